@@ -0,0 +1,96 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	genericapiserver "k8s.io/apiserver/pkg/server"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+
+	"github.com/kcp-dev/kcp/pkg/cacheserver"
+)
+
+const resyncPeriod = 10 * time.Hour
+
+func defaultOptions() *options {
+	return &options{
+		port: 6444,
+	}
+}
+
+func bindOptions(defaultOptions *options, fs *pflag.FlagSet) *options {
+	fs.StringVar(&defaultOptions.rootKubeconfigPath, "root-kubeconfig", "", "Path to the kubeconfig of the root shard.")
+	fs.IntVar(&defaultOptions.port, "port", defaultOptions.port, "Port to serve the cached objects on.")
+	return defaultOptions
+}
+
+type options struct {
+	// rootKubeconfigPath should hold a kubeconfig with credentials to list and watch
+	// the cached resources in all logical clusters of the root shard
+	rootKubeconfigPath string
+	port               int
+}
+
+func (o *options) Validate() error {
+	if o.rootKubeconfigPath == "" {
+		return errors.New("--root-kubeconfig is required")
+	}
+	return nil
+}
+
+func main() {
+	ctx := genericapiserver.SetupSignalContext()
+
+	fs := pflag.NewFlagSet("cache-server", pflag.ContinueOnError)
+	o := bindOptions(defaultOptions(), fs)
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		klog.Fatalf("failed to parse arguments: %v", err)
+	}
+	if err := o.Validate(); err != nil {
+		klog.Fatalf("invalid options: %v", err)
+	}
+
+	rootConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(&clientcmd.ClientConfigLoadingRules{ExplicitPath: o.rootKubeconfigPath}, nil).ClientConfig()
+	if err != nil {
+		klog.Fatalf("failed to load root credentials: %v", err)
+	}
+	rootClusterClient, err := dynamic.NewClusterForConfig(rootConfig)
+	if err != nil {
+		klog.Fatalf("failed to create root client: %v", err)
+	}
+
+	informers := dynamicinformer.NewDynamicSharedInformerFactory(rootClusterClient.Cluster("*"), resyncPeriod)
+	stores := map[schema.GroupVersionResource]cacheserver.Store{}
+	for gvr := range cacheserver.Resources {
+		stores[gvr] = cacheserver.InformerStore(informers.ForResource(gvr).Informer())
+	}
+	server := cacheserver.NewServer(o.port, informers, stores)
+
+	informers.Start(ctx.Done())
+	go server.ListenAndServe(ctx)
+
+	<-ctx.Done()
+}
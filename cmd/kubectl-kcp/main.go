@@ -27,6 +27,11 @@ import (
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/klog/v2"
 
+	bindcmd "github.com/kcp-dev/kcp/pkg/cliplugins/bind/cmd"
+	crdcmd "github.com/kcp-dev/kcp/pkg/cliplugins/crd/cmd"
+	encryptioncmd "github.com/kcp-dev/kcp/pkg/cliplugins/encryption/cmd"
+	logincmd "github.com/kcp-dev/kcp/pkg/cliplugins/login/cmd"
+	workloadcmd "github.com/kcp-dev/kcp/pkg/cliplugins/workload/cmd"
 	"github.com/kcp-dev/kcp/pkg/cliplugins/workspace/cmd"
 	"github.com/kcp-dev/kcp/pkg/cmd/help"
 )
@@ -64,6 +69,11 @@ func main() {
 		os.Exit(1)
 	}
 	root.AddCommand(workspaceCmd)
+	root.AddCommand(bindcmd.NewCmdBind(genericclioptions.IOStreams{In: os.Stdin, Out: os.Stdout, ErrOut: os.Stderr}))
+	root.AddCommand(crdcmd.NewCmdCRD(genericclioptions.IOStreams{In: os.Stdin, Out: os.Stdout, ErrOut: os.Stderr}))
+	root.AddCommand(encryptioncmd.NewCmdEncryption(genericclioptions.IOStreams{In: os.Stdin, Out: os.Stdout, ErrOut: os.Stderr}))
+	root.AddCommand(logincmd.NewCmdLogin(genericclioptions.IOStreams{In: os.Stdin, Out: os.Stdout, ErrOut: os.Stderr}))
+	root.AddCommand(workloadcmd.NewCmdWorkload(genericclioptions.IOStreams{In: os.Stdin, Out: os.Stdout, ErrOut: os.Stderr}))
 
 	if err := root.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
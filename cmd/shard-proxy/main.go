@@ -46,6 +46,7 @@ func bindOptions(defaultOptions *options, fs *pflag.FlagSet) *options {
 	fs.StringVar(&defaultOptions.rootKubeconfigPath, "root-kubeconfig", "", "Path to root kubeconfig.")
 	fs.IntVar(&defaultOptions.numThreads, "threads", defaultOptions.numThreads, "Number of threads to use.")
 	fs.IntVar(&defaultOptions.port, "port", defaultOptions.port, "Port to serve index on.")
+	fs.StringVar(&defaultOptions.metricsBindAddress, "metrics-bind-address", defaultOptions.metricsBindAddress, "Address to serve the federated metrics of all the shards on, without authentication. Disabled when empty.")
 	return defaultOptions
 }
 
@@ -55,6 +56,9 @@ type options struct {
 	rootKubeconfigPath string
 	numThreads         int
 	port               int
+	// metricsBindAddress is the address serving the metrics of all the shards. They
+	// are served without authentication, so it should only be reachable by Prometheus.
+	metricsBindAddress string
 }
 
 func (o *options) Validate() error {
@@ -100,7 +104,8 @@ func main() {
 	if err != nil {
 		klog.Fatalf("failed to create workspace index controller: %v", err)
 	}
-	server := workspaceindex.NewServer(o.port, kcpSharedInformerFactory, index, controller.Stable)
+	metrics := workspaceindex.NewMetricsFederator(rootKubeClient, kcpSharedInformerFactory.Tenancy().V1alpha1().WorkspaceShards().Lister())
+	server := workspaceindex.NewServer(o.port, kcpSharedInformerFactory, index, controller.Stable, o.metricsBindAddress, metrics)
 
 	kcpSharedInformerFactory.Start(ctx.Done())
 	kcpSharedInformerFactory.WaitForCacheSync(ctx.Done())
@@ -20,6 +20,7 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"path"
@@ -28,6 +29,8 @@ import (
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/component-base/metrics/legacyregistry"
+	_ "k8s.io/component-base/metrics/prometheus/workqueue" // queue depth and latency of the syncers
 	"k8s.io/klog/v2"
 
 	nscontroller "github.com/kcp-dev/kcp/pkg/reconciler/namespace"
@@ -42,7 +45,8 @@ var (
 	toKubeconfig    = flag.String("to_kubeconfig", "", "Kubeconfig file for -to cluster. If not set, the InCluster configuration will be used.")
 	toContext       = flag.String("to_context", "", "Context to use in the Kubeconfig file for -to cluster, instead of the current context.")
 	pclusterID      = flag.String("cluster", "",
-		fmt.Sprintf("ID of the -to cluster. Resources with this ID set in the '%s' label will be synced.", nscontroller.ClusterLabel))
+		fmt.Sprintf("ID of the -to cluster. Resources with the '%s<ID>' label will be synced.", nscontroller.ClusterLabelPrefix))
+	metricsAddress = flag.String("metrics_address", ":8080", "Address to serve the syncer metrics on, at /metrics. Metrics are not served if empty.")
 )
 
 func main() {
@@ -92,6 +96,17 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGILL, syscall.SIGINT)
 	defer cancel()
 
+	if *metricsAddress != "" {
+		syncer.RegisterMetrics()
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", legacyregistry.Handler())
+		go func() {
+			if err := http.ListenAndServe(*metricsAddress, mux); err != nil {
+				klog.Errorf("Failed to serve metrics on %s: %v", *metricsAddress, err)
+			}
+		}()
+	}
+
 	klog.Infoln("Starting workers")
 	if err := syncer.StartSyncer(ctx, fromConfig, toConfig, sets.NewString(syncedResourceTypes...), *fromClusterName, *pclusterID, numThreads); err != nil {
 		klog.Fatal(err)
@@ -28,7 +28,10 @@ import (
 
 	genericapiserver "k8s.io/apiserver/pkg/server"
 
+	virtualapiexportcmd "github.com/kcp-dev/kcp/pkg/virtual/apiexport/cmd"
+	virtualeventscmd "github.com/kcp-dev/kcp/pkg/virtual/events/cmd"
 	virtualgenericcmd "github.com/kcp-dev/kcp/pkg/virtual/framework/cmd"
+	virtualsyncercmd "github.com/kcp-dev/kcp/pkg/virtual/syncer/cmd"
 	virtualworkspacescmd "github.com/kcp-dev/kcp/pkg/virtual/workspaces/cmd"
 )
 
@@ -47,17 +50,11 @@ func main() {
 }
 
 func NewVirtualWorkspaceApiServerCommand(stopCh <-chan struct{}) *cobra.Command {
-	cmd := &cobra.Command{
-		Use:   "virtual-workspaces",
-		Short: "Command for virtual workspaces API Servers",
-		Run: func(cmd *cobra.Command, args []string) {
-			_ = cmd.Help()
-			os.Exit(1)
-		},
-	}
-	workspacesAPIServerSubCommandOptions := &virtualworkspacescmd.WorkspacesSubCommandOptions{}
-	workspacesAPIServerSubCommand := virtualgenericcmd.APIServerCommand(os.Stdout, os.Stderr, stopCh, workspacesAPIServerSubCommandOptions)
-	cmd.AddCommand(workspacesAPIServerSubCommand)
+	registry := virtualgenericcmd.NewRegistry()
+	registry.Register(&virtualworkspacescmd.WorkspacesSubCommandOptions{})
+	registry.Register(&virtualsyncercmd.SyncerSubCommandOptions{})
+	registry.Register(&virtualapiexportcmd.APIExportSubCommandOptions{})
+	registry.Register(&virtualeventscmd.EventsSubCommandOptions{})
 
-	return cmd
+	return registry.Command("virtual-workspaces", os.Stdout, os.Stderr, stopCh)
 }
@@ -73,26 +73,39 @@ func Create(ctx context.Context, client apiextensionsv1client.CustomResourceDefi
 	return CreateFromFS(ctx, client, raw, grs...)
 }
 
-// CreateFromFS creates the given CRD using the target client from the
-// provided filesystem and waits for it to become established. This call is blocking.
-func createSingleFromFS(ctx context.Context, client apiextensionsv1client.CustomResourceDefinitionInterface, gr metav1.GroupResource, fs embed.FS) error {
-	start := time.Now()
-	klog.V(4).Infof("Bootstrapping %v", gr.String())
+// Get returns the CRD of the given group resource.
+func Get(gr metav1.GroupResource) (*apiextensionsv1.CustomResourceDefinition, error) {
+	return getFromFS(raw, gr)
+}
+
+func getFromFS(fs embed.FS, gr metav1.GroupResource) (*apiextensionsv1.CustomResourceDefinition, error) {
 	raw, err := fs.ReadFile(fmt.Sprintf("%s_%s.yaml", gr.Group, gr.Resource))
 	if err != nil {
-		return fmt.Errorf("could not read CRD %s: %w", gr.String(), err)
+		return nil, fmt.Errorf("could not read CRD %s: %w", gr.String(), err)
 	}
 	expectedGvk := &schema.GroupVersionKind{Group: apiextensionsv1.GroupName, Version: "v1", Kind: "CustomResourceDefinition"}
 	obj, gvk, err := extensionsapiserver.Codecs.UniversalDeserializer().Decode(raw, expectedGvk, &apiextensionsv1.CustomResourceDefinition{})
 	if err != nil {
-		return fmt.Errorf("could not decode raw CRD %s: %w", gr.String(), err)
+		return nil, fmt.Errorf("could not decode raw CRD %s: %w", gr.String(), err)
 	}
 	if !equality.Semantic.DeepEqual(gvk, expectedGvk) {
-		return fmt.Errorf("decoded CRD %s into incorrect GroupVersionKind, got %#v, wanted %#v", gr.String(), gvk, expectedGvk)
+		return nil, fmt.Errorf("decoded CRD %s into incorrect GroupVersionKind, got %#v, wanted %#v", gr.String(), gvk, expectedGvk)
 	}
-	rawCrd, ok := obj.(*apiextensionsv1.CustomResourceDefinition)
+	crd, ok := obj.(*apiextensionsv1.CustomResourceDefinition)
 	if !ok {
-		return fmt.Errorf("decoded CRD %s into incorrect type, got %T, wanted %T", gr.String(), rawCrd, &apiextensionsv1.CustomResourceDefinition{})
+		return nil, fmt.Errorf("decoded CRD %s into incorrect type, got %T, wanted %T", gr.String(), obj, &apiextensionsv1.CustomResourceDefinition{})
+	}
+	return crd, nil
+}
+
+// CreateFromFS creates the given CRD using the target client from the
+// provided filesystem and waits for it to become established. This call is blocking.
+func createSingleFromFS(ctx context.Context, client apiextensionsv1client.CustomResourceDefinitionInterface, gr metav1.GroupResource, fs embed.FS) error {
+	start := time.Now()
+	klog.V(4).Infof("Bootstrapping %v", gr.String())
+	rawCrd, err := getFromFS(fs, gr)
+	if err != nil {
+		return err
 	}
 
 	crdResource, err := client.Get(ctx, rawCrd.Name, metav1.GetOptions{})
@@ -24,6 +24,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sync"
 	"time"
 
 	extensionsapiserver "k8s.io/apiextensions-apiserver/pkg/apiserver"
@@ -70,6 +71,10 @@ func ReplaceOption(pairs ...string) Option {
 // Bootstrap creates a list of CRDs and then the resources in a package's fs by
 // continuously retrying the list. This is blocking, i.e. it only returns (with error)
 // when the context is closed or with nil when the bootstrapping is successfully completed.
+//
+// The resources are created in parallel. The ones created successfully are checkpointed,
+// i.e. only the failed ones are retried, e.g. those waiting for another resource of the
+// list to be admitted.
 func Bootstrap(ctx context.Context, crdClient apiextensionsclient.Interface, dynamicClient dynamic.Interface, fs embed.FS, crds []metav1.GroupResource, opts ...Option) error {
 	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(crdClient.Discovery()))
 
@@ -88,53 +93,66 @@ func Bootstrap(ctx context.Context, crdClient apiextensionsclient.Interface, dyn
 	for _, opt := range opts {
 		transformers = append(transformers, opt.TransformFile)
 	}
-	return wait.PollImmediateInfiniteWithContext(ctx, time.Second, func(ctx context.Context) (bool, error) {
-		if err := CreateResourcesFromFS(ctx, dynamicClient, mapper, fs, transformers...); err != nil {
-			klog.Infof("Failed to bootstrap resources, retrying: %v", err)
+	docs, err := documentsFromFS(fs, transformers...)
+	if err != nil {
+		return err
+	}
+	return wait.PollImmediateInfiniteWithContext(ctx, resourceRetryInterval, func(ctx context.Context) (bool, error) {
+		if docs = createDocuments(ctx, dynamicClient, mapper, docs); len(docs) > 0 {
 			return false, nil
 		}
 		return true, nil
 	})
 }
 
-// CreateResourcesFromFS creates all resources from a filesystem.
-func CreateResourcesFromFS(ctx context.Context, client dynamic.Interface, mapper meta.RESTMapper, fs embed.FS, transformers ...TransformFileFunc) error {
+// resourceRetryInterval is the interval the failed resources are retried at. It is short
+// as resources mostly fail because of other resources of the same bootstrap not being
+// visible to admission yet.
+const resourceRetryInterval = 200 * time.Millisecond
+
+// document is a YAML document of a resource file.
+type document struct {
+	filename string
+	index    int
+	raw      []byte
+}
+
+// documentsFromFS reads and transforms the YAML documents of all the files of a filesystem.
+func documentsFromFS(fs embed.FS, transformers ...TransformFileFunc) ([]document, error) {
 	files, err := fs.ReadDir(".")
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	var errs []error
+	var docs []document
 	for _, f := range files {
 		if f.IsDir() {
 			continue
 		}
-		if err := CreateResourceFromFS(ctx, client, mapper, f.Name(), fs, transformers...); err != nil {
-			errs = append(errs, err)
+		fileDocs, err := documentsFromFile(fs, f.Name(), transformers...)
+		if err != nil {
+			return nil, err
 		}
+		docs = append(docs, fileDocs...)
 	}
-	return apimachineryerrors.NewAggregate(errs)
+	return docs, nil
 }
 
-// CreateResourceFromFS creates given resource file.
-func CreateResourceFromFS(ctx context.Context, client dynamic.Interface, mapper meta.RESTMapper, filename string, fs embed.FS, transformers ...TransformFileFunc) error {
+// documentsFromFile reads and transforms the YAML documents of a file.
+func documentsFromFile(fs embed.FS, filename string, transformers ...TransformFileFunc) ([]document, error) {
 	raw, err := fs.ReadFile(filename)
 	if err != nil {
-		return fmt.Errorf("could not read %s: %w", filename, err)
-	}
-
-	if len(raw) == 0 {
-		return nil // ignore empty files
+		return nil, fmt.Errorf("could not read %s: %w", filename, err)
 	}
 
 	d := kubeyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(raw)))
-	var errs []error
+	var docs []document
 	for i := 1; ; i++ {
 		doc, err := d.Read()
 		if errors.Is(err, io.EOF) {
 			break
 		} else if err != nil {
-			return err
+			return nil, err
 		}
 		if len(bytes.TrimSpace(doc)) == 0 {
 			continue
@@ -143,12 +161,68 @@ func CreateResourceFromFS(ctx context.Context, client dynamic.Interface, mapper
 		for _, transformer := range transformers {
 			doc, err = transformer(doc)
 			if err != nil {
-				return err
+				return nil, err
 			}
 		}
+		docs = append(docs, document{filename: filename, index: i, raw: doc})
+	}
+	return docs, nil
+}
+
+// createDocuments creates or updates the resources of the given documents in parallel, and
+// returns the documents which failed.
+func createDocuments(ctx context.Context, client dynamic.Interface, mapper meta.RESTMapper, docs []document) []document {
+	errs := make([]error, len(docs))
+	var wg sync.WaitGroup
+	for i := range docs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = createResourceFromFS(ctx, client, mapper, docs[i].raw)
+		}(i)
+	}
+	wg.Wait()
+
+	var failed []document
+	for i, err := range errs {
+		if err != nil {
+			klog.Infof("Failed to bootstrap resource %s doc %d, retrying: %v", docs[i].filename, docs[i].index, err)
+			failed = append(failed, docs[i])
+		}
+	}
+	return failed
+}
 
-		if err := createResourceFromFS(ctx, client, mapper, doc); err != nil {
-			errs = append(errs, fmt.Errorf("failed to create resource %s doc %d: %w", filename, i, err))
+// CreateResourcesFromFS creates all resources from a filesystem.
+func CreateResourcesFromFS(ctx context.Context, client dynamic.Interface, mapper meta.RESTMapper, fs embed.FS, transformers ...TransformFileFunc) error {
+	files, err := fs.ReadDir(".")
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		if err := CreateResourceFromFS(ctx, client, mapper, f.Name(), fs, transformers...); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return apimachineryerrors.NewAggregate(errs)
+}
+
+// CreateResourceFromFS creates given resource file.
+func CreateResourceFromFS(ctx context.Context, client dynamic.Interface, mapper meta.RESTMapper, filename string, fs embed.FS, transformers ...TransformFileFunc) error {
+	docs, err := documentsFromFile(fs, filename, transformers...)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, doc := range docs {
+		if err := createResourceFromFS(ctx, client, mapper, doc.raw); err != nil {
+			errs = append(errs, fmt.Errorf("failed to create resource %s doc %d: %w", filename, doc.index, err))
 		}
 	}
 	return apimachineryerrors.NewAggregate(errs)
@@ -38,5 +38,6 @@ func Bootstrap(ctx context.Context, crdClient apiextensionsclient.Interface, dyn
 	return confighelpers.Bootstrap(ctx, crdClient, dynamicClient, fs, []metav1.GroupResource{
 		{Group: tenancy.GroupName, Resource: "clusterworkspaces"},
 		{Group: tenancy.GroupName, Resource: "clusterworkspacetypes"},
+		{Group: tenancy.GroupName, Resource: "workspaceresourcequotas"},
 	})
 }
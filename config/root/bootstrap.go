@@ -19,13 +19,10 @@ package root
 import (
 	"context"
 	"embed"
-	"encoding/base64"
 
 	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/dynamic"
-	"k8s.io/client-go/tools/clientcmd"
-	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 
 	confighelpers "github.com/kcp-dev/kcp/config/helpers"
 	"github.com/kcp-dev/kcp/pkg/apis/tenancy"
@@ -37,18 +34,11 @@ var fs embed.FS
 // Bootstrap creates CRDs and the resources in this package by continuously retrying the list.
 // This is blocking, i.e. it only returns (with error) when the context is closed or with nil when
 // the bootstrapping is successfully completed.
-func Bootstrap(ctx context.Context, rootCrdClient apiextensionsclient.Interface, rootDynamicClient dynamic.Interface, shardName string, kubeconfig clientcmdapi.Config) error {
-	kubeconfigRaw, err := clientcmd.Write(kubeconfig)
-	if err != nil {
-		return err
-	}
-
+func Bootstrap(ctx context.Context, rootCrdClient apiextensionsclient.Interface, rootDynamicClient dynamic.Interface) error {
 	return confighelpers.Bootstrap(ctx, rootCrdClient, rootDynamicClient, fs, []metav1.GroupResource{
 		{Group: tenancy.GroupName, Resource: "clusterworkspaces"},
 		{Group: tenancy.GroupName, Resource: "clusterworkspacetypes"},
+		{Group: tenancy.GroupName, Resource: "workspaceresourcequotas"},
 		{Group: tenancy.GroupName, Resource: "workspaceshards"},
-	}, confighelpers.ReplaceOption(
-		"SHARD_NAME", shardName,
-		"SHARD_KUBECONFIG", base64.StdEncoding.EncodeToString(kubeconfigRaw),
-	))
+	})
 }
@@ -0,0 +1,316 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemexports
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog/v2"
+	"k8s.io/kube-aggregator/pkg/apis/apiregistration"
+
+	configcrds "github.com/kcp-dev/kcp/config/crds"
+	"github.com/kcp-dev/kcp/pkg/apis/apiresource"
+	"github.com/kcp-dev/kcp/pkg/apis/apis"
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy"
+	"github.com/kcp-dev/kcp/pkg/apis/workload"
+	kcpclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
+)
+
+// Export is an APIExport of kcp's own APIs in the root workspace.
+type Export struct {
+	// Name is the name of the APIExport.
+	Name string
+	// Resources are the exported resources, each backed by the CRD of the resource.
+	Resources []metav1.GroupResource
+}
+
+var (
+	TenancyExport = Export{
+		Name: tenancy.GroupName,
+		Resources: []metav1.GroupResource{
+			{Group: tenancy.GroupName, Resource: "clusterworkspaces"},
+			{Group: tenancy.GroupName, Resource: "clusterworkspacetypes"},
+			{Group: tenancy.GroupName, Resource: "workspaceresourcequotas"},
+		},
+	}
+	WorkloadExport = Export{
+		Name: workload.GroupName,
+		Resources: []metav1.GroupResource{
+			{Group: workload.GroupName, Resource: "workloadclusters"},
+			{Group: workload.GroupName, Resource: "locations"},
+			{Group: workload.GroupName, Resource: "placements"},
+		},
+	}
+	APIResourceExport = Export{
+		Name: apiresource.GroupName,
+		Resources: []metav1.GroupResource{
+			{Group: apiresource.GroupName, Resource: "apiresourceimports"},
+			{Group: apiresource.GroupName, Resource: "negotiatedapiresources"},
+		},
+	}
+	// APIRegistrationExport offers the APIServices of aggregated APIs in workspaces.
+	APIRegistrationExport = Export{
+		Name: apiregistration.GroupName,
+		Resources: []metav1.GroupResource{
+			{Group: apiregistration.GroupName, Resource: "apiservices"},
+		},
+	}
+
+	// exportsByType are the exports bound in new workspaces of the given type.
+	exportsByType = map[string][]Export{
+		"Organization": {TenancyExport},
+		"Universal":    {WorkloadExport, APIResourceExport, APIRegistrationExport},
+	}
+
+	// apisCRDs are the CRDs of the APIs to export and bind APIs.
+	apisCRDs = []metav1.GroupResource{
+		{Group: apis.GroupName, Resource: "apiresourceschemas"},
+		{Group: apis.GroupName, Resource: "apiexports"},
+		{Group: apis.GroupName, Resource: "apiexportendpointslices"},
+		{Group: apis.GroupName, Resource: "apibindings"},
+	}
+)
+
+// ForType returns the exports bound in new workspaces of the given type.
+func ForType(workspaceType string) []Export {
+	return exportsByType[workspaceType]
+}
+
+// Bootstrap creates the APIResourceSchemas and APIExports of kcp's own APIs in the root
+// workspace by continuously retrying. This is blocking, i.e. it only returns (with error)
+// when the context is closed or with nil when the bootstrapping is successfully completed.
+func Bootstrap(ctx context.Context, rootCrdClient apiextensionsclient.Interface, rootKcpClient kcpclient.Interface) error {
+	if err := wait.PollImmediateInfiniteWithContext(ctx, time.Second, func(ctx context.Context) (bool, error) {
+		if err := configcrds.Create(ctx, rootCrdClient.ApiextensionsV1().CustomResourceDefinitions(), apisCRDs...); err != nil {
+			klog.Errorf("failed to bootstrap CRDs: %v", err)
+			return false, nil // keep retrying
+		}
+		return true, nil
+	}); err != nil {
+		return fmt.Errorf("failed to bootstrap CRDs: %w", err)
+	}
+
+	// the exports are ensured in parallel, retrying only the failed ones
+	pending := []Export{TenancyExport, WorkloadExport, APIResourceExport, APIRegistrationExport}
+	return wait.PollImmediateInfiniteWithContext(ctx, time.Second, func(ctx context.Context) (bool, error) {
+		errs := make([]error, len(pending))
+		var wg sync.WaitGroup
+		for i := range pending {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = ensureExport(ctx, rootKcpClient, pending[i])
+			}(i)
+		}
+		wg.Wait()
+
+		var failed []Export
+		for i, err := range errs {
+			if err != nil {
+				klog.Infof("Failed to bootstrap APIExport %s, retrying: %v", pending[i].Name, err)
+				failed = append(failed, pending[i])
+			}
+		}
+		pending = failed
+		return len(pending) == 0, nil
+	})
+}
+
+func ensureExport(ctx context.Context, kcpClient kcpclient.Interface, export Export) error {
+	schemaNames := make([]string, 0, len(export.Resources))
+	for _, gr := range export.Resources {
+		crd, err := configcrds.Get(gr)
+		if err != nil {
+			return err
+		}
+		s, err := SchemaFromCRD(crd)
+		if err != nil {
+			return err
+		}
+		// schemas are immutable and named after their content
+		if _, err := kcpClient.ApisV1alpha1().APIResourceSchemas().Create(ctx, s, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+			return err
+		}
+		schemaNames = append(schemaNames, s.Name)
+	}
+
+	existing, err := kcpClient.ApisV1alpha1().APIExports().Get(ctx, export.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		created, err := kcpClient.ApisV1alpha1().APIExports().Create(ctx, &apisv1alpha1.APIExport{
+			ObjectMeta: metav1.ObjectMeta{Name: export.Name},
+			Spec:       apisv1alpha1.APIExportSpec{LatestResourceSchemas: schemaNames},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return err
+		}
+		klog.Infof("Bootstrapped APIExport %s|%s", created.ClusterName, created.Name)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if equality.Semantic.DeepEqual(existing.Spec.LatestResourceSchemas, schemaNames) {
+		return nil
+	}
+	existing = existing.DeepCopy()
+	existing.Spec.LatestResourceSchemas = schemaNames
+	updated, err := kcpClient.ApisV1alpha1().APIExports().Update(ctx, existing, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	klog.Infof("Updated APIExport %s|%s", updated.ClusterName, updated.Name)
+	return nil
+}
+
+// SchemaFromCRD returns an APIResourceSchema equivalent to the given CRD. The schema is named
+// after a hash of its spec, such that every change to the CRD results in a new schema.
+func SchemaFromCRD(crd *apiextensionsv1.CustomResourceDefinition) (*apisv1alpha1.APIResourceSchema, error) {
+	spec := apisv1alpha1.APIResourceSchemaSpec{
+		Group: crd.Spec.Group,
+		Names: crd.Spec.Names,
+		Scope: crd.Spec.Scope,
+	}
+	for _, v := range crd.Spec.Versions {
+		var raw []byte
+		if v.Schema != nil && v.Schema.OpenAPIV3Schema != nil {
+			var err error
+			if raw, err = json.Marshal(v.Schema.OpenAPIV3Schema); err != nil {
+				return nil, fmt.Errorf("failed to encode schema of version %q of CRD %s: %w", v.Name, crd.Name, err)
+			}
+		}
+		spec.Versions = append(spec.Versions, apisv1alpha1.APIResourceVersion{
+			Name:                     v.Name,
+			Served:                   v.Served,
+			Storage:                  v.Storage,
+			Deprecated:               v.Deprecated,
+			DeprecationWarning:       v.DeprecationWarning,
+			Schema:                   runtime.RawExtension{Raw: raw},
+			Subresources:             v.Subresources,
+			AdditionalPrinterColumns: v.AdditionalPrinterColumns,
+		})
+	}
+
+	bs, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(bs)
+
+	return &apisv1alpha1.APIResourceSchema{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: fmt.Sprintf("v%x.%s.%s", hash[:4], spec.Names.Plural, spec.Group),
+		},
+		Spec: spec,
+	}, nil
+}
+
+// WithBindings wraps the bootstrap function of a workspace type such that it also binds the
+// given APIExports of the root workspace in the bootstrapped workspace.
+func WithBindings(
+	bootstrap func(context.Context, apiextensionsclient.Interface, dynamic.Interface) error,
+	rootKcpClient kcpclient.Interface,
+	exports ...Export,
+) func(context.Context, apiextensionsclient.Interface, dynamic.Interface) error {
+	return func(ctx context.Context, crdClient apiextensionsclient.Interface, dynamicClient dynamic.Interface) error {
+		if err := bootstrap(ctx, crdClient, dynamicClient); err != nil {
+			return err
+		}
+		if len(exports) == 0 {
+			return nil
+		}
+
+		if err := wait.PollImmediateInfiniteWithContext(ctx, time.Second, func(ctx context.Context) (bool, error) {
+			if err := configcrds.Create(ctx, crdClient.ApiextensionsV1().CustomResourceDefinitions(), metav1.GroupResource{Group: apis.GroupName, Resource: "apibindings"}); err != nil {
+				klog.Errorf("failed to bootstrap CRDs: %v", err)
+				return false, nil // keep retrying
+			}
+			return true, nil
+		}); err != nil {
+			return fmt.Errorf("failed to bootstrap CRDs: %w", err)
+		}
+
+		// bindings are not retried here: a rejected binding does not heal by itself, and
+		// the failure is surfaced on the workspace by the caller, which retries later.
+		var errs []error
+		for _, export := range exports {
+			if err := bind(ctx, dynamicClient, rootKcpClient, export); err != nil {
+				errs = append(errs, fmt.Errorf("failed to bind APIExport %s: %w", export.Name, err))
+			}
+		}
+		return utilerrors.NewAggregate(errs)
+	}
+}
+
+// bind creates an APIBinding to the given export of the root workspace, presenting the
+// current identity of the export.
+//
+// The bound resources are also served by the CRDs of the workspace type, which are still
+// installed in the workspace as APIBindings are not served in this tree. The binding uses
+// the LocalWins conflict policy: the local CRDs keep serving the resources, and the binding
+// is accepted instead of being rejected for conflicting with them.
+func bind(ctx context.Context, dynamicClient dynamic.Interface, rootKcpClient kcpclient.Interface, export Export) error {
+	e, err := rootKcpClient.ApisV1alpha1().APIExports().Get(ctx, export.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	binding := &apisv1alpha1.APIBinding{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: apisv1alpha1.SchemeGroupVersion.String(),
+			Kind:       "APIBinding",
+		},
+		ObjectMeta: metav1.ObjectMeta{Name: export.Name},
+		Spec: apisv1alpha1.APIBindingSpec{
+			Reference: apisv1alpha1.ExportReference{
+				Root: &apisv1alpha1.RootExportReference{
+					ExportName:   e.Name,
+					IdentityHash: e.Status.IdentityHash,
+				},
+			},
+			ConflictPolicy: apisv1alpha1.APIBindingConflictPolicyLocalWins,
+		},
+	}
+	raw, err := runtime.DefaultUnstructuredConverter.ToUnstructured(binding)
+	if err != nil {
+		return err
+	}
+
+	created, err := dynamicClient.Resource(apisv1alpha1.SchemeGroupVersion.WithResource("apibindings")).Create(ctx, &unstructured.Unstructured{Object: raw}, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	klog.Infof("Bootstrapped APIBinding %s|%s", created.GetClusterName(), created.GetName())
+	return nil
+}
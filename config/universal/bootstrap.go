@@ -40,5 +40,7 @@ func Bootstrap(ctx context.Context, crdClient apiextensionsclient.Interface, dyn
 		{Group: apiresource.GroupName, Resource: "apiresourceimports"},
 		{Group: apiresource.GroupName, Resource: "negotiatedapiresources"},
 		{Group: workload.GroupName, Resource: "workloadclusters"},
+		{Group: workload.GroupName, Resource: "locations"},
+		{Group: workload.GroupName, Resource: "placements"},
 	})
 }
@@ -0,0 +1,314 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apibinding
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsinformers "k8s.io/apiextensions-apiserver/pkg/client/informers/externalversions"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/kubernetes"
+
+	kcpadmissionhelpers "github.com/kcp-dev/kcp/pkg/admission/helpers"
+	kcpinitializers "github.com/kcp-dev/kcp/pkg/admission/initializers"
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+	apishelper "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1/helper"
+	tenancyhelper "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+	kcpinformers "github.com/kcp-dev/kcp/pkg/client/informers/externalversions"
+)
+
+const (
+	PluginName = "apis.kcp.dev/APIBinding"
+)
+
+func Register(plugins *admission.Plugins) {
+	plugins.Register(PluginName,
+		func(_ io.Reader) (admission.Interface, error) {
+			return &apiBindingAdmission{
+				Handler:          admission.NewHandler(admission.Create, admission.Update),
+				createAuthorizer: kcpadmissionhelpers.NewAdmissionAuthorizer,
+			}, nil
+		})
+}
+
+// apiBindingAdmission validates that APIBindings present the identity hash of the
+// APIExport they reference, so that they can only bind to the intended service provider,
+// that the user is allowed to bind to APIExports referenced by workspace, and that the
+// bound resources do not conflict with the CRDs and APIBindings of the workspace.
+type apiBindingAdmission struct {
+	*admission.Handler
+	apiExportIndex         *kcpadmissionhelpers.ClusterIndex
+	apiBindingIndex        *kcpadmissionhelpers.ClusterIndex
+	apiResourceSchemaIndex *kcpadmissionhelpers.ClusterIndex
+	crdIndex               *kcpadmissionhelpers.ClusterIndex
+	crdsSynced             func() bool
+	hasSynced              func() bool
+	kubeClusterClient      *kubernetes.Cluster
+
+	createAuthorizer kcpadmissionhelpers.AdmissionAuthorizerFactory
+}
+
+// Ensure that the required admission interfaces are implemented.
+var _ = admission.ValidationInterface(&apiBindingAdmission{})
+var _ = admission.InitializationValidator(&apiBindingAdmission{})
+var _ = kcpadmissionhelpers.ReadinessReporter(&apiBindingAdmission{})
+var _ = kcpinitializers.WantsKcpInformers(&apiBindingAdmission{})
+var _ = kcpinitializers.WantsKubeClusterClient(&apiBindingAdmission{})
+var _ = kcpinitializers.WantsAPIExtensionsInformers(&apiBindingAdmission{})
+
+// Validate checks, when an APIBinding is created or its reference changes, that the
+// user has the `bind` verb on the APIExport referenced by workspace, in the workspace
+// of the APIExport, and that the referenced APIExport has the identity hash presented
+// by the APIBinding. When an APIBinding is created, or its reference or conflict policy
+// changes, it checks that the resources of the APIExport do not conflict with the
+// resources of the workspace, unless the conflict policy resolves the conflicts.
+func (o *apiBindingAdmission) Validate(ctx context.Context, a admission.Attributes, _ admission.ObjectInterfaces) (err error) {
+	if a.GetResource().GroupResource() != apisv1alpha1.Resource("apibindings") {
+		return nil
+	}
+
+	obj, err := kcpadmissionhelpers.NativeObject(a.GetObject())
+	if err != nil {
+		// nolint: nilerr
+		return nil // only work on unstructured APIBindings
+	}
+	binding, ok := obj.(*apisv1alpha1.APIBinding)
+	if !ok {
+		// nolint: nilerr
+		return nil // only work on unstructured APIBindings
+	}
+
+	referenceChanged := true
+	if a.GetOperation() == admission.Update {
+		obj, err = kcpadmissionhelpers.NativeObject(a.GetOldObject())
+		if err != nil {
+			return fmt.Errorf("unexpected unknown old object, got %v, expected APIBinding", a.GetOldObject().GetObjectKind().GroupVersionKind().Kind)
+		}
+		old, ok := obj.(*apisv1alpha1.APIBinding)
+		if !ok {
+			return fmt.Errorf("unexpected unknown old object, got %v, expected APIBinding", obj.GetObjectKind().GroupVersionKind().Kind)
+		}
+		referenceChanged = !reflect.DeepEqual(old.Spec.Reference, binding.Spec.Reference)
+		if !referenceChanged && old.Spec.ConflictPolicy == binding.Spec.ConflictPolicy {
+			return nil
+		}
+	}
+
+	if errs := validateWorkspaceReference(binding.Spec.Reference.Workspace, field.NewPath("spec", "reference", "workspace")); len(errs) > 0 {
+		return admission.NewForbidden(a, errs.ToAggregate())
+	}
+
+	clusterName, err := genericapirequest.ClusterNameFrom(ctx)
+	if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+	exportClusterName, exportName, ok := apishelper.ExportClusterName(clusterName, binding.Spec.Reference)
+	if !ok {
+		return nil
+	}
+
+	if !o.WaitForReady() {
+		return kcpadmissionhelpers.NewNotReadyError(a)
+	}
+
+	if referenceChanged && binding.Spec.Reference.Workspace != nil {
+		authz, err := o.createAuthorizer(exportClusterName, o.kubeClusterClient)
+		if err != nil {
+			return admission.NewForbidden(a, fmt.Errorf("unable to determine access to APIExport %q in workspace %q: %w", exportName, exportClusterName, err))
+		}
+		bindAttr := authorizer.AttributesRecord{
+			User:            a.GetUserInfo(),
+			Verb:            "bind",
+			APIGroup:        apisv1alpha1.SchemeGroupVersion.Group,
+			APIVersion:      apisv1alpha1.SchemeGroupVersion.Version,
+			Resource:        "apiexports",
+			Name:            exportName,
+			ResourceRequest: true,
+		}
+		if decision, _, err := authz.Authorize(ctx, bindAttr); err != nil {
+			return admission.NewForbidden(a, fmt.Errorf("unable to determine access to APIExport %q in workspace %q: %w", exportName, exportClusterName, err))
+		} else if decision != authorizer.DecisionAllow {
+			return admission.NewForbidden(a, fmt.Errorf("unable to bind to APIExport %q in workspace %q: missing verb='bind' permission on apiexports", exportName, exportClusterName))
+		}
+	}
+
+	exportObj, err := o.apiExportIndex.Get(exportClusterName, exportName)
+	if apierrors.IsNotFound(err) {
+		return nil // the APIBinding waits for the APIExport to exist
+	} else if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+	export := exportObj.(*apisv1alpha1.APIExport)
+
+	if referenceChanged && export.Status.IdentityHash != "" && apishelper.IdentityHash(binding.Spec.Reference) != export.Status.IdentityHash {
+		return admission.NewForbidden(a, fmt.Errorf("spec.reference identityHash does not match the identity of APIExport %q in workspace %q", exportName, exportClusterName))
+	}
+
+	conflicts, err := o.namingConflicts(clusterName, binding, exportClusterName, export)
+	if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+	if rejected := apishelper.RejectedNamingConflicts(binding, conflicts); len(rejected) > 0 {
+		msgs := make([]string, 0, len(rejected))
+		for _, c := range rejected {
+			msgs = append(msgs, c.String())
+		}
+		return admission.NewForbidden(a, fmt.Errorf("conflicting resources in the workspace with conflict policy %s: %s", apishelper.ConflictPolicy(binding), strings.Join(msgs, "; ")))
+	}
+
+	return nil
+}
+
+// namingConflicts returns the conflicts of the resources bound by the APIBinding, and of the
+// resources of its APIExport, with the CRDs and the other APIBindings of the workspace.
+func (o *apiBindingAdmission) namingConflicts(clusterName string, binding *apisv1alpha1.APIBinding, exportClusterName string, export *apisv1alpha1.APIExport) ([]apishelper.NamingConflict, error) {
+	resources := apishelper.BoundGroupResources(binding)
+	for _, name := range export.Spec.LatestResourceSchemas {
+		obj, err := o.apiResourceSchemaIndex.Get(exportClusterName, name)
+		if apierrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		s := obj.(*apisv1alpha1.APIResourceSchema)
+		gr := schema.GroupResource{Group: s.Spec.Group, Resource: s.Spec.Names.Plural}
+		found := false
+		for _, r := range resources {
+			if r == gr {
+				found = true
+				break
+			}
+		}
+		if !found {
+			resources = append(resources, gr)
+		}
+	}
+
+	crdObjs, err := o.crdIndex.List(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	crds := make([]*apiextensionsv1.CustomResourceDefinition, 0, len(crdObjs))
+	for _, obj := range crdObjs {
+		crds = append(crds, obj.(*apiextensionsv1.CustomResourceDefinition))
+	}
+
+	bindingObjs, err := o.apiBindingIndex.List(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	bindings := make([]*apisv1alpha1.APIBinding, 0, len(bindingObjs))
+	for _, obj := range bindingObjs {
+		bindings = append(bindings, obj.(*apisv1alpha1.APIBinding))
+	}
+
+	return apishelper.NamingConflicts(binding, resources, crds, bindings), nil
+}
+
+// validateWorkspaceReference checks that exactly one of name and path of a workspace
+// reference is set, and that the path is a valid logical cluster name.
+func validateWorkspaceReference(ref *apisv1alpha1.WorkspaceExportReference, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if ref == nil {
+		return errs
+	}
+
+	switch {
+	case ref.WorkspaceName == "" && ref.Path == "":
+		errs = append(errs, field.Required(fldPath, "one of name or path is required"))
+	case ref.WorkspaceName != "" && ref.Path != "":
+		errs = append(errs, field.Invalid(fldPath.Child("path"), ref.Path, "must not be set together with name"))
+	case ref.Path != "":
+		if _, _, err := tenancyhelper.ParseLogicalClusterName(ref.Path); err != nil {
+			errs = append(errs, field.Invalid(fldPath.Child("path"), ref.Path, err.Error()))
+		}
+	}
+	return errs
+}
+
+func (o *apiBindingAdmission) ValidateInitialization() error {
+	if o.apiExportIndex == nil {
+		return fmt.Errorf(PluginName + " plugin needs an APIExport index")
+	}
+	if o.apiBindingIndex == nil {
+		return fmt.Errorf(PluginName + " plugin needs an APIBinding index")
+	}
+	if o.apiResourceSchemaIndex == nil {
+		return fmt.Errorf(PluginName + " plugin needs an APIResourceSchema index")
+	}
+	if o.crdIndex == nil {
+		return fmt.Errorf(PluginName + " plugin needs a CustomResourceDefinition index")
+	}
+	if o.kubeClusterClient == nil {
+		return fmt.Errorf(PluginName + " plugin needs a Kubernetes cluster client")
+	}
+	return nil
+}
+
+func (o *apiBindingAdmission) SetKcpInformers(informers kcpinformers.SharedInformerFactory) {
+	exports := informers.Apis().V1alpha1().APIExports()
+	bindings := informers.Apis().V1alpha1().APIBindings()
+	schemas := informers.Apis().V1alpha1().APIResourceSchemas()
+	o.hasSynced = func() bool {
+		return exports.Informer().HasSynced() && bindings.Informer().HasSynced() && schemas.Informer().HasSynced() &&
+			o.crdsSynced != nil && o.crdsSynced()
+	}
+	o.SetReadyFunc(o.hasSynced)
+
+	// ValidateInitialization fails on missing indexes
+	var err error
+	if o.apiExportIndex, err = kcpadmissionhelpers.NewClusterIndex(exports.Informer(), apisv1alpha1.Resource("apiexports")); err != nil {
+		utilruntime.HandleError(err)
+	}
+	if o.apiBindingIndex, err = kcpadmissionhelpers.NewClusterIndex(bindings.Informer(), apisv1alpha1.Resource("apibindings")); err != nil {
+		utilruntime.HandleError(err)
+	}
+	if o.apiResourceSchemaIndex, err = kcpadmissionhelpers.NewClusterIndex(schemas.Informer(), apisv1alpha1.Resource("apiresourceschemas")); err != nil {
+		utilruntime.HandleError(err)
+	}
+}
+
+// HasSynced returns true when the informers of the plugin have synced.
+func (o *apiBindingAdmission) HasSynced() bool {
+	return o.hasSynced == nil || o.hasSynced()
+}
+
+func (o *apiBindingAdmission) SetAPIExtensionsInformers(informers apiextensionsinformers.SharedInformerFactory) {
+	crdInformer := informers.Apiextensions().V1().CustomResourceDefinitions().Informer()
+	o.crdsSynced = crdInformer.HasSynced
+
+	// ValidateInitialization fails on a missing index
+	var err error
+	if o.crdIndex, err = kcpadmissionhelpers.NewClusterIndex(crdInformer, apiextensionsv1.Resource("customresourcedefinitions")); err != nil {
+		utilruntime.HandleError(err)
+	}
+}
+
+func (o *apiBindingAdmission) SetKubeClusterClient(kubeClusterClient *kubernetes.Cluster) {
+	o.kubeClusterClient = kubeClusterClient
+}
@@ -0,0 +1,227 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apibinding
+
+import (
+	"context"
+	"testing"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	kcpadmissionhelpers "github.com/kcp-dev/kcp/pkg/admission/helpers"
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+)
+
+func newBinding(identityHash string) *apisv1alpha1.APIBinding {
+	return &apisv1alpha1.APIBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "widgets"},
+		Spec: apisv1alpha1.APIBindingSpec{
+			Reference: apisv1alpha1.ExportReference{
+				Workspace: &apisv1alpha1.WorkspaceExportReference{
+					WorkspaceName: "provider",
+					ExportName:    "widgets",
+					IdentityHash:  identityHash,
+				},
+			},
+		},
+	}
+}
+
+func attr(binding, old *apisv1alpha1.APIBinding) admission.Attributes {
+	op := admission.Create
+	if old != nil {
+		op = admission.Update
+	}
+	return admission.NewAttributesRecord(
+		binding,
+		old,
+		apisv1alpha1.Kind("APIBinding").WithVersion("v1alpha1"),
+		"",
+		binding.Name,
+		apisv1alpha1.Resource("apibindings").WithVersion("v1alpha1"),
+		"",
+		op,
+		&metav1.CreateOptions{},
+		false,
+		&user.DefaultInfo{},
+	)
+}
+
+func TestValidate(t *testing.T) {
+	byLogicalCluster := cache.Indexers{kcpadmissionhelpers.ByLogicalClusterIndex: kcpadmissionhelpers.IndexByLogicalCluster}
+
+	exports := []*apisv1alpha1.APIExport{
+		{
+			ObjectMeta: metav1.ObjectMeta{ClusterName: "org:provider", Name: "widgets"},
+			Spec:       apisv1alpha1.APIExportSpec{LatestResourceSchemas: []string{"today.widgets.today.dev"}},
+			Status:     apisv1alpha1.APIExportStatus{IdentityHash: "abc"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{ClusterName: "org:legacy", Name: "widgets"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{ClusterName: "other:services", Name: "widgets"},
+			Status:     apisv1alpha1.APIExportStatus{IdentityHash: "ghi"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{ClusterName: "root", Name: "tenancy.kcp.dev"},
+			Status:     apisv1alpha1.APIExportStatus{IdentityHash: "def"},
+		},
+	}
+	exportIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, byLogicalCluster)
+	for _, export := range exports {
+		if err := exportIndexer.Add(export); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	legacy := newBinding("")
+	legacy.Spec.Reference.Workspace.WorkspaceName = "legacy"
+	rotated := newBinding("old")
+	rotated.Labels = map[string]string{"changed": "true"}
+	missing := newBinding("")
+	missing.Spec.Reference.Workspace.ExportName = "missing"
+	rootBinding := func(identityHash string) *apisv1alpha1.APIBinding {
+		b := newBinding("")
+		b.Spec.Reference = apisv1alpha1.ExportReference{
+			Root: &apisv1alpha1.RootExportReference{ExportName: "tenancy.kcp.dev", IdentityHash: identityHash},
+		}
+		return b
+	}
+	pathBinding := func(path, identityHash string) *apisv1alpha1.APIBinding {
+		b := newBinding(identityHash)
+		b.Spec.Reference.Workspace.WorkspaceName = ""
+		b.Spec.Reference.Workspace.Path = path
+		return b
+	}
+	nameAndPath := newBinding("abc")
+	nameAndPath.Spec.Reference.Workspace.Path = "org:provider"
+	withPolicy := func(b *apisv1alpha1.APIBinding, policy apisv1alpha1.APIBindingConflictPolicyType) *apisv1alpha1.APIBinding {
+		b.Spec.ConflictPolicy = policy
+		return b
+	}
+
+	schemaIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, byLogicalCluster)
+	if err := schemaIndexer.Add(&apisv1alpha1.APIResourceSchema{
+		ObjectMeta: metav1.ObjectMeta{ClusterName: "org:provider", Name: "today.widgets.today.dev"},
+		Spec: apisv1alpha1.APIResourceSchemaSpec{
+			Group: "today.dev",
+			Names: apiextensionsv1.CustomResourceDefinitionNames{Plural: "widgets"},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	widgetsCRD := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{ClusterName: "org:consumer", Name: "widgets.today.dev"},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: "today.dev",
+			Names: apiextensionsv1.CustomResourceDefinitionNames{Plural: "widgets"},
+		},
+	}
+	olderBinding := &apisv1alpha1.APIBinding{
+		ObjectMeta: metav1.ObjectMeta{ClusterName: "org:consumer", Name: "gadgets", CreationTimestamp: metav1.Now()},
+		Status: apisv1alpha1.APIBindingStatus{
+			BoundResources: []apisv1alpha1.BoundAPIResource{{Group: "today.dev", Resource: "widgets"}},
+		},
+	}
+
+	for _, tt := range []struct {
+		name         string
+		attr         admission.Attributes
+		denyBind     bool
+		crds         []*apiextensionsv1.CustomResourceDefinition
+		bindings     []*apisv1alpha1.APIBinding
+		wantAuthzFor string
+		wantErr      bool
+	}{
+		{name: "matching identity hash", attr: attr(newBinding("abc"), nil), wantAuthzFor: "org:provider"},
+		{name: "missing bind permission", attr: attr(newBinding("abc"), nil), denyBind: true, wantErr: true},
+		{name: "absolute path to another organization", attr: attr(pathBinding("other:services", "ghi"), nil), wantAuthzFor: "other:services"},
+		{name: "absolute path without bind permission", attr: attr(pathBinding("other:services", "ghi"), nil), denyBind: true, wantErr: true},
+		{name: "invalid absolute path", attr: attr(pathBinding("too:many:parts", "ghi"), nil), wantErr: true},
+		{name: "name and absolute path", attr: attr(nameAndPath, nil), wantErr: true},
+		{name: "wrong identity hash", attr: attr(newBinding("other"), nil), wantErr: true},
+		{name: "missing identity hash", attr: attr(newBinding(""), nil), wantErr: true},
+		{name: "APIExport without identity", attr: attr(legacy, nil)},
+		{name: "APIExport does not exist yet", attr: attr(missing, nil)},
+		{name: "update without reference change", attr: attr(rotated, newBinding("old"))},
+		{name: "update of the reference", attr: attr(newBinding("old"), newBinding("abc")), wantErr: true},
+		{name: "root export with matching identity hash", attr: attr(rootBinding("def"), nil)},
+		{name: "root export with wrong identity hash", attr: attr(rootBinding("abc"), nil), wantErr: true},
+		{name: "conflicting CRD with the default policy", attr: attr(newBinding("abc"), nil), crds: []*apiextensionsv1.CustomResourceDefinition{widgetsCRD}, wantErr: true},
+		{name: "conflicting CRD with the LocalWins policy", attr: attr(withPolicy(newBinding("abc"), apisv1alpha1.APIBindingConflictPolicyLocalWins), nil), crds: []*apiextensionsv1.CustomResourceDefinition{widgetsCRD}},
+		{name: "conflicting CRD with the BindingWins policy", attr: attr(withPolicy(newBinding("abc"), apisv1alpha1.APIBindingConflictPolicyBindingWins), nil), crds: []*apiextensionsv1.CustomResourceDefinition{widgetsCRD}},
+		{name: "resource bound by another APIBinding", attr: attr(withPolicy(newBinding("abc"), apisv1alpha1.APIBindingConflictPolicyBindingWins), nil), bindings: []*apisv1alpha1.APIBinding{olderBinding}, wantErr: true},
+		{name: "update of the conflict policy to Reject", attr: attr(newBinding("old"), withPolicy(newBinding("old"), apisv1alpha1.APIBindingConflictPolicyBindingWins)), crds: []*apiextensionsv1.CustomResourceDefinition{widgetsCRD}, wantErr: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := authorizer.DecisionAllow
+			if tt.denyBind {
+				decision = authorizer.DecisionDeny
+			}
+			crdIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, byLogicalCluster)
+			for _, crd := range tt.crds {
+				if err := crdIndexer.Add(crd); err != nil {
+					t.Fatal(err)
+				}
+			}
+			bindingIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, byLogicalCluster)
+			for _, binding := range tt.bindings {
+				if err := bindingIndexer.Add(binding); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var authzFor string
+			o := &apiBindingAdmission{
+				Handler:                admission.NewHandler(admission.Create, admission.Update),
+				apiExportIndex:         kcpadmissionhelpers.NewClusterIndexForIndexer(exportIndexer, apisv1alpha1.Resource("apiexports")),
+				apiBindingIndex:        kcpadmissionhelpers.NewClusterIndexForIndexer(bindingIndexer, apisv1alpha1.Resource("apibindings")),
+				apiResourceSchemaIndex: kcpadmissionhelpers.NewClusterIndexForIndexer(schemaIndexer, apisv1alpha1.Resource("apiresourceschemas")),
+				crdIndex:               kcpadmissionhelpers.NewClusterIndexForIndexer(crdIndexer, apiextensionsv1.Resource("customresourcedefinitions")),
+				createAuthorizer: func(clusterName string, client *kubernetes.Cluster) (authorizer.Authorizer, error) {
+					authzFor = clusterName
+					return &fakeAuthorizer{decision}, nil
+				},
+			}
+			ctx := request.WithCluster(context.Background(), request.Cluster{Name: "org:consumer"})
+			if err := o.Validate(ctx, tt.attr, nil); (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantAuthzFor != "" && authzFor != tt.wantAuthzFor {
+				t.Errorf("bind permission checked in %q, want %q", authzFor, tt.wantAuthzFor)
+			}
+		})
+	}
+}
+
+type fakeAuthorizer struct {
+	decision authorizer.Decision
+}
+
+func (a *fakeAuthorizer) Authorize(ctx context.Context, attr authorizer.Attributes) (authorizer.Decision, string, error) {
+	if attr.GetVerb() != "bind" || attr.GetResource() != "apiexports" {
+		return authorizer.DecisionDeny, "unexpected attributes", nil
+	}
+	return a.decision, "reason", nil
+}
@@ -0,0 +1,423 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiexportwebhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/apiserver/pkg/admission/plugin/webhook"
+	webhookerrors "k8s.io/apiserver/pkg/admission/plugin/webhook/errors"
+	"k8s.io/apiserver/pkg/admission/plugin/webhook/generic"
+	webhookinit "k8s.io/apiserver/pkg/admission/plugin/webhook/initializer"
+	webhookrequest "k8s.io/apiserver/pkg/admission/plugin/webhook/request"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	webhookutil "k8s.io/apiserver/pkg/util/webhook"
+	"k8s.io/apiserver/pkg/warning"
+	"k8s.io/klog/v2"
+
+	kcpadmissionhelpers "github.com/kcp-dev/kcp/pkg/admission/helpers"
+	kcpinitializers "github.com/kcp-dev/kcp/pkg/admission/initializers"
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+	apishelper "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1/helper"
+	kcpinformers "github.com/kcp-dev/kcp/pkg/client/informers/externalversions"
+)
+
+const (
+	PluginName = "apis.kcp.dev/APIExportWebhooks"
+
+	// defaultTimeout is the timeout of the webhooks without timeoutSeconds, like upstream.
+	defaultTimeout = 10 * time.Second
+)
+
+func Register(plugins *admission.Plugins) {
+	plugins.Register(PluginName,
+		func(_ io.Reader) (admission.Interface, error) {
+			return newAPIExportWebhooks()
+		})
+}
+
+func newAPIExportWebhooks() (*apiExportWebhooks, error) {
+	cm, err := webhookutil.NewClientManager(
+		[]schema.GroupVersion{
+			admissionv1beta1.SchemeGroupVersion,
+			admissionv1.SchemeGroupVersion,
+		},
+		admissionv1beta1.AddToScheme,
+		admissionv1.AddToScheme,
+	)
+	if err != nil {
+		return nil, err
+	}
+	authInfoResolver, err := webhookutil.NewDefaultAuthenticationInfoResolver("")
+	if err != nil {
+		return nil, err
+	}
+	// Set defaults which are overridden by the webhook plugin initializer.
+	cm.SetAuthenticationInfoResolver(authInfoResolver)
+	cm.SetServiceResolver(webhookutil.NewDefaultServiceResolver())
+
+	return &apiExportWebhooks{
+		Handler:       admission.NewHandler(admission.Create, admission.Update, admission.Delete),
+		clientManager: &cm,
+	}, nil
+}
+
+// apiExportWebhooks calls the admission webhooks of APIExports for the resources they
+// export, in every workspace bound to them. The webhooks are called in the logical cluster
+// of the APIExport, so that their Services are resolved in the workspace of the service
+// provider.
+type apiExportWebhooks struct {
+	*admission.Handler
+	apiBindingIndex *kcpadmissionhelpers.ClusterIndex
+	apiExportIndex  *kcpadmissionhelpers.ClusterIndex
+	hasSynced       func() bool
+
+	clientManager *webhookutil.ClientManager
+}
+
+// Ensure that the required admission interfaces are implemented.
+var _ = admission.MutationInterface(&apiExportWebhooks{})
+var _ = admission.ValidationInterface(&apiExportWebhooks{})
+var _ = admission.InitializationValidator(&apiExportWebhooks{})
+var _ = kcpadmissionhelpers.ReadinessReporter(&apiExportWebhooks{})
+var _ = kcpinitializers.WantsKcpInformers(&apiExportWebhooks{})
+var _ = webhookinit.WantsServiceResolver(&apiExportWebhooks{})
+var _ = webhookinit.WantsAuthenticationInfoResolverWrapper(&apiExportWebhooks{})
+
+// Admit calls the mutating webhooks of the APIExport of the resource, and applies their patches.
+func (o *apiExportWebhooks) Admit(ctx context.Context, a admission.Attributes, _ admission.ObjectInterfaces) error {
+	return o.dispatch(ctx, a, apisv1alpha1.MutatingAdmissionWebhook)
+}
+
+// Validate calls the validating webhooks of the APIExport of the resource.
+func (o *apiExportWebhooks) Validate(ctx context.Context, a admission.Attributes, _ admission.ObjectInterfaces) error {
+	return o.dispatch(ctx, a, apisv1alpha1.ValidatingAdmissionWebhook)
+}
+
+func (o *apiExportWebhooks) dispatch(ctx context.Context, a admission.Attributes, webhookType apisv1alpha1.AdmissionWebhookType) error {
+	// the webhooks are called for the exported resources only, not for their subresources
+	if a.GetSubresource() != "" {
+		return nil
+	}
+	if _, ok := a.GetObject().(*unstructured.Unstructured); !ok && a.GetOperation() != admission.Delete {
+		return nil // bound resources are always unstructured
+	}
+
+	clusterName, err := genericapirequest.ClusterNameFrom(ctx)
+	if err != nil {
+		return nil // nolint: nilerr
+	}
+
+	if !o.WaitForReady() {
+		return kcpadmissionhelpers.NewNotReadyError(a)
+	}
+
+	exportClusterName, export, err := o.boundExport(clusterName, a.GetResource().GroupResource())
+	if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+	if export == nil {
+		return nil
+	}
+
+	for i := range export.Spec.AdmissionWebhooks {
+		hook := &export.Spec.AdmissionWebhooks[i]
+		if hook.Type != webhookType || !matches(hook, a) {
+			continue
+		}
+		if err := o.call(ctx, exportClusterName, export, hook, a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// boundExport returns the APIExport bound for the given resource in the given logical
+// cluster, and the logical cluster of the APIExport, or nil if the resource is not bound.
+func (o *apiExportWebhooks) boundExport(clusterName string, gr schema.GroupResource) (string, *apisv1alpha1.APIExport, error) {
+	bindingObjs, err := o.apiBindingIndex.List(clusterName)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, obj := range bindingObjs {
+		binding := obj.(*apisv1alpha1.APIBinding)
+		bound := false
+		for _, r := range binding.Status.BoundResources {
+			if r.Group == gr.Group && r.Resource == gr.Resource {
+				bound = true
+				break
+			}
+		}
+		if !bound {
+			continue
+		}
+
+		exportClusterName, exportName, ok := apishelper.ExportClusterName(clusterName, binding.Spec.Reference)
+		if !ok {
+			return "", nil, nil
+		}
+		exportObj, err := o.apiExportIndex.Get(exportClusterName, exportName)
+		if apierrors.IsNotFound(err) {
+			return "", nil, nil
+		} else if err != nil {
+			return "", nil, err
+		}
+		return exportClusterName, exportObj.(*apisv1alpha1.APIExport), nil
+	}
+	return "", nil, nil
+}
+
+// matches returns true if the given webhook is called for the resource and operation of
+// the given attributes.
+func matches(hook *apisv1alpha1.AdmissionWebhook, a admission.Attributes) bool {
+	if len(hook.Resources) > 0 {
+		found := false
+		for _, r := range hook.Resources {
+			if r == a.GetResource().Resource {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	operations := hook.Operations
+	if len(operations) == 0 {
+		operations = []admissionregistrationv1.OperationType{admissionregistrationv1.Create, admissionregistrationv1.Update}
+	}
+	for _, op := range operations {
+		if op == admissionregistrationv1.OperationAll || string(op) == string(a.GetOperation()) {
+			return true
+		}
+	}
+	return false
+}
+
+// accessor returns the upstream webhook accessor of the given webhook of an APIExport.
+func accessor(exportClusterName string, export *apisv1alpha1.APIExport, hook *apisv1alpha1.AdmissionWebhook) webhook.WebhookAccessor {
+	uid := fmt.Sprintf("%s|%s/%s", exportClusterName, export.Name, hook.Name)
+	sideEffects := admissionregistrationv1.SideEffectClassNone
+	admissionReviewVersions := hook.AdmissionReviewVersions
+	if len(admissionReviewVersions) == 0 {
+		admissionReviewVersions = []string{admissionv1.SchemeGroupVersion.Version}
+	}
+
+	if hook.Type == apisv1alpha1.MutatingAdmissionWebhook {
+		return webhook.NewMutatingWebhookAccessor(uid, export.Name, &admissionregistrationv1.MutatingWebhook{
+			Name:                    hook.Name,
+			ClientConfig:            hook.ClientConfig,
+			FailurePolicy:           hook.FailurePolicy,
+			SideEffects:             &sideEffects,
+			TimeoutSeconds:          hook.TimeoutSeconds,
+			AdmissionReviewVersions: admissionReviewVersions,
+		})
+	}
+	return webhook.NewValidatingWebhookAccessor(uid, export.Name, &admissionregistrationv1.ValidatingWebhook{
+		Name:                    hook.Name,
+		ClientConfig:            hook.ClientConfig,
+		FailurePolicy:           hook.FailurePolicy,
+		SideEffects:             &sideEffects,
+		TimeoutSeconds:          hook.TimeoutSeconds,
+		AdmissionReviewVersions: admissionReviewVersions,
+	})
+}
+
+// call calls the given webhook, handling failures according to its failure policy.
+func (o *apiExportWebhooks) call(ctx context.Context, exportClusterName string, export *apisv1alpha1.APIExport, hook *apisv1alpha1.AdmissionWebhook, a admission.Attributes) error {
+	err := o.callHook(ctx, exportClusterName, accessor(exportClusterName, export, hook), a)
+	if err == nil {
+		return nil
+	}
+
+	switch err := err.(type) {
+	case *webhookutil.ErrCallingWebhook:
+		if hook.FailurePolicy != nil && *hook.FailurePolicy == admissionregistrationv1.Ignore {
+			klog.Warningf("Failed calling webhook %q of APIExport %s|%s, failing open: %v", hook.Name, exportClusterName, export.Name, err)
+			return nil
+		}
+		klog.Warningf("Failed calling webhook %q of APIExport %s|%s, failing closed: %v", hook.Name, exportClusterName, export.Name, err)
+		return apierrors.NewInternalError(err)
+	case *webhookutil.ErrWebhookRejection:
+		return err.Status
+	default:
+		return err
+	}
+}
+
+// callHook sends an AdmissionReview for the given attributes to the given webhook, from the
+// logical cluster of its APIExport, and applies the returned patch to the object if the
+// webhook is mutating.
+func (o *apiExportWebhooks) callHook(ctx context.Context, exportClusterName string, h webhook.WebhookAccessor, a admission.Attributes) error {
+	attr := &generic.VersionedAttributes{
+		Attributes:         a,
+		VersionedOldObject: a.GetOldObject(),
+		VersionedObject:    a.GetObject(),
+		VersionedKind:      a.GetKind(),
+	}
+	invocation := &generic.WebhookInvocation{
+		Webhook:     h,
+		Resource:    a.GetResource(),
+		Subresource: a.GetSubresource(),
+		Kind:        a.GetKind(),
+	}
+	_, mutating := h.GetMutatingWebhook()
+
+	uid, request, response, err := webhookrequest.CreateAdmissionObjects(attr, invocation)
+	if err != nil {
+		return &webhookutil.ErrCallingWebhook{WebhookName: h.GetName(), Reason: fmt.Errorf("could not create admission objects: %w", err), Status: apierrors.NewBadRequest("error creating admission objects")}
+	}
+	client, err := h.GetRESTClient(o.clientManager)
+	if err != nil {
+		return &webhookutil.ErrCallingWebhook{WebhookName: h.GetName(), Reason: fmt.Errorf("could not get REST client: %w", err), Status: apierrors.NewBadRequest("error getting REST client")}
+	}
+
+	timeout := defaultTimeout
+	if h.GetTimeoutSeconds() != nil {
+		timeout = time.Duration(*h.GetTimeoutSeconds()) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	// the Services of the webhooks are resolved in the logical cluster of the APIExport.
+	ctx = genericapirequest.WithCluster(ctx, genericapirequest.Cluster{Name: exportClusterName})
+
+	if err := client.Post().Body(request).Timeout(timeout).Do(ctx).Into(response); err != nil {
+		status, ok := err.(*apierrors.StatusError)
+		if !ok {
+			status = apierrors.NewBadRequest("error calling webhook")
+		}
+		return &webhookutil.ErrCallingWebhook{WebhookName: h.GetName(), Reason: fmt.Errorf("failed to call webhook: %w", err), Status: status}
+	}
+
+	result, err := webhookrequest.VerifyAdmissionResponse(uid, mutating, response)
+	if err != nil {
+		return &webhookutil.ErrCallingWebhook{WebhookName: h.GetName(), Reason: fmt.Errorf("received invalid webhook response: %w", err), Status: apierrors.NewServiceUnavailable("error validating webhook response")}
+	}
+
+	for k, v := range result.AuditAnnotations {
+		key := h.GetName() + "/" + k
+		if err := a.AddAnnotation(key, v); err != nil {
+			klog.Warningf("Failed to set admission audit annotation %s to %s for webhook %s: %v", key, v, h.GetName(), err)
+		}
+	}
+	for _, w := range result.Warnings {
+		warning.AddWarning(ctx, "", w)
+	}
+	if !result.Allowed {
+		return &webhookutil.ErrWebhookRejection{Status: webhookerrors.ToStatusErr(h.GetName(), result.Result)}
+	}
+
+	if !mutating || len(result.Patch) == 0 {
+		return nil
+	}
+	return patch(h.GetName(), a, result)
+}
+
+// patch applies the JSON patch of a mutating webhook to the object of the given attributes.
+func patch(webhookName string, a admission.Attributes, result *webhookrequest.AdmissionResponse) error {
+	if result.PatchType != admissionv1.PatchTypeJSONPatch {
+		return &webhookutil.ErrCallingWebhook{WebhookName: webhookName, Reason: fmt.Errorf("unsupported patch type %q", result.PatchType), Status: webhookerrors.ToStatusErr(webhookName, result.Result)}
+	}
+	patchObj, err := jsonpatch.DecodePatch(result.Patch)
+	if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+	if len(patchObj) == 0 {
+		return nil
+	}
+
+	obj, ok := a.GetObject().(*unstructured.Unstructured)
+	if !ok {
+		return apierrors.NewInternalError(fmt.Errorf("admission webhook %q attempted to modify the object, which is not supported for this operation", webhookName))
+	}
+	objJS, err := json.Marshal(obj.Object)
+	if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+	patchedJS, err := patchObj.Apply(objJS)
+	if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+	patched := map[string]interface{}{}
+	if err := json.Unmarshal(patchedJS, &patched); err != nil {
+		return apierrors.NewInternalError(err)
+	}
+	obj.Object = patched
+	return nil
+}
+
+func (o *apiExportWebhooks) ValidateInitialization() error {
+	if o.apiBindingIndex == nil {
+		return fmt.Errorf(PluginName + " plugin needs an APIBinding index")
+	}
+	if o.apiExportIndex == nil {
+		return fmt.Errorf(PluginName + " plugin needs an APIExport index")
+	}
+	if err := o.clientManager.Validate(); err != nil {
+		return fmt.Errorf(PluginName+" plugin client manager is not properly setup: %w", err)
+	}
+	return nil
+}
+
+func (o *apiExportWebhooks) SetKcpInformers(informers kcpinformers.SharedInformerFactory) {
+	bindings := informers.Apis().V1alpha1().APIBindings()
+	exports := informers.Apis().V1alpha1().APIExports()
+	o.hasSynced = func() bool {
+		return bindings.Informer().HasSynced() && exports.Informer().HasSynced()
+	}
+	o.SetReadyFunc(o.hasSynced)
+
+	// ValidateInitialization fails on missing indexes
+	var err error
+	if o.apiBindingIndex, err = kcpadmissionhelpers.NewClusterIndex(bindings.Informer(), apisv1alpha1.Resource("apibindings")); err != nil {
+		utilruntime.HandleError(err)
+	}
+	if o.apiExportIndex, err = kcpadmissionhelpers.NewClusterIndex(exports.Informer(), apisv1alpha1.Resource("apiexports")); err != nil {
+		utilruntime.HandleError(err)
+	}
+}
+
+// HasSynced returns true when the informers of the plugin have synced.
+func (o *apiExportWebhooks) HasSynced() bool {
+	return o.hasSynced == nil || o.hasSynced()
+}
+
+// SetAuthenticationInfoResolverWrapper sets the wrapper resolving the Services of the webhooks
+// in the logical cluster of the request.
+func (o *apiExportWebhooks) SetAuthenticationInfoResolverWrapper(wrapper webhookutil.AuthenticationInfoResolverWrapper) {
+	o.clientManager.SetAuthenticationInfoResolverWrapper(wrapper)
+}
+
+// SetServiceResolver sets the resolver of the Services of the webhooks.
+func (o *apiExportWebhooks) SetServiceResolver(sr webhookutil.ServiceResolver) {
+	o.clientManager.SetServiceResolver(sr)
+}
@@ -0,0 +1,229 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiexportwebhooks
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/tools/cache"
+
+	kcpadmissionhelpers "github.com/kcp-dev/kcp/pkg/admission/helpers"
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+)
+
+func newWidget(size int64) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "today.dev/v1",
+		"kind":       "Widget",
+		"metadata":   map[string]interface{}{"name": "widget"},
+		"spec":       map[string]interface{}{"size": size},
+	}}
+}
+
+func attr(obj *unstructured.Unstructured, resource string) admission.Attributes {
+	return admission.NewAttributesRecord(
+		obj,
+		nil,
+		schema.GroupVersionKind{Group: "today.dev", Version: "v1", Kind: "Widget"},
+		"default",
+		obj.GetName(),
+		schema.GroupVersionResource{Group: "today.dev", Version: "v1", Resource: resource},
+		"",
+		admission.Create,
+		&metav1.CreateOptions{},
+		false,
+		&user.DefaultInfo{Name: "alice"},
+	)
+}
+
+func TestDispatch(t *testing.T) {
+	var called []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		called = append(called, req.URL.Path)
+		review := &admissionv1.AdmissionReview{}
+		require.NoError(t, json.NewDecoder(req.Body).Decode(review))
+		widget := &unstructured.Unstructured{}
+		require.NoError(t, json.Unmarshal(review.Request.Object.Raw, &widget.Object))
+
+		response := &admissionv1.AdmissionResponse{UID: review.Request.UID, Allowed: true}
+		switch req.URL.Path {
+		case "/mutate":
+			patchType := admissionv1.PatchTypeJSONPatch
+			response.PatchType = &patchType
+			response.Patch = []byte(`[{"op":"add","path":"/metadata/labels","value":{"provider":"today"}}]`)
+		case "/validate":
+			if size, _, _ := unstructured.NestedFloat64(widget.Object, "spec", "size"); size > 10 {
+				response.Allowed = false
+				response.Result = &metav1.Status{Message: "too big"}
+			}
+		}
+		review.Response = response
+		review.Request = nil
+		require.NoError(t, json.NewEncoder(w).Encode(review))
+	}))
+	defer server.Close()
+	caBundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	hookURL := func(path string) string { return server.URL + path }
+	failurePolicy := func(p admissionregistrationv1.FailurePolicyType) *admissionregistrationv1.FailurePolicyType { return &p }
+
+	byLogicalCluster := cache.Indexers{kcpadmissionhelpers.ByLogicalClusterIndex: kcpadmissionhelpers.IndexByLogicalCluster}
+	bindingIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, byLogicalCluster)
+	require.NoError(t, bindingIndexer.Add(&apisv1alpha1.APIBinding{
+		ObjectMeta: metav1.ObjectMeta{ClusterName: "org:consumer", Name: "widgets"},
+		Spec: apisv1alpha1.APIBindingSpec{
+			Reference: apisv1alpha1.ExportReference{
+				Workspace: &apisv1alpha1.WorkspaceExportReference{WorkspaceName: "provider", ExportName: "widgets"},
+			},
+		},
+		Status: apisv1alpha1.APIBindingStatus{
+			BoundResources: []apisv1alpha1.BoundAPIResource{
+				{Group: "today.dev", Resource: "widgets"},
+				{Group: "today.dev", Resource: "gadgets"},
+			},
+		},
+	}))
+
+	for _, tt := range []struct {
+		name        string
+		hooks       []apisv1alpha1.AdmissionWebhook
+		clusterName string
+		attr        admission.Attributes
+		wantCalled  []string
+		wantLabels  map[string]string
+		wantErr     bool
+	}{
+		{
+			name: "mutating webhook patches the object",
+			hooks: []apisv1alpha1.AdmissionWebhook{
+				{Name: "mutate", Type: apisv1alpha1.MutatingAdmissionWebhook, ClientConfig: admissionregistrationv1.WebhookClientConfig{URL: ptr(hookURL("/mutate")), CABundle: caBundle}},
+			},
+			clusterName: "org:consumer",
+			attr:        attr(newWidget(1), "widgets"),
+			wantCalled:  []string{"/mutate"},
+			wantLabels:  map[string]string{"provider": "today"},
+		},
+		{
+			name: "validating webhook accepts the object",
+			hooks: []apisv1alpha1.AdmissionWebhook{
+				{Name: "validate", Type: apisv1alpha1.ValidatingAdmissionWebhook, ClientConfig: admissionregistrationv1.WebhookClientConfig{URL: ptr(hookURL("/validate")), CABundle: caBundle}},
+			},
+			clusterName: "org:consumer",
+			attr:        attr(newWidget(1), "widgets"),
+			wantCalled:  []string{"/validate"},
+		},
+		{
+			name: "validating webhook rejects the object",
+			hooks: []apisv1alpha1.AdmissionWebhook{
+				{Name: "validate", Type: apisv1alpha1.ValidatingAdmissionWebhook, ClientConfig: admissionregistrationv1.WebhookClientConfig{URL: ptr(hookURL("/validate")), CABundle: caBundle}},
+			},
+			clusterName: "org:consumer",
+			attr:        attr(newWidget(20), "widgets"),
+			wantCalled:  []string{"/validate"},
+			wantErr:     true,
+		},
+		{
+			name: "webhook for other resources",
+			hooks: []apisv1alpha1.AdmissionWebhook{
+				{Name: "validate", Type: apisv1alpha1.ValidatingAdmissionWebhook, Resources: []string{"gadgets"}, ClientConfig: admissionregistrationv1.WebhookClientConfig{URL: ptr(hookURL("/validate")), CABundle: caBundle}},
+			},
+			clusterName: "org:consumer",
+			attr:        attr(newWidget(20), "widgets"),
+		},
+		{
+			name: "webhook for other operations",
+			hooks: []apisv1alpha1.AdmissionWebhook{
+				{Name: "validate", Type: apisv1alpha1.ValidatingAdmissionWebhook, Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Delete}, ClientConfig: admissionregistrationv1.WebhookClientConfig{URL: ptr(hookURL("/validate")), CABundle: caBundle}},
+			},
+			clusterName: "org:consumer",
+			attr:        attr(newWidget(20), "widgets"),
+		},
+		{
+			name: "workspace not bound to the APIExport",
+			hooks: []apisv1alpha1.AdmissionWebhook{
+				{Name: "validate", Type: apisv1alpha1.ValidatingAdmissionWebhook, ClientConfig: admissionregistrationv1.WebhookClientConfig{URL: ptr(hookURL("/validate")), CABundle: caBundle}},
+			},
+			clusterName: "org:other",
+			attr:        attr(newWidget(20), "widgets"),
+		},
+		{
+			name: "failing webhook with the Ignore policy",
+			hooks: []apisv1alpha1.AdmissionWebhook{
+				{Name: "validate", Type: apisv1alpha1.ValidatingAdmissionWebhook, FailurePolicy: failurePolicy(admissionregistrationv1.Ignore), ClientConfig: admissionregistrationv1.WebhookClientConfig{URL: ptr(hookURL("/validate"))}},
+			},
+			clusterName: "org:consumer",
+			attr:        attr(newWidget(20), "widgets"),
+		},
+		{
+			name: "failing webhook with the default policy",
+			hooks: []apisv1alpha1.AdmissionWebhook{
+				{Name: "validate", Type: apisv1alpha1.ValidatingAdmissionWebhook, ClientConfig: admissionregistrationv1.WebhookClientConfig{URL: ptr(hookURL("/validate"))}},
+			},
+			clusterName: "org:consumer",
+			attr:        attr(newWidget(1), "widgets"),
+			wantErr:     true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			called = nil
+			exportIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, byLogicalCluster)
+			require.NoError(t, exportIndexer.Add(&apisv1alpha1.APIExport{
+				ObjectMeta: metav1.ObjectMeta{ClusterName: "org:provider", Name: "widgets"},
+				Spec:       apisv1alpha1.APIExportSpec{AdmissionWebhooks: tt.hooks},
+			}))
+
+			o, err := newAPIExportWebhooks()
+			require.NoError(t, err)
+			o.apiBindingIndex = kcpadmissionhelpers.NewClusterIndexForIndexer(bindingIndexer, apisv1alpha1.Resource("apibindings"))
+			o.apiExportIndex = kcpadmissionhelpers.NewClusterIndexForIndexer(exportIndexer, apisv1alpha1.Resource("apiexports"))
+
+			ctx := request.WithCluster(context.Background(), request.Cluster{Name: tt.clusterName})
+			err = o.Admit(ctx, tt.attr, nil)
+			if err == nil {
+				err = o.Validate(ctx, tt.attr, nil)
+			}
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tt.wantCalled, called)
+			if tt.wantLabels != nil {
+				require.Equal(t, tt.wantLabels, tt.attr.GetObject().(*unstructured.Unstructured).GetLabels())
+			}
+		})
+	}
+}
+
+func ptr(s string) *string {
+	return &s
+}
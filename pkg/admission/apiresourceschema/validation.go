@@ -26,10 +26,14 @@ import (
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	crdvalidation "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/validation"
 	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
 	utilvalidation "k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apiserver/pkg/util/webhook"
 
 	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/schemaconversion"
 )
 
 var namePrefixRE = regexp.MustCompile("^[a-z]([-a-z0-9]*[a-z0-9])?$")
@@ -126,12 +130,166 @@ func ValidateAPIResourceSchemaSpec(spec *apisv1alpha1.APIResourceSchemaSpec, fld
 		allErrs = append(allErrs, crdvalidation.ValidateCustomResourceDefinitionNames(&crdNames, fldPath.Child("names"))...)
 	}
 
+	if spec.Conversion != nil {
+		allErrs = append(allErrs, ValidateConversion(spec.Conversion, spec.Versions, fldPath.Child("conversion"))...)
+	}
+
 	// TODO(sttts): validate predecessors
-	// TODO(sttts): validate conversions
 
 	return allErrs
 }
 
+var (
+	acceptedConversionReviewVersions = sets.NewString("v1", "v1beta1")
+	fieldPathRE                      = regexp.MustCompile(`^[a-zA-Z_$][a-zA-Z0-9_$-]*(\.[a-zA-Z_$][a-zA-Z0-9_$-]*)*$`)
+)
+
+// ValidateConversion validates the conversion settings of an APIResourceSchema.
+func ValidateConversion(conversion *apisv1alpha1.CustomResourceConversion, versions []apisv1alpha1.APIResourceVersion, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	switch conversion.Strategy {
+	case apisv1alpha1.NoneConverter:
+		if conversion.Webhook != nil {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child("webhook"), "must not be set for strategy None"))
+		}
+		if len(conversion.Rules) > 0 {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child("rules"), "must not be set for strategy None"))
+		}
+	case apisv1alpha1.WebhookConverter:
+		if len(conversion.Rules) > 0 {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child("rules"), "must not be set for strategy Webhook"))
+		}
+		allErrs = append(allErrs, validateWebhookConversion(conversion.Webhook, fldPath.Child("webhook"))...)
+	case apisv1alpha1.RulesConverter:
+		if conversion.Webhook != nil {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child("webhook"), "must not be set for strategy Rules"))
+		}
+		allErrs = append(allErrs, validateConversionRules(conversion.Rules, versions, fldPath.Child("rules"))...)
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("strategy"), conversion.Strategy, []string{
+			string(apisv1alpha1.NoneConverter), string(apisv1alpha1.WebhookConverter), string(apisv1alpha1.RulesConverter),
+		}))
+	}
+
+	return allErrs
+}
+
+func validateWebhookConversion(conversion *apiextensionsv1.WebhookConversion, fldPath *field.Path) field.ErrorList {
+	if conversion == nil {
+		return field.ErrorList{field.Required(fldPath, "required for strategy Webhook")}
+	}
+
+	allErrs := field.ErrorList{}
+	if cc := conversion.ClientConfig; cc == nil {
+		allErrs = append(allErrs, field.Required(fldPath.Child("clientConfig"), "required for strategy Webhook"))
+	} else {
+		switch {
+		case (cc.URL == nil) == (cc.Service == nil):
+			allErrs = append(allErrs, field.Required(fldPath.Child("clientConfig"), "exactly one of url or service is required"))
+		case cc.URL != nil:
+			allErrs = append(allErrs, webhook.ValidateWebhookURL(fldPath.Child("clientConfig", "url"), *cc.URL, true)...)
+		case cc.Service != nil:
+			var port int32 = 443
+			if cc.Service.Port != nil {
+				port = *cc.Service.Port
+			}
+			allErrs = append(allErrs, webhook.ValidateWebhookService(fldPath.Child("clientConfig", "service"), cc.Service.Name, cc.Service.Namespace, cc.Service.Path, port)...)
+		}
+	}
+
+	found := false
+	for _, v := range conversion.ConversionReviewVersions {
+		if acceptedConversionReviewVersions.Has(v) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("conversionReviewVersions"), conversion.ConversionReviewVersions,
+			fmt.Sprintf("must include at least one of %s", strings.Join(acceptedConversionReviewVersions.List(), ", "))))
+	}
+
+	return allErrs
+}
+
+func validateConversionRules(rules []apisv1alpha1.ConversionRules, versions []apisv1alpha1.APIResourceVersion, fldPath *field.Path) field.ErrorList {
+	if len(rules) == 0 {
+		return field.ErrorList{field.Required(fldPath, "required for strategy Rules")}
+	}
+
+	allErrs := field.ErrorList{}
+
+	versionNames := sets.NewString()
+	versionSchemas := map[string]runtime.RawExtension{}
+	storageVersion := ""
+	for _, v := range versions {
+		versionNames.Insert(v.Name)
+		versionSchemas[v.Name] = v.Schema
+		if v.Storage {
+			storageVersion = v.Name
+		}
+	}
+
+	pairs := sets.NewString()
+	for i, r := range rules {
+		if !versionNames.Has(r.FromVersion) {
+			allErrs = append(allErrs, field.NotSupported(fldPath.Index(i).Child("fromVersion"), r.FromVersion, versionNames.List()))
+		}
+		if !versionNames.Has(r.ToVersion) {
+			allErrs = append(allErrs, field.NotSupported(fldPath.Index(i).Child("toVersion"), r.ToVersion, versionNames.List()))
+		}
+		if r.FromVersion == r.ToVersion {
+			allErrs = append(allErrs, field.Invalid(fldPath.Index(i).Child("toVersion"), r.ToVersion, "must differ from fromVersion"))
+		}
+		pairs.Insert(r.FromVersion + "->" + r.ToVersion)
+
+		for j, f := range r.Fields {
+			if !fieldPathRE.MatchString(f.From) {
+				allErrs = append(allErrs, field.Invalid(fldPath.Index(i).Child("fields").Index(j).Child("from"), f.From, "must be a dot-separated field path"))
+			}
+			if f.To != "" && !fieldPathRE.MatchString(f.To) {
+				allErrs = append(allErrs, field.Invalid(fldPath.Index(i).Child("fields").Index(j).Child("to"), f.To, "must be a dot-separated field path"))
+			}
+			if isMetadataPath(f.From) || isMetadataPath(f.To) {
+				allErrs = append(allErrs, field.Forbidden(fldPath.Index(i).Child("fields").Index(j), "must not move apiVersion, kind or metadata"))
+			}
+			if f.Transformation != "" {
+				if f.To == "" {
+					allErrs = append(allErrs, field.Required(fldPath.Index(i).Child("fields").Index(j).Child("to"), "required with a transformation"))
+				}
+				if versionSchema, ok := versionSchemas[r.FromVersion]; ok && fieldPathRE.MatchString(f.From) {
+					if _, err := schemaconversion.CompileTransformation(versionSchema, f.From, f.Transformation); err != nil {
+						allErrs = append(allErrs, field.Invalid(fldPath.Index(i).Child("fields").Index(j).Child("transformation"), f.Transformation, err.Error()))
+					}
+				}
+			}
+		}
+	}
+
+	// every version must be reachable to and from the storage version
+	if storageVersion != "" {
+		for _, v := range versionNames.List() {
+			if v == storageVersion {
+				continue
+			}
+			if !pairs.Has(v + "->" + storageVersion) {
+				allErrs = append(allErrs, field.Required(fldPath, fmt.Sprintf("rules from version %q to storage version %q are required", v, storageVersion)))
+			}
+			if !pairs.Has(storageVersion + "->" + v) {
+				allErrs = append(allErrs, field.Required(fldPath, fmt.Sprintf("rules from storage version %q to version %q are required", storageVersion, v)))
+			}
+		}
+	}
+
+	return allErrs
+}
+
+func isMetadataPath(path string) bool {
+	root := strings.SplitN(path, ".", 2)[0]
+	return root == "apiVersion" || root == "kind" || root == "metadata"
+}
+
 var defaultValidationOpts = crdvalidation.ValidationOptions{
 	AllowDefaults:                            true,
 	RequireRecognizedConversionReviewVersion: true,
@@ -18,7 +18,14 @@ package apiresourceschema
 
 import (
 	"reflect"
+	"strings"
 	"testing"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
 )
 
 func TestValidationOptionDrift(t *testing.T) {
@@ -45,3 +52,182 @@ func TestValidationOptionDrift(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateConversion(t *testing.T) {
+	url := "https://example.com/convert"
+	versions := []apisv1alpha1.APIResourceVersion{
+		{Name: "v1", Served: true, Storage: true, Schema: runtime.RawExtension{Raw: []byte(`{"type":"object","properties":{"spec":{"type":"object","properties":{"size":{"type":"integer"}}}}}`)}},
+		{Name: "v2", Served: true, Schema: runtime.RawExtension{Raw: []byte(`{"type":"object","properties":{"spec":{"type":"object","properties":{"replicas":{"type":"integer"}}}}}`)}},
+	}
+
+	tests := []struct {
+		name       string
+		conversion apisv1alpha1.CustomResourceConversion
+		wantErrs   []string
+	}{
+		{
+			name:       "none",
+			conversion: apisv1alpha1.CustomResourceConversion{Strategy: apisv1alpha1.NoneConverter},
+		},
+		{
+			name: "none with rules",
+			conversion: apisv1alpha1.CustomResourceConversion{
+				Strategy: apisv1alpha1.NoneConverter,
+				Rules:    []apisv1alpha1.ConversionRules{{FromVersion: "v1", ToVersion: "v2"}},
+			},
+			wantErrs: []string{"spec.conversion.rules: Forbidden"},
+		},
+		{
+			name: "webhook",
+			conversion: apisv1alpha1.CustomResourceConversion{
+				Strategy: apisv1alpha1.WebhookConverter,
+				Webhook: &apiextensionsv1.WebhookConversion{
+					ClientConfig:             &apiextensionsv1.WebhookClientConfig{URL: &url},
+					ConversionReviewVersions: []string{"v1"},
+				},
+			},
+		},
+		{
+			name:       "webhook without config",
+			conversion: apisv1alpha1.CustomResourceConversion{Strategy: apisv1alpha1.WebhookConverter},
+			wantErrs:   []string{"spec.conversion.webhook: Required"},
+		},
+		{
+			name: "webhook without client config and review versions",
+			conversion: apisv1alpha1.CustomResourceConversion{
+				Strategy: apisv1alpha1.WebhookConverter,
+				Webhook:  &apiextensionsv1.WebhookConversion{ConversionReviewVersions: []string{"v2"}},
+			},
+			wantErrs: []string{
+				"spec.conversion.webhook.clientConfig: Required",
+				"spec.conversion.webhook.conversionReviewVersions: Invalid",
+			},
+		},
+		{
+			name: "rules in both directions",
+			conversion: apisv1alpha1.CustomResourceConversion{
+				Strategy: apisv1alpha1.RulesConverter,
+				Rules: []apisv1alpha1.ConversionRules{
+					{FromVersion: "v1", ToVersion: "v2", Fields: []apisv1alpha1.FieldConversionRule{{From: "spec.size", To: "spec.replicas"}}},
+					{FromVersion: "v2", ToVersion: "v1", Fields: []apisv1alpha1.FieldConversionRule{{From: "spec.replicas", To: "spec.size"}}},
+				},
+			},
+		},
+		{
+			name: "rules with transformations",
+			conversion: apisv1alpha1.CustomResourceConversion{
+				Strategy: apisv1alpha1.RulesConverter,
+				Rules: []apisv1alpha1.ConversionRules{
+					{FromVersion: "v1", ToVersion: "v2", Fields: []apisv1alpha1.FieldConversionRule{{From: "spec.size", To: "spec.replicas", Transformation: "self * 2"}}},
+					{FromVersion: "v2", ToVersion: "v1", Fields: []apisv1alpha1.FieldConversionRule{{From: "spec.replicas", To: "spec.size", Transformation: "self / 2"}}},
+				},
+			},
+		},
+		{
+			name: "rules with invalid transformations",
+			conversion: apisv1alpha1.CustomResourceConversion{
+				Strategy: apisv1alpha1.RulesConverter,
+				Rules: []apisv1alpha1.ConversionRules{
+					{FromVersion: "v1", ToVersion: "v2", Fields: []apisv1alpha1.FieldConversionRule{{From: "spec.size", To: "spec.replicas", Transformation: "self + 'a'"}}},
+					{FromVersion: "v2", ToVersion: "v1", Fields: []apisv1alpha1.FieldConversionRule{{From: "spec.replicas", Transformation: "self / 2"}}},
+				},
+			},
+			wantErrs: []string{
+				"spec.conversion.rules[0].fields[0].transformation: Invalid",
+				"spec.conversion.rules[1].fields[0].to: Required",
+			},
+		},
+		{
+			name: "rules missing direction to storage",
+			conversion: apisv1alpha1.CustomResourceConversion{
+				Strategy: apisv1alpha1.RulesConverter,
+				Rules: []apisv1alpha1.ConversionRules{
+					{FromVersion: "v1", ToVersion: "v2"},
+				},
+			},
+			wantErrs: []string{"spec.conversion.rules: Required"},
+		},
+		{
+			name: "rules with unknown version and invalid paths",
+			conversion: apisv1alpha1.CustomResourceConversion{
+				Strategy: apisv1alpha1.RulesConverter,
+				Rules: []apisv1alpha1.ConversionRules{
+					{FromVersion: "v1", ToVersion: "v2", Fields: []apisv1alpha1.FieldConversionRule{{From: "metadata.name", To: "spec.name"}}},
+					{FromVersion: "v2", ToVersion: "v1", Fields: []apisv1alpha1.FieldConversionRule{{From: "spec..replicas"}}},
+					{FromVersion: "v3", ToVersion: "v1"},
+				},
+			},
+			wantErrs: []string{
+				"spec.conversion.rules[0].fields[0]: Forbidden",
+				"spec.conversion.rules[1].fields[0].from: Invalid",
+				"spec.conversion.rules[2].fromVersion: Unsupported value",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := ValidateConversion(&tt.conversion, versions, field.NewPath("spec", "conversion"))
+			if len(errs) != len(tt.wantErrs) {
+				t.Fatalf("expected %d errors, got %d: %v", len(tt.wantErrs), len(errs), errs)
+			}
+			for i, want := range tt.wantErrs {
+				if !strings.HasPrefix(errs[i].Error(), want) {
+					t.Errorf("expected error %d to start with %q, got %q", i, want, errs[i].Error())
+				}
+			}
+		})
+	}
+}
+
+func TestValidateAPIResourceVersionValidationRules(t *testing.T) {
+	schema := func(rule string) string {
+		return `{"type":"object","properties":{"spec":{"type":"object",` +
+			`"properties":{"minReplicas":{"type":"integer","default":1},"maxReplicas":{"type":"integer"}},` +
+			`"x-kubernetes-validations":[{"rule":"` + rule + `","message":"invalid replicas"}]}}}`
+	}
+
+	tests := []struct {
+		name     string
+		schema   string
+		wantErrs []string
+	}{
+		{
+			name:   "valid rule with defaulting",
+			schema: schema("self.minReplicas <= self.maxReplicas"),
+		},
+		{
+			name:     "empty rule",
+			schema:   schema(""),
+			wantErrs: []string{"spec.versions[0].schema.openAPIV3Schema.properties[spec].x-kubernetes-validations[0].rule: Required"},
+		},
+		{
+			name:     "rule not compiling",
+			schema:   schema("self.minReplicas <="),
+			wantErrs: []string{"spec.versions[0].schema.openAPIV3Schema.properties[spec].x-kubernetes-validations[0].rule: Invalid"},
+		},
+		{
+			name:     "rule referencing an unknown field",
+			schema:   schema("self.replicas > 0"),
+			wantErrs: []string{"spec.versions[0].schema.openAPIV3Schema.properties[spec].x-kubernetes-validations[0].rule: Invalid"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version := apisv1alpha1.APIResourceVersion{
+				Name:    "v1",
+				Served:  true,
+				Storage: true,
+				Schema:  runtime.RawExtension{Raw: []byte(tt.schema)},
+			}
+			errs := ValidateAPIResourceVersion(&version, field.NewPath("spec", "versions").Index(0))
+			if len(errs) != len(tt.wantErrs) {
+				t.Fatalf("expected %d errors, got %d: %v", len(tt.wantErrs), len(errs), errs)
+			}
+			for i, want := range tt.wantErrs {
+				if !strings.HasPrefix(errs[i].Error(), want) {
+					t.Errorf("expected error %d to start with %q, got %q", i, want, errs[i].Error())
+				}
+			}
+		})
+	}
+}
@@ -21,19 +21,27 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/url"
 
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/apiserver/pkg/admission"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
 
 	kcpadmissionhelpers "github.com/kcp-dev/kcp/pkg/admission/helpers"
 	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+	"github.com/kcp-dev/kcp/pkg/workspacetype"
 )
 
 // Validate ClusterWorkspace creation and updates for
 // - immutability of fields like type
 // - valid phase transitions fulfilling pre-conditions
 // - status.location.current and status.baseURL cannot be unset.
+// - spec.authentication is only set on organization workspaces.
+// - spec.placement is valid, and immutable once the workspace is scheduled.
 
 const (
 	PluginName = "tenancy.kcp.dev/ClusterWorkspace"
@@ -107,11 +115,34 @@ func (o *clusterWorkspace) Validate(ctx context.Context, a admission.Attributes,
 			return admission.NewForbidden(a, errors.New("status.baseURL cannot be unset"))
 		}
 
+		if old.Status.Location.Current != "" && !equality.Semantic.DeepEqual(old.Spec.Placement, cw.Spec.Placement) {
+			return admission.NewForbidden(a, errors.New("spec.placement is immutable once the workspace is scheduled"))
+		}
+
 		if phaseOrdinal[old.Status.Phase] > phaseOrdinal[cw.Status.Phase] {
 			return admission.NewForbidden(a, fmt.Errorf("cannot transition from %q to %q", old.Status.Phase, cw.Status.Phase))
 		}
 	}
 
+	if cw.Spec.Authentication != nil {
+		clusterName, err := genericapirequest.ClusterNameFrom(ctx)
+		if err != nil {
+			return apierrors.NewInternalError(err)
+		}
+		if clusterName != helper.RootCluster {
+			return admission.NewForbidden(a, errors.New("spec.authentication can only be set on organization workspaces"))
+		}
+		if errs := validateAuthentication(cw.Spec.Authentication, field.NewPath("spec", "authentication")); len(errs) > 0 {
+			return admission.NewForbidden(a, errs.ToAggregate())
+		}
+	}
+
+	if cw.Spec.Placement != nil {
+		if errs := workspacetype.ValidatePlacement(cw.Spec.Placement, field.NewPath("spec", "placement")); len(errs) > 0 {
+			return admission.NewForbidden(a, errs.ToAggregate())
+		}
+	}
+
 	if phaseOrdinal[cw.Status.Phase] > phaseOrdinal[tenancyv1alpha1.ClusterWorkspacePhaseInitializing] && len(cw.Status.Initializers) > 0 {
 		return admission.NewForbidden(a, fmt.Errorf("spec.initializers must be empty for phase %s", cw.Status.Phase))
 	}
@@ -127,3 +158,30 @@ func (o *clusterWorkspace) Validate(ctx context.Context, a admission.Attributes,
 
 	return nil
 }
+
+func validateAuthentication(auth *tenancyv1alpha1.ClusterWorkspaceAuthentication, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	switch {
+	case auth.OIDC == nil && auth.Webhook == nil:
+		errs = append(errs, field.Required(fldPath, "exactly one of oidc or webhook must be set"))
+	case auth.OIDC != nil && auth.Webhook != nil:
+		errs = append(errs, field.Invalid(fldPath, "oidc, webhook", "exactly one of oidc or webhook must be set"))
+	}
+
+	if auth.OIDC != nil {
+		if u, err := url.Parse(auth.OIDC.IssuerURL); err != nil || u.Scheme != "https" || u.Host == "" {
+			errs = append(errs, field.Invalid(fldPath.Child("oidc", "issuerURL"), auth.OIDC.IssuerURL, "must be an https URL"))
+		}
+		if auth.OIDC.ClientID == "" {
+			errs = append(errs, field.Required(fldPath.Child("oidc", "clientID"), ""))
+		}
+	}
+	if auth.Webhook != nil {
+		if u, err := url.Parse(auth.Webhook.URL); err != nil || u.Scheme != "https" || u.Host == "" {
+			errs = append(errs, field.Invalid(fldPath.Child("webhook", "url"), auth.Webhook.URL, "must be an https URL"))
+		}
+	}
+
+	return errs
+}
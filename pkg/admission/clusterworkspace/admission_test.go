@@ -62,9 +62,10 @@ func updateAttr(ws, old *tenancyv1alpha1.ClusterWorkspace) admission.Attributes
 
 func TestValidate(t *testing.T) {
 	tests := []struct {
-		name    string
-		a       admission.Attributes
-		wantErr bool
+		name        string
+		a           admission.Attributes
+		clusterName string
+		wantErr     bool
 	}{
 		{
 			name: "rejects type mutations",
@@ -307,6 +308,79 @@ func TestValidate(t *testing.T) {
 				}),
 			wantErr: true,
 		},
+		{
+			name: "accepts oidc authentication on organization workspaces",
+			a: createAttr(&tenancyv1alpha1.ClusterWorkspace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test",
+				},
+				Spec: tenancyv1alpha1.ClusterWorkspaceSpec{
+					Authentication: &tenancyv1alpha1.ClusterWorkspaceAuthentication{
+						OIDC: &tenancyv1alpha1.OIDCAuthentication{
+							IssuerURL: "https://idp.bigcorp.com",
+							ClientID:  "kcp",
+						},
+					},
+				},
+			}),
+			clusterName: "root",
+		},
+		{
+			name: "rejects authentication on non-organization workspaces",
+			a: createAttr(&tenancyv1alpha1.ClusterWorkspace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test",
+				},
+				Spec: tenancyv1alpha1.ClusterWorkspaceSpec{
+					Authentication: &tenancyv1alpha1.ClusterWorkspaceAuthentication{
+						OIDC: &tenancyv1alpha1.OIDCAuthentication{
+							IssuerURL: "https://idp.bigcorp.com",
+							ClientID:  "kcp",
+						},
+					},
+				},
+			}),
+			wantErr: true,
+		},
+		{
+			name: "rejects non-https issuer",
+			a: createAttr(&tenancyv1alpha1.ClusterWorkspace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test",
+				},
+				Spec: tenancyv1alpha1.ClusterWorkspaceSpec{
+					Authentication: &tenancyv1alpha1.ClusterWorkspaceAuthentication{
+						OIDC: &tenancyv1alpha1.OIDCAuthentication{
+							IssuerURL: "http://idp.bigcorp.com",
+							ClientID:  "kcp",
+						},
+					},
+				},
+			}),
+			clusterName: "root",
+			wantErr:     true,
+		},
+		{
+			name: "rejects both oidc and webhook authentication",
+			a: createAttr(&tenancyv1alpha1.ClusterWorkspace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test",
+				},
+				Spec: tenancyv1alpha1.ClusterWorkspaceSpec{
+					Authentication: &tenancyv1alpha1.ClusterWorkspaceAuthentication{
+						OIDC: &tenancyv1alpha1.OIDCAuthentication{
+							IssuerURL: "https://idp.bigcorp.com",
+							ClientID:  "kcp",
+						},
+						Webhook: &tenancyv1alpha1.WebhookAuthentication{
+							URL: "https://authn.bigcorp.com",
+						},
+					},
+				},
+			}),
+			clusterName: "root",
+			wantErr:     true,
+		},
 		{
 			name: "ignores different resources",
 			a: admission.NewAttributesRecord(
@@ -333,7 +407,11 @@ func TestValidate(t *testing.T) {
 			o := &clusterWorkspace{
 				Handler: admission.NewHandler(admission.Create, admission.Update),
 			}
-			ctx := request.WithCluster(context.Background(), request.Cluster{Name: "root:org"})
+			clusterName := tt.clusterName
+			if clusterName == "" {
+				clusterName = "root:org"
+			}
+			ctx := request.WithCluster(context.Background(), request.Cluster{Name: clusterName})
 			if err := o.Validate(ctx, tt.a, nil); (err != nil) != tt.wantErr {
 				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
 			}
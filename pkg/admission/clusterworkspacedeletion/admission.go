@@ -0,0 +1,143 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clusterworkspacedeletion
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/admission"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+
+	kcpadmissionhelpers "github.com/kcp-dev/kcp/pkg/admission/helpers"
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+	kcpinformers "github.com/kcp-dev/kcp/pkg/client/informers/externalversions"
+)
+
+// Add the deletion finalizer to new ClusterWorkspaces, such that their child workspaces
+// and the content of their logical cluster are deleted with them, and reject the deletion
+// of ClusterWorkspaces with child workspaces unless the whole subtree is deleted, i.e.
+// with the Foreground propagation policy.
+
+const (
+	PluginName = "tenancy.kcp.dev/ClusterWorkspaceDeletion"
+)
+
+func Register(plugins *admission.Plugins) {
+	plugins.Register(PluginName,
+		func(_ io.Reader) (admission.Interface, error) {
+			return &clusterWorkspaceDeletion{
+				Handler: admission.NewHandler(admission.Create, admission.Delete),
+			}, nil
+		})
+}
+
+type clusterWorkspaceDeletion struct {
+	*admission.Handler
+
+	workspaceIndex *kcpadmissionhelpers.ClusterIndex
+}
+
+// Ensure that the required admission interfaces are implemented.
+var _ = admission.MutationInterface(&clusterWorkspaceDeletion{})
+var _ = admission.ValidationInterface(&clusterWorkspaceDeletion{})
+var _ = admission.InitializationValidator(&clusterWorkspaceDeletion{})
+
+// Admit adds the deletion finalizer to created ClusterWorkspaces.
+func (o *clusterWorkspaceDeletion) Admit(ctx context.Context, a admission.Attributes, _ admission.ObjectInterfaces) (err error) {
+	if a.GetResource().GroupResource() != tenancyv1alpha1.Resource("clusterworkspaces") || a.GetSubresource() != "" {
+		return nil
+	}
+	if a.GetOperation() != admission.Create {
+		return nil
+	}
+
+	u, ok := a.GetObject().(*unstructured.Unstructured)
+	if !ok {
+		return nil // only work on unstructured ClusterWorkspaces
+	}
+	finalizers := sets.NewString(u.GetFinalizers()...)
+	if !finalizers.Has(tenancyv1alpha1.ClusterWorkspaceDeletionFinalizer) {
+		u.SetFinalizers(append(u.GetFinalizers(), tenancyv1alpha1.ClusterWorkspaceDeletionFinalizer))
+	}
+	return nil
+}
+
+// Validate rejects the deletion of a ClusterWorkspace with child workspaces, unless it is
+// deleted with the Foreground propagation policy.
+func (o *clusterWorkspaceDeletion) Validate(ctx context.Context, a admission.Attributes, _ admission.ObjectInterfaces) (err error) {
+	if a.GetResource().GroupResource() != tenancyv1alpha1.Resource("clusterworkspaces") || a.GetSubresource() != "" {
+		return nil
+	}
+	if a.GetOperation() != admission.Delete {
+		return nil
+	}
+
+	if options, ok := a.GetOperationOptions().(*metav1.DeleteOptions); ok && options.PropagationPolicy != nil &&
+		*options.PropagationPolicy == metav1.DeletePropagationForeground {
+		return nil
+	}
+
+	clusterName, err := genericapirequest.ClusterNameFrom(ctx)
+	if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+
+	if !o.WaitForReady() {
+		return kcpadmissionhelpers.NewNotReadyError(a)
+	}
+
+	workspaceClusterName, err := helper.EncodeLogicalClusterName(&tenancyv1alpha1.ClusterWorkspace{
+		ObjectMeta: metav1.ObjectMeta{ClusterName: clusterName, Name: a.GetName()},
+	})
+	if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+	children, err := o.workspaceIndex.List(workspaceClusterName)
+	if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+	if len(children) > 0 {
+		return admission.NewForbidden(a, fmt.Errorf("workspace has %d child workspaces, delete them first or delete the whole subtree with the Foreground propagation policy", len(children)))
+	}
+	return nil
+}
+
+func (o *clusterWorkspaceDeletion) ValidateInitialization() error {
+	if o.workspaceIndex == nil {
+		return fmt.Errorf(PluginName + " plugin needs a ClusterWorkspace index")
+	}
+	return nil
+}
+
+func (o *clusterWorkspaceDeletion) SetKcpInformers(informers kcpinformers.SharedInformerFactory) {
+	workspaces := informers.Tenancy().V1alpha1().ClusterWorkspaces().Informer()
+	o.SetReadyFunc(workspaces.HasSynced)
+
+	// ValidateInitialization fails on a missing index
+	var err error
+	if o.workspaceIndex, err = kcpadmissionhelpers.NewClusterIndex(workspaces, tenancyv1alpha1.Resource("clusterworkspaces")); err != nil {
+		utilruntime.HandleError(err)
+	}
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clusterworkspacedeletion
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/tools/cache"
+
+	kcpadmissionhelpers "github.com/kcp-dev/kcp/pkg/admission/helpers"
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+)
+
+func createAttr(obj *unstructured.Unstructured) admission.Attributes {
+	return admission.NewAttributesRecord(
+		obj,
+		nil,
+		tenancyv1alpha1.Kind("ClusterWorkspace").WithVersion("v1alpha1"),
+		"",
+		obj.GetName(),
+		tenancyv1alpha1.Resource("clusterworkspaces").WithVersion("v1alpha1"),
+		"",
+		admission.Create,
+		&metav1.CreateOptions{},
+		false,
+		&user.DefaultInfo{},
+	)
+}
+
+func deleteAttr(name string, policy *metav1.DeletionPropagation) admission.Attributes {
+	return admission.NewAttributesRecord(
+		nil,
+		nil,
+		tenancyv1alpha1.Kind("ClusterWorkspace").WithVersion("v1alpha1"),
+		"",
+		name,
+		tenancyv1alpha1.Resource("clusterworkspaces").WithVersion("v1alpha1"),
+		"",
+		admission.Delete,
+		&metav1.DeleteOptions{PropagationPolicy: policy},
+		false,
+		&user.DefaultInfo{},
+	)
+}
+
+func TestAdmit(t *testing.T) {
+	tests := []struct {
+		name               string
+		finalizers         []string
+		expectedFinalizers []string
+	}{
+		{
+			name:               "adds the finalizer",
+			expectedFinalizers: []string{tenancyv1alpha1.ClusterWorkspaceDeletionFinalizer},
+		},
+		{
+			name:               "keeps other finalizers",
+			finalizers:         []string{"other"},
+			expectedFinalizers: []string{"other", tenancyv1alpha1.ClusterWorkspaceDeletionFinalizer},
+		},
+		{
+			name:               "does not add the finalizer twice",
+			finalizers:         []string{tenancyv1alpha1.ClusterWorkspaceDeletionFinalizer},
+			expectedFinalizers: []string{tenancyv1alpha1.ClusterWorkspaceDeletionFinalizer},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &unstructured.Unstructured{}
+			u.SetAPIVersion(tenancyv1alpha1.SchemeGroupVersion.String())
+			u.SetKind("ClusterWorkspace")
+			u.SetName("test")
+			u.SetFinalizers(tt.finalizers)
+
+			o := &clusterWorkspaceDeletion{Handler: admission.NewHandler(admission.Create, admission.Delete)}
+			ctx := request.WithCluster(context.Background(), request.Cluster{Name: "root:org"})
+			require.NoError(t, o.Admit(ctx, createAttr(u), nil))
+			require.Equal(t, tt.expectedFinalizers, u.GetFinalizers())
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	foreground := metav1.DeletePropagationForeground
+	background := metav1.DeletePropagationBackground
+
+	tests := []struct {
+		name        string
+		clusterName string
+		workspaces  []*tenancyv1alpha1.ClusterWorkspace
+		a           admission.Attributes
+		wantErr     bool
+	}{
+		{
+			name:        "allows deleting a workspace without child workspaces",
+			clusterName: "root:org",
+			workspaces: []*tenancyv1alpha1.ClusterWorkspace{
+				{ObjectMeta: metav1.ObjectMeta{ClusterName: "root:org", Name: "other"}},
+				{ObjectMeta: metav1.ObjectMeta{ClusterName: "org:other", Name: "child"}},
+			},
+			a: deleteAttr("test", nil),
+		},
+		{
+			name:        "rejects deleting a workspace with child workspaces",
+			clusterName: "root",
+			workspaces: []*tenancyv1alpha1.ClusterWorkspace{
+				{ObjectMeta: metav1.ObjectMeta{ClusterName: "root:org", Name: "child"}},
+			},
+			a:       deleteAttr("org", &background),
+			wantErr: true,
+		},
+		{
+			name:        "allows deleting a workspace with child workspaces in the foreground",
+			clusterName: "root",
+			workspaces: []*tenancyv1alpha1.ClusterWorkspace{
+				{ObjectMeta: metav1.ObjectMeta{ClusterName: "root:org", Name: "child"}},
+			},
+			a: deleteAttr("org", &foreground),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{kcpadmissionhelpers.ByLogicalClusterIndex: kcpadmissionhelpers.IndexByLogicalCluster})
+			for _, ws := range tt.workspaces {
+				require.NoError(t, indexer.Add(ws))
+			}
+			o := &clusterWorkspaceDeletion{
+				Handler:        admission.NewHandler(admission.Create, admission.Delete),
+				workspaceIndex: kcpadmissionhelpers.NewClusterIndexForIndexer(indexer, tenancyv1alpha1.Resource("clusterworkspaces")),
+			}
+			ctx := request.WithCluster(context.Background(), request.Cluster{Name: tt.clusterName})
+			err := o.Validate(ctx, tt.a, nil)
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clusterworkspaceplacement
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apiserver/pkg/admission"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/tools/clusters"
+
+	kcpadmissionhelpers "github.com/kcp-dev/kcp/pkg/admission/helpers"
+	kcpinitializers "github.com/kcp-dev/kcp/pkg/admission/initializers"
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+	kcpinformers "github.com/kcp-dev/kcp/pkg/client/informers/externalversions"
+	tenancylisters "github.com/kcp-dev/kcp/pkg/client/listers/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/workspacetype"
+)
+
+// Validate that ClusterWorkspaces are only placed, i.e. scheduled or moved, to
+// WorkspaceShards satisfying the required placement of the workspace and of its type.
+
+const (
+	PluginName = "tenancy.kcp.dev/ClusterWorkspacePlacement"
+)
+
+func Register(plugins *admission.Plugins) {
+	plugins.Register(PluginName,
+		func(_ io.Reader) (admission.Interface, error) {
+			return &clusterWorkspacePlacement{
+				Handler: admission.NewHandler(admission.Update),
+			}, nil
+		})
+}
+
+type clusterWorkspacePlacement struct {
+	*admission.Handler
+
+	shardLister      tenancylisters.WorkspaceShardLister
+	shardsHaveSynced func() bool
+	typeResolver     *workspacetype.Resolver
+}
+
+// Ensure that the required admission interfaces are implemented.
+var _ = admission.ValidationInterface(&clusterWorkspacePlacement{})
+var _ = admission.InitializationValidator(&clusterWorkspacePlacement{})
+var _ = kcpadmissionhelpers.ReadinessReporter(&clusterWorkspacePlacement{})
+var _ = kcpinitializers.WantsKcpInformers(&clusterWorkspacePlacement{})
+var _ = kcpinitializers.WantsClusterWorkspaceTypeResolver(&clusterWorkspacePlacement{})
+
+// Validate rejects setting status.location.current or status.location.target of a
+// ClusterWorkspace to a WorkspaceShard whose labels do not satisfy the required placement.
+func (o *clusterWorkspacePlacement) Validate(ctx context.Context, a admission.Attributes, _ admission.ObjectInterfaces) (err error) {
+	if a.GetResource().GroupResource() != tenancyv1alpha1.Resource("clusterworkspaces") {
+		return nil
+	}
+
+	obj, err := kcpadmissionhelpers.NativeObject(a.GetObject())
+	if err != nil {
+		// nolint: nilerr
+		return nil // only work on unstructured ClusterWorkspaces
+	}
+	cw, ok := obj.(*tenancyv1alpha1.ClusterWorkspace)
+	if !ok {
+		// nolint: nilerr
+		return nil // only work on unstructured ClusterWorkspaces
+	}
+	obj, err = kcpadmissionhelpers.NativeObject(a.GetOldObject())
+	if err != nil {
+		return fmt.Errorf("unexpected unknown old object, got %v, expected ClusterWorkspace", a.GetOldObject().GetObjectKind().GroupVersionKind().Kind)
+	}
+	old, ok := obj.(*tenancyv1alpha1.ClusterWorkspace)
+	if !ok {
+		return fmt.Errorf("unexpected unknown old object, got %v, expected ClusterWorkspace", obj.GetObjectKind().GroupVersionKind().Kind)
+	}
+
+	var shardNames []string
+	if current := cw.Status.Location.Current; current != "" && current != old.Status.Location.Current {
+		shardNames = append(shardNames, current)
+	}
+	if target := cw.Status.Location.Target; target != "" && target != old.Status.Location.Target {
+		shardNames = append(shardNames, target)
+	}
+	if len(shardNames) == 0 {
+		return nil
+	}
+
+	if !o.WaitForReady() {
+		return kcpadmissionhelpers.NewNotReadyError(a)
+	}
+
+	clusterName, err := genericapirequest.ClusterNameFrom(ctx)
+	if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+	placements, err := o.typeResolver.Placements(clusterName, cw)
+	if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+	if len(placements) == 0 {
+		return nil
+	}
+
+	for _, name := range shardNames {
+		shard, err := o.shardLister.Get(clusters.ToClusterAwareKey(helper.RootCluster, name))
+		if apierrors.IsNotFound(err) {
+			continue // the scheduler marks workspaces on missing shards as such
+		} else if err != nil {
+			return apierrors.NewInternalError(err)
+		}
+		satisfied, err := workspacetype.SatisfiesPlacements(shard, placements)
+		if err != nil {
+			return admission.NewForbidden(a, err)
+		}
+		if !satisfied {
+			return admission.NewForbidden(a, fmt.Errorf("WorkspaceShard %q does not satisfy the required placement of the workspace or of its type", name))
+		}
+	}
+	return nil
+}
+
+func (o *clusterWorkspacePlacement) ValidateInitialization() error {
+	if o.shardLister == nil {
+		return fmt.Errorf(PluginName + " plugin needs a WorkspaceShard lister")
+	}
+	if o.typeResolver == nil {
+		return fmt.Errorf(PluginName + " plugin needs a ClusterWorkspaceType resolver")
+	}
+	return nil
+}
+
+func (o *clusterWorkspacePlacement) SetKcpInformers(informers kcpinformers.SharedInformerFactory) {
+	shards := informers.Tenancy().V1alpha1().WorkspaceShards()
+	o.shardLister = shards.Lister()
+	o.shardsHaveSynced = shards.Informer().HasSynced
+	o.SetReadyFunc(o.HasSynced)
+}
+
+func (o *clusterWorkspacePlacement) SetClusterWorkspaceTypeResolver(typeResolver *workspacetype.Resolver) {
+	o.typeResolver = typeResolver
+	o.SetReadyFunc(o.HasSynced)
+}
+
+// HasSynced returns true when the WorkspaceShard and ClusterWorkspaceType informers have synced.
+func (o *clusterWorkspacePlacement) HasSynced() bool {
+	return (o.shardsHaveSynced == nil || o.shardsHaveSynced()) && (o.typeResolver == nil || o.typeResolver.HasSynced())
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clusterworkspaceplacement
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/tools/cache"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+	kcpinformers "github.com/kcp-dev/kcp/pkg/client/informers/externalversions"
+	tenancylisters "github.com/kcp-dev/kcp/pkg/client/listers/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/workspacetype"
+)
+
+func updateAttr(ws, old *tenancyv1alpha1.ClusterWorkspace) admission.Attributes {
+	return admission.NewAttributesRecord(
+		ws,
+		old,
+		tenancyv1alpha1.Kind("ClusterWorkspace").WithVersion("v1alpha1"),
+		"",
+		"test",
+		tenancyv1alpha1.Resource("clusterworkspaces").WithVersion("v1alpha1"),
+		"",
+		admission.Update,
+		&metav1.UpdateOptions{},
+		false,
+		&user.DefaultInfo{},
+	)
+}
+
+func TestValidate(t *testing.T) {
+	inRegion := func(region string) *tenancyv1alpha1.ClusterWorkspacePlacement {
+		return &tenancyv1alpha1.ClusterWorkspacePlacement{
+			Required: &metav1.LabelSelector{MatchLabels: map[string]string{"topology.kubernetes.io/region": region}},
+		}
+	}
+	shards := []*tenancyv1alpha1.WorkspaceShard{
+		{ObjectMeta: metav1.ObjectMeta{Name: "eu", ClusterName: helper.RootCluster, Labels: map[string]string{"topology.kubernetes.io/region": "eu-west-1"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "us", ClusterName: helper.RootCluster, Labels: map[string]string{"topology.kubernetes.io/region": "us-east-1"}}},
+	}
+	types := []*tenancyv1alpha1.ClusterWorkspaceType{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "european", ClusterName: "root:org"},
+			Spec:       tenancyv1alpha1.ClusterWorkspaceTypeSpec{Placement: inRegion("eu-west-1")},
+		},
+	}
+	workspace := func(typeName string, placement *tenancyv1alpha1.ClusterWorkspacePlacement, current, target string) *tenancyv1alpha1.ClusterWorkspace {
+		return &tenancyv1alpha1.ClusterWorkspace{
+			ObjectMeta: metav1.ObjectMeta{Name: "test"},
+			Spec:       tenancyv1alpha1.ClusterWorkspaceSpec{Type: typeName, Placement: placement},
+			Status: tenancyv1alpha1.ClusterWorkspaceStatus{
+				Location: tenancyv1alpha1.ClusterWorkspaceLocation{Current: current, Target: target},
+			},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		attr    admission.Attributes
+		wantErr bool
+	}{
+		{
+			name: "passes scheduling without placement",
+			attr: updateAttr(workspace("", nil, "us", ""), workspace("", nil, "", "")),
+		},
+		{
+			name: "passes scheduling to a shard satisfying the placement of the workspace",
+			attr: updateAttr(workspace("", inRegion("eu-west-1"), "eu", ""), workspace("", inRegion("eu-west-1"), "", "")),
+		},
+		{
+			name:    "rejects scheduling to a shard not satisfying the placement of the workspace",
+			attr:    updateAttr(workspace("", inRegion("eu-west-1"), "us", ""), workspace("", inRegion("eu-west-1"), "", "")),
+			wantErr: true,
+		},
+		{
+			name:    "rejects scheduling to a shard not satisfying the placement of the type",
+			attr:    updateAttr(workspace("European", nil, "us", ""), workspace("European", nil, "", "")),
+			wantErr: true,
+		},
+		{
+			name:    "rejects moving to a shard not satisfying the placement",
+			attr:    updateAttr(workspace("European", nil, "eu", "us"), workspace("European", nil, "eu", "")),
+			wantErr: true,
+		},
+		{
+			name: "passes unchanged locations",
+			attr: updateAttr(workspace("European", nil, "us", ""), workspace("European", nil, "us", "")),
+		},
+		{
+			name: "passes scheduling to an unknown shard",
+			attr: updateAttr(workspace("European", nil, "unknown", ""), workspace("European", nil, "", "")),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			for _, shard := range shards {
+				if err := indexer.Add(shard); err != nil {
+					t.Fatal(err)
+				}
+			}
+			o := &clusterWorkspacePlacement{
+				Handler:      admission.NewHandler(admission.Update),
+				shardLister:  tenancylisters.NewWorkspaceShardLister(indexer),
+				typeResolver: newTypeResolver(t, types),
+			}
+			ctx := request.WithCluster(context.Background(), request.Cluster{Name: "root:org"})
+			if err := o.Validate(ctx, tt.attr, nil); (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func newTypeResolver(t *testing.T, types []*tenancyv1alpha1.ClusterWorkspaceType) *workspacetype.Resolver {
+	typeInformer := kcpinformers.NewSharedInformerFactory(nil, 0).Tenancy().V1alpha1().ClusterWorkspaceTypes()
+	resolver, err := workspacetype.NewResolver(typeInformer, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cwt := range types {
+		if err := typeInformer.Informer().GetIndexer().Add(cwt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resolver
+}
@@ -21,17 +21,26 @@ import (
 	"errors"
 	"io"
 
+	apiextensionsinternal "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	crdvalidation "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/validation"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/apiserver/pkg/admission"
 	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
 
 	kcpadmissionhelpers "github.com/kcp-dev/kcp/pkg/admission/helpers"
 	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
 	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+	"github.com/kcp-dev/kcp/pkg/workspacetype"
 )
 
 // Validate ClusterWorkspaceTypes creation and updates for
 //  - "organization" type is only created in root workspace.
+//  - spec.placement is valid.
+//  - spec.protectedNamespaces are valid namespace names.
+//  - spec.additionalPrinterColumns are valid column definitions.
 
 const (
 	PluginName = "tenancy.kcp.dev/ClusterWorkspaceType"
@@ -77,5 +86,29 @@ func (o *clusterWorkspaceType) Validate(ctx context.Context, a admission.Attribu
 		return errors.New("organization type can only be created in root workspace")
 	}
 
+	if cwt.Spec.Placement != nil {
+		if errs := workspacetype.ValidatePlacement(cwt.Spec.Placement, field.NewPath("spec", "placement")); len(errs) > 0 {
+			return admission.NewForbidden(a, errs.ToAggregate())
+		}
+	}
+	var errs field.ErrorList
+	for i, namespace := range cwt.Spec.ProtectedNamespaces {
+		for _, msg := range validation.IsDNS1123Label(namespace) {
+			errs = append(errs, field.Invalid(field.NewPath("spec", "protectedNamespaces").Index(i), namespace, msg))
+		}
+	}
+	for i := range cwt.Spec.AdditionalPrinterColumns {
+		fldPath := field.NewPath("spec", "additionalPrinterColumns").Index(i)
+		var column apiextensionsinternal.CustomResourceColumnDefinition
+		if err := apiextensionsv1.Convert_v1_CustomResourceColumnDefinition_To_apiextensions_CustomResourceColumnDefinition(&cwt.Spec.AdditionalPrinterColumns[i], &column, nil); err != nil {
+			errs = append(errs, field.Invalid(fldPath, cwt.Spec.AdditionalPrinterColumns[i], err.Error()))
+			continue
+		}
+		errs = append(errs, crdvalidation.ValidateCustomResourceColumnDefinition(&column, fldPath)...)
+	}
+	if len(errs) > 0 {
+		return admission.NewForbidden(a, errs.ToAggregate())
+	}
+
 	return nil
 }
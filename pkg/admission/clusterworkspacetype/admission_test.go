@@ -20,6 +20,7 @@ import (
 	"context"
 	"testing"
 
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apiserver/pkg/admission"
 	"k8s.io/apiserver/pkg/authentication/user"
@@ -98,6 +99,51 @@ func TestValidate(t *testing.T) {
 			clusterName: "foo:bar",
 			wantErr:     true,
 		},
+		{
+			name: "allow valid additional printer columns",
+			a: createAttr(&tenancyv1alpha1.ClusterWorkspaceType{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test",
+				},
+				Spec: tenancyv1alpha1.ClusterWorkspaceTypeSpec{
+					AdditionalPrinterColumns: []apiextensionsv1.CustomResourceColumnDefinition{
+						{Name: "Environment", Type: "string", JSONPath: ".metadata.labels.environment"},
+					},
+				},
+			}),
+			clusterName: "foo:bar",
+			wantErr:     false,
+		},
+		{
+			name: "deny additional printer columns with invalid type",
+			a: createAttr(&tenancyv1alpha1.ClusterWorkspaceType{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test",
+				},
+				Spec: tenancyv1alpha1.ClusterWorkspaceTypeSpec{
+					AdditionalPrinterColumns: []apiextensionsv1.CustomResourceColumnDefinition{
+						{Name: "Environment", Type: "text", JSONPath: ".metadata.labels.environment"},
+					},
+				},
+			}),
+			clusterName: "foo:bar",
+			wantErr:     true,
+		},
+		{
+			name: "deny additional printer columns with invalid JSONPath",
+			a: createAttr(&tenancyv1alpha1.ClusterWorkspaceType{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test",
+				},
+				Spec: tenancyv1alpha1.ClusterWorkspaceTypeSpec{
+					AdditionalPrinterColumns: []apiextensionsv1.CustomResourceColumnDefinition{
+						{Name: "Environment", Type: "string", JSONPath: "metadata.labels.environment"},
+					},
+				},
+			}),
+			clusterName: "foo:bar",
+			wantErr:     true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
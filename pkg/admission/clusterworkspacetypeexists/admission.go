@@ -20,22 +20,20 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"strings"
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/apiserver/pkg/authentication/user"
 	"k8s.io/apiserver/pkg/authorization/authorizer"
 	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clusters"
 
 	kcpadmissionhelpers "github.com/kcp-dev/kcp/pkg/admission/helpers"
 	kcpinitializers "github.com/kcp-dev/kcp/pkg/admission/initializers"
 	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
-	kcpinformers "github.com/kcp-dev/kcp/pkg/client/informers/externalversions"
-	tenancyv1alpha1lister "github.com/kcp-dev/kcp/pkg/client/listers/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/workspacetype"
 )
 
 const (
@@ -53,12 +51,13 @@ func Register(plugins *admission.Plugins) {
 }
 
 // clusterWorkspaceTypeExists  does the following
-// - it checks existence of ClusterWorkspaceType in the same workspace,
+// - it checks existence of ClusterWorkspaceType in the same workspace, or of a type
+//   published for cross-workspace use in an ancestor workspace,
 // - it applies the ClusterWorkspaceType initializers to the ClusterWorkspace when it
 //   transitions to the Initializing state.
 type clusterWorkspaceTypeExists struct {
 	*admission.Handler
-	typeLister        tenancyv1alpha1lister.ClusterWorkspaceTypeLister
+	typeResolver      *workspacetype.Resolver
 	kubeClusterClient *kubernetes.Cluster
 
 	createAuthorizer kcpadmissionhelpers.AdmissionAuthorizerFactory
@@ -67,8 +66,9 @@ type clusterWorkspaceTypeExists struct {
 // Ensure that the required admission interfaces are implemented.
 var _ = admission.MutationInterface(&clusterWorkspaceTypeExists{})
 var _ = admission.ValidationInterface(&clusterWorkspaceTypeExists{})
+var _ = kcpadmissionhelpers.ReadinessReporter(&clusterWorkspaceTypeExists{})
 var _ = admission.InitializationValidator(&clusterWorkspaceTypeExists{})
-var _ = kcpinitializers.WantsKcpInformers(&clusterWorkspaceTypeExists{})
+var _ = kcpinitializers.WantsClusterWorkspaceTypeResolver(&clusterWorkspaceTypeExists{})
 var _ = kcpinitializers.WantsKubeClusterClient(&clusterWorkspaceTypeExists{})
 
 // Admit adds type initializer on transition to initializing phase.
@@ -113,7 +113,7 @@ func (o *clusterWorkspaceTypeExists) Admit(ctx context.Context, a admission.Attr
 	}
 
 	if !o.WaitForReady() {
-		return admission.NewForbidden(a, fmt.Errorf("not yet ready to handle request"))
+		return kcpadmissionhelpers.NewNotReadyError(a)
 	}
 
 	clusterName, err := genericapirequest.ClusterNameFrom(ctx)
@@ -121,9 +121,9 @@ func (o *clusterWorkspaceTypeExists) Admit(ctx context.Context, a admission.Attr
 		return apierrors.NewInternalError(err)
 	}
 
-	cwt, err := o.typeLister.Get(clusters.ToClusterAwareKey(clusterName, strings.ToLower(cw.Spec.Type)))
+	cwt, err := o.typeResolver.Resolve(clusterName, workspacetype.TypeName(cw))
 	if err != nil && apierrors.IsNotFound(err) {
-		if cw.Spec.Type == "Universal" {
+		if workspacetype.TypeName(cw) == workspacetype.UniversalType {
 			return nil // Universal is always valid
 		}
 		return admission.NewForbidden(a, fmt.Errorf("spec.type %q does not exist", cw.Spec.Type))
@@ -187,7 +187,7 @@ func (o *clusterWorkspaceTypeExists) Validate(ctx context.Context, a admission.A
 	}
 
 	if !o.WaitForReady() {
-		return admission.NewForbidden(a, fmt.Errorf("not yet ready to handle request"))
+		return kcpadmissionhelpers.NewNotReadyError(a)
 	}
 
 	// TODO(sttts): there is a race that the type can be deleted between scheduling and initializing
@@ -195,15 +195,16 @@ func (o *clusterWorkspaceTypeExists) Validate(ctx context.Context, a admission.A
 	//		        the race either. So, ¯\_(ツ)_/¯. Chance is low. Object can be deleted, or a condition could should
 	//              show it failing.
 	var cwt *tenancyv1alpha1.ClusterWorkspaceType
+	var clusterName string
 	if (a.GetOperation() == admission.Update && transitioningToInitializing) || a.GetOperation() == admission.Create {
-		clusterName, err := genericapirequest.ClusterNameFrom(ctx)
+		clusterName, err = genericapirequest.ClusterNameFrom(ctx)
 		if err != nil {
 			return apierrors.NewInternalError(err)
 		}
 
-		cwt, err = o.typeLister.Get(clusters.ToClusterAwareKey(clusterName, strings.ToLower(cw.Spec.Type)))
+		cwt, err = o.typeResolver.Resolve(clusterName, workspacetype.TypeName(cw))
 		if err != nil && apierrors.IsNotFound(err) {
-			if cw.Spec.Type == "Universal" {
+			if workspacetype.TypeName(cw) == workspacetype.UniversalType {
 				return nil // Universal is always valid
 			}
 			return admission.NewForbidden(a, fmt.Errorf("spec.type %q does not exist", cw.Spec.Type))
@@ -229,6 +230,10 @@ func (o *clusterWorkspaceTypeExists) Validate(ctx context.Context, a admission.A
 
 	// verify that the type can be used by the given user
 	if a.GetOperation() == admission.Create {
+		if cwt.ClusterName != clusterName && publishedTo(cwt, clusterName, a.GetUserInfo()) {
+			return nil
+		}
+
 		authz, err := o.createAuthorizer(cwt.ClusterName, o.kubeClusterClient)
 		if err != nil {
 			return admission.NewForbidden(a, fmt.Errorf("unable to determine access to cluster workspace type %q: %w", cw.Spec.Type, err))
@@ -253,16 +258,41 @@ func (o *clusterWorkspaceTypeExists) Validate(ctx context.Context, a admission.A
 	return nil
 }
 
+// publishedTo returns whether the type is published for use by the given user in the given
+// logical cluster.
+func publishedTo(cwt *tenancyv1alpha1.ClusterWorkspaceType, clusterName string, u user.Info) bool {
+	for _, ws := range cwt.Spec.AllowedWorkspaces {
+		if ws == "*" || ws == clusterName {
+			return true
+		}
+	}
+	if u == nil {
+		return false
+	}
+	groups := sets.NewString(u.GetGroups()...)
+	for _, g := range cwt.Spec.AllowedGroups {
+		if groups.Has(g) {
+			return true
+		}
+	}
+	return false
+}
+
 func (o *clusterWorkspaceTypeExists) ValidateInitialization() error {
-	if o.typeLister == nil {
-		return fmt.Errorf(PluginName + " plugin needs an ClusterWorkspaceType lister")
+	if o.typeResolver == nil {
+		return fmt.Errorf(PluginName + " plugin needs a ClusterWorkspaceType resolver")
 	}
 	return nil
 }
 
-func (o *clusterWorkspaceTypeExists) SetKcpInformers(informers kcpinformers.SharedInformerFactory) {
-	o.SetReadyFunc(informers.Tenancy().V1alpha1().ClusterWorkspaceTypes().Informer().HasSynced)
-	o.typeLister = informers.Tenancy().V1alpha1().ClusterWorkspaceTypes().Lister()
+func (o *clusterWorkspaceTypeExists) SetClusterWorkspaceTypeResolver(typeResolver *workspacetype.Resolver) {
+	o.typeResolver = typeResolver
+	o.SetReadyFunc(typeResolver.HasSynced)
+}
+
+// HasSynced returns true when the ClusterWorkspaceType informer has synced.
+func (o *clusterWorkspaceTypeExists) HasSynced() bool {
+	return o.typeResolver == nil || o.typeResolver.HasSynced()
 }
 
 func (o *clusterWorkspaceTypeExists) SetKubeClusterClient(kubeClusterClient *kubernetes.Cluster) {
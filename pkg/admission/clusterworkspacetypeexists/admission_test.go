@@ -22,9 +22,7 @@ import (
 	"reflect"
 	"testing"
 
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apiserver/pkg/admission"
 	"k8s.io/apiserver/pkg/authentication/user"
@@ -34,9 +32,15 @@ import (
 	"k8s.io/utils/diff"
 
 	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	kcpinformers "github.com/kcp-dev/kcp/pkg/client/informers/externalversions"
+	"github.com/kcp-dev/kcp/pkg/workspacetype"
 )
 
 func createAttr(ws *tenancyv1alpha1.ClusterWorkspace) admission.Attributes {
+	return createAttrAs(ws, &user.DefaultInfo{})
+}
+
+func createAttrAs(ws *tenancyv1alpha1.ClusterWorkspace, u user.Info) admission.Attributes {
 	return admission.NewAttributesRecord(
 		ws,
 		nil,
@@ -48,7 +52,7 @@ func createAttr(ws *tenancyv1alpha1.ClusterWorkspace) admission.Attributes {
 		admission.Create,
 		&metav1.CreateOptions{},
 		false,
-		&user.DefaultInfo{},
+		u,
 	)
 }
 
@@ -81,7 +85,8 @@ func TestAdmit(t *testing.T) {
 			types: []*tenancyv1alpha1.ClusterWorkspaceType{
 				{
 					ObjectMeta: metav1.ObjectMeta{
-						Name: "root:org#$#foo",
+						Name:        "foo",
+						ClusterName: "root:org",
 					},
 					Spec: tenancyv1alpha1.ClusterWorkspaceTypeSpec{
 						Initializers: []tenancyv1alpha1.ClusterWorkspaceInitializer{"a", "b"},
@@ -134,7 +139,8 @@ func TestAdmit(t *testing.T) {
 			types: []*tenancyv1alpha1.ClusterWorkspaceType{
 				{
 					ObjectMeta: metav1.ObjectMeta{
-						Name: "root:org#$#foo",
+						Name:        "foo",
+						ClusterName: "root:org",
 					},
 					Spec: tenancyv1alpha1.ClusterWorkspaceTypeSpec{
 						Initializers: []tenancyv1alpha1.ClusterWorkspaceInitializer{"a", "b"},
@@ -254,8 +260,8 @@ func TestAdmit(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			o := &clusterWorkspaceTypeExists{
-				Handler:    admission.NewHandler(admission.Create, admission.Update),
-				typeLister: fakeClusterWorkspaceTypeLister(tt.types),
+				Handler:      admission.NewHandler(admission.Create, admission.Update),
+				typeResolver: newTypeResolver(t, tt.types),
 			}
 			ctx := request.WithCluster(context.Background(), request.Cluster{Name: "root:org"})
 			if err := o.Admit(ctx, tt.a, nil); (err != nil) != tt.wantErr {
@@ -284,7 +290,8 @@ func TestValidate(t *testing.T) {
 			types: []*tenancyv1alpha1.ClusterWorkspaceType{
 				{
 					ObjectMeta: metav1.ObjectMeta{
-						Name: "root:org#$#foo",
+						Name:        "foo",
+						ClusterName: "root:org",
 					},
 				},
 			},
@@ -315,7 +322,8 @@ func TestValidate(t *testing.T) {
 			types: []*tenancyv1alpha1.ClusterWorkspaceType{
 				{
 					ObjectMeta: metav1.ObjectMeta{
-						Name: "root:bigcorp#$#foo",
+						Name:        "foo",
+						ClusterName: "root:bigcorp",
 					},
 				},
 			},
@@ -329,6 +337,97 @@ func TestValidate(t *testing.T) {
 			}),
 			wantErr: true,
 		},
+		{
+			name: "passes create if type of parent workspace is published to the workspace",
+			types: []*tenancyv1alpha1.ClusterWorkspaceType{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:        "foo",
+						ClusterName: "root",
+					},
+					Spec: tenancyv1alpha1.ClusterWorkspaceTypeSpec{
+						AllowedWorkspaces: []string{"root:org"},
+					},
+				},
+			},
+			attr: createAttr(&tenancyv1alpha1.ClusterWorkspace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test",
+				},
+				Spec: tenancyv1alpha1.ClusterWorkspaceSpec{
+					Type: "Foo",
+				},
+			}),
+			authzDecision: authorizer.DecisionNoOpinion,
+		},
+		{
+			name: "passes create if type of parent workspace is published to a group of the user",
+			types: []*tenancyv1alpha1.ClusterWorkspaceType{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:        "foo",
+						ClusterName: "root",
+					},
+					Spec: tenancyv1alpha1.ClusterWorkspaceTypeSpec{
+						AllowedGroups: []string{"platform-users"},
+					},
+				},
+			},
+			attr: createAttrAs(&tenancyv1alpha1.ClusterWorkspace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test",
+				},
+				Spec: tenancyv1alpha1.ClusterWorkspaceSpec{
+					Type: "Foo",
+				},
+			}, &user.DefaultInfo{Name: "alice", Groups: []string{"platform-users"}}),
+			authzDecision: authorizer.DecisionNoOpinion,
+		},
+		{
+			name: "fails if type of parent workspace is published to other workspaces and not authorized",
+			types: []*tenancyv1alpha1.ClusterWorkspaceType{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:        "foo",
+						ClusterName: "root",
+					},
+					Spec: tenancyv1alpha1.ClusterWorkspaceTypeSpec{
+						AllowedWorkspaces: []string{"root:bigcorp"},
+					},
+				},
+			},
+			attr: createAttr(&tenancyv1alpha1.ClusterWorkspace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test",
+				},
+				Spec: tenancyv1alpha1.ClusterWorkspaceSpec{
+					Type: "Foo",
+				},
+			}),
+			authzDecision: authorizer.DecisionNoOpinion,
+			wantErr:       true,
+		},
+		{
+			name: "fails if type of parent workspace is not published",
+			types: []*tenancyv1alpha1.ClusterWorkspaceType{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:        "foo",
+						ClusterName: "root",
+					},
+				},
+			},
+			attr: createAttr(&tenancyv1alpha1.ClusterWorkspace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test",
+				},
+				Spec: tenancyv1alpha1.ClusterWorkspaceSpec{
+					Type: "Foo",
+				},
+			}),
+			authzDecision: authorizer.DecisionAllow,
+			wantErr:       true,
+		},
 		{
 			name: "fails if not allowed",
 			attr: createAttr(&tenancyv1alpha1.ClusterWorkspace{
@@ -397,7 +496,8 @@ func TestValidate(t *testing.T) {
 			types: []*tenancyv1alpha1.ClusterWorkspaceType{
 				{
 					ObjectMeta: metav1.ObjectMeta{
-						Name: "root:org#$#universal",
+						Name:        "universal",
+						ClusterName: "root:org",
 					},
 				},
 			},
@@ -416,7 +516,8 @@ func TestValidate(t *testing.T) {
 			types: []*tenancyv1alpha1.ClusterWorkspaceType{
 				{
 					ObjectMeta: metav1.ObjectMeta{
-						Name: "root:org#$#foo",
+						Name:        "foo",
+						ClusterName: "root:org",
 					},
 					Spec: tenancyv1alpha1.ClusterWorkspaceTypeSpec{
 						Initializers: []tenancyv1alpha1.ClusterWorkspaceInitializer{"a", "b"},
@@ -453,7 +554,8 @@ func TestValidate(t *testing.T) {
 			types: []*tenancyv1alpha1.ClusterWorkspaceType{
 				{
 					ObjectMeta: metav1.ObjectMeta{
-						Name: "root:org#$#foo",
+						Name:        "foo",
+						ClusterName: "root:org",
 					},
 					Spec: tenancyv1alpha1.ClusterWorkspaceTypeSpec{
 						Initializers: []tenancyv1alpha1.ClusterWorkspaceInitializer{"a", "b"},
@@ -512,8 +614,8 @@ func TestValidate(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			o := &clusterWorkspaceTypeExists{
-				Handler:    admission.NewHandler(admission.Create, admission.Update),
-				typeLister: fakeClusterWorkspaceTypeLister(tt.types),
+				Handler:      admission.NewHandler(admission.Create, admission.Update),
+				typeResolver: newTypeResolver(t, tt.types),
 				createAuthorizer: func(clusterName string, client *kubernetes.Cluster) (authorizer.Authorizer, error) {
 					return &fakeAuthorizer{
 						tt.authzDecision,
@@ -529,27 +631,18 @@ func TestValidate(t *testing.T) {
 	}
 }
 
-type fakeClusterWorkspaceTypeLister []*tenancyv1alpha1.ClusterWorkspaceType
-
-func (l fakeClusterWorkspaceTypeLister) List(selector labels.Selector) (ret []*tenancyv1alpha1.ClusterWorkspaceType, err error) {
-	return l.ListWithContext(context.Background(), selector)
-}
-
-func (l fakeClusterWorkspaceTypeLister) ListWithContext(ctx context.Context, selector labels.Selector) (ret []*tenancyv1alpha1.ClusterWorkspaceType, err error) {
-	return l, nil
-}
-
-func (l fakeClusterWorkspaceTypeLister) Get(name string) (*tenancyv1alpha1.ClusterWorkspaceType, error) {
-	return l.GetWithContext(context.Background(), name)
-}
-
-func (l fakeClusterWorkspaceTypeLister) GetWithContext(ctx context.Context, name string) (*tenancyv1alpha1.ClusterWorkspaceType, error) {
-	for _, t := range l {
-		if t.Name == name {
-			return t, nil
+func newTypeResolver(t *testing.T, types []*tenancyv1alpha1.ClusterWorkspaceType) *workspacetype.Resolver {
+	typeInformer := kcpinformers.NewSharedInformerFactory(nil, 0).Tenancy().V1alpha1().ClusterWorkspaceTypes()
+	resolver, err := workspacetype.NewResolver(typeInformer, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cwt := range types {
+		if err := typeInformer.Informer().GetIndexer().Add(cwt); err != nil {
+			t.Fatal(err)
 		}
 	}
-	return nil, apierrors.NewNotFound(tenancyv1alpha1.Resource("clusterworkspacetype"), name)
+	return resolver
 }
 
 type fakeAuthorizer struct {
@@ -0,0 +1,86 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ByLogicalClusterIndex is the name of the informer index of objects by logical cluster.
+const ByLogicalClusterIndex = "admission-by-logical-cluster"
+
+// IndexByLogicalCluster indexes objects by their logical cluster.
+func IndexByLogicalCluster(obj interface{}) ([]string, error) {
+	metaObj, ok := obj.(metav1.Object)
+	if !ok {
+		return []string{}, fmt.Errorf("obj is supposed to be a metav1.Object, but is %T", obj)
+	}
+	return []string{metaObj.GetClusterName()}, nil
+}
+
+// ClusterIndex looks up the objects of an informer by logical cluster through the
+// ByLogicalClusterIndex, instead of composing cluster aware keys for every lookup.
+type ClusterIndex struct {
+	indexer  cache.Indexer
+	resource schema.GroupResource
+}
+
+// NewClusterIndex adds the ByLogicalClusterIndex to the given informer, unless another
+// admission plugin or chain already did, and returns a ClusterIndex on top of it. It must
+// be called before the informer is started.
+func NewClusterIndex(informer cache.SharedIndexInformer, resource schema.GroupResource) (*ClusterIndex, error) {
+	if _, found := informer.GetIndexer().GetIndexers()[ByLogicalClusterIndex]; !found {
+		if err := informer.AddIndexers(cache.Indexers{ByLogicalClusterIndex: IndexByLogicalCluster}); err != nil {
+			return nil, err
+		}
+	}
+	return NewClusterIndexForIndexer(informer.GetIndexer(), resource), nil
+}
+
+// NewClusterIndexForIndexer returns a ClusterIndex for an indexer which already has the
+// ByLogicalClusterIndex.
+func NewClusterIndexForIndexer(indexer cache.Indexer, resource schema.GroupResource) *ClusterIndex {
+	return &ClusterIndex{
+		indexer:  indexer,
+		resource: resource,
+	}
+}
+
+// List returns the objects in the given logical cluster.
+func (i *ClusterIndex) List(clusterName string) ([]interface{}, error) {
+	return i.indexer.ByIndex(ByLogicalClusterIndex, clusterName)
+}
+
+// Get returns the object of the given name in the given logical cluster, or a NotFound
+// error.
+func (i *ClusterIndex) Get(clusterName, name string) (interface{}, error) {
+	objs, err := i.List(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range objs {
+		if metaObj, ok := obj.(metav1.Object); ok && metaObj.GetName() == name {
+			return obj, nil
+		}
+	}
+	return nil, apierrors.NewNotFound(i.resource, name)
+}
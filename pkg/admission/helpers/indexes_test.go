@@ -0,0 +1,54 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestClusterIndex(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{ByLogicalClusterIndex: IndexByLogicalCluster})
+	for _, obj := range []*metav1.PartialObjectMetadata{
+		{ObjectMeta: metav1.ObjectMeta{ClusterName: "root:org", Name: "foo"}},
+		{ObjectMeta: metav1.ObjectMeta{ClusterName: "root:org", Name: "bar"}},
+		{ObjectMeta: metav1.ObjectMeta{ClusterName: "root:other", Name: "foo"}},
+	} {
+		require.NoError(t, indexer.Add(obj))
+	}
+	index := NewClusterIndexForIndexer(indexer, schema.GroupResource{Group: "test.kcp.dev", Resource: "things"})
+
+	objs, err := index.List("root:org")
+	require.NoError(t, err)
+	require.Len(t, objs, 2)
+
+	obj, err := index.Get("root:other", "foo")
+	require.NoError(t, err)
+	require.Equal(t, "root:other", obj.(metav1.Object).GetClusterName())
+
+	_, err = index.Get("root:other", "bar")
+	require.True(t, apierrors.IsNotFound(err), "expected NotFound, got %v", err)
+
+	objs, err = index.List("root:missing")
+	require.NoError(t, err)
+	require.Empty(t, objs)
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/apiserver/pkg/admission"
+)
+
+// ReadinessReporter is implemented by admission plugins that deny requests until
+// their informers have synced, i.e. that use admission.Handler's WaitForReady.
+type ReadinessReporter interface {
+	// HasSynced returns true when the plugin is ready to handle requests. It must not block.
+	HasSynced() bool
+}
+
+// NewNotReadyError returns the error admission plugins return while they are not yet ready
+// to handle requests. It points at the readyz check that tells which plugins are waiting.
+func NewNotReadyError(a admission.Attributes) error {
+	return admission.NewForbidden(a, fmt.Errorf("not yet ready to handle request, see the %s check of /readyz", AdmissionReadinessCheckName))
+}
+
+// AdmissionReadinessCheckName is the name of the readyz check of ReadinessTracker.
+const AdmissionReadinessCheckName = "kcp-admission-plugins"
+
+// ReadinessTracker records the admission plugins implementing ReadinessReporter and exposes
+// them as a readyz check, failing as long as one of them is not ready.
+type ReadinessTracker struct {
+	lock    sync.RWMutex
+	plugins map[string][]ReadinessReporter
+}
+
+// NewReadinessTracker returns an empty ReadinessTracker.
+func NewReadinessTracker() *ReadinessTracker {
+	return &ReadinessTracker{
+		plugins: map[string][]ReadinessReporter{},
+	}
+}
+
+// Decorator returns an admission decorator recording the plugins it decorates. It must
+// come first in the decorator chain, as other decorators hide the plugin type.
+func (t *ReadinessTracker) Decorator() admission.Decorator {
+	return admission.DecoratorFunc(func(handler admission.Interface, name string) admission.Interface {
+		if reporter, ok := handler.(ReadinessReporter); ok {
+			t.lock.Lock()
+			defer t.lock.Unlock()
+			// the plugins are instantiated once per admission chain, i.e. once per apiserver of the chain
+			t.plugins[name] = append(t.plugins[name], reporter)
+		}
+		return handler
+	})
+}
+
+func (t *ReadinessTracker) Name() string {
+	return AdmissionReadinessCheckName
+}
+
+func (t *ReadinessTracker) Check(_ *http.Request) error {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	var notReady []string
+	for name, reporters := range t.plugins {
+		for _, reporter := range reporters {
+			if !reporter.HasSynced() {
+				notReady = append(notReady, name)
+				break
+			}
+		}
+	}
+	if len(notReady) > 0 {
+		sort.Strings(notReady)
+		return fmt.Errorf("admission plugins not yet ready to handle requests: %s", strings.Join(notReady, ", "))
+	}
+	return nil
+}
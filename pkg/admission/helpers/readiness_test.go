@@ -0,0 +1,56 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apiserver/pkg/admission"
+)
+
+type fakePlugin struct {
+	*admission.Handler
+	synced bool
+}
+
+func (p *fakePlugin) HasSynced() bool {
+	return p.synced
+}
+
+func TestReadinessTracker(t *testing.T) {
+	tracker := NewReadinessTracker()
+	decorator := tracker.Decorator()
+
+	a := &fakePlugin{Handler: admission.NewHandler(admission.Create)}
+	b := &fakePlugin{Handler: admission.NewHandler(admission.Create)}
+	bOtherChain := &fakePlugin{Handler: admission.NewHandler(admission.Create), synced: true}
+	other := admission.NewHandler(admission.Create)
+
+	require.Equal(t, a, decorator.Decorate(a, "a"))
+	decorator.Decorate(b, "b")
+	decorator.Decorate(bOtherChain, "b")
+	decorator.Decorate(other, "other")
+
+	require.EqualError(t, tracker.Check(nil), "admission plugins not yet ready to handle requests: a, b")
+
+	a.synced = true
+	require.EqualError(t, tracker.Check(nil), "admission plugins not yet ready to handle requests: b")
+
+	b.synced = true
+	require.NoError(t, tracker.Check(nil))
+}
@@ -21,37 +21,41 @@ import (
 
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/util/json"
 
 	kcpclientscheme "github.com/kcp-dev/kcp/pkg/client/clientset/versioned/scheme"
 )
 
 // DecodeUnstructured decodes an unstructured KCP object into the Golang type.
+//
+// The fields are converted directly, without a round-trip through JSON, which matters
+// for the admission plugins decoding every ClusterWorkspace write. The converter caches
+// the field layout of every Golang type.
 func DecodeUnstructured(u *unstructured.Unstructured) (runtime.Object, error) {
-	bs, err := json.Marshal(u)
+	newObj, err := kcpclientscheme.Scheme.New(u.GroupVersionKind())
 	if err != nil {
 		return nil, err
 	}
-	newObj, err := runtime.Decode(kcpclientscheme.Codecs.UniversalDecoder(u.GroupVersionKind().GroupVersion()), bs)
-	if err != nil {
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), newObj); err != nil {
 		return nil, err
 	}
+	kcpclientscheme.Scheme.Default(newObj)
 	return newObj, nil
 }
 
+// EncodeIntoUnstructured replaces the content of the unstructured object with the given
+// Golang object, of the same kind.
 func EncodeIntoUnstructured(u *unstructured.Unstructured, obj runtime.Object) error {
 	if u == nil {
 		return fmt.Errorf("unstructured object is nil") // programming error
 	}
 
-	bs, err := runtime.Encode(kcpclientscheme.Codecs.LegacyCodec(u.GroupVersionKind().GroupVersion()), obj)
-	if err != nil {
-		return err
-	}
-	err = json.Unmarshal(bs, &u.Object)
+	gvk := u.GroupVersionKind()
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
 	if err != nil {
 		return err
 	}
+	u.SetUnstructuredContent(content)
+	u.SetGroupVersionKind(gvk)
 	return nil
 }
 
@@ -0,0 +1,117 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/json"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	kcpclientscheme "github.com/kcp-dev/kcp/pkg/client/clientset/versioned/scheme"
+)
+
+func newClusterWorkspace() *tenancyv1alpha1.ClusterWorkspace {
+	return &tenancyv1alpha1.ClusterWorkspace{
+		TypeMeta: metav1.TypeMeta{APIVersion: tenancyv1alpha1.SchemeGroupVersion.String(), Kind: "ClusterWorkspace"},
+		ObjectMeta: metav1.ObjectMeta{
+			ClusterName:       "root:org",
+			Name:              "ws",
+			ResourceVersion:   "42",
+			CreationTimestamp: metav1.NewTime(time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC).Local()),
+			Labels:            map[string]string{"team": "a"},
+		},
+		Spec: tenancyv1alpha1.ClusterWorkspaceSpec{
+			Type: "Universal",
+			Authentication: &tenancyv1alpha1.ClusterWorkspaceAuthentication{
+				OIDC: &tenancyv1alpha1.OIDCAuthentication{IssuerURL: "https://issuer", ClientID: "kcp", CABundle: []byte("ca")},
+			},
+		},
+		Status: tenancyv1alpha1.ClusterWorkspaceStatus{
+			Phase:        tenancyv1alpha1.ClusterWorkspacePhaseInitializing,
+			Initializers: []tenancyv1alpha1.ClusterWorkspaceInitializer{"a", "b"},
+			Usage:        &tenancyv1alpha1.ClusterWorkspaceUsage{ObjectCount: 3, StorageBytes: 1024},
+		},
+	}
+}
+
+// toUnstructuredThroughJSON converts like the apiserver does for the objects served by CRDs.
+func toUnstructuredThroughJSON(t testing.TB, obj runtime.Object) *unstructured.Unstructured {
+	bs, err := json.Marshal(obj)
+	require.NoError(t, err)
+	u := &unstructured.Unstructured{}
+	require.NoError(t, json.Unmarshal(bs, &u.Object))
+	return u
+}
+
+func TestDecodeUnstructured(t *testing.T) {
+	ws := newClusterWorkspace()
+
+	obj, err := DecodeUnstructured(toUnstructuredThroughJSON(t, ws))
+	require.NoError(t, err)
+	require.Equal(t, ws, obj)
+
+	_, err = DecodeUnstructured(&unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "unknown.kcp.dev/v1", "kind": "Unknown"}})
+	require.Error(t, err)
+}
+
+func TestEncodeIntoUnstructured(t *testing.T) {
+	ws := newClusterWorkspace()
+	u := toUnstructuredThroughJSON(t, ws)
+
+	updated := ws.DeepCopy()
+	updated.TypeMeta = metav1.TypeMeta{}
+	updated.Labels = nil
+	updated.Status.Initializers = []tenancyv1alpha1.ClusterWorkspaceInitializer{"b"}
+	require.NoError(t, EncodeIntoUnstructured(u, updated))
+
+	updated.TypeMeta = ws.TypeMeta
+	require.Equal(t, toUnstructuredThroughJSON(t, updated), u, "the content is replaced, keeping the kind")
+
+	require.Error(t, EncodeIntoUnstructured(nil, updated))
+}
+
+func BenchmarkDecodeUnstructured(b *testing.B) {
+	u := toUnstructuredThroughJSON(b, newClusterWorkspace())
+
+	b.Run("typed", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := DecodeUnstructured(u); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("json", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			bs, err := json.Marshal(u)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := runtime.Decode(kcpclientscheme.Codecs.UniversalDecoder(u.GroupVersionKind().GroupVersion()), bs); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
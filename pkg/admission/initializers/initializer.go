@@ -17,11 +17,14 @@ limitations under the License.
 package initializers
 
 import (
+	apiextensionsinformers "k8s.io/apiextensions-apiserver/pkg/client/informers/externalversions"
 	"k8s.io/apiserver/pkg/admission"
 	"k8s.io/client-go/kubernetes"
 
 	kcpclientset "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
 	kcpinformers "github.com/kcp-dev/kcp/pkg/client/informers/externalversions"
+	"github.com/kcp-dev/kcp/pkg/objectcount"
+	"github.com/kcp-dev/kcp/pkg/workspacetype"
 )
 
 // NewKcpInformersInitializer returns an admission plugin initializer that injects
@@ -83,3 +86,63 @@ func (i *kcpClusterClientInitializer) Initialize(plugin admission.Interface) {
 		wants.SetKcpClusterClient(i.kcpClusterClient)
 	}
 }
+
+// NewAPIExtensionsInformersInitializer returns an admission plugin initializer that injects
+// an apiextensions shared informer factory into admission plugins.
+func NewAPIExtensionsInformersInitializer(
+	apiExtensionsInformers apiextensionsinformers.SharedInformerFactory,
+) *apiExtensionsInformersInitializer {
+	return &apiExtensionsInformersInitializer{
+		apiExtensionsInformers: apiExtensionsInformers,
+	}
+}
+
+type apiExtensionsInformersInitializer struct {
+	apiExtensionsInformers apiextensionsinformers.SharedInformerFactory
+}
+
+func (i *apiExtensionsInformersInitializer) Initialize(plugin admission.Interface) {
+	if wants, ok := plugin.(WantsAPIExtensionsInformers); ok {
+		wants.SetAPIExtensionsInformers(i.apiExtensionsInformers)
+	}
+}
+
+// NewClusterWorkspaceTypeResolverInitializer returns an admission plugin initializer that
+// injects the shared ClusterWorkspaceType resolver into admission plugins.
+func NewClusterWorkspaceTypeResolverInitializer(
+	typeResolver *workspacetype.Resolver,
+) *clusterWorkspaceTypeResolverInitializer {
+	return &clusterWorkspaceTypeResolverInitializer{
+		typeResolver: typeResolver,
+	}
+}
+
+type clusterWorkspaceTypeResolverInitializer struct {
+	typeResolver *workspacetype.Resolver
+}
+
+func (i *clusterWorkspaceTypeResolverInitializer) Initialize(plugin admission.Interface) {
+	if wants, ok := plugin.(WantsClusterWorkspaceTypeResolver); ok {
+		wants.SetClusterWorkspaceTypeResolver(i.typeResolver)
+	}
+}
+
+// NewObjectCounterInitializer returns an admission plugin initializer that
+// injects the shared object counter into admission plugins.
+func NewObjectCounterInitializer(
+	counter *objectcount.Counter,
+) *objectCounterInitializer {
+	return &objectCounterInitializer{
+		counter: counter,
+	}
+}
+
+type objectCounterInitializer struct {
+	counter *objectcount.Counter
+}
+
+func (i *objectCounterInitializer) Initialize(plugin admission.Interface) {
+	if wants, ok := plugin.(WantsObjectCounter); ok {
+		wants.SetObjectCounter(i.counter)
+	}
+}
@@ -17,10 +17,13 @@ limitations under the License.
 package initializers
 
 import (
+	apiextensionsinformers "k8s.io/apiextensions-apiserver/pkg/client/informers/externalversions"
 	"k8s.io/client-go/kubernetes"
 
 	kcpclientset "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
 	kcpinformers "github.com/kcp-dev/kcp/pkg/client/informers/externalversions"
+	"github.com/kcp-dev/kcp/pkg/objectcount"
+	"github.com/kcp-dev/kcp/pkg/workspacetype"
 )
 
 // WantsKcpInformers interface should be implemented by admission plugins
@@ -40,3 +43,21 @@ type WantsKubeClusterClient interface {
 type WantsKcpClusterClient interface {
 	SetKcpClusterClient(kubeClusterClient *kcpclientset.Cluster)
 }
+
+// WantsAPIExtensionsInformers interface should be implemented by admission plugins
+// that want to have an apiextensions informer factory injected.
+type WantsAPIExtensionsInformers interface {
+	SetAPIExtensionsInformers(informers apiextensionsinformers.SharedInformerFactory)
+}
+
+// WantsClusterWorkspaceTypeResolver interface should be implemented by admission plugins
+// that want to have the shared ClusterWorkspaceType resolver injected.
+type WantsClusterWorkspaceTypeResolver interface {
+	SetClusterWorkspaceTypeResolver(typeResolver *workspacetype.Resolver)
+}
+
+// WantsObjectCounter interface should be implemented by admission plugins
+// that want to have the shared object counter injected.
+type WantsObjectCounter interface {
+	SetObjectCounter(counter *objectcount.Counter)
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package objectcountquota
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apiserver/pkg/admission"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+	kcpinformers "github.com/kcp-dev/kcp/pkg/client/informers/externalversions"
+	tenancylisters "github.com/kcp-dev/kcp/pkg/client/listers/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/objectcount"
+)
+
+// Validate creations against the spec.quota.objectCount limits of the ClusterWorkspace
+// of the logical cluster, using the counts of the shared object counter instead of
+// listing the objects of the logical cluster.
+
+const (
+	PluginName = "tenancy.kcp.dev/ObjectCountQuota"
+)
+
+func Register(plugins *admission.Plugins) {
+	plugins.Register(PluginName,
+		func(_ io.Reader) (admission.Interface, error) {
+			return &objectCountQuota{
+				Handler: admission.NewHandler(admission.Create),
+			}, nil
+		})
+}
+
+type objectCountQuota struct {
+	*admission.Handler
+
+	workspaceLister tenancylisters.ClusterWorkspaceLister
+	counter         *objectcount.Counter
+	hasSynced       func() bool
+}
+
+// Ensure that the required admission interfaces are implemented.
+var _ = admission.ValidationInterface(&objectCountQuota{})
+var _ = admission.InitializationValidator(&objectCountQuota{})
+
+// Validate rejects the creation of an object if the number of objects of its resource
+// in the logical cluster reached the limit of the ClusterWorkspace.
+func (o *objectCountQuota) Validate(ctx context.Context, a admission.Attributes, _ admission.ObjectInterfaces) (err error) {
+	if a.GetSubresource() != "" {
+		return nil
+	}
+
+	clusterName, err := genericapirequest.ClusterNameFrom(ctx)
+	if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+	if clusterName == helper.RootCluster || strings.HasPrefix(clusterName, helper.LocalSystemClusterPrefix) {
+		return nil // not defined by a ClusterWorkspace
+	}
+	org, name, err := helper.ParseLogicalClusterName(clusterName)
+	if err != nil {
+		// nolint: nilerr
+		return nil // not defined by a ClusterWorkspace
+	}
+	ws, err := o.workspaceLister.Get(helper.WorkspaceKey(org, name))
+	if apierrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+	if ws.Spec.Quota == nil {
+		return nil
+	}
+
+	resource := a.GetResource().GroupResource()
+	limit, found := ws.Spec.Quota.ObjectCount[resource.String()]
+	if !found {
+		return nil
+	}
+	if count := o.counter.Count(clusterName, resource); count >= limit {
+		return admission.NewForbidden(a, fmt.Errorf("exceeded object count quota of workspace %q for %s: %d of %d objects", clusterName, resource, count, limit))
+	}
+	return nil
+}
+
+func (o *objectCountQuota) ValidateInitialization() error {
+	if o.workspaceLister == nil {
+		return fmt.Errorf(PluginName + " plugin needs a ClusterWorkspace lister")
+	}
+	if o.counter == nil {
+		return fmt.Errorf(PluginName + " plugin needs an object counter")
+	}
+	return nil
+}
+
+func (o *objectCountQuota) SetKcpInformers(informers kcpinformers.SharedInformerFactory) {
+	workspaces := informers.Tenancy().V1alpha1().ClusterWorkspaces()
+	o.workspaceLister = workspaces.Lister()
+	o.hasSynced = workspaces.Informer().HasSynced
+	o.SetReadyFunc(o.hasSynced)
+}
+
+func (o *objectCountQuota) SetObjectCounter(counter *objectcount.Counter) {
+	o.counter = counter
+}
+
+// HasSynced returns true when the ClusterWorkspace informer has synced.
+func (o *objectCountQuota) HasSynced() bool {
+	return o.hasSynced == nil || o.hasSynced()
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package objectcountquota
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/tools/cache"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	tenancylisters "github.com/kcp-dev/kcp/pkg/client/listers/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/objectcount"
+)
+
+var (
+	configMaps  = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	deployments = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	secrets     = schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+)
+
+func createAttr(resource schema.GroupVersionResource, subresource string) admission.Attributes {
+	return admission.NewAttributesRecord(
+		&metav1.PartialObjectMetadata{},
+		nil,
+		schema.GroupVersionKind{},
+		"default",
+		"test",
+		resource,
+		subresource,
+		admission.Create,
+		&metav1.CreateOptions{},
+		false,
+		&user.DefaultInfo{},
+	)
+}
+
+func newWorkspaceLister(workspaces ...*tenancyv1alpha1.ClusterWorkspace) tenancylisters.ClusterWorkspaceLister {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, ws := range workspaces {
+		if err := indexer.Add(ws); err != nil {
+			panic(err)
+		}
+	}
+	return tenancylisters.NewClusterWorkspaceLister(indexer)
+}
+
+func TestValidate(t *testing.T) {
+	quota := &tenancyv1alpha1.ClusterWorkspaceQuota{
+		ObjectCount: map[string]int64{"configmaps": 2, "deployments.apps": 0},
+	}
+	workspaces := newWorkspaceLister(
+		&tenancyv1alpha1.ClusterWorkspace{
+			ObjectMeta: metav1.ObjectMeta{ClusterName: "root:org", Name: "limited"},
+			Spec:       tenancyv1alpha1.ClusterWorkspaceSpec{Quota: quota},
+		},
+		&tenancyv1alpha1.ClusterWorkspace{
+			ObjectMeta: metav1.ObjectMeta{ClusterName: "root", Name: "org"},
+			Spec:       tenancyv1alpha1.ClusterWorkspaceSpec{Quota: quota},
+		},
+		&tenancyv1alpha1.ClusterWorkspace{
+			ObjectMeta: metav1.ObjectMeta{ClusterName: "root:org", Name: "unlimited"},
+		},
+	)
+
+	counter := objectcount.NewCounter()
+	for _, clusterName := range []string{"org:limited", "org:unlimited", "root:org", "root"} {
+		for i := 0; i < 2; i++ {
+			counter.OnAdd(configMaps, &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{ClusterName: clusterName, Namespace: "default", Name: fmt.Sprintf("cm-%d", i)}})
+		}
+	}
+
+	tests := []struct {
+		name        string
+		clusterName string
+		a           admission.Attributes
+		wantErr     bool
+	}{
+		{
+			name:        "rejects beyond the limit",
+			clusterName: "org:limited",
+			a:           createAttr(configMaps, ""),
+			wantErr:     true,
+		},
+		{
+			name:        "rejects beyond the limit of an organization",
+			clusterName: "root:org",
+			a:           createAttr(configMaps, ""),
+			wantErr:     true,
+		},
+		{
+			name:        "rejects resources with group",
+			clusterName: "org:limited",
+			a:           createAttr(deployments, ""),
+			wantErr:     true,
+		},
+		{
+			name:        "allows resources without limit",
+			clusterName: "org:limited",
+			a:           createAttr(secrets, ""),
+		},
+		{
+			name:        "allows subresources",
+			clusterName: "org:limited",
+			a:           createAttr(configMaps, "status"),
+		},
+		{
+			name:        "allows workspaces without quota",
+			clusterName: "org:unlimited",
+			a:           createAttr(configMaps, ""),
+		},
+		{
+			name:        "allows unknown workspaces",
+			clusterName: "org:unknown",
+			a:           createAttr(configMaps, ""),
+		},
+		{
+			name:        "allows the root workspace",
+			clusterName: "root",
+			a:           createAttr(configMaps, ""),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &objectCountQuota{
+				Handler:         admission.NewHandler(admission.Create),
+				workspaceLister: workspaces,
+				counter:         counter,
+			}
+			ctx := request.WithCluster(context.Background(), request.Cluster{Name: tt.clusterName})
+			err := o.Validate(ctx, tt.a, nil)
+			if tt.wantErr {
+				require.True(t, apierrors.IsForbidden(err), "expected forbidden error, got %v", err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
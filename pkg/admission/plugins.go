@@ -17,6 +17,9 @@ limitations under the License.
 package admission
 
 import (
+	"fmt"
+	"strings"
+
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apiserver/pkg/admission"
 	"k8s.io/apiserver/pkg/admission/plugin/namespace/lifecycle"
@@ -39,39 +42,128 @@ import (
 	"k8s.io/kubernetes/plugin/pkg/admission/storage/storageclass/setdefault"
 	"k8s.io/kubernetes/plugin/pkg/admission/storage/storageobjectinuseprotection"
 
+	"github.com/kcp-dev/kcp/pkg/admission/apibinding"
+	"github.com/kcp-dev/kcp/pkg/admission/apiexportwebhooks"
 	"github.com/kcp-dev/kcp/pkg/admission/apiresourceschema"
 	"github.com/kcp-dev/kcp/pkg/admission/clusterworkspace"
+	"github.com/kcp-dev/kcp/pkg/admission/clusterworkspacedeletion"
+	"github.com/kcp-dev/kcp/pkg/admission/clusterworkspaceplacement"
 	"github.com/kcp-dev/kcp/pkg/admission/clusterworkspacetype"
 	"github.com/kcp-dev/kcp/pkg/admission/clusterworkspacetypeexists"
+	"github.com/kcp-dev/kcp/pkg/admission/objectcountquota"
+	"github.com/kcp-dev/kcp/pkg/admission/protectednamespaces"
+	"github.com/kcp-dev/kcp/pkg/admission/sharedclusterroles"
+	"github.com/kcp-dev/kcp/pkg/admission/syncerwrites"
+	"github.com/kcp-dev/kcp/pkg/admission/workspaceresourcequota"
 )
 
-// AllOrderedPlugins is the list of all the plugins in order.
-var AllOrderedPlugins = beforeWebhooks(kubeapiserveroptions.AllOrderedPlugins,
+// DefaultKcpPluginOrder is the default order of the kcp admission plugins, relative to the
+// admission webhooks of the workspaces. The webhooks of APIExports are called after the
+// webhooks of the workspaces, so that service providers have the last word on their resources.
+var DefaultKcpPluginOrder = []string{
 	apiresourceschema.PluginName,
+	apibinding.PluginName,
 	clusterworkspace.PluginName,
+	clusterworkspacedeletion.PluginName,
 	clusterworkspacetype.PluginName,
 	clusterworkspacetypeexists.PluginName,
-)
+	clusterworkspaceplacement.PluginName,
+	protectednamespaces.PluginName,
+	sharedclusterroles.PluginName,
+	syncerwrites.PluginName,
+	objectcountquota.PluginName,
+	workspaceresourcequota.PluginName,
+	mutatingwebhook.PluginName,
+	validatingwebhook.PluginName,
+	apiexportwebhooks.PluginName,
+}
 
-func beforeWebhooks(recommended []string, plugins ...string) []string {
-	ret := make([]string, 0, len(recommended)+len(plugins))
-	for _, plugin := range recommended {
-		if plugin == mutatingwebhook.PluginName {
-			ret = append(ret, plugins...)
+// AllOrderedPlugins is the list of all the plugins in the default order.
+var AllOrderedPlugins = OrderedPlugins(DefaultKcpPluginOrder)
+
+// OrderedPlugins returns the list of all the plugins, with the kcp plugins and the admission
+// webhooks in the given order, in place of the admission webhooks in the order of kube.
+func OrderedPlugins(kcpOrder []string) []string {
+	ret := make([]string, 0, len(kubeapiserveroptions.AllOrderedPlugins)+len(kcpOrder))
+	inserted := false
+	for _, plugin := range kubeapiserveroptions.AllOrderedPlugins {
+		if plugin != mutatingwebhook.PluginName && plugin != validatingwebhook.PluginName {
+			ret = append(ret, plugin)
+			continue
+		}
+		if !inserted {
+			ret = append(ret, kcpOrder...)
+			inserted = true
 		}
-		ret = append(ret, plugin)
 	}
 	return ret
 }
 
+// orderDependencies are the pairs of plugins which must be called in this order. Mutating
+// plugins are called before validating plugins, such that validation sees the final objects.
+var orderDependencies = [][2]string{
+	// workspace webhooks see the initializers and finalizers set by kcp
+	{clusterworkspacetypeexists.PluginName, mutatingwebhook.PluginName},
+	{clusterworkspacedeletion.PluginName, mutatingwebhook.PluginName},
+	{mutatingwebhook.PluginName, validatingwebhook.PluginName},
+	// service providers have the last word on their resources
+	{mutatingwebhook.PluginName, apiexportwebhooks.PluginName},
+	{validatingwebhook.PluginName, apiexportwebhooks.PluginName},
+}
+
+// ValidatePluginOrder validates an order of the kcp plugins and the admission webhooks, as
+// used by OrderedPlugins. It must contain every plugin of DefaultKcpPluginOrder once, and
+// respect the order dependencies between them.
+func ValidatePluginOrder(kcpOrder []string) []error {
+	var errs []error
+
+	known := sets.NewString(DefaultKcpPluginOrder...)
+	index := map[string]int{}
+	for i, plugin := range kcpOrder {
+		if !known.Has(plugin) {
+			errs = append(errs, fmt.Errorf("unknown admission plugin %q, must be one of: %s", plugin, strings.Join(DefaultKcpPluginOrder, ", ")))
+			continue
+		}
+		if _, found := index[plugin]; found {
+			errs = append(errs, fmt.Errorf("admission plugin %q is ordered more than once", plugin))
+			continue
+		}
+		index[plugin] = i
+	}
+	for _, plugin := range DefaultKcpPluginOrder {
+		if _, found := index[plugin]; !found {
+			errs = append(errs, fmt.Errorf("admission plugin %q is not ordered", plugin))
+		}
+	}
+
+	for _, dep := range orderDependencies {
+		before, foundBefore := index[dep[0]]
+		after, foundAfter := index[dep[1]]
+		if foundBefore && foundAfter && before > after {
+			errs = append(errs, fmt.Errorf("admission plugin %q must be ordered before %q", dep[0], dep[1]))
+		}
+	}
+
+	return errs
+}
+
 // RegisterAllKcpAdmissionPlugins registers all admission plugins.
 // The order of registration is irrelevant, see AllOrderedPlugins for execution order.
 func RegisterAllKcpAdmissionPlugins(plugins *admission.Plugins) {
 	kubeapiserveroptions.RegisterAllAdmissionPlugins(plugins)
 	clusterworkspace.Register(plugins)
+	clusterworkspacedeletion.Register(plugins)
 	clusterworkspacetype.Register(plugins)
 	clusterworkspacetypeexists.Register(plugins)
+	clusterworkspaceplacement.Register(plugins)
+	protectednamespaces.Register(plugins)
+	sharedclusterroles.Register(plugins)
+	syncerwrites.Register(plugins)
 	apiresourceschema.Register(plugins)
+	apibinding.Register(plugins)
+	apiexportwebhooks.Register(plugins)
+	objectcountquota.Register(plugins)
+	workspaceresourcequota.Register(plugins)
 }
 
 var defaultOnPluginsInKcp = sets.NewString(
@@ -85,9 +177,18 @@ var defaultOnPluginsInKcp = sets.NewString(
 
 	// KCP
 	clusterworkspace.PluginName,
+	clusterworkspacedeletion.PluginName,
 	clusterworkspacetype.PluginName,
 	clusterworkspacetypeexists.PluginName,
+	clusterworkspaceplacement.PluginName,
+	protectednamespaces.PluginName,
+	sharedclusterroles.PluginName,
+	syncerwrites.PluginName,
 	apiresourceschema.PluginName,
+	apibinding.PluginName,
+	apiexportwebhooks.PluginName,
+	objectcountquota.PluginName,
+	workspaceresourcequota.PluginName,
 )
 
 // defaultOnKubePluginsInKube is a copy of kubeapiserveroptions.defaultOnKubePlugins.
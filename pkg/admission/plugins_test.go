@@ -19,8 +19,19 @@ package admission
 import (
 	"testing"
 
+	"github.com/stretchr/testify/require"
+
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/admission/plugin/resourcequota"
+	mutatingwebhook "k8s.io/apiserver/pkg/admission/plugin/webhook/mutating"
+	validatingwebhook "k8s.io/apiserver/pkg/admission/plugin/webhook/validating"
 	kubeapiserveroptions "k8s.io/kubernetes/pkg/kubeapiserver/options"
+
+	"github.com/kcp-dev/kcp/pkg/admission/apiexportwebhooks"
+	"github.com/kcp-dev/kcp/pkg/admission/clusterworkspacedeletion"
+	"github.com/kcp-dev/kcp/pkg/admission/clusterworkspacetypeexists"
+	"github.com/kcp-dev/kcp/pkg/admission/objectcountquota"
+	"github.com/kcp-dev/kcp/pkg/admission/workspaceresourcequota"
 )
 
 func TestPluginDrift(t *testing.T) {
@@ -34,3 +45,124 @@ func TestPluginDrift(t *testing.T) {
 		t.Errorf("Default-on plugins got removed in kube. Remove in defaultOnKubePluginsInKube, and decide whether to remove from defaultOnPluginsInKcp: %v", goneInKube.List())
 	}
 }
+
+// without returns the default kcp plugin order without the given plugins.
+func without(plugins ...string) []string {
+	excluded := sets.NewString(plugins...)
+	var ret []string
+	for _, p := range DefaultKcpPluginOrder {
+		if !excluded.Has(p) {
+			ret = append(ret, p)
+		}
+	}
+	return ret
+}
+
+// swapped returns the default kcp plugin order with the given plugins swapped.
+func swapped(a, b string) []string {
+	ret := append([]string(nil), DefaultKcpPluginOrder...)
+	var i, j int
+	for k, p := range ret {
+		switch p {
+		case a:
+			i = k
+		case b:
+			j = k
+		}
+	}
+	ret[i], ret[j] = ret[j], ret[i]
+	return ret
+}
+
+func indexOf(t *testing.T, plugins []string, plugin string) int {
+	for i, p := range plugins {
+		if p == plugin {
+			return i
+		}
+	}
+	t.Fatalf("plugin %q not found in %v", plugin, plugins)
+	return -1
+}
+
+func TestOrderedPlugins(t *testing.T) {
+	require.Empty(t, ValidatePluginOrder(DefaultKcpPluginOrder))
+	require.Equal(t, AllOrderedPlugins, OrderedPlugins(DefaultKcpPluginOrder))
+	require.Len(t, sets.NewString(AllOrderedPlugins...), len(AllOrderedPlugins), "plugins are ordered once")
+	require.True(t, sets.NewString(AllOrderedPlugins...).HasAll(kubeapiserveroptions.AllOrderedPlugins...), "kube plugins are kept")
+
+	order := append([]string{workspaceresourcequota.PluginName, objectcountquota.PluginName}, without(workspaceresourcequota.PluginName, objectcountquota.PluginName)...)
+	require.Empty(t, ValidatePluginOrder(order))
+	plugins := OrderedPlugins(order)
+	require.Len(t, plugins, len(AllOrderedPlugins))
+	first := indexOf(t, plugins, workspaceresourcequota.PluginName)
+	require.Equal(t, indexOf(t, AllOrderedPlugins, DefaultKcpPluginOrder[0]), first, "kcp plugins are ordered in place of the webhooks")
+	require.Equal(t, order, plugins[first:first+len(order)])
+	require.Less(t, indexOf(t, plugins, apiexportwebhooks.PluginName), indexOf(t, plugins, resourcequota.PluginName))
+}
+
+func TestValidatePluginOrder(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		order    []string
+		wantErrs []string
+	}{
+		{
+			name:  "default order",
+			order: DefaultKcpPluginOrder,
+		},
+		{
+			name:  "reordered validating plugins",
+			order: swapped(objectcountquota.PluginName, workspaceresourcequota.PluginName),
+		},
+		{
+			name:     "unknown plugin",
+			order:    append(append([]string(nil), DefaultKcpPluginOrder...), "NamespaceLifecycle"),
+			wantErrs: []string{`unknown admission plugin "NamespaceLifecycle"`},
+		},
+		{
+			name:     "duplicate plugin",
+			order:    append(append([]string(nil), DefaultKcpPluginOrder...), objectcountquota.PluginName),
+			wantErrs: []string{`admission plugin "tenancy.kcp.dev/ObjectCountQuota" is ordered more than once`},
+		},
+		{
+			name:     "missing plugin",
+			order:    without(objectcountquota.PluginName),
+			wantErrs: []string{`admission plugin "tenancy.kcp.dev/ObjectCountQuota" is not ordered`},
+		},
+		{
+			name:     "validating webhook before mutating webhook",
+			order:    swapped(mutatingwebhook.PluginName, validatingwebhook.PluginName),
+			wantErrs: []string{`admission plugin "MutatingAdmissionWebhook" must be ordered before "ValidatingAdmissionWebhook"`},
+		},
+		{
+			name:     "kcp mutating plugin after mutating webhook",
+			order:    swapped(clusterworkspacetypeexists.PluginName, mutatingwebhook.PluginName),
+			wantErrs: []string{`admission plugin "tenancy.kcp.dev/ClusterWorkspaceTypeExists" must be ordered before "MutatingAdmissionWebhook"`},
+		},
+		{
+			name:     "kcp mutating plugin after all webhooks",
+			order:    append(without(clusterworkspacedeletion.PluginName), clusterworkspacedeletion.PluginName),
+			wantErrs: []string{`admission plugin "tenancy.kcp.dev/ClusterWorkspaceDeletion" must be ordered before "MutatingAdmissionWebhook"`},
+		},
+		{
+			name:  "APIExport webhooks before workspace webhooks",
+			order: swapped(mutatingwebhook.PluginName, apiexportwebhooks.PluginName),
+			wantErrs: []string{
+				`admission plugin "MutatingAdmissionWebhook" must be ordered before "ValidatingAdmissionWebhook"`,
+				`admission plugin "MutatingAdmissionWebhook" must be ordered before "apis.kcp.dev/APIExportWebhooks"`,
+				`admission plugin "ValidatingAdmissionWebhook" must be ordered before "apis.kcp.dev/APIExportWebhooks"`,
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var errs []string
+			for _, err := range ValidatePluginOrder(tt.order) {
+				errs = append(errs, err.Error())
+			}
+			require.Len(t, errs, len(tt.wantErrs), "errors: %v", errs)
+			for i, want := range tt.wantErrs {
+				require.Contains(t, errs[i], want)
+			}
+		})
+	}
+}
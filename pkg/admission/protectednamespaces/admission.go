@@ -0,0 +1,194 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protectednamespaces
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/apiserver/pkg/authentication/user"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/tools/clusters"
+
+	kcpadmissionhelpers "github.com/kcp-dev/kcp/pkg/admission/helpers"
+	kcpinitializers "github.com/kcp-dev/kcp/pkg/admission/initializers"
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+	"github.com/kcp-dev/kcp/pkg/authorization/bootstrap"
+	kcpinformers "github.com/kcp-dev/kcp/pkg/client/informers/externalversions"
+	tenancylisters "github.com/kcp-dev/kcp/pkg/client/listers/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/workspacetype"
+)
+
+// Reserve the protected namespaces of every logical cluster, i.e. kcp-system and the
+// namespaces listed in the ClusterWorkspaceType of its workspace, to system identities:
+//  - only system identities create, update or delete them and the objects they contain.
+//  - they are only deleted with their workspace.
+
+const (
+	PluginName = "tenancy.kcp.dev/ProtectedNamespaces"
+)
+
+// systemGroups are the groups of the privileged users and of the kcp system components.
+// Other system:kcp: groups, like the ones of workspace tokens, are not system identities.
+var systemGroups = sets.NewString(bootstrap.SystemKcpComponentGroups...).Insert(user.SystemPrivilegedGroup)
+
+// DefaultProtectedNamespaces are protected in every logical cluster.
+var DefaultProtectedNamespaces = []string{"kcp-system"}
+
+func Register(plugins *admission.Plugins) {
+	plugins.Register(PluginName,
+		func(_ io.Reader) (admission.Interface, error) {
+			return &protectedNamespaces{
+				Handler: admission.NewHandler(admission.Create, admission.Update, admission.Delete),
+			}, nil
+		})
+}
+
+type protectedNamespaces struct {
+	*admission.Handler
+
+	workspaceLister      tenancylisters.ClusterWorkspaceLister
+	workspacesHaveSynced func() bool
+	typeResolver         *workspacetype.Resolver
+}
+
+// Ensure that the required admission interfaces are implemented.
+var _ = admission.ValidationInterface(&protectedNamespaces{})
+var _ = admission.InitializationValidator(&protectedNamespaces{})
+var _ = kcpinitializers.WantsKcpInformers(&protectedNamespaces{})
+var _ = kcpinitializers.WantsClusterWorkspaceTypeResolver(&protectedNamespaces{})
+
+// Validate rejects the writes of other identities than system ones to protected namespaces
+// and their content, and the deletion of protected namespaces of workspaces not deleted.
+func (o *protectedNamespaces) Validate(ctx context.Context, a admission.Attributes, _ admission.ObjectInterfaces) (err error) {
+	namespace := a.GetNamespace()
+	isNamespace := a.GetResource().GroupResource() == corev1.Resource("namespaces") && a.GetSubresource() == ""
+	if isNamespace {
+		namespace = a.GetName()
+	}
+	if namespace == "" {
+		return nil
+	}
+
+	clusterName, err := genericapirequest.ClusterNameFrom(ctx)
+	if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+
+	if !o.WaitForReady() {
+		return kcpadmissionhelpers.NewNotReadyError(a)
+	}
+
+	workspace, err := o.workspaceOf(clusterName)
+	if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+	protected, err := o.protectedNamespaces(workspace)
+	if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+	if !protected.Has(namespace) {
+		return nil
+	}
+
+	if isNamespace && a.GetOperation() == admission.Delete && (workspace == nil || workspace.DeletionTimestamp.IsZero()) {
+		return admission.NewForbidden(a, fmt.Errorf("namespace %q is protected, it is only deleted with its workspace", namespace))
+	}
+	if !isSystemIdentity(a.GetUserInfo()) {
+		return admission.NewForbidden(a, fmt.Errorf("namespace %q is protected, only system identities can write to it", namespace))
+	}
+	return nil
+}
+
+// workspaceOf returns the ClusterWorkspace of the given logical cluster, or nil if there is
+// none, like for the root and system logical clusters.
+func (o *protectedNamespaces) workspaceOf(clusterName string) (*tenancyv1alpha1.ClusterWorkspace, error) {
+	if clusterName == helper.RootCluster || strings.HasPrefix(clusterName, helper.LocalSystemClusterPrefix) {
+		return nil, nil
+	}
+	parentClusterName, err := helper.ParentClusterName(clusterName)
+	if err != nil {
+		return nil, nil // nolint: nilerr
+	}
+	_, name, err := helper.ParseLogicalClusterName(clusterName)
+	if err != nil {
+		return nil, nil // nolint: nilerr
+	}
+	workspace, err := o.workspaceLister.Get(clusters.ToClusterAwareKey(parentClusterName, name))
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	return workspace, err
+}
+
+// protectedNamespaces returns the default protected namespaces and the ones of the type
+// of the given workspace.
+func (o *protectedNamespaces) protectedNamespaces(workspace *tenancyv1alpha1.ClusterWorkspace) (sets.String, error) {
+	protected := sets.NewString(DefaultProtectedNamespaces...)
+	if workspace == nil {
+		return protected, nil
+	}
+	cwt, err := o.typeResolver.Resolve(workspace.ClusterName, workspacetype.TypeName(workspace))
+	if apierrors.IsNotFound(err) {
+		return protected, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return protected.Insert(cwt.Spec.ProtectedNamespaces...), nil
+}
+
+// isSystemIdentity returns true for the privileged users and the kcp system components.
+func isSystemIdentity(u user.Info) bool {
+	if u == nil {
+		return false
+	}
+	return systemGroups.HasAny(u.GetGroups()...)
+}
+
+func (o *protectedNamespaces) ValidateInitialization() error {
+	if o.workspaceLister == nil {
+		return fmt.Errorf(PluginName + " plugin needs a ClusterWorkspace lister")
+	}
+	if o.typeResolver == nil {
+		return fmt.Errorf(PluginName + " plugin needs a ClusterWorkspaceType resolver")
+	}
+	return nil
+}
+
+func (o *protectedNamespaces) SetKcpInformers(informers kcpinformers.SharedInformerFactory) {
+	workspaces := informers.Tenancy().V1alpha1().ClusterWorkspaces()
+	o.workspaceLister = workspaces.Lister()
+	o.workspacesHaveSynced = workspaces.Informer().HasSynced
+	o.SetReadyFunc(o.HasSynced)
+}
+
+func (o *protectedNamespaces) SetClusterWorkspaceTypeResolver(typeResolver *workspacetype.Resolver) {
+	o.typeResolver = typeResolver
+	o.SetReadyFunc(o.HasSynced)
+}
+
+// HasSynced returns true when the ClusterWorkspace and ClusterWorkspaceType informers have synced.
+func (o *protectedNamespaces) HasSynced() bool {
+	return (o.workspacesHaveSynced == nil || o.workspacesHaveSynced()) && (o.typeResolver == nil || o.typeResolver.HasSynced())
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protectednamespaces
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/tools/cache"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	kcpinformers "github.com/kcp-dev/kcp/pkg/client/informers/externalversions"
+	tenancylisters "github.com/kcp-dev/kcp/pkg/client/listers/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/workspacetype"
+)
+
+var (
+	alice  = &user.DefaultInfo{Name: "alice", Groups: []string{"system:authenticated"}}
+	system = &user.DefaultInfo{Name: "system:kcp:workspace-deletion", Groups: []string{"system:kcp:scheduler"}}
+	admin  = &user.DefaultInfo{Name: "admin", Groups: []string{user.SystemPrivilegedGroup}}
+	viewer = &user.DefaultInfo{Name: "alice", Groups: []string{"system:kcp:authenticated", "system:kcp:workspace:view"}}
+)
+
+func namespaceAttr(name string, op admission.Operation, u user.Info) admission.Attributes {
+	return admission.NewAttributesRecord(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}},
+		nil,
+		corev1.SchemeGroupVersion.WithKind("Namespace"),
+		"",
+		name,
+		corev1.SchemeGroupVersion.WithResource("namespaces"),
+		"",
+		op,
+		nil,
+		false,
+		u,
+	)
+}
+
+func configMapAttr(namespace string, op admission.Operation, u user.Info) admission.Attributes {
+	return admission.NewAttributesRecord(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: namespace}},
+		nil,
+		corev1.SchemeGroupVersion.WithKind("ConfigMap"),
+		namespace,
+		"test",
+		corev1.SchemeGroupVersion.WithResource("configmaps"),
+		"",
+		op,
+		nil,
+		false,
+		u,
+	)
+}
+
+func TestValidate(t *testing.T) {
+	now := metav1.Now()
+	workspaces := []*tenancyv1alpha1.ClusterWorkspace{
+		{
+			ObjectMeta: metav1.ObjectMeta{ClusterName: "root:org", Name: "team"},
+			Spec:       tenancyv1alpha1.ClusterWorkspaceSpec{Type: "Team"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{ClusterName: "root:org", Name: "deleted", DeletionTimestamp: &now},
+			Spec:       tenancyv1alpha1.ClusterWorkspaceSpec{Type: "Team"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{ClusterName: "root:org", Name: "universal"},
+		},
+	}
+	types := []*tenancyv1alpha1.ClusterWorkspaceType{
+		{
+			ObjectMeta: metav1.ObjectMeta{ClusterName: "root:org", Name: "team"},
+			Spec:       tenancyv1alpha1.ClusterWorkspaceTypeSpec{ProtectedNamespaces: []string{"policies"}},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		clusterName string
+		attr        admission.Attributes
+		wantErr     bool
+	}{
+		{
+			name:        "passes writes to other namespaces",
+			clusterName: "org:team",
+			attr:        configMapAttr("default", admission.Create, alice),
+		},
+		{
+			name:        "passes cluster-scoped writes",
+			clusterName: "org:team",
+			attr:        configMapAttr("", admission.Create, alice),
+		},
+		{
+			name:        "rejects writes of users to the default protected namespaces",
+			clusterName: "org:universal",
+			attr:        configMapAttr("kcp-system", admission.Update, alice),
+			wantErr:     true,
+		},
+		{
+			name:        "rejects writes of users to the protected namespaces of the type",
+			clusterName: "org:team",
+			attr:        configMapAttr("policies", admission.Delete, alice),
+			wantErr:     true,
+		},
+		{
+			name:        "passes writes of users to the protected namespaces of other types",
+			clusterName: "org:universal",
+			attr:        configMapAttr("policies", admission.Create, alice),
+		},
+		{
+			name:        "rejects the creation of protected namespaces by users",
+			clusterName: "org:team",
+			attr:        namespaceAttr("policies", admission.Create, alice),
+			wantErr:     true,
+		},
+		{
+			name:        "passes writes of system components",
+			clusterName: "org:team",
+			attr:        configMapAttr("policies", admission.Create, system),
+		},
+		{
+			name:        "rejects writes of workspace token identities",
+			clusterName: "org:team",
+			attr:        configMapAttr("policies", admission.Create, viewer),
+			wantErr:     true,
+		},
+		{
+			name:        "passes writes of privileged users",
+			clusterName: "org:team",
+			attr:        namespaceAttr("policies", admission.Update, admin),
+		},
+		{
+			name:        "rejects the deletion of protected namespaces",
+			clusterName: "org:team",
+			attr:        namespaceAttr("policies", admission.Delete, admin),
+			wantErr:     true,
+		},
+		{
+			name:        "rejects the deletion of protected namespaces of the root workspace",
+			clusterName: "root",
+			attr:        namespaceAttr("kcp-system", admission.Delete, admin),
+			wantErr:     true,
+		},
+		{
+			name:        "passes the deletion of protected namespaces of deleted workspaces by system components",
+			clusterName: "org:deleted",
+			attr:        namespaceAttr("policies", admission.Delete, system),
+		},
+		{
+			name:        "rejects the deletion of protected namespaces of deleted workspaces by users",
+			clusterName: "org:deleted",
+			attr:        namespaceAttr("policies", admission.Delete, alice),
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			for _, ws := range workspaces {
+				if err := indexer.Add(ws); err != nil {
+					t.Fatal(err)
+				}
+			}
+			o := &protectedNamespaces{
+				Handler:         admission.NewHandler(admission.Create, admission.Update, admission.Delete),
+				workspaceLister: tenancylisters.NewClusterWorkspaceLister(indexer),
+				typeResolver:    newTypeResolver(t, types),
+			}
+			ctx := request.WithCluster(context.Background(), request.Cluster{Name: tt.clusterName})
+			if err := o.Validate(ctx, tt.attr, nil); (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func newTypeResolver(t *testing.T, types []*tenancyv1alpha1.ClusterWorkspaceType) *workspacetype.Resolver {
+	typeInformer := kcpinformers.NewSharedInformerFactory(nil, 0).Tenancy().V1alpha1().ClusterWorkspaceTypes()
+	resolver, err := workspacetype.NewResolver(typeInformer, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cwt := range types {
+		if err := typeInformer.Informer().GetIndexer().Add(cwt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resolver
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sharedclusterroles
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apiserver/pkg/admission"
+
+	"github.com/kcp-dev/kcp/pkg/authorization"
+)
+
+// Reject ClusterRoles named with the separator of the references of bindings to the shared
+// ClusterRoles of ancestor workspaces, e.g. "root:acme#viewer", such that references to
+// ClusterRoles are unambiguous.
+
+const (
+	PluginName = "rbac.kcp.dev/SharedClusterRoles"
+)
+
+func Register(plugins *admission.Plugins) {
+	plugins.Register(PluginName,
+		func(_ io.Reader) (admission.Interface, error) {
+			return &sharedClusterRoles{
+				Handler: admission.NewHandler(admission.Create),
+			}, nil
+		})
+}
+
+type sharedClusterRoles struct {
+	*admission.Handler
+}
+
+// Ensure that the required admission interfaces are implemented.
+var _ = admission.ValidationInterface(&sharedClusterRoles{})
+
+// Validate rejects the creation of ClusterRoles with names containing the separator of
+// references to shared ClusterRoles.
+func (o *sharedClusterRoles) Validate(ctx context.Context, a admission.Attributes, _ admission.ObjectInterfaces) error {
+	if a.GetResource().GroupResource() != rbacv1.Resource("clusterroles") || a.GetSubresource() != "" {
+		return nil
+	}
+	if strings.Contains(a.GetName(), authorization.ClusterRoleRefSeparator) {
+		return admission.NewForbidden(a, fmt.Errorf("ClusterRole names must not contain %q, which separates the logical cluster of shared ClusterRoles in role references", authorization.ClusterRoleRefSeparator))
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sharedclusterroles
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+func TestValidate(t *testing.T) {
+	attr := func(resource, name string) admission.Attributes {
+		return admission.NewAttributesRecord(
+			&rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: name}},
+			nil,
+			rbacv1.SchemeGroupVersion.WithKind("ClusterRole"),
+			"",
+			name,
+			rbacv1.SchemeGroupVersion.WithResource(resource),
+			"",
+			admission.Create,
+			nil,
+			false,
+			&user.DefaultInfo{Name: "alice"},
+		)
+	}
+
+	o := &sharedClusterRoles{Handler: admission.NewHandler(admission.Create)}
+	require.NoError(t, o.Validate(context.Background(), attr("clusterroles", "viewer"), nil))
+	require.Error(t, o.Validate(context.Background(), attr("clusterroles", "root:acme#viewer"), nil), "names are not ambiguous with references to shared ClusterRoles")
+	require.NoError(t, o.Validate(context.Background(), attr("roles", "root:acme#viewer"), nil), "only ClusterRoles can be shared")
+}
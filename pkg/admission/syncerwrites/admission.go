@@ -0,0 +1,118 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncerwrites
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/apiserver/pkg/authentication/user"
+
+	"github.com/kcp-dev/kcp/pkg/authentication"
+	"github.com/kcp-dev/kcp/pkg/authorization/bootstrap"
+	"github.com/kcp-dev/kcp/pkg/syncer"
+)
+
+// Restrict the writes of the syncers to the main resource of the synced objects, which
+// their ClusterRole grants them to patch, to the status annotation of their WorkloadCluster.
+// Their status is written through the status subresource.
+
+const (
+	PluginName = "workload.kcp.dev/SyncerWrites"
+)
+
+func Register(plugins *admission.Plugins) {
+	plugins.Register(PluginName,
+		func(_ io.Reader) (admission.Interface, error) {
+			return &syncerWrites{
+				Handler: admission.NewHandler(admission.Update),
+			}, nil
+		})
+}
+
+type syncerWrites struct {
+	*admission.Handler
+}
+
+// Ensure that the required admission interfaces are implemented.
+var _ = admission.ValidationInterface(&syncerWrites{})
+
+// Validate rejects the updates of syncers to the main resource of objects changing anything
+// else than the status annotation of their WorkloadCluster.
+func (o *syncerWrites) Validate(ctx context.Context, a admission.Attributes, _ admission.ObjectInterfaces) error {
+	if a.GetSubresource() != "" || !isSyncer(a.GetUserInfo()) {
+		return nil
+	}
+
+	oldContent, err := content(a.GetOldObject())
+	if err != nil {
+		return admission.NewForbidden(a, err)
+	}
+	newContent, err := content(a.GetObject())
+	if err != nil {
+		return admission.NewForbidden(a, err)
+	}
+
+	var annotations []string
+	for _, workloadCluster := range a.GetUserInfo().GetExtra()[authentication.SyncerWorkloadClusterExtraKey] {
+		annotations = append(annotations, syncer.StatusAnnotationPrefix+workloadCluster)
+	}
+	for _, c := range []map[string]interface{}{oldContent, newContent} {
+		for _, field := range [][]string{{"metadata", "resourceVersion"}, {"metadata", "generation"}, {"metadata", "managedFields"}} {
+			unstructured.RemoveNestedField(c, field...)
+		}
+		for _, annotation := range annotations {
+			unstructured.RemoveNestedField(c, "metadata", "annotations", annotation)
+		}
+		if annotations, found, _ := unstructured.NestedMap(c, "metadata", "annotations"); found && len(annotations) == 0 {
+			unstructured.RemoveNestedField(c, "metadata", "annotations")
+		}
+	}
+	if !reflect.DeepEqual(oldContent, newContent) {
+		return admission.NewForbidden(a, fmt.Errorf("syncers only write the status annotation of their WorkloadCluster to %s", a.GetResource().GroupResource()))
+	}
+	return nil
+}
+
+// isSyncer returns true for the users of the syncers.
+func isSyncer(u user.Info) bool {
+	if u == nil {
+		return false
+	}
+	for _, group := range u.GetGroups() {
+		if group == bootstrap.SystemKcpSyncerGroup {
+			return true
+		}
+	}
+	return false
+}
+
+// content returns a copy of the fields of the given object.
+func content(obj runtime.Object) (map[string]interface{}, error) {
+	if obj == nil {
+		return nil, fmt.Errorf("no object")
+	}
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return u.DeepCopy().UnstructuredContent(), nil
+	}
+	return runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncerwrites
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/apiserver/pkg/authentication/user"
+
+	"github.com/kcp-dev/kcp/pkg/authentication"
+	"github.com/kcp-dev/kcp/pkg/syncer"
+)
+
+var (
+	alice = &user.DefaultInfo{Name: "alice", Groups: []string{"system:authenticated"}}
+	east  = &user.DefaultInfo{
+		Name:   "system:kcp:syncer:east",
+		Groups: []string{"system:kcp:syncer"},
+		Extra:  map[string][]string{authentication.SyncerWorkloadClusterExtraKey: {"east"}},
+	}
+)
+
+func deployment(resourceVersion string, annotations map[string]string, replicas int64) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"name":            "test",
+			"namespace":       "default",
+			"resourceVersion": resourceVersion,
+		},
+		"spec": map[string]interface{}{"replicas": replicas},
+	}}
+	u.SetAnnotations(annotations)
+	return u
+}
+
+func configMap(resourceVersion string, annotations map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default", ResourceVersion: resourceVersion, Annotations: annotations}}
+}
+
+func updateAttr(obj, old runtime.Object, resource, subresource string, u user.Info) admission.Attributes {
+	return admission.NewAttributesRecord(
+		obj,
+		old,
+		obj.GetObjectKind().GroupVersionKind(),
+		"default",
+		"test",
+		metav1.SchemeGroupVersion.WithResource(resource),
+		subresource,
+		admission.Update,
+		nil,
+		false,
+		u,
+	)
+}
+
+func TestValidate(t *testing.T) {
+	eastStatus := map[string]string{syncer.StatusAnnotationPrefix + "east": `{"replicas":1}`}
+	westStatus := map[string]string{syncer.StatusAnnotationPrefix + "west": `{"replicas":1}`}
+
+	tests := []struct {
+		name    string
+		attr    admission.Attributes
+		wantErr bool
+	}{
+		{
+			name: "passes the status annotation of the workload cluster of the syncer",
+			attr: updateAttr(deployment("2", eastStatus, 1), deployment("1", nil, 1), "deployments", "", east),
+		},
+		{
+			name: "passes the removal of the status annotation of the workload cluster of the syncer",
+			attr: updateAttr(configMap("2", nil), configMap("1", eastStatus), "configmaps", "", east),
+		},
+		{
+			name:    "rejects the status annotation of other workload clusters",
+			attr:    updateAttr(deployment("2", westStatus, 1), deployment("1", nil, 1), "deployments", "", east),
+			wantErr: true,
+		},
+		{
+			name:    "rejects spec changes",
+			attr:    updateAttr(deployment("2", eastStatus, 2), deployment("1", nil, 1), "deployments", "", east),
+			wantErr: true,
+		},
+		{
+			name:    "rejects other annotations of typed objects",
+			attr:    updateAttr(configMap("2", map[string]string{"foo": "bar"}), configMap("1", nil), "configmaps", "", east),
+			wantErr: true,
+		},
+		{
+			name: "passes writes to the status subresource",
+			attr: updateAttr(deployment("2", nil, 2), deployment("1", nil, 1), "deployments", "status", east),
+		},
+		{
+			name: "passes writes of other users",
+			attr: updateAttr(deployment("2", westStatus, 2), deployment("1", nil, 1), "deployments", "", alice),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &syncerWrites{
+				Handler: admission.NewHandler(admission.Update),
+			}
+			if err := o.Validate(context.Background(), tt.attr, nil); (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workspaceresourcequota
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/admission"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/tools/cache"
+
+	kcpinformers "github.com/kcp-dev/kcp/pkg/client/informers/externalversions"
+	"github.com/kcp-dev/kcp/pkg/objectcount"
+	"github.com/kcp-dev/kcp/pkg/workspacequota"
+)
+
+// Validate creations against the limits of the WorkspaceResourceQuotas of the parent
+// workspace in effect for the workspace of the logical cluster, using the counts of the
+// shared object counter of the ObjectCountQuota plugin instead of listing the objects of
+// the logical cluster. Both plugins validate, i.e. the lowest limit of a resource applies.
+
+const (
+	PluginName = "tenancy.kcp.dev/WorkspaceResourceQuota"
+)
+
+var namespaces = schema.GroupResource{Resource: "namespaces"}
+
+func Register(plugins *admission.Plugins) {
+	plugins.Register(PluginName,
+		func(_ io.Reader) (admission.Interface, error) {
+			return &workspaceResourceQuota{
+				Handler: admission.NewHandler(admission.Create),
+			}, nil
+		})
+}
+
+type workspaceResourceQuota struct {
+	*admission.Handler
+
+	quotaIndexer cache.Indexer
+	indexerErr   error
+	counter      *objectcount.Counter
+}
+
+// Ensure that the required admission interfaces are implemented.
+var _ = admission.ValidationInterface(&workspaceResourceQuota{})
+var _ = admission.InitializationValidator(&workspaceResourceQuota{})
+
+// Validate rejects the creation of a namespaced object if the number of objects of its
+// resource, or of all the namespaced resources, in the logical cluster reached a limit
+// in effect for its workspace. The error names the quota setting the limit.
+func (o *workspaceResourceQuota) Validate(ctx context.Context, a admission.Attributes, _ admission.ObjectInterfaces) (err error) {
+	if a.GetSubresource() != "" || a.GetNamespace() == "" || a.GetResource().GroupResource() == namespaces {
+		return nil
+	}
+
+	clusterName, err := genericapirequest.ClusterNameFrom(ctx)
+	if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+	workspace, limits, ok, err := workspacequota.ForLogicalCluster(o.quotaIndexer, clusterName)
+	if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+	if !ok || limits.Empty() {
+		return nil
+	}
+
+	resource := a.GetResource().GroupResource()
+	if limit, found := limits.ObjectCount[resource.String()]; found {
+		if count := o.counter.Count(clusterName, resource); count >= limit.Value {
+			return admission.NewForbidden(a, fmt.Errorf("exceeded WorkspaceResourceQuota %s|%s of workspace %q for %s: %d of %d objects", limit.Quota.ClusterName, limit.Quota.Name, workspace, resource, count, limit.Value))
+		}
+	}
+	if limit := limits.TotalObjectCount; limit != nil {
+		if count := o.counter.Total(clusterName); count >= limit.Value {
+			return admission.NewForbidden(a, fmt.Errorf("exceeded WorkspaceResourceQuota %s|%s of workspace %q: %d of %d objects", limit.Quota.ClusterName, limit.Quota.Name, workspace, count, limit.Value))
+		}
+	}
+	return nil
+}
+
+func (o *workspaceResourceQuota) ValidateInitialization() error {
+	if o.indexerErr != nil {
+		return fmt.Errorf("%s plugin failed to index WorkspaceResourceQuotas: %w", PluginName, o.indexerErr)
+	}
+	if o.quotaIndexer == nil {
+		return fmt.Errorf(PluginName + " plugin needs a WorkspaceResourceQuota indexer")
+	}
+	if o.counter == nil {
+		return fmt.Errorf(PluginName + " plugin needs an object counter")
+	}
+	return nil
+}
+
+func (o *workspaceResourceQuota) SetKcpInformers(informers kcpinformers.SharedInformerFactory) {
+	quotas := informers.Tenancy().V1alpha1().WorkspaceResourceQuotas().Informer()
+	if err := workspacequota.AddIndexers(quotas); err != nil {
+		o.indexerErr = err
+		return
+	}
+	o.quotaIndexer = quotas.GetIndexer()
+	o.SetReadyFunc(quotas.HasSynced)
+}
+
+func (o *workspaceResourceQuota) SetObjectCounter(counter *objectcount.Counter) {
+	o.counter = counter
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workspaceresourcequota
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/tools/cache"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/objectcount"
+	"github.com/kcp-dev/kcp/pkg/workspacequota"
+)
+
+var (
+	configMaps  = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	namespacesV = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+	secrets     = schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+)
+
+func createAttr(resource schema.GroupVersionResource, namespace, subresource string) admission.Attributes {
+	return admission.NewAttributesRecord(
+		&metav1.PartialObjectMetadata{},
+		nil,
+		schema.GroupVersionKind{},
+		namespace,
+		"test",
+		resource,
+		subresource,
+		admission.Create,
+		&metav1.CreateOptions{},
+		false,
+		&user.DefaultInfo{},
+	)
+}
+
+func int64Ptr(i int64) *int64 {
+	return &i
+}
+
+func TestValidate(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{workspacequota.ByLogicalClusterIndex: workspacequota.IndexByLogicalCluster})
+	for _, quota := range []*tenancyv1alpha1.WorkspaceResourceQuota{
+		{
+			ObjectMeta: metav1.ObjectMeta{ClusterName: "root:org", Name: "defaults"},
+			Spec: tenancyv1alpha1.WorkspaceResourceQuotaSpec{
+				ObjectCount: map[string]int64{"configmaps": 2},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{ClusterName: "root:org", Name: "team"},
+			Spec: tenancyv1alpha1.WorkspaceResourceQuotaSpec{
+				Workspaces:       []string{"team"},
+				ObjectCount:      map[string]int64{"configmaps": 10},
+				TotalObjectCount: int64Ptr(3),
+			},
+		},
+	} {
+		require.NoError(t, indexer.Add(quota))
+	}
+
+	counter := objectcount.NewCounter()
+	for _, clusterName := range []string{"org:limited", "org:team", "root:org"} {
+		for i := 0; i < 2; i++ {
+			counter.OnAdd(configMaps, &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{ClusterName: clusterName, Namespace: "default", Name: fmt.Sprintf("cm-%d", i)}})
+		}
+	}
+	counter.OnAdd(secrets, &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{ClusterName: "org:team", Namespace: "default", Name: "secret"}})
+
+	tests := []struct {
+		name        string
+		clusterName string
+		a           admission.Attributes
+		wantErr     string
+	}{
+		{
+			name:        "rejects beyond the limit of the quota for all workspaces",
+			clusterName: "org:limited",
+			a:           createAttr(configMaps, "default", ""),
+			wantErr:     "exceeded WorkspaceResourceQuota root:org|defaults",
+		},
+		{
+			name:        "allows below the limit of the quota naming the workspace",
+			clusterName: "org:team",
+			a:           createAttr(configMaps, "default", ""),
+			wantErr:     "exceeded WorkspaceResourceQuota root:org|team of workspace \"team\": 3 of 3 objects",
+		},
+		{
+			name:        "rejects beyond the total limit",
+			clusterName: "org:team",
+			a:           createAttr(secrets, "default", ""),
+			wantErr:     "exceeded WorkspaceResourceQuota root:org|team of workspace \"team\": 3 of 3 objects",
+		},
+		{
+			name:        "allows resources without limit",
+			clusterName: "org:limited",
+			a:           createAttr(secrets, "default", ""),
+		},
+		{
+			name:        "allows subresources",
+			clusterName: "org:limited",
+			a:           createAttr(configMaps, "default", "status"),
+		},
+		{
+			name:        "allows namespaces",
+			clusterName: "org:team",
+			a:           createAttr(namespacesV, "test", ""),
+		},
+		{
+			name:        "allows workspaces of organizations without quota",
+			clusterName: "other:team",
+			a:           createAttr(configMaps, "default", ""),
+		},
+		{
+			name:        "allows organizations",
+			clusterName: "root:org",
+			a:           createAttr(configMaps, "default", ""),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &workspaceResourceQuota{
+				Handler:      admission.NewHandler(admission.Create),
+				quotaIndexer: indexer,
+				counter:      counter,
+			}
+			ctx := request.WithCluster(context.Background(), request.Cluster{Name: tt.clusterName})
+			err := o.Validate(ctx, tt.a, nil)
+			if tt.wantErr != "" {
+				require.True(t, apierrors.IsForbidden(err), "expected forbidden error, got %v", err)
+				require.Contains(t, err.Error(), tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregator
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clusters"
+	apiregistrationv1 "k8s.io/kube-aggregator/pkg/apis/apiregistration/v1"
+)
+
+// APIServicesGVR is the resource of the APIServices, bound in workspaces from the
+// apiregistration.k8s.io APIExport of the root workspace.
+var APIServicesGVR = apiregistrationv1.SchemeGroupVersion.WithResource("apiservices")
+
+// ByLogicalClusterIndex is the name of the index of APIServices by the logical cluster
+// they are created in.
+const ByLogicalClusterIndex = "aggregator-byLogicalCluster"
+
+// IndexByLogicalCluster indexes APIServices by the logical cluster they are created in.
+func IndexByLogicalCluster(obj interface{}) ([]string, error) {
+	apiService, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("obj is supposed to be an unstructured APIService, but is %T", obj)
+	}
+	return []string{apiService.GetClusterName()}, nil
+}
+
+// AddIndexers adds the ByLogicalClusterIndex to the given APIService informer, unless
+// added already.
+func AddIndexers(informer cache.SharedIndexInformer) error {
+	if _, found := informer.GetIndexer().GetIndexers()[ByLogicalClusterIndex]; found {
+		return nil
+	}
+	return informer.AddIndexers(cache.Indexers{
+		ByLogicalClusterIndex: IndexByLogicalCluster,
+	})
+}
+
+// FromUnstructured converts an APIService of a dynamic informer into its typed form.
+func FromUnstructured(obj interface{}) (*apiregistrationv1.APIService, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("obj is supposed to be an unstructured APIService, but is %T", obj)
+	}
+	apiService := &apiregistrationv1.APIService{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), apiService); err != nil {
+		return nil, fmt.Errorf("invalid APIService %s|%s: %w", u.GetClusterName(), u.GetName(), err)
+	}
+	return apiService, nil
+}
+
+// ToUnstructured converts an APIService into its form for the dynamic client.
+func ToUnstructured(apiService *apiregistrationv1.APIService) (*unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(apiService)
+	if err != nil {
+		return nil, err
+	}
+	u := &unstructured.Unstructured{Object: content}
+	u.SetGroupVersionKind(apiregistrationv1.SchemeGroupVersion.WithKind("APIService"))
+	return u, nil
+}
+
+// Lister lists the APIServices of logical clusters from an indexed APIService informer.
+type Lister struct {
+	indexer cache.Indexer
+}
+
+// NewLister returns a Lister of the APIServices of the given informer, adding the
+// ByLogicalClusterIndex to it.
+func NewLister(informer cache.SharedIndexInformer) (*Lister, error) {
+	if err := AddIndexers(informer); err != nil {
+		return nil, err
+	}
+	return &Lister{indexer: informer.GetIndexer()}, nil
+}
+
+// List returns the APIServices of the given logical cluster. Invalid APIServices are
+// skipped.
+func (l *Lister) List(clusterName string) ([]*apiregistrationv1.APIService, error) {
+	objs, err := l.indexer.ByIndex(ByLogicalClusterIndex, clusterName)
+	if err != nil {
+		return nil, err
+	}
+	apiServices := make([]*apiregistrationv1.APIService, 0, len(objs))
+	for _, obj := range objs {
+		apiService, err := FromUnstructured(obj)
+		if err != nil {
+			continue
+		}
+		apiServices = append(apiServices, apiService)
+	}
+	return apiServices, nil
+}
+
+// Get returns the APIService of the given name in the given logical cluster, nil if
+// it does not exist.
+func (l *Lister) Get(clusterName, name string) (*apiregistrationv1.APIService, error) {
+	obj, exists, err := l.indexer.GetByKey(clusters.ToClusterAwareKey(clusterName, name))
+	if err != nil || !exists {
+		return nil, err
+	}
+	return FromUnstructured(obj)
+}
@@ -0,0 +1,204 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregator
+
+import (
+	"fmt"
+	"net/http"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apiserver/pkg/endpoints/handlers/negotiation"
+	"k8s.io/apiserver/pkg/endpoints/handlers/responsewriters"
+	apiregistrationv1 "k8s.io/kube-aggregator/pkg/apis/apiregistration/v1"
+	apiregistrationv1helper "k8s.io/kube-aggregator/pkg/apis/apiregistration/v1/helper"
+	controlplaneaggregator "k8s.io/kubernetes/pkg/genericcontrolplane/aggregator"
+)
+
+// aggregatedGroups returns the groups of the available APIServices proxied to an extension
+// apiserver, by decreasing group priority, with their versions by decreasing version
+// priority. APIServices which are not available are left out of discovery, such that
+// clients do not fail to discover the other groups of the workspace.
+func aggregatedGroups(apiServices []*apiregistrationv1.APIService) []metav1.APIGroup {
+	var available []*apiregistrationv1.APIService
+	for _, apiService := range apiServices {
+		if apiService.Spec.Service != nil && apiregistrationv1helper.IsAPIServiceConditionTrue(apiService, apiregistrationv1.Available) {
+			available = append(available, apiService)
+		}
+	}
+
+	var groups []metav1.APIGroup
+	for _, byVersion := range apiregistrationv1helper.SortedByGroupAndVersion(available) {
+		group := metav1.APIGroup{Name: byVersion[0].Spec.Group}
+		for _, apiService := range byVersion {
+			group.Versions = append(group.Versions, metav1.GroupVersionForDiscovery{
+				GroupVersion: schema.GroupVersion{Group: apiService.Spec.Group, Version: apiService.Spec.Version}.String(),
+				Version:      apiService.Spec.Version,
+			})
+		}
+		group.PreferredVersion = group.Versions[0]
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// mergeGroup adds the versions of the aggregated group missing from the given group.
+func mergeGroup(group *metav1.APIGroup, aggregated metav1.APIGroup) {
+	existing := map[string]bool{}
+	for _, v := range group.Versions {
+		existing[v.Version] = true
+	}
+	for _, v := range aggregated.Versions {
+		if !existing[v.Version] {
+			group.Versions = append(group.Versions, v)
+		}
+	}
+	if group.PreferredVersion.Version == "" {
+		group.PreferredVersion = aggregated.PreferredVersion
+	}
+}
+
+// serveGroupList serves /apis, merging the aggregated groups of the given APIServices into
+// the groups served by apiHandler.
+func serveGroupList(w http.ResponseWriter, req *http.Request, apiHandler http.Handler, apiServices []*apiregistrationv1.APIService) {
+	list := &metav1.APIGroupList{}
+	if ok := delegateDiscovery(w, req, apiHandler, list); !ok {
+		return
+	}
+
+	for _, aggregated := range aggregatedGroups(apiServices) {
+		merged := false
+		for i := range list.Groups {
+			if list.Groups[i].Name == aggregated.Name {
+				mergeGroup(&list.Groups[i], aggregated)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			list.Groups = append(list.Groups, aggregated)
+		}
+	}
+	responsewriters.WriteObjectNegotiated(controlplaneaggregator.DiscoveryCodecs, negotiation.DefaultEndpointRestrictions, schema.GroupVersion{}, w, req, http.StatusOK, list)
+}
+
+// serveGroup serves /apis/<group>, merging the versions of the group of the given
+// APIServices into the ones served by apiHandler, if any.
+func serveGroup(w http.ResponseWriter, req *http.Request, apiHandler http.Handler, groupName string, apiServices []*apiregistrationv1.APIService) {
+	var aggregated *metav1.APIGroup
+	for _, group := range aggregatedGroups(apiServices) {
+		if group.Name == groupName {
+			group := group
+			aggregated = &group
+			break
+		}
+	}
+	if aggregated == nil {
+		apiHandler.ServeHTTP(w, req)
+		return
+	}
+
+	group := &metav1.APIGroup{}
+	writer := newInMemoryResponseWriter()
+	apiHandler.ServeHTTP(writer, discoveryRequest(req))
+	switch writer.respCode {
+	case http.StatusOK:
+		if err := decodeDiscovery(writer.data, group); err != nil {
+			responsewriters.ErrorNegotiated(apierrors.NewInternalError(err), errorCodecs, schema.GroupVersion{}, w, req)
+			return
+		}
+		mergeGroup(group, *aggregated)
+	case http.StatusNotFound:
+		group = aggregated
+	default:
+		writer.writeTo(w)
+		return
+	}
+	responsewriters.WriteObjectNegotiated(controlplaneaggregator.DiscoveryCodecs, negotiation.DefaultEndpointRestrictions, schema.GroupVersion{}, w, req, http.StatusOK, group)
+}
+
+// delegateDiscovery decodes into the given object the discovery served by apiHandler. It
+// writes the response of apiHandler and returns false if it fails.
+func delegateDiscovery(w http.ResponseWriter, req *http.Request, apiHandler http.Handler, into runtime.Object) bool {
+	writer := newInMemoryResponseWriter()
+	apiHandler.ServeHTTP(writer, discoveryRequest(req))
+	if writer.respCode != http.StatusOK {
+		writer.writeTo(w)
+		return false
+	}
+	if err := decodeDiscovery(writer.data, into); err != nil {
+		responsewriters.ErrorNegotiated(apierrors.NewInternalError(err), errorCodecs, schema.GroupVersion{}, w, req)
+		return false
+	}
+	return true
+}
+
+// discoveryRequest clones the given discovery request, asking for JSON to decode it.
+func discoveryRequest(req *http.Request) *http.Request {
+	cr := utilnet.CloneRequest(req)
+	cr.Header.Set("Accept", "application/json")
+	return cr
+}
+
+// decodeDiscovery decodes the given JSON discovery into the given object.
+func decodeDiscovery(data []byte, into runtime.Object) error {
+	if _, _, err := controlplaneaggregator.DiscoveryCodecs.UniversalDeserializer().Decode(data, nil, into); err != nil {
+		return fmt.Errorf("failed to decode discovery: %w", err)
+	}
+	return nil
+}
+
+// inMemoryResponseWriter is a http.ResponseWriter keeping the response in memory.
+type inMemoryResponseWriter struct {
+	header   http.Header
+	respCode int
+	data     []byte
+}
+
+func newInMemoryResponseWriter() *inMemoryResponseWriter {
+	return &inMemoryResponseWriter{header: http.Header{}}
+}
+
+func (r *inMemoryResponseWriter) Header() http.Header {
+	return r.header
+}
+
+func (r *inMemoryResponseWriter) WriteHeader(code int) {
+	if r.respCode == 0 {
+		r.respCode = code
+	}
+}
+
+func (r *inMemoryResponseWriter) Write(in []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	r.data = append(r.data, in...)
+	return len(in), nil
+}
+
+// writeTo writes the kept response to the given writer.
+func (r *inMemoryResponseWriter) writeTo(w http.ResponseWriter) {
+	for key, values := range r.header {
+		w.Header()[key] = values
+	}
+	if r.respCode != 0 {
+		w.WriteHeader(r.respCode)
+	}
+	w.Write(r.data) //nolint:errcheck
+}
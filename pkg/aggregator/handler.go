@@ -0,0 +1,185 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregator
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/handlers/responsewriters"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/klog/v2"
+	apiregistrationv1 "k8s.io/kube-aggregator/pkg/apis/apiregistration/v1"
+	apiregistrationv1helper "k8s.io/kube-aggregator/pkg/apis/apiregistration/v1/helper"
+)
+
+var (
+	errorScheme = runtime.NewScheme()
+	errorCodecs = serializer.NewCodecFactory(errorScheme)
+)
+
+func init() {
+	errorScheme.AddUnversionedTypes(metav1.Unversioned,
+		&metav1.Status{},
+	)
+}
+
+// The headers the user of proxied requests is passed in, to be authenticated by the
+// extension apiserver with the request header authentication of the proxy client
+// certificate.
+const (
+	remoteUserHeader        = "X-Remote-User"
+	remoteGroupHeader       = "X-Remote-Group"
+	remoteExtraHeaderPrefix = "X-Remote-Extra-"
+)
+
+// Handler serves the aggregated APIs of the APIServices of workspaces.
+type Handler struct {
+	apiServices *Lister
+	transports  *Transports
+}
+
+// NewHandler returns a Handler proxying the requests to the aggregated APIs of the given
+// APIServices with the given transports.
+func NewHandler(apiServices *Lister, transports *Transports) *Handler {
+	return &Handler{
+		apiServices: apiServices,
+		transports:  transports,
+	}
+}
+
+// WithAggregatedAPIs proxies the requests to the group versions of the APIServices of the
+// logical cluster of the request to their extension apiserver, and merges the groups of
+// the available ones into the discovery of the logical cluster. Any other request is
+// passed to apiHandler.
+func (h *Handler) WithAggregatedAPIs(apiHandler http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		cluster := request.ClusterFrom(req.Context())
+		if cluster == nil || cluster.Wildcard {
+			apiHandler.ServeHTTP(w, req)
+			return
+		}
+
+		var segments []string
+		switch path := strings.TrimSuffix(req.URL.Path, "/"); {
+		case path == "/apis":
+		case strings.HasPrefix(path, "/apis/"):
+			segments = strings.Split(strings.TrimPrefix(path, "/apis/"), "/")
+		default:
+			apiHandler.ServeHTTP(w, req)
+			return
+		}
+
+		apiServices, err := h.apiServices.List(cluster.Name)
+		if err != nil {
+			responsewriters.ErrorNegotiated(apierrors.NewInternalError(err), errorCodecs, schema.GroupVersion{}, w, req)
+			return
+		}
+		if len(apiServices) == 0 {
+			apiHandler.ServeHTTP(w, req)
+			return
+		}
+
+		switch len(segments) {
+		case 0:
+			serveGroupList(w, req, apiHandler, apiServices)
+		case 1:
+			serveGroup(w, req, apiHandler, segments[0], apiServices)
+		default:
+			gv := schema.GroupVersion{Group: segments[0], Version: segments[1]}
+			for _, apiService := range apiServices {
+				if apiService.Spec.Group == gv.Group && apiService.Spec.Version == gv.Version && apiService.Spec.Service != nil {
+					h.proxy(w, req, gv, apiService)
+					return
+				}
+			}
+			apiHandler.ServeHTTP(w, req)
+		}
+	}
+}
+
+// proxy passes the request to the extension apiserver of the given APIService, as the
+// user of the request.
+func (h *Handler) proxy(w http.ResponseWriter, req *http.Request, gv schema.GroupVersion, apiService *apiregistrationv1.APIService) {
+	if !apiregistrationv1helper.IsAPIServiceConditionTrue(apiService, apiregistrationv1.Available) {
+		responsewriters.ErrorNegotiated(
+			apierrors.NewServiceUnavailable(fmt.Sprintf("the server for %s is currently unable to handle the request", gv)),
+			errorCodecs, gv, w, req,
+		)
+		return
+	}
+	userInfo, ok := request.UserFrom(req.Context())
+	if !ok {
+		responsewriters.ErrorNegotiated(apierrors.NewInternalError(fmt.Errorf("missing userInfo")), errorCodecs, gv, w, req)
+		return
+	}
+	transport, err := h.transports.TransportFor(apiService)
+	if err != nil {
+		responsewriters.ErrorNegotiated(apierrors.NewServiceUnavailable(err.Error()), errorCodecs, gv, w, req)
+		return
+	}
+
+	host := apiService.Spec.Service.Name + "." + apiService.Spec.Service.Namespace + ".svc"
+	proxy := &httputil.ReverseProxy{
+		Director: func(r *http.Request) {
+			rewriteProxiedRequest(r, host, userInfo)
+		},
+		Transport:     transport,
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			klog.V(4).Infof("failed to proxy request to APIService %s|%s: %v", apiService.ClusterName, apiService.Name, err)
+			responsewriters.ErrorNegotiated(
+				apierrors.NewServiceUnavailable(fmt.Sprintf("failed to reach the server for %s: %v", gv, err)),
+				errorCodecs, gv, w, req,
+			)
+		},
+	}
+	proxy.ServeHTTP(w, req)
+}
+
+// rewriteProxiedRequest targets the request at the given host, and replaces the
+// credentials of the user by the request headers naming the user.
+func rewriteProxiedRequest(req *http.Request, host string, userInfo user.Info) {
+	req.URL.Scheme = "https"
+	req.URL.Host = host
+	req.Host = host
+
+	req.Header.Del("Authorization")
+	for header := range req.Header {
+		if strings.HasPrefix(header, "Impersonate-") || strings.HasPrefix(header, "X-Remote-") {
+			req.Header.Del(header)
+		}
+	}
+	req.Header.Set(remoteUserHeader, userInfo.GetName())
+	for _, group := range userInfo.GetGroups() {
+		req.Header.Add(remoteGroupHeader, group)
+	}
+	for key, values := range userInfo.GetExtra() {
+		for _, value := range values {
+			req.Header.Add(remoteExtraHeaderPrefix+url.PathEscape(key), value)
+		}
+	}
+}
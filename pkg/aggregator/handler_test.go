@@ -0,0 +1,151 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregator
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/tools/cache"
+	apiregistrationv1 "k8s.io/kube-aggregator/pkg/apis/apiregistration/v1"
+)
+
+type staticResolver struct {
+	u *url.URL
+}
+
+func (r staticResolver) ResolveEndpoint(clusterName, namespace, name string, port int32) (*url.URL, error) {
+	return r.u, nil
+}
+
+func newAPIService(t *testing.T, clusterName, version string, available apiregistrationv1.ConditionStatus) *unstructured.Unstructured {
+	u, err := ToUnstructured(&apiregistrationv1.APIService{
+		ObjectMeta: metav1.ObjectMeta{ClusterName: clusterName, Name: version + ".metrics.k8s.io", ResourceVersion: "1"},
+		Spec: apiregistrationv1.APIServiceSpec{
+			Group:                 "metrics.k8s.io",
+			Version:               version,
+			Service:               &apiregistrationv1.ServiceReference{Namespace: "kube-system", Name: "metrics-server"},
+			InsecureSkipTLSVerify: true,
+			GroupPriorityMinimum:  100,
+			VersionPriority:       100,
+		},
+		Status: apiregistrationv1.APIServiceStatus{
+			Conditions: []apiregistrationv1.APIServiceCondition{{Type: apiregistrationv1.Available, Status: available}},
+		},
+	})
+	require.NoError(t, err)
+	return u
+}
+
+func TestWithAggregatedAPIs(t *testing.T) {
+	var proxied *http.Request
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		proxied = req
+		w.Write([]byte("remote")) //nolint:errcheck
+	}))
+	defer backend.Close()
+	backendURL, err := url.Parse(backend.URL)
+	require.NoError(t, err)
+
+	informer := cache.NewSharedIndexInformer(&cache.ListWatch{}, &unstructured.Unstructured{}, 0, cache.Indexers{})
+	lister, err := NewLister(informer)
+	require.NoError(t, err)
+	require.NoError(t, informer.GetIndexer().Add(newAPIService(t, "root:org:ws", "v1beta1", apiregistrationv1.ConditionTrue)))
+	require.NoError(t, informer.GetIndexer().Add(newAPIService(t, "root:org:ws", "v1alpha1", apiregistrationv1.ConditionFalse)))
+	transports, err := NewTransports(staticResolver{u: backendURL}, "", "")
+	require.NoError(t, err)
+
+	local := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/apis":
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(&metav1.APIGroupList{ //nolint:errcheck
+				TypeMeta: metav1.TypeMeta{Kind: "APIGroupList", APIVersion: "v1"},
+				Groups: []metav1.APIGroup{{
+					Name:             "apps",
+					Versions:         []metav1.GroupVersionForDiscovery{{GroupVersion: "apps/v1", Version: "v1"}},
+					PreferredVersion: metav1.GroupVersionForDiscovery{GroupVersion: "apps/v1", Version: "v1"},
+				}},
+			})
+		case "/apis/metrics.k8s.io":
+			http.NotFound(w, req)
+		default:
+			w.Write([]byte("local")) //nolint:errcheck
+		}
+	})
+	handler := NewHandler(lister, transports).WithAggregatedAPIs(local)
+
+	serve := func(clusterName, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		req.Header.Set("Accept", "application/json")
+		ctx := request.WithCluster(req.Context(), request.Cluster{Name: clusterName})
+		ctx = request.WithUser(ctx, &user.DefaultInfo{Name: "alice", Groups: []string{"devs"}, Extra: map[string][]string{"scopes": {"a"}}})
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req.WithContext(ctx))
+		return w
+	}
+
+	t.Run("proxies available APIServices as the user", func(t *testing.T) {
+		w := serve("root:org:ws", "/apis/metrics.k8s.io/v1beta1/nodes")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, "remote", w.Body.String())
+		require.Equal(t, "/apis/metrics.k8s.io/v1beta1/nodes", proxied.URL.Path)
+		require.Equal(t, "alice", proxied.Header.Get("X-Remote-User"))
+		require.Equal(t, []string{"devs"}, proxied.Header.Values("X-Remote-Group"))
+		require.Equal(t, "a", proxied.Header.Get("X-Remote-Extra-Scopes"))
+		require.Empty(t, proxied.Header.Get("Authorization"))
+	})
+
+	t.Run("fails for unavailable APIServices", func(t *testing.T) {
+		w := serve("root:org:ws", "/apis/metrics.k8s.io/v1alpha1/nodes")
+		require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	})
+
+	t.Run("serves other logical clusters locally", func(t *testing.T) {
+		w := serve("root:org:other", "/apis/metrics.k8s.io/v1beta1/nodes")
+		require.Equal(t, "local", w.Body.String())
+	})
+
+	t.Run("merges the available groups into discovery", func(t *testing.T) {
+		w := serve("root:org:ws", "/apis")
+		require.Equal(t, http.StatusOK, w.Code)
+		list := &metav1.APIGroupList{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), list))
+		require.Len(t, list.Groups, 2)
+		require.Equal(t, "apps", list.Groups[0].Name)
+		require.Equal(t, "metrics.k8s.io", list.Groups[1].Name)
+		require.Equal(t, []metav1.GroupVersionForDiscovery{{GroupVersion: "metrics.k8s.io/v1beta1", Version: "v1beta1"}}, list.Groups[1].Versions)
+	})
+
+	t.Run("serves the discovery of aggregated groups", func(t *testing.T) {
+		w := serve("root:org:ws", "/apis/metrics.k8s.io")
+		require.Equal(t, http.StatusOK, w.Code)
+		group := &metav1.APIGroup{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), group))
+		require.Equal(t, "metrics.k8s.io/v1beta1", group.PreferredVersion.GroupVersion)
+	})
+}
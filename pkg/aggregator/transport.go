@@ -0,0 +1,156 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package aggregator serves the aggregated APIs registered by APIServices in workspaces,
+// proxying their requests to the extension apiserver behind the Service of the APIService,
+// resolved in the logical cluster of the workspace.
+package aggregator
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/tools/clusters"
+	apiregistrationv1 "k8s.io/kube-aggregator/pkg/apis/apiregistration/v1"
+
+	"github.com/kcp-dev/kcp/pkg/server/serviceresolver"
+)
+
+// Transports builds the transports to the extension apiservers of APIServices, caching
+// them until the APIService changes.
+type Transports struct {
+	resolver   serviceresolver.Resolver
+	clientCert *tls.Certificate
+
+	lock       sync.Mutex
+	transports map[string]*cachedTransport
+}
+
+type cachedTransport struct {
+	resourceVersion string
+	transport       *http.Transport
+}
+
+// NewTransports returns Transports dialing the Services of APIServices at the endpoint
+// resolved by the given Resolver. If the given client certificate and key files are set,
+// the extension apiservers are called with the client certificate, e.g. the one given by
+// --proxy-client-cert-file.
+func NewTransports(resolver serviceresolver.Resolver, clientCertFile, clientKeyFile string) (*Transports, error) {
+	t := &Transports{
+		resolver:   resolver,
+		transports: map[string]*cachedTransport{},
+	}
+	if clientCertFile != "" || clientKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(clientCertFile, clientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the proxy client certificate: %w", err)
+		}
+		t.clientCert = &cert
+	}
+	return t, nil
+}
+
+// TransportFor returns the transport to the extension apiserver of the given APIService.
+// It fails for local APIServices.
+func (t *Transports) TransportFor(apiService *apiregistrationv1.APIService) (http.RoundTripper, error) {
+	if apiService.Spec.Service == nil {
+		return nil, fmt.Errorf("APIService %s|%s is served locally", apiService.ClusterName, apiService.Name)
+	}
+
+	key := clusters.ToClusterAwareKey(apiService.ClusterName, apiService.Name)
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if cached, ok := t.transports[key]; ok {
+		if cached.resourceVersion == apiService.ResourceVersion {
+			return cached.transport, nil
+		}
+		cached.transport.CloseIdleConnections()
+	}
+	transport, err := t.newTransport(apiService)
+	if err != nil {
+		return nil, err
+	}
+	t.transports[key] = &cachedTransport{
+		resourceVersion: apiService.ResourceVersion,
+		transport:       transport,
+	}
+	return transport, nil
+}
+
+// Forget drops the transport of the APIService with the given cluster-aware key.
+func (t *Transports) Forget(key string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if cached, ok := t.transports[key]; ok {
+		cached.transport.CloseIdleConnections()
+		delete(t.transports, key)
+	}
+}
+
+func (t *Transports) newTransport(apiService *apiregistrationv1.APIService) (*http.Transport, error) {
+	service := apiService.Spec.Service
+	port := int32(443)
+	if service.Port != nil {
+		port = *service.Port
+	}
+
+	tlsConfig := &tls.Config{
+		// TLS is verified against the name of the Service, like in Kubernetes.
+		ServerName:         service.Name + "." + service.Namespace + ".svc",
+		InsecureSkipVerify: apiService.Spec.InsecureSkipTLSVerify, // nolint:gosec
+		// http/1.1 for the streams, e.g. of the pods of metrics-server-style APIs.
+		NextProtos: []string{"http/1.1"},
+	}
+	if len(apiService.Spec.CABundle) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(apiService.Spec.CABundle) {
+			return nil, fmt.Errorf("invalid caBundle of APIService %s|%s", apiService.ClusterName, apiService.Name)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if t.clientCert != nil {
+		tlsConfig.Certificates = []tls.Certificate{*t.clientCert}
+	}
+
+	clusterName := apiService.ClusterName
+	var dialer net.Dialer
+	return &http.Transport{
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: 10 * time.Second,
+		IdleConnTimeout:     90 * time.Second,
+		MaxIdleConnsPerHost: 25,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			u, err := t.resolver.ResolveEndpoint(clusterName, service.Namespace, service.Name, port)
+			if err != nil {
+				return nil, err
+			}
+			hostPort := u.Host
+			if u.Port() == "" {
+				hostPort = net.JoinHostPort(u.Hostname(), strconv.Itoa(443))
+			}
+			return dialer.DialContext(ctx, network, hostPort)
+		},
+	}, nil
+}
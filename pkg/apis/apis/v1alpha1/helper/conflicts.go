@@ -0,0 +1,113 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helper
+
+import (
+	"fmt"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+)
+
+// NamingConflict is a resource of an APIBinding which is also defined in its workspace,
+// by a CustomResourceDefinition or by another APIBinding.
+type NamingConflict struct {
+	schema.GroupResource
+
+	// CRD is the name of the conflicting CustomResourceDefinition, if any.
+	CRD string
+	// APIBinding is the name of the conflicting APIBinding, if any.
+	APIBinding string
+}
+
+func (c NamingConflict) String() string {
+	if c.APIBinding != "" {
+		return fmt.Sprintf("%s is bound by APIBinding %q", c.GroupResource, c.APIBinding)
+	}
+	return fmt.Sprintf("%s is defined by CustomResourceDefinition %q", c.GroupResource, c.CRD)
+}
+
+// ConflictPolicy returns the conflict policy of the APIBinding, defaulting to Reject.
+func ConflictPolicy(binding *apisv1alpha1.APIBinding) apisv1alpha1.APIBindingConflictPolicyType {
+	if binding.Spec.ConflictPolicy == "" {
+		return apisv1alpha1.APIBindingConflictPolicyReject
+	}
+	return binding.Spec.ConflictPolicy
+}
+
+// BoundGroupResources returns the resources bound by the APIBinding.
+func BoundGroupResources(binding *apisv1alpha1.APIBinding) []schema.GroupResource {
+	grs := make([]schema.GroupResource, 0, len(binding.Status.BoundResources))
+	for _, bound := range binding.Status.BoundResources {
+		grs = append(grs, schema.GroupResource{Group: bound.Group, Resource: bound.Resource})
+	}
+	return grs
+}
+
+// BindsBefore returns whether APIBinding a takes precedence over APIBinding b for the
+// resources bound by both, i.e. whether a was created first. APIBindings which are not
+// created yet come last.
+func BindsBefore(a, b *apisv1alpha1.APIBinding) bool {
+	if a.CreationTimestamp.IsZero() != b.CreationTimestamp.IsZero() {
+		return b.CreationTimestamp.IsZero()
+	}
+	if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+		return a.CreationTimestamp.Before(&b.CreationTimestamp)
+	}
+	return a.Name < b.Name
+}
+
+// NamingConflicts returns the conflicts of the given resources, bound by the APIBinding,
+// with the CustomResourceDefinitions and the other APIBindings of its workspace. Only
+// APIBindings binding before the given one are conflicting.
+func NamingConflicts(binding *apisv1alpha1.APIBinding, resources []schema.GroupResource, crds []*apiextensionsv1.CustomResourceDefinition, bindings []*apisv1alpha1.APIBinding) []NamingConflict {
+	var conflicts []NamingConflict
+	for _, gr := range resources {
+		for _, crd := range crds {
+			if crd.Spec.Group == gr.Group && crd.Spec.Names.Plural == gr.Resource {
+				conflicts = append(conflicts, NamingConflict{GroupResource: gr, CRD: crd.Name})
+			}
+		}
+		for _, other := range bindings {
+			if other.Name == binding.Name || !BindsBefore(other, binding) {
+				continue
+			}
+			for _, bound := range BoundGroupResources(other) {
+				if bound == gr {
+					conflicts = append(conflicts, NamingConflict{GroupResource: gr, APIBinding: other.Name})
+					break
+				}
+			}
+		}
+	}
+	return conflicts
+}
+
+// RejectedNamingConflicts returns the conflicts which are not resolved by the conflict policy
+// of the APIBinding: conflicts with other APIBindings, and conflicts with CustomResourceDefinitions
+// if the conflict policy is Reject.
+func RejectedNamingConflicts(binding *apisv1alpha1.APIBinding, conflicts []NamingConflict) []NamingConflict {
+	var rejected []NamingConflict
+	for _, c := range conflicts {
+		if c.APIBinding != "" || ConflictPolicy(binding) == apisv1alpha1.APIBindingConflictPolicyReject {
+			rejected = append(rejected, c)
+		}
+	}
+	return rejected
+}
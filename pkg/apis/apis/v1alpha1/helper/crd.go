@@ -0,0 +1,96 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helper
+
+import (
+	"encoding/json"
+	"fmt"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+)
+
+// APIResourceSchemaName returns the name of the APIResourceSchema of the given resource
+// with the given prefix, i.e. <prefix>.<plural>.<group>, with "core" for the core group.
+func APIResourceSchemaName(prefix, group, plural string) string {
+	if group == "" {
+		group = "core"
+	}
+	return fmt.Sprintf("%s.%s.%s", prefix, plural, group)
+}
+
+// CRDToAPIResourceSchema returns an APIResourceSchema equivalent to the given CRD, named
+// with the given prefix. Fields of the CRD without counterpart are folded into the
+// schemas of its versions:
+//   - spec.preserveUnknownFields becomes x-kubernetes-preserve-unknown-fields on the
+//     root of every schema, as unknown fields would be pruned otherwise.
+//   - versions without schema get an object schema preserving all fields.
+//
+// Conversion is carried over for the webhook strategy only, the default being None.
+func CRDToAPIResourceSchema(crd *apiextensionsv1.CustomResourceDefinition, prefix string) (*apisv1alpha1.APIResourceSchema, error) {
+	s := &apisv1alpha1.APIResourceSchema{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: apisv1alpha1.SchemeGroupVersion.String(),
+			Kind:       "APIResourceSchema",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: APIResourceSchemaName(prefix, crd.Spec.Group, crd.Spec.Names.Plural),
+		},
+		Spec: apisv1alpha1.APIResourceSchemaSpec{
+			Group: crd.Spec.Group,
+			Names: crd.Spec.Names,
+			Scope: crd.Spec.Scope,
+		},
+	}
+	if conversion := crd.Spec.Conversion; conversion != nil && conversion.Strategy == apiextensionsv1.WebhookConverter {
+		s.Spec.Conversion = &apisv1alpha1.CustomResourceConversion{
+			Strategy: apisv1alpha1.WebhookConverter,
+			Webhook:  conversion.Webhook.DeepCopy(),
+		}
+	}
+
+	preserveUnknownFields := true
+	for _, v := range crd.Spec.Versions {
+		props := &apiextensionsv1.JSONSchemaProps{Type: "object", XPreserveUnknownFields: &preserveUnknownFields}
+		if v.Schema != nil && v.Schema.OpenAPIV3Schema != nil {
+			props = v.Schema.OpenAPIV3Schema.DeepCopy()
+			if crd.Spec.PreserveUnknownFields {
+				props.XPreserveUnknownFields = &preserveUnknownFields
+			}
+		}
+		raw, err := json.Marshal(props)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode the schema of version %q of CRD %s: %w", v.Name, crd.Name, err)
+		}
+
+		s.Spec.Versions = append(s.Spec.Versions, apisv1alpha1.APIResourceVersion{
+			Name:                     v.Name,
+			Served:                   v.Served,
+			Storage:                  v.Storage,
+			Deprecated:               v.Deprecated,
+			DeprecationWarning:       v.DeprecationWarning,
+			Schema:                   runtime.RawExtension{Raw: raw},
+			Subresources:             v.Subresources.DeepCopy(),
+			AdditionalPrinterColumns: v.AdditionalPrinterColumns,
+		})
+	}
+
+	return s, nil
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helper
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+)
+
+func TestCRDToAPIResourceSchema(t *testing.T) {
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "widgets.example.com"},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: "example.com",
+			Names: apiextensionsv1.CustomResourceDefinitionNames{Plural: "widgets", Singular: "widget", Kind: "Widget", ListKind: "WidgetList"},
+			Scope: apiextensionsv1.NamespaceScoped,
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{
+					Name:    "v1",
+					Served:  true,
+					Storage: true,
+					Schema: &apiextensionsv1.CustomResourceValidation{OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
+						Type: "object",
+						Properties: map[string]apiextensionsv1.JSONSchemaProps{
+							"spec": {Type: "object", Properties: map[string]apiextensionsv1.JSONSchemaProps{
+								"size": {Type: "integer", Default: &apiextensionsv1.JSON{Raw: []byte("1")}},
+							}},
+						},
+					}},
+					Subresources: &apiextensionsv1.CustomResourceSubresources{Status: &apiextensionsv1.CustomResourceSubresourceStatus{}},
+				},
+				{Name: "v1alpha1", Served: false},
+			},
+			Conversion:            &apiextensionsv1.CustomResourceConversion{Strategy: apiextensionsv1.NoneConverter},
+			PreserveUnknownFields: true,
+		},
+	}
+
+	s, err := CRDToAPIResourceSchema(crd, "v1")
+	require.NoError(t, err)
+	require.Equal(t, "v1.widgets.example.com", s.Name)
+	require.Equal(t, crd.Spec.Names, s.Spec.Names)
+	require.Equal(t, apiextensionsv1.NamespaceScoped, s.Spec.Scope)
+	require.Nil(t, s.Spec.Conversion, "the None strategy is the default")
+	require.Len(t, s.Spec.Versions, 2)
+	require.NotNil(t, s.Spec.Versions[0].Subresources.Status)
+
+	for _, v := range s.Spec.Versions {
+		var props apiextensionsv1.JSONSchemaProps
+		require.NoError(t, json.Unmarshal(v.Schema.Raw, &props))
+		require.Equal(t, "object", props.Type)
+		require.NotNil(t, props.XPreserveUnknownFields, "version %s", v.Name)
+		require.True(t, *props.XPreserveUnknownFields, "version %s", v.Name)
+	}
+	require.Nil(t, crd.Spec.Versions[0].Schema.OpenAPIV3Schema.XPreserveUnknownFields, "the CRD must not be mutated")
+
+	crd.Spec.Group = ""
+	crd.Spec.Conversion = &apiextensionsv1.CustomResourceConversion{
+		Strategy: apiextensionsv1.WebhookConverter,
+		Webhook:  &apiextensionsv1.WebhookConversion{ConversionReviewVersions: []string{"v1"}},
+	}
+	s, err = CRDToAPIResourceSchema(crd, "v2")
+	require.NoError(t, err)
+	require.Equal(t, "v2.widgets.core", s.Name)
+	require.Equal(t, apisv1alpha1.WebhookConverter, s.Spec.Conversion.Strategy)
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helper
+
+import (
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+	tenancyhelper "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+)
+
+// ExportClusterName returns the logical cluster and the name of the APIExport referenced
+// by an APIBinding in the given logical cluster. It returns false if no APIExport is
+// referenced, or if the reference cannot be resolved.
+func ExportClusterName(bindingClusterName string, ref apisv1alpha1.ExportReference) (string, string, bool) {
+	switch {
+	case ref.Workspace != nil && ref.Workspace.Path != "":
+		return ref.Workspace.Path, ref.Workspace.ExportName, true
+	case ref.Workspace != nil:
+		org, _, err := tenancyhelper.ParseLogicalClusterName(bindingClusterName)
+		if err != nil {
+			return "", "", false
+		}
+		return tenancyhelper.EncodeOrganizationAndWorkspace(org, ref.Workspace.WorkspaceName), ref.Workspace.ExportName, true
+	case ref.Root != nil:
+		return tenancyhelper.RootCluster, ref.Root.ExportName, true
+	default:
+		return "", "", false
+	}
+}
+
+// IdentityHash returns the identity hash of the APIExport presented by the reference.
+func IdentityHash(ref apisv1alpha1.ExportReference) string {
+	switch {
+	case ref.Workspace != nil:
+		return ref.Workspace.IdentityHash
+	case ref.Root != nil:
+		return ref.Root.IdentityHash
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helper
+
+import (
+	"testing"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+)
+
+func TestExportClusterName(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		cluster     string
+		ref         apisv1alpha1.ExportReference
+		wantCluster string
+		wantExport  string
+		wantOK      bool
+	}{
+		{
+			name:        "workspace",
+			cluster:     "acme:team",
+			ref:         apisv1alpha1.ExportReference{Workspace: &apisv1alpha1.WorkspaceExportReference{WorkspaceName: "services", ExportName: "widgets"}},
+			wantCluster: "acme:services",
+			wantExport:  "widgets",
+			wantOK:      true,
+		},
+		{
+			name:        "absolute path in another organization",
+			cluster:     "acme:team",
+			ref:         apisv1alpha1.ExportReference{Workspace: &apisv1alpha1.WorkspaceExportReference{Path: "initech:services", ExportName: "widgets"}},
+			wantCluster: "initech:services",
+			wantExport:  "widgets",
+			wantOK:      true,
+		},
+		{
+			name:        "root",
+			cluster:     "acme:team",
+			ref:         apisv1alpha1.ExportReference{Root: &apisv1alpha1.RootExportReference{ExportName: "tenancy.kcp.dev"}},
+			wantCluster: "root",
+			wantExport:  "tenancy.kcp.dev",
+			wantOK:      true,
+		},
+		{
+			name:    "invalid binding cluster",
+			cluster: "too:many:parts",
+			ref:     apisv1alpha1.ExportReference{Workspace: &apisv1alpha1.WorkspaceExportReference{WorkspaceName: "services", ExportName: "widgets"}},
+		},
+		{
+			name:    "empty",
+			cluster: "acme:team",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster, export, ok := ExportClusterName(tt.cluster, tt.ref)
+			if cluster != tt.wantCluster || export != tt.wantExport || ok != tt.wantOK {
+				t.Errorf("ExportClusterName() = (%q, %q, %v), want (%q, %q, %v)", cluster, export, ok, tt.wantCluster, tt.wantExport, tt.wantOK)
+			}
+		})
+	}
+}
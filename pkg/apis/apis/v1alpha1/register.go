@@ -51,6 +51,9 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 		&APIExport{},
 		&APIExportList{},
 
+		&APIExportEndpointSlice{},
+		&APIExportEndpointSliceList{},
+
 		&APIResourceSchema{},
 		&APIResourceSchemaList{},
 	)
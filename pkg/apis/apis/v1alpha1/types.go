@@ -17,6 +17,8 @@ limitations under the License.
 package v1alpha1
 
 import (
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -49,41 +51,146 @@ type APIBinding struct {
 	Status APIBindingStatus `json:"status,omitempty"`
 }
 
+func (in *APIBinding) SetConditions(c conditionsv1alpha1.Conditions) {
+	in.Status.Conditions = c
+}
+
+func (in *APIBinding) GetConditions() conditionsv1alpha1.Conditions {
+	return in.Status.Conditions
+}
+
 // APIBindingSpec records the APIs and implementations that are to be bound.
 type APIBindingSpec struct {
 	// reference uniquely identifies an API to bind to.
 	//
 	// +optional
 	Reference ExportReference `json:"reference,omitempty"`
+
+	// acceptedPermissionClaims records the permission claims of the bound APIExport
+	// that are granted in this workspace. Claims not listed here are not granted, and
+	// entries not claimed by the APIExport have no effect.
+	//
+	// +optional
+	// +listType=map
+	// +listMapKey=group
+	// +listMapKey=resource
+	AcceptedPermissionClaims []PermissionClaim `json:"acceptedPermissionClaims,omitempty"`
+
+	// upgradePolicy defines how newer APIResourceSchemas of the bound APIExport are adopted:
+	// - Manual: an upgrade listed in status.availableUpgrades is only applied when its
+	//   schema is listed in spec.acceptedUpgrades.
+	// - Automatic: upgrades are applied as soon as they are available.
+	//
+	// +optional
+	// +kubebuilder:default=Manual
+	// +kubebuilder:validation:Enum=Manual;Automatic
+	UpgradePolicy APIBindingUpgradePolicyType `json:"upgradePolicy,omitempty"`
+
+	// acceptedUpgrades lists the names of the APIResourceSchemas the bound resources
+	// may be upgraded to when the upgrade policy is Manual.
+	//
+	// +optional
+	// +listType=set
+	AcceptedUpgrades []string `json:"acceptedUpgrades,omitempty"`
+
+	// conflictPolicy defines which definition of a resource is served when a bound resource
+	// is also defined by a CustomResourceDefinition of the workspace:
+	// - Reject: the APIBinding is rejected by admission. If the CustomResourceDefinition is
+	//   created afterwards, the CustomResourceDefinition is served.
+	// - LocalWins: the CustomResourceDefinition of the workspace is served.
+	// - BindingWins: the bound resource is served.
+	//
+	// A resource bound by several APIBindings of a workspace is always served by the oldest
+	// of them, and the creation of newer APIBindings binding the same resource is rejected.
+	//
+	// +optional
+	// +kubebuilder:default=Reject
+	// +kubebuilder:validation:Enum=Reject;LocalWins;BindingWins
+	ConflictPolicy APIBindingConflictPolicyType `json:"conflictPolicy,omitempty"`
 }
 
+// APIBindingUpgradePolicyType is the policy of adopting newer APIResourceSchemas of an APIExport.
+type APIBindingUpgradePolicyType string
+
+const (
+	APIBindingUpgradePolicyManual    APIBindingUpgradePolicyType = "Manual"
+	APIBindingUpgradePolicyAutomatic APIBindingUpgradePolicyType = "Automatic"
+)
+
+// APIBindingConflictPolicyType is the policy of resolving conflicts between bound resources and
+// the CustomResourceDefinitions of the workspace.
+type APIBindingConflictPolicyType string
+
+const (
+	APIBindingConflictPolicyReject      APIBindingConflictPolicyType = "Reject"
+	APIBindingConflictPolicyLocalWins   APIBindingConflictPolicyType = "LocalWins"
+	APIBindingConflictPolicyBindingWins APIBindingConflictPolicyType = "BindingWins"
+)
+
 // ExportReference describes a reference to an APIExport. Exactly one of the
 // fields must be set.
 type ExportReference struct {
-	// workspace is a reference to an APIExport in the same organization. The creator
-	// of the APIBinding needs to have access to the APIExport with the verb `bind`
-	// in order to bind to it.
+	// workspace is a reference to an APIExport in a workspace of the same organization,
+	// or in any workspace given by its absolute path. The creator of the APIBinding
+	// needs to have access to the APIExport with the verb `bind` in the workspace of
+	// the APIExport in order to bind to it.
 	//
 	// +optional
 	Workspace *WorkspaceExportReference `json:"workspace,omitempty"`
+
+	// root is a reference to an APIExport in the root workspace, e.g. one of the
+	// APIExports of kcp's own APIs.
+	//
+	// +optional
+	Root *RootExportReference `json:"root,omitempty"`
 }
 
 // WorkspaceExportReference describes an API and backing implementation that are provided by an actor in the
-// specified Workspace.
+// specified Workspace. Exactly one of name and path must be set.
 type WorkspaceExportReference struct {
 	// name is a workspace name in the same organization.
 	//
+	// +optional
+	WorkspaceName string `json:"name,omitempty"`
+
+	// path is the absolute path of the workspace of the APIExport, i.e. its logical
+	// cluster name, e.g. `root:acme` or `acme:provider`. It allows binding to APIExports
+	// outside of the organization.
+	//
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(:[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`
+	Path string `json:"path,omitempty"`
+
+	// Name of the APIExport that describes the API.
+	//
 	// +required
 	// +kubebuilder:validation:Required
 	// +kube:validation:MinLength=1
-	WorkspaceName string `json:"name"`
+	ExportName string `json:"exportName"`
 
-	// Name of the APIExport that describes the API.
+	// identityHash is the identity hash of the APIExport, as published in its
+	// status.identityHash. It must match the current identity of the APIExport,
+	// which makes sure the binding is bound to the intended service provider.
+	//
+	// +optional
+	IdentityHash string `json:"identityHash,omitempty"`
+}
+
+// RootExportReference describes an API and backing implementation that are provided
+// in the root workspace.
+type RootExportReference struct {
+	// Name of the APIExport in the root workspace.
 	//
 	// +required
 	// +kubebuilder:validation:Required
 	// +kube:validation:MinLength=1
 	ExportName string `json:"exportName"`
+
+	// identityHash is the identity hash of the APIExport, as published in its
+	// status.identityHash. It must match the current identity of the APIExport.
+	//
+	// +optional
+	IdentityHash string `json:"identityHash,omitempty"`
 }
 
 // APIBindingPhaseType is the type of the current phase of an APIBinding.
@@ -115,6 +222,15 @@ type APIBindingStatus struct {
 	// +listMapKey=resource
 	BoundResources []BoundAPIResource `json:"boundResources,omitempty"`
 
+	// availableUpgrades lists the bound resources for which the bound APIExport offers
+	// a different APIResourceSchema than the bound one.
+	//
+	// +optional
+	// +listType=map
+	// +listMapKey=group
+	// +listMapKey=resource
+	AvailableUpgrades []AvailableUpgrade `json:"availableUpgrades,omitempty"`
+
 	// initializers tracks the binding process of the APIBinding. The APIBinding cannot
 	// be moved to Bound until the initializers have finished their work. Initializers are
 	// added before transition to Initializing phase and verified through admission to be
@@ -169,6 +285,51 @@ type BoundAPIResource struct {
 	StorageVersions []string `json:"storageVersions,omitempty"`
 }
 
+// These are valid conditions of APIBinding.
+const (
+	// StorageMigrated means that the stored objects of all bound resources are persisted
+	// in the storage version of the bound schemas.
+	StorageMigrated conditionsv1alpha1.ConditionType = "StorageMigrated"
+	// StorageMigrationFailedReason reason in StorageMigrated condition means that stored
+	// objects could not be rewritten in the current storage version.
+	StorageMigrationFailedReason = "MigrationFailed"
+	// StorageMigrationPendingReason reason in StorageMigrated condition means that stored
+	// objects might still be persisted in previous storage versions.
+	StorageMigrationPendingReason = "MigrationPending"
+
+	// NamesAccepted means that the bound resources do not conflict with the CustomResourceDefinitions
+	// or the other APIBindings of the workspace, or that the conflicts are resolved in favor of the
+	// APIBinding.
+	NamesAccepted conditionsv1alpha1.ConditionType = "NamesAccepted"
+	// NamingConflictsReason reason in NamesAccepted condition means that some bound resources are
+	// not served because they are bound by older APIBindings, or defined by CustomResourceDefinitions
+	// of the workspace with the Reject conflict policy.
+	NamingConflictsReason = "NamingConflicts"
+	// LocalResourcesWinReason reason in NamesAccepted condition means that some bound resources are
+	// not served because they are defined by CustomResourceDefinitions of the workspace with the
+	// LocalWins conflict policy.
+	LocalResourcesWinReason = "LocalResourcesWin"
+)
+
+// AvailableUpgrade describes a newer APIResourceSchema of the bound APIExport for a bound resource.
+type AvailableUpgrade struct {
+	// group is the group of the bound API. Empty string for the core API group.
+	//
+	// +required
+	Group string `json:"group"`
+
+	// resource is the resource of the bound API.
+	//
+	// +required
+	// +kubebuilder:validation:MinLength=1
+	Resource string `json:"resource"`
+
+	// schema references the APIResourceSchema the resource can be upgraded to.
+	//
+	// +required
+	Schema BoundAPIResourceSchema `json:"schema"`
+}
+
 // BoundAPIResourceSchema is a reference to an APIResourceSchema.
 type BoundAPIResourceSchema struct {
 	// name is the bound APIResourceSchema name.
@@ -227,18 +388,154 @@ type APIExportSpec struct {
 	// with this APIExport.
 	//
 	// The schemas can be changed in the life-cycle of the APIExport. These changes
-	// have no effect on existing APIBindings, but only on newly bound ones.
-	//
-	// For updating existing APIBindings, use an APIDeployment keeping bound
-	// workspaces up-to-date.
+	// are offered to existing APIBindings as available upgrades, which are applied
+	// according to the upgrade policy of the APIBinding.
 	//
 	// +optional
 	// +listType=set
 	LatestResourceSchemas []string `json:"latestResourceSchemas,omitempty"`
+
+	// permissionClaims are the resources of the consumer workspaces, not part of the
+	// exported APIs, that the owner of the APIExport asks access to through the APIExport
+	// virtual workspace, e.g. ConfigMaps or Secrets. A claim is only granted in the
+	// workspaces whose APIBinding accepts it.
+	//
+	// +optional
+	// +listType=map
+	// +listMapKey=group
+	// +listMapKey=resource
+	PermissionClaims []PermissionClaim `json:"permissionClaims,omitempty"`
+
+	// identity points to a secret that contains the API identity in the "key" file.
+	// The API identity tells this APIExport apart from other APIExports exporting
+	// the same group and resources. Its hash is published in status.identityHash.
+	//
+	// Different APIExports in a workspace can share a common identity, or have
+	// different ones. The identity (the secret) can also be transferred to another
+	// workspace when the APIExport is moved. Updating the key rotates the identity.
+	//
+	// If no secret is referenced, one is generated in the kcp-system namespace.
+	//
+	// +optional
+	Identity *Identity `json:"identity,omitempty"`
+
+	// admissionWebhooks are the admission webhooks of the owner of the APIExport. They are
+	// called for the exported resources in all the workspaces bound to the APIExport, after
+	// the admission webhooks of these workspaces are called. The Services of the webhooks
+	// are resolved in the workspace of the APIExport.
+	//
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	AdmissionWebhooks []AdmissionWebhook `json:"admissionWebhooks,omitempty"`
+}
+
+// AdmissionWebhookType is the type of an admission webhook of an APIExport.
+type AdmissionWebhookType string
+
+const (
+	// MutatingAdmissionWebhook webhooks are called in the mutating admission phase, and can
+	// change the objects with a JSON patch.
+	MutatingAdmissionWebhook AdmissionWebhookType = "Mutating"
+	// ValidatingAdmissionWebhook webhooks are called in the validating admission phase, and
+	// can only accept or reject the objects.
+	ValidatingAdmissionWebhook AdmissionWebhookType = "Validating"
+)
+
+// AdmissionWebhook is an admission webhook called for the exported resources of an APIExport.
+//
+// Webhooks must not have side effects, as they are also called for dry-run requests.
+type AdmissionWebhook struct {
+	// name is the name of the webhook, unique in the APIExport.
+	//
+	// +required
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// type is the type of the webhook, Mutating or Validating.
+	//
+	// +required
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Enum=Mutating;Validating
+	Type AdmissionWebhookType `json:"type"`
+
+	// clientConfig defines how to communicate with the webhook. A Service is resolved in
+	// the workspace of the APIExport.
+	//
+	// +required
+	// +kubebuilder:validation:Required
+	ClientConfig admissionregistrationv1.WebhookClientConfig `json:"clientConfig"`
+
+	// resources are the exported resources the webhook is called for. All the exported
+	// resources if empty.
+	//
+	// +optional
+	// +listType=set
+	Resources []string `json:"resources,omitempty"`
+
+	// operations are the operations the webhook is called for. CREATE and UPDATE if empty.
+	//
+	// +optional
+	// +listType=set
+	Operations []admissionregistrationv1.OperationType `json:"operations,omitempty"`
+
+	// failurePolicy defines how errors calling the webhook are handled, Ignore or Fail.
+	// Defaults to Fail.
+	//
+	// +optional
+	// +kubebuilder:validation:Enum=Ignore;Fail
+	FailurePolicy *admissionregistrationv1.FailurePolicyType `json:"failurePolicy,omitempty"`
+
+	// timeoutSeconds is the timeout of the calls of the webhook, between 1 and 30 seconds.
+	// Defaults to 10 seconds.
+	//
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=30
+	TimeoutSeconds *int32 `json:"timeoutSeconds,omitempty"`
+
+	// admissionReviewVersions are the AdmissionReview versions the webhook accepts, by order
+	// of preference. kcp sends the first version it supports. Defaults to v1.
+	//
+	// +optional
+	// +listType=atomic
+	AdmissionReviewVersions []string `json:"admissionReviewVersions,omitempty"`
+}
+
+// Identity defines the identity of an APIExport.
+type Identity struct {
+	// secretRef is a reference to a secret that contains the API identity in the "key" file.
+	//
+	// +optional
+	SecretRef *corev1.SecretReference `json:"secretRef,omitempty"`
+}
+
+// PermissionClaim identifies a resource of the consumer workspaces an APIExport asks access to.
+type PermissionClaim struct {
+	// group is the API group of the claimed resource. Empty string for the core API group.
+	//
+	// +required
+	Group string `json:"group"`
+
+	// resource is the name of the claimed resource.
+	//
+	// +required
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Resource string `json:"resource"`
 }
 
 // APIExportStatus defines the observed state of APIExport.
 type APIExportStatus struct {
+	// identityHash is the hash of the API identity that this APIExport represents.
+	// The hash is the hex encoded sha256 of the key in the identity secret.
+	//
+	// APIBindings must present this hash to bind to the APIExport.
+	//
+	// +optional
+	IdentityHash string `json:"identityHash,omitempty"`
+
 	// ResourceSchemasInUse records which schemas are actually in use (that is,
 	// APIBindings bound to this APIExport at any given time). It can be a
 	// superset of the actually bound schemas. Pruning is done regularly.
@@ -248,6 +545,21 @@ type APIExportStatus struct {
 	// +optional
 	// +listType=set
 	ResourceSchemasInUse []string `json:"resourceSchemasInUse,omitempty"`
+
+	// virtualWorkspaces contains all APIExport virtual workspace URLs, one per shard.
+	//
+	// +optional
+	VirtualWorkspaces []VirtualWorkspace `json:"virtualWorkspaces,omitempty"`
+}
+
+// VirtualWorkspace is a URL where a virtual workspace can be reached.
+type VirtualWorkspace struct {
+	// url is a virtual workspace URL.
+	//
+	// +required
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Format=uri
+	URL string `json:"url"`
 }
 
 // APIExportList is a list of APIExport resources
@@ -260,6 +572,99 @@ type APIExportList struct {
 	Items []APIExport `json:"items"`
 }
 
+// APIExportEndpointSlice is a sink for the endpoints of an APIExport. These endpoints
+// are the URLs of the APIExport virtual workspace, one per shard. Provider controllers
+// watch APIExportEndpointSlices to discover and connect to all the shards serving
+// the consumers of their APIExport.
+//
+// +crd
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster,categories=kcp,path=apiexportendpointslices,singular=apiexportendpointslice
+type APIExportEndpointSlice struct {
+	metav1.TypeMeta `json:",inline"`
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec holds the desired state.
+	//
+	// +required
+	Spec APIExportEndpointSliceSpec `json:"spec"`
+
+	// Status communicates the observed state.
+	//
+	// +optional
+	Status APIExportEndpointSliceStatus `json:"status,omitempty"`
+}
+
+func (in *APIExportEndpointSlice) SetConditions(c conditionsv1alpha1.Conditions) {
+	in.Status.Conditions = c
+}
+
+func (in *APIExportEndpointSlice) GetConditions() conditionsv1alpha1.Conditions {
+	return in.Status.Conditions
+}
+
+// APIExportEndpointSliceSpec defines the desired state of APIExportEndpointSlice.
+type APIExportEndpointSliceSpec struct {
+	// export points to the APIExport whose endpoints are listed.
+	//
+	// +required
+	// +kubebuilder:validation:Required
+	Export ExportReference `json:"export"`
+}
+
+// APIExportEndpointSliceStatus defines the observed state of APIExportEndpointSlice.
+type APIExportEndpointSliceStatus struct {
+	// endpoints contains all the URLs of the APIExport virtual workspace, one per shard,
+	// sorted by shard name.
+	//
+	// +optional
+	// +listType=map
+	// +listMapKey=url
+	Endpoints []APIExportEndpoint `json:"endpoints,omitempty"`
+
+	// conditions is a list of conditions that apply to the APIExportEndpointSlice.
+	//
+	// +optional
+	Conditions conditionsv1alpha1.Conditions `json:"conditions,omitempty"`
+}
+
+// APIExportEndpoint contains the endpoint information of an APIExport on a shard.
+type APIExportEndpoint struct {
+	// url is an APIExport virtual workspace URL.
+	//
+	// +required
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Format=uri
+	URL string `json:"url"`
+}
+
+// These are valid conditions of APIExportEndpointSlice.
+const (
+	// APIExportValid means that the referenced APIExport exists.
+	APIExportValid conditionsv1alpha1.ConditionType = "APIExportValid"
+	// APIExportNotFoundReason reason in APIExportValid condition means that the
+	// referenced APIExport does not exist.
+	APIExportNotFoundReason = "APIExportNotFound"
+	// APIExportInvalidReferenceReason reason in APIExportValid condition means that
+	// the export reference cannot be resolved.
+	APIExportInvalidReferenceReason = "InvalidReference"
+)
+
+// APIExportEndpointSliceList is a list of APIExportEndpointSlice resources
+//
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type APIExportEndpointSliceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []APIExportEndpointSlice `json:"items"`
+}
+
 // APIResourceSchema describes a resource, identified by (group, version, resource, schema).
 //
 // A APIResourceSchema is immutable and cannot be deleted if they are referenced by
@@ -302,14 +707,107 @@ type APIResourceSchemaSpec struct {
 
 	// versions is the API version of the defined custom resource.
 	//
-	// Note: the OpenAPI v3 schemas must be equal for all versions until CEL
-	//       version migration is supported.
+	// Note: the OpenAPI v3 schemas of different versions may only differ if
+	//       a conversion strategy other than None is specified.
 	//
 	// +required
 	// +listType=map
 	// +listMapKey=name
 	// +kubebuilder:validation:MinItems=1
 	Versions []APIResourceVersion `json:"versions"`
+
+	// conversion defines conversion settings for the defined custom resource.
+	// If not specified, the None strategy is used.
+	//
+	// +optional
+	Conversion *CustomResourceConversion `json:"conversion,omitempty"`
+}
+
+// ConversionStrategyType describes different conversion types.
+type ConversionStrategyType string
+
+const (
+	// NoneConverter is a converter that only sets the apiVersion of the object.
+	NoneConverter ConversionStrategyType = "None"
+	// WebhookConverter is a converter that calls an external webhook to do the conversion.
+	WebhookConverter ConversionStrategyType = "Webhook"
+	// RulesConverter is a converter that applies the declarative conversion rules
+	// of the APIResourceSchema in-process.
+	RulesConverter ConversionStrategyType = "Rules"
+)
+
+// CustomResourceConversion describes how to convert different versions of a resource.
+type CustomResourceConversion struct {
+	// strategy specifies how custom resources are converted between versions. Allowed values are:
+	// - `None`: The converter only changes the apiVersion and does not touch any other field in the custom resource.
+	// - `Webhook`: kcp calls an external webhook to do the conversion. spec.conversion.webhook must be set.
+	//   A service reference is resolved in the workspace of the APIResourceSchema.
+	// - `Rules`: kcp applies the rules in spec.conversion.rules in-process. spec.conversion.rules must be set.
+	//
+	// +required
+	// +kubebuilder:validation:Enum=None;Webhook;Rules
+	Strategy ConversionStrategyType `json:"strategy"`
+
+	// webhook describes how to call the conversion webhook. Required when `strategy` is set to `Webhook`.
+	//
+	// +optional
+	Webhook *apiextensionsv1.WebhookConversion `json:"webhook,omitempty"`
+
+	// rules describe how to convert between pairs of versions. Required when `strategy` is set to `Rules`.
+	// Every version must be convertible to and from the storage version.
+	//
+	// +optional
+	// +listType=map
+	// +listMapKey=fromVersion
+	// +listMapKey=toVersion
+	Rules []ConversionRules `json:"rules,omitempty"`
+}
+
+// ConversionRules describes how to convert an object from one version to another.
+type ConversionRules struct {
+	// fromVersion is the version the rules convert from.
+	//
+	// +required
+	// +kubebuilder:validation:MinLength=1
+	FromVersion string `json:"fromVersion"`
+
+	// toVersion is the version the rules convert to.
+	//
+	// +required
+	// +kubebuilder:validation:MinLength=1
+	ToVersion string `json:"toVersion"`
+
+	// fields lists the fields which move between the versions. Fields not
+	// listed are kept at the same path.
+	//
+	// +optional
+	// +listType=map
+	// +listMapKey=from
+	Fields []FieldConversionRule `json:"fields,omitempty"`
+}
+
+// FieldConversionRule moves a field from one path to another, optionally transforming its
+// value with a CEL expression.
+type FieldConversionRule struct {
+	// from is the dot-separated path of the field in the source version, e.g. "spec.size".
+	//
+	// +required
+	// +kubebuilder:validation:MinLength=1
+	From string `json:"from"`
+
+	// to is the dot-separated path of the field in the target version, e.g. "spec.replicas".
+	// If empty, the field is dropped.
+	//
+	// +optional
+	To string `json:"to,omitempty"`
+
+	// transformation is a CEL expression computing the value of the field in the target
+	// version from `self`, the value of the field in the source version, typed by the
+	// schema of the source version, e.g. "self * 2" or "self.split(',')". If empty, the
+	// value is moved as is. Requires `to`.
+	//
+	// +optional
+	Transformation string `json:"transformation,omitempty"`
 }
 
 // APIResourceVersion describes one API version of a resource.
@@ -345,7 +843,9 @@ type APIResourceVersion struct {
 	// +optional
 	DeprecationWarning *string `json:"deprecationWarning,omitempty"`
 	// schema describes the structural schema used for validation, pruning, and defaulting
-	// of this version of the custom resource.
+	// of this version of the custom resource. Like in CustomResourceDefinitions, CEL
+	// validation rules can be given in `x-kubernetes-validations`. They are evaluated on
+	// create and update of the bound resources in every workspace bound to the schema.
 	//
 	// +required
 	// +kubebuilder:pruning:PreserveUnknownFields
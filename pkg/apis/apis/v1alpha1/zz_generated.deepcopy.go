@@ -22,6 +22,8 @@ limitations under the License.
 package v1alpha1
 
 import (
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 
@@ -93,6 +95,16 @@ func (in *APIBindingList) DeepCopyObject() runtime.Object {
 func (in *APIBindingSpec) DeepCopyInto(out *APIBindingSpec) {
 	*out = *in
 	in.Reference.DeepCopyInto(&out.Reference)
+	if in.AcceptedPermissionClaims != nil {
+		in, out := &in.AcceptedPermissionClaims, &out.AcceptedPermissionClaims
+		*out = make([]PermissionClaim, len(*in))
+		copy(*out, *in)
+	}
+	if in.AcceptedUpgrades != nil {
+		in, out := &in.AcceptedUpgrades, &out.AcceptedUpgrades
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -121,6 +133,11 @@ func (in *APIBindingStatus) DeepCopyInto(out *APIBindingStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.AvailableUpgrades != nil {
+		in, out := &in.AvailableUpgrades, &out.AvailableUpgrades
+		*out = make([]AvailableUpgrade, len(*in))
+		copy(*out, *in)
+	}
 	if in.Initializers != nil {
 		in, out := &in.Initializers, &out.Initializers
 		*out = make([]string, len(*in))
@@ -174,6 +191,128 @@ func (in *APIExport) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *APIExportEndpoint) DeepCopyInto(out *APIExportEndpoint) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new APIExportEndpoint.
+func (in *APIExportEndpoint) DeepCopy() *APIExportEndpoint {
+	if in == nil {
+		return nil
+	}
+	out := new(APIExportEndpoint)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *APIExportEndpointSlice) DeepCopyInto(out *APIExportEndpointSlice) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new APIExportEndpointSlice.
+func (in *APIExportEndpointSlice) DeepCopy() *APIExportEndpointSlice {
+	if in == nil {
+		return nil
+	}
+	out := new(APIExportEndpointSlice)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *APIExportEndpointSlice) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *APIExportEndpointSliceList) DeepCopyInto(out *APIExportEndpointSliceList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]APIExportEndpointSlice, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new APIExportEndpointSliceList.
+func (in *APIExportEndpointSliceList) DeepCopy() *APIExportEndpointSliceList {
+	if in == nil {
+		return nil
+	}
+	out := new(APIExportEndpointSliceList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *APIExportEndpointSliceList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *APIExportEndpointSliceSpec) DeepCopyInto(out *APIExportEndpointSliceSpec) {
+	*out = *in
+	in.Export.DeepCopyInto(&out.Export)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new APIExportEndpointSliceSpec.
+func (in *APIExportEndpointSliceSpec) DeepCopy() *APIExportEndpointSliceSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(APIExportEndpointSliceSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *APIExportEndpointSliceStatus) DeepCopyInto(out *APIExportEndpointSliceStatus) {
+	*out = *in
+	if in.Endpoints != nil {
+		in, out := &in.Endpoints, &out.Endpoints
+		*out = make([]APIExportEndpoint, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make(conditionsv1alpha1.Conditions, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new APIExportEndpointSliceStatus.
+func (in *APIExportEndpointSliceStatus) DeepCopy() *APIExportEndpointSliceStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(APIExportEndpointSliceStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *APIExportList) DeepCopyInto(out *APIExportList) {
 	*out = *in
@@ -215,6 +354,23 @@ func (in *APIExportSpec) DeepCopyInto(out *APIExportSpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.PermissionClaims != nil {
+		in, out := &in.PermissionClaims, &out.PermissionClaims
+		*out = make([]PermissionClaim, len(*in))
+		copy(*out, *in)
+	}
+	if in.Identity != nil {
+		in, out := &in.Identity, &out.Identity
+		*out = new(Identity)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AdmissionWebhooks != nil {
+		in, out := &in.AdmissionWebhooks, &out.AdmissionWebhooks
+		*out = make([]AdmissionWebhook, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -236,6 +392,11 @@ func (in *APIExportStatus) DeepCopyInto(out *APIExportStatus) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.VirtualWorkspaces != nil {
+		in, out := &in.VirtualWorkspaces, &out.VirtualWorkspaces
+		*out = make([]VirtualWorkspace, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -320,6 +481,11 @@ func (in *APIResourceSchemaSpec) DeepCopyInto(out *APIResourceSchemaSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Conversion != nil {
+		in, out := &in.Conversion, &out.Conversion
+		*out = new(CustomResourceConversion)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -365,6 +531,65 @@ func (in *APIResourceVersion) DeepCopy() *APIResourceVersion {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AdmissionWebhook) DeepCopyInto(out *AdmissionWebhook) {
+	*out = *in
+	in.ClientConfig.DeepCopyInto(&out.ClientConfig)
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Operations != nil {
+		in, out := &in.Operations, &out.Operations
+		*out = make([]admissionregistrationv1.OperationType, len(*in))
+		copy(*out, *in)
+	}
+	if in.FailurePolicy != nil {
+		in, out := &in.FailurePolicy, &out.FailurePolicy
+		*out = new(admissionregistrationv1.FailurePolicyType)
+		**out = **in
+	}
+	if in.TimeoutSeconds != nil {
+		in, out := &in.TimeoutSeconds, &out.TimeoutSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.AdmissionReviewVersions != nil {
+		in, out := &in.AdmissionReviewVersions, &out.AdmissionReviewVersions
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AdmissionWebhook.
+func (in *AdmissionWebhook) DeepCopy() *AdmissionWebhook {
+	if in == nil {
+		return nil
+	}
+	out := new(AdmissionWebhook)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AvailableUpgrade) DeepCopyInto(out *AvailableUpgrade) {
+	*out = *in
+	out.Schema = in.Schema
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AvailableUpgrade.
+func (in *AvailableUpgrade) DeepCopy() *AvailableUpgrade {
+	if in == nil {
+		return nil
+	}
+	out := new(AvailableUpgrade)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *BoundAPIResource) DeepCopyInto(out *BoundAPIResource) {
 	*out = *in
@@ -403,6 +628,55 @@ func (in *BoundAPIResourceSchema) DeepCopy() *BoundAPIResourceSchema {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConversionRules) DeepCopyInto(out *ConversionRules) {
+	*out = *in
+	if in.Fields != nil {
+		in, out := &in.Fields, &out.Fields
+		*out = make([]FieldConversionRule, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConversionRules.
+func (in *ConversionRules) DeepCopy() *ConversionRules {
+	if in == nil {
+		return nil
+	}
+	out := new(ConversionRules)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CustomResourceConversion) DeepCopyInto(out *CustomResourceConversion) {
+	*out = *in
+	if in.Webhook != nil {
+		in, out := &in.Webhook, &out.Webhook
+		*out = new(v1.WebhookConversion)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Rules != nil {
+		in, out := &in.Rules, &out.Rules
+		*out = make([]ConversionRules, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CustomResourceConversion.
+func (in *CustomResourceConversion) DeepCopy() *CustomResourceConversion {
+	if in == nil {
+		return nil
+	}
+	out := new(CustomResourceConversion)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ExportReference) DeepCopyInto(out *ExportReference) {
 	*out = *in
@@ -411,6 +685,11 @@ func (in *ExportReference) DeepCopyInto(out *ExportReference) {
 		*out = new(WorkspaceExportReference)
 		**out = **in
 	}
+	if in.Root != nil {
+		in, out := &in.Root, &out.Root
+		*out = new(RootExportReference)
+		**out = **in
+	}
 	return
 }
 
@@ -424,6 +703,91 @@ func (in *ExportReference) DeepCopy() *ExportReference {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FieldConversionRule) DeepCopyInto(out *FieldConversionRule) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FieldConversionRule.
+func (in *FieldConversionRule) DeepCopy() *FieldConversionRule {
+	if in == nil {
+		return nil
+	}
+	out := new(FieldConversionRule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Identity) DeepCopyInto(out *Identity) {
+	*out = *in
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
+		*out = new(corev1.SecretReference)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Identity.
+func (in *Identity) DeepCopy() *Identity {
+	if in == nil {
+		return nil
+	}
+	out := new(Identity)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PermissionClaim) DeepCopyInto(out *PermissionClaim) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PermissionClaim.
+func (in *PermissionClaim) DeepCopy() *PermissionClaim {
+	if in == nil {
+		return nil
+	}
+	out := new(PermissionClaim)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RootExportReference) DeepCopyInto(out *RootExportReference) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RootExportReference.
+func (in *RootExportReference) DeepCopy() *RootExportReference {
+	if in == nil {
+		return nil
+	}
+	out := new(RootExportReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtualWorkspace) DeepCopyInto(out *VirtualWorkspace) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtualWorkspace.
+func (in *VirtualWorkspace) DeepCopy() *VirtualWorkspace {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtualWorkspace)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *WorkspaceExportReference) DeepCopyInto(out *WorkspaceExportReference) {
 	*out = *in
@@ -0,0 +1,229 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package projection
+
+import (
+	"encoding/json"
+	"reflect"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1beta1"
+)
+
+// projectedFields maps the fields of ClusterWorkspaces projected onto Workspaces, below
+// the metadata, to the fields of Workspaces, by parent field. The metadata is projected
+// as a whole.
+var projectedFields = map[string]map[string]string{
+	"f:spec":   {".": ".", "f:type": "f:type"},
+	"f:status": {".": ".", "f:baseURL": "f:URL", "f:phase": "f:phase", "f:initializers": "f:initializers"},
+}
+
+// projectManagedFields returns the managed fields of the Workspace projection of a
+// ClusterWorkspace with the given managed fields: the ownership of the projected fields,
+// renamed to the fields of Workspaces.
+func projectManagedFields(managedFields []metav1.ManagedFieldsEntry) []metav1.ManagedFieldsEntry {
+	var projected []metav1.ManagedFieldsEntry
+	for _, entry := range managedFields {
+		if entry.APIVersion != v1alpha1.SchemeGroupVersion.String() {
+			continue
+		}
+		fields, ok := decodeFields(entry.FieldsV1)
+		if !ok {
+			continue
+		}
+		if fields = projectFields(fields, false); len(fields) == 0 {
+			continue
+		}
+		entry.APIVersion = v1beta1.SchemeGroupVersion.String()
+		entry.FieldsV1 = encodeFields(fields)
+		projected = append(projected, entry)
+	}
+	return projected
+}
+
+// ProjectWorkspaceManagedFields returns the managed fields of a ClusterWorkspace with the
+// given managed fields, after an update of its Workspace projection resulting in the given
+// managed fields of the Workspace. The ownership of the projected fields is taken from
+// the Workspace, the ownership of the other fields is kept.
+//
+// This keeps the field managers of Workspaces, e.g. server-side apply conflicts and the
+// removal of fields no longer applied, working across the projection.
+func ProjectWorkspaceManagedFields(workspaceManagedFields, managedFields []metav1.ManagedFieldsEntry) []metav1.ManagedFieldsEntry {
+	var result []metav1.ManagedFieldsEntry
+	for _, entry := range managedFields {
+		if entry.APIVersion != v1alpha1.SchemeGroupVersion.String() {
+			result = append(result, entry)
+			continue
+		}
+		fields, ok := decodeFields(entry.FieldsV1)
+		if !ok {
+			continue
+		}
+		if fields = unprojectedFields(fields); len(fields) == 0 {
+			continue
+		}
+		entry.FieldsV1 = encodeFields(fields)
+		result = append(result, entry)
+	}
+
+	for _, entry := range workspaceManagedFields {
+		if entry.APIVersion != v1beta1.SchemeGroupVersion.String() {
+			continue
+		}
+		fields, ok := decodeFields(entry.FieldsV1)
+		if !ok {
+			continue
+		}
+		if fields = projectFields(fields, true); len(fields) == 0 {
+			continue
+		}
+		entry.APIVersion = v1alpha1.SchemeGroupVersion.String()
+
+		merged := false
+		for i := range result {
+			existing := &result[i]
+			if existing.Manager != entry.Manager || existing.Operation != entry.Operation || existing.Subresource != entry.Subresource || existing.APIVersion != entry.APIVersion {
+				continue
+			}
+			if existingFields, ok := decodeFields(existing.FieldsV1); ok {
+				fields = mergeFields(existingFields, fields)
+			}
+			existing.FieldsV1 = encodeFields(fields)
+			existing.Time = entry.Time
+			merged = true
+			break
+		}
+		if !merged {
+			entry.FieldsV1 = encodeFields(fields)
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// EqualManagedFields returns whether the given managed fields record the same ownership,
+// ignoring the times of the entries and the encoding of their fields.
+func EqualManagedFields(a, b []metav1.ManagedFieldsEntry) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Manager != b[i].Manager || a[i].Operation != b[i].Operation || a[i].APIVersion != b[i].APIVersion || a[i].Subresource != b[i].Subresource {
+			return false
+		}
+		aFields, aOK := decodeFields(a[i].FieldsV1)
+		bFields, bOK := decodeFields(b[i].FieldsV1)
+		if aOK != bOK || !reflect.DeepEqual(aFields, bFields) {
+			return false
+		}
+	}
+	return true
+}
+
+// projectFields returns the projection of the given fields of a ClusterWorkspace onto its
+// Workspace, or the fields of the ClusterWorkspace projected onto the given fields of a
+// Workspace if reverse is true.
+func projectFields(fields map[string]interface{}, reverse bool) map[string]interface{} {
+	projected := map[string]interface{}{}
+	if metadata, ok := fields["f:metadata"]; ok {
+		projected["f:metadata"] = metadata
+	}
+	for parent, children := range projectedFields {
+		from, ok := fields[parent].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		to := map[string]interface{}{}
+		for clusterWorkspaceField, workspaceField := range children {
+			src, dst := clusterWorkspaceField, workspaceField
+			if reverse {
+				src, dst = workspaceField, clusterWorkspaceField
+			}
+			if value, ok := from[src]; ok {
+				to[dst] = value
+			}
+		}
+		if len(to) > 0 {
+			projected[parent] = to
+		}
+	}
+	return projected
+}
+
+// unprojectedFields returns the given fields of a ClusterWorkspace which are not projected
+// onto its Workspace.
+func unprojectedFields(fields map[string]interface{}) map[string]interface{} {
+	remaining := map[string]interface{}{}
+	for name, value := range fields {
+		if name == "f:metadata" {
+			continue
+		}
+		children, projected := projectedFields[name]
+		childFields, ok := value.(map[string]interface{})
+		if !projected || !ok {
+			remaining[name] = value
+			continue
+		}
+		remainingChildren := map[string]interface{}{}
+		for childName, childValue := range childFields {
+			if _, projected := children[childName]; !projected {
+				remainingChildren[childName] = childValue
+			}
+		}
+		if len(remainingChildren) > 0 {
+			remaining[name] = remainingChildren
+		}
+	}
+	return remaining
+}
+
+// mergeFields returns the union of the given fields.
+func mergeFields(a, b map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(a)+len(b))
+	for name, value := range a {
+		merged[name] = value
+	}
+	for name, value := range b {
+		aChildren, aOK := merged[name].(map[string]interface{})
+		bChildren, bOK := value.(map[string]interface{})
+		if aOK && bOK {
+			merged[name] = mergeFields(aChildren, bChildren)
+			continue
+		}
+		merged[name] = value
+	}
+	return merged
+}
+
+func decodeFields(fieldsV1 *metav1.FieldsV1) (map[string]interface{}, bool) {
+	if fieldsV1 == nil {
+		return nil, false
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(fieldsV1.Raw, &fields); err != nil {
+		return nil, false
+	}
+	return fields, true
+}
+
+func encodeFields(fields map[string]interface{}) *metav1.FieldsV1 {
+	// decoded from JSON, hence always encodable
+	raw, _ := json.Marshal(fields)
+	return &metav1.FieldsV1{Raw: raw}
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package projection
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func entry(manager string, operation metav1.ManagedFieldsOperationType, apiVersion, fields string) metav1.ManagedFieldsEntry {
+	return metav1.ManagedFieldsEntry{
+		Manager:    manager,
+		Operation:  operation,
+		APIVersion: apiVersion,
+		FieldsType: "FieldsV1",
+		FieldsV1:   &metav1.FieldsV1{Raw: []byte(fields)},
+	}
+}
+
+func TestProjectManagedFields(t *testing.T) {
+	got := projectManagedFields([]metav1.ManagedFieldsEntry{
+		entry("kubectl", metav1.ManagedFieldsOperationApply, "tenancy.kcp.dev/v1alpha1", `{"f:metadata":{"f:labels":{"f:team":{}}},"f:spec":{"f:type":{},"f:shard":{}}}`),
+		entry("kcp", metav1.ManagedFieldsOperationUpdate, "tenancy.kcp.dev/v1alpha1", `{"f:status":{"f:baseURL":{},"f:phase":{},"f:conditions":{}}}`),
+		entry("scheduler", metav1.ManagedFieldsOperationUpdate, "tenancy.kcp.dev/v1alpha1", `{"f:status":{"f:location":{}}}`),
+		entry("other", metav1.ManagedFieldsOperationUpdate, "example.io/v1", `{"f:metadata":{}}`),
+	})
+	require.True(t, EqualManagedFields([]metav1.ManagedFieldsEntry{
+		entry("kubectl", metav1.ManagedFieldsOperationApply, "tenancy.kcp.dev/v1beta1", `{"f:metadata":{"f:labels":{"f:team":{}}},"f:spec":{"f:type":{}}}`),
+		entry("kcp", metav1.ManagedFieldsOperationUpdate, "tenancy.kcp.dev/v1beta1", `{"f:status":{"f:URL":{},"f:phase":{}}}`),
+	}, got), "got %v", got)
+}
+
+func TestProjectWorkspaceManagedFields(t *testing.T) {
+	clusterWorkspaceFields := []metav1.ManagedFieldsEntry{
+		entry("kubectl", metav1.ManagedFieldsOperationApply, "tenancy.kcp.dev/v1alpha1", `{"f:metadata":{"f:labels":{"f:team":{}}},"f:spec":{"f:type":{},"f:shard":{}}}`),
+		entry("kcp", metav1.ManagedFieldsOperationUpdate, "tenancy.kcp.dev/v1alpha1", `{"f:status":{"f:baseURL":{},"f:phase":{},"f:conditions":{}}}`),
+		entry("argocd", metav1.ManagedFieldsOperationApply, "tenancy.kcp.dev/v1alpha1", `{"f:metadata":{"f:annotations":{"f:a":{}}}}`),
+	}
+	workspaceFields := []metav1.ManagedFieldsEntry{
+		// kubectl no longer applies the team label, but a tier label
+		entry("kubectl", metav1.ManagedFieldsOperationApply, "tenancy.kcp.dev/v1beta1", `{"f:metadata":{"f:labels":{"f:tier":{}}},"f:spec":{"f:type":{}}}`),
+		entry("kcp", metav1.ManagedFieldsOperationUpdate, "tenancy.kcp.dev/v1beta1", `{"f:status":{"f:URL":{},"f:phase":{}}}`),
+		// argocd dropped its annotation, and a new manager took over
+		entry("flux", metav1.ManagedFieldsOperationApply, "tenancy.kcp.dev/v1beta1", `{"f:metadata":{"f:annotations":{"f:a":{}}}}`),
+	}
+
+	got := ProjectWorkspaceManagedFields(workspaceFields, clusterWorkspaceFields)
+	require.True(t, EqualManagedFields([]metav1.ManagedFieldsEntry{
+		entry("kubectl", metav1.ManagedFieldsOperationApply, "tenancy.kcp.dev/v1alpha1", `{"f:metadata":{"f:labels":{"f:tier":{}}},"f:spec":{"f:type":{},"f:shard":{}}}`),
+		entry("kcp", metav1.ManagedFieldsOperationUpdate, "tenancy.kcp.dev/v1alpha1", `{"f:status":{"f:baseURL":{},"f:phase":{},"f:conditions":{}}}`),
+		entry("flux", metav1.ManagedFieldsOperationApply, "tenancy.kcp.dev/v1alpha1", `{"f:metadata":{"f:annotations":{"f:a":{}}}}`),
+	}, got), "got %v", got)
+
+	// the projection of the result is what the Workspace field manager recorded
+	require.True(t, EqualManagedFields(workspaceFields, projectManagedFields(got)))
+}
@@ -23,7 +23,9 @@ import (
 
 func ProjectClusterWorkspaceToWorkspace(from *v1alpha1.ClusterWorkspace, to *v1beta1.Workspace) {
 	to.ObjectMeta = from.ObjectMeta
+	to.ManagedFields = projectManagedFields(from.ManagedFields)
 	to.Spec.Type = from.Spec.Type
 	to.Status.URL = from.Status.BaseURL
 	to.Status.Phase = from.Status.Phase
+	to.Status.Initializers = from.Status.Initializers
 }
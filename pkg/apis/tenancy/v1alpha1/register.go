@@ -49,6 +49,8 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 		&ClusterWorkspaceList{},
 		&ClusterWorkspaceType{},
 		&ClusterWorkspaceTypeList{},
+		&WorkspaceResourceQuota{},
+		&WorkspaceResourceQuotaList{},
 		&WorkspaceShard{},
 		&WorkspaceShardList{},
 	)
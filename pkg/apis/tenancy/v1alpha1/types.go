@@ -18,6 +18,7 @@ package v1alpha1
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	conditionsv1alpha1 "github.com/kcp-dev/kcp/third_party/conditions/apis/conditions/v1alpha1"
@@ -34,10 +35,15 @@ import (
 // +genclient
 // +genclient:nonNamespaced
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:storageversion
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:scope=Cluster,categories=kcp
 // +kubebuilder:printcolumn:name="Type",type=string,JSONPath=`.spec.type`,description="Type of the workspace"
 // +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`,description="The current phase (e.g. Scheduling, Initializing, Ready)"
+// +kubebuilder:printcolumn:name="URL",type=string,JSONPath=`.status.baseURL`,description="URL to access the workspace"
+// +kubebuilder:printcolumn:name="Initializers",type=string,JSONPath=`.status.initializers`,description="Initializers to clear before the workspace is ready"
+// +kubebuilder:printcolumn:name="Shard",type=string,JSONPath=`.status.location.current`,description="Shard the workspace is scheduled to"
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 type ClusterWorkspace struct {
 	metav1.TypeMeta `json:",inline"`
 	// +optional
@@ -73,15 +79,165 @@ type ClusterWorkspaceSpec struct {
 	// resources and initially installed APIs) and during runtime (e.g. permissions).
 	//
 	// The type is a reference to a ClusterWorkspaceType in the same workspace
-	// with the same name, but lower-cased. The ClusterWorkspaceType existence is
+	// with the same name, but lower-cased, or to a type of an ancestor workspace
+	// published for use in this workspace. The ClusterWorkspaceType existence is
 	// validated at admission during creation, with the exception of the
 	// "Universal" type whose existence is not required but respected if it exists.
 	// The type is immutable after creation. The use of a type is gated via
-	// the RBAC clusterworkspacetypes/use resource permission.
+	// the RBAC clusterworkspacetypes/use resource permission, or the publishing
+	// of a type of an ancestor workspace.
 	//
 	// +optional
 	// +kubebuilder:default:="Universal"
 	Type string `json:"type,omitempty"`
+
+	// authentication configures an external identity provider trusted for
+	// requests to this workspace. It can only be set on organization workspaces,
+	// i.e. on ClusterWorkspaces in the root workspace, and then applies to the
+	// organization and all of the workspaces within it.
+	//
+	// +optional
+	Authentication *ClusterWorkspaceAuthentication `json:"authentication,omitempty"`
+
+	// quota limits the resources of the logical cluster of the workspace.
+	//
+	// +optional
+	Quota *ClusterWorkspaceQuota `json:"quota,omitempty"`
+
+	// placement constrains the WorkspaceShards the workspace is scheduled to, on
+	// top of the placement of its type. It is immutable once the workspace is
+	// scheduled.
+	//
+	// +optional
+	Placement *ClusterWorkspacePlacement `json:"placement,omitempty"`
+}
+
+// ClusterWorkspacePlacement constrains the WorkspaceShards a workspace is scheduled to
+// by their labels, e.g. by the topology.kubernetes.io/region and topology.kubernetes.io/zone
+// labels to keep the data of a workspace in a region.
+type ClusterWorkspacePlacement struct {
+	// required selects the shards the workspace can be scheduled to. The workspace
+	// stays unschedulable as long as no valid shard matches.
+	//
+	// +optional
+	Required *metav1.LabelSelector `json:"required,omitempty"`
+
+	// preferred are the shards the workspace is preferably scheduled to. Among the
+	// shards the workspace can be scheduled to, it is scheduled to one of those with
+	// the highest sum of weights of the matching terms.
+	//
+	// +optional
+	Preferred []PreferredShardSelector `json:"preferred,omitempty"`
+}
+
+// PreferredShardSelector is a weighted selector of WorkspaceShards.
+type PreferredShardSelector struct {
+	// weight is added to the score of the shards matching the selector.
+	//
+	// +required
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	Weight int32 `json:"weight"`
+
+	// selector selects the preferred shards.
+	//
+	// +required
+	// +kubebuilder:validation:Required
+	Selector metav1.LabelSelector `json:"selector"`
+}
+
+// ClusterWorkspaceAuthentication configures an external identity provider of a
+// workspace. Exactly one of the fields must be set.
+type ClusterWorkspaceAuthentication struct {
+	// oidc configures an OpenID Connect issuer whose ID tokens are accepted as
+	// bearer tokens.
+	//
+	// +optional
+	OIDC *OIDCAuthentication `json:"oidc,omitempty"`
+
+	// webhook configures a webhook that bearer tokens are sent to as TokenReviews.
+	//
+	// +optional
+	Webhook *WebhookAuthentication `json:"webhook,omitempty"`
+}
+
+// OIDCAuthentication configures an OpenID Connect issuer.
+type OIDCAuthentication struct {
+	// issuerURL is the URL of the OpenID issuer. Only the https scheme is accepted.
+	//
+	// +required
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^https://`
+	IssuerURL string `json:"issuerURL"`
+
+	// clientID is the client ID for the OpenID Connect client. ID tokens must be
+	// issued for this audience.
+	//
+	// +required
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	ClientID string `json:"clientID"`
+
+	// caBundle is a PEM encoded CA bundle used to validate the certificate of the
+	// issuer. If unset, the system trust roots are used.
+	//
+	// +optional
+	CABundle []byte `json:"caBundle,omitempty"`
+
+	// usernameClaim is the ID token claim to use as the user name.
+	//
+	// +optional
+	// +kubebuilder:default:="sub"
+	UsernameClaim string `json:"usernameClaim,omitempty"`
+
+	// usernamePrefix is prepended to user names to prevent clashes with other
+	// authentication strategies.
+	//
+	// +optional
+	UsernamePrefix string `json:"usernamePrefix,omitempty"`
+
+	// groupsClaim is the ID token claim to use as the user's groups. The claim
+	// value must be a string or an array of strings.
+	//
+	// +optional
+	GroupsClaim string `json:"groupsClaim,omitempty"`
+
+	// groupsPrefix is prepended to group names to prevent clashes with other
+	// authentication strategies.
+	//
+	// +optional
+	GroupsPrefix string `json:"groupsPrefix,omitempty"`
+}
+
+// WebhookAuthentication configures a token review webhook.
+type WebhookAuthentication struct {
+	// url is the https URL TokenReviews are posted to.
+	//
+	// +required
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^https://`
+	URL string `json:"url"`
+
+	// caBundle is a PEM encoded CA bundle used to validate the certificate of the
+	// webhook. If unset, the system trust roots are used.
+	//
+	// +optional
+	CABundle []byte `json:"caBundle,omitempty"`
+}
+
+// ClusterWorkspaceQuota limits the resources of the logical cluster of a workspace.
+type ClusterWorkspaceQuota struct {
+	// objectCount limits the number of objects per resource, across all the namespaces
+	// of the workspace. The keys are resources of the form <resource>[.<group>], e.g.
+	// "configmaps" or "deployments.apps". Only namespaced resources are limited.
+	//
+	// Creations are rejected once the limit is reached. The limits are enforced
+	// against eventually consistent counts, i.e. concurrent creations can exceed
+	// them by a few objects.
+	//
+	// +optional
+	ObjectCount map[string]int64 `json:"objectCount,omitempty"`
 }
 
 // ClusterWorkspaceType specifies behaviour of workspaces of this type.
@@ -90,7 +246,10 @@ type ClusterWorkspaceSpec struct {
 // +genclient
 // +genclient:nonNamespaced
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:storageversion
 // +kubebuilder:resource:scope=Cluster,categories=kcp
+// +kubebuilder:printcolumn:name="Initializers",type=string,JSONPath=`.spec.initializers`,description="Initializers set on the workspaces of this type"
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 type ClusterWorkspaceType struct {
 	metav1.TypeMeta `json:",inline"`
 	// +optional
@@ -107,6 +266,46 @@ type ClusterWorkspaceTypeSpec struct {
 	//
 	// +optional
 	Initializers []ClusterWorkspaceInitializer `json:"initializers,omitempty"`
+
+	// allowedWorkspaces publishes the type for use by ClusterWorkspaces created in
+	// descendant workspaces, given as logical cluster names, e.g. "root:acme".
+	// "*" publishes the type to all descendant workspaces. Without publishing, a
+	// type can only be used in the workspace it is defined in.
+	//
+	// +optional
+	AllowedWorkspaces []string `json:"allowedWorkspaces,omitempty"`
+
+	// allowedGroups publishes the type for use by members of the given groups
+	// in all descendant workspaces.
+	//
+	// +optional
+	AllowedGroups []string `json:"allowedGroups,omitempty"`
+
+	// placement constrains the WorkspaceShards the workspaces of this type are
+	// scheduled to. The required placement of a workspace must be satisfied along
+	// with the one of its type, and the preferred placements of both are scored
+	// together.
+	//
+	// +optional
+	Placement *ClusterWorkspacePlacement `json:"placement,omitempty"`
+
+	// protectedNamespaces are reserved in the workspaces of this type, in addition
+	// to kcp-system. They cannot be deleted, unless the workspace is deleted, and
+	// only system identities can create, update or delete them and the objects
+	// they contain.
+	//
+	// +optional
+	// +listType=set
+	ProtectedNamespaces []string `json:"protectedNamespaces,omitempty"`
+
+	// additionalPrinterColumns are printed by the workspaces virtual workspace, after
+	// the built-in columns, when listing workspaces of this type. The JSONPaths are
+	// evaluated against the Workspace objects, e.g. `.metadata.labels.environment`.
+	//
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	AdditionalPrinterColumns []apiextensionsv1.CustomResourceColumnDefinition `json:"additionalPrinterColumns,omitempty"`
 }
 
 // ClusterWorkspaceTypeList is a list of cluster workspace types
@@ -163,6 +362,27 @@ type ClusterWorkspaceStatus struct {
 	//
 	// +optional
 	Initializers []ClusterWorkspaceInitializer `json:"initializers,omitempty"`
+
+	// usage is the storage usage of the logical cluster of the workspace, as
+	// periodically measured from the storage of kcp.
+	//
+	// +optional
+	Usage *ClusterWorkspaceUsage `json:"usage,omitempty"`
+}
+
+// ClusterWorkspaceUsage is the storage usage of the logical cluster of a workspace,
+// excluding the nested workspaces.
+type ClusterWorkspaceUsage struct {
+	// objectCount is the number of objects stored in the logical cluster.
+	ObjectCount int64 `json:"objectCount"`
+
+	// storageBytes is the approximate number of bytes used in storage by the
+	// objects of the logical cluster, counting their keys and encoded values.
+	StorageBytes int64 `json:"storageBytes"`
+
+	// lastUpdateTime is the time the current values were measured. The usage
+	// is only updated when it changes.
+	LastUpdateTime metav1.Time `json:"lastUpdateTime"`
 }
 
 // These are valid conditions of workspace.
@@ -175,6 +395,9 @@ const (
 	// WorkspaceReasonReasonUnknown reason in WorkspaceScheduled means that scheduler has failed for
 	// some unexpected reason.
 	WorkspaceReasonReasonUnknown = "Unknown"
+	// WorkspaceReasonPlacementUnsatisfiable reason in WorkspaceScheduled WorkspaceCondition means that no
+	// valid shard satisfies the required placement of the workspace and of its type.
+	WorkspaceReasonPlacementUnsatisfiable = "PlacementUnsatisfiable"
 
 	// WorkspaceShardValid represents status of the connection process for this workspace.
 	WorkspaceShardValid conditionsv1alpha1.ConditionType = "WorkspaceShardValid"
@@ -190,6 +413,53 @@ const (
 	// WorkspaceShardValidReasonMissingConnectionInfo reason in WorkspaceShardValid condition means that the
 	// referenced WorkspaceShard object lacks connection info.
 	WorkspaceShardValidReasonMissingConnectionInfo = "MissingConnectionInfo"
+	// WorkspaceShardValidReasonUnhealthy reason in WorkspaceShardValid condition means that the
+	// referenced WorkspaceShard is unhealthy or missed its heartbeats.
+	WorkspaceShardValidReasonUnhealthy = "ShardUnhealthy"
+	// WorkspaceShardValidReasonEtcdConflict reason in WorkspaceShardValid condition means that the
+	// etcd of the shard is shared with another shard using an overlapping key prefix.
+	WorkspaceShardValidReasonEtcdConflict = "ShardEtcdConflict"
+
+	// WorkspaceContentDeleted represents the status of the deletion of the child workspaces
+	// and of the content of the logical cluster of a deleted workspace.
+	WorkspaceContentDeleted conditionsv1alpha1.ConditionType = "WorkspaceContentDeleted"
+	// WorkspaceContentDeletedReasonDeletingWorkspaces reason in WorkspaceContentDeleted condition means
+	// that the child workspaces of the workspace are being deleted.
+	WorkspaceContentDeletedReasonDeletingWorkspaces = "DeletingWorkspaces"
+	// WorkspaceContentDeletedReasonDeletingContent reason in WorkspaceContentDeleted condition means
+	// that the objects of the logical cluster of the workspace are being deleted.
+	WorkspaceContentDeletedReasonDeletingContent = "DeletingContent"
+	// WorkspaceContentDeletedReasonDeletionFailed reason in WorkspaceContentDeleted condition means
+	// that objects of the logical cluster of the workspace could not be deleted.
+	WorkspaceContentDeletedReasonDeletionFailed = "DeletionFailed"
+	// WorkspaceContentDeletedReasonRetained reason in WorkspaceContentDeleted condition means
+	// that the child workspaces and the content of the workspace are retained until the end
+	// of its retention period.
+	WorkspaceContentDeletedReasonRetained = "Retained"
+
+	// WorkspaceTypeBootstrapped represents the status of the bootstrapping of the resources
+	// of the type of the workspace, e.g. its CRDs and APIBindings, by the initializer of the type.
+	WorkspaceTypeBootstrapped conditionsv1alpha1.ConditionType = "WorkspaceTypeBootstrapped"
+	// WorkspaceTypeBootstrappedReasonBootstrapFailed reason in WorkspaceTypeBootstrapped condition
+	// means that the resources of the type of the workspace could not be bootstrapped.
+	WorkspaceTypeBootstrappedReasonBootstrapFailed = "BootstrapFailed"
+)
+
+// ClusterWorkspaceDeletionFinalizer is the finalizer added to every ClusterWorkspace on
+// creation. It is removed once the child workspaces and the content of the logical cluster
+// of a deleted workspace are gone.
+const ClusterWorkspaceDeletionFinalizer = "tenancy.kcp.dev/workspace-deletion"
+
+const (
+	// ClusterWorkspacePurgeableLabel is set to "true" on deleted ClusterWorkspaces the child
+	// workspaces and content of which are retained, and can be purged early.
+	ClusterWorkspacePurgeableLabel = "tenancy.kcp.dev/purgeable"
+	// ClusterWorkspacePurgeAfterAnnotation holds the end of the retention period of a
+	// purgeable ClusterWorkspace, in RFC 3339 format.
+	ClusterWorkspacePurgeAfterAnnotation = "tenancy.kcp.dev/purge-after"
+	// ClusterWorkspacePurgeAnnotation set to "true" on a deleted ClusterWorkspace purges its
+	// child workspaces and content without waiting for the end of its retention period.
+	ClusterWorkspacePurgeAnnotation = "tenancy.kcp.dev/purge"
 )
 
 // ClusterWorkspaceLocation specifies workspace placement information, including current, desired (target), and
@@ -248,6 +518,10 @@ type ClusterWorkspaceList struct {
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:scope=Cluster,categories=kcp
+// +kubebuilder:printcolumn:name="URL",type=string,JSONPath=`.status.connectionInfo.host`,description="URL of the shard"
+// +kubebuilder:printcolumn:name="Version",type=string,JSONPath=`.status.version`,description="Version of kcp running on the shard"
+// +kubebuilder:printcolumn:name="Workspaces",type=integer,JSONPath=`.status.workspaceCount`,description="Number of workspaces on the shard"
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 type WorkspaceShard struct {
 	metav1.TypeMeta `json:",inline"`
 	// +optional
@@ -294,6 +568,35 @@ type WorkspaceShardStatus struct {
 	// Version of credentials last successfully loaded.
 	// +optional
 	CredentialsHash string `json:"credentialsHash,omitempty"`
+
+	// version is the version of kcp running on the shard, as registered by the shard.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// workspaceCount is the number of ClusterWorkspaces stored on the shard, as registered
+	// by the shard. Workspaces are not scheduled to the shard once it reaches the
+	// "workspaces" capacity.
+	// +optional
+	WorkspaceCount int64 `json:"workspaceCount,omitempty"`
+
+	// lastHeartbeatTime is the time the shard last registered its status. Workspaces are
+	// not scheduled to a shard missing its heartbeats.
+	// +optional
+	LastHeartbeatTime *metav1.Time `json:"lastHeartbeatTime,omitempty"`
+
+	// etcd is the etcd the shard stores its objects in, as registered by the shard. It is
+	// not set for shards running an embedded etcd.
+	// +optional
+	Etcd *WorkspaceShardEtcd `json:"etcd,omitempty"`
+}
+
+// WorkspaceShardEtcd describes the etcd of a shard, without its credentials.
+type WorkspaceShardEtcd struct {
+	// endpoints are the client URLs of the etcd members.
+	Endpoints []string `json:"endpoints"`
+	// prefix is the prefix of the keys of the shard. Shards sharing an etcd member
+	// must have prefixes that are not prefixes of one another.
+	Prefix string `json:"prefix"`
 }
 
 // ConnectionInfo holds the information necessary to connect to a shard.
@@ -320,6 +623,22 @@ const (
 	// WorkspaceShardCredentialsReasonInvalid reason in WorkspaceShardCredentialsValid condition means that the
 	// credentials referenced in the WorkspaceShard did not contain valid data in the correct key.
 	WorkspaceShardCredentialsReasonInvalid = "Invalid"
+
+	// WorkspaceShardHealthy represents the health of the shard and its storage, as registered by the shard.
+	WorkspaceShardHealthy conditionsv1alpha1.ConditionType = "WorkspaceShardHealthy"
+	// WorkspaceShardHealthyReasonEtcdUnhealthy reason in WorkspaceShardHealthy condition means that the
+	// shard failed to reach its etcd.
+	WorkspaceShardHealthyReasonEtcdUnhealthy = "EtcdUnhealthy"
+
+	// WorkspaceShardEtcdValid represents whether the etcd of this workspace shard can be used
+	// without overwriting the objects of other shards.
+	WorkspaceShardEtcdValid conditionsv1alpha1.ConditionType = "WorkspaceShardEtcdValid"
+	// WorkspaceShardEtcdReasonPrefixConflict reason in WorkspaceShardEtcdValid condition means that
+	// another shard uses an etcd member of the shard with an overlapping key prefix.
+	WorkspaceShardEtcdReasonPrefixConflict = "EtcdPrefixConflict"
+
+	// WorkspaceShardWorkspacesCapacity is the capacity of a shard in number of workspaces.
+	WorkspaceShardWorkspacesCapacity corev1.ResourceName = "workspaces"
 )
 
 // WorkspaceShardList is a list of workspace shards
@@ -331,3 +650,94 @@ type WorkspaceShardList struct {
 
 	Items []WorkspaceShard `json:"items"`
 }
+
+// WorkspaceResourceQuota limits the number of objects in the logical clusters of the
+// child workspaces of the workspace it is created in, e.g. of the workspaces of an
+// organization. As it lives in the parent workspace, it is managed by the admins of the
+// parent workspace and cannot be changed from within the limited workspaces.
+//
+// +crd
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster,categories=kcp
+type WorkspaceResourceQuota struct {
+	metav1.TypeMeta `json:",inline"`
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// +optional
+	Spec WorkspaceResourceQuotaSpec `json:"spec,omitempty"`
+
+	// +optional
+	Status WorkspaceResourceQuotaStatus `json:"status,omitempty"`
+}
+
+// WorkspaceResourceQuotaSpec holds the limits of a WorkspaceResourceQuota.
+type WorkspaceResourceQuotaSpec struct {
+	// workspaces are the names of the child workspaces the quota applies to. If empty,
+	// the quota applies to all the child workspaces.
+	//
+	// The limits of the quotas naming a workspace override the limits of the same
+	// resources of the quotas applying to all the child workspaces. If several quotas
+	// of the same kind limit a resource, the lowest limit applies.
+	//
+	// +optional
+	Workspaces []string `json:"workspaces,omitempty"`
+
+	// objectCount limits the number of objects per resource, across all the namespaces
+	// of a workspace. The keys are resources of the form <resource>[.<group>], e.g.
+	// "configmaps" or "deployments.apps". Only namespaced resources are limited.
+	//
+	// +optional
+	ObjectCount map[string]int64 `json:"objectCount,omitempty"`
+
+	// totalObjectCount limits the number of objects of all the namespaced resources of
+	// a workspace.
+	//
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	TotalObjectCount *int64 `json:"totalObjectCount,omitempty"`
+}
+
+// WorkspaceResourceQuotaStatus communicates the usage of the limits of a WorkspaceResourceQuota.
+type WorkspaceResourceQuotaStatus struct {
+	// workspaces holds the usage of the workspaces the quota applies to, for the limits
+	// of the quota in effect for them, i.e. not overridden by other quotas.
+	//
+	// +optional
+	Workspaces []WorkspaceResourceQuotaUsage `json:"workspaces,omitempty"`
+
+	// lastUpdateTime is the time the usage was last measured.
+	//
+	// +optional
+	LastUpdateTime *metav1.Time `json:"lastUpdateTime,omitempty"`
+}
+
+// WorkspaceResourceQuotaUsage is the usage of a workspace limited by a WorkspaceResourceQuota.
+type WorkspaceResourceQuotaUsage struct {
+	// name is the name of the child workspace.
+	Name string `json:"name"`
+
+	// objectCount is the number of objects of the resources limited by the quota.
+	//
+	// +optional
+	ObjectCount map[string]int64 `json:"objectCount,omitempty"`
+
+	// totalObjectCount is the number of objects of all the namespaced resources, if
+	// limited by the quota.
+	//
+	// +optional
+	TotalObjectCount *int64 `json:"totalObjectCount,omitempty"`
+}
+
+// WorkspaceResourceQuotaList is a list of WorkspaceResourceQuotas
+//
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type WorkspaceResourceQuotaList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []WorkspaceResourceQuota `json:"items"`
+}
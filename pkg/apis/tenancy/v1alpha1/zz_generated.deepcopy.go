@@ -23,6 +23,8 @@ package v1alpha1
 
 import (
 	v1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 
 	conditionsv1alpha1 "github.com/kcp-dev/kcp/third_party/conditions/apis/conditions/v1alpha1"
@@ -33,7 +35,7 @@ func (in *ClusterWorkspace) DeepCopyInto(out *ClusterWorkspace) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 	return
 }
@@ -56,6 +58,32 @@ func (in *ClusterWorkspace) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterWorkspaceAuthentication) DeepCopyInto(out *ClusterWorkspaceAuthentication) {
+	*out = *in
+	if in.OIDC != nil {
+		in, out := &in.OIDC, &out.OIDC
+		*out = new(OIDCAuthentication)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Webhook != nil {
+		in, out := &in.Webhook, &out.Webhook
+		*out = new(WebhookAuthentication)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterWorkspaceAuthentication.
+func (in *ClusterWorkspaceAuthentication) DeepCopy() *ClusterWorkspaceAuthentication {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterWorkspaceAuthentication)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterWorkspaceList) DeepCopyInto(out *ClusterWorkspaceList) {
 	*out = *in
@@ -110,9 +138,75 @@ func (in *ClusterWorkspaceLocation) DeepCopy() *ClusterWorkspaceLocation {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterWorkspacePlacement) DeepCopyInto(out *ClusterWorkspacePlacement) {
+	*out = *in
+	if in.Required != nil {
+		in, out := &in.Required, &out.Required
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Preferred != nil {
+		in, out := &in.Preferred, &out.Preferred
+		*out = make([]PreferredShardSelector, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterWorkspacePlacement.
+func (in *ClusterWorkspacePlacement) DeepCopy() *ClusterWorkspacePlacement {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterWorkspacePlacement)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterWorkspaceQuota) DeepCopyInto(out *ClusterWorkspaceQuota) {
+	*out = *in
+	if in.ObjectCount != nil {
+		in, out := &in.ObjectCount, &out.ObjectCount
+		*out = make(map[string]int64, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterWorkspaceQuota.
+func (in *ClusterWorkspaceQuota) DeepCopy() *ClusterWorkspaceQuota {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterWorkspaceQuota)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterWorkspaceSpec) DeepCopyInto(out *ClusterWorkspaceSpec) {
 	*out = *in
+	if in.Authentication != nil {
+		in, out := &in.Authentication, &out.Authentication
+		*out = new(ClusterWorkspaceAuthentication)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Quota != nil {
+		in, out := &in.Quota, &out.Quota
+		*out = new(ClusterWorkspaceQuota)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Placement != nil {
+		in, out := &in.Placement, &out.Placement
+		*out = new(ClusterWorkspacePlacement)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -142,6 +236,11 @@ func (in *ClusterWorkspaceStatus) DeepCopyInto(out *ClusterWorkspaceStatus) {
 		*out = make([]ClusterWorkspaceInitializer, len(*in))
 		copy(*out, *in)
 	}
+	if in.Usage != nil {
+		in, out := &in.Usage, &out.Usage
+		*out = new(ClusterWorkspaceUsage)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -223,6 +322,31 @@ func (in *ClusterWorkspaceTypeSpec) DeepCopyInto(out *ClusterWorkspaceTypeSpec)
 		*out = make([]ClusterWorkspaceInitializer, len(*in))
 		copy(*out, *in)
 	}
+	if in.AllowedWorkspaces != nil {
+		in, out := &in.AllowedWorkspaces, &out.AllowedWorkspaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedGroups != nil {
+		in, out := &in.AllowedGroups, &out.AllowedGroups
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Placement != nil {
+		in, out := &in.Placement, &out.Placement
+		*out = new(ClusterWorkspacePlacement)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ProtectedNamespaces != nil {
+		in, out := &in.ProtectedNamespaces, &out.ProtectedNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AdditionalPrinterColumns != nil {
+		in, out := &in.AdditionalPrinterColumns, &out.AdditionalPrinterColumns
+		*out = make([]apiextensionsv1.CustomResourceColumnDefinition, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -236,6 +360,23 @@ func (in *ClusterWorkspaceTypeSpec) DeepCopy() *ClusterWorkspaceTypeSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterWorkspaceUsage) DeepCopyInto(out *ClusterWorkspaceUsage) {
+	*out = *in
+	in.LastUpdateTime.DeepCopyInto(&out.LastUpdateTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterWorkspaceUsage.
+func (in *ClusterWorkspaceUsage) DeepCopy() *ClusterWorkspaceUsage {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterWorkspaceUsage)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ConnectionInfo) DeepCopyInto(out *ConnectionInfo) {
 	*out = *in
@@ -252,6 +393,44 @@ func (in *ConnectionInfo) DeepCopy() *ConnectionInfo {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OIDCAuthentication) DeepCopyInto(out *OIDCAuthentication) {
+	*out = *in
+	if in.CABundle != nil {
+		in, out := &in.CABundle, &out.CABundle
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OIDCAuthentication.
+func (in *OIDCAuthentication) DeepCopy() *OIDCAuthentication {
+	if in == nil {
+		return nil
+	}
+	out := new(OIDCAuthentication)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PreferredShardSelector) DeepCopyInto(out *PreferredShardSelector) {
+	*out = *in
+	in.Selector.DeepCopyInto(&out.Selector)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PreferredShardSelector.
+func (in *PreferredShardSelector) DeepCopy() *PreferredShardSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(PreferredShardSelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ShardStatus) DeepCopyInto(out *ShardStatus) {
 	*out = *in
@@ -268,6 +447,176 @@ func (in *ShardStatus) DeepCopy() *ShardStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WebhookAuthentication) DeepCopyInto(out *WebhookAuthentication) {
+	*out = *in
+	if in.CABundle != nil {
+		in, out := &in.CABundle, &out.CABundle
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WebhookAuthentication.
+func (in *WebhookAuthentication) DeepCopy() *WebhookAuthentication {
+	if in == nil {
+		return nil
+	}
+	out := new(WebhookAuthentication)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WorkspaceResourceQuota) DeepCopyInto(out *WorkspaceResourceQuota) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WorkspaceResourceQuota.
+func (in *WorkspaceResourceQuota) DeepCopy() *WorkspaceResourceQuota {
+	if in == nil {
+		return nil
+	}
+	out := new(WorkspaceResourceQuota)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *WorkspaceResourceQuota) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WorkspaceResourceQuotaList) DeepCopyInto(out *WorkspaceResourceQuotaList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]WorkspaceResourceQuota, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WorkspaceResourceQuotaList.
+func (in *WorkspaceResourceQuotaList) DeepCopy() *WorkspaceResourceQuotaList {
+	if in == nil {
+		return nil
+	}
+	out := new(WorkspaceResourceQuotaList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *WorkspaceResourceQuotaList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WorkspaceResourceQuotaSpec) DeepCopyInto(out *WorkspaceResourceQuotaSpec) {
+	*out = *in
+	if in.Workspaces != nil {
+		in, out := &in.Workspaces, &out.Workspaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ObjectCount != nil {
+		in, out := &in.ObjectCount, &out.ObjectCount
+		*out = make(map[string]int64, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.TotalObjectCount != nil {
+		in, out := &in.TotalObjectCount, &out.TotalObjectCount
+		*out = new(int64)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WorkspaceResourceQuotaSpec.
+func (in *WorkspaceResourceQuotaSpec) DeepCopy() *WorkspaceResourceQuotaSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(WorkspaceResourceQuotaSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WorkspaceResourceQuotaStatus) DeepCopyInto(out *WorkspaceResourceQuotaStatus) {
+	*out = *in
+	if in.Workspaces != nil {
+		in, out := &in.Workspaces, &out.Workspaces
+		*out = make([]WorkspaceResourceQuotaUsage, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.LastUpdateTime != nil {
+		in, out := &in.LastUpdateTime, &out.LastUpdateTime
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WorkspaceResourceQuotaStatus.
+func (in *WorkspaceResourceQuotaStatus) DeepCopy() *WorkspaceResourceQuotaStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(WorkspaceResourceQuotaStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WorkspaceResourceQuotaUsage) DeepCopyInto(out *WorkspaceResourceQuotaUsage) {
+	*out = *in
+	if in.ObjectCount != nil {
+		in, out := &in.ObjectCount, &out.ObjectCount
+		*out = make(map[string]int64, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.TotalObjectCount != nil {
+		in, out := &in.TotalObjectCount, &out.TotalObjectCount
+		*out = new(int64)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WorkspaceResourceQuotaUsage.
+func (in *WorkspaceResourceQuotaUsage) DeepCopy() *WorkspaceResourceQuotaUsage {
+	if in == nil {
+		return nil
+	}
+	out := new(WorkspaceResourceQuotaUsage)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *WorkspaceShard) DeepCopyInto(out *WorkspaceShard) {
 	*out = *in
@@ -296,6 +645,27 @@ func (in *WorkspaceShard) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WorkspaceShardEtcd) DeepCopyInto(out *WorkspaceShardEtcd) {
+	*out = *in
+	if in.Endpoints != nil {
+		in, out := &in.Endpoints, &out.Endpoints
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WorkspaceShardEtcd.
+func (in *WorkspaceShardEtcd) DeepCopy() *WorkspaceShardEtcd {
+	if in == nil {
+		return nil
+	}
+	out := new(WorkspaceShardEtcd)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *WorkspaceShardList) DeepCopyInto(out *WorkspaceShardList) {
 	*out = *in
@@ -368,6 +738,15 @@ func (in *WorkspaceShardStatus) DeepCopyInto(out *WorkspaceShardStatus) {
 		*out = new(ConnectionInfo)
 		**out = **in
 	}
+	if in.LastHeartbeatTime != nil {
+		in, out := &in.LastHeartbeatTime, &out.LastHeartbeatTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Etcd != nil {
+		in, out := &in.Etcd, &out.Etcd
+		*out = new(WorkspaceShardEtcd)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -0,0 +1,227 @@
+/*
+Copyright 2021 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/conversion"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+)
+
+// RegisterConversions adds the conversions between the v1alpha1 and the v1beta1
+// ClusterWorkspaces and ClusterWorkspaceTypes to the given scheme.
+func RegisterConversions(s *runtime.Scheme) error {
+	if err := s.AddConversionFunc((*v1alpha1.ClusterWorkspace)(nil), (*ClusterWorkspace)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_ClusterWorkspace_To_v1beta1_ClusterWorkspace(a.(*v1alpha1.ClusterWorkspace), b.(*ClusterWorkspace), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddConversionFunc((*ClusterWorkspace)(nil), (*v1alpha1.ClusterWorkspace)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1beta1_ClusterWorkspace_To_v1alpha1_ClusterWorkspace(a.(*ClusterWorkspace), b.(*v1alpha1.ClusterWorkspace), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddConversionFunc((*v1alpha1.ClusterWorkspaceList)(nil), (*ClusterWorkspaceList)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_ClusterWorkspaceList_To_v1beta1_ClusterWorkspaceList(a.(*v1alpha1.ClusterWorkspaceList), b.(*ClusterWorkspaceList), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddConversionFunc((*ClusterWorkspaceList)(nil), (*v1alpha1.ClusterWorkspaceList)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1beta1_ClusterWorkspaceList_To_v1alpha1_ClusterWorkspaceList(a.(*ClusterWorkspaceList), b.(*v1alpha1.ClusterWorkspaceList), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddConversionFunc((*v1alpha1.ClusterWorkspaceType)(nil), (*ClusterWorkspaceType)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_ClusterWorkspaceType_To_v1beta1_ClusterWorkspaceType(a.(*v1alpha1.ClusterWorkspaceType), b.(*ClusterWorkspaceType), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddConversionFunc((*ClusterWorkspaceType)(nil), (*v1alpha1.ClusterWorkspaceType)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1beta1_ClusterWorkspaceType_To_v1alpha1_ClusterWorkspaceType(a.(*ClusterWorkspaceType), b.(*v1alpha1.ClusterWorkspaceType), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddConversionFunc((*v1alpha1.ClusterWorkspaceTypeList)(nil), (*ClusterWorkspaceTypeList)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_ClusterWorkspaceTypeList_To_v1beta1_ClusterWorkspaceTypeList(a.(*v1alpha1.ClusterWorkspaceTypeList), b.(*ClusterWorkspaceTypeList), scope)
+	}); err != nil {
+		return err
+	}
+	return s.AddConversionFunc((*ClusterWorkspaceTypeList)(nil), (*v1alpha1.ClusterWorkspaceTypeList)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1beta1_ClusterWorkspaceTypeList_To_v1alpha1_ClusterWorkspaceTypeList(a.(*ClusterWorkspaceTypeList), b.(*v1alpha1.ClusterWorkspaceTypeList), scope)
+	})
+}
+
+func Convert_v1alpha1_ClusterWorkspace_To_v1beta1_ClusterWorkspace(in *v1alpha1.ClusterWorkspace, out *ClusterWorkspace, s conversion.Scope) error {
+	out.ObjectMeta = in.ObjectMeta
+	out.Spec = ClusterWorkspaceSpec{
+		ReadOnly:       in.Spec.ReadOnly,
+		InheritFrom:    in.Spec.InheritFrom,
+		Type:           ClusterWorkspaceTypeReference{Name: in.Spec.Type},
+		Authentication: in.Spec.Authentication,
+		Quota:          in.Spec.Quota,
+		Placement:      in.Spec.Placement,
+	}
+	out.Status = ClusterWorkspaceStatus{
+		Phase:        in.Status.Phase,
+		Conditions:   in.Status.Conditions,
+		URL:          in.Status.BaseURL,
+		Location:     in.Status.Location,
+		Initializers: convertInitializersToV1beta1(in.Status.Initializers),
+		Usage:        in.Status.Usage,
+	}
+	return nil
+}
+
+func Convert_v1beta1_ClusterWorkspace_To_v1alpha1_ClusterWorkspace(in *ClusterWorkspace, out *v1alpha1.ClusterWorkspace, s conversion.Scope) error {
+	out.ObjectMeta = in.ObjectMeta
+	out.Spec = v1alpha1.ClusterWorkspaceSpec{
+		ReadOnly:       in.Spec.ReadOnly,
+		InheritFrom:    in.Spec.InheritFrom,
+		Type:           in.Spec.Type.Name,
+		Authentication: in.Spec.Authentication,
+		Quota:          in.Spec.Quota,
+		Placement:      in.Spec.Placement,
+	}
+	out.Status = v1alpha1.ClusterWorkspaceStatus{
+		Phase:        in.Status.Phase,
+		Conditions:   in.Status.Conditions,
+		BaseURL:      in.Status.URL,
+		Location:     in.Status.Location,
+		Initializers: convertInitializersToV1alpha1(in.Status.Initializers),
+		Usage:        in.Status.Usage,
+	}
+	return nil
+}
+
+func Convert_v1alpha1_ClusterWorkspaceList_To_v1beta1_ClusterWorkspaceList(in *v1alpha1.ClusterWorkspaceList, out *ClusterWorkspaceList, s conversion.Scope) error {
+	out.ListMeta = in.ListMeta
+	out.Items = nil
+	if in.Items != nil {
+		out.Items = make([]ClusterWorkspace, len(in.Items))
+		for i := range in.Items {
+			if err := Convert_v1alpha1_ClusterWorkspace_To_v1beta1_ClusterWorkspace(&in.Items[i], &out.Items[i], s); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func Convert_v1beta1_ClusterWorkspaceList_To_v1alpha1_ClusterWorkspaceList(in *ClusterWorkspaceList, out *v1alpha1.ClusterWorkspaceList, s conversion.Scope) error {
+	out.ListMeta = in.ListMeta
+	out.Items = nil
+	if in.Items != nil {
+		out.Items = make([]v1alpha1.ClusterWorkspace, len(in.Items))
+		for i := range in.Items {
+			if err := Convert_v1beta1_ClusterWorkspace_To_v1alpha1_ClusterWorkspace(&in.Items[i], &out.Items[i], s); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func Convert_v1alpha1_ClusterWorkspaceType_To_v1beta1_ClusterWorkspaceType(in *v1alpha1.ClusterWorkspaceType, out *ClusterWorkspaceType, s conversion.Scope) error {
+	out.ObjectMeta = in.ObjectMeta
+	out.Spec = ClusterWorkspaceTypeSpec{
+		Initializers:             convertInitializersToV1beta1(in.Spec.Initializers),
+		AllowedWorkspaces:        in.Spec.AllowedWorkspaces,
+		AllowedGroups:            in.Spec.AllowedGroups,
+		Placement:                in.Spec.Placement,
+		ProtectedNamespaces:      in.Spec.ProtectedNamespaces,
+		AdditionalPrinterColumns: in.Spec.AdditionalPrinterColumns,
+	}
+	return nil
+}
+
+func Convert_v1beta1_ClusterWorkspaceType_To_v1alpha1_ClusterWorkspaceType(in *ClusterWorkspaceType, out *v1alpha1.ClusterWorkspaceType, s conversion.Scope) error {
+	out.ObjectMeta = in.ObjectMeta
+	out.Spec = v1alpha1.ClusterWorkspaceTypeSpec{
+		Initializers:             convertInitializersToV1alpha1(in.Spec.Initializers),
+		AllowedWorkspaces:        in.Spec.AllowedWorkspaces,
+		AllowedGroups:            in.Spec.AllowedGroups,
+		Placement:                in.Spec.Placement,
+		ProtectedNamespaces:      in.Spec.ProtectedNamespaces,
+		AdditionalPrinterColumns: in.Spec.AdditionalPrinterColumns,
+	}
+	return nil
+}
+
+func Convert_v1alpha1_ClusterWorkspaceTypeList_To_v1beta1_ClusterWorkspaceTypeList(in *v1alpha1.ClusterWorkspaceTypeList, out *ClusterWorkspaceTypeList, s conversion.Scope) error {
+	out.ListMeta = in.ListMeta
+	out.Items = nil
+	if in.Items != nil {
+		out.Items = make([]ClusterWorkspaceType, len(in.Items))
+		for i := range in.Items {
+			if err := Convert_v1alpha1_ClusterWorkspaceType_To_v1beta1_ClusterWorkspaceType(&in.Items[i], &out.Items[i], s); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func Convert_v1beta1_ClusterWorkspaceTypeList_To_v1alpha1_ClusterWorkspaceTypeList(in *ClusterWorkspaceTypeList, out *v1alpha1.ClusterWorkspaceTypeList, s conversion.Scope) error {
+	out.ListMeta = in.ListMeta
+	out.Items = nil
+	if in.Items != nil {
+		out.Items = make([]v1alpha1.ClusterWorkspaceType, len(in.Items))
+		for i := range in.Items {
+			if err := Convert_v1beta1_ClusterWorkspaceType_To_v1alpha1_ClusterWorkspaceType(&in.Items[i], &out.Items[i], s); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// convertInitializersToV1beta1 splits the initializers at their last "/" into a domain
+// and a name. Initializers without a domain, or with a leading "/", are kept as names.
+func convertInitializersToV1beta1(in []v1alpha1.ClusterWorkspaceInitializer) []ClusterWorkspaceInitializer {
+	if in == nil {
+		return nil
+	}
+	out := make([]ClusterWorkspaceInitializer, len(in))
+	for i, initializer := range in {
+		s := string(initializer)
+		if j := strings.LastIndex(s, "/"); j > 0 {
+			out[i] = ClusterWorkspaceInitializer{Domain: s[:j], Name: s[j+1:]}
+		} else {
+			out[i] = ClusterWorkspaceInitializer{Name: s}
+		}
+	}
+	return out
+}
+
+// convertInitializersToV1alpha1 joins the domain and the name of the initializers with a "/".
+func convertInitializersToV1alpha1(in []ClusterWorkspaceInitializer) []v1alpha1.ClusterWorkspaceInitializer {
+	if in == nil {
+		return nil
+	}
+	out := make([]v1alpha1.ClusterWorkspaceInitializer, len(in))
+	for i, initializer := range in {
+		if initializer.Domain == "" {
+			out[i] = v1alpha1.ClusterWorkspaceInitializer(initializer.Name)
+		} else {
+			out[i] = v1alpha1.ClusterWorkspaceInitializer(initializer.Domain + "/" + initializer.Name)
+		}
+	}
+	return out
+}
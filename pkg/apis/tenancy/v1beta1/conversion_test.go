@@ -0,0 +1,163 @@
+/*
+Copyright 2021 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	conditionsv1alpha1 "github.com/kcp-dev/kcp/third_party/conditions/apis/conditions/v1alpha1"
+)
+
+func newScheme(t *testing.T) *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	require.NoError(t, v1alpha1.AddToScheme(scheme))
+	require.NoError(t, AddToScheme(scheme))
+	return scheme
+}
+
+func TestClusterWorkspaceConversion(t *testing.T) {
+	alpha := &v1alpha1.ClusterWorkspace{
+		ObjectMeta: metav1.ObjectMeta{ClusterName: "root:org", Name: "team", Labels: map[string]string{"environment": "prod"}},
+		Spec: v1alpha1.ClusterWorkspaceSpec{
+			ReadOnly:    true,
+			InheritFrom: "parent",
+			Type:        "Team",
+			Quota:       &v1alpha1.ClusterWorkspaceQuota{},
+			Placement:   &v1alpha1.ClusterWorkspacePlacement{Required: &metav1.LabelSelector{MatchLabels: map[string]string{"region": "eu"}}},
+		},
+		Status: v1alpha1.ClusterWorkspaceStatus{
+			Phase:      v1alpha1.ClusterWorkspacePhaseInitializing,
+			Conditions: conditionsv1alpha1.Conditions{{Type: v1alpha1.WorkspaceScheduled, Status: "True"}},
+			BaseURL:    "https://shard/clusters/root:org:team",
+			Location:   v1alpha1.ClusterWorkspaceLocation{Current: "shard"},
+			Initializers: []v1alpha1.ClusterWorkspaceInitializer{
+				"initializers.tenancy.kcp.dev/team",
+				"example.dev/nested/initializer",
+				"plain",
+				"/leading",
+			},
+			Usage: &v1alpha1.ClusterWorkspaceUsage{ObjectCount: 42, StorageBytes: 1024},
+		},
+	}
+	beta := &ClusterWorkspace{
+		ObjectMeta: alpha.ObjectMeta,
+		Spec: ClusterWorkspaceSpec{
+			ReadOnly:    true,
+			InheritFrom: "parent",
+			Type:        ClusterWorkspaceTypeReference{Name: "Team"},
+			Quota:       alpha.Spec.Quota,
+			Placement:   alpha.Spec.Placement,
+		},
+		Status: ClusterWorkspaceStatus{
+			Phase:      v1alpha1.ClusterWorkspacePhaseInitializing,
+			Conditions: alpha.Status.Conditions,
+			URL:        "https://shard/clusters/root:org:team",
+			Location:   alpha.Status.Location,
+			Initializers: []ClusterWorkspaceInitializer{
+				{Domain: "initializers.tenancy.kcp.dev", Name: "team"},
+				{Domain: "example.dev/nested", Name: "initializer"},
+				{Name: "plain"},
+				{Name: "/leading"},
+			},
+			Usage: alpha.Status.Usage,
+		},
+	}
+	scheme := newScheme(t)
+
+	converted := &ClusterWorkspace{}
+	require.NoError(t, scheme.Convert(alpha, converted, nil))
+	require.Equal(t, beta, converted)
+
+	roundTripped := &v1alpha1.ClusterWorkspace{}
+	require.NoError(t, scheme.Convert(converted, roundTripped, nil))
+	require.Equal(t, alpha, roundTripped)
+
+	obj, err := scheme.ConvertToVersion(&v1alpha1.ClusterWorkspaceList{Items: []v1alpha1.ClusterWorkspace{*alpha}}, SchemeGroupVersion)
+	require.NoError(t, err)
+	list, ok := obj.(*ClusterWorkspaceList)
+	require.True(t, ok, "unexpected %T", obj)
+	require.Equal(t, SchemeGroupVersion.WithKind("ClusterWorkspaceList"), list.GroupVersionKind())
+	require.Equal(t, []ClusterWorkspace{*beta}, list.Items)
+
+	obj, err = scheme.ConvertToVersion(list, v1alpha1.SchemeGroupVersion)
+	require.NoError(t, err)
+	require.Equal(t, []v1alpha1.ClusterWorkspace{*alpha}, obj.(*v1alpha1.ClusterWorkspaceList).Items)
+}
+
+func TestClusterWorkspaceTypeConversion(t *testing.T) {
+	beta := &ClusterWorkspaceType{
+		ObjectMeta: metav1.ObjectMeta{ClusterName: "root:org", Name: "team"},
+		Spec: ClusterWorkspaceTypeSpec{
+			Initializers: []ClusterWorkspaceInitializer{
+				{Domain: "initializers.tenancy.kcp.dev", Name: "team"},
+				{Name: "plain"},
+			},
+			AllowedWorkspaces:        []string{"root:org:*"},
+			AllowedGroups:            []string{"team-admins"},
+			Placement:                &v1alpha1.ClusterWorkspacePlacement{Preferred: []v1alpha1.PreferredShardSelector{{Weight: 10}}},
+			ProtectedNamespaces:      []string{"team-system"},
+			AdditionalPrinterColumns: []apiextensionsv1.CustomResourceColumnDefinition{{Name: "Environment", Type: "string", JSONPath: ".metadata.labels.environment"}},
+		},
+	}
+	alpha := &v1alpha1.ClusterWorkspaceType{
+		ObjectMeta: beta.ObjectMeta,
+		Spec: v1alpha1.ClusterWorkspaceTypeSpec{
+			Initializers:             []v1alpha1.ClusterWorkspaceInitializer{"initializers.tenancy.kcp.dev/team", "plain"},
+			AllowedWorkspaces:        beta.Spec.AllowedWorkspaces,
+			AllowedGroups:            beta.Spec.AllowedGroups,
+			Placement:                beta.Spec.Placement,
+			ProtectedNamespaces:      beta.Spec.ProtectedNamespaces,
+			AdditionalPrinterColumns: beta.Spec.AdditionalPrinterColumns,
+		},
+	}
+	scheme := newScheme(t)
+
+	converted := &v1alpha1.ClusterWorkspaceType{}
+	require.NoError(t, scheme.Convert(beta, converted, nil))
+	require.Equal(t, alpha, converted)
+
+	roundTripped := &ClusterWorkspaceType{}
+	require.NoError(t, scheme.Convert(converted, roundTripped, nil))
+	require.Equal(t, beta, roundTripped)
+
+	obj, err := scheme.ConvertToVersion(&ClusterWorkspaceTypeList{Items: []ClusterWorkspaceType{*beta}}, v1alpha1.SchemeGroupVersion)
+	require.NoError(t, err)
+	require.Equal(t, []v1alpha1.ClusterWorkspaceType{*alpha}, obj.(*v1alpha1.ClusterWorkspaceTypeList).Items)
+
+	obj, err = scheme.ConvertToVersion(obj, SchemeGroupVersion)
+	require.NoError(t, err)
+	require.Equal(t, []ClusterWorkspaceType{*beta}, obj.(*ClusterWorkspaceTypeList).Items)
+}
+
+func TestClusterWorkspaceConversionOfEmptyObjects(t *testing.T) {
+	scheme := newScheme(t)
+
+	beta := &ClusterWorkspace{}
+	require.NoError(t, scheme.Convert(&v1alpha1.ClusterWorkspace{}, beta, nil))
+	require.Equal(t, &ClusterWorkspace{}, beta)
+
+	alpha := &v1alpha1.ClusterWorkspaceType{}
+	require.NoError(t, scheme.Convert(&ClusterWorkspaceType{}, alpha, nil))
+	require.Equal(t, &v1alpha1.ClusterWorkspaceType{}, alpha)
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package v1beta1
 
 import (
+	"fmt"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -38,7 +40,7 @@ func Resource(resource string) schema.GroupResource {
 }
 
 var (
-	SchemeBuilder = runtime.NewSchemeBuilder(addKnownTypes)
+	SchemeBuilder = runtime.NewSchemeBuilder(addKnownTypes, RegisterConversions)
 	AddToScheme   = SchemeBuilder.AddToScheme
 )
 
@@ -47,7 +49,18 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(SchemeGroupVersion,
 		&Workspace{},
 		&WorkspaceList{},
+		&ClusterWorkspace{},
+		&ClusterWorkspaceList{},
+		&ClusterWorkspaceType{},
+		&ClusterWorkspaceTypeList{},
 	)
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
-	return nil
+	return scheme.AddFieldLabelConversionFunc(SchemeGroupVersion.WithKind("Workspace"), func(label, value string) (string, string, error) {
+		switch label {
+		case "metadata.name", "spec.type", "status.phase":
+			return label, value, nil
+		default:
+			return "", "", fmt.Errorf("field label not supported: %s", label)
+		}
+	})
 }
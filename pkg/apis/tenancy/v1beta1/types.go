@@ -17,9 +17,11 @@ limitations under the License.
 package v1beta1
 
 import (
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	conditionsv1alpha1 "github.com/kcp-dev/kcp/third_party/conditions/apis/conditions/v1alpha1"
 )
 
 // Workspace defines a generic Kubernetes-cluster-like endpoint, with standard Kubernetes
@@ -38,6 +40,9 @@ import (
 // +kubebuilder:resource:scope=Cluster,categories=kcp
 // +kubebuilder:printcolumn:name="Type",type=string,JSONPath=`.spec.type`,description="Type of the workspace"
 // +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`,description="The current phase (e.g. Scheduling, Initializing, Ready)"
+// +kubebuilder:printcolumn:name="URL",type=string,JSONPath=`.status.URL`,description="URL to access the workspace"
+// +kubebuilder:printcolumn:name="Initializers",type=string,JSONPath=`.status.initializers`,description="Initializers to clear before the workspace is ready"
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 type Workspace struct {
 	metav1.TypeMeta `json:",inline"`
 	// +optional
@@ -78,6 +83,12 @@ type WorkspaceStatus struct {
 
 	// Phase of the workspace (Initializing / Active / Terminating). This field is ALPHA.
 	Phase v1alpha1.ClusterWorkspacePhaseType `json:"phase,omitempty"`
+
+	// initializers must be cleared by a controller before the workspace is ready,
+	// as long as it is in the "Initializing" phase.
+	//
+	// +optional
+	Initializers []v1alpha1.ClusterWorkspaceInitializer `json:"initializers,omitempty"`
 }
 
 // WorkspaceList is a list of Workspaces
@@ -89,3 +100,199 @@ type WorkspaceList struct {
 
 	Items []Workspace `json:"items"`
 }
+
+// ClusterWorkspace is the v1beta1 version of a v1alpha1 ClusterWorkspace. It references
+// its type by a typed reference, exposes its URL like a Workspace, and structures its
+// initializers in a domain and a name. Both versions convert into each other without
+// loss through the scheme.
+//
+// +crd
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster,categories=kcp
+// +kubebuilder:printcolumn:name="Type",type=string,JSONPath=`.spec.type.name`,description="Type of the workspace"
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`,description="The current phase (e.g. Scheduling, Initializing, Ready)"
+// +kubebuilder:printcolumn:name="URL",type=string,JSONPath=`.status.URL`,description="URL to access the workspace"
+// +kubebuilder:printcolumn:name="Shard",type=string,JSONPath=`.status.location.current`,description="Shard the workspace is scheduled to"
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+type ClusterWorkspace struct {
+	metav1.TypeMeta `json:",inline"`
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// +optional
+	Spec ClusterWorkspaceSpec `json:"spec,omitempty"`
+
+	// +optional
+	Status ClusterWorkspaceStatus `json:"status,omitempty"`
+}
+
+// ClusterWorkspaceSpec holds the desired state of the ClusterWorkspace.
+type ClusterWorkspaceSpec struct {
+	// +optional
+	ReadOnly bool `json:"readOnly,omitempty"`
+
+	// +optional
+	InheritFrom string `json:"inheritFrom,omitempty"`
+
+	// type references the ClusterWorkspaceType of the workspace, in the same workspace
+	// or published by an ancestor workspace. It is immutable after creation.
+	//
+	// +optional
+	// +kubebuilder:default:={name:"Universal"}
+	Type ClusterWorkspaceTypeReference `json:"type,omitempty"`
+
+	// authentication configures an external identity provider trusted for
+	// requests to this workspace. It can only be set on organization workspaces.
+	//
+	// +optional
+	Authentication *v1alpha1.ClusterWorkspaceAuthentication `json:"authentication,omitempty"`
+
+	// quota limits the resources of the logical cluster of the workspace.
+	//
+	// +optional
+	Quota *v1alpha1.ClusterWorkspaceQuota `json:"quota,omitempty"`
+
+	// placement constrains the WorkspaceShards the workspace is scheduled to, on
+	// top of the placement of its type.
+	//
+	// +optional
+	Placement *v1alpha1.ClusterWorkspacePlacement `json:"placement,omitempty"`
+}
+
+// ClusterWorkspaceTypeReference references a ClusterWorkspaceType by name.
+type ClusterWorkspaceTypeReference struct {
+	// name of the type, e.g. "Universal". It is matched case-insensitively against
+	// the names of ClusterWorkspaceTypes.
+	//
+	// +required
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+}
+
+// ClusterWorkspaceInitializer references a controller initializing workspaces,
+// e.g. "initializers.tenancy.kcp.dev/team".
+type ClusterWorkspaceInitializer struct {
+	// domain qualifies the name of the initializer, e.g. "initializers.tenancy.kcp.dev".
+	//
+	// +optional
+	Domain string `json:"domain,omitempty"`
+
+	// name of the initializer within its domain. It must not contain a "/".
+	//
+	// +required
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Pattern=`^[^/]+$`
+	Name string `json:"name"`
+}
+
+// ClusterWorkspaceStatus communicates the observed state of the ClusterWorkspace.
+type ClusterWorkspaceStatus struct {
+	// Phase of the workspace (Scheduling / Initializing / Ready)
+	//
+	// +optional
+	Phase v1alpha1.ClusterWorkspacePhaseType `json:"phase,omitempty"`
+
+	// Current processing state of the ClusterWorkspace.
+	//
+	// +optional
+	Conditions conditionsv1alpha1.Conditions `json:"conditions,omitempty"`
+
+	// url is the address under which the workspace can be targeted.
+	//
+	// +optional
+	URL string `json:"URL,omitempty"`
+
+	// Contains workspace placement information.
+	//
+	// +optional
+	Location v1alpha1.ClusterWorkspaceLocation `json:"location,omitempty"`
+
+	// initializers must be cleared by a controller before the workspace is ready,
+	// as long as it is in the "Initializing" phase.
+	//
+	// +optional
+	Initializers []ClusterWorkspaceInitializer `json:"initializers,omitempty"`
+
+	// usage is the storage usage of the logical cluster of the workspace.
+	//
+	// +optional
+	Usage *v1alpha1.ClusterWorkspaceUsage `json:"usage,omitempty"`
+}
+
+// ClusterWorkspaceList is a list of ClusterWorkspace resources
+//
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type ClusterWorkspaceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []ClusterWorkspace `json:"items"`
+}
+
+// ClusterWorkspaceType is the v1beta1 version of a v1alpha1 ClusterWorkspaceType, with
+// structured initializers.
+//
+// +crd
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:resource:scope=Cluster,categories=kcp
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+type ClusterWorkspaceType struct {
+	metav1.TypeMeta `json:",inline"`
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// +optional
+	Spec ClusterWorkspaceTypeSpec `json:"spec,omitempty"`
+}
+
+type ClusterWorkspaceTypeSpec struct {
+	// initializers are set on the ClusterWorkspaces of this type on creation.
+	//
+	// +optional
+	Initializers []ClusterWorkspaceInitializer `json:"initializers,omitempty"`
+
+	// allowedWorkspaces publishes the type for use by ClusterWorkspaces created in
+	// descendant workspaces, given as logical cluster names, e.g. "root:acme".
+	//
+	// +optional
+	AllowedWorkspaces []string `json:"allowedWorkspaces,omitempty"`
+
+	// allowedGroups publishes the type for use by members of the given groups
+	// in all descendant workspaces.
+	//
+	// +optional
+	AllowedGroups []string `json:"allowedGroups,omitempty"`
+
+	// placement constrains the WorkspaceShards the workspaces of this type are
+	// scheduled to.
+	//
+	// +optional
+	Placement *v1alpha1.ClusterWorkspacePlacement `json:"placement,omitempty"`
+
+	// protectedNamespaces are reserved in the workspaces of this type, in addition
+	// to kcp-system.
+	//
+	// +optional
+	// +listType=set
+	ProtectedNamespaces []string `json:"protectedNamespaces,omitempty"`
+
+	// additionalPrinterColumns are printed by the workspaces virtual workspace when
+	// listing workspaces of this type.
+	//
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	AdditionalPrinterColumns []apiextensionsv1.CustomResourceColumnDefinition `json:"additionalPrinterColumns,omitempty"`
+}
+
+// ClusterWorkspaceTypeList is a list of cluster workspace types
+//
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type ClusterWorkspaceTypeList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []ClusterWorkspaceType `json:"items"`
+}
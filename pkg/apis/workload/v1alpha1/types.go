@@ -19,6 +19,7 @@ package v1alpha1
 import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 
 	conditionsv1alpha1 "github.com/kcp-dev/kcp/third_party/conditions/apis/conditions/v1alpha1"
 	"github.com/kcp-dev/kcp/third_party/conditions/util/conditions"
@@ -68,6 +69,64 @@ type WorkloadClusterSpec struct {
 	// will be unassigned from the cluster.
 	// By default, workloads scheduled to the cluster are not evicted.
 	EvictAfter *metav1.Time `json:"evictAfter,omitempty"`
+
+	// SyncedResources restricts the resources the syncer of this cluster is
+	// allowed to sync down and up. By default, all the resources negotiated
+	// with the cluster are synced.
+	// +optional
+	SyncedResources *SyncedResources `json:"syncedResources,omitempty"`
+}
+
+// SyncedResources lists the resources allowed and denied to be synced to a cluster.
+type SyncedResources struct {
+	// Allowed are the only resources synced to the cluster. When empty, all
+	// the resources not denied are synced.
+	// +optional
+	Allowed []GroupVersionResource `json:"allowed,omitempty"`
+
+	// Denied are resources never synced to the cluster, even if allowed.
+	// +optional
+	Denied []GroupVersionResource `json:"denied,omitempty"`
+}
+
+// GroupVersionResource identifies a resource, in all its versions when the
+// version is empty.
+type GroupVersionResource struct {
+	// Group is the API group of the resource, empty for the core group.
+	// +optional
+	Group string `json:"group,omitempty"`
+
+	// Version is the version of the resource. When empty, all the versions
+	// of the resource match.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// Resource is the plural name of the resource.
+	// +kubebuilder:validation:MinLength=1
+	Resource string `json:"resource"`
+}
+
+// Allows returns true if the given resource may be synced. A resource with an
+// empty version stands for all its versions: it is allowed if any of its versions
+// is allowed, and denied only if all its versions are denied.
+func (r *SyncedResources) Allows(gvr schema.GroupVersionResource) bool {
+	if r == nil {
+		return true
+	}
+	for _, denied := range r.Denied {
+		if denied.Group == gvr.Group && denied.Resource == gvr.Resource && (denied.Version == "" || denied.Version == gvr.Version) {
+			return false
+		}
+	}
+	if len(r.Allowed) == 0 {
+		return true
+	}
+	for _, allowed := range r.Allowed {
+		if allowed.Group == gvr.Group && allowed.Resource == gvr.Resource && (allowed.Version == "" || gvr.Version == "" || allowed.Version == gvr.Version) {
+			return true
+		}
+	}
+	return false
 }
 
 // WorkloadClusterStatus communicates the observed state of the WorkloadCluster (from the controller).
@@ -87,6 +146,24 @@ type WorkloadClusterStatus struct {
 
 	// +optional
 	SyncedResources []string `json:"syncedResources,omitempty"`
+
+	// VirtualWorkspaces contains all syncer virtual workspace URLs, one per shard.
+	// +optional
+	VirtualWorkspaces []VirtualWorkspace `json:"virtualWorkspaces,omitempty"`
+
+	// LastSyncerHeartbeatTime is the last time the syncer of this cluster
+	// reported it was alive. The cluster is marked as not ready when no
+	// heartbeat has been received within the configured grace period.
+	// +optional
+	LastSyncerHeartbeatTime *metav1.Time `json:"lastSyncerHeartbeatTime,omitempty"`
+}
+
+// VirtualWorkspace is a URL where a virtual workspace can be reached.
+type VirtualWorkspace struct {
+	// URL is a virtual workspace URL.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Format=uri
+	URL string `json:"url"`
 }
 
 // WorkloadClusterList is a list of WorkloadCluster resources
@@ -130,6 +207,10 @@ const (
 
 	// ErrorStartingAPIImporterReason indicates an error starting the API Importer.
 	ErrorStartingAPIImporterReason = "ErrorStartingAPIImporter"
+
+	// ErrorHeartbeatMissedReason indicates that the syncer has not reported a heartbeat
+	// within the configured grace period.
+	ErrorHeartbeatMissedReason = "ErrorHeartbeat"
 )
 
 func (in *WorkloadCluster) SetConditions(c conditionsv1alpha1.Conditions) {
@@ -183,3 +264,136 @@ type WorkloadClusterCondition struct {
 }
 
 type WorkloadClusterConditions []WorkloadClusterCondition
+
+// Location describes a group of WorkloadClusters of a workspace, e.g. the clusters
+// of a region or cloud provider, selected by their labels. Locations are in turn
+// selected by the labels of the Location object, like region=us-east1, in Placements.
+//
+// +crd
+// +genclient
+// +genclient:nonNamespaced
+// +genclient:noStatus
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:resource:scope=Cluster,categories=kcp
+// +kubebuilder:printcolumn:name="Description",type="string",JSONPath=`.spec.description`,priority=1
+type Location struct {
+	metav1.TypeMeta `json:",inline"`
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec holds the desired state.
+	// +optional
+	Spec LocationSpec `json:"spec,omitempty"`
+}
+
+// LocationSpec holds the desired state of the Location.
+type LocationSpec struct {
+	// description is a human-readable description of the location.
+	//
+	// +optional
+	Description string `json:"description,omitempty"`
+
+	// instanceSelector chooses the WorkloadClusters of the workspace that belong to
+	// this location. An empty selector selects all of them, a missing one none.
+	//
+	// +optional
+	InstanceSelector *metav1.LabelSelector `json:"instanceSelector,omitempty"`
+
+	// storageClasses maps the StorageClasses requested by the PersistentVolumeClaims
+	// of the workspace to the StorageClasses of the WorkloadClusters of this location,
+	// e.g. "fast" to "gp3" on AWS clusters. Claims requesting an unmapped StorageClass
+	// are synced as is, and claims requesting none get the default StorageClass of the
+	// WorkloadCluster.
+	//
+	// +optional
+	StorageClasses map[string]string `json:"storageClasses,omitempty"`
+}
+
+// LocationList is a list of Location resources
+//
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type LocationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []Location `json:"items"`
+}
+
+// Placement is a policy assigning the namespaces of a workspace to the WorkloadClusters
+// of some Locations. A namespace selected by several placements is placed according to
+// the first one by name.
+//
+// +crd
+// +genclient
+// +genclient:nonNamespaced
+// +genclient:noStatus
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:resource:scope=Cluster,categories=kcp
+type Placement struct {
+	metav1.TypeMeta `json:",inline"`
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec holds the desired state.
+	// +optional
+	Spec PlacementSpec `json:"spec,omitempty"`
+}
+
+// PlacementSpec holds the desired state of the Placement.
+type PlacementSpec struct {
+	// namespaceSelector chooses the namespaces this placement applies to. An empty
+	// selector selects all namespaces, a missing one none.
+	//
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// locationSelectors chooses the Locations the selected namespaces can be placed
+	// in. A Location is chosen if its labels match any of the selectors.
+	//
+	// +kubebuilder:validation:MinItems=1
+	LocationSelectors []metav1.LabelSelector `json:"locationSelectors"`
+
+	// numberOfClusters is the number of clusters the selected namespaces are placed
+	// on. The first one is the primary cluster. Every cluster reports the status of
+	// the namespaced objects in an annotation, and their status is the one of the
+	// primary cluster with the replica counts summed over all the clusters.
+	//
+	// +optional
+	// +kubebuilder:default=1
+	// +kubebuilder:validation:Minimum=1
+	NumberOfClusters *int32 `json:"numberOfClusters,omitempty"`
+
+	// spreadConstraints spread the clusters a namespace is placed on over the values
+	// of labels of their Locations, e.g. regions or zones.
+	//
+	// +optional
+	SpreadConstraints []SpreadConstraint `json:"spreadConstraints,omitempty"`
+}
+
+// SpreadConstraint spreads the clusters a namespace is placed on over the domains
+// of a topology, defined by the values of a Location label.
+type SpreadConstraint struct {
+	// topologyKey is the Location label whose values are the domains of the
+	// topology. Clusters whose Location does not have the label are not placed on.
+	//
+	// +kubebuilder:validation:MinLength=1
+	TopologyKey string `json:"topologyKey"`
+
+	// maxSkew is the maximum difference between the number of clusters a namespace
+	// is placed on in any two domains of the topology.
+	//
+	// +optional
+	// +kubebuilder:default=1
+	// +kubebuilder:validation:Minimum=1
+	MaxSkew int32 `json:"maxSkew,omitempty"`
+}
+
+// PlacementList is a list of Placement resources
+//
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type PlacementList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []Placement `json:"items"`
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestSyncedResourcesAllows(t *testing.T) {
+	deployments := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	services := schema.GroupVersionResource{Version: "v1", Resource: "services"}
+
+	for _, tt := range []struct {
+		name            string
+		syncedResources *SyncedResources
+		gvr             schema.GroupVersionResource
+		want            bool
+	}{
+		{name: "unset", gvr: deployments, want: true},
+		{name: "empty", syncedResources: &SyncedResources{}, gvr: deployments, want: true},
+		{
+			name:            "allowed",
+			syncedResources: &SyncedResources{Allowed: []GroupVersionResource{{Group: "apps", Resource: "deployments"}}},
+			gvr:             deployments,
+			want:            true,
+		},
+		{
+			name:            "not allowed",
+			syncedResources: &SyncedResources{Allowed: []GroupVersionResource{{Group: "apps", Resource: "deployments"}}},
+			gvr:             services,
+		},
+		{
+			name:            "other version allowed",
+			syncedResources: &SyncedResources{Allowed: []GroupVersionResource{{Group: "apps", Version: "v1beta1", Resource: "deployments"}}},
+			gvr:             deployments,
+		},
+		{
+			name:            "some version allowed",
+			syncedResources: &SyncedResources{Allowed: []GroupVersionResource{{Group: "apps", Version: "v1", Resource: "deployments"}}},
+			gvr:             deployments.GroupResource().WithVersion(""),
+			want:            true,
+		},
+		{
+			name:            "denied",
+			syncedResources: &SyncedResources{Denied: []GroupVersionResource{{Version: "v1", Resource: "services"}}},
+			gvr:             services,
+		},
+		{
+			name: "denied even if allowed",
+			syncedResources: &SyncedResources{
+				Allowed: []GroupVersionResource{{Resource: "services"}},
+				Denied:  []GroupVersionResource{{Resource: "services"}},
+			},
+			gvr: services,
+		},
+		{
+			name:            "only some versions denied",
+			syncedResources: &SyncedResources{Denied: []GroupVersionResource{{Group: "apps", Version: "v1beta1", Resource: "deployments"}}},
+			gvr:             deployments.GroupResource().WithVersion(""),
+			want:            true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.syncedResources.Allows(tt.gvr); got != tt.want {
+				t.Errorf("Allows(%v) = %v, want %v", tt.gvr, got, tt.want)
+			}
+		})
+	}
+}
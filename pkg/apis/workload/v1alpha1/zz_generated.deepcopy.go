@@ -22,13 +22,274 @@ limitations under the License.
 package v1alpha1
 
 import (
-	v1 "k8s.io/api/core/v1"
+	corev1 "k8s.io/api/core/v1"
 	resource "k8s.io/apimachinery/pkg/api/resource"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 
 	conditionsv1alpha1 "github.com/kcp-dev/kcp/third_party/conditions/apis/conditions/v1alpha1"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GroupVersionResource) DeepCopyInto(out *GroupVersionResource) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GroupVersionResource.
+func (in *GroupVersionResource) DeepCopy() *GroupVersionResource {
+	if in == nil {
+		return nil
+	}
+	out := new(GroupVersionResource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Location) DeepCopyInto(out *Location) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Location.
+func (in *Location) DeepCopy() *Location {
+	if in == nil {
+		return nil
+	}
+	out := new(Location)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *Location) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LocationList) DeepCopyInto(out *LocationList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]Location, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LocationList.
+func (in *LocationList) DeepCopy() *LocationList {
+	if in == nil {
+		return nil
+	}
+	out := new(LocationList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *LocationList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LocationSpec) DeepCopyInto(out *LocationSpec) {
+	*out = *in
+	if in.InstanceSelector != nil {
+		in, out := &in.InstanceSelector, &out.InstanceSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.StorageClasses != nil {
+		in, out := &in.StorageClasses, &out.StorageClasses
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LocationSpec.
+func (in *LocationSpec) DeepCopy() *LocationSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(LocationSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Placement) DeepCopyInto(out *Placement) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Placement.
+func (in *Placement) DeepCopy() *Placement {
+	if in == nil {
+		return nil
+	}
+	out := new(Placement)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *Placement) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlacementList) DeepCopyInto(out *PlacementList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]Placement, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlacementList.
+func (in *PlacementList) DeepCopy() *PlacementList {
+	if in == nil {
+		return nil
+	}
+	out := new(PlacementList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PlacementList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlacementSpec) DeepCopyInto(out *PlacementSpec) {
+	*out = *in
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LocationSelectors != nil {
+		in, out := &in.LocationSelectors, &out.LocationSelectors
+		*out = make([]v1.LabelSelector, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.NumberOfClusters != nil {
+		in, out := &in.NumberOfClusters, &out.NumberOfClusters
+		*out = new(int32)
+		**out = **in
+	}
+	if in.SpreadConstraints != nil {
+		in, out := &in.SpreadConstraints, &out.SpreadConstraints
+		*out = make([]SpreadConstraint, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlacementSpec.
+func (in *PlacementSpec) DeepCopy() *PlacementSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PlacementSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SpreadConstraint) DeepCopyInto(out *SpreadConstraint) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SpreadConstraint.
+func (in *SpreadConstraint) DeepCopy() *SpreadConstraint {
+	if in == nil {
+		return nil
+	}
+	out := new(SpreadConstraint)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SyncedResources) DeepCopyInto(out *SyncedResources) {
+	*out = *in
+	if in.Allowed != nil {
+		in, out := &in.Allowed, &out.Allowed
+		*out = make([]GroupVersionResource, len(*in))
+		copy(*out, *in)
+	}
+	if in.Denied != nil {
+		in, out := &in.Denied, &out.Denied
+		*out = make([]GroupVersionResource, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SyncedResources.
+func (in *SyncedResources) DeepCopy() *SyncedResources {
+	if in == nil {
+		return nil
+	}
+	out := new(SyncedResources)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtualWorkspace) DeepCopyInto(out *VirtualWorkspace) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtualWorkspace.
+func (in *VirtualWorkspace) DeepCopy() *VirtualWorkspace {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtualWorkspace)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *WorkloadCluster) DeepCopyInto(out *WorkloadCluster) {
 	*out = *in
@@ -141,6 +402,11 @@ func (in *WorkloadClusterSpec) DeepCopyInto(out *WorkloadClusterSpec) {
 		in, out := &in.EvictAfter, &out.EvictAfter
 		*out = (*in).DeepCopy()
 	}
+	if in.SyncedResources != nil {
+		in, out := &in.SyncedResources, &out.SyncedResources
+		*out = new(SyncedResources)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -159,10 +425,10 @@ func (in *WorkloadClusterStatus) DeepCopyInto(out *WorkloadClusterStatus) {
 	*out = *in
 	if in.Allocatable != nil {
 		in, out := &in.Allocatable, &out.Allocatable
-		*out = new(v1.ResourceList)
+		*out = new(corev1.ResourceList)
 		if **in != nil {
 			in, out := *in, *out
-			*out = make(map[v1.ResourceName]resource.Quantity, len(*in))
+			*out = make(map[corev1.ResourceName]resource.Quantity, len(*in))
 			for key, val := range *in {
 				(*out)[key] = val.DeepCopy()
 			}
@@ -170,10 +436,10 @@ func (in *WorkloadClusterStatus) DeepCopyInto(out *WorkloadClusterStatus) {
 	}
 	if in.Capacity != nil {
 		in, out := &in.Capacity, &out.Capacity
-		*out = new(v1.ResourceList)
+		*out = new(corev1.ResourceList)
 		if **in != nil {
 			in, out := *in, *out
-			*out = make(map[v1.ResourceName]resource.Quantity, len(*in))
+			*out = make(map[corev1.ResourceName]resource.Quantity, len(*in))
 			for key, val := range *in {
 				(*out)[key] = val.DeepCopy()
 			}
@@ -191,6 +457,15 @@ func (in *WorkloadClusterStatus) DeepCopyInto(out *WorkloadClusterStatus) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.VirtualWorkspaces != nil {
+		in, out := &in.VirtualWorkspaces, &out.VirtualWorkspaces
+		*out = make([]VirtualWorkspace, len(*in))
+		copy(*out, *in)
+	}
+	if in.LastSyncerHeartbeatTime != nil {
+		in, out := &in.LastSyncerHeartbeatTime, &out.LastSyncerHeartbeatTime
+		*out = (*in).DeepCopy()
+	}
 	return
 }
 
@@ -0,0 +1,89 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"net/http"
+	"strings"
+
+	"k8s.io/apiserver/pkg/audit"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/tools/clusters"
+
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+	"github.com/kcp-dev/kcp/pkg/authorization"
+	tenancylisters "github.com/kcp-dev/kcp/pkg/client/listers/tenancy/v1alpha1"
+)
+
+const (
+	// LogicalClusterAnnotationKey is the audit annotation holding the logical cluster
+	// of a request.
+	LogicalClusterAnnotationKey = "audit.kcp.dev/logical-cluster"
+	// WorkspacePathAnnotationKey is the audit annotation holding the full path of the
+	// workspace of a request, starting at the root workspace.
+	WorkspacePathAnnotationKey = "audit.kcp.dev/workspace-path"
+	// ShardAnnotationKey is the audit annotation holding the shard the workspace of a
+	// request is scheduled on. It is not set for the root and system logical clusters.
+	ShardAnnotationKey = "audit.kcp.dev/shard"
+)
+
+// WithWorkspaceAnnotations adds the logical cluster, the workspace path and the shard
+// of every request to its audit event, including the requests rejected by
+// authentication. It must be wrapped by the handler setting the logical cluster of
+// requests, and wrap the handler chain creating audit events.
+func WithWorkspaceAnnotations(handler http.Handler, workspaceLister tenancylisters.ClusterWorkspaceLister) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		cluster := genericapirequest.ClusterFrom(req.Context())
+		if cluster == nil {
+			handler.ServeHTTP(w, req)
+			return
+		}
+
+		// annotations added before the audit event is created are merged into it
+		ctx := audit.WithAuditAnnotations(req.Context())
+		for key, value := range workspaceAnnotations(cluster, workspaceLister) {
+			audit.AddAuditAnnotation(ctx, key, value)
+		}
+		handler.ServeHTTP(w, req.WithContext(ctx))
+	}
+}
+
+func workspaceAnnotations(cluster *genericapirequest.Cluster, workspaceLister tenancylisters.ClusterWorkspaceLister) map[string]string {
+	if cluster.Wildcard {
+		return map[string]string{LogicalClusterAnnotationKey: "*"}
+	}
+
+	annotations := map[string]string{
+		LogicalClusterAnnotationKey: cluster.Name,
+		WorkspacePathAnnotationKey:  authorization.WorkspacePath(cluster.Name),
+	}
+	if cluster.Name == helper.RootCluster || strings.HasPrefix(cluster.Name, helper.LocalSystemClusterPrefix) {
+		return annotations
+	}
+	parentClusterName, err := helper.ParentClusterName(cluster.Name)
+	if err != nil {
+		return annotations
+	}
+	_, workspaceName, err := helper.ParseLogicalClusterName(cluster.Name)
+	if err != nil {
+		return annotations
+	}
+	if workspace, err := workspaceLister.Get(clusters.ToClusterAwareKey(parentClusterName, workspaceName)); err == nil && workspace.Status.Location.Current != "" {
+		annotations[ShardAnnotationKey] = workspace.Status.Location.Current
+	}
+	return annotations
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/tools/cache"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	tenancylisters "github.com/kcp-dev/kcp/pkg/client/listers/tenancy/v1alpha1"
+)
+
+func TestWorkspaceAnnotations(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, ws := range []*tenancyv1alpha1.ClusterWorkspace{
+		{ObjectMeta: metav1.ObjectMeta{ClusterName: "root", Name: "acme"}, Status: tenancyv1alpha1.ClusterWorkspaceStatus{Location: tenancyv1alpha1.ClusterWorkspaceLocation{Current: "shard-1"}}},
+		{ObjectMeta: metav1.ObjectMeta{ClusterName: "root:acme", Name: "team"}, Status: tenancyv1alpha1.ClusterWorkspaceStatus{Location: tenancyv1alpha1.ClusterWorkspaceLocation{Current: "shard-2"}}},
+		{ObjectMeta: metav1.ObjectMeta{ClusterName: "root:acme", Name: "unscheduled"}},
+	} {
+		require.NoError(t, indexer.Add(ws))
+	}
+	lister := tenancylisters.NewClusterWorkspaceLister(indexer)
+
+	for _, tt := range []struct {
+		cluster genericapirequest.Cluster
+		want    map[string]string
+	}{
+		{cluster: genericapirequest.Cluster{Name: "root"}, want: map[string]string{
+			LogicalClusterAnnotationKey: "root",
+			WorkspacePathAnnotationKey:  "root",
+		}},
+		{cluster: genericapirequest.Cluster{Name: "system:admin"}, want: map[string]string{
+			LogicalClusterAnnotationKey: "system:admin",
+			WorkspacePathAnnotationKey:  "system:admin",
+		}},
+		{cluster: genericapirequest.Cluster{Name: "system:admin", Wildcard: true}, want: map[string]string{
+			LogicalClusterAnnotationKey: "*",
+		}},
+		{cluster: genericapirequest.Cluster{Name: "root:acme"}, want: map[string]string{
+			LogicalClusterAnnotationKey: "root:acme",
+			WorkspacePathAnnotationKey:  "root:acme",
+			ShardAnnotationKey:          "shard-1",
+		}},
+		{cluster: genericapirequest.Cluster{Name: "acme:team"}, want: map[string]string{
+			LogicalClusterAnnotationKey: "acme:team",
+			WorkspacePathAnnotationKey:  "root:acme:team",
+			ShardAnnotationKey:          "shard-2",
+		}},
+		{cluster: genericapirequest.Cluster{Name: "acme:unscheduled"}, want: map[string]string{
+			LogicalClusterAnnotationKey: "acme:unscheduled",
+			WorkspacePathAnnotationKey:  "root:acme:unscheduled",
+		}},
+		{cluster: genericapirequest.Cluster{Name: "acme:deleted"}, want: map[string]string{
+			LogicalClusterAnnotationKey: "acme:deleted",
+			WorkspacePathAnnotationKey:  "root:acme:deleted",
+		}},
+	} {
+		t.Run(tt.cluster.Name, func(t *testing.T) {
+			require.Equal(t, tt.want, workspaceAnnotations(&tt.cluster, lister))
+		})
+	}
+}
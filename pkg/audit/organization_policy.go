@@ -0,0 +1,147 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	auditinternal "k8s.io/apiserver/pkg/apis/audit"
+	"k8s.io/apiserver/pkg/audit"
+	"k8s.io/apiserver/pkg/audit/policy"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+
+	"github.com/kcp-dev/kcp/pkg/authentication"
+)
+
+// LoadOrganizationPolicies loads the audit policies of organizations from the given
+// directory, holding one policy file per organization named <organization>.yaml.
+func LoadOrganizationPolicies(dir string) (map[string]audit.PolicyRuleEvaluator, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	evaluators := map[string]audit.PolicyRuleEvaluator{}
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".yaml" {
+			continue
+		}
+		p, err := policy.LoadPolicyFromFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the audit policy of organization %q: %w", strings.TrimSuffix(file.Name(), ".yaml"), err)
+		}
+		evaluators[strings.TrimSuffix(file.Name(), ".yaml")] = policy.NewPolicyRuleEvaluator(p)
+	}
+	return evaluators, nil
+}
+
+// NewOrganizationPolicyBackend returns an audit backend applying the audit policy of
+// the organization of the logical cluster of events, if it has one, before passing
+// them to the delegate. Events are recorded at the level of the server policy, so
+// the policy of an organization can lower the level of its events or drop them, but
+// not raise it. The logical cluster is read from the annotation added by
+// WithWorkspaceAnnotations.
+func NewOrganizationPolicyBackend(delegate audit.Backend, evaluators map[string]audit.PolicyRuleEvaluator) audit.Backend {
+	return &organizationPolicyBackend{
+		Backend:    delegate,
+		evaluators: evaluators,
+	}
+}
+
+type organizationPolicyBackend struct {
+	audit.Backend
+
+	evaluators map[string]audit.PolicyRuleEvaluator
+}
+
+func (b *organizationPolicyBackend) ProcessEvents(events ...*auditinternal.Event) bool {
+	filtered := make([]*auditinternal.Event, 0, len(events))
+	for _, ev := range events {
+		if ev = b.applyOrganizationPolicy(ev); ev != nil {
+			filtered = append(filtered, ev)
+		}
+	}
+	if len(filtered) == 0 {
+		return true
+	}
+	return b.Backend.ProcessEvents(filtered...)
+}
+
+// applyOrganizationPolicy returns the event as audited by the policy of its
+// organization, or nil if it must not be audited.
+func (b *organizationPolicyBackend) applyOrganizationPolicy(ev *auditinternal.Event) *auditinternal.Event {
+	org, ok := authentication.OrganizationName(ev.Annotations[LogicalClusterAnnotationKey])
+	if !ok {
+		return ev
+	}
+	evaluator, ok := b.evaluators[org]
+	if !ok {
+		return ev
+	}
+
+	config := evaluator.EvaluatePolicyRule(eventAttributes(ev))
+	if config.Level == auditinternal.LevelNone {
+		return nil
+	}
+	for _, stage := range config.OmitStages {
+		if ev.Stage == stage {
+			return nil
+		}
+	}
+	if !config.Level.Less(ev.Level) {
+		return ev
+	}
+
+	ev = ev.DeepCopy()
+	ev.Level = config.Level
+	if config.Level.Less(auditinternal.LevelRequest) {
+		ev.RequestObject = nil
+	}
+	if config.Level.Less(auditinternal.LevelRequestResponse) {
+		ev.ResponseObject = nil
+	}
+	return ev
+}
+
+// eventAttributes returns the attributes of the request of an audit event that audit
+// policies are evaluated against.
+func eventAttributes(ev *auditinternal.Event) authorizer.Attributes {
+	attrs := authorizer.AttributesRecord{
+		User: &user.DefaultInfo{
+			Name:   ev.User.Username,
+			Groups: ev.User.Groups,
+		},
+		Verb: ev.Verb,
+	}
+	if u, err := url.ParseRequestURI(ev.RequestURI); err == nil {
+		attrs.Path = u.Path
+	}
+	if ev.ObjectRef != nil {
+		attrs.ResourceRequest = true
+		attrs.Namespace = ev.ObjectRef.Namespace
+		attrs.Name = ev.ObjectRef.Name
+		attrs.APIGroup = ev.ObjectRef.APIGroup
+		attrs.APIVersion = ev.ObjectRef.APIVersion
+		attrs.Resource = ev.ObjectRef.Resource
+		attrs.Subresource = ev.ObjectRef.Subresource
+	}
+	return attrs
+}
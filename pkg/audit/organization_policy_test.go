@@ -0,0 +1,98 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	auditinternal "k8s.io/apiserver/pkg/apis/audit"
+	"k8s.io/apiserver/pkg/audit"
+	"k8s.io/apiserver/pkg/audit/policy"
+)
+
+type fakeBackend struct {
+	audit.Backend
+
+	events []*auditinternal.Event
+}
+
+func (b *fakeBackend) ProcessEvents(events ...*auditinternal.Event) bool {
+	b.events = append(b.events, events...)
+	return true
+}
+
+func TestOrganizationPolicyBackend(t *testing.T) {
+	evaluators := map[string]audit.PolicyRuleEvaluator{
+		"acme": policy.NewPolicyRuleEvaluator(&auditinternal.Policy{
+			OmitStages: []auditinternal.Stage{auditinternal.StageRequestReceived},
+			Rules: []auditinternal.PolicyRule{
+				{Level: auditinternal.LevelNone, Verbs: []string{"watch"}},
+				{Level: auditinternal.LevelMetadata, Resources: []auditinternal.GroupResources{{Resources: []string{"secrets"}}}},
+				{Level: auditinternal.LevelRequestResponse},
+			},
+		}),
+	}
+
+	event := func(cluster, verb, resource string, stage auditinternal.Stage) *auditinternal.Event {
+		return &auditinternal.Event{
+			Level:          auditinternal.LevelRequestResponse,
+			Stage:          stage,
+			Verb:           verb,
+			RequestURI:     "/clusters/" + cluster + "/api/v1/" + resource,
+			ObjectRef:      &auditinternal.ObjectReference{Resource: resource, APIVersion: "v1"},
+			RequestObject:  &runtime.Unknown{Raw: []byte("{}")},
+			ResponseObject: &runtime.Unknown{Raw: []byte("{}")},
+			Annotations:    map[string]string{LogicalClusterAnnotationKey: cluster},
+		}
+	}
+
+	for _, tt := range []struct {
+		name      string
+		event     *auditinternal.Event
+		wantLevel auditinternal.Level
+		dropped   bool
+	}{
+		{name: "no organization", event: event("root", "watch", "configmaps", auditinternal.StageResponseComplete), wantLevel: auditinternal.LevelRequestResponse},
+		{name: "organization without policy", event: event("root:other", "watch", "configmaps", auditinternal.StageResponseComplete), wantLevel: auditinternal.LevelRequestResponse},
+		{name: "dropped by level", event: event("acme:team", "watch", "configmaps", auditinternal.StageResponseComplete), dropped: true},
+		{name: "dropped by stage", event: event("acme:team", "get", "configmaps", auditinternal.StageRequestReceived), dropped: true},
+		{name: "lowered", event: event("root:acme", "get", "secrets", auditinternal.StageResponseComplete), wantLevel: auditinternal.LevelMetadata},
+		{name: "unchanged", event: event("acme:team", "get", "configmaps", auditinternal.StageResponseComplete), wantLevel: auditinternal.LevelRequestResponse},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			delegate := &fakeBackend{}
+			backend := NewOrganizationPolicyBackend(delegate, evaluators)
+			require.True(t, backend.ProcessEvents(tt.event))
+
+			if tt.dropped {
+				require.Empty(t, delegate.events)
+				return
+			}
+			require.Len(t, delegate.events, 1)
+			got := delegate.events[0]
+			require.Equal(t, tt.wantLevel, got.Level)
+			if got.Level.Less(auditinternal.LevelRequest) {
+				require.Nil(t, got.RequestObject)
+				require.Nil(t, got.ResponseObject)
+				require.Equal(t, auditinternal.LevelRequestResponse, tt.event.Level, "original event must not be modified")
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authentication
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+// Subject attributes of client certificates identities can be mapped from.
+const (
+	AttributeCommonName         = "CN"
+	AttributeOrganization       = "O"
+	AttributeOrganizationalUnit = "OU"
+	AttributeSerialNumber       = "SERIALNUMBER"
+	AttributeLocality           = "L"
+	AttributeCountry            = "C"
+)
+
+var attributes = sets.NewString(
+	AttributeCommonName,
+	AttributeOrganization,
+	AttributeOrganizationalUnit,
+	AttributeSerialNumber,
+	AttributeLocality,
+	AttributeCountry,
+)
+
+// ClientCertMapping maps the subject of client certificates to users, such that the
+// identities of an existing PKI can be used with kcp, e.g. by mapping organizational
+// units to kcp groups.
+type ClientCertMapping struct {
+	// UsernameAttribute is the subject attribute the username is taken from.
+	UsernameAttribute string
+	// GroupAttributes are the subject attributes whose values are groups of the user.
+	GroupAttributes []string
+	// GroupMappings map subject attribute values, keyed by <attribute>:<value>, to the groups
+	// they are replaced with, or added as if the attribute is not a group attribute.
+	GroupMappings map[string][]string
+}
+
+// ParseGroupMappings parses group mappings in the format <attribute>:<value>=<group>.
+// Several groups can be mapped from the same attribute value.
+func ParseGroupMappings(settings []string) (map[string][]string, error) {
+	ret := map[string][]string{}
+	for _, setting := range settings {
+		tokens := strings.SplitN(setting, "=", 2)
+		if len(tokens) != 2 || tokens[1] == "" {
+			return nil, fmt.Errorf("invalid client certificate group mapping, expected <attribute>:<value>=<group>: %s", setting)
+		}
+		source := strings.SplitN(tokens[0], ":", 2)
+		if len(source) != 2 || source[1] == "" {
+			return nil, fmt.Errorf("invalid client certificate group mapping, expected <attribute>:<value>=<group>: %s", setting)
+		}
+		if !attributes.Has(source[0]) {
+			return nil, fmt.Errorf("invalid client certificate group mapping %s: attribute must be one of %s", setting, strings.Join(attributes.List(), ", "))
+		}
+		ret[tokens[0]] = append(ret[tokens[0]], tokens[1])
+	}
+	return ret, nil
+}
+
+// Validate validates the attributes of the mapping.
+func (m *ClientCertMapping) Validate() error {
+	if !attributes.Has(m.UsernameAttribute) {
+		return fmt.Errorf("invalid client certificate username attribute %q: must be one of %s", m.UsernameAttribute, strings.Join(attributes.List(), ", "))
+	}
+	for _, attribute := range m.GroupAttributes {
+		if !attributes.Has(attribute) {
+			return fmt.Errorf("invalid client certificate group attribute %q: must be one of %s", attribute, strings.Join(attributes.List(), ", "))
+		}
+	}
+	return nil
+}
+
+// IsDefault returns whether the mapping is the default one of Kubernetes, mapping the
+// common name to the username and the organizations to groups.
+func (m *ClientCertMapping) IsDefault() bool {
+	return m.UsernameAttribute == AttributeCommonName &&
+		len(m.GroupAttributes) == 1 && m.GroupAttributes[0] == AttributeOrganization &&
+		len(m.GroupMappings) == 0
+}
+
+// User maps the subject of the leaf certificate of the given chain to a user, in the
+// system:authenticated group. Certificates without a value for the username attribute are
+// not authenticated.
+func (m *ClientCertMapping) User(chain []*x509.Certificate) (*authenticator.Response, bool, error) {
+	subject := chain[0].Subject
+	names := values(subject, m.UsernameAttribute)
+	if len(names) == 0 || names[0] == "" {
+		return nil, false, nil
+	}
+
+	groupAttributes := sets.NewString(m.GroupAttributes...)
+	groups := []string{user.AllAuthenticated}
+	for _, attribute := range attributes.List() {
+		for _, value := range values(subject, attribute) {
+			if value == "" {
+				continue
+			}
+			if mapped, ok := m.GroupMappings[attribute+":"+value]; ok {
+				groups = append(groups, mapped...)
+			} else if groupAttributes.Has(attribute) {
+				groups = append(groups, value)
+			}
+		}
+	}
+
+	return &authenticator.Response{
+		User: &user.DefaultInfo{
+			Name:   names[0],
+			Groups: sets.NewString(groups...).List(),
+		},
+	}, true, nil
+}
+
+// values returns the values of the given attribute of the given subject.
+func values(subject pkix.Name, attribute string) []string {
+	switch attribute {
+	case AttributeCommonName:
+		return []string{subject.CommonName}
+	case AttributeOrganization:
+		return subject.Organization
+	case AttributeOrganizationalUnit:
+		return subject.OrganizationalUnit
+	case AttributeSerialNumber:
+		return []string{subject.SerialNumber}
+	case AttributeLocality:
+		return subject.Locality
+	case AttributeCountry:
+		return subject.Country
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authentication
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+func TestClientCertMapping(t *testing.T) {
+	groupMappings, err := ParseGroupMappings([]string{
+		"OU:platform=system:kcp:platform-admins",
+		"OU:platform=platform",
+		"C:DE=eu-users",
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string][]string{
+		"OU:platform": {"system:kcp:platform-admins", "platform"},
+		"C:DE":        {"eu-users"},
+	}, groupMappings)
+
+	for _, setting := range []string{"OU:platform", "OU:platform=", "OU=admins", "OU:=admins", "X:platform=admins"} {
+		_, err := ParseGroupMappings([]string{setting})
+		require.Error(t, err, setting)
+	}
+
+	cert := &x509.Certificate{Subject: pkix.Name{
+		CommonName:         "alice",
+		SerialNumber:       "4711",
+		Organization:       []string{"acme"},
+		OrganizationalUnit: []string{"platform", "storage"},
+		Country:            []string{"DE"},
+	}}
+
+	m := &ClientCertMapping{UsernameAttribute: AttributeCommonName, GroupAttributes: []string{AttributeOrganization}}
+	require.True(t, m.IsDefault())
+	resp, ok, err := m.User([]*x509.Certificate{cert})
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, &user.DefaultInfo{Name: "alice", Groups: []string{"acme", user.AllAuthenticated}}, resp.User)
+
+	m = &ClientCertMapping{
+		UsernameAttribute: AttributeSerialNumber,
+		GroupAttributes:   []string{AttributeOrganization, AttributeOrganizationalUnit},
+		GroupMappings:     groupMappings,
+	}
+	require.NoError(t, m.Validate())
+	require.False(t, m.IsDefault())
+	resp, ok, err = m.User([]*x509.Certificate{cert})
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, &user.DefaultInfo{
+		Name:   "4711",
+		Groups: []string{"acme", "eu-users", "platform", "storage", user.AllAuthenticated, "system:kcp:platform-admins"},
+	}, resp.User, "mapped values are replaced by their groups, also for other attributes, and users are authenticated")
+
+	resp, ok, err = m.User([]*x509.Certificate{{Subject: pkix.Name{SerialNumber: "42"}}})
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, &user.DefaultInfo{Name: "42", Groups: []string{user.AllAuthenticated}}, resp.User, "users without groups are authenticated")
+
+	_, ok, err = m.User([]*x509.Certificate{{Subject: pkix.Name{CommonName: "bob"}}})
+	require.NoError(t, err)
+	require.False(t, ok, "certificates without username attribute are not authenticated")
+
+	require.Error(t, (&ClientCertMapping{UsernameAttribute: "EMAIL"}).Validate())
+	require.Error(t, (&ClientCertMapping{UsernameAttribute: AttributeCommonName, GroupAttributes: []string{"DC"}}).Validate())
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authentication
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authentication/user"
+
+	"github.com/kcp-dev/kcp/pkg/authorization/bootstrap"
+)
+
+const (
+	// SyncerClusterExtraKey is the user extra holding the logical cluster a syncer
+	// token is scoped to.
+	SyncerClusterExtraKey = "authentication.kcp.dev/syncer-cluster"
+	// SyncerWorkloadClusterExtraKey is the user extra holding the WorkloadCluster a
+	// syncer token is scoped to.
+	SyncerWorkloadClusterExtraKey = "authentication.kcp.dev/syncer-workload-cluster"
+
+	syncerTokenPrefix = "kcp-syncer."
+)
+
+type syncerTokenClaims struct {
+	Cluster         string `json:"cluster"`
+	WorkloadCluster string `json:"workloadCluster"`
+}
+
+// SyncerTokens issues and authenticates the bearer tokens of syncers, which are
+// scoped to a WorkloadCluster of a logical cluster. Tokens are signed with a key
+// persisted by the server, and stay valid as long as the key does.
+type SyncerTokens struct {
+	key []byte
+}
+
+// NewSyncerTokens returns SyncerTokens signing tokens with the given key.
+func NewSyncerTokens(key []byte) *SyncerTokens {
+	return &SyncerTokens{key: key}
+}
+
+// LoadOrCreateTokenKey reads the key signing tokens from the given file,
+// generating it if it does not exist yet.
+func LoadOrCreateTokenKey(path string) ([]byte, error) {
+	key, err := ioutil.ReadFile(path)
+	if err == nil {
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(path, key, 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// SyncerUserName returns the name of the user authenticated by the token of the
+// syncer of the given WorkloadCluster.
+func SyncerUserName(clusterName, workloadClusterName string) string {
+	return "system:kcp:syncer:" + clusterName + ":" + workloadClusterName
+}
+
+// Token returns the token of the syncer of the given WorkloadCluster.
+func (t *SyncerTokens) Token(clusterName, workloadClusterName string) (string, error) {
+	claims, err := json.Marshal(syncerTokenClaims{Cluster: clusterName, WorkloadCluster: workloadClusterName})
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(claims)
+	return syncerTokenPrefix + payload + "." + base64.RawURLEncoding.EncodeToString(t.sign(payload)), nil
+}
+
+func (t *SyncerTokens) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, t.key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+var _ authenticator.Token = &SyncerTokens{}
+
+// AuthenticateToken authenticates syncer tokens as members of the syncer group,
+// with the logical cluster and WorkloadCluster they are scoped to in their extras.
+// Other tokens are left to the following authenticators.
+func (t *SyncerTokens) AuthenticateToken(ctx context.Context, token string) (*authenticator.Response, bool, error) {
+	if !strings.HasPrefix(token, syncerTokenPrefix) {
+		return nil, false, nil
+	}
+	parts := strings.Split(strings.TrimPrefix(token, syncerTokenPrefix), ".")
+	if len(parts) != 2 {
+		return nil, false, nil
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, t.sign(parts[0])) {
+		return nil, false, nil
+	}
+	claimBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid syncer token payload: %w", err)
+	}
+	var claims syncerTokenClaims
+	if err := json.Unmarshal(claimBytes, &claims); err != nil {
+		return nil, false, fmt.Errorf("invalid syncer token payload: %w", err)
+	}
+	if claims.Cluster == "" || claims.WorkloadCluster == "" {
+		return nil, false, fmt.Errorf("invalid syncer token payload: missing cluster")
+	}
+
+	return &authenticator.Response{
+		User: &user.DefaultInfo{
+			Name:   SyncerUserName(claims.Cluster, claims.WorkloadCluster),
+			Groups: []string{bootstrap.SystemKcpSyncerGroup, user.AllAuthenticated},
+			Extra: map[string][]string{
+				SyncerClusterExtraKey:         {claims.Cluster},
+				SyncerWorkloadClusterExtraKey: {claims.WorkloadCluster},
+			},
+		},
+	}, true, nil
+}
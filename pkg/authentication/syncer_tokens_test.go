@@ -0,0 +1,67 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authentication
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/apiserver/pkg/authentication/user"
+
+	"github.com/kcp-dev/kcp/pkg/authorization/bootstrap"
+)
+
+func TestSyncerTokens(t *testing.T) {
+	tokens := NewSyncerTokens([]byte("key"))
+
+	token, err := tokens.Token("root:acme", "east")
+	require.NoError(t, err)
+
+	resp, ok, err := tokens.AuthenticateToken(context.Background(), token)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, &user.DefaultInfo{
+		Name:   "system:kcp:syncer:root:acme:east",
+		Groups: []string{bootstrap.SystemKcpSyncerGroup, user.AllAuthenticated},
+		Extra: map[string][]string{
+			SyncerClusterExtraKey:         {"root:acme"},
+			SyncerWorkloadClusterExtraKey: {"east"},
+		},
+	}, resp.User)
+
+	for name, token := range map[string]string{
+		"other key":    mustToken(t, NewSyncerTokens([]byte("other")), "root:acme", "east"),
+		"not syncer":   "some-token",
+		"no payload":   syncerTokenPrefix,
+		"tampered":     token[:len(syncerTokenPrefix)] + "x" + token[len(syncerTokenPrefix)+1:],
+		"no signature": token[:strings.LastIndex(token, ".")],
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, ok, _ := tokens.AuthenticateToken(context.Background(), token)
+			require.False(t, ok)
+		})
+	}
+}
+
+func mustToken(t *testing.T, tokens *SyncerTokens, clusterName, workloadClusterName string) string {
+	token, err := tokens.Token(clusterName, workloadClusterName)
+	require.NoError(t, err)
+	return token
+}
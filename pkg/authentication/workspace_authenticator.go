@@ -0,0 +1,351 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authentication
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authentication/request/bearertoken"
+	"k8s.io/apiserver/pkg/authentication/user"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/server/dynamiccertificates"
+	"k8s.io/apiserver/pkg/server/options"
+	"k8s.io/apiserver/plugin/pkg/authenticator/token/oidc"
+	"k8s.io/apiserver/plugin/pkg/authenticator/token/webhook"
+	authenticationv1client "k8s.io/client-go/kubernetes/typed/authentication/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+	tenancyinformers "github.com/kcp-dev/kcp/pkg/client/informers/externalversions/tenancy/v1alpha1"
+	tenancylisters "github.com/kcp-dev/kcp/pkg/client/listers/tenancy/v1alpha1"
+)
+
+// reservedExtraPrefixes are the prefixes of the user extras which are only set by kcp
+// and Kubernetes, e.g. to scope workspace tokens, and are dropped from the users
+// authenticated by the identity providers of organizations.
+var reservedExtraPrefixes = []string{
+	"authentication.kcp.dev/",
+	"authentication.kubernetes.io/",
+}
+
+// OrganizationIdentityPrefix returns the prefix of the names and groups of the users
+// authenticated by the identity provider of the given organization. It is prepended to
+// the prefixes configured on the organization, such that an organization can never
+// authenticate users of the kcp instance or of another organization.
+func OrganizationIdentityPrefix(org string) string {
+	return "org:" + org + ":"
+}
+
+// NewWorkspaceAuthenticator returns a request authenticator that authenticates bearer
+// tokens against the identity provider configured on the organization workspace of
+// the logical cluster a request is targeted at.
+func NewWorkspaceAuthenticator(workspaceInformer tenancyinformers.ClusterWorkspaceInformer, apiAudiences authenticator.Audiences) *WorkspaceAuthenticator {
+	a := &WorkspaceAuthenticator{
+		workspaceLister: workspaceInformer.Lister(),
+		apiAudiences:    apiAudiences,
+		authenticators:  map[string]*organizationAuthenticator{},
+	}
+	workspaceInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: func(obj interface{}) bool {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			ws, ok := obj.(*tenancyv1alpha1.ClusterWorkspace)
+			return ok && ws.ClusterName == helper.RootCluster
+		},
+		Handler: cache.ResourceEventHandlerFuncs{
+			DeleteFunc: func(obj interface{}) {
+				if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+					obj = tombstone.Obj
+				}
+				a.forget(obj.(*tenancyv1alpha1.ClusterWorkspace).Name)
+			},
+		},
+	})
+	return a
+}
+
+type WorkspaceAuthenticator struct {
+	workspaceLister tenancylisters.ClusterWorkspaceLister
+	apiAudiences    authenticator.Audiences
+
+	lock sync.Mutex
+	// authenticators holds the token authenticators per organization, lazily
+	// created, replaced when the configuration changes and dropped when the
+	// organization is deleted.
+	authenticators map[string]*organizationAuthenticator
+}
+
+type organizationAuthenticator struct {
+	config        tenancyv1alpha1.ClusterWorkspaceAuthentication
+	authenticator authenticator.Request
+	close         func()
+}
+
+var _ authenticator.Request = &WorkspaceAuthenticator{}
+
+func (a *WorkspaceAuthenticator) AuthenticateRequest(req *http.Request) (*authenticator.Response, bool, error) {
+	cluster := genericapirequest.ClusterFrom(req.Context())
+	if cluster == nil || cluster.Wildcard {
+		return nil, false, nil
+	}
+	org, ok := OrganizationName(cluster.Name)
+	if !ok {
+		return nil, false, nil
+	}
+
+	ws, err := a.workspaceLister.Get(helper.WorkspaceKey(helper.RootCluster, org))
+	if errors.IsNotFound(err) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	auth, err := a.authenticatorFor(org, ws.Spec.Authentication)
+	if err != nil {
+		return nil, false, err
+	}
+	if auth == nil {
+		return nil, false, nil
+	}
+
+	return auth.AuthenticateRequest(req)
+}
+
+// authenticatorFor returns the cached authenticator for the given organization,
+// or a new one if the configuration has changed since it was created. New
+// authenticators are created without holding the lock, as creating an OIDC
+// authenticator may wait for the discovery of its issuer.
+func (a *WorkspaceAuthenticator) authenticatorFor(org string, config *tenancyv1alpha1.ClusterWorkspaceAuthentication) (authenticator.Request, error) {
+	if auth, found := a.cached(org, config); found {
+		return auth, nil
+	}
+	if config == nil {
+		a.forget(org)
+		return nil, nil
+	}
+
+	created, err := a.newAuthenticator(org, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create authenticator for organization %q: %w", org, err)
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if existing, found := a.authenticators[org]; found {
+		if reflect.DeepEqual(existing.config, *config) {
+			// created concurrently by another request
+			created.close()
+			return existing.authenticator, nil
+		}
+		existing.close()
+	}
+	a.authenticators[org] = created
+	return created.authenticator, nil
+}
+
+// cached returns the cached authenticator of the given organization, if it was
+// created for the given configuration.
+func (a *WorkspaceAuthenticator) cached(org string, config *tenancyv1alpha1.ClusterWorkspaceAuthentication) (authenticator.Request, bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	existing, found := a.authenticators[org]
+	if !found || config == nil || !reflect.DeepEqual(existing.config, *config) {
+		return nil, false
+	}
+	return existing.authenticator, true
+}
+
+// forget closes and drops the cached authenticator of the given organization.
+func (a *WorkspaceAuthenticator) forget(org string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if existing, found := a.authenticators[org]; found {
+		existing.close()
+		delete(a.authenticators, org)
+	}
+}
+
+func (a *WorkspaceAuthenticator) newAuthenticator(org string, config *tenancyv1alpha1.ClusterWorkspaceAuthentication) (*organizationAuthenticator, error) {
+	switch {
+	case config.OIDC != nil:
+		opts := oidc.Options{
+			IssuerURL:      config.OIDC.IssuerURL,
+			ClientID:       config.OIDC.ClientID,
+			UsernameClaim:  config.OIDC.UsernameClaim,
+			UsernamePrefix: config.OIDC.UsernamePrefix,
+			GroupsClaim:    config.OIDC.GroupsClaim,
+			GroupsPrefix:   config.OIDC.GroupsPrefix,
+		}
+		if opts.UsernameClaim == "" {
+			opts.UsernameClaim = "sub"
+		}
+		if len(config.OIDC.CABundle) > 0 {
+			ca, err := dynamiccertificates.NewStaticCAContent("oidc-authenticator", config.OIDC.CABundle)
+			if err != nil {
+				return nil, err
+			}
+			opts.CAContentProvider = ca
+		}
+		tokenAuth, err := oidc.New(opts)
+		if err != nil {
+			return nil, err
+		}
+		return &organizationAuthenticator{
+			config:        *config.DeepCopy(),
+			authenticator: bearertoken.New(organizationTokenAuthenticator(org, authenticator.WrapAudienceAgnosticToken(a.apiAudiences, tokenAuth))),
+			close:         tokenAuth.Close,
+		}, nil
+
+	case config.Webhook != nil:
+		tokenAuth, err := newWebhookTokenAuthenticator(config.Webhook, a.apiAudiences)
+		if err != nil {
+			return nil, err
+		}
+		return &organizationAuthenticator{
+			config:        *config.DeepCopy(),
+			authenticator: bearertoken.New(organizationTokenAuthenticator(org, tokenAuth)),
+			close:         func() {},
+		}, nil
+	}
+
+	return nil, fmt.Errorf("no authenticator configured")
+}
+
+// organizationTokenAuthenticator restricts the users authenticated by the given token
+// authenticator of an organization to identities of that organization.
+func organizationTokenAuthenticator(org string, delegate authenticator.Token) authenticator.Token {
+	return authenticator.TokenFunc(func(ctx context.Context, token string) (*authenticator.Response, bool, error) {
+		resp, ok, err := delegate.AuthenticateToken(ctx, token)
+		if err != nil || !ok {
+			return resp, ok, err
+		}
+		resp.User = organizationUser(org, resp.User)
+		return resp, true, nil
+	})
+}
+
+// organizationUser prefixes the name and the groups of the given user with the identity
+// prefix of the organization. System groups and reserved extras are dropped, as an
+// organization must not grant them, and the user is added to system:authenticated.
+func organizationUser(org string, u user.Info) user.Info {
+	prefix := OrganizationIdentityPrefix(org)
+
+	var groups []string
+	for _, g := range u.GetGroups() {
+		if strings.HasPrefix(g, "system:") {
+			continue
+		}
+		groups = append(groups, prefix+g)
+	}
+	groups = append(groups, user.AllAuthenticated)
+
+	var extra map[string][]string
+	for k, v := range u.GetExtra() {
+		if hasReservedExtraPrefix(k) {
+			continue
+		}
+		if extra == nil {
+			extra = map[string][]string{}
+		}
+		extra[k] = v
+	}
+
+	return &user.DefaultInfo{
+		Name:   prefix + u.GetName(),
+		UID:    u.GetUID(),
+		Groups: groups,
+		Extra:  extra,
+	}
+}
+
+func hasReservedExtraPrefix(key string) bool {
+	for _, prefix := range reservedExtraPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// newWebhookTokenAuthenticator creates a token review webhook authenticator posting
+// TokenReviews to the URL of the given configuration.
+func newWebhookTokenAuthenticator(config *tenancyv1alpha1.WebhookAuthentication, apiAudiences authenticator.Audiences) (authenticator.Token, error) {
+	webhookURL, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, err
+	}
+	restConfig := &rest.Config{
+		Host:            config.URL,
+		TLSClientConfig: rest.TLSClientConfig{CAData: config.CABundle},
+	}
+	restConfig.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &webhookURLRoundTripper{url: webhookURL, delegate: rt}
+	})
+	client, err := authenticationv1client.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return webhook.NewFromInterface(client, apiAudiences, *options.DefaultAuthWebhookRetryBackoff(), 0, webhook.AuthenticatorMetrics{
+		RecordRequestTotal:   func(context.Context, string) {},
+		RecordRequestLatency: func(context.Context, string, float64) {},
+	})
+}
+
+// webhookURLRoundTripper sends requests to the URL of a token review webhook, rather than
+// to the tokenreviews resource of the authentication.k8s.io API under that URL.
+type webhookURLRoundTripper struct {
+	url      *url.URL
+	delegate http.RoundTripper
+}
+
+func (rt *webhookURLRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Path = rt.url.Path
+	req.URL.RawPath = rt.url.RawPath
+	req.URL.RawQuery = rt.url.RawQuery
+	return rt.delegate.RoundTrip(req)
+}
+
+// OrganizationName returns the organization a logical cluster belongs to. It
+// returns false for the root and system logical clusters.
+func OrganizationName(clusterName string) (string, bool) {
+	if strings.HasPrefix(clusterName, helper.LocalSystemClusterPrefix) {
+		return "", false
+	}
+	org, ws, err := helper.ParseLogicalClusterName(clusterName)
+	if err != nil || org == "" {
+		return "", false
+	}
+	if org == helper.RootCluster {
+		return ws, true
+	}
+	return org, true
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authentication
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apiserver/pkg/authentication/user"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	kcpfake "github.com/kcp-dev/kcp/pkg/client/clientset/versioned/fake"
+	kcpinformers "github.com/kcp-dev/kcp/pkg/client/informers/externalversions"
+)
+
+func TestOrganizationName(t *testing.T) {
+	for _, tt := range []struct {
+		clusterName string
+		wantOrg     string
+		wantOK      bool
+	}{
+		{clusterName: "root"},
+		{clusterName: "system:admin"},
+		{clusterName: "root:acme", wantOrg: "acme", wantOK: true},
+		{clusterName: "acme:team", wantOrg: "acme", wantOK: true},
+		{clusterName: "too:many:parts"},
+	} {
+		t.Run(tt.clusterName, func(t *testing.T) {
+			org, ok := OrganizationName(tt.clusterName)
+			if org != tt.wantOrg || ok != tt.wantOK {
+				t.Errorf("OrganizationName(%q) = (%q, %v), want (%q, %v)", tt.clusterName, org, ok, tt.wantOrg, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestWebhookTokenAuthenticatorRestrictsToOrganization(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/authenticate" {
+			http.Error(w, "unexpected path "+r.URL.Path, http.StatusNotFound)
+			return
+		}
+		var review authenticationv1.TokenReview
+		if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		review.Status = authenticationv1.TokenReviewStatus{
+			Authenticated: review.Spec.Token == "valid",
+			User: authenticationv1.UserInfo{
+				Username: "alice",
+				Groups:   []string{"system:masters", "system:kcp:authenticated", "dev"},
+				Extra: map[string]authenticationv1.ExtraValue{
+					WorkspaceTokenClusterExtraKey:           {"root:other"},
+					"authentication.kubernetes.io/pod-name": {"pod"},
+					"acme.com/team":                         {"red"},
+				},
+			},
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(review)
+	}))
+	defer server.Close()
+
+	caBundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	tokenAuth, err := newWebhookTokenAuthenticator(&tenancyv1alpha1.WebhookAuthentication{
+		URL:      server.URL + "/authenticate",
+		CABundle: caBundle,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenAuth = organizationTokenAuthenticator("acme", tokenAuth)
+
+	resp, ok, err := tokenAuth.AuthenticateToken(context.Background(), "valid")
+	if err != nil || !ok {
+		t.Fatalf("expected the token to be authenticated, got ok=%v err=%v", ok, err)
+	}
+	if got, want := resp.User.GetName(), "org:acme:alice"; got != want {
+		t.Errorf("expected user %q, got %q", want, got)
+	}
+	if got, want := resp.User.GetGroups(), []string{"org:acme:dev", user.AllAuthenticated}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected groups %v, got %v", want, got)
+	}
+	if got, want := resp.User.GetExtra(), map[string][]string{"acme.com/team": {"red"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected extra %v, got %v", want, got)
+	}
+
+	if _, ok, _ := tokenAuth.AuthenticateToken(context.Background(), "invalid"); ok {
+		t.Errorf("expected an invalid token not to be authenticated")
+	}
+}
+
+func TestWorkspaceAuthenticatorForgetsDeletedOrganizations(t *testing.T) {
+	config := &tenancyv1alpha1.ClusterWorkspaceAuthentication{
+		Webhook: &tenancyv1alpha1.WebhookAuthentication{URL: "https://idp.acme.com/authenticate"},
+	}
+	org := &tenancyv1alpha1.ClusterWorkspace{
+		ObjectMeta: metav1.ObjectMeta{ClusterName: "root", Name: "acme"},
+		Spec:       tenancyv1alpha1.ClusterWorkspaceSpec{Authentication: config},
+	}
+	client := kcpfake.NewSimpleClientset(org)
+	informers := kcpinformers.NewSharedInformerFactory(client, 0)
+	a := NewWorkspaceAuthenticator(informers.Tenancy().V1alpha1().ClusterWorkspaces(), nil)
+	stop := make(chan struct{})
+	defer close(stop)
+	informers.Start(stop)
+	informers.WaitForCacheSync(stop)
+
+	first, err := a.authenticatorFor("acme", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second, err := a.authenticatorFor("acme", config.DeepCopy()); err != nil || second != first {
+		t.Fatalf("expected the cached authenticator, got err=%v", err)
+	}
+
+	if err := client.TenancyV1alpha1().ClusterWorkspaces().Delete(context.Background(), "acme", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := wait.PollImmediate(10*time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+		a.lock.Lock()
+		defer a.lock.Unlock()
+		_, found := a.authenticators["acme"]
+		return !found, nil
+	}); err != nil {
+		t.Errorf("expected the authenticator of the deleted organization to be dropped: %v", err)
+	}
+}
@@ -0,0 +1,212 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authentication
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/handlers/responsewriters"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/client-go/tools/clusters"
+
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy"
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+	"github.com/kcp-dev/kcp/pkg/authorization/bootstrap"
+	tenancylisters "github.com/kcp-dev/kcp/pkg/client/listers/tenancy/v1alpha1"
+)
+
+const (
+	// KubeconfigSubresource is the subresource of ClusterWorkspaces serving kubeconfigs
+	// with a workspace token scoped to their logical cluster.
+	KubeconfigSubresource = "kubeconfig"
+
+	// DefaultWorkspaceTokenExpiration is the lifetime of workspace tokens when the
+	// expiration query parameter is not set.
+	DefaultWorkspaceTokenExpiration = time.Hour
+)
+
+// WorkspaceKubeconfigHandler serves kubeconfigs with a workspace token scoped to the
+// logical cluster of a ClusterWorkspace.
+type WorkspaceKubeconfigHandler struct {
+	workspaceLister tenancylisters.ClusterWorkspaceLister
+	tokens          *WorkspaceTokens
+	authorizer      authorizer.Authorizer
+
+	serverURL     string
+	caData        []byte
+	maxExpiration time.Duration
+}
+
+// NewWorkspaceKubeconfigHandler returns a WorkspaceKubeconfigHandler generating
+// kubeconfigs to kcp at the given URL, with tokens expiring after at most
+// maxExpiration. The authorizer checks that requesting users hold the role they
+// hand over on the content of the workspace.
+func NewWorkspaceKubeconfigHandler(workspaceLister tenancylisters.ClusterWorkspaceLister, tokens *WorkspaceTokens, authz authorizer.Authorizer, serverURL string, caData []byte, maxExpiration time.Duration) *WorkspaceKubeconfigHandler {
+	return &WorkspaceKubeconfigHandler{
+		workspaceLister: workspaceLister,
+		tokens:          tokens,
+		authorizer:      authz,
+		serverURL:       serverURL,
+		caData:          caData,
+		maxExpiration:   maxExpiration,
+	}
+}
+
+// IsWorkspaceKubeconfigRequest returns true if the request gets a kubeconfig for the
+// logical cluster of a ClusterWorkspace.
+func IsWorkspaceKubeconfigRequest(requestInfo *genericapirequest.RequestInfo) bool {
+	return requestInfo != nil && requestInfo.IsResourceRequest &&
+		requestInfo.APIGroup == tenancy.GroupName &&
+		requestInfo.Resource == "clusterworkspaces" &&
+		requestInfo.Subresource == KubeconfigSubresource &&
+		requestInfo.Verb == "get"
+}
+
+// WithWorkspaceKubeconfigs serves kubeconfigs for the logical clusters of
+// ClusterWorkspaces, in YAML. The token of the kubeconfig is named after the name
+// query parameter, has the role of the role query parameter (view by default), and
+// expires after the duration of the expiration query parameter. Every other request
+// is passed to apiHandler. It expects authenticated and authorized requests.
+func (h *WorkspaceKubeconfigHandler) WithWorkspaceKubeconfigs(apiHandler http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		requestInfo, _ := genericapirequest.RequestInfoFrom(req.Context())
+		cluster := genericapirequest.ClusterFrom(req.Context())
+		if cluster == nil || cluster.Wildcard || !IsWorkspaceKubeconfigRequest(requestInfo) {
+			apiHandler.ServeHTTP(w, req)
+			return
+		}
+
+		kubeconfig, err := h.kubeconfig(req, cluster.Name, requestInfo.Name)
+		if err != nil {
+			gv := schema.GroupVersion{Group: requestInfo.APIGroup, Version: requestInfo.APIVersion}
+			responsewriters.ErrorNegotiated(err, scheme.Codecs, gv, w, req)
+			return
+		}
+		w.Header().Set("Content-Type", "application/yaml")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(kubeconfig)
+	}
+}
+
+func (h *WorkspaceKubeconfigHandler) kubeconfig(req *http.Request, clusterName, workspaceName string) ([]byte, error) {
+	query := req.URL.Query()
+	name := query.Get("name")
+	if name == "" {
+		return nil, apierrors.NewBadRequest("the name query parameter is required")
+	}
+	if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("invalid name %q: %s", name, strings.Join(errs, ", ")))
+	}
+	role := query.Get("role")
+	if role == "" {
+		role = "view"
+	}
+	if _, ok := bootstrap.WorkspaceContentGroups[role]; !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("invalid role %q, must be one of %s", role, strings.Join(workspaceRoles(), ", ")))
+	}
+	expiration := DefaultWorkspaceTokenExpiration
+	if value := query.Get("expiration"); value != "" {
+		var err error
+		if expiration, err = time.ParseDuration(value); err != nil {
+			return nil, apierrors.NewBadRequest(fmt.Sprintf("invalid expiration %q: %v", value, err))
+		}
+	}
+	if expiration <= 0 || expiration > h.maxExpiration {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expiration must be positive and at most %s", h.maxExpiration))
+	}
+
+	workspace, err := h.workspaceLister.Get(clusters.ToClusterAwareKey(clusterName, workspaceName))
+	if apierrors.IsNotFound(err) {
+		return nil, apierrors.NewNotFound(tenancyv1alpha1.Resource("clusterworkspaces"), workspaceName)
+	} else if err != nil {
+		return nil, apierrors.NewInternalError(err)
+	}
+	workspaceClusterName, err := helper.EncodeLogicalClusterName(workspace)
+	if err != nil {
+		return nil, apierrors.NewInternalError(err)
+	}
+
+	// users can only hand over the access they have to the workspace themselves
+	requester, _ := genericapirequest.UserFrom(req.Context())
+	dec, _, err := h.authorizer.Authorize(req.Context(), authorizer.AttributesRecord{
+		User:            requester,
+		Verb:            role,
+		APIGroup:        tenancyv1alpha1.SchemeGroupVersion.Group,
+		APIVersion:      tenancyv1alpha1.SchemeGroupVersion.Version,
+		Resource:        "workspaces",
+		Subresource:     "content",
+		Name:            workspaceName,
+		ResourceRequest: true,
+	})
+	if err != nil {
+		return nil, apierrors.NewInternalError(err)
+	}
+	if dec != authorizer.DecisionAllow {
+		return nil, apierrors.NewForbidden(tenancyv1alpha1.Resource("clusterworkspaces"), workspaceName, fmt.Errorf("%q access to the workspace is required to hand it over", role))
+	}
+
+	token, err := h.tokens.Token(workspace, name, role, h.tokens.now().Add(expiration))
+	if err != nil {
+		return nil, apierrors.NewInternalError(fmt.Errorf("failed to issue the workspace token: %w", err))
+	}
+	kubeconfig, err := clientcmd.Write(newWorkspaceKubeconfig(h.serverURL, h.caData, workspaceClusterName, name, token))
+	if err != nil {
+		return nil, apierrors.NewInternalError(err)
+	}
+	return kubeconfig, nil
+}
+
+// newWorkspaceKubeconfig returns a kubeconfig to the given logical cluster with the
+// given token as credentials.
+func newWorkspaceKubeconfig(serverURL string, caData []byte, clusterName, name, token string) clientcmdapi.Config {
+	return clientcmdapi.Config{
+		Clusters: map[string]*clientcmdapi.Cluster{
+			clusterName: {
+				Server:                   serverURL + "/clusters/" + clusterName,
+				CertificateAuthorityData: caData,
+			},
+		},
+		AuthInfos: map[string]*clientcmdapi.AuthInfo{
+			name: {Token: token},
+		},
+		Contexts: map[string]*clientcmdapi.Context{
+			clusterName: {Cluster: clusterName, AuthInfo: name},
+		},
+		CurrentContext: clusterName,
+	}
+}
+
+func workspaceRoles() []string {
+	roles := make([]string, 0, len(bootstrap.WorkspaceContentGroups))
+	for role := range bootstrap.WorkspaceContentGroups {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	return roles
+}
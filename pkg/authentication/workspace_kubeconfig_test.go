@@ -0,0 +1,125 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authentication
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	tenancylisters "github.com/kcp-dev/kcp/pkg/client/listers/tenancy/v1alpha1"
+)
+
+func TestWorkspaceKubeconfigHandler(t *testing.T) {
+	now := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	require.NoError(t, indexer.Add(&tenancyv1alpha1.ClusterWorkspace{ObjectMeta: metav1.ObjectMeta{ClusterName: "root:acme", Name: "team", UID: "team-uid"}}))
+	tokens := NewWorkspaceTokens([]byte("key"), tenancylisters.NewClusterWorkspaceLister(indexer))
+	tokens.now = func() time.Time { return now }
+
+	// alice is an editor of every workspace, bob a viewer
+	authz := authorizer.AuthorizerFunc(func(ctx context.Context, attr authorizer.Attributes) (authorizer.Decision, string, error) {
+		switch {
+		case attr.GetUser().GetName() == "alice" && attr.GetVerb() != "admin":
+			return authorizer.DecisionAllow, "", nil
+		case attr.GetUser().GetName() == "bob" && (attr.GetVerb() == "view" || attr.GetVerb() == "access"):
+			return authorizer.DecisionAllow, "", nil
+		}
+		return authorizer.DecisionNoOpinion, "", nil
+	})
+	handler := NewWorkspaceKubeconfigHandler(tenancylisters.NewClusterWorkspaceLister(indexer), tokens, authz, "https://kcp.example.com", []byte("ca"), 24*time.Hour)
+
+	apiHandler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	for _, tt := range []struct {
+		name        string
+		user        string
+		workspace   string
+		query       string
+		subresource string
+		wantStatus  int
+		wantUser    *user.DefaultInfo
+	}{
+		{name: "other subresource", user: "alice", workspace: "team", subresource: "status", wantStatus: http.StatusTeapot},
+		{name: "default role", user: "bob", workspace: "team", query: "name=ci", wantStatus: http.StatusOK, wantUser: &user.DefaultInfo{
+			Name:   "system:kcp:workspace-token:acme:team:ci",
+			Groups: []string{"system:kcp:workspace:view", user.AllAuthenticated, "system:kcp:authenticated"},
+			Extra:  map[string][]string{WorkspaceTokenClusterExtraKey: {"acme:team"}},
+		}},
+		{name: "edit role", user: "alice", workspace: "team", query: "name=ci&role=edit&expiration=2h", wantStatus: http.StatusOK, wantUser: &user.DefaultInfo{
+			Name:   "system:kcp:workspace-token:acme:team:ci",
+			Groups: []string{"system:kcp:workspace:edit", user.AllAuthenticated, "system:kcp:authenticated"},
+			Extra:  map[string][]string{WorkspaceTokenClusterExtraKey: {"acme:team"}},
+		}},
+		{name: "role not held", user: "bob", workspace: "team", query: "name=ci&role=edit", wantStatus: http.StatusForbidden},
+		{name: "missing name", user: "alice", workspace: "team", wantStatus: http.StatusBadRequest},
+		{name: "invalid name", user: "alice", workspace: "team", query: "name=CI", wantStatus: http.StatusBadRequest},
+		{name: "unknown role", user: "alice", workspace: "team", query: "name=ci&role=owner", wantStatus: http.StatusBadRequest},
+		{name: "expiration too long", user: "alice", workspace: "team", query: "name=ci&expiration=48h", wantStatus: http.StatusBadRequest},
+		{name: "negative expiration", user: "alice", workspace: "team", query: "name=ci&expiration=-1h", wantStatus: http.StatusBadRequest},
+		{name: "unknown workspace", user: "alice", workspace: "other", query: "name=ci", wantStatus: http.StatusNotFound},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			subresource := tt.subresource
+			if subresource == "" {
+				subresource = KubeconfigSubresource
+			}
+			req := httptest.NewRequest(http.MethodGet, "https://kcp.example.com/apis/tenancy.kcp.dev/v1alpha1/clusterworkspaces/"+tt.workspace+"/"+subresource+"?"+tt.query, nil)
+			ctx := genericapirequest.WithCluster(req.Context(), genericapirequest.Cluster{Name: "root:acme"})
+			ctx = genericapirequest.WithUser(ctx, &user.DefaultInfo{Name: tt.user})
+			ctx = genericapirequest.WithRequestInfo(ctx, &genericapirequest.RequestInfo{
+				IsResourceRequest: true,
+				Verb:              "get",
+				APIGroup:          "tenancy.kcp.dev",
+				APIVersion:        "v1alpha1",
+				Resource:          "clusterworkspaces",
+				Subresource:       subresource,
+				Name:              tt.workspace,
+			})
+			rec := httptest.NewRecorder()
+			handler.WithWorkspaceKubeconfigs(apiHandler).ServeHTTP(rec, req.WithContext(ctx))
+			require.Equal(t, tt.wantStatus, rec.Code, rec.Body.String())
+			if tt.wantUser == nil {
+				return
+			}
+
+			kubeconfig, err := clientcmd.Load(rec.Body.Bytes())
+			require.NoError(t, err)
+			require.Equal(t, "acme:team", kubeconfig.CurrentContext)
+			require.Equal(t, "https://kcp.example.com/clusters/acme:team", kubeconfig.Clusters["acme:team"].Server)
+			require.Equal(t, []byte("ca"), kubeconfig.Clusters["acme:team"].CertificateAuthorityData)
+			resp, ok, err := tokens.AuthenticateToken(context.Background(), kubeconfig.AuthInfos["ci"].Token)
+			require.NoError(t, err)
+			require.True(t, ok)
+			require.Equal(t, tt.wantUser, resp.User)
+		})
+	}
+}
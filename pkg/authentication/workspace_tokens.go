@@ -0,0 +1,193 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authentication
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authentication/user"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+	"github.com/kcp-dev/kcp/pkg/authorization/bootstrap"
+	tenancylisters "github.com/kcp-dev/kcp/pkg/client/listers/tenancy/v1alpha1"
+)
+
+const (
+	// WorkspaceTokenClusterExtraKey is the user extra holding the logical cluster a
+	// workspace token is scoped to.
+	WorkspaceTokenClusterExtraKey = "authentication.kcp.dev/workspace-token-cluster"
+
+	// WorkspaceTokenGenerationAnnotationKey is the annotation of ClusterWorkspaces holding
+	// the generation of their workspace tokens. Changing it revokes all the tokens issued
+	// for the workspace before.
+	WorkspaceTokenGenerationAnnotationKey = "authentication.kcp.dev/workspace-token-generation"
+
+	workspaceTokenPrefix = "kcp-workspace."
+)
+
+type workspaceTokenClaims struct {
+	Cluster    string `json:"cluster"`
+	UID        string `json:"uid"`
+	Generation string `json:"generation,omitempty"`
+	Name       string `json:"name"`
+	Role       string `json:"role"`
+	ExpiresAt  int64  `json:"expiresAt"`
+}
+
+// WorkspaceTokens issues and authenticates time-limited bearer tokens scoped to the
+// logical cluster of a ClusterWorkspace, with one of the roles users are granted on
+// the content of a workspace. They are handed to automation, e.g. CI systems, instead
+// of user credentials.
+//
+// Tokens are bound to the UID of the ClusterWorkspace and to the value of its
+// WorkspaceTokenGenerationAnnotationKey annotation when they are issued, such that
+// they are revoked when the workspace is recreated or the annotation changes.
+type WorkspaceTokens struct {
+	key             []byte
+	workspaceLister tenancylisters.ClusterWorkspaceLister
+	now             func() time.Time
+}
+
+// NewWorkspaceTokens returns WorkspaceTokens signing tokens with the given key, and
+// checking the ClusterWorkspaces of the tokens with the given lister.
+func NewWorkspaceTokens(key []byte, workspaceLister tenancylisters.ClusterWorkspaceLister) *WorkspaceTokens {
+	return &WorkspaceTokens{key: key, workspaceLister: workspaceLister, now: time.Now}
+}
+
+// WorkspaceTokenUserName returns the name of the user authenticated by the workspace
+// token with the given name in the given logical cluster.
+func WorkspaceTokenUserName(clusterName, name string) string {
+	return "system:kcp:workspace-token:" + clusterName + ":" + name
+}
+
+// Token returns a token with the given name and role in the logical cluster of the
+// given ClusterWorkspace, expiring at the given time. The role is one of the keys of
+// bootstrap.WorkspaceContentGroups.
+func (t *WorkspaceTokens) Token(workspace *tenancyv1alpha1.ClusterWorkspace, name, role string, expiresAt time.Time) (string, error) {
+	if _, ok := bootstrap.WorkspaceContentGroups[role]; !ok {
+		return "", fmt.Errorf("unknown workspace role %q", role)
+	}
+	clusterName, err := helper.EncodeLogicalClusterName(workspace)
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(workspaceTokenClaims{
+		Cluster:    clusterName,
+		UID:        string(workspace.UID),
+		Generation: workspace.Annotations[WorkspaceTokenGenerationAnnotationKey],
+		Name:       name,
+		Role:       role,
+		ExpiresAt:  expiresAt.Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(claims)
+	return workspaceTokenPrefix + payload + "." + base64.RawURLEncoding.EncodeToString(t.sign(payload)), nil
+}
+
+func (t *WorkspaceTokens) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, t.key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+var _ authenticator.Token = &WorkspaceTokens{}
+
+// AuthenticateToken authenticates unexpired and unrevoked workspace tokens as members
+// of the group of their role, with the logical cluster they are scoped to in their
+// extras. Other tokens are left to the following authenticators.
+func (t *WorkspaceTokens) AuthenticateToken(ctx context.Context, token string) (*authenticator.Response, bool, error) {
+	if !strings.HasPrefix(token, workspaceTokenPrefix) {
+		return nil, false, nil
+	}
+	parts := strings.Split(strings.TrimPrefix(token, workspaceTokenPrefix), ".")
+	if len(parts) != 2 {
+		return nil, false, nil
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, t.sign(parts[0])) {
+		return nil, false, nil
+	}
+	claimBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid workspace token payload: %w", err)
+	}
+	var claims workspaceTokenClaims
+	if err := json.Unmarshal(claimBytes, &claims); err != nil {
+		return nil, false, fmt.Errorf("invalid workspace token payload: %w", err)
+	}
+	if claims.Cluster == "" || claims.Name == "" {
+		return nil, false, fmt.Errorf("invalid workspace token payload: missing cluster")
+	}
+	group, ok := bootstrap.WorkspaceContentGroups[claims.Role]
+	if !ok {
+		return nil, false, fmt.Errorf("invalid workspace token payload: unknown role %q", claims.Role)
+	}
+	if !t.now().Before(time.Unix(claims.ExpiresAt, 0)) {
+		return nil, false, fmt.Errorf("workspace token %q of logical cluster %q has expired", claims.Name, claims.Cluster)
+	}
+	if err := t.checkRevocation(claims); err != nil {
+		return nil, false, err
+	}
+
+	groups := []string{group, user.AllAuthenticated}
+	if access := bootstrap.WorkspaceContentGroups["access"]; group != access {
+		groups = append(groups, access)
+	}
+	return &authenticator.Response{
+		User: &user.DefaultInfo{
+			Name:   WorkspaceTokenUserName(claims.Cluster, claims.Name),
+			Groups: groups,
+			Extra: map[string][]string{
+				WorkspaceTokenClusterExtraKey: {claims.Cluster},
+			},
+		},
+	}, true, nil
+}
+
+// checkRevocation returns an error if the ClusterWorkspace of the token is gone, was
+// recreated, or had its workspace tokens revoked since the token was issued.
+func (t *WorkspaceTokens) checkRevocation(claims workspaceTokenClaims) error {
+	org, name, err := helper.ParseLogicalClusterName(claims.Cluster)
+	if err != nil {
+		return fmt.Errorf("invalid workspace token payload: %w", err)
+	}
+	workspace, err := t.workspaceLister.Get(helper.WorkspaceKey(org, name))
+	if apierrors.IsNotFound(err) {
+		return fmt.Errorf("workspace token %q of logical cluster %q is revoked: the workspace does not exist", claims.Name, claims.Cluster)
+	} else if err != nil {
+		return err
+	}
+	if string(workspace.UID) != claims.UID {
+		return fmt.Errorf("workspace token %q of logical cluster %q is revoked: the workspace was recreated", claims.Name, claims.Cluster)
+	}
+	if workspace.Annotations[WorkspaceTokenGenerationAnnotationKey] != claims.Generation {
+		return fmt.Errorf("workspace token %q of logical cluster %q is revoked", claims.Name, claims.Cluster)
+	}
+	return nil
+}
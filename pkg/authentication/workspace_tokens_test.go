@@ -0,0 +1,121 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authentication
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/client-go/tools/cache"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	tenancylisters "github.com/kcp-dev/kcp/pkg/client/listers/tenancy/v1alpha1"
+)
+
+func TestWorkspaceTokens(t *testing.T) {
+	now := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	acme := &tenancyv1alpha1.ClusterWorkspace{ObjectMeta: metav1.ObjectMeta{ClusterName: "root", Name: "acme", UID: "acme-uid"}}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	require.NoError(t, indexer.Add(acme))
+	workspaceLister := tenancylisters.NewClusterWorkspaceLister(indexer)
+	tokens := NewWorkspaceTokens([]byte("key"), workspaceLister)
+	tokens.now = func() time.Time { return now }
+
+	token, err := tokens.Token(acme, "ci", "edit", now.Add(time.Hour))
+	require.NoError(t, err)
+
+	resp, ok, err := tokens.AuthenticateToken(context.Background(), token)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, &user.DefaultInfo{
+		Name:   "system:kcp:workspace-token:root:acme:ci",
+		Groups: []string{"system:kcp:workspace:edit", user.AllAuthenticated, "system:kcp:authenticated"},
+		Extra: map[string][]string{
+			WorkspaceTokenClusterExtraKey: {"root:acme"},
+		},
+	}, resp.User)
+
+	_, err = tokens.Token(acme, "ci", "owner", now.Add(time.Hour))
+	require.Error(t, err)
+
+	expired, err := tokens.Token(acme, "ci", "view", now)
+	require.NoError(t, err)
+	_, ok, err = tokens.AuthenticateToken(context.Background(), expired)
+	require.Error(t, err)
+	require.False(t, ok)
+
+	other := NewWorkspaceTokens([]byte("other"), workspaceLister)
+	otherToken, err := other.Token(acme, "ci", "edit", now.Add(time.Hour))
+	require.NoError(t, err)
+
+	for name, token := range map[string]string{
+		"other key":     otherToken,
+		"syncer token":  syncerTokenPrefix + strings.TrimPrefix(token, workspaceTokenPrefix),
+		"not workspace": "some-token",
+		"tampered":      token[:len(workspaceTokenPrefix)] + "x" + token[len(workspaceTokenPrefix)+1:],
+		"no signature":  token[:strings.LastIndex(token, ".")],
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, ok, _ := tokens.AuthenticateToken(context.Background(), token)
+			require.False(t, ok)
+		})
+	}
+}
+
+func TestWorkspaceTokensRevocation(t *testing.T) {
+	acme := &tenancyv1alpha1.ClusterWorkspace{ObjectMeta: metav1.ObjectMeta{ClusterName: "root", Name: "acme", UID: "acme-uid"}}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	require.NoError(t, indexer.Add(acme))
+	tokens := NewWorkspaceTokens([]byte("key"), tenancylisters.NewClusterWorkspaceLister(indexer))
+
+	token, err := tokens.Token(acme, "ci", "edit", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	_, ok, err := tokens.AuthenticateToken(context.Background(), token)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	revoked := acme.DeepCopy()
+	revoked.Annotations = map[string]string{WorkspaceTokenGenerationAnnotationKey: "2"}
+	require.NoError(t, indexer.Update(revoked))
+	_, ok, err = tokens.AuthenticateToken(context.Background(), token)
+	require.Error(t, err, "tokens are revoked by changing the generation of the workspace")
+	require.False(t, ok)
+
+	token, err = tokens.Token(revoked, "ci", "edit", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	_, ok, err = tokens.AuthenticateToken(context.Background(), token)
+	require.NoError(t, err, "tokens issued after the revocation are valid")
+	require.True(t, ok)
+
+	recreated := revoked.DeepCopy()
+	recreated.UID = "other-uid"
+	require.NoError(t, indexer.Update(recreated))
+	_, ok, err = tokens.AuthenticateToken(context.Background(), token)
+	require.Error(t, err, "tokens of a recreated workspace are revoked")
+	require.False(t, ok)
+
+	require.NoError(t, indexer.Delete(recreated))
+	_, ok, err = tokens.AuthenticateToken(context.Background(), token)
+	require.Error(t, err, "tokens of a deleted workspace are revoked")
+	require.False(t, ok)
+}
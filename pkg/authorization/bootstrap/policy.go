@@ -18,17 +18,219 @@ package bootstrap
 
 import (
 	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	rbacv1helpers "k8s.io/kubernetes/pkg/apis/rbac/v1"
 	rbacrest "k8s.io/kubernetes/pkg/registry/rbac/rest"
 )
 
+const (
+	// SystemKcpSchedulerGroup is the group of the workspace and namespace schedulers.
+	SystemKcpSchedulerGroup = "system:kcp:scheduler"
+	// SystemKcpInitializersGroup is the group of the controllers initializing ClusterWorkspaces.
+	SystemKcpInitializersGroup = "system:kcp:initializers"
+	// SystemKcpSyncerGroup is the group of the syncers.
+	SystemKcpSyncerGroup = "system:kcp:syncer"
+	// SystemKcpVirtualWorkspacesGroup is the group of the virtual workspace apiservers.
+	SystemKcpVirtualWorkspacesGroup = "system:kcp:virtual-workspaces"
+	// SystemKcpReplicationGroup is the group of the controller replicating objects from the root shard.
+	SystemKcpReplicationGroup = "system:kcp:replication"
+	// SystemKcpShardsGroup is the group of the shards reaching their peers with the client
+	// certificates issued by the shard CA, impersonating the users of fanned out requests.
+	SystemKcpShardsGroup = "system:kcp:shards"
+)
+
+// The users of the kcp system components writing objects of any resource. They are members
+// of SystemKcpSchedulerGroup, and granted the verbs they need on every resource by a
+// ClusterRole of the same name.
+const (
+	// SystemKcpGarbageCollectorUser removes the owner references and finalizers of objects,
+	// and deletes them.
+	SystemKcpGarbageCollectorUser = "system:kcp:garbage-collector"
+	// SystemKcpWorkspaceDeletionUser deletes the content of deleted workspaces.
+	SystemKcpWorkspaceDeletionUser = "system:kcp:workspace-deletion"
+	// SystemKcpNamespaceSchedulerUser labels the objects of scheduled namespaces with their
+	// placement.
+	SystemKcpNamespaceSchedulerUser = "system:kcp:namespace-scheduler"
+	// SystemKcpAPIBindingUpgradeUser rewrites the objects of upgraded APIBindings in their new
+	// storage version.
+	SystemKcpAPIBindingUpgradeUser = "system:kcp:apibinding-upgrade"
+)
+
+// SystemKcpComponentGroups are the groups of the kcp system components. Members
+// are authorized by the bootstrap policy in every logical cluster of a shard.
+var SystemKcpComponentGroups = []string{
+	SystemKcpSchedulerGroup,
+	SystemKcpInitializersGroup,
+	SystemKcpSyncerGroup,
+	SystemKcpVirtualWorkspacesGroup,
+	SystemKcpReplicationGroup,
+}
+
+// WorkspaceContentGroups are the groups granted in a workspace to the users authorized
+// for the given verbs on the content subresource of its ClusterWorkspace.
+var WorkspaceContentGroups = map[string]string{
+	"admin":  "system:kcp:workspace:admin",
+	"edit":   "system:kcp:workspace:edit",
+	"view":   "system:kcp:workspace:view",
+	"access": "system:kcp:authenticated",
+}
+
+const (
+	tenancyGroup  = "tenancy.kcp.dev"
+	workloadGroup = "workload.kcp.dev"
+	apiextGroup   = "apiextensions.k8s.io"
+	apisGroup     = "apis.kcp.dev"
+	rbacGroup     = "rbac.authorization.k8s.io"
+	certsGroup    = "certificates.k8s.io"
+	authzGroup    = "authorization.k8s.io"
+	apiregGroup   = "apiregistration.k8s.io"
+	legacyGroup   = ""
+)
+
+var (
+	readVerbs  = []string{"get", "list", "watch"}
+	writeVerbs = []string{"get", "list", "watch", "create", "update", "patch", "delete"}
+)
+
+// CrossWorkspaceImpersonatorClusterRole allows to impersonate users, groups and service accounts
+// in every workspace of a shard when bound in the bootstrap policy cluster.
+const CrossWorkspaceImpersonatorClusterRole = "system:kcp:cross-workspace-impersonator"
+
+// CrossWorkspaceReaderClusterRole allows to list and watch every resource across all workspaces
+// of a shard through the `*` logical cluster when bound in the bootstrap policy cluster.
+const CrossWorkspaceReaderClusterRole = "system:kcp:cross-workspace-reader"
+
+// clusterRoles return the roles of the kcp system components and platform operators
+func clusterRoles() []rbacv1.ClusterRole {
+	return []rbacv1.ClusterRole{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: CrossWorkspaceImpersonatorClusterRole},
+			Rules: []rbacv1.PolicyRule{
+				rbacv1helpers.NewRule("impersonate").Groups(legacyGroup).Resources("users", "groups", "serviceaccounts").RuleOrDie(),
+				rbacv1helpers.NewRule("impersonate").Groups("authentication.k8s.io").Resources("userextras/*", "uids").RuleOrDie(),
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: CrossWorkspaceReaderClusterRole},
+			Rules: []rbacv1.PolicyRule{
+				rbacv1helpers.NewRule("list", "watch").Groups("*").Resources("*").RuleOrDie(),
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: SystemKcpSchedulerGroup},
+			Rules: []rbacv1.PolicyRule{
+				rbacv1helpers.NewRule("get", "list", "watch", "update", "patch").Groups(tenancyGroup).Resources("clusterworkspaces", "clusterworkspaces/status", "workspaceshards", "workspaceshards/status").RuleOrDie(),
+				rbacv1helpers.NewRule("update", "patch").Groups(tenancyGroup).Resources("workspaceresourcequotas/status").RuleOrDie(),
+				rbacv1helpers.NewRule(readVerbs...).Groups(legacyGroup).Resources("secrets").RuleOrDie(),
+				rbacv1helpers.NewRule("create").Groups(legacyGroup).Resources("namespaces", "secrets").RuleOrDie(),
+				rbacv1helpers.NewRule("update").Groups(legacyGroup).Resources("secrets").RuleOrDie(),
+				rbacv1helpers.NewRule("create").Groups(tenancyGroup).Resources("workspaceshards").RuleOrDie(),
+				rbacv1helpers.NewRule(readVerbs...).Groups(workloadGroup).Resources("workloadclusters").RuleOrDie(),
+				rbacv1helpers.NewRule("update", "patch").Groups(workloadGroup).Resources("workloadclusters/status").RuleOrDie(),
+				rbacv1helpers.NewRule("update", "patch").Groups(apisGroup).Resources("apiexports/status", "apiexportendpointslices/status", "apibindings/status").RuleOrDie(),
+				rbacv1helpers.NewRule("update").Groups(apiregGroup).Resources("apiservices/status").RuleOrDie(),
+				rbacv1helpers.NewRule("create", "update", "delete", "escalate").Groups(rbacGroup).Resources("clusterroles").RuleOrDie(),
+				rbacv1helpers.NewRule("create", "delete").Groups(apiextGroup).Resources("customresourcedefinitions").RuleOrDie(),
+				// the root shard approves and signs the certificates requested by the other shards
+				rbacv1helpers.NewRule(readVerbs...).Groups(certsGroup).Resources("certificatesigningrequests").RuleOrDie(),
+				rbacv1helpers.NewRule("update").Groups(certsGroup).Resources("certificatesigningrequests/approval", "certificatesigningrequests/status").RuleOrDie(),
+				rbacv1helpers.NewRule("approve", "sign").Groups(certsGroup).Resources("signers").Names("kcp.dev/shard-client", "kcp.dev/shard-serving").RuleOrDie(),
+				rbacv1helpers.NewRule("create").Groups(authzGroup).Resources("subjectaccessreviews").RuleOrDie(),
+				// the objects of any resource are read, e.g. counted for quotas, the components
+				// writing them are granted their own ClusterRole below
+				rbacv1helpers.NewRule(readVerbs...).Groups("*").Resources("*").RuleOrDie(),
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: SystemKcpGarbageCollectorUser},
+			Rules: []rbacv1.PolicyRule{
+				rbacv1helpers.NewRule("patch", "delete").Groups("*").Resources("*").RuleOrDie(),
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: SystemKcpWorkspaceDeletionUser},
+			Rules: []rbacv1.PolicyRule{
+				rbacv1helpers.NewRule("delete").Groups("*").Resources("*").RuleOrDie(),
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: SystemKcpNamespaceSchedulerUser},
+			Rules: []rbacv1.PolicyRule{
+				rbacv1helpers.NewRule("patch").Groups("*").Resources("*").RuleOrDie(),
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: SystemKcpAPIBindingUpgradeUser},
+			Rules: []rbacv1.PolicyRule{
+				rbacv1helpers.NewRule("update").Groups("*").Resources("*").RuleOrDie(),
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: SystemKcpInitializersGroup},
+			Rules: []rbacv1.PolicyRule{
+				rbacv1helpers.NewRule("get", "list", "watch", "update", "patch").Groups(tenancyGroup).Resources("clusterworkspaces", "clusterworkspaces/status").RuleOrDie(),
+				rbacv1helpers.NewRule(writeVerbs...).Groups(tenancyGroup).Resources("clusterworkspacetypes").RuleOrDie(),
+				rbacv1helpers.NewRule(writeVerbs...).Groups(apiextGroup).Resources("customresourcedefinitions").RuleOrDie(),
+				rbacv1helpers.NewRule(writeVerbs...).Groups(legacyGroup).Resources("namespaces").RuleOrDie(),
+				rbacv1helpers.NewRule(readVerbs...).Groups(apisGroup).Resources("apiexports").RuleOrDie(),
+				rbacv1helpers.NewRule(writeVerbs...).Groups(apisGroup).Resources("apibindings").RuleOrDie(),
+				rbacv1helpers.NewRule(append([]string{"bind", "escalate"}, writeVerbs...)...).Groups(rbacGroup).Resources("clusterroles", "clusterrolebindings", "roles", "rolebindings").RuleOrDie(),
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: SystemKcpSyncerGroup},
+			Rules: []rbacv1.PolicyRule{
+				rbacv1helpers.NewRule("get", "list", "watch", "update", "patch").Groups(workloadGroup).Resources("workloadclusters", "workloadclusters/status").RuleOrDie(),
+				rbacv1helpers.NewRule("sync").Groups(workloadGroup).Resources("workloadclusters").RuleOrDie(),
+				rbacv1helpers.NewRule("get").Groups(workloadGroup).Resources("workloadclusters/tunnel").RuleOrDie(),
+				rbacv1helpers.NewRule(readVerbs...).Groups(apiextGroup).Resources("customresourcedefinitions").RuleOrDie(),
+				// the syncers write the status of the synced objects, and their status annotation,
+				// the only change of their main resource admitted by the SyncerWrites plugin
+				rbacv1helpers.NewRule(readVerbs...).Groups("*").Resources("*").RuleOrDie(),
+				rbacv1helpers.NewRule("update", "patch").Groups("*").Resources("*/status").RuleOrDie(),
+				rbacv1helpers.NewRule("patch").Groups("*").Resources("*").RuleOrDie(),
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: SystemKcpVirtualWorkspacesGroup},
+			Rules: []rbacv1.PolicyRule{
+				rbacv1helpers.NewRule(append([]string{"deletecollection"}, writeVerbs...)...).Groups(tenancyGroup).Resources("clusterworkspaces").RuleOrDie(),
+				rbacv1helpers.NewRule("use").Groups(tenancyGroup).Resources("clusterworkspacetypes").RuleOrDie(),
+				rbacv1helpers.NewRule(append([]string{"deletecollection", "bind", "escalate"}, writeVerbs...)...).Groups(rbacGroup).Resources("clusterroles", "clusterrolebindings").RuleOrDie(),
+				rbacv1helpers.NewRule(readVerbs...).Groups(rbacGroup).Resources("roles", "rolebindings").RuleOrDie(),
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: SystemKcpReplicationGroup},
+			Rules: []rbacv1.PolicyRule{
+				rbacv1helpers.NewRule(writeVerbs...).Groups(tenancyGroup).Resources("clusterworkspacetypes", "workspaceshards", "workspaceshards/status").RuleOrDie(),
+				rbacv1helpers.NewRule(append([]string{"bind", "escalate"}, writeVerbs...)...).Groups(rbacGroup).Resources("clusterroles", "clusterrolebindings").RuleOrDie(),
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: SystemKcpShardsGroup},
+			Rules: []rbacv1.PolicyRule{
+				rbacv1helpers.NewRule("impersonate").Groups(legacyGroup).Resources("users", "groups", "serviceaccounts").RuleOrDie(),
+				rbacv1helpers.NewRule("impersonate").Groups("authentication.k8s.io").Resources("userextras/*", "uids").RuleOrDie(),
+			},
+		},
+	}
+}
+
 // ClusterRoleBindings return default rolebindings to the default roles
 func clusterRoleBindings() []rbacv1.ClusterRoleBinding {
-	return []rbacv1.ClusterRoleBinding{
+	bindings := []rbacv1.ClusterRoleBinding{
 		clusterRoleBindingCustomName(rbacv1helpers.NewClusterBinding("cluster-admin").Groups("system:kcp:workspace:edit").BindingOrDie(), "system:kcp:workspace:edit"),
 		clusterRoleBindingCustomName(rbacv1helpers.NewClusterBinding("view").Groups("system:kcp:workspace:view").BindingOrDie(), "system:kcp:workspace:view"),
 		clusterRoleBindingCustomName(rbacv1helpers.NewClusterBinding("admin").Groups("system:kcp:workspace:admin").BindingOrDie(), "system:kcp:workspace:admin"),
 	}
+	for _, group := range append(SystemKcpComponentGroups, SystemKcpShardsGroup) {
+		bindings = append(bindings, rbacv1helpers.NewClusterBinding(group).Groups(group).BindingOrDie())
+	}
+	for _, user := range []string{SystemKcpGarbageCollectorUser, SystemKcpWorkspaceDeletionUser, SystemKcpNamespaceSchedulerUser, SystemKcpAPIBindingUpgradeUser} {
+		bindings = append(bindings, rbacv1helpers.NewClusterBinding(user).Users(user).BindingOrDie())
+	}
+	return bindings
 }
 
 func clusterRoleBindingCustomName(b rbacv1.ClusterRoleBinding, name string) rbacv1.ClusterRoleBinding {
@@ -38,6 +240,7 @@ func clusterRoleBindingCustomName(b rbacv1.ClusterRoleBinding, name string) rbac
 
 func Policy() *rbacrest.PolicyData {
 	return &rbacrest.PolicyData{
+		ClusterRoles:        clusterRoles(),
 		ClusterRoleBindings: clusterRoleBindings(),
 	}
 }
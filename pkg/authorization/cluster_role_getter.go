@@ -0,0 +1,95 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authorization
+
+import (
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	rbacinformers "k8s.io/client-go/informers/rbac/v1"
+
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+	frameworkrbac "github.com/kcp-dev/kcp/pkg/virtual/framework/rbac"
+)
+
+const (
+	// ClusterRoleRefSeparator separates the logical cluster of an ancestor workspace from the
+	// ClusterRole name in path-qualified role references of bindings, e.g. "root:acme#viewer".
+	// ClusterRole names must not contain it.
+	ClusterRoleRefSeparator = "#"
+
+	// SharedClusterRoleLabel is the label with value "true" of the ClusterRoles that the
+	// bindings of descendant workspaces can reference.
+	SharedClusterRoleLabel = "authorization.kcp.dev/shared"
+)
+
+// workspaceClusterRoleGetter resolves ClusterRoles referenced by the bindings of a logical
+// cluster. Plain names refer to ClusterRoles of the logical cluster itself, path-qualified
+// names to shared ClusterRoles of one of its ancestor workspaces.
+type workspaceClusterRoleGetter struct {
+	clusterName string
+	informers   rbacinformers.Interface
+}
+
+func newWorkspaceClusterRoleGetter(clusterName string, informers rbacinformers.Interface) *workspaceClusterRoleGetter {
+	return &workspaceClusterRoleGetter{
+		clusterName: clusterName,
+		informers:   informers,
+	}
+}
+
+func (g *workspaceClusterRoleGetter) GetClusterRole(name string) (*rbacv1.ClusterRole, error) {
+	i := strings.Index(name, ClusterRoleRefSeparator)
+	if i < 0 {
+		return frameworkrbac.FilterPerCluster(g.clusterName, g.informers).ClusterRoles().Lister().Get(name)
+	}
+	clusterName, roleName := name[:i], name[i+len(ClusterRoleRefSeparator):]
+	if !isAncestor(clusterName, g.clusterName) {
+		return nil, errors.NewNotFound(rbacv1.Resource("clusterroles"), name)
+	}
+	role, err := frameworkrbac.FilterPerCluster(clusterName, g.informers).ClusterRoles().Lister().Get(roleName)
+	if err != nil {
+		return nil, err
+	}
+	if !isShared(role) {
+		return nil, errors.NewNotFound(rbacv1.Resource("clusterroles"), name)
+	}
+	return role, nil
+}
+
+// isShared returns whether the ClusterRole opted in to be referenced by the bindings of
+// descendant workspaces.
+func isShared(role *rbacv1.ClusterRole) bool {
+	return role.Labels[SharedClusterRoleLabel] == "true"
+}
+
+// isAncestor returns whether ancestor is a logical cluster of a workspace the given
+// logical cluster is nested in.
+func isAncestor(ancestor, clusterName string) bool {
+	for current := clusterName; current != helper.RootCluster && !strings.HasPrefix(current, helper.LocalSystemClusterPrefix); {
+		parent, err := helper.ParentClusterName(current)
+		if err != nil {
+			return false
+		}
+		if parent == ancestor {
+			return true
+		}
+		current = parent
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authorization
+
+import (
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestIsAncestor(t *testing.T) {
+	for _, tt := range []struct {
+		ancestor    string
+		clusterName string
+		want        bool
+	}{
+		{ancestor: "root", clusterName: "root:acme", want: true},
+		{ancestor: "root", clusterName: "acme:team", want: true},
+		{ancestor: "root:acme", clusterName: "acme:team", want: true},
+		{ancestor: "root:other", clusterName: "acme:team"},
+		{ancestor: "acme:team", clusterName: "acme:team"},
+		{ancestor: "root", clusterName: "root"},
+		{ancestor: "root", clusterName: "system:admin"},
+	} {
+		t.Run(tt.ancestor+"/"+tt.clusterName, func(t *testing.T) {
+			if got := isAncestor(tt.ancestor, tt.clusterName); got != tt.want {
+				t.Errorf("isAncestor(%q, %q) = %v, want %v", tt.ancestor, tt.clusterName, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsShared(t *testing.T) {
+	role := func(labels map[string]string) *rbacv1.ClusterRole {
+		return &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "viewer", Labels: labels}}
+	}
+	if isShared(role(nil)) {
+		t.Error("ClusterRoles without the shared label must not be shared")
+	}
+	if isShared(role(map[string]string{SharedClusterRoleLabel: "false"})) {
+		t.Error("ClusterRoles with the shared label set to false must not be shared")
+	}
+	if !isShared(role(map[string]string{SharedClusterRoleLabel: "true"})) {
+		t.Error("ClusterRoles with the shared label set to true must be shared")
+	}
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authorization
+
+import (
+	"context"
+
+	"k8s.io/apiserver/pkg/audit"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+const (
+	// ImpersonatorAuditAnnotationKey records the user that impersonated another identity.
+	ImpersonatorAuditAnnotationKey = "impersonation.kcp.dev/impersonator"
+	// ImpersonationScopeAuditAnnotationKey records whether impersonation was granted by the
+	// workspace RBAC ("workspace") or by the shard-wide bootstrap RBAC ("cross-workspace").
+	ImpersonationScopeAuditAnnotationKey = "impersonation.kcp.dev/scope"
+)
+
+// NewImpersonationAuthorizer returns an authorizer deciding on the impersonate verb. Impersonation
+// is allowed only by an explicit grant in the RBAC of the logical cluster the request targets,
+// or, for platform operators, by a grant in the shard-wide bootstrap RBAC which applies to every
+// workspace. Workspace admin and edit access do not imply impersonation.
+func NewImpersonationAuthorizer(bootstrapAuth, localAuth authorizer.Authorizer) authorizer.Authorizer {
+	return &ImpersonationAuthorizer{
+		bootstrapAuth: bootstrapAuth,
+		localAuth:     localAuth,
+	}
+}
+
+type ImpersonationAuthorizer struct {
+	bootstrapAuth authorizer.Authorizer
+	localAuth     authorizer.Authorizer
+}
+
+func (a *ImpersonationAuthorizer) Authorize(ctx context.Context, attr authorizer.Attributes) (authorizer.Decision, string, error) {
+	if attr.GetVerb() != "impersonate" {
+		return authorizer.DecisionNoOpinion, "", nil
+	}
+
+	if dec, reason, err := a.localAuth.Authorize(ctx, attr); err != nil {
+		return authorizer.DecisionNoOpinion, reason, err
+	} else if dec == authorizer.DecisionAllow {
+		annotateImpersonation(ctx, attr, "workspace")
+		return dec, reason, nil
+	}
+
+	if dec, reason, err := a.bootstrapAuth.Authorize(ctx, attr); err != nil {
+		return authorizer.DecisionNoOpinion, reason, err
+	} else if dec == authorizer.DecisionAllow {
+		annotateImpersonation(ctx, attr, "cross-workspace")
+		return dec, reason, nil
+	}
+
+	return authorizer.DecisionDeny, "impersonation requires an explicit impersonate grant", nil
+}
+
+func annotateImpersonation(ctx context.Context, attr authorizer.Attributes, scope string) {
+	if attr.GetUser() != nil {
+		audit.AddAuditAnnotation(ctx, ImpersonatorAuditAnnotationKey, attr.GetUser().GetName())
+	}
+	audit.AddAuditAnnotation(ctx, ImpersonationScopeAuditAnnotationKey, scope)
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authorization
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+func decide(dec authorizer.Decision) authorizer.Authorizer {
+	return authorizer.AuthorizerFunc(func(ctx context.Context, attr authorizer.Attributes) (authorizer.Decision, string, error) {
+		return dec, "", nil
+	})
+}
+
+func TestImpersonationAuthorizer(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		verb      string
+		local     authorizer.Decision
+		bootstrap authorizer.Decision
+		want      authorizer.Decision
+	}{
+		{name: "other verb", verb: "get", local: authorizer.DecisionAllow, bootstrap: authorizer.DecisionAllow, want: authorizer.DecisionNoOpinion},
+		{name: "workspace grant", verb: "impersonate", local: authorizer.DecisionAllow, bootstrap: authorizer.DecisionNoOpinion, want: authorizer.DecisionAllow},
+		{name: "cross-workspace grant", verb: "impersonate", local: authorizer.DecisionNoOpinion, bootstrap: authorizer.DecisionAllow, want: authorizer.DecisionAllow},
+		{name: "no grant", verb: "impersonate", local: authorizer.DecisionNoOpinion, bootstrap: authorizer.DecisionNoOpinion, want: authorizer.DecisionDeny},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewImpersonationAuthorizer(decide(tt.bootstrap), decide(tt.local))
+			got, _, err := a.Authorize(context.Background(), authorizer.AttributesRecord{
+				User:            &user.DefaultInfo{Name: "operator"},
+				Verb:            tt.verb,
+				Resource:        "users",
+				Name:            "alice",
+				ResourceRequest: true,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -71,7 +71,7 @@ func (a *LocalAuthorizer) Authorize(ctx context.Context, attr authorizer.Attribu
 	scopedAuth := rbac.New(
 		&rbac.RoleGetter{Lister: filteredInformer.Roles().Lister()},
 		&rbac.RoleBindingLister{Lister: filteredInformer.RoleBindings().Lister()},
-		&rbac.ClusterRoleGetter{Lister: filteredInformer.ClusterRoles().Lister()},
+		newWorkspaceClusterRoleGetter(reqScope, a.versionedInformers.Rbac().V1()),
 		&rbac.ClusterRoleBindingLister{Lister: filteredInformer.ClusterRoleBindings().Lister()},
 	)
 
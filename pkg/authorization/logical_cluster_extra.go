@@ -0,0 +1,90 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authorization
+
+import (
+	"context"
+	"strings"
+
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+)
+
+const (
+	// LogicalClusterExtraKey is the user extra holding the logical cluster of a request,
+	// as passed to external authorizers.
+	LogicalClusterExtraKey = "authorization.kcp.dev/logical-cluster"
+	// WorkspacePathExtraKey is the user extra holding the full workspace path of a request,
+	// e.g. "root:acme:team", as passed to external authorizers.
+	WorkspacePathExtraKey = "authorization.kcp.dev/workspace-path"
+)
+
+// WithLogicalClusterExtra returns an authorizer that passes the logical cluster and the
+// workspace path of the request to the delegate as user extras. This makes them part of
+// SubjectAccessReviews sent to external authorizers like webhooks.
+func WithLogicalClusterExtra(delegate authorizer.Authorizer) authorizer.Authorizer {
+	return authorizer.AuthorizerFunc(func(ctx context.Context, attr authorizer.Attributes) (authorizer.Decision, string, error) {
+		cluster := genericapirequest.ClusterFrom(ctx)
+		if cluster == nil || cluster.Name == "" || attr.GetUser() == nil {
+			return delegate.Authorize(ctx, attr)
+		}
+
+		extra := map[string][]string{}
+		for k, v := range attr.GetUser().GetExtra() {
+			extra[k] = v
+		}
+		extra[LogicalClusterExtraKey] = []string{cluster.Name}
+		extra[WorkspacePathExtraKey] = []string{WorkspacePath(cluster.Name)}
+
+		return delegate.Authorize(ctx, authorizer.AttributesRecord{
+			User: &user.DefaultInfo{
+				Name:   attr.GetUser().GetName(),
+				UID:    attr.GetUser().GetUID(),
+				Groups: attr.GetUser().GetGroups(),
+				Extra:  extra,
+			},
+			Verb:            attr.GetVerb(),
+			Namespace:       attr.GetNamespace(),
+			APIGroup:        attr.GetAPIGroup(),
+			APIVersion:      attr.GetAPIVersion(),
+			Resource:        attr.GetResource(),
+			Subresource:     attr.GetSubresource(),
+			Name:            attr.GetName(),
+			ResourceRequest: attr.IsResourceRequest(),
+			Path:            attr.GetPath(),
+		})
+	})
+}
+
+// WorkspacePath returns the full path of the workspace of a logical cluster, starting
+// at the root workspace. System logical clusters are returned as is.
+func WorkspacePath(clusterName string) string {
+	if strings.HasPrefix(clusterName, helper.LocalSystemClusterPrefix) {
+		return clusterName
+	}
+	org, ws, err := helper.ParseLogicalClusterName(clusterName)
+	if err != nil || org == "" {
+		return clusterName
+	}
+	if org == helper.RootCluster {
+		return helper.RootCluster + ":" + ws
+	}
+	return helper.RootCluster + ":" + org + ":" + ws
+}
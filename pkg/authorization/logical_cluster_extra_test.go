@@ -0,0 +1,66 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authorization
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+)
+
+func TestWorkspacePath(t *testing.T) {
+	for clusterName, want := range map[string]string{
+		"root":         "root",
+		"system:admin": "system:admin",
+		"root:acme":    "root:acme",
+		"acme:team":    "root:acme:team",
+	} {
+		if got := WorkspacePath(clusterName); got != want {
+			t.Errorf("WorkspacePath(%q) = %q, want %q", clusterName, got, want)
+		}
+	}
+}
+
+func TestWithLogicalClusterExtra(t *testing.T) {
+	var got map[string][]string
+	a := WithLogicalClusterExtra(authorizer.AuthorizerFunc(func(ctx context.Context, attr authorizer.Attributes) (authorizer.Decision, string, error) {
+		got = attr.GetUser().GetExtra()
+		return authorizer.DecisionAllow, "", nil
+	}))
+
+	ctx := genericapirequest.WithCluster(context.Background(), genericapirequest.Cluster{Name: "acme:team"})
+	u := &user.DefaultInfo{Name: "alice", Extra: map[string][]string{"scopes": {"a"}}}
+	if _, _, err := a.Authorize(ctx, authorizer.AttributesRecord{User: u}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string][]string{
+		"scopes":               {"a"},
+		LogicalClusterExtraKey: {"acme:team"},
+		WorkspacePathExtraKey:  {"root:acme:team"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got extra %v, want %v", got, want)
+	}
+	if len(u.Extra) != 1 {
+		t.Errorf("user extra of the request was modified: %v", u.Extra)
+	}
+}
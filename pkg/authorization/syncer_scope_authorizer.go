@@ -0,0 +1,59 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authorization
+
+import (
+	"context"
+
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+
+	"github.com/kcp-dev/kcp/pkg/apis/workload"
+	"github.com/kcp-dev/kcp/pkg/authentication"
+)
+
+// NewSyncerScopeAuthorizer returns an authorizer denying the requests of syncers
+// authenticated by a scoped token outside of their logical cluster, and to other
+// WorkloadClusters than their own. Other requests are left to the following authorizers.
+func NewSyncerScopeAuthorizer() authorizer.Authorizer {
+	return &SyncerScopeAuthorizer{}
+}
+
+type SyncerScopeAuthorizer struct{}
+
+func (a *SyncerScopeAuthorizer) Authorize(ctx context.Context, attr authorizer.Attributes) (authorizer.Decision, string, error) {
+	if attr.GetUser() == nil {
+		return authorizer.DecisionNoOpinion, "", nil
+	}
+	extra := attr.GetUser().GetExtra()
+	scopedClusters, scoped := extra[authentication.SyncerClusterExtraKey]
+	if !scoped {
+		return authorizer.DecisionNoOpinion, "", nil
+	}
+
+	cluster := genericapirequest.ClusterFrom(ctx)
+	if cluster == nil || cluster.Wildcard || len(scopedClusters) != 1 || cluster.Name != scopedClusters[0] {
+		return authorizer.DecisionDeny, "syncer token is scoped to another logical cluster", nil
+	}
+	if attr.IsResourceRequest() && attr.GetAPIGroup() == workload.GroupName && attr.GetResource() == "workloadclusters" {
+		workloadClusters := extra[authentication.SyncerWorkloadClusterExtraKey]
+		if attr.GetName() != "" && (len(workloadClusters) != 1 || attr.GetName() != workloadClusters[0]) {
+			return authorizer.DecisionDeny, "syncer token is scoped to another WorkloadCluster", nil
+		}
+	}
+	return authorizer.DecisionNoOpinion, "", nil
+}
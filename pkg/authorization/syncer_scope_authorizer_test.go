@@ -0,0 +1,66 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authorization
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+
+	"github.com/kcp-dev/kcp/pkg/authentication"
+)
+
+func TestSyncerScopeAuthorizer(t *testing.T) {
+	scopedSyncer := &user.DefaultInfo{
+		Name: "syncer",
+		Extra: map[string][]string{
+			authentication.SyncerClusterExtraKey:         {"root:acme"},
+			authentication.SyncerWorkloadClusterExtraKey: {"east"},
+		},
+	}
+	for _, tt := range []struct {
+		name    string
+		user    user.Info
+		cluster *genericapirequest.Cluster
+		attr    authorizer.AttributesRecord
+		want    authorizer.Decision
+	}{
+		{name: "unscoped user", user: &user.DefaultInfo{Name: "user"}, cluster: &genericapirequest.Cluster{Name: "root:other"}, want: authorizer.DecisionNoOpinion},
+		{name: "own cluster", user: scopedSyncer, cluster: &genericapirequest.Cluster{Name: "root:acme"}, attr: authorizer.AttributesRecord{ResourceRequest: true, Resource: "deployments", APIGroup: "apps"}, want: authorizer.DecisionNoOpinion},
+		{name: "other cluster", user: scopedSyncer, cluster: &genericapirequest.Cluster{Name: "root:other"}, want: authorizer.DecisionDeny},
+		{name: "wildcard cluster", user: scopedSyncer, cluster: &genericapirequest.Cluster{Name: "*", Wildcard: true}, want: authorizer.DecisionDeny},
+		{name: "own workload cluster", user: scopedSyncer, cluster: &genericapirequest.Cluster{Name: "root:acme"}, attr: authorizer.AttributesRecord{ResourceRequest: true, APIGroup: "workload.kcp.dev", Resource: "workloadclusters", Name: "east"}, want: authorizer.DecisionNoOpinion},
+		{name: "other workload cluster", user: scopedSyncer, cluster: &genericapirequest.Cluster{Name: "root:acme"}, attr: authorizer.AttributesRecord{ResourceRequest: true, APIGroup: "workload.kcp.dev", Resource: "workloadclusters", Name: "west"}, want: authorizer.DecisionDeny},
+		{name: "list workload clusters", user: scopedSyncer, cluster: &genericapirequest.Cluster{Name: "root:acme"}, attr: authorizer.AttributesRecord{ResourceRequest: true, APIGroup: "workload.kcp.dev", Resource: "workloadclusters", Verb: "list"}, want: authorizer.DecisionNoOpinion},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := genericapirequest.WithCluster(context.Background(), *tt.cluster)
+			attr := tt.attr
+			attr.User = tt.user
+			got, _, err := NewSyncerScopeAuthorizer().Authorize(ctx, attr)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
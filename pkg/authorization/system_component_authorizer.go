@@ -0,0 +1,54 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authorization
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+
+	"github.com/kcp-dev/kcp/pkg/authorization/bootstrap"
+)
+
+// NewSystemComponentAuthorizer returns an authorizer that authorizes members of the
+// kcp system component groups against the bootstrap policy in every logical cluster.
+// Other users are left to the following authorizers.
+func NewSystemComponentAuthorizer(bootstrapAuth authorizer.Authorizer) authorizer.Authorizer {
+	return &SystemComponentAuthorizer{
+		bootstrapAuth: bootstrapAuth,
+		groups:        sets.NewString(bootstrap.SystemKcpComponentGroups...),
+	}
+}
+
+type SystemComponentAuthorizer struct {
+	bootstrapAuth authorizer.Authorizer
+	groups        sets.String
+}
+
+func (a *SystemComponentAuthorizer) Authorize(ctx context.Context, attr authorizer.Attributes) (authorizer.Decision, string, error) {
+	if attr.GetUser() == nil || !a.groups.HasAny(attr.GetUser().GetGroups()...) {
+		return authorizer.DecisionNoOpinion, "", nil
+	}
+
+	dec, reason, err := a.bootstrapAuth.Authorize(ctx, attr)
+	if dec != authorizer.DecisionAllow {
+		// system components never get access through workspace RBAC
+		return authorizer.DecisionDeny, reason, err
+	}
+	return dec, reason, err
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authorization
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+
+	"github.com/kcp-dev/kcp/pkg/authorization/bootstrap"
+)
+
+func TestSystemComponentAuthorizer(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		groups    []string
+		bootstrap authorizer.Decision
+		want      authorizer.Decision
+	}{
+		{name: "non-component user", groups: []string{"system:authenticated"}, bootstrap: authorizer.DecisionAllow, want: authorizer.DecisionNoOpinion},
+		{name: "component allowed by policy", groups: []string{bootstrap.SystemKcpSchedulerGroup}, bootstrap: authorizer.DecisionAllow, want: authorizer.DecisionAllow},
+		{name: "component not allowed by policy", groups: []string{bootstrap.SystemKcpSyncerGroup}, bootstrap: authorizer.DecisionNoOpinion, want: authorizer.DecisionDeny},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewSystemComponentAuthorizer(decide(tt.bootstrap))
+			got, _, err := a.Authorize(context.Background(), authorizer.AttributesRecord{User: &user.DefaultInfo{Name: "component", Groups: tt.groups}})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
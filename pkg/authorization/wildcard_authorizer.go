@@ -0,0 +1,59 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authorization
+
+import (
+	"context"
+
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+)
+
+// NewWildcardAuthorizer returns an authorizer deciding on requests to the `*` logical cluster,
+// which lists and watches resources across all logical clusters of a shard. Only list and watch
+// are allowed, and only by a grant in the shard-wide bootstrap RBAC, e.g. through the
+// system:kcp:cross-workspace-reader ClusterRole. Requests to other logical clusters are left to
+// the following authorizers.
+func NewWildcardAuthorizer(bootstrapAuth authorizer.Authorizer) authorizer.Authorizer {
+	return &WildcardAuthorizer{
+		bootstrapAuth: bootstrapAuth,
+	}
+}
+
+type WildcardAuthorizer struct {
+	bootstrapAuth authorizer.Authorizer
+}
+
+func (a *WildcardAuthorizer) Authorize(ctx context.Context, attr authorizer.Attributes) (authorizer.Decision, string, error) {
+	cluster := genericapirequest.ClusterFrom(ctx)
+	if cluster == nil || !cluster.Wildcard {
+		return authorizer.DecisionNoOpinion, "", nil
+	}
+
+	if attr.IsResourceRequest() && attr.GetVerb() != "list" && attr.GetVerb() != "watch" {
+		return authorizer.DecisionDeny, "only list and watch are allowed across logical clusters", nil
+	}
+
+	dec, reason, err := a.bootstrapAuth.Authorize(ctx, attr)
+	if err != nil {
+		return authorizer.DecisionNoOpinion, reason, err
+	}
+	if dec != authorizer.DecisionAllow {
+		return authorizer.DecisionDeny, "access across logical clusters requires a shard-wide grant", nil
+	}
+	return dec, reason, nil
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authorization
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+)
+
+func TestWildcardAuthorizer(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		wildcard  bool
+		verb      string
+		bootstrap authorizer.Decision
+		want      authorizer.Decision
+	}{
+		{name: "non-wildcard request", verb: "list", bootstrap: authorizer.DecisionAllow, want: authorizer.DecisionNoOpinion},
+		{name: "list allowed by bootstrap policy", wildcard: true, verb: "list", bootstrap: authorizer.DecisionAllow, want: authorizer.DecisionAllow},
+		{name: "watch allowed by bootstrap policy", wildcard: true, verb: "watch", bootstrap: authorizer.DecisionAllow, want: authorizer.DecisionAllow},
+		{name: "list without shard-wide grant", wildcard: true, verb: "list", bootstrap: authorizer.DecisionNoOpinion, want: authorizer.DecisionDeny},
+		{name: "get across logical clusters", wildcard: true, verb: "get", bootstrap: authorizer.DecisionAllow, want: authorizer.DecisionDeny},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := genericapirequest.WithCluster(context.Background(), genericapirequest.Cluster{Name: "system:admin", Wildcard: tt.wildcard})
+			a := NewWildcardAuthorizer(decide(tt.bootstrap))
+			got, _, err := a.Authorize(ctx, authorizer.AttributesRecord{
+				User:            &user.DefaultInfo{Name: "operator"},
+				Verb:            tt.verb,
+				Resource:        "configmaps",
+				ResourceRequest: true,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
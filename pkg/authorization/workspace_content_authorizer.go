@@ -32,6 +32,7 @@ import (
 
 	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
 	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+	"github.com/kcp-dev/kcp/pkg/authorization/bootstrap"
 	tenancyv1 "github.com/kcp-dev/kcp/pkg/client/listers/tenancy/v1alpha1"
 	frameworkrbac "github.com/kcp-dev/kcp/pkg/virtual/framework/rbac"
 )
@@ -87,7 +88,7 @@ func (a *OrgWorkspaceAuthorizer) Authorize(ctx context.Context, attr authorizer.
 	orgAuthorizer := rbac.New(
 		&rbac.RoleGetter{Lister: orgWorkspaceKubeInformer.Roles().Lister()},
 		&rbac.RoleBindingLister{Lister: orgWorkspaceKubeInformer.RoleBindings().Lister()},
-		&rbac.ClusterRoleGetter{Lister: orgWorkspaceKubeInformer.ClusterRoles().Lister()},
+		newWorkspaceClusterRoleGetter(parentClusterName, a.versionedInformers.Rbac().V1()),
 		&rbac.ClusterRoleBindingLister{Lister: orgWorkspaceKubeInformer.ClusterRoleBindings().Lister()},
 	)
 
@@ -123,19 +124,12 @@ func (a *OrgWorkspaceAuthorizer) Authorize(ctx context.Context, attr authorizer.
 		}
 	}
 
-	verbToGroupMembership := map[string]string{
-		"admin":  "system:kcp:workspace:admin",
-		"edit":   "system:kcp:workspace:edit",
-		"view":   "system:kcp:workspace:view",
-		"access": "system:kcp:authenticated",
-	}
-
 	extraGroups := []string{}
 	var (
 		errList    []error
 		reasonList []string
 	)
-	for verb, group := range verbToGroupMembership {
+	for verb, group := range bootstrap.WorkspaceContentGroups {
 		workspaceAttr := authorizer.AttributesRecord{
 			User:            attr.GetUser(),
 			Verb:            verb,
@@ -0,0 +1,60 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authorization
+
+import (
+	"context"
+
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+
+	"github.com/kcp-dev/kcp/pkg/authentication"
+)
+
+// NewWorkspaceTokenAuthorizer returns an authorizer for the users authenticated by a
+// workspace token. They are denied outside of their logical cluster, and authorized
+// by the delegate inside of it with the group of the role of their token, without
+// requiring access to the workspace in its parent. Other requests are left to the
+// following authorizers.
+func NewWorkspaceTokenAuthorizer(delegate authorizer.Authorizer) authorizer.Authorizer {
+	return &WorkspaceTokenAuthorizer{delegate: delegate}
+}
+
+type WorkspaceTokenAuthorizer struct {
+	delegate authorizer.Authorizer
+}
+
+func (a *WorkspaceTokenAuthorizer) Authorize(ctx context.Context, attr authorizer.Attributes) (authorizer.Decision, string, error) {
+	if attr.GetUser() == nil {
+		return authorizer.DecisionNoOpinion, "", nil
+	}
+	scopedClusters, scoped := attr.GetUser().GetExtra()[authentication.WorkspaceTokenClusterExtraKey]
+	if !scoped {
+		return authorizer.DecisionNoOpinion, "", nil
+	}
+
+	cluster := genericapirequest.ClusterFrom(ctx)
+	if cluster == nil || cluster.Wildcard || len(scopedClusters) != 1 || cluster.Name != scopedClusters[0] {
+		return authorizer.DecisionDeny, "workspace token is scoped to another logical cluster", nil
+	}
+
+	dec, reason, err := a.delegate.Authorize(ctx, attr)
+	if err != nil || dec == authorizer.DecisionAllow {
+		return dec, reason, err
+	}
+	return authorizer.DecisionDeny, reason, nil
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authorization
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+
+	"github.com/kcp-dev/kcp/pkg/authentication"
+)
+
+func TestWorkspaceTokenAuthorizer(t *testing.T) {
+	scopedToken := &user.DefaultInfo{
+		Name:   "system:kcp:workspace-token:root:acme:ci",
+		Groups: []string{"system:kcp:workspace:view"},
+		Extra: map[string][]string{
+			authentication.WorkspaceTokenClusterExtraKey: {"root:acme"},
+		},
+	}
+	// the delegate allows the view group to read
+	delegate := authorizer.AuthorizerFunc(func(ctx context.Context, attr authorizer.Attributes) (authorizer.Decision, string, error) {
+		for _, group := range attr.GetUser().GetGroups() {
+			if group == "system:kcp:workspace:view" && attr.GetVerb() == "get" {
+				return authorizer.DecisionAllow, "", nil
+			}
+		}
+		return authorizer.DecisionNoOpinion, "", nil
+	})
+	for _, tt := range []struct {
+		name    string
+		user    user.Info
+		cluster *genericapirequest.Cluster
+		verb    string
+		want    authorizer.Decision
+	}{
+		{name: "unscoped user", user: &user.DefaultInfo{Name: "user", Groups: []string{"system:kcp:workspace:view"}}, cluster: &genericapirequest.Cluster{Name: "root:acme"}, verb: "get", want: authorizer.DecisionNoOpinion},
+		{name: "allowed in own cluster", user: scopedToken, cluster: &genericapirequest.Cluster{Name: "root:acme"}, verb: "get", want: authorizer.DecisionAllow},
+		{name: "not allowed in own cluster", user: scopedToken, cluster: &genericapirequest.Cluster{Name: "root:acme"}, verb: "delete", want: authorizer.DecisionDeny},
+		{name: "other cluster", user: scopedToken, cluster: &genericapirequest.Cluster{Name: "root:other"}, verb: "get", want: authorizer.DecisionDeny},
+		{name: "wildcard cluster", user: scopedToken, cluster: &genericapirequest.Cluster{Name: "*", Wildcard: true}, verb: "get", want: authorizer.DecisionDeny},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := genericapirequest.WithCluster(context.Background(), *tt.cluster)
+			attr := authorizer.AttributesRecord{User: tt.user, Verb: tt.verb, ResourceRequest: true, Resource: "configmaps"}
+			got, _, err := NewWorkspaceTokenAuthorizer(delegate).Authorize(ctx, attr)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
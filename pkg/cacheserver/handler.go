@@ -0,0 +1,173 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cacheserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clusters"
+	"k8s.io/klog/v2"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+)
+
+// Resources are the cluster-scoped resources served by the cache server, by the kind of
+// their objects. They are read by every shard and controller, and rarely change.
+var Resources = map[schema.GroupVersionResource]string{
+	tenancyv1alpha1.SchemeGroupVersion.WithResource("clusterworkspacetypes"): "ClusterWorkspaceType",
+	tenancyv1alpha1.SchemeGroupVersion.WithResource("workspaceshards"):       "WorkspaceShard",
+	apisv1alpha1.SchemeGroupVersion.WithResource("apiexports"):               "APIExport",
+	apisv1alpha1.SchemeGroupVersion.WithResource("apiresourceschemas"):      "APIResourceSchema",
+}
+
+// Store is the read-only view of the cached objects of a resource.
+type Store interface {
+	GetByKey(key string) (item interface{}, exists bool, err error)
+	List() []interface{}
+	LastSyncResourceVersion() string
+}
+
+// informerStore serves the objects of an informer.
+type informerStore struct {
+	cache.SharedIndexInformer
+}
+
+func (s informerStore) GetByKey(key string) (interface{}, bool, error) {
+	return s.GetStore().GetByKey(key)
+}
+
+func (s informerStore) List() []interface{} {
+	return s.GetStore().List()
+}
+
+// InformerStore returns the store serving the objects of the given informer.
+func InformerStore(informer cache.SharedIndexInformer) Store {
+	return informerStore{informer}
+}
+
+// NewHandler returns a handler serving read-only copies of the objects of the given stores,
+// by resource, with the paths and the encoding of the kcp API. Objects are listed in all
+// logical clusters with the "*" cluster, e.g.
+// /clusters/*/apis/tenancy.kcp.dev/v1alpha1/clusterworkspacetypes, or in one, and are
+// read one by one in their logical cluster. Other verbs are rejected.
+func NewHandler(stores map[schema.GroupVersionResource]Store) http.Handler {
+	return &handler{stores: stores}
+}
+
+type handler struct {
+	stores map[schema.GroupVersionResource]Store
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeStatus(w, apierrors.NewMethodNotSupported(schema.GroupResource{}, r.Method))
+		return
+	}
+	if r.URL.Query().Get("watch") == "true" || r.URL.Query().Get("watch") == "1" {
+		writeStatus(w, apierrors.NewMethodNotSupported(schema.GroupResource{}, "watch"))
+		return
+	}
+
+	clusterName, gvr, name, ok := parsePath(r.URL.Path)
+	if !ok {
+		writeStatus(w, apierrors.NewNotFound(schema.GroupResource{}, r.URL.Path))
+		return
+	}
+	store, found := h.stores[gvr]
+	if !found {
+		writeStatus(w, apierrors.NewNotFound(gvr.GroupResource(), ""))
+		return
+	}
+
+	if name != "" {
+		if clusterName == "*" {
+			writeStatus(w, apierrors.NewBadRequest("objects cannot be read in the wildcard cluster"))
+			return
+		}
+		obj, exists, err := store.GetByKey(clusters.ToClusterAwareKey(clusterName, name))
+		if err != nil {
+			writeStatus(w, apierrors.NewInternalError(err))
+			return
+		}
+		if !exists {
+			writeStatus(w, apierrors.NewNotFound(gvr.GroupResource(), name))
+			return
+		}
+		writeJSON(w, http.StatusOK, obj)
+		return
+	}
+
+	list := &unstructured.UnstructuredList{}
+	list.SetAPIVersion(gvr.GroupVersion().String())
+	list.SetKind(Resources[gvr] + "List")
+	list.SetResourceVersion(store.LastSyncResourceVersion())
+	for _, item := range store.List() {
+		obj, ok := item.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+		if clusterName != "*" && obj.GetClusterName() != clusterName {
+			continue
+		}
+		list.Items = append(list.Items, *obj)
+	}
+	sort.Slice(list.Items, func(i, j int) bool {
+		return clusters.ToClusterAwareKey(list.Items[i].GetClusterName(), list.Items[i].GetName()) < clusters.ToClusterAwareKey(list.Items[j].GetClusterName(), list.Items[j].GetName())
+	})
+	writeJSON(w, http.StatusOK, list)
+}
+
+// parsePath parses /clusters/<cluster>/apis/<group>/<version>/<resource>[/<name>].
+func parsePath(path string) (clusterName string, gvr schema.GroupVersionResource, name string, ok bool) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) < 6 || len(segments) > 7 || segments[0] != "clusters" || segments[2] != "apis" {
+		return "", schema.GroupVersionResource{}, "", false
+	}
+	if len(segments) == 7 {
+		name = segments[6]
+	}
+	return segments[1], schema.GroupVersionResource{Group: segments[3], Version: segments[4], Resource: segments[5]}, name, segments[1] != ""
+}
+
+func writeStatus(w http.ResponseWriter, err *apierrors.StatusError) {
+	status := err.Status()
+	status.APIVersion = "v1"
+	status.Kind = "Status"
+	writeJSON(w, int(status.Code), &status)
+}
+
+func writeJSON(w http.ResponseWriter, code int, obj interface{}) {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to encode response: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if _, err := w.Write(raw); err != nil {
+		klog.V(4).Infof("failed to write response: %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cacheserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+)
+
+type fakeStore struct {
+	cache.Store
+}
+
+func (fakeStore) LastSyncResourceVersion() string {
+	return "42"
+}
+
+func TestHandler(t *testing.T) {
+	ctx := context.Background()
+	gvr := tenancyv1alpha1.SchemeGroupVersion.WithResource("clusterworkspacetypes")
+
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	for _, o := range []struct{ clusterName, name string }{
+		{"root", "organization"},
+		{"root:acme", "team"},
+		{"root:acme", "universal"},
+	} {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion(tenancyv1alpha1.SchemeGroupVersion.String())
+		obj.SetKind("ClusterWorkspaceType")
+		obj.SetClusterName(o.clusterName)
+		obj.SetName(o.name)
+		require.NoError(t, store.Add(obj))
+	}
+
+	server := httptest.NewServer(NewHandler(map[schema.GroupVersionResource]Store{gvr: fakeStore{store}}))
+	defer server.Close()
+	client, err := dynamic.NewClusterForConfig(&rest.Config{Host: server.URL})
+	require.NoError(t, err)
+
+	names := func(list *unstructured.UnstructuredList) []string {
+		var names []string
+		for _, item := range list.Items {
+			names = append(names, item.GetClusterName()+"|"+item.GetName())
+		}
+		return names
+	}
+
+	list, err := client.Cluster("*").Resource(gvr).List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"root|organization", "root:acme|team", "root:acme|universal"}, names(list))
+	require.Equal(t, "42", list.GetResourceVersion())
+
+	list, err = client.Cluster("root:acme").Resource(gvr).List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"root:acme|team", "root:acme|universal"}, names(list))
+
+	obj, err := client.Cluster("root:acme").Resource(gvr).Get(ctx, "team", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "team", obj.GetName())
+
+	_, err = client.Cluster("root").Resource(gvr).Get(ctx, "team", metav1.GetOptions{})
+	require.True(t, apierrors.IsNotFound(err), "expected not found, got %v", err)
+
+	_, err = client.Cluster("root").Resource(tenancyv1alpha1.SchemeGroupVersion.WithResource("clusterworkspaces")).List(ctx, metav1.ListOptions{})
+	require.True(t, apierrors.IsNotFound(err), "expected not found, got %v", err)
+
+	_, err = client.Cluster("root").Resource(gvr).Create(ctx, obj, metav1.CreateOptions{})
+	require.True(t, apierrors.IsMethodNotSupported(err), "expected method not supported, got %v", err)
+
+	resp, err := http.Get(server.URL + "/clusters/*/apis/tenancy.kcp.dev/v1alpha1/clusterworkspacetypes?watch=true")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
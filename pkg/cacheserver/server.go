@@ -0,0 +1,82 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cacheserver
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/server/healthz"
+	"k8s.io/klog/v2"
+)
+
+// NewServer creates a new server serving the objects of the given stores on the given port,
+// once the given informers are synced.
+func NewServer(port int, waiter cacheSyncWaiter, stores map[schema.GroupVersionResource]Store) Server {
+	return &server{
+		port:   port,
+		waiter: waiter,
+		stores: stores,
+	}
+}
+
+type Server interface {
+	ListenAndServe(ctx context.Context)
+}
+
+type server struct {
+	port   int
+	waiter cacheSyncWaiter
+	stores map[schema.GroupVersionResource]Store
+}
+
+type cacheSyncWaiter interface {
+	WaitForCacheSync(stopCh <-chan struct{}) map[schema.GroupVersionResource]bool
+}
+
+// syncWaiter adapts the cache sync of the dynamic informers to the informer sync check.
+type syncWaiter struct {
+	cacheSyncWaiter
+}
+
+func (w syncWaiter) WaitForCacheSync(stopCh <-chan struct{}) map[reflect.Type]bool {
+	synced := true
+	for _, ok := range w.cacheSyncWaiter.WaitForCacheSync(stopCh) {
+		synced = synced && ok
+	}
+	return map[reflect.Type]bool{reflect.TypeOf(w): synced}
+}
+
+func (s *server) ListenAndServe(ctx context.Context) {
+	mux := http.NewServeMux()
+	mux.Handle("/clusters/", NewHandler(s.stores))
+	healthz.InstallHandler(mux)
+	healthz.InstallReadyzHandler(mux, healthz.NewInformerSyncHealthz(syncWaiter{s.waiter}))
+	httpServer := http.Server{Addr: ":" + strconv.Itoa(s.port), Handler: mux}
+	go func() {
+		<-ctx.Done()
+		if err := httpServer.Shutdown(context.Background()); err != nil {
+			klog.Error(err)
+		}
+	}()
+	if err := httpServer.ListenAndServe(); err != nil {
+		klog.Error(err)
+	}
+}
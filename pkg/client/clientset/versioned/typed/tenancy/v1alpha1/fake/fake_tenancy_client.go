@@ -37,6 +37,10 @@ func (c *FakeTenancyV1alpha1) ClusterWorkspaceTypes() v1alpha1.ClusterWorkspaceT
 	return &FakeClusterWorkspaceTypes{c}
 }
 
+func (c *FakeTenancyV1alpha1) WorkspaceResourceQuotas() v1alpha1.WorkspaceResourceQuotaInterface {
+	return &FakeWorkspaceResourceQuotas{c}
+}
+
 func (c *FakeTenancyV1alpha1) WorkspaceShards() v1alpha1.WorkspaceShardInterface {
 	return &FakeWorkspaceShards{c}
 }
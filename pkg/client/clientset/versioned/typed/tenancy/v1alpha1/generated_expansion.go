@@ -22,4 +22,6 @@ type ClusterWorkspaceExpansion interface{}
 
 type ClusterWorkspaceTypeExpansion interface{}
 
+type WorkspaceResourceQuotaExpansion interface{}
+
 type WorkspaceShardExpansion interface{}
@@ -29,6 +29,14 @@ type FakeWorkloadV1alpha1 struct {
 	*testing.Fake
 }
 
+func (c *FakeWorkloadV1alpha1) Locations() v1alpha1.LocationInterface {
+	return &FakeLocations{c}
+}
+
+func (c *FakeWorkloadV1alpha1) Placements() v1alpha1.PlacementInterface {
+	return &FakePlacements{c}
+}
+
 func (c *FakeWorkloadV1alpha1) WorkloadClusters() v1alpha1.WorkloadClusterInterface {
 	return &FakeWorkloadClusters{c}
 }
@@ -18,4 +18,8 @@ limitations under the License.
 
 package v1alpha1
 
+type LocationExpansion interface{}
+
+type PlacementExpansion interface{}
+
 type WorkloadClusterExpansion interface{}
@@ -29,6 +29,8 @@ import (
 
 type WorkloadV1alpha1Interface interface {
 	RESTClient() rest.Interface
+	LocationsGetter
+	PlacementsGetter
 	WorkloadClustersGetter
 }
 
@@ -38,6 +40,14 @@ type WorkloadV1alpha1Client struct {
 	cluster    string
 }
 
+func (c *WorkloadV1alpha1Client) Locations() LocationInterface {
+	return newLocations(c)
+}
+
+func (c *WorkloadV1alpha1Client) Placements() PlacementInterface {
+	return newPlacements(c)
+}
+
 func (c *WorkloadV1alpha1Client) WorkloadClusters() WorkloadClusterInterface {
 	return newWorkloadClusters(c)
 }
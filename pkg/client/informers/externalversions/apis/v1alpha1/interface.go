@@ -28,6 +28,8 @@ type Interface interface {
 	APIBindings() APIBindingInformer
 	// APIExports returns a APIExportInformer.
 	APIExports() APIExportInformer
+	// APIExportEndpointSlices returns a APIExportEndpointSliceInformer.
+	APIExportEndpointSlices() APIExportEndpointSliceInformer
 	// APIResourceSchemas returns a APIResourceSchemaInformer.
 	APIResourceSchemas() APIResourceSchemaInformer
 }
@@ -53,6 +55,11 @@ func (v *version) APIExports() APIExportInformer {
 	return &aPIExportInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
 }
 
+// APIExportEndpointSlices returns a APIExportEndpointSliceInformer.
+func (v *version) APIExportEndpointSlices() APIExportEndpointSliceInformer {
+	return &aPIExportEndpointSliceInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
+}
+
 // APIResourceSchemas returns a APIResourceSchemaInformer.
 func (v *version) APIResourceSchemas() APIResourceSchemaInformer {
 	return &aPIResourceSchemaInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
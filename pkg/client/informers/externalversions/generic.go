@@ -68,6 +68,8 @@ func (f *sharedInformerFactory) ForResource(resource schema.GroupVersionResource
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Apis().V1alpha1().APIBindings().Informer()}, nil
 	case apisv1alpha1.SchemeGroupVersion.WithResource("apiexports"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Apis().V1alpha1().APIExports().Informer()}, nil
+	case apisv1alpha1.SchemeGroupVersion.WithResource("apiexportendpointslices"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Apis().V1alpha1().APIExportEndpointSlices().Informer()}, nil
 	case apisv1alpha1.SchemeGroupVersion.WithResource("apiresourceschemas"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Apis().V1alpha1().APIResourceSchemas().Informer()}, nil
 
@@ -76,6 +78,8 @@ func (f *sharedInformerFactory) ForResource(resource schema.GroupVersionResource
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Tenancy().V1alpha1().ClusterWorkspaces().Informer()}, nil
 	case tenancyv1alpha1.SchemeGroupVersion.WithResource("clusterworkspacetypes"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Tenancy().V1alpha1().ClusterWorkspaceTypes().Informer()}, nil
+	case tenancyv1alpha1.SchemeGroupVersion.WithResource("workspaceresourcequotas"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Tenancy().V1alpha1().WorkspaceResourceQuotas().Informer()}, nil
 	case tenancyv1alpha1.SchemeGroupVersion.WithResource("workspaceshards"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Tenancy().V1alpha1().WorkspaceShards().Informer()}, nil
 
@@ -84,6 +88,10 @@ func (f *sharedInformerFactory) ForResource(resource schema.GroupVersionResource
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Tenancy().V1beta1().Workspaces().Informer()}, nil
 
 		// Group=workload.kcp.dev, Version=v1alpha1
+	case workloadv1alpha1.SchemeGroupVersion.WithResource("locations"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Workload().V1alpha1().Locations().Informer()}, nil
+	case workloadv1alpha1.SchemeGroupVersion.WithResource("placements"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Workload().V1alpha1().Placements().Informer()}, nil
 	case workloadv1alpha1.SchemeGroupVersion.WithResource("workloadclusters"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Workload().V1alpha1().WorkloadClusters().Informer()}, nil
 
@@ -28,6 +28,8 @@ type Interface interface {
 	ClusterWorkspaces() ClusterWorkspaceInformer
 	// ClusterWorkspaceTypes returns a ClusterWorkspaceTypeInformer.
 	ClusterWorkspaceTypes() ClusterWorkspaceTypeInformer
+	// WorkspaceResourceQuotas returns a WorkspaceResourceQuotaInformer.
+	WorkspaceResourceQuotas() WorkspaceResourceQuotaInformer
 	// WorkspaceShards returns a WorkspaceShardInformer.
 	WorkspaceShards() WorkspaceShardInformer
 }
@@ -53,6 +55,11 @@ func (v *version) ClusterWorkspaceTypes() ClusterWorkspaceTypeInformer {
 	return &clusterWorkspaceTypeInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
 }
 
+// WorkspaceResourceQuotas returns a WorkspaceResourceQuotaInformer.
+func (v *version) WorkspaceResourceQuotas() WorkspaceResourceQuotaInformer {
+	return &workspaceResourceQuotaInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
+}
+
 // WorkspaceShards returns a WorkspaceShardInformer.
 func (v *version) WorkspaceShards() WorkspaceShardInformer {
 	return &workspaceShardInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
@@ -24,6 +24,10 @@ import (
 
 // Interface provides access to all the informers in this group version.
 type Interface interface {
+	// Locations returns a LocationInformer.
+	Locations() LocationInformer
+	// Placements returns a PlacementInformer.
+	Placements() PlacementInformer
 	// WorkloadClusters returns a WorkloadClusterInformer.
 	WorkloadClusters() WorkloadClusterInformer
 }
@@ -39,6 +43,16 @@ func New(f internalinterfaces.SharedInformerFactory, namespace string, tweakList
 	return &version{factory: f, namespace: namespace, tweakListOptions: tweakListOptions}
 }
 
+// Locations returns a LocationInformer.
+func (v *version) Locations() LocationInformer {
+	return &locationInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
+}
+
+// Placements returns a PlacementInformer.
+func (v *version) Placements() PlacementInformer {
+	return &placementInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
+}
+
 // WorkloadClusters returns a WorkloadClusterInformer.
 func (v *version) WorkloadClusters() WorkloadClusterInformer {
 	return &workloadClusterInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
@@ -26,6 +26,10 @@ type APIBindingListerExpansion interface{}
 // APIExportLister.
 type APIExportListerExpansion interface{}
 
+// APIExportEndpointSliceListerExpansion allows custom methods to be added to
+// APIExportEndpointSliceLister.
+type APIExportEndpointSliceListerExpansion interface{}
+
 // APIResourceSchemaListerExpansion allows custom methods to be added to
 // APIResourceSchemaLister.
 type APIResourceSchemaListerExpansion interface{}
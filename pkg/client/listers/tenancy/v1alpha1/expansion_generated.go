@@ -26,6 +26,10 @@ type ClusterWorkspaceListerExpansion interface{}
 // ClusterWorkspaceTypeLister.
 type ClusterWorkspaceTypeListerExpansion interface{}
 
+// WorkspaceResourceQuotaListerExpansion allows custom methods to be added to
+// WorkspaceResourceQuotaLister.
+type WorkspaceResourceQuotaListerExpansion interface{}
+
 // WorkspaceShardListerExpansion allows custom methods to be added to
 // WorkspaceShardLister.
 type WorkspaceShardListerExpansion interface{}
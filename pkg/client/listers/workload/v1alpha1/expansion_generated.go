@@ -18,6 +18,14 @@ limitations under the License.
 
 package v1alpha1
 
+// LocationListerExpansion allows custom methods to be added to
+// LocationLister.
+type LocationListerExpansion interface{}
+
+// PlacementListerExpansion allows custom methods to be added to
+// PlacementLister.
+type PlacementListerExpansion interface{}
+
 // WorkloadClusterListerExpansion allows custom methods to be added to
 // WorkloadClusterLister.
 type WorkloadClusterListerExpansion interface{}
@@ -0,0 +1,74 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+
+	"github.com/kcp-dev/kcp/pkg/cliplugins/bind/plugin"
+)
+
+var (
+	bindExample = `
+	# bind the widgets APIExport of the root:acme:provider workspace into the current workspace
+	%[1]s bind apiexport root:acme:provider:widgets
+
+	# accept its claim on configmaps without prompting
+	%[1]s bind apiexport root:acme:provider:widgets --accept-permission-claim=configmaps
+`
+)
+
+// NewCmdBind provides a cobra command wrapping BindOptions
+func NewCmdBind(streams genericclioptions.IOStreams) *cobra.Command {
+	opts := plugin.NewBindOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:          "bind",
+		Short:        "Binds APIs into the current workspace",
+		Example:      fmt.Sprintf(bindExample, "kubectl kcp"),
+		SilenceUsage: true,
+	}
+
+	apiExportCmd := &cobra.Command{
+		Use:          "apiexport <workspace path>:<export name>",
+		Short:        "Binds an APIExport into the current workspace and waits for its APIs to be available",
+		Example:      fmt.Sprintf(bindExample, "kubectl kcp"),
+		SilenceUsage: true,
+		Args:         cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			return plugin.BindAPIExport(c.Context(), opts, args[0])
+		},
+		ValidArgsFunction: func(c *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) > 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			references, err := plugin.CompleteExportReferences(c.Context(), opts, toComplete)
+			if err != nil {
+				return nil, cobra.ShellCompDirectiveError
+			}
+			return references, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+		},
+	}
+	opts.BindFlags(apiExportCmd)
+
+	cmd.AddCommand(apiExportCmd)
+	return cmd
+}
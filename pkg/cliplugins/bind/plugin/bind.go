@@ -0,0 +1,245 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/tools/clientcmd"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+	kcpclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
+	"github.com/kcp-dev/kcp/pkg/cliplugins/helpers"
+)
+
+// BindOptions contains the options to bind an APIExport into the current workspace.
+type BindOptions struct {
+	KubectlOverrides *clientcmd.ConfigOverrides
+
+	// BindingName is the name of the APIBinding, the name of the APIExport if empty.
+	BindingName string
+	// AcceptedPermissionClaims lists the permission claims accepted without prompting,
+	// as resource.group.
+	AcceptedPermissionClaims []string
+	// AcceptAllPermissionClaims accepts all the permission claims without prompting.
+	AcceptAllPermissionClaims bool
+	// Timeout is the time to wait for the APIBinding to be bound.
+	Timeout time.Duration
+
+	genericclioptions.IOStreams
+}
+
+// NewBindOptions provides an instance of BindOptions with default values.
+func NewBindOptions(streams genericclioptions.IOStreams) *BindOptions {
+	return &BindOptions{
+		KubectlOverrides: &clientcmd.ConfigOverrides{},
+		Timeout:          time.Minute,
+
+		IOStreams: streams,
+	}
+}
+
+// BindFlags binds the options to the flags of the given command.
+func (o *BindOptions) BindFlags(cmd *cobra.Command) {
+	kubectlConfigOverrideFlags := clientcmd.RecommendedConfigOverrideFlags("")
+	kubectlConfigOverrideFlags.AuthOverrideFlags.ClientCertificate.LongName = ""
+	kubectlConfigOverrideFlags.AuthOverrideFlags.ClientKey.LongName = ""
+	kubectlConfigOverrideFlags.AuthOverrideFlags.Impersonate.LongName = ""
+	kubectlConfigOverrideFlags.AuthOverrideFlags.ImpersonateGroups.LongName = ""
+	kubectlConfigOverrideFlags.ContextOverrideFlags.AuthInfoName.LongName = ""
+	kubectlConfigOverrideFlags.ContextOverrideFlags.ClusterName.LongName = ""
+	kubectlConfigOverrideFlags.ContextOverrideFlags.Namespace.LongName = ""
+	kubectlConfigOverrideFlags.Timeout.LongName = ""
+	clientcmd.BindOverrideFlags(o.KubectlOverrides, cmd.PersistentFlags(), kubectlConfigOverrideFlags)
+
+	cmd.Flags().StringVar(&o.BindingName, "name", o.BindingName, "Name of the APIBinding, the name of the APIExport if empty")
+	cmd.Flags().StringSliceVar(&o.AcceptedPermissionClaims, "accept-permission-claim", o.AcceptedPermissionClaims, "Permission claim to accept without prompting, as resource.group")
+	cmd.Flags().BoolVar(&o.AcceptAllPermissionClaims, "accept-all-permission-claims", o.AcceptAllPermissionClaims, "Accept all the permission claims of the APIExport without prompting")
+	cmd.Flags().DurationVar(&o.Timeout, "timeout", o.Timeout, "Time to wait for the APIBinding to be bound")
+}
+
+// ParseExportReference splits an APIExport reference of the form <workspace path>:<export name>,
+// e.g. root:acme:widgets, into the logical cluster of the APIExport and its name.
+func ParseExportReference(reference string) (string, string, error) {
+	i := strings.LastIndex(reference, ":")
+	if i <= 0 || i == len(reference)-1 {
+		return "", "", fmt.Errorf("expected an APIExport reference of the form <workspace path>:<export name>, got %q", reference)
+	}
+	return reference[:i], reference[i+1:], nil
+}
+
+// BindAPIExport creates an APIBinding to the given APIExport in the current workspace,
+// waits for it to be bound and prints the resources it makes available.
+func BindAPIExport(ctx context.Context, opts *BindOptions, exportReference string) error {
+	exportClusterName, exportName, err := ParseExportReference(exportReference)
+	if err != nil {
+		return err
+	}
+
+	config, clusterName, err := helpers.ClusterConfig(clientcmd.NewNonInteractiveDeferredLoadingClientConfig(clientcmd.NewDefaultClientConfigLoadingRules(), opts.KubectlOverrides))
+	if err != nil {
+		return err
+	}
+	if clusterName == "" {
+		return errors.New("The current context doesn't point to a workspace")
+	}
+
+	clusterClient, err := kcpclient.NewClusterForConfig(config)
+	if err != nil {
+		return err
+	}
+
+	reference := &apisv1alpha1.WorkspaceExportReference{
+		Path:       exportClusterName,
+		ExportName: exportName,
+	}
+	var acceptedClaims []apisv1alpha1.PermissionClaim
+	export, err := clusterClient.Cluster(exportClusterName).ApisV1alpha1().APIExports().Get(ctx, exportName, metav1.GetOptions{})
+	switch {
+	case err == nil:
+		reference.IdentityHash = export.Status.IdentityHash
+		if acceptedClaims, err = acceptPermissionClaims(opts, export.Spec.PermissionClaims); err != nil {
+			return err
+		}
+	case apierrors.IsForbidden(err):
+		// Binding only requires the bind verb on the APIExport.
+		if len(opts.AcceptedPermissionClaims) > 0 || opts.AcceptAllPermissionClaims {
+			return fmt.Errorf("cannot read the permission claims of APIExport %s: %w", exportReference, err)
+		}
+	default:
+		return err
+	}
+
+	bindingName := opts.BindingName
+	if bindingName == "" {
+		bindingName = exportName
+	}
+	bindings := clusterClient.Cluster(clusterName).ApisV1alpha1().APIBindings()
+	if _, err := bindings.Create(ctx, &apisv1alpha1.APIBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: bindingName},
+		Spec: apisv1alpha1.APIBindingSpec{
+			Reference:                apisv1alpha1.ExportReference{Workspace: reference},
+			AcceptedPermissionClaims: acceptedClaims,
+		},
+	}, metav1.CreateOptions{}); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(opts.Out, "APIBinding %q created.\n", bindingName); err != nil {
+		return err
+	}
+
+	var binding *apisv1alpha1.APIBinding
+	var lastPhase apisv1alpha1.APIBindingPhaseType
+	err = wait.PollImmediate(500*time.Millisecond, opts.Timeout, func() (bool, error) {
+		binding, err = bindings.Get(ctx, bindingName, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		if phase := binding.Status.Phase; phase != lastPhase && phase != "" {
+			lastPhase = phase
+			if _, err := fmt.Fprintf(opts.Out, "APIBinding %q is %s.\n", bindingName, phase); err != nil {
+				return false, err
+			}
+		}
+		return binding.Status.Phase == apisv1alpha1.APIBindingPhaseBound, nil
+	})
+	if errors.Is(err, wait.ErrWaitTimeout) {
+		return fmt.Errorf("APIBinding %q not bound after %v%s", bindingName, opts.Timeout, failedConditions(binding))
+	} else if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintln(opts.Out, "Available resources:"); err != nil {
+		return err
+	}
+	for _, resource := range binding.Status.BoundResources {
+		gr := resource.Resource
+		if resource.Group != "" {
+			gr += "." + resource.Group
+		}
+		if _, err := fmt.Fprintf(opts.Out, "  %s\n", gr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// acceptPermissionClaims returns the permission claims accepted by the user, through the
+// options or by answering a prompt for each of them.
+func acceptPermissionClaims(opts *BindOptions, claims []apisv1alpha1.PermissionClaim) ([]apisv1alpha1.PermissionClaim, error) {
+	preaccepted := sets.NewString(opts.AcceptedPermissionClaims...)
+	in := bufio.NewReader(opts.In)
+
+	var accepted []apisv1alpha1.PermissionClaim
+	for _, claim := range claims {
+		gr := claim.Resource
+		if claim.Group != "" {
+			gr += "." + claim.Group
+		}
+		if opts.AcceptAllPermissionClaims || preaccepted.Has(gr) {
+			accepted = append(accepted, claim)
+			continue
+		}
+
+		if _, err := fmt.Fprintf(opts.Out, "The APIExport claims access to %s in this workspace. Accept? [y/N] ", gr); err != nil {
+			return nil, err
+		}
+		answer, err := in.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if answer = strings.ToLower(strings.TrimSpace(answer)); answer == "y" || answer == "yes" {
+			accepted = append(accepted, claim)
+		}
+		if err == io.EOF {
+			if _, err := fmt.Fprintln(opts.Out); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return accepted, nil
+}
+
+func failedConditions(binding *apisv1alpha1.APIBinding) string {
+	if binding == nil {
+		return ""
+	}
+	var messages []string
+	for _, condition := range binding.Status.Conditions {
+		if condition.Status == corev1.ConditionFalse && condition.Message != "" {
+			messages = append(messages, fmt.Sprintf("%s: %s", condition.Type, condition.Message))
+		}
+	}
+	if len(messages) == 0 {
+		return ""
+	}
+	return ": " + strings.Join(messages, ", ")
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+)
+
+func TestParseExportReference(t *testing.T) {
+	for _, tt := range []struct {
+		reference   string
+		wantCluster string
+		wantExport  string
+		wantErr     bool
+	}{
+		{reference: "root:acme:widgets", wantCluster: "root:acme", wantExport: "widgets"},
+		{reference: "acme:team:widgets", wantCluster: "acme:team", wantExport: "widgets"},
+		{reference: "widgets", wantErr: true},
+		{reference: ":widgets", wantErr: true},
+		{reference: "root:acme:", wantErr: true},
+	} {
+		t.Run(tt.reference, func(t *testing.T) {
+			cluster, export, err := ParseExportReference(tt.reference)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantCluster, cluster)
+			require.Equal(t, tt.wantExport, export)
+		})
+	}
+}
+
+func TestAcceptPermissionClaims(t *testing.T) {
+	configmaps := apisv1alpha1.PermissionClaim{Resource: "configmaps"}
+	deployments := apisv1alpha1.PermissionClaim{Group: "apps", Resource: "deployments"}
+	claims := []apisv1alpha1.PermissionClaim{configmaps, deployments}
+
+	for _, tt := range []struct {
+		name        string
+		input       string
+		accepted    []string
+		acceptAll   bool
+		want        []apisv1alpha1.PermissionClaim
+		wantPrompts int
+	}{
+		{name: "accept all", acceptAll: true, want: claims},
+		{name: "preaccepted", accepted: []string{"configmaps", "deployments.apps"}, want: claims},
+		{name: "prompt yes and no", input: "y\nn\n", want: []apisv1alpha1.PermissionClaim{configmaps}, wantPrompts: 2},
+		{name: "prompt for the rest", accepted: []string{"configmaps"}, input: "yes\n", want: claims, wantPrompts: 1},
+		{name: "eof denies", input: "", wantPrompts: 2},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			opts := NewBindOptions(genericclioptions.IOStreams{In: strings.NewReader(tt.input), Out: out, ErrOut: out})
+			opts.AcceptedPermissionClaims = tt.accepted
+			opts.AcceptAllPermissionClaims = tt.acceptAll
+
+			got, err := acceptPermissionClaims(opts, claims)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+			require.Equal(t, tt.wantPrompts, strings.Count(out.String(), "Accept? [y/N]"))
+		})
+	}
+}
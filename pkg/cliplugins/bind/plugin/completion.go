@@ -0,0 +1,96 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/clientcmd"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+	kcpclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
+	"github.com/kcp-dev/kcp/pkg/cliplugins/helpers"
+	workspaceplugin "github.com/kcp-dev/kcp/pkg/cliplugins/workspace/plugin"
+)
+
+// listAPIExportsFunc lists the APIExports of a logical cluster.
+type listAPIExportsFunc func(ctx context.Context, clusterName string) ([]apisv1alpha1.APIExport, error)
+
+// CompleteExportReferences returns the APIExport references starting with toComplete:
+// the logical clusters followed by a colon while the logical cluster is being typed,
+// and the APIExports of the logical cluster once it is complete.
+func CompleteExportReferences(ctx context.Context, opts *BindOptions, toComplete string) ([]string, error) {
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(clientcmd.NewDefaultClientConfigLoadingRules(), opts.KubectlOverrides)
+	config, _, err := helpers.ClusterConfig(clientConfig)
+	if err != nil {
+		return nil, err
+	}
+	clusterClient, err := kcpclient.NewClusterForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	listExports := func(ctx context.Context, clusterName string) ([]apisv1alpha1.APIExport, error) {
+		exports, err := clusterClient.Cluster(clusterName).ApisV1alpha1().APIExports().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return exports.Items, nil
+	}
+	return completeExportReferences(ctx, workspaceplugin.NewListWorkspacesFunc(clusterClient), listExports, toComplete)
+}
+
+func completeExportReferences(ctx context.Context, listWorkspaces workspaceplugin.ListWorkspacesFunc, listExports listAPIExportsFunc, toComplete string) ([]string, error) {
+	clusters, err := workspaceplugin.CompleteLogicalClusters(ctx, listWorkspaces, toComplete)
+	if err != nil {
+		return nil, err
+	}
+	candidates := sets.NewString()
+	for _, cluster := range clusters {
+		if !strings.HasSuffix(cluster, ":") {
+			cluster += ":"
+		}
+		candidates.Insert(cluster)
+	}
+
+	if i := strings.LastIndex(toComplete, ":"); i >= 0 && isLogicalClusterName(toComplete[:i]) {
+		exports, err := listExports(ctx, toComplete[:i])
+		if err != nil {
+			return nil, err
+		}
+		for _, export := range exports {
+			if reference := toComplete[:i] + ":" + export.Name; strings.HasPrefix(reference, toComplete) {
+				candidates.Insert(reference)
+			}
+		}
+	}
+
+	return candidates.List(), nil
+}
+
+// isLogicalClusterName returns whether the given name is a complete logical cluster name,
+// i.e. root, root:<org> or <org>:<workspace>.
+func isLogicalClusterName(name string) bool {
+	if name == helper.RootCluster {
+		return true
+	}
+	parts := strings.Split(name, ":")
+	return len(parts) == 2 && parts[0] != "" && parts[1] != ""
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+)
+
+func TestCompleteExportReferences(t *testing.T) {
+	workspaces := map[string][]string{
+		"root":      {"acme"},
+		"root:acme": {"provider"},
+	}
+	exports := map[string][]string{
+		"root":          {"tenancy"},
+		"root:acme":     {"widgets"},
+		"acme:provider": {"gadgets", "gizmos"},
+	}
+	listWorkspaces := func(ctx context.Context, clusterName string) ([]tenancyv1alpha1.ClusterWorkspace, error) {
+		var items []tenancyv1alpha1.ClusterWorkspace
+		for _, name := range workspaces[clusterName] {
+			items = append(items, tenancyv1alpha1.ClusterWorkspace{ObjectMeta: metav1.ObjectMeta{Name: name}})
+		}
+		return items, nil
+	}
+	listExports := func(ctx context.Context, clusterName string) ([]apisv1alpha1.APIExport, error) {
+		var items []apisv1alpha1.APIExport
+		for _, name := range exports[clusterName] {
+			items = append(items, apisv1alpha1.APIExport{ObjectMeta: metav1.ObjectMeta{Name: name}})
+		}
+		return items, nil
+	}
+
+	for toComplete, want := range map[string][]string{
+		"":                 {"acme:", "root:"},
+		"root:":            {"root:acme:", "root:tenancy"},
+		"root:acme:":       {"root:acme:widgets"},
+		"acme:":            {"acme:provider:"},
+		"acme:provider:":   {"acme:provider:gadgets", "acme:provider:gizmos"},
+		"acme:provider:gi": {"acme:provider:gizmos"},
+	} {
+		t.Run(toComplete, func(t *testing.T) {
+			got, err := completeExportReferences(context.Background(), listWorkspaces, listExports, toComplete)
+			require.NoError(t, err)
+			require.Equal(t, want, got)
+		})
+	}
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+
+	"github.com/kcp-dev/kcp/pkg/cliplugins/crd/plugin"
+)
+
+var (
+	snapshotExample = `
+	# convert the CRDs of a file to APIResourceSchemas and an APIExport exporting them
+	%[1]s crd snapshot -f crds.yaml --prefix v220301 > apiexport.yaml
+
+	# convert a CRD of the cluster of the current context
+	%[1]s crd snapshot widgets.example.com --prefix v220301 --export-name widgets
+`
+)
+
+// NewCmdCRD provides a cobra command wrapping SnapshotOptions
+func NewCmdCRD(streams genericclioptions.IOStreams) *cobra.Command {
+	opts := plugin.NewSnapshotOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:          "crd",
+		Short:        "Converts CustomResourceDefinitions for use in KCP",
+		Example:      fmt.Sprintf(snapshotExample, "kubectl kcp"),
+		SilenceUsage: true,
+	}
+
+	snapshotCmd := &cobra.Command{
+		Use:          "snapshot [crd name...] --prefix <prefix>",
+		Short:        "Converts CRDs to immutable APIResourceSchemas and a skeleton APIExport",
+		Example:      fmt.Sprintf(snapshotExample, "kubectl kcp"),
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			return plugin.Snapshot(c.Context(), opts, args)
+		},
+	}
+	opts.BindFlags(snapshotCmd)
+
+	cmd.AddCommand(snapshotCmd)
+	return cmd
+}
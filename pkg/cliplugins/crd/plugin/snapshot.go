@@ -0,0 +1,246 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
+
+	"github.com/kcp-dev/kcp/pkg/admission/apiresourceschema"
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+	apishelper "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1/helper"
+)
+
+// SnapshotOptions contains the options to convert CRDs to APIResourceSchemas.
+type SnapshotOptions struct {
+	KubectlOverrides *clientcmd.ConfigOverrides
+
+	// Filename is the file the CRDs are read from, - for stdin. The CRDs are read from
+	// the cluster of the current context if empty.
+	Filename string
+	// Prefix is the prefix of the names of the APIResourceSchemas, e.g. a date or a
+	// release, which makes them immutable snapshots of the CRDs.
+	Prefix string
+	// ExportName is the name of the APIExport exporting the APIResourceSchemas. The
+	// group of the first CRD is used if empty.
+	ExportName string
+
+	genericclioptions.IOStreams
+}
+
+// NewSnapshotOptions provides an instance of SnapshotOptions with default values.
+func NewSnapshotOptions(streams genericclioptions.IOStreams) *SnapshotOptions {
+	return &SnapshotOptions{
+		KubectlOverrides: &clientcmd.ConfigOverrides{},
+
+		IOStreams: streams,
+	}
+}
+
+// BindFlags binds the options to the flags of the given command.
+func (o *SnapshotOptions) BindFlags(cmd *cobra.Command) {
+	kubectlConfigOverrideFlags := clientcmd.RecommendedConfigOverrideFlags("")
+	kubectlConfigOverrideFlags.AuthOverrideFlags.ClientCertificate.LongName = ""
+	kubectlConfigOverrideFlags.AuthOverrideFlags.ClientKey.LongName = ""
+	kubectlConfigOverrideFlags.AuthOverrideFlags.Impersonate.LongName = ""
+	kubectlConfigOverrideFlags.AuthOverrideFlags.ImpersonateGroups.LongName = ""
+	kubectlConfigOverrideFlags.ContextOverrideFlags.AuthInfoName.LongName = ""
+	kubectlConfigOverrideFlags.ContextOverrideFlags.ClusterName.LongName = ""
+	kubectlConfigOverrideFlags.ContextOverrideFlags.Namespace.LongName = ""
+	kubectlConfigOverrideFlags.Timeout.LongName = ""
+	clientcmd.BindOverrideFlags(o.KubectlOverrides, cmd.PersistentFlags(), kubectlConfigOverrideFlags)
+
+	cmd.Flags().StringVarP(&o.Filename, "filename", "f", o.Filename, "File to read the CRDs from, - for stdin. The CRDs are read from the cluster of the current context if empty")
+	cmd.Flags().StringVar(&o.Prefix, "prefix", o.Prefix, "Prefix of the names of the APIResourceSchemas, e.g. a date or a release")
+	cmd.Flags().StringVar(&o.ExportName, "export-name", o.ExportName, "Name of the APIExport, the group of the first CRD if empty")
+}
+
+// Snapshot converts CRDs to APIResourceSchemas named <prefix>.<plural>.<group>, and
+// prints them followed by an APIExport exporting them. The CRDs are read from the
+// options file, or from the cluster of the current context by name. Without names,
+// all the CRDs of the file or the cluster are converted.
+func Snapshot(ctx context.Context, opts *SnapshotOptions, names []string) error {
+	if opts.Prefix == "" {
+		return errors.New("--prefix is required")
+	}
+
+	var crds []*apiextensionsv1.CustomResourceDefinition
+	var err error
+	if opts.Filename != "" {
+		crds, err = readCRDs(opts, names)
+	} else {
+		crds, err = getCRDs(ctx, opts, names)
+	}
+	if err != nil {
+		return err
+	}
+	if len(crds) == 0 {
+		return errors.New("no CustomResourceDefinition found")
+	}
+
+	objects, err := snapshotObjects(crds, opts.Prefix, opts.ExportName)
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	for _, obj := range objects {
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		out.WriteString("---\n")
+		out.Write(data)
+	}
+	_, err = out.WriteTo(opts.Out)
+	return err
+}
+
+// snapshotObjects returns the APIResourceSchemas of the given CRDs, followed by an
+// APIExport exporting them.
+func snapshotObjects(crds []*apiextensionsv1.CustomResourceDefinition, prefix, exportName string) ([]runtime.Object, error) {
+	if exportName == "" {
+		exportName = crds[0].Spec.Group
+	}
+	export := &apisv1alpha1.APIExport{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: apisv1alpha1.SchemeGroupVersion.String(),
+			Kind:       "APIExport",
+		},
+		ObjectMeta: metav1.ObjectMeta{Name: exportName},
+	}
+
+	var objects []runtime.Object
+	for _, crd := range crds {
+		schema, err := apishelper.CRDToAPIResourceSchema(crd, prefix)
+		if err != nil {
+			return nil, err
+		}
+		if errs := apiresourceschema.ValidateAPIResourceSchema(schema); len(errs) > 0 {
+			return nil, fmt.Errorf("CRD %s cannot be converted to an APIResourceSchema: %w", crd.Name, errs.ToAggregate())
+		}
+		objects = append(objects, schema)
+		export.Spec.LatestResourceSchemas = append(export.Spec.LatestResourceSchemas, schema.Name)
+	}
+	return append(objects, export), nil
+}
+
+// readCRDs reads the CRDs with the given names from the options file, or all of them if
+// no name is given. Other objects are ignored.
+func readCRDs(opts *SnapshotOptions, names []string) ([]*apiextensionsv1.CustomResourceDefinition, error) {
+	var in io.Reader = opts.In
+	if opts.Filename != "-" {
+		f, err := os.Open(opts.Filename)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	wanted := map[string]bool{}
+	for _, name := range names {
+		wanted[name] = false
+	}
+	var crds []*apiextensionsv1.CustomResourceDefinition
+	decoder := utilyaml.NewYAMLOrJSONDecoder(in, 4096)
+	for {
+		var u unstructured.Unstructured
+		if err := decoder.Decode(&u.Object); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", opts.Filename, err)
+		}
+		if u.Object == nil || u.GroupVersionKind().GroupKind() != apiextensionsv1.Kind("CustomResourceDefinition") {
+			continue
+		}
+		if u.GroupVersionKind().Version != apiextensionsv1.SchemeGroupVersion.Version {
+			return nil, fmt.Errorf("CRD %s is %s, only %s is supported", u.GetName(), u.GetAPIVersion(), apiextensionsv1.SchemeGroupVersion)
+		}
+		if _, found := wanted[u.GetName()]; len(names) > 0 && !found {
+			continue
+		}
+		crd := &apiextensionsv1.CustomResourceDefinition{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, crd); err != nil {
+			return nil, fmt.Errorf("failed to decode CRD %s: %w", u.GetName(), err)
+		}
+		wanted[crd.Name] = true
+		crds = append(crds, crd)
+	}
+
+	var missing []string
+	for name, found := range wanted {
+		if !found {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("CRDs %v not found in %s", missing, opts.Filename)
+	}
+	return crds, nil
+}
+
+// getCRDs gets the CRDs with the given names from the cluster of the current context,
+// or all of them if no name is given.
+func getCRDs(ctx context.Context, opts *SnapshotOptions, names []string) ([]*apiextensionsv1.CustomResourceDefinition, error) {
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(clientcmd.NewDefaultClientConfigLoadingRules(), opts.KubectlOverrides).ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	client, err := apiextensionsclient.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var crds []*apiextensionsv1.CustomResourceDefinition
+	if len(names) == 0 {
+		list, err := client.ApiextensionsV1().CustomResourceDefinitions().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			crds = append(crds, &list.Items[i])
+		}
+		return crds, nil
+	}
+	for _, name := range names {
+		crd, err := client.ApiextensionsV1().CustomResourceDefinitions().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		crds = append(crds, crd)
+	}
+	return crds, nil
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+const crdsYAML = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ignored
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  names:
+    plural: widgets
+    singular: widget
+    kind: Widget
+    listKind: WidgetList
+  scope: Namespaced
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            properties:
+              size:
+                type: integer
+                default: 1
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: gadgets.example.com
+spec:
+  group: example.com
+  names:
+    plural: gadgets
+    singular: gadget
+    kind: Gadget
+    listKind: GadgetList
+  scope: Cluster
+  preserveUnknownFields: true
+  versions:
+  - name: v1
+    served: true
+    storage: true
+`
+
+func TestSnapshot(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		input    string
+		names    []string
+		prefix   string
+		export   string
+		want     []string
+		wantErrs string
+	}{
+		{
+			name:   "all crds",
+			input:  crdsYAML,
+			prefix: "v220301",
+			want: []string{
+				"kind: APIResourceSchema\nmetadata:\n  creationTimestamp: null\n  name: v220301.widgets.example.com",
+				"kind: APIResourceSchema\nmetadata:\n  creationTimestamp: null\n  name: v220301.gadgets.example.com",
+				"kind: APIExport\nmetadata:\n  creationTimestamp: null\n  name: example.com\nspec:\n  latestResourceSchemas:\n  - v220301.widgets.example.com\n  - v220301.gadgets.example.com",
+				"x-kubernetes-preserve-unknown-fields: true",
+			},
+		},
+		{
+			name:   "named crd",
+			input:  crdsYAML,
+			names:  []string{"gadgets.example.com"},
+			prefix: "v1",
+			export: "gadgets",
+			want:   []string{"name: gadgets\nspec:\n  latestResourceSchemas:\n  - v1.gadgets.example.com\n"},
+		},
+		{name: "missing crd", input: crdsYAML, names: []string{"foos.example.com"}, prefix: "v1", wantErrs: "[foos.example.com] not found"},
+		{name: "missing prefix", input: crdsYAML, wantErrs: "--prefix is required"},
+		{name: "invalid prefix", input: crdsYAML, prefix: "V1", wantErrs: "cannot be converted"},
+		{name: "no crd", input: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: foo\n", prefix: "v1", wantErrs: "no CustomResourceDefinition found"},
+		{
+			name:     "v1beta1 crd",
+			input:    "apiVersion: apiextensions.k8s.io/v1beta1\nkind: CustomResourceDefinition\nmetadata:\n  name: foos.example.com\n",
+			prefix:   "v1",
+			wantErrs: "only apiextensions.k8s.io/v1 is supported",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			opts := NewSnapshotOptions(genericclioptions.IOStreams{In: strings.NewReader(tt.input), Out: out, ErrOut: out})
+			opts.Filename = "-"
+			opts.Prefix = tt.prefix
+			opts.ExportName = tt.export
+
+			err := Snapshot(context.Background(), opts, tt.names)
+			if tt.wantErrs != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.wantErrs)
+				return
+			}
+			require.NoError(t, err)
+			for _, want := range tt.want {
+				require.Contains(t, out.String(), want)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+
+	"github.com/kcp-dev/kcp/pkg/cliplugins/encryption/plugin"
+)
+
+var (
+	rewriteExample = `
+	# store the secrets of the current workspace with its current encryption provider configuration
+	%[1]s encryption rewrite secrets
+
+	# store the secrets and the widgets of the current workspace and its descendant workspaces
+	%[1]s encryption rewrite secrets widgets.v1alpha1.example.io --recursive
+`
+)
+
+// NewCmdEncryption provides a cobra command wrapping RewriteOptions
+func NewCmdEncryption(streams genericclioptions.IOStreams) *cobra.Command {
+	opts := plugin.NewRewriteOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:          "encryption",
+		Short:        "Manages the encryption at rest of workspaces",
+		Example:      fmt.Sprintf(rewriteExample, "kubectl kcp"),
+		SilenceUsage: true,
+	}
+
+	rewriteCmd := &cobra.Command{
+		Use:          "rewrite <resource>[.<version>.<group>]...",
+		Short:        "Rewrites objects such that they are stored with the current encryption provider configuration of their workspace",
+		Example:      fmt.Sprintf(rewriteExample, "kubectl kcp"),
+		SilenceUsage: true,
+		Args:         cobra.MinimumNArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			return plugin.Rewrite(c.Context(), opts, args)
+		},
+	}
+	opts.BindFlags(rewriteCmd)
+
+	cmd.AddCommand(rewriteCmd)
+	return cmd
+}
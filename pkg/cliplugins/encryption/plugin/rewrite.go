@@ -0,0 +1,209 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/clientcmd"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+	kcpclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
+	"github.com/kcp-dev/kcp/pkg/cliplugins/helpers"
+)
+
+// RewriteOptions contains the options to rewrite the objects of the current workspace.
+type RewriteOptions struct {
+	KubectlOverrides *clientcmd.ConfigOverrides
+
+	// Recursive rewrites the objects of the descendant workspaces too.
+	Recursive bool
+	// ChunkSize is the number of objects listed at once.
+	ChunkSize int64
+
+	genericclioptions.IOStreams
+}
+
+// NewRewriteOptions provides an instance of RewriteOptions with default values.
+func NewRewriteOptions(streams genericclioptions.IOStreams) *RewriteOptions {
+	return &RewriteOptions{
+		KubectlOverrides: &clientcmd.ConfigOverrides{},
+		ChunkSize:        500,
+
+		IOStreams: streams,
+	}
+}
+
+// BindFlags binds the options to the flags of the given command.
+func (o *RewriteOptions) BindFlags(cmd *cobra.Command) {
+	kubectlConfigOverrideFlags := clientcmd.RecommendedConfigOverrideFlags("")
+	kubectlConfigOverrideFlags.AuthOverrideFlags.ClientCertificate.LongName = ""
+	kubectlConfigOverrideFlags.AuthOverrideFlags.ClientKey.LongName = ""
+	kubectlConfigOverrideFlags.AuthOverrideFlags.Impersonate.LongName = ""
+	kubectlConfigOverrideFlags.AuthOverrideFlags.ImpersonateGroups.LongName = ""
+	kubectlConfigOverrideFlags.ContextOverrideFlags.AuthInfoName.LongName = ""
+	kubectlConfigOverrideFlags.ContextOverrideFlags.ClusterName.LongName = ""
+	kubectlConfigOverrideFlags.ContextOverrideFlags.Namespace.LongName = ""
+	kubectlConfigOverrideFlags.Timeout.LongName = ""
+	clientcmd.BindOverrideFlags(o.KubectlOverrides, cmd.PersistentFlags(), kubectlConfigOverrideFlags)
+
+	cmd.Flags().BoolVarP(&o.Recursive, "recursive", "r", o.Recursive, "Rewrite the objects of the descendant workspaces too")
+	cmd.Flags().Int64Var(&o.ChunkSize, "chunk-size", o.ChunkSize, "Number of objects listed at once")
+}
+
+// ParseResource parses a resource of the form <resource>[.<version>.<group>], e.g. secrets
+// or widgets.v1alpha1.example.io. Resources without group default to version v1.
+func ParseResource(arg string) (schema.GroupVersionResource, error) {
+	gvr, gr := schema.ParseResourceArg(arg)
+	switch {
+	case gvr != nil:
+		return *gvr, nil
+	case gr.Resource != "" && gr.Group == "":
+		return gr.WithVersion("v1"), nil
+	default:
+		return schema.GroupVersionResource{}, fmt.Errorf("expected a resource of the form <resource>[.<version>.<group>], got %q", arg)
+	}
+}
+
+// ListWorkspacesFunc lists the ClusterWorkspaces of a logical cluster.
+type ListWorkspacesFunc func(ctx context.Context, clusterName string) ([]tenancyv1alpha1.ClusterWorkspace, error)
+
+// Rewrite reads and writes back unchanged every object of the given resources in the
+// workspace of the current context, and in its descendant workspaces if recursive, such
+// that the objects are stored with the current encryption provider configuration of
+// their workspace.
+func Rewrite(ctx context.Context, opts *RewriteOptions, resources []string) error {
+	gvrs := make([]schema.GroupVersionResource, 0, len(resources))
+	for _, resource := range resources {
+		gvr, err := ParseResource(resource)
+		if err != nil {
+			return err
+		}
+		gvrs = append(gvrs, gvr)
+	}
+
+	config, clusterName, err := helpers.ClusterConfig(clientcmd.NewNonInteractiveDeferredLoadingClientConfig(clientcmd.NewDefaultClientConfigLoadingRules(), opts.KubectlOverrides))
+	if err != nil {
+		return err
+	}
+	if clusterName == "" {
+		return errors.New("The current context doesn't point to a workspace")
+	}
+
+	dynamicClusterClient, err := dynamic.NewClusterForConfig(config)
+	if err != nil {
+		return err
+	}
+	clusterNames := []string{clusterName}
+	if opts.Recursive {
+		kcpClusterClient, err := kcpclient.NewClusterForConfig(config)
+		if err != nil {
+			return err
+		}
+		list := func(ctx context.Context, clusterName string) ([]tenancyv1alpha1.ClusterWorkspace, error) {
+			workspaces, err := kcpClusterClient.Cluster(clusterName).TenancyV1alpha1().ClusterWorkspaces().List(ctx, metav1.ListOptions{})
+			if err != nil {
+				return nil, err
+			}
+			return workspaces.Items, nil
+		}
+		if clusterNames, err = workspaceSubtree(ctx, list, clusterName); err != nil {
+			return err
+		}
+	}
+
+	for _, clusterName := range clusterNames {
+		for _, gvr := range gvrs {
+			count, err := rewriteObjects(ctx, dynamicClusterClient.Cluster(clusterName).Resource(gvr), opts.ChunkSize)
+			if err != nil {
+				return fmt.Errorf("failed to rewrite %s in workspace %s: %w", gvr.GroupResource(), clusterName, err)
+			}
+			if _, err := fmt.Fprintf(opts.Out, "Rewrote %d %s in workspace %s.\n", count, gvr.GroupResource(), clusterName); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// workspaceSubtree returns the given logical cluster followed by the logical clusters of
+// its descendant workspaces, parents before their children.
+func workspaceSubtree(ctx context.Context, list ListWorkspacesFunc, clusterName string) ([]string, error) {
+	clusterNames := []string{clusterName}
+	for i := 0; i < len(clusterNames); i++ {
+		// Only the root and organization logical clusters have child workspaces.
+		if clusterNames[i] != helper.RootCluster && !strings.HasPrefix(clusterNames[i], helper.RootCluster+":") {
+			continue
+		}
+		workspaces, err := list(ctx, clusterNames[i])
+		if err != nil {
+			return nil, err
+		}
+		for j := range workspaces {
+			ws := &workspaces[j]
+			if ws.ClusterName == "" {
+				ws.ClusterName = clusterNames[i]
+			}
+			childClusterName, err := helper.EncodeLogicalClusterName(ws)
+			if err != nil {
+				return nil, err
+			}
+			clusterNames = append(clusterNames, childClusterName)
+		}
+	}
+	return clusterNames, nil
+}
+
+// rewriteObjects updates every object of the resource unchanged and returns the number of
+// objects rewritten. Objects deleted or updated by someone else in the meantime have
+// already been written again, or are gone, and are skipped.
+func rewriteObjects(ctx context.Context, client dynamic.NamespaceableResourceInterface, chunkSize int64) (int, error) {
+	count := 0
+	listOptions := metav1.ListOptions{Limit: chunkSize}
+	for {
+		objs, err := client.List(ctx, listOptions)
+		if err != nil {
+			return count, err
+		}
+		for i := range objs.Items {
+			obj := &objs.Items[i]
+			_, err := client.Namespace(obj.GetNamespace()).Update(ctx, obj, metav1.UpdateOptions{})
+			switch {
+			case err == nil:
+				count++
+			case apierrors.IsNotFound(err), apierrors.IsConflict(err):
+			default:
+				return count, err
+			}
+		}
+		if objs.GetContinue() == "" {
+			return count, nil
+		}
+		listOptions.Continue = objs.GetContinue()
+	}
+}
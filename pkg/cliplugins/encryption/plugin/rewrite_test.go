@@ -0,0 +1,105 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+)
+
+func TestParseResource(t *testing.T) {
+	for _, tt := range []struct {
+		arg     string
+		want    schema.GroupVersionResource
+		wantErr bool
+	}{
+		{arg: "secrets", want: schema.GroupVersionResource{Version: "v1", Resource: "secrets"}},
+		{arg: "widgets.v1alpha1.example.io", want: schema.GroupVersionResource{Group: "example.io", Version: "v1alpha1", Resource: "widgets"}},
+		{arg: "deployments.apps", wantErr: true},
+		{arg: "", wantErr: true},
+	} {
+		t.Run(tt.arg, func(t *testing.T) {
+			got, err := ParseResource(tt.arg)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestWorkspaceSubtree(t *testing.T) {
+	workspaces := map[string][]string{
+		"root":      {"acme", "beta"},
+		"root:acme": {"team"},
+		"acme:team": {"unexpected"},
+	}
+	list := func(ctx context.Context, clusterName string) ([]tenancyv1alpha1.ClusterWorkspace, error) {
+		var items []tenancyv1alpha1.ClusterWorkspace
+		for _, name := range workspaces[clusterName] {
+			items = append(items, tenancyv1alpha1.ClusterWorkspace{ObjectMeta: metav1.ObjectMeta{Name: name}})
+		}
+		return items, nil
+	}
+
+	got, err := workspaceSubtree(context.Background(), list, "root")
+	require.NoError(t, err)
+	require.Equal(t, []string{"root", "root:acme", "root:beta", "acme:team"}, got)
+
+	got, err = workspaceSubtree(context.Background(), list, "acme:team")
+	require.NoError(t, err)
+	require.Equal(t, []string{"acme:team"}, got)
+}
+
+func TestRewriteObjects(t *testing.T) {
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+	secret := func(namespace, name string) runtime.Object {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion("v1")
+		obj.SetKind("Secret")
+		obj.SetNamespace(namespace)
+		obj.SetName(name)
+		return obj
+	}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{gvr: "SecretList"},
+		secret("default", "a"), secret("default", "b"), secret("other", "c"))
+
+	count, err := rewriteObjects(context.Background(), client.Resource(gvr), 500)
+	require.NoError(t, err)
+	require.Equal(t, 3, count)
+
+	var updated []string
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "update" {
+			updated = append(updated, action.GetNamespace())
+		}
+	}
+	require.ElementsMatch(t, []string{"default", "default", "other"}, updated)
+}
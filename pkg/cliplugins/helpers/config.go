@@ -0,0 +1,49 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"net/url"
+	"strings"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// ClusterConfig returns the config of the given kubeconfig without the logical cluster
+// path of its server, for use with cluster clients, and that logical cluster. The
+// logical cluster is empty if the server doesn't point to one.
+func ClusterConfig(clientConfig clientcmd.ClientConfig) (*rest.Config, string, error) {
+	config, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, "", err
+	}
+	// The server of workspace contexts points to the logical cluster, e.g.
+	// https://kcp.example.com/clusters/root:acme. Cluster clients add that part.
+	serverURL, err := url.Parse(config.Host)
+	if err != nil {
+		return nil, "", err
+	}
+	clusterName := ""
+	if strings.HasPrefix(serverURL.Path, "/clusters/") {
+		clusterName = strings.TrimPrefix(serverURL.Path, "/clusters/")
+		serverURL.Path = ""
+	}
+	config = rest.CopyConfig(config)
+	config.Host = serverURL.String()
+	return config, clusterName, nil
+}
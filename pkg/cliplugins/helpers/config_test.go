@@ -0,0 +1,53 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestClusterConfig(t *testing.T) {
+	for _, tt := range []struct {
+		server      string
+		wantHost    string
+		wantCluster string
+	}{
+		{server: "https://kcp.example.com/clusters/root:acme", wantHost: "https://kcp.example.com", wantCluster: "root:acme"},
+		{server: "https://kcp.example.com:6443/clusters/acme:team", wantHost: "https://kcp.example.com:6443", wantCluster: "acme:team"},
+		{server: "https://kcp.example.com", wantHost: "https://kcp.example.com"},
+		{server: "https://kcp.example.com/services/workspaces/root/personal", wantHost: "https://kcp.example.com/services/workspaces/root/personal"},
+	} {
+		t.Run(tt.server, func(t *testing.T) {
+			clientConfig := clientcmd.NewDefaultClientConfig(clientcmdapi.Config{
+				Clusters:       map[string]*clientcmdapi.Cluster{"kcp": {Server: tt.server}},
+				AuthInfos:      map[string]*clientcmdapi.AuthInfo{"kcp": {Token: "token"}},
+				Contexts:       map[string]*clientcmdapi.Context{"kcp": {Cluster: "kcp", AuthInfo: "kcp"}},
+				CurrentContext: "kcp",
+			}, nil)
+			config, clusterName, err := ClusterConfig(clientConfig)
+			require.NoError(t, err)
+			require.Equal(t, tt.wantHost, config.Host)
+			require.Equal(t, tt.wantCluster, clusterName)
+			require.Equal(t, "token", config.BearerToken)
+		})
+	}
+}
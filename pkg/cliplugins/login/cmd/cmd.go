@@ -0,0 +1,56 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+
+	"github.com/kcp-dev/kcp/pkg/cliplugins/login/plugin"
+)
+
+var (
+	loginExample = `
+	# log in to kcp with the device flow of an OpenID Connect provider
+	%[1]s login https://kcp.example.com --issuer-url=https://sso.example.com --client-id=kcp
+
+	# log in with a web browser
+	%[1]s login https://kcp.example.com --issuer-url=https://sso.example.com --client-id=kcp --flow=browser
+`
+)
+
+// NewCmdLogin provides a cobra command wrapping LoginOptions
+func NewCmdLogin(streams genericclioptions.IOStreams) *cobra.Command {
+	opts := plugin.NewLoginOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:          "login <server>",
+		Short:        "Logs in to kcp with OpenID Connect and uses the root workspace",
+		Example:      fmt.Sprintf(loginExample, "kubectl kcp"),
+		SilenceUsage: true,
+		Args:         cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			return plugin.Login(c.Context(), opts, args[0])
+		},
+	}
+	opts.BindFlags(cmd)
+
+	return cmd
+}
@@ -0,0 +1,469 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+const (
+	// rootContextName is the kubeconfig context of the root workspace, named like the
+	// contexts of the workspace plugin.
+	rootContextName = "workspace.kcp.dev/root"
+
+	// DeviceFlow and BrowserFlow are the supported OIDC flows.
+	DeviceFlow  = "device"
+	BrowserFlow = "browser"
+
+	deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+)
+
+// LoginOptions contains the options to log in to kcp with an OpenID Connect provider.
+type LoginOptions struct {
+	// IssuerURL is the URL of the OpenID Connect issuer trusted by kcp.
+	IssuerURL string
+	// ClientID is the OpenID Connect client the ID token is issued for.
+	ClientID string
+	// ClientSecret is the secret of the client, if it is not a public client.
+	ClientSecret string
+	// Scopes are the scopes requested in addition to openid.
+	Scopes []string
+	// Flow is the flow used to get the token: device, or browser. The device flow is
+	// used if the issuer supports it when empty.
+	Flow string
+	// Timeout is the time to wait for the user to log in.
+	Timeout time.Duration
+
+	// CertificateAuthority is the CA file the kcp serving certificate is verified with.
+	CertificateAuthority string
+	// InsecureSkipTLSVerify disables the verification of the kcp serving certificate.
+	InsecureSkipTLSVerify bool
+
+	// PathOptions locates the kubeconfig the context of the root workspace is written to.
+	PathOptions *clientcmd.PathOptions
+
+	// httpClient is the client of the OpenID Connect provider.
+	httpClient *http.Client
+	// openBrowser opens the given URL in a web browser.
+	openBrowser func(url string) error
+
+	genericclioptions.IOStreams
+}
+
+// NewLoginOptions provides an instance of LoginOptions with default values.
+func NewLoginOptions(streams genericclioptions.IOStreams) *LoginOptions {
+	return &LoginOptions{
+		Timeout:     5 * time.Minute,
+		PathOptions: clientcmd.NewDefaultPathOptions(),
+		httpClient:  http.DefaultClient,
+		openBrowser: openBrowser,
+
+		IOStreams: streams,
+	}
+}
+
+// BindFlags binds the options to the flags of the given command.
+func (o *LoginOptions) BindFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.IssuerURL, "issuer-url", o.IssuerURL, "URL of the OpenID Connect issuer trusted by kcp")
+	cmd.Flags().StringVar(&o.ClientID, "client-id", o.ClientID, "OpenID Connect client the ID token is issued for")
+	cmd.Flags().StringVar(&o.ClientSecret, "client-secret", o.ClientSecret, "Secret of the OpenID Connect client, for clients which are not public")
+	cmd.Flags().StringSliceVar(&o.Scopes, "scope", o.Scopes, "Scopes requested in addition to openid")
+	cmd.Flags().StringVar(&o.Flow, "flow", o.Flow, "Flow used to log in, device or browser. The device flow is used if the issuer supports it when empty")
+	cmd.Flags().DurationVar(&o.Timeout, "timeout", o.Timeout, "Time to wait for the login to complete")
+	cmd.Flags().StringVar(&o.CertificateAuthority, "certificate-authority", o.CertificateAuthority, "Path to a CA file the kcp serving certificate is verified with")
+	cmd.Flags().BoolVar(&o.InsecureSkipTLSVerify, "insecure-skip-tls-verify", o.InsecureSkipTLSVerify, "Don't verify the kcp serving certificate")
+	cmd.Flags().StringVar(&o.PathOptions.LoadingRules.ExplicitPath, "kubeconfig", o.PathOptions.LoadingRules.ExplicitPath, "Kubeconfig the context of the root workspace is written to")
+}
+
+// providerMetadata is the subset of the OpenID Connect discovery document used to log in.
+type providerMetadata struct {
+	Issuer                      string `json:"issuer"`
+	AuthorizationEndpoint       string `json:"authorization_endpoint"`
+	TokenEndpoint               string `json:"token_endpoint"`
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+}
+
+type deviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+type tokenResponse struct {
+	IDToken string `json:"id_token"`
+
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Login logs in to the kcp server at the given URL, typically the front proxy, with the
+// OpenID Connect device or browser flow. The ID token is written to the kubeconfig in a
+// context pointing to the root workspace, which becomes the current context.
+func Login(ctx context.Context, opts *LoginOptions, server string) error {
+	if opts.IssuerURL == "" || opts.ClientID == "" {
+		return errors.New("--issuer-url and --client-id are required")
+	}
+	if opts.Flow != "" && opts.Flow != DeviceFlow && opts.Flow != BrowserFlow {
+		return fmt.Errorf("unknown flow %q, expected %s or %s", opts.Flow, DeviceFlow, BrowserFlow)
+	}
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return err
+	}
+	if serverURL.Scheme != "https" || serverURL.Host == "" {
+		return fmt.Errorf("expected an https URL, got %q", server)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	metadata, err := discover(ctx, opts.httpClient, opts.IssuerURL)
+	if err != nil {
+		return err
+	}
+	flow := opts.Flow
+	if flow == "" {
+		flow = BrowserFlow
+		if metadata.DeviceAuthorizationEndpoint != "" {
+			flow = DeviceFlow
+		}
+	}
+
+	var idToken string
+	switch flow {
+	case DeviceFlow:
+		idToken, err = deviceFlow(ctx, opts, metadata)
+	case BrowserFlow:
+		idToken, err = browserFlow(ctx, opts, metadata)
+	}
+	if err != nil {
+		return err
+	}
+
+	serverURL.Path = "/clusters/root"
+	if err := writeKubeconfig(opts, serverURL.String(), idToken); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(opts.Out, "Logged in, current workspace is \"root\".\n")
+	return err
+}
+
+// discover gets the OpenID Connect discovery document of the given issuer.
+func discover(ctx context.Context, client *http.Client, issuerURL string) (*providerMetadata, error) {
+	wellKnown := strings.TrimSuffix(issuerURL, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the OpenID Connect configuration of %s: %w", issuerURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get the OpenID Connect configuration of %s: %s", issuerURL, resp.Status)
+	}
+
+	var metadata providerMetadata
+	if err := json.NewDecoder(resp.Body).Decode(&metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode the OpenID Connect configuration of %s: %w", issuerURL, err)
+	}
+	if metadata.Issuer != issuerURL {
+		return nil, fmt.Errorf("the OpenID Connect configuration of %s is for issuer %q", issuerURL, metadata.Issuer)
+	}
+	if metadata.TokenEndpoint == "" {
+		return nil, fmt.Errorf("the OpenID Connect configuration of %s has no token endpoint", issuerURL)
+	}
+	return &metadata, nil
+}
+
+// deviceFlow gets an ID token with the OAuth 2.0 device authorization grant (RFC 8628):
+// the user logs in on another device with a code, while the token endpoint is polled.
+func deviceFlow(ctx context.Context, opts *LoginOptions, metadata *providerMetadata) (string, error) {
+	if metadata.DeviceAuthorizationEndpoint == "" {
+		return "", fmt.Errorf("issuer %s doesn't support the device flow", metadata.Issuer)
+	}
+
+	form := url.Values{
+		"client_id": {opts.ClientID},
+		"scope":     {strings.Join(append([]string{"openid"}, opts.Scopes...), " ")},
+	}
+	var authorization deviceAuthorizationResponse
+	if err := postForm(ctx, opts, metadata.DeviceAuthorizationEndpoint, form, &authorization); err != nil {
+		return "", fmt.Errorf("failed to start the device flow: %w", err)
+	}
+	if authorization.VerificationURIComplete != "" {
+		if _, err := fmt.Fprintf(opts.ErrOut, "To log in, open %s and confirm the code %s.\n", authorization.VerificationURIComplete, authorization.UserCode); err != nil {
+			return "", err
+		}
+	} else {
+		if _, err := fmt.Fprintf(opts.ErrOut, "To log in, open %s and enter the code %s.\n", authorization.VerificationURI, authorization.UserCode); err != nil {
+			return "", err
+		}
+	}
+
+	interval := time.Duration(authorization.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	form = url.Values{
+		"grant_type":  {deviceCodeGrantType},
+		"device_code": {authorization.DeviceCode},
+		"client_id":   {opts.ClientID},
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("login not completed: %w", ctx.Err())
+		case <-time.After(interval):
+		}
+
+		token, err := requestToken(ctx, opts, metadata.TokenEndpoint, form)
+		if err != nil {
+			return "", err
+		}
+		switch token.Error {
+		case "":
+			return token.IDToken, nil
+		case "authorization_pending":
+		case "slow_down":
+			interval += 5 * time.Second
+		default:
+			return "", tokenError(token)
+		}
+	}
+}
+
+// browserFlow gets an ID token with the authorization code flow and PKCE (RFC 7636): the
+// user logs in with a web browser, which is redirected to a local server with the code.
+func browserFlow(ctx context.Context, opts *LoginOptions, metadata *providerMetadata) (string, error) {
+	if metadata.AuthorizationEndpoint == "" {
+		return "", fmt.Errorf("issuer %s doesn't support the authorization code flow", metadata.Issuer)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer listener.Close()
+	redirectURI := fmt.Sprintf("http://%s/callback", listener.Addr())
+
+	state, err := randomString()
+	if err != nil {
+		return "", err
+	}
+	verifier, err := randomString()
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+
+	authorizationURL, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	query := authorizationURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", opts.ClientID)
+	query.Set("redirect_uri", redirectURI)
+	query.Set("scope", strings.Join(append([]string{"openid"}, opts.Scopes...), " "))
+	query.Set("state", state)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+	authorizationURL.RawQuery = query.Encode()
+
+	codes := make(chan string, 1)
+	errs := make(chan error, 1)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/callback" {
+			http.NotFound(w, req)
+			return
+		}
+		query := req.URL.Query()
+		switch {
+		case query.Get("state") != state:
+			http.Error(w, "Invalid state.", http.StatusBadRequest)
+			return
+		case query.Get("error") != "":
+			http.Error(w, "Login failed, you can close this window.", http.StatusUnauthorized)
+			select {
+			case errs <- tokenError(&tokenResponse{Error: query.Get("error"), ErrorDescription: query.Get("error_description")}):
+			default:
+			}
+		default:
+			_, _ = fmt.Fprintln(w, "Logged in, you can close this window.")
+			select {
+			case codes <- query.Get("code"):
+			default:
+			}
+		}
+	})}
+	go func() { _ = server.Serve(listener) }()
+	defer server.Close()
+
+	if err := opts.openBrowser(authorizationURL.String()); err != nil {
+		if _, err := fmt.Fprintf(opts.ErrOut, "To log in, open %s\n", authorizationURL); err != nil {
+			return "", err
+		}
+	} else if _, err := fmt.Fprintln(opts.ErrOut, "Log in with the web browser which has been opened."); err != nil {
+		return "", err
+	}
+
+	var code string
+	select {
+	case <-ctx.Done():
+		return "", fmt.Errorf("login not completed: %w", ctx.Err())
+	case err := <-errs:
+		return "", err
+	case code = <-codes:
+	}
+
+	token, err := requestToken(ctx, opts, metadata.TokenEndpoint, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"client_id":     {opts.ClientID},
+		"code_verifier": {verifier},
+	})
+	if err != nil {
+		return "", err
+	}
+	if token.Error != "" {
+		return "", tokenError(token)
+	}
+	return token.IDToken, nil
+}
+
+// requestToken posts the given form to the token endpoint. OAuth 2.0 errors are returned
+// in the response, for the caller to handle the ones expected by the flow.
+func requestToken(ctx context.Context, opts *LoginOptions, endpoint string, form url.Values) (*tokenResponse, error) {
+	var token tokenResponse
+	if err := postForm(ctx, opts, endpoint, form, &token); err != nil {
+		return nil, fmt.Errorf("failed to get the token: %w", err)
+	}
+	if token.Error == "" && token.IDToken == "" {
+		return nil, errors.New("failed to get the token: no ID token returned, is the openid scope supported?")
+	}
+	return &token, nil
+}
+
+// postForm posts the given form, authenticated with the client secret if any, and decodes
+// the JSON response into v. Error responses are decoded as well, as OAuth 2.0 errors are
+// returned with a 400 status.
+func postForm(ctx context.Context, opts *LoginOptions, endpoint string, form url.Values, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if opts.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(opts.ClientID), url.QueryEscape(opts.ClientSecret))
+	}
+
+	resp, err := opts.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusBadRequest && resp.StatusCode != http.StatusUnauthorized {
+		return fmt.Errorf("%s returned %s", endpoint, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode the response of %s: %w", endpoint, err)
+	}
+	return nil
+}
+
+func tokenError(token *tokenResponse) error {
+	if token.ErrorDescription != "" {
+		return fmt.Errorf("login failed: %s: %s", token.Error, token.ErrorDescription)
+	}
+	return fmt.Errorf("login failed: %s", token.Error)
+}
+
+// writeKubeconfig adds a context pointing to the given server with the given token to the
+// kubeconfig, and makes it the current context.
+func writeKubeconfig(opts *LoginOptions, server, token string) error {
+	config, err := opts.PathOptions.GetStartingConfig()
+	if err != nil {
+		return err
+	}
+
+	cluster := api.NewCluster()
+	cluster.Server = server
+	if opts.CertificateAuthority != "" {
+		if cluster.CertificateAuthority, err = filepath.Abs(opts.CertificateAuthority); err != nil {
+			return err
+		}
+	}
+	cluster.InsecureSkipTLSVerify = opts.InsecureSkipTLSVerify
+	authInfo := api.NewAuthInfo()
+	authInfo.Token = token
+	kubeContext := api.NewContext()
+	kubeContext.Cluster = rootContextName
+	kubeContext.AuthInfo = rootContextName
+
+	config.Clusters[rootContextName] = cluster
+	config.AuthInfos[rootContextName] = authInfo
+	config.Contexts[rootContextName] = kubeContext
+	config.CurrentContext = rootContextName
+	return clientcmd.ModifyConfig(opts.PathOptions, *config, true)
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// openBrowser opens the given URL in the default web browser.
+func openBrowser(url string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", url).Start()
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Start()
+	default:
+		return exec.Command("xdg-open", url).Start()
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// fakeProvider is an OpenID Connect provider supporting the device and authorization
+// code flows, which authorizes the device code after the first poll.
+func fakeProvider(t *testing.T) *httptest.Server {
+	var server *httptest.Server
+	polls := 0
+	mux := http.NewServeMux()
+	reply := func(w http.ResponseWriter, status int, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		require.NoError(t, json.NewEncoder(w).Encode(v))
+	}
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, req *http.Request) {
+		reply(w, http.StatusOK, map[string]string{
+			"issuer":                        server.URL,
+			"authorization_endpoint":        server.URL + "/authorize",
+			"token_endpoint":                server.URL + "/token",
+			"device_authorization_endpoint": server.URL + "/device",
+		})
+	})
+	mux.HandleFunc("/device", func(w http.ResponseWriter, req *http.Request) {
+		require.NoError(t, req.ParseForm())
+		require.Equal(t, "kcp", req.PostForm.Get("client_id"))
+		require.Equal(t, "openid email", req.PostForm.Get("scope"))
+		reply(w, http.StatusOK, map[string]interface{}{
+			"device_code":      "device-code",
+			"user_code":        "ABCD-EFGH",
+			"verification_uri": server.URL + "/activate",
+			"interval":         1,
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, req *http.Request) {
+		require.NoError(t, req.ParseForm())
+		switch req.PostForm.Get("grant_type") {
+		case deviceCodeGrantType:
+			require.Equal(t, "device-code", req.PostForm.Get("device_code"))
+			if polls++; polls == 1 {
+				reply(w, http.StatusBadRequest, map[string]string{"error": "authorization_pending"})
+				return
+			}
+			reply(w, http.StatusOK, map[string]string{"id_token": "device-token"})
+		case "authorization_code":
+			if req.PostForm.Get("code") != "auth-code" || req.PostForm.Get("code_verifier") == "" {
+				reply(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "bad code"})
+				return
+			}
+			reply(w, http.StatusOK, map[string]string{"id_token": "browser-token"})
+		}
+	})
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestLogin(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		flow      string
+		code      string
+		wantToken string
+		wantErr   string
+	}{
+		{name: "device flow by default", wantToken: "device-token"},
+		{name: "browser flow", flow: BrowserFlow, code: "auth-code", wantToken: "browser-token"},
+		{name: "browser flow with an invalid code", flow: BrowserFlow, code: "other", wantErr: "invalid_grant: bad code"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := fakeProvider(t)
+			kubeconfig := filepath.Join(t.TempDir(), "kubeconfig")
+			require.NoError(t, os.WriteFile(kubeconfig, nil, 0600))
+
+			out := &bytes.Buffer{}
+			opts := NewLoginOptions(genericclioptions.IOStreams{Out: out, ErrOut: out})
+			opts.IssuerURL = provider.URL
+			opts.ClientID = "kcp"
+			opts.Scopes = []string{"email"}
+			opts.Flow = tt.flow
+			opts.PathOptions.LoadingRules.ExplicitPath = kubeconfig
+			opts.openBrowser = func(authorizationURL string) error {
+				u, err := url.Parse(authorizationURL)
+				require.NoError(t, err)
+				query := u.Query()
+				require.Equal(t, "S256", query.Get("code_challenge_method"))
+				go func() {
+					resp, err := http.Get(query.Get("redirect_uri") + "?" + url.Values{"code": {tt.code}, "state": {query.Get("state")}}.Encode())
+					if err == nil {
+						resp.Body.Close()
+					}
+				}()
+				return nil
+			}
+
+			err := Login(context.Background(), opts, "https://kcp.example.com")
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			config, err := clientcmd.LoadFromFile(kubeconfig)
+			require.NoError(t, err)
+			require.Equal(t, rootContextName, config.CurrentContext)
+			require.Equal(t, "https://kcp.example.com/clusters/root", config.Clusters[rootContextName].Server)
+			require.Equal(t, tt.wantToken, config.AuthInfos[rootContextName].Token)
+		})
+	}
+}
+
+func TestLoginValidation(t *testing.T) {
+	opts := NewLoginOptions(genericclioptions.NewTestIOStreamsDiscard())
+	require.Error(t, Login(context.Background(), opts, "https://kcp.example.com"))
+
+	opts.IssuerURL = "https://sso.example.com"
+	opts.ClientID = "kcp"
+	require.Error(t, Login(context.Background(), opts, "http://kcp.example.com"))
+
+	opts.Flow = "implicit"
+	require.Error(t, Login(context.Background(), opts, "https://kcp.example.com"))
+}
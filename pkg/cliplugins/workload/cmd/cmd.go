@@ -0,0 +1,64 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+
+	"github.com/kcp-dev/kcp/pkg/cliplugins/workload/plugin"
+)
+
+var (
+	syncExample = `
+	# create the cluster-1 WorkloadCluster in the current workspace and print the manifests of its syncer
+	%[1]s workload sync cluster-1 > syncer.yaml
+
+	# install the syncer of cluster-1 in the physical cluster of the given kubeconfig
+	%[1]s workload sync cluster-1 --syncer-image=ghcr.io/kcp-dev/kcp/syncer:latest --target-kubeconfig=cluster-1.kubeconfig
+`
+)
+
+// NewCmdWorkload provides a cobra command wrapping SyncOptions
+func NewCmdWorkload(streams genericclioptions.IOStreams) *cobra.Command {
+	opts := plugin.NewSyncOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:          "workload",
+		Short:        "Manages the physical clusters running the workloads of KCP workspaces",
+		Example:      fmt.Sprintf(syncExample, "kubectl kcp"),
+		SilenceUsage: true,
+	}
+
+	syncCmd := &cobra.Command{
+		Use:          "sync <workload cluster name>",
+		Short:        "Creates a WorkloadCluster and installs its syncer in a physical cluster, or prints the syncer manifests",
+		Example:      fmt.Sprintf(syncExample, "kubectl kcp"),
+		SilenceUsage: true,
+		Args:         cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			return plugin.Sync(c.Context(), opts, args[0])
+		},
+	}
+	opts.BindFlags(syncCmd)
+
+	cmd.AddCommand(syncCmd)
+	return cmd
+}
@@ -0,0 +1,239 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+	kcpclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
+	"github.com/kcp-dev/kcp/pkg/cliplugins/helpers"
+	"github.com/kcp-dev/kcp/pkg/syncer/bundle"
+)
+
+// fieldManager is the field manager of the syncer objects applied to physical clusters.
+const fieldManager = "kubectl-kcp"
+
+// SyncOptions contains the options to on-board a physical cluster to the current workspace.
+type SyncOptions struct {
+	KubectlOverrides *clientcmd.ConfigOverrides
+
+	// Image is the syncer image, the one configured in kcp if empty.
+	Image string
+	// Namespace is the namespace of the physical cluster the syncer is installed in.
+	Namespace string
+	// ResourcesToSync are the group resources synced to the physical cluster, the ones
+	// configured in kcp if empty.
+	ResourcesToSync []string
+	// TargetKubeconfig is the kubeconfig of the physical cluster the syncer manifests
+	// are applied to. The manifests are printed if empty.
+	TargetKubeconfig string
+	// TargetContext is the context of TargetKubeconfig to use instead of the current one.
+	TargetContext string
+
+	genericclioptions.IOStreams
+}
+
+// NewSyncOptions provides an instance of SyncOptions with default values.
+func NewSyncOptions(streams genericclioptions.IOStreams) *SyncOptions {
+	return &SyncOptions{
+		KubectlOverrides: &clientcmd.ConfigOverrides{},
+
+		IOStreams: streams,
+	}
+}
+
+// BindFlags binds the options to the flags of the given command.
+func (o *SyncOptions) BindFlags(cmd *cobra.Command) {
+	kubectlConfigOverrideFlags := clientcmd.RecommendedConfigOverrideFlags("")
+	kubectlConfigOverrideFlags.AuthOverrideFlags.ClientCertificate.LongName = ""
+	kubectlConfigOverrideFlags.AuthOverrideFlags.ClientKey.LongName = ""
+	kubectlConfigOverrideFlags.AuthOverrideFlags.Impersonate.LongName = ""
+	kubectlConfigOverrideFlags.AuthOverrideFlags.ImpersonateGroups.LongName = ""
+	kubectlConfigOverrideFlags.ContextOverrideFlags.AuthInfoName.LongName = ""
+	kubectlConfigOverrideFlags.ContextOverrideFlags.ClusterName.LongName = ""
+	kubectlConfigOverrideFlags.ContextOverrideFlags.Namespace.LongName = ""
+	kubectlConfigOverrideFlags.Timeout.LongName = ""
+	clientcmd.BindOverrideFlags(o.KubectlOverrides, cmd.PersistentFlags(), kubectlConfigOverrideFlags)
+
+	cmd.Flags().StringVar(&o.Image, "syncer-image", o.Image, "Image of the syncer, the one configured in kcp if empty")
+	cmd.Flags().StringVar(&o.Namespace, "syncer-namespace", o.Namespace, "Namespace of the physical cluster the syncer is installed in, "+bundle.DefaultNamespace+" if empty")
+	cmd.Flags().StringSliceVar(&o.ResourcesToSync, "resources", o.ResourcesToSync, "Resources synced to the physical cluster, as resource.group. The ones configured in kcp if empty")
+	cmd.Flags().StringVar(&o.TargetKubeconfig, "target-kubeconfig", o.TargetKubeconfig, "Kubeconfig of the physical cluster to apply the syncer manifests to. The manifests are printed if empty")
+	cmd.Flags().StringVar(&o.TargetContext, "target-context", o.TargetContext, "Context of the target kubeconfig to use instead of its current context")
+}
+
+// Sync creates the WorkloadCluster of the given name in the current workspace if it
+// doesn't exist yet, and generates the manifests installing its syncer. They are
+// applied to the target cluster if one is configured, and printed as YAML otherwise.
+func Sync(ctx context.Context, opts *SyncOptions, workloadClusterName string) error {
+	if opts.TargetContext != "" && opts.TargetKubeconfig == "" {
+		return errors.New("--target-context requires --target-kubeconfig")
+	}
+
+	config, clusterName, err := helpers.ClusterConfig(clientcmd.NewNonInteractiveDeferredLoadingClientConfig(clientcmd.NewDefaultClientConfigLoadingRules(), opts.KubectlOverrides))
+	if err != nil {
+		return err
+	}
+	if clusterName == "" {
+		return errors.New("The current context doesn't point to a workspace")
+	}
+	clusterClient, err := kcpclient.NewClusterForConfig(config)
+	if err != nil {
+		return err
+	}
+	client := clusterClient.Cluster(clusterName)
+
+	workloadClusters := client.WorkloadV1alpha1().WorkloadClusters()
+	if _, err := workloadClusters.Create(ctx, &workloadv1alpha1.WorkloadCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: workloadClusterName},
+	}, metav1.CreateOptions{}); err == nil {
+		if _, err := fmt.Fprintf(opts.ErrOut, "WorkloadCluster %q created.\n", workloadClusterName); err != nil {
+			return err
+		}
+	} else if !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	request := client.WorkloadV1alpha1().RESTClient().Get().
+		Cluster(clusterName).
+		Resource("workloadclusters").
+		Name(workloadClusterName).
+		SubResource(bundle.SyncerSubresource)
+	if opts.Image != "" {
+		request = request.Param("image", opts.Image)
+	}
+	if opts.Namespace != "" {
+		request = request.Param("namespace", opts.Namespace)
+	}
+	if len(opts.ResourcesToSync) > 0 {
+		request = request.Param("resources", strings.Join(opts.ResourcesToSync, ","))
+	}
+	raw, err := request.DoRaw(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to generate the syncer manifests of WorkloadCluster %q: %w", workloadClusterName, err)
+	}
+	objects, err := decodeBundle(raw)
+	if err != nil {
+		return err
+	}
+
+	if opts.TargetKubeconfig == "" {
+		return printObjects(opts, objects)
+	}
+	targetConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: opts.TargetKubeconfig},
+		&clientcmd.ConfigOverrides{CurrentContext: opts.TargetContext},
+	).ClientConfig()
+	if err != nil {
+		return err
+	}
+	return applyObjects(ctx, opts, targetConfig, objects)
+}
+
+// decodeBundle returns the objects of a syncer install bundle served as a v1 List.
+func decodeBundle(raw []byte) ([]*unstructured.Unstructured, error) {
+	var list corev1.List
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, fmt.Errorf("failed to decode the syncer manifests: %w", err)
+	}
+	objects := make([]*unstructured.Unstructured, 0, len(list.Items))
+	for _, item := range list.Items {
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(item.Raw); err != nil {
+			return nil, fmt.Errorf("failed to decode the syncer manifests: %w", err)
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
+
+// printObjects prints the given objects as a multi-document YAML stream.
+func printObjects(opts *SyncOptions, objects []*unstructured.Unstructured) error {
+	var out bytes.Buffer
+	for _, obj := range objects {
+		data, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return err
+		}
+		out.WriteString("---\n")
+		out.Write(data)
+	}
+	_, err := out.WriteTo(opts.Out)
+	return err
+}
+
+// applyObjects server-side applies the given objects to the cluster of the given
+// config, in order.
+func applyObjects(ctx context.Context, opts *SyncOptions, config *rest.Config, objects []*unstructured.Unstructured) error {
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return err
+	}
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient))
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+
+	force := true
+	for _, obj := range objects {
+		gvk := obj.GroupVersionKind()
+		mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return err
+		}
+		var resource dynamic.ResourceInterface = dynamicClient.Resource(mapping.Resource)
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			resource = dynamicClient.Resource(mapping.Resource).Namespace(obj.GetNamespace())
+		}
+
+		data, err := obj.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		if _, err := resource.Patch(ctx, obj.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{FieldManager: fieldManager, Force: &force}); err != nil {
+			return fmt.Errorf("failed to apply %s %q: %w", gvk.Kind, obj.GetName(), err)
+		}
+		if _, err := fmt.Fprintf(opts.Out, "%s/%s applied\n", strings.ToLower(gvk.Kind), obj.GetName()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+
+	"github.com/kcp-dev/kcp/pkg/syncer/bundle"
+)
+
+func TestDecodeAndPrintBundle(t *testing.T) {
+	list, err := bundle.List(bundle.Options{
+		Image:           "syncer:latest",
+		ServerURL:       "https://kcp.example.com/clusters/root:acme",
+		Token:           "token",
+		LogicalCluster:  "root:acme",
+		WorkloadCluster: "cluster-1",
+		ResourcesToSync: []string{"deployments.apps"},
+	})
+	require.NoError(t, err)
+	raw, err := json.Marshal(list)
+	require.NoError(t, err)
+
+	objects, err := decodeBundle(raw)
+	require.NoError(t, err)
+	var kinds []string
+	for _, obj := range objects {
+		kinds = append(kinds, obj.GetKind())
+	}
+	require.Equal(t, []string{"Namespace", "ServiceAccount", "ClusterRole", "ClusterRoleBinding", "Secret", "Deployment"}, kinds)
+	require.Equal(t, bundle.DefaultNamespace, objects[0].GetName())
+
+	out := &bytes.Buffer{}
+	require.NoError(t, printObjects(&SyncOptions{IOStreams: genericclioptions.IOStreams{Out: out}}, objects))
+	require.Equal(t, len(objects), strings.Count(out.String(), "---\n"))
+	require.Contains(t, out.String(), "image: syncer:latest")
+}
+
+func TestDecodeBundleError(t *testing.T) {
+	_, err := decodeBundle([]byte("not json"))
+	require.Error(t, err)
+}
@@ -18,6 +18,8 @@ package cmd
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -28,14 +30,28 @@ import (
 
 var (
 	workspaceExample = `
-	# Shows the workspace you are currently using
+	# Shows the workspace you are currently using, with its path, type, shard and URL
 	%[1]s workspace current
+	%[1]s workspace .
+
+	# Shows the workspace you are currently using in JSON
+	%[1]s workspace current -o json
 
 	# use a given workspace (this will change the current-context of your current KUBECONFIG)
 	%[1]s workspace use
 
+	# go back to the previous workspace, or to the parent of the current workspace
+	%[1]s workspace -
+	%[1]s workspace ..
+
 	# list all your personal workspaces
 	%[1]s workspace list
+
+	# show the hierarchy of workspaces under the current workspace
+	%[1]s workspace tree
+
+	# generate a kubeconfig with edit access to a child workspace for a CI system, valid for 2 hours
+	%[1]s workspace kubeconfig my-workspace --name=ci --role=edit --expiration=2h > ci.kubeconfig
 `
 )
 
@@ -44,11 +60,12 @@ func NewCmdWorkspace(streams genericclioptions.IOStreams) (*cobra.Command, error
 	opts := plugin.NewOptions(streams)
 
 	cmd := &cobra.Command{
-		Use:              "workspace [--workspace-directory-server=] <current|use|list>",
+		Use:              "workspace [--workspace-directory-server=] <current|use|list|tree|kubeconfig|.|-|..>",
 		Short:            "Manages KCP workspaces",
 		Example:          fmt.Sprintf(workspaceExample, "kubectl kcp"),
 		SilenceUsage:     true,
 		TraverseChildren: true,
+		Args:             cobra.MaximumNArgs(1),
 	}
 
 	opts.BindFlags(cmd)
@@ -57,9 +74,25 @@ func NewCmdWorkspace(streams genericclioptions.IOStreams) (*cobra.Command, error
 		return nil, err
 	}
 
+	var output string
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Output format of the current workspace with '.', json or human readable if empty")
+
+	cmd.RunE = func(c *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			return c.Help()
+		}
+		if args[0] == "." {
+			return kubeconfig.CurrentWorkspace(c.Context(), opts, output)
+		}
+		if args[0] != "-" && args[0] != ".." {
+			return fmt.Errorf("unknown command %q", args[0])
+		}
+		return kubeconfig.UseWorkspace(c.Context(), opts, args[0])
+	}
+
 	useCmd := &cobra.Command{
-		Use:          "use < workspace name | - >",
-		Short:        "Uses the given workspace as the current workspace. Using - means previous workspace",
+		Use:          "use < workspace name | - | .. >",
+		Short:        "Uses the given workspace as the current workspace. Using - means previous workspace, .. the parent workspace",
 		Example:      "kcp workspace use my-worspace",
 		SilenceUsage: true,
 		RunE: func(c *cobra.Command, args []string) error {
@@ -72,20 +105,36 @@ func NewCmdWorkspace(streams genericclioptions.IOStreams) (*cobra.Command, error
 			}
 			return nil
 		},
+		ValidArgsFunction: func(c *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) > 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			names, err := kubeconfig.CompleteWorkspaceNames(c.Context(), opts, toComplete)
+			if err != nil {
+				return nil, cobra.ShellCompDirectiveError
+			}
+			for _, name := range []string{"-", ".."} {
+				if strings.HasPrefix(name, toComplete) {
+					names = append(names, name)
+				}
+			}
+			return names, cobra.ShellCompDirectiveNoFileComp
+		},
 	}
 
 	currentCmd := &cobra.Command{
 		Use:          "current",
-		Short:        "Returns the name of the current workspace",
-		Example:      "kcp workspace current",
+		Short:        "Returns the name, path, logical cluster, type, shard and URL of the current workspace",
+		Example:      "kcp workspace current -o json",
 		SilenceUsage: true,
 		RunE: func(c *cobra.Command, args []string) error {
-			if err := kubeconfig.CurrentWorkspace(c.Context(), opts); err != nil {
+			if err := kubeconfig.CurrentWorkspace(c.Context(), opts, output); err != nil {
 				return err
 			}
 			return nil
 		},
 	}
+	currentCmd.Flags().StringVarP(&output, "output", "o", "", "Output format, json or human readable if empty")
 
 	listCmd := &cobra.Command{
 		Use:          "list",
@@ -100,44 +149,145 @@ func NewCmdWorkspace(streams genericclioptions.IOStreams) (*cobra.Command, error
 		},
 	}
 
-	useFlag := "use"
+	var (
+		workspaceType string
+		enter         bool
+		readyTimeout  time.Duration
+	)
 	createCmd := &cobra.Command{
 		Use:          "create",
 		Short:        "Creates a new personal workspace",
-		Example:      "kcp workspace create <workspace name>",
+		Example:      "kcp workspace create <workspace name> [--type=<type>] [--enter]",
 		SilenceUsage: true,
 		Args:         cobra.ExactArgs(1),
 		RunE: func(c *cobra.Command, args []string) error {
-			useAfterCreation, err := c.Flags().GetBool(useFlag)
-			if err != nil {
-				return err
+			if enter && readyTimeout == 0 {
+				return fmt.Errorf("--enter requires waiting for the workspace to be ready, --timeout must not be 0")
 			}
-			if err := kubeconfig.CreateWorkspace(c.Context(), opts, args[0], useAfterCreation); err != nil {
+			if err := kubeconfig.CreateWorkspace(c.Context(), opts, args[0], workspaceType, enter, readyTimeout); err != nil {
 				return err
 			}
 			return nil
 		},
+		ValidArgsFunction: func(c *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			// the name of a new workspace cannot be completed
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		},
 	}
-	createCmd.Flags().Bool(useFlag, false, "Use the new workspace after a successful creation")
+	createCmd.Flags().StringVar(&workspaceType, "type", "", "Type of the new workspace, the default type of the server if empty")
+	_ = createCmd.RegisterFlagCompletionFunc("type", func(c *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		types, err := kubeconfig.CompleteWorkspaceTypes(c.Context(), opts, toComplete)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		return types, cobra.ShellCompDirectiveNoFileComp
+	})
+	createCmd.Flags().BoolVar(&enter, "enter", false, "Use the new workspace once it is ready")
+	createCmd.Flags().BoolVar(&enter, "use", false, "Use the new workspace once it is ready")
+	_ = createCmd.Flags().MarkDeprecated("use", "use --enter instead")
+	createCmd.Flags().DurationVar(&readyTimeout, "timeout", time.Minute, "Time to wait for the new workspace to be ready, 0 to not wait")
 
+	var cascade string
 	deleteCmd := &cobra.Command{
 		Use:          "delete",
 		Short:        "Deletes a personal workspace",
-		Example:      "kcp workspace delete <workspace name>",
+		Example:      "kcp workspace delete <workspace name> [--cascade=subtree]",
 		SilenceUsage: true,
 		Args:         cobra.ExactArgs(1),
 		RunE: func(c *cobra.Command, args []string) error {
-			if err := kubeconfig.DeleteWorkspace(c.Context(), opts, args[0]); err != nil {
+			if cascade != "none" && cascade != "subtree" {
+				return fmt.Errorf("--cascade must be none or subtree, got %q", cascade)
+			}
+			if err := kubeconfig.DeleteWorkspace(c.Context(), opts, args[0], cascade == "subtree"); err != nil {
 				return err
 			}
 			return nil
 		},
+		ValidArgsFunction: func(c *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) > 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			names, err := kubeconfig.CompleteWorkspaceNames(c.Context(), opts, toComplete)
+			if err != nil {
+				return nil, cobra.ShellCompDirectiveError
+			}
+			return names, cobra.ShellCompDirectiveNoFileComp
+		},
+	}
+
+	deleteCmd.Flags().StringVar(&cascade, "cascade", "none", "Must be none or subtree. With subtree, the child workspaces of the workspace are deleted with it, otherwise a workspace with child workspaces cannot be deleted")
+
+	var treeOpts plugin.TreeOptions
+	treeCmd := &cobra.Command{
+		Use:          "tree [logical cluster]",
+		Short:        "Shows the hierarchy of workspaces under the current or given logical cluster",
+		Example:      "kcp workspace tree root:my-org --phase=Initializing",
+		SilenceUsage: true,
+		Args:         cobra.MaximumNArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			clusterName := ""
+			if len(args) == 1 {
+				clusterName = args[0]
+			}
+			if err := kubeconfig.WorkspaceTree(c.Context(), opts, treeOpts, clusterName); err != nil {
+				return err
+			}
+			return nil
+		},
+		ValidArgsFunction: func(c *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) > 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			clusterNames, err := kubeconfig.CompleteLogicalClusterNames(c.Context(), opts, toComplete)
+			if err != nil {
+				return nil, cobra.ShellCompDirectiveError
+			}
+			return clusterNames, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+		},
+	}
+	treeCmd.Flags().StringSliceVar(&treeOpts.Types, "type", nil, "Only show the workspaces of the given types, and their parents")
+	treeCmd.Flags().StringSliceVar(&treeOpts.Phases, "phase", nil, "Only show the workspaces in the given phases, and their parents")
+	treeCmd.Flags().IntVar(&treeOpts.MaxDepth, "max-depth", 0, "Maximum depth of the tree, unlimited if 0")
+
+	var handoverOpts plugin.HandoverOptions
+	kubeconfigCmd := &cobra.Command{
+		Use:          "kubeconfig <workspace name>",
+		Short:        "Generates a kubeconfig for a child workspace, with a time-limited token restricted to it",
+		Example:      "kcp workspace kubeconfig my-workspace --name=ci --role=view --expiration=1h",
+		SilenceUsage: true,
+		Args:         cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := kubeconfig.WorkspaceKubeconfig(c.Context(), opts, args[0], handoverOpts); err != nil {
+				return err
+			}
+			return nil
+		},
+		ValidArgsFunction: func(c *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) > 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			names, err := kubeconfig.CompleteWorkspaceNames(c.Context(), opts, toComplete)
+			if err != nil {
+				return nil, cobra.ShellCompDirectiveError
+			}
+			return names, cobra.ShellCompDirectiveNoFileComp
+		},
 	}
+	kubeconfigCmd.Flags().StringVar(&handoverOpts.Name, "name", "", "Name of the token, e.g. the name of the system the kubeconfig is handed to")
+	kubeconfigCmd.Flags().StringVar(&handoverOpts.Role, "role", "view", "Role of the token in the workspace: admin, edit, view or access")
+	kubeconfigCmd.Flags().DurationVar(&handoverOpts.Expiration, "expiration", time.Hour, "Lifetime of the token, at most the maximum configured on the server")
+	kubeconfigCmd.Flags().StringVar(&handoverOpts.OutputFile, "output-file", "", "File to write the kubeconfig to, stdout if empty")
+	_ = kubeconfigCmd.MarkFlagRequired("name")
+	_ = kubeconfigCmd.RegisterFlagCompletionFunc("role", func(c *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"admin", "edit", "view", "access"}, cobra.ShellCompDirectiveNoFileComp
+	})
 
 	cmd.AddCommand(useCmd)
 	cmd.AddCommand(currentCmd)
 	cmd.AddCommand(listCmd)
 	cmd.AddCommand(createCmd)
 	cmd.AddCommand(deleteCmd)
+	cmd.AddCommand(treeCmd)
+	cmd.AddCommand(kubeconfigCmd)
 	return cmd, nil
 }
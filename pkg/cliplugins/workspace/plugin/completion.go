@@ -0,0 +1,165 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+	tenancyclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
+	"github.com/kcp-dev/kcp/pkg/cliplugins/helpers"
+)
+
+// CompleteWorkspaceNames returns the names of the workspaces of the workspace directory
+// starting with toComplete.
+func (kc *KubeConfig) CompleteWorkspaceNames(ctx context.Context, opts *Options, toComplete string) ([]string, error) {
+	workspaceDirectoryRestConfig, err := kc.workspaceDirectoryRestConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	tenancyClient, err := tenancyclient.NewForConfig(workspaceDirectoryRestConfig)
+	if err != nil {
+		return nil, err
+	}
+	workspaces, err := tenancyClient.TenancyV1beta1().Workspaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(workspaces.Items))
+	for _, workspace := range workspaces.Items {
+		names = append(names, workspace.Name)
+	}
+	sort.Strings(names)
+	return filterPrefix(names, toComplete), nil
+}
+
+// CompleteLogicalClusterNames returns the logical cluster names starting with toComplete,
+// as listed by CompleteLogicalClusters with the credentials of the current context.
+func (kc *KubeConfig) CompleteLogicalClusterNames(ctx context.Context, opts *Options, toComplete string) ([]string, error) {
+	config, _, err := helpers.ClusterConfig(clientcmd.NewDefaultClientConfig(*kc.startingConfig, opts.KubectlOverrides))
+	if err != nil {
+		return nil, err
+	}
+	clusterClient, err := tenancyclient.NewClusterForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return CompleteLogicalClusters(ctx, NewListWorkspacesFunc(clusterClient), toComplete)
+}
+
+// CompleteWorkspaceTypes returns the names of the ClusterWorkspaceTypes of the logical
+// cluster of the current context starting with toComplete.
+func (kc *KubeConfig) CompleteWorkspaceTypes(ctx context.Context, opts *Options, toComplete string) ([]string, error) {
+	config, clusterName, err := helpers.ClusterConfig(clientcmd.NewDefaultClientConfig(*kc.startingConfig, opts.KubectlOverrides))
+	if err != nil {
+		return nil, err
+	}
+	if clusterName == "" {
+		return nil, nil
+	}
+	clusterClient, err := tenancyclient.NewClusterForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	types, err := clusterClient.Cluster(clusterName).TenancyV1alpha1().ClusterWorkspaceTypes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(types.Items))
+	for _, t := range types.Items {
+		names = append(names, t.Name)
+	}
+	sort.Strings(names)
+	return filterPrefix(names, strings.ToLower(toComplete)), nil
+}
+
+// NewListWorkspacesFunc returns a function listing the ClusterWorkspaces of a logical
+// cluster with the given cluster client.
+func NewListWorkspacesFunc(clusterClient *tenancyclient.Cluster) ListWorkspacesFunc {
+	return func(ctx context.Context, clusterName string) ([]tenancyv1alpha1.ClusterWorkspace, error) {
+		workspaces, err := clusterClient.Cluster(clusterName).TenancyV1alpha1().ClusterWorkspaces().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return workspaces.Items, nil
+	}
+}
+
+// CompleteLogicalClusters returns the logical cluster names starting with toComplete,
+// one level at a time: root and the organizations followed by a colon first, then the
+// workspaces of root after "root:", and the workspaces of an organization after "<org>:".
+func CompleteLogicalClusters(ctx context.Context, list ListWorkspacesFunc, toComplete string) ([]string, error) {
+	i := strings.LastIndex(toComplete, ":")
+	if i < 0 {
+		workspaces, err := list(ctx, helper.RootCluster)
+		if err != nil {
+			return nil, err
+		}
+		candidates := []string{helper.RootCluster, helper.RootCluster + ":"}
+		for _, workspace := range sortedNames(workspaces) {
+			candidates = append(candidates, workspace+":")
+		}
+		return filterPrefix(candidates, toComplete), nil
+	}
+
+	parent := toComplete[:i]
+	var clusterName string
+	switch {
+	case parent == helper.RootCluster:
+		clusterName = helper.RootCluster
+	case !strings.Contains(parent, ":"):
+		clusterName = helper.EncodeOrganizationAndWorkspace(helper.RootCluster, parent)
+	default:
+		return nil, nil
+	}
+	workspaces, err := list(ctx, clusterName)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []string
+	for _, workspace := range sortedNames(workspaces) {
+		candidates = append(candidates, parent+":"+workspace)
+	}
+	return filterPrefix(candidates, toComplete), nil
+}
+
+func sortedNames(workspaces []tenancyv1alpha1.ClusterWorkspace) []string {
+	names := make([]string, 0, len(workspaces))
+	for _, workspace := range workspaces {
+		names = append(names, workspace.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func filterPrefix(candidates []string, prefix string) []string {
+	var filtered []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, prefix) {
+			filtered = append(filtered, candidate)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+)
+
+func fakeListWorkspaces(workspaces map[string][]string) ListWorkspacesFunc {
+	return func(ctx context.Context, clusterName string) ([]tenancyv1alpha1.ClusterWorkspace, error) {
+		var items []tenancyv1alpha1.ClusterWorkspace
+		for _, name := range workspaces[clusterName] {
+			items = append(items, tenancyv1alpha1.ClusterWorkspace{ObjectMeta: metav1.ObjectMeta{ClusterName: clusterName, Name: name}})
+		}
+		return items, nil
+	}
+}
+
+func TestCompleteLogicalClusters(t *testing.T) {
+	list := fakeListWorkspaces(map[string][]string{
+		"root":      {"beta", "acme"},
+		"root:acme": {"team", "platform"},
+	})
+
+	for toComplete, want := range map[string][]string{
+		"":               {"root", "root:", "acme:", "beta:"},
+		"r":              {"root", "root:"},
+		"a":              {"acme:"},
+		"root:":          {"root:acme", "root:beta"},
+		"root:a":         {"root:acme"},
+		"acme:":          {"acme:platform", "acme:team"},
+		"acme:t":         {"acme:team"},
+		"beta:":          nil,
+		"acme:team:":     nil,
+		"root:acme:team": nil,
+	} {
+		t.Run(toComplete, func(t *testing.T) {
+			got, err := CompleteLogicalClusters(context.Background(), list, toComplete)
+			require.NoError(t, err)
+			require.Equal(t, want, got)
+		})
+	}
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+	tenancyclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
+	"github.com/kcp-dev/kcp/pkg/cliplugins/helpers"
+)
+
+// WorkspaceDetails describes the current workspace, as printed by the current command.
+type WorkspaceDetails struct {
+	// Name is the name of the workspace.
+	Name string `json:"name"`
+	// Scope is the scope of the workspace in the workspace directory, empty for the
+	// workspaces outside of it.
+	Scope string `json:"scope,omitempty"`
+	// Path is the absolute path of the workspace, e.g. root:acme:team.
+	Path string `json:"path,omitempty"`
+	// LogicalCluster is the logical cluster backing the workspace, e.g. acme:team.
+	LogicalCluster string `json:"logicalCluster,omitempty"`
+	// Type is the type of the workspace.
+	Type string `json:"type,omitempty"`
+	// Shard is the shard the workspace is scheduled on.
+	Shard string `json:"shard,omitempty"`
+	// URL is the external URL of the workspace.
+	URL string `json:"url,omitempty"`
+}
+
+type getClusterWorkspaceFunc func(ctx context.Context, clusterName, name string) (*tenancyv1alpha1.ClusterWorkspace, error)
+
+// currentWorkspaceDetails returns the details of the workspace of the current context.
+// Only the name and scope are known if the context doesn't point to a logical cluster.
+func (kc *KubeConfig) currentWorkspaceDetails(ctx context.Context, opts *Options, scope, name string) (*WorkspaceDetails, error) {
+	details := &WorkspaceDetails{Name: name, Scope: scope}
+
+	config, clusterName, err := helpers.ClusterConfig(clientcmd.NewDefaultClientConfig(*kc.startingConfig, opts.KubectlOverrides))
+	if err != nil {
+		return nil, err
+	}
+	if clusterName == "" {
+		return details, nil
+	}
+	details.URL = config.Host + "/clusters/" + clusterName
+
+	clusterClient, err := tenancyclient.NewClusterForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	get := func(ctx context.Context, clusterName, name string) (*tenancyv1alpha1.ClusterWorkspace, error) {
+		return clusterClient.Cluster(clusterName).TenancyV1alpha1().ClusterWorkspaces().Get(ctx, name, metav1.GetOptions{})
+	}
+	if err := completeWorkspaceDetails(ctx, get, details, clusterName); err != nil {
+		return nil, err
+	}
+	return details, nil
+}
+
+// completeWorkspaceDetails fills the details of the workspace backed by the given logical
+// cluster from its ClusterWorkspace. The ClusterWorkspace lives in the parent logical
+// cluster, which the user may not have access to: the type and shard are left empty then.
+func completeWorkspaceDetails(ctx context.Context, get getClusterWorkspaceFunc, details *WorkspaceDetails, clusterName string) error {
+	details.LogicalCluster = clusterName
+	details.Path = absoluteWorkspacePath(clusterName)
+	if clusterName == helper.RootCluster || strings.HasPrefix(clusterName, helper.LocalSystemClusterPrefix) {
+		return nil
+	}
+
+	parentClusterName, err := helper.ParentClusterName(clusterName)
+	if err != nil {
+		return err
+	}
+	_, workspaceName, err := helper.ParseLogicalClusterName(clusterName)
+	if err != nil {
+		return err
+	}
+	workspace, err := get(ctx, parentClusterName, workspaceName)
+	if apierrors.IsForbidden(err) || apierrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	details.Type = workspace.Spec.Type
+	details.Shard = workspace.Status.Location.Current
+	if workspace.Status.BaseURL != "" {
+		details.URL = workspace.Status.BaseURL
+	}
+	return nil
+}
+
+// absoluteWorkspacePath returns the path of the workspace backed by the given logical
+// cluster from the root workspace. The logical clusters of the workspaces of organizations
+// are named after the organization only, e.g. acme:team for root:acme:team.
+func absoluteWorkspacePath(clusterName string) string {
+	if clusterName == helper.RootCluster || strings.HasPrefix(clusterName, helper.RootCluster+":") || strings.HasPrefix(clusterName, helper.LocalSystemClusterPrefix) {
+		return clusterName
+	}
+	return helper.RootCluster + ":" + clusterName
+}
+
+// printWorkspaceDetails prints the given details in the given output format, json or
+// human readable if empty.
+func printWorkspaceDetails(out io.Writer, details *WorkspaceDetails, output string) error {
+	switch output {
+	case "json":
+		data, err := json.MarshalIndent(details, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, string(data))
+		return err
+	case "":
+	default:
+		return fmt.Errorf("unsupported output format %q, only json is supported", output)
+	}
+
+	if _, err := io.WriteString(out, currentWorkspaceMessage(details.Scope, details.Name)); err != nil {
+		return err
+	}
+	for _, field := range []struct{ name, value string }{
+		{"Path", details.Path},
+		{"Logical cluster", details.LogicalCluster},
+		{"Type", details.Type},
+		{"Shard", details.Shard},
+		{"URL", details.URL},
+	} {
+		if field.value == "" {
+			continue
+		}
+		if _, err := fmt.Fprintf(out, "  %-16s %s\n", field.name+":", field.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+)
+
+func TestCompleteWorkspaceDetails(t *testing.T) {
+	team := &tenancyv1alpha1.ClusterWorkspace{
+		ObjectMeta: metav1.ObjectMeta{ClusterName: "root:acme", Name: "team"},
+		Spec:       tenancyv1alpha1.ClusterWorkspaceSpec{Type: "Universal"},
+		Status: tenancyv1alpha1.ClusterWorkspaceStatus{
+			BaseURL:  "https://shard-1.example.com/clusters/acme:team",
+			Location: tenancyv1alpha1.ClusterWorkspaceLocation{Current: "shard-1"},
+		},
+	}
+	get := func(ctx context.Context, clusterName, name string) (*tenancyv1alpha1.ClusterWorkspace, error) {
+		if clusterName == team.ClusterName && name == team.Name {
+			return team, nil
+		}
+		return nil, apierrors.NewForbidden(tenancyv1alpha1.Resource("clusterworkspaces"), name, nil)
+	}
+
+	for _, tt := range []struct {
+		clusterName string
+		want        WorkspaceDetails
+	}{
+		{
+			clusterName: "root",
+			want:        WorkspaceDetails{Path: "root", LogicalCluster: "root", URL: "https://kcp.example.com/clusters/root"},
+		},
+		{
+			clusterName: "root:acme",
+			want:        WorkspaceDetails{Path: "root:acme", LogicalCluster: "root:acme", URL: "https://kcp.example.com/clusters/root:acme"},
+		},
+		{
+			clusterName: "acme:team",
+			want: WorkspaceDetails{
+				Path:           "root:acme:team",
+				LogicalCluster: "acme:team",
+				Type:           "Universal",
+				Shard:          "shard-1",
+				URL:            "https://shard-1.example.com/clusters/acme:team",
+			},
+		},
+	} {
+		t.Run(tt.clusterName, func(t *testing.T) {
+			details := &WorkspaceDetails{URL: "https://kcp.example.com/clusters/" + tt.clusterName}
+			require.NoError(t, completeWorkspaceDetails(context.Background(), get, details, tt.clusterName))
+			require.Equal(t, tt.want, *details)
+		})
+	}
+}
+
+func TestPrintWorkspaceDetails(t *testing.T) {
+	details := &WorkspaceDetails{
+		Name:           "team",
+		Scope:          "personal",
+		Path:           "root:acme:team",
+		LogicalCluster: "acme:team",
+		Type:           "Universal",
+		URL:            "https://kcp.example.com/clusters/acme:team",
+	}
+
+	out := &bytes.Buffer{}
+	require.NoError(t, printWorkspaceDetails(out, details, ""))
+	require.Equal(t, `Current personal workspace is "team".
+  Path:            root:acme:team
+  Logical cluster: acme:team
+  Type:            Universal
+  URL:             https://kcp.example.com/clusters/acme:team
+`, out.String())
+
+	out.Reset()
+	require.NoError(t, printWorkspaceDetails(out, details, "json"))
+	require.JSONEq(t, `{
+		"name": "team",
+		"scope": "personal",
+		"path": "root:acme:team",
+		"logicalCluster": "acme:team",
+		"type": "Universal",
+		"url": "https://kcp.example.com/clusters/acme:team"
+	}`, out.String())
+
+	require.Error(t, printWorkspaceDetails(out, details, "yaml"))
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd"
+
+	tenancyclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
+	"github.com/kcp-dev/kcp/pkg/cliplugins/helpers"
+)
+
+// HandoverOptions are the options of the kubeconfigs generated for a workspace.
+type HandoverOptions struct {
+	// Name is the name of the token of the kubeconfig, e.g. the name of the CI system.
+	Name string
+	// Role is the role of the token in the workspace: admin, edit, view or access.
+	Role string
+	// Expiration is the lifetime of the token.
+	Expiration time.Duration
+	// OutputFile is the file the kubeconfig is written to, stdout if empty.
+	OutputFile string
+}
+
+// WorkspaceKubeconfig generates a kubeconfig for the given child workspace of the
+// current workspace, with a token restricted to the logical cluster of the workspace
+// and expiring after the given duration. It is meant to hand access over to
+// automation without sharing user credentials.
+func (kc *KubeConfig) WorkspaceKubeconfig(ctx context.Context, opts *Options, workspaceName string, handoverOpts HandoverOptions) error {
+	config, clusterName, err := helpers.ClusterConfig(clientcmd.NewDefaultClientConfig(*kc.startingConfig, opts.KubectlOverrides))
+	if err != nil {
+		return err
+	}
+	if clusterName == "" {
+		return errors.New("The current context doesn't point to a workspace")
+	}
+	tenancyClient, err := tenancyclient.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+
+	request := tenancyClient.TenancyV1alpha1().RESTClient().Get().
+		Cluster(clusterName).
+		Resource("clusterworkspaces").
+		Name(workspaceName).
+		SubResource("kubeconfig").
+		Param("name", handoverOpts.Name)
+	if handoverOpts.Role != "" {
+		request = request.Param("role", handoverOpts.Role)
+	}
+	if handoverOpts.Expiration != 0 {
+		request = request.Param("expiration", handoverOpts.Expiration.String())
+	}
+	kubeconfig, err := request.DoRaw(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to generate a kubeconfig for workspace %q: %w", workspaceName, err)
+	}
+
+	if handoverOpts.OutputFile == "" {
+		_, err = opts.Out.Write(kubeconfig)
+		return err
+	}
+	if err := ioutil.WriteFile(handoverOpts.OutputFile, kubeconfig, 0600); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(opts.ErrOut, "Kubeconfig for workspace %q written to %s.\n", workspaceName, handoverOpts.OutputFile)
+	return err
+}
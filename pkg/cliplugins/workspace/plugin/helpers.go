@@ -17,6 +17,7 @@ limitations under the License.
 package plugin
 
 import (
+	"fmt"
 	"strings"
 
 	"k8s.io/client-go/tools/clientcmd/api"
@@ -51,6 +52,14 @@ func extractScopeAndName(workspaceKey string) (string, string) {
 	return "", workspaceKey
 }
 
+// currentWorkspaceMessage returns the message telling the current workspace.
+func currentWorkspaceMessage(scope, name string) string {
+	if scope == "" {
+		return fmt.Sprintf("Current workspace is \"%s\".\n", name)
+	}
+	return fmt.Sprintf("Current %s workspace is \"%s\".\n", scope, name)
+}
+
 func write(opts *Options, str string) error {
 	_, err := opts.Out.Write([]byte(str))
 	return err
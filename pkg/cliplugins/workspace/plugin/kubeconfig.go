@@ -18,6 +18,7 @@ package plugin
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -25,13 +26,18 @@ import (
 	"strings"
 	"time"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	metav1beta1 "k8s.io/apimachinery/pkg/apis/meta/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/cli-runtime/pkg/printers"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/clientcmd/api"
 
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
 	tenancyv1beta1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1beta1"
 	tenancyclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
 	workspacecmd "github.com/kcp-dev/kcp/pkg/virtual/framework/cmd"
@@ -40,10 +46,25 @@ import (
 )
 
 const (
-	kcpWorkspaceContextNamePrefix  string = "workspace.kcp.dev/"
+	kcpWorkspaceContextNamePrefix string = "workspace.kcp.dev/"
+	// kcpPreviousWorkspaceContextKey is the context older versions of the plugin
+	// stored the previous workspace in. It is removed when the kubeconfig is written.
 	kcpPreviousWorkspaceContextKey string = "workspace.kcp.dev/-"
+	// kcpWorkspaceExtensionKey is the kubeconfig extension holding the state of the plugin.
+	kcpWorkspaceExtensionKey string = "workspace.kcp.dev"
+
+	// previousWorkspaceName and parentWorkspaceName are the workspace names used
+	// to jump back to the previous workspace, and to the parent workspace.
+	previousWorkspaceName = "-"
+	parentWorkspaceName   = ".."
 )
 
+// workspaceExtension is the state of the plugin stored in the kubeconfig.
+type workspaceExtension struct {
+	// PreviousContext is the context of the workspace used before the current one.
+	PreviousContext string `json:"previousContext,omitempty"`
+}
+
 var defaultWorkspaceDirectoryApiServerPath = workspacebuilder.DefaultRootPathPrefix + "/addsupportfororgs/" + workspaceregistry.PersonalScope
 
 // KubeConfig contains a config loaded from a Kubeconfig
@@ -156,52 +177,80 @@ func (kc *KubeConfig) workspaceDirectoryRestConfig(options *Options) (*rest.Conf
 // from the `workspaces` virtual workspace `workspaces/kubeconfig` sube-resources,
 // and adds it (along with the Auth info that is currently used) to the Kubeconfig.
 // Then it make this new context the current context.
+// The "-" workspace name switches back to the previous workspace, and ".." to the
+// parent of the current workspace.
 func (kc *KubeConfig) UseWorkspace(ctx context.Context, opts *Options, workspaceName string) error {
+	currentContextName := kc.startingConfig.CurrentContext
+	if opts.KubectlOverrides.CurrentContext != "" {
+		currentContextName = opts.KubectlOverrides.CurrentContext
+	}
 
-	workspaceDirectoryRestConfig, err := kc.workspaceDirectoryRestConfig(opts)
-	if err != nil {
-		return err
+	var workspaceContextName string
+	switch workspaceName {
+	case previousWorkspaceName:
+		extension, err := kc.workspaceExtension()
+		if err != nil {
+			return err
+		}
+		if _, previousWorkspaceExists := kc.startingConfig.Contexts[extension.PreviousContext]; extension.PreviousContext == "" || !previousWorkspaceExists {
+			return errors.New("No previous workspace exists !")
+		}
+		workspaceContextName = extension.PreviousContext
+
+	case parentWorkspaceName:
+		var err error
+		if workspaceContextName, err = kc.addParentWorkspaceContext(opts, currentContextName); err != nil {
+			return err
+		}
+
+	default:
+		var err error
+		if workspaceContextName, err = kc.addWorkspaceContext(ctx, opts, currentContextName, workspaceName); err != nil {
+			return err
+		}
 	}
 
-	tenancyClient, err := tenancyclient.NewForConfig(workspaceDirectoryRestConfig)
-	if err != nil {
+	if strings.HasPrefix(currentContextName, kcpWorkspaceContextNamePrefix) && currentContextName != workspaceContextName {
+		if err := kc.setWorkspaceExtension(workspaceExtension{PreviousContext: currentContextName}); err != nil {
+			return err
+		}
+	}
+	delete(kc.startingConfig.Contexts, kcpPreviousWorkspaceContextKey)
+	kc.startingConfig.CurrentContext = workspaceContextName
+
+	scope, name := extractScopeAndName(strings.TrimPrefix(workspaceContextName, kcpWorkspaceContextNamePrefix))
+	if err := write(opts, currentWorkspaceMessage(scope, name)); err != nil {
 		return err
 	}
+	return clientcmd.ModifyConfig(kc.configAccess, *kc.startingConfig, true)
+}
 
-	if workspaceName == "-" {
-		if _, previousWorkspaceExists := kc.startingConfig.Contexts[kcpPreviousWorkspaceContextKey]; !previousWorkspaceExists {
-			return errors.New("No previous workspace exists !")
-		}
-		_, workspaceName = extractScopeAndName(string(kc.startingConfig.Contexts[kcpPreviousWorkspaceContextKey].Cluster))
-		delete(kc.startingConfig.Contexts, kcpPreviousWorkspaceContextKey)
+// addWorkspaceContext adds the context of the given workspace of the workspace
+// directory to the kubeconfig, and returns its name.
+func (kc *KubeConfig) addWorkspaceContext(ctx context.Context, opts *Options, currentContextName, workspaceName string) (string, error) {
+	workspaceDirectoryRestConfig, err := kc.workspaceDirectoryRestConfig(opts)
+	if err != nil {
+		return "", err
 	}
 
-	currentWorkspaceScope, currentWorkspaceName, err := kc.getCurrentWorkspace(opts)
-	if err == nil && currentWorkspaceName != "" {
-		kc.startingConfig.Contexts[kcpPreviousWorkspaceContextKey] = &api.Context{
-			Cluster: currentWorkspaceScope + "/" + currentWorkspaceName,
-		}
+	tenancyClient, err := tenancyclient.NewForConfig(workspaceDirectoryRestConfig)
+	if err != nil {
+		return "", err
 	}
 
 	workspaceKubeConfigBytes, err := tenancyClient.RESTClient().Get().Resource("workspaces").SubResource("kubeconfig").Name(workspaceName).Do(ctx).Raw()
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	workspaceConfig, err := clientcmd.Load(workspaceKubeConfigBytes)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	workspaceConfigCurrentContext := workspaceConfig.CurrentContext
-	scope, _ := extractScopeAndName(workspaceConfigCurrentContext)
 	workspaceContextName := kcpWorkspaceContextNamePrefix + workspaceConfigCurrentContext
 
-	currentContextName := kc.startingConfig.CurrentContext
-	if opts.KubectlOverrides.CurrentContext != "" {
-		currentContextName = opts.KubectlOverrides.CurrentContext
-	}
-
 	currentContext := kc.startingConfig.Contexts[currentContextName]
 	var currentContextAuthInfo *api.AuthInfo
 	if currentContext != nil {
@@ -218,13 +267,78 @@ func (kc *KubeConfig) UseWorkspace(ctx context.Context, opts *Options, workspace
 		Cluster:  workspaceContextName,
 		AuthInfo: workspaceContextName,
 	}
+	return workspaceContextName, nil
+}
 
-	kc.startingConfig.CurrentContext = workspaceContextName
+// addParentWorkspaceContext adds the context of the parent of the current workspace
+// to the kubeconfig, and returns its name. The context points to the logical cluster
+// of the parent, with the credentials of the current workspace.
+func (kc *KubeConfig) addParentWorkspaceContext(opts *Options, currentContextName string) (string, error) {
+	currentContext := kc.startingConfig.Contexts[currentContextName]
+	if currentContext == nil {
+		return "", errors.New("No current context !")
+	}
+	currentCluster := kc.startingConfig.Clusters[currentContext.Cluster]
+	if currentCluster == nil {
+		return "", fmt.Errorf("The cluster of the current context %q doesn't exist !", currentContextName)
+	}
 
-	if err := write(opts, fmt.Sprintf("Current %s workspace is \"%s\".\n", scope, workspaceName)); err != nil {
+	serverURL, err := url.Parse(currentCluster.Server)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(serverURL.Path, "/clusters/") {
+		return "", errors.New("The current context doesn't point to a workspace !")
+	}
+	parentClusterName, err := helper.ParentClusterName(strings.TrimPrefix(serverURL.Path, "/clusters/"))
+	if err != nil {
+		return "", err
+	}
+	serverURL.Path = "/clusters/" + parentClusterName
+
+	workspaceContextName := kcpWorkspaceContextNamePrefix + parentClusterName
+	parentCluster := currentCluster.DeepCopy()
+	parentCluster.Server = serverURL.String()
+	kc.startingConfig.Clusters[workspaceContextName] = parentCluster
+
+	currentContextAuthInfo := kc.startingConfig.AuthInfos[currentContext.AuthInfo]
+	kc.startingConfig.AuthInfos[workspaceContextName] = prioritizedAuthInfo(&opts.KubectlOverrides.AuthInfo, currentContextAuthInfo)
+
+	kc.startingConfig.Contexts[workspaceContextName] = &api.Context{
+		Cluster:  workspaceContextName,
+		AuthInfo: workspaceContextName,
+	}
+	return workspaceContextName, nil
+}
+
+// workspaceExtension returns the state of the plugin stored in the kubeconfig.
+func (kc *KubeConfig) workspaceExtension() (workspaceExtension, error) {
+	var extension workspaceExtension
+	obj, found := kc.startingConfig.Extensions[kcpWorkspaceExtensionKey]
+	if !found {
+		return extension, nil
+	}
+	unknown, ok := obj.(*runtime.Unknown)
+	if !ok {
+		return extension, fmt.Errorf("unexpected %T in the %s kubeconfig extension", obj, kcpWorkspaceExtensionKey)
+	}
+	if err := json.Unmarshal(unknown.Raw, &extension); err != nil {
+		return extension, fmt.Errorf("invalid %s kubeconfig extension: %w", kcpWorkspaceExtensionKey, err)
+	}
+	return extension, nil
+}
+
+// setWorkspaceExtension stores the state of the plugin in the kubeconfig.
+func (kc *KubeConfig) setWorkspaceExtension(extension workspaceExtension) error {
+	raw, err := json.Marshal(extension)
+	if err != nil {
 		return err
 	}
-	return clientcmd.ModifyConfig(kc.configAccess, *kc.startingConfig, true)
+	if kc.startingConfig.Extensions == nil {
+		kc.startingConfig.Extensions = map[string]runtime.Object{}
+	}
+	kc.startingConfig.Extensions[kcpWorkspaceExtensionKey] = &runtime.Unknown{Raw: raw, ContentType: runtime.ContentTypeJSON}
+	return nil
 }
 
 // getCurrentWorkspace gets the current workspace from the kubeconfig.
@@ -255,8 +369,13 @@ func checkWorkspaceExists(ctx context.Context, workspaceName string, tenancyClie
 	return err
 }
 
-// CurrentWorkspace outputs the current workspace.
-func (kc *KubeConfig) CurrentWorkspace(ctx context.Context, opts *Options) error {
+// CurrentWorkspace outputs the current workspace, with its absolute path, logical cluster,
+// type, shard and URL. The output is JSON if output is "json", human readable if empty.
+func (kc *KubeConfig) CurrentWorkspace(ctx context.Context, opts *Options, output string) error {
+	if output != "" && output != "json" {
+		return fmt.Errorf("unsupported output format %q, only json is supported", output)
+	}
+
 	workspaceDirectoryRestConfig, err := kc.workspaceDirectoryRestConfig(opts)
 	if err != nil {
 		return err
@@ -273,25 +392,33 @@ func (kc *KubeConfig) CurrentWorkspace(ctx context.Context, opts *Options) error
 	}
 
 	outputCurrentWorkspaceMessage := func() error {
-		if workspaceName != "" {
-			err := write(opts, fmt.Sprintf("Current %s workspace is \"%s\".\n", scope, workspaceName))
+		if workspaceName != "" && output == "" {
+			err := write(opts, currentWorkspaceMessage(scope, workspaceName))
 			return err
 		}
 		return nil
 	}
 
-	// Check that the scope is consistent with the workspace-directory config
-	if !strings.HasSuffix(workspaceDirectoryRestConfig.Host, "/"+scope) {
-		_ = outputCurrentWorkspaceMessage()
-		return fmt.Errorf("Scope of the workspace-directory ('%s') doesn't match the scope of the workspace-directory server ('%s').\nCannot check the current workspace existence.", scope, workspaceDirectoryRestConfig.Host)
+	// The parent workspaces are not in a workspace directory scope.
+	if scope != "" {
+		// Check that the scope is consistent with the workspace-directory config
+		if !strings.HasSuffix(workspaceDirectoryRestConfig.Host, "/"+scope) {
+			_ = outputCurrentWorkspaceMessage()
+			return fmt.Errorf("Scope of the workspace-directory ('%s') doesn't match the scope of the workspace-directory server ('%s').\nCannot check the current workspace existence.", scope, workspaceDirectoryRestConfig.Host)
+		}
+
+		if err := checkWorkspaceExists(ctx, workspaceName, tenancyClient); err != nil {
+			_ = outputCurrentWorkspaceMessage()
+			return err
+		}
 	}
 
-	if err := checkWorkspaceExists(ctx, workspaceName, tenancyClient); err != nil {
+	details, err := kc.currentWorkspaceDetails(ctx, opts, scope, workspaceName)
+	if err != nil {
 		_ = outputCurrentWorkspaceMessage()
 		return err
 	}
-
-	return outputCurrentWorkspaceMessage()
+	return printWorkspaceDetails(opts.Out, details, output)
 }
 
 // ListWorkspaces outputs the list of workspaces of the current user
@@ -339,8 +466,9 @@ func (kc *KubeConfig) ListWorkspaces(ctx context.Context, opts *Options) error {
 }
 
 // CreateWorkspace creates a workspace owned by the the current user
-// (kubeconfig user possibly overridden by CLI options).
-func (kc *KubeConfig) CreateWorkspace(ctx context.Context, opts *Options, workspaceName string, useAfterCreation bool) error {
+// (kubeconfig user possibly overridden by CLI options). Unless readyTimeout is 0,
+// it waits for the workspace to be ready, reporting its phase changes.
+func (kc *KubeConfig) CreateWorkspace(ctx context.Context, opts *Options, workspaceName, workspaceType string, useAfterCreation bool, readyTimeout time.Duration) error {
 	workspaceDirectoryRestConfig, err := kc.workspaceDirectoryRestConfig(opts)
 	if err != nil {
 		return err
@@ -355,7 +483,9 @@ func (kc *KubeConfig) CreateWorkspace(ctx context.Context, opts *Options, worksp
 		ObjectMeta: metav1.ObjectMeta{
 			Name: workspaceName,
 		},
-		Spec: tenancyv1beta1.WorkspaceSpec{},
+		Spec: tenancyv1beta1.WorkspaceSpec{
+			Type: workspaceType,
+		},
 	}, metav1.CreateOptions{}); err != nil {
 		return err
 	}
@@ -364,8 +494,13 @@ func (kc *KubeConfig) CreateWorkspace(ctx context.Context, opts *Options, worksp
 		return err
 	}
 
+	if readyTimeout > 0 {
+		if err := waitForWorkspaceReady(ctx, opts, tenancyClient, workspaceName, readyTimeout); err != nil {
+			return err
+		}
+	}
+
 	if useAfterCreation {
-		time.Sleep(1 * time.Second)
 		if err := kc.UseWorkspace(ctx, opts, workspaceName); err != nil {
 			return err
 		}
@@ -373,9 +508,36 @@ func (kc *KubeConfig) CreateWorkspace(ctx context.Context, opts *Options, worksp
 	return nil
 }
 
+// waitForWorkspaceReady polls the given workspace until it is ready, i.e. it has
+// been scheduled and its initializers are done, or the timeout expires.
+func waitForWorkspaceReady(ctx context.Context, opts *Options, tenancyClient tenancyclient.Interface, workspaceName string, timeout time.Duration) error {
+	var lastPhase tenancyv1alpha1.ClusterWorkspacePhaseType
+	err := wait.PollImmediate(500*time.Millisecond, timeout, func() (bool, error) {
+		workspace, err := tenancyClient.TenancyV1beta1().Workspaces().Get(ctx, workspaceName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			// The workspace directory may not have observed it yet.
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		if phase := workspace.Status.Phase; phase != lastPhase && phase != "" {
+			lastPhase = phase
+			if err := write(opts, fmt.Sprintf("Workspace \"%s\" is %s.\n", workspaceName, phase)); err != nil {
+				return false, err
+			}
+		}
+		return workspace.Status.Phase == tenancyv1alpha1.ClusterWorkspacePhaseReady, nil
+	})
+	if errors.Is(err, wait.ErrWaitTimeout) {
+		return fmt.Errorf("workspace %q not ready after %v", workspaceName, timeout)
+	}
+	return err
+}
+
 // DeleteWorkspace deletes a workspace owned by the the current user
-// (kubeconfig user possibly overridden by CLI options).
-func (kc *KubeConfig) DeleteWorkspace(ctx context.Context, opts *Options, workspaceName string) error {
+// (kubeconfig user possibly overridden by CLI options), and its child
+// workspaces if subtree is true.
+func (kc *KubeConfig) DeleteWorkspace(ctx context.Context, opts *Options, workspaceName string, subtree bool) error {
 	workspaceDirectoryRestConfig, err := kc.workspaceDirectoryRestConfig(opts)
 	if err != nil {
 		return err
@@ -386,7 +548,14 @@ func (kc *KubeConfig) DeleteWorkspace(ctx context.Context, opts *Options, worksp
 		return err
 	}
 
-	if err := tenancyClient.TenancyV1beta1().Workspaces().Delete(ctx, workspaceName, metav1.DeleteOptions{}); err != nil {
+	// workspaces with child workspaces are only deleted in the foreground, together with
+	// their whole subtree
+	deleteOptions := metav1.DeleteOptions{}
+	if subtree {
+		policy := metav1.DeletePropagationForeground
+		deleteOptions.PropagationPolicy = &policy
+	}
+	if err := tenancyClient.TenancyV1beta1().Workspaces().Delete(ctx, workspaceName, deleteOptions); err != nil {
 		return err
 	}
 
@@ -0,0 +1,71 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestAddParentWorkspaceContext(t *testing.T) {
+	config := api.NewConfig()
+	config.Clusters["workspace.kcp.dev/personal/team"] = &api.Cluster{Server: "https://kcp.example.com:6443/clusters/acme:team"}
+	config.AuthInfos["workspace.kcp.dev/personal/team"] = &api.AuthInfo{Token: "secret"}
+	config.Contexts["workspace.kcp.dev/personal/team"] = &api.Context{
+		Cluster:  "workspace.kcp.dev/personal/team",
+		AuthInfo: "workspace.kcp.dev/personal/team",
+	}
+	kc := &KubeConfig{startingConfig: config}
+
+	name, err := kc.addParentWorkspaceContext(NewOptions(genericclioptions.NewTestIOStreamsDiscard()), "workspace.kcp.dev/personal/team")
+	require.NoError(t, err)
+	require.Equal(t, "workspace.kcp.dev/root:acme", name)
+	require.Equal(t, "https://kcp.example.com:6443/clusters/root:acme", config.Clusters[name].Server)
+	require.Equal(t, "secret", config.AuthInfos[name].Token)
+
+	name, err = kc.addParentWorkspaceContext(NewOptions(genericclioptions.NewTestIOStreamsDiscard()), name)
+	require.NoError(t, err)
+	require.Equal(t, "workspace.kcp.dev/root", name)
+
+	_, err = kc.addParentWorkspaceContext(NewOptions(genericclioptions.NewTestIOStreamsDiscard()), name)
+	require.Error(t, err, "root has no parent")
+}
+
+func TestWorkspaceExtension(t *testing.T) {
+	kc := &KubeConfig{startingConfig: api.NewConfig()}
+
+	extension, err := kc.workspaceExtension()
+	require.NoError(t, err)
+	require.Equal(t, workspaceExtension{}, extension)
+
+	require.NoError(t, kc.setWorkspaceExtension(workspaceExtension{PreviousContext: "workspace.kcp.dev/personal/team"}))
+
+	// The extension survives the serialization of the kubeconfig.
+	data, err := clientcmd.Write(*kc.startingConfig)
+	require.NoError(t, err)
+	loaded, err := clientcmd.Load(data)
+	require.NoError(t, err)
+
+	extension, err = (&KubeConfig{startingConfig: loaded}).workspaceExtension()
+	require.NoError(t, err)
+	require.Equal(t, workspaceExtension{PreviousContext: "workspace.kcp.dev/personal/team"}, extension)
+}
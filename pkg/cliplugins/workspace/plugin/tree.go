@@ -0,0 +1,184 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/clientcmd"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+	tenancyclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
+	"github.com/kcp-dev/kcp/pkg/cliplugins/helpers"
+)
+
+// TreeOptions filters the workspaces shown by the tree command.
+type TreeOptions struct {
+	// Types only shows the workspaces of these types, if not empty.
+	Types []string
+	// Phases only shows the workspaces in these phases, if not empty.
+	Phases []string
+	// MaxDepth limits the depth of the tree, if positive.
+	MaxDepth int
+}
+
+type workspaceNode struct {
+	name     string
+	wsType   string
+	phase    tenancyv1alpha1.ClusterWorkspacePhaseType
+	ready    bool
+	children []*workspaceNode
+}
+
+// ListWorkspacesFunc lists the ClusterWorkspaces of a logical cluster.
+type ListWorkspacesFunc func(ctx context.Context, clusterName string) ([]tenancyv1alpha1.ClusterWorkspace, error)
+
+// WorkspaceTree outputs the hierarchy of workspaces under the given logical cluster,
+// or under the logical cluster of the current context if none is given.
+func (kc *KubeConfig) WorkspaceTree(ctx context.Context, opts *Options, treeOpts TreeOptions, clusterName string) error {
+	config, currentClusterName, err := helpers.ClusterConfig(clientcmd.NewDefaultClientConfig(*kc.startingConfig, opts.KubectlOverrides))
+	if err != nil {
+		return err
+	}
+	if clusterName == "" {
+		if currentClusterName == "" {
+			return errors.New("The current context doesn't point to a logical cluster, a workspace path should be given")
+		}
+		clusterName = currentClusterName
+	}
+
+	clusterClient, err := tenancyclient.NewClusterForConfig(config)
+	if err != nil {
+		return err
+	}
+	nodes, err := loadWorkspaceTree(ctx, NewListWorkspacesFunc(clusterClient), clusterName, 1, treeOpts.MaxDepth)
+	if err != nil {
+		return err
+	}
+	return printWorkspaceTree(opts.Out, clusterName, filterWorkspaceTree(nodes, treeOpts))
+}
+
+// loadWorkspaceTree lists the workspaces of the given logical cluster, and recursively
+// the workspaces of their own logical clusters.
+func loadWorkspaceTree(ctx context.Context, list ListWorkspacesFunc, clusterName string, depth, maxDepth int) ([]*workspaceNode, error) {
+	workspaces, err := list(ctx, clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the workspaces of %s: %w", clusterName, err)
+	}
+	sort.Slice(workspaces, func(i, j int) bool { return workspaces[i].Name < workspaces[j].Name })
+
+	nodes := make([]*workspaceNode, 0, len(workspaces))
+	for i := range workspaces {
+		ws := &workspaces[i]
+		node := &workspaceNode{
+			name:   ws.Name,
+			wsType: ws.Spec.Type,
+			phase:  ws.Status.Phase,
+			ready:  isWorkspaceReady(ws),
+		}
+		nodes = append(nodes, node)
+
+		// Only the root and organization logical clusters have child workspaces.
+		if clusterName != helper.RootCluster && !strings.HasPrefix(clusterName, helper.RootCluster+":") {
+			continue
+		}
+		if maxDepth > 0 && depth >= maxDepth {
+			continue
+		}
+		if ws.ClusterName == "" {
+			ws.ClusterName = clusterName
+		}
+		childClusterName, err := helper.EncodeLogicalClusterName(ws)
+		if err != nil {
+			return nil, err
+		}
+		if node.children, err = loadWorkspaceTree(ctx, list, childClusterName, depth+1, maxDepth); err != nil {
+			return nil, err
+		}
+	}
+	return nodes, nil
+}
+
+func isWorkspaceReady(ws *tenancyv1alpha1.ClusterWorkspace) bool {
+	if ws.Status.Phase != tenancyv1alpha1.ClusterWorkspacePhaseReady {
+		return false
+	}
+	for _, condition := range ws.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			return false
+		}
+	}
+	return true
+}
+
+// filterWorkspaceTree returns the nodes matching the options, along with the nodes
+// having matching descendants so that the hierarchy is kept.
+func filterWorkspaceTree(nodes []*workspaceNode, opts TreeOptions) []*workspaceNode {
+	types, phases := sets.NewString(opts.Types...), sets.NewString(opts.Phases...)
+
+	var filtered []*workspaceNode
+	for _, node := range nodes {
+		children := filterWorkspaceTree(node.children, opts)
+		matches := (types.Len() == 0 || types.Has(node.wsType)) && (phases.Len() == 0 || phases.Has(string(node.phase)))
+		if !matches && len(children) == 0 {
+			continue
+		}
+		copied := *node
+		copied.children = children
+		filtered = append(filtered, &copied)
+	}
+	return filtered
+}
+
+func printWorkspaceTree(out io.Writer, clusterName string, nodes []*workspaceNode) error {
+	if _, err := fmt.Fprintln(out, clusterName); err != nil {
+		return err
+	}
+	return printWorkspaceNodes(out, "", nodes)
+}
+
+func printWorkspaceNodes(out io.Writer, prefix string, nodes []*workspaceNode) error {
+	for i, node := range nodes {
+		branch, indent := "├── ", "│   "
+		if i == len(nodes)-1 {
+			branch, indent = "└── ", "    "
+		}
+		ready := "not ready"
+		if node.ready {
+			ready = "ready"
+		}
+		phase := string(node.phase)
+		if phase == "" {
+			phase = "Unknown"
+		}
+		if _, err := fmt.Fprintf(out, "%s%s%s [%s] %s, %s\n", prefix, branch, node.name, node.wsType, phase, ready); err != nil {
+			return err
+		}
+		if err := printWorkspaceNodes(out, prefix+indent, node.children); err != nil {
+			return err
+		}
+	}
+	return nil
+}
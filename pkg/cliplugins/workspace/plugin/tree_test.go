@@ -0,0 +1,89 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+)
+
+func TestWorkspaceTree(t *testing.T) {
+	workspace := func(clusterName, name, wsType string, phase tenancyv1alpha1.ClusterWorkspacePhaseType) tenancyv1alpha1.ClusterWorkspace {
+		return tenancyv1alpha1.ClusterWorkspace{
+			ObjectMeta: metav1.ObjectMeta{ClusterName: clusterName, Name: name},
+			Spec:       tenancyv1alpha1.ClusterWorkspaceSpec{Type: wsType},
+			Status:     tenancyv1alpha1.ClusterWorkspaceStatus{Phase: phase},
+		}
+	}
+	workspaces := map[string][]tenancyv1alpha1.ClusterWorkspace{
+		"root": {
+			workspace("root", "beta", "Organization", tenancyv1alpha1.ClusterWorkspacePhaseReady),
+			workspace("root", "acme", "Organization", tenancyv1alpha1.ClusterWorkspacePhaseReady),
+		},
+		"root:acme": {
+			workspace("root:acme", "team-b", "Universal", tenancyv1alpha1.ClusterWorkspacePhaseInitializing),
+			workspace("root:acme", "team-a", "Universal", tenancyv1alpha1.ClusterWorkspacePhaseReady),
+		},
+	}
+	list := func(ctx context.Context, clusterName string) ([]tenancyv1alpha1.ClusterWorkspace, error) {
+		return workspaces[clusterName], nil
+	}
+
+	for _, c := range []struct {
+		desc string
+		opts TreeOptions
+		want string
+	}{{
+		desc: "all",
+		want: `root
+├── acme [Organization] Ready, ready
+│   ├── team-a [Universal] Ready, ready
+│   └── team-b [Universal] Initializing, not ready
+└── beta [Organization] Ready, ready
+`,
+	}, {
+		desc: "max depth",
+		opts: TreeOptions{MaxDepth: 1},
+		want: `root
+├── acme [Organization] Ready, ready
+└── beta [Organization] Ready, ready
+`,
+	}, {
+		desc: "phase filter keeps parents",
+		opts: TreeOptions{Phases: []string{"Initializing"}},
+		want: `root
+└── acme [Organization] Ready, ready
+    └── team-b [Universal] Initializing, not ready
+`,
+	}} {
+		t.Run(c.desc, func(t *testing.T) {
+			nodes, err := loadWorkspaceTree(context.Background(), list, "root", 1, c.opts.MaxDepth)
+			require.NoError(t, err)
+
+			var out bytes.Buffer
+			require.NoError(t, printWorkspaceTree(&out, "root", filterWorkspaceTree(nodes, c.opts)))
+			require.Equal(t, c.want, out.String())
+		})
+	}
+}
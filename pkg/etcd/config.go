@@ -0,0 +1,119 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Config is the etcd a shard stores its objects in, as configured in the file given
+// with --etcd-config-file, e.g.
+//
+//   endpoints:
+//   - https://etcd-0.example.com:2379
+//   prefix: /shards/shard-1
+//   certFile: /etc/kcp/etcd/client.crt
+//   keyFile: /etc/kcp/etcd/client.key
+//   trustedCAFile: /etc/kcp/etcd/ca.crt
+type Config struct {
+	// Endpoints are the client URLs of the etcd members.
+	Endpoints []string `json:"endpoints"`
+	// Prefix is the prefix of the keys of the shard. Shards sharing an etcd must have
+	// prefixes that are not prefixes of one another.
+	Prefix string `json:"prefix"`
+
+	// CertFile and KeyFile are the client certificate and key to authenticate with.
+	CertFile string `json:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty"`
+	// TrustedCAFile is the CA bundle to verify the serving certificates of etcd with.
+	TrustedCAFile string `json:"trustedCAFile,omitempty"`
+}
+
+// LoadConfig reads and validates the etcd configuration in the given file.
+func LoadConfig(path string) (*Config, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read etcd config: %w", err)
+	}
+	config := &Config{}
+	if err := yaml.UnmarshalStrict(raw, config); err != nil {
+		return nil, fmt.Errorf("failed to parse etcd config %s: %w", path, err)
+	}
+	if errs := config.Validate(); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid etcd config %s: %v", path, errs)
+	}
+	return config, nil
+}
+
+// Validate checks that the configuration is complete and that its files are readable.
+func (c *Config) Validate() []error {
+	var errs []error
+	if len(c.Endpoints) == 0 {
+		errs = append(errs, fmt.Errorf("endpoints must not be empty"))
+	}
+	for _, endpoint := range c.Endpoints {
+		if u, err := url.Parse(endpoint); err != nil || u.Host == "" {
+			errs = append(errs, fmt.Errorf("endpoint %q must be a URL", endpoint))
+		}
+	}
+	if !strings.HasPrefix(c.Prefix, "/") || strings.TrimRight(c.Prefix, "/") == "" {
+		errs = append(errs, fmt.Errorf("prefix %q must be an absolute path other than /", c.Prefix))
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		errs = append(errs, fmt.Errorf("certFile and keyFile must be set together"))
+	}
+	for _, file := range []string{c.CertFile, c.KeyFile, c.TrustedCAFile} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// SharesEndpoint returns whether the given etcd endpoints have a member in common.
+func SharesEndpoint(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if endpointHost(x) == endpointHost(y) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func endpointHost(endpoint string) string {
+	if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+		return strings.ToLower(u.Host)
+	}
+	return strings.ToLower(endpoint)
+}
+
+// PrefixesOverlap returns whether the keys under one of the given prefixes can be under
+// the other, i.e. whether shards using them cannot share an etcd.
+func PrefixesOverlap(a, b string) bool {
+	a, b = strings.TrimRight(a, "/")+"/", strings.TrimRight(b, "/")+"/"
+	return strings.HasPrefix(a, b) || strings.HasPrefix(b, a)
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca := filepath.Join(dir, "ca.crt")
+	require.NoError(t, os.WriteFile(ca, []byte("ca"), 0600))
+
+	for _, tc := range []struct {
+		name    string
+		content string
+		want    *Config
+		wantErr bool
+	}{
+		{
+			name:    "valid",
+			content: "endpoints: [https://etcd-0:2379]\nprefix: /shards/shard-1\ntrustedCAFile: " + ca,
+			want:    &Config{Endpoints: []string{"https://etcd-0:2379"}, Prefix: "/shards/shard-1", TrustedCAFile: ca},
+		},
+		{name: "no endpoints", content: "prefix: /shards/shard-1", wantErr: true},
+		{name: "endpoint without scheme", content: "endpoints: [etcd-0:2379]\nprefix: /kcp", wantErr: true},
+		{name: "root prefix", content: "endpoints: [https://etcd-0:2379]\nprefix: /", wantErr: true},
+		{name: "relative prefix", content: "endpoints: [https://etcd-0:2379]\nprefix: kcp", wantErr: true},
+		{name: "cert without key", content: "endpoints: [https://etcd-0:2379]\nprefix: /kcp\ncertFile: " + ca, wantErr: true},
+		{name: "missing file", content: "endpoints: [https://etcd-0:2379]\nprefix: /kcp\ntrustedCAFile: " + filepath.Join(dir, "missing"), wantErr: true},
+		{name: "unknown field", content: "endpoints: [https://etcd-0:2379]\nprefix: /kcp\nprefixes: [/a]", wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(dir, "etcd.yaml")
+			require.NoError(t, os.WriteFile(path, []byte(tc.content), 0600))
+			got, err := LoadConfig(path)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestSharing(t *testing.T) {
+	require.True(t, SharesEndpoint([]string{"https://etcd-0:2379", "https://etcd-1:2379"}, []string{"https://ETCD-1:2379"}))
+	require.False(t, SharesEndpoint([]string{"https://etcd-0:2379"}, []string{"https://etcd-0:2380"}))
+
+	require.True(t, PrefixesOverlap("/kcp", "/kcp/"))
+	require.True(t, PrefixesOverlap("/shards", "/shards/shard-1"))
+	require.False(t, PrefixesOverlap("/shards/shard-1", "/shards/shard-10"))
+}
@@ -41,6 +41,11 @@ import (
 	"k8s.io/klog/v2"
 )
 
+// progressNotifyInterval is the interval at which etcd notifies idle watches requesting
+// it of its progress, which the wildcard watches of the resources without watch cache
+// get as bookmarks. It matches the bookmark frequency of the watch cache.
+const progressNotifyInterval = time.Minute
+
 type Server struct {
 	Dir string
 }
@@ -72,6 +77,7 @@ func (s *Server) Run(ctx context.Context, peerPort, clientPort string, walSizeBy
 	cfg.LCUrls = []url.URL{{Scheme: "https", Host: "localhost:" + clientPort}}
 	cfg.ACUrls = []url.URL{{Scheme: "https", Host: "localhost:" + clientPort}}
 	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+	cfg.ExperimentalWatchProgressNotifyInterval = progressNotifyInterval
 
 	if err := os.MkdirAll(cfg.Dir, 0700); err != nil {
 		return ClientInfo{}, err
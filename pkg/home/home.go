@@ -0,0 +1,268 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package home resolves the `~` logical cluster to the home workspace of the requesting
+// user, such that kubeconfigs can use a stable .../clusters/~ URL.
+//
+// Home workspaces are ClusterWorkspaces of a dedicated organization, named after their
+// user. They are created on the first request of their user, who is granted admin access
+// to them.
+package home
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/filters"
+	"k8s.io/apiserver/pkg/endpoints/handlers/responsewriters"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/klog/v2"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+	kcpclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
+	tenancylisters "github.com/kcp-dev/kcp/pkg/client/listers/tenancy/v1alpha1"
+)
+
+const (
+	// ClusterName is the logical cluster resolved to the home workspace of the requesting user.
+	ClusterName = "~"
+
+	// OwnerAnnotation on a home workspace holds the name of its user.
+	OwnerAnnotation = "home.kcp.dev/owner"
+
+	// retryAfterSeconds is the delay after which clients retry while their home workspace
+	// is being created.
+	retryAfterSeconds = 1
+)
+
+var reWorkspaceName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,30}[a-z0-9]$`)
+
+// WorkspaceName returns the name of the home workspace of the given user: the username if
+// it is a valid workspace name without "--", otherwise a sanitized prefix of it followed by
+// "--" and a hash of the username. The two forms are disjoint, and the hash is long enough
+// for distinct users not to share a name in practice. Home workspaces are only served to
+// the user recorded in their OwnerAnnotation in any case.
+func WorkspaceName(userName string) string {
+	if reWorkspaceName.MatchString(userName) && !strings.Contains(userName, "--") {
+		return userName
+	}
+	sanitized := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '-'
+	}, userName)
+	if len(sanitized) > 14 {
+		sanitized = sanitized[:14]
+	}
+	sanitized = strings.Trim(sanitized, "-")
+	if sanitized == "" {
+		sanitized = "home"
+	}
+
+	sum := sha256.Sum256([]byte(userName))
+	return sanitized + "--" + hex.EncodeToString(sum[:])[:16]
+}
+
+// Handler resolves requests to the `~` logical cluster to the home workspace of their user.
+type Handler struct {
+	organization      string
+	workspaceLister   tenancylisters.ClusterWorkspaceLister
+	kcpClusterClient  kcpclient.ClusterInterface
+	kubeClusterClient kubernetes.ClusterInterface
+	authorizer        authorizer.Authorizer
+}
+
+// NewHandler returns a Handler resolving home workspaces in the given organization,
+// creating them with the given clients. The authorizer authorizes the requests once
+// resolved to the home workspace.
+func NewHandler(organization string, workspaceLister tenancylisters.ClusterWorkspaceLister, kcpClusterClient kcpclient.ClusterInterface, kubeClusterClient kubernetes.ClusterInterface, authz authorizer.Authorizer) *Handler {
+	return &Handler{
+		organization:      organization,
+		workspaceLister:   workspaceLister,
+		kcpClusterClient:  kcpClusterClient,
+		kubeClusterClient: kubeClusterClient,
+		authorizer:        authz,
+	}
+}
+
+// WithHomeWorkspaces serves the requests to the `~` logical cluster in the home workspace
+// of their user, authorized against it. The home workspace is created if missing, and the
+// requests are answered with 503 and a Retry-After header until it is ready. Every other
+// request is passed to apiHandler. It expects authenticated requests, the requests to the
+// `~` logical cluster being authorized by NewAuthorizer.
+func (h *Handler) WithHomeWorkspaces(apiHandler http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		cluster := genericapirequest.ClusterFrom(req.Context())
+		if cluster == nil || cluster.Name != ClusterName {
+			apiHandler.ServeHTTP(w, req)
+			return
+		}
+
+		u, ok := genericapirequest.UserFrom(req.Context())
+		if !ok || isAnonymous(u) {
+			responsewriters.ErrorNegotiated(
+				apierrors.NewUnauthorized("home workspaces require authentication"),
+				scheme.Codecs, tenancyv1alpha1.SchemeGroupVersion, w, req,
+			)
+			return
+		}
+
+		clusterName, err := h.ensureHome(req.Context(), u)
+		if err != nil {
+			responsewriters.ErrorNegotiated(err, scheme.Codecs, tenancyv1alpha1.SchemeGroupVersion, w, req)
+			return
+		}
+
+		ctx := genericapirequest.WithCluster(req.Context(), genericapirequest.Cluster{Name: clusterName})
+		attributes, err := filters.GetAuthorizerAttributes(ctx)
+		if err != nil {
+			responsewriters.InternalError(w, req, err)
+			return
+		}
+		dec, reason, err := h.authorizer.Authorize(ctx, attributes)
+		if err != nil {
+			responsewriters.InternalError(w, req, err)
+			return
+		}
+		if dec != authorizer.DecisionAllow {
+			responsewriters.Forbidden(ctx, attributes, w, req, reason, scheme.Codecs)
+			return
+		}
+		apiHandler.ServeHTTP(w, req.WithContext(ctx))
+	}
+}
+
+// ensureHome returns the logical cluster of the home workspace of the given user, once it
+// is ready, creating it if missing. It is forbidden to use a workspace of another owner.
+func (h *Handler) ensureHome(ctx context.Context, u user.Info) (string, error) {
+	name := WorkspaceName(u.GetName())
+	workspace, err := h.workspaceLister.Get(helper.WorkspaceKey(h.organization, name))
+	if apierrors.IsNotFound(err) {
+		if err := h.create(ctx, u, name); err != nil {
+			return "", err
+		}
+		return "", notReady(name)
+	} else if err != nil {
+		return "", apierrors.NewInternalError(err)
+	}
+	if owner := workspace.Annotations[OwnerAnnotation]; owner != u.GetName() {
+		return "", apierrors.NewForbidden(tenancyv1alpha1.Resource("clusterworkspaces"), name, fmt.Errorf("home workspace %q is not owned by user %q", name, u.GetName()))
+	}
+	if workspace.Status.Phase != tenancyv1alpha1.ClusterWorkspacePhaseReady {
+		return "", notReady(name)
+	}
+	return helper.EncodeOrganizationAndWorkspace(h.organization, name), nil
+}
+
+// create creates the home workspace of the given name for the given user, along with the
+// RBAC granting the user admin access to it.
+func (h *Handler) create(ctx context.Context, u user.Info, name string) error {
+	orgClusterName := helper.EncodeOrganizationAndWorkspace(helper.RootCluster, h.organization)
+	klog.Infof("Creating home workspace %s|%s of user %q", orgClusterName, name, u.GetName())
+
+	rbac := h.kubeClusterClient.Cluster(orgClusterName).RbacV1()
+	roleName := "home-" + name
+	if _, err := rbac.ClusterRoles().Create(ctx, &rbacv1.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{Name: roleName},
+		Rules: []rbacv1.PolicyRule{
+			{
+				APIGroups:     []string{tenancyv1alpha1.SchemeGroupVersion.Group},
+				Resources:     []string{"workspaces/content"},
+				ResourceNames: []string{name},
+				Verbs:         []string{"admin", "access"},
+			},
+		},
+	}, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		return apierrors.NewInternalError(fmt.Errorf("failed to create the ClusterRole of home workspace %q: %w", name, err))
+	}
+	if _, err := rbac.ClusterRoleBindings().Create(ctx, &rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: roleName},
+		RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: roleName},
+		Subjects:   []rbacv1.Subject{{APIGroup: rbacv1.GroupName, Kind: rbacv1.UserKind, Name: u.GetName()}},
+	}, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		return apierrors.NewInternalError(fmt.Errorf("failed to create the ClusterRoleBinding of home workspace %q: %w", name, err))
+	}
+
+	if _, err := h.kcpClusterClient.Cluster(orgClusterName).TenancyV1alpha1().ClusterWorkspaces().Create(ctx, &tenancyv1alpha1.ClusterWorkspace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Annotations: map[string]string{OwnerAnnotation: u.GetName()},
+		},
+	}, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		return apierrors.NewInternalError(fmt.Errorf("failed to create home workspace %q: %w", name, err))
+	}
+	return nil
+}
+
+// notReady returns a 503 error asking clients to retry once the given home workspace is ready.
+func notReady(name string) error {
+	return &apierrors.StatusError{ErrStatus: metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    http.StatusServiceUnavailable,
+		Reason:  metav1.StatusReasonServiceUnavailable,
+		Message: fmt.Sprintf("home workspace %q is being created, please try again later", name),
+		Details: &metav1.StatusDetails{
+			Group:             tenancyv1alpha1.SchemeGroupVersion.Group,
+			Kind:              "clusterworkspaces",
+			Name:              name,
+			RetryAfterSeconds: retryAfterSeconds,
+		},
+	}}
+}
+
+func isAnonymous(u user.Info) bool {
+	if u.GetName() == user.Anonymous {
+		return true
+	}
+	for _, group := range u.GetGroups() {
+		if group == user.AllUnauthenticated {
+			return true
+		}
+	}
+	return false
+}
+
+// NewAuthorizer returns the given authorizer, allowing the requests of authenticated users
+// to the `~` logical cluster, such that they reach Handler.WithHomeWorkspaces, which
+// authorizes them against the home workspace of their user.
+func NewAuthorizer(delegate authorizer.Authorizer) authorizer.Authorizer {
+	return authorizer.AuthorizerFunc(func(ctx context.Context, attr authorizer.Attributes) (authorizer.Decision, string, error) {
+		if cluster := genericapirequest.ClusterFrom(ctx); cluster != nil && cluster.Name == ClusterName {
+			if attr.GetUser() == nil || isAnonymous(attr.GetUser()) {
+				return authorizer.DecisionDeny, "home workspaces require authentication", nil
+			}
+			return authorizer.DecisionAllow, "authorized against the home workspace once resolved", nil
+		}
+		return delegate.Authorize(ctx, attr)
+	})
+}
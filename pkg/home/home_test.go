@@ -0,0 +1,175 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package home
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/kubernetes"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	kcpclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
+	kcpfake "github.com/kcp-dev/kcp/pkg/client/clientset/versioned/fake"
+	tenancylisters "github.com/kcp-dev/kcp/pkg/client/listers/tenancy/v1alpha1"
+)
+
+func TestWorkspaceName(t *testing.T) {
+	require.Equal(t, "alice", WorkspaceName("alice"))
+	require.Equal(t, "bob-1", WorkspaceName("bob-1"))
+	for _, userName := range []string{"Alice", "alice@example.com", "system:serviceaccount:default:builder", "a", "@@@"} {
+		name := WorkspaceName(userName)
+		require.Regexp(t, reWorkspaceName, name, userName)
+		require.NotEqual(t, name, WorkspaceName(userName+"x"), "distinct users have distinct home workspaces")
+	}
+	require.NotEqual(t, WorkspaceName("Alice"), WorkspaceName("alice"))
+	require.NotEqual(t, WorkspaceName("Alice"), WorkspaceName(WorkspaceName("Alice")), "usernames cannot take the name of hashed ones")
+	require.Regexp(t, reWorkspaceName, WorkspaceName("alice--x"))
+	require.Equal(t, WorkspaceName("alice@example.com"), WorkspaceName("alice@example.com"))
+}
+
+// fakeKcpCluster returns the same fake clientset for every logical cluster, remembering the last one.
+type fakeKcpCluster struct {
+	*kcpfake.Clientset
+	clusterName string
+}
+
+func (c *fakeKcpCluster) Cluster(name string) kcpclient.Interface {
+	c.clusterName = name
+	return c.Clientset
+}
+
+type fakeKubeCluster struct {
+	*kubefake.Clientset
+}
+
+func (c *fakeKubeCluster) Cluster(name string) kubernetes.Interface {
+	return c.Clientset
+}
+
+func TestWithHomeWorkspaces(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	kcpClient := &fakeKcpCluster{Clientset: kcpfake.NewSimpleClientset()}
+	kubeClient := &fakeKubeCluster{Clientset: kubefake.NewSimpleClientset()}
+	var authorized string
+	authz := authorizer.AuthorizerFunc(func(ctx context.Context, attr authorizer.Attributes) (authorizer.Decision, string, error) {
+		authorized = genericapirequest.ClusterFrom(ctx).Name
+		if attr.GetUser().GetName() == "mallory" {
+			return authorizer.DecisionDeny, "", nil
+		}
+		return authorizer.DecisionAllow, "", nil
+	})
+	var served string
+	h := NewHandler("users", tenancylisters.NewClusterWorkspaceLister(indexer), kcpClient, kubeClient, authz).WithHomeWorkspaces(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			served = genericapirequest.ClusterFrom(req.Context()).Name
+		}),
+	)
+	serve := func(clusterName string, u user.Info) *httptest.ResponseRecorder {
+		ctx := genericapirequest.WithCluster(context.Background(), genericapirequest.Cluster{Name: clusterName})
+		ctx = genericapirequest.WithRequestInfo(ctx, &genericapirequest.RequestInfo{IsResourceRequest: true, Verb: "list", APIVersion: "v1", Resource: "configmaps"})
+		if u != nil {
+			ctx = genericapirequest.WithUser(ctx, u)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/configmaps", nil).WithContext(ctx))
+		return w
+	}
+	alice := &user.DefaultInfo{Name: "alice"}
+
+	w := serve("root:org", alice)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "root:org", served, "other logical clusters are passed through")
+
+	w = serve(ClusterName, &user.DefaultInfo{Name: user.Anonymous, Groups: []string{user.AllUnauthenticated}})
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// the home workspace is created on first use
+	w = serve(ClusterName, alice)
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Equal(t, "1", w.Header().Get("Retry-After"))
+	require.Equal(t, "root:users", kcpClient.clusterName)
+	ws, err := kcpClient.TenancyV1alpha1().ClusterWorkspaces().Get(context.Background(), "alice", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "alice", ws.Annotations[OwnerAnnotation])
+	binding, err := kubeClient.RbacV1().ClusterRoleBindings().Get(context.Background(), "home-alice", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "alice", binding.Subjects[0].Name)
+	role, err := kubeClient.RbacV1().ClusterRoles().Get(context.Background(), "home-alice", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"alice"}, role.Rules[0].ResourceNames)
+
+	// requests are retried until it is ready
+	ws.ClusterName = "root:users"
+	require.NoError(t, indexer.Add(ws))
+	w = serve(ClusterName, alice)
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	ws = ws.DeepCopy()
+	ws.Status.Phase = tenancyv1alpha1.ClusterWorkspacePhaseReady
+	require.NoError(t, indexer.Update(ws))
+	w = serve(ClusterName, alice)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "users:alice", served)
+	require.Equal(t, "users:alice", authorized, "requests are authorized against the home workspace")
+
+	// others cannot get into the home workspace of alice
+	require.NoError(t, indexer.Add(&tenancyv1alpha1.ClusterWorkspace{
+		ObjectMeta: metav1.ObjectMeta{ClusterName: "root:users", Name: "mallory", Annotations: map[string]string{OwnerAnnotation: "mallory"}},
+		Status:     tenancyv1alpha1.ClusterWorkspaceStatus{Phase: tenancyv1alpha1.ClusterWorkspacePhaseReady},
+	}))
+	served = ""
+	w = serve(ClusterName, &user.DefaultInfo{Name: "mallory"})
+	require.Equal(t, http.StatusForbidden, w.Code)
+	require.Empty(t, served)
+
+	// workspaces of other owners are not served as home workspaces
+	require.NoError(t, indexer.Add(&tenancyv1alpha1.ClusterWorkspace{
+		ObjectMeta: metav1.ObjectMeta{ClusterName: "root:users", Name: "eve", Annotations: map[string]string{OwnerAnnotation: "alice"}},
+		Status:     tenancyv1alpha1.ClusterWorkspaceStatus{Phase: tenancyv1alpha1.ClusterWorkspacePhaseReady},
+	}))
+	authorized = ""
+	w = serve(ClusterName, &user.DefaultInfo{Name: "eve"})
+	require.Equal(t, http.StatusForbidden, w.Code)
+	require.Empty(t, served)
+	require.Empty(t, authorized, "the owner is checked before authorization")
+}
+
+func TestNewAuthorizer(t *testing.T) {
+	a := NewAuthorizer(authorizer.AuthorizerFunc(func(ctx context.Context, attr authorizer.Attributes) (authorizer.Decision, string, error) {
+		return authorizer.DecisionNoOpinion, "", nil
+	}))
+	authorize := func(clusterName string, u user.Info) authorizer.Decision {
+		ctx := genericapirequest.WithCluster(context.Background(), genericapirequest.Cluster{Name: clusterName})
+		dec, _, err := a.Authorize(ctx, authorizer.AttributesRecord{User: u})
+		require.NoError(t, err)
+		return dec
+	}
+	require.Equal(t, authorizer.DecisionAllow, authorize(ClusterName, &user.DefaultInfo{Name: "alice"}))
+	require.Equal(t, authorizer.DecisionDeny, authorize(ClusterName, &user.DefaultInfo{Name: user.Anonymous}))
+	require.Equal(t, authorizer.DecisionNoOpinion, authorize("root:org", &user.DefaultInfo{Name: "alice"}))
+}
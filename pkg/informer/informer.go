@@ -31,6 +31,10 @@ import (
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/metadata/metadatainformer"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
 
@@ -46,12 +50,18 @@ type clusterDiscovery interface {
 	WithCluster(name string) discovery.DiscoveryInterface
 }
 
+// gvrSharedInformerFactory is implemented by both the dynamic and the
+// metadata-only shared informer factories.
+type gvrSharedInformerFactory interface {
+	ForResource(gvr schema.GroupVersionResource) informers.GenericInformer
+}
+
 // DynamicDiscoverySharedInformerFactory is a SharedInformerFactory that
 // dynamically discovers new types and begins informing on them.
 type DynamicDiscoverySharedInformerFactory struct {
 	workspaceLister tenancylisters.ClusterWorkspaceLister
 	disco           clusterDiscovery
-	dsif            dynamicinformer.DynamicSharedInformerFactory
+	dsif            gvrSharedInformerFactory
 	handler         GVREventHandler
 	filterFunc      func(interface{}) bool
 	pollInterval    time.Duration
@@ -102,10 +112,42 @@ func NewDynamicDiscoverySharedInformerFactory(
 	pollInterval time.Duration,
 ) DynamicDiscoverySharedInformerFactory {
 	dsif := dynamicinformer.NewDynamicSharedInformerFactory(dynClient, resyncPeriod)
+	return newDiscoverySharedInformerFactory(workspaceLister, disco, dsif, filterFunc, handler, pollInterval)
+}
+
+// NewMetadataDiscoverySharedInformerFactory returns a factory for shared
+// informers that discovers new types and informs on updates to the metadata
+// of resources of those types. The informed objects are
+// *metav1.PartialObjectMetadata, without spec and status, which keeps the
+// memory footprint low for controllers that only need names, labels and
+// annotations.
+//
+// The metadata client is expected to list and watch across all logical
+// clusters, see NewWildcardMetadataClient.
+func NewMetadataDiscoverySharedInformerFactory(
+	workspaceLister tenancylisters.ClusterWorkspaceLister,
+	disco clusterDiscovery,
+	metadataClient metadata.Interface,
+	filterFunc func(obj interface{}) bool,
+	handler GVREventHandler,
+	pollInterval time.Duration,
+) DynamicDiscoverySharedInformerFactory {
+	msif := metadatainformer.NewSharedInformerFactory(metadataClient, resyncPeriod)
+	return newDiscoverySharedInformerFactory(workspaceLister, disco, msif, filterFunc, handler, pollInterval)
+}
+
+func newDiscoverySharedInformerFactory(
+	workspaceLister tenancylisters.ClusterWorkspaceLister,
+	disco clusterDiscovery,
+	sif gvrSharedInformerFactory,
+	filterFunc func(obj interface{}) bool,
+	handler GVREventHandler,
+	pollInterval time.Duration,
+) DynamicDiscoverySharedInformerFactory {
 	return DynamicDiscoverySharedInformerFactory{
 		workspaceLister: workspaceLister,
 		disco:           disco,
-		dsif:            dsif,
+		dsif:            sif,
 		handler:         handler,
 		filterFunc:      filterFunc,
 		gvrs:            sets.NewString(),
@@ -113,6 +155,14 @@ func NewDynamicDiscoverySharedInformerFactory(
 	}
 }
 
+// NewWildcardMetadataClient returns a metadata client for the given config
+// that lists and watches across all logical clusters.
+func NewWildcardMetadataClient(config *rest.Config) (metadata.Interface, error) {
+	wildcardConfig := rest.CopyConfig(config)
+	wildcardConfig.Host += "/clusters/*"
+	return metadata.NewForConfig(wildcardConfig)
+}
+
 // GVREventHandler is an event handler that includes the GroupVersionResource
 // of the resource being handled.
 type GVREventHandler interface {
@@ -0,0 +1,124 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package objectcount
+
+import (
+	"fmt"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/kcp-dev/kcp/pkg/informer"
+)
+
+// Counter counts the objects per logical cluster and resource. It is maintained
+// incrementally from the events of informers across all logical clusters, such that
+// quota checks get the count of a logical cluster in constant time, instead of listing
+// its objects on every admission call.
+//
+// The counts are eventually consistent, i.e. they lag behind the storage by the
+// latency of the watches.
+type Counter struct {
+	lock sync.RWMutex
+	// counts holds the number of objects per resource version and logical cluster. Empty
+	// logical clusters are dropped.
+	counts map[schema.GroupVersionResource]map[string]int64
+}
+
+var _ informer.GVREventHandler = &Counter{}
+
+// NewCounter returns an empty Counter. It is to be fed as event handler to informers.
+func NewCounter() *Counter {
+	return &Counter{
+		counts: map[schema.GroupVersionResource]map[string]int64{},
+	}
+}
+
+// Count returns the number of objects of the given resource in the given logical cluster.
+// If the resource is informed in several versions, e.g. because the logical clusters
+// prefer different versions of a CRD, the highest count is returned.
+func (c *Counter) Count(clusterName string, resource schema.GroupResource) int64 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	var count int64
+	for gvr, counts := range c.counts {
+		if gvr.GroupResource() == resource && counts[clusterName] > count {
+			count = counts[clusterName]
+		}
+	}
+	return count
+}
+
+// Total returns the number of objects of all the counted resources in the given logical
+// cluster, counting every resource in the version with the highest count.
+func (c *Counter) Total(clusterName string) int64 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	byResource := map[schema.GroupResource]int64{}
+	for gvr, counts := range c.counts {
+		if count := counts[clusterName]; count > byResource[gvr.GroupResource()] {
+			byResource[gvr.GroupResource()] = count
+		}
+	}
+	var total int64
+	for _, count := range byResource {
+		total += count
+	}
+	return total
+}
+
+func (c *Counter) OnAdd(gvr schema.GroupVersionResource, obj interface{}) {
+	c.add(gvr, obj, 1)
+}
+
+func (c *Counter) OnUpdate(gvr schema.GroupVersionResource, oldObj, newObj interface{}) {
+	// Nothing to do, the logical cluster of an object never changes.
+}
+
+func (c *Counter) OnDelete(gvr schema.GroupVersionResource, obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	c.add(gvr, obj, -1)
+}
+
+func (c *Counter) add(gvr schema.GroupVersionResource, obj interface{}, delta int64) {
+	metaObj, err := meta.Accessor(obj)
+	if err != nil {
+		runtime.HandleError(fmt.Errorf("failed to count %s object: %w", gvr, err))
+		return
+	}
+	clusterName := metaObj.GetClusterName()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	counts, found := c.counts[gvr]
+	if !found {
+		counts = map[string]int64{}
+		c.counts[gvr] = counts
+	}
+	if count := counts[clusterName] + delta; count > 0 {
+		counts[clusterName] = count
+	} else {
+		delete(counts, clusterName)
+	}
+}
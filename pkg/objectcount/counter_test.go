@@ -0,0 +1,62 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package objectcount
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestCounter(t *testing.T) {
+	configMapsV1 := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	widgetsV1 := schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+	widgetsV2 := schema.GroupVersionResource{Group: "example.com", Version: "v2", Resource: "widgets"}
+	object := func(clusterName, name string) *metav1.PartialObjectMetadata {
+		return &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{ClusterName: clusterName, Namespace: "default", Name: name}}
+	}
+
+	c := NewCounter()
+	c.OnAdd(configMapsV1, object("org:a", "1"))
+	c.OnAdd(configMapsV1, object("org:a", "2"))
+	c.OnAdd(configMapsV1, object("org:b", "1"))
+	c.OnUpdate(configMapsV1, object("org:a", "1"), object("org:a", "1"))
+	require.Equal(t, int64(2), c.Count("org:a", configMapsV1.GroupResource()))
+	require.Equal(t, int64(1), c.Count("org:b", configMapsV1.GroupResource()))
+	require.Equal(t, int64(0), c.Count("org:c", configMapsV1.GroupResource()))
+	require.Equal(t, int64(0), c.Count("org:a", widgetsV1.GroupResource()))
+
+	c.OnDelete(configMapsV1, object("org:a", "1"))
+	c.OnDelete(configMapsV1, cache.DeletedFinalStateUnknown{Key: "org:b|default/1", Obj: object("org:b", "1")})
+	require.Equal(t, int64(1), c.Count("org:a", configMapsV1.GroupResource()))
+	require.Equal(t, int64(0), c.Count("org:b", configMapsV1.GroupResource()))
+	require.NotContains(t, c.counts[configMapsV1], "org:b", "empty logical clusters are dropped")
+
+	// the highest count of the versions of a resource
+	c.OnAdd(widgetsV1, object("org:a", "1"))
+	c.OnAdd(widgetsV2, object("org:a", "1"))
+	c.OnAdd(widgetsV2, object("org:a", "2"))
+	require.Equal(t, int64(2), c.Count("org:a", widgetsV1.GroupResource()))
+
+	// every resource counted once
+	require.Equal(t, int64(3), c.Total("org:a"))
+	require.Equal(t, int64(0), c.Total("org:b"))
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apibindingconflicts
+
+import (
+	"strings"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+	apishelper "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1/helper"
+	conditionsapi "github.com/kcp-dev/kcp/third_party/conditions/apis/conditions/v1alpha1"
+	"github.com/kcp-dev/kcp/third_party/conditions/util/conditions"
+)
+
+// updateNamesAccepted sets the NamesAccepted condition of the APIBinding according to the
+// conflicts of its bound resources with the given CRDs and APIBindings of its workspace.
+func updateNamesAccepted(binding *apisv1alpha1.APIBinding, crds []*apiextensionsv1.CustomResourceDefinition, bindings []*apisv1alpha1.APIBinding) {
+	conflicts := apishelper.NamingConflicts(binding, apishelper.BoundGroupResources(binding), crds, bindings)
+
+	if rejected := apishelper.RejectedNamingConflicts(binding, conflicts); len(rejected) > 0 {
+		conditions.MarkFalse(binding, apisv1alpha1.NamesAccepted, apisv1alpha1.NamingConflictsReason, conditionsapi.ConditionSeverityError,
+			"not serving conflicting resources: %s", describe(rejected))
+		return
+	}
+	if len(conflicts) > 0 && apishelper.ConflictPolicy(binding) == apisv1alpha1.APIBindingConflictPolicyLocalWins {
+		conditions.MarkFalse(binding, apisv1alpha1.NamesAccepted, apisv1alpha1.LocalResourcesWinReason, conditionsapi.ConditionSeverityWarning,
+			"not serving resources defined in the workspace: %s", describe(conflicts))
+		return
+	}
+	conditions.MarkTrue(binding, apisv1alpha1.NamesAccepted)
+}
+
+func describe(conflicts []apishelper.NamingConflict) string {
+	msgs := make([]string, 0, len(conflicts))
+	for _, c := range conflicts {
+		msgs = append(msgs, c.String())
+	}
+	return strings.Join(msgs, "; ")
+}
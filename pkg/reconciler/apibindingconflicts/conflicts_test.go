@@ -0,0 +1,115 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apibindingconflicts
+
+import (
+	"testing"
+	"time"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+	"github.com/kcp-dev/kcp/third_party/conditions/util/conditions"
+)
+
+func newBinding(name string, created time.Time, policy apisv1alpha1.APIBindingConflictPolicyType) *apisv1alpha1.APIBinding {
+	return &apisv1alpha1.APIBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			ClusterName:       "acme:consumer",
+			Name:              name,
+			CreationTimestamp: metav1.NewTime(created),
+		},
+		Spec: apisv1alpha1.APIBindingSpec{ConflictPolicy: policy},
+		Status: apisv1alpha1.APIBindingStatus{
+			BoundAPIExport: &apisv1alpha1.ExportReference{
+				Workspace: &apisv1alpha1.WorkspaceExportReference{WorkspaceName: "provider", ExportName: name},
+			},
+			BoundResources: []apisv1alpha1.BoundAPIResource{
+				{Group: "today.dev", Resource: "widgets"},
+			},
+		},
+	}
+}
+
+func TestUpdateNamesAccepted(t *testing.T) {
+	now := time.Now()
+	widgetsCRD := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{ClusterName: "acme:consumer", Name: "widgets.today.dev"},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: "today.dev",
+			Names: apiextensionsv1.CustomResourceDefinitionNames{Plural: "widgets"},
+		},
+	}
+
+	for _, tt := range []struct {
+		name       string
+		binding    *apisv1alpha1.APIBinding
+		crds       []*apiextensionsv1.CustomResourceDefinition
+		bindings   []*apisv1alpha1.APIBinding
+		wantTrue   bool
+		wantReason string
+	}{
+		{
+			name:     "no conflicts",
+			binding:  newBinding("today", now, ""),
+			wantTrue: true,
+		},
+		{
+			name:       "conflicting CRD with the default policy",
+			binding:    newBinding("today", now, ""),
+			crds:       []*apiextensionsv1.CustomResourceDefinition{widgetsCRD},
+			wantReason: apisv1alpha1.NamingConflictsReason,
+		},
+		{
+			name:       "conflicting CRD with the LocalWins policy",
+			binding:    newBinding("today", now, apisv1alpha1.APIBindingConflictPolicyLocalWins),
+			crds:       []*apiextensionsv1.CustomResourceDefinition{widgetsCRD},
+			wantReason: apisv1alpha1.LocalResourcesWinReason,
+		},
+		{
+			name:     "conflicting CRD with the BindingWins policy",
+			binding:  newBinding("today", now, apisv1alpha1.APIBindingConflictPolicyBindingWins),
+			crds:     []*apiextensionsv1.CustomResourceDefinition{widgetsCRD},
+			wantTrue: true,
+		},
+		{
+			name:       "older APIBinding binding the same resource",
+			binding:    newBinding("today", now, apisv1alpha1.APIBindingConflictPolicyBindingWins),
+			bindings:   []*apisv1alpha1.APIBinding{newBinding("yesterday", now.Add(-time.Hour), "")},
+			wantReason: apisv1alpha1.NamingConflictsReason,
+		},
+		{
+			name:     "newer APIBinding binding the same resource",
+			binding:  newBinding("today", now, ""),
+			bindings: []*apisv1alpha1.APIBinding{newBinding("tomorrow", now.Add(time.Hour), "")},
+			wantTrue: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			bindings := append([]*apisv1alpha1.APIBinding{tt.binding}, tt.bindings...)
+			updateNamesAccepted(tt.binding, tt.crds, bindings)
+
+			if got := conditions.IsTrue(tt.binding, apisv1alpha1.NamesAccepted); got != tt.wantTrue {
+				t.Errorf("got NamesAccepted=%v, want %v", got, tt.wantTrue)
+			}
+			if got := conditions.GetReason(tt.binding, apisv1alpha1.NamesAccepted); got != tt.wantReason {
+				t.Errorf("got reason %q, want %q", got, tt.wantReason)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apibindingconflicts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsinformers "k8s.io/apiextensions-apiserver/pkg/client/informers/externalversions/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+	kcpclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
+	apisinformer "github.com/kcp-dev/kcp/pkg/client/informers/externalversions/apis/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/reconciler/boundcrds"
+	reconcilermetrics "github.com/kcp-dev/kcp/pkg/reconciler/metrics"
+)
+
+const (
+	controllerName = "apibinding-conflicts"
+
+	byWorkspace = "byWorkspace"
+)
+
+func NewController(
+	kcpClient kcpclient.ClusterInterface,
+	apiBindingInformer apisinformer.APIBindingInformer,
+	crdInformer apiextensionsinformers.CustomResourceDefinitionInformer,
+) (*Controller, error) {
+	queue := reconcilermetrics.InstrumentQueue(controllerName, workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), controllerName))
+
+	c := &Controller{
+		queue:             queue,
+		kcpClient:         kcpClient,
+		apiBindingIndexer: apiBindingInformer.Informer().GetIndexer(),
+		crdIndexer:        crdInformer.Informer().GetIndexer(),
+	}
+
+	if err := apiBindingInformer.Informer().AddIndexers(cache.Indexers{
+		byWorkspace: indexByWorkspace,
+	}); err != nil {
+		return nil, err
+	}
+	if err := crdInformer.Informer().AddIndexers(cache.Indexers{
+		byWorkspace: indexByWorkspace,
+	}); err != nil {
+		return nil, err
+	}
+
+	apiBindingInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.enqueue(obj) },
+		UpdateFunc: func(_, obj interface{}) { c.enqueue(obj) },
+		DeleteFunc: func(obj interface{}) { c.enqueue(obj) },
+	})
+	crdInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.enqueue(obj) },
+		UpdateFunc: func(_, obj interface{}) { c.enqueue(obj) },
+		DeleteFunc: func(obj interface{}) { c.enqueue(obj) },
+	})
+
+	return c, nil
+}
+
+// Controller detects conflicts between the resources bound by APIBindings and the CRDs and
+// other APIBindings of their workspace, and reports them in the NamesAccepted condition of
+// the APIBindings, according to their conflict policy. Workspaces are reconciled as a whole,
+// because a change of one APIBinding or CRD can resolve or cause conflicts of all the others.
+type Controller struct {
+	queue workqueue.RateLimitingInterface
+
+	kcpClient         kcpclient.ClusterInterface
+	apiBindingIndexer cache.Indexer
+	crdIndexer        cache.Indexer
+}
+
+// indexByWorkspace indexes objects by their logical cluster.
+func indexByWorkspace(obj interface{}) ([]string, error) {
+	metaObj, ok := obj.(metav1.Object)
+	if !ok {
+		return []string{}, fmt.Errorf("obj is supposed to be a metav1.Object, but is %T", obj)
+	}
+	return []string{metaObj.GetClusterName()}, nil
+}
+
+// enqueue queues the logical cluster of the given APIBinding or CRD.
+func (c *Controller) enqueue(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	metaObj, ok := obj.(metav1.Object)
+	if !ok {
+		runtime.HandleError(fmt.Errorf("obj is supposed to be a metav1.Object, but is %T", obj))
+		return
+	}
+	clusterName := metaObj.GetClusterName()
+	if _, ok := boundcrds.HashFromShadowClusterName(clusterName); ok {
+		return // shadow CRDs are not part of any workspace
+	}
+	klog.Infof("queueing workspace %q", clusterName)
+	c.queue.Add(clusterName)
+}
+
+func (c *Controller) Start(ctx context.Context, numThreads int) {
+	defer runtime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.Info("Starting APIBinding conflicts controller")
+	defer klog.Info("Shutting down APIBinding conflicts controller")
+
+	for i := 0; i < numThreads; i++ {
+		go wait.Until(func() { c.startWorker(ctx) }, time.Second, ctx.Done())
+	}
+
+	<-ctx.Done()
+}
+
+func (c *Controller) startWorker(ctx context.Context) {
+	for c.processNextWorkItem(ctx) {
+	}
+}
+
+func (c *Controller) processNextWorkItem(ctx context.Context) bool {
+	// Wait until there is a new item in the working queue
+	k, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	key := k.(string)
+
+	klog.Infof("processing key %q", key)
+
+	// No matter what, tell the queue we're done with this key, to unblock
+	// other workers.
+	defer c.queue.Done(key)
+
+	if err := c.process(ctx, key); err != nil {
+		runtime.HandleError(fmt.Errorf("%q controller failed to sync %q, err: %w", controllerName, key, err))
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+func (c *Controller) process(ctx context.Context, clusterName string) error {
+	objs, err := c.apiBindingIndexer.ByIndex(byWorkspace, clusterName)
+	if err != nil {
+		return err
+	}
+	bindings := make([]*apisv1alpha1.APIBinding, 0, len(objs))
+	for _, obj := range objs {
+		bindings = append(bindings, obj.(*apisv1alpha1.APIBinding))
+	}
+
+	objs, err = c.crdIndexer.ByIndex(byWorkspace, clusterName)
+	if err != nil {
+		return err
+	}
+	crds := make([]*apiextensionsv1.CustomResourceDefinition, 0, len(objs))
+	for _, obj := range objs {
+		crds = append(crds, obj.(*apiextensionsv1.CustomResourceDefinition))
+	}
+
+	var errs []error
+	for _, old := range bindings {
+		if old.Status.BoundAPIExport == nil {
+			continue // not bound yet
+		}
+		binding := old.DeepCopy()
+		updateNamesAccepted(binding, crds, bindings)
+		if err := c.patchStatus(ctx, old, binding); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to update APIBindings of workspace %q: %v", clusterName, errs)
+	}
+	return nil
+}
+
+func (c *Controller) patchStatus(ctx context.Context, old, obj *apisv1alpha1.APIBinding) error {
+	if equality.Semantic.DeepEqual(old.Status, obj.Status) {
+		return nil
+	}
+
+	oldData, err := json.Marshal(apisv1alpha1.APIBinding{
+		Status: old.Status,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to Marshal old data for APIBinding %s|%s: %w", obj.ClusterName, obj.Name, err)
+	}
+	newData, err := json.Marshal(apisv1alpha1.APIBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			UID:             old.UID,
+			ResourceVersion: old.ResourceVersion,
+		}, // to ensure they appear in the patch as preconditions
+		Status: obj.Status,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to Marshal new data for APIBinding %s|%s: %w", obj.ClusterName, obj.Name, err)
+	}
+	patchBytes, err := jsonpatch.CreateMergePatch(oldData, newData)
+	if err != nil {
+		return fmt.Errorf("failed to create patch for APIBinding %s|%s: %w", obj.ClusterName, obj.Name, err)
+	}
+	_, err = c.kcpClient.Cluster(obj.ClusterName).ApisV1alpha1().APIBindings().Patch(ctx, obj.Name, types.MergePatchType, patchBytes, metav1.PatchOptions{}, "status")
+	return err
+}
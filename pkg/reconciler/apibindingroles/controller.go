@@ -0,0 +1,301 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apibindingroles
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	rbacinformers "k8s.io/client-go/informers/rbac/v1"
+	"k8s.io/client-go/kubernetes"
+	rbaclisters "k8s.io/client-go/listers/rbac/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clusters"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+	apishelper "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1/helper"
+	apisinformer "github.com/kcp-dev/kcp/pkg/client/informers/externalversions/apis/v1alpha1"
+	apislister "github.com/kcp-dev/kcp/pkg/client/listers/apis/v1alpha1"
+	reconcilermetrics "github.com/kcp-dev/kcp/pkg/reconciler/metrics"
+)
+
+const (
+	controllerName = "apibinding-roles"
+)
+
+func NewController(
+	kubeClusterClient *kubernetes.Cluster,
+	apiBindingInformer apisinformer.APIBindingInformer,
+	apiResourceSchemaInformer apisinformer.APIResourceSchemaInformer,
+	clusterRoleInformer rbacinformers.ClusterRoleInformer,
+) (*Controller, error) {
+	queue := reconcilermetrics.InstrumentQueue(controllerName, workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), controllerName))
+
+	c := &Controller{
+		queue:                   queue,
+		kubeClusterClient:       kubeClusterClient,
+		apiBindingLister:        apiBindingInformer.Lister(),
+		apiResourceSchemaLister: apiResourceSchemaInformer.Lister(),
+		clusterRoleLister:       clusterRoleInformer.Lister(),
+	}
+
+	apiBindingInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.enqueue(obj) },
+		UpdateFunc: func(_, obj interface{}) { c.enqueue(obj) },
+		DeleteFunc: func(obj interface{}) { c.enqueue(obj) },
+	})
+	apiResourceSchemaInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) { c.enqueueSchema(obj) },
+	})
+	clusterRoleInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: func(obj interface{}) bool {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			role, ok := obj.(*rbacv1.ClusterRole)
+			return ok && role.Labels[BindingLabel] != ""
+		},
+		Handler: cache.ResourceEventHandlerFuncs{
+			UpdateFunc: func(_, obj interface{}) { c.enqueueClusterRole(obj) },
+			DeleteFunc: func(obj interface{}) { c.enqueueClusterRole(obj) },
+		},
+	})
+
+	return c, nil
+}
+
+// Controller materializes the default `<export>-edit` and `<export>-view` ClusterRoles for
+// the resources bound by APIBindings in the workspace of the APIBinding, and keeps them in
+// sync with the bound resources. The ClusterRoles are labelled with the name of the
+// APIBinding, and deleted when the APIBinding is deleted. ClusterRoles of the same name
+// that are not managed by the APIBinding are left untouched.
+type Controller struct {
+	queue workqueue.RateLimitingInterface
+
+	kubeClusterClient       *kubernetes.Cluster
+	apiBindingLister        apislister.APIBindingLister
+	apiResourceSchemaLister apislister.APIResourceSchemaLister
+	clusterRoleLister       rbaclisters.ClusterRoleLister
+}
+
+func (c *Controller) enqueue(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	klog.Infof("queueing APIBinding %q", key)
+	c.queue.Add(key)
+}
+
+// enqueueSchema queues the APIBindings bound to the given APIResourceSchema, whose roles
+// depend on the subresources declared by the schema.
+func (c *Controller) enqueueSchema(obj interface{}) {
+	s, ok := obj.(*apisv1alpha1.APIResourceSchema)
+	if !ok {
+		runtime.HandleError(fmt.Errorf("obj is supposed to be an APIResourceSchema, but is %T", obj))
+		return
+	}
+
+	bindings, err := c.apiBindingLister.List(labels.Everything())
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	for _, binding := range bindings {
+		if binding.Status.BoundAPIExport == nil {
+			continue
+		}
+		exportClusterName, _, ok := apishelper.ExportClusterName(binding.ClusterName, *binding.Status.BoundAPIExport)
+		if !ok || exportClusterName != s.ClusterName {
+			continue
+		}
+		for _, bound := range binding.Status.BoundResources {
+			if bound.Schema.Name == s.Name {
+				c.enqueue(binding)
+				break
+			}
+		}
+	}
+}
+
+// enqueueClusterRole queues the APIBinding managing the given ClusterRole, when it is
+// changed or deleted by somebody else.
+func (c *Controller) enqueueClusterRole(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	role, ok := obj.(*rbacv1.ClusterRole)
+	if !ok {
+		runtime.HandleError(fmt.Errorf("obj is supposed to be a ClusterRole, but is %T", obj))
+		return
+	}
+	key := clusters.ToClusterAwareKey(role.ClusterName, role.Labels[BindingLabel])
+	klog.Infof("queueing APIBinding %q because of ClusterRole %s|%s", key, role.ClusterName, role.Name)
+	c.queue.Add(key)
+}
+
+func (c *Controller) Start(ctx context.Context, numThreads int) {
+	defer runtime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.Info("Starting APIBinding roles controller")
+	defer klog.Info("Shutting down APIBinding roles controller")
+
+	for i := 0; i < numThreads; i++ {
+		go wait.Until(func() { c.startWorker(ctx) }, time.Second, ctx.Done())
+	}
+
+	<-ctx.Done()
+}
+
+func (c *Controller) startWorker(ctx context.Context) {
+	for c.processNextWorkItem(ctx) {
+	}
+}
+
+func (c *Controller) processNextWorkItem(ctx context.Context) bool {
+	// Wait until there is a new item in the working queue
+	k, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	key := k.(string)
+
+	klog.Infof("processing key %q", key)
+
+	// No matter what, tell the queue we're done with this key, to unblock
+	// other workers.
+	defer c.queue.Done(key)
+
+	if err := c.process(ctx, key); err != nil {
+		runtime.HandleError(fmt.Errorf("%q controller failed to sync %q, err: %w", controllerName, key, err))
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+func (c *Controller) process(ctx context.Context, key string) error {
+	_, clusterAwareName, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		klog.Errorf("invalid key: %q: %v", key, err)
+		return nil
+	}
+	clusterName, name := clusters.SplitClusterAwareKey(clusterAwareName)
+
+	var desired []*rbacv1.ClusterRole
+	binding, err := c.apiBindingLister.Get(key)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	} else if err == nil {
+		schemas, err := c.boundSchemas(binding)
+		if err != nil {
+			return err
+		}
+		desired = defaultClusterRoles(binding, schemas)
+	}
+
+	existing, err := c.managedClusterRoles(clusterName, name)
+	if err != nil {
+		return err
+	}
+
+	client := c.kubeClusterClient.Cluster(clusterName).RbacV1().ClusterRoles()
+	for _, role := range desired {
+		current, err := c.clusterRoleLister.Get(clusters.ToClusterAwareKey(clusterName, role.Name))
+		if errors.IsNotFound(err) {
+			if _, err := client.Create(ctx, role, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+				return err
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if current.Labels[BindingLabel] != name {
+			klog.Infof("Not managing ClusterRole %s|%s for APIBinding %s: it exists and is not managed by the APIBinding", clusterName, role.Name, name)
+			continue
+		}
+		delete(existing, role.Name)
+		if equality.Semantic.DeepEqual(current.Rules, role.Rules) && equality.Semantic.DeepEqual(current.Labels, role.Labels) {
+			continue
+		}
+		updated := current.DeepCopy()
+		updated.Labels = role.Labels
+		updated.Rules = role.Rules
+		if _, err := client.Update(ctx, updated, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+	}
+
+	for roleName := range existing {
+		if err := client.Delete(ctx, roleName, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// managedClusterRoles returns the names of the ClusterRoles of the given logical cluster
+// that are managed by the APIBinding of the given name.
+func (c *Controller) managedClusterRoles(clusterName, bindingName string) (map[string]bool, error) {
+	roles, err := c.clusterRoleLister.List(labels.SelectorFromSet(labels.Set{BindingLabel: bindingName}))
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	for _, role := range roles {
+		if role.ClusterName == clusterName {
+			names[role.Name] = true
+		}
+	}
+	return names, nil
+}
+
+// boundSchemas returns the APIResourceSchemas bound by the APIBinding, by name.
+func (c *Controller) boundSchemas(binding *apisv1alpha1.APIBinding) (map[string]*apisv1alpha1.APIResourceSchema, error) {
+	schemas := map[string]*apisv1alpha1.APIResourceSchema{}
+	if binding.Status.BoundAPIExport == nil {
+		return schemas, nil
+	}
+	exportClusterName, _, ok := apishelper.ExportClusterName(binding.ClusterName, *binding.Status.BoundAPIExport)
+	if !ok {
+		return schemas, nil
+	}
+	for _, bound := range binding.Status.BoundResources {
+		s, err := c.apiResourceSchemaLister.Get(clusters.ToClusterAwareKey(exportClusterName, bound.Schema.Name))
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		schemas[bound.Schema.Name] = s
+	}
+	return schemas, nil
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apibindingroles
+
+import (
+	"sort"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+	apishelper "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1/helper"
+)
+
+const (
+	// BindingLabel is set on the ClusterRoles materialized for an APIBinding, with the
+	// name of the APIBinding as value.
+	BindingLabel = "apis.kcp.dev/binding"
+
+	aggregateToAdminLabel = "rbac.authorization.k8s.io/aggregate-to-admin"
+	aggregateToEditLabel  = "rbac.authorization.k8s.io/aggregate-to-edit"
+	aggregateToViewLabel  = "rbac.authorization.k8s.io/aggregate-to-view"
+)
+
+var (
+	viewVerbs = []string{"get", "list", "watch"}
+	editVerbs = []string{"create", "delete", "deletecollection", "get", "list", "patch", "update", "watch"}
+)
+
+// defaultClusterRoles returns the `<export>-edit` and `<export>-view` ClusterRoles granting
+// access to the resources bound by the APIBinding, and to their status and scale subresources
+// as declared by the bound APIResourceSchemas, given by name. Like for the built-in
+// resources, the status subresource is read-only in both roles. The roles are aggregated
+// into the default admin, edit and view ClusterRoles of the workspace. No roles are
+// returned if the APIBinding has no bound resources.
+func defaultClusterRoles(binding *apisv1alpha1.APIBinding, schemas map[string]*apisv1alpha1.APIResourceSchema) []*rbacv1.ClusterRole {
+	if binding.Status.BoundAPIExport == nil || len(binding.Status.BoundResources) == 0 {
+		return nil
+	}
+	_, exportName, ok := apishelper.ExportClusterName(binding.ClusterName, *binding.Status.BoundAPIExport)
+	if !ok {
+		return nil
+	}
+
+	editResources := map[string]sets.String{}
+	viewResources := map[string]sets.String{}
+	for _, bound := range binding.Status.BoundResources {
+		if _, found := editResources[bound.Group]; !found {
+			editResources[bound.Group] = sets.NewString()
+			viewResources[bound.Group] = sets.NewString()
+		}
+		editResources[bound.Group].Insert(bound.Resource)
+		viewResources[bound.Group].Insert(bound.Resource)
+
+		status, scale := subresources(schemas[bound.Schema.Name])
+		if status {
+			viewResources[bound.Group].Insert(bound.Resource + "/status")
+		}
+		if scale {
+			editResources[bound.Group].Insert(bound.Resource + "/scale")
+			viewResources[bound.Group].Insert(bound.Resource + "/scale")
+		}
+	}
+	groups := make([]string, 0, len(editResources))
+	for group := range editResources {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	rules := func(verbs []string, resourcesByGroup map[string]sets.String) []rbacv1.PolicyRule {
+		rules := make([]rbacv1.PolicyRule, 0, len(groups))
+		for _, group := range groups {
+			rules = append(rules, rbacv1.PolicyRule{
+				Verbs:     verbs,
+				APIGroups: []string{group},
+				Resources: resourcesByGroup[group].List(),
+			})
+		}
+		return rules
+	}
+
+	return []*rbacv1.ClusterRole{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: exportName + "-edit",
+				Labels: map[string]string{
+					BindingLabel:          binding.Name,
+					aggregateToAdminLabel: "true",
+					aggregateToEditLabel:  "true",
+				},
+			},
+			Rules: rules(editVerbs, editResources),
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: exportName + "-view",
+				Labels: map[string]string{
+					BindingLabel:         binding.Name,
+					aggregateToViewLabel: "true",
+				},
+			},
+			Rules: rules(viewVerbs, viewResources),
+		},
+	}
+}
+
+// subresources returns whether a served version of the APIResourceSchema declares the
+// status and the scale subresource.
+func subresources(s *apisv1alpha1.APIResourceSchema) (status, scale bool) {
+	if s == nil {
+		return false, false
+	}
+	for _, v := range s.Spec.Versions {
+		if !v.Served || v.Subresources == nil {
+			continue
+		}
+		status = status || v.Subresources.Status != nil
+		scale = scale || v.Subresources.Scale != nil
+	}
+	return status, scale
+}
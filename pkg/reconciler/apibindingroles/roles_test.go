@@ -0,0 +1,115 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apibindingroles
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+)
+
+func TestDefaultClusterRoles(t *testing.T) {
+	boundExport := &apisv1alpha1.ExportReference{
+		Workspace: &apisv1alpha1.WorkspaceExportReference{WorkspaceName: "provider", ExportName: "today"},
+	}
+
+	schemas := map[string]*apisv1alpha1.APIResourceSchema{
+		"today.cowboys.wildwest.dev": {
+			Spec: apisv1alpha1.APIResourceSchemaSpec{
+				Versions: []apisv1alpha1.APIResourceVersion{
+					{
+						Name:   "v1",
+						Served: true,
+						Subresources: &apiextensionsv1.CustomResourceSubresources{
+							Status: &apiextensionsv1.CustomResourceSubresourceStatus{},
+							Scale:  &apiextensionsv1.CustomResourceSubresourceScale{SpecReplicasPath: ".spec.replicas", StatusReplicasPath: ".status.replicas"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range []struct {
+		name    string
+		binding *apisv1alpha1.APIBinding
+		want    []*rbacv1.ClusterRole
+	}{
+		{
+			name: "not bound yet",
+			binding: &apisv1alpha1.APIBinding{
+				ObjectMeta: metav1.ObjectMeta{ClusterName: "acme:consumer", Name: "today"},
+			},
+		},
+		{
+			name: "bound resources",
+			binding: &apisv1alpha1.APIBinding{
+				ObjectMeta: metav1.ObjectMeta{ClusterName: "acme:consumer", Name: "today"},
+				Status: apisv1alpha1.APIBindingStatus{
+					BoundAPIExport: boundExport,
+					BoundResources: []apisv1alpha1.BoundAPIResource{
+						{Group: "wildwest.dev", Resource: "sheriffs"},
+						{Group: "today.dev", Resource: "widgets"},
+						{Group: "wildwest.dev", Resource: "cowboys", Schema: apisv1alpha1.BoundAPIResourceSchema{Name: "today.cowboys.wildwest.dev"}},
+					},
+				},
+			},
+			want: []*rbacv1.ClusterRole{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "today-edit",
+						Labels: map[string]string{
+							BindingLabel:          "today",
+							aggregateToAdminLabel: "true",
+							aggregateToEditLabel:  "true",
+						},
+					},
+					Rules: []rbacv1.PolicyRule{
+						{Verbs: editVerbs, APIGroups: []string{"today.dev"}, Resources: []string{"widgets"}},
+						{Verbs: editVerbs, APIGroups: []string{"wildwest.dev"}, Resources: []string{"cowboys", "cowboys/scale", "sheriffs"}},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "today-view",
+						Labels: map[string]string{
+							BindingLabel:         "today",
+							aggregateToViewLabel: "true",
+						},
+					},
+					Rules: []rbacv1.PolicyRule{
+						{Verbs: viewVerbs, APIGroups: []string{"today.dev"}, Resources: []string{"widgets"}},
+						{Verbs: viewVerbs, APIGroups: []string{"wildwest.dev"}, Resources: []string{"cowboys", "cowboys/scale", "cowboys/status", "sheriffs"}},
+					},
+				},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := defaultClusterRoles(tt.binding, schemas)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("unexpected ClusterRoles (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,339 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apibindingupgrade
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clusters"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+	apishelper "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1/helper"
+	kcpclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
+	apisinformer "github.com/kcp-dev/kcp/pkg/client/informers/externalversions/apis/v1alpha1"
+	apislister "github.com/kcp-dev/kcp/pkg/client/listers/apis/v1alpha1"
+	reconcilermetrics "github.com/kcp-dev/kcp/pkg/reconciler/metrics"
+	conditionsapi "github.com/kcp-dev/kcp/third_party/conditions/apis/conditions/v1alpha1"
+	"github.com/kcp-dev/kcp/third_party/conditions/util/conditions"
+)
+
+const (
+	controllerName = "apibinding-upgrade"
+
+	byBoundExport = "byBoundExport"
+)
+
+func NewController(
+	kcpClient kcpclient.ClusterInterface,
+	dynamicClusterClient dynamic.ClusterInterface,
+	apiBindingInformer apisinformer.APIBindingInformer,
+	apiExportInformer apisinformer.APIExportInformer,
+	apiResourceSchemaInformer apisinformer.APIResourceSchemaInformer,
+) (*Controller, error) {
+	queue := reconcilermetrics.InstrumentQueue(controllerName, workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), controllerName))
+
+	c := &Controller{
+		queue:                   queue,
+		kcpClient:               kcpClient,
+		dynamicClusterClient:    dynamicClusterClient,
+		apiBindingLister:        apiBindingInformer.Lister(),
+		apiBindingIndexer:       apiBindingInformer.Informer().GetIndexer(),
+		apiExportLister:         apiExportInformer.Lister(),
+		apiResourceSchemaLister: apiResourceSchemaInformer.Lister(),
+	}
+
+	if err := apiBindingInformer.Informer().AddIndexers(cache.Indexers{
+		byBoundExport: indexByBoundExport,
+	}); err != nil {
+		return nil, err
+	}
+
+	apiBindingInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.enqueue(obj) },
+		UpdateFunc: func(_, obj interface{}) { c.enqueue(obj) },
+	})
+	apiExportInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.enqueueExport(obj) },
+		UpdateFunc: func(_, obj interface{}) { c.enqueueExport(obj) },
+	})
+	apiResourceSchemaInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) { c.enqueueSchema(obj) },
+	})
+
+	return c, nil
+}
+
+// Controller upgrades the bound resources of APIBindings to the latest APIResourceSchemas of
+// the bound APIExports. Upgrades are published in status.availableUpgrades, and applied
+// according to the upgrade policy of the APIBinding. After an upgrade, the stored objects
+// of the resource are rewritten in the new storage version, and the previous storage
+// versions are dropped from status.boundResources[*].storageVersions.
+type Controller struct {
+	queue workqueue.RateLimitingInterface
+
+	kcpClient               kcpclient.ClusterInterface
+	dynamicClusterClient    dynamic.ClusterInterface
+	apiBindingLister        apislister.APIBindingLister
+	apiBindingIndexer       cache.Indexer
+	apiExportLister         apislister.APIExportLister
+	apiResourceSchemaLister apislister.APIResourceSchemaLister
+}
+
+// boundExportCluster returns the logical cluster and name of the APIExport the binding is bound to.
+func boundExportCluster(binding *apisv1alpha1.APIBinding) (string, string, bool) {
+	if binding.Status.BoundAPIExport == nil {
+		return "", "", false
+	}
+	return apishelper.ExportClusterName(binding.ClusterName, *binding.Status.BoundAPIExport)
+}
+
+// indexByBoundExport indexes APIBindings by the cluster-aware key of their bound APIExport.
+func indexByBoundExport(obj interface{}) ([]string, error) {
+	binding, ok := obj.(*apisv1alpha1.APIBinding)
+	if !ok {
+		return []string{}, fmt.Errorf("obj is supposed to be an APIBinding, but is %T", obj)
+	}
+	clusterName, exportName, ok := boundExportCluster(binding)
+	if !ok {
+		return []string{}, nil
+	}
+	return []string{clusters.ToClusterAwareKey(clusterName, exportName)}, nil
+}
+
+func (c *Controller) enqueue(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	klog.Infof("queueing APIBinding %q", key)
+	c.queue.Add(key)
+}
+
+func (c *Controller) enqueueExport(obj interface{}) {
+	export, ok := obj.(*apisv1alpha1.APIExport)
+	if !ok {
+		runtime.HandleError(fmt.Errorf("obj is supposed to be an APIExport, but is %T", obj))
+		return
+	}
+
+	bindings, err := c.apiBindingIndexer.ByIndex(byBoundExport, clusters.ToClusterAwareKey(export.ClusterName, export.Name))
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	for _, binding := range bindings {
+		c.enqueue(binding)
+	}
+}
+
+func (c *Controller) enqueueSchema(obj interface{}) {
+	s, ok := obj.(*apisv1alpha1.APIResourceSchema)
+	if !ok {
+		runtime.HandleError(fmt.Errorf("obj is supposed to be an APIResourceSchema, but is %T", obj))
+		return
+	}
+
+	exports, err := c.apiExportLister.List(labels.Everything())
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	for _, export := range exports {
+		if export.ClusterName != s.ClusterName {
+			continue
+		}
+		for _, name := range export.Spec.LatestResourceSchemas {
+			if name == s.Name {
+				c.enqueueExport(export)
+				break
+			}
+		}
+	}
+}
+
+func (c *Controller) Start(ctx context.Context, numThreads int) {
+	defer runtime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.Info("Starting APIBinding upgrade controller")
+	defer klog.Info("Shutting down APIBinding upgrade controller")
+
+	for i := 0; i < numThreads; i++ {
+		go wait.Until(func() { c.startWorker(ctx) }, time.Second, ctx.Done())
+	}
+
+	<-ctx.Done()
+}
+
+func (c *Controller) startWorker(ctx context.Context) {
+	for c.processNextWorkItem(ctx) {
+	}
+}
+
+func (c *Controller) processNextWorkItem(ctx context.Context) bool {
+	// Wait until there is a new item in the working queue
+	k, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	key := k.(string)
+
+	klog.Infof("processing key %q", key)
+
+	// No matter what, tell the queue we're done with this key, to unblock
+	// other workers.
+	defer c.queue.Done(key)
+
+	if err := c.process(ctx, key); err != nil {
+		runtime.HandleError(fmt.Errorf("%q controller failed to sync %q, err: %w", controllerName, key, err))
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+func (c *Controller) process(ctx context.Context, key string) error {
+	obj, err := c.apiBindingLister.Get(key)
+	if errors.IsNotFound(err) {
+		return nil // object deleted before we handled it
+	} else if err != nil {
+		return err
+	}
+	if obj.Status.Phase != apisv1alpha1.APIBindingPhaseBound {
+		return nil // only bound APIBindings are upgraded
+	}
+	old := obj
+	obj = obj.DeepCopy()
+
+	reconcileErr := c.reconcile(ctx, obj)
+
+	if equality.Semantic.DeepEqual(old.Status, obj.Status) {
+		return reconcileErr
+	}
+
+	oldData, err := json.Marshal(apisv1alpha1.APIBinding{
+		Status: old.Status,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to Marshal old data for APIBinding %s|%s: %w", obj.ClusterName, obj.Name, err)
+	}
+	newData, err := json.Marshal(apisv1alpha1.APIBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			UID:             old.UID,
+			ResourceVersion: old.ResourceVersion,
+		}, // to ensure they appear in the patch as preconditions
+		Status: obj.Status,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to Marshal new data for APIBinding %s|%s: %w", obj.ClusterName, obj.Name, err)
+	}
+	patchBytes, err := jsonpatch.CreateMergePatch(oldData, newData)
+	if err != nil {
+		return fmt.Errorf("failed to create patch for APIBinding %s|%s: %w", obj.ClusterName, obj.Name, err)
+	}
+	if _, err := c.kcpClient.Cluster(obj.ClusterName).ApisV1alpha1().APIBindings().Patch(ctx, obj.Name, types.MergePatchType, patchBytes, metav1.PatchOptions{}, "status"); err != nil {
+		return err
+	}
+	return reconcileErr
+}
+
+func (c *Controller) reconcile(ctx context.Context, binding *apisv1alpha1.APIBinding) error {
+	exportClusterName, exportName, ok := boundExportCluster(binding)
+	if !ok {
+		return nil
+	}
+	export, err := c.apiExportLister.Get(clusters.ToClusterAwareKey(exportClusterName, exportName))
+	if errors.IsNotFound(err) {
+		return nil // the APIExport event will requeue the APIBinding
+	} else if err != nil {
+		return err
+	}
+
+	latest := make([]*apisv1alpha1.APIResourceSchema, 0, len(export.Spec.LatestResourceSchemas))
+	schemas := map[string]*apisv1alpha1.APIResourceSchema{}
+	for _, name := range export.Spec.LatestResourceSchemas {
+		s, err := c.apiResourceSchemaLister.Get(clusters.ToClusterAwareKey(exportClusterName, name))
+		if errors.IsNotFound(err) {
+			continue // the APIResourceSchema event will requeue the APIBinding
+		} else if err != nil {
+			return err
+		}
+		latest = append(latest, s)
+		schemas[name] = s
+	}
+
+	applyUpgrades(binding, availableUpgrades(binding, latest), schemas)
+
+	return c.migrateStorage(ctx, binding, exportClusterName)
+}
+
+// migrateStorage rewrites the stored objects of the bound resources which have been stored in
+// other versions than the storage version of their bound schema.
+func (c *Controller) migrateStorage(ctx context.Context, binding *apisv1alpha1.APIBinding, exportClusterName string) error {
+	for i := range binding.Status.BoundResources {
+		bound := &binding.Status.BoundResources[i]
+
+		s, err := c.apiResourceSchemaLister.Get(clusters.ToClusterAwareKey(exportClusterName, bound.Schema.Name))
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		version := storageVersion(s)
+		if version == "" || (len(bound.StorageVersions) == 1 && bound.StorageVersions[0] == version) {
+			continue
+		}
+		if len(bound.StorageVersions) == 0 {
+			// nothing has been recorded as persisted yet
+			bound.StorageVersions = []string{version}
+			continue
+		}
+
+		conditions.MarkFalse(binding, apisv1alpha1.StorageMigrated, apisv1alpha1.StorageMigrationPendingReason, conditionsapi.ConditionSeverityInfo,
+			"Migrating %s.%s to version %s.", bound.Resource, bound.Group, version)
+
+		gvr := schema.GroupVersionResource{Group: bound.Group, Version: version, Resource: bound.Resource}
+		if err := migrateStorage(ctx, c.dynamicClusterClient.Cluster(binding.ClusterName), gvr, s); err != nil {
+			conditions.MarkFalse(binding, apisv1alpha1.StorageMigrated, apisv1alpha1.StorageMigrationFailedReason, conditionsapi.ConditionSeverityError,
+				"Migrating %s.%s to version %s failed: %v.", bound.Resource, bound.Group, version, err)
+			return err
+		}
+		bound.StorageVersions = []string{version}
+	}
+
+	conditions.MarkTrue(binding, apisv1alpha1.StorageMigrated)
+	return nil
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apibindingupgrade
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog/v2"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+)
+
+// migrationPageSize is the number of objects listed at once while migrating storage.
+const migrationPageSize = 500
+
+// migrateStorage rewrites all objects of the given resource such that they are persisted in
+// the current storage version of the given schema. Conflicts and missing objects are
+// ignored, as those objects have been rewritten or removed concurrently.
+func migrateStorage(ctx context.Context, client dynamic.Interface, gvr schema.GroupVersionResource, s *apisv1alpha1.APIResourceSchema) error {
+	served := servedVersions(s)
+	convertible := s.Spec.Conversion == nil || s.Spec.Conversion.Strategy != apisv1alpha1.WebhookConverter
+	opts := metav1.ListOptions{Limit: migrationPageSize}
+	for {
+		list, err := client.Resource(gvr).List(ctx, opts)
+		if err != nil {
+			return fmt.Errorf("failed to list %s: %w", gvr, err)
+		}
+		for i := range list.Items {
+			item := &list.Items[i]
+			if convertible {
+				convertManagedFields(item, gvr.GroupVersion(), served)
+			}
+			_, err := client.Resource(gvr).Namespace(item.GetNamespace()).Update(ctx, item, metav1.UpdateOptions{})
+			if errors.IsConflict(err) || errors.IsNotFound(err) {
+				continue
+			} else if err != nil {
+				return fmt.Errorf("failed to migrate %s %s/%s: %w", gvr, item.GetNamespace(), item.GetName(), err)
+			}
+		}
+		klog.V(4).Infof("migrated %d objects of %s", len(list.Items), gvr)
+
+		if list.GetContinue() == "" {
+			return nil
+		}
+		opts.Continue = list.GetContinue()
+	}
+}
+
+// servedVersions returns the versions served by the given schema.
+func servedVersions(s *apisv1alpha1.APIResourceSchema) sets.String {
+	served := sets.NewString()
+	for _, v := range s.Spec.Versions {
+		if v.Served {
+			served.Insert(v.Name)
+		}
+	}
+	return served
+}
+
+// convertManagedFields records the managed fields of the object recorded for versions of
+// its group which are not served anymore for the given version instead, and returns
+// whether it changed any. The field manager drops the managed fields of versions it
+// cannot convert to, losing the ownership of their fields, e.g. for server-side apply.
+// Without conversion webhook, all versions of a schema have the same fields, hence the
+// ownership carries over unchanged.
+//
+// Updates recorded for both versions by the same manager cannot be told apart, in that
+// case the one of the unserved version is left to be dropped.
+func convertManagedFields(obj *unstructured.Unstructured, gv schema.GroupVersion, served sets.String) bool {
+	managedFields := obj.GetManagedFields()
+	changed := false
+	for i := range managedFields {
+		entry := &managedFields[i]
+		entryGV, err := schema.ParseGroupVersion(entry.APIVersion)
+		if err != nil || entryGV.Group != gv.Group || served.Has(entryGV.Version) {
+			continue
+		}
+		converted := *entry
+		converted.APIVersion = gv.String()
+		if converted.Operation == metav1.ManagedFieldsOperationUpdate && hasManagedFieldsEntry(managedFields, converted) {
+			continue
+		}
+		*entry = converted
+		changed = true
+	}
+	if changed {
+		obj.SetManagedFields(managedFields)
+	}
+	return changed
+}
+
+func hasManagedFieldsEntry(managedFields []metav1.ManagedFieldsEntry, entry metav1.ManagedFieldsEntry) bool {
+	for _, existing := range managedFields {
+		if existing.Manager == entry.Manager && existing.Operation == entry.Operation && existing.Subresource == entry.Subresource && existing.APIVersion == entry.APIVersion {
+			return true
+		}
+	}
+	return false
+}
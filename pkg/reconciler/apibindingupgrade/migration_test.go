@@ -0,0 +1,61 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apibindingupgrade
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func TestConvertManagedFields(t *testing.T) {
+	entry := func(manager string, operation metav1.ManagedFieldsOperationType, apiVersion string) metav1.ManagedFieldsEntry {
+		return metav1.ManagedFieldsEntry{Manager: manager, Operation: operation, APIVersion: apiVersion, FieldsType: "FieldsV1", FieldsV1: &metav1.FieldsV1{Raw: []byte(`{"f:spec":{}}`)}}
+	}
+	obj := &unstructured.Unstructured{}
+	obj.SetManagedFields([]metav1.ManagedFieldsEntry{
+		entry("argocd", metav1.ManagedFieldsOperationApply, "example.io/v1alpha1"),
+		entry("controller", metav1.ManagedFieldsOperationUpdate, "example.io/v1alpha1"),
+		entry("controller", metav1.ManagedFieldsOperationUpdate, "example.io/v1"),
+		entry("kubectl", metav1.ManagedFieldsOperationUpdate, "example.io/v1beta1"),
+		entry("other", metav1.ManagedFieldsOperationUpdate, "other.io/v1alpha1"),
+	})
+
+	changed := convertManagedFields(obj, schema.GroupVersion{Group: "example.io", Version: "v1"}, sets.NewString("v1", "v1beta1"))
+	if !changed {
+		t.Fatal("expected the managed fields to be changed")
+	}
+	expected := []metav1.ManagedFieldsEntry{
+		entry("argocd", metav1.ManagedFieldsOperationApply, "example.io/v1"),
+		entry("controller", metav1.ManagedFieldsOperationUpdate, "example.io/v1alpha1"),
+		entry("controller", metav1.ManagedFieldsOperationUpdate, "example.io/v1"),
+		entry("kubectl", metav1.ManagedFieldsOperationUpdate, "example.io/v1beta1"),
+		entry("other", metav1.ManagedFieldsOperationUpdate, "other.io/v1alpha1"),
+	}
+	if diff := cmp.Diff(expected, obj.GetManagedFields()); diff != "" {
+		t.Errorf("unexpected managed fields (-want +got):\n%s", diff)
+	}
+
+	if convertManagedFields(obj, schema.GroupVersion{Group: "example.io", Version: "v1"}, sets.NewString("v1", "v1beta1")) {
+		t.Error("expected the managed fields to be unchanged the second time")
+	}
+}
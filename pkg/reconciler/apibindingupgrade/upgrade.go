@@ -0,0 +1,91 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apibindingupgrade
+
+import (
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+)
+
+// availableUpgrades returns the upgrades offered by the given latest schemas of the bound
+// APIExport, i.e. the schemas of bound resources which differ from the bound schema.
+func availableUpgrades(binding *apisv1alpha1.APIBinding, latest []*apisv1alpha1.APIResourceSchema) []apisv1alpha1.AvailableUpgrade {
+	var upgrades []apisv1alpha1.AvailableUpgrade
+	for _, schema := range latest {
+		for _, bound := range binding.Status.BoundResources {
+			if bound.Group != schema.Spec.Group || bound.Resource != schema.Spec.Names.Plural {
+				continue
+			}
+			if bound.Schema.Name == schema.Name && bound.Schema.UID == string(schema.UID) {
+				continue
+			}
+			upgrades = append(upgrades, apisv1alpha1.AvailableUpgrade{
+				Group:    bound.Group,
+				Resource: bound.Resource,
+				Schema: apisv1alpha1.BoundAPIResourceSchema{
+					Name: schema.Name,
+					UID:  string(schema.UID),
+				},
+			})
+		}
+	}
+	return upgrades
+}
+
+// accepted returns whether the binding accepts an upgrade to the given schema.
+func accepted(binding *apisv1alpha1.APIBinding, schemaName string) bool {
+	if binding.Spec.UpgradePolicy == apisv1alpha1.APIBindingUpgradePolicyAutomatic {
+		return true
+	}
+	return sets.NewString(binding.Spec.AcceptedUpgrades...).Has(schemaName)
+}
+
+// applyUpgrades binds the accepted upgrades and records them no longer as available. The
+// storage versions of the new schemas are added to the storage versions of the bound
+// resources, to be migrated to by the storage migration.
+func applyUpgrades(binding *apisv1alpha1.APIBinding, upgrades []apisv1alpha1.AvailableUpgrade, schemas map[string]*apisv1alpha1.APIResourceSchema) {
+	var remaining []apisv1alpha1.AvailableUpgrade
+	for _, upgrade := range upgrades {
+		schema, found := schemas[upgrade.Schema.Name]
+		if !found || !accepted(binding, upgrade.Schema.Name) {
+			remaining = append(remaining, upgrade)
+			continue
+		}
+		for i := range binding.Status.BoundResources {
+			bound := &binding.Status.BoundResources[i]
+			if bound.Group != upgrade.Group || bound.Resource != upgrade.Resource {
+				continue
+			}
+			bound.Schema = upgrade.Schema
+			if v := storageVersion(schema); v != "" && !sets.NewString(bound.StorageVersions...).Has(v) {
+				bound.StorageVersions = append(bound.StorageVersions, v)
+			}
+		}
+	}
+	binding.Status.AvailableUpgrades = remaining
+}
+
+// storageVersion returns the storage version of the given schema.
+func storageVersion(schema *apisv1alpha1.APIResourceSchema) string {
+	for _, v := range schema.Spec.Versions {
+		if v.Storage {
+			return v.Name
+		}
+	}
+	return ""
+}
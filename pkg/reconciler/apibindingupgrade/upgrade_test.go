@@ -0,0 +1,128 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apibindingupgrade
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+)
+
+func newSchema(name, uid, storageVersion string) *apisv1alpha1.APIResourceSchema {
+	return &apisv1alpha1.APIResourceSchema{
+		ObjectMeta: metav1.ObjectMeta{Name: name, UID: types.UID(uid)},
+		Spec: apisv1alpha1.APIResourceSchemaSpec{
+			Group: "example.io",
+			Names: apiextensionsv1.CustomResourceDefinitionNames{Plural: "widgets"},
+			Versions: []apisv1alpha1.APIResourceVersion{
+				{Name: storageVersion, Served: true, Storage: true},
+			},
+		},
+	}
+}
+
+func newBinding(policy apisv1alpha1.APIBindingUpgradePolicyType, accepted ...string) *apisv1alpha1.APIBinding {
+	return &apisv1alpha1.APIBinding{
+		Spec: apisv1alpha1.APIBindingSpec{
+			UpgradePolicy:    policy,
+			AcceptedUpgrades: accepted,
+		},
+		Status: apisv1alpha1.APIBindingStatus{
+			Phase: apisv1alpha1.APIBindingPhaseBound,
+			BoundResources: []apisv1alpha1.BoundAPIResource{
+				{
+					Group:           "example.io",
+					Resource:        "widgets",
+					Schema:          apisv1alpha1.BoundAPIResourceSchema{Name: "v1.widgets.example.io", UID: "uid-1"},
+					StorageVersions: []string{"v1"},
+				},
+			},
+		},
+	}
+}
+
+func TestAvailableUpgrades(t *testing.T) {
+	binding := newBinding(apisv1alpha1.APIBindingUpgradePolicyManual)
+
+	if upgrades := availableUpgrades(binding, []*apisv1alpha1.APIResourceSchema{newSchema("v1.widgets.example.io", "uid-1", "v1")}); len(upgrades) != 0 {
+		t.Errorf("expected no upgrades for the bound schema, got %v", upgrades)
+	}
+
+	upgrades := availableUpgrades(binding, []*apisv1alpha1.APIResourceSchema{newSchema("v2.widgets.example.io", "uid-2", "v2")})
+	expected := []apisv1alpha1.AvailableUpgrade{{
+		Group:    "example.io",
+		Resource: "widgets",
+		Schema:   apisv1alpha1.BoundAPIResourceSchema{Name: "v2.widgets.example.io", UID: "uid-2"},
+	}}
+	if diff := cmp.Diff(expected, upgrades); diff != "" {
+		t.Errorf("unexpected upgrades (-want +got):\n%s", diff)
+	}
+}
+
+func TestApplyUpgrades(t *testing.T) {
+	v2 := newSchema("v2.widgets.example.io", "uid-2", "v2")
+	schemas := map[string]*apisv1alpha1.APIResourceSchema{v2.Name: v2}
+
+	for _, tt := range []struct {
+		name            string
+		binding         *apisv1alpha1.APIBinding
+		wantSchema      string
+		wantStorage     []string
+		wantUpgradeLeft bool
+	}{
+		{
+			name:            "manual without acceptance",
+			binding:         newBinding(apisv1alpha1.APIBindingUpgradePolicyManual),
+			wantSchema:      "v1.widgets.example.io",
+			wantStorage:     []string{"v1"},
+			wantUpgradeLeft: true,
+		},
+		{
+			name:        "manual with acceptance",
+			binding:     newBinding(apisv1alpha1.APIBindingUpgradePolicyManual, "v2.widgets.example.io"),
+			wantSchema:  "v2.widgets.example.io",
+			wantStorage: []string{"v1", "v2"},
+		},
+		{
+			name:        "automatic",
+			binding:     newBinding(apisv1alpha1.APIBindingUpgradePolicyAutomatic),
+			wantSchema:  "v2.widgets.example.io",
+			wantStorage: []string{"v1", "v2"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			applyUpgrades(tt.binding, availableUpgrades(tt.binding, []*apisv1alpha1.APIResourceSchema{v2}), schemas)
+
+			bound := tt.binding.Status.BoundResources[0]
+			if bound.Schema.Name != tt.wantSchema {
+				t.Errorf("expected bound schema %q, got %q", tt.wantSchema, bound.Schema.Name)
+			}
+			if diff := cmp.Diff(tt.wantStorage, bound.StorageVersions); diff != "" {
+				t.Errorf("unexpected storage versions (-want +got):\n%s", diff)
+			}
+			if left := len(tt.binding.Status.AvailableUpgrades) > 0; left != tt.wantUpgradeLeft {
+				t.Errorf("expected available upgrades left to be %v, got %v", tt.wantUpgradeLeft, tt.binding.Status.AvailableUpgrades)
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiexport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clusters"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+	kcpclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
+	apisinformer "github.com/kcp-dev/kcp/pkg/client/informers/externalversions/apis/v1alpha1"
+	apislister "github.com/kcp-dev/kcp/pkg/client/listers/apis/v1alpha1"
+)
+
+const (
+	controllerName = "apiexport-identity"
+
+	byIdentitySecret = "byIdentitySecret"
+)
+
+func NewController(
+	kcpClient kcpclient.ClusterInterface,
+	kubeClusterClient *kubernetes.Cluster,
+	apiExportInformer apisinformer.APIExportInformer,
+	secretInformer coreinformers.SecretInformer,
+) (*Controller, error) {
+	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), controllerName)
+
+	c := &Controller{
+		queue:             queue,
+		kcpClient:         kcpClient,
+		kubeClusterClient: kubeClusterClient,
+		apiExportLister:   apiExportInformer.Lister(),
+		apiExportIndexer:  apiExportInformer.Informer().GetIndexer(),
+		secretLister:      secretInformer.Lister(),
+	}
+
+	if err := apiExportInformer.Informer().AddIndexers(cache.Indexers{
+		byIdentitySecret: indexByIdentitySecret,
+	}); err != nil {
+		return nil, err
+	}
+
+	apiExportInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.enqueue(obj) },
+		UpdateFunc: func(_, obj interface{}) { c.enqueue(obj) },
+	})
+	secretInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.enqueueSecret(obj) },
+		UpdateFunc: func(_, obj interface{}) { c.enqueueSecret(obj) },
+		DeleteFunc: func(obj interface{}) { c.enqueueSecret(obj) },
+	})
+
+	return c, nil
+}
+
+// Controller maintains the identity of APIExports: it generates an identity secret for the
+// APIExports not referencing one, and publishes the hash of the identity in the status of
+// the APIExports. Rotating the identity in the secret updates the published hash.
+type Controller struct {
+	queue workqueue.RateLimitingInterface
+
+	kcpClient         kcpclient.ClusterInterface
+	kubeClusterClient *kubernetes.Cluster
+	apiExportLister   apislister.APIExportLister
+	apiExportIndexer  cache.Indexer
+	secretLister      corelisters.SecretLister
+}
+
+// indexByIdentitySecret indexes APIExports by the cluster-aware key of their identity secret.
+func indexByIdentitySecret(obj interface{}) ([]string, error) {
+	export, ok := obj.(*apisv1alpha1.APIExport)
+	if !ok {
+		return []string{}, fmt.Errorf("obj is supposed to be an APIExport, but is %T", obj)
+	}
+	ref, _ := IdentitySecretRef(export)
+	return []string{secretKey(export.ClusterName, ref.Namespace, ref.Name)}, nil
+}
+
+func secretKey(clusterName, namespace, name string) string {
+	return namespace + "/" + clusters.ToClusterAwareKey(clusterName, name)
+}
+
+func (c *Controller) enqueue(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	klog.Infof("queueing APIExport %q", key)
+	c.queue.Add(key)
+}
+
+func (c *Controller) enqueueSecret(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		runtime.HandleError(fmt.Errorf("obj is supposed to be a Secret, but is %T", obj))
+		return
+	}
+
+	exports, err := c.apiExportIndexer.ByIndex(byIdentitySecret, secretKey(secret.ClusterName, secret.Namespace, secret.Name))
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	for _, export := range exports {
+		c.enqueue(export)
+	}
+}
+
+func (c *Controller) Start(ctx context.Context, numThreads int) {
+	defer runtime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.Info("Starting APIExport identity controller")
+	defer klog.Info("Shutting down APIExport identity controller")
+
+	for i := 0; i < numThreads; i++ {
+		go wait.Until(func() { c.startWorker(ctx) }, time.Second, ctx.Done())
+	}
+
+	<-ctx.Done()
+}
+
+func (c *Controller) startWorker(ctx context.Context) {
+	for c.processNextWorkItem(ctx) {
+	}
+}
+
+func (c *Controller) processNextWorkItem(ctx context.Context) bool {
+	// Wait until there is a new item in the working queue
+	k, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	key := k.(string)
+
+	klog.Infof("processing key %q", key)
+
+	// No matter what, tell the queue we're done with this key, to unblock
+	// other workers.
+	defer c.queue.Done(key)
+
+	if err := c.process(ctx, key); err != nil {
+		runtime.HandleError(fmt.Errorf("%q controller failed to sync %q, err: %w", controllerName, key, err))
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+func (c *Controller) process(ctx context.Context, key string) error {
+	obj, err := c.apiExportLister.Get(key)
+	if errors.IsNotFound(err) {
+		return nil // object deleted before we handled it
+	} else if err != nil {
+		return err
+	}
+	old := obj
+	obj = obj.DeepCopy()
+
+	if err := c.reconcile(ctx, obj); err != nil {
+		return err
+	}
+
+	if old.Status.IdentityHash == obj.Status.IdentityHash {
+		return nil
+	}
+
+	oldData, err := json.Marshal(apisv1alpha1.APIExport{
+		Status: old.Status,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to Marshal old data for APIExport %s|%s: %w", obj.ClusterName, obj.Name, err)
+	}
+	newData, err := json.Marshal(apisv1alpha1.APIExport{
+		ObjectMeta: metav1.ObjectMeta{
+			UID:             old.UID,
+			ResourceVersion: old.ResourceVersion,
+		}, // to ensure they appear in the patch as preconditions
+		Status: obj.Status,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to Marshal new data for APIExport %s|%s: %w", obj.ClusterName, obj.Name, err)
+	}
+	patchBytes, err := jsonpatch.CreateMergePatch(oldData, newData)
+	if err != nil {
+		return fmt.Errorf("failed to create patch for APIExport %s|%s: %w", obj.ClusterName, obj.Name, err)
+	}
+	_, err = c.kcpClient.Cluster(obj.ClusterName).ApisV1alpha1().APIExports().Patch(ctx, obj.Name, types.MergePatchType, patchBytes, metav1.PatchOptions{}, "status")
+	return err
+}
+
+func (c *Controller) reconcile(ctx context.Context, export *apisv1alpha1.APIExport) error {
+	ref, generated := IdentitySecretRef(export)
+
+	secret, err := c.secretLister.Secrets(ref.Namespace).Get(clusters.ToClusterAwareKey(export.ClusterName, ref.Name))
+	if errors.IsNotFound(err) {
+		if !generated {
+			klog.Infof("identity secret %s/%s of APIExport %s|%s does not exist", ref.Namespace, ref.Name, export.ClusterName, export.Name)
+			return nil // the secret event will requeue the APIExport
+		}
+		return c.createIdentitySecret(ctx, export.ClusterName, ref)
+	} else if err != nil {
+		return err
+	}
+
+	hash, err := IdentityHash(secret)
+	if err != nil {
+		klog.Errorf("invalid identity of APIExport %s|%s: %v", export.ClusterName, export.Name, err)
+		return nil // the secret event will requeue the APIExport
+	}
+	export.Status.IdentityHash = hash
+	return nil
+}
+
+// createIdentitySecret creates the generated identity secret, in a namespace created on demand.
+func (c *Controller) createIdentitySecret(ctx context.Context, clusterName string, ref corev1.SecretReference) error {
+	kubeClient := c.kubeClusterClient.Cluster(clusterName)
+
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ref.Namespace}}
+	if _, err := kubeClient.CoreV1().Namespaces().Create(ctx, ns, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+
+	identity, err := GenerateIdentity()
+	if err != nil {
+		return err
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: ref.Namespace,
+			Name:      ref.Name,
+		},
+		StringData: map[string]string{
+			IdentitySecretKey: identity,
+		},
+	}
+	if _, err := kubeClient.CoreV1().Secrets(ref.Namespace).Create(ctx, secret, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiexport
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+)
+
+const (
+	// IdentitySecretKey is the key of the API identity in the identity secret of an APIExport.
+	IdentitySecretKey = "key"
+
+	// DefaultIdentitySecretNamespace is the namespace of the identity secrets generated for
+	// APIExports not referencing one.
+	DefaultIdentitySecretNamespace = "kcp-system"
+)
+
+// IdentitySecretRef returns the reference of the identity secret of the APIExport, and whether
+// the secret is generated by kcp rather than provided by the owner of the APIExport.
+func IdentitySecretRef(export *apisv1alpha1.APIExport) (ref corev1.SecretReference, generated bool) {
+	if export.Spec.Identity != nil && export.Spec.Identity.SecretRef != nil {
+		return *export.Spec.Identity.SecretRef, false
+	}
+	return corev1.SecretReference{Namespace: DefaultIdentitySecretNamespace, Name: export.Name}, true
+}
+
+// GenerateIdentity returns a new random API identity.
+func GenerateIdentity() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// IdentityHash returns the hex encoded sha256 of the API identity in the given secret.
+func IdentityHash(secret *corev1.Secret) (string, error) {
+	key := secret.Data[IdentitySecretKey]
+	if len(key) == 0 {
+		return "", fmt.Errorf("secret %s/%s has no %q key", secret.Namespace, secret.Name, IdentitySecretKey)
+	}
+	hash := sha256.Sum256(key)
+	return hex.EncodeToString(hash[:]), nil
+}
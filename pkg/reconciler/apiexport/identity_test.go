@@ -0,0 +1,77 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiexport
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+)
+
+func TestIdentityHash(t *testing.T) {
+	secret := &corev1.Secret{Data: map[string][]byte{IdentitySecretKey: []byte("abc")}}
+	hash, err := IdentityHash(secret)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// sha256 of "abc"
+	if want := "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"; hash != want {
+		t.Errorf("IdentityHash() = %q, want %q", hash, want)
+	}
+
+	secret.Data[IdentitySecretKey] = []byte("rotated")
+	rotated, err := IdentityHash(secret)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rotated == hash {
+		t.Errorf("expected a new hash after rotating the identity")
+	}
+
+	if _, err := IdentityHash(&corev1.Secret{}); err == nil {
+		t.Errorf("expected an error for a secret without identity")
+	}
+}
+
+func TestGenerateIdentity(t *testing.T) {
+	a, err := GenerateIdentity()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, err := GenerateIdentity()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(a) != 64 || a == b {
+		t.Errorf("expected two distinct 32 bytes identities, got %q and %q", a, b)
+	}
+}
+
+func TestIdentitySecretRef(t *testing.T) {
+	export := &apisv1alpha1.APIExport{ObjectMeta: metav1.ObjectMeta{Name: "widgets"}}
+	if ref, generated := IdentitySecretRef(export); !generated || ref.Namespace != DefaultIdentitySecretNamespace || ref.Name != "widgets" {
+		t.Errorf("unexpected default identity secret %v (generated=%v)", ref, generated)
+	}
+
+	export.Spec.Identity = &apisv1alpha1.Identity{SecretRef: &corev1.SecretReference{Namespace: "provider", Name: "identity"}}
+	if ref, generated := IdentitySecretRef(export); generated || ref.Namespace != "provider" || ref.Name != "identity" {
+		t.Errorf("unexpected identity secret %v (generated=%v)", ref, generated)
+	}
+}
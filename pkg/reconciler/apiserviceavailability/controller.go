@@ -0,0 +1,231 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiserviceavailability
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+	apiregistrationv1 "k8s.io/kube-aggregator/pkg/apis/apiregistration/v1"
+	apiregistrationv1helper "k8s.io/kube-aggregator/pkg/apis/apiregistration/v1/helper"
+
+	"github.com/kcp-dev/kcp/pkg/aggregator"
+	reconcilermetrics "github.com/kcp-dev/kcp/pkg/reconciler/metrics"
+)
+
+const (
+	controllerName = "apiservice-availability"
+
+	// checkInterval is the interval at which the extension apiservers of APIServices are
+	// checked, like in kube-aggregator.
+	checkInterval = 30 * time.Second
+
+	// checkTimeout is the timeout of the discovery request of a check.
+	checkTimeout = 5 * time.Second
+)
+
+// NewController returns a controller checking the availability of the extension apiservers
+// of the APIServices of workspaces, and publishing it in their Available condition.
+func NewController(
+	dynamicClusterClient dynamic.ClusterInterface,
+	apiServiceInformer informers.GenericInformer,
+	transports *aggregator.Transports,
+) (*Controller, error) {
+	queue := reconcilermetrics.InstrumentQueue(controllerName, workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), controllerName))
+
+	c := &Controller{
+		queue:                queue,
+		dynamicClusterClient: dynamicClusterClient,
+		apiServiceIndexer:    apiServiceInformer.Informer().GetIndexer(),
+		transports:           transports,
+	}
+
+	apiServiceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.enqueue(obj) },
+		UpdateFunc: func(_, obj interface{}) { c.enqueue(obj) },
+		DeleteFunc: func(obj interface{}) { c.enqueue(obj) },
+	})
+
+	return c, nil
+}
+
+// Controller checks that the extension apiservers of APIServices serve the group version
+// of the APIService, by requesting its discovery through the Service of the APIService,
+// resolved in the logical cluster of the APIService. APIServices served locally are always
+// available.
+type Controller struct {
+	queue workqueue.RateLimitingInterface
+
+	dynamicClusterClient dynamic.ClusterInterface
+	apiServiceIndexer    cache.Indexer
+	transports           *aggregator.Transports
+}
+
+func (c *Controller) enqueue(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	klog.V(4).Infof("queueing APIService %q", key)
+	c.queue.Add(key)
+}
+
+func (c *Controller) Start(ctx context.Context, numThreads int) {
+	defer runtime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.Info("Starting APIService availability controller")
+	defer klog.Info("Shutting down APIService availability controller")
+
+	for i := 0; i < numThreads; i++ {
+		go wait.Until(func() { c.startWorker(ctx) }, time.Second, ctx.Done())
+	}
+
+	<-ctx.Done()
+}
+
+func (c *Controller) startWorker(ctx context.Context) {
+	for c.processNextWorkItem(ctx) {
+	}
+}
+
+func (c *Controller) processNextWorkItem(ctx context.Context) bool {
+	// Wait until there is a new item in the working queue
+	k, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	key := k.(string)
+
+	klog.V(4).Infof("processing key %q", key)
+
+	// No matter what, tell the queue we're done with this key, to unblock
+	// other workers.
+	defer c.queue.Done(key)
+
+	if err := c.process(ctx, key); err != nil {
+		runtime.HandleError(fmt.Errorf("%q controller failed to sync %q, err: %w", controllerName, key, err))
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+func (c *Controller) process(ctx context.Context, key string) error {
+	obj, exists, err := c.apiServiceIndexer.GetByKey(key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		_, clusterAwareName, err := cache.SplitMetaNamespaceKey(key)
+		if err != nil {
+			klog.Errorf("invalid key: %q: %v", key, err)
+			return nil
+		}
+		c.transports.Forget(clusterAwareName)
+		return nil
+	}
+	apiService, err := aggregator.FromUnstructured(obj)
+	if err != nil {
+		klog.Errorf("failed to check availability: %v", err)
+		return nil
+	}
+
+	updated := apiService.DeepCopy()
+	apiregistrationv1helper.SetAPIServiceCondition(updated, c.check(ctx, apiService))
+	if !equality.Semantic.DeepEqual(apiService.Status, updated.Status) {
+		u, err := aggregator.ToUnstructured(updated)
+		if err != nil {
+			return err
+		}
+		klog.V(2).Infof("updating availability of APIService %s|%s", apiService.ClusterName, apiService.Name)
+		if _, err := c.dynamicClusterClient.Cluster(apiService.ClusterName).Resource(aggregator.APIServicesGVR).UpdateStatus(ctx, u, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+	}
+
+	// APIServices served remotely are checked again, as their extension apiserver can fail
+	// at any time.
+	if apiService.Spec.Service != nil {
+		c.queue.AddAfter(key, checkInterval)
+	}
+	return nil
+}
+
+// check returns the Available condition of the given APIService.
+func (c *Controller) check(ctx context.Context, apiService *apiregistrationv1.APIService) apiregistrationv1.APIServiceCondition {
+	if apiService.Spec.Service == nil {
+		return apiregistrationv1helper.NewLocalAvailableAPIServiceCondition()
+	}
+
+	condition := apiregistrationv1.APIServiceCondition{
+		Type:               apiregistrationv1.Available,
+		Status:             apiregistrationv1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+	}
+	transport, err := c.transports.TransportFor(apiService)
+	if err != nil {
+		condition.Reason = "ServiceNotResolved"
+		condition.Message = err.Error()
+		return condition
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	service := apiService.Spec.Service
+	discoveryURL := fmt.Sprintf("https://%s.%s.svc/apis/%s/%s", service.Name, service.Namespace, apiService.Spec.Group, apiService.Spec.Version)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discoveryURL, nil)
+	if err != nil {
+		condition.Reason = "FailedDiscoveryCheck"
+		condition.Message = err.Error()
+		return condition
+	}
+	// the discovery of the group version is requested as kcp itself, like kube-aggregator.
+	req.Header.Set("X-Remote-User", "system:kube-aggregator")
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		condition.Reason = "FailedDiscoveryCheck"
+		condition.Message = fmt.Sprintf("failing or missing response from %s: %v", discoveryURL, err)
+		return condition
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body) // nolint:errcheck
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		condition.Reason = "FailedDiscoveryCheck"
+		condition.Message = fmt.Sprintf("failing or missing response from %s: bad status from %s: %d", discoveryURL, discoveryURL, resp.StatusCode)
+		return condition
+	}
+
+	condition.Status = apiregistrationv1.ConditionTrue
+	condition.Reason = "Passed"
+	condition.Message = "all checks passed"
+	return condition
+}
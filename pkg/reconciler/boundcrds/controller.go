@@ -0,0 +1,327 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package boundcrds
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	apiextensionsinformers "k8s.io/apiextensions-apiserver/pkg/client/informers/externalversions/apiextensions/v1"
+	apiextensionslisters "k8s.io/apiextensions-apiserver/pkg/client/listers/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clusters"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+	apishelper "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1/helper"
+	apisinformer "github.com/kcp-dev/kcp/pkg/client/informers/externalversions/apis/v1alpha1"
+	apislister "github.com/kcp-dev/kcp/pkg/client/listers/apis/v1alpha1"
+)
+
+const (
+	controllerName = "bound-crds"
+
+	byBoundSchema = "byBoundSchema"
+	bySchemaHash  = "bySchemaHash"
+)
+
+func NewController(
+	crdClusterClient *apiextensionsclient.Cluster,
+	resolver *Resolver,
+	apiBindingInformer apisinformer.APIBindingInformer,
+	apiResourceSchemaInformer apisinformer.APIResourceSchemaInformer,
+	crdInformer apiextensionsinformers.CustomResourceDefinitionInformer,
+) (*Controller, error) {
+	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), controllerName)
+
+	c := &Controller{
+		queue:                    queue,
+		crdClusterClient:         crdClusterClient,
+		resolver:                 resolver,
+		apiBindingIndexer:        apiBindingInformer.Informer().GetIndexer(),
+		apiResourceSchemaLister:  apiResourceSchemaInformer.Lister(),
+		apiResourceSchemaIndexer: apiResourceSchemaInformer.Informer().GetIndexer(),
+		crdLister:                crdInformer.Lister(),
+	}
+
+	if _, found := apiBindingInformer.Informer().GetIndexer().GetIndexers()[byBoundSchema]; !found {
+		if err := apiBindingInformer.Informer().AddIndexers(cache.Indexers{
+			byBoundSchema: indexByBoundSchema,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if err := apiResourceSchemaInformer.Informer().AddIndexers(cache.Indexers{
+		bySchemaHash: indexBySchemaHash,
+	}); err != nil {
+		return nil, err
+	}
+
+	apiBindingInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.enqueueBinding(obj) },
+		UpdateFunc: func(old, obj interface{}) { c.enqueueBinding(old); c.enqueueBinding(obj) },
+		DeleteFunc: func(obj interface{}) { c.enqueueBinding(obj) },
+	})
+	apiResourceSchemaInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.enqueueSchema(obj) },
+		DeleteFunc: func(obj interface{}) { c.enqueueSchema(obj) },
+	})
+	crdInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.enqueueCRD(obj) },
+		DeleteFunc: func(obj interface{}) { c.enqueueCRD(obj) },
+	})
+	resolver.AddRequestHandler(func(hash string) {
+		klog.Infof("queueing requested schema hash %q", hash)
+		c.queue.Add(hash)
+	})
+
+	return c, nil
+}
+
+// Controller maintains one shadow CRD per unique APIResourceSchema bound by APIBindings,
+// in a system logical cluster named after the hash of the schema. All workspaces bound
+// to equal schemas are served through the same shadow CRD, instead of a CRD copy per
+// workspace. Shadow CRDs are only created once a request to a workspace bound to their
+// schema resolves it, such that the storage, OpenAPI and discovery of schemas nobody uses
+// are never built, and are deleted when no APIBinding is bound to their schema anymore.
+type Controller struct {
+	queue workqueue.RateLimitingInterface
+
+	crdClusterClient         *apiextensionsclient.Cluster
+	resolver                 *Resolver
+	apiBindingIndexer        cache.Indexer
+	apiResourceSchemaLister  apislister.APIResourceSchemaLister
+	apiResourceSchemaIndexer cache.Indexer
+	crdLister                apiextensionslisters.CustomResourceDefinitionLister
+}
+
+// boundSchemaKeys returns the cluster-aware keys of the APIResourceSchemas bound by the binding.
+func boundSchemaKeys(binding *apisv1alpha1.APIBinding) []string {
+	if binding.Status.BoundAPIExport == nil {
+		return nil
+	}
+	exportClusterName, _, ok := apishelper.ExportClusterName(binding.ClusterName, *binding.Status.BoundAPIExport)
+	if !ok {
+		return nil
+	}
+	keys := make([]string, 0, len(binding.Status.BoundResources))
+	for _, bound := range binding.Status.BoundResources {
+		keys = append(keys, clusters.ToClusterAwareKey(exportClusterName, bound.Schema.Name))
+	}
+	return keys
+}
+
+// indexByBoundSchema indexes APIBindings by the cluster-aware keys of their bound APIResourceSchemas.
+func indexByBoundSchema(obj interface{}) ([]string, error) {
+	binding, ok := obj.(*apisv1alpha1.APIBinding)
+	if !ok {
+		return []string{}, fmt.Errorf("obj is supposed to be an APIBinding, but is %T", obj)
+	}
+	return boundSchemaKeys(binding), nil
+}
+
+// indexBySchemaHash indexes APIResourceSchemas by their hash.
+func indexBySchemaHash(obj interface{}) ([]string, error) {
+	s, ok := obj.(*apisv1alpha1.APIResourceSchema)
+	if !ok {
+		return []string{}, fmt.Errorf("obj is supposed to be an APIResourceSchema, but is %T", obj)
+	}
+	hash, err := SchemaHash(s)
+	if err != nil {
+		return []string{}, err
+	}
+	return []string{hash}, nil
+}
+
+func (c *Controller) enqueueBinding(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	binding, ok := obj.(*apisv1alpha1.APIBinding)
+	if !ok {
+		runtime.HandleError(fmt.Errorf("obj is supposed to be an APIBinding, but is %T", obj))
+		return
+	}
+	for _, key := range boundSchemaKeys(binding) {
+		s, err := c.apiResourceSchemaLister.Get(key)
+		if errors.IsNotFound(err) {
+			continue // the APIResourceSchema event will queue it
+		} else if err != nil {
+			runtime.HandleError(err)
+			continue
+		}
+		c.enqueueSchema(s)
+	}
+}
+
+func (c *Controller) enqueueSchema(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	s, ok := obj.(*apisv1alpha1.APIResourceSchema)
+	if !ok {
+		runtime.HandleError(fmt.Errorf("obj is supposed to be an APIResourceSchema, but is %T", obj))
+		return
+	}
+	hash, err := SchemaHash(s)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	klog.Infof("queueing schema hash %q of APIResourceSchema %s|%s", hash, s.ClusterName, s.Name)
+	c.queue.Add(hash)
+}
+
+func (c *Controller) enqueueCRD(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	crd, ok := obj.(*apiextensionsv1.CustomResourceDefinition)
+	if !ok {
+		runtime.HandleError(fmt.Errorf("obj is supposed to be a CustomResourceDefinition, but is %T", obj))
+		return
+	}
+	if hash, ok := HashFromShadowClusterName(crd.ClusterName); ok {
+		klog.Infof("queueing schema hash %q of shadow CRD %s|%s", hash, crd.ClusterName, crd.Name)
+		c.queue.Add(hash)
+	}
+}
+
+func (c *Controller) Start(ctx context.Context, numThreads int) {
+	defer runtime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.Info("Starting bound CRDs controller")
+	defer klog.Info("Shutting down bound CRDs controller")
+
+	for i := 0; i < numThreads; i++ {
+		go wait.Until(func() { c.startWorker(ctx) }, time.Second, ctx.Done())
+	}
+
+	<-ctx.Done()
+}
+
+func (c *Controller) startWorker(ctx context.Context) {
+	for c.processNextWorkItem(ctx) {
+	}
+}
+
+func (c *Controller) processNextWorkItem(ctx context.Context) bool {
+	// Wait until there is a new item in the working queue
+	k, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	key := k.(string)
+
+	klog.Infof("processing key %q", key)
+
+	// No matter what, tell the queue we're done with this key, to unblock
+	// other workers.
+	defer c.queue.Done(key)
+
+	if err := c.process(ctx, key); err != nil {
+		runtime.HandleError(fmt.Errorf("%q controller failed to sync %q, err: %w", controllerName, key, err))
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+func (c *Controller) process(ctx context.Context, hash string) error {
+	bound, err := c.boundSchema(hash)
+	if err != nil {
+		return err
+	}
+	shadowClusterName := ShadowClusterName(hash)
+	client := c.crdClusterClient.Cluster(shadowClusterName).ApiextensionsV1().CustomResourceDefinitions()
+
+	if bound == nil {
+		crds, err := c.crdLister.List(labels.Everything())
+		if err != nil {
+			return err
+		}
+		for _, crd := range crds {
+			if crd.ClusterName != shadowClusterName {
+				continue
+			}
+			klog.Infof("Deleting shadow CRD %s|%s which is not bound anymore", crd.ClusterName, crd.Name)
+			if err := client.Delete(ctx, crd.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+		}
+		return nil
+	}
+
+	crd, err := ShadowCRD(bound)
+	if err != nil {
+		return err
+	}
+	if _, err := c.crdLister.Get(clusters.ToClusterAwareKey(shadowClusterName, crd.Name)); err == nil {
+		return nil // shadow CRDs are immutable, their schema is part of the name of their logical cluster
+	} else if !errors.IsNotFound(err) {
+		return err
+	}
+	if _, requested := c.resolver.Requested(hash); !requested {
+		return nil // created on the first request, queued by the resolver
+	}
+
+	klog.Infof("Creating shadow CRD %s|%s for APIResourceSchema %s|%s", shadowClusterName, crd.Name, bound.ClusterName, bound.Name)
+	if _, err := client.Create(ctx, crd, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// boundSchema returns an APIResourceSchema of the given hash that is bound by at least one
+// APIBinding, or nil if there is none.
+func (c *Controller) boundSchema(hash string) (*apisv1alpha1.APIResourceSchema, error) {
+	objs, err := c.apiResourceSchemaIndexer.ByIndex(bySchemaHash, hash)
+	if err != nil {
+		return nil, err
+	}
+	schemas := make([]*apisv1alpha1.APIResourceSchema, 0, len(objs))
+	for _, obj := range objs {
+		schemas = append(schemas, obj.(*apisv1alpha1.APIResourceSchema))
+	}
+	// be deterministic about the schema the shadow CRD is created from
+	sort.Slice(schemas, func(i, j int) bool {
+		return clusters.ToClusterAwareKey(schemas[i].ClusterName, schemas[i].Name) < clusters.ToClusterAwareKey(schemas[j].ClusterName, schemas[j].Name)
+	})
+
+	for _, s := range schemas {
+		bindings, err := c.apiBindingIndexer.ByIndex(byBoundSchema, clusters.ToClusterAwareKey(s.ClusterName, s.Name))
+		if err != nil {
+			return nil, err
+		}
+		if len(bindings) > 0 {
+			return s, nil
+		}
+	}
+	return nil, nil
+}
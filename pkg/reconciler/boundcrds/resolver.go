@@ -0,0 +1,359 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package boundcrds
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	utilcache "k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clusters"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+	apishelper "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1/helper"
+	apisinformer "github.com/kcp-dev/kcp/pkg/client/informers/externalversions/apis/v1alpha1"
+	apislister "github.com/kcp-dev/kcp/pkg/client/listers/apis/v1alpha1"
+)
+
+const (
+	byLogicalCluster = "bound-crds-resolver-by-logical-cluster"
+	byCRDName        = "bound-crds-resolver-by-crd-name"
+)
+
+// Resolver resolves the resources bound in a workspace to their shadow CRDs.
+//
+// The bound resources of a workspace are resolved on the first request to it, and
+// cached until an APIBinding of the workspace or one of its bound APIResourceSchemas
+// changes. Workspaces without requests for the idle timeout, or least recently used
+// beyond the maximum number of cached workspaces, are evicted, such that the cost of
+// serving bound resources scales with the active workspaces rather than with all the
+// APIBindings of the shard.
+//
+// The shadow CRD of a schema, with its storage, OpenAPI and discovery, is only created once
+// its bound resource is requested, in a workspace or across workspaces.
+type Resolver struct {
+	apiBindingIndexer        cache.Indexer
+	apiResourceSchemaLister  apislister.APIResourceSchemaLister
+	apiResourceSchemaIndexer cache.Indexer
+	idleTimeout              time.Duration
+
+	lock sync.Mutex
+	// resolving are the resolutions in flight, such that a resolution racing with an
+	// invalidation of its workspace is not cached.
+	resolving map[*resolution]struct{}
+	resolved  *utilcache.LRUExpireCache
+	// requested are the schema hashes whose bound resources were requested, by the time
+	// they were first requested.
+	requested       map[string]time.Time
+	requestHandlers []func(hash string)
+}
+
+// resolvedWorkspace are the resolved bound resources of a workspace.
+type resolvedWorkspace struct {
+	keys map[string]ShadowCRDKey
+	// schemas are the cluster-aware keys of the APIResourceSchemas the keys were
+	// resolved from, including the ones not found.
+	schemas sets.String
+}
+
+// resolution is a resolution of the bound resources of a workspace in flight.
+type resolution struct {
+	clusterName string
+	// stale is set when an APIBinding of the workspace changes during the resolution.
+	stale bool
+	// staleSchemas are the cluster-aware keys of the APIResourceSchemas changed during
+	// the resolution.
+	staleSchemas sets.String
+}
+
+// NewResolver returns a Resolver caching the resolved bound resources of at most
+// maxWorkspaces workspaces, each for idleTimeout after its last request.
+func NewResolver(
+	apiBindingInformer apisinformer.APIBindingInformer,
+	apiResourceSchemaInformer apisinformer.APIResourceSchemaInformer,
+	maxWorkspaces int,
+	idleTimeout time.Duration,
+) (*Resolver, error) {
+	if _, found := apiBindingInformer.Informer().GetIndexer().GetIndexers()[byLogicalCluster]; !found {
+		if err := apiBindingInformer.Informer().AddIndexers(cache.Indexers{
+			byLogicalCluster: indexByLogicalCluster,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if _, found := apiBindingInformer.Informer().GetIndexer().GetIndexers()[byBoundSchema]; !found {
+		if err := apiBindingInformer.Informer().AddIndexers(cache.Indexers{
+			byBoundSchema: indexByBoundSchema,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if _, found := apiResourceSchemaInformer.Informer().GetIndexer().GetIndexers()[byCRDName]; !found {
+		if err := apiResourceSchemaInformer.Informer().AddIndexers(cache.Indexers{
+			byCRDName: indexByCRDName,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	r := newResolver(apiBindingInformer.Informer().GetIndexer(), apiResourceSchemaInformer.Informer().GetIndexer(), utilcache.NewLRUExpireCache(maxWorkspaces), idleTimeout)
+
+	apiBindingInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { r.invalidateBinding(obj) },
+		UpdateFunc: func(_, obj interface{}) { r.invalidateBinding(obj) },
+		DeleteFunc: func(obj interface{}) { r.invalidateBinding(obj) },
+	})
+	apiResourceSchemaInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { r.invalidateSchema(obj) },
+		UpdateFunc: func(_, obj interface{}) { r.invalidateSchema(obj) },
+		DeleteFunc: func(obj interface{}) { r.invalidateSchema(obj) },
+	})
+
+	return r, nil
+}
+
+func newResolver(apiBindingIndexer, apiResourceSchemaIndexer cache.Indexer, resolved *utilcache.LRUExpireCache, idleTimeout time.Duration) *Resolver {
+	return &Resolver{
+		apiBindingIndexer:        apiBindingIndexer,
+		apiResourceSchemaLister:  apislister.NewAPIResourceSchemaLister(apiResourceSchemaIndexer),
+		apiResourceSchemaIndexer: apiResourceSchemaIndexer,
+		idleTimeout:              idleTimeout,
+		resolving:                map[*resolution]struct{}{},
+		resolved:                 resolved,
+		requested:                map[string]time.Time{},
+	}
+}
+
+// indexByLogicalCluster indexes APIBindings by their logical cluster.
+func indexByLogicalCluster(obj interface{}) ([]string, error) {
+	binding, ok := obj.(*apisv1alpha1.APIBinding)
+	if !ok {
+		return []string{}, fmt.Errorf("obj is supposed to be an APIBinding, but is %T", obj)
+	}
+	return []string{binding.ClusterName}, nil
+}
+
+// indexByCRDName indexes APIResourceSchemas by the name of their shadow CRD.
+func indexByCRDName(obj interface{}) ([]string, error) {
+	s, ok := obj.(*apisv1alpha1.APIResourceSchema)
+	if !ok {
+		return []string{}, fmt.Errorf("obj is supposed to be an APIResourceSchema, but is %T", obj)
+	}
+	return []string{s.Spec.Names.Plural + "." + s.Spec.Group}, nil
+}
+
+// ShadowCRDKey is the cluster-aware key of the shadow CRD serving a bound resource.
+type ShadowCRDKey struct {
+	Key string
+	// Hash is the hash of the bound schema.
+	Hash string
+	// OverridesLocal is true if the shadow CRD takes precedence over a CRD of the
+	// workspace with the same name, according to the conflict policy of the APIBinding.
+	OverridesLocal bool
+}
+
+// ShadowCRDKeys returns the keys of the shadow CRDs serving the resources bound in the given
+// logical cluster, by CRD name. A resource bound by several APIBindings is served by the
+// APIBinding binding first. The returned map must not be mutated.
+func (r *Resolver) ShadowCRDKeys(clusterName string) (map[string]ShadowCRDKey, error) {
+	r.lock.Lock()
+	if cached, found := r.resolved.Get(clusterName); found {
+		// Touch the workspace to postpone its idle eviction.
+		r.resolved.Add(clusterName, cached, r.idleTimeout)
+		r.lock.Unlock()
+		return cached.(*resolvedWorkspace).keys, nil
+	}
+	inFlight := &resolution{clusterName: clusterName, staleSchemas: sets.NewString()}
+	r.resolving[inFlight] = struct{}{}
+	r.lock.Unlock()
+
+	resolved, err := r.resolve(clusterName)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.resolving, inFlight)
+	if err != nil {
+		return nil, err
+	}
+	if !inFlight.stale && !inFlight.staleSchemas.HasAny(resolved.schemas.UnsortedList()...) {
+		r.resolved.Add(clusterName, resolved, r.idleTimeout)
+	}
+	return resolved.keys, nil
+}
+
+// BoundResourceKeys returns the keys of the shadow CRDs of all the bound APIResourceSchemas of
+// the given CRD name, for requests across workspaces.
+func (r *Resolver) BoundResourceKeys(crdName string) ([]ShadowCRDKey, error) {
+	objs, err := r.apiResourceSchemaIndexer.ByIndex(byCRDName, crdName)
+	if err != nil {
+		return nil, err
+	}
+	hashes := sets.NewString()
+	for _, obj := range objs {
+		s := obj.(*apisv1alpha1.APIResourceSchema)
+		bindings, err := r.apiBindingIndexer.ByIndex(byBoundSchema, clusters.ToClusterAwareKey(s.ClusterName, s.Name))
+		if err != nil {
+			return nil, err
+		}
+		if len(bindings) == 0 {
+			continue
+		}
+		hash, err := SchemaHash(s)
+		if err != nil {
+			return nil, err
+		}
+		hashes.Insert(hash)
+	}
+	keys := make([]ShadowCRDKey, 0, hashes.Len())
+	for _, hash := range hashes.List() {
+		keys = append(keys, ShadowCRDKey{Key: clusters.ToClusterAwareKey(ShadowClusterName(hash), crdName), Hash: hash})
+	}
+	return keys, nil
+}
+
+// Requested returns when the shadow CRD of the given schema hash was first requested, and
+// whether it was.
+func (r *Resolver) Requested(hash string) (time.Time, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	requested, found := r.requested[hash]
+	return requested, found
+}
+
+// AddRequestHandler adds a handler called with the schema hashes requested for the first time.
+func (r *Resolver) AddRequestHandler(handler func(hash string)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.requestHandlers = append(r.requestHandlers, handler)
+}
+
+// Request records the given schema hash as requested, notifying the request handlers if it
+// is requested for the first time, and returns when it was first requested.
+func (r *Resolver) Request(hash string) time.Time {
+	r.lock.Lock()
+	requested, found := r.requested[hash]
+	if found {
+		r.lock.Unlock()
+		return requested
+	}
+	requested = time.Now()
+	r.requested[hash] = requested
+	handlers := r.requestHandlers
+	r.lock.Unlock()
+
+	for _, handler := range handlers {
+		handler(hash)
+	}
+	return requested
+}
+
+func (r *Resolver) resolve(clusterName string) (*resolvedWorkspace, error) {
+	objs, err := r.apiBindingIndexer.ByIndex(byLogicalCluster, clusterName)
+	if err != nil {
+		return nil, err
+	}
+	var bindings []*apisv1alpha1.APIBinding
+	for _, obj := range objs {
+		if binding := obj.(*apisv1alpha1.APIBinding); binding.Status.BoundAPIExport != nil {
+			bindings = append(bindings, binding)
+		}
+	}
+	sort.Slice(bindings, func(i, j int) bool {
+		return apishelper.BindsBefore(bindings[i], bindings[j])
+	})
+
+	resolved := &resolvedWorkspace{
+		keys:    map[string]ShadowCRDKey{},
+		schemas: sets.NewString(),
+	}
+	for _, binding := range bindings {
+		for _, schemaKey := range boundSchemaKeys(binding) {
+			resolved.schemas.Insert(schemaKey)
+			s, err := r.apiResourceSchemaLister.Get(schemaKey)
+			if errors.IsNotFound(err) {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			hash, err := SchemaHash(s)
+			if err != nil {
+				return nil, err
+			}
+			name := s.Spec.Names.Plural + "." + s.Spec.Group
+			if _, found := resolved.keys[name]; found {
+				continue // bound by an older APIBinding
+			}
+			resolved.keys[name] = ShadowCRDKey{
+				Key:            clusters.ToClusterAwareKey(ShadowClusterName(hash), name),
+				Hash:           hash,
+				OverridesLocal: apishelper.ConflictPolicy(binding) == apisv1alpha1.APIBindingConflictPolicyBindingWins,
+			}
+		}
+	}
+	return resolved, nil
+}
+
+// invalidateBinding evicts the workspace of the given APIBinding.
+func (r *Resolver) invalidateBinding(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	binding, ok := obj.(*apisv1alpha1.APIBinding)
+	if !ok {
+		runtime.HandleError(fmt.Errorf("obj is supposed to be an APIBinding, but is %T", obj))
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for inFlight := range r.resolving {
+		if inFlight.clusterName == binding.ClusterName {
+			inFlight.stale = true
+		}
+	}
+	r.resolved.Remove(binding.ClusterName)
+}
+
+// invalidateSchema evicts the workspaces bound to the given APIResourceSchema.
+func (r *Resolver) invalidateSchema(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	s, ok := obj.(*apisv1alpha1.APIResourceSchema)
+	if !ok {
+		runtime.HandleError(fmt.Errorf("obj is supposed to be an APIResourceSchema, but is %T", obj))
+		return
+	}
+	schemaKey := clusters.ToClusterAwareKey(s.ClusterName, s.Name)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for inFlight := range r.resolving {
+		inFlight.staleSchemas.Insert(schemaKey)
+	}
+	for _, clusterName := range r.resolved.Keys() {
+		if cached, found := r.resolved.Get(clusterName); found && cached.(*resolvedWorkspace).schemas.Has(schemaKey) {
+			r.resolved.Remove(clusterName)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package boundcrds
+
+import (
+	"testing"
+	"time"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilcache "k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/client-go/tools/cache"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+// racingIndexer calls race on the lookups of APIBindings, to invalidate during resolutions.
+type racingIndexer struct {
+	cache.Indexer
+	race func()
+}
+
+func (i *racingIndexer) ByIndex(indexName, indexedValue string) ([]interface{}, error) {
+	if i.race != nil {
+		i.race()
+	}
+	return i.Indexer.ByIndex(indexName, indexedValue)
+}
+
+func TestResolver(t *testing.T) {
+	widgets := &apisv1alpha1.APIResourceSchema{
+		ObjectMeta: metav1.ObjectMeta{ClusterName: "root:org:provider", Name: "today.widgets.example.com"},
+		Spec: apisv1alpha1.APIResourceSchemaSpec{
+			Group: "example.com",
+			Names: apiextensionsv1.CustomResourceDefinitionNames{Plural: "widgets", Kind: "Widget"},
+			Scope: apiextensionsv1.NamespaceScoped,
+		},
+	}
+	binding := func(clusterName string) *apisv1alpha1.APIBinding {
+		return &apisv1alpha1.APIBinding{
+			ObjectMeta: metav1.ObjectMeta{ClusterName: clusterName, Name: "widgets"},
+			Status: apisv1alpha1.APIBindingStatus{
+				BoundAPIExport: &apisv1alpha1.ExportReference{
+					Workspace: &apisv1alpha1.WorkspaceExportReference{Path: "root:org:provider", ExportName: "widgets"},
+				},
+				BoundResources: []apisv1alpha1.BoundAPIResource{
+					{Group: "example.com", Resource: "widgets", Schema: apisv1alpha1.BoundAPIResourceSchema{Name: widgets.Name}},
+				},
+			},
+		}
+	}
+
+	bindingIndexer := &racingIndexer{Indexer: cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{byLogicalCluster: indexByLogicalCluster, byBoundSchema: indexByBoundSchema})}
+	schemaIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{byCRDName: indexByCRDName})
+	clock := &fakeClock{now: time.Now()}
+	r := newResolver(bindingIndexer, schemaIndexer, utilcache.NewLRUExpireCacheWithClock(2, clock), time.Minute)
+	var requested []string
+	r.AddRequestHandler(func(hash string) { requested = append(requested, hash) })
+
+	resolve := func(clusterName string) map[string]ShadowCRDKey {
+		t.Helper()
+		keys, err := r.ShadowCRDKeys(clusterName)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return keys
+	}
+	add := func(indexer cache.Indexer, obj interface{}) {
+		t.Helper()
+		if err := indexer.Add(obj); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// The binding of the workspace is resolved once its schema exists.
+	add(bindingIndexer, binding("root:org:consumer"))
+	if keys := resolve("root:org:consumer"); len(keys) != 0 {
+		t.Errorf("got %v before the schema exists, want none", keys)
+	}
+	add(schemaIndexer, widgets)
+	if keys := resolve("root:org:consumer"); len(keys) != 0 {
+		t.Errorf("got %v from the cache, want none", keys)
+	}
+	r.invalidateSchema(widgets)
+	if keys := resolve("root:org:consumer"); len(keys) != 1 {
+		t.Errorf("got %v after the schema was added, want widgets", keys)
+	}
+
+	// Bound resources are requested across workspaces by the name of their shadow CRD, once.
+	hash, err := SchemaHash(widgets)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	keys, err := r.BoundResourceKeys("widgets.example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(keys) != 1 || keys[0].Hash != hash {
+		t.Errorf("got %v, want the widgets of hash %q", keys, hash)
+	}
+	if _, found := r.Requested(hash); found {
+		t.Errorf("schema hash %q is requested before its first request", hash)
+	}
+	first := r.Request(hash)
+	if again := r.Request(hash); !again.Equal(first) || len(requested) != 1 || requested[0] != hash {
+		t.Errorf("got requested %v at %v and %v, want %q once", requested, first, again, hash)
+	}
+
+	// Bindings of other workspaces only invalidate their workspace.
+	add(bindingIndexer, binding("root:org:other"))
+	r.invalidateBinding(binding("root:org:other"))
+	if keys := resolve("root:org:consumer"); len(keys) != 1 {
+		t.Errorf("got %v, want widgets", keys)
+	}
+	if keys := resolve("root:org:other"); len(keys) != 1 {
+		t.Errorf("got %v, want widgets", keys)
+	}
+
+	// Resolutions racing with invalidations of their workspace are not cached, the ones
+	// racing with invalidations of other workspaces are.
+	r.resolved.Remove("root:org:other")
+	bindingIndexer.race = func() { r.invalidateBinding(binding("root:org:other")) }
+	resolve("root:org:other")
+	if _, found := r.resolved.Get("root:org:other"); found {
+		t.Errorf("resolution of root:org:other racing with its invalidation was cached")
+	}
+	bindingIndexer.race = func() { r.invalidateBinding(binding("root:org:consumer")) }
+	resolve("root:org:other")
+	if _, found := r.resolved.Get("root:org:other"); !found {
+		t.Errorf("resolution of root:org:other racing with the invalidation of root:org:consumer was not cached")
+	}
+	bindingIndexer.race = nil
+
+	// Deleted bindings are not served anymore once invalidated.
+	if err := bindingIndexer.Delete(binding("root:org:consumer")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	r.invalidateBinding(binding("root:org:consumer"))
+	if keys := resolve("root:org:consumer"); len(keys) != 0 {
+		t.Errorf("got %v after the binding was deleted, want none", keys)
+	}
+
+	// Idle workspaces are evicted, active ones are kept.
+	clock.now = clock.now.Add(40 * time.Second)
+	resolve("root:org:other")
+	clock.now = clock.now.Add(40 * time.Second)
+	if _, found := r.resolved.Get("root:org:consumer"); found {
+		t.Errorf("idle workspace root:org:consumer was not evicted")
+	}
+	if _, found := r.resolved.Get("root:org:other"); !found {
+		t.Errorf("active workspace root:org:other was evicted")
+	}
+
+	// The least recently used workspaces are evicted beyond the maximum.
+	resolve("root:org:a")
+	resolve("root:org:b")
+	if _, found := r.resolved.Get("root:org:other"); found {
+		t.Errorf("least recently used workspace root:org:other was not evicted")
+	}
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package boundcrds
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+	tenancyhelper "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+	"github.com/kcp-dev/kcp/pkg/schemaconversion"
+)
+
+// ShadowClusterPrefix is the prefix of the system logical clusters holding the shared
+// CRDs of bound APIResourceSchemas, one logical cluster per unique schema.
+const ShadowClusterPrefix = tenancyhelper.LocalSystemClusterPrefix + "bound-crds-"
+
+// SchemaHash returns the hash of the given APIResourceSchema. Schemas with the same hash
+// are served by the same shadow CRD, independently of the workspace they live in.
+//
+// Webhook service references are resolved in the workspace of the schema, hence schemas
+// with a webhook service conversion are only shared within their workspace.
+func SchemaHash(s *apisv1alpha1.APIResourceSchema) (string, error) {
+	bs, err := json.Marshal(s.Spec)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode APIResourceSchema %s|%s: %w", s.ClusterName, s.Name, err)
+	}
+	if c := s.Spec.Conversion; c != nil && c.Strategy == apisv1alpha1.WebhookConverter && c.Webhook != nil && c.Webhook.ClientConfig != nil && c.Webhook.ClientConfig.Service != nil {
+		bs = append(bs, []byte(s.ClusterName)...)
+	}
+	hash := sha256.Sum256(bs)
+	return fmt.Sprintf("%x", hash[:8]), nil
+}
+
+// ShadowClusterName returns the logical cluster of the shadow CRD of the schema with the given hash.
+func ShadowClusterName(hash string) string {
+	return ShadowClusterPrefix + hash
+}
+
+// HashFromShadowClusterName returns the schema hash of the given shadow logical cluster,
+// or false if the logical cluster is not a shadow logical cluster.
+func HashFromShadowClusterName(clusterName string) (string, bool) {
+	if !strings.HasPrefix(clusterName, ShadowClusterPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(clusterName, ShadowClusterPrefix), true
+}
+
+// ShadowCRD returns the shared CRD serving the given APIResourceSchema in every workspace
+// bound to it, and its logical cluster.
+func ShadowCRD(s *apisv1alpha1.APIResourceSchema) (*apiextensionsv1.CustomResourceDefinition, error) {
+	hash, err := SchemaHash(s)
+	if err != nil {
+		return nil, err
+	}
+	crd, err := schemaconversion.CustomResourceDefinition(s)
+	if err != nil {
+		return nil, err
+	}
+	crd.ClusterName = ShadowClusterName(hash)
+	return crd, nil
+}
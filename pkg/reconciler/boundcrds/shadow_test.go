@@ -0,0 +1,112 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package boundcrds
+
+import (
+	"testing"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+)
+
+func TestSchemaHash(t *testing.T) {
+	schema := func(clusterName, plural string, conversion *apisv1alpha1.CustomResourceConversion) *apisv1alpha1.APIResourceSchema {
+		return &apisv1alpha1.APIResourceSchema{
+			ObjectMeta: metav1.ObjectMeta{
+				ClusterName: clusterName,
+				Name:        "today." + plural + ".example.com",
+			},
+			Spec: apisv1alpha1.APIResourceSchemaSpec{
+				Group: "example.com",
+				Names: apiextensionsv1.CustomResourceDefinitionNames{
+					Plural:   plural,
+					Singular: "widget",
+					Kind:     "Widget",
+					ListKind: "WidgetList",
+				},
+				Scope: apiextensionsv1.NamespaceScoped,
+				Versions: []apisv1alpha1.APIResourceVersion{
+					{Name: "v1", Served: true, Storage: true, Schema: runtime.RawExtension{Raw: []byte(`{"type":"object"}`)}},
+				},
+				Conversion: conversion,
+			},
+		}
+	}
+	webhookService := &apisv1alpha1.CustomResourceConversion{
+		Strategy: apisv1alpha1.WebhookConverter,
+		Webhook: &apiextensionsv1.WebhookConversion{
+			ClientConfig: &apiextensionsv1.WebhookClientConfig{
+				Service: &apiextensionsv1.ServiceReference{Namespace: "default", Name: "converter"},
+			},
+			ConversionReviewVersions: []string{"v1"},
+		},
+	}
+
+	for _, tt := range []struct {
+		name     string
+		a, b     *apisv1alpha1.APIResourceSchema
+		wantSame bool
+	}{
+		{
+			name:     "same schema in different workspaces",
+			a:        schema("org:ws1", "widgets", nil),
+			b:        schema("org:ws2", "widgets", nil),
+			wantSame: true,
+		},
+		{
+			name: "different specs",
+			a:    schema("org:ws1", "widgets", nil),
+			b:    schema("org:ws1", "gadgets", nil),
+		},
+		{
+			name: "webhook service conversion in different workspaces",
+			a:    schema("org:ws1", "widgets", webhookService),
+			b:    schema("org:ws2", "widgets", webhookService),
+		},
+		{
+			name:     "webhook service conversion in the same workspace",
+			a:        schema("org:ws1", "widgets", webhookService),
+			b:        schema("org:ws1", "widgets", webhookService),
+			wantSame: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := ShadowCRD(tt.a)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			b, err := ShadowCRD(tt.b)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if same := a.ClusterName == b.ClusterName; same != tt.wantSame {
+				t.Errorf("got shadow clusters %q and %q, want same=%v", a.ClusterName, b.ClusterName, tt.wantSame)
+			}
+
+			hash, ok := HashFromShadowClusterName(a.ClusterName)
+			if !ok {
+				t.Fatalf("%q is not a shadow cluster name", a.ClusterName)
+			}
+			if want, _ := SchemaHash(tt.a); hash != want {
+				t.Errorf("got hash %q, want %q", hash, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package heartbeat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+	kcpclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
+	workloadinformer "github.com/kcp-dev/kcp/pkg/client/informers/externalversions/workload/v1alpha1"
+	workloadlisters "github.com/kcp-dev/kcp/pkg/client/listers/workload/v1alpha1"
+)
+
+const controllerName = "workloadcluster-heartbeat"
+
+func NewController(
+	kcpClient kcpclient.ClusterInterface,
+	workloadClusterInformer workloadinformer.WorkloadClusterInformer,
+	gracePeriod time.Duration,
+) *Controller {
+	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), controllerName)
+
+	c := &Controller{
+		queue:                 queue,
+		kcpClient:             kcpClient,
+		workloadClusterLister: workloadClusterInformer.Lister(),
+		gracePeriod:           gracePeriod,
+	}
+
+	workloadClusterInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.enqueue(obj) },
+		UpdateFunc: func(_, obj interface{}) { c.enqueue(obj) },
+	})
+
+	return c
+}
+
+// Controller marks WorkloadClusters as not ready when their syncer stops reporting heartbeats
+// for longer than the grace period, so that no new workloads get scheduled to them and
+// existing ones are rescheduled.
+type Controller struct {
+	queue workqueue.RateLimitingInterface
+
+	kcpClient             kcpclient.ClusterInterface
+	workloadClusterLister workloadlisters.WorkloadClusterLister
+	gracePeriod           time.Duration
+}
+
+func (c *Controller) enqueue(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	klog.V(4).Infof("queueing WorkloadCluster %q", key)
+	c.queue.Add(key)
+}
+
+func (c *Controller) Start(ctx context.Context, numThreads int) {
+	defer runtime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.Info("Starting WorkloadCluster heartbeat controller")
+	defer klog.Info("Shutting down WorkloadCluster heartbeat controller")
+
+	for i := 0; i < numThreads; i++ {
+		go wait.Until(func() { c.startWorker(ctx) }, time.Second, ctx.Done())
+	}
+
+	<-ctx.Done()
+}
+
+func (c *Controller) startWorker(ctx context.Context) {
+	for c.processNextWorkItem(ctx) {
+	}
+}
+
+func (c *Controller) processNextWorkItem(ctx context.Context) bool {
+	// Wait until there is a new item in the working queue
+	k, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	key := k.(string)
+
+	// No matter what, tell the queue we're done with this key, to unblock
+	// other workers.
+	defer c.queue.Done(key)
+
+	if err := c.process(ctx, key); err != nil {
+		runtime.HandleError(fmt.Errorf("%q controller failed to sync %q, err: %w", controllerName, key, err))
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+func (c *Controller) process(ctx context.Context, key string) error {
+	old, err := c.workloadClusterLister.Get(key)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	cluster := old.DeepCopy()
+	if recheckAfter := reconcile(cluster, c.gracePeriod, time.Now()); recheckAfter > 0 {
+		c.queue.AddAfter(key, recheckAfter)
+	}
+
+	return c.patchStatus(ctx, old, cluster)
+}
+
+func (c *Controller) patchStatus(ctx context.Context, old, obj *workloadv1alpha1.WorkloadCluster) error {
+	if equality.Semantic.DeepEqual(old.Status.Conditions, obj.Status.Conditions) {
+		return nil
+	}
+
+	oldData, err := json.Marshal(workloadv1alpha1.WorkloadCluster{
+		Status: old.Status,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to Marshal old data for WorkloadCluster %s|%s: %w", obj.ClusterName, obj.Name, err)
+	}
+	newData, err := json.Marshal(workloadv1alpha1.WorkloadCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			UID:             old.UID,
+			ResourceVersion: old.ResourceVersion,
+		}, // to ensure they appear in the patch as preconditions
+		Status: obj.Status,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to Marshal new data for WorkloadCluster %s|%s: %w", obj.ClusterName, obj.Name, err)
+	}
+	patchBytes, err := jsonpatch.CreateMergePatch(oldData, newData)
+	if err != nil {
+		return fmt.Errorf("failed to create patch for WorkloadCluster %s|%s: %w", obj.ClusterName, obj.Name, err)
+	}
+	_, err = c.kcpClient.Cluster(obj.ClusterName).WorkloadV1alpha1().WorkloadClusters().Patch(ctx, obj.Name, types.MergePatchType, patchBytes, metav1.PatchOptions{}, "status")
+	return err
+}
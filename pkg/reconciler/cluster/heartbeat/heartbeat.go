@@ -0,0 +1,53 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package heartbeat
+
+import (
+	"time"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+	conditionsv1alpha1 "github.com/kcp-dev/kcp/third_party/conditions/apis/conditions/v1alpha1"
+	"github.com/kcp-dev/kcp/third_party/conditions/util/conditions"
+)
+
+// reconcile marks the cluster as not ready when its syncer has not reported a heartbeat
+// within the grace period, and as ready again once heartbeats resume. It returns the
+// duration after which the cluster must be checked again, or zero if there is no need to.
+func reconcile(cluster *workloadv1alpha1.WorkloadCluster, gracePeriod time.Duration, now time.Time) time.Duration {
+	lastHeartbeat := cluster.Status.LastSyncerHeartbeatTime
+	if lastHeartbeat == nil {
+		return 0 // no syncer has ever reported, the syncer controller owns readiness
+	}
+
+	expiry := lastHeartbeat.Add(gracePeriod)
+	if !now.Before(expiry) {
+		conditions.MarkFalse(
+			cluster,
+			workloadv1alpha1.WorkloadClusterReadyCondition,
+			workloadv1alpha1.ErrorHeartbeatMissedReason,
+			conditionsv1alpha1.ConditionSeverityWarning,
+			"No heartbeat received from the syncer since %s.",
+			lastHeartbeat.UTC().Format(time.RFC3339),
+		)
+		return 0
+	}
+
+	if conditions.GetReason(cluster, workloadv1alpha1.WorkloadClusterReadyCondition) == workloadv1alpha1.ErrorHeartbeatMissedReason {
+		conditions.MarkTrue(cluster, workloadv1alpha1.WorkloadClusterReadyCondition)
+	}
+	return expiry.Sub(now)
+}
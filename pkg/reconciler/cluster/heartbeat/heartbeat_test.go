@@ -0,0 +1,93 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package heartbeat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+	conditionsv1alpha1 "github.com/kcp-dev/kcp/third_party/conditions/apis/conditions/v1alpha1"
+	"github.com/kcp-dev/kcp/third_party/conditions/util/conditions"
+)
+
+func TestReconcile(t *testing.T) {
+	now := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	gracePeriod := 20 * time.Second
+
+	for _, tt := range []struct {
+		name          string
+		lastHeartbeat *metav1.Time
+		readyReason   string
+		wantReady     bool
+		wantReason    string
+		wantRecheck   time.Duration
+	}{
+		{
+			name:      "no heartbeat yet",
+			wantReady: true,
+		},
+		{
+			name:          "recent heartbeat",
+			lastHeartbeat: &metav1.Time{Time: now.Add(-5 * time.Second)},
+			wantReady:     true,
+			wantRecheck:   15 * time.Second,
+		},
+		{
+			name:          "heartbeat missed",
+			lastHeartbeat: &metav1.Time{Time: now.Add(-gracePeriod)},
+			wantReason:    workloadv1alpha1.ErrorHeartbeatMissedReason,
+		},
+		{
+			name:          "heartbeat resumed",
+			lastHeartbeat: &metav1.Time{Time: now},
+			readyReason:   workloadv1alpha1.ErrorHeartbeatMissedReason,
+			wantReady:     true,
+			wantRecheck:   gracePeriod,
+		},
+		{
+			name:          "not ready for another reason",
+			lastHeartbeat: &metav1.Time{Time: now},
+			readyReason:   workloadv1alpha1.WorkloadClusterNotReadyReason,
+			wantReason:    workloadv1alpha1.WorkloadClusterNotReadyReason,
+			wantRecheck:   gracePeriod,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := &workloadv1alpha1.WorkloadCluster{
+				Status: workloadv1alpha1.WorkloadClusterStatus{
+					LastSyncerHeartbeatTime: tt.lastHeartbeat,
+				},
+			}
+			if tt.readyReason != "" {
+				conditions.MarkFalse(cluster, workloadv1alpha1.WorkloadClusterReadyCondition, tt.readyReason, conditionsv1alpha1.ConditionSeverityError, "")
+			} else {
+				conditions.MarkTrue(cluster, workloadv1alpha1.WorkloadClusterReadyCondition)
+			}
+
+			recheck := reconcile(cluster, gracePeriod, now)
+
+			require.Equal(t, tt.wantRecheck, recheck)
+			require.Equal(t, tt.wantReady, conditions.IsTrue(cluster, workloadv1alpha1.WorkloadClusterReadyCondition))
+			require.Equal(t, tt.wantReason, conditions.GetReason(cluster, workloadv1alpha1.WorkloadClusterReadyCondition))
+		})
+	}
+}
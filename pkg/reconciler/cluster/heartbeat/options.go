@@ -0,0 +1,51 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package heartbeat
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/kcp-dev/kcp/pkg/syncer"
+)
+
+// DefaultOptions are the default options for the heartbeat controller.
+func DefaultOptions() *Options {
+	return &Options{
+		HeartbeatGracePeriod: 4 * syncer.HeartbeatInterval,
+	}
+}
+
+// BindOptions binds the heartbeat controller options to the flag set.
+func BindOptions(o *Options, fs *pflag.FlagSet) *Options {
+	fs.DurationVar(&o.HeartbeatGracePeriod, "syncer-heartbeat-grace-period", o.HeartbeatGracePeriod, "Amount of time after the last syncer heartbeat before a workload cluster is marked as not ready")
+	return o
+}
+
+// Options are the options for the heartbeat controller.
+type Options struct {
+	HeartbeatGracePeriod time.Duration
+}
+
+func (o *Options) Validate() error {
+	if o.HeartbeatGracePeriod <= syncer.HeartbeatInterval {
+		return fmt.Errorf("--syncer-heartbeat-grace-period must be greater than the syncer heartbeat interval of %s", syncer.HeartbeatInterval)
+	}
+	return nil
+}
@@ -27,13 +27,12 @@ import (
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
-	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/selection"
-	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog/v2"
 
 	"github.com/kcp-dev/kcp/pkg/syncer"
+	"github.com/kcp-dev/kcp/pkg/syncer/bundle"
 )
 
 const (
@@ -74,32 +73,11 @@ func installSyncer(ctx context.Context, client kubernetes.Interface, syncerImage
 	}
 
 	// Create or Update ClusterRole
-
-	resourcesWithStatus := sets.NewString()
-	apiGroups := sets.NewString()
-
-	for _, groupResourceToSync := range groupResourcesToSync {
-		gr := schema.ParseGroupResource(groupResourceToSync)
-		resourcesWithStatus.Insert(gr.Resource, gr.Resource+"/status")
-		apiGroups.Insert(gr.Group)
-	}
-
 	clusterRole := &rbacv1.ClusterRole{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: syncerSAName,
 		},
-		Rules: []rbacv1.PolicyRule{
-			{
-				Verbs:     []string{"create"},
-				APIGroups: []string{""},
-				Resources: []string{"namespaces"},
-			},
-			{
-				Verbs:     []string{"list", "watch", "create", "update", "get", "delete"},
-				Resources: resourcesWithStatus.List(),
-				APIGroups: apiGroups.List(),
-			},
-		},
+		Rules: bundle.ClusterRoleRules(groupResourcesToSync),
 	}
 	if _, err := client.RbacV1().ClusterRoles().Create(ctx, clusterRole, metav1.CreateOptions{}); err != nil {
 		if !k8serrors.IsAlreadyExists(err) {
@@ -99,7 +99,7 @@ func (m *pullSyncerManager) checkHealth(ctx context.Context, cluster *workloadv1
 		conditions.MarkFalse(cluster, workloadv1alpha1.WorkloadClusterReadyCondition, workloadv1alpha1.WorkloadClusterNotReadyReason, conditionsv1alpha1.ConditionSeverityInfo, "Syncer not yet ready")
 	} else {
 		klog.Infof("started pull mode syncer for cluster %s in logical cluster %s!", cluster.Name, logicalCluster)
-		conditions.MarkTrue(cluster, workloadv1alpha1.WorkloadClusterReadyCondition)
+		markReadyUnlessHeartbeatMissed(cluster)
 	}
 	return true
 }
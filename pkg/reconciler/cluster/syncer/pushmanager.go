@@ -136,7 +136,7 @@ func (m *pushSyncerManager) checkHealth(ctx context.Context, cluster *workloadv1
 
 	logicalCluster := cluster.GetClusterName()
 	klog.Infof("healthy push mode syncer running for cluster %s in logical cluster %s!", cluster.Name, logicalCluster)
-	conditions.MarkTrue(cluster, workloadv1alpha1.WorkloadClusterReadyCondition)
+	markReadyUnlessHeartbeatMissed(cluster)
 
 	return true
 }
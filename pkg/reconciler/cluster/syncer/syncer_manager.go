@@ -99,6 +99,12 @@ func (m *syncerManager) Reconcile(ctx context.Context, cluster *workloadv1alpha1
 		}.String())
 	}
 
+	for _, groupResource := range groupResources.List() {
+		if !cluster.Spec.SyncedResources.Allows(schema.ParseGroupResource(groupResource).WithVersion("")) {
+			groupResources.Delete(groupResource)
+		}
+	}
+
 	cfg, err := clientcmd.RESTConfigFromKubeConfig([]byte(cluster.Spec.KubeConfig))
 	if err != nil {
 		klog.Errorf("%s: invalid kubeconfig: %v", m.name, err)
@@ -152,3 +158,13 @@ func (m *syncerManager) Cleanup(ctx context.Context, deletedCluster *workloadv1a
 	klog.Infof("%s: cleanup resources for cluster %q", m.name, deletedCluster.Name)
 	m.syncerManagerImpl.cleanup(ctx, deletedCluster)
 }
+
+// markReadyUnlessHeartbeatMissed marks the cluster as ready, unless it has been marked
+// as not ready because its syncer stopped sending heartbeats. The heartbeat controller
+// marks it as ready again when heartbeats resume.
+func markReadyUnlessHeartbeatMissed(cluster *workloadv1alpha1.WorkloadCluster) {
+	if conditions.GetReason(cluster, workloadv1alpha1.WorkloadClusterReadyCondition) == workloadv1alpha1.ErrorHeartbeatMissedReason {
+		return
+	}
+	conditions.MarkTrue(cluster, workloadv1alpha1.WorkloadClusterReadyCondition)
+}
@@ -18,29 +18,21 @@ package clusterworkspacetypebootstrap
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"time"
 
-	jsonpatch "github.com/evanphx/json-patch"
-
 	apiextensionclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
-	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/tools/cache"
-	"k8s.io/client-go/tools/clusters"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 
-	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
-	kcpclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
 	tenancyinformer "github.com/kcp-dev/kcp/pkg/client/informers/externalversions/tenancy/v1alpha1"
 	tenancylister "github.com/kcp-dev/kcp/pkg/client/listers/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/reconciler/statusbatcher"
 )
 
 const (
@@ -50,20 +42,21 @@ const (
 func NewController(
 	dynamicCLient dynamic.ClusterInterface,
 	crdClusterClient apiextensionclientset.ClusterInterface,
-	kcpClusterClient kcpclient.ClusterInterface,
+	statusBatcher *statusbatcher.Batcher,
 	workspaceInformer tenancyinformer.ClusterWorkspaceInformer,
 	workspaceType string,
+	shards int,
 	bootstrap func(context.Context, apiextensionclientset.Interface, dynamic.Interface) error,
 ) (*controller, error) {
 	controllerName := fmt.Sprintf("%s-%s", controllerNameBase, workspaceType)
-	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), controllerName)
+	queue := newShardedQueue(controllerName, shards)
 
 	c := &controller{
 		controllerName:  controllerName,
 		queue:           queue,
 		dynamicClient:   dynamicCLient,
 		crdClient:       crdClusterClient,
-		kcpClient:       kcpClusterClient,
+		statusBatcher:   statusBatcher,
 		workspaceLister: workspaceInformer.Lister(),
 		syncChecks: []cache.InformerSynced{
 			workspaceInformer.Informer().HasSynced,
@@ -76,20 +69,23 @@ func NewController(
 		AddFunc:    func(obj interface{}) { c.enqueue(obj) },
 		UpdateFunc: func(_, obj interface{}) { c.enqueue(obj) },
 	})
+	statusBatcher.AddRequeueFunc(func(key string) { c.queue.Add(key) })
 
 	return c, nil
 }
 
 // controller watches ClusterWorkspaces of a given type in initializing
 // state and bootstrap resources from the configs/<lower-case-type> package.
+// The workspaces are sharded by logical cluster, each shard being processed
+// by its own workers.
 type controller struct {
 	controllerName string
 
-	queue workqueue.RateLimitingInterface
+	queue *shardedQueue
 
 	dynamicClient dynamic.ClusterInterface
 	crdClient     apiextensionclientset.ClusterInterface
-	kcpClient     kcpclient.ClusterInterface
+	statusBatcher *statusbatcher.Batcher
 
 	workspaceLister tenancylister.ClusterWorkspaceLister
 
@@ -121,21 +117,25 @@ func (c *controller) Start(ctx context.Context, numThreads int) {
 		return
 	}
 
-	for i := 0; i < numThreads; i++ {
-		go wait.Until(func() { c.startWorker(ctx) }, time.Second, ctx.Done())
+	// numThreads workers per shard
+	for _, shard := range c.queue.shards {
+		shard := shard
+		for i := 0; i < numThreads; i++ {
+			go wait.Until(func() { c.startWorker(ctx, shard) }, time.Second, ctx.Done())
+		}
 	}
 
 	<-ctx.Done()
 }
 
-func (c *controller) startWorker(ctx context.Context) {
-	for c.processNextWorkItem(ctx) {
+func (c *controller) startWorker(ctx context.Context, queue workqueue.RateLimitingInterface) {
+	for c.processNextWorkItem(ctx, queue) {
 	}
 }
 
-func (c *controller) processNextWorkItem(ctx context.Context) bool {
+func (c *controller) processNextWorkItem(ctx context.Context, queue workqueue.RateLimitingInterface) bool {
 	// Wait until there is a new item in the working queue
-	k, quit := c.queue.Get()
+	k, quit := queue.Get()
 	if quit {
 		return false
 	}
@@ -145,25 +145,18 @@ func (c *controller) processNextWorkItem(ctx context.Context) bool {
 
 	// No matter what, tell the queue we're done with this key, to unblock
 	// other workers.
-	defer c.queue.Done(key)
+	defer queue.Done(key)
 
 	if err := c.process(ctx, key); err != nil {
 		runtime.HandleError(fmt.Errorf("%q controller failed to sync %q, err: %w", c.controllerName, key, err))
-		c.queue.AddRateLimited(key)
+		queue.AddRateLimited(key)
 		return true
 	}
-	c.queue.Forget(key)
+	queue.Forget(key)
 	return true
 }
 
 func (c *controller) process(ctx context.Context, key string) error {
-	namespace, clusterAwareName, err := cache.SplitMetaNamespaceKey(key)
-	if err != nil {
-		klog.Errorf("invalid key: %q: %v", key, err)
-		return nil
-	}
-	clusterName, name := clusters.SplitClusterAwareKey(clusterAwareName)
-
 	obj, err := c.workspaceLister.Get(key) // TODO: clients need a way to scope down the lister per-cluster
 	if err != nil {
 		if errors.IsNotFound(err) {
@@ -174,37 +167,12 @@ func (c *controller) process(ctx context.Context, key string) error {
 	old := obj
 	obj = obj.DeepCopy()
 
-	if err := c.reconcile(ctx, obj); err != nil {
-		return err
-	}
-
-	// If the object being reconciled changed as a result, update it.
-	if !equality.Semantic.DeepEqual(old.Status, obj.Status) {
-		oldData, err := json.Marshal(tenancyv1alpha1.ClusterWorkspace{
-			Status: old.Status,
-		})
-		if err != nil {
-			return fmt.Errorf("failed to Marshal old data for workspace %s|%s/%s: %w", clusterName, namespace, name, err)
-		}
-
-		newData, err := json.Marshal(tenancyv1alpha1.ClusterWorkspace{
-			ObjectMeta: metav1.ObjectMeta{
-				UID:             old.UID,
-				ResourceVersion: old.ResourceVersion,
-			}, // to ensure they appear in the patch as preconditions
-			Status: obj.Status,
-		})
-		if err != nil {
-			return fmt.Errorf("failed to Marshal new data for workspace %s|%s/%s: %w", clusterName, namespace, name, err)
-		}
+	reconcileErr := c.reconcile(ctx, obj)
 
-		patchBytes, err := jsonpatch.CreateMergePatch(oldData, newData)
-		if err != nil {
-			return fmt.Errorf("failed to create patch for workspace %s|%s/%s: %w", clusterName, namespace, name, err)
-		}
-		_, uerr := c.kcpClient.Cluster(clusterName).TenancyV1alpha1().ClusterWorkspaces().Patch(ctx, obj.Name, types.MergePatchType, patchBytes, metav1.PatchOptions{}, "status")
-		return uerr
+	// If the object being reconciled changed as a result, update it. This is also
+	// done when reconciling failed, to surface the failure in the conditions.
+	if err := c.statusBatcher.Patch(old, obj); err != nil {
+		return err
 	}
-
-	return nil
+	return reconcileErr
 }
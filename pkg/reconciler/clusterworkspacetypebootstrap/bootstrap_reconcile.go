@@ -25,6 +25,9 @@ import (
 
 	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
 	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+	"github.com/kcp-dev/kcp/pkg/workspacetype"
+	conditionsv1alpha1 "github.com/kcp-dev/kcp/third_party/conditions/apis/conditions/v1alpha1"
+	"github.com/kcp-dev/kcp/third_party/conditions/util/conditions"
 )
 
 const (
@@ -35,7 +38,7 @@ func (c *controller) reconcile(ctx context.Context, workspace *tenancyv1alpha1.C
 	if workspace.Status.Phase != tenancyv1alpha1.ClusterWorkspacePhaseInitializing {
 		return nil
 	}
-	if workspace.Spec.Type != c.workspaceType {
+	if workspacetype.TypeName(workspace) != c.workspaceType {
 		return nil
 	}
 
@@ -62,8 +65,10 @@ func (c *controller) reconcile(ctx context.Context, workspace *tenancyv1alpha1.C
 	bootstrapCtx, cancel := context.WithDeadline(ctx, time.Now().Add(time.Second*30)) // to not block the controller
 	defer cancel()
 	if err := c.bootstrap(bootstrapCtx, c.crdClient.Cluster(wsClusterName), c.dynamicClient.Cluster(wsClusterName)); err != nil {
+		conditions.MarkFalse(workspace, tenancyv1alpha1.WorkspaceTypeBootstrapped, tenancyv1alpha1.WorkspaceTypeBootstrappedReasonBootstrapFailed, conditionsv1alpha1.ConditionSeverityError, "Failed to bootstrap the resources of type %s: %v.", c.workspaceType, err)
 		return err // requeue
 	}
+	conditions.MarkTrue(workspace, tenancyv1alpha1.WorkspaceTypeBootstrapped)
 
 	// we are done. remove our initializer
 	newInitializers := make([]tenancyv1alpha1.ClusterWorkspaceInitializer, 0, len(workspace.Status.Initializers))
@@ -0,0 +1,92 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clusterworkspacetypebootstrap
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clusters"
+	"k8s.io/client-go/util/workqueue"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+	reconcilermetrics "github.com/kcp-dev/kcp/pkg/reconciler/metrics"
+)
+
+// DefaultShards is the default number of shards ClusterWorkspaces are bootstrapped in.
+const DefaultShards = 8
+
+// shardedQueue splits the keys of ClusterWorkspaces over independent queues, by the hash
+// of the logical cluster of the workspace. Every shard has its own rate limiter and
+// workers, such that a burst of new workspaces, e.g. in a single organization, is
+// bootstrapped in parallel, and the retries of failing workspaces only slow down their
+// shard.
+type shardedQueue struct {
+	shards []workqueue.RateLimitingInterface
+}
+
+func newShardedQueue(controllerName string, shards int) *shardedQueue {
+	if shards < 1 {
+		shards = 1
+	}
+	q := &shardedQueue{
+		shards: make([]workqueue.RateLimitingInterface, shards),
+	}
+	for i := range q.shards {
+		name := fmt.Sprintf("%s-%d", controllerName, i)
+		q.shards[i] = reconcilermetrics.InstrumentQueue(controllerName, workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), name))
+	}
+	return q
+}
+
+// Add queues the given ClusterWorkspace key in its shard.
+func (q *shardedQueue) Add(key string) {
+	q.shardFor(key).Add(key)
+}
+
+// shardFor returns the queue of the shard of the given ClusterWorkspace key.
+func (q *shardedQueue) shardFor(key string) workqueue.RateLimitingInterface {
+	h := fnv.New32a()
+	h.Write([]byte(workspaceClusterName(key))) // nolint:errcheck
+	return q.shards[h.Sum32()%uint32(len(q.shards))]
+}
+
+func (q *shardedQueue) ShutDown() {
+	for _, shard := range q.shards {
+		shard.ShutDown()
+	}
+}
+
+// workspaceClusterName returns the logical cluster of the ClusterWorkspace of the given key,
+// or the key itself if it is not a valid ClusterWorkspace key.
+func workspaceClusterName(key string) string {
+	_, clusterAwareName, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return key
+	}
+	clusterName, name := clusters.SplitClusterAwareKey(clusterAwareName)
+	wsClusterName, err := helper.EncodeLogicalClusterName(&tenancyv1alpha1.ClusterWorkspace{
+		ObjectMeta: metav1.ObjectMeta{ClusterName: clusterName, Name: name},
+	})
+	if err != nil {
+		return key
+	}
+	return wsClusterName
+}
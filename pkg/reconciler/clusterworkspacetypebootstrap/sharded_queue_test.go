@@ -0,0 +1,59 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clusterworkspacetypebootstrap
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/client-go/tools/clusters"
+)
+
+func TestWorkspaceClusterName(t *testing.T) {
+	require.Equal(t, "root:acme", workspaceClusterName(clusters.ToClusterAwareKey("root", "acme")))
+	require.Equal(t, "acme:ws", workspaceClusterName(clusters.ToClusterAwareKey("root:acme", "ws")))
+	require.Equal(t, "a/b/c", workspaceClusterName("a/b/c"), "invalid keys are their own shard key")
+}
+
+func TestShardedQueue(t *testing.T) {
+	q := newShardedQueue("test-sharded-queue", 4)
+	defer q.ShutDown()
+
+	// many workspaces of the same organization are spread over the shards
+	for i := 0; i < 100; i++ {
+		key := clusters.ToClusterAwareKey("root:acme", fmt.Sprintf("ws-%d", i))
+		require.Same(t, q.shardFor(key), q.shardFor(key), "a workspace is always in the same shard")
+		q.Add(key)
+	}
+	for i, shard := range q.shards {
+		require.NotZero(t, shard.Len(), "shard %d is empty", i)
+	}
+
+	// the shards have independent rate limiters
+	key := clusters.ToClusterAwareKey("root:acme", "ws-0")
+	for i := 0; i < 10; i++ {
+		q.shardFor(key).AddRateLimited(key)
+	}
+	for _, shard := range q.shards {
+		if shard != q.shardFor(key) {
+			require.Zero(t, shard.NumRequeues(key))
+		}
+	}
+	require.Equal(t, 10, q.shardFor(key).NumRequeues(key))
+}
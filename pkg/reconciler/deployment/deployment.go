@@ -19,6 +19,7 @@ package deployment
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -153,7 +154,13 @@ func (c *Controller) createLeafs(ctx context.Context, root *appsv1.Deployment) e
 		if vd.Labels == nil {
 			vd.Labels = map[string]string{}
 		}
+		for key := range vd.Labels {
+			if strings.HasPrefix(key, nscontroller.ClusterLabelPrefix) {
+				delete(vd.Labels, key)
+			}
+		}
 		vd.Labels[clusterLabel] = cl.Name
+		vd.Labels[nscontroller.ClusterLabelFor(cl.Name)] = ""
 		vd.Labels[ownedByLabel] = root.Name
 
 		replicasToSet := replicasEach
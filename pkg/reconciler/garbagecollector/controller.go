@@ -0,0 +1,334 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package garbagecollector deletes the objects whose owners are gone, in every logical
+// cluster, including the objects of APIs bound through APIBindings.
+//
+// The ownership graph is built per logical cluster from metadata informers across all
+// logical clusters. Owner references are resolved in the logical cluster of the
+// dependent only: an object of another workspace with the UID of an owner does not keep
+// the dependent alive. Owners missing from the graph, e.g. cluster-scoped owners or owners
+// not informed yet, are looked up before their dependents are deleted.
+package garbagecollector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+const controllerName = "garbage-collector"
+
+type clusterDiscovery interface {
+	WithCluster(name string) discovery.DiscoveryInterface
+}
+
+// NewController returns a garbage collector for all logical clusters. It is to be fed as
+// event handler to metadata informers of all the namespaced resources across logical
+// clusters, see informer.NewMetadataDiscoverySharedInformerFactory.
+func NewController(dynamicClusterClient dynamic.ClusterInterface, disco clusterDiscovery) *Controller {
+	return &Controller{
+		queue:                workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), controllerName),
+		dynamicClusterClient: dynamicClusterClient,
+		mappers: &restMappers{
+			newMapper: func(clusterName string) (meta.RESTMapper, error) {
+				groupResources, err := restmapper.GetAPIGroupResources(disco.WithCluster(clusterName))
+				if err != nil {
+					return nil, err
+				}
+				return restmapper.NewDiscoveryRESTMapper(groupResources), nil
+			},
+			mappers: map[string]meta.RESTMapper{},
+		},
+		nodes:      map[objectReference]*node{},
+		dependents: map[objectReference]map[objectReference]struct{}{},
+	}
+}
+
+// Controller deletes the objects all owners of which are gone, removes the references
+// to owners that are gone from objects with other owners, and handles the orphan and
+// foregroundDeletion finalizers of owners deleted with the Orphan and Foreground
+// propagation policies.
+type Controller struct {
+	queue workqueue.RateLimitingInterface
+
+	dynamicClusterClient dynamic.ClusterInterface
+	mappers              *restMappers
+
+	lock  sync.RWMutex
+	nodes map[objectReference]*node
+	// dependents holds the dependents of every owner, including owners not in the graph.
+	dependents map[objectReference]map[objectReference]struct{}
+}
+
+func (c *Controller) Start(ctx context.Context, numThreads int) {
+	defer runtime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.Info("Starting garbage collector")
+	defer klog.Info("Shutting down garbage collector")
+
+	for i := 0; i < numThreads; i++ {
+		go wait.Until(func() { c.startWorker(ctx) }, time.Second, ctx.Done())
+	}
+
+	<-ctx.Done()
+}
+
+func (c *Controller) startWorker(ctx context.Context) {
+	for c.processNextWorkItem(ctx) {
+	}
+}
+
+func (c *Controller) processNextWorkItem(ctx context.Context) bool {
+	// Wait until there is a new item in the working queue
+	k, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	key := k.(objectReference)
+
+	klog.V(4).Infof("processing key %q", key)
+
+	// No matter what, tell the queue we're done with this key, to unblock
+	// other workers.
+	defer c.queue.Done(key)
+
+	if err := c.process(ctx, key); err != nil {
+		runtime.HandleError(fmt.Errorf("%q controller failed to sync %q, err: %w", controllerName, key, err))
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+func (c *Controller) process(ctx context.Context, ref objectReference) error {
+	n, found := c.node(ref)
+	if !found {
+		return nil
+	}
+
+	if n.deleting {
+		switch {
+		case n.hasFinalizer(metav1.FinalizerOrphanDependents):
+			return c.orphanDependents(ctx, ref, n)
+		case n.hasFinalizer(metav1.FinalizerDeleteDependents):
+			return c.deleteDependents(ctx, ref, n)
+		}
+		return nil
+	}
+
+	if len(n.owners) == 0 {
+		return nil
+	}
+	var remaining []metav1.OwnerReference
+	for _, owner := range n.owners {
+		exists, err := c.ownerExists(ctx, ref.clusterName, n.namespace, owner)
+		if err != nil {
+			return err
+		}
+		if exists {
+			remaining = append(remaining, owner)
+		}
+	}
+	switch {
+	case len(remaining) == len(n.owners):
+		return nil
+	case len(remaining) == 0:
+		klog.Infof("Deleting %s %s|%s/%s whose owners are gone", n.gvr, ref.clusterName, n.namespace, n.name)
+		return c.delete(ctx, ref, n, metav1.DeletePropagationBackground)
+	default:
+		klog.Infof("Removing the references to owners that are gone from %s %s|%s/%s", n.gvr, ref.clusterName, n.namespace, n.name)
+		return c.patchOwners(ctx, ref, n, remaining)
+	}
+}
+
+// ownerExists returns true if the owner of the given reference exists in the given
+// logical cluster. Namespaced owners must be in the namespace of the dependent.
+func (c *Controller) ownerExists(ctx context.Context, clusterName, namespace string, owner metav1.OwnerReference) (bool, error) {
+	if n, found := c.node(objectReference{clusterName: clusterName, uid: owner.UID}); found {
+		return n.namespace == namespace, nil
+	}
+
+	gv, err := schema.ParseGroupVersion(owner.APIVersion)
+	if err != nil {
+		// nolint: nilerr
+		return false, nil // invalid references cannot be resolved, ever
+	}
+	mapping, err := c.mappers.mapping(clusterName, gv.WithKind(owner.Kind))
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve the owner %s %s of logical cluster %s: %w", owner.Kind, owner.Name, clusterName, err)
+	}
+	client := c.dynamicClusterClient.Cluster(clusterName).Resource(mapping.Resource)
+	var resource dynamic.ResourceInterface = client
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		resource = client.Namespace(namespace)
+	}
+	obj, err := resource.Get(ctx, owner.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return obj.GetUID() == owner.UID, nil
+}
+
+// orphanDependents removes the references to the given owner from its dependents, and
+// then the orphan finalizer from the owner.
+func (c *Controller) orphanDependents(ctx context.Context, ref objectReference, n *node) error {
+	for dependentRef, dependent := range c.dependentNodes(ref) {
+		var remaining []metav1.OwnerReference
+		for _, owner := range dependent.owners {
+			if owner.UID != ref.uid {
+				remaining = append(remaining, owner)
+			}
+		}
+		klog.Infof("Orphaning %s %s|%s/%s of deleted owner %s %s|%s/%s", dependent.gvr, dependentRef.clusterName, dependent.namespace, dependent.name, n.gvr, ref.clusterName, n.namespace, n.name)
+		if err := c.patchOwners(ctx, dependentRef, dependent, remaining); err != nil {
+			return err
+		}
+	}
+	return c.removeFinalizer(ctx, ref, n, metav1.FinalizerOrphanDependents)
+}
+
+// deleteDependents deletes the dependents of the given owner, and removes the
+// foregroundDeletion finalizer from the owner once the dependents blocking the deletion
+// of their owner are gone.
+func (c *Controller) deleteDependents(ctx context.Context, ref objectReference, n *node) error {
+	blocking := 0
+	for dependentRef, dependent := range c.dependentNodes(ref) {
+		policy := metav1.DeletePropagationBackground
+		if owner, _ := dependent.ownerReference(ref.uid); owner.BlockOwnerDeletion != nil && *owner.BlockOwnerDeletion {
+			policy = metav1.DeletePropagationForeground
+			blocking++
+		}
+		if dependent.deleting {
+			continue
+		}
+		klog.Infof("Deleting %s %s|%s/%s of owner %s %s|%s/%s deleted in the foreground", dependent.gvr, dependentRef.clusterName, dependent.namespace, dependent.name, n.gvr, ref.clusterName, n.namespace, n.name)
+		if err := c.delete(ctx, dependentRef, dependent, policy); err != nil {
+			return err
+		}
+	}
+	if blocking > 0 {
+		// the deletion of the dependents queues the owner again
+		return nil
+	}
+	return c.removeFinalizer(ctx, ref, n, metav1.FinalizerDeleteDependents)
+}
+
+func (c *Controller) delete(ctx context.Context, ref objectReference, n *node, policy metav1.DeletionPropagation) error {
+	err := c.dynamicClusterClient.Cluster(ref.clusterName).Resource(n.gvr).Namespace(n.namespace).Delete(ctx, n.name, metav1.DeleteOptions{
+		Preconditions:     &metav1.Preconditions{UID: &ref.uid},
+		PropagationPolicy: &policy,
+	})
+	if errors.IsNotFound(err) || errors.IsConflict(err) {
+		// gone already, or replaced by an object of the same name
+		return nil
+	}
+	return err
+}
+
+func (c *Controller) patchOwners(ctx context.Context, ref objectReference, n *node, owners []metav1.OwnerReference) error {
+	if owners == nil {
+		owners = []metav1.OwnerReference{}
+	}
+	return c.patchMetadata(ctx, ref, n, map[string]interface{}{"ownerReferences": owners})
+}
+
+func (c *Controller) removeFinalizer(ctx context.Context, ref objectReference, n *node, finalizer string) error {
+	finalizers := []string{}
+	for _, f := range n.finalizers {
+		if f != finalizer {
+			finalizers = append(finalizers, f)
+		}
+	}
+	return c.patchMetadata(ctx, ref, n, map[string]interface{}{"finalizers": finalizers})
+}
+
+// patchMetadata patches the metadata of the given object, provided it did not change
+// since it was last seen.
+func (c *Controller) patchMetadata(ctx context.Context, ref objectReference, n *node, metadata map[string]interface{}) error {
+	metadata["uid"] = ref.uid
+	metadata["resourceVersion"] = n.resourceVersion
+	patch, err := json.Marshal(map[string]interface{}{"metadata": metadata})
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata patch for %s %s|%s/%s: %w", n.gvr, ref.clusterName, n.namespace, n.name, err)
+	}
+	_, err = c.dynamicClusterClient.Cluster(ref.clusterName).Resource(n.gvr).Namespace(n.namespace).Patch(ctx, n.name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// restMappers caches a RESTMapper per logical cluster, as every workspace serves its own
+// set of APIs.
+type restMappers struct {
+	newMapper func(clusterName string) (meta.RESTMapper, error)
+
+	lock    sync.Mutex
+	mappers map[string]meta.RESTMapper
+}
+
+// mapping returns the mapping of the given kind in the given logical cluster. The mapper
+// of the logical cluster is rebuilt once if the kind is unknown, e.g. because it was
+// bound after the mapper was built.
+func (m *restMappers) mapping(clusterName string, gvk schema.GroupVersionKind) (*meta.RESTMapping, error) {
+	mapper, err := m.mapper(clusterName, false)
+	if err != nil {
+		return nil, err
+	}
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if !meta.IsNoMatchError(err) {
+		return mapping, err
+	}
+	if mapper, err = m.mapper(clusterName, true); err != nil {
+		return nil, err
+	}
+	return mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+}
+
+func (m *restMappers) mapper(clusterName string, refresh bool) (meta.RESTMapper, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if mapper, found := m.mappers[clusterName]; found && !refresh {
+		return mapper, nil
+	}
+	mapper, err := m.newMapper(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	m.mappers[clusterName] = mapper
+	return mapper, nil
+}
@@ -0,0 +1,225 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package garbagecollector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/util/workqueue"
+)
+
+var (
+	configMaps = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	widgetKind = schema.GroupVersionKind{Group: "example.io", Version: "v1", Kind: "Widget"}
+)
+
+// fakeClusterClient serves every logical cluster from its own fake client.
+type fakeClusterClient map[string]*dynamicfake.FakeDynamicClient
+
+func (c fakeClusterClient) Cluster(name string) dynamic.Interface {
+	return c[name]
+}
+
+func configMap(clusterName, name string, uid types.UID, owners ...metav1.OwnerReference) *metav1.PartialObjectMetadata {
+	return &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{
+		ClusterName:     clusterName,
+		Namespace:       "default",
+		Name:            name,
+		UID:             uid,
+		ResourceVersion: "1",
+		OwnerReferences: owners,
+	}}
+}
+
+func ownedBy(name string, uid types.UID) metav1.OwnerReference {
+	return metav1.OwnerReference{APIVersion: "v1", Kind: "ConfigMap", Name: name, UID: uid}
+}
+
+func unstructuredConfigMap(name string, uid types.UID) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion("v1")
+	u.SetKind("ConfigMap")
+	u.SetNamespace("default")
+	u.SetName(name)
+	u.SetUID(uid)
+	return u
+}
+
+func newController(t *testing.T, clients fakeClusterClient) *Controller {
+	c := NewController(clients, nil)
+	c.queue = workqueue.NewRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(time.Millisecond, time.Millisecond))
+	c.mappers.newMapper = func(clusterName string) (meta.RESTMapper, error) {
+		mapper := meta.NewDefaultRESTMapper(nil)
+		mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+		mapper.Add(widgetKind, meta.RESTScopeRoot)
+		return mapper, nil
+	}
+	t.Cleanup(c.queue.ShutDown)
+	return c
+}
+
+func writes(client *dynamicfake.FakeDynamicClient) []clienttesting.Action {
+	var actions []clienttesting.Action
+	for _, action := range client.Actions() {
+		if action.GetVerb() != "get" {
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
+
+func TestProcess(t *testing.T) {
+	t.Run("keeps dependents of owners in the graph", func(t *testing.T) {
+		clients := fakeClusterClient{"org:a": dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())}
+		c := newController(t, clients)
+		c.OnAdd(configMaps, configMap("org:a", "owner", "1"))
+		c.OnAdd(configMaps, configMap("org:a", "dependent", "2", ownedBy("owner", "1")))
+
+		require.NoError(t, c.process(context.Background(), objectReference{"org:a", "2"}))
+		require.Empty(t, clients["org:a"].Actions())
+	})
+
+	t.Run("deletes dependents of owners that are gone", func(t *testing.T) {
+		clients := fakeClusterClient{"org:a": dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), unstructuredConfigMap("dependent", "2"))}
+		c := newController(t, clients)
+		c.OnAdd(configMaps, configMap("org:a", "dependent", "2", ownedBy("owner", "1")))
+
+		require.NoError(t, c.process(context.Background(), objectReference{"org:a", "2"}))
+		actions := writes(clients["org:a"])
+		require.Len(t, actions, 1)
+		require.Equal(t, "delete", actions[0].GetVerb())
+		require.Equal(t, "dependent", actions[0].(clienttesting.DeleteAction).GetName())
+	})
+
+	t.Run("does not follow owner references across workspaces", func(t *testing.T) {
+		clients := fakeClusterClient{
+			"org:a": dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), unstructuredConfigMap("dependent", "2")),
+			"org:b": dynamicfake.NewSimpleDynamicClient(runtime.NewScheme()),
+		}
+		c := newController(t, clients)
+		c.OnAdd(configMaps, configMap("org:b", "owner", "1"))
+		c.OnAdd(configMaps, configMap("org:a", "dependent", "2", ownedBy("owner", "1")))
+
+		require.NoError(t, c.process(context.Background(), objectReference{"org:a", "2"}))
+		actions := writes(clients["org:a"])
+		require.Len(t, actions, 1)
+		require.Equal(t, "delete", actions[0].GetVerb())
+		require.Empty(t, clients["org:b"].Actions())
+	})
+
+	t.Run("removes the references to owners that are gone", func(t *testing.T) {
+		clients := fakeClusterClient{"org:a": dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), unstructuredConfigMap("dependent", "3"))}
+		c := newController(t, clients)
+		c.OnAdd(configMaps, configMap("org:a", "owner", "1"))
+		c.OnAdd(configMaps, configMap("org:a", "dependent", "3", ownedBy("owner", "1"), ownedBy("gone", "2")))
+
+		require.NoError(t, c.process(context.Background(), objectReference{"org:a", "3"}))
+		actions := writes(clients["org:a"])
+		require.Len(t, actions, 1)
+		require.Equal(t, "patch", actions[0].GetVerb())
+		require.JSONEq(t, `{"metadata":{"ownerReferences":[{"apiVersion":"v1","kind":"ConfigMap","name":"owner","uid":"1"}],"resourceVersion":"1","uid":"3"}}`, string(actions[0].(clienttesting.PatchAction).GetPatch()))
+	})
+
+	t.Run("looks up owners not in the graph", func(t *testing.T) {
+		widget := &unstructured.Unstructured{}
+		widget.SetGroupVersionKind(widgetKind)
+		widget.SetName("owner")
+		widget.SetUID("1")
+		clients := fakeClusterClient{"org:a": dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), widget)}
+		c := newController(t, clients)
+		c.OnAdd(configMaps, configMap("org:a", "dependent", "2", metav1.OwnerReference{APIVersion: "example.io/v1", Kind: "Widget", Name: "owner", UID: "1"}))
+
+		require.NoError(t, c.process(context.Background(), objectReference{"org:a", "2"}))
+		require.Empty(t, writes(clients["org:a"]))
+	})
+
+	t.Run("orphans the dependents of owners deleted with the orphan policy", func(t *testing.T) {
+		clients := fakeClusterClient{"org:a": dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), unstructuredConfigMap("owner", "1"), unstructuredConfigMap("dependent", "2"))}
+		c := newController(t, clients)
+		owner := configMap("org:a", "owner", "1")
+		owner.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+		owner.Finalizers = []string{metav1.FinalizerOrphanDependents}
+		c.OnAdd(configMaps, owner)
+		c.OnAdd(configMaps, configMap("org:a", "dependent", "2", ownedBy("owner", "1")))
+
+		require.NoError(t, c.process(context.Background(), objectReference{"org:a", "1"}))
+		actions := writes(clients["org:a"])
+		require.Len(t, actions, 2)
+		require.Equal(t, "dependent", actions[0].(clienttesting.PatchAction).GetName())
+		require.JSONEq(t, `{"metadata":{"ownerReferences":[],"resourceVersion":"1","uid":"2"}}`, string(actions[0].(clienttesting.PatchAction).GetPatch()))
+		require.Equal(t, "owner", actions[1].(clienttesting.PatchAction).GetName())
+		require.JSONEq(t, `{"metadata":{"finalizers":[],"resourceVersion":"1","uid":"1"}}`, string(actions[1].(clienttesting.PatchAction).GetPatch()))
+	})
+
+	t.Run("waits for blocking dependents of owners deleted in the foreground", func(t *testing.T) {
+		clients := fakeClusterClient{"org:a": dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), unstructuredConfigMap("owner", "1"), unstructuredConfigMap("dependent", "2"))}
+		c := newController(t, clients)
+		owner := configMap("org:a", "owner", "1")
+		owner.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+		owner.Finalizers = []string{metav1.FinalizerDeleteDependents}
+		c.OnAdd(configMaps, owner)
+		block := true
+		ref := ownedBy("owner", "1")
+		ref.BlockOwnerDeletion = &block
+		c.OnAdd(configMaps, configMap("org:a", "dependent", "2", ref))
+
+		require.NoError(t, c.process(context.Background(), objectReference{"org:a", "1"}))
+		actions := writes(clients["org:a"])
+		require.Len(t, actions, 1)
+		require.Equal(t, "delete", actions[0].GetVerb())
+
+		c.OnDelete(configMaps, configMap("org:a", "dependent", "2", ref))
+		require.NoError(t, c.process(context.Background(), objectReference{"org:a", "1"}))
+		actions = writes(clients["org:a"])
+		require.Len(t, actions, 2)
+		require.Equal(t, "patch", actions[1].GetVerb())
+		require.Equal(t, "owner", actions[1].(clienttesting.PatchAction).GetName())
+	})
+}
+
+func TestGraph(t *testing.T) {
+	c := newController(t, fakeClusterClient{})
+	c.OnAdd(configMaps, configMap("org:a", "dependent", "2", ownedBy("owner", "1")))
+	require.Equal(t, 1, c.queue.Len())
+	require.Len(t, c.dependentNodes(objectReference{"org:a", "1"}), 1)
+	require.Empty(t, c.dependentNodes(objectReference{"org:b", "1"}))
+
+	// unchanged owners are not queued again
+	c.OnUpdate(configMaps, nil, configMap("org:a", "dependent", "2", ownedBy("owner", "1")))
+	require.Equal(t, 1, c.queue.Len())
+
+	c.OnUpdate(configMaps, nil, configMap("org:a", "dependent", "2"))
+	require.Empty(t, c.dependentNodes(objectReference{"org:a", "1"}))
+
+	c.OnDelete(configMaps, configMap("org:a", "dependent", "2"))
+	_, found := c.node(objectReference{"org:a", "2"})
+	require.False(t, found)
+	require.Empty(t, c.dependents)
+}
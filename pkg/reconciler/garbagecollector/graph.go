@@ -0,0 +1,190 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package garbagecollector
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/kcp-dev/kcp/pkg/informer"
+)
+
+// objectReference identifies an object of the ownership graph. UIDs are only unique
+// within a logical cluster, e.g. objects copied to another workspace keep their UID.
+// Owner references are hence always resolved in the logical cluster of the dependent,
+// never across workspaces.
+type objectReference struct {
+	clusterName string
+	uid         types.UID
+}
+
+func (r objectReference) String() string {
+	return fmt.Sprintf("%s|%s", r.clusterName, r.uid)
+}
+
+// node is an object of the ownership graph.
+type node struct {
+	gvr             schema.GroupVersionResource
+	namespace       string
+	name            string
+	resourceVersion string
+	owners          []metav1.OwnerReference
+	finalizers      []string
+	deleting        bool
+}
+
+func (n *node) hasFinalizer(finalizer string) bool {
+	for _, f := range n.finalizers {
+		if f == finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// ownerReference returns the reference of the node to the owner of the given UID.
+func (n *node) ownerReference(uid types.UID) (metav1.OwnerReference, bool) {
+	for _, owner := range n.owners {
+		if owner.UID == uid {
+			return owner, true
+		}
+	}
+	return metav1.OwnerReference{}, false
+}
+
+var _ informer.GVREventHandler = &Controller{}
+
+func (c *Controller) OnAdd(gvr schema.GroupVersionResource, obj interface{}) {
+	c.updateNode(gvr, obj)
+}
+
+func (c *Controller) OnUpdate(gvr schema.GroupVersionResource, oldObj, newObj interface{}) {
+	c.updateNode(gvr, newObj)
+}
+
+func (c *Controller) OnDelete(gvr schema.GroupVersionResource, obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	metaObj, err := meta.Accessor(obj)
+	if err != nil {
+		runtime.HandleError(fmt.Errorf("failed to remove %s object from the ownership graph: %w", gvr, err))
+		return
+	}
+	ref := objectReference{clusterName: metaObj.GetClusterName(), uid: metaObj.GetUID()}
+
+	c.lock.Lock()
+	n, found := c.nodes[ref]
+	if found {
+		delete(c.nodes, ref)
+		c.removeOwners(ref, n)
+	}
+	dependents := make([]objectReference, 0, len(c.dependents[ref]))
+	for dependent := range c.dependents[ref] {
+		dependents = append(dependents, dependent)
+	}
+	c.lock.Unlock()
+
+	// the dependents might be orphaned now, and the owners waiting for the deletion of
+	// their dependents might be done.
+	for _, dependent := range dependents {
+		c.queue.Add(dependent)
+	}
+	if found {
+		for _, owner := range n.owners {
+			c.queue.Add(objectReference{clusterName: ref.clusterName, uid: owner.UID})
+		}
+	}
+}
+
+func (c *Controller) updateNode(gvr schema.GroupVersionResource, obj interface{}) {
+	metaObj, err := meta.Accessor(obj)
+	if err != nil {
+		runtime.HandleError(fmt.Errorf("failed to add %s object to the ownership graph: %w", gvr, err))
+		return
+	}
+	ref := objectReference{clusterName: metaObj.GetClusterName(), uid: metaObj.GetUID()}
+	n := &node{
+		gvr:             gvr,
+		namespace:       metaObj.GetNamespace(),
+		name:            metaObj.GetName(),
+		resourceVersion: metaObj.GetResourceVersion(),
+		owners:          metaObj.GetOwnerReferences(),
+		finalizers:      metaObj.GetFinalizers(),
+		deleting:        metaObj.GetDeletionTimestamp() != nil,
+	}
+
+	c.lock.Lock()
+	old, found := c.nodes[ref]
+	if found {
+		c.removeOwners(ref, old)
+	}
+	c.nodes[ref] = n
+	for _, owner := range n.owners {
+		ownerRef := objectReference{clusterName: ref.clusterName, uid: owner.UID}
+		if c.dependents[ownerRef] == nil {
+			c.dependents[ownerRef] = map[objectReference]struct{}{}
+		}
+		c.dependents[ownerRef][ref] = struct{}{}
+	}
+	c.lock.Unlock()
+
+	if n.deleting || (len(n.owners) > 0 && (!found || !equality.Semantic.DeepEqual(old.owners, n.owners))) {
+		c.queue.Add(ref)
+	}
+}
+
+// removeOwners removes the edges of the given node to its owners. It must be called
+// with the lock held.
+func (c *Controller) removeOwners(ref objectReference, n *node) {
+	for _, owner := range n.owners {
+		ownerRef := objectReference{clusterName: ref.clusterName, uid: owner.UID}
+		delete(c.dependents[ownerRef], ref)
+		if len(c.dependents[ownerRef]) == 0 {
+			delete(c.dependents, ownerRef)
+		}
+	}
+}
+
+// dependentNodes returns the dependents of the given owner in the graph.
+func (c *Controller) dependentNodes(ref objectReference) map[objectReference]*node {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	dependents := make(map[objectReference]*node, len(c.dependents[ref]))
+	for dependent := range c.dependents[ref] {
+		if n, found := c.nodes[dependent]; found {
+			dependents[dependent] = n
+		}
+	}
+	return dependents
+}
+
+func (c *Controller) node(ref objectReference) (*node, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	n, found := c.nodes[ref]
+	return n, found
+}
@@ -207,7 +207,7 @@ func (c *Controller) desiredLeaves(ctx context.Context, root *networkingv1.Ingre
 	var clusterDests []string
 	for _, service := range services {
 		if service.Labels[clusterLabel] != "" {
-			clusterDests = append(clusterDests, service.Labels[clusterLabel])
+			clusterDests = append(clusterDests, nscontroller.AssignedClusters(service.Labels)...)
 		} else {
 			klog.Infof("Skipping service %q because it is not assigned to any cluster", service.Name)
 		}
@@ -225,6 +225,7 @@ func (c *Controller) desiredLeaves(ctx context.Context, root *networkingv1.Ingre
 
 		vd.Labels = map[string]string{}
 		vd.Labels[clusterLabel] = cl
+		vd.Labels[nscontroller.ClusterLabelFor(cl)] = ""
 
 		// Label the leaf with the rootIngress information, so we can construct the ingress key
 		// from it.
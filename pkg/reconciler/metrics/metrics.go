@@ -0,0 +1,148 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics instruments the workqueues of the workspace-aware controllers with
+// metrics broken out by controller and logical cluster, to find the logical clusters
+// keeping the controllers busy.
+package metrics
+
+import (
+	"sync"
+
+	compbasemetrics "k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+
+	kcpmetrics "github.com/kcp-dev/kcp/pkg/server/metrics"
+)
+
+const (
+	namespace = "kcp"
+	subsystem = "controller"
+
+	// NoCluster is the logical cluster label of the queue keys without a logical cluster.
+	NoCluster = "none"
+)
+
+var (
+	retries = compbasemetrics.NewCounterVec(
+		&compbasemetrics.CounterOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "retries_total",
+			Help:           "Counter of keys requeued after a failed reconciliation, broken out by controller and logical cluster. Logical clusters which are neither allowed nor among the busiest ones are counted as 'other'.",
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+		[]string{"controller", "logical_cluster"},
+	)
+	reconcileDuration = compbasemetrics.NewHistogramVec(
+		&compbasemetrics.HistogramOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "reconcile_duration_seconds",
+			Help:           "Duration distribution in seconds of the reconciliations of keys, from being handed out to a worker until done, broken out by controller and logical cluster.",
+			Buckets:        compbasemetrics.ExponentialBuckets(0.001, 4, 10),
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+		[]string{"controller", "logical_cluster"},
+	)
+	queueDepth = compbasemetrics.NewDesc(
+		compbasemetrics.BuildFQName(namespace, subsystem, "queue_depth"),
+		"Number of keys waiting in the queue to be reconciled, broken out by controller and logical cluster. Keys waiting for a retry backoff are not counted.",
+		[]string{"controller", "logical_cluster"},
+		nil,
+		compbasemetrics.ALPHA,
+		"",
+	)
+)
+
+var (
+	lock sync.Mutex
+	// allowed and topN configure the logical cluster labelers of new controllers.
+	allowed []string
+	topN    = 10
+	// labelers are the logical cluster labelers per controller, shared by its queues.
+	labelers = map[string]*kcpmetrics.ClusterLabeler{}
+	// queues are the instrumented queues, whose depth is collected on scrape.
+	queues []*instrumentedQueue
+
+	registerMetrics sync.Once
+)
+
+// SetClusterLabeling configures the logical clusters broken out in the metrics of the
+// controllers instrumented afterwards: the allowed ones, and the topN other logical
+// clusters with the most reconciliations in the previous minute.
+func SetClusterLabeling(allowedClusters []string, n int) {
+	lock.Lock()
+	defer lock.Unlock()
+	allowed = allowedClusters
+	topN = n
+}
+
+// register registers the controller metrics in the legacy registry, which is served by
+// the apiserver at /metrics.
+func register() {
+	registerMetrics.Do(func() {
+		legacyregistry.MustRegister(retries, reconcileDuration)
+		legacyregistry.CustomMustRegister(&queueDepthCollector{})
+	})
+}
+
+// labelerFor returns the logical cluster labeler of the given controller. lock must be held.
+func labelerFor(controller string) *kcpmetrics.ClusterLabeler {
+	if labeler, ok := labelers[controller]; ok {
+		return labeler
+	}
+	labeler := kcpmetrics.NewClusterLabeler(allowed, topN, func(clusterName string) {
+		labels := map[string]string{"controller": controller, "logical_cluster": clusterName}
+		retries.Delete(labels)
+		reconcileDuration.Delete(labels)
+	})
+	labelers[controller] = labeler
+	return labeler
+}
+
+// queueDepthCollector collects the depth of the instrumented queues when scraped, such
+// that logical clusters changing label or with empty queues leave no stale series.
+type queueDepthCollector struct {
+	compbasemetrics.BaseStableCollector
+}
+
+var _ compbasemetrics.StableCollector = &queueDepthCollector{}
+
+func (c *queueDepthCollector) DescribeWithStability(ch chan<- *compbasemetrics.Desc) {
+	ch <- queueDepth
+}
+
+func (c *queueDepthCollector) CollectWithStability(ch chan<- compbasemetrics.Metric) {
+	lock.Lock()
+	instrumented := append([]*instrumentedQueue(nil), queues...)
+	lock.Unlock()
+
+	// several queues can belong to the same controller
+	type series struct {
+		controller string
+		label      string
+	}
+	depths := map[series]int{}
+	for _, q := range instrumented {
+		for clusterName, depth := range q.depths() {
+			depths[series{controller: q.controller, label: q.labeler.Label(clusterName)}] += depth
+		}
+	}
+	for s, depth := range depths {
+		ch <- compbasemetrics.NewLazyConstMetric(queueDepth, compbasemetrics.GaugeValue, float64(depth), s.controller, s.label)
+	}
+}
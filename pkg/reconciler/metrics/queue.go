@@ -0,0 +1,154 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clusters"
+	"k8s.io/client-go/util/workqueue"
+
+	kcpmetrics "github.com/kcp-dev/kcp/pkg/server/metrics"
+)
+
+// InstrumentQueue returns the given queue of the given controller, recording its depth,
+// retries and reconcile durations by logical cluster. The keys of the queue are expected
+// to be cluster aware object keys, i.e. [<namespace>/]<cluster>#$#<name>.
+func InstrumentQueue(controller string, queue workqueue.RateLimitingInterface) workqueue.RateLimitingInterface {
+	register()
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	q := &instrumentedQueue{
+		RateLimitingInterface: queue,
+		controller:            controller,
+		labeler:               labelerFor(controller),
+		now:                   time.Now,
+		queued:                map[string]sets.String{},
+		processing:            map[interface{}]time.Time{},
+	}
+	queues = append(queues, q)
+	return q
+}
+
+type instrumentedQueue struct {
+	workqueue.RateLimitingInterface
+
+	controller string
+	labeler    *kcpmetrics.ClusterLabeler
+	now        func() time.Time
+
+	lock sync.Mutex
+	// queued are the keys added and not yet handed out to a worker, per logical cluster.
+	queued map[string]sets.String
+	// processing are the times the keys being reconciled were handed out to a worker.
+	processing map[interface{}]time.Time
+}
+
+func (q *instrumentedQueue) Add(item interface{}) {
+	clusterName := clusterOf(item)
+
+	q.lock.Lock()
+	if q.queued[clusterName] == nil {
+		q.queued[clusterName] = sets.NewString()
+	}
+	q.queued[clusterName].Insert(keyOf(item))
+	q.lock.Unlock()
+
+	q.RateLimitingInterface.Add(item)
+}
+
+func (q *instrumentedQueue) Get() (interface{}, bool) {
+	item, shutdown := q.RateLimitingInterface.Get()
+	if shutdown {
+		return item, shutdown
+	}
+
+	clusterName := clusterOf(item)
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if keys := q.queued[clusterName]; keys != nil {
+		keys.Delete(keyOf(item))
+		if keys.Len() == 0 {
+			delete(q.queued, clusterName)
+		}
+	}
+	q.processing[item] = q.now()
+
+	return item, shutdown
+}
+
+func (q *instrumentedQueue) Done(item interface{}) {
+	q.lock.Lock()
+	start, ok := q.processing[item]
+	delete(q.processing, item)
+	q.lock.Unlock()
+
+	if ok {
+		elapsed := q.now().Sub(start)
+		q.labeler.Observe(clusterOf(item), func(label string) {
+			reconcileDuration.WithLabelValues(q.controller, label).Observe(elapsed.Seconds())
+		})
+	}
+
+	q.RateLimitingInterface.Done(item)
+}
+
+func (q *instrumentedQueue) AddRateLimited(item interface{}) {
+	q.labeler.Observe(clusterOf(item), func(label string) {
+		retries.WithLabelValues(q.controller, label).Inc()
+	})
+
+	q.RateLimitingInterface.AddRateLimited(item)
+}
+
+// depths returns the number of queued keys per logical cluster.
+func (q *instrumentedQueue) depths() map[string]int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	depths := make(map[string]int, len(q.queued))
+	for clusterName, keys := range q.queued {
+		depths[clusterName] = keys.Len()
+	}
+	return depths
+}
+
+func keyOf(item interface{}) string {
+	if key, ok := item.(string); ok {
+		return key
+	}
+	return ""
+}
+
+// clusterOf returns the logical cluster of a cluster aware object key, or NoCluster.
+func clusterOf(item interface{}) string {
+	_, clusterAwareName, err := cache.SplitMetaNamespaceKey(keyOf(item))
+	if err != nil {
+		return NoCluster
+	}
+	clusterName, _ := clusters.SplitClusterAwareKey(clusterAwareName)
+	if clusterName == "" {
+		return NoCluster
+	}
+	return clusterName
+}
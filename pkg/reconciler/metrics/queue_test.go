@@ -0,0 +1,58 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/clusters"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestInstrumentedQueueDepths(t *testing.T) {
+	q := InstrumentQueue("test", workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())).(*instrumentedQueue)
+	defer q.ShutDown()
+
+	acme := clusters.ToClusterAwareKey("root:acme", "foo")
+	beta := "default/" + clusters.ToClusterAwareKey("root:beta", "bar")
+
+	q.Add(acme)
+	q.Add(acme)
+	q.Add(beta)
+	q.Add("no-cluster")
+	require.Equal(t, map[string]int{"root:acme": 1, "root:beta": 1, NoCluster: 1}, q.depths())
+
+	item, _ := q.Get()
+	require.Equal(t, acme, item)
+	require.Equal(t, map[string]int{"root:beta": 1, NoCluster: 1}, q.depths())
+	require.Contains(t, q.processing, item)
+
+	// a key added while being processed waits in the queue again
+	q.Add(acme)
+	require.Equal(t, map[string]int{"root:acme": 1, "root:beta": 1, NoCluster: 1}, q.depths())
+
+	q.Done(item)
+	require.NotContains(t, q.processing, item)
+}
+
+func TestClusterOf(t *testing.T) {
+	require.Equal(t, "root:acme", clusterOf(clusters.ToClusterAwareKey("root:acme", "foo")))
+	require.Equal(t, "root:acme", clusterOf("default/"+clusters.ToClusterAwareKey("root:acme", "foo")))
+	require.Equal(t, NoCluster, clusterOf("foo"))
+	require.Equal(t, NoCluster, clusterOf(42))
+}
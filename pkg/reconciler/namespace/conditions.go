@@ -95,9 +95,15 @@ func setScheduledCondition(ns *corev1.Namespace) *corev1.Namespace {
 			"Automatic scheduling is deactivated and can be performed by setting the cluster label manually.")
 	} else if ns.Labels[ClusterLabel] == "" {
 		// Unschedulable
-		conditions.MarkFalse(conditionsAdapter, NamespaceScheduled, NamespaceReasonUnschedulable,
-			conditionsv1alpha1.ConditionSeverityNone, // NamespaceCondition doesn't support severity
-			"No clusters are available to schedule Namespaces to.")
+		if placement := ns.Annotations[PlacementAnnotation]; placement != "" {
+			conditions.MarkFalse(conditionsAdapter, NamespaceScheduled, NamespaceReasonUnschedulable,
+				conditionsv1alpha1.ConditionSeverityNone, // NamespaceCondition doesn't support severity
+				"No clusters are available in the locations of placement %q to schedule Namespaces to.", placement)
+		} else {
+			conditions.MarkFalse(conditionsAdapter, NamespaceScheduled, NamespaceReasonUnschedulable,
+				conditionsv1alpha1.ConditionSeverityNone, // NamespaceCondition doesn't support severity
+				"No clusters are available to schedule Namespaces to.")
+		}
 	} else {
 		conditions.MarkTrue(conditionsAdapter, NamespaceScheduled)
 	}
@@ -23,7 +23,7 @@ import (
 	"time"
 
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/runtime"
@@ -34,6 +34,7 @@ import (
 	coreinformers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
 	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clusters"
 	"k8s.io/client-go/util/workqueue"
@@ -56,14 +57,19 @@ type clusterDiscovery interface {
 func NewController(
 	workspaceLister tenancylisters.ClusterWorkspaceLister,
 	dynClient dynamic.ClusterInterface,
+	metadataClient metadata.Interface,
 	disco clusterDiscovery,
 	clusterInformer workloadinformer.WorkloadClusterInformer,
 	clusterLister workloadlisters.WorkloadClusterLister,
+	placementInformer workloadinformer.PlacementInformer,
+	locationInformer workloadinformer.LocationInformer,
 	namespaceInformer coreinformers.NamespaceInformer,
 	namespaceLister corelisters.NamespaceLister,
 	kubeClient kubernetes.ClusterInterface,
 	gvkTrans *gvk.GVKTranslator,
 	pollInterval time.Duration,
+	unreadyEvictionThreshold time.Duration,
+	evictionGracePeriod time.Duration,
 ) *Controller {
 
 	resourceQueue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "kcp-namespace-resource")
@@ -79,15 +85,29 @@ func NewController(
 
 		dynClient:       dynClient,
 		clusterLister:   clusterLister,
+		placementLister: placementInformer.Lister(),
+		locationLister:  locationInformer.Lister(),
 		namespaceLister: namespaceLister,
 		kubeClient:      kubeClient,
 		gvkTrans:        gvkTrans,
+
+		unreadyEvictionThreshold: unreadyEvictionThreshold,
+		evictionGracePeriod:      evictionGracePeriod,
 	}
 	clusterInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc:    func(obj interface{}) { c.enqueueCluster(obj) },
 		UpdateFunc: func(_, obj interface{}) { c.enqueueCluster(obj) },
 		DeleteFunc: func(obj interface{}) { c.enqueueCluster(obj) },
 	})
+	// Placements and Locations can change the placement of any namespace of their
+	// logical cluster.
+	for _, informer := range []cache.SharedIndexInformer{placementInformer.Informer(), locationInformer.Informer()} {
+		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    func(obj interface{}) { c.enqueueNamespacesOf(obj) },
+			UpdateFunc: func(_, obj interface{}) { c.enqueueNamespacesOf(obj) },
+			DeleteFunc: func(obj interface{}) { c.enqueueNamespacesOf(obj) },
+		})
+	}
 	namespaceInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
 		FilterFunc: filterNamespace,
 		Handler: cache.ResourceEventHandlerFuncs{
@@ -96,8 +116,9 @@ func NewController(
 			DeleteFunc: nil, // Nothing to do.
 		},
 	})
-	// Always do a * list/watch
-	c.ddsif = informer.NewDynamicDiscoverySharedInformerFactory(workspaceLister, disco, dynClient.Cluster("*"),
+	// Always do a * list/watch. Only metadata is needed to schedule resources,
+	// so avoid caching full objects of every type across all logical clusters.
+	c.ddsif = informer.NewMetadataDiscoverySharedInformerFactory(workspaceLister, disco, metadataClient,
 		filterResource,
 		informer.GVREventHandlerFuncs{
 			AddFunc:    func(gvr schema.GroupVersionResource, obj interface{}) { c.enqueueResource(gvr, obj) },
@@ -116,16 +137,21 @@ type Controller struct {
 
 	dynClient       dynamic.ClusterInterface
 	clusterLister   workloadlisters.WorkloadClusterLister
+	placementLister workloadlisters.PlacementLister
+	locationLister  workloadlisters.LocationLister
 	namespaceLister corelisters.NamespaceLister
 	kubeClient      kubernetes.ClusterInterface
 	ddsif           informer.DynamicDiscoverySharedInformerFactory
 	gvkTrans        *gvk.GVKTranslator
+
+	unreadyEvictionThreshold time.Duration
+	evictionGracePeriod      time.Duration
 }
 
 func filterResource(obj interface{}) bool {
-	current, ok := obj.(*unstructured.Unstructured)
+	current, ok := obj.(*metav1.PartialObjectMetadata)
 	if !ok {
-		klog.V(2).Infof("Object was not Unstructured: %T", obj)
+		klog.V(2).Infof("Object was not PartialObjectMetadata: %T", obj)
 		return false
 	}
 
@@ -179,6 +205,38 @@ func (c *Controller) enqueueNamespace(obj interface{}) {
 	c.namespaceQueue.Add(key)
 }
 
+func (c *Controller) enqueueNamespaceAfter(obj interface{}, dur time.Duration) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	c.namespaceQueue.AddAfter(key, dur)
+}
+
+// enqueueNamespacesOf queues all namespaces of the logical cluster of the given object.
+func (c *Controller) enqueueNamespacesOf(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	metaObj, ok := obj.(metav1.Object)
+	if !ok {
+		runtime.HandleError(fmt.Errorf("obj is supposed to be a metav1.Object, but is %T", obj))
+		return
+	}
+	namespaces, err := c.namespaceLister.List(labels.Everything())
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	for _, ns := range namespaces {
+		if ns.ClusterName != metaObj.GetClusterName() || namespaceBlocklist.Has(ns.Name) {
+			continue
+		}
+		c.enqueueNamespace(ns)
+	}
+}
+
 func (c *Controller) enqueueCluster(obj interface{}) {
 	key, err := cache.MetaNamespaceKeyFunc(obj)
 	if err != nil {
@@ -283,12 +341,12 @@ func (c *Controller) processResource(ctx context.Context, key string) error {
 		klog.Infof("object %q does not exist", key)
 		return nil
 	}
-	unstr, ok := obj.(*unstructured.Unstructured)
+	metaObj, ok := obj.(*metav1.PartialObjectMetadata)
 	if !ok {
-		klog.Errorf("object was not Unstructured, dropping: %T", obj)
+		klog.Errorf("object was not PartialObjectMetadata, dropping: %T", obj)
 		return nil
 	}
-	unstr = unstr.DeepCopy()
+	metaObj = metaObj.DeepCopy()
 
 	// Get logical cluster name.
 	_, clusterAwareName, err := cache.SplitMetaNamespaceKey(key)
@@ -297,7 +355,7 @@ func (c *Controller) processResource(ctx context.Context, key string) error {
 		return nil
 	}
 	lclusterName, _ := clusters.SplitClusterAwareKey(clusterAwareName)
-	return c.reconcileResource(ctx, lclusterName, unstr, gvr)
+	return c.reconcileResource(ctx, lclusterName, metaObj, gvr)
 }
 
 func (c *Controller) processGVR(ctx context.Context, gvrstr string) error {
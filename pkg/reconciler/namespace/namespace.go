@@ -28,12 +28,12 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/selection"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/tools/clusters"
 	"k8s.io/klog/v2"
 
@@ -42,10 +42,39 @@ import (
 )
 
 const (
+	// ClusterLabel holds the primary cluster a namespace and its objects are assigned
+	// to. The status of the objects is synced up from this cluster.
 	ClusterLabel            = "workloads.kcp.dev/cluster"
 	SchedulingDisabledLabel = "experimental.workloads.kcp.dev/scheduling-disabled"
+
+	// ClusterLabelPrefix prefixes a label, with an empty value, for every cluster a
+	// namespace and its objects are assigned to, including the primary cluster.
+	// Syncers select the objects to sync with it.
+	ClusterLabelPrefix = "cluster.workloads.kcp.dev/"
+
+	// EvictionAnnotationPrefix prefixes an annotation for every cluster a namespace
+	// and its objects are being evicted from, after it degraded or the namespace was
+	// rescheduled. The value is the RFC3339 time at which the syncer of the cluster
+	// deletes the objects, which keep their cluster label until then so that they
+	// are running on their new clusters before they are removed from the old one.
+	EvictionAnnotationPrefix = "eviction.workloads.kcp.dev/"
 )
 
+// AssignedClusters returns the clusters assigned by the given labels, the primary
+// cluster first.
+func AssignedClusters(lbls map[string]string) []string {
+	if lbls[ClusterLabel] == "" {
+		return nil
+	}
+	return append([]string{lbls[ClusterLabel]}, additionalClusters(lbls)...)
+}
+
+// ClusterLabelFor returns the label set on the namespaces and objects assigned to
+// the given cluster.
+func ClusterLabelFor(workloadClusterName string) string {
+	return ClusterLabelPrefix + workloadClusterName
+}
+
 var (
 	scheduleRequirement           labels.Requirement
 	scheduleEmptyLabelRequirement labels.Requirement
@@ -75,25 +104,25 @@ func init() {
 
 // reconcileResource is responsible for setting the cluster for a resource of
 // any type, to match the cluster where its namespace is assigned.
-func (c *Controller) reconcileResource(ctx context.Context, lclusterName string, unstr *unstructured.Unstructured, gvr *schema.GroupVersionResource) error {
+func (c *Controller) reconcileResource(ctx context.Context, lclusterName string, obj *metav1.PartialObjectMetadata, gvr *schema.GroupVersionResource) error {
 	if gvr.Group == "networking.k8s.io" && gvr.Resource == "ingresses" {
-		klog.V(2).Infof("Skipping reconciliation of ingress %s/%s", unstr.GetNamespace(), unstr.GetName())
+		klog.V(2).Infof("Skipping reconciliation of ingress %s/%s", obj.GetNamespace(), obj.GetName())
 		return nil
 	}
 
-	klog.Infof("Reconciling %s %s|%s/%s", gvr.String(), lclusterName, unstr.GetNamespace(), unstr.GetName())
+	klog.Infof("Reconciling %s %s|%s/%s", gvr.String(), lclusterName, obj.GetNamespace(), obj.GetName())
 
 	// If the resource is not namespaced (incl if the resource is itself a
 	// namespace), ignore it.
-	if unstr.GetNamespace() == "" {
-		klog.V(5).Infof("%s %s|%s had no namespace; ignoring", gvr.String(), unstr.GetClusterName(), unstr.GetName())
+	if obj.GetNamespace() == "" {
+		klog.V(5).Infof("%s %s|%s had no namespace; ignoring", gvr.String(), obj.GetClusterName(), obj.GetName())
 		return nil
 	}
 
 	// Align the resource's assigned cluster with the namespace's assigned
 	// cluster.
 	// First, get the namespace object (from the cached lister).
-	ns, err := c.namespaceLister.Get(clusters.ToClusterAwareKey(lclusterName, unstr.GetNamespace()))
+	ns, err := c.namespaceLister.Get(clusters.ToClusterAwareKey(lclusterName, obj.GetNamespace()))
 	if err != nil {
 		return err
 	}
@@ -105,24 +134,27 @@ func (c *Controller) reconcileResource(ctx context.Context, lclusterName string,
 		return nil
 	}
 
-	lbls := unstr.GetLabels()
+	lbls := obj.GetLabels()
 	if lbls == nil {
 		lbls = map[string]string{}
 	}
+	annotations := obj.GetAnnotations()
 
 	old, new := lbls[ClusterLabel], ns.Labels[ClusterLabel]
-	if old == new {
-		// Already assigned to the right cluster.
+	newEvictions := evictions(ns.Annotations)
+	newAdditional := withoutEvictions(additionalClusters(ns.Labels), newEvictions)
+	if assignmentUpToDate(lbls, annotations, new, newAdditional, newEvictions) {
+		// Already assigned to the right clusters.
 		return nil
 	}
 
 	// Update the resource's assignment.
-	patchType, patchBytes := clusterLabelPatchBytes(new)
+	patchBytes := assignmentPatchBytes(lbls, annotations, new, newAdditional, newEvictions)
 	if _, err = c.dynClient.Cluster(lclusterName).Resource(*gvr).Namespace(ns.Name).
-		Patch(ctx, unstr.GetName(), patchType, patchBytes, metav1.PatchOptions{}); err != nil {
+		Patch(ctx, obj.GetName(), types.MergePatchType, patchBytes, metav1.PatchOptions{}); err != nil {
 		return err
 	}
-	klog.Infof("Patched cluster assignment for %s %s/%s: %q -> %q", gvr, ns.Name, unstr.GetName(), old, new)
+	klog.Infof("Patched cluster assignment for %s %s/%s: %q -> %q, additional clusters %v, evictions %v", gvr, ns.Name, obj.GetName(), old, new, newAdditional, newEvictions)
 
 	return nil
 }
@@ -155,26 +187,159 @@ func (c *Controller) ensureScheduled(ctx context.Context, ns *corev1.Namespace)
 	oldPClusterName := ns.Labels[ClusterLabel]
 
 	scheduler := namespaceScheduler{
-		getCluster:   c.clusterLister.Get,
-		listClusters: c.clusterLister.List,
+		getCluster:               c.clusterLister.Get,
+		listClusters:             c.clusterLister.List,
+		listPlacements:           c.placementLister.List,
+		listLocations:            c.locationLister.List,
+		unreadyEvictionThreshold: c.unreadyEvictionThreshold,
 	}
-	newPClusterName, err := scheduler.AssignCluster(ns)
+	newPClusterName, placementName, err := scheduler.AssignCluster(ns)
+	if err != nil {
+		return err
+	}
+	newAdditionalClusters, err := scheduler.AssignAdditionalClusters(ns, newPClusterName)
 	if err != nil {
 		return err
 	}
 
-	if oldPClusterName == newPClusterName {
+	if oldPlacementName := ns.Annotations[PlacementAnnotation]; oldPlacementName != placementName {
+		klog.Infof("Patching to update placement of namespace %s|%s: %q -> %q",
+			ns.ClusterName, ns.Name, oldPlacementName, placementName)
+		if _, err := c.kubeClient.Cluster(ns.ClusterName).CoreV1().Namespaces().
+			Patch(ctx, ns.Name, types.MergePatchType, placementAnnotationPatchBytes(placementName), metav1.PatchOptions{}); err != nil {
+			return err
+		}
+		if ns.Annotations == nil {
+			ns.Annotations = map[string]string{}
+		}
+		ns.Annotations[PlacementAnnotation] = placementName
+	}
+
+	oldEvictions := evictions(ns.Annotations)
+	oldClusters := withoutEvictions(AssignedClusters(ns.Labels), oldEvictions)
+	newClusters := newAdditionalClusters
+	if newPClusterName != "" {
+		newClusters = append([]string{newPClusterName}, newClusters...)
+	}
+	newEvictions, nextEviction := evictClusters(oldClusters, newClusters, oldEvictions, time.Now(), c.evictionGracePeriod)
+	if nextEviction > 0 {
+		// Remove the evicted clusters from the assignment once their grace period is over.
+		c.enqueueNamespaceAfter(ns, nextEviction)
+	}
+
+	if assignmentUpToDate(ns.Labels, ns.Annotations, newPClusterName, newAdditionalClusters, newEvictions) {
 		return nil
 	}
 
-	klog.Infof("Patching to update cluster assignment for namespace %s|%s: %s -> %s",
-		ns.ClusterName, ns.Name, oldPClusterName, newPClusterName)
-	patchType, patchBytes := clusterLabelPatchBytes(newPClusterName)
+	klog.Infof("Patching to update cluster assignment for namespace %s|%s: %s -> %s, additional clusters %v, evictions %v",
+		ns.ClusterName, ns.Name, oldPClusterName, newPClusterName, newAdditionalClusters, newEvictions)
 	_, err = c.kubeClient.Cluster(ns.ClusterName).CoreV1().Namespaces().
-		Patch(ctx, ns.Name, patchType, patchBytes, metav1.PatchOptions{})
+		Patch(ctx, ns.Name, types.MergePatchType, assignmentPatchBytes(ns.Labels, ns.Annotations, newPClusterName, newAdditionalClusters, newEvictions), metav1.PatchOptions{})
 	return err
 }
 
+// evictions returns the eviction times, by cluster, of the given annotations.
+func evictions(annotations map[string]string) map[string]string {
+	var evictions map[string]string
+	for key, value := range annotations {
+		if name := strings.TrimPrefix(key, EvictionAnnotationPrefix); name != key {
+			if evictions == nil {
+				evictions = map[string]string{}
+			}
+			evictions[name] = value
+		}
+	}
+	return evictions
+}
+
+func withoutEvictions(names []string, evictions map[string]string) []string {
+	var kept []string
+	for _, name := range names {
+		if _, found := evictions[name]; !found {
+			kept = append(kept, name)
+		}
+	}
+	return kept
+}
+
+// evictClusters returns the evictions, by cluster, once a namespace assigned to the
+// old clusters is assigned to the new ones, and the time until the next one is over.
+// The clusters the namespace is not assigned to anymore are evicted at the end of the
+// grace period, or right away without one. Existing evictions are kept until their
+// time is over, or until the namespace is assigned to their cluster again.
+func evictClusters(oldClusters, newClusters []string, existing map[string]string, now time.Time, gracePeriod time.Duration) (map[string]string, time.Duration) {
+	evictions := map[string]string{}
+	var next time.Duration
+	keep := func(name string, evictAt time.Time) {
+		evictions[name] = evictAt.UTC().Format(time.RFC3339)
+		if remaining := evictAt.Sub(now); next == 0 || remaining < next {
+			next = remaining
+		}
+	}
+
+	for name, value := range existing {
+		if containsName(newClusters, name) {
+			continue
+		}
+		evictAt, err := time.Parse(time.RFC3339, value)
+		if err != nil || !evictAt.After(now) {
+			continue
+		}
+		keep(name, evictAt)
+	}
+	if gracePeriod > 0 {
+		for _, name := range oldClusters {
+			if _, found := existing[name]; found || containsName(newClusters, name) {
+				continue
+			}
+			keep(name, now.Add(gracePeriod))
+		}
+	}
+
+	if len(evictions) == 0 {
+		return nil, 0
+	}
+	return evictions, next
+}
+
+// assignmentUpToDate returns whether the given labels and annotations assign the
+// primary and additional clusters, and the evicted ones.
+func assignmentUpToDate(lbls, annotations map[string]string, primary string, additional []string, evicted map[string]string) bool {
+	if lbls[ClusterLabel] != primary {
+		return false
+	}
+	expected := sets.NewString()
+	if primary != "" {
+		expected.Insert(ClusterLabelFor(primary))
+		for _, name := range additional {
+			expected.Insert(ClusterLabelFor(name))
+		}
+	}
+	for name := range evicted {
+		expected.Insert(ClusterLabelFor(name))
+	}
+	actual := sets.NewString()
+	for key := range lbls {
+		if strings.HasPrefix(key, ClusterLabelPrefix) {
+			actual.Insert(key)
+		}
+	}
+	if !expected.Equal(actual) {
+		return false
+	}
+
+	existing := evictions(annotations)
+	if len(existing) != len(evicted) {
+		return false
+	}
+	for name, value := range evicted {
+		if existing[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
 // ensureScheduledStatus ensures the status of the given namespace reflects the
 // namespace's scheduled state.
 func (c *Controller) ensureScheduledStatus(ctx context.Context, ns *corev1.Namespace) error {
@@ -248,23 +413,55 @@ func (c *Controller) reconcileNamespace(ctx context.Context, lclusterName string
 	return nil
 }
 
-// clusterLabelPatchBytes returns JSON patch bytes expressing an operation
-// to add, replace to the given value, or delete the cluster assignment label.
-func clusterLabelPatchBytes(val string) (types.PatchType, []byte) {
+// assignmentPatchBytes returns merge patch bytes updating the given labels and
+// annotations to assign the primary and the additional clusters, or to remove the
+// assignment if the primary cluster is empty. The clusters being evicted stay
+// assigned until their eviction time.
+func assignmentPatchBytes(existingLabels, existingAnnotations map[string]string, primary string, additional []string, evictions map[string]string) []byte {
+	lbls := map[string]interface{}{}
+	for key := range existingLabels {
+		if strings.HasPrefix(key, ClusterLabelPrefix) {
+			lbls[key] = nil
+		}
+	}
+	if primary == "" {
+		lbls[ClusterLabel] = nil
+	} else {
+		lbls[ClusterLabel] = primary
+		for _, name := range append([]string{primary}, additional...) {
+			lbls[ClusterLabelFor(name)] = ""
+		}
+	}
+	annotations := map[string]interface{}{}
+	for key := range existingAnnotations {
+		if strings.HasPrefix(key, EvictionAnnotationPrefix) {
+			annotations[key] = nil
+		}
+	}
+	for name, evictAt := range evictions {
+		lbls[ClusterLabelFor(name)] = ""
+		annotations[EvictionAnnotationPrefix+name] = evictAt
+	}
+
+	metadata := map[string]interface{}{
+		"labels": lbls,
+	}
+	if len(annotations) > 0 {
+		metadata["annotations"] = annotations
+	}
+	patchBytes, _ := json.Marshal(map[string]interface{}{
+		"metadata": metadata,
+	})
+	return patchBytes
+}
+
+// placementAnnotationPatchBytes returns merge patch bytes setting the placement
+// annotation to the given value, or removing it if empty.
+func placementAnnotationPatchBytes(val string) []byte {
 	if val == "" {
-		return types.JSONPatchType,
-			[]byte(fmt.Sprintf(`[{"op": "remove", "path": "/metadata/labels/%s"}]`, strings.ReplaceAll(ClusterLabel, "/", "~1")))
-	}
-
-	return types.MergePatchType,
-		[]byte(fmt.Sprintf(`
-{
-  "metadata":{
-    "labels":{
-      %q: %q
-    }
-  }
-}`, ClusterLabel, val))
+		return []byte(fmt.Sprintf(`{"metadata":{"annotations":{%q:null}}}`, PlacementAnnotation))
+	}
+	return []byte(fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`, PlacementAnnotation, val))
 }
 
 // observeCluster is responsible for watching to see if the Cluster is happy;
@@ -283,6 +480,10 @@ func (c *Controller) observeCluster(ctx context.Context, cl *workloadv1alpha1.Wo
 		dur := time.Until(cl.Spec.EvictAfter.Time)
 		c.enqueueClusterAfter(cl, dur)
 	}
+	if remaining := unreadyEvictionRemaining(cl, c.unreadyEvictionThreshold); remaining > 0 {
+		// The namespaces stay on the unready cluster until the threshold is reached.
+		c.enqueueClusterAfter(cl, remaining)
+	}
 
 	switch strategy {
 	case enqueueUnscheduled:
@@ -291,6 +492,8 @@ func (c *Controller) observeCluster(ctx context.Context, cl *workloadv1alpha1.Wo
 			Add(unscheduledRequirement).Add(scheduleRequirement)))
 		errs = append(errs, c.enqueueNamespaces(ctx, labels.NewSelector().
 			Add(scheduleEmptyLabelRequirement).Add(scheduleRequirement)))
+		// Namespaces placed on several clusters may be missing some of them.
+		errs = append(errs, c.enqueuePlacedNamespaces(ctx))
 		return errors.NewAggregate(errs)
 
 	case enqueueScheduled:
@@ -298,7 +501,14 @@ func (c *Controller) observeCluster(ctx context.Context, cl *workloadv1alpha1.Wo
 		if err != nil {
 			return err
 		}
-		return c.enqueueNamespaces(ctx, labels.NewSelector().Add(*scheduledToCluster))
+		assignedToCluster, err := labels.NewRequirement(ClusterLabelFor(cl.Name), selection.Exists, nil)
+		if err != nil {
+			return err
+		}
+		return errors.NewAggregate([]error{
+			c.enqueueNamespaces(ctx, labels.NewSelector().Add(*scheduledToCluster)),
+			c.enqueueNamespaces(ctx, labels.NewSelector().Add(*assignedToCluster)),
+		})
 
 	case enqueueNothing:
 		break
@@ -327,6 +537,21 @@ func (c *Controller) enqueueNamespaces(ctx context.Context, selector labels.Sele
 	return nil
 }
 
+// enqueuePlacedNamespaces adds all namespaces scheduled by a Placement to the queue.
+func (c *Controller) enqueuePlacedNamespaces(ctx context.Context) error {
+	namespaces, err := c.namespaceLister.ListWithContext(ctx, labels.NewSelector().Add(scheduleRequirement))
+	if err != nil {
+		return err
+	}
+	for _, namespace := range namespaces {
+		if namespace.Annotations[PlacementAnnotation] == "" || namespaceBlocklist.Has(namespace.Name) {
+			continue
+		}
+		c.enqueueNamespace(namespace)
+	}
+	return nil
+}
+
 type clusterEnqueueStrategy int
 
 const (
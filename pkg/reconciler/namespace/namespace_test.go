@@ -105,3 +105,113 @@ func TestEnqueueStrategyForCluster(t *testing.T) {
 	}
 
 }
+
+func TestAssignmentPatchBytes(t *testing.T) {
+	testCases := map[string]struct {
+		existingLabels      map[string]string
+		existingAnnotations map[string]string
+		primary             string
+		additional          []string
+		evictions           map[string]string
+		expected            string
+	}{
+		"assign": {
+			existingLabels: map[string]string{"app": "foo"},
+			primary:        "east",
+			additional:     []string{"west"},
+			expected:       `{"metadata":{"labels":{"cluster.workloads.kcp.dev/east":"","cluster.workloads.kcp.dev/west":"","workloads.kcp.dev/cluster":"east"}}}`,
+		},
+		"reassign": {
+			existingLabels: map[string]string{ClusterLabel: "east", ClusterLabelFor("east"): "", ClusterLabelFor("west"): ""},
+			primary:        "west",
+			expected:       `{"metadata":{"labels":{"cluster.workloads.kcp.dev/east":null,"cluster.workloads.kcp.dev/west":"","workloads.kcp.dev/cluster":"west"}}}`,
+		},
+		"unassign": {
+			existingLabels: map[string]string{ClusterLabel: "east", ClusterLabelFor("east"): ""},
+			expected:       `{"metadata":{"labels":{"cluster.workloads.kcp.dev/east":null,"workloads.kcp.dev/cluster":null}}}`,
+		},
+		"reassign with eviction": {
+			existingLabels: map[string]string{ClusterLabel: "east", ClusterLabelFor("east"): ""},
+			primary:        "west",
+			evictions:      map[string]string{"east": "2022-03-01T10:00:00Z"},
+			expected:       `{"metadata":{"annotations":{"eviction.workloads.kcp.dev/east":"2022-03-01T10:00:00Z"},"labels":{"cluster.workloads.kcp.dev/east":"","cluster.workloads.kcp.dev/west":"","workloads.kcp.dev/cluster":"west"}}}`,
+		},
+		"eviction over": {
+			existingLabels:      map[string]string{ClusterLabel: "west", ClusterLabelFor("east"): "", ClusterLabelFor("west"): ""},
+			existingAnnotations: map[string]string{EvictionAnnotationPrefix + "east": "2022-03-01T10:00:00Z", "app": "foo"},
+			primary:             "west",
+			expected:            `{"metadata":{"annotations":{"eviction.workloads.kcp.dev/east":null},"labels":{"cluster.workloads.kcp.dev/east":null,"cluster.workloads.kcp.dev/west":"","workloads.kcp.dev/cluster":"west"}}}`,
+		},
+	}
+	for testName, testCase := range testCases {
+		t.Run(testName, func(t *testing.T) {
+			patchBytes := assignmentPatchBytes(testCase.existingLabels, testCase.existingAnnotations, testCase.primary, testCase.additional, testCase.evictions)
+			require.Equal(t, testCase.expected, string(patchBytes))
+		})
+	}
+}
+
+func TestEvictClusters(t *testing.T) {
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	testCases := map[string]struct {
+		oldClusters  []string
+		newClusters  []string
+		existing     map[string]string
+		gracePeriod  time.Duration
+		expected     map[string]string
+		nextEviction time.Duration
+	}{
+		"unchanged": {
+			oldClusters: []string{"east"},
+			newClusters: []string{"east"},
+			gracePeriod: time.Minute,
+		},
+		"rescheduled without grace period": {
+			oldClusters: []string{"east"},
+			newClusters: []string{"west"},
+		},
+		"rescheduled": {
+			oldClusters:  []string{"east"},
+			newClusters:  []string{"west"},
+			gracePeriod:  time.Minute,
+			expected:     map[string]string{"east": "2022-03-01T10:01:00Z"},
+			nextEviction: time.Minute,
+		},
+		"evicting": {
+			newClusters:  []string{"west"},
+			existing:     map[string]string{"east": "2022-03-01T10:00:30Z"},
+			gracePeriod:  time.Minute,
+			expected:     map[string]string{"east": "2022-03-01T10:00:30Z"},
+			nextEviction: 30 * time.Second,
+		},
+		"eviction over": {
+			newClusters: []string{"west"},
+			existing:    map[string]string{"east": "2022-03-01T09:59:00Z"},
+			gracePeriod: time.Minute,
+		},
+		"invalid eviction": {
+			newClusters: []string{"west"},
+			existing:    map[string]string{"east": "soon"},
+			gracePeriod: time.Minute,
+		},
+		"rescheduled back": {
+			newClusters: []string{"east"},
+			existing:    map[string]string{"east": "2022-03-01T10:00:30Z"},
+			gracePeriod: time.Minute,
+		},
+		"unassigned": {
+			oldClusters:  []string{"east", "west"},
+			gracePeriod:  time.Minute,
+			expected:     map[string]string{"east": "2022-03-01T10:01:00Z", "west": "2022-03-01T10:01:00Z"},
+			nextEviction: time.Minute,
+		},
+	}
+	for testName, testCase := range testCases {
+		t.Run(testName, func(t *testing.T) {
+			evictions, nextEviction := evictClusters(testCase.oldClusters, testCase.newClusters, testCase.existing, now, testCase.gracePeriod)
+			require.Equal(t, testCase.expected, evictions)
+			require.Equal(t, testCase.nextEviction, nextEviction)
+		})
+	}
+}
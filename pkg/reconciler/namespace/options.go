@@ -0,0 +1,55 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespace
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// DefaultOptions are the default options for the namespace scheduler.
+func DefaultOptions() *Options {
+	return &Options{
+		UnreadyEvictionThreshold: time.Minute,
+		EvictionGracePeriod:      30 * time.Second,
+	}
+}
+
+// BindOptions binds the namespace scheduler options to the flag set.
+func BindOptions(o *Options, fs *pflag.FlagSet) *Options {
+	fs.DurationVar(&o.UnreadyEvictionThreshold, "workload-cluster-unready-eviction-threshold", o.UnreadyEvictionThreshold, "Amount of time a workload cluster must be not ready before its namespaces are rescheduled to other clusters")
+	fs.DurationVar(&o.EvictionGracePeriod, "namespace-eviction-grace-period", o.EvictionGracePeriod, "Amount of time a rescheduled namespace keeps running on the cluster it is evicted from, before its objects are deleted from it")
+	return o
+}
+
+// Options are the options for the namespace scheduler.
+type Options struct {
+	UnreadyEvictionThreshold time.Duration
+	EvictionGracePeriod      time.Duration
+}
+
+func (o *Options) Validate() error {
+	if o.UnreadyEvictionThreshold < 0 {
+		return fmt.Errorf("--workload-cluster-unready-eviction-threshold must not be negative")
+	}
+	if o.EvictionGracePeriod < 0 {
+		return fmt.Errorf("--namespace-eviction-grace-period must not be negative")
+	}
+	return nil
+}
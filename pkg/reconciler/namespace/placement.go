@@ -0,0 +1,315 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespace
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+)
+
+// PlacementAnnotation records the name of the Placement a namespace has been
+// scheduled by.
+const PlacementAnnotation = "workloads.kcp.dev/placement"
+
+type listPlacementsFunc func(selector labels.Selector) ([]*workloadv1alpha1.Placement, error)
+type listLocationsFunc func(selector labels.Selector) ([]*workloadv1alpha1.Location, error)
+
+// placementFor returns the Placement of the namespace's logical cluster that
+// selects the namespace, or nil if there is none. If several placements select
+// the namespace, the first one by name wins.
+func (s *namespaceScheduler) placementFor(ns *corev1.Namespace) (*workloadv1alpha1.Placement, error) {
+	if s.listPlacements == nil {
+		return nil, nil
+	}
+	placements, err := s.listPlacements(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []*workloadv1alpha1.Placement
+	for _, placement := range placements {
+		if placement.ClusterName != ns.ClusterName {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(placement.Spec.NamespaceSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid namespace selector of Placement %s|%s: %w", placement.ClusterName, placement.Name, err)
+		}
+		if selector.Matches(labels.Set(ns.Labels)) {
+			candidates = append(candidates, placement)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Name < candidates[j].Name
+	})
+	return candidates[0], nil
+}
+
+// placedClusters filters the given clusters down to those belonging to a Location
+// selected by the placement, and returns the labels of the Location of each of them.
+// Locations and clusters must be in the logical cluster of the placement.
+func (s *namespaceScheduler) placedClusters(placement *workloadv1alpha1.Placement, allClusters []*workloadv1alpha1.WorkloadCluster) ([]*workloadv1alpha1.WorkloadCluster, map[string]labels.Set, error) {
+	locations, err := s.listLocations(labels.Everything())
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Slice(locations, func(i, j int) bool {
+		return locations[i].Name < locations[j].Name
+	})
+
+	type selectedLocation struct {
+		instanceSelector labels.Selector
+		labels           labels.Set
+	}
+	var selectedLocations []selectedLocation
+	for _, location := range locations {
+		if location.ClusterName != placement.ClusterName {
+			continue
+		}
+		selected := false
+		for i := range placement.Spec.LocationSelectors {
+			selector, err := metav1.LabelSelectorAsSelector(&placement.Spec.LocationSelectors[i])
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid location selector of Placement %s|%s: %w", placement.ClusterName, placement.Name, err)
+			}
+			if selector.Matches(labels.Set(location.Labels)) {
+				selected = true
+				break
+			}
+		}
+		if !selected {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(location.Spec.InstanceSelector)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid instance selector of Location %s|%s: %w", location.ClusterName, location.Name, err)
+		}
+		selectedLocations = append(selectedLocations, selectedLocation{instanceSelector: selector, labels: labels.Set(location.Labels)})
+	}
+
+	var placed []*workloadv1alpha1.WorkloadCluster
+	locationLabels := map[string]labels.Set{}
+	for _, cluster := range allClusters {
+		if cluster.ClusterName != placement.ClusterName {
+			continue
+		}
+		for _, location := range selectedLocations {
+			if location.instanceSelector.Matches(labels.Set(cluster.Labels)) {
+				placed = append(placed, cluster)
+				locationLabels[cluster.Name] = location.labels
+				break
+			}
+		}
+	}
+	return placed, locationLabels, nil
+}
+
+// numberOfClusters returns the number of clusters the placement places namespaces on.
+func numberOfClusters(placement *workloadv1alpha1.Placement) int {
+	if placement == nil || placement.Spec.NumberOfClusters == nil || *placement.Spec.NumberOfClusters < 1 {
+		return 1
+	}
+	return int(*placement.Spec.NumberOfClusters)
+}
+
+// AssignAdditionalClusters returns the clusters to assign to the namespace on top of
+// its primary cluster, when the Placement of the namespace asks for more than one
+// cluster. The current additional clusters are kept while they are valid, and new
+// ones are picked according to the spread constraints of the placement.
+func (s *namespaceScheduler) AssignAdditionalClusters(ns *corev1.Namespace, primaryCluster string) ([]string, error) {
+	// Clusters the namespace is being evicted from are not assigned anymore.
+	evicting := evictions(ns.Annotations)
+	var currentClusters []string
+	for _, name := range additionalClusters(ns.Labels) {
+		if _, found := evicting[name]; !found {
+			currentClusters = append(currentClusters, name)
+		}
+	}
+
+	if !scheduleRequirement.Matches(labels.Set(ns.Labels)) {
+		return currentClusters, nil
+	}
+	if primaryCluster == "" {
+		return nil, nil
+	}
+	placement, err := s.placementFor(ns)
+	if err != nil {
+		return nil, err
+	}
+	wanted := numberOfClusters(placement) - 1
+	if wanted == 0 {
+		return nil, nil
+	}
+
+	allClusters, err := s.listClusters(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	placed, locationLabels, err := s.placedClusters(placement, allClusters)
+	if err != nil {
+		return nil, err
+	}
+
+	var kept []string
+	for _, name := range currentClusters {
+		if name == primaryCluster || !containsCluster(placed, name) {
+			continue
+		}
+		isValid, invalidMsg, err := s.isValidCluster(ns.ClusterName, name)
+		if err != nil {
+			return nil, err
+		}
+		if !isValid {
+			klog.V(5).Infof("Cluster %s|%s %s", ns.ClusterName, name, invalidMsg)
+			continue
+		}
+		kept = append(kept, name)
+	}
+
+	var candidates []*workloadv1alpha1.WorkloadCluster
+	for _, cluster := range schedulableClusters(placed, ns.ClusterName) {
+		if cluster.Name != primaryCluster {
+			candidates = append(candidates, cluster)
+		}
+	}
+
+	return spreadClusters(append([]string{primaryCluster}, kept...), candidates, locationLabels, placement.Spec.SpreadConstraints, wanted+1)[1:], nil
+}
+
+// spreadClusters adds clusters from the candidates to the assigned ones until there
+// are the given number of them, or no candidate satisfies the spread constraints. The
+// candidate in the least used domains of the topologies is added first.
+func spreadClusters(assigned []string, candidates []*workloadv1alpha1.WorkloadCluster, locationLabels map[string]labels.Set, constraints []workloadv1alpha1.SpreadConstraint, number int) []string {
+	domainsOf := func(clusterName string) ([]string, bool) {
+		var domains []string
+		for _, constraint := range constraints {
+			domain, ok := locationLabels[clusterName][constraint.TopologyKey]
+			if !ok {
+				return nil, false
+			}
+			domains = append(domains, domain)
+		}
+		return domains, true
+	}
+
+	// counts holds the number of assigned clusters per domain of every topology, including
+	// the domains of the candidates without any assigned cluster yet.
+	counts := make([]map[string]int, len(constraints))
+	for i := range constraints {
+		counts[i] = map[string]int{}
+	}
+	for _, cluster := range candidates {
+		if domains, ok := domainsOf(cluster.Name); ok {
+			for i, domain := range domains {
+				counts[i][domain] += 0
+			}
+		}
+	}
+	for _, name := range assigned {
+		if domains, ok := domainsOf(name); ok {
+			for i, domain := range domains {
+				counts[i][domain]++
+			}
+		}
+	}
+
+	sorted := make([]*workloadv1alpha1.WorkloadCluster, len(candidates))
+	copy(sorted, candidates)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	result := append([]string(nil), assigned...)
+	for len(result) < number {
+		best, bestScore := "", -1
+		for _, cluster := range sorted {
+			if containsName(result, cluster.Name) {
+				continue
+			}
+			domains, ok := domainsOf(cluster.Name)
+			if !ok {
+				continue
+			}
+			score, admissible := 0, true
+			for i, domain := range domains {
+				min := -1
+				for _, count := range counts[i] {
+					if min == -1 || count < min {
+						min = count
+					}
+				}
+				if counts[i][domain]+1-min > int(maxSkew(constraints[i])) {
+					admissible = false
+					break
+				}
+				score += counts[i][domain]
+			}
+			if admissible && (bestScore == -1 || score < bestScore) {
+				best, bestScore = cluster.Name, score
+			}
+		}
+		if best == "" {
+			break
+		}
+		result = append(result, best)
+		domains, _ := domainsOf(best)
+		for i, domain := range domains {
+			counts[i][domain]++
+		}
+	}
+	return result
+}
+
+func maxSkew(constraint workloadv1alpha1.SpreadConstraint) int32 {
+	if constraint.MaxSkew < 1 {
+		return 1
+	}
+	return constraint.MaxSkew
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// additionalClusters returns the clusters assigned by the given labels, apart from
+// the primary cluster.
+func additionalClusters(lbls map[string]string) []string {
+	var names []string
+	for key := range lbls {
+		if name := strings.TrimPrefix(key, ClusterLabelPrefix); name != key && name != lbls[ClusterLabel] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
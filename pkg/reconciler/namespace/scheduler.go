@@ -17,6 +17,7 @@ limitations under the License.
 package namespace
 
 import (
+	"fmt"
 	"math/rand"
 	"time"
 
@@ -36,43 +37,80 @@ type listClustersFunc func(selector labels.Selector) ([]*workloadv1alpha1.Worklo
 type namespaceScheduler struct {
 	getCluster   getClusterFunc
 	listClusters listClustersFunc
+
+	listPlacements listPlacementsFunc
+	listLocations  listLocationsFunc
+
+	// unreadyEvictionThreshold is how long a cluster can be not ready before the
+	// namespaces assigned to it are rescheduled.
+	unreadyEvictionThreshold time.Duration
 }
 
 // AssignCluster returns the name of the cluster to assign to the provided
-// namespace. The current cluster assignment will be returned if it is valid or if
+// namespace, and the name of the Placement the decision was made by, if any.
+// The current cluster assignment will be returned if it is valid or if
 // the automatic scheduling is disabled for the namespace. An new assignment will
-// be attempted if the current assignment is empty or invalid.
-func (s *namespaceScheduler) AssignCluster(ns *corev1.Namespace) (string, error) {
+// be attempted if the current assignment is empty or invalid. When a Placement
+// selects the namespace, only the clusters of its Locations are valid.
+func (s *namespaceScheduler) AssignCluster(ns *corev1.Namespace) (string, string, error) {
 	assignedCluster := ns.Labels[ClusterLabel]
 
 	schedulingDisabled := !scheduleRequirement.Matches(labels.Set(ns.Labels))
 	if schedulingDisabled {
 		klog.Infof("Automatic scheduling is disabled for namespace %s|%s", ns.ClusterName, ns.Name)
-		return assignedCluster, nil
+		return assignedCluster, ns.Annotations[PlacementAnnotation], nil
+	}
+
+	placement, err := s.placementFor(ns)
+	if err != nil {
+		return "", "", err
+	}
+	placementName := ""
+	if placement != nil {
+		placementName = placement.Name
+	}
+
+	allClusters, err := s.listClusters(labels.Everything())
+	if err != nil {
+		return "", "", err
+	}
+	if placement != nil {
+		if allClusters, _, err = s.placedClusters(placement, allClusters); err != nil {
+			return "", "", err
+		}
 	}
 
 	if assignedCluster != "" {
 		isValid, invalidMsg, err := s.isValidCluster(ns.ClusterName, assignedCluster)
 		if err != nil {
-			return "", err
+			return "", "", err
+		}
+		if isValid && placement != nil && !containsCluster(allClusters, assignedCluster) {
+			isValid, invalidMsg = false, fmt.Sprintf("is not in the locations of placement %q", placement.Name)
 		}
 		if isValid {
-			return assignedCluster, nil
+			return assignedCluster, placementName, nil
 		}
 		// A new cluster needs to be assigned
 		klog.V(5).Infof("Cluster %s|%s %s", ns.ClusterName, assignedCluster, invalidMsg)
 	}
 
-	allClusters, err := s.listClusters(labels.Everything())
-	if err != nil {
-		return "", err
+	return pickCluster(allClusters, ns.ClusterName), placementName, nil
+}
+
+func containsCluster(clusters []*workloadv1alpha1.WorkloadCluster, name string) bool {
+	for _, cluster := range clusters {
+		if cluster.Name == name {
+			return true
+		}
 	}
-	return pickCluster(allClusters, ns.ClusterName), nil
+	return false
 }
 
 // isValidCluster checks whether the given cluster name exists and is valid for
 // the purposes of any namespace already scheduled to it (i.e., if it reports
-// as Ready, and any evictAfter value, if specified, has not yet passed).
+// as Ready or has not been unready for longer than the eviction threshold, and
+// any evictAfter value, if specified, has not yet passed).
 //
 // It doesn't take into account Unschedulable, and should only be used when
 // determining if a cluster that a namespace has already been assigned to
@@ -88,7 +126,8 @@ func (s *namespaceScheduler) isValidCluster(lclusterName, clusterName string) (
 		return false, "", err
 	}
 	// TODO(marun) Stop duplicating these checks here and in pickCluster
-	if ready := conditions.IsTrue(cluster, workloadv1alpha1.WorkloadClusterReadyCondition); !ready {
+	if ready := conditions.IsTrue(cluster, workloadv1alpha1.WorkloadClusterReadyCondition); !ready &&
+		unreadyEvictionRemaining(cluster, s.unreadyEvictionThreshold) <= 0 {
 		return false, "is not reporting ready", nil
 	}
 	if evictAfter := cluster.Spec.EvictAfter; evictAfter != nil && evictAfter.Time.Before(time.Now()) {
@@ -97,11 +136,44 @@ func (s *namespaceScheduler) isValidCluster(lclusterName, clusterName string) (
 	return true, "", nil
 }
 
+// unreadyEvictionRemaining returns how long the namespaces assigned to the given
+// cluster are kept on it while it is not ready. It returns zero for a ready cluster,
+// or if the namespaces have to be rescheduled.
+func unreadyEvictionRemaining(cluster *workloadv1alpha1.WorkloadCluster, threshold time.Duration) time.Duration {
+	if threshold <= 0 || conditions.IsTrue(cluster, workloadv1alpha1.WorkloadClusterReadyCondition) {
+		return 0
+	}
+	ready := conditions.Get(cluster, workloadv1alpha1.WorkloadClusterReadyCondition)
+	if ready == nil {
+		// The cluster has never been ready.
+		return 0
+	}
+	if remaining := time.Until(ready.LastTransitionTime.Add(threshold)); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
 // pickCluster attempts to choose a cluster in the given logical
 // cluster to assign to a namespace. If a suitable cluster is
 // identified, its name will be returned. Otherwise, an empty string
 // will be returned.
 func pickCluster(allClusters []*workloadv1alpha1.WorkloadCluster, lclusterName string) string {
+	clusters := schedulableClusters(allClusters, lclusterName)
+
+	newClusterName := ""
+	if len(clusters) > 0 {
+		// Select a cluster at random.
+		cluster := clusters[rand.Intn(len(clusters))]
+		newClusterName = cluster.Name
+	}
+
+	return newClusterName
+}
+
+// schedulableClusters returns the clusters of the given logical cluster new
+// namespaces can be assigned to.
+func schedulableClusters(allClusters []*workloadv1alpha1.WorkloadCluster, lclusterName string) []*workloadv1alpha1.WorkloadCluster {
 	var clusters []*workloadv1alpha1.WorkloadCluster
 	for i := range allClusters {
 		// Only include Clusters that are in the logical cluster
@@ -127,13 +199,5 @@ func pickCluster(allClusters []*workloadv1alpha1.WorkloadCluster, lclusterName s
 		klog.V(2).InfoS("pickCluster: found a ready candidate", "metadata.name", allClusters[i].Name)
 		clusters = append(clusters, allClusters[i])
 	}
-
-	newClusterName := ""
-	if len(clusters) > 0 {
-		// Select a cluster at random.
-		cluster := clusters[rand.Intn(len(clusters))]
-		newClusterName = cluster.Name
-	}
-
-	return newClusterName
+	return clusters
 }
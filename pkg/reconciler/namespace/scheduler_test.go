@@ -29,6 +29,7 @@ import (
 	clustertools "k8s.io/client-go/tools/clusters"
 
 	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+	conditionsv1alpha1 "github.com/kcp-dev/kcp/third_party/conditions/apis/conditions/v1alpha1"
 	"github.com/kcp-dev/kcp/third_party/conditions/util/conditions"
 )
 
@@ -69,6 +70,16 @@ func (f *clusterFixture) withReady() *clusterFixture {
 	return f
 }
 
+func (f *clusterFixture) withUnreadySince(since time.Time) *clusterFixture {
+	conditions.MarkFalse(f.cluster, workloadv1alpha1.WorkloadClusterReadyCondition, "Unreachable", conditionsv1alpha1.ConditionSeverityError, "")
+	clusterConditions := f.cluster.GetConditions()
+	for i := range clusterConditions {
+		clusterConditions[i].LastTransitionTime = metav1.NewTime(since)
+	}
+	f.cluster.SetConditions(clusterConditions)
+	return f
+}
+
 func (f *clusterFixture) withUnscheduable() *clusterFixture {
 	f.cluster.Spec.Unschedulable = true
 	return f
@@ -151,22 +162,303 @@ func TestAssignCluster(t *testing.T) {
 					Labels:      testCase.labels,
 				},
 			}
-			clusterName, err := scheduler.AssignCluster(ns)
+			clusterName, placementName, err := scheduler.AssignCluster(ns)
+			require.NoError(t, err)
+			require.Equal(t, testCase.expectedCluster, clusterName)
+			require.Empty(t, placementName)
+		})
+	}
+}
+
+func TestAssignClusterWithPlacement(t *testing.T) {
+	eastCluster := defaultClusterFixture().withReady().cluster
+	eastCluster.Labels = map[string]string{"region": "us-east1"}
+	westCluster := otherClusterFixture().withReady().cluster
+	westCluster.Labels = map[string]string{"region": "us-west1"}
+
+	locations := []*workloadv1alpha1.Location{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "east", ClusterName: testLclusterName, Labels: map[string]string{"geo": "east"}},
+			Spec: workloadv1alpha1.LocationSpec{
+				InstanceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"region": "us-east1"}},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "west", ClusterName: testLclusterName, Labels: map[string]string{"geo": "west"}},
+			Spec: workloadv1alpha1.LocationSpec{
+				InstanceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"region": "us-west1"}},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "elsewhere", ClusterName: otherTestLclusterName, Labels: map[string]string{"geo": "nowhere"}},
+			Spec: workloadv1alpha1.LocationSpec{
+				InstanceSelector: &metav1.LabelSelector{},
+			},
+		},
+	}
+	placement := func(name, lclusterName string, namespaceSelector *metav1.LabelSelector, geo string) *workloadv1alpha1.Placement {
+		return &workloadv1alpha1.Placement{
+			ObjectMeta: metav1.ObjectMeta{Name: name, ClusterName: lclusterName},
+			Spec: workloadv1alpha1.PlacementSpec{
+				NamespaceSelector: namespaceSelector,
+				LocationSelectors: []metav1.LabelSelector{{MatchLabels: map[string]string{"geo": geo}}},
+			},
+		}
+	}
+
+	testCases := map[string]struct {
+		placements        []*workloadv1alpha1.Placement
+		labels            map[string]string
+		expectedCluster   string
+		expectedPlacement string
+	}{
+		"placement selecting the namespace -> cluster of its location": {
+			placements:        []*workloadv1alpha1.Placement{placement("west", testLclusterName, &metav1.LabelSelector{}, "west")},
+			expectedCluster:   otherTestClusterName,
+			expectedPlacement: "west",
+		},
+		"assignment outside of placement -> new assignment": {
+			placements:        []*workloadv1alpha1.Placement{placement("east", testLclusterName, &metav1.LabelSelector{}, "east")},
+			labels:            map[string]string{ClusterLabel: otherTestClusterName},
+			expectedCluster:   testClusterName,
+			expectedPlacement: "east",
+		},
+		"placement without namespace selector -> any cluster": {
+			placements:      []*workloadv1alpha1.Placement{placement("west", testLclusterName, nil, "west")},
+			labels:          map[string]string{ClusterLabel: testClusterName},
+			expectedCluster: testClusterName,
+		},
+		"placement of another logical cluster -> ignored": {
+			placements:      []*workloadv1alpha1.Placement{placement("west", otherTestLclusterName, &metav1.LabelSelector{}, "west")},
+			labels:          map[string]string{ClusterLabel: testClusterName},
+			expectedCluster: testClusterName,
+		},
+		"several placements -> first by name": {
+			placements: []*workloadv1alpha1.Placement{
+				placement("b-west", testLclusterName, &metav1.LabelSelector{}, "west"),
+				placement("a-east", testLclusterName, &metav1.LabelSelector{}, "east"),
+			},
+			expectedCluster:   testClusterName,
+			expectedPlacement: "a-east",
+		},
+		"placement without matching locations -> unschedulable": {
+			placements:        []*workloadv1alpha1.Placement{placement("nowhere", testLclusterName, &metav1.LabelSelector{}, "nowhere")},
+			expectedPlacement: "nowhere",
+		},
+	}
+	for testName, testCase := range testCases {
+		t.Run(testName, func(t *testing.T) {
+			scheduler := newTestScheduler([]*workloadv1alpha1.WorkloadCluster{eastCluster, westCluster})
+			scheduler.listPlacements = func(selector labels.Selector) ([]*workloadv1alpha1.Placement, error) {
+				return testCase.placements, nil
+			}
+			scheduler.listLocations = func(selector labels.Selector) ([]*workloadv1alpha1.Location, error) {
+				return locations, nil
+			}
+			ns := &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					ClusterName: testLclusterName,
+					Labels:      testCase.labels,
+				},
+			}
+			clusterName, placementName, err := scheduler.AssignCluster(ns)
 			require.NoError(t, err)
 			require.Equal(t, testCase.expectedCluster, clusterName)
+			require.Equal(t, testCase.expectedPlacement, placementName)
+		})
+	}
+}
+
+func TestSpreadClusters(t *testing.T) {
+	cluster := func(name string) *workloadv1alpha1.WorkloadCluster {
+		return &workloadv1alpha1.WorkloadCluster{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	}
+	candidates := []*workloadv1alpha1.WorkloadCluster{cluster("east-a"), cluster("east-b"), cluster("west-a"), cluster("west-b"), cluster("unknown")}
+	locationLabels := map[string]labels.Set{
+		"east-a":  {"region": "east", "zone": "a"},
+		"east-b":  {"region": "east", "zone": "b"},
+		"west-a":  {"region": "west", "zone": "a"},
+		"west-b":  {"region": "west", "zone": "b"},
+		"unknown": {},
+	}
+	byRegion := []workloadv1alpha1.SpreadConstraint{{TopologyKey: "region", MaxSkew: 1}}
+
+	testCases := map[string]struct {
+		assigned    []string
+		constraints []workloadv1alpha1.SpreadConstraint
+		number      int
+		expected    []string
+	}{
+		"no constraint -> by name": {
+			assigned: []string{"east-a"},
+			number:   3,
+			expected: []string{"east-a", "east-b", "unknown"},
+		},
+		"spread over regions": {
+			assigned:    []string{"east-a"},
+			constraints: byRegion,
+			number:      2,
+			expected:    []string{"east-a", "west-a"},
+		},
+		"spread over regions and zones": {
+			assigned:    []string{"east-a"},
+			constraints: append(byRegion, workloadv1alpha1.SpreadConstraint{TopologyKey: "zone", MaxSkew: 1}),
+			number:      2,
+			expected:    []string{"east-a", "west-b"},
+		},
+		"more clusters than regions": {
+			assigned:    []string{"east-a"},
+			constraints: byRegion,
+			number:      4,
+			expected:    []string{"east-a", "west-a", "east-b", "west-b"},
+		},
+		"clusters without the topology label are excluded": {
+			assigned:    []string{"east-a"},
+			constraints: byRegion,
+			number:      5,
+			expected:    []string{"east-a", "west-a", "east-b", "west-b"},
+		},
+		"larger skew allowed": {
+			assigned:    []string{"east-a"},
+			constraints: []workloadv1alpha1.SpreadConstraint{{TopologyKey: "region", MaxSkew: 2}},
+			number:      3,
+			expected:    []string{"east-a", "west-a", "east-b"},
+		},
+		"assigned clusters are kept": {
+			assigned:    []string{"east-a", "east-b"},
+			constraints: byRegion,
+			number:      3,
+			expected:    []string{"east-a", "east-b", "west-a"},
+		},
+	}
+	for testName, testCase := range testCases {
+		t.Run(testName, func(t *testing.T) {
+			require.Equal(t, testCase.expected, spreadClusters(testCase.assigned, candidates, locationLabels, testCase.constraints, testCase.number))
+		})
+	}
+}
+
+func TestAssignAdditionalClusters(t *testing.T) {
+	eastCluster := defaultClusterFixture().withReady().cluster
+	eastCluster.Labels = map[string]string{"region": "us-east1"}
+	westCluster := otherClusterFixture().withReady().cluster
+	westCluster.Labels = map[string]string{"region": "us-west1"}
+	notReadyCluster := newClusterFixture(testLclusterName, "not-ready").cluster
+	notReadyCluster.Labels = map[string]string{"region": "us-west1"}
+
+	locations := []*workloadv1alpha1.Location{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "east", ClusterName: testLclusterName, Labels: map[string]string{"region": "east"}},
+			Spec: workloadv1alpha1.LocationSpec{
+				InstanceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"region": "us-east1"}},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "west", ClusterName: testLclusterName, Labels: map[string]string{"region": "west"}},
+			Spec: workloadv1alpha1.LocationSpec{
+				InstanceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"region": "us-west1"}},
+			},
+		},
+	}
+	placement := func(numberOfClusters int32) *workloadv1alpha1.Placement {
+		return &workloadv1alpha1.Placement{
+			ObjectMeta: metav1.ObjectMeta{Name: "everywhere", ClusterName: testLclusterName},
+			Spec: workloadv1alpha1.PlacementSpec{
+				NamespaceSelector: &metav1.LabelSelector{},
+				LocationSelectors: []metav1.LabelSelector{{}},
+				NumberOfClusters:  &numberOfClusters,
+				SpreadConstraints: []workloadv1alpha1.SpreadConstraint{{TopologyKey: "region", MaxSkew: 1}},
+			},
+		}
+	}
+
+	testCases := map[string]struct {
+		placement *workloadv1alpha1.Placement
+		labels    map[string]string
+		primary   string
+		expected  []string
+	}{
+		"no placement -> no additional cluster": {
+			primary: testClusterName,
+		},
+		"single cluster placement -> no additional cluster": {
+			placement: placement(1),
+			primary:   testClusterName,
+		},
+		"unscheduled -> no additional cluster": {
+			placement: placement(2),
+		},
+		"two clusters -> other region": {
+			placement: placement(2),
+			primary:   testClusterName,
+			expected:  []string{otherTestClusterName},
+		},
+		"more clusters than available -> all ready ones": {
+			placement: placement(3),
+			primary:   otherTestClusterName,
+			expected:  []string{testClusterName},
+		},
+		"not ready additional cluster -> replaced": {
+			placement: placement(2),
+			labels:    map[string]string{ClusterLabel: testClusterName, ClusterLabelFor(testClusterName): "", ClusterLabelFor("not-ready"): ""},
+			primary:   testClusterName,
+			expected:  []string{otherTestClusterName},
+		},
+		"scheduling disabled -> kept": {
+			placement: placement(1),
+			labels:    map[string]string{ClusterLabel: testClusterName, ClusterLabelFor("not-ready"): "", SchedulingDisabledLabel: ""},
+			primary:   testClusterName,
+			expected:  []string{"not-ready"},
+		},
+	}
+	for testName, testCase := range testCases {
+		t.Run(testName, func(t *testing.T) {
+			scheduler := newTestScheduler([]*workloadv1alpha1.WorkloadCluster{eastCluster, westCluster, notReadyCluster})
+			scheduler.listPlacements = func(selector labels.Selector) ([]*workloadv1alpha1.Placement, error) {
+				if testCase.placement == nil {
+					return nil, nil
+				}
+				return []*workloadv1alpha1.Placement{testCase.placement}, nil
+			}
+			scheduler.listLocations = func(selector labels.Selector) ([]*workloadv1alpha1.Location, error) {
+				return locations, nil
+			}
+			ns := &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					ClusterName: testLclusterName,
+					Labels:      testCase.labels,
+				},
+			}
+			clusters, err := scheduler.AssignAdditionalClusters(ns, testCase.primary)
+			require.NoError(t, err)
+			require.Equal(t, testCase.expected, clusters)
 		})
 	}
 }
 
 func TestIsValidCluster(t *testing.T) {
 	testCases := map[string]struct {
-		cluster *clusterFixture
-		isValid bool
+		cluster   *clusterFixture
+		threshold time.Duration
+		isValid   bool
 	}{
 		"missing -> false": {},
 		"unready -> false": {
 			cluster: defaultClusterFixture(),
 		},
+		"unready, never ready with threshold -> false": {
+			cluster:   defaultClusterFixture(),
+			threshold: time.Hour,
+		},
+		"unready for less than threshold -> true": {
+			cluster:   defaultClusterFixture().withUnreadySince(time.Now().Add(-time.Minute)),
+			threshold: time.Hour,
+			isValid:   true,
+		},
+		"unready for more than threshold -> false": {
+			cluster:   defaultClusterFixture().withUnreadySince(time.Now().Add(-2 * time.Hour)),
+			threshold: time.Hour,
+		},
 		"ready -> true": {
 			cluster: defaultClusterFixture().withReady(),
 			isValid: true,
@@ -186,6 +478,7 @@ func TestIsValidCluster(t *testing.T) {
 				clusters = append(clusters, testCase.cluster.cluster)
 			}
 			scheduler := newTestScheduler(clusters)
+			scheduler.unreadyEvictionThreshold = testCase.threshold
 			isValid, _, err := scheduler.isValidCluster(testLclusterName, testClusterName)
 			require.NoError(t, err)
 			require.Equal(t, testCase.isValid, isValid)
@@ -0,0 +1,345 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package replication
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clusters"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	reconcilermetrics "github.com/kcp-dev/kcp/pkg/reconciler/metrics"
+)
+
+const (
+	controllerName = "kcp-replication"
+
+	// ReplicatedFromLabel is set on the objects replicated from another shard, with the name
+	// of that shard as value. Objects without the label are never touched by the replication.
+	ReplicatedFromLabel = "replication.kcp.dev/replicated-from"
+)
+
+var (
+	clusterWorkspaceTypesGVR = tenancyv1alpha1.SchemeGroupVersion.WithResource("clusterworkspacetypes")
+	workspaceShardsGVR       = tenancyv1alpha1.SchemeGroupVersion.WithResource("workspaceshards")
+	clusterRolesGVR          = rbacv1.SchemeGroupVersion.WithResource("clusterroles")
+	clusterRoleBindingsGVR   = rbacv1.SchemeGroupVersion.WithResource("clusterrolebindings")
+
+	// replicatedResources are the resources replicated from the source shard, and whether
+	// they have a status subresource.
+	replicatedResources = map[schema.GroupVersionResource]bool{
+		clusterWorkspaceTypesGVR: false,
+		workspaceShardsGVR:       true,
+		clusterRolesGVR:          false,
+		clusterRoleBindingsGVR:   false,
+	}
+)
+
+// NewController returns a controller replicating the objects of the source shard that
+// admission and authorization of the local shard depend on. The source informers must list
+// and watch all logical clusters of the source shard, the local informers all logical
+// clusters of the local shard, restricted to the ReplicatedFromLabel. Both informer
+// factories are started by the controller.
+func NewController(
+	sourceShard string,
+	sourceInformers dynamicinformer.DynamicSharedInformerFactory,
+	localClusterClient dynamic.ClusterInterface,
+	localInformers dynamicinformer.DynamicSharedInformerFactory,
+) (*Controller, error) {
+	queue := reconcilermetrics.InstrumentQueue(controllerName, workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), controllerName))
+
+	c := &Controller{
+		queue:              queue,
+		sourceShard:        sourceShard,
+		sourceInformers:    sourceInformers,
+		localClusterClient: localClusterClient,
+		localInformers:     localInformers,
+	}
+
+	for gvr := range replicatedResources {
+		gvr := gvr
+		handler := cache.ResourceEventHandlerFuncs{
+			AddFunc:    func(obj interface{}) { c.enqueue(gvr, obj) },
+			UpdateFunc: func(_, obj interface{}) { c.enqueue(gvr, obj) },
+			DeleteFunc: func(obj interface{}) { c.enqueue(gvr, obj) },
+		}
+		sourceInformers.ForResource(gvr).Informer().AddEventHandler(handler)
+		localInformers.ForResource(gvr).Informer().AddEventHandler(handler)
+	}
+	// the ClusterRoleBindings are replicated depending on the ClusterRole they reference
+	sourceInformers.ForResource(clusterRolesGVR).Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.enqueueBindingsForRole(obj) },
+		UpdateFunc: func(_, obj interface{}) { c.enqueueBindingsForRole(obj) },
+		DeleteFunc: func(obj interface{}) { c.enqueueBindingsForRole(obj) },
+	})
+
+	return c, nil
+}
+
+// Controller replicates the ClusterWorkspaceTypes, the WorkspaceShards, and the ClusterRoles
+// granting the use of ClusterWorkspaceTypes together with their ClusterRoleBindings, from all
+// logical clusters of the source shard, usually the root shard, to the same logical clusters
+// on the local shard. This way, admission and authorization keep working for workspaces living
+// on a different shard than their type. Replicas are labelled with ReplicatedFromLabel, and
+// deleted when the source object is deleted or stops being replicated. Local objects of the
+// same name that are not replicas are left untouched.
+type Controller struct {
+	queue workqueue.RateLimitingInterface
+
+	sourceShard        string
+	sourceInformers    dynamicinformer.DynamicSharedInformerFactory
+	localClusterClient dynamic.ClusterInterface
+	localInformers     dynamicinformer.DynamicSharedInformerFactory
+}
+
+// queueKey returns the key of an object of the given resource. The resource is a suffix of the
+// key so that the logical cluster of the key is still recognized by the queue metrics.
+func queueKey(gvr schema.GroupVersionResource, key string) string {
+	return key + "::" + gvr.GroupResource().String()
+}
+
+func splitQueueKey(key string) (schema.GroupVersionResource, string, error) {
+	i := strings.LastIndex(key, "::")
+	if i < 0 {
+		return schema.GroupVersionResource{}, "", fmt.Errorf("missing resource")
+	}
+	gr := schema.ParseGroupResource(key[i+2:])
+	for gvr := range replicatedResources {
+		if gvr.GroupResource() == gr {
+			return gvr, key[:i], nil
+		}
+	}
+	return schema.GroupVersionResource{}, "", fmt.Errorf("unknown resource %q", gr)
+}
+
+func (c *Controller) enqueue(gvr schema.GroupVersionResource, obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	klog.V(4).Infof("queueing %s %q", gvr.Resource, key)
+	c.queue.Add(queueKey(gvr, key))
+}
+
+// enqueueBindingsForRole queues the ClusterRoleBindings of the source shard referencing the
+// given ClusterRole, which are replicated only when the role grants the use of types.
+func (c *Controller) enqueueBindingsForRole(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	role, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		utilruntime.HandleError(fmt.Errorf("obj is supposed to be an Unstructured, but is %T", obj))
+		return
+	}
+	bindings, err := c.sourceInformers.ForResource(clusterRoleBindingsGVR).Informer().GetIndexer().ByIndex(cache.NamespaceIndex, "")
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	for _, b := range bindings {
+		binding, ok := b.(*unstructured.Unstructured)
+		if !ok || binding.GetClusterName() != role.GetClusterName() {
+			continue
+		}
+		if name, _, _ := unstructured.NestedString(binding.Object, "roleRef", "name"); name == role.GetName() {
+			c.enqueue(clusterRoleBindingsGVR, binding)
+		}
+	}
+}
+
+func (c *Controller) Start(ctx context.Context, numThreads int) {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.Infof("Starting replication controller from shard %q", c.sourceShard)
+	defer klog.Infof("Shutting down replication controller from shard %q", c.sourceShard)
+
+	c.sourceInformers.Start(ctx.Done())
+	c.localInformers.Start(ctx.Done())
+	for gvr, synced := range c.sourceInformers.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			klog.Errorf("failed to sync %s of shard %q", gvr.Resource, c.sourceShard)
+			return
+		}
+	}
+	for gvr, synced := range c.localInformers.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			klog.Errorf("failed to sync replicated %s", gvr.Resource)
+			return
+		}
+	}
+
+	for i := 0; i < numThreads; i++ {
+		go wait.Until(func() { c.startWorker(ctx) }, time.Second, ctx.Done())
+	}
+
+	<-ctx.Done()
+}
+
+func (c *Controller) startWorker(ctx context.Context) {
+	for c.processNextWorkItem(ctx) {
+	}
+}
+
+func (c *Controller) processNextWorkItem(ctx context.Context) bool {
+	// Wait until there is a new item in the working queue
+	k, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	key := k.(string)
+
+	klog.V(4).Infof("processing key %q", key)
+
+	// No matter what, tell the queue we're done with this key, to unblock
+	// other workers.
+	defer c.queue.Done(key)
+
+	if err := c.process(ctx, key); err != nil {
+		utilruntime.HandleError(fmt.Errorf("%q controller failed to sync %q, err: %w", controllerName, key, err))
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+func (c *Controller) process(ctx context.Context, key string) error {
+	gvr, key, err := splitQueueKey(key)
+	if err != nil {
+		klog.Errorf("invalid key: %q: %v", key, err)
+		return nil
+	}
+	_, clusterAwareName, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		klog.Errorf("invalid key: %q: %v", key, err)
+		return nil
+	}
+	clusterName, name := clusters.SplitClusterAwareKey(clusterAwareName)
+
+	var desired *unstructured.Unstructured
+	source, exists, err := c.sourceInformers.ForResource(gvr).Informer().GetIndexer().GetByKey(key)
+	if err != nil {
+		return err
+	}
+	if exists {
+		replicate, err := c.replicates(gvr, source.(*unstructured.Unstructured))
+		if err != nil {
+			return err
+		}
+		if replicate {
+			desired = replica(source.(*unstructured.Unstructured), c.sourceShard)
+		}
+	}
+
+	client := c.localClusterClient.Cluster(clusterName).Resource(gvr)
+	obj, exists, err := c.localInformers.ForResource(gvr).Informer().GetIndexer().GetByKey(key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if desired == nil {
+			return nil
+		}
+		created, err := client.Create(ctx, desired, metav1.CreateOptions{})
+		if errors.IsAlreadyExists(err) {
+			klog.Infof("Not replicating %s %s|%s from shard %q: it exists and is not a replica", gvr.Resource, clusterName, name, c.sourceShard)
+			return nil
+		} else if err != nil {
+			return err
+		}
+		return c.updateStatus(ctx, gvr, client, created, desired)
+	}
+
+	local := obj.(*unstructured.Unstructured)
+	if desired == nil {
+		klog.Infof("Deleting replicated %s %s|%s no longer replicated from shard %q", gvr.Resource, clusterName, name, c.sourceShard)
+		if err := client.Delete(ctx, name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+	if !specEqual(local, desired) {
+		updated := desired.DeepCopy()
+		updated.SetResourceVersion(local.GetResourceVersion())
+		if local, err = client.Update(ctx, updated, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+	}
+	return c.updateStatus(ctx, gvr, client, local, desired)
+}
+
+// updateStatus updates the status of the local replica to the desired one, for the resources
+// with a status subresource.
+func (c *Controller) updateStatus(ctx context.Context, gvr schema.GroupVersionResource, client dynamic.ResourceInterface, local, desired *unstructured.Unstructured) error {
+	if !replicatedResources[gvr] || statusEqual(local, desired) {
+		return nil
+	}
+	updated := local.DeepCopy()
+	if status, ok := desired.Object["status"]; ok {
+		updated.Object["status"] = runtime.DeepCopyJSONValue(status)
+	} else {
+		delete(updated.Object, "status")
+	}
+	_, err := client.UpdateStatus(ctx, updated, metav1.UpdateOptions{})
+	return err
+}
+
+// replicates returns whether the given object of the source shard is replicated.
+func (c *Controller) replicates(gvr schema.GroupVersionResource, obj *unstructured.Unstructured) (bool, error) {
+	switch gvr {
+	case clusterRolesGVR:
+		var role rbacv1.ClusterRole
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &role); err != nil {
+			return false, err
+		}
+		return grantsUse(&role), nil
+	case clusterRoleBindingsGVR:
+		var binding rbacv1.ClusterRoleBinding
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &binding); err != nil {
+			return false, err
+		}
+		if binding.RoleRef.Kind != "ClusterRole" {
+			return false, nil
+		}
+		role, exists, err := c.sourceInformers.ForResource(clusterRolesGVR).Informer().GetIndexer().GetByKey(clusters.ToClusterAwareKey(obj.GetClusterName(), binding.RoleRef.Name))
+		if err != nil || !exists {
+			return false, err
+		}
+		return c.replicates(clusterRolesGVR, role.(*unstructured.Unstructured))
+	default:
+		return true, nil
+	}
+}
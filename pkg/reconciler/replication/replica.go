@@ -0,0 +1,94 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package replication
+
+import (
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+)
+
+// replica returns the object to be written on the local shard for the given object of the
+// source shard. Only the name, labels and annotations of the metadata are kept, since the
+// rest is owned by the local shard, and the object is labelled with the source shard.
+func replica(source *unstructured.Unstructured, sourceShard string) *unstructured.Unstructured {
+	replica := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	for k, v := range source.Object {
+		if k == "metadata" {
+			continue
+		}
+		replica.Object[k] = runtime.DeepCopyJSONValue(v)
+	}
+	replica.SetName(source.GetName())
+
+	labels := map[string]string{}
+	for k, v := range source.GetLabels() {
+		labels[k] = v
+	}
+	labels[ReplicatedFromLabel] = sourceShard
+	replica.SetLabels(labels)
+	replica.SetAnnotations(source.GetAnnotations())
+	return replica
+}
+
+// specEqual returns whether the labels, annotations and the fields other than the metadata and
+// the status of the given objects are equal.
+func specEqual(a, b *unstructured.Unstructured) bool {
+	if !equality.Semantic.DeepEqual(a.GetLabels(), b.GetLabels()) || !equality.Semantic.DeepEqual(a.GetAnnotations(), b.GetAnnotations()) {
+		return false
+	}
+	return equality.Semantic.DeepEqual(withoutMetadataAndStatus(a.Object), withoutMetadataAndStatus(b.Object))
+}
+
+// statusEqual returns whether the status of the given objects are equal.
+func statusEqual(a, b *unstructured.Unstructured) bool {
+	return equality.Semantic.DeepEqual(a.Object["status"], b.Object["status"])
+}
+
+func withoutMetadataAndStatus(obj map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(obj))
+	for k, v := range obj {
+		if k != "metadata" && k != "status" {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// grantsUse returns whether the given ClusterRole grants the use of ClusterWorkspaceTypes, which
+// is authorized when admitting ClusterWorkspaces.
+func grantsUse(role *rbacv1.ClusterRole) bool {
+	for _, rule := range role.Rules {
+		if has(rule.Verbs, "use") && has(rule.APIGroups, tenancyv1alpha1.SchemeGroupVersion.Group) && has(rule.Resources, "clusterworkspacetypes") {
+			return true
+		}
+	}
+	return false
+}
+
+// has returns whether the given values of a policy rule contain the given value or the wildcard.
+func has(values []string, value string) bool {
+	for _, v := range values {
+		if v == value || v == rbacv1.VerbAll {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package replication
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestReplica(t *testing.T) {
+	source := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "tenancy.kcp.dev/v1alpha1",
+		"kind":       "WorkspaceShard",
+		"metadata": map[string]interface{}{
+			"name":            "shard-1",
+			"clusterName":     "root",
+			"resourceVersion": "42",
+			"uid":             "uid",
+			"labels":          map[string]interface{}{"a": "b"},
+			"annotations":     map[string]interface{}{"c": "d"},
+			"finalizers":      []interface{}{"f"},
+		},
+		"spec":   map[string]interface{}{"credentials": map[string]interface{}{"name": "creds"}},
+		"status": map[string]interface{}{"baseURL": "https://shard-1"},
+	}}
+
+	got := replica(source, "root")
+	want := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "tenancy.kcp.dev/v1alpha1",
+		"kind":       "WorkspaceShard",
+		"metadata": map[string]interface{}{
+			"name":        "shard-1",
+			"labels":      map[string]interface{}{"a": "b", ReplicatedFromLabel: "root"},
+			"annotations": map[string]interface{}{"c": "d"},
+		},
+		"spec":   map[string]interface{}{"credentials": map[string]interface{}{"name": "creds"}},
+		"status": map[string]interface{}{"baseURL": "https://shard-1"},
+	}}
+	if diff := cmp.Diff(want.Object, got.Object); diff != "" {
+		t.Errorf("unexpected replica (-want +got):\n%s", diff)
+	}
+
+	local := got.DeepCopy()
+	local.SetResourceVersion("7")
+	local.SetUID("other")
+	if !specEqual(local, got) {
+		t.Errorf("expected replicas differing in metadata only to be equal")
+	}
+	local.Object["status"] = map[string]interface{}{}
+	if !specEqual(local, got) || statusEqual(local, got) {
+		t.Errorf("expected replicas differing in status only to have an equal spec and a different status")
+	}
+	local.SetLabels(map[string]string{"a": "b"})
+	if specEqual(local, got) {
+		t.Errorf("expected replicas differing in labels to be different")
+	}
+}
+
+func TestGrantsUse(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		rule rbacv1.PolicyRule
+		want bool
+	}{
+		{
+			name: "use of clusterworkspacetypes",
+			rule: rbacv1.PolicyRule{Verbs: []string{"use"}, APIGroups: []string{"tenancy.kcp.dev"}, Resources: []string{"clusterworkspacetypes"}, ResourceNames: []string{"team"}},
+			want: true,
+		},
+		{
+			name: "wildcards",
+			rule: rbacv1.PolicyRule{Verbs: []string{"*"}, APIGroups: []string{"*"}, Resources: []string{"*"}},
+			want: true,
+		},
+		{
+			name: "other verb",
+			rule: rbacv1.PolicyRule{Verbs: []string{"get"}, APIGroups: []string{"tenancy.kcp.dev"}, Resources: []string{"clusterworkspacetypes"}},
+		},
+		{
+			name: "other resource",
+			rule: rbacv1.PolicyRule{Verbs: []string{"use"}, APIGroups: []string{"tenancy.kcp.dev"}, Resources: []string{"clusterworkspaces"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := grantsUse(&rbacv1.ClusterRole{Rules: []rbacv1.PolicyRule{tc.rule}}); got != tc.want {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
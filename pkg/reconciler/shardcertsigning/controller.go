@@ -0,0 +1,244 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shardcertsigning
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	certificatesinformers "k8s.io/client-go/informers/certificates/v1"
+	certificatesv1client "k8s.io/client-go/kubernetes/typed/certificates/v1"
+	certificateslisters "k8s.io/client-go/listers/certificates/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	reconcilermetrics "github.com/kcp-dev/kcp/pkg/reconciler/metrics"
+	"github.com/kcp-dev/kcp/pkg/shardcerts"
+)
+
+const controllerName = "shardcertsigning"
+
+// subresources are the subresources of certificatesigningrequests requesters must be
+// allowed to create in the root logical cluster to get the certificates of a signer.
+var subresources = map[string]string{
+	shardcerts.ClientSignerName:  "shardclient",
+	shardcerts.ServingSignerName: "shardserving",
+}
+
+// NewController returns a controller approving and signing with the given issuer the
+// CertificateSigningRequests of the shard signers in the root logical cluster, through the
+// given client of it. Requests are approved if their requester is allowed by the given
+// authorizer to create the certificatesigningrequests/shardclient, respectively
+// certificatesigningrequests/shardserving, subresource. Requests the issuer refuses to sign,
+// e.g. of other identities than shards, are marked as failed. The certificates are valid for
+// the requested duration, at most for the given validity.
+func NewController(
+	issuer *shardcerts.Issuer,
+	validity time.Duration,
+	client certificatesv1client.CertificateSigningRequestInterface,
+	authz authorizer.Authorizer,
+	csrInformer certificatesinformers.CertificateSigningRequestInformer,
+) *Controller {
+	queue := reconcilermetrics.InstrumentQueue(controllerName, workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), controllerName))
+
+	c := &Controller{
+		queue:     queue,
+		issuer:    issuer,
+		validity:  validity,
+		client:    client,
+		authz:     authz,
+		csrLister: csrInformer.Lister(),
+	}
+
+	csrInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: func(obj interface{}) bool {
+			csr, ok := obj.(*certificatesv1.CertificateSigningRequest)
+			if !ok {
+				return false
+			}
+			_, found := subresources[csr.Spec.SignerName]
+			return found
+		},
+		Handler: cache.ResourceEventHandlerFuncs{
+			AddFunc:    func(obj interface{}) { c.enqueue(obj) },
+			UpdateFunc: func(_, obj interface{}) { c.enqueue(obj) },
+		},
+	})
+
+	return c
+}
+
+// Controller approves and signs the CertificateSigningRequests of the shard signers.
+type Controller struct {
+	queue workqueue.RateLimitingInterface
+
+	issuer    *shardcerts.Issuer
+	validity  time.Duration
+	client    certificatesv1client.CertificateSigningRequestInterface
+	authz     authorizer.Authorizer
+	csrLister certificateslisters.CertificateSigningRequestLister
+}
+
+func (c *Controller) enqueue(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	c.queue.Add(key)
+}
+
+func (c *Controller) Start(ctx context.Context, numThreads int) {
+	defer runtime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.Info("Starting shard certificate signing controller")
+	defer klog.Info("Shutting down shard certificate signing controller")
+
+	for i := 0; i < numThreads; i++ {
+		go wait.Until(func() { c.startWorker(ctx) }, time.Second, ctx.Done())
+	}
+
+	<-ctx.Done()
+}
+
+func (c *Controller) startWorker(ctx context.Context) {
+	for c.processNextWorkItem(ctx) {
+	}
+}
+
+func (c *Controller) processNextWorkItem(ctx context.Context) bool {
+	// Wait until there is a new item in the working queue
+	k, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	key := k.(string)
+
+	// No matter what, tell the queue we're done with this key, to unblock
+	// other workers.
+	defer c.queue.Done(key)
+
+	if err := c.process(ctx, key); err != nil {
+		runtime.HandleError(fmt.Errorf("%q controller failed to sync %q, err: %w", controllerName, key, err))
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+func (c *Controller) process(ctx context.Context, key string) error {
+	csr, err := c.csrLister.Get(key)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if len(csr.Status.Certificate) > 0 || hasCondition(csr, certificatesv1.CertificateDenied) || hasCondition(csr, certificatesv1.CertificateFailed) {
+		return nil
+	}
+	csr = csr.DeepCopy()
+
+	if !hasCondition(csr, certificatesv1.CertificateApproved) {
+		allowed, err := c.authorize(ctx, csr)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			klog.V(2).Infof("Not approving CertificateSigningRequest %q of user %q for signer %q", csr.Name, csr.Spec.Username, csr.Spec.SignerName)
+			return nil
+		}
+		csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{
+			Type:           certificatesv1.CertificateApproved,
+			Status:         corev1.ConditionTrue,
+			Reason:         "AutoApproved",
+			Message:        "Auto approving shard certificate after SubjectAccessReview.",
+			LastUpdateTime: metav1.Now(),
+		})
+		if csr, err = c.client.UpdateApproval(ctx, csr.Name, csr, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+	}
+
+	validity := c.validity
+	if csr.Spec.ExpirationSeconds != nil {
+		if requested := time.Duration(*csr.Spec.ExpirationSeconds) * time.Second; requested < validity {
+			validity = requested
+		}
+	}
+	certPEM, err := c.issuer.Sign(csr.Spec.Request, csr.Spec.SignerName, validity)
+	if err != nil {
+		csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{
+			Type:           certificatesv1.CertificateFailed,
+			Status:         corev1.ConditionTrue,
+			Reason:         "SignerValidationFailure",
+			Message:        err.Error(),
+			LastUpdateTime: metav1.Now(),
+		})
+	} else {
+		csr.Status.Certificate = certPEM
+	}
+	_, err = c.client.UpdateStatus(ctx, csr, metav1.UpdateOptions{})
+	return err
+}
+
+// authorize returns whether the requester of the CertificateSigningRequest is allowed to
+// create the subresource of its signer.
+func (c *Controller) authorize(ctx context.Context, csr *certificatesv1.CertificateSigningRequest) (bool, error) {
+	extra := map[string][]string{}
+	for k, v := range csr.Spec.Extra {
+		extra[k] = v
+	}
+	decision, _, err := c.authz.Authorize(ctx, authorizer.AttributesRecord{
+		User: &user.DefaultInfo{
+			Name:   csr.Spec.Username,
+			UID:    csr.Spec.UID,
+			Groups: csr.Spec.Groups,
+			Extra:  extra,
+		},
+		Verb:            "create",
+		APIGroup:        certificatesv1.GroupName,
+		APIVersion:      "v1",
+		Resource:        "certificatesigningrequests",
+		Subresource:     subresources[csr.Spec.SignerName],
+		ResourceRequest: true,
+	})
+	if err != nil {
+		return false, err
+	}
+	return decision == authorizer.DecisionAllow, nil
+}
+
+func hasCondition(csr *certificatesv1.CertificateSigningRequest, conditionType certificatesv1.RequestConditionType) bool {
+	for _, c := range csr.Status.Conditions {
+		if c.Type == conditionType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shardcertsigning
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	certificatesv1 "k8s.io/api/certificates/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	certificateslisters "k8s.io/client-go/listers/certificates/v1"
+	"k8s.io/client-go/tools/cache"
+	certutil "k8s.io/client-go/util/cert"
+	"k8s.io/client-go/util/keyutil"
+
+	"github.com/kcp-dev/kcp/pkg/authorization/bootstrap"
+	"github.com/kcp-dev/kcp/pkg/shardcerts"
+)
+
+func newTestIssuer(t *testing.T) *shardcerts.Issuer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ca, err := certutil.NewSelfSignedCACert(certutil.Config{CommonName: "shard-ca"}, key)
+	require.NoError(t, err)
+	keyPEM, err := keyutil.MarshalPrivateKeyToPEM(key)
+	require.NoError(t, err)
+	issuer, err := shardcerts.NewIssuer(pem.EncodeToMemory(&pem.Block{Type: certutil.CertificateBlockType, Bytes: ca.Raw}), keyPEM)
+	require.NoError(t, err)
+	return issuer
+}
+
+func newRequest(t *testing.T, name, userName string, groups []string) *certificatesv1.CertificateSigningRequest {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: userName, Organization: groups}}, key)
+	require.NoError(t, err)
+	return &certificatesv1.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{ClusterName: "root", Name: name},
+		Spec: certificatesv1.CertificateSigningRequestSpec{
+			Request:    pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}),
+			SignerName: shardcerts.ClientSignerName,
+			Username:   "shard-admin",
+		},
+	}
+}
+
+func TestProcess(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name        string
+		groups      []string
+		allowed     bool
+		approved    bool
+		certificate bool
+		failed      bool
+	}{
+		{name: "allowed shard client", groups: []string{bootstrap.SystemKcpShardsGroup}, allowed: true, approved: true, certificate: true},
+		{name: "forbidden requester", groups: []string{bootstrap.SystemKcpShardsGroup}},
+		{name: "allowed system:masters client", groups: []string{"system:masters"}, allowed: true, approved: true, failed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			csr := newRequest(t, "shard-1-abc", shardcerts.UserName("shard-1"), tt.groups)
+			kubeClient := kubefake.NewSimpleClientset(csr)
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			require.NoError(t, indexer.Add(csr))
+
+			var attributes authorizer.Attributes
+			c := &Controller{
+				issuer:   newTestIssuer(t),
+				validity: time.Hour,
+				client:   kubeClient.CertificatesV1().CertificateSigningRequests(),
+				authz: authorizer.AuthorizerFunc(func(ctx context.Context, a authorizer.Attributes) (authorizer.Decision, string, error) {
+					attributes = a
+					if tt.allowed {
+						return authorizer.DecisionAllow, "", nil
+					}
+					return authorizer.DecisionNoOpinion, "", nil
+				}),
+				csrLister: certificateslisters.NewCertificateSigningRequestLister(indexer),
+			}
+
+			key, err := cache.MetaNamespaceKeyFunc(csr)
+			require.NoError(t, err)
+			require.NoError(t, c.process(ctx, key))
+
+			require.Equal(t, "shard-admin", attributes.GetUser().GetName())
+			require.Equal(t, "create", attributes.GetVerb())
+			require.Equal(t, "certificatesigningrequests", attributes.GetResource())
+			require.Equal(t, "shardclient", attributes.GetSubresource())
+
+			got, err := kubeClient.CertificatesV1().CertificateSigningRequests().Get(ctx, csr.Name, metav1.GetOptions{})
+			require.NoError(t, err)
+			require.Equal(t, tt.approved, hasCondition(got, certificatesv1.CertificateApproved))
+			require.Equal(t, tt.failed, hasCondition(got, certificatesv1.CertificateFailed))
+			require.Equal(t, tt.certificate, len(got.Status.Certificate) > 0)
+		})
+	}
+}
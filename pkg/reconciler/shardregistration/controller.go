@@ -0,0 +1,303 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shardregistration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	kcpclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
+	tenancyinformer "github.com/kcp-dev/kcp/pkg/client/informers/externalversions/tenancy/v1alpha1"
+	tenancylister "github.com/kcp-dev/kcp/pkg/client/listers/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/etcd"
+	conditionsapi "github.com/kcp-dev/kcp/third_party/conditions/apis/conditions/v1alpha1"
+	"github.com/kcp-dev/kcp/third_party/conditions/util/conditions"
+)
+
+const (
+	controllerName = "shardregistration"
+
+	// credentialsNamespace is the namespace of the root workspace holding the credentials of the shards.
+	credentialsNamespace = "default"
+
+	// etcdHealthTimeout is the time after which etcd is considered unhealthy when reading from it.
+	etcdHealthTimeout = 5 * time.Second
+)
+
+// NewController returns a controller registering the shard of the given name in the root
+// workspace, through the given root clients: the given kubeconfig to reach the shard is
+// stored in a secret referenced by the WorkspaceShard, and the version of the shard, its
+// workspace capacity, the number of ClusterWorkspaces it stores and the health of its etcd
+// are published on the status of the WorkspaceShard at every heartbeat interval. The given
+// etcd endpoints and prefix, nil for an embedded etcd, are published too and checked
+// against those of the other shards. The given labels, e.g. the region and zone of the
+// shard, are set on the WorkspaceShard for workspaces to be placed by.
+func NewController(
+	shardName string,
+	kubeconfig []byte,
+	version string,
+	rootKubeClient kubernetes.Interface,
+	rootKcpClient kcpclient.Interface,
+	etcdClient clientv3.KV,
+	etcd *tenancyv1alpha1.WorkspaceShardEtcd,
+	shardLabels map[string]string,
+	workspaceInformer tenancyinformer.ClusterWorkspaceInformer,
+	workspaceCapacity int64,
+	interval time.Duration,
+) *Controller {
+	return &Controller{
+		shardName:         shardName,
+		kubeconfig:        kubeconfig,
+		version:           version,
+		rootKubeClient:    rootKubeClient,
+		rootKcpClient:     rootKcpClient,
+		etcdClient:        etcdClient,
+		etcd:              etcd,
+		shardLabels:       shardLabels,
+		workspaceLister:   workspaceInformer.Lister(),
+		workspaceCapacity: workspaceCapacity,
+		interval:          interval,
+		now:               time.Now,
+	}
+}
+
+// Controller registers a shard as a WorkspaceShard of the root workspace and heartbeats its
+// status, for the workspace scheduler to choose among the live shards with capacity left.
+type Controller struct {
+	shardName         string
+	kubeconfig        []byte
+	version           string
+	rootKubeClient    kubernetes.Interface
+	rootKcpClient     kcpclient.Interface
+	etcdClient        clientv3.KV
+	etcd              *tenancyv1alpha1.WorkspaceShardEtcd
+	shardLabels       map[string]string
+	workspaceLister   tenancylister.ClusterWorkspaceLister
+	workspaceCapacity int64
+	interval          time.Duration
+
+	now func() time.Time
+}
+
+func (c *Controller) Start(ctx context.Context) {
+	defer runtime.HandleCrash()
+
+	klog.Infof("Starting shard registration controller for shard %q", c.shardName)
+	defer klog.Info("Shutting down shard registration controller")
+
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := c.register(ctx); err != nil {
+			runtime.HandleError(fmt.Errorf("%q controller failed to register shard %q: %w", controllerName, c.shardName, err))
+		}
+	}, c.interval)
+}
+
+// register makes sure the credentials and the WorkspaceShard of the shard exist, and
+// publishes the current status of the shard.
+func (c *Controller) register(ctx context.Context) error {
+	if err := c.ensureCredentials(ctx); err != nil {
+		return err
+	}
+	shard, err := c.ensureShard(ctx)
+	if err != nil {
+		return err
+	}
+	return c.updateStatus(ctx, shard)
+}
+
+func (c *Controller) credentialsName() string {
+	return fmt.Sprintf("shard-%s-kubeconfig", c.shardName)
+}
+
+// ensureCredentials creates or updates the secret holding the kubeconfig of the shard.
+func (c *Controller) ensureCredentials(ctx context.Context) error {
+	secrets := c.rootKubeClient.CoreV1().Secrets(credentialsNamespace)
+	secret, err := secrets.Get(ctx, c.credentialsName(), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		klog.Infof("Creating credentials of shard %q", c.shardName)
+		_, err = secrets.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: c.credentialsName(), Namespace: credentialsNamespace},
+			Data:       map[string][]byte{tenancyv1alpha1.WorkspaceShardCredentialsKey: c.kubeconfig},
+		}, metav1.CreateOptions{})
+		return err
+	} else if err != nil {
+		return err
+	}
+	if bytes.Equal(secret.Data[tenancyv1alpha1.WorkspaceShardCredentialsKey], c.kubeconfig) {
+		return nil
+	}
+
+	klog.Infof("Updating credentials of shard %q", c.shardName)
+	secret = secret.DeepCopy()
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data[tenancyv1alpha1.WorkspaceShardCredentialsKey] = c.kubeconfig
+	_, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+	return err
+}
+
+// ensureShard creates the WorkspaceShard of the shard, or makes it reference the credentials
+// and carry the labels of the shard.
+func (c *Controller) ensureShard(ctx context.Context) (*tenancyv1alpha1.WorkspaceShard, error) {
+	credentials := corev1.SecretReference{Namespace: credentialsNamespace, Name: c.credentialsName()}
+	shards := c.rootKcpClient.TenancyV1alpha1().WorkspaceShards()
+	shard, err := shards.Get(ctx, c.shardName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		klog.Infof("Creating WorkspaceShard %q", c.shardName)
+		return shards.Create(ctx, &tenancyv1alpha1.WorkspaceShard{
+			ObjectMeta: metav1.ObjectMeta{Name: c.shardName, Labels: c.shardLabels},
+			Spec:       tenancyv1alpha1.WorkspaceShardSpec{Credentials: credentials},
+		}, metav1.CreateOptions{})
+	} else if err != nil {
+		return nil, err
+	}
+	if shard.Spec.Credentials == credentials && c.hasLabels(shard) {
+		return shard, nil
+	}
+
+	shard = shard.DeepCopy()
+	shard.Spec.Credentials = credentials
+	if shard.Labels == nil {
+		shard.Labels = map[string]string{}
+	}
+	for k, v := range c.shardLabels {
+		shard.Labels[k] = v
+	}
+	return shards.Update(ctx, shard, metav1.UpdateOptions{})
+}
+
+// hasLabels returns whether the given WorkspaceShard carries the labels of the shard.
+func (c *Controller) hasLabels(shard *tenancyv1alpha1.WorkspaceShard) bool {
+	for k, v := range c.shardLabels {
+		if value, ok := shard.Labels[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// updateStatus publishes the version, capacity, workspace count, etcd and health of the
+// shard, along with the time of the heartbeat.
+func (c *Controller) updateStatus(ctx context.Context, shard *tenancyv1alpha1.WorkspaceShard) error {
+	workspaces, err := c.workspaceLister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+
+	previous := shard
+	shard = shard.DeepCopy()
+	shard.Status.Version = c.version
+	shard.Status.WorkspaceCount = int64(len(workspaces))
+	now := metav1.NewTime(c.now())
+	shard.Status.LastHeartbeatTime = &now
+	if c.workspaceCapacity > 0 {
+		if shard.Status.Capacity == nil {
+			shard.Status.Capacity = corev1.ResourceList{}
+		}
+		shard.Status.Capacity[tenancyv1alpha1.WorkspaceShardWorkspacesCapacity] = *resource.NewQuantity(c.workspaceCapacity, resource.DecimalSI)
+	} else {
+		delete(shard.Status.Capacity, tenancyv1alpha1.WorkspaceShardWorkspacesCapacity)
+	}
+	if err := c.checkEtcd(ctx); err != nil {
+		conditions.MarkFalse(shard, tenancyv1alpha1.WorkspaceShardHealthy, tenancyv1alpha1.WorkspaceShardHealthyReasonEtcdUnhealthy, conditionsapi.ConditionSeverityError, "Failed to read from etcd: %v.", err)
+	} else {
+		conditions.MarkTrue(shard, tenancyv1alpha1.WorkspaceShardHealthy)
+	}
+	shard.Status.Etcd = c.etcd
+	if c.etcd == nil {
+		conditions.Delete(shard, tenancyv1alpha1.WorkspaceShardEtcdValid)
+	} else if other, err := c.etcdConflict(ctx); err != nil {
+		return err
+	} else if other != "" {
+		conditions.MarkFalse(shard, tenancyv1alpha1.WorkspaceShardEtcdValid, tenancyv1alpha1.WorkspaceShardEtcdReasonPrefixConflict, conditionsapi.ConditionSeverityError, "Shard %q uses the same etcd with an overlapping prefix.", other)
+	} else {
+		conditions.MarkTrue(shard, tenancyv1alpha1.WorkspaceShardEtcdValid)
+	}
+
+	if equality.Semantic.DeepEqual(previous.Status, shard.Status) {
+		return nil
+	}
+
+	oldData, err := json.Marshal(tenancyv1alpha1.WorkspaceShard{
+		Status: previous.Status,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to Marshal old data for workspace shard %s: %w", c.shardName, err)
+	}
+	newData, err := json.Marshal(tenancyv1alpha1.WorkspaceShard{
+		ObjectMeta: metav1.ObjectMeta{
+			UID:             previous.UID,
+			ResourceVersion: previous.ResourceVersion,
+		}, // to ensure they appear in the patch as preconditions
+		Status: shard.Status,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to Marshal new data for workspace shard %s: %w", c.shardName, err)
+	}
+	patchBytes, err := jsonpatch.CreateMergePatch(oldData, newData)
+	if err != nil {
+		return fmt.Errorf("failed to create patch for workspace shard %s: %w", c.shardName, err)
+	}
+	_, err = c.rootKcpClient.TenancyV1alpha1().WorkspaceShards().Patch(ctx, shard.Name, types.MergePatchType, patchBytes, metav1.PatchOptions{}, "status")
+	return err
+}
+
+// checkEtcd reads a key from etcd to find out whether it is reachable.
+func (c *Controller) checkEtcd(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, etcdHealthTimeout)
+	defer cancel()
+	_, err := c.etcdClient.Get(ctx, "health")
+	return err
+}
+
+// etcdConflict returns the name of another shard registered with an etcd member of this
+// shard and a prefix overlapping with its prefix, if any.
+func (c *Controller) etcdConflict(ctx context.Context) (string, error) {
+	shards, err := c.rootKcpClient.TenancyV1alpha1().WorkspaceShards().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+	for _, other := range shards.Items {
+		if other.Name == c.shardName || other.Status.Etcd == nil {
+			continue
+		}
+		if etcd.SharesEndpoint(c.etcd.Endpoints, other.Status.Etcd.Endpoints) && etcd.PrefixesOverlap(c.etcd.Prefix, other.Status.Etcd.Prefix) {
+			return other.Name, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shardregistration
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	kcpfake "github.com/kcp-dev/kcp/pkg/client/clientset/versioned/fake"
+	tenancylister "github.com/kcp-dev/kcp/pkg/client/listers/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/third_party/conditions/util/conditions"
+)
+
+// fakeKV fails reads with the given error.
+type fakeKV struct {
+	clientv3.KV
+
+	err error
+}
+
+func (kv *fakeKV) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	return &clientv3.GetResponse{}, kv.err
+}
+
+func TestRegister(t *testing.T) {
+	ctx := context.Background()
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, name := range []string{"a", "b"} {
+		require.NoError(t, indexer.Add(&tenancyv1alpha1.ClusterWorkspace{ObjectMeta: metav1.ObjectMeta{Name: name}}))
+	}
+	kubeClient := kubefake.NewSimpleClientset()
+	kcpClient := kcpfake.NewSimpleClientset()
+	etcd := &fakeKV{}
+	now := time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)
+	c := &Controller{
+		shardName:         "shard-1",
+		kubeconfig:        []byte("kubeconfig"),
+		version:           "v0.4.0",
+		rootKubeClient:    kubeClient,
+		rootKcpClient:     kcpClient,
+		etcdClient:        etcd,
+		workspaceLister:   tenancylister.NewClusterWorkspaceLister(indexer),
+		workspaceCapacity: 10,
+		interval:          time.Second,
+		now:               func() time.Time { return now },
+	}
+
+	require.NoError(t, c.register(ctx))
+
+	secret, err := kubeClient.CoreV1().Secrets("default").Get(ctx, "shard-shard-1-kubeconfig", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "kubeconfig", string(secret.Data[tenancyv1alpha1.WorkspaceShardCredentialsKey]))
+
+	shard, err := kcpClient.TenancyV1alpha1().WorkspaceShards().Get(ctx, "shard-1", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, corev1.SecretReference{Namespace: "default", Name: "shard-shard-1-kubeconfig"}, shard.Spec.Credentials)
+	require.Equal(t, "v0.4.0", shard.Status.Version)
+	require.Equal(t, int64(2), shard.Status.WorkspaceCount)
+	require.Equal(t, now.Unix(), shard.Status.LastHeartbeatTime.Unix())
+	capacity := shard.Status.Capacity[tenancyv1alpha1.WorkspaceShardWorkspacesCapacity]
+	require.Equal(t, int64(10), capacity.Value())
+	require.True(t, conditions.IsTrue(shard, tenancyv1alpha1.WorkspaceShardHealthy))
+
+	// the next heartbeat follows changes of the credentials and of the health of etcd
+	c.kubeconfig = []byte("rotated")
+	c.workspaceCapacity = 0
+	etcd.err = errors.New("connection refused")
+	now = now.Add(time.Minute)
+	require.NoError(t, c.register(ctx))
+
+	secret, err = kubeClient.CoreV1().Secrets("default").Get(ctx, "shard-shard-1-kubeconfig", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "rotated", string(secret.Data[tenancyv1alpha1.WorkspaceShardCredentialsKey]))
+
+	shard, err = kcpClient.TenancyV1alpha1().WorkspaceShards().Get(ctx, "shard-1", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, now.Unix(), shard.Status.LastHeartbeatTime.Unix())
+	require.NotContains(t, shard.Status.Capacity, tenancyv1alpha1.WorkspaceShardWorkspacesCapacity)
+	require.True(t, conditions.IsFalse(shard, tenancyv1alpha1.WorkspaceShardHealthy))
+	require.Equal(t, tenancyv1alpha1.WorkspaceShardHealthyReasonEtcdUnhealthy, conditions.GetReason(shard, tenancyv1alpha1.WorkspaceShardHealthy))
+}
+
+func TestRegisterEtcd(t *testing.T) {
+	ctx := context.Background()
+
+	kcpClient := kcpfake.NewSimpleClientset(&tenancyv1alpha1.WorkspaceShard{
+		ObjectMeta: metav1.ObjectMeta{Name: "shard-2"},
+		Status: tenancyv1alpha1.WorkspaceShardStatus{
+			Etcd: &tenancyv1alpha1.WorkspaceShardEtcd{Endpoints: []string{"https://etcd-0:2379"}, Prefix: "/shards/shard-2"},
+		},
+	})
+	c := &Controller{
+		shardName:       "shard-1",
+		rootKubeClient:  kubefake.NewSimpleClientset(),
+		rootKcpClient:   kcpClient,
+		etcdClient:      &fakeKV{},
+		etcd:            &tenancyv1alpha1.WorkspaceShardEtcd{Endpoints: []string{"https://etcd-1:2379", "https://ETCD-0:2379"}, Prefix: "/shards"},
+		workspaceLister: tenancylister.NewClusterWorkspaceLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})),
+		now:             time.Now,
+	}
+
+	require.NoError(t, c.register(ctx))
+	shard, err := kcpClient.TenancyV1alpha1().WorkspaceShards().Get(ctx, "shard-1", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, c.etcd, shard.Status.Etcd)
+	require.True(t, conditions.IsFalse(shard, tenancyv1alpha1.WorkspaceShardEtcdValid))
+	require.Equal(t, tenancyv1alpha1.WorkspaceShardEtcdReasonPrefixConflict, conditions.GetReason(shard, tenancyv1alpha1.WorkspaceShardEtcdValid))
+
+	// distinct prefixes can share an etcd
+	c.etcd = &tenancyv1alpha1.WorkspaceShardEtcd{Endpoints: []string{"https://etcd-0:2379"}, Prefix: "/shards/shard-1"}
+	require.NoError(t, c.register(ctx))
+	shard, err = kcpClient.TenancyV1alpha1().WorkspaceShards().Get(ctx, "shard-1", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.True(t, conditions.IsTrue(shard, tenancyv1alpha1.WorkspaceShardEtcdValid))
+
+	// an embedded etcd is not published
+	c.etcd = nil
+	require.NoError(t, c.register(ctx))
+	shard, err = kcpClient.TenancyV1alpha1().WorkspaceShards().Get(ctx, "shard-1", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Nil(t, shard.Status.Etcd)
+	require.Nil(t, conditions.Get(shard, tenancyv1alpha1.WorkspaceShardEtcdValid))
+}
+
+func TestRegisterLabels(t *testing.T) {
+	ctx := context.Background()
+
+	kcpClient := kcpfake.NewSimpleClientset()
+	c := &Controller{
+		shardName:       "shard-1",
+		rootKubeClient:  kubefake.NewSimpleClientset(),
+		rootKcpClient:   kcpClient,
+		etcdClient:      &fakeKV{},
+		shardLabels:     map[string]string{"topology.kubernetes.io/region": "eu-west-1"},
+		workspaceLister: tenancylister.NewClusterWorkspaceLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})),
+		now:             time.Now,
+	}
+
+	require.NoError(t, c.register(ctx))
+	shard, err := kcpClient.TenancyV1alpha1().WorkspaceShards().Get(ctx, "shard-1", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"topology.kubernetes.io/region": "eu-west-1"}, shard.Labels)
+
+	// labels set by others are kept, the ones of the shard are updated
+	shard.Labels["team"] = "storage"
+	_, err = kcpClient.TenancyV1alpha1().WorkspaceShards().Update(ctx, shard, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	c.shardLabels = map[string]string{"topology.kubernetes.io/region": "eu-west-1", "topology.kubernetes.io/zone": "eu-west-1a"}
+	require.NoError(t, c.register(ctx))
+	shard, err = kcpClient.TenancyV1alpha1().WorkspaceShards().Get(ctx, "shard-1", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"topology.kubernetes.io/region": "eu-west-1", "topology.kubernetes.io/zone": "eu-west-1a", "team": "storage"}, shard.Labels)
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shardregistration
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// DefaultOptions are the default options for the shard registration controller.
+func DefaultOptions() *Options {
+	return &Options{
+		HeartbeatInterval:    30 * time.Second,
+		HeartbeatGracePeriod: 2 * time.Minute,
+	}
+}
+
+// BindOptions binds the shard registration controller options to the flag set.
+func BindOptions(o *Options, fs *pflag.FlagSet) *Options {
+	fs.DurationVar(&o.HeartbeatInterval, "shard-heartbeat-interval", o.HeartbeatInterval, "Interval at which the shard registers its WorkspaceShard with its version, capacity, workspace count and health")
+	fs.DurationVar(&o.HeartbeatGracePeriod, "shard-heartbeat-grace-period", o.HeartbeatGracePeriod, "Time after the last heartbeat of a shard after which no workspaces are scheduled to it")
+	fs.Int64Var(&o.WorkspaceCapacity, "shard-workspace-capacity", o.WorkspaceCapacity, "Number of workspaces after which no more workspaces are scheduled to the shard, 0 for no limit")
+	fs.StringToStringVar(&o.Labels, "shard-labels", o.Labels, "Labels the shard sets on its WorkspaceShard, e.g. topology.kubernetes.io/region=eu-west-1, for workspaces to be placed by")
+	return o
+}
+
+// Options are the options for the shard registration controller.
+type Options struct {
+	HeartbeatInterval    time.Duration
+	HeartbeatGracePeriod time.Duration
+	WorkspaceCapacity    int64
+	Labels               map[string]string
+}
+
+func (o *Options) Validate() error {
+	if o.HeartbeatInterval < time.Second {
+		return fmt.Errorf("--shard-heartbeat-interval must be at least one second")
+	}
+	if o.HeartbeatGracePeriod <= o.HeartbeatInterval {
+		return fmt.Errorf("--shard-heartbeat-grace-period must be longer than --shard-heartbeat-interval")
+	}
+	if o.WorkspaceCapacity < 0 {
+		return fmt.Errorf("--shard-workspace-capacity must not be negative")
+	}
+	if errs := metav1validation.ValidateLabels(o.Labels, field.NewPath("--shard-labels")); len(errs) > 0 {
+		return errs.ToAggregate()
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shardrouting
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clusters"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+	tenancyinformer "github.com/kcp-dev/kcp/pkg/client/informers/externalversions/tenancy/v1alpha1"
+	tenancylister "github.com/kcp-dev/kcp/pkg/client/listers/tenancy/v1alpha1"
+	reconcilermetrics "github.com/kcp-dev/kcp/pkg/reconciler/metrics"
+	"github.com/kcp-dev/kcp/pkg/sharding"
+	"github.com/kcp-dev/kcp/third_party/conditions/util/conditions"
+)
+
+const controllerName = "shardrouting"
+
+// NewController returns a controller keeping the shards of the given loader, to which
+// sharded requests are routed, in sync with the WorkspaceShards of the root workspace:
+// shards are added with the credentials of their WorkspaceShard, read through the given
+// root client, reloaded when these change, and removed with their WorkspaceShard. The
+// shard of the given name is the local one and is never added, and the shards already in
+// the loader, e.g. from a static kubeconfig, are left untouched.
+//
+// If clientTLS is not nil, the shards are reached with it instead of the credentials of
+// their WorkspaceShard, i.e. with the client certificate issued by the shard CA, trusting
+// the serving certificates it issues.
+func NewController(
+	localShardName string,
+	loader *sharding.ClientLoader,
+	clientTLS *rest.TLSClientConfig,
+	rootKubeClient kubernetes.Interface,
+	rootWorkspaceShardInformer tenancyinformer.WorkspaceShardInformer,
+) *Controller {
+	queue := reconcilermetrics.InstrumentQueue(controllerName, workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), controllerName))
+
+	static := map[string]bool{localShardName: true}
+	for name := range loader.Clients() {
+		static[name] = true
+	}
+
+	c := &Controller{
+		queue:                    queue,
+		static:                   static,
+		loader:                   loader,
+		clientTLS:                clientTLS,
+		rootKubeClient:           rootKubeClient,
+		rootWorkspaceShardLister: rootWorkspaceShardInformer.Lister(),
+		loaded:                   map[string]string{},
+	}
+
+	rootWorkspaceShardInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.enqueue(obj) },
+		UpdateFunc: func(_, obj interface{}) { c.enqueue(obj) },
+		DeleteFunc: func(obj interface{}) { c.enqueue(obj) },
+	})
+
+	return c
+}
+
+// Controller loads the credentials of the WorkspaceShards into the shard client loader.
+type Controller struct {
+	queue workqueue.RateLimitingInterface
+
+	// static are the names of the shards not managed by the controller
+	static                   map[string]bool
+	loader                   *sharding.ClientLoader
+	clientTLS                *rest.TLSClientConfig
+	rootKubeClient           kubernetes.Interface
+	rootWorkspaceShardLister tenancylister.WorkspaceShardLister
+
+	lock sync.Mutex
+	// loaded holds the credentials hash of the shards in the loader, by shard name
+	loaded map[string]string
+}
+
+func (c *Controller) enqueue(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	c.queue.Add(key)
+}
+
+func (c *Controller) Start(ctx context.Context, numThreads int) {
+	defer runtime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.Info("Starting shard routing controller")
+	defer klog.Info("Shutting down shard routing controller")
+
+	for i := 0; i < numThreads; i++ {
+		go wait.Until(func() { c.startWorker(ctx) }, time.Second, ctx.Done())
+	}
+
+	<-ctx.Done()
+}
+
+func (c *Controller) startWorker(ctx context.Context) {
+	for c.processNextWorkItem(ctx) {
+	}
+}
+
+func (c *Controller) processNextWorkItem(ctx context.Context) bool {
+	// Wait until there is a new item in the working queue
+	k, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	key := k.(string)
+
+	// No matter what, tell the queue we're done with this key, to unblock
+	// other workers.
+	defer c.queue.Done(key)
+
+	if err := c.process(ctx, key); err != nil {
+		runtime.HandleError(fmt.Errorf("%q controller failed to sync %q, err: %w", controllerName, key, err))
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+func (c *Controller) process(ctx context.Context, key string) error {
+	_, clusterAwareName, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		klog.Errorf("invalid key: %q: %v", key, err)
+		return nil
+	}
+	_, name := clusters.SplitClusterAwareKey(clusterAwareName)
+	if c.static[name] {
+		return nil
+	}
+
+	shard, err := c.rootWorkspaceShardLister.Get(key)
+	if errors.IsNotFound(err) {
+		c.remove(name)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !conditions.IsTrue(shard, tenancyv1alpha1.WorkspaceShardCredentialsValid) {
+		// keep routing with the last valid credentials, the shard might come back
+		return nil
+	}
+
+	c.lock.Lock()
+	hash, found := c.loaded[name]
+	c.lock.Unlock()
+	if found && hash == shard.Status.CredentialsHash {
+		return nil
+	}
+
+	secret, err := c.rootKubeClient.CoreV1().Secrets(shard.Spec.Credentials.Namespace).Get(ctx, shard.Spec.Credentials.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get the credentials of shard %s|%s: %w", helper.RootCluster, name, err)
+	}
+	config, err := clientcmd.RESTConfigFromKubeConfig(secret.Data[tenancyv1alpha1.WorkspaceShardCredentialsKey])
+	if err != nil {
+		klog.Errorf("invalid credentials of shard %s|%s: %v", helper.RootCluster, name, err)
+		return nil // the WorkspaceShard is updated when the credentials are fixed
+	}
+	config.ContentType = "application/json"
+	if c.clientTLS != nil {
+		config = rest.AnonymousClientConfig(config)
+		config.TLSClientConfig = *c.clientTLS
+	}
+
+	klog.Infof("Routing to shard %q at %s", name, config.Host)
+	c.loader.Add(name, config)
+	c.lock.Lock()
+	c.loaded[name] = shard.Status.CredentialsHash
+	c.lock.Unlock()
+	return nil
+}
+
+func (c *Controller) remove(name string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, found := c.loaded[name]; !found {
+		return
+	}
+	klog.Infof("Not routing to removed shard %q anymore", name)
+	c.loader.Remove(name)
+	delete(c.loaded, name)
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shardrouting
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	tenancylister "github.com/kcp-dev/kcp/pkg/client/listers/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/sharding"
+	"github.com/kcp-dev/kcp/third_party/conditions/util/conditions"
+)
+
+func kubeconfig(host string) []byte {
+	return []byte(fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: shard
+  cluster:
+    server: %s
+contexts:
+- name: shard
+  context:
+    cluster: shard
+current-context: shard
+`, host))
+}
+
+func TestProcess(t *testing.T) {
+	ctx := context.Background()
+
+	kubeClient := kubefake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "shard-1-kubeconfig"},
+		Data:       map[string][]byte{tenancyv1alpha1.WorkspaceShardCredentialsKey: kubeconfig("https://shard-1")},
+	})
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	loader := sharding.NewClientLoader()
+	loader.Add("static", &rest.Config{Host: "https://static"})
+	c := &Controller{
+		static:                   map[string]bool{"root": true, "static": true},
+		loader:                   loader,
+		rootKubeClient:           kubeClient,
+		rootWorkspaceShardLister: tenancylister.NewWorkspaceShardLister(indexer),
+		loaded:                   map[string]string{},
+	}
+
+	newShard := func(name, hash string) *tenancyv1alpha1.WorkspaceShard {
+		shard := &tenancyv1alpha1.WorkspaceShard{
+			ObjectMeta: metav1.ObjectMeta{ClusterName: "root", Name: name},
+			Spec: tenancyv1alpha1.WorkspaceShardSpec{
+				Credentials: corev1.SecretReference{Namespace: "default", Name: name + "-kubeconfig"},
+			},
+			Status: tenancyv1alpha1.WorkspaceShardStatus{CredentialsHash: hash},
+		}
+		conditions.MarkTrue(shard, tenancyv1alpha1.WorkspaceShardCredentialsValid)
+		return shard
+	}
+	process := func(obj interface{}) {
+		t.Helper()
+		key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+		require.NoError(t, err)
+		require.NoError(t, c.process(ctx, key))
+	}
+	hosts := func() map[string]string {
+		hosts := map[string]string{}
+		for name, config := range loader.Clients() {
+			hosts[name] = config.Host
+		}
+		return hosts
+	}
+
+	shard := newShard("shard-1", "v1")
+	require.NoError(t, indexer.Add(shard))
+	require.NoError(t, indexer.Add(newShard("root", "v1")))
+	require.NoError(t, indexer.Add(newShard("static", "v1")))
+	for _, obj := range indexer.List() {
+		process(obj)
+	}
+	require.Equal(t, map[string]string{"shard-1": "https://shard-1", "static": "https://static"}, hosts())
+
+	// rotated credentials are reloaded once the WorkspaceShard reflects them
+	secret, err := kubeClient.CoreV1().Secrets("default").Get(ctx, "shard-1-kubeconfig", metav1.GetOptions{})
+	require.NoError(t, err)
+	secret.Data[tenancyv1alpha1.WorkspaceShardCredentialsKey] = kubeconfig("https://shard-1.example.com")
+	_, err = kubeClient.CoreV1().Secrets("default").Update(ctx, secret, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	process(shard)
+	require.Equal(t, "https://shard-1", hosts()["shard-1"])
+	shard = newShard("shard-1", "v2")
+	require.NoError(t, indexer.Update(shard))
+	process(shard)
+	require.Equal(t, "https://shard-1.example.com", hosts()["shard-1"])
+
+	// removed shards are not routed to anymore, static ones are kept
+	for _, obj := range indexer.List() {
+		require.NoError(t, indexer.Delete(obj))
+		process(obj)
+	}
+	require.Equal(t, map[string]string{"static": "https://static"}, hosts())
+}
+
+func TestProcessWithClientTLS(t *testing.T) {
+	ctx := context.Background()
+
+	kubeClient := kubefake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "shard-1-kubeconfig"},
+		Data:       map[string][]byte{tenancyv1alpha1.WorkspaceShardCredentialsKey: kubeconfig("https://shard-1")},
+	})
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	loader := sharding.NewClientLoader()
+	clientTLS := &rest.TLSClientConfig{CAFile: "ca.crt", CertFile: "client.crt", KeyFile: "client.key"}
+	c := &Controller{
+		static:                   map[string]bool{"root": true},
+		loader:                   loader,
+		clientTLS:                clientTLS,
+		rootKubeClient:           kubeClient,
+		rootWorkspaceShardLister: tenancylister.NewWorkspaceShardLister(indexer),
+		loaded:                   map[string]string{},
+	}
+
+	shard := &tenancyv1alpha1.WorkspaceShard{
+		ObjectMeta: metav1.ObjectMeta{ClusterName: "root", Name: "shard-1"},
+		Spec: tenancyv1alpha1.WorkspaceShardSpec{
+			Credentials: corev1.SecretReference{Namespace: "default", Name: "shard-1-kubeconfig"},
+		},
+		Status: tenancyv1alpha1.WorkspaceShardStatus{CredentialsHash: "v1"},
+	}
+	conditions.MarkTrue(shard, tenancyv1alpha1.WorkspaceShardCredentialsValid)
+	require.NoError(t, indexer.Add(shard))
+	key, err := cache.MetaNamespaceKeyFunc(shard)
+	require.NoError(t, err)
+	require.NoError(t, c.process(ctx, key))
+
+	// the shard is reached at the host of its credentials with the client certificate of the shard CA
+	config := loader.Clients()["shard-1"]
+	require.NotNil(t, config)
+	require.Equal(t, "https://shard-1", config.Host)
+	require.Equal(t, *clientTLS, config.TLSClientConfig)
+	require.Empty(t, config.BearerToken)
+}
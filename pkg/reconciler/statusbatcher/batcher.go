@@ -0,0 +1,305 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package statusbatcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	kcpclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
+	reconcilermetrics "github.com/kcp-dev/kcp/pkg/reconciler/metrics"
+)
+
+const (
+	controllerName = "workspace-status-batcher"
+
+	// DefaultWindow is the time status changes of a ClusterWorkspace are collected for
+	// before they are written.
+	DefaultWindow = 200 * time.Millisecond
+	// DefaultQPS is the rate at which status patches are written, across all ClusterWorkspaces.
+	DefaultQPS = 50
+	// DefaultBurst is the number of status patches that can be written at once.
+	DefaultBurst = 100
+)
+
+// patchFunc writes a status merge patch for the named ClusterWorkspace of the given logical cluster.
+type patchFunc func(ctx context.Context, clusterName, name string, patch []byte) error
+
+// NewBatcher returns a Batcher writing status patches with the given client, after
+// collecting the changes of a ClusterWorkspace for the given window, and at most at
+// the given rate.
+func NewBatcher(kcpClusterClient kcpclient.ClusterInterface, window time.Duration, qps float32, burst int) *Batcher {
+	return newBatcher(func(ctx context.Context, clusterName, name string, patch []byte) error {
+		_, err := kcpClusterClient.Cluster(clusterName).TenancyV1alpha1().ClusterWorkspaces().Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{}, "status")
+		return err
+	}, window, flowcontrol.NewTokenBucketRateLimiter(qps, burst))
+}
+
+func newBatcher(patch patchFunc, window time.Duration, limiter flowcontrol.RateLimiter) *Batcher {
+	return &Batcher{
+		queue:   reconcilermetrics.InstrumentQueue(controllerName, workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), controllerName)),
+		patch:   patch,
+		window:  window,
+		limiter: limiter,
+		pending: map[string]*pendingPatch{},
+	}
+}
+
+// Batcher coalesces the status changes the tenancy controllers make to ClusterWorkspaces
+// into fewer writes. Changes computed against the same version of a ClusterWorkspace are
+// merged into a single patch, later changes winning for the fields set by both, which is
+// right as long as every status field is owned by a single controller. Patches are written
+// with the resource version they were computed against as precondition. When that fails
+// because the ClusterWorkspace changed meanwhile, the changes are dropped and the
+// registered requeue functions are called for the ClusterWorkspace, for the controllers
+// to compute them again against the newer version.
+type Batcher struct {
+	queue   workqueue.RateLimitingInterface
+	patch   patchFunc
+	window  time.Duration
+	limiter flowcontrol.RateLimiter
+
+	lock sync.Mutex
+	// pending are the patches not written yet, by ClusterWorkspace key.
+	pending map[string]*pendingPatch
+	// requeues are called with the key of a ClusterWorkspace when its pending changes were dropped.
+	requeues []func(key string)
+}
+
+// pendingPatch is a status merge patch computed against a given resource version of a
+// ClusterWorkspace.
+type pendingPatch struct {
+	clusterName     string
+	name            string
+	uid             types.UID
+	resourceVersion string
+	patch           []byte
+}
+
+// AddRequeueFunc registers a function called with the key of a ClusterWorkspace when the
+// pending changes to its status were dropped.
+func (b *Batcher) AddRequeueFunc(requeue func(key string)) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.requeues = append(b.requeues, requeue)
+}
+
+// Patch queues the changes from the status of old to the status of obj, which is a
+// modified copy of old, to be written with the other changes made to the ClusterWorkspace
+// meanwhile.
+func (b *Batcher) Patch(old, obj *tenancyv1alpha1.ClusterWorkspace) error {
+	if equality.Semantic.DeepEqual(old.Status, obj.Status) {
+		return nil
+	}
+
+	key, err := cache.MetaNamespaceKeyFunc(old)
+	if err != nil {
+		return err
+	}
+	clusterName, name := old.ClusterName, old.Name
+
+	oldData, err := json.Marshal(tenancyv1alpha1.ClusterWorkspace{
+		Status: old.Status,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to Marshal old data for workspace %s|%s: %w", clusterName, name, err)
+	}
+	newData, err := json.Marshal(tenancyv1alpha1.ClusterWorkspace{
+		Status: obj.Status,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to Marshal new data for workspace %s|%s: %w", clusterName, name, err)
+	}
+	patch, err := jsonpatch.CreateMergePatch(oldData, newData)
+	if err != nil {
+		return fmt.Errorf("failed to create patch for workspace %s|%s: %w", clusterName, name, err)
+	}
+
+	b.enqueue(key, &pendingPatch{
+		clusterName:     clusterName,
+		name:            name,
+		uid:             old.UID,
+		resourceVersion: old.ResourceVersion,
+		patch:           patch,
+	})
+	return nil
+}
+
+// enqueue merges the given patch into the pending one of the given key, and schedules
+// writing it at the end of the window if nothing was pending.
+func (b *Batcher) enqueue(key string, p *pendingPatch) {
+	b.lock.Lock()
+	existing, found := b.pending[key]
+	merged, dropped := merge(existing, p)
+	b.pending[key] = merged
+	requeues := b.requeues
+	b.lock.Unlock()
+
+	if dropped {
+		klog.V(4).Infof("Dropping status changes to workspace %s|%s computed against another version", p.clusterName, p.name)
+		for _, requeue := range requeues {
+			requeue(key)
+		}
+	}
+	if !found {
+		b.queue.AddAfter(key, b.window)
+	}
+}
+
+// merge returns the patch applying older then newer. When they were computed against
+// different versions of the ClusterWorkspace, the newer one wins and dropped is true.
+func merge(older, newer *pendingPatch) (merged *pendingPatch, dropped bool) {
+	if older == nil {
+		return newer, false
+	}
+	if older.uid != newer.uid || older.resourceVersion != newer.resourceVersion {
+		return newer, true
+	}
+	patch, err := jsonpatch.MergeMergePatches(older.patch, newer.patch)
+	if err != nil {
+		// shouldn't happen as both are valid merge patches
+		runtime.HandleError(fmt.Errorf("failed to merge status patches for workspace %s|%s: %w", newer.clusterName, newer.name, err))
+		return newer, true
+	}
+	return &pendingPatch{
+		clusterName:     newer.clusterName,
+		name:            newer.name,
+		uid:             newer.uid,
+		resourceVersion: newer.resourceVersion,
+		patch:           patch,
+	}, false
+}
+
+func (b *Batcher) Start(ctx context.Context, numThreads int) {
+	defer runtime.HandleCrash()
+	defer b.queue.ShutDown()
+
+	klog.Info("Starting ClusterWorkspace status batcher")
+	defer klog.Info("Shutting down ClusterWorkspace status batcher")
+
+	for i := 0; i < numThreads; i++ {
+		go wait.Until(func() { b.startWorker(ctx) }, time.Second, ctx.Done())
+	}
+
+	<-ctx.Done()
+}
+
+func (b *Batcher) startWorker(ctx context.Context) {
+	for b.processNextWorkItem(ctx) {
+	}
+}
+
+func (b *Batcher) processNextWorkItem(ctx context.Context) bool {
+	// Wait until there is a new item in the working queue
+	k, quit := b.queue.Get()
+	if quit {
+		return false
+	}
+	key := k.(string)
+
+	// No matter what, tell the queue we're done with this key, to unblock
+	// other workers.
+	defer b.queue.Done(key)
+
+	if err := b.process(ctx, key); err != nil {
+		runtime.HandleError(fmt.Errorf("%q controller failed to sync %q, err: %w", controllerName, key, err))
+		b.queue.AddRateLimited(key)
+		return true
+	}
+	b.queue.Forget(key)
+	return true
+}
+
+// process writes the pending patch of the given key. Changes queued while it is written
+// start a new window.
+func (b *Batcher) process(ctx context.Context, key string) error {
+	b.lock.Lock()
+	p, found := b.pending[key]
+	delete(b.pending, key)
+	b.lock.Unlock()
+	if !found {
+		return nil
+	}
+
+	if err := b.limiter.Wait(ctx); err != nil {
+		b.restore(key, p)
+		return err
+	}
+
+	preconditions, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"uid":             p.uid,
+			"resourceVersion": p.resourceVersion,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to Marshal preconditions for workspace %s|%s: %w", p.clusterName, p.name, err)
+	}
+	// to ensure they appear in the patch as preconditions
+	patch, err := jsonpatch.MergeMergePatches(preconditions, p.patch)
+	if err != nil {
+		return fmt.Errorf("failed to create patch for workspace %s|%s: %w", p.clusterName, p.name, err)
+	}
+
+	klog.V(4).Infof("Patching status of workspace %s|%s: %s", p.clusterName, p.name, string(patch))
+	err = b.patch(ctx, p.clusterName, p.name, patch)
+	switch {
+	case err == nil, errors.IsNotFound(err):
+		return nil
+	case errors.IsConflict(err):
+		klog.V(4).Infof("Dropping status changes to workspace %s|%s computed against an outdated version", p.clusterName, p.name)
+		b.lock.Lock()
+		requeues := b.requeues
+		b.lock.Unlock()
+		for _, requeue := range requeues {
+			requeue(key)
+		}
+		return nil
+	default:
+		b.restore(key, p)
+		return err
+	}
+}
+
+// restore puts back a pending patch that failed to be written, beneath the changes queued
+// meanwhile.
+func (b *Batcher) restore(key string, p *pendingPatch) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if newer, found := b.pending[key]; found {
+		b.pending[key], _ = merge(p, newer)
+		return
+	}
+	b.pending[key] = p
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package statusbatcher
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/flowcontrol"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+)
+
+func TestBatcher(t *testing.T) {
+	workspace := &tenancyv1alpha1.ClusterWorkspace{
+		ObjectMeta: metav1.ObjectMeta{ClusterName: "root:org", Name: "ws", UID: "uid", ResourceVersion: "1"},
+		Status: tenancyv1alpha1.ClusterWorkspaceStatus{
+			Phase:        tenancyv1alpha1.ClusterWorkspacePhaseInitializing,
+			Initializers: []tenancyv1alpha1.ClusterWorkspaceInitializer{"a"},
+		},
+	}
+	key, err := cache.MetaNamespaceKeyFunc(workspace)
+	require.NoError(t, err)
+
+	scheduled := func(ws *tenancyv1alpha1.ClusterWorkspace) *tenancyv1alpha1.ClusterWorkspace {
+		ws = ws.DeepCopy()
+		ws.Status.BaseURL = "https://shard/clusters/org:ws"
+		ws.Status.Location.Current = "shard"
+		return ws
+	}
+	initialized := func(ws *tenancyv1alpha1.ClusterWorkspace) *tenancyv1alpha1.ClusterWorkspace {
+		ws = ws.DeepCopy()
+		ws.Status.Initializers = nil
+		return ws
+	}
+	newer := func(ws *tenancyv1alpha1.ClusterWorkspace) *tenancyv1alpha1.ClusterWorkspace {
+		ws = ws.DeepCopy()
+		ws.ResourceVersion = "2"
+		return ws
+	}
+
+	tests := []struct {
+		name         string
+		changes      func(b *Batcher) error
+		patchErr     error
+		wantPatch    string
+		wantQueued   bool
+		wantRequeued []string
+	}{
+		{
+			name:    "no change",
+			changes: func(b *Batcher) error { return b.Patch(workspace, workspace.DeepCopy()) },
+		},
+		{
+			name: "changes against the same version are merged",
+			changes: func(b *Batcher) error {
+				if err := b.Patch(workspace, scheduled(workspace)); err != nil {
+					return err
+				}
+				return b.Patch(workspace, initialized(workspace))
+			},
+			wantPatch: `{"metadata":{"resourceVersion":"1","uid":"uid"},"status":{"baseURL":"https://shard/clusters/org:ws","initializers":null,"location":{"current":"shard"}}}`,
+		},
+		{
+			name: "changes against another version replace pending ones",
+			changes: func(b *Batcher) error {
+				if err := b.Patch(workspace, scheduled(workspace)); err != nil {
+					return err
+				}
+				return b.Patch(newer(workspace), initialized(newer(workspace)))
+			},
+			wantPatch:    `{"metadata":{"resourceVersion":"2","uid":"uid"},"status":{"initializers":null}}`,
+			wantRequeued: []string{key},
+		},
+		{
+			name:         "conflicts drop the changes",
+			changes:      func(b *Batcher) error { return b.Patch(workspace, scheduled(workspace)) },
+			patchErr:     apierrors.NewConflict(schema.GroupResource{Group: "tenancy.kcp.dev", Resource: "clusterworkspaces"}, "ws", errors.New("conflict")),
+			wantPatch:    `{"metadata":{"resourceVersion":"1","uid":"uid"},"status":{"baseURL":"https://shard/clusters/org:ws","location":{"current":"shard"}}}`,
+			wantRequeued: []string{key},
+		},
+		{
+			name:       "errors keep the changes",
+			changes:    func(b *Batcher) error { return b.Patch(workspace, scheduled(workspace)) },
+			patchErr:   errors.New("boom"),
+			wantPatch:  `{"metadata":{"resourceVersion":"1","uid":"uid"},"status":{"baseURL":"https://shard/clusters/org:ws","location":{"current":"shard"}}}`,
+			wantQueued: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var patches []string
+			b := newBatcher(func(ctx context.Context, clusterName, name string, patch []byte) error {
+				require.Equal(t, "root:org", clusterName)
+				require.Equal(t, "ws", name)
+				patches = append(patches, string(patch))
+				return tt.patchErr
+			}, time.Hour, flowcontrol.NewFakeAlwaysRateLimiter())
+			var requeued []string
+			b.AddRequeueFunc(func(key string) { requeued = append(requeued, key) })
+
+			require.NoError(t, tt.changes(b))
+			err := b.process(context.Background(), key)
+			if tt.patchErr != nil && !apierrors.IsConflict(tt.patchErr) {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			if tt.wantPatch == "" {
+				require.Empty(t, patches)
+			} else {
+				require.Len(t, patches, 1)
+				require.JSONEq(t, tt.wantPatch, patches[0])
+			}
+			_, queued := b.pending[key]
+			require.Equal(t, tt.wantQueued, queued)
+			require.Equal(t, tt.wantRequeued, requeued)
+		})
+	}
+}
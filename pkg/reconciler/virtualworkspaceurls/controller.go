@@ -0,0 +1,447 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virtualworkspaceurls
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clusters"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+	apishelper "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1/helper"
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+	kcpclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
+	apisinformer "github.com/kcp-dev/kcp/pkg/client/informers/externalversions/apis/v1alpha1"
+	tenancyinformer "github.com/kcp-dev/kcp/pkg/client/informers/externalversions/tenancy/v1alpha1"
+	workloadinformer "github.com/kcp-dev/kcp/pkg/client/informers/externalversions/workload/v1alpha1"
+	apislister "github.com/kcp-dev/kcp/pkg/client/listers/apis/v1alpha1"
+	tenancylister "github.com/kcp-dev/kcp/pkg/client/listers/tenancy/v1alpha1"
+	workloadlister "github.com/kcp-dev/kcp/pkg/client/listers/workload/v1alpha1"
+	apiexportbuilder "github.com/kcp-dev/kcp/pkg/virtual/apiexport/builder"
+	syncerbuilder "github.com/kcp-dev/kcp/pkg/virtual/syncer/builder"
+	conditionsapi "github.com/kcp-dev/kcp/third_party/conditions/apis/conditions/v1alpha1"
+	"github.com/kcp-dev/kcp/third_party/conditions/util/conditions"
+)
+
+const (
+	controllerName = "virtualworkspaceurls"
+
+	apiExportKind              = "APIExport"
+	apiExportEndpointSliceKind = "APIExportEndpointSlice"
+	workloadClusterKind        = "WorkloadCluster"
+
+	// keySeparator separates the kind from the object key in queue keys.
+	keySeparator = "|"
+
+	byExport = "byExport"
+)
+
+func NewController(
+	kcpClient kcpclient.ClusterInterface,
+	rootWorkspaceShardInformer tenancyinformer.WorkspaceShardInformer,
+	apiExportInformer apisinformer.APIExportInformer,
+	apiExportEndpointSliceInformer apisinformer.APIExportEndpointSliceInformer,
+	workloadClusterInformer workloadinformer.WorkloadClusterInformer,
+) (*Controller, error) {
+	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), controllerName)
+
+	c := &Controller{
+		queue:                         queue,
+		kcpClient:                     kcpClient,
+		rootWorkspaceShardLister:      rootWorkspaceShardInformer.Lister(),
+		apiExportLister:               apiExportInformer.Lister(),
+		apiExportEndpointSliceLister:  apiExportEndpointSliceInformer.Lister(),
+		apiExportEndpointSliceIndexer: apiExportEndpointSliceInformer.Informer().GetIndexer(),
+		workloadClusterLister:         workloadClusterInformer.Lister(),
+	}
+
+	if err := apiExportEndpointSliceInformer.Informer().AddIndexers(cache.Indexers{
+		byExport: indexByExport,
+	}); err != nil {
+		return nil, err
+	}
+
+	apiExportInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			c.enqueue(apiExportKind, obj)
+			c.enqueueEndpointSlicesOf(obj)
+		},
+		UpdateFunc: func(_, obj interface{}) { c.enqueue(apiExportKind, obj) },
+		DeleteFunc: func(obj interface{}) { c.enqueueEndpointSlicesOf(obj) },
+	})
+	apiExportEndpointSliceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.enqueue(apiExportEndpointSliceKind, obj) },
+		UpdateFunc: func(_, obj interface{}) { c.enqueue(apiExportEndpointSliceKind, obj) },
+	})
+	workloadClusterInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.enqueue(workloadClusterKind, obj) },
+		UpdateFunc: func(_, obj interface{}) { c.enqueue(workloadClusterKind, obj) },
+	})
+	rootWorkspaceShardInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.enqueueAll() },
+		UpdateFunc: func(_, obj interface{}) { c.enqueueAll() },
+		DeleteFunc: func(obj interface{}) { c.enqueueAll() },
+	})
+
+	return c, nil
+}
+
+// Controller watches APIExports, APIExportEndpointSlices, WorkloadClusters and WorkspaceShards
+// in order to publish in the status of APIExports and WorkloadClusters the URLs of their virtual
+// workspaces, one per shard. The APIExport URLs are also published as endpoints of the
+// APIExportEndpointSlices referencing the APIExport.
+type Controller struct {
+	queue workqueue.RateLimitingInterface
+
+	kcpClient                     kcpclient.ClusterInterface
+	rootWorkspaceShardLister      tenancylister.WorkspaceShardLister
+	apiExportLister               apislister.APIExportLister
+	apiExportEndpointSliceLister  apislister.APIExportEndpointSliceLister
+	apiExportEndpointSliceIndexer cache.Indexer
+	workloadClusterLister         workloadlister.WorkloadClusterLister
+}
+
+// indexByExport indexes APIExportEndpointSlices by the cluster-aware key of their APIExport.
+func indexByExport(obj interface{}) ([]string, error) {
+	slice, ok := obj.(*apisv1alpha1.APIExportEndpointSlice)
+	if !ok {
+		return []string{}, fmt.Errorf("obj is supposed to be an APIExportEndpointSlice, but is %T", obj)
+	}
+	clusterName, exportName, ok := apishelper.ExportClusterName(slice.ClusterName, slice.Spec.Export)
+	if !ok {
+		return []string{}, nil
+	}
+	return []string{clusters.ToClusterAwareKey(clusterName, exportName)}, nil
+}
+
+func (c *Controller) enqueue(kind string, obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	klog.Infof("queueing %s %q", kind, key)
+	c.queue.Add(kind + keySeparator + key)
+}
+
+// enqueueEndpointSlicesOf queues the APIExportEndpointSlices referencing the given APIExport,
+// when it is created or deleted.
+func (c *Controller) enqueueEndpointSlicesOf(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	export, ok := obj.(*apisv1alpha1.APIExport)
+	if !ok {
+		runtime.HandleError(fmt.Errorf("obj is supposed to be an APIExport, but is %T", obj))
+		return
+	}
+
+	slices, err := c.apiExportEndpointSliceIndexer.ByIndex(byExport, clusters.ToClusterAwareKey(export.ClusterName, export.Name))
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	for _, slice := range slices {
+		c.enqueue(apiExportEndpointSliceKind, slice)
+	}
+}
+
+// enqueueAll queues all the APIExports, APIExportEndpointSlices and WorkloadClusters, when
+// the shards change.
+func (c *Controller) enqueueAll() {
+	apiExports, err := c.apiExportLister.List(labels.Everything())
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	for _, apiExport := range apiExports {
+		c.enqueue(apiExportKind, apiExport)
+	}
+	slices, err := c.apiExportEndpointSliceLister.List(labels.Everything())
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	for _, slice := range slices {
+		c.enqueue(apiExportEndpointSliceKind, slice)
+	}
+	workloadClusters, err := c.workloadClusterLister.List(labels.Everything())
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	for _, workloadCluster := range workloadClusters {
+		c.enqueue(workloadClusterKind, workloadCluster)
+	}
+}
+
+func (c *Controller) Start(ctx context.Context, numThreads int) {
+	defer runtime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.Info("Starting VirtualWorkspaceURLs controller")
+	defer klog.Info("Shutting down VirtualWorkspaceURLs controller")
+
+	for i := 0; i < numThreads; i++ {
+		go wait.Until(func() { c.startWorker(ctx) }, time.Second, ctx.Done())
+	}
+
+	<-ctx.Done()
+}
+
+func (c *Controller) startWorker(ctx context.Context) {
+	for c.processNextWorkItem(ctx) {
+	}
+}
+
+func (c *Controller) processNextWorkItem(ctx context.Context) bool {
+	// Wait until there is a new item in the working queue
+	k, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	key := k.(string)
+
+	klog.Infof("processing key %q", key)
+
+	// No matter what, tell the queue we're done with this key, to unblock
+	// other workers.
+	defer c.queue.Done(key)
+
+	if err := c.process(ctx, key); err != nil {
+		runtime.HandleError(fmt.Errorf("%q controller failed to sync %q, err: %w", controllerName, key, err))
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+func (c *Controller) process(ctx context.Context, queueKey string) error {
+	parts := strings.SplitN(queueKey, keySeparator, 2)
+	if len(parts) != 2 {
+		klog.Errorf("invalid key: %q", queueKey)
+		return nil
+	}
+	kind, key := parts[0], parts[1]
+	_, clusterAwareName, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		klog.Errorf("invalid key: %q: %v", key, err)
+		return nil
+	}
+	clusterName, name := clusters.SplitClusterAwareKey(clusterAwareName)
+
+	shards, err := c.rootWorkspaceShardLister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+
+	switch kind {
+	case apiExportKind:
+		obj, err := c.apiExportLister.Get(key)
+		if errors.IsNotFound(err) {
+			return nil // object deleted before we handled it
+		} else if err != nil {
+			return err
+		}
+
+		var virtualWorkspaces []apisv1alpha1.VirtualWorkspace
+		for _, u := range virtualWorkspaceURLs(shards, apiexportbuilder.DefaultRootPathPrefix, clusterName, name) {
+			virtualWorkspaces = append(virtualWorkspaces, apisv1alpha1.VirtualWorkspace{URL: u})
+		}
+		if equality.Semantic.DeepEqual(obj.Status.VirtualWorkspaces, virtualWorkspaces) {
+			return nil
+		}
+		patchBytes, err := statusPatch(obj.UID, obj.ResourceVersion, obj.Status.VirtualWorkspaces, virtualWorkspaces)
+		if err != nil {
+			return fmt.Errorf("failed to create patch for APIExport %s|%s: %w", clusterName, name, err)
+		}
+		_, err = c.kcpClient.Cluster(clusterName).ApisV1alpha1().APIExports().Patch(ctx, name, types.MergePatchType, patchBytes, metav1.PatchOptions{}, "status")
+		return err
+
+	case apiExportEndpointSliceKind:
+		obj, err := c.apiExportEndpointSliceLister.Get(key)
+		if errors.IsNotFound(err) {
+			return nil // object deleted before we handled it
+		} else if err != nil {
+			return err
+		}
+
+		slice := obj.DeepCopy()
+		if err := c.reconcileEndpointSlice(slice, shards); err != nil {
+			return err
+		}
+		if equality.Semantic.DeepEqual(obj.Status, slice.Status) {
+			return nil
+		}
+		patchBytes, err := endpointSliceStatusPatch(obj, slice)
+		if err != nil {
+			return fmt.Errorf("failed to create patch for APIExportEndpointSlice %s|%s: %w", clusterName, name, err)
+		}
+		_, err = c.kcpClient.Cluster(clusterName).ApisV1alpha1().APIExportEndpointSlices().Patch(ctx, name, types.MergePatchType, patchBytes, metav1.PatchOptions{}, "status")
+		return err
+
+	case workloadClusterKind:
+		obj, err := c.workloadClusterLister.Get(key)
+		if errors.IsNotFound(err) {
+			return nil // object deleted before we handled it
+		} else if err != nil {
+			return err
+		}
+
+		var virtualWorkspaces []workloadv1alpha1.VirtualWorkspace
+		for _, u := range virtualWorkspaceURLs(shards, syncerbuilder.DefaultRootPathPrefix, clusterName, name) {
+			virtualWorkspaces = append(virtualWorkspaces, workloadv1alpha1.VirtualWorkspace{URL: u})
+		}
+		if equality.Semantic.DeepEqual(obj.Status.VirtualWorkspaces, virtualWorkspaces) {
+			return nil
+		}
+		patchBytes, err := statusPatch(obj.UID, obj.ResourceVersion, obj.Status.VirtualWorkspaces, virtualWorkspaces)
+		if err != nil {
+			return fmt.Errorf("failed to create patch for WorkloadCluster %s|%s: %w", clusterName, name, err)
+		}
+		_, err = c.kcpClient.Cluster(clusterName).WorkloadV1alpha1().WorkloadClusters().Patch(ctx, name, types.MergePatchType, patchBytes, metav1.PatchOptions{}, "status")
+		return err
+	}
+
+	klog.Errorf("unknown kind %q in key %q", kind, queueKey)
+	return nil
+}
+
+// reconcileEndpointSlice sets the endpoints of the slice to the virtual workspace URLs of the
+// referenced APIExport, or clears them if the APIExport cannot be found.
+func (c *Controller) reconcileEndpointSlice(slice *apisv1alpha1.APIExportEndpointSlice, shards []*tenancyv1alpha1.WorkspaceShard) error {
+	exportClusterName, exportName, ok := apishelper.ExportClusterName(slice.ClusterName, slice.Spec.Export)
+	if !ok {
+		slice.Status.Endpoints = nil
+		conditions.MarkFalse(slice, apisv1alpha1.APIExportValid, apisv1alpha1.APIExportInvalidReferenceReason, conditionsapi.ConditionSeverityError, "The APIExport reference could not be resolved.")
+		return nil
+	}
+
+	_, err := c.apiExportLister.Get(clusters.ToClusterAwareKey(exportClusterName, exportName))
+	if errors.IsNotFound(err) {
+		slice.Status.Endpoints = nil
+		conditions.MarkFalse(slice, apisv1alpha1.APIExportValid, apisv1alpha1.APIExportNotFoundReason, conditionsapi.ConditionSeverityError, "APIExport %s|%s not found.", exportClusterName, exportName)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var endpoints []apisv1alpha1.APIExportEndpoint
+	for _, u := range virtualWorkspaceURLs(shards, apiexportbuilder.DefaultRootPathPrefix, exportClusterName, exportName) {
+		endpoints = append(endpoints, apisv1alpha1.APIExportEndpoint{URL: u})
+	}
+	slice.Status.Endpoints = endpoints
+	conditions.MarkTrue(slice, apisv1alpha1.APIExportValid)
+	return nil
+}
+
+// endpointSliceStatusPatch returns a merge patch from the status of the old slice to the
+// status of the new one, with the UID and resource version of the slice as preconditions.
+func endpointSliceStatusPatch(oldSlice, newSlice *apisv1alpha1.APIExportEndpointSlice) ([]byte, error) {
+	type object struct {
+		metav1.ObjectMeta `json:"metadata,omitempty"`
+		Status            apisv1alpha1.APIExportEndpointSliceStatus `json:"status"`
+	}
+
+	oldData, err := json.Marshal(object{Status: oldSlice.Status})
+	if err != nil {
+		return nil, err
+	}
+	newData, err := json.Marshal(object{
+		ObjectMeta: metav1.ObjectMeta{
+			UID:             oldSlice.UID,
+			ResourceVersion: oldSlice.ResourceVersion,
+		}, // to ensure they appear in the patch as preconditions
+		Status: newSlice.Status,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jsonpatch.CreateMergePatch(oldData, newData)
+}
+
+// statusPatch returns a merge patch setting status.virtualWorkspaces, with the UID and
+// resource version of the object as preconditions.
+func statusPatch(uid types.UID, resourceVersion string, previous, current interface{}) ([]byte, error) {
+	type status struct {
+		VirtualWorkspaces interface{} `json:"virtualWorkspaces"`
+	}
+	type object struct {
+		metav1.ObjectMeta `json:"metadata,omitempty"`
+		Status            status `json:"status"`
+	}
+
+	oldData, err := json.Marshal(object{Status: status{VirtualWorkspaces: previous}})
+	if err != nil {
+		return nil, err
+	}
+	newData, err := json.Marshal(object{
+		ObjectMeta: metav1.ObjectMeta{
+			UID:             uid,
+			ResourceVersion: resourceVersion,
+		}, // to ensure they appear in the patch as preconditions
+		Status: status{VirtualWorkspaces: current},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jsonpatch.CreateMergePatch(oldData, newData)
+}
+
+// virtualWorkspaceURLs returns the URLs of the virtual workspace of the given object
+// on each shard with a known address, sorted by shard name.
+func virtualWorkspaceURLs(shards []*tenancyv1alpha1.WorkspaceShard, rootPathPrefix, clusterName, name string) []string {
+	sorted := make([]*tenancyv1alpha1.WorkspaceShard, len(shards))
+	copy(sorted, shards)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	var urls []string
+	for _, shard := range sorted {
+		if shard.Status.ConnectionInfo == nil || shard.Status.ConnectionInfo.Host == "" {
+			continue
+		}
+		u, err := url.Parse(shard.Status.ConnectionInfo.Host)
+		if err != nil {
+			klog.Errorf("invalid host %q of shard %q: %v", shard.Status.ConnectionInfo.Host, shard.Name, err)
+			continue
+		}
+		u.Path = path.Join(u.Path, rootPathPrefix, clusterName, name)
+		urls = append(urls, u.String())
+	}
+	return urls
+}
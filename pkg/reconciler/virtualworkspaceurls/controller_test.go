@@ -0,0 +1,121 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virtualworkspaceurls
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	apislister "github.com/kcp-dev/kcp/pkg/client/listers/apis/v1alpha1"
+	"github.com/kcp-dev/kcp/third_party/conditions/util/conditions"
+)
+
+func newShard(name, host string) *tenancyv1alpha1.WorkspaceShard {
+	shard := &tenancyv1alpha1.WorkspaceShard{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	if host != "" {
+		shard.Status.ConnectionInfo = &tenancyv1alpha1.ConnectionInfo{Host: host}
+	}
+	return shard
+}
+
+func TestVirtualWorkspaceURLs(t *testing.T) {
+	shards := []*tenancyv1alpha1.WorkspaceShard{
+		newShard("beta", "https://beta.example.com:6443"),
+		newShard("alpha", "https://alpha.example.com/prefix"),
+		newShard("pending", ""),
+	}
+
+	got := virtualWorkspaceURLs(shards, "/services/syncer", "acme:team", "us-east1")
+	want := []string{
+		"https://alpha.example.com/prefix/services/syncer/acme:team/us-east1",
+		"https://beta.example.com:6443/services/syncer/acme:team/us-east1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("virtualWorkspaceURLs() = %v, want %v", got, want)
+	}
+}
+
+func TestReconcileEndpointSlice(t *testing.T) {
+	shards := []*tenancyv1alpha1.WorkspaceShard{
+		newShard("beta", "https://beta.example.com:6443"),
+		newShard("alpha", "https://alpha.example.com"),
+	}
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := indexer.Add(&apisv1alpha1.APIExport{ObjectMeta: metav1.ObjectMeta{ClusterName: "acme:provider", Name: "cowboys"}}); err != nil {
+		t.Fatal(err)
+	}
+	c := &Controller{apiExportLister: apislister.NewAPIExportLister(indexer)}
+
+	for _, tt := range []struct {
+		name          string
+		export        apisv1alpha1.ExportReference
+		wantValid     bool
+		wantReason    string
+		wantEndpoints []apisv1alpha1.APIExportEndpoint
+	}{
+		{
+			name: "existing export",
+			export: apisv1alpha1.ExportReference{
+				Workspace: &apisv1alpha1.WorkspaceExportReference{WorkspaceName: "provider", ExportName: "cowboys"},
+			},
+			wantValid: true,
+			wantEndpoints: []apisv1alpha1.APIExportEndpoint{
+				{URL: "https://alpha.example.com/services/apiexport/acme:provider/cowboys"},
+				{URL: "https://beta.example.com:6443/services/apiexport/acme:provider/cowboys"},
+			},
+		},
+		{
+			name: "missing export",
+			export: apisv1alpha1.ExportReference{
+				Workspace: &apisv1alpha1.WorkspaceExportReference{WorkspaceName: "provider", ExportName: "horses"},
+			},
+			wantReason: apisv1alpha1.APIExportNotFoundReason,
+		},
+		{
+			name:       "no reference",
+			wantReason: apisv1alpha1.APIExportInvalidReferenceReason,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			slice := &apisv1alpha1.APIExportEndpointSlice{
+				ObjectMeta: metav1.ObjectMeta{ClusterName: "acme:consumer", Name: "slice"},
+				Spec:       apisv1alpha1.APIExportEndpointSliceSpec{Export: tt.export},
+				Status: apisv1alpha1.APIExportEndpointSliceStatus{
+					Endpoints: []apisv1alpha1.APIExportEndpoint{{URL: "https://stale.example.com"}},
+				},
+			}
+			if err := c.reconcileEndpointSlice(slice, shards); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(slice.Status.Endpoints, tt.wantEndpoints) {
+				t.Errorf("endpoints = %v, want %v", slice.Status.Endpoints, tt.wantEndpoints)
+			}
+			if got := conditions.IsTrue(slice, apisv1alpha1.APIExportValid); got != tt.wantValid {
+				t.Errorf("APIExportValid = %v, want %v", got, tt.wantValid)
+			}
+			if got := conditions.GetReason(slice, apisv1alpha1.APIExportValid); got != tt.wantReason {
+				t.Errorf("APIExportValid reason = %q, want %q", got, tt.wantReason)
+			}
+		})
+	}
+}
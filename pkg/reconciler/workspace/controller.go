@@ -18,7 +18,6 @@ package workspace
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/url"
 	"path"
@@ -26,13 +25,9 @@ import (
 	"strings"
 	"time"
 
-	jsonpatch "github.com/evanphx/json-patch"
-
 	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
-	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/rand"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
@@ -43,9 +38,11 @@ import (
 
 	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
 	tenancyhelper "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
-	kcpclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
 	tenancyinformer "github.com/kcp-dev/kcp/pkg/client/informers/externalversions/tenancy/v1alpha1"
 	tenancylister "github.com/kcp-dev/kcp/pkg/client/listers/tenancy/v1alpha1"
+	reconcilermetrics "github.com/kcp-dev/kcp/pkg/reconciler/metrics"
+	"github.com/kcp-dev/kcp/pkg/reconciler/statusbatcher"
+	"github.com/kcp-dev/kcp/pkg/workspacetype"
 	conditionsv1alpha1 "github.com/kcp-dev/kcp/third_party/conditions/apis/conditions/v1alpha1"
 	"github.com/kcp-dev/kcp/third_party/conditions/util/conditions"
 )
@@ -54,28 +51,44 @@ const (
 	currentShardIndex  = "shard"
 	unschedulableIndex = "unschedulable"
 	controllerName     = "workspace"
+
+	// shardFullReason is the reason for not scheduling workspaces to a shard at capacity.
+	shardFullReason = "ShardFull"
+	// placementMismatchReason is the reason for not scheduling workspaces to a shard not
+	// satisfying their required placement.
+	placementMismatchReason = "PlacementMismatch"
+
+	// maxReconcileRounds bounds the number of times a workspace is reconciled on top of
+	// its own changes before they are written.
+	maxReconcileRounds = 5
 )
 
 func NewController(
-	kcpClient kcpclient.ClusterInterface,
+	statusBatcher *statusbatcher.Batcher,
 	workspaceInformer tenancyinformer.ClusterWorkspaceInformer,
 	rootWorkspaceShardInformer tenancyinformer.WorkspaceShardInformer,
+	typeResolver *workspacetype.Resolver,
+	shardHeartbeatGracePeriod time.Duration,
 ) (*Controller, error) {
-	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), controllerName)
+	queue := reconcilermetrics.InstrumentQueue(controllerName, workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), controllerName))
 
 	c := &Controller{
 		queue:                     queue,
-		kcpClient:                 kcpClient,
+		statusBatcher:             statusBatcher,
 		workspaceIndexer:          workspaceInformer.Informer().GetIndexer(),
 		workspaceLister:           workspaceInformer.Lister(),
 		rootWorkspaceShardIndexer: rootWorkspaceShardInformer.Informer().GetIndexer(),
 		rootWorkspaceShardLister:  rootWorkspaceShardInformer.Lister(),
+		typeResolver:              typeResolver,
+		shardHeartbeatGracePeriod: shardHeartbeatGracePeriod,
+		now:                       time.Now,
 	}
 
 	workspaceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc:    func(obj interface{}) { c.enqueue(obj) },
 		UpdateFunc: func(_, obj interface{}) { c.enqueue(obj) },
 	})
+	statusBatcher.AddRequeueFunc(func(key string) { c.queue.Add(key) })
 	if err := c.workspaceIndexer.AddIndexers(map[string]cache.IndexFunc{
 		currentShardIndex: func(obj interface{}) ([]string, error) {
 			if workspace, ok := obj.(*tenancyv1alpha1.ClusterWorkspace); ok {
@@ -85,8 +98,11 @@ func NewController(
 		},
 		unschedulableIndex: func(obj interface{}) ([]string, error) {
 			if workspace, ok := obj.(*tenancyv1alpha1.ClusterWorkspace); ok {
-				if conditions.IsFalse(workspace, tenancyv1alpha1.WorkspaceScheduled) && conditions.GetReason(workspace, tenancyv1alpha1.WorkspaceScheduled) == tenancyv1alpha1.WorkspaceReasonUnschedulable {
-					return []string{"true"}, nil
+				if conditions.IsFalse(workspace, tenancyv1alpha1.WorkspaceScheduled) {
+					switch conditions.GetReason(workspace, tenancyv1alpha1.WorkspaceScheduled) {
+					case tenancyv1alpha1.WorkspaceReasonUnschedulable, tenancyv1alpha1.WorkspaceReasonPlacementUnsatisfiable:
+						return []string{"true"}, nil
+					}
 				}
 			}
 			return []string{}, nil
@@ -109,12 +125,20 @@ func NewController(
 type Controller struct {
 	queue workqueue.RateLimitingInterface
 
-	kcpClient        kcpclient.ClusterInterface
+	statusBatcher    *statusbatcher.Batcher
 	workspaceIndexer cache.Indexer
 	workspaceLister  tenancylister.ClusterWorkspaceLister
 
 	rootWorkspaceShardIndexer cache.Indexer
 	rootWorkspaceShardLister  tenancylister.WorkspaceShardLister
+
+	// typeResolver resolves the ClusterWorkspaceTypes of workspaces for their placement.
+	typeResolver *workspacetype.Resolver
+
+	// shardHeartbeatGracePeriod is the time after the last heartbeat of a registered shard
+	// after which it is not valid anymore.
+	shardHeartbeatGracePeriod time.Duration
+	now                       func() time.Time
 }
 
 func (c *Controller) enqueue(obj interface{}) {
@@ -224,13 +248,6 @@ func (c *Controller) processNextWorkItem(ctx context.Context) bool {
 }
 
 func (c *Controller) process(ctx context.Context, key string) error {
-	namespace, clusterAwareName, err := cache.SplitMetaNamespaceKey(key)
-	if err != nil {
-		klog.Errorf("invalid key: %q: %v", key, err)
-		return nil
-	}
-	clusterName, name := clusters.SplitClusterAwareKey(clusterAwareName)
-
 	obj, err := c.workspaceLister.Get(key) // TODO: clients need a way to scope down the lister per-cluster
 	if err != nil {
 		if errors.IsNotFound(err) {
@@ -241,44 +258,31 @@ func (c *Controller) process(ctx context.Context, key string) error {
 	previous := obj
 	obj = obj.DeepCopy()
 
-	if err := c.reconcile(ctx, obj); err != nil {
-		return err
-	}
-
-	// If the object being reconciled changed as a result, update it.
-	if !equality.Semantic.DeepEqual(previous.Status, obj.Status) {
-		oldData, err := json.Marshal(tenancyv1alpha1.ClusterWorkspace{
-			Status: previous.Status,
-		})
-		if err != nil {
-			return fmt.Errorf("failed to Marshal old data for workspace %s|%s/%s: %w", clusterName, namespace, name, err)
-		}
-
-		newData, err := json.Marshal(tenancyv1alpha1.ClusterWorkspace{
-			ObjectMeta: metav1.ObjectMeta{
-				UID:             previous.UID,
-				ResourceVersion: previous.ResourceVersion,
-			}, // to ensure they appear in the patch as preconditions
-			Status: obj.Status,
-		})
-		if err != nil {
-			return fmt.Errorf("failed to Marshal new data for workspace %s|%s/%s: %w", clusterName, namespace, name, err)
+	// Reconcile on top of our own changes until they settle, in order to write the phases
+	// the workspace goes through at once. Stop at the transition to initializing though,
+	// which admission must see in order to add the initializers of the workspace type.
+	for i := 0; i < maxReconcileRounds; i++ {
+		status := obj.Status.DeepCopy()
+		if err := c.reconcile(ctx, obj); err != nil {
+			return err
 		}
-
-		patchBytes, err := jsonpatch.CreateMergePatch(oldData, newData)
-		if err != nil {
-			return fmt.Errorf("failed to create patch for workspace %s|%s/%s: %w", clusterName, namespace, name, err)
+		if obj.Status.Phase == tenancyv1alpha1.ClusterWorkspacePhaseInitializing || equality.Semantic.DeepEqual(*status, obj.Status) {
+			break
 		}
-		_, uerr := c.kcpClient.Cluster(clusterName).TenancyV1alpha1().ClusterWorkspaces().Patch(ctx, obj.Name, types.MergePatchType, patchBytes, metav1.PatchOptions{}, "status")
-		return uerr
 	}
 
-	return nil
+	// If the object being reconciled changed as a result, update it.
+	return c.statusBatcher.Patch(previous, obj)
 }
 
 func (c *Controller) reconcile(ctx context.Context, workspace *tenancyv1alpha1.ClusterWorkspace) error {
 	switch workspace.Status.Phase {
 	case tenancyv1alpha1.ClusterWorkspacePhaseScheduling:
+		placements, err := c.typeResolver.Placements(workspace.ClusterName, workspace)
+		if err != nil {
+			return err
+		}
+
 		// possibly de-schedule while still in scheduling phase
 		if current := workspace.Status.Location.Current; current != "" {
 			// make sure current shard still exists
@@ -288,10 +292,16 @@ func (c *Controller) reconcile(ctx context.Context, workspace *tenancyv1alpha1.C
 				workspace.Status.BaseURL = ""
 			} else if err != nil {
 				return err
-			} else if valid, _, _ := isValidShard(shard); !valid {
+			} else if valid, _, _ := c.isValidShard(shard); !valid {
 				klog.Infof("De-scheduling workspace %s|%s from invalid shard %q", tenancyhelper.RootCluster, workspace.Name, current)
 				workspace.Status.Location.Current = ""
 				workspace.Status.BaseURL = ""
+			} else if satisfied, err := workspacetype.SatisfiesPlacements(shard, placements); err != nil {
+				return err
+			} else if !satisfied {
+				klog.Infof("De-scheduling workspace %s|%s from shard %q not satisfying its placement", tenancyhelper.RootCluster, workspace.Name, current)
+				workspace.Status.Location.Current = ""
+				workspace.Status.BaseURL = ""
 			}
 		}
 
@@ -302,13 +312,37 @@ func (c *Controller) reconcile(ctx context.Context, workspace *tenancyv1alpha1.C
 				return err
 			}
 
+			// only keep the valid shards satisfying the placement with the highest score
 			validShards := make([]*tenancyv1alpha1.WorkspaceShard, 0, len(shards))
+			var validScore int64
+			placementMismatches := 0
 			invalidShards := map[string]struct {
 				reason, message string
 			}{}
 			for _, shard := range shards {
-				if valid, reason, message := isValidShard(shard); valid {
-					validShards = append(validShards, shard)
+				valid, reason, message := c.isValidShard(shard)
+				if valid {
+					valid, reason, message = hasCapacity(shard)
+				}
+				if valid {
+					if valid, err = workspacetype.SatisfiesPlacements(shard, placements); err != nil {
+						return err
+					} else if !valid {
+						reason, message = placementMismatchReason, "WorkspaceShard does not satisfy the required placement of the workspace or of its type."
+						placementMismatches++
+					}
+				}
+				if valid {
+					score, err := workspacetype.PlacementScore(shard, placements)
+					if err != nil {
+						return err
+					}
+					if len(validShards) == 0 || score > validScore {
+						validShards, validScore = validShards[:0], score
+					}
+					if score == validScore {
+						validShards = append(validShards, shard)
+					}
 				} else {
 					invalidShards[shard.Name] = struct {
 						reason, message string
@@ -320,7 +354,7 @@ func (c *Controller) reconcile(ctx context.Context, workspace *tenancyv1alpha1.C
 			}
 
 			if len(validShards) > 0 {
-				targetShard := shards[rand.Intn(len(shards))]
+				targetShard := validShards[rand.Intn(len(validShards))]
 
 				u, err := url.Parse(targetShard.Status.ConnectionInfo.Host)
 				if err != nil {
@@ -341,6 +375,8 @@ func (c *Controller) reconcile(ctx context.Context, workspace *tenancyv1alpha1.C
 
 				conditions.MarkTrue(workspace, tenancyv1alpha1.WorkspaceScheduled)
 				klog.Infof("Scheduled workspace %s|%s to %s|%s", workspace.ClusterName, workspace.Name, targetShard.ClusterName, targetShard.Name)
+			} else if placementMismatches > 0 {
+				conditions.MarkFalse(workspace, tenancyv1alpha1.WorkspaceScheduled, tenancyv1alpha1.WorkspaceReasonPlacementUnsatisfiable, conditionsv1alpha1.ConditionSeverityError, "No available shards satisfy the placement of the workspace.")
 			} else {
 				conditions.MarkFalse(workspace, tenancyv1alpha1.WorkspaceScheduled, tenancyv1alpha1.WorkspaceReasonUnschedulable, conditionsv1alpha1.ConditionSeverityError, "No available shards to schedule the workspace.")
 				failures := make([]string, 0, len(invalidShards))
@@ -406,7 +442,7 @@ func (c *Controller) reconcile(ctx context.Context, workspace *tenancyv1alpha1.C
 			conditions.MarkFalse(workspace, tenancyv1alpha1.WorkspaceShardValid, tenancyv1alpha1.WorkspaceShardValidReasonShardNotFound, conditionsv1alpha1.ConditionSeverityError, fmt.Sprintf("WorkspaceShard %q got deleted.", workspace.Status.Location.Current))
 		} else if err != nil {
 			return err
-		} else if valid, reason, message := isValidShard(shard); !valid {
+		} else if valid, reason, message := c.isValidShard(shard); !valid {
 			conditions.MarkFalse(workspace, tenancyv1alpha1.WorkspaceShardValid, reason, conditionsv1alpha1.ConditionSeverityError, message)
 		} else {
 			conditions.MarkTrue(workspace, tenancyv1alpha1.WorkspaceShardValid)
@@ -429,7 +465,7 @@ func (c *Controller) reconcile(ctx context.Context, workspace *tenancyv1alpha1.C
 	return nil
 }
 
-func isValidShard(shard *tenancyv1alpha1.WorkspaceShard) (valid bool, reason, message string) {
+func (c *Controller) isValidShard(shard *tenancyv1alpha1.WorkspaceShard) (valid bool, reason, message string) {
 	if !conditions.IsTrue(shard, tenancyv1alpha1.WorkspaceShardCredentialsValid) {
 		return false, tenancyv1alpha1.WorkspaceShardValidReasonMissingCredentials, "Invalid connection information on target WorkspaceShard."
 	}
@@ -442,5 +478,25 @@ func isValidShard(shard *tenancyv1alpha1.WorkspaceShard) (valid bool, reason, me
 	if _, err := url.Parse(shard.Status.ConnectionInfo.Host); err != nil {
 		return false, tenancyv1alpha1.WorkspaceShardValidReasonURLInvalid, fmt.Sprintf("Invalid host on target WorkspaceShard: %v.", err)
 	}
+	// shards registering themselves are only valid while they heartbeat and report being healthy
+	if heartbeat := shard.Status.LastHeartbeatTime; heartbeat != nil && c.now().Sub(heartbeat.Time) > c.shardHeartbeatGracePeriod {
+		return false, tenancyv1alpha1.WorkspaceShardValidReasonUnhealthy, fmt.Sprintf("WorkspaceShard missed its heartbeats since %s.", heartbeat.Time.Format(time.RFC3339))
+	}
+	if conditions.IsFalse(shard, tenancyv1alpha1.WorkspaceShardHealthy) {
+		return false, tenancyv1alpha1.WorkspaceShardValidReasonUnhealthy, fmt.Sprintf("WorkspaceShard is unhealthy: %s.", conditions.GetMessage(shard, tenancyv1alpha1.WorkspaceShardHealthy))
+	}
+	if conditions.IsFalse(shard, tenancyv1alpha1.WorkspaceShardEtcdValid) {
+		return false, tenancyv1alpha1.WorkspaceShardValidReasonEtcdConflict, fmt.Sprintf("WorkspaceShard has an invalid etcd: %s", conditions.GetMessage(shard, tenancyv1alpha1.WorkspaceShardEtcdValid))
+	}
 	return true, "", ""
 }
+
+// hasCapacity returns whether new workspaces can be scheduled to the given shard, i.e. whether
+// it stores less workspaces than its registered "workspaces" capacity, if any.
+func hasCapacity(shard *tenancyv1alpha1.WorkspaceShard) (ok bool, reason, message string) {
+	capacity, found := shard.Status.Capacity[tenancyv1alpha1.WorkspaceShardWorkspacesCapacity]
+	if !found || shard.Status.WorkspaceCount < capacity.Value() {
+		return true, "", ""
+	}
+	return false, shardFullReason, fmt.Sprintf("WorkspaceShard stores %d workspaces out of a capacity of %s.", shard.Status.WorkspaceCount, capacity.String())
+}
@@ -0,0 +1,510 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package workspacedeletion deletes the child workspaces and the content of the logical
+// cluster of deleted ClusterWorkspaces, before removing their deletion finalizer.
+//
+// The child workspaces and the content are retained for the retention period of the
+// workspace first, during which the workspace is labeled as purgeable, unless an early
+// purge is requested through the purge annotation, or its parent workspace is purged.
+//
+// The child workspaces are deleted first, in the foreground, such that whole subtrees are
+// deleted bottom-up. Then the cluster-scoped objects of the logical cluster are deleted,
+// including its namespaces the content of which is purged by the namespace controller,
+// and finally its CustomResourceDefinitions and APIBindings, once the objects of the APIs
+// they serve had the chance to be finalized.
+package workspacedeletion
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clusters"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+	tenancyinformer "github.com/kcp-dev/kcp/pkg/client/informers/externalversions/tenancy/v1alpha1"
+	tenancylister "github.com/kcp-dev/kcp/pkg/client/listers/tenancy/v1alpha1"
+	reconcilermetrics "github.com/kcp-dev/kcp/pkg/reconciler/metrics"
+	"github.com/kcp-dev/kcp/pkg/reconciler/statusbatcher"
+	conditionsv1alpha1 "github.com/kcp-dev/kcp/third_party/conditions/apis/conditions/v1alpha1"
+	"github.com/kcp-dev/kcp/third_party/conditions/util/conditions"
+)
+
+const (
+	controllerName = "workspace-deletion"
+
+	byLogicalClusterIndex = "workspacedeletion-by-logical-cluster"
+
+	// pollInterval is how often the deletion of the child workspaces and of the content
+	// of a deleted workspace is checked, as the content is not watched.
+	pollInterval = 5 * time.Second
+)
+
+var (
+	clusterWorkspaces = tenancyv1alpha1.SchemeGroupVersion.WithResource("clusterworkspaces")
+
+	// skippedResources are not deleted as content: child workspaces are deleted first,
+	// and Workspaces are projections of them.
+	skippedResources = sets.NewString(
+		tenancyv1alpha1.Resource("clusterworkspaces").String(),
+		schema.GroupResource{Group: tenancyv1alpha1.SchemeGroupVersion.Group, Resource: "workspaces"}.String(),
+	)
+
+	// lateResources serve the APIs of the logical cluster, and are deleted after the rest
+	// of the content.
+	lateResources = sets.NewString(
+		apiextensionsv1.Resource("customresourcedefinitions").String(),
+		apisv1alpha1.Resource("apibindings").String(),
+	)
+)
+
+type clusterDiscovery interface {
+	WithCluster(name string) discovery.DiscoveryInterface
+}
+
+// NewController returns a controller deleting the child workspaces and the content of
+// deleted ClusterWorkspaces carrying the deletion finalizer.
+func NewController(
+	dynamicClusterClient dynamic.ClusterInterface,
+	disco clusterDiscovery,
+	statusBatcher *statusbatcher.Batcher,
+	workspaceInformer tenancyinformer.ClusterWorkspaceInformer,
+	retention *RetentionPolicy,
+) (*Controller, error) {
+	queue := reconcilermetrics.InstrumentQueue(controllerName, workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), controllerName))
+
+	c := &Controller{
+		queue:                queue,
+		dynamicClusterClient: dynamicClusterClient,
+		statusBatcher:        statusBatcher,
+		workspaceIndexer:     workspaceInformer.Informer().GetIndexer(),
+		workspaceLister:      workspaceInformer.Lister(),
+		retention:            retention,
+		now:                  time.Now,
+		clusterScopedResources: func(clusterName string) ([]schema.GroupVersionResource, error) {
+			return clusterScopedResources(disco.WithCluster(clusterName))
+		},
+	}
+
+	workspaceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.enqueue(obj) },
+		UpdateFunc: func(_, obj interface{}) { c.enqueue(obj) },
+		DeleteFunc: func(obj interface{}) { c.enqueueParent(obj) },
+	})
+	statusBatcher.AddRequeueFunc(func(key string) { c.queue.Add(key) })
+	if _, found := c.workspaceIndexer.GetIndexers()[byLogicalClusterIndex]; !found {
+		if err := c.workspaceIndexer.AddIndexers(cache.Indexers{
+			byLogicalClusterIndex: func(obj interface{}) ([]string, error) {
+				if workspace, ok := obj.(*tenancyv1alpha1.ClusterWorkspace); ok {
+					return []string{workspace.ClusterName}, nil
+				}
+				return []string{}, nil
+			},
+		}); err != nil {
+			return nil, fmt.Errorf("failed to add indexer for ClusterWorkspace: %w", err)
+		}
+	}
+
+	return c, nil
+}
+
+// Controller deletes the child workspaces and the content of deleted ClusterWorkspaces,
+// reporting its progress in the WorkspaceContentDeleted condition, and then removes their
+// deletion finalizer.
+type Controller struct {
+	queue workqueue.RateLimitingInterface
+
+	dynamicClusterClient dynamic.ClusterInterface
+	statusBatcher        *statusbatcher.Batcher
+	workspaceIndexer     cache.Indexer
+	workspaceLister      tenancylister.ClusterWorkspaceLister
+	retention            *RetentionPolicy
+	now                  func() time.Time
+
+	// clusterScopedResources returns the cluster-scoped resources of the given logical
+	// cluster supporting list and delete.
+	clusterScopedResources func(clusterName string) ([]schema.GroupVersionResource, error)
+}
+
+func (c *Controller) enqueue(obj interface{}) {
+	workspace, ok := obj.(*tenancyv1alpha1.ClusterWorkspace)
+	if !ok || workspace.DeletionTimestamp.IsZero() {
+		return
+	}
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	klog.V(2).Infof("Queueing deleted workspace %q", key)
+	c.queue.Add(key)
+}
+
+// enqueueParent queues the workspace of the logical cluster of a deleted workspace, which
+// might wait for its child workspaces to be gone.
+func (c *Controller) enqueueParent(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	workspace, ok := obj.(*tenancyv1alpha1.ClusterWorkspace)
+	if !ok || workspace.ClusterName == helper.RootCluster || strings.HasPrefix(workspace.ClusterName, helper.LocalSystemClusterPrefix) {
+		return // the root and system logical clusters have no workspace
+	}
+	parentClusterName, err := helper.ParentClusterName(workspace.ClusterName)
+	if err != nil {
+		return
+	}
+	_, name, err := helper.ParseLogicalClusterName(workspace.ClusterName)
+	if err != nil {
+		return
+	}
+	c.queue.Add(clusters.ToClusterAwareKey(parentClusterName, name))
+}
+
+func (c *Controller) Start(ctx context.Context, numThreads int) {
+	defer runtime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.Info("Starting workspace deletion controller")
+	defer klog.Info("Shutting down workspace deletion controller")
+
+	for i := 0; i < numThreads; i++ {
+		go wait.Until(func() { c.startWorker(ctx) }, time.Second, ctx.Done())
+	}
+
+	<-ctx.Done()
+}
+
+func (c *Controller) startWorker(ctx context.Context) {
+	for c.processNextWorkItem(ctx) {
+	}
+}
+
+func (c *Controller) processNextWorkItem(ctx context.Context) bool {
+	// Wait until there is a new item in the working queue
+	k, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	key := k.(string)
+
+	klog.V(4).Infof("processing key %q", key)
+
+	// No matter what, tell the queue we're done with this key, to unblock
+	// other workers.
+	defer c.queue.Done(key)
+
+	if err := c.process(ctx, key); err != nil {
+		runtime.HandleError(fmt.Errorf("%q controller failed to sync %q, err: %w", controllerName, key, err))
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+func (c *Controller) process(ctx context.Context, key string) error {
+	obj, err := c.workspaceLister.Get(key)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil // object deleted before we handled it
+		}
+		return err
+	}
+	if obj.DeletionTimestamp.IsZero() || !sets.NewString(obj.Finalizers...).Has(tenancyv1alpha1.ClusterWorkspaceDeletionFinalizer) {
+		return nil
+	}
+	previous := obj
+	obj = obj.DeepCopy()
+
+	if until, retained := c.retainedUntil(obj); retained {
+		conditions.MarkFalse(obj, tenancyv1alpha1.WorkspaceContentDeleted, tenancyv1alpha1.WorkspaceContentDeletedReasonRetained, conditionsv1alpha1.ConditionSeverityInfo, "Retained until %s", until.UTC().Format(time.RFC3339))
+		if err := c.statusBatcher.Patch(previous, obj); err != nil {
+			return err
+		}
+		if err := c.setPurgeable(ctx, previous, &until); err != nil {
+			return err
+		}
+		c.queue.AddAfter(key, until.Sub(c.now()))
+		return nil
+	}
+	if _, purgeable := previous.Labels[tenancyv1alpha1.ClusterWorkspacePurgeableLabel]; purgeable {
+		// the update requeues the workspace to be purged
+		return c.setPurgeable(ctx, previous, nil)
+	}
+
+	done, reconcileErr := c.reconcile(ctx, obj)
+	if done {
+		return c.removeFinalizer(ctx, previous)
+	}
+	if err := c.statusBatcher.Patch(previous, obj); err != nil {
+		return err
+	}
+	if reconcileErr != nil {
+		return reconcileErr
+	}
+	c.queue.AddAfter(key, pollInterval)
+	return nil
+}
+
+// retainedUntil returns the end of the retention period of the given deleted workspace,
+// and whether it is not over yet. Workspaces with the purge annotation, or the parent
+// workspace of which is purged, are not retained.
+func (c *Controller) retainedUntil(workspace *tenancyv1alpha1.ClusterWorkspace) (time.Time, bool) {
+	if workspace.Annotations[tenancyv1alpha1.ClusterWorkspacePurgeAnnotation] == "true" {
+		return time.Time{}, false
+	}
+	if parent := c.parentWorkspace(workspace); parent != nil && !parent.DeletionTimestamp.IsZero() {
+		if _, retained := c.retainedUntil(parent); !retained {
+			return time.Time{}, false
+		}
+	}
+	clusterName, err := helper.EncodeLogicalClusterName(workspace)
+	if err != nil {
+		return time.Time{}, false
+	}
+	until := workspace.DeletionTimestamp.Add(c.retention.For(clusterName, workspace.Spec.Type))
+	return until, c.now().Before(until)
+}
+
+// parentWorkspace returns the workspace of the logical cluster of the given workspace, or
+// nil if it is not known to this shard.
+func (c *Controller) parentWorkspace(workspace *tenancyv1alpha1.ClusterWorkspace) *tenancyv1alpha1.ClusterWorkspace {
+	if workspace.ClusterName == helper.RootCluster || strings.HasPrefix(workspace.ClusterName, helper.LocalSystemClusterPrefix) {
+		return nil
+	}
+	parentClusterName, err := helper.ParentClusterName(workspace.ClusterName)
+	if err != nil {
+		return nil
+	}
+	_, name, err := helper.ParseLogicalClusterName(workspace.ClusterName)
+	if err != nil {
+		return nil
+	}
+	obj, exists, err := c.workspaceIndexer.GetByKey(clusters.ToClusterAwareKey(parentClusterName, name))
+	if err != nil || !exists {
+		return nil
+	}
+	parent, _ := obj.(*tenancyv1alpha1.ClusterWorkspace)
+	return parent
+}
+
+// setPurgeable labels the given workspace as purgeable until the given time, or removes
+// the label if nil.
+func (c *Controller) setPurgeable(ctx context.Context, workspace *tenancyv1alpha1.ClusterWorkspace, until *time.Time) error {
+	var label, annotation interface{}
+	if until != nil {
+		label, annotation = "true", until.UTC().Format(time.RFC3339)
+	}
+	currentLabel, hasLabel := workspace.Labels[tenancyv1alpha1.ClusterWorkspacePurgeableLabel]
+	currentAnnotation, hasAnnotation := workspace.Annotations[tenancyv1alpha1.ClusterWorkspacePurgeAfterAnnotation]
+	if (until == nil && !hasLabel && !hasAnnotation) || (until != nil && currentLabel == label && currentAnnotation == annotation) {
+		return nil
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels":      map[string]interface{}{tenancyv1alpha1.ClusterWorkspacePurgeableLabel: label},
+			"annotations": map[string]interface{}{tenancyv1alpha1.ClusterWorkspacePurgeAfterAnnotation: annotation},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal purgeable patch for workspace %s|%s: %w", workspace.ClusterName, workspace.Name, err)
+	}
+	if until == nil {
+		klog.Infof("Purging workspace %s|%s", workspace.ClusterName, workspace.Name)
+	}
+	_, err = c.dynamicClusterClient.Cluster(workspace.ClusterName).Resource(clusterWorkspaces).Patch(ctx, workspace.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// reconcile deletes the child workspaces of the given deleted workspace, and then the
+// content of its logical cluster. It returns true once both are gone.
+func (c *Controller) reconcile(ctx context.Context, workspace *tenancyv1alpha1.ClusterWorkspace) (bool, error) {
+	clusterName, err := helper.EncodeLogicalClusterName(workspace)
+	if err != nil {
+		return false, err
+	}
+
+	children, err := c.workspaceIndexer.ByIndex(byLogicalClusterIndex, clusterName)
+	if err != nil {
+		return false, err
+	}
+	if len(children) > 0 {
+		if err := c.deleteChildren(ctx, clusterName, children); err != nil {
+			conditions.MarkFalse(workspace, tenancyv1alpha1.WorkspaceContentDeleted, tenancyv1alpha1.WorkspaceContentDeletedReasonDeletionFailed, conditionsv1alpha1.ConditionSeverityError, "%v", err)
+			return false, err
+		}
+		conditions.MarkFalse(workspace, tenancyv1alpha1.WorkspaceContentDeleted, tenancyv1alpha1.WorkspaceContentDeletedReasonDeletingWorkspaces, conditionsv1alpha1.ConditionSeverityInfo, "Deleting %d child workspaces", len(children))
+		return false, nil
+	}
+
+	resources, err := c.clusterScopedResources(clusterName)
+	if err != nil {
+		conditions.MarkFalse(workspace, tenancyv1alpha1.WorkspaceContentDeleted, tenancyv1alpha1.WorkspaceContentDeletedReasonDeletionFailed, conditionsv1alpha1.ConditionSeverityError, "Failed to discover the resources of logical cluster %s: %v", clusterName, err)
+		return false, err
+	}
+	var content, late []schema.GroupVersionResource
+	for _, gvr := range resources {
+		switch {
+		case skippedResources.Has(gvr.GroupResource().String()):
+		case lateResources.Has(gvr.GroupResource().String()):
+			late = append(late, gvr)
+		default:
+			content = append(content, gvr)
+		}
+	}
+	for _, resources := range [][]schema.GroupVersionResource{content, late} {
+		remaining, err := c.deleteContent(ctx, clusterName, resources)
+		if err != nil {
+			conditions.MarkFalse(workspace, tenancyv1alpha1.WorkspaceContentDeleted, tenancyv1alpha1.WorkspaceContentDeletedReasonDeletionFailed, conditionsv1alpha1.ConditionSeverityError, "%v", err)
+			return false, err
+		}
+		if remaining > 0 {
+			conditions.MarkFalse(workspace, tenancyv1alpha1.WorkspaceContentDeleted, tenancyv1alpha1.WorkspaceContentDeletedReasonDeletingContent, conditionsv1alpha1.ConditionSeverityInfo, "Waiting for %d objects to be deleted", remaining)
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// deleteChildren deletes the given child workspaces in the foreground, such that their
+// own child workspaces are deleted before them.
+func (c *Controller) deleteChildren(ctx context.Context, clusterName string, children []interface{}) error {
+	policy := metav1.DeletePropagationForeground
+	for _, obj := range children {
+		child, ok := obj.(*tenancyv1alpha1.ClusterWorkspace)
+		if !ok {
+			continue
+		}
+		if !child.DeletionTimestamp.IsZero() {
+			// children deleted before are purged with their parent
+			c.queue.Add(clusters.ToClusterAwareKey(clusterName, child.Name))
+			continue
+		}
+		klog.Infof("Deleting child workspace %s|%s of deleted workspace", clusterName, child.Name)
+		err := c.dynamicClusterClient.Cluster(clusterName).Resource(clusterWorkspaces).Delete(ctx, child.Name, metav1.DeleteOptions{
+			PropagationPolicy: &policy,
+			Preconditions:     &metav1.Preconditions{UID: &child.UID},
+		})
+		if err != nil && !errors.IsNotFound(err) && !errors.IsConflict(err) {
+			return fmt.Errorf("failed to delete child workspace %s|%s: %w", clusterName, child.Name, err)
+		}
+	}
+	return nil
+}
+
+// deleteContent deletes the objects of the given cluster-scoped resources of the given
+// logical cluster, and returns the number of objects not gone yet.
+func (c *Controller) deleteContent(ctx context.Context, clusterName string, resources []schema.GroupVersionResource) (int, error) {
+	remaining := 0
+	for _, gvr := range resources {
+		client := c.dynamicClusterClient.Cluster(clusterName).Resource(gvr)
+		list, err := client.List(ctx, metav1.ListOptions{})
+		if errors.IsNotFound(err) || errors.IsMethodNotSupported(err) {
+			continue // the resource went away meanwhile
+		} else if err != nil {
+			return 0, fmt.Errorf("failed to list %s of logical cluster %s: %w", gvr.GroupResource(), clusterName, err)
+		}
+		for i := range list.Items {
+			obj := &list.Items[i]
+			remaining++
+			if obj.GetDeletionTimestamp() != nil {
+				continue
+			}
+			klog.V(2).Infof("Deleting %s %s|%s of deleted workspace", gvr.GroupResource(), clusterName, obj.GetName())
+			uid := obj.GetUID()
+			err := client.Delete(ctx, obj.GetName(), metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &uid}})
+			if errors.IsNotFound(err) {
+				remaining--
+			} else if err != nil && !errors.IsConflict(err) {
+				return 0, fmt.Errorf("failed to delete %s %s of logical cluster %s: %w", gvr.GroupResource(), obj.GetName(), clusterName, err)
+			}
+		}
+	}
+	return remaining, nil
+}
+
+// removeFinalizer removes the deletion finalizer from the given workspace, failing if it
+// changed meanwhile. The foregroundDeletion finalizer of workspaces deleted with their
+// subtree is removed too, as the garbage collector does not handle cluster-scoped owners,
+// and the child workspaces are gone.
+func (c *Controller) removeFinalizer(ctx context.Context, workspace *tenancyv1alpha1.ClusterWorkspace) error {
+	var finalizers []string
+	for _, finalizer := range workspace.Finalizers {
+		if finalizer != tenancyv1alpha1.ClusterWorkspaceDeletionFinalizer && finalizer != metav1.FinalizerDeleteDependents {
+			finalizers = append(finalizers, finalizer)
+		}
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"finalizers":      finalizers,
+			"resourceVersion": workspace.ResourceVersion,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal finalizer patch for workspace %s|%s: %w", workspace.ClusterName, workspace.Name, err)
+	}
+	klog.Infof("Removing the deletion finalizer of workspace %s|%s, its child workspaces and content are gone", workspace.ClusterName, workspace.Name)
+	_, err = c.dynamicClusterClient.Cluster(workspace.ClusterName).Resource(clusterWorkspaces).Patch(ctx, workspace.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// clusterScopedResources returns the preferred versions of the cluster-scoped resources
+// supporting list and delete, excluding subresources, failing if any API group could not be discovered, as its
+// objects would be left behind.
+func clusterScopedResources(disco discovery.DiscoveryInterface) ([]schema.GroupVersionResource, error) {
+	lists, err := disco.ServerPreferredResources()
+	if err != nil {
+		return nil, err
+	}
+	lists = discovery.FilteredBy(discovery.ResourcePredicateFunc(func(groupVersion string, r *metav1.APIResource) bool {
+		return !r.Namespaced && !strings.Contains(r.Name, "/") && sets.NewString(r.Verbs...).HasAll("list", "delete")
+	}), lists)
+	gvrs, err := discovery.GroupVersionResources(lists)
+	if err != nil {
+		return nil, err
+	}
+	resources := make([]schema.GroupVersionResource, 0, len(gvrs))
+	for gvr := range gvrs {
+		resources = append(resources, gvr)
+	}
+	return resources, nil
+}
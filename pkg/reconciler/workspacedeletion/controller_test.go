@@ -0,0 +1,292 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workspacedeletion
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/third_party/conditions/util/conditions"
+)
+
+var (
+	namespaces = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+	crds       = schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+)
+
+// fakeClusterClient serves every logical cluster from its own fake client.
+type fakeClusterClient map[string]*dynamicfake.FakeDynamicClient
+
+func (c fakeClusterClient) Cluster(name string) dynamic.Interface {
+	return c[name]
+}
+
+func newClient(objs ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		namespaces:        "NamespaceList",
+		crds:              "CustomResourceDefinitionList",
+		clusterWorkspaces: "ClusterWorkspaceList",
+	}, objs...)
+}
+
+func object(gvr schema.GroupVersionResource, kind, name string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion(gvr.GroupVersion().String())
+	u.SetKind(kind)
+	u.SetName(name)
+	return u
+}
+
+func deletedWorkspace(clusterName, name string) *tenancyv1alpha1.ClusterWorkspace {
+	now := metav1.Now()
+	return &tenancyv1alpha1.ClusterWorkspace{ObjectMeta: metav1.ObjectMeta{
+		ClusterName:       clusterName,
+		Name:              name,
+		ResourceVersion:   "1",
+		DeletionTimestamp: &now,
+		Finalizers:        []string{tenancyv1alpha1.ClusterWorkspaceDeletionFinalizer},
+	}}
+}
+
+func newController(t *testing.T, clients fakeClusterClient, workspaces ...*tenancyv1alpha1.ClusterWorkspace) *Controller {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{
+		byLogicalClusterIndex: func(obj interface{}) ([]string, error) {
+			return []string{obj.(*tenancyv1alpha1.ClusterWorkspace).ClusterName}, nil
+		},
+	})
+	for _, ws := range workspaces {
+		require.NoError(t, indexer.Add(ws))
+	}
+	return &Controller{
+		queue:                workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		dynamicClusterClient: clients,
+		workspaceIndexer:     indexer,
+		now:                  time.Now,
+		clusterScopedResources: func(clusterName string) ([]schema.GroupVersionResource, error) {
+			return []schema.GroupVersionResource{clusterWorkspaces, namespaces, crds}, nil
+		},
+	}
+}
+
+func deletedNames(client *dynamicfake.FakeDynamicClient, gvr schema.GroupVersionResource) []string {
+	var names []string
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "delete" && action.GetResource() == gvr {
+			names = append(names, action.(clienttesting.DeleteAction).GetName())
+		}
+	}
+	return names
+}
+
+func TestReconcile(t *testing.T) {
+	t.Run("deletes the child workspaces first", func(t *testing.T) {
+		deletingChild := deletedWorkspace("root:org", "deleting")
+		clients := fakeClusterClient{"root:org": newClient(
+			object(clusterWorkspaces, "ClusterWorkspace", "child"),
+			object(namespaces, "Namespace", "default"),
+		)}
+		ws := deletedWorkspace("root", "org")
+		c := newController(t, clients, ws, deletingChild, &tenancyv1alpha1.ClusterWorkspace{
+			ObjectMeta: metav1.ObjectMeta{ClusterName: "root:org", Name: "child"},
+		})
+
+		done, err := c.reconcile(context.Background(), ws)
+		require.NoError(t, err)
+		require.False(t, done)
+		require.Equal(t, []string{"child"}, deletedNames(clients["root:org"], clusterWorkspaces))
+		require.Empty(t, deletedNames(clients["root:org"], namespaces))
+		require.Equal(t, tenancyv1alpha1.WorkspaceContentDeletedReasonDeletingWorkspaces, conditions.GetReason(ws, tenancyv1alpha1.WorkspaceContentDeleted))
+	})
+
+	t.Run("deletes the content before the APIs", func(t *testing.T) {
+		clients := fakeClusterClient{"root:org": newClient(
+			object(namespaces, "Namespace", "default"),
+			object(crds, "CustomResourceDefinition", "widgets.example.io"),
+		)}
+		ws := deletedWorkspace("root", "org")
+		c := newController(t, clients, ws)
+
+		done, err := c.reconcile(context.Background(), ws)
+		require.NoError(t, err)
+		require.False(t, done)
+		require.Equal(t, []string{"default"}, deletedNames(clients["root:org"], namespaces))
+		require.Empty(t, deletedNames(clients["root:org"], crds))
+		require.Equal(t, tenancyv1alpha1.WorkspaceContentDeletedReasonDeletingContent, conditions.GetReason(ws, tenancyv1alpha1.WorkspaceContentDeleted))
+
+		clients["root:org"].ClearActions()
+		done, err = c.reconcile(context.Background(), ws)
+		require.NoError(t, err)
+		require.False(t, done)
+		require.Equal(t, []string{"widgets.example.io"}, deletedNames(clients["root:org"], crds))
+
+		done, err = c.reconcile(context.Background(), ws)
+		require.NoError(t, err)
+		require.True(t, done)
+	})
+
+	t.Run("does not delete objects being deleted again", func(t *testing.T) {
+		ns := object(namespaces, "Namespace", "default")
+		now := metav1.Now()
+		ns.SetDeletionTimestamp(&now)
+		clients := fakeClusterClient{"root:org": newClient(ns)}
+		ws := deletedWorkspace("root", "org")
+		c := newController(t, clients, ws)
+
+		done, err := c.reconcile(context.Background(), ws)
+		require.NoError(t, err)
+		require.False(t, done)
+		require.Empty(t, deletedNames(clients["root:org"], namespaces))
+		require.Contains(t, conditions.GetMessage(ws, tenancyv1alpha1.WorkspaceContentDeleted), "1 objects")
+	})
+}
+
+func TestRemoveFinalizer(t *testing.T) {
+	u := object(clusterWorkspaces, "ClusterWorkspace", "org")
+	u.SetFinalizers([]string{metav1.FinalizerDeleteDependents, "other", tenancyv1alpha1.ClusterWorkspaceDeletionFinalizer})
+	clients := fakeClusterClient{"root": newClient(u)}
+	c := newController(t, clients)
+
+	ws := deletedWorkspace("root", "org")
+	ws.Finalizers = []string{metav1.FinalizerDeleteDependents, "other", tenancyv1alpha1.ClusterWorkspaceDeletionFinalizer}
+	require.NoError(t, c.removeFinalizer(context.Background(), ws))
+
+	patched, err := clients["root"].Resource(clusterWorkspaces).Get(context.Background(), "org", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"other"}, patched.GetFinalizers())
+}
+
+func TestRetainedUntil(t *testing.T) {
+	deletedAt := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	deleted := func(clusterName, name, workspaceType string, annotations map[string]string) *tenancyv1alpha1.ClusterWorkspace {
+		ws := deletedWorkspace(clusterName, name)
+		ws.DeletionTimestamp = &metav1.Time{Time: deletedAt}
+		ws.Spec.Type = workspaceType
+		ws.Annotations = annotations
+		return ws
+	}
+	retention := &RetentionPolicy{
+		Default:   time.Hour,
+		ByType:    map[string]time.Duration{"Team": 24 * time.Hour},
+		ByCluster: map[string]time.Duration{"root:compliance": 0},
+	}
+
+	tests := []struct {
+		name         string
+		workspace    *tenancyv1alpha1.ClusterWorkspace
+		workspaces   []*tenancyv1alpha1.ClusterWorkspace
+		now          time.Time
+		wantUntil    time.Time
+		wantRetained bool
+	}{
+		{
+			name:         "retained for the default retention",
+			workspace:    deleted("root:org", "ws", "Universal", nil),
+			now:          deletedAt.Add(time.Minute),
+			wantUntil:    deletedAt.Add(time.Hour),
+			wantRetained: true,
+		},
+		{
+			name:      "purged after the retention",
+			workspace: deleted("root:org", "ws", "Universal", nil),
+			now:       deletedAt.Add(time.Hour),
+			wantUntil: deletedAt.Add(time.Hour),
+		},
+		{
+			name:         "retained for the retention of its type",
+			workspace:    deleted("root:org", "ws", "Team", nil),
+			now:          deletedAt.Add(2 * time.Hour),
+			wantUntil:    deletedAt.Add(24 * time.Hour),
+			wantRetained: true,
+		},
+		{
+			name:      "the retention of an ancestor logical cluster takes precedence",
+			workspace: deleted("root:compliance", "team", "Team", nil),
+			now:       deletedAt,
+			wantUntil: deletedAt,
+		},
+		{
+			name:      "purged early on request",
+			workspace: deleted("root:org", "ws", "Universal", map[string]string{tenancyv1alpha1.ClusterWorkspacePurgeAnnotation: "true"}),
+			now:       deletedAt,
+		},
+		{
+			name:       "purged with its parent",
+			workspace:  deleted("org:team", "ws", "Team", nil),
+			workspaces: []*tenancyv1alpha1.ClusterWorkspace{deleted("root:org", "team", "Universal", nil)},
+			now:        deletedAt.Add(2 * time.Hour),
+		},
+		{
+			name:         "retained with its parent",
+			workspace:    deleted("org:team", "ws", "Universal", nil),
+			workspaces:   []*tenancyv1alpha1.ClusterWorkspace{deleted("root:org", "team", "Team", nil)},
+			now:          deletedAt.Add(time.Minute),
+			wantUntil:    deletedAt.Add(time.Hour),
+			wantRetained: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newController(t, fakeClusterClient{}, append(tt.workspaces, tt.workspace)...)
+			c.retention = retention
+			c.now = func() time.Time { return tt.now }
+
+			until, retained := c.retainedUntil(tt.workspace)
+			require.Equal(t, tt.wantRetained, retained)
+			require.True(t, tt.wantUntil.Equal(until), "expected %s, got %s", tt.wantUntil, until)
+		})
+	}
+}
+
+func TestSetPurgeable(t *testing.T) {
+	u := object(clusterWorkspaces, "ClusterWorkspace", "org")
+	clients := fakeClusterClient{"root": newClient(u)}
+	c := newController(t, clients)
+
+	ws := deletedWorkspace("root", "org")
+	until := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, c.setPurgeable(context.Background(), ws, &until))
+	patched, err := clients["root"].Resource(clusterWorkspaces).Get(context.Background(), "org", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{tenancyv1alpha1.ClusterWorkspacePurgeableLabel: "true"}, patched.GetLabels())
+	require.Equal(t, map[string]string{tenancyv1alpha1.ClusterWorkspacePurgeAfterAnnotation: "2022-06-01T00:00:00Z"}, patched.GetAnnotations())
+
+	ws.Labels = patched.GetLabels()
+	ws.Annotations = patched.GetAnnotations()
+	clients["root"].ClearActions()
+	require.NoError(t, c.setPurgeable(context.Background(), ws, &until))
+	require.Empty(t, clients["root"].Actions(), "unchanged labels must not be patched")
+
+	require.NoError(t, c.setPurgeable(context.Background(), ws, nil))
+	patched, err = clients["root"].Resource(clusterWorkspaces).Get(context.Background(), "org", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Empty(t, patched.GetLabels())
+	require.Empty(t, patched.GetAnnotations())
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workspacedeletion
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// DefaultOptions are the default options for the workspace deletion controller.
+func DefaultOptions() *Options {
+	return &Options{}
+}
+
+// BindOptions binds the workspace deletion controller options to the flag set.
+func BindOptions(o *Options, fs *pflag.FlagSet) *Options {
+	fs.DurationVar(&o.Retention, "deleted-workspace-retention", o.Retention, "Duration the child workspaces and content of deleted workspaces are retained before they are purged, unless overridden by --deleted-workspace-type-retentions or --deleted-workspace-retentions")
+	fs.StringSliceVar(&o.TypeRetentions, "deleted-workspace-type-retentions", o.TypeRetentions, "Retention of deleted workspaces per workspace type, comma separated, in the format type=duration, e.g. Team=24h, overriding --deleted-workspace-retention")
+	fs.StringSliceVar(&o.ClusterRetentions, "deleted-workspace-retentions", o.ClusterRetentions, "Retention of deleted workspaces per logical cluster, comma separated, in the format logical-cluster=duration, e.g. root:org=720h. A retention applies to the workspace of the logical cluster and its descendants, the retention of the closest ancestor taking precedence, and overrides the retention of workspace types")
+	return o
+}
+
+// Options are the options for the workspace deletion controller.
+type Options struct {
+	Retention         time.Duration
+	TypeRetentions    []string
+	ClusterRetentions []string
+}
+
+func (o *Options) Validate() error {
+	if o.Retention < 0 {
+		return fmt.Errorf("--deleted-workspace-retention must not be negative")
+	}
+	_, err := o.RetentionPolicy()
+	return err
+}
+
+// RetentionPolicy returns the retention policy of deleted workspaces the options describe.
+func (o *Options) RetentionPolicy() (*RetentionPolicy, error) {
+	byType, err := parseRetentions(o.TypeRetentions, "--deleted-workspace-type-retentions", false)
+	if err != nil {
+		return nil, err
+	}
+	byCluster, err := parseRetentions(o.ClusterRetentions, "--deleted-workspace-retentions", true)
+	if err != nil {
+		return nil, err
+	}
+	return &RetentionPolicy{Default: o.Retention, ByType: byType, ByCluster: byCluster}, nil
+}
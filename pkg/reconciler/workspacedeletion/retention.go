@@ -0,0 +1,84 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workspacedeletion
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+)
+
+// RetentionPolicy holds how long the child workspaces and content of deleted workspaces
+// are retained before they are purged.
+type RetentionPolicy struct {
+	// Default is the retention of workspaces not matched by ByType or ByCluster.
+	Default time.Duration
+	// ByType are the retentions by workspace type.
+	ByType map[string]time.Duration
+	// ByCluster are the retentions of the workspaces of logical clusters and of their
+	// descendants, taking precedence over ByType.
+	ByCluster map[string]time.Duration
+}
+
+// For returns the retention of the workspace of the given logical cluster and type.
+func (p *RetentionPolicy) For(clusterName, workspaceType string) time.Duration {
+	if p == nil {
+		return 0
+	}
+	for clusterName != "" {
+		if retention, ok := p.ByCluster[clusterName]; ok {
+			return retention
+		}
+		if clusterName == helper.RootCluster {
+			break
+		}
+		parent, err := helper.ParentClusterName(clusterName)
+		if err != nil {
+			break
+		}
+		clusterName = parent
+	}
+	if retention, ok := p.ByType[workspaceType]; ok {
+		return retention
+	}
+	return p.Default
+}
+
+// parseRetentions parses retentions in the format <key>=<duration>, keyed by workspace
+// type or by logical cluster.
+func parseRetentions(settings []string, flag string, byCluster bool) (map[string]time.Duration, error) {
+	ret := map[string]time.Duration{}
+	for _, setting := range settings {
+		tokens := strings.SplitN(setting, "=", 2)
+		if len(tokens) != 2 || tokens[0] == "" {
+			return nil, fmt.Errorf("invalid %s setting, expected <key>=<duration>: %s", flag, setting)
+		}
+		if byCluster {
+			if _, _, err := helper.ParseLogicalClusterName(tokens[0]); err != nil {
+				return nil, fmt.Errorf("invalid %s setting %s: %w", flag, setting, err)
+			}
+		}
+		retention, err := time.ParseDuration(tokens[1])
+		if err != nil || retention < 0 {
+			return nil, fmt.Errorf("invalid %s setting %s: the retention must be a non-negative duration", flag, setting)
+		}
+		ret[tokens[0]] = retention
+	}
+	return ret, nil
+}
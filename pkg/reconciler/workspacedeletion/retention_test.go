@@ -0,0 +1,70 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workspacedeletion
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetentionPolicy(t *testing.T) {
+	o := &Options{
+		Retention:         time.Hour,
+		TypeRetentions:    []string{"Team=24h"},
+		ClusterRetentions: []string{"root:org=720h", "org:restricted=0s"},
+	}
+	require.NoError(t, o.Validate())
+	policy, err := o.RetentionPolicy()
+	require.NoError(t, err)
+
+	require.Equal(t, time.Hour, policy.For("root:other", "Universal"))
+	require.Equal(t, 24*time.Hour, policy.For("root:other", "Team"))
+	require.Equal(t, 720*time.Hour, policy.For("root:org", "Organization"))
+	require.Equal(t, 720*time.Hour, policy.For("org:team", "Team"))
+	require.Equal(t, time.Duration(0), policy.For("org:restricted", "Team"))
+
+	var nilPolicy *RetentionPolicy
+	require.Equal(t, time.Duration(0), nilPolicy.For("root:org", "Team"))
+}
+
+func TestParseRetentions(t *testing.T) {
+	tests := []struct {
+		name      string
+		settings  []string
+		byCluster bool
+		wantErr   bool
+	}{
+		{name: "valid types", settings: []string{"Team=1h", "Universal=0s"}},
+		{name: "valid clusters", settings: []string{"root=1h", "root:org=24h"}, byCluster: true},
+		{name: "missing duration", settings: []string{"Team"}, wantErr: true},
+		{name: "invalid duration", settings: []string{"Team=forever"}, wantErr: true},
+		{name: "negative duration", settings: []string{"Team=-1h"}, wantErr: true},
+		{name: "invalid logical cluster", settings: []string{"a:b:c=1h"}, byCluster: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseRetentions(tt.settings, "--flag", tt.byCluster)
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
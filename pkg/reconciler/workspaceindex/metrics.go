@@ -0,0 +1,238 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workspaceindex
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	tenancylister "github.com/kcp-dev/kcp/pkg/client/listers/tenancy/v1alpha1"
+)
+
+const (
+	// ShardLabel is the label holding the name of the shard of federated metrics.
+	ShardLabel = "shard"
+	// ShardUpMetric is the name of the metric telling whether the metrics of a shard
+	// could be scraped.
+	ShardUpMetric = "kcp_shard_up"
+
+	scrapeTimeout = 10 * time.Second
+)
+
+// NewMetricsFederator returns a handler serving the metrics of all the WorkspaceShards,
+// scraped from their /metrics endpoint with their credentials, and labelled with the
+// name of their shard, so that a single Prometheus target covers all the shards.
+func NewMetricsFederator(kubeClient kubernetes.ClusterInterface, workspaceShardLister tenancylister.WorkspaceShardLister) http.Handler {
+	return &metricsFederator{
+		kubeClient:           kubeClient,
+		workspaceShardLister: workspaceShardLister,
+		clients:              map[string]*shardClient{},
+	}
+}
+
+type metricsFederator struct {
+	kubeClient           kubernetes.ClusterInterface
+	workspaceShardLister tenancylister.WorkspaceShardLister
+
+	lock sync.Mutex
+	// clients holds the HTTP clients of the shards, by shard name, until their
+	// credentials change
+	clients map[string]*shardClient
+}
+
+type shardClient struct {
+	credentialsHash string
+	host            string
+	client          *http.Client
+}
+
+func (f *metricsFederator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	shards, err := f.workspaceShardLister.List(labels.Everything())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to list workspace shards: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), scrapeTimeout)
+	defer cancel()
+
+	scraped := make([]map[string]*dto.MetricFamily, len(shards))
+	var wg sync.WaitGroup
+	for i, shard := range shards {
+		wg.Add(1)
+		go func(i int, shard *tenancyv1alpha1.WorkspaceShard) {
+			defer wg.Done()
+			families, err := f.scrape(ctx, shard)
+			if err != nil {
+				klog.Errorf("failed to scrape the metrics of workspace shard %q: %v", shard.Name, err)
+				return
+			}
+			scraped[i] = families
+		}(i, shard)
+	}
+	wg.Wait()
+
+	byShard := make(map[string]map[string]*dto.MetricFamily, len(shards))
+	for i, shard := range shards {
+		byShard[shard.Name] = scraped[i]
+	}
+	merged := mergeMetrics(byShard)
+
+	w.Header().Set("Content-Type", string(expfmt.FmtText))
+	names := make([]string, 0, len(merged))
+	for name := range merged {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := expfmt.MetricFamilyToText(w, merged[name]); err != nil {
+			klog.Errorf("failed to write metric family %q: %v", name, err)
+			return
+		}
+	}
+}
+
+// scrape returns the metrics of the given shard.
+func (f *metricsFederator) scrape(ctx context.Context, shard *tenancyv1alpha1.WorkspaceShard) (map[string]*dto.MetricFamily, error) {
+	c, err := f.clientFor(ctx, shard)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(c.host, "/")+"/metrics", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", string(expfmt.FmtText))
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	var parser expfmt.TextParser
+	return parser.TextToMetricFamilies(resp.Body)
+}
+
+// clientFor returns the HTTP client of the given shard, created from the kubeconfig in
+// its credentials secret.
+func (f *metricsFederator) clientFor(ctx context.Context, shard *tenancyv1alpha1.WorkspaceShard) (*shardClient, error) {
+	f.lock.Lock()
+	existing, ok := f.clients[shard.Name]
+	f.lock.Unlock()
+	if ok && existing.credentialsHash == shard.Status.CredentialsHash {
+		return existing, nil
+	}
+
+	secret, err := f.kubeClient.Cluster(shard.ClusterName).CoreV1().Secrets(shard.Spec.Credentials.Namespace).Get(ctx, shard.Spec.Credentials.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace shard credentials: %w", err)
+	}
+	data, ok := secret.Data[tenancyv1alpha1.WorkspaceShardCredentialsKey]
+	if !ok {
+		return nil, fmt.Errorf("workspace shard credentials missing key %q", tenancyv1alpha1.WorkspaceShardCredentialsKey)
+	}
+	cfg, err := clientcmd.RESTConfigFromKubeConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("workspace shard credentials invalid: %w", err)
+	}
+	client, err := rest.HTTPClientFor(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &shardClient{
+		credentialsHash: shard.Status.CredentialsHash,
+		host:            cfg.Host,
+		client:          client,
+	}
+	f.lock.Lock()
+	f.clients[shard.Name] = c
+	f.lock.Unlock()
+	return c, nil
+}
+
+// mergeMetrics merges the metrics of the given shards, adding the shard label to all of
+// them. A shard label of a shard metric is renamed to exported_shard. A nil map of
+// metric families means the shard could not be scraped, which is reported with the
+// ShardUpMetric metric. Metric families of a shard conflicting in type with the ones
+// of other shards are dropped.
+func mergeMetrics(byShard map[string]map[string]*dto.MetricFamily) map[string]*dto.MetricFamily {
+	shardNames := make([]string, 0, len(byShard))
+	for name := range byShard {
+		shardNames = append(shardNames, name)
+	}
+	sort.Strings(shardNames)
+
+	up := &dto.MetricFamily{
+		Name: proto.String(ShardUpMetric),
+		Help: proto.String("Whether the metrics of the workspace shard could be scraped."),
+		Type: dto.MetricType_GAUGE.Enum(),
+	}
+	merged := map[string]*dto.MetricFamily{ShardUpMetric: up}
+	for _, shardName := range shardNames {
+		families := byShard[shardName]
+		value := 1.0
+		if families == nil {
+			value = 0
+		}
+		up.Metric = append(up.Metric, &dto.Metric{
+			Label: []*dto.LabelPair{{Name: proto.String(ShardLabel), Value: proto.String(shardName)}},
+			Gauge: &dto.Gauge{Value: proto.Float64(value)},
+		})
+
+		for name, family := range families {
+			for _, m := range family.Metric {
+				for _, l := range m.Label {
+					if l.GetName() == ShardLabel {
+						l.Name = proto.String("exported_" + ShardLabel)
+					}
+				}
+				m.Label = append(m.Label, &dto.LabelPair{Name: proto.String(ShardLabel), Value: proto.String(shardName)})
+			}
+			existing, ok := merged[name]
+			if !ok {
+				merged[name] = family
+				continue
+			}
+			if existing.GetType() != family.GetType() {
+				klog.V(2).Infof("dropping metric %q of workspace shard %q with type %s conflicting with %s", name, shardName, family.GetType(), existing.GetType())
+				continue
+			}
+			existing.Metric = append(existing.Metric, family.Metric...)
+		}
+	}
+	return merged
+}
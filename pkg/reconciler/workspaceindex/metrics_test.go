@@ -0,0 +1,74 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workspaceindex
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeMetrics(t *testing.T) {
+	parse := func(text string) map[string]*dto.MetricFamily {
+		var parser expfmt.TextParser
+		families, err := parser.TextToMetricFamilies(strings.NewReader(text))
+		require.NoError(t, err)
+		return families
+	}
+
+	merged := mergeMetrics(map[string]map[string]*dto.MetricFamily{
+		"shard-1": parse(`# TYPE apiserver_request_total counter
+apiserver_request_total{verb="GET"} 3
+# TYPE conflicting gauge
+conflicting 1
+`),
+		"shard-2": parse(`# TYPE apiserver_request_total counter
+apiserver_request_total{verb="GET",shard="inner"} 5
+# TYPE conflicting counter
+conflicting 2
+`),
+		"shard-3": nil,
+	})
+
+	var names []string
+	for name := range merged {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var out bytes.Buffer
+	for _, name := range names {
+		_, err := expfmt.MetricFamilyToText(&out, merged[name])
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, `# TYPE apiserver_request_total counter
+apiserver_request_total{verb="GET",shard="shard-1"} 3
+apiserver_request_total{verb="GET",exported_shard="inner",shard="shard-2"} 5
+# TYPE conflicting gauge
+conflicting{shard="shard-1"} 1
+# HELP kcp_shard_up Whether the metrics of the workspace shard could be scraped.
+# TYPE kcp_shard_up gauge
+kcp_shard_up{shard="shard-1"} 1
+kcp_shard_up{shard="shard-2"} 1
+kcp_shard_up{shard="shard-3"} 0
+`, out.String())
+}
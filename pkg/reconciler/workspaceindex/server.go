@@ -32,12 +32,17 @@ import (
 )
 
 // NewServer creates a new server that can respond to requests for versioned data in workspaces.
-func NewServer(port int, waiter cacheSyncWaiter, index Index, stable func() bool) Server {
+// When metricsBindAddress is not empty, the metrics of all the shards are served with the given
+// handler on that address only, as they expose series of every logical cluster without
+// authentication and must not be reachable by the clients of the index.
+func NewServer(port int, waiter cacheSyncWaiter, index Index, stable func() bool, metricsBindAddress string, metrics http.Handler) Server {
 	return &server{
-		port:   port,
-		waiter: waiter,
-		index:  index,
-		stable: stable,
+		port:               port,
+		waiter:             waiter,
+		index:              index,
+		stable:             stable,
+		metricsBindAddress: metricsBindAddress,
+		metrics:            metrics,
 	}
 }
 
@@ -50,6 +55,9 @@ type server struct {
 	waiter cacheSyncWaiter
 	index  Index
 	stable func() bool
+
+	metricsBindAddress string
+	metrics            http.Handler
 }
 
 type cacheSyncWaiter interface {
@@ -67,7 +75,15 @@ func (s *server) ListenAndServe(ctx context.Context) {
 		}
 		return nil
 	}), healthz.NewInformerSyncHealthz(s.waiter))
-	httpServer := http.Server{Addr: ":" + strconv.Itoa(s.port), Handler: mux}
+	if s.metricsBindAddress != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", s.metrics)
+		go listenAndServe(ctx, &http.Server{Addr: s.metricsBindAddress, Handler: metricsMux})
+	}
+	listenAndServe(ctx, &http.Server{Addr: ":" + strconv.Itoa(s.port), Handler: mux})
+}
+
+func listenAndServe(ctx context.Context, httpServer *http.Server) {
 	go func() {
 		<-ctx.Done()
 		if err := httpServer.Shutdown(context.Background()); err != nil {
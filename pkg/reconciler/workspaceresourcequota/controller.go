@@ -0,0 +1,182 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workspaceresourcequota
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+	kcpclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
+	tenancyinformer "github.com/kcp-dev/kcp/pkg/client/informers/externalversions/tenancy/v1alpha1"
+	tenancylister "github.com/kcp-dev/kcp/pkg/client/listers/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/objectcount"
+	"github.com/kcp-dev/kcp/pkg/workspacequota"
+)
+
+const controllerName = "workspaceresourcequota"
+
+// NewController returns a controller publishing on the status of WorkspaceResourceQuotas
+// the number of objects in the workspaces they limit, as counted by the given counter,
+// at the given interval.
+func NewController(
+	kcpClusterClient kcpclient.ClusterInterface,
+	quotaInformer tenancyinformer.WorkspaceResourceQuotaInformer,
+	workspaceInformer tenancyinformer.ClusterWorkspaceInformer,
+	counter *objectcount.Counter,
+	interval time.Duration,
+) *Controller {
+	return &Controller{
+		kcpClusterClient: kcpClusterClient,
+		quotaLister:      quotaInformer.Lister(),
+		workspaceLister:  workspaceInformer.Lister(),
+		counter:          counter,
+		interval:         interval,
+		now:              time.Now,
+	}
+}
+
+// Controller periodically publishes the usage of the limits of WorkspaceResourceQuotas.
+// The limits themselves are enforced at admission.
+type Controller struct {
+	kcpClusterClient kcpclient.ClusterInterface
+	quotaLister      tenancylister.WorkspaceResourceQuotaLister
+	workspaceLister  tenancylister.ClusterWorkspaceLister
+	counter          *objectcount.Counter
+	interval         time.Duration
+
+	now func() time.Time
+}
+
+func (c *Controller) Start(ctx context.Context) {
+	defer runtime.HandleCrash()
+
+	klog.Info("Starting workspace resource quota controller")
+	defer klog.Info("Shutting down workspace resource quota controller")
+
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := c.update(ctx); err != nil {
+			runtime.HandleError(fmt.Errorf("%q controller failed to update the usage of workspace resource quotas: %w", controllerName, err))
+		}
+	}, c.interval)
+}
+
+// update publishes the usage of all the WorkspaceResourceQuotas it changed for.
+func (c *Controller) update(ctx context.Context) error {
+	quotas, err := c.quotaLister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	workspaces, err := c.workspaceLister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	now := metav1.NewTime(c.now())
+	for quota, usages := range c.usages(quotas, workspaces) {
+		if equality.Semantic.DeepEqual(quota.Status.Workspaces, usages) {
+			continue
+		}
+		if err := c.patchStatus(ctx, quota, &tenancyv1alpha1.WorkspaceResourceQuotaStatus{
+			Workspaces:     usages,
+			LastUpdateTime: &now,
+		}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// usages returns the usage of the limits in effect of every quota, per child workspace
+// of the workspace the quota is created in, sorted by name. Workspaces for which all
+// the limits of a quota are overridden by other quotas are left out.
+func (c *Controller) usages(quotas []*tenancyv1alpha1.WorkspaceResourceQuota, workspaces []*tenancyv1alpha1.ClusterWorkspace) map[*tenancyv1alpha1.WorkspaceResourceQuota][]tenancyv1alpha1.WorkspaceResourceQuotaUsage {
+	quotasByCluster := map[string][]*tenancyv1alpha1.WorkspaceResourceQuota{}
+	usages := make(map[*tenancyv1alpha1.WorkspaceResourceQuota][]tenancyv1alpha1.WorkspaceResourceQuotaUsage, len(quotas))
+	for _, quota := range quotas {
+		quotasByCluster[quota.ClusterName] = append(quotasByCluster[quota.ClusterName], quota)
+		usages[quota] = nil
+	}
+
+	sort.Slice(workspaces, func(i, j int) bool {
+		return workspaces[i].Name < workspaces[j].Name
+	})
+	for _, ws := range workspaces {
+		quotas := quotasByCluster[ws.ClusterName]
+		if len(quotas) == 0 {
+			continue
+		}
+		clusterName, err := helper.EncodeLogicalClusterName(ws)
+		if err != nil {
+			klog.Errorf("failed to determine the logical cluster of workspace %s|%s: %v", ws.ClusterName, ws.Name, err)
+			continue
+		}
+
+		limits := workspacequota.Resolve(quotas, ws.Name)
+		for _, quota := range quotas {
+			usage := tenancyv1alpha1.WorkspaceResourceQuotaUsage{Name: ws.Name}
+			for resource, limit := range limits.ObjectCount {
+				if limit.Quota != quota {
+					continue
+				}
+				if usage.ObjectCount == nil {
+					usage.ObjectCount = map[string]int64{}
+				}
+				usage.ObjectCount[resource] = c.counter.Count(clusterName, schema.ParseGroupResource(resource))
+			}
+			if limit := limits.TotalObjectCount; limit != nil && limit.Quota == quota {
+				total := c.counter.Total(clusterName)
+				usage.TotalObjectCount = &total
+			}
+			if usage.ObjectCount != nil || usage.TotalObjectCount != nil {
+				usages[quota] = append(usages[quota], usage)
+			}
+		}
+	}
+	return usages
+}
+
+func (c *Controller) patchStatus(ctx context.Context, quota *tenancyv1alpha1.WorkspaceResourceQuota, status *tenancyv1alpha1.WorkspaceResourceQuotaStatus) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			// null clears the list when no workspace is limited anymore
+			"workspaces":     status.Workspaces,
+			"lastUpdateTime": status.LastUpdateTime,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal status patch for workspace resource quota %s|%s: %w", quota.ClusterName, quota.Name, err)
+	}
+	klog.V(4).Infof("updating usage of workspace resource quota %s|%s: %d workspaces", quota.ClusterName, quota.Name, len(status.Workspaces))
+	_, err = c.kcpClusterClient.Cluster(quota.ClusterName).TenancyV1alpha1().WorkspaceResourceQuotas().Patch(ctx, quota.Name, types.MergePatchType, patch, metav1.PatchOptions{}, "status")
+	return err
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workspaceresourcequota
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/objectcount"
+)
+
+func int64Ptr(i int64) *int64 {
+	return &i
+}
+
+func TestUsages(t *testing.T) {
+	defaults := &tenancyv1alpha1.WorkspaceResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{ClusterName: "root:org", Name: "defaults"},
+		Spec: tenancyv1alpha1.WorkspaceResourceQuotaSpec{
+			ObjectCount:      map[string]int64{"configmaps": 10, "secrets": 10},
+			TotalObjectCount: int64Ptr(100),
+		},
+	}
+	team := &tenancyv1alpha1.WorkspaceResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{ClusterName: "root:org", Name: "team"},
+		Spec: tenancyv1alpha1.WorkspaceResourceQuotaSpec{
+			Workspaces:  []string{"team"},
+			ObjectCount: map[string]int64{"configmaps": 20},
+		},
+	}
+	unused := &tenancyv1alpha1.WorkspaceResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{ClusterName: "root:other", Name: "unused"},
+		Spec: tenancyv1alpha1.WorkspaceResourceQuotaSpec{
+			ObjectCount: map[string]int64{"configmaps": 1},
+		},
+	}
+
+	counter := objectcount.NewCounter()
+	configMaps := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	for _, clusterName := range []string{"org:team", "org:dev", "org:dev", "org:dev"} {
+		counter.OnAdd(configMaps, &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{ClusterName: clusterName, Namespace: "default", Name: fmt.Sprintf("cm-%d", counter.Count(clusterName, configMaps.GroupResource()))}})
+	}
+
+	c := &Controller{counter: counter}
+	usages := c.usages([]*tenancyv1alpha1.WorkspaceResourceQuota{defaults, team, unused}, []*tenancyv1alpha1.ClusterWorkspace{
+		{ObjectMeta: metav1.ObjectMeta{ClusterName: "root:org", Name: "team"}},
+		{ObjectMeta: metav1.ObjectMeta{ClusterName: "root:org", Name: "dev"}},
+		{ObjectMeta: metav1.ObjectMeta{ClusterName: "root", Name: "org"}},
+	})
+
+	require.Equal(t, map[*tenancyv1alpha1.WorkspaceResourceQuota][]tenancyv1alpha1.WorkspaceResourceQuotaUsage{
+		defaults: {
+			{Name: "dev", ObjectCount: map[string]int64{"configmaps": 3, "secrets": 0}, TotalObjectCount: int64Ptr(3)},
+			{Name: "team", ObjectCount: map[string]int64{"secrets": 0}, TotalObjectCount: int64Ptr(1)},
+		},
+		team: {
+			{Name: "team", ObjectCount: map[string]int64{"configmaps": 1}},
+		},
+		unused: nil,
+	}, usages)
+}
@@ -0,0 +1,49 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workspaceresourcequota
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// DefaultOptions are the default options for the workspace resource quota controller.
+func DefaultOptions() *Options {
+	return &Options{
+		Interval: 30 * time.Second,
+	}
+}
+
+// BindOptions binds the workspace resource quota controller options to the flag set.
+func BindOptions(o *Options, fs *pflag.FlagSet) *Options {
+	fs.DurationVar(&o.Interval, "workspace-resource-quota-interval", o.Interval, "Interval at which the usage of the workspaces limited by WorkspaceResourceQuotas is published on their status")
+	return o
+}
+
+// Options are the options for the workspace resource quota controller.
+type Options struct {
+	Interval time.Duration
+}
+
+func (o *Options) Validate() error {
+	if o.Interval < time.Second {
+		return fmt.Errorf("--workspace-resource-quota-interval must be at least one second")
+	}
+	return nil
+}
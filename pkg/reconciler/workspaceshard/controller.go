@@ -46,6 +46,8 @@ import (
 	kcpclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
 	tenancyinformer "github.com/kcp-dev/kcp/pkg/client/informers/externalversions/tenancy/v1alpha1"
 	tenancylister "github.com/kcp-dev/kcp/pkg/client/listers/tenancy/v1alpha1"
+	reconcilermetrics "github.com/kcp-dev/kcp/pkg/reconciler/metrics"
+	"github.com/kcp-dev/kcp/pkg/reconciler/replication"
 	conditionsapi "github.com/kcp-dev/kcp/third_party/conditions/apis/conditions/v1alpha1"
 	"github.com/kcp-dev/kcp/third_party/conditions/util/conditions"
 )
@@ -60,7 +62,7 @@ func NewController(
 	rootSecretInformer coreinformer.SecretInformer,
 	rootWorkspaceShardInformer tenancyinformer.WorkspaceShardInformer,
 ) (*Controller, error) {
-	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "kcp-workspaceshard")
+	queue := reconcilermetrics.InstrumentQueue("kcp-workspaceshard", workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "kcp-workspaceshard"))
 
 	c := &Controller{
 		queue:                     queue,
@@ -222,6 +224,9 @@ func (c *Controller) process(ctx context.Context, key string) error {
 		}
 		return err
 	}
+	if _, replicated := obj.Labels[replication.ReplicatedFromLabel]; replicated {
+		return nil // the status is owned by the shard the WorkspaceShard is replicated from
+	}
 	previous := obj
 	obj = obj.DeepCopy()
 
@@ -0,0 +1,207 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workspaceusage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+	kcpclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
+	tenancyinformer "github.com/kcp-dev/kcp/pkg/client/informers/externalversions/tenancy/v1alpha1"
+	tenancylister "github.com/kcp-dev/kcp/pkg/client/listers/tenancy/v1alpha1"
+)
+
+const (
+	controllerName = "workspaceusage"
+
+	// pageSize is the number of keys read from etcd at once.
+	pageSize = 500
+)
+
+// NewController returns a controller publishing on the status of ClusterWorkspaces the
+// number of objects and the approximate number of bytes stored in etcd for their
+// logical cluster, measured at the given interval by reading all the keys under the
+// given etcd prefix.
+func NewController(
+	etcdClient clientv3.KV,
+	etcdPrefix string,
+	kcpClusterClient kcpclient.ClusterInterface,
+	workspaceInformer tenancyinformer.ClusterWorkspaceInformer,
+	interval time.Duration,
+) *Controller {
+	if !strings.HasSuffix(etcdPrefix, "/") {
+		etcdPrefix += "/"
+	}
+	return &Controller{
+		etcdClient:       etcdClient,
+		etcdPrefix:       etcdPrefix,
+		kcpClusterClient: kcpClusterClient,
+		workspaceLister:  workspaceInformer.Lister(),
+		interval:         interval,
+		now:              time.Now,
+	}
+}
+
+// Controller periodically measures the storage usage of the logical clusters of
+// ClusterWorkspaces, for chargeback and quota decisions.
+type Controller struct {
+	etcdClient       clientv3.KV
+	etcdPrefix       string
+	kcpClusterClient kcpclient.ClusterInterface
+	workspaceLister  tenancylister.ClusterWorkspaceLister
+	interval         time.Duration
+
+	now func() time.Time
+}
+
+// usage is the storage usage of a logical cluster.
+type usage struct {
+	objects int64
+	bytes   int64
+}
+
+func (c *Controller) Start(ctx context.Context) {
+	defer runtime.HandleCrash()
+
+	klog.Info("Starting workspace usage controller")
+	defer klog.Info("Shutting down workspace usage controller")
+
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := c.update(ctx); err != nil {
+			runtime.HandleError(fmt.Errorf("%q controller failed to update the usage of workspaces: %w", controllerName, err))
+		}
+	}, c.interval)
+}
+
+// update measures the usage of the logical clusters of all the ClusterWorkspaces, and
+// publishes it on the ones it changed for.
+func (c *Controller) update(ctx context.Context) error {
+	workspaces, err := c.workspaceLister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	workspacesByCluster := make(map[string]*tenancyv1alpha1.ClusterWorkspace, len(workspaces))
+	for _, ws := range workspaces {
+		clusterName, err := helper.EncodeLogicalClusterName(ws)
+		if err != nil {
+			klog.Errorf("failed to determine the logical cluster of workspace %s|%s: %v", ws.ClusterName, ws.Name, err)
+			continue
+		}
+		workspacesByCluster[clusterName] = ws
+	}
+
+	usages, err := c.measure(ctx, workspacesByCluster)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	now := metav1.NewTime(c.now())
+	for clusterName, ws := range workspacesByCluster {
+		u := usages[clusterName]
+		if current := ws.Status.Usage; current != nil && current.ObjectCount == u.objects && current.StorageBytes == u.bytes {
+			continue
+		}
+		if err := c.patchUsage(ctx, ws, &tenancyv1alpha1.ClusterWorkspaceUsage{
+			ObjectCount:    u.objects,
+			StorageBytes:   u.bytes,
+			LastUpdateTime: now,
+		}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// measure reads all the keys under the etcd prefix, page by page at the revision of
+// the first page, and sums up the usage of the given logical clusters.
+func (c *Controller) measure(ctx context.Context, workspacesByCluster map[string]*tenancyv1alpha1.ClusterWorkspace) (map[string]usage, error) {
+	usages := map[string]usage{}
+	key := c.etcdPrefix
+	rangeEnd := clientv3.GetPrefixRangeEnd(c.etcdPrefix)
+	var revision int64
+	for {
+		opts := []clientv3.OpOption{clientv3.WithRange(rangeEnd), clientv3.WithLimit(pageSize)}
+		if revision != 0 {
+			opts = append(opts, clientv3.WithRev(revision))
+		}
+		resp, err := c.etcdClient.Get(ctx, key, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read keys from etcd: %w", err)
+		}
+		if revision == 0 && resp.Header != nil {
+			revision = resp.Header.Revision
+		}
+		for _, kv := range resp.Kvs {
+			clusterName, ok := clusterOfKey(string(kv.Key), c.etcdPrefix, workspacesByCluster)
+			if !ok {
+				continue
+			}
+			u := usages[clusterName]
+			u.objects++
+			u.bytes += int64(len(kv.Key) + len(kv.Value))
+			usages[clusterName] = u
+		}
+		if !resp.More || len(resp.Kvs) == 0 {
+			return usages, nil
+		}
+		key = string(resp.Kvs[len(resp.Kvs)-1].Key) + "\x00"
+	}
+}
+
+// clusterOfKey returns the logical cluster an etcd key belongs to. Keys are of the form
+// <prefix>/<resource prefix>/<logical cluster>/[<namespace>/]<name>, where the resource
+// prefix is made of one or more segments, none of which can be the name of a logical
+// cluster of a workspace, as these contain a colon.
+func clusterOfKey(key, prefix string, workspacesByCluster map[string]*tenancyv1alpha1.ClusterWorkspace) (string, bool) {
+	segments := strings.Split(strings.TrimPrefix(key, prefix), "/")
+	for _, segment := range segments[:len(segments)-1] {
+		if _, ok := workspacesByCluster[segment]; ok {
+			return segment, true
+		}
+	}
+	return "", false
+}
+
+func (c *Controller) patchUsage(ctx context.Context, ws *tenancyv1alpha1.ClusterWorkspace, u *tenancyv1alpha1.ClusterWorkspaceUsage) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"usage": u,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal usage patch for workspace %s|%s: %w", ws.ClusterName, ws.Name, err)
+	}
+	klog.V(4).Infof("updating usage of workspace %s|%s: %d objects, %d bytes", ws.ClusterName, ws.Name, u.ObjectCount, u.StorageBytes)
+	_, err = c.kcpClusterClient.Cluster(ws.ClusterName).TenancyV1alpha1().ClusterWorkspaces().Patch(ctx, ws.Name, types.MergePatchType, patch, metav1.PatchOptions{}, "status")
+	return err
+}
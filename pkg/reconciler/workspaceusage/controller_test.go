@@ -0,0 +1,96 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workspaceusage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+)
+
+// fakeKV serves range reads from a map, in pages of pageSize keys.
+type fakeKV struct {
+	clientv3.KV
+
+	data map[string]string
+}
+
+func (kv *fakeKV) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	op := clientv3.OpGet(key, opts...)
+	keys := make([]string, 0, len(kv.data))
+	for k := range kv.data {
+		if k >= key && k < string(op.RangeBytes()) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	resp := &clientv3.GetResponse{Header: &etcdserverpb.ResponseHeader{Revision: 42}}
+	if len(keys) > pageSize {
+		keys = keys[:pageSize]
+		resp.More = true
+	}
+	for _, k := range keys {
+		resp.Kvs = append(resp.Kvs, &mvccpb.KeyValue{Key: []byte(k), Value: []byte(kv.data[k])})
+	}
+	return resp, nil
+}
+
+func TestMeasure(t *testing.T) {
+	data := map[string]string{
+		"/registry/configmaps/root/default/foo":                      "12345",
+		"/registry/configmaps/root:acme/default/foo":                 "12345",
+		"/registry/tenancy.kcp.dev/clusterworkspaces/root:acme/team": "123",
+		"/registry/namespaces/acme:team/default":                     "1",
+		"/registry/namespaces/system:admin/default":                  "1",
+		"/other/configmaps/acme:team/default/foo":                    "1",
+	}
+	for i := 0; i < 2*pageSize; i++ {
+		data[fmt.Sprintf("/registry/secrets/acme:team/default/secret-%04d", i)] = "x"
+	}
+
+	c := &Controller{
+		etcdClient: &fakeKV{data: data},
+		etcdPrefix: "/registry/",
+	}
+	usages, err := c.measure(context.Background(), map[string]*tenancyv1alpha1.ClusterWorkspace{
+		"root:acme":   {},
+		"acme:team":   {},
+		"acme:unused": {},
+	})
+	require.NoError(t, err)
+
+	teamBytes := int64(len("/registry/namespaces/acme:team/default") + 1)
+	for i := 0; i < 2*pageSize; i++ {
+		teamBytes += int64(len(fmt.Sprintf("/registry/secrets/acme:team/default/secret-%04d", i)) + 1)
+	}
+	require.Equal(t, map[string]usage{
+		"root:acme": {
+			objects: 2,
+			bytes:   int64(len("/registry/configmaps/root:acme/default/foo") + 5 + len("/registry/tenancy.kcp.dev/clusterworkspaces/root:acme/team") + 3),
+		},
+		"acme:team": {objects: 2*pageSize + 1, bytes: teamBytes},
+	}, usages)
+}
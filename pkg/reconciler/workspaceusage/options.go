@@ -0,0 +1,49 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workspaceusage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// DefaultOptions are the default options for the workspace usage controller.
+func DefaultOptions() *Options {
+	return &Options{
+		Interval: 10 * time.Minute,
+	}
+}
+
+// BindOptions binds the workspace usage controller options to the flag set.
+func BindOptions(o *Options, fs *pflag.FlagSet) *Options {
+	fs.DurationVar(&o.Interval, "workspace-usage-interval", o.Interval, "Interval at which the storage usage of the logical clusters of workspaces is measured and published on their status")
+	return o
+}
+
+// Options are the options for the workspace usage controller.
+type Options struct {
+	Interval time.Duration
+}
+
+func (o *Options) Validate() error {
+	if o.Interval < time.Minute {
+		return fmt.Errorf("--workspace-usage-interval must be at least one minute")
+	}
+	return nil
+}
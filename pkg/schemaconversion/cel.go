@@ -0,0 +1,177 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schemaconversion
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+	"github.com/google/cel-go/ext"
+	expr "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	structuralschema "k8s.io/apiextensions-apiserver/pkg/apiserver/schema"
+	apiservercel "k8s.io/apiextensions-apiserver/pkg/apiserver/schema/cel"
+	celmodel "k8s.io/apiextensions-apiserver/third_party/forked/celopenapi/model"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// selfTypeName is the CEL type name of self in transformations, if it is an object.
+const selfTypeName = "selfType"
+
+// Transformation is a compiled CEL expression of a field conversion rule, computing the value
+// of the field in the target version from the value of the field in the source version.
+type Transformation struct {
+	program cel.Program
+	schema  *structuralschema.Structural
+}
+
+// CompileTransformation compiles the given CEL expression, with `self` bound to the value of
+// the field at the given dot-separated path of the given OpenAPI v3 schema of the source
+// version.
+func CompileTransformation(versionSchema runtime.RawExtension, path, expression string) (*Transformation, error) {
+	s, err := fieldSchema(versionSchema, path)
+	if err != nil {
+		return nil, err
+	}
+
+	env, err := cel.NewEnv()
+	if err != nil {
+		return nil, err
+	}
+	ruleTypes, err := celmodel.NewRuleTypes(selfTypeName, s, false, celmodel.NewRegistry(env))
+	if err != nil {
+		return nil, err
+	}
+	opts, err := ruleTypes.EnvOptions(env.TypeProvider())
+	if err != nil {
+		return nil, err
+	}
+	selfType, ok := ruleTypes.FindDeclType(selfTypeName)
+	if !ok {
+		declType := celmodel.SchemaDeclType(s, false)
+		if declType == nil {
+			return nil, fmt.Errorf("field %q of type %q cannot be transformed", path, s.Type)
+		}
+		selfType = declType.MaybeAssignTypeName(selfTypeName)
+	}
+	opts = append(opts, cel.Declarations([]*expr.Decl{decls.NewVar(apiservercel.ScopedVarName, selfType.ExprType())}...), ext.Strings())
+	env, err = env.Extend(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	ast, issues := env.Compile(expression)
+	if issues != nil {
+		return nil, fmt.Errorf("compilation failed: %s", issues.String())
+	}
+	program, err := env.Program(ast)
+	if err != nil {
+		return nil, fmt.Errorf("program instantiation failed: %w", err)
+	}
+	return &Transformation{program: program, schema: s}, nil
+}
+
+// Eval returns the result of the transformation of the given value, as an unstructured value.
+func (t *Transformation) Eval(value interface{}) (interface{}, error) {
+	result, _, err := t.program.Eval(map[string]interface{}{
+		apiservercel.ScopedVarName: apiservercel.UnstructuredToVal(value, t.schema),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return toUnstructured(result)
+}
+
+// fieldSchema returns the structural schema of the field at the given dot-separated path of
+// the given OpenAPI v3 schema. Only object properties are traversed.
+func fieldSchema(versionSchema runtime.RawExtension, path string) (*structuralschema.Structural, error) {
+	var props apiextensionsv1.JSONSchemaProps
+	if err := json.Unmarshal(versionSchema.Raw, &props); err != nil {
+		return nil, fmt.Errorf("failed to decode schema: %w", err)
+	}
+	var internal apiextensions.JSONSchemaProps
+	if err := apiextensionsv1.Convert_v1_JSONSchemaProps_To_apiextensions_JSONSchemaProps(&props, &internal, nil); err != nil {
+		return nil, err
+	}
+	s, err := structuralschema.NewStructural(&internal)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range strings.Split(path, ".") {
+		property, ok := s.Properties[name]
+		if !ok {
+			return nil, fmt.Errorf("field %q is not in the schema", path)
+		}
+		s = &property
+	}
+	return s, nil
+}
+
+// toUnstructured converts the result of a CEL program to an unstructured value.
+func toUnstructured(val ref.Val) (interface{}, error) {
+	switch v := val.(type) {
+	case *types.Err:
+		return nil, v
+	case types.Null:
+		return nil, nil
+	case types.Bool, types.Int, types.Double, types.String:
+		return v.Value(), nil
+	case types.Uint:
+		return int64(v), nil
+	case types.Duration:
+		return v.Duration.String(), nil
+	case types.Timestamp:
+		return v.Time.UTC().Format(time.RFC3339), nil
+	case traits.Mapper:
+		m := map[string]interface{}{}
+		for it := v.Iterator(); it.HasNext() == types.True; {
+			key := it.Next()
+			name, ok := key.(types.String)
+			if !ok {
+				return nil, fmt.Errorf("map key %v is not a string", key.Value())
+			}
+			value, err := toUnstructured(v.Get(key))
+			if err != nil {
+				return nil, err
+			}
+			m[string(name)] = value
+		}
+		return m, nil
+	case traits.Lister:
+		l := []interface{}{}
+		for it := v.Iterator(); it.HasNext() == types.True; {
+			value, err := toUnstructured(it.Next())
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, value)
+		}
+		return l, nil
+	default:
+		return nil, fmt.Errorf("unsupported result type %s", val.Type().TypeName())
+	}
+}
@@ -0,0 +1,247 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schemaconversion
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apiextensions-apiserver/pkg/apiserver/conversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+)
+
+// Converter converts custom resources defined by an APIResourceSchema between its versions.
+type Converter interface {
+	// Convert converts in to the given group version. It may mutate in and return it.
+	Convert(in runtime.Object, targetGV schema.GroupVersion) (runtime.Object, error)
+}
+
+// NewConverter returns a converter for the conversion strategy of the given schema. The
+// webhook converter factory is only used for the Webhook strategy and may be nil otherwise.
+func NewConverter(s *apisv1alpha1.APIResourceSchema, webhooks *conversion.CRConverterFactory) (Converter, error) {
+	strategy := apisv1alpha1.NoneConverter
+	if s.Spec.Conversion != nil {
+		strategy = s.Spec.Conversion.Strategy
+	}
+
+	switch strategy {
+	case apisv1alpha1.NoneConverter:
+		return &nopConverter{}, nil
+	case apisv1alpha1.RulesConverter:
+		return newRulesConverter(s)
+	case apisv1alpha1.WebhookConverter:
+		if webhooks == nil {
+			return nil, fmt.Errorf("webhook conversion is not available for APIResourceSchema %s|%s", s.ClusterName, s.Name)
+		}
+		crd, err := CustomResourceDefinition(s)
+		if err != nil {
+			return nil, err
+		}
+		_, unsafe, err := webhooks.NewConverter(crd)
+		if err != nil {
+			return nil, err
+		}
+		return &objectConvertor{delegate: unsafe}, nil
+	default:
+		return nil, fmt.Errorf("unknown conversion strategy %q for APIResourceSchema %s|%s", strategy, s.ClusterName, s.Name)
+	}
+}
+
+// CustomResourceDefinition returns a CustomResourceDefinition equivalent to the given schema.
+// The CRD lives in the logical cluster of the schema such that webhook service references
+// are resolved in the workspace of the schema.
+func CustomResourceDefinition(s *apisv1alpha1.APIResourceSchema) (*apiextensionsv1.CustomResourceDefinition, error) {
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        s.Spec.Names.Plural + "." + s.Spec.Group,
+			ClusterName: s.ClusterName,
+		},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: s.Spec.Group,
+			Names: s.Spec.Names,
+			Scope: s.Spec.Scope,
+			Conversion: &apiextensionsv1.CustomResourceConversion{
+				Strategy: apiextensionsv1.NoneConverter,
+			},
+		},
+	}
+	if s.Spec.Conversion != nil && s.Spec.Conversion.Strategy == apisv1alpha1.WebhookConverter {
+		crd.Spec.Conversion = &apiextensionsv1.CustomResourceConversion{
+			Strategy: apiextensionsv1.WebhookConverter,
+			Webhook:  s.Spec.Conversion.Webhook.DeepCopy(),
+		}
+	}
+
+	for _, v := range s.Spec.Versions {
+		var props apiextensionsv1.JSONSchemaProps
+		if err := json.Unmarshal(v.Schema.Raw, &props); err != nil {
+			return nil, fmt.Errorf("failed to decode schema of version %q of APIResourceSchema %s|%s: %w", v.Name, s.ClusterName, s.Name, err)
+		}
+		crd.Spec.Versions = append(crd.Spec.Versions, apiextensionsv1.CustomResourceDefinitionVersion{
+			Name:                     v.Name,
+			Served:                   v.Served,
+			Storage:                  v.Storage,
+			Deprecated:               v.Deprecated,
+			DeprecationWarning:       v.DeprecationWarning,
+			Schema:                   &apiextensionsv1.CustomResourceValidation{OpenAPIV3Schema: &props},
+			Subresources:             v.Subresources.DeepCopy(),
+			AdditionalPrinterColumns: v.AdditionalPrinterColumns,
+		})
+	}
+
+	return crd, nil
+}
+
+// objectConvertor adapts a runtime.ObjectConvertor to a Converter.
+type objectConvertor struct {
+	delegate runtime.ObjectConvertor
+}
+
+func (c *objectConvertor) Convert(in runtime.Object, targetGV schema.GroupVersion) (runtime.Object, error) {
+	return c.delegate.ConvertToVersion(in, targetGV)
+}
+
+// nopConverter only sets the apiVersion of the objects.
+type nopConverter struct{}
+
+func (c *nopConverter) Convert(in runtime.Object, targetGV schema.GroupVersion) (runtime.Object, error) {
+	if list, ok := in.(*unstructured.UnstructuredList); ok {
+		for i := range list.Items {
+			list.Items[i].SetGroupVersionKind(targetGV.WithKind(list.Items[i].GroupVersionKind().Kind))
+		}
+	}
+	in.GetObjectKind().SetGroupVersionKind(targetGV.WithKind(in.GetObjectKind().GroupVersionKind().Kind))
+	return in, nil
+}
+
+type versionPair struct {
+	from, to string
+}
+
+// fieldRule is a field conversion rule with its compiled transformation, if any.
+type fieldRule struct {
+	from, to       string
+	transformation *Transformation
+}
+
+// rulesConverter moves and transforms fields according to the declarative conversion rules
+// of a schema.
+type rulesConverter struct {
+	rules map[versionPair][]fieldRule
+}
+
+func newRulesConverter(s *apisv1alpha1.APIResourceSchema) (*rulesConverter, error) {
+	schemas := map[string]runtime.RawExtension{}
+	for _, v := range s.Spec.Versions {
+		schemas[v.Name] = v.Schema
+	}
+
+	c := &rulesConverter{rules: map[versionPair][]fieldRule{}}
+	for _, r := range s.Spec.Conversion.Rules {
+		fields := make([]fieldRule, 0, len(r.Fields))
+		for _, f := range r.Fields {
+			rule := fieldRule{from: f.From, to: f.To}
+			if f.Transformation != "" {
+				t, err := CompileTransformation(schemas[r.FromVersion], f.From, f.Transformation)
+				if err != nil {
+					return nil, fmt.Errorf("invalid transformation of field %q from version %q to %q of APIResourceSchema %s|%s: %w", f.From, r.FromVersion, r.ToVersion, s.ClusterName, s.Name, err)
+				}
+				rule.transformation = t
+			}
+			fields = append(fields, rule)
+		}
+		c.rules[versionPair{from: r.FromVersion, to: r.ToVersion}] = fields
+	}
+	return c, nil
+}
+
+func (c *rulesConverter) Convert(in runtime.Object, targetGV schema.GroupVersion) (runtime.Object, error) {
+	if list, ok := in.(*unstructured.UnstructuredList); ok {
+		for i := range list.Items {
+			if err := c.convert(&list.Items[i], targetGV); err != nil {
+				return nil, err
+			}
+		}
+		list.SetGroupVersionKind(targetGV.WithKind(list.GroupVersionKind().Kind))
+		return list, nil
+	}
+
+	u, ok := in.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type %T for rules conversion", in)
+	}
+	if err := c.convert(u, targetGV); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (c *rulesConverter) convert(u *unstructured.Unstructured, targetGV schema.GroupVersion) error {
+	fromGVK := u.GroupVersionKind()
+	if fromGVK.Version != targetGV.Version {
+		fields, ok := c.rules[versionPair{from: fromGVK.Version, to: targetGV.Version}]
+		if !ok {
+			return fmt.Errorf("no conversion rules from version %q to %q", fromGVK.Version, targetGV.Version)
+		}
+		if err := moveFields(u.Object, fields); err != nil {
+			return err
+		}
+	}
+	u.SetGroupVersionKind(targetGV.WithKind(fromGVK.Kind))
+	return nil
+}
+
+// moveFields applies the given field rules to obj. All fields are removed from their
+// source paths before any of them is set, such that rules can swap fields.
+func moveFields(obj map[string]interface{}, fields []fieldRule) error {
+	values := make([]interface{}, len(fields))
+	found := make([]bool, len(fields))
+	for i, f := range fields {
+		path := strings.Split(f.from, ".")
+		v, ok, err := unstructured.NestedFieldNoCopy(obj, path...)
+		if err != nil {
+			return fmt.Errorf("failed to get field %q: %w", f.from, err)
+		}
+		values[i], found[i] = v, ok
+		if ok {
+			unstructured.RemoveNestedField(obj, path...)
+		}
+	}
+	for i, f := range fields {
+		if !found[i] || f.to == "" {
+			continue
+		}
+		value := values[i]
+		if f.transformation != nil {
+			var err error
+			if value, err = f.transformation.Eval(value); err != nil {
+				return fmt.Errorf("failed to transform field %q: %w", f.from, err)
+			}
+		}
+		if err := unstructured.SetNestedField(obj, value, strings.Split(f.to, ".")...); err != nil {
+			return fmt.Errorf("failed to set field %q: %w", f.to, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schemaconversion
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+)
+
+func widgetSchema(versions map[string]string, rules []apisv1alpha1.ConversionRules) *apisv1alpha1.APIResourceSchema {
+	s := &apisv1alpha1.APIResourceSchema{
+		ObjectMeta: metav1.ObjectMeta{ClusterName: "acme:provider", Name: "today.widgets.example.io"},
+		Spec: apisv1alpha1.APIResourceSchemaSpec{
+			Group:      "example.io",
+			Names:      apiextensionsv1.CustomResourceDefinitionNames{Plural: "widgets", Singular: "widget", Kind: "Widget", ListKind: "WidgetList"},
+			Scope:      apiextensionsv1.NamespaceScoped,
+			Conversion: &apisv1alpha1.CustomResourceConversion{Strategy: apisv1alpha1.RulesConverter, Rules: rules},
+		},
+	}
+	for _, name := range []string{"v1", "v2"} {
+		s.Spec.Versions = append(s.Spec.Versions, apisv1alpha1.APIResourceVersion{
+			Name:    name,
+			Served:  true,
+			Storage: name == "v1",
+			Schema:  runtime.RawExtension{Raw: []byte(`{"type":"object","properties":{"spec":{"type":"object","properties":{` + versions[name] + `}}}}`)},
+		})
+	}
+	return s
+}
+
+func TestRulesConverter(t *testing.T) {
+	c, err := newRulesConverter(widgetSchema(map[string]string{
+		"v1": `"size":{"type":"integer"},"legacy":{"type":"boolean"},"color":{"type":"string"}`,
+		"v2": `"replicas":{"type":"integer"},"color":{"type":"string"}`,
+	}, []apisv1alpha1.ConversionRules{
+		{
+			FromVersion: "v1",
+			ToVersion:   "v2",
+			Fields: []apisv1alpha1.FieldConversionRule{
+				{From: "spec.size", To: "spec.replicas"},
+				{From: "spec.legacy"},
+			},
+		},
+		{
+			FromVersion: "v2",
+			ToVersion:   "v1",
+			Fields: []apisv1alpha1.FieldConversionRule{
+				{From: "spec.replicas", To: "spec.size"},
+			},
+		},
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	in := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.io/v1",
+		"kind":       "Widget",
+		"metadata":   map[string]interface{}{"name": "foo"},
+		"spec": map[string]interface{}{
+			"size":   int64(3),
+			"legacy": true,
+			"color":  "blue",
+		},
+	}}
+
+	out, err := c.Convert(in, schema.GroupVersion{Group: "example.io", Version: "v2"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{
+		"apiVersion": "example.io/v2",
+		"kind":       "Widget",
+		"metadata":   map[string]interface{}{"name": "foo"},
+		"spec": map[string]interface{}{
+			"replicas": int64(3),
+			"color":    "blue",
+		},
+	}
+	if diff := cmp.Diff(expected, out.(*unstructured.Unstructured).Object); diff != "" {
+		t.Errorf("unexpected conversion result (-want +got):\n%s", diff)
+	}
+
+	if _, err := c.Convert(out, schema.GroupVersion{Group: "example.io", Version: "v3"}); err == nil {
+		t.Errorf("expected error converting to a version without rules")
+	}
+}
+
+func TestMoveFieldsSwap(t *testing.T) {
+	obj := map[string]interface{}{
+		"spec": map[string]interface{}{"a": "1", "b": "2"},
+	}
+	if err := moveFields(obj, []fieldRule{
+		{from: "spec.a", to: "spec.b"},
+		{from: "spec.b", to: "spec.a"},
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{
+		"spec": map[string]interface{}{"a": "2", "b": "1"},
+	}
+	if diff := cmp.Diff(expected, obj); diff != "" {
+		t.Errorf("unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestRulesConverterTransformations(t *testing.T) {
+	c, err := newRulesConverter(widgetSchema(map[string]string{
+		"v1": `"size":{"type":"integer"},"color":{"type":"string"},"owner":{"type":"object","properties":{"first":{"type":"string"},"last":{"type":"string"}}}`,
+		"v2": `"replicas":{"type":"integer"},"color":{"type":"string"},"owner":{"type":"array","items":{"type":"string"}}`,
+	}, []apisv1alpha1.ConversionRules{
+		{
+			FromVersion: "v1",
+			ToVersion:   "v2",
+			Fields: []apisv1alpha1.FieldConversionRule{
+				{From: "spec.size", To: "spec.replicas", Transformation: "self * 2"},
+				{From: "spec.color", To: "spec.color", Transformation: "self.upperAscii()"},
+				{From: "spec.owner", To: "spec.owner", Transformation: "[self.first, self.last]"},
+			},
+		},
+		{
+			FromVersion: "v2",
+			ToVersion:   "v1",
+			Fields: []apisv1alpha1.FieldConversionRule{
+				{From: "spec.replicas", To: "spec.size", Transformation: "self / 2"},
+				{From: "spec.color", To: "spec.color", Transformation: "self.lowerAscii()"},
+				{From: "spec.owner", To: "spec.owner", Transformation: "{'first': self[0], 'last': self[1]}"},
+			},
+		},
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	v1 := map[string]interface{}{
+		"apiVersion": "example.io/v1",
+		"kind":       "Widget",
+		"metadata":   map[string]interface{}{"name": "foo"},
+		"spec": map[string]interface{}{
+			"size":  int64(3),
+			"color": "blue",
+			"owner": map[string]interface{}{"first": "Ada", "last": "Lovelace"},
+		},
+	}
+	out, err := c.Convert(&unstructured.Unstructured{Object: runtime.DeepCopyJSON(v1)}, schema.GroupVersion{Group: "example.io", Version: "v2"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{
+		"apiVersion": "example.io/v2",
+		"kind":       "Widget",
+		"metadata":   map[string]interface{}{"name": "foo"},
+		"spec": map[string]interface{}{
+			"replicas": int64(6),
+			"color":    "BLUE",
+			"owner":    []interface{}{"Ada", "Lovelace"},
+		},
+	}
+	if diff := cmp.Diff(expected, out.(*unstructured.Unstructured).Object); diff != "" {
+		t.Errorf("unexpected conversion result (-want +got):\n%s", diff)
+	}
+
+	back, err := c.Convert(out, schema.GroupVersion{Group: "example.io", Version: "v1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(v1, back.(*unstructured.Unstructured).Object); diff != "" {
+		t.Errorf("unexpected round-trip result (-want +got):\n%s", diff)
+	}
+}
+
+func TestCompileTransformation(t *testing.T) {
+	versionSchema := runtime.RawExtension{Raw: []byte(`{"type":"object","properties":{"spec":{"type":"object","properties":{"size":{"type":"integer"}}}}}`)}
+
+	tests := []struct {
+		name       string
+		path       string
+		expression string
+		wantErr    bool
+	}{
+		{name: "valid", path: "spec.size", expression: "self + 1"},
+		{name: "type error", path: "spec.size", expression: "self + 'a'", wantErr: true},
+		{name: "unknown field of self", path: "spec", expression: "self.replicas", wantErr: true},
+		{name: "field not in the schema", path: "spec.replicas", expression: "self", wantErr: true},
+		{name: "syntax error", path: "spec.size", expression: "self +", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := CompileTransformation(versionSchema, tt.path, tt.expression); (err != nil) != tt.wantErr {
+				t.Errorf("CompileTransformation() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCustomResourceDefinitionValidationRules(t *testing.T) {
+	s := &apisv1alpha1.APIResourceSchema{
+		ObjectMeta: metav1.ObjectMeta{ClusterName: "acme:provider", Name: "today.widgets.example.io"},
+		Spec: apisv1alpha1.APIResourceSchemaSpec{
+			Group: "example.io",
+			Names: apiextensionsv1.CustomResourceDefinitionNames{Plural: "widgets", Singular: "widget", Kind: "Widget", ListKind: "WidgetList"},
+			Scope: apiextensionsv1.NamespaceScoped,
+			Versions: []apisv1alpha1.APIResourceVersion{{
+				Name:    "v1",
+				Served:  true,
+				Storage: true,
+				Schema: runtime.RawExtension{Raw: []byte(`{"type":"object","properties":{"spec":{"type":"object",` +
+					`"properties":{"minReplicas":{"type":"integer","default":1},"maxReplicas":{"type":"integer"}},` +
+					`"x-kubernetes-validations":[{"rule":"self.minReplicas <= self.maxReplicas","message":"invalid replicas"}]}}}`)},
+			}},
+		},
+	}
+
+	crd, err := CustomResourceDefinition(s)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	spec := crd.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["spec"]
+	expectedRules := apiextensionsv1.ValidationRules{{Rule: "self.minReplicas <= self.maxReplicas", Message: "invalid replicas"}}
+	if diff := cmp.Diff(expectedRules, spec.XValidations); diff != "" {
+		t.Errorf("unexpected validation rules (-want +got):\n%s", diff)
+	}
+	if def := spec.Properties["minReplicas"].Default; def == nil || string(def.Raw) != "1" {
+		t.Errorf("expected default 1 for minReplicas, got %v", def)
+	}
+}
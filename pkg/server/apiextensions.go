@@ -21,9 +21,11 @@ import (
 	"fmt"
 	_ "net/http/pprof"
 	"strings"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 
+	apiextensionshelpers "k8s.io/apiextensions-apiserver/pkg/apihelpers"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	apiextensionsexternalversions "k8s.io/apiextensions-apiserver/pkg/client/informers/externalversions"
 	"k8s.io/apiextensions-apiserver/pkg/client/informers/externalversions/apiextensions"
@@ -33,18 +35,28 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
 	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
 	"k8s.io/client-go/tools/clusters"
 	"k8s.io/klog/v2"
 
 	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
 	tenancylisters "github.com/kcp-dev/kcp/pkg/client/listers/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/reconciler/boundcrds"
+	"github.com/kcp-dev/kcp/pkg/server/serviceresolver"
 )
 
-// inheritanceCRDLister is a CRD lister that add support for ClusterWorkspace API inheritance.
+// shadowCRDCreationTimeout is how long after the first request of a bound resource requests
+// wait for its shadow CRD to be created and established.
+const shadowCRDCreationTimeout = 10 * time.Second
+
+// inheritanceCRDLister is a CRD lister that add support for ClusterWorkspace API inheritance,
+// and for resources bound through APIBindings, which are served by shadow CRDs shared by all
+// the workspaces bound to the same schema.
 type inheritanceCRDLister struct {
-	crdLister       apiextensionslisters.CustomResourceDefinitionLister
-	workspaceLister tenancylisters.ClusterWorkspaceLister
+	crdLister        apiextensionslisters.CustomResourceDefinitionLister
+	workspaceLister  tenancylisters.ClusterWorkspaceLister
+	boundCRDResolver *boundcrds.Resolver
 }
 
 var _ apiextensionslisters.CustomResourceDefinitionLister = (*inheritanceCRDLister)(nil)
@@ -131,20 +143,54 @@ func (c *inheritanceCRDLister) ListWithContext(ctx context.Context, selector lab
 	if err != nil {
 		return nil, err
 	}
+	names := map[string]int{}
 	for i := range crds {
 		crd := crds[i]
 		if crd.ClusterName == cluster.Name || (inheriting && crd.ClusterName == inheritFrom) {
+			names[crd.Name] = len(ret)
 			ret = append(ret, crd)
 		}
 	}
 
+	// Add the shadow CRDs of the bound resources. CRDs of the workspace take precedence,
+	// unless the conflict policy of the APIBinding says otherwise.
+	if c.boundCRDResolver != nil {
+		shadowKeys, err := c.boundCRDResolver.ShadowCRDKeys(cluster.Name)
+		if err != nil {
+			return nil, err
+		}
+		for name, key := range shadowKeys {
+			i, local := names[name]
+			if local && !key.OverridesLocal {
+				continue
+			}
+			crd, err := c.getShadowCRD(ctx, key)
+			if apierrors.IsNotFound(err) {
+				continue // not created yet
+			} else if err != nil {
+				return nil, err
+			}
+			if local {
+				ret[i] = crd
+			} else {
+				ret = append(ret, crd)
+			}
+		}
+	}
+
 	return ret, nil
 }
 
 // Get gets a CustomResourceDefinitions in the underlying store by name. This method does not
 // support scoping to logical clusters or workspace inheritance.
 func (c *inheritanceCRDLister) Get(name string) (*apiextensionsv1.CustomResourceDefinition, error) {
-	return c.crdLister.GetWithContext(context.Background(), name)
+	crd, err := c.crdLister.GetWithContext(context.Background(), name)
+	if err != nil {
+		return nil, err
+	}
+	// Conversion requests do not carry the logical cluster of the CRD, pass it in the path of
+	// its conversion webhook to resolve the Service it calls.
+	return serviceresolver.ScopeConversionWebhook(crd), nil
 }
 
 // GetWithContext gets a CustomResourceDefinitions in the logical cluster associated with ctx by
@@ -181,6 +227,24 @@ func (c *inheritanceCRDLister) GetWithContext(ctx context.Context, name string)
 		}
 		var equal bool // true if all the found CRDs have the same spec
 		crd, equal = findCRD(name, crds)
+		if crd == nil && c.boundCRDResolver != nil {
+			// The shadow CRDs of bound resources are created on their first request.
+			keys, err := c.boundCRDResolver.BoundResourceKeys(name)
+			if err != nil {
+				return nil, err
+			}
+			for _, key := range keys {
+				if _, err := c.getShadowCRD(ctx, key); err != nil && !apierrors.IsNotFound(err) {
+					return nil, err
+				}
+			}
+			if len(keys) > 0 {
+				if crds, err = c.crdLister.List(labels.Everything()); err != nil {
+					return nil, err
+				}
+				crd, equal = findCRD(name, crds)
+			}
+		}
 		if !equal {
 			err = apierrors.NewInternalError(fmt.Errorf("error resolving resource: cannot watch across logical clusters for a resource type with several distinct schemas"))
 			return nil, err
@@ -193,6 +257,26 @@ func (c *inheritanceCRDLister) GetWithContext(ctx context.Context, name string)
 		return crd, nil
 	}
 
+	// Look up a resource bound through an APIBinding.
+	var shadowKey *boundcrds.ShadowCRDKey
+	if c.boundCRDResolver != nil {
+		shadowKeys, err := c.boundCRDResolver.ShadowCRDKeys(cluster.Name)
+		if err != nil {
+			return nil, err
+		}
+		if key, found := shadowKeys[name]; found {
+			shadowKey = &key
+		}
+	}
+
+	// A bound resource overriding the CRDs of the workspace takes priority.
+	if shadowKey != nil && shadowKey.OverridesLocal {
+		crd, err := c.getShadowCRD(ctx, *shadowKey)
+		if err == nil || !apierrors.IsNotFound(err) {
+			return crd, err
+		}
+	}
+
 	crdKey := clusters.ToClusterAwareKey(cluster.Name, name)
 	crd, err = c.crdLister.Get(crdKey)
 	if err != nil && !apierrors.IsNotFound(err) {
@@ -205,6 +289,14 @@ func (c *inheritanceCRDLister) GetWithContext(ctx context.Context, name string)
 		return crd, nil
 	}
 
+	// Then check for a resource bound through an APIBinding.
+	if shadowKey != nil && !shadowKey.OverridesLocal {
+		crd, err := c.getShadowCRD(ctx, *shadowKey)
+		if err == nil || !apierrors.IsNotFound(err) {
+			return crd, err
+		}
+	}
+
 	// ClusterWorkspace CRD is apparently not installed
 	if c.workspaceLister == nil {
 		return nil, apierrors.NewNotFound(apiextensionsv1.Resource("customresourcedefinitions"), name)
@@ -253,6 +345,24 @@ func (c *inheritanceCRDLister) GetWithContext(ctx context.Context, name string)
 	return crd, err
 }
 
+// getShadowCRD gets the shadow CRD of the given key, recording its schema as requested. Shadow
+// CRDs are created on the first request of their bound resource, and requests wait for them to
+// be established for up to shadowCRDCreationTimeout after that first request.
+func (c *inheritanceCRDLister) getShadowCRD(ctx context.Context, key boundcrds.ShadowCRDKey) (*apiextensionsv1.CustomResourceDefinition, error) {
+	var crd *apiextensionsv1.CustomResourceDefinition
+	var err error
+	requested := c.boundCRDResolver.Request(key.Hash)
+	_ = wait.PollImmediateUntil(100*time.Millisecond, func() (bool, error) {
+		crd, err = c.crdLister.Get(key.Key)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		established := err == nil && apiextensionshelpers.IsCRDConditionTrue(crd, apiextensionsv1.Established)
+		return established || time.Since(requested) > shadowCRDCreationTimeout, nil
+	}, ctx.Done())
+	return crd, err
+}
+
 // findCRD tries to locate a CRD named crdName in crds. It returns the located CRD, if any, and a bool
 // indicating that if there were multiple matches, they all have the same spec (true) or not (false).
 func findCRD(crdName string, crds []*apiextensionsv1.CustomResourceDefinition) (*apiextensionsv1.CustomResourceDefinition, bool) {
@@ -280,7 +390,8 @@ func findCRD(crdName string, crds []*apiextensionsv1.CustomResourceDefinition) (
 // we can supply our own inheritance-aware CRD lister.
 type kcpAPIExtensionsSharedInformerFactory struct {
 	apiextensionsexternalversions.SharedInformerFactory
-	workspaceLister tenancylisters.ClusterWorkspaceLister
+	workspaceLister  tenancylisters.ClusterWorkspaceLister
+	boundCRDResolver *boundcrds.Resolver
 }
 
 // Apiextensions returns an apiextensions.Interface that supports inheritance when getting and
@@ -288,8 +399,9 @@ type kcpAPIExtensionsSharedInformerFactory struct {
 func (f *kcpAPIExtensionsSharedInformerFactory) Apiextensions() apiextensions.Interface {
 	i := f.SharedInformerFactory.Apiextensions()
 	return &kcpAPIExtensionsApiextensions{
-		Interface:       i,
-		workspaceLister: f.workspaceLister,
+		Interface:        i,
+		workspaceLister:  f.workspaceLister,
+		boundCRDResolver: f.boundCRDResolver,
 	}
 }
 
@@ -297,7 +409,8 @@ func (f *kcpAPIExtensionsSharedInformerFactory) Apiextensions() apiextensions.In
 // we can supply our own inheritance-aware CRD lister.
 type kcpAPIExtensionsApiextensions struct {
 	apiextensions.Interface
-	workspaceLister tenancylisters.ClusterWorkspaceLister
+	workspaceLister  tenancylisters.ClusterWorkspaceLister
+	boundCRDResolver *boundcrds.Resolver
 }
 
 // V1 returns an apiextensionsinformerv1.Interface that supports inheritance when getting and
@@ -305,8 +418,9 @@ type kcpAPIExtensionsApiextensions struct {
 func (i *kcpAPIExtensionsApiextensions) V1() apiextensionsinformerv1.Interface {
 	v1i := i.Interface.V1()
 	return &kcpAPIExtensionsApiextensionsV1{
-		Interface:       v1i,
-		workspaceLister: i.workspaceLister,
+		Interface:        v1i,
+		workspaceLister:  i.workspaceLister,
+		boundCRDResolver: i.boundCRDResolver,
 	}
 }
 
@@ -314,7 +428,8 @@ func (i *kcpAPIExtensionsApiextensions) V1() apiextensionsinformerv1.Interface {
 // we can supply our own inheritance-aware CRD lister.
 type kcpAPIExtensionsApiextensionsV1 struct {
 	apiextensionsinformerv1.Interface
-	workspaceLister tenancylisters.ClusterWorkspaceLister
+	workspaceLister  tenancylisters.ClusterWorkspaceLister
+	boundCRDResolver *boundcrds.Resolver
 }
 
 // CustomResourceDefinitions returns an apiextensionsinformerv1.CustomResourceDefinitionInformer
@@ -324,6 +439,7 @@ func (i *kcpAPIExtensionsApiextensionsV1) CustomResourceDefinitions() apiextensi
 	return &kcpAPIExtensionsApiextensionsV1CustomResourceDefinitionInformer{
 		CustomResourceDefinitionInformer: c,
 		workspaceLister:                  i.workspaceLister,
+		boundCRDResolver:                 i.boundCRDResolver,
 	}
 }
 
@@ -332,7 +448,8 @@ func (i *kcpAPIExtensionsApiextensionsV1) CustomResourceDefinitions() apiextensi
 // inheritance-aware CRD lister.
 type kcpAPIExtensionsApiextensionsV1CustomResourceDefinitionInformer struct {
 	apiextensionsinformerv1.CustomResourceDefinitionInformer
-	workspaceLister tenancylisters.ClusterWorkspaceLister
+	workspaceLister  tenancylisters.ClusterWorkspaceLister
+	boundCRDResolver *boundcrds.Resolver
 }
 
 // Lister returns an apiextensionslisters.CustomResourceDefinitionLister
@@ -340,8 +457,9 @@ type kcpAPIExtensionsApiextensionsV1CustomResourceDefinitionInformer struct {
 func (i *kcpAPIExtensionsApiextensionsV1CustomResourceDefinitionInformer) Lister() apiextensionslisters.CustomResourceDefinitionLister {
 	originalLister := i.CustomResourceDefinitionInformer.Lister()
 	l := &inheritanceCRDLister{
-		crdLister:       originalLister,
-		workspaceLister: i.workspaceLister,
+		crdLister:        originalLister,
+		workspaceLister:  i.workspaceLister,
+		boundCRDResolver: i.boundCRDResolver,
 	}
 	return l
 }
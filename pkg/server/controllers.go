@@ -19,21 +19,30 @@ package server
 import (
 	"context"
 	"errors"
+	"fmt"
 	_ "net/http/pprof"
 	"net/url"
+	"os"
 	"time"
 
+	"go.etcd.io/etcd/client/pkg/v3/transport"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
 	corev1 "k8s.io/api/core/v1"
 	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	genericapiserver "k8s.io/apiserver/pkg/server"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/pkg/version"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	_ "k8s.io/component-base/metrics/prometheus/workqueue" // queue depth and latency of the controllers
 	"k8s.io/klog/v2"
 	"k8s.io/kubernetes/pkg/controller/clusterroleaggregation"
 	"k8s.io/kubernetes/pkg/controller/namespace"
@@ -41,17 +50,44 @@ import (
 
 	configcrds "github.com/kcp-dev/kcp/config/crds"
 	configorganization "github.com/kcp-dev/kcp/config/organization"
+	configsystemexports "github.com/kcp-dev/kcp/config/systemexports"
 	configuniversal "github.com/kcp-dev/kcp/config/universal"
+	kcpadmissionhelpers "github.com/kcp-dev/kcp/pkg/admission/helpers"
+	"github.com/kcp-dev/kcp/pkg/aggregator"
 	apiresourceapi "github.com/kcp-dev/kcp/pkg/apis/apiresource"
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
 	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
 	"github.com/kcp-dev/kcp/pkg/apis/workload"
+	bootstrappolicy "github.com/kcp-dev/kcp/pkg/authorization/bootstrap"
 	kcpclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
 	tenancylisters "github.com/kcp-dev/kcp/pkg/client/listers/tenancy/v1alpha1"
 	"github.com/kcp-dev/kcp/pkg/gvk"
+	"github.com/kcp-dev/kcp/pkg/informer"
+	"github.com/kcp-dev/kcp/pkg/objectcount"
+	"github.com/kcp-dev/kcp/pkg/reconciler/apibindingconflicts"
+	"github.com/kcp-dev/kcp/pkg/reconciler/apibindingroles"
+	"github.com/kcp-dev/kcp/pkg/reconciler/apibindingupgrade"
+	"github.com/kcp-dev/kcp/pkg/reconciler/apiexport"
+	"github.com/kcp-dev/kcp/pkg/reconciler/apiserviceavailability"
+	"github.com/kcp-dev/kcp/pkg/reconciler/boundcrds"
+	"github.com/kcp-dev/kcp/pkg/reconciler/cluster/heartbeat"
 	"github.com/kcp-dev/kcp/pkg/reconciler/clusterworkspacetypebootstrap"
+	"github.com/kcp-dev/kcp/pkg/reconciler/garbagecollector"
 	kcpnamespace "github.com/kcp-dev/kcp/pkg/reconciler/namespace"
+	"github.com/kcp-dev/kcp/pkg/reconciler/replication"
+	"github.com/kcp-dev/kcp/pkg/reconciler/shardcertsigning"
+	"github.com/kcp-dev/kcp/pkg/reconciler/shardregistration"
+	"github.com/kcp-dev/kcp/pkg/reconciler/shardrouting"
+	"github.com/kcp-dev/kcp/pkg/reconciler/statusbatcher"
+	"github.com/kcp-dev/kcp/pkg/reconciler/virtualworkspaceurls"
 	"github.com/kcp-dev/kcp/pkg/reconciler/workspace"
+	"github.com/kcp-dev/kcp/pkg/reconciler/workspacedeletion"
+	"github.com/kcp-dev/kcp/pkg/reconciler/workspaceresourcequota"
 	"github.com/kcp-dev/kcp/pkg/reconciler/workspaceshard"
+	"github.com/kcp-dev/kcp/pkg/reconciler/workspaceusage"
+	"github.com/kcp-dev/kcp/pkg/shardcerts"
+	"github.com/kcp-dev/kcp/pkg/sharding"
+	"github.com/kcp-dev/kcp/pkg/workspacetype"
 )
 
 func (s *Server) installClusterRoleAggregationController(ctx context.Context, config *rest.Config) error {
@@ -118,16 +154,115 @@ func (s *Server) installKubeNamespaceController(ctx context.Context, config *res
 	return nil
 }
 
+func (s *Server) installGarbageCollectorController(ctx context.Context, server *genericapiserver.GenericAPIServer) error {
+	gcConfig := asSystemComponent(server.LoopbackClientConfig, bootstrappolicy.SystemKcpGarbageCollectorUser, bootstrappolicy.SystemKcpSchedulerGroup)
+	kubeClusterClient, err := kubernetes.NewClusterForConfig(gcConfig)
+	if err != nil {
+		return err
+	}
+	dynamicClusterClient, err := dynamic.NewClusterForConfig(gcConfig)
+	if err != nil {
+		return err
+	}
+	metadataClient, err := informer.NewWildcardMetadataClient(gcConfig)
+	if err != nil {
+		return err
+	}
+
+	c := garbagecollector.NewController(dynamicClusterClient, kubeClusterClient.DiscoveryClient)
+
+	// The ownership graph is fed by metadata informers of all namespaced resources across
+	// logical clusters, including the resources of bound APIs.
+	gcInformers := informer.NewMetadataDiscoverySharedInformerFactory(
+		s.kcpSharedInformerFactory.Tenancy().V1alpha1().ClusterWorkspaces().Lister(),
+		kubeClusterClient.DiscoveryClient,
+		metadataClient,
+		func(interface{}) bool { return true },
+		c,
+		s.options.Extra.DiscoveryPollInterval,
+	)
+
+	if err := s.addControllerPostStartHook(server, "kcp-install-garbage-collector", func(hookContext genericapiserver.PostStartHookContext) error {
+		if err := s.waitForSync(hookContext.StopCh); err != nil {
+			klog.Errorf("failed to finish post-start-hook kcp-install-garbage-collector: %v", err)
+			// nolint:nilerr
+			return nil // don't klog.Fatal. This only happens when context is cancelled.
+		}
+
+		gcInformers.Start(goContext(hookContext))
+		go c.Start(goContext(hookContext), 2)
+
+		return nil
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) installWorkspaceDeletionController(ctx context.Context, server *genericapiserver.GenericAPIServer) error {
+	deletionConfig := asSystemComponent(server.LoopbackClientConfig, bootstrappolicy.SystemKcpWorkspaceDeletionUser, bootstrappolicy.SystemKcpSchedulerGroup)
+	kubeClusterClient, err := kubernetes.NewClusterForConfig(deletionConfig)
+	if err != nil {
+		return err
+	}
+	kcpClusterClient, err := kcpclient.NewClusterForConfig(deletionConfig)
+	if err != nil {
+		return err
+	}
+	dynamicClusterClient, err := dynamic.NewClusterForConfig(deletionConfig)
+	if err != nil {
+		return err
+	}
+
+	retention, err := s.options.Controllers.WorkspaceDeletion.RetentionPolicy()
+	if err != nil {
+		return err
+	}
+
+	statusBatcher := statusbatcher.NewBatcher(kcpClusterClient, statusbatcher.DefaultWindow, statusbatcher.DefaultQPS, statusbatcher.DefaultBurst)
+	c, err := workspacedeletion.NewController(
+		dynamicClusterClient,
+		kubeClusterClient.DiscoveryClient,
+		statusBatcher,
+		s.kcpSharedInformerFactory.Tenancy().V1alpha1().ClusterWorkspaces(),
+		retention,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := s.addControllerPostStartHook(server, "kcp-install-workspace-deletion-controller", func(hookContext genericapiserver.PostStartHookContext) error {
+		if err := s.waitForSync(hookContext.StopCh); err != nil {
+			klog.Errorf("failed to finish post-start-hook kcp-install-workspace-deletion-controller: %v", err)
+			// nolint:nilerr
+			return nil // don't klog.Fatal. This only happens when context is cancelled.
+		}
+
+		go statusBatcher.Start(goContext(hookContext), 2)
+		go c.Start(goContext(hookContext), 2)
+
+		return nil
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
 func (s *Server) installNamespaceScheduler(ctx context.Context, workspaceLister tenancylisters.ClusterWorkspaceLister, clientConfig clientcmdapi.Config, server *genericapiserver.GenericAPIServer) error {
-	kubeClient, err := kubernetes.NewClusterForConfig(server.LoopbackClientConfig)
+	schedulerConfig := asSystemComponent(server.LoopbackClientConfig, bootstrappolicy.SystemKcpNamespaceSchedulerUser, bootstrappolicy.SystemKcpSchedulerGroup)
+	kubeClient, err := kubernetes.NewClusterForConfig(schedulerConfig)
 	if err != nil {
 		return err
 	}
-	dynamicClusterClient, err := dynamic.NewClusterForConfig(server.LoopbackClientConfig)
+	dynamicClusterClient, err := dynamic.NewClusterForConfig(schedulerConfig)
 	if err != nil {
 		return err
 	}
 	dynamicClient := dynamicClusterClient
+	metadataClient, err := informer.NewWildcardMetadataClient(schedulerConfig)
+	if err != nil {
+		return err
+	}
 
 	// TODO(ncdc): I dont' think this is used anywhere?
 	gvkTrans := gvk.NewGVKTranslator(server.LoopbackClientConfig)
@@ -135,17 +270,22 @@ func (s *Server) installNamespaceScheduler(ctx context.Context, workspaceLister
 	namespaceScheduler := kcpnamespace.NewController(
 		workspaceLister,
 		dynamicClient,
+		metadataClient,
 		kubeClient.DiscoveryClient,
 		s.kcpSharedInformerFactory.Workload().V1alpha1().WorkloadClusters(),
 		s.kcpSharedInformerFactory.Workload().V1alpha1().WorkloadClusters().Lister(),
+		s.kcpSharedInformerFactory.Workload().V1alpha1().Placements(),
+		s.kcpSharedInformerFactory.Workload().V1alpha1().Locations(),
 		s.kubeSharedInformerFactory.Core().V1().Namespaces(),
 		s.kubeSharedInformerFactory.Core().V1().Namespaces().Lister(),
 		kubeClient,
 		gvkTrans,
 		s.options.Extra.DiscoveryPollInterval,
+		s.options.Controllers.NamespaceScheduler.UnreadyEvictionThreshold,
+		s.options.Controllers.NamespaceScheduler.EvictionGracePeriod,
 	)
 
-	if err := server.AddPostStartHook("kcp-install-namespace-scheduler", func(hookContext genericapiserver.PostStartHookContext) error {
+	if err := s.addControllerPostStartHook(server, "kcp-install-namespace-scheduler", func(hookContext genericapiserver.PostStartHookContext) error {
 		if err := s.waitForSync(hookContext.StopCh); err != nil {
 			klog.Errorf("failed to finish post-start-hook kcp-install-namespace-scheduler: %v", err)
 			// nolint:nilerr
@@ -160,32 +300,43 @@ func (s *Server) installNamespaceScheduler(ctx context.Context, workspaceLister
 	return nil
 }
 
-func (s *Server) installWorkspaceScheduler(ctx context.Context, clientConfig clientcmdapi.Config, server *genericapiserver.GenericAPIServer) error {
+func (s *Server) installWorkspaceScheduler(ctx context.Context, clientConfig clientcmdapi.Config, server *genericapiserver.GenericAPIServer, workspaceTypeResolver *workspacetype.Resolver) error {
 	kubeconfig := clientConfig.DeepCopy()
 	adminConfig, err := clientcmd.NewNonInteractiveClientConfig(*kubeconfig, "system:admin", &clientcmd.ConfigOverrides{}, nil).ClientConfig()
 	if err != nil {
 		return err
 	}
 
-	kcpClusterClient, err := kcpclient.NewClusterForConfig(adminConfig)
+	kcpClusterClient, err := kcpclient.NewClusterForConfig(asSystemComponent(adminConfig, "system:kcp:workspace-scheduler", bootstrappolicy.SystemKcpSchedulerGroup))
+	if err != nil {
+		return err
+	}
+
+	initializerConfig := asSystemComponent(adminConfig, "system:kcp:workspace-initializer", bootstrappolicy.SystemKcpInitializersGroup)
+	initializerKcpClusterClient, err := kcpclient.NewClusterForConfig(initializerConfig)
 	if err != nil {
 		return err
 	}
 
-	crdClusterClient, err := apiextensionsclient.NewClusterForConfig(adminConfig)
+	crdClusterClient, err := apiextensionsclient.NewClusterForConfig(initializerConfig)
 	if err != nil {
 		return err
 	}
 
-	dynamicClusterClient, err := dynamic.NewClusterForConfig(adminConfig)
+	dynamicClusterClient, err := dynamic.NewClusterForConfig(initializerConfig)
 	if err != nil {
 		return err
 	}
 
+	// the scheduler and the initializers share a batcher to coalesce their status changes
+	statusBatcher := statusbatcher.NewBatcher(kcpClusterClient, statusbatcher.DefaultWindow, statusbatcher.DefaultQPS, statusbatcher.DefaultBurst)
+
 	workspaceController, err := workspace.NewController(
-		kcpClusterClient,
+		statusBatcher,
 		s.kcpSharedInformerFactory.Tenancy().V1alpha1().ClusterWorkspaces(),
 		s.rootKcpSharedInformerFactory.Tenancy().V1alpha1().WorkspaceShards(),
+		workspaceTypeResolver,
+		s.options.Controllers.ShardRegistration.HeartbeatGracePeriod,
 	)
 	if err != nil {
 		return err
@@ -203,10 +354,11 @@ func (s *Server) installWorkspaceScheduler(ctx context.Context, clientConfig cli
 	organizationController, err := clusterworkspacetypebootstrap.NewController(
 		dynamicClusterClient,
 		crdClusterClient,
-		kcpClusterClient,
+		statusBatcher,
 		s.kcpSharedInformerFactory.Tenancy().V1alpha1().ClusterWorkspaces(),
 		"Organization",
-		configorganization.Bootstrap,
+		clusterworkspacetypebootstrap.DefaultShards,
+		configsystemexports.WithBindings(configorganization.Bootstrap, initializerKcpClusterClient.Cluster(helper.RootCluster), configsystemexports.ForType("Organization")...),
 	)
 	if err != nil {
 		return err
@@ -215,22 +367,24 @@ func (s *Server) installWorkspaceScheduler(ctx context.Context, clientConfig cli
 	universalController, err := clusterworkspacetypebootstrap.NewController(
 		dynamicClusterClient,
 		crdClusterClient,
-		kcpClusterClient,
+		statusBatcher,
 		s.kcpSharedInformerFactory.Tenancy().V1alpha1().ClusterWorkspaces(),
 		"Universal",
-		configuniversal.Bootstrap,
+		clusterworkspacetypebootstrap.DefaultShards,
+		configsystemexports.WithBindings(configuniversal.Bootstrap, initializerKcpClusterClient.Cluster(helper.RootCluster), configsystemexports.ForType("Universal")...),
 	)
 	if err != nil {
 		return err
 	}
 
-	if err := server.AddPostStartHook("kcp-install-workspace-scheduler", func(hookContext genericapiserver.PostStartHookContext) error {
+	if err := s.addControllerPostStartHook(server, "kcp-install-workspace-scheduler", func(hookContext genericapiserver.PostStartHookContext) error {
 		if err := s.waitForSync(hookContext.StopCh); err != nil {
 			klog.Errorf("failed to finish post-start-hook kcp-install-workspace-scheduler: %v", err)
 			// nolint:nilerr
 			return nil // don't klog.Fatal. This only happens when context is cancelled.
 		}
 
+		go statusBatcher.Start(ctx, 2)
 		go workspaceController.Start(ctx, 2)
 		go workspaceShardController.Start(ctx, 2)
 		go organizationController.Start(ctx, 2)
@@ -243,31 +397,41 @@ func (s *Server) installWorkspaceScheduler(ctx context.Context, clientConfig cli
 	return nil
 }
 
-func (s *Server) installApiImportController(ctx context.Context, clientConfig clientcmdapi.Config, server *genericapiserver.GenericAPIServer) error {
+func (s *Server) installAPIExportIdentityController(ctx context.Context, clientConfig clientcmdapi.Config, server *genericapiserver.GenericAPIServer) error {
 	kubeconfig := clientConfig.DeepCopy()
-	for _, cluster := range kubeconfig.Clusters {
-		hostURL, err := url.Parse(cluster.Server)
-		if err != nil {
-			return err
-		}
-		hostURL.Host = server.ExternalAddress
-		cluster.Server = hostURL.String()
+	adminConfig, err := clientcmd.NewNonInteractiveClientConfig(*kubeconfig, "system:admin", &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+	if err != nil {
+		return err
 	}
 
-	c := s.options.Controllers.ApiImporter.Complete(*kubeconfig, s.kcpSharedInformerFactory, s.apiextensionsSharedInformerFactory)
-	apiimporter, err := c.New()
+	identityConfig := asSystemComponent(adminConfig, "system:kcp:apiexport-identity", bootstrappolicy.SystemKcpSchedulerGroup)
+	kcpClusterClient, err := kcpclient.NewClusterForConfig(identityConfig)
+	if err != nil {
+		return err
+	}
+	kubeClusterClient, err := kubernetes.NewClusterForConfig(identityConfig)
+	if err != nil {
+		return err
+	}
+
+	c, err := apiexport.NewController(
+		kcpClusterClient,
+		kubeClusterClient,
+		s.kcpSharedInformerFactory.Apis().V1alpha1().APIExports(),
+		s.kubeSharedInformerFactory.Core().V1().Secrets(),
+	)
 	if err != nil {
 		return err
 	}
 
-	if err := server.AddPostStartHook("kcp-install-api-importer-controller", func(hookContext genericapiserver.PostStartHookContext) error {
+	if err := s.addControllerPostStartHook(server, "kcp-install-apiexport-identity-controller", func(hookContext genericapiserver.PostStartHookContext) error {
 		if err := s.waitForSync(hookContext.StopCh); err != nil {
-			klog.Errorf("failed to finish post-start-hook kcp-install-api-importer-controller: %v", err)
+			klog.Errorf("failed to finish post-start-hook kcp-install-apiexport-identity-controller: %v", err)
 			// nolint:nilerr
 			return nil // don't klog.Fatal. This only happens when context is cancelled.
 		}
 
-		go apiimporter.Start(goContext(hookContext))
+		go c.Start(ctx, 2)
 
 		return nil
 	}); err != nil {
@@ -276,42 +440,79 @@ func (s *Server) installApiImportController(ctx context.Context, clientConfig cl
 	return nil
 }
 
-func (s *Server) installApiResourceController(ctx context.Context, crdClusterClient apiextensionsclient.ClusterInterface, clientConfig clientcmdapi.Config, server *genericapiserver.GenericAPIServer) error {
+func (s *Server) installAPIBindingUpgradeController(ctx context.Context, clientConfig clientcmdapi.Config, server *genericapiserver.GenericAPIServer) error {
 	kubeconfig := clientConfig.DeepCopy()
-	for _, cluster := range kubeconfig.Clusters {
-		hostURL, err := url.Parse(cluster.Server)
-		if err != nil {
-			return err
-		}
-		hostURL.Host = server.ExternalAddress
-		cluster.Server = hostURL.String()
+	adminConfig, err := clientcmd.NewNonInteractiveClientConfig(*kubeconfig, "system:admin", &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+	if err != nil {
+		return err
 	}
 
-	c := s.options.Controllers.ApiResource.Complete(*kubeconfig, s.kcpSharedInformerFactory, s.apiextensionsSharedInformerFactory)
-	apiresource, err := c.New()
+	upgradeConfig := asSystemComponent(adminConfig, bootstrappolicy.SystemKcpAPIBindingUpgradeUser, bootstrappolicy.SystemKcpSchedulerGroup)
+	kcpClusterClient, err := kcpclient.NewClusterForConfig(upgradeConfig)
+	if err != nil {
+		return err
+	}
+	dynamicClusterClient, err := dynamic.NewClusterForConfig(upgradeConfig)
 	if err != nil {
 		return err
 	}
 
-	if err := server.AddPostStartHook("kcp-install-api-resource-controller", func(hookContext genericapiserver.PostStartHookContext) error {
-		// HACK HACK HACK
-		// TODO(sttts): these CRDs can go away when when we don't need a CRD in some workspace for "*" informers to work
-		err = configcrds.Create(ctx, crdClusterClient.Cluster(genericcontrolplane.LocalAdminCluster).ApiextensionsV1().CustomResourceDefinitions(),
-			metav1.GroupResource{Group: workload.GroupName, Resource: "workloadclusters"},
-			metav1.GroupResource{Group: apiresourceapi.GroupName, Resource: "apiresourceimports"},
-			metav1.GroupResource{Group: apiresourceapi.GroupName, Resource: "negotiatedapiresources"},
-		)
-		if err != nil {
-			return err
+	c, err := apibindingupgrade.NewController(
+		kcpClusterClient,
+		dynamicClusterClient,
+		s.kcpSharedInformerFactory.Apis().V1alpha1().APIBindings(),
+		s.kcpSharedInformerFactory.Apis().V1alpha1().APIExports(),
+		s.kcpSharedInformerFactory.Apis().V1alpha1().APIResourceSchemas(),
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := s.addControllerPostStartHook(server, "kcp-install-apibinding-upgrade-controller", func(hookContext genericapiserver.PostStartHookContext) error {
+		if err := s.waitForSync(hookContext.StopCh); err != nil {
+			klog.Errorf("failed to finish post-start-hook kcp-install-apibinding-upgrade-controller: %v", err)
+			// nolint:nilerr
+			return nil // don't klog.Fatal. This only happens when context is cancelled.
 		}
 
+		go c.Start(ctx, 2)
+
+		return nil
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) installAPIBindingConflictsController(ctx context.Context, clientConfig clientcmdapi.Config, server *genericapiserver.GenericAPIServer) error {
+	kubeconfig := clientConfig.DeepCopy()
+	adminConfig, err := clientcmd.NewNonInteractiveClientConfig(*kubeconfig, "system:admin", &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+	if err != nil {
+		return err
+	}
+
+	kcpClusterClient, err := kcpclient.NewClusterForConfig(asSystemComponent(adminConfig, "system:kcp:apibinding-conflicts", bootstrappolicy.SystemKcpSchedulerGroup))
+	if err != nil {
+		return err
+	}
+
+	c, err := apibindingconflicts.NewController(
+		kcpClusterClient,
+		s.kcpSharedInformerFactory.Apis().V1alpha1().APIBindings(),
+		s.apiextensionsSharedInformerFactory.Apiextensions().V1().CustomResourceDefinitions(),
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := s.addControllerPostStartHook(server, "kcp-install-apibinding-conflicts-controller", func(hookContext genericapiserver.PostStartHookContext) error {
 		if err := s.waitForSync(hookContext.StopCh); err != nil {
-			klog.Errorf("failed to finish post-start-hook kcp-install-api-resource-controller: %v", err)
+			klog.Errorf("failed to finish post-start-hook kcp-install-apibinding-conflicts-controller: %v", err)
 			// nolint:nilerr
 			return nil // don't klog.Fatal. This only happens when context is cancelled.
 		}
 
-		go apiresource.Start(goContext(hookContext), c.NumThreads)
+		go c.Start(ctx, 2)
 
 		return nil
 	}); err != nil {
@@ -320,40 +521,114 @@ func (s *Server) installApiResourceController(ctx context.Context, crdClusterCli
 	return nil
 }
 
-func (s *Server) installSyncerController(ctx context.Context, clientConfig clientcmdapi.Config, server *genericapiserver.GenericAPIServer) error {
+func (s *Server) installAPIBindingRolesController(ctx context.Context, clientConfig clientcmdapi.Config, server *genericapiserver.GenericAPIServer) error {
 	kubeconfig := clientConfig.DeepCopy()
-	for _, cluster := range kubeconfig.Clusters {
-		hostURL, err := url.Parse(cluster.Server)
-		if err != nil {
-			return err
+	adminConfig, err := clientcmd.NewNonInteractiveClientConfig(*kubeconfig, "system:admin", &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+	if err != nil {
+		return err
+	}
+
+	kubeClusterClient, err := kubernetes.NewClusterForConfig(asSystemComponent(adminConfig, "system:kcp:apibinding-roles", bootstrappolicy.SystemKcpSchedulerGroup))
+	if err != nil {
+		return err
+	}
+
+	c, err := apibindingroles.NewController(
+		kubeClusterClient,
+		s.kcpSharedInformerFactory.Apis().V1alpha1().APIBindings(),
+		s.kcpSharedInformerFactory.Apis().V1alpha1().APIResourceSchemas(),
+		s.kubeSharedInformerFactory.Rbac().V1().ClusterRoles(),
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := s.addControllerPostStartHook(server, "kcp-install-apibinding-roles-controller", func(hookContext genericapiserver.PostStartHookContext) error {
+		if err := s.waitForSync(hookContext.StopCh); err != nil {
+			klog.Errorf("failed to finish post-start-hook kcp-install-apibinding-roles-controller: %v", err)
+			// nolint:nilerr
+			return nil // don't klog.Fatal. This only happens when context is cancelled.
 		}
-		hostURL.Host = server.ExternalAddress
-		cluster.Server = hostURL.String()
+
+		go c.Start(ctx, 2)
+
+		return nil
+	}); err != nil {
+		return err
 	}
+	return nil
+}
 
-	c := s.options.Controllers.Syncer.Complete(
-		*kubeconfig,
-		s.kcpSharedInformerFactory,
-		s.apiextensionsSharedInformerFactory,
-		s.options.Controllers.ApiImporter.ResourcesToSync,
+func (s *Server) installBoundCRDsController(ctx context.Context, clientConfig clientcmdapi.Config, server *genericapiserver.GenericAPIServer, boundCRDResolver *boundcrds.Resolver) error {
+	kubeconfig := clientConfig.DeepCopy()
+	adminConfig, err := clientcmd.NewNonInteractiveClientConfig(*kubeconfig, "system:admin", &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+	if err != nil {
+		return err
+	}
+
+	crdClusterClient, err := apiextensionsclient.NewClusterForConfig(asSystemComponent(adminConfig, "system:kcp:bound-crds", bootstrappolicy.SystemKcpSchedulerGroup))
+	if err != nil {
+		return err
+	}
+
+	c, err := boundcrds.NewController(
+		crdClusterClient,
+		boundCRDResolver,
+		s.kcpSharedInformerFactory.Apis().V1alpha1().APIBindings(),
+		s.kcpSharedInformerFactory.Apis().V1alpha1().APIResourceSchemas(),
+		s.apiextensionsSharedInformerFactory.Apiextensions().V1().CustomResourceDefinitions(),
 	)
-	optionalSyncer, err := c.NewOrNil()
 	if err != nil {
 		return err
 	}
-	if optionalSyncer == nil {
-		klog.Info("syncer not enabled. To enable, supply --pull-mode or --push-mode")
+
+	if err := s.addControllerPostStartHook(server, "kcp-install-bound-crds-controller", func(hookContext genericapiserver.PostStartHookContext) error {
+		if err := s.waitForSync(hookContext.StopCh); err != nil {
+			klog.Errorf("failed to finish post-start-hook kcp-install-bound-crds-controller: %v", err)
+			// nolint:nilerr
+			return nil // don't klog.Fatal. This only happens when context is cancelled.
+		}
+
+		go c.Start(ctx, 2)
+
 		return nil
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) installVirtualWorkspaceURLsController(ctx context.Context, clientConfig clientcmdapi.Config, server *genericapiserver.GenericAPIServer) error {
+	kubeconfig := clientConfig.DeepCopy()
+	adminConfig, err := clientcmd.NewNonInteractiveClientConfig(*kubeconfig, "system:admin", &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+	if err != nil {
+		return err
+	}
+
+	kcpClusterClient, err := kcpclient.NewClusterForConfig(asSystemComponent(adminConfig, "system:kcp:virtual-workspace-urls", bootstrappolicy.SystemKcpSchedulerGroup))
+	if err != nil {
+		return err
+	}
+
+	c, err := virtualworkspaceurls.NewController(
+		kcpClusterClient,
+		s.rootKcpSharedInformerFactory.Tenancy().V1alpha1().WorkspaceShards(),
+		s.kcpSharedInformerFactory.Apis().V1alpha1().APIExports(),
+		s.kcpSharedInformerFactory.Apis().V1alpha1().APIExportEndpointSlices(),
+		s.kcpSharedInformerFactory.Workload().V1alpha1().WorkloadClusters(),
+	)
+	if err != nil {
+		return err
 	}
 
-	if err := server.AddPostStartHook("kcp-install-syncer-controller", func(hookContext genericapiserver.PostStartHookContext) error {
+	if err := s.addControllerPostStartHook(server, "kcp-install-virtual-workspace-urls-controller", func(hookContext genericapiserver.PostStartHookContext) error {
 		if err := s.waitForSync(hookContext.StopCh); err != nil {
-			klog.Errorf("failed to finish post-start-hook kcp-install-syncer-controller: %v", err)
+			klog.Errorf("failed to finish post-start-hook kcp-install-virtual-workspace-urls-controller: %v", err)
 			// nolint:nilerr
 			return nil // don't klog.Fatal. This only happens when context is cancelled.
 		}
 
-		go optionalSyncer.Start(goContext(hookContext))
+		go c.Start(ctx, 2)
 
 		return nil
 	}); err != nil {
@@ -362,6 +637,555 @@ func (s *Server) installSyncerController(ctx context.Context, clientConfig clien
 	return nil
 }
 
+func (s *Server) installAPIServiceAvailabilityController(ctx context.Context, clientConfig clientcmdapi.Config, server *genericapiserver.GenericAPIServer, apiServiceInformer informers.GenericInformer, transports *aggregator.Transports) error {
+	kubeconfig := clientConfig.DeepCopy()
+	adminConfig, err := clientcmd.NewNonInteractiveClientConfig(*kubeconfig, "system:admin", &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+	if err != nil {
+		return err
+	}
+
+	dynamicClusterClient, err := dynamic.NewClusterForConfig(asSystemComponent(adminConfig, "system:kcp:apiservice-availability", bootstrappolicy.SystemKcpSchedulerGroup))
+	if err != nil {
+		return err
+	}
+
+	c, err := apiserviceavailability.NewController(
+		dynamicClusterClient,
+		apiServiceInformer,
+		transports,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := s.addControllerPostStartHook(server, "kcp-install-apiservice-availability-controller", func(hookContext genericapiserver.PostStartHookContext) error {
+		if err := s.waitForSync(hookContext.StopCh); err != nil {
+			klog.Errorf("failed to finish post-start-hook kcp-install-apiservice-availability-controller: %v", err)
+			// nolint:nilerr
+			return nil // don't klog.Fatal. This only happens when context is cancelled.
+		}
+
+		go c.Start(goContext(hookContext), 2)
+
+		return nil
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) installApiImportController(ctx context.Context, clientConfig clientcmdapi.Config, server *genericapiserver.GenericAPIServer) error {
+	kubeconfig := clientConfig.DeepCopy()
+	for _, cluster := range kubeconfig.Clusters {
+		hostURL, err := url.Parse(cluster.Server)
+		if err != nil {
+			return err
+		}
+		hostURL.Host = server.ExternalAddress
+		cluster.Server = hostURL.String()
+	}
+
+	c := s.options.Controllers.ApiImporter.Complete(*kubeconfig, s.kcpSharedInformerFactory, s.apiextensionsSharedInformerFactory)
+	apiimporter, err := c.New()
+	if err != nil {
+		return err
+	}
+
+	if err := s.addControllerPostStartHook(server, "kcp-install-api-importer-controller", func(hookContext genericapiserver.PostStartHookContext) error {
+		if err := s.waitForSync(hookContext.StopCh); err != nil {
+			klog.Errorf("failed to finish post-start-hook kcp-install-api-importer-controller: %v", err)
+			// nolint:nilerr
+			return nil // don't klog.Fatal. This only happens when context is cancelled.
+		}
+
+		go apiimporter.Start(goContext(hookContext))
+
+		return nil
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) installApiResourceController(ctx context.Context, crdClusterClient apiextensionsclient.ClusterInterface, clientConfig clientcmdapi.Config, server *genericapiserver.GenericAPIServer) error {
+	kubeconfig := clientConfig.DeepCopy()
+	for _, cluster := range kubeconfig.Clusters {
+		hostURL, err := url.Parse(cluster.Server)
+		if err != nil {
+			return err
+		}
+		hostURL.Host = server.ExternalAddress
+		cluster.Server = hostURL.String()
+	}
+
+	c := s.options.Controllers.ApiResource.Complete(*kubeconfig, s.kcpSharedInformerFactory, s.apiextensionsSharedInformerFactory)
+	apiresource, err := c.New()
+	if err != nil {
+		return err
+	}
+
+	if err := s.addControllerPostStartHook(server, "kcp-install-api-resource-controller", func(hookContext genericapiserver.PostStartHookContext) error {
+		// HACK HACK HACK
+		// TODO(sttts): these CRDs can go away when when we don't need a CRD in some workspace for "*" informers to work
+		err = configcrds.Create(ctx, crdClusterClient.Cluster(genericcontrolplane.LocalAdminCluster).ApiextensionsV1().CustomResourceDefinitions(),
+			metav1.GroupResource{Group: workload.GroupName, Resource: "workloadclusters"},
+			metav1.GroupResource{Group: workload.GroupName, Resource: "locations"},
+			metav1.GroupResource{Group: workload.GroupName, Resource: "placements"},
+			metav1.GroupResource{Group: apiresourceapi.GroupName, Resource: "apiresourceimports"},
+			metav1.GroupResource{Group: apiresourceapi.GroupName, Resource: "negotiatedapiresources"},
+		)
+		if err != nil {
+			return err
+		}
+
+		if err := s.waitForSync(hookContext.StopCh); err != nil {
+			klog.Errorf("failed to finish post-start-hook kcp-install-api-resource-controller: %v", err)
+			// nolint:nilerr
+			return nil // don't klog.Fatal. This only happens when context is cancelled.
+		}
+
+		go apiresource.Start(goContext(hookContext), c.NumThreads)
+
+		return nil
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) installSyncerController(ctx context.Context, clientConfig clientcmdapi.Config, server *genericapiserver.GenericAPIServer) error {
+	kubeconfig := clientConfig.DeepCopy()
+	for _, cluster := range kubeconfig.Clusters {
+		hostURL, err := url.Parse(cluster.Server)
+		if err != nil {
+			return err
+		}
+		hostURL.Host = server.ExternalAddress
+		cluster.Server = hostURL.String()
+	}
+
+	c := s.options.Controllers.Syncer.Complete(
+		*kubeconfig,
+		s.kcpSharedInformerFactory,
+		s.apiextensionsSharedInformerFactory,
+		s.options.Controllers.ApiImporter.ResourcesToSync,
+	)
+	optionalSyncer, err := c.NewOrNil()
+	if err != nil {
+		return err
+	}
+	if optionalSyncer == nil {
+		klog.Info("syncer not enabled. To enable, supply --pull-mode or --push-mode")
+		return nil
+	}
+
+	if err := s.addControllerPostStartHook(server, "kcp-install-syncer-controller", func(hookContext genericapiserver.PostStartHookContext) error {
+		if err := s.waitForSync(hookContext.StopCh); err != nil {
+			klog.Errorf("failed to finish post-start-hook kcp-install-syncer-controller: %v", err)
+			// nolint:nilerr
+			return nil // don't klog.Fatal. This only happens when context is cancelled.
+		}
+
+		go optionalSyncer.Start(goContext(hookContext))
+
+		return nil
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) installSyncerHeartbeatController(ctx context.Context, clientConfig clientcmdapi.Config, server *genericapiserver.GenericAPIServer) error {
+	kubeconfig := clientConfig.DeepCopy()
+	adminConfig, err := clientcmd.NewNonInteractiveClientConfig(*kubeconfig, "system:admin", &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+	if err != nil {
+		return err
+	}
+
+	kcpClusterClient, err := kcpclient.NewClusterForConfig(asSystemComponent(adminConfig, "system:kcp:syncer-heartbeat", bootstrappolicy.SystemKcpSchedulerGroup))
+	if err != nil {
+		return err
+	}
+
+	c := heartbeat.NewController(
+		kcpClusterClient,
+		s.kcpSharedInformerFactory.Workload().V1alpha1().WorkloadClusters(),
+		s.options.Controllers.SyncerHeartbeat.HeartbeatGracePeriod,
+	)
+
+	if err := s.addControllerPostStartHook(server, "kcp-install-syncer-heartbeat-controller", func(hookContext genericapiserver.PostStartHookContext) error {
+		if err := s.waitForSync(hookContext.StopCh); err != nil {
+			klog.Errorf("failed to finish post-start-hook kcp-install-syncer-heartbeat-controller: %v", err)
+			// nolint:nilerr
+			return nil // don't klog.Fatal. This only happens when context is cancelled.
+		}
+
+		go c.Start(ctx, 2)
+
+		return nil
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) installWorkspaceUsageController(ctx context.Context, clientConfig clientcmdapi.Config, server *genericapiserver.GenericAPIServer) error {
+	kubeconfig := clientConfig.DeepCopy()
+	adminConfig, err := clientcmd.NewNonInteractiveClientConfig(*kubeconfig, "system:admin", &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+	if err != nil {
+		return err
+	}
+
+	kcpClusterClient, err := kcpclient.NewClusterForConfig(asSystemComponent(adminConfig, "system:kcp:workspace-usage", bootstrappolicy.SystemKcpSchedulerGroup))
+	if err != nil {
+		return err
+	}
+
+	etcdClient, err := s.newEtcdClient()
+	if err != nil {
+		return err
+	}
+
+	c := workspaceusage.NewController(
+		etcdClient,
+		s.options.GenericControlPlane.Etcd.StorageConfig.Prefix,
+		kcpClusterClient,
+		s.kcpSharedInformerFactory.Tenancy().V1alpha1().ClusterWorkspaces(),
+		s.options.Controllers.WorkspaceUsage.Interval,
+	)
+
+	if err := s.addControllerPostStartHook(server, "kcp-install-workspace-usage-controller", func(hookContext genericapiserver.PostStartHookContext) error {
+		if err := s.waitForSync(hookContext.StopCh); err != nil {
+			klog.Errorf("failed to finish post-start-hook kcp-install-workspace-usage-controller: %v", err)
+			// nolint:nilerr
+			return nil // don't klog.Fatal. This only happens when context is cancelled.
+		}
+
+		go func() {
+			defer etcdClient.Close()
+			c.Start(goContext(hookContext))
+		}()
+
+		return nil
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) installWorkspaceResourceQuotaController(ctx context.Context, clientConfig clientcmdapi.Config, server *genericapiserver.GenericAPIServer, counter *objectcount.Counter) error {
+	kubeconfig := clientConfig.DeepCopy()
+	adminConfig, err := clientcmd.NewNonInteractiveClientConfig(*kubeconfig, "system:admin", &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+	if err != nil {
+		return err
+	}
+
+	kcpClusterClient, err := kcpclient.NewClusterForConfig(asSystemComponent(adminConfig, "system:kcp:workspace-resource-quota", bootstrappolicy.SystemKcpSchedulerGroup))
+	if err != nil {
+		return err
+	}
+
+	c := workspaceresourcequota.NewController(
+		kcpClusterClient,
+		s.kcpSharedInformerFactory.Tenancy().V1alpha1().WorkspaceResourceQuotas(),
+		s.kcpSharedInformerFactory.Tenancy().V1alpha1().ClusterWorkspaces(),
+		counter,
+		s.options.Controllers.WorkspaceQuota.Interval,
+	)
+
+	if err := s.addControllerPostStartHook(server, "kcp-install-workspace-resource-quota-controller", func(hookContext genericapiserver.PostStartHookContext) error {
+		if err := s.waitForSync(hookContext.StopCh); err != nil {
+			klog.Errorf("failed to finish post-start-hook kcp-install-workspace-resource-quota-controller: %v", err)
+			// nolint:nilerr
+			return nil // don't klog.Fatal. This only happens when context is cancelled.
+		}
+
+		go c.Start(goContext(hookContext))
+
+		return nil
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) installReplicationController(ctx context.Context, clientConfig clientcmdapi.Config, server *genericapiserver.GenericAPIServer) error {
+	kubeconfig := clientConfig.DeepCopy()
+	adminConfig, err := clientcmd.NewNonInteractiveClientConfig(*kubeconfig, "system:admin", &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+	if err != nil {
+		return err
+	}
+	localClusterClient, err := dynamic.NewClusterForConfig(asSystemComponent(adminConfig, "system:kcp:replication", bootstrappolicy.SystemKcpReplicationGroup))
+	if err != nil {
+		return err
+	}
+
+	rootShardConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(&clientcmd.ClientConfigLoadingRules{ExplicitPath: s.options.Extra.RootShardKubeconfigFile}, nil).ClientConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load root shard kubeconfig: %w", err)
+	}
+	rootShardClusterClient, err := dynamic.NewClusterForConfig(rootShardConfig)
+	if err != nil {
+		return err
+	}
+
+	c, err := replication.NewController(
+		sharding.RootShard,
+		dynamicinformer.NewDynamicSharedInformerFactory(rootShardClusterClient.Cluster("*"), resyncPeriod),
+		localClusterClient,
+		dynamicinformer.NewFilteredDynamicSharedInformerFactory(localClusterClient.Cluster("*"), resyncPeriod, metav1.NamespaceAll, func(options *metav1.ListOptions) {
+			options.LabelSelector = replication.ReplicatedFromLabel
+		}),
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := s.addControllerPostStartHook(server, "kcp-install-replication-controller", func(hookContext genericapiserver.PostStartHookContext) error {
+		if err := s.waitForSync(hookContext.StopCh); err != nil {
+			klog.Errorf("failed to finish post-start-hook kcp-install-replication-controller: %v", err)
+			// nolint:nilerr
+			return nil // don't klog.Fatal. This only happens when context is cancelled.
+		}
+
+		go c.Start(goContext(hookContext), 2)
+
+		return nil
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) installShardRegistrationController(ctx context.Context, clientConfig clientcmdapi.Config, server *genericapiserver.GenericAPIServer) error {
+	kubeconfig := clientConfig.DeepCopy()
+	adminConfig, err := clientcmd.NewNonInteractiveClientConfig(*kubeconfig, "system:admin", &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+	if err != nil {
+		return err
+	}
+
+	// the root shard registers itself locally, the other shards through the root shard
+	rootConfig := asSystemComponent(adminConfig, "system:kcp:shard-registration", bootstrappolicy.SystemKcpSchedulerGroup)
+	if s.options.Extra.RootShardKubeconfigFile != "" {
+		rootConfig, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(&clientcmd.ClientConfigLoadingRules{ExplicitPath: s.options.Extra.RootShardKubeconfigFile}, nil).ClientConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load root shard kubeconfig: %w", err)
+		}
+	}
+	rootKubeClusterClient, err := kubernetes.NewClusterForConfig(rootConfig)
+	if err != nil {
+		return err
+	}
+	rootKcpClusterClient, err := kcpclient.NewClusterForConfig(rootConfig)
+	if err != nil {
+		return err
+	}
+
+	// with a shard CA, the peers trust the serving certificates it issues, which are rotated,
+	// and authenticate with the client certificates it issues to them.
+	// TODO(sttts): wire controller updating the serving certificate when it changes without a shard CA
+	caData, _ := server.SecureServingInfo.Cert.CurrentCertKeyContent()
+	if s.options.ShardCertificates.Enabled() {
+		caData, err = os.ReadFile(s.options.ShardCertificates.CAFile)
+		if err != nil {
+			return err
+		}
+	}
+	shardKubeconfig, err := clientcmd.Write(clientcmdapi.Config{
+		Clusters: map[string]*clientcmdapi.Cluster{
+			"shard": {
+				Server:                   "https://" + server.ExternalAddress,
+				CertificateAuthorityData: caData,
+			},
+		},
+		Contexts: map[string]*clientcmdapi.Context{
+			"shard": {Cluster: "shard"},
+		},
+		CurrentContext: "shard",
+	})
+	if err != nil {
+		return err
+	}
+
+	etcdClient, err := s.newEtcdClient()
+	if err != nil {
+		return err
+	}
+	// an embedded etcd is never shared with other shards
+	var etcd *tenancyv1alpha1.WorkspaceShardEtcd
+	if !s.options.EmbeddedEtcd.Enabled {
+		storageConfig := s.options.GenericControlPlane.Etcd.StorageConfig
+		etcd = &tenancyv1alpha1.WorkspaceShardEtcd{
+			Endpoints: storageConfig.Transport.ServerList,
+			Prefix:    storageConfig.Prefix,
+		}
+	}
+
+	c := shardregistration.NewController(
+		s.options.Extra.ShardName,
+		shardKubeconfig,
+		version.Get().GitVersion,
+		rootKubeClusterClient.Cluster(helper.RootCluster),
+		rootKcpClusterClient.Cluster(helper.RootCluster),
+		etcdClient,
+		etcd,
+		s.options.Controllers.ShardRegistration.Labels,
+		s.kcpSharedInformerFactory.Tenancy().V1alpha1().ClusterWorkspaces(),
+		s.options.Controllers.ShardRegistration.WorkspaceCapacity,
+		s.options.Controllers.ShardRegistration.HeartbeatInterval,
+	)
+
+	if err := s.addControllerPostStartHook(server, "kcp-install-shard-registration-controller", func(hookContext genericapiserver.PostStartHookContext) error {
+		if err := s.waitForSync(hookContext.StopCh); err != nil {
+			klog.Errorf("failed to finish post-start-hook kcp-install-shard-registration-controller: %v", err)
+			// nolint:nilerr
+			return nil // don't klog.Fatal. This only happens when context is cancelled.
+		}
+
+		go func() {
+			defer etcdClient.Close()
+			c.Start(goContext(hookContext))
+		}()
+
+		return nil
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) installShardRoutingController(ctx context.Context, clientConfig clientcmdapi.Config, server *genericapiserver.GenericAPIServer, loader *sharding.ClientLoader) error {
+	kubeconfig := clientConfig.DeepCopy()
+	adminConfig, err := clientcmd.NewNonInteractiveClientConfig(*kubeconfig, "system:admin", &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+	if err != nil {
+		return err
+	}
+
+	// the credentials of the shards are only stored on the root shard
+	rootConfig := asSystemComponent(adminConfig, "system:kcp:shard-routing", bootstrappolicy.SystemKcpSchedulerGroup)
+	if s.options.Extra.RootShardKubeconfigFile != "" {
+		rootConfig, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(&clientcmd.ClientConfigLoadingRules{ExplicitPath: s.options.Extra.RootShardKubeconfigFile}, nil).ClientConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load root shard kubeconfig: %w", err)
+		}
+	}
+	rootKubeClusterClient, err := kubernetes.NewClusterForConfig(rootConfig)
+	if err != nil {
+		return err
+	}
+
+	var clientTLS *rest.TLSClientConfig
+	if s.options.ShardCertificates.Enabled() {
+		certFile, keyFile := s.options.ShardCertificates.ClientCertFile()
+		clientTLS = &rest.TLSClientConfig{
+			CAFile:   s.options.ShardCertificates.CAFile,
+			CertFile: certFile,
+			KeyFile:  keyFile,
+		}
+	}
+
+	c := shardrouting.NewController(
+		s.options.Extra.ShardName,
+		loader,
+		clientTLS,
+		rootKubeClusterClient.Cluster(helper.RootCluster),
+		s.rootKcpSharedInformerFactory.Tenancy().V1alpha1().WorkspaceShards(),
+	)
+
+	if err := s.addControllerPostStartHook(server, "kcp-install-shard-routing-controller", func(hookContext genericapiserver.PostStartHookContext) error {
+		if err := s.waitForSync(hookContext.StopCh); err != nil {
+			klog.Errorf("failed to finish post-start-hook kcp-install-shard-routing-controller: %v", err)
+			// nolint:nilerr
+			return nil // don't klog.Fatal. This only happens when context is cancelled.
+		}
+
+		go c.Start(goContext(hookContext), 1)
+
+		return nil
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) installShardCertificateSigningController(ctx context.Context, clientConfig clientcmdapi.Config, server *genericapiserver.GenericAPIServer) error {
+	kubeconfig := clientConfig.DeepCopy()
+	adminConfig, err := clientcmd.NewNonInteractiveClientConfig(*kubeconfig, "system:admin", &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+	if err != nil {
+		return err
+	}
+	kubeClusterClient, err := kubernetes.NewClusterForConfig(asSystemComponent(adminConfig, "system:kcp:shard-certificate-signer", bootstrappolicy.SystemKcpSchedulerGroup))
+	if err != nil {
+		return err
+	}
+
+	issuer, err := shardcerts.LoadIssuer(s.options.ShardCertificates.CAFile, s.options.ShardCertificates.CAKeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load the shard CA: %w", err)
+	}
+	authz, err := kcpadmissionhelpers.NewAdmissionAuthorizer(helper.RootCluster, kubeClusterClient)
+	if err != nil {
+		return err
+	}
+
+	c := shardcertsigning.NewController(
+		issuer,
+		s.options.ShardCertificates.Validity,
+		kubeClusterClient.Cluster(helper.RootCluster).CertificatesV1().CertificateSigningRequests(),
+		authz,
+		s.rootKubeSharedInformerFactory.Certificates().V1().CertificateSigningRequests(),
+	)
+
+	if err := s.addControllerPostStartHook(server, "kcp-install-shard-certificate-signing-controller", func(hookContext genericapiserver.PostStartHookContext) error {
+		if err := s.waitForSync(hookContext.StopCh); err != nil {
+			klog.Errorf("failed to finish post-start-hook kcp-install-shard-certificate-signing-controller: %v", err)
+			// nolint:nilerr
+			return nil // don't klog.Fatal. This only happens when context is cancelled.
+		}
+
+		go c.Start(goContext(hookContext), 1)
+
+		return nil
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
+// newEtcdClient returns a client of the etcd the shard stores its objects in.
+func (s *Server) newEtcdClient() (*clientv3.Client, error) {
+	storageConfig := s.options.GenericControlPlane.Etcd.StorageConfig
+	etcdConfig := clientv3.Config{
+		Endpoints:   storageConfig.Transport.ServerList,
+		DialTimeout: 20 * time.Second,
+	}
+	if storageConfig.Transport.CertFile != "" || storageConfig.Transport.KeyFile != "" || storageConfig.Transport.TrustedCAFile != "" {
+		tlsInfo := transport.TLSInfo{
+			CertFile:      storageConfig.Transport.CertFile,
+			KeyFile:       storageConfig.Transport.KeyFile,
+			TrustedCAFile: storageConfig.Transport.TrustedCAFile,
+		}
+		var err error
+		if etcdConfig.TLS, err = tlsInfo.ClientConfig(); err != nil {
+			return nil, err
+		}
+	}
+
+	// the client connects lazily, so it can be created before etcd is reachable
+	return clientv3.New(etcdConfig)
+}
+
+// asSystemComponent returns a copy of the given config that impersonates a kcp system
+// component instead of using the privileged loopback identity.
+func asSystemComponent(config *rest.Config, userName, group string) *rest.Config {
+	config = rest.CopyConfig(config)
+	config.Impersonate = rest.ImpersonationConfig{
+		UserName: userName,
+		Groups:   []string{group},
+	}
+	return config
+}
+
 func (s *Server) waitForSync(stop <-chan struct{}) error {
 	// Wait for shared informer factories to by synced.
 	// factory. Otherwise, informer list calls may go into backoff (before the CRDs are ready) and
@@ -0,0 +1,264 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discoverycache
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The aggregated discovery of Kubernetes 1.26+, i.e. the groups, versions and resources
+// of /api or /apis in a single document, as an APIGroupDiscoveryList of the
+// apidiscovery.k8s.io group, which clients ask for in their Accept header.
+const (
+	aggregatedDiscoveryGroup = "apidiscovery.k8s.io"
+	aggregatedDiscoveryKind  = "APIGroupDiscoveryList"
+
+	// legacyDiscoveryAccept is the Accept header of the documents aggregated discovery is
+	// built from.
+	legacyDiscoveryAccept = "application/json"
+)
+
+// aggregatedDiscoveryVersions are the served versions of aggregated discovery, which
+// share the same schema.
+var aggregatedDiscoveryVersions = map[string]bool{"v2": true, "v2beta1": true}
+
+// APIGroupDiscoveryList is the aggregated discovery of /api or /apis.
+type APIGroupDiscoveryList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []APIGroupDiscovery `json:"items"`
+}
+
+// APIGroupDiscovery are the versions of a group, by decreasing preference.
+type APIGroupDiscovery struct {
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Versions          []APIVersionDiscovery `json:"versions,omitempty"`
+}
+
+// APIVersionDiscovery are the resources of a group version.
+type APIVersionDiscovery struct {
+	Version   string                 `json:"version"`
+	Resources []APIResourceDiscovery `json:"resources,omitempty"`
+	// Freshness is Stale if the resources of the group version could not be discovered.
+	Freshness string `json:"freshness,omitempty"`
+}
+
+// APIResourceDiscovery is a resource of a group version, with its subresources.
+type APIResourceDiscovery struct {
+	Resource         string                    `json:"resource"`
+	ResponseKind     *metav1.GroupVersionKind  `json:"responseKind,omitempty"`
+	Scope            string                    `json:"scope"`
+	SingularResource string                    `json:"singularResource,omitempty"`
+	Verbs            []string                  `json:"verbs"`
+	ShortNames       []string                  `json:"shortNames,omitempty"`
+	Categories       []string                  `json:"categories,omitempty"`
+	Subresources     []APISubresourceDiscovery `json:"subresources,omitempty"`
+}
+
+// APISubresourceDiscovery is a subresource of a resource.
+type APISubresourceDiscovery struct {
+	Subresource  string                   `json:"subresource"`
+	ResponseKind *metav1.GroupVersionKind `json:"responseKind,omitempty"`
+	Verbs        []string                 `json:"verbs"`
+}
+
+// aggregatedDiscoveryVersion returns the version of aggregated discovery asked for by the
+// given Accept header, if the client prefers it over the legacy discovery.
+func aggregatedDiscoveryVersion(accept string) (string, bool) {
+	for _, clause := range strings.Split(accept, ",") {
+		params := strings.Split(clause, ";")
+		if mediaType := strings.TrimSpace(params[0]); mediaType != "application/json" {
+			if mediaType == "" {
+				continue
+			}
+			return "", false
+		}
+		var g, v, as string
+		for _, param := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			switch kv[0] {
+			case "g":
+				g = kv[1]
+			case "v":
+				v = kv[1]
+			case "as":
+				as = kv[1]
+			}
+		}
+		if g == aggregatedDiscoveryGroup && as == aggregatedDiscoveryKind && aggregatedDiscoveryVersions[v] {
+			return v, true
+		}
+		if g == "" && as == "" {
+			// the client prefers the legacy discovery
+			return "", false
+		}
+	}
+	return "", false
+}
+
+// serveAggregated serves the aggregated discovery of /api or /apis in the given version,
+// built from the cached legacy discovery documents.
+func (c *Cache) serveAggregated(w http.ResponseWriter, req *http.Request, apiHandler http.Handler, clusterName, path, version string) {
+	key := documentKey{path: path, accept: aggregatedDiscoveryGroup + "/" + version}
+	doc, failed := c.cached(clusterName, key, func() (*document, *inMemoryResponseWriter) {
+		var groups []metav1.APIGroup
+		if path == "/api" {
+			versions := &metav1.APIVersions{}
+			if failed := c.decode(apiHandler, req, clusterName, path, versions); failed != nil {
+				return nil, failed
+			}
+			group := metav1.APIGroup{}
+			for _, v := range versions.Versions {
+				group.Versions = append(group.Versions, metav1.GroupVersionForDiscovery{GroupVersion: v, Version: v})
+			}
+			groups = append(groups, group)
+		} else {
+			groupList := &metav1.APIGroupList{}
+			if failed := c.decode(apiHandler, req, clusterName, path, groupList); failed != nil {
+				return nil, failed
+			}
+			groups = groupList.Groups
+		}
+
+		list := &APIGroupDiscoveryList{
+			TypeMeta: metav1.TypeMeta{APIVersion: aggregatedDiscoveryGroup + "/" + version, Kind: aggregatedDiscoveryKind},
+			Items:    []APIGroupDiscovery{},
+		}
+		for _, group := range groups {
+			list.Items = append(list.Items, c.aggregateGroup(apiHandler, req, clusterName, path, group))
+		}
+		data, err := json.Marshal(list)
+		if err != nil {
+			failed := newInMemoryResponseWriter()
+			http.Error(failed, err.Error(), http.StatusInternalServerError)
+			return nil, failed
+		}
+		return &document{
+			contentType: fmt.Sprintf("application/json;g=%s;v=%s;as=%s", aggregatedDiscoveryGroup, version, aggregatedDiscoveryKind),
+			data:        data,
+		}, nil
+	})
+	if failed != nil {
+		failed.writeTo(w)
+		return
+	}
+	doc.writeTo(w)
+}
+
+// aggregateGroup returns the aggregated discovery of the given group, with the preferred
+// version first. Versions whose resources cannot be discovered are stale.
+func (c *Cache) aggregateGroup(apiHandler http.Handler, req *http.Request, clusterName, path string, group metav1.APIGroup) APIGroupDiscovery {
+	versions := group.Versions
+	if preferred := group.PreferredVersion.Version; preferred != "" {
+		sort.SliceStable(versions, func(i, j int) bool {
+			return versions[i].Version == preferred && versions[j].Version != preferred
+		})
+	}
+
+	ret := APIGroupDiscovery{ObjectMeta: metav1.ObjectMeta{Name: group.Name}}
+	for _, v := range versions {
+		resourceList := &metav1.APIResourceList{}
+		if failed := c.decode(apiHandler, req, clusterName, path+"/"+v.GroupVersion, resourceList); failed != nil {
+			ret.Versions = append(ret.Versions, APIVersionDiscovery{Version: v.Version, Freshness: "Stale"})
+			continue
+		}
+		ret.Versions = append(ret.Versions, APIVersionDiscovery{
+			Version:   v.Version,
+			Resources: aggregateResources(group.Name, v.Version, resourceList.APIResources),
+			Freshness: "Current",
+		})
+	}
+	return ret
+}
+
+// aggregateResources returns the resources of the given legacy discovery, sorted by name,
+// with their subresources.
+func aggregateResources(group, version string, resources []metav1.APIResource) []APIResourceDiscovery {
+	responseKind := func(r metav1.APIResource) *metav1.GroupVersionKind {
+		gvk := &metav1.GroupVersionKind{Group: group, Version: version, Kind: r.Kind}
+		if r.Group != "" {
+			gvk.Group = r.Group
+		}
+		if r.Version != "" {
+			gvk.Version = r.Version
+		}
+		return gvk
+	}
+
+	var ret []APIResourceDiscovery
+	byName := map[string]int{}
+	for _, r := range resources {
+		if strings.Contains(r.Name, "/") {
+			continue
+		}
+		scope := "Cluster"
+		if r.Namespaced {
+			scope = "Namespaced"
+		}
+		byName[r.Name] = len(ret)
+		ret = append(ret, APIResourceDiscovery{
+			Resource:         r.Name,
+			ResponseKind:     responseKind(r),
+			Scope:            scope,
+			SingularResource: r.SingularName,
+			Verbs:            r.Verbs,
+			ShortNames:       r.ShortNames,
+			Categories:       r.Categories,
+		})
+	}
+	for _, r := range resources {
+		parts := strings.SplitN(r.Name, "/", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if i, found := byName[parts[0]]; found {
+			ret[i].Subresources = append(ret[i].Subresources, APISubresourceDiscovery{
+				Subresource:  parts[1],
+				ResponseKind: responseKind(r),
+				Verbs:        r.Verbs,
+			})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Resource < ret[j].Resource
+	})
+	return ret
+}
+
+// decode decodes into the given object the cached legacy discovery document at the given
+// path. If it is not served, the failed response is returned.
+func (c *Cache) decode(apiHandler http.Handler, req *http.Request, clusterName, path string, into interface{}) *inMemoryResponseWriter {
+	doc, failed := c.get(apiHandler, req, clusterName, path, legacyDiscoveryAccept)
+	if failed != nil {
+		return failed
+	}
+	if err := json.Unmarshal(doc.data, into); err != nil {
+		failed := newInMemoryResponseWriter()
+		http.Error(failed, fmt.Sprintf("failed to decode discovery of %s: %v", path, err), http.StatusInternalServerError)
+		return failed
+	}
+	return nil
+}
@@ -0,0 +1,374 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discoverycache
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsinformers "k8s.io/apiextensions-apiserver/pkg/client/informers/externalversions/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	utilcache "k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/tools/cache"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	tenancyhelper "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+	apisinformer "github.com/kcp-dev/kcp/pkg/client/informers/externalversions/apis/v1alpha1"
+	tenancyinformer "github.com/kcp-dev/kcp/pkg/client/informers/externalversions/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/reconciler/boundcrds"
+)
+
+const byInheritFrom = "discovery-cache-by-inherit-from"
+
+var requestInfoFactory = &request.RequestInfoFactory{
+	APIPrefixes:          sets.NewString("api", "apis"),
+	GrouplessAPIPrefixes: sets.NewString("api"),
+}
+
+// Cache caches the discovery documents of workspaces, i.e. /api, /api/<version>, /apis,
+// /apis/<group> and /apis/<group>/<version>, per logical cluster and Accept header.
+//
+// The documents of a workspace are built on its first discovery request, and evicted when
+// the APIs it serves change: one of its CRDs, the CRDs of the workspace it inherits from,
+// one of its APIBindings, or the shadow CRDs of bound APIs. Workspaces without discovery
+// requests for the idle timeout, or least recently used beyond the maximum number of
+// cached workspaces, are evicted too.
+type Cache struct {
+	workspaceIndexer cache.Indexer
+	idleTimeout      time.Duration
+
+	lock sync.Mutex
+	// workspaces are the *workspace of logical clusters, by logical cluster name.
+	workspaces *utilcache.LRUExpireCache
+}
+
+// workspace are the cached discovery documents of a logical cluster, by documentKey.
+type workspace struct {
+	documents map[documentKey]*document
+}
+
+type documentKey struct {
+	path   string
+	accept string
+}
+
+// document is a cached discovery response.
+type document struct {
+	contentType string
+	data        []byte
+}
+
+// NewCache returns a Cache caching the discovery of at most maxWorkspaces workspaces,
+// each for idleTimeout after its last discovery request, invalidated by the events of the
+// given informers.
+func NewCache(
+	crdInformer apiextensionsinformers.CustomResourceDefinitionInformer,
+	workspaceInformer tenancyinformer.ClusterWorkspaceInformer,
+	apiBindingInformer apisinformer.APIBindingInformer,
+	maxWorkspaces int,
+	idleTimeout time.Duration,
+) (*Cache, error) {
+	if _, found := workspaceInformer.Informer().GetIndexer().GetIndexers()[byInheritFrom]; !found {
+		if err := workspaceInformer.Informer().AddIndexers(cache.Indexers{
+			byInheritFrom: indexByInheritFrom,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	c := newCache(workspaceInformer.Informer().GetIndexer(), utilcache.NewLRUExpireCache(maxWorkspaces), idleTimeout)
+
+	crdInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.invalidateCRD(obj) },
+		UpdateFunc: func(_, obj interface{}) { c.invalidateCRD(obj) },
+		DeleteFunc: func(obj interface{}) { c.invalidateCRD(obj) },
+	})
+	workspaceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.invalidateWorkspace(obj) },
+		UpdateFunc: func(_, obj interface{}) { c.invalidateWorkspace(obj) },
+		DeleteFunc: func(obj interface{}) { c.invalidateWorkspace(obj) },
+	})
+	apiBindingInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.invalidateObject(obj) },
+		UpdateFunc: func(_, obj interface{}) { c.invalidateObject(obj) },
+		DeleteFunc: func(obj interface{}) { c.invalidateObject(obj) },
+	})
+
+	return c, nil
+}
+
+func newCache(workspaceIndexer cache.Indexer, workspaces *utilcache.LRUExpireCache, idleTimeout time.Duration) *Cache {
+	return &Cache{
+		workspaceIndexer: workspaceIndexer,
+		idleTimeout:      idleTimeout,
+		workspaces:       workspaces,
+	}
+}
+
+// indexByInheritFrom indexes ClusterWorkspaces by the logical cluster they inherit the
+// CRDs of, resolved like the CRD lister of the server does.
+func indexByInheritFrom(obj interface{}) ([]string, error) {
+	ws, ok := obj.(*tenancyv1alpha1.ClusterWorkspace)
+	if !ok {
+		return []string{}, fmt.Errorf("obj is supposed to be a ClusterWorkspace, but is %T", obj)
+	}
+	inheritFrom := ws.Spec.InheritFrom
+	if inheritFrom == "" {
+		return []string{}, nil
+	}
+	if inheritFrom == tenancyhelper.RootCluster || strings.ContainsRune(inheritFrom, ':') {
+		return []string{inheritFrom}, nil
+	}
+	// invalid names do not inherit, and must not fail the informer
+	clusterName, err := tenancyhelper.EncodeLogicalClusterName(ws)
+	if err != nil {
+		return []string{}, nil //nolint:nilerr
+	}
+	org, _, err := tenancyhelper.ParseLogicalClusterName(clusterName)
+	if err != nil {
+		return []string{}, nil //nolint:nilerr
+	}
+	return []string{tenancyhelper.EncodeOrganizationAndWorkspace(org, inheritFrom)}, nil
+}
+
+// WithDiscoveryCache serves the discovery requests of the logical cluster of the request
+// from the cache, filling it with the responses of apiHandler. Aggregated discovery is
+// built from the cached documents of the group versions. Any other request is passed to
+// apiHandler.
+func (c *Cache) WithDiscoveryCache(apiHandler http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		cluster := request.ClusterFrom(req.Context())
+		if cluster == nil || cluster.Wildcard || req.Method != http.MethodGet || req.URL.RawQuery != "" || !isDiscoveryPath(req.URL.Path) {
+			apiHandler.ServeHTTP(w, req)
+			return
+		}
+
+		path := strings.TrimSuffix(req.URL.Path, "/")
+		if version, ok := aggregatedDiscoveryVersion(req.Header.Get("Accept")); ok && (path == "/api" || path == "/apis") {
+			c.serveAggregated(w, req, apiHandler, cluster.Name, path, version)
+			return
+		}
+
+		doc, failed := c.get(apiHandler, req, cluster.Name, path, req.Header.Get("Accept"))
+		if failed != nil {
+			failed.writeTo(w)
+			return
+		}
+		doc.writeTo(w)
+	}
+}
+
+// get returns the cached discovery document at the given path for the given Accept
+// header, filling the cache with the response of apiHandler. If apiHandler does not
+// succeed, its response is returned instead, and not cached.
+func (c *Cache) get(apiHandler http.Handler, req *http.Request, clusterName, path, accept string) (*document, *inMemoryResponseWriter) {
+	return c.cached(clusterName, documentKey{path: path, accept: accept}, func() (*document, *inMemoryResponseWriter) {
+		discoveryReq := req.Clone(req.Context())
+		discoveryReq.URL.Path = path
+		discoveryReq.Header.Set("Accept", accept)
+		// the handlers of the server chain find the path in the request info
+		if path != req.URL.Path {
+			requestInfo, err := requestInfoFactory.NewRequestInfo(discoveryReq)
+			if err != nil {
+				failed := newInMemoryResponseWriter()
+				http.Error(failed, err.Error(), http.StatusInternalServerError)
+				return nil, failed
+			}
+			discoveryReq = discoveryReq.WithContext(request.WithRequestInfo(discoveryReq.Context(), requestInfo))
+		}
+		writer := newInMemoryResponseWriter()
+		apiHandler.ServeHTTP(writer, discoveryReq)
+		if writer.respCode != http.StatusOK {
+			return nil, writer
+		}
+		return &document{contentType: writer.header.Get("Content-Type"), data: writer.data}, nil
+	})
+}
+
+// cached returns the cached document of the given logical cluster with the given key,
+// filling the cache with the document returned by build, unless it fails.
+func (c *Cache) cached(clusterName string, key documentKey, build func() (*document, *inMemoryResponseWriter)) (*document, *inMemoryResponseWriter) {
+	c.lock.Lock()
+	ws := &workspace{documents: map[documentKey]*document{}}
+	if cached, found := c.workspaces.Get(clusterName); found {
+		ws = cached.(*workspace)
+	}
+	// Touch the workspace to postpone its idle eviction.
+	c.workspaces.Add(clusterName, ws, c.idleTimeout)
+	doc, found := ws.documents[key]
+	c.lock.Unlock()
+	if found {
+		return doc, nil
+	}
+
+	doc, failed := build()
+	if failed != nil {
+		return nil, failed
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	// Only cache the document if the workspace was not invalidated in the meantime.
+	if cached, found := c.workspaces.Get(clusterName); found && cached.(*workspace) == ws {
+		ws.documents[key] = doc
+	}
+	return doc, nil
+}
+
+// Invalidate evicts the cached discovery of the given logical cluster.
+func (c *Cache) Invalidate(clusterName string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.workspaces.Remove(clusterName)
+}
+
+// InvalidateAll evicts the cached discovery of all logical clusters.
+func (c *Cache) InvalidateAll() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, clusterName := range c.workspaces.Keys() {
+		c.workspaces.Remove(clusterName)
+	}
+}
+
+// invalidateCRD evicts the workspace of the given CRD, and the workspaces inheriting from
+// it. Shadow CRDs of bound APIs evict all workspaces, as any of them may bind them.
+func (c *Cache) invalidateCRD(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	crd, ok := obj.(*apiextensionsv1.CustomResourceDefinition)
+	if !ok {
+		runtime.HandleError(fmt.Errorf("obj is supposed to be a CustomResourceDefinition, but is %T", obj))
+		return
+	}
+	if strings.HasPrefix(crd.ClusterName, boundcrds.ShadowClusterPrefix) {
+		c.InvalidateAll()
+		return
+	}
+
+	c.Invalidate(crd.ClusterName)
+	inheriting, err := c.workspaceIndexer.ByIndex(byInheritFrom, crd.ClusterName)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	for _, obj := range inheriting {
+		if clusterName, err := tenancyhelper.EncodeLogicalClusterName(obj.(*tenancyv1alpha1.ClusterWorkspace)); err == nil {
+			c.Invalidate(clusterName)
+		}
+	}
+}
+
+// invalidateWorkspace evicts the logical cluster of the given ClusterWorkspace, whose
+// inheritance may have changed.
+func (c *Cache) invalidateWorkspace(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	ws, ok := obj.(*tenancyv1alpha1.ClusterWorkspace)
+	if !ok {
+		runtime.HandleError(fmt.Errorf("obj is supposed to be a ClusterWorkspace, but is %T", obj))
+		return
+	}
+	clusterName, err := tenancyhelper.EncodeLogicalClusterName(ws)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	c.Invalidate(clusterName)
+}
+
+// invalidateObject evicts the logical cluster of the given object, e.g. an APIBinding.
+func (c *Cache) invalidateObject(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	c.Invalidate(m.GetClusterName())
+}
+
+// isDiscoveryPath returns true for /api, /api/<version>, /apis, /apis/<group> and
+// /apis/<group>/<version>.
+func isDiscoveryPath(path string) bool {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	switch segments[0] {
+	case "api":
+		return len(segments) <= 2
+	case "apis":
+		return len(segments) <= 3
+	default:
+		return false
+	}
+}
+
+func (d *document) writeTo(w http.ResponseWriter) {
+	if d.contentType != "" {
+		w.Header().Set("Content-Type", d.contentType)
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(d.data) //nolint:errcheck
+}
+
+// inMemoryResponseWriter is a http.ResponseWriter keeping the response in memory.
+type inMemoryResponseWriter struct {
+	header   http.Header
+	respCode int
+	data     []byte
+}
+
+func newInMemoryResponseWriter() *inMemoryResponseWriter {
+	return &inMemoryResponseWriter{header: http.Header{}}
+}
+
+func (r *inMemoryResponseWriter) Header() http.Header {
+	return r.header
+}
+
+func (r *inMemoryResponseWriter) WriteHeader(code int) {
+	if r.respCode == 0 {
+		r.respCode = code
+	}
+}
+
+func (r *inMemoryResponseWriter) Write(in []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	r.data = append(r.data, in...)
+	return len(in), nil
+}
+
+// writeTo writes the kept response to the given writer.
+func (r *inMemoryResponseWriter) writeTo(w http.ResponseWriter) {
+	for key, values := range r.header {
+		w.Header()[key] = values
+	}
+	if r.respCode != 0 {
+		w.WriteHeader(r.respCode)
+	}
+	w.Write(r.data) //nolint:errcheck
+}
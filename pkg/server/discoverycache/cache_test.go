@@ -0,0 +1,246 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discoverycache
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilcache "k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/tools/cache"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/reconciler/boundcrds"
+)
+
+const aggregatedAccept = "application/json;g=apidiscovery.k8s.io;v=v2beta1;as=APIGroupDiscoveryList,application/json"
+
+func newTestCache(t *testing.T) (*Cache, map[string]int) {
+	workspaceIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{byInheritFrom: indexByInheritFrom})
+	require.NoError(t, workspaceIndexer.Add(&tenancyv1alpha1.ClusterWorkspace{
+		ObjectMeta: metav1.ObjectMeta{ClusterName: "root:org", Name: "inheriting"},
+		Spec:       tenancyv1alpha1.ClusterWorkspaceSpec{InheritFrom: "parent"},
+	}))
+	return newCache(workspaceIndexer, utilcache.NewLRUExpireCache(10), time.Minute), map[string]int{}
+}
+
+// discoveryHandler serves a workspace with the widgets of today.dev/v1, counting the
+// requests by logical cluster and path.
+func discoveryHandler(t *testing.T, served map[string]int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		served[request.ClusterFrom(req.Context()).Name+req.URL.Path]++
+		requestInfo, ok := request.RequestInfoFrom(req.Context())
+		require.True(t, ok)
+		require.Equal(t, req.URL.Path, requestInfo.Path)
+
+		var obj interface{}
+		switch req.URL.Path {
+		case "/apis":
+			obj = metav1.APIGroupList{Groups: []metav1.APIGroup{{
+				Name:             "today.dev",
+				Versions:         []metav1.GroupVersionForDiscovery{{GroupVersion: "today.dev/v1", Version: "v1"}},
+				PreferredVersion: metav1.GroupVersionForDiscovery{GroupVersion: "today.dev/v1", Version: "v1"},
+			}}}
+		case "/apis/today.dev/v1":
+			obj = metav1.APIResourceList{GroupVersion: "today.dev/v1", APIResources: []metav1.APIResource{
+				{Name: "widgets", SingularName: "widget", Namespaced: true, Kind: "Widget", Verbs: []string{"get", "list"}},
+				{Name: "widgets/status", Namespaced: true, Kind: "Widget", Verbs: []string{"get", "update"}},
+			}}
+		default:
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(obj))
+	})
+}
+
+func serve(c *Cache, handler http.Handler, clusterName, path, accept string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Accept", accept)
+	ctx := request.WithCluster(req.Context(), request.Cluster{Name: clusterName})
+	ctx = request.WithRequestInfo(ctx, &request.RequestInfo{Path: path})
+	w := httptest.NewRecorder()
+	c.WithDiscoveryCache(handler).ServeHTTP(w, req.WithContext(ctx))
+	return w
+}
+
+func TestWithDiscoveryCache(t *testing.T) {
+	c, served := newTestCache(t)
+	handler := discoveryHandler(t, served)
+
+	for i := 0; i < 3; i++ {
+		w := serve(c, handler, "org:ws", "/apis", "application/json")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		require.Contains(t, w.Body.String(), "today.dev")
+	}
+	require.Equal(t, 1, served["org:ws/apis"])
+
+	serve(c, handler, "org:other", "/apis", "application/json")
+	require.Equal(t, 1, served["org:other/apis"], "workspaces are cached separately")
+
+	serve(c, handler, "org:ws", "/apis", "application/yaml")
+	require.Equal(t, 2, served["org:ws/apis"], "Accept headers are cached separately")
+
+	require.Equal(t, http.StatusNotFound, serve(c, handler, "org:ws", "/apis/other.dev", "application/json").Code)
+	require.Equal(t, http.StatusNotFound, serve(c, handler, "org:ws", "/apis/other.dev", "application/json").Code)
+	require.Equal(t, 2, served["org:ws/apis/other.dev"], "failures are not cached")
+
+	serve(c, handler, "org:ws", "/apis/today.dev/v1/widgets", "application/json")
+	serve(c, handler, "org:ws", "/apis/today.dev/v1/widgets", "application/json")
+	require.Equal(t, 2, served["org:ws/apis/today.dev/v1/widgets"], "resource requests are not cached")
+}
+
+func TestInvalidation(t *testing.T) {
+	crd := func(clusterName string) *apiextensionsv1.CustomResourceDefinition {
+		return &apiextensionsv1.CustomResourceDefinition{ObjectMeta: metav1.ObjectMeta{ClusterName: clusterName, Name: "widgets.today.dev"}}
+	}
+
+	for _, tt := range []struct {
+		name            string
+		invalidate      func(c *Cache)
+		wantInvalidated []string
+	}{
+		{
+			name:            "CRD of a workspace",
+			invalidate:      func(c *Cache) { c.invalidateCRD(crd("root:ws")) },
+			wantInvalidated: []string{"root:ws"},
+		},
+		{
+			name:            "deleted CRD of a workspace",
+			invalidate:      func(c *Cache) { c.invalidateCRD(cache.DeletedFinalStateUnknown{Obj: crd("root:ws")}) },
+			wantInvalidated: []string{"root:ws"},
+		},
+		{
+			name:            "CRD of an inherited workspace",
+			invalidate:      func(c *Cache) { c.invalidateCRD(crd("org:parent")) },
+			wantInvalidated: []string{"org:parent", "org:inheriting"},
+		},
+		{
+			name:            "shadow CRD of bound APIs",
+			invalidate:      func(c *Cache) { c.invalidateCRD(crd(boundcrds.ShadowClusterName("hash"))) },
+			wantInvalidated: []string{"root:ws", "org:parent", "org:inheriting"},
+		},
+		{
+			name: "APIBinding",
+			invalidate: func(c *Cache) {
+				c.invalidateObject(&apisv1alpha1.APIBinding{ObjectMeta: metav1.ObjectMeta{ClusterName: "root:ws", Name: "widgets"}})
+			},
+			wantInvalidated: []string{"root:ws"},
+		},
+		{
+			name: "ClusterWorkspace",
+			invalidate: func(c *Cache) {
+				c.invalidateWorkspace(&tenancyv1alpha1.ClusterWorkspace{ObjectMeta: metav1.ObjectMeta{ClusterName: "root:org", Name: "inheriting"}})
+			},
+			wantInvalidated: []string{"org:inheriting"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c, served := newTestCache(t)
+			handler := discoveryHandler(t, served)
+			clusterNames := []string{"root:ws", "org:parent", "org:inheriting"}
+			for _, clusterName := range clusterNames {
+				serve(c, handler, clusterName, "/apis", "application/json")
+			}
+
+			tt.invalidate(c)
+
+			for _, clusterName := range clusterNames {
+				serve(c, handler, clusterName, "/apis", "application/json")
+			}
+			for _, clusterName := range clusterNames {
+				want := 1
+				for _, invalidated := range tt.wantInvalidated {
+					if invalidated == clusterName {
+						want = 2
+					}
+				}
+				require.Equal(t, want, served[clusterName+"/apis"], "requests of %s", clusterName)
+			}
+		})
+	}
+}
+
+func TestAggregatedDiscovery(t *testing.T) {
+	c, served := newTestCache(t)
+	handler := discoveryHandler(t, served)
+
+	w := serve(c, handler, "org:ws", "/apis", aggregatedAccept)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "application/json;g=apidiscovery.k8s.io;v=v2beta1;as=APIGroupDiscoveryList", w.Header().Get("Content-Type"))
+
+	list := &APIGroupDiscoveryList{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), list))
+	require.Equal(t, "apidiscovery.k8s.io/v2beta1", list.APIVersion)
+	require.Equal(t, []APIGroupDiscovery{{
+		ObjectMeta: metav1.ObjectMeta{Name: "today.dev"},
+		Versions: []APIVersionDiscovery{{
+			Version: "v1",
+			Resources: []APIResourceDiscovery{{
+				Resource:         "widgets",
+				ResponseKind:     &metav1.GroupVersionKind{Group: "today.dev", Version: "v1", Kind: "Widget"},
+				Scope:            "Namespaced",
+				SingularResource: "widget",
+				Verbs:            []string{"get", "list"},
+				Subresources: []APISubresourceDiscovery{{
+					Subresource:  "status",
+					ResponseKind: &metav1.GroupVersionKind{Group: "today.dev", Version: "v1", Kind: "Widget"},
+					Verbs:        []string{"get", "update"},
+				}},
+			}},
+			Freshness: "Current",
+		}},
+	}}, list.Items)
+
+	serve(c, handler, "org:ws", "/apis", aggregatedAccept)
+	serve(c, handler, "org:ws", "/apis", "application/json")
+	require.Equal(t, 1, served["org:ws/apis"], "aggregated discovery is built from the cached documents")
+	require.Equal(t, 1, served["org:ws/apis/today.dev/v1"])
+}
+
+func TestAggregatedDiscoveryVersion(t *testing.T) {
+	for _, tt := range []struct {
+		accept      string
+		wantVersion string
+		wantOK      bool
+	}{
+		{accept: "application/json"},
+		{accept: "application/json, */*"},
+		{accept: "application/json;g=apidiscovery.k8s.io;v=v2beta1;as=APIGroupDiscoveryList", wantVersion: "v2beta1", wantOK: true},
+		{accept: "application/json;g=apidiscovery.k8s.io;v=v2;as=APIGroupDiscoveryList,application/json;g=apidiscovery.k8s.io;v=v2beta1;as=APIGroupDiscoveryList,application/json", wantVersion: "v2", wantOK: true},
+		{accept: "application/json;g=apidiscovery.k8s.io;v=v3;as=APIGroupDiscoveryList,application/json;g=apidiscovery.k8s.io;v=v2beta1;as=APIGroupDiscoveryList", wantVersion: "v2beta1", wantOK: true},
+		{accept: "application/json,application/json;g=apidiscovery.k8s.io;v=v2;as=APIGroupDiscoveryList"},
+		{accept: "application/vnd.kubernetes.protobuf,application/json;g=apidiscovery.k8s.io;v=v2;as=APIGroupDiscoveryList"},
+	} {
+		t.Run(tt.accept, func(t *testing.T) {
+			version, ok := aggregatedDiscoveryVersion(tt.accept)
+			require.Equal(t, tt.wantOK, ok)
+			require.Equal(t, tt.wantVersion, version)
+		})
+	}
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package encryption encrypts the data of workspace subtrees at rest with their own
+// encryption provider configuration, e.g. with a distinct KMS key per organization for
+// tenants bringing their own key.
+//
+// An encryption provider configuration, in the format of --encryption-provider-config,
+// applies to the workspaces of a logical cluster and of its descendants, the one of the
+// closest ancestor taking precedence. The resources it does not list, and the other
+// workspaces, are encrypted according to --encryption-provider-config. Data written before
+// a workspace got its own configuration stays readable and is rewritten with it on the
+// next write of every object, such that rewriting all objects migrates the storage.
+package encryption
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/registry/generic"
+	"k8s.io/apiserver/pkg/server/healthz"
+	"k8s.io/apiserver/pkg/server/options/encryptionconfig"
+	"k8s.io/apiserver/pkg/storage/value"
+
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+)
+
+// Config holds the transformers of the logical clusters with their own encryption
+// provider configuration.
+type Config struct {
+	// transformers are the transformers per logical cluster and resource.
+	transformers map[string]map[schema.GroupResource]value.Transformer
+	healthChecks []healthz.HealthChecker
+}
+
+// ParseProviderConfigs parses settings in the format <logical cluster>=<file>, keyed by
+// logical cluster. The root logical cluster is configured by --encryption-provider-config.
+func ParseProviderConfigs(settings []string) (map[string]string, error) {
+	ret := map[string]string{}
+	for _, setting := range settings {
+		tokens := strings.SplitN(setting, "=", 2)
+		if len(tokens) != 2 || tokens[0] == "" || tokens[1] == "" {
+			return nil, fmt.Errorf("invalid workspace encryption provider config, expected <logical cluster>=<file>: %s", setting)
+		}
+		if _, _, err := helper.ParseLogicalClusterName(tokens[0]); err != nil {
+			return nil, fmt.Errorf("invalid workspace encryption provider config %s: %w", setting, err)
+		}
+		if tokens[0] == helper.RootCluster || strings.HasPrefix(tokens[0], helper.LocalSystemClusterPrefix) {
+			return nil, fmt.Errorf("invalid workspace encryption provider config %s: use --encryption-provider-config for %s", setting, tokens[0])
+		}
+		if _, found := ret[tokens[0]]; found {
+			return nil, fmt.Errorf("duplicate workspace encryption provider config for %s", tokens[0])
+		}
+		ret[tokens[0]] = tokens[1]
+	}
+	return ret, nil
+}
+
+// NewConfig loads the encryption provider configurations of the given settings in the
+// format <logical cluster>=<file>.
+func NewConfig(settings []string) (*Config, error) {
+	files, err := ParseProviderConfigs(settings)
+	if err != nil {
+		return nil, err
+	}
+	clusterNames := make([]string, 0, len(files))
+	for clusterName := range files {
+		clusterNames = append(clusterNames, clusterName)
+	}
+	sort.Strings(clusterNames)
+
+	c := &Config{transformers: map[string]map[schema.GroupResource]value.Transformer{}}
+	for _, clusterName := range clusterNames {
+		transformers, err := encryptionconfig.GetTransformerOverrides(files[clusterName])
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption provider config of workspace %s: %w", clusterName, err)
+		}
+		c.transformers[clusterName] = transformers
+
+		checks, err := encryptionconfig.GetKMSPluginHealthzCheckers(files[clusterName])
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption provider config of workspace %s: %w", clusterName, err)
+		}
+		for _, check := range checks {
+			// the checks of every file are named kms-provider-<index>
+			c.healthChecks = append(c.healthChecks, healthz.NamedCheck(fmt.Sprintf("%s-%s", check.Name(), clusterName), func(check healthz.HealthChecker) func(*http.Request) error {
+				return check.Check
+			}(check)))
+		}
+	}
+	return c, nil
+}
+
+// HealthChecks returns the health checks of the KMS plugins of the workspaces.
+func (c *Config) HealthChecks() []healthz.HealthChecker {
+	return c.healthChecks
+}
+
+// RESTOptionsGetter wraps the given RESTOptionsGetter to encrypt the resources listed in
+// the encryption provider configurations of workspaces with them, for the built-in
+// resources and the resources served by CRDs alike.
+func (c *Config) RESTOptionsGetter(delegate generic.RESTOptionsGetter) generic.RESTOptionsGetter {
+	if len(c.transformers) == 0 {
+		return delegate
+	}
+	return &restOptionsGetter{delegate: delegate, config: c}
+}
+
+type restOptionsGetter struct {
+	delegate generic.RESTOptionsGetter
+	config   *Config
+}
+
+func (g *restOptionsGetter) GetRESTOptions(resource schema.GroupResource) (generic.RESTOptions, error) {
+	opts, err := g.delegate.GetRESTOptions(resource)
+	if err != nil || opts.StorageConfig == nil {
+		return opts, err
+	}
+	transformers := map[string]value.Transformer{}
+	for clusterName, byResource := range g.config.transformers {
+		if transformer, found := byResource[resource]; found {
+			transformers[clusterName] = transformer
+		}
+	}
+	if len(transformers) == 0 {
+		return opts, nil
+	}
+
+	storageConfig := *opts.StorageConfig
+	storageConfig.Transformer = newClusterTransformer(storageConfig.Transformer, transformers)
+	opts.StorageConfig = &storageConfig
+	return opts, nil
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package encryption
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/registry/generic"
+	"k8s.io/apiserver/pkg/storage/storagebackend"
+	"k8s.io/apiserver/pkg/storage/value"
+)
+
+func writeProviderConfig(t *testing.T, keyName, secret string) string {
+	path := filepath.Join(t.TempDir(), keyName+".yaml")
+	require.NoError(t, os.WriteFile(path, []byte(fmt.Sprintf(`
+apiVersion: apiserver.config.k8s.io/v1
+kind: EncryptionConfiguration
+resources:
+- resources: ["secrets"]
+  providers:
+  - aescbc:
+      keys:
+      - name: %s
+        secret: %s
+`, keyName, base64.StdEncoding.EncodeToString([]byte(secret)))), 0600))
+	return path
+}
+
+type fakeRESTOptionsGetter struct {
+	transformer value.Transformer
+}
+
+func (g *fakeRESTOptionsGetter) GetRESTOptions(resource schema.GroupResource) (generic.RESTOptions, error) {
+	return generic.RESTOptions{StorageConfig: &storagebackend.ConfigForResource{Config: storagebackend.Config{Transformer: g.transformer}}}, nil
+}
+
+func TestParseProviderConfigs(t *testing.T) {
+	files, err := ParseProviderConfigs([]string{"root:acme=/etc/acme.yaml", "acme:team=/etc/team.yaml"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"root:acme": "/etc/acme.yaml", "acme:team": "/etc/team.yaml"}, files)
+
+	for _, invalid := range []string{"root:acme", "=/etc/acme.yaml", "root:acme=", "a:b:c=/etc/x.yaml", "root=/etc/root.yaml", "system:admin=/etc/admin.yaml"} {
+		_, err := ParseProviderConfigs([]string{invalid})
+		require.Error(t, err, invalid)
+	}
+	_, err = ParseProviderConfigs([]string{"root:acme=/etc/a.yaml", "root:acme=/etc/b.yaml"})
+	require.Error(t, err)
+}
+
+func TestTransformer(t *testing.T) {
+	config, err := NewConfig([]string{
+		"root:acme=" + writeProviderConfig(t, "acme", strings.Repeat("a", 32)),
+		"acme:team=" + writeProviderConfig(t, "team", strings.Repeat("t", 32)),
+	})
+	require.NoError(t, err)
+
+	getter := config.RESTOptionsGetter(&fakeRESTOptionsGetter{})
+	opts, err := getter.GetRESTOptions(schema.GroupResource{Resource: "configmaps"})
+	require.NoError(t, err)
+	require.Nil(t, opts.StorageConfig.Transformer, "resources without workspace encryption keep their transformer")
+
+	opts, err = getter.GetRESTOptions(schema.GroupResource{Resource: "secrets"})
+	require.NoError(t, err)
+	transformer := opts.StorageConfig.Transformer
+
+	tests := []struct {
+		key        string
+		wantPrefix string
+	}{
+		{key: "/registry/secrets/root:acme/default/foo", wantPrefix: "k8s:enc:aescbc:v1:acme:"},
+		{key: "/registry/secrets/acme:dev/default/foo", wantPrefix: "k8s:enc:aescbc:v1:acme:"},
+		{key: "/registry/secrets/acme:team/default/foo", wantPrefix: "k8s:enc:aescbc:v1:team:"},
+		{key: "/registry/secrets/root:other/default/foo"},
+		{key: "/registry/secrets/other:team/default/foo"},
+		{key: "/registry/secrets/root/default/foo"},
+		{key: "/registry/secrets/root/default/root:acme"},
+		{key: "/registry/secrets/system:admin/default/foo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			out, err := transformer.TransformToStorage([]byte("data"), value.DefaultContext(tt.key))
+			require.NoError(t, err)
+			if tt.wantPrefix == "" {
+				require.Equal(t, "data", string(out))
+			} else {
+				require.True(t, strings.HasPrefix(string(out), tt.wantPrefix), "got %q", out)
+			}
+
+			data, stale, err := transformer.TransformFromStorage(out, value.DefaultContext(tt.key))
+			require.NoError(t, err)
+			require.False(t, stale)
+			require.Equal(t, "data", string(data))
+		})
+	}
+
+	t.Run("data written before the workspace got its own configuration is stale", func(t *testing.T) {
+		data, stale, err := transformer.TransformFromStorage([]byte("data"), value.DefaultContext("/registry/secrets/root:acme/default/foo"))
+		require.NoError(t, err)
+		require.True(t, stale)
+		require.Equal(t, "data", string(data))
+	})
+
+	t.Run("data encrypted with the key of another workspace is not readable", func(t *testing.T) {
+		out, err := transformer.TransformToStorage([]byte("data"), value.DefaultContext("/registry/secrets/acme:team/default/foo"))
+		require.NoError(t, err)
+		_, _, err = transformer.TransformFromStorage(out, value.DefaultContext("/registry/secrets/root:acme/default/foo"))
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package encryption
+
+import (
+	"bytes"
+	"strings"
+
+	"k8s.io/apiserver/pkg/storage/value"
+
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+)
+
+// encryptedPrefix is the prefix of the data written by the encrypting providers.
+var encryptedPrefix = []byte("k8s:enc:")
+
+// clusterTransformer transforms the data of the logical clusters with their own
+// transformer, or the one of their closest ancestor, and the data of the other logical
+// clusters with the delegate.
+type clusterTransformer struct {
+	delegate     value.Transformer
+	transformers map[string]value.Transformer
+}
+
+var _ value.Transformer = &clusterTransformer{}
+
+func newClusterTransformer(delegate value.Transformer, transformers map[string]value.Transformer) *clusterTransformer {
+	if delegate == nil {
+		delegate = value.IdentityTransformer
+	}
+	return &clusterTransformer{delegate: delegate, transformers: transformers}
+}
+
+// TransformFromStorage reads the data of a logical cluster with its transformer. Data
+// written with the delegate, e.g. before the logical cluster got its own transformer, is
+// read with the delegate and reported stale, such that it is rewritten on the next write.
+func (t *clusterTransformer) TransformFromStorage(data []byte, context value.Context) ([]byte, bool, error) {
+	transformer, ok := t.transformerFor(context)
+	if !ok {
+		return t.delegate.TransformFromStorage(data, context)
+	}
+	out, stale, err := transformer.TransformFromStorage(data, context)
+	if err == nil {
+		return out, stale, nil
+	}
+	if t.delegate == value.IdentityTransformer && bytes.HasPrefix(data, encryptedPrefix) {
+		// encrypted data the identity cannot read
+		return nil, false, err
+	}
+	if out, _, delegateErr := t.delegate.TransformFromStorage(data, context); delegateErr == nil {
+		return out, true, nil
+	}
+	return nil, false, err
+}
+
+func (t *clusterTransformer) TransformToStorage(data []byte, context value.Context) ([]byte, error) {
+	if transformer, ok := t.transformerFor(context); ok {
+		return transformer.TransformToStorage(data, context)
+	}
+	return t.delegate.TransformToStorage(data, context)
+}
+
+// transformerFor returns the transformer of the logical cluster of the etcd key the
+// context authenticates, or of its closest ancestor.
+func (t *clusterTransformer) transformerFor(context value.Context) (value.Transformer, bool) {
+	clusterName, ok := clusterOfKey(string(context.AuthenticatedData()))
+	if !ok {
+		return nil, false
+	}
+	for {
+		if transformer, found := t.transformers[clusterName]; found {
+			return transformer, true
+		}
+		parent, err := helper.ParentClusterName(clusterName)
+		if err != nil || parent == helper.RootCluster {
+			return nil, false
+		}
+		clusterName = parent
+	}
+}
+
+// clusterOfKey returns the logical cluster of an etcd key of the form
+// <prefix>/<resource prefix>/<logical cluster>/[<namespace>/]<name>. The logical cluster
+// is the only segment before the name that can contain a colon. The keys of the root
+// logical cluster, and of the system logical clusters, are not matched.
+func clusterOfKey(key string) (string, bool) {
+	segments := strings.Split(key, "/")
+	for _, segment := range segments[:len(segments)-1] {
+		if strings.Contains(segment, ":") {
+			if strings.HasPrefix(segment, helper.LocalSystemClusterPrefix) {
+				return "", false
+			}
+			return segment, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package exportidentity restricts the wildcard lists and watches of the resources bound
+// through APIBindings to the logical clusters bound to the APIExport whose identity hash
+// the request presents, such that two service providers exporting the same resource cannot
+// read each other's data across logical clusters.
+//
+// Wildcard requests present the identity hash as a suffix of the resource in their path,
+// e.g. /clusters/*/apis/example.io/v1/widgets:<identityHash>.
+package exportidentity
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/authentication/user"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/tools/cache"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+	apishelper "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1/helper"
+	"github.com/kcp-dev/kcp/pkg/authorization/bootstrap"
+	apisinformer "github.com/kcp-dev/kcp/pkg/client/informers/externalversions/apis/v1alpha1"
+)
+
+const (
+	byBoundResource         = "exportidentity-by-bound-resource"
+	byBoundResourceIdentity = "exportidentity-by-bound-resource-identity"
+)
+
+// unrestrictedGroups are the groups of the users listing and watching the bound resources
+// across all logical clusters without presenting an identity hash, i.e. the privileged
+// users and the kcp controllers processing the objects of every resource, like the garbage
+// collector or the replication of the root shard.
+var unrestrictedGroups = sets.NewString(user.SystemPrivilegedGroup, bootstrap.SystemKcpSchedulerGroup, bootstrap.SystemKcpReplicationGroup)
+
+type key int
+
+const identityKey key = iota
+
+// WithIdentity returns a context carrying the given identity hash.
+func WithIdentity(ctx context.Context, identityHash string) context.Context {
+	return context.WithValue(ctx, identityKey, identityHash)
+}
+
+// IdentityFrom returns the identity hash presented by the request, or "" if none.
+func IdentityFrom(ctx context.Context) string {
+	identityHash, _ := ctx.Value(identityKey).(string)
+	return identityHash
+}
+
+// SplitPath returns the given API path without the identity hash suffixing the resource in
+// its last segment, and that identity hash, if any.
+func SplitPath(path string) (string, string) {
+	if !strings.HasPrefix(path, "/api/") && !strings.HasPrefix(path, "/apis/") {
+		return path, ""
+	}
+	slash := strings.LastIndex(path, "/")
+	colon := strings.Index(path[slash:], ":")
+	if colon == -1 {
+		return path, ""
+	}
+	return path[:slash+colon], path[slash+colon+1:]
+}
+
+// Bindings tells which logical clusters bind a resource through an APIBinding presenting
+// a given identity hash.
+type Bindings struct {
+	indexer cache.Indexer
+}
+
+// NewBindings returns Bindings indexing the APIBindings of the given informer.
+func NewBindings(apiBindingInformer apisinformer.APIBindingInformer) (*Bindings, error) {
+	indexers := cache.Indexers{}
+	for name, f := range map[string]cache.IndexFunc{byBoundResource: indexByBoundResource, byBoundResourceIdentity: indexByBoundResourceIdentity} {
+		if _, found := apiBindingInformer.Informer().GetIndexer().GetIndexers()[name]; !found {
+			indexers[name] = f
+		}
+	}
+	if len(indexers) > 0 {
+		if err := apiBindingInformer.Informer().AddIndexers(indexers); err != nil {
+			return nil, err
+		}
+	}
+	return &Bindings{indexer: apiBindingInformer.Informer().GetIndexer()}, nil
+}
+
+// IsBound returns whether the given resource is bound through an APIBinding in any logical
+// cluster.
+func (b *Bindings) IsBound(gr schema.GroupResource) (bool, error) {
+	objs, err := b.indexer.ByIndex(byBoundResource, gr.String())
+	return len(objs) > 0, err
+}
+
+// Binds returns whether the given logical cluster binds the given resource through an
+// APIBinding presenting the given identity hash.
+func (b *Bindings) Binds(clusterName string, gr schema.GroupResource, identityHash string) bool {
+	objs, err := b.indexer.ByIndex(byBoundResourceIdentity, identityIndexKey(clusterName, gr, identityHash))
+	return err == nil && len(objs) > 0
+}
+
+// isUnrestricted returns whether the user of the request lists and watches the bound resources
+// across all logical clusters without presenting an identity hash.
+func isUnrestricted(ctx context.Context) bool {
+	u, ok := genericapirequest.UserFrom(ctx)
+	return ok && unrestrictedGroups.HasAny(u.GetGroups()...)
+}
+
+func indexByBoundResource(obj interface{}) ([]string, error) {
+	binding, ok := obj.(*apisv1alpha1.APIBinding)
+	if !ok {
+		return []string{}, fmt.Errorf("obj is supposed to be an APIBinding, but is %T", obj)
+	}
+	var keys []string
+	for _, resource := range binding.Status.BoundResources {
+		keys = append(keys, schema.GroupResource{Group: resource.Group, Resource: resource.Resource}.String())
+	}
+	return keys, nil
+}
+
+func indexByBoundResourceIdentity(obj interface{}) ([]string, error) {
+	binding, ok := obj.(*apisv1alpha1.APIBinding)
+	if !ok {
+		return []string{}, fmt.Errorf("obj is supposed to be an APIBinding, but is %T", obj)
+	}
+	if binding.Status.BoundAPIExport == nil {
+		return []string{}, nil
+	}
+	identityHash := apishelper.IdentityHash(*binding.Status.BoundAPIExport)
+	if identityHash == "" {
+		return []string{}, nil
+	}
+	var keys []string
+	for _, resource := range binding.Status.BoundResources {
+		keys = append(keys, identityIndexKey(binding.ClusterName, schema.GroupResource{Group: resource.Group, Resource: resource.Resource}, identityHash))
+	}
+	return keys, nil
+}
+
+func identityIndexKey(clusterName string, gr schema.GroupResource, identityHash string) string {
+	return clusterName + "|" + gr.String() + "|" + identityHash
+}
@@ -0,0 +1,43 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exportidentity
+
+import (
+	"testing"
+)
+
+func TestSplitPath(t *testing.T) {
+	for _, tt := range []struct {
+		path         string
+		wantPath     string
+		wantIdentity string
+	}{
+		{path: "/apis/example.io/v1/widgets:abc", wantPath: "/apis/example.io/v1/widgets", wantIdentity: "abc"},
+		{path: "/apis/example.io/v1/namespaces/default/widgets:abc", wantPath: "/apis/example.io/v1/namespaces/default/widgets", wantIdentity: "abc"},
+		{path: "/api/v1/configmaps:abc", wantPath: "/api/v1/configmaps", wantIdentity: "abc"},
+		{path: "/apis/example.io/v1/widgets", wantPath: "/apis/example.io/v1/widgets"},
+		{path: "/openapi/v3/apis/example.io:abc", wantPath: "/openapi/v3/apis/example.io:abc"},
+		{path: "", wantPath: ""},
+	} {
+		t.Run(tt.path, func(t *testing.T) {
+			gotPath, gotIdentity := SplitPath(tt.path)
+			if gotPath != tt.wantPath || gotIdentity != tt.wantIdentity {
+				t.Errorf("SplitPath() = %q, %q, want %q, %q", gotPath, gotIdentity, tt.wantPath, tt.wantIdentity)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exportidentity
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/generic"
+	"k8s.io/apiserver/pkg/storage"
+	"k8s.io/apiserver/pkg/storage/storagebackend"
+	"k8s.io/apiserver/pkg/storage/storagebackend/factory"
+	"k8s.io/client-go/tools/cache"
+)
+
+// boundField is the field set by the restricted predicates to whether the logical cluster of
+// an object binds its resource with the identity hash of the request.
+const boundField = "kcp.dev/identity-bound"
+
+// RESTOptionsGetter wraps the given RESTOptionsGetter to restrict the wildcard lists and
+// watches of the resources bound through APIBindings to the logical clusters binding them
+// with the identity hash of the request.
+func (b *Bindings) RESTOptionsGetter(delegate generic.RESTOptionsGetter) generic.RESTOptionsGetter {
+	return &restOptionsGetter{delegate: delegate, bindings: b}
+}
+
+type restOptionsGetter struct {
+	delegate generic.RESTOptionsGetter
+	bindings *Bindings
+}
+
+func (g *restOptionsGetter) GetRESTOptions(resource schema.GroupResource) (generic.RESTOptions, error) {
+	opts, err := g.delegate.GetRESTOptions(resource)
+	if err != nil {
+		return opts, err
+	}
+	decorator := opts.Decorator
+	opts.Decorator = func(
+		config *storagebackend.ConfigForResource,
+		resourcePrefix string,
+		keyFunc func(obj runtime.Object) (string, error),
+		newFunc func() runtime.Object,
+		newListFunc func() runtime.Object,
+		getAttrsFunc storage.AttrFunc,
+		triggerFuncs storage.IndexerFuncs,
+		indexers *cache.Indexers,
+	) (storage.Interface, factory.DestroyFunc, error) {
+		s, destroy, err := decorator(config, resourcePrefix, keyFunc, newFunc, newListFunc, getAttrsFunc, triggerFuncs, indexers)
+		if err != nil {
+			return s, destroy, err
+		}
+		return &restrictedStorage{Interface: s, resource: resource, bindings: g.bindings}, destroy, nil
+	}
+	return opts, nil
+}
+
+// restrictedStorage restricts the wildcard lists and watches of a resource bound through
+// APIBindings. Lists are restricted by their storage predicate, such that limits and
+// continue tokens keep working, and are served from etcd, as the watch cache filters with
+// its own attributes. Watches are filtered by event.
+type restrictedStorage struct {
+	storage.Interface
+
+	resource schema.GroupResource
+	bindings *Bindings
+}
+
+// binds returns a func returning whether the objects of a logical cluster are served to the
+// request, or nil if the request is not restricted.
+func (s *restrictedStorage) binds(ctx context.Context) (func(clusterName string) bool, error) {
+	cluster := genericapirequest.ClusterFrom(ctx)
+	if cluster == nil || !cluster.Wildcard {
+		return nil, nil
+	}
+	identityHash := IdentityFrom(ctx)
+	if identityHash == "" {
+		bound, err := s.bindings.IsBound(s.resource)
+		if err != nil {
+			return nil, apierrors.NewInternalError(err)
+		}
+		if !bound || isUnrestricted(ctx) {
+			return nil, nil
+		}
+		return nil, apierrors.NewForbidden(s.resource, "", fmt.Errorf("%s is bound through APIBindings, requests across logical clusters must present the identity hash of its APIExport as %s:<identityHash>", s.resource, s.resource.Resource))
+	}
+	return func(clusterName string) bool {
+		return s.bindings.Binds(clusterName, s.resource, identityHash)
+	}, nil
+}
+
+func (s *restrictedStorage) restrictList(ctx context.Context, opts storage.ListOptions) (storage.ListOptions, error) {
+	binds, err := s.binds(ctx)
+	if err != nil || binds == nil {
+		return opts, err
+	}
+	opts.Predicate = restrictPredicate(opts.Predicate, binds)
+	if opts.ResourceVersionMatch != metav1.ResourceVersionMatchExact && opts.Predicate.Continue == "" {
+		// An unset resource version is served from etcd, with the latest data.
+		opts.ResourceVersion = ""
+		opts.ResourceVersionMatch = ""
+	}
+	return opts, nil
+}
+
+func (s *restrictedStorage) GetToList(ctx context.Context, key string, opts storage.ListOptions, listObj runtime.Object) error {
+	opts, err := s.restrictList(ctx, opts)
+	if err != nil {
+		return err
+	}
+	return s.Interface.GetToList(ctx, key, opts, listObj)
+}
+
+func (s *restrictedStorage) List(ctx context.Context, key string, opts storage.ListOptions, listObj runtime.Object) error {
+	opts, err := s.restrictList(ctx, opts)
+	if err != nil {
+		return err
+	}
+	return s.Interface.List(ctx, key, opts, listObj)
+}
+
+func (s *restrictedStorage) Watch(ctx context.Context, key string, opts storage.ListOptions) (watch.Interface, error) {
+	binds, err := s.binds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	w, err := s.Interface.Watch(ctx, key, opts)
+	return filterWatch(w, binds), err
+}
+
+func (s *restrictedStorage) WatchList(ctx context.Context, key string, opts storage.ListOptions) (watch.Interface, error) {
+	binds, err := s.binds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	w, err := s.Interface.WatchList(ctx, key, opts)
+	return filterWatch(w, binds), err
+}
+
+// restrictPredicate returns the given predicate, only matching the objects of the logical
+// clusters binds returns true for.
+func restrictPredicate(pred storage.SelectionPredicate, binds func(clusterName string) bool) storage.SelectionPredicate {
+	getAttrs := pred.GetAttrs
+	if getAttrs == nil {
+		getAttrs = storage.DefaultNamespaceScopedAttr
+	}
+	pred.GetAttrs = func(obj runtime.Object) (labels.Set, fields.Set, error) {
+		l, f, err := getAttrs(obj)
+		if err != nil {
+			return nil, nil, err
+		}
+		m, err := meta.Accessor(obj)
+		if err != nil {
+			return nil, nil, err
+		}
+		restricted := make(fields.Set, len(f)+1)
+		for k, v := range f {
+			restricted[k] = v
+		}
+		restricted[boundField] = strconv.FormatBool(binds(m.GetClusterName()))
+		return l, restricted, nil
+	}
+	if pred.Label == nil {
+		pred.Label = labels.Everything()
+	}
+	if pred.Field == nil {
+		pred.Field = fields.Everything()
+	}
+	pred.Field = fields.AndSelectors(pred.Field, fields.OneTermEqualSelector(boundField, "true"))
+	return pred
+}
+
+// filterWatch returns the given watch, only passing the events of the objects of the logical
+// clusters binds returns true for, or the given watch if binds is nil.
+func filterWatch(w watch.Interface, binds func(clusterName string) bool) watch.Interface {
+	if w == nil || binds == nil {
+		return w
+	}
+	return watch.Filter(w, func(event watch.Event) (watch.Event, bool) {
+		if event.Type == watch.Bookmark || event.Type == watch.Error {
+			return event, true
+		}
+		m, err := meta.Accessor(event.Object)
+		return event, err == nil && binds(m.GetClusterName())
+	})
+}
@@ -0,0 +1,229 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exportidentity
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/apiserver/pkg/authentication/user"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/storage"
+	"k8s.io/client-go/tools/cache"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+)
+
+var widgets = schema.GroupResource{Group: "example.io", Resource: "widgets"}
+
+// fakeStorage lists its objects matching the predicate, like the etcd storage does.
+type fakeStorage struct {
+	storage.Interface
+
+	objs    []unstructured.Unstructured
+	opts    storage.ListOptions
+	watcher *watch.FakeWatcher
+}
+
+func (s *fakeStorage) List(_ context.Context, _ string, opts storage.ListOptions, listObj runtime.Object) error {
+	s.opts = opts
+	list := listObj.(*unstructured.UnstructuredList)
+	for i := range s.objs {
+		if ok, err := opts.Predicate.Matches(&s.objs[i]); err != nil {
+			return err
+		} else if ok {
+			list.Items = append(list.Items, s.objs[i])
+		}
+	}
+	return nil
+}
+
+func (s *fakeStorage) Watch(_ context.Context, _ string, _ storage.ListOptions) (watch.Interface, error) {
+	return s.watcher, nil
+}
+
+func newWidget(clusterName, name string) unstructured.Unstructured {
+	u := unstructured.Unstructured{}
+	u.SetAPIVersion("example.io/v1")
+	u.SetKind("Widget")
+	u.SetClusterName(clusterName)
+	u.SetName(name)
+	u.SetLabels(map[string]string{"app": name})
+	return u
+}
+
+func newBinding(clusterName, identityHash string, resources ...schema.GroupResource) *apisv1alpha1.APIBinding {
+	binding := &apisv1alpha1.APIBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "widgets", ClusterName: clusterName},
+		Status: apisv1alpha1.APIBindingStatus{
+			BoundAPIExport: &apisv1alpha1.ExportReference{
+				Workspace: &apisv1alpha1.WorkspaceExportReference{WorkspaceName: "provider", ExportName: "widgets", IdentityHash: identityHash},
+			},
+		},
+	}
+	for _, gr := range resources {
+		binding.Status.BoundResources = append(binding.Status.BoundResources, apisv1alpha1.BoundAPIResource{Group: gr.Group, Resource: gr.Resource})
+	}
+	return binding
+}
+
+func newBindings(t *testing.T, bindings ...*apisv1alpha1.APIBinding) *Bindings {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{
+		byBoundResource:         indexByBoundResource,
+		byBoundResourceIdentity: indexByBoundResourceIdentity,
+	})
+	for _, binding := range bindings {
+		if err := indexer.Add(binding); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &Bindings{indexer: indexer}
+}
+
+func wildcardContext(identityHash string, groups ...string) context.Context {
+	ctx := genericapirequest.WithCluster(context.Background(), genericapirequest.Cluster{Name: "admin", Wildcard: true})
+	ctx = genericapirequest.WithUser(ctx, &user.DefaultInfo{Name: "provider", Groups: groups})
+	if identityHash != "" {
+		ctx = WithIdentity(ctx, identityHash)
+	}
+	return ctx
+}
+
+func TestRestrictedStorageList(t *testing.T) {
+	bindings := newBindings(t,
+		newBinding("acme:consumer1", "abc", widgets),
+		newBinding("acme:consumer2", "abc", widgets),
+		newBinding("acme:other", "def", widgets),
+	)
+	objs := []unstructured.Unstructured{
+		newWidget("acme:consumer1", "a"),
+		newWidget("acme:consumer2", "b"),
+		newWidget("acme:other", "c"),
+		newWidget("acme:unbound", "d"),
+	}
+
+	for _, tt := range []struct {
+		name      string
+		ctx       context.Context
+		resource  schema.GroupResource
+		label     labels.Selector
+		wantNames []string
+		wantErr   func(error) bool
+	}{
+		{name: "matching identity", ctx: wildcardContext("abc"), resource: widgets, wantNames: []string{"a", "b"}},
+		{name: "matching identity with a label selector", ctx: wildcardContext("abc"), resource: widgets, label: labels.SelectorFromSet(labels.Set{"app": "b"}), wantNames: []string{"b"}},
+		{name: "other identity", ctx: wildcardContext("def"), resource: widgets, wantNames: []string{"c"}},
+		{name: "mismatched identity", ctx: wildcardContext("xyz"), resource: widgets},
+		{name: "missing identity", ctx: wildcardContext(""), resource: widgets, wantErr: apierrors.IsForbidden},
+		{name: "missing identity of a privileged user", ctx: wildcardContext("", user.SystemPrivilegedGroup), resource: widgets, wantNames: []string{"a", "b", "c", "d"}},
+		{name: "missing identity of an unbound resource", ctx: wildcardContext(""), resource: schema.GroupResource{Group: "example.io", Resource: "gadgets"}, wantNames: []string{"a", "b", "c", "d"}},
+		{name: "single logical cluster", ctx: genericapirequest.WithCluster(context.Background(), genericapirequest.Cluster{Name: "acme:other"}), resource: widgets, wantNames: []string{"a", "b", "c", "d"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			delegate := &fakeStorage{objs: objs}
+			s := &restrictedStorage{Interface: delegate, resource: tt.resource, bindings: bindings}
+
+			label := tt.label
+			if label == nil {
+				label = labels.Everything()
+			}
+			opts := storage.ListOptions{
+				ResourceVersion: "0",
+				Predicate:       storage.SelectionPredicate{Label: label, Field: fields.Everything(), Limit: 10, GetAttrs: storage.DefaultClusterScopedAttr},
+			}
+			list := &unstructured.UnstructuredList{}
+			err := s.List(tt.ctx, "/widgets", opts, list)
+			if tt.wantErr != nil {
+				if !tt.wantErr(err) {
+					t.Fatalf("List() error = %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+
+			var names []string
+			for _, item := range list.Items {
+				names = append(names, item.GetName())
+			}
+			if !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("List() = %v, want %v", names, tt.wantNames)
+			}
+			if delegate.opts.Predicate.Limit != 10 {
+				t.Errorf("List() limit = %d, want 10", delegate.opts.Predicate.Limit)
+			}
+		})
+	}
+}
+
+func TestRestrictedStorageWatch(t *testing.T) {
+	bindings := newBindings(t,
+		newBinding("acme:consumer1", "abc", widgets),
+		newBinding("acme:other", "def", widgets),
+	)
+
+	for _, tt := range []struct {
+		name      string
+		ctx       context.Context
+		wantNames []string
+		wantErr   bool
+	}{
+		{name: "matching identity", ctx: wildcardContext("abc"), wantNames: []string{"a"}},
+		{name: "mismatched identity", ctx: wildcardContext("xyz")},
+		{name: "missing identity", ctx: wildcardContext(""), wantErr: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			delegate := &fakeStorage{watcher: watch.NewFakeWithChanSize(2, false)}
+			s := &restrictedStorage{Interface: delegate, resource: widgets, bindings: bindings}
+
+			w, err := s.Watch(tt.ctx, "/widgets", storage.ListOptions{})
+			if tt.wantErr {
+				if !apierrors.IsForbidden(err) {
+					t.Fatalf("Watch() error = %v, want forbidden", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Watch() error = %v", err)
+			}
+			defer w.Stop()
+
+			other, consumer := newWidget("acme:other", "c"), newWidget("acme:consumer1", "a")
+			delegate.watcher.Add(&consumer)
+			delegate.watcher.Add(&other)
+			delegate.watcher.Stop()
+
+			var names []string
+			for event := range w.ResultChan() {
+				names = append(names, event.Object.(*unstructured.Unstructured).GetName())
+			}
+			if !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("Watch() = %v, want %v", names, tt.wantNames)
+			}
+		})
+	}
+}
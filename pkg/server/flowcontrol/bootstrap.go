@@ -0,0 +1,141 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flowcontrol
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	flowcontrolv1beta2 "k8s.io/api/flowcontrol/v1beta2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	genericapiserver "k8s.io/apiserver/pkg/server"
+	"k8s.io/client-go/kubernetes"
+	flowcontrolclient "k8s.io/client-go/kubernetes/typed/flowcontrol/v1beta2"
+	"k8s.io/klog/v2"
+	"k8s.io/kubernetes/pkg/genericcontrolplane"
+)
+
+// TenantDefault is the name of the FlowSchema and PriorityLevelConfiguration of the requests
+// of the authenticated users not matched by a more specific FlowSchema, whose flows are
+// distinguished by logical cluster.
+const TenantDefault = "tenant-default"
+
+// tenantDefaultPriorityLevel gives the tenants the same share of the concurrency as the
+// global-default priority level, each tenant being limited to a few of its queues.
+var tenantDefaultPriorityLevel = &flowcontrolv1beta2.PriorityLevelConfiguration{
+	ObjectMeta: metav1.ObjectMeta{Name: TenantDefault},
+	Spec: flowcontrolv1beta2.PriorityLevelConfigurationSpec{
+		Type: flowcontrolv1beta2.PriorityLevelEnablementLimited,
+		Limited: &flowcontrolv1beta2.LimitedPriorityLevelConfiguration{
+			AssuredConcurrencyShares: 20,
+			LimitResponse: flowcontrolv1beta2.LimitResponse{
+				Type: flowcontrolv1beta2.LimitResponseTypeQueue,
+				Queuing: &flowcontrolv1beta2.QueuingConfiguration{
+					Queues:           128,
+					HandSize:         6,
+					QueueLengthLimit: 50,
+				},
+			},
+		},
+	},
+}
+
+// tenantDefaultFlowSchema matches the requests of all authenticated users before the
+// global-default FlowSchema does.
+var tenantDefaultFlowSchema = &flowcontrolv1beta2.FlowSchema{
+	ObjectMeta: metav1.ObjectMeta{
+		Name: TenantDefault,
+		Annotations: map[string]string{
+			DistinguisherAnnotation: DistinguisherLogicalCluster,
+		},
+	},
+	Spec: flowcontrolv1beta2.FlowSchemaSpec{
+		PriorityLevelConfiguration: flowcontrolv1beta2.PriorityLevelConfigurationReference{Name: TenantDefault},
+		MatchingPrecedence:         9800,
+		DistinguisherMethod:        &flowcontrolv1beta2.FlowDistinguisherMethod{Type: flowcontrolv1beta2.FlowDistinguisherMethodByUserType},
+		Rules: []flowcontrolv1beta2.PolicyRulesWithSubjects{
+			{
+				Subjects: []flowcontrolv1beta2.Subject{
+					{
+						Kind:  flowcontrolv1beta2.SubjectKindGroup,
+						Group: &flowcontrolv1beta2.GroupSubject{Name: "system:authenticated"},
+					},
+				},
+				ResourceRules: []flowcontrolv1beta2.ResourcePolicyRule{
+					{
+						Verbs:        []string{flowcontrolv1beta2.VerbAll},
+						APIGroups:    []string{flowcontrolv1beta2.APIGroupAll},
+						Resources:    []string{flowcontrolv1beta2.ResourceAll},
+						ClusterScope: true,
+						Namespaces:   []string{flowcontrolv1beta2.NamespaceEvery},
+					},
+				},
+				NonResourceRules: []flowcontrolv1beta2.NonResourcePolicyRule{
+					{
+						Verbs:           []string{flowcontrolv1beta2.VerbAll},
+						NonResourceURLs: []string{flowcontrolv1beta2.NonResourceAll},
+					},
+				},
+			},
+		},
+	},
+}
+
+// EnsureTenantConfiguration is a post-start hook creating the tenant-default FlowSchema and
+// PriorityLevelConfiguration in the admin logical cluster if they do not exist. Existing
+// ones are left untouched, such that they can be tuned or removed by the operators.
+func EnsureTenantConfiguration(hookContext genericapiserver.PostStartHookContext) error {
+	kubeClusterClient, err := kubernetes.NewClusterForConfig(hookContext.LoopbackClientConfig)
+	if err != nil {
+		return err
+	}
+	client := kubeClusterClient.Cluster(genericcontrolplane.LocalAdminCluster).FlowcontrolV1beta2()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-hookContext.StopCh
+		cancel()
+	}()
+
+	// the flowcontrol API might not be served yet, so keep trying in the background like
+	// the APF bootstrap configuration does, not to hold back the readiness of the server.
+	go func() {
+		defer cancel()
+		_ = wait.PollImmediateUntil(time.Second, func() (bool, error) {
+			if err := ensureTenantConfiguration(ctx, client); err != nil {
+				klog.Errorf("Failed to ensure the %s APF configuration, will retry: %v", TenantDefault, err)
+				return false, nil
+			}
+			return true, nil
+		}, ctx.Done())
+	}()
+
+	return nil
+}
+
+func ensureTenantConfiguration(ctx context.Context, client flowcontrolclient.FlowcontrolV1beta2Interface) error {
+	if _, err := client.PriorityLevelConfigurations().Create(ctx, tenantDefaultPriorityLevel, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create PriorityLevelConfiguration %s: %w", TenantDefault, err)
+	}
+	if _, err := client.FlowSchemas().Create(ctx, tenantDefaultFlowSchema, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create FlowSchema %s: %w", TenantDefault, err)
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package flowcontrol partitions the request concurrency of API Priority and Fairness by
+// logical cluster or organization.
+//
+// The flow distinguisher methods of APF are limited to the user and the namespace. Flow
+// schemas using the ByUser method can be annotated with DistinguisherAnnotation for the
+// requests they match to be distinguished by their logical cluster or organization
+// instead, such that one tenant's controller storm only fills its own queues of the
+// priority level instead of starving the other tenants on the same shard.
+package flowcontrol
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	flowcontrolv1beta2 "k8s.io/api/flowcontrol/v1beta2"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apiserver/pkg/authentication/user"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	utilflowcontrol "k8s.io/apiserver/pkg/util/flowcontrol"
+	fq "k8s.io/apiserver/pkg/util/flowcontrol/fairqueuing"
+	fcrequest "k8s.io/apiserver/pkg/util/flowcontrol/request"
+	flowcontrolinformers "k8s.io/client-go/informers/flowcontrol/v1beta2"
+	flowcontrollisters "k8s.io/client-go/listers/flowcontrol/v1beta2"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/kubernetes/pkg/genericcontrolplane"
+
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+)
+
+const (
+	// DistinguisherAnnotation on a FlowSchema using the ByUser distinguisher method
+	// distinguishes the flows of the requests it matches by the given key instead.
+	DistinguisherAnnotation = "flowcontrol.kcp.dev/distinguisher"
+
+	// DistinguisherLogicalCluster distinguishes flows by the logical cluster of the request.
+	DistinguisherLogicalCluster = "LogicalCluster"
+	// DistinguisherOrganization distinguishes flows by the organization of the logical
+	// cluster of the request, sharing the queues between its workspaces.
+	DistinguisherOrganization = "Organization"
+)
+
+// WithTenantDistinguisher returns the given APF controller, distinguishing the flows of the
+// requests matched by a FlowSchema annotated with DistinguisherAnnotation by their logical
+// cluster or organization. Only the FlowSchemas of the admin logical cluster, which configure
+// APF, are considered.
+func WithTenantDistinguisher(delegate utilflowcontrol.Interface, flowSchemaInformer flowcontrolinformers.FlowSchemaInformer) utilflowcontrol.Interface {
+	d := &tenantDistinguisher{
+		Interface: delegate,
+	}
+	d.flowSchemas.Store([]*flowcontrolv1beta2.FlowSchema{})
+
+	lister := flowSchemaInformer.Lister()
+	flowSchemaInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: func(obj interface{}) bool {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			fs, ok := obj.(*flowcontrolv1beta2.FlowSchema)
+			return ok && fs.ClusterName == genericcontrolplane.LocalAdminCluster
+		},
+		Handler: cache.ResourceEventHandlerFuncs{
+			AddFunc:    func(obj interface{}) { d.refresh(lister) },
+			UpdateFunc: func(_, obj interface{}) { d.refresh(lister) },
+			DeleteFunc: func(obj interface{}) { d.refresh(lister) },
+		},
+	})
+
+	return d
+}
+
+// tenantDistinguisher rewrites the user of the request digests matched by an annotated
+// FlowSchema to one named after the distinguisher key, such that the ByUser method
+// distinguishes the flows by it.
+type tenantDistinguisher struct {
+	utilflowcontrol.Interface
+
+	// flowSchemas holds the FlowSchemas of the admin logical cluster in matching order,
+	// as a []*flowcontrolv1beta2.FlowSchema.
+	flowSchemas atomic.Value
+}
+
+// refresh snapshots the FlowSchemas of the admin logical cluster in matching order.
+func (d *tenantDistinguisher) refresh(lister flowcontrollisters.FlowSchemaLister) {
+	all, err := lister.List(labels.Everything())
+	if err != nil {
+		runtime.HandleError(fmt.Errorf("failed to list FlowSchemas: %w", err))
+		return
+	}
+	flowSchemas := make([]*flowcontrolv1beta2.FlowSchema, 0, len(all))
+	for _, fs := range all {
+		if fs.ClusterName == genericcontrolplane.LocalAdminCluster && !isDangling(fs) {
+			flowSchemas = append(flowSchemas, fs)
+		}
+	}
+	sortFlowSchemas(flowSchemas)
+	d.flowSchemas.Store(flowSchemas)
+}
+
+// isDangling returns whether APF reported the priority level of the given FlowSchema to not
+// exist, in which case APF ignores it.
+func isDangling(fs *flowcontrolv1beta2.FlowSchema) bool {
+	for _, condition := range fs.Status.Conditions {
+		if condition.Type == flowcontrolv1beta2.FlowSchemaConditionDangling {
+			return condition.Status == flowcontrolv1beta2.ConditionTrue
+		}
+	}
+	return false
+}
+
+// sortFlowSchemas sorts the given FlowSchemas in the order APF matches them.
+func sortFlowSchemas(flowSchemas []*flowcontrolv1beta2.FlowSchema) {
+	sort.Slice(flowSchemas, func(i, j int) bool {
+		if flowSchemas[i].Spec.MatchingPrecedence != flowSchemas[j].Spec.MatchingPrecedence {
+			return flowSchemas[i].Spec.MatchingPrecedence < flowSchemas[j].Spec.MatchingPrecedence
+		}
+		return flowSchemas[i].Name < flowSchemas[j].Name
+	})
+}
+
+func (d *tenantDistinguisher) Handle(ctx context.Context,
+	requestDigest utilflowcontrol.RequestDigest,
+	noteFn func(fs *flowcontrolv1beta2.FlowSchema, pl *flowcontrolv1beta2.PriorityLevelConfiguration, flowDistinguisher string),
+	workEstimator func() fcrequest.WorkEstimate,
+	queueNoteFn fq.QueueNoteFn,
+	execFn func(),
+) {
+	var clusterName string
+	if cluster := genericapirequest.ClusterFrom(ctx); cluster != nil {
+		clusterName = cluster.Name
+	}
+	requestDigest = distinguish(d.flowSchemas.Load().([]*flowcontrolv1beta2.FlowSchema), clusterName, requestDigest)
+	d.Interface.Handle(ctx, requestDigest, noteFn, workEstimator, queueNoteFn, execFn)
+}
+
+// distinguish returns the given request digest with its user renamed to the distinguisher
+// key of the first matching FlowSchema, if it is annotated. The digest is returned
+// unchanged if the renamed user would be matched by another FlowSchema.
+func distinguish(flowSchemas []*flowcontrolv1beta2.FlowSchema, clusterName string, requestDigest utilflowcontrol.RequestDigest) utilflowcontrol.RequestDigest {
+	if clusterName == "" || requestDigest.User == nil || requestDigest.RequestInfo == nil {
+		return requestDigest
+	}
+
+	fs := firstMatch(flowSchemas, requestDigest)
+	if fs == nil || fs.Spec.DistinguisherMethod == nil || fs.Spec.DistinguisherMethod.Type != flowcontrolv1beta2.FlowDistinguisherMethodByUserType {
+		return requestDigest
+	}
+
+	var key string
+	switch fs.Annotations[DistinguisherAnnotation] {
+	case DistinguisherLogicalCluster:
+		key = clusterName
+	case DistinguisherOrganization:
+		key = organization(clusterName)
+	default:
+		return requestDigest
+	}
+
+	distinguished := utilflowcontrol.RequestDigest{
+		RequestInfo: requestDigest.RequestInfo,
+		User: &user.DefaultInfo{
+			Name:   key,
+			UID:    requestDigest.User.GetUID(),
+			Groups: requestDigest.User.GetGroups(),
+			Extra:  requestDigest.User.GetExtra(),
+		},
+	}
+	if firstMatch(flowSchemas, distinguished) != fs {
+		return requestDigest
+	}
+	return distinguished
+}
+
+// organization returns the logical cluster of the organization of the given logical cluster,
+// i.e. the logical cluster itself for the root, system and organization logical clusters,
+// and its parent for the workspaces of an organization.
+func organization(clusterName string) string {
+	if clusterName == helper.RootCluster || strings.HasPrefix(clusterName, helper.LocalSystemClusterPrefix) {
+		return clusterName
+	}
+	parent, _, err := helper.ParseLogicalClusterName(clusterName)
+	if err != nil || parent == helper.RootCluster {
+		return clusterName
+	}
+	return helper.EncodeOrganizationAndWorkspace(helper.RootCluster, parent)
+}
+
+// firstMatch returns the first of the given FlowSchemas, in matching order, matching the
+// given request digest, or nil if there is none.
+func firstMatch(flowSchemas []*flowcontrolv1beta2.FlowSchema, requestDigest utilflowcontrol.RequestDigest) *flowcontrolv1beta2.FlowSchema {
+	for _, fs := range flowSchemas {
+		if matchesFlowSchema(requestDigest, fs) {
+			return fs
+		}
+	}
+	return nil
+}
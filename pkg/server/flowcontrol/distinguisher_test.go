@@ -0,0 +1,138 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flowcontrol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	flowcontrolv1beta2 "k8s.io/api/flowcontrol/v1beta2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	utilflowcontrol "k8s.io/apiserver/pkg/util/flowcontrol"
+)
+
+func TestDistinguish(t *testing.T) {
+	byOrganization := tenantDefaultFlowSchema.DeepCopy()
+	byOrganization.Annotations[DistinguisherAnnotation] = DistinguisherOrganization
+
+	// matches the users named after a logical cluster before tenant-default
+	clusterNamedUser := &flowcontrolv1beta2.FlowSchema{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster-named-user"},
+		Spec: flowcontrolv1beta2.FlowSchemaSpec{
+			MatchingPrecedence: 100,
+			Rules: []flowcontrolv1beta2.PolicyRulesWithSubjects{{
+				Subjects: []flowcontrolv1beta2.Subject{{
+					Kind: flowcontrolv1beta2.SubjectKindUser,
+					User: &flowcontrolv1beta2.UserSubject{Name: "org:ws"},
+				}},
+				ResourceRules: tenantDefaultFlowSchema.Spec.Rules[0].ResourceRules,
+			}},
+		},
+	}
+	serviceAccounts := &flowcontrolv1beta2.FlowSchema{
+		ObjectMeta: metav1.ObjectMeta{Name: "service-accounts"},
+		Spec: flowcontrolv1beta2.FlowSchemaSpec{
+			MatchingPrecedence:  9000,
+			DistinguisherMethod: &flowcontrolv1beta2.FlowDistinguisherMethod{Type: flowcontrolv1beta2.FlowDistinguisherMethodByUserType},
+			Rules: []flowcontrolv1beta2.PolicyRulesWithSubjects{{
+				Subjects: []flowcontrolv1beta2.Subject{{
+					Kind:  flowcontrolv1beta2.SubjectKindGroup,
+					Group: &flowcontrolv1beta2.GroupSubject{Name: "system:serviceaccounts"},
+				}},
+				ResourceRules: tenantDefaultFlowSchema.Spec.Rules[0].ResourceRules,
+			}},
+		},
+	}
+
+	requestInfo := &genericapirequest.RequestInfo{IsResourceRequest: true, Verb: "list", APIGroup: "apps", Resource: "deployments", Namespace: "default"}
+	alice := &user.DefaultInfo{Name: "alice", Groups: []string{"system:authenticated"}}
+	serviceAccount := &user.DefaultInfo{Name: "system:serviceaccount:default:sa", Groups: []string{"system:serviceaccounts", "system:authenticated"}}
+
+	tests := []struct {
+		name        string
+		flowSchemas []*flowcontrolv1beta2.FlowSchema
+		clusterName string
+		user        user.Info
+		wantUser    string
+	}{
+		{
+			name:        "distinguished by logical cluster",
+			flowSchemas: []*flowcontrolv1beta2.FlowSchema{serviceAccounts, tenantDefaultFlowSchema},
+			clusterName: "org:ws",
+			user:        alice,
+			wantUser:    "org:ws",
+		},
+		{
+			name:        "distinguished by organization",
+			flowSchemas: []*flowcontrolv1beta2.FlowSchema{byOrganization},
+			clusterName: "org:ws",
+			user:        alice,
+			wantUser:    "root:org",
+		},
+		{
+			name:        "organizations are their own organization",
+			flowSchemas: []*flowcontrolv1beta2.FlowSchema{byOrganization},
+			clusterName: "root:org",
+			user:        alice,
+			wantUser:    "root:org",
+		},
+		{
+			name:        "not annotated flow schemas are left alone",
+			flowSchemas: []*flowcontrolv1beta2.FlowSchema{serviceAccounts, tenantDefaultFlowSchema},
+			clusterName: "org:ws",
+			user:        serviceAccount,
+			wantUser:    "system:serviceaccount:default:sa",
+		},
+		{
+			name:        "no distinguishing if another flow schema would match",
+			flowSchemas: []*flowcontrolv1beta2.FlowSchema{clusterNamedUser, tenantDefaultFlowSchema},
+			clusterName: "org:ws",
+			user:        alice,
+			wantUser:    "alice",
+		},
+		{
+			name:        "no distinguishing without logical cluster",
+			flowSchemas: []*flowcontrolv1beta2.FlowSchema{tenantDefaultFlowSchema},
+			user:        alice,
+			wantUser:    "alice",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			digest := distinguish(tt.flowSchemas, tt.clusterName, utilflowcontrol.RequestDigest{RequestInfo: requestInfo, User: tt.user})
+			require.Equal(t, tt.wantUser, digest.User.GetName())
+			require.Equal(t, tt.user.GetGroups(), digest.User.GetGroups())
+		})
+	}
+}
+
+func TestSortFlowSchemas(t *testing.T) {
+	flowSchema := func(name string, precedence int32) *flowcontrolv1beta2.FlowSchema {
+		return &flowcontrolv1beta2.FlowSchema{ObjectMeta: metav1.ObjectMeta{Name: name}, Spec: flowcontrolv1beta2.FlowSchemaSpec{MatchingPrecedence: precedence}}
+	}
+	flowSchemas := []*flowcontrolv1beta2.FlowSchema{flowSchema("global-default", 9900), flowSchema("b", 9800), flowSchema("a", 9800), flowSchema("exempt", 1)}
+	sortFlowSchemas(flowSchemas)
+
+	var names []string
+	for _, fs := range flowSchemas {
+		names = append(names, fs.Name)
+	}
+	require.Equal(t, []string{"exempt", "a", "b", "global-default"}, names)
+}
@@ -18,11 +18,9 @@ package server
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"net/http"
 	_ "net/http/pprof"
-	"net/url"
 	"regexp"
 	"sort"
 	"strings"
@@ -45,6 +43,9 @@ import (
 	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
 	"k8s.io/kubernetes/pkg/genericcontrolplane"
 	"k8s.io/kubernetes/pkg/genericcontrolplane/aggregator"
+
+	"github.com/kcp-dev/kcp/pkg/home"
+	"github.com/kcp-dev/kcp/pkg/server/exportidentity"
 )
 
 var (
@@ -92,13 +93,20 @@ func WithClusterScope(apiHandler http.Handler) http.HandlerFunc {
 			clusterName = req.Header.Get("X-Kubernetes-Cluster")
 		}
 		var cluster genericapirequest.Cluster
+		var identityHash string
 		switch clusterName {
 		case "*":
-			// HACK: just a workaround for testing
+			// list and watch across all logical clusters of the shard, see WithWildcardListWatchGuard.
 			cluster.Wildcard = true
+			// the identity hash of the APIExport suffixing the resource, see exportidentity.
+			req.URL.Path, identityHash = exportidentity.SplitPath(req.URL.Path)
+			req.URL.RawPath, _ = exportidentity.SplitPath(req.URL.RawPath)
 			fallthrough
 		case "":
 			cluster.Name = genericcontrolplane.LocalAdminCluster
+		case home.ClusterName:
+			// the home workspace of the user, resolved once authenticated, see home.WithHomeWorkspaces.
+			cluster.Name = clusterName
 		default:
 			if !reClusterName.MatchString(clusterName) {
 				responsewriters.ErrorNegotiated(
@@ -110,10 +118,16 @@ func WithClusterScope(apiHandler http.Handler) http.HandlerFunc {
 			cluster.Name = clusterName
 		}
 		ctx := genericapirequest.WithCluster(req.Context(), cluster)
+		if identityHash != "" {
+			ctx = exportidentity.WithIdentity(ctx, identityHash)
+		}
 		apiHandler.ServeHTTP(w, req.WithContext(ctx))
 	}
 }
 
+// WithWildcardListWatchGuard rejects every resource request to the `*` logical cluster other
+// than list and watch. Objects returned by these requests carry the name of their logical
+// cluster in metadata.clusterName.
 func WithWildcardListWatchGuard(apiHandler http.Handler) http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
 		cluster := genericapirequest.ClusterFrom(req.Context())
@@ -306,13 +320,3 @@ func (r *inMemoryResponseWriter) String() string {
 	}
 	return s
 }
-
-// unimplementedServiceResolver is a webhook.ServiceResolver that always returns an error, because
-// we have not implemented support for this yet. As a result, CRD webhook conversions are not
-// supported.
-type unimplementedServiceResolver struct{}
-
-// ResolveEndpoint always returns an error that this is not yet supported.
-func (r *unimplementedServiceResolver) ResolveEndpoint(namespace string, name string, port int32) (*url.URL, error) {
-	return nil, errors.New("CRD webhook conversions are not yet supported in kcp")
-}
@@ -0,0 +1,141 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package maintenance blocks the requests to workspaces under maintenance at the edge of
+// the shard, e.g. while they are migrated to another shard or restored from a backup, such
+// that clients get a 503 with a friendly message and retry later instead of reading from
+// or writing to a half-migrated workspace.
+//
+// A workspace is put under maintenance by setting the Annotation on its ClusterWorkspace,
+// which blocks the descendant workspaces too.
+package maintenance
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/handlers/responsewriters"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/tools/clusters"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+	"github.com/kcp-dev/kcp/pkg/authorization"
+	tenancylisters "github.com/kcp-dev/kcp/pkg/client/listers/tenancy/v1alpha1"
+)
+
+const (
+	// Annotation on a ClusterWorkspace puts the workspace and its descendants under
+	// maintenance. Its value is the reason shown to the clients, e.g. "migration to shard-2".
+	Annotation = "tenancy.kcp.dev/maintenance"
+
+	// retryAfterSeconds is the delay after which clients are asked to retry.
+	retryAfterSeconds = 30
+)
+
+var (
+	errorScheme = runtime.NewScheme()
+	errorCodecs = serializer.NewCodecFactory(errorScheme)
+)
+
+func init() {
+	errorScheme.AddUnversionedTypes(metav1.Unversioned,
+		&metav1.Status{},
+	)
+}
+
+// WithMaintenance rejects the requests to workspaces under maintenance, or whose ancestors
+// are, with 503 Service Unavailable, the reason of the maintenance and a Retry-After header.
+// Requests of privileged users, i.e. of kcp itself and of the operators performing the
+// maintenance, and wildcard requests across logical clusters are not blocked.
+func WithMaintenance(handler http.Handler, workspaceLister tenancylisters.ClusterWorkspaceLister) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		cluster := genericapirequest.ClusterFrom(req.Context())
+		if cluster == nil || cluster.Wildcard {
+			handler.ServeHTTP(w, req)
+			return
+		}
+		if u, ok := genericapirequest.UserFrom(req.Context()); ok {
+			for _, group := range u.GetGroups() {
+				if group == user.SystemPrivilegedGroup {
+					handler.ServeHTTP(w, req)
+					return
+				}
+			}
+		}
+
+		if workspace, reason, ok := underMaintenance(cluster.Name, workspaceLister); ok {
+			responsewriters.ErrorNegotiated(unavailable(cluster.Name, workspace, reason), errorCodecs, schema.GroupVersion{}, w, req)
+			return
+		}
+		handler.ServeHTTP(w, req)
+	}
+}
+
+// underMaintenance returns the ClusterWorkspace of the given logical cluster, or of its
+// closest ancestor, under maintenance and the reason of the maintenance.
+func underMaintenance(clusterName string, workspaceLister tenancylisters.ClusterWorkspaceLister) (*tenancyv1alpha1.ClusterWorkspace, string, bool) {
+	if strings.HasPrefix(clusterName, helper.LocalSystemClusterPrefix) {
+		return nil, "", false
+	}
+	for clusterName != helper.RootCluster {
+		parent, err := helper.ParentClusterName(clusterName)
+		if err != nil {
+			return nil, "", false
+		}
+		_, name, err := helper.ParseLogicalClusterName(clusterName)
+		if err != nil {
+			return nil, "", false
+		}
+		if workspace, err := workspaceLister.Get(clusters.ToClusterAwareKey(parent, name)); err == nil {
+			if reason, ok := workspace.Annotations[Annotation]; ok {
+				return workspace, reason, true
+			}
+		}
+		clusterName = parent
+	}
+	return nil, "", false
+}
+
+// unavailable returns a 503 error asking clients to retry once the maintenance is over.
+func unavailable(clusterName string, workspace *tenancyv1alpha1.ClusterWorkspace, reason string) error {
+	message := fmt.Sprintf("workspace %s is under maintenance", authorization.WorkspacePath(clusterName))
+	if ancestor, err := helper.EncodeLogicalClusterName(workspace); err == nil && ancestor != clusterName {
+		message = fmt.Sprintf("workspace %s is under maintenance as part of workspace %s", authorization.WorkspacePath(clusterName), authorization.WorkspacePath(ancestor))
+	}
+	if reason != "" {
+		message += ": " + reason
+	}
+	return &apierrors.StatusError{ErrStatus: metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    http.StatusServiceUnavailable,
+		Reason:  metav1.StatusReasonServiceUnavailable,
+		Message: message + ", please try again later",
+		Details: &metav1.StatusDetails{
+			Group:             tenancyv1alpha1.SchemeGroupVersion.Group,
+			Kind:              "clusterworkspaces",
+			Name:              workspace.Name,
+			RetryAfterSeconds: retryAfterSeconds,
+		},
+	}}
+}
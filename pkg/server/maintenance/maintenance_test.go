@@ -0,0 +1,101 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package maintenance
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/tools/cache"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	tenancylisters "github.com/kcp-dev/kcp/pkg/client/listers/tenancy/v1alpha1"
+)
+
+func TestWithMaintenance(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, ws := range []*tenancyv1alpha1.ClusterWorkspace{
+		{ObjectMeta: metav1.ObjectMeta{ClusterName: "root", Name: "acme"}},
+		{ObjectMeta: metav1.ObjectMeta{ClusterName: "root:acme", Name: "team", Annotations: map[string]string{Annotation: "migration to shard-2"}}},
+		{ObjectMeta: metav1.ObjectMeta{ClusterName: "root", Name: "moving", Annotations: map[string]string{Annotation: ""}}},
+		{ObjectMeta: metav1.ObjectMeta{ClusterName: "root:moving", Name: "team"}},
+	} {
+		require.NoError(t, indexer.Add(ws))
+	}
+	handler := WithMaintenance(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), tenancylisters.NewClusterWorkspaceLister(indexer))
+
+	for _, tt := range []struct {
+		name        string
+		cluster     genericapirequest.Cluster
+		groups      []string
+		wantCode    int
+		wantMessage string
+	}{
+		{name: "root", cluster: genericapirequest.Cluster{Name: "root"}, wantCode: http.StatusOK},
+		{name: "system", cluster: genericapirequest.Cluster{Name: "system:admin"}, wantCode: http.StatusOK},
+		{name: "organization", cluster: genericapirequest.Cluster{Name: "root:acme"}, wantCode: http.StatusOK},
+		{name: "sibling", cluster: genericapirequest.Cluster{Name: "acme:other"}, wantCode: http.StatusOK},
+		{name: "wildcard", cluster: genericapirequest.Cluster{Name: "*", Wildcard: true}, wantCode: http.StatusOK},
+		{
+			name:        "under maintenance",
+			cluster:     genericapirequest.Cluster{Name: "acme:team"},
+			wantCode:    http.StatusServiceUnavailable,
+			wantMessage: "workspace root:acme:team is under maintenance: migration to shard-2, please try again later",
+		},
+		{
+			name:     "under maintenance, privileged",
+			cluster:  genericapirequest.Cluster{Name: "acme:team"},
+			groups:   []string{user.SystemPrivilegedGroup},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:        "organization under maintenance",
+			cluster:     genericapirequest.Cluster{Name: "root:moving"},
+			wantCode:    http.StatusServiceUnavailable,
+			wantMessage: "workspace root:moving is under maintenance, please try again later",
+		},
+		{
+			name:        "parent under maintenance",
+			cluster:     genericapirequest.Cluster{Name: "moving:team"},
+			wantCode:    http.StatusServiceUnavailable,
+			wantMessage: "workspace root:moving:team is under maintenance as part of workspace root:moving, please try again later",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/configmaps", nil)
+			ctx := genericapirequest.WithCluster(req.Context(), tt.cluster)
+			ctx = genericapirequest.WithUser(ctx, &user.DefaultInfo{Name: "alice", Groups: tt.groups})
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req.WithContext(ctx))
+
+			require.Equal(t, tt.wantCode, w.Code)
+			if tt.wantCode == http.StatusServiceUnavailable {
+				require.Equal(t, "30", w.Header().Get("Retry-After"))
+				require.True(t, strings.Contains(w.Body.String(), tt.wantMessage), "expected message %q in %s", tt.wantMessage, w.Body.String())
+			}
+		})
+	}
+}
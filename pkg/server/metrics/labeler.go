@@ -0,0 +1,153 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	// OtherClusters is the logical cluster label of the logical clusters which are
+	// neither allowed nor among the busiest ones.
+	OtherClusters = "other"
+
+	// topWindow is the period over which the busiest logical clusters are determined.
+	topWindow = time.Minute
+)
+
+// ClusterLabeler bounds the cardinality of a logical cluster label: only the allowed
+// logical clusters and the topN other logical clusters with the most observations in
+// the previous minute are broken out, the others are labeled OtherClusters.
+type ClusterLabeler struct {
+	allowed sets.String
+	topN    int
+	now     func() time.Time
+	// evict is called with the logical clusters which are not broken out anymore, for
+	// their series to be deleted.
+	evict func(clusterName string)
+
+	lock sync.Mutex
+	// windowStart is the start of the window observations are currently counted in.
+	windowStart time.Time
+	// counts are the number of observations per logical cluster in the current window.
+	counts map[string]int
+	// top are the busiest logical clusters of the previous window.
+	top sets.String
+	// brokenOut are the logical clusters labeled with their own name since they were
+	// last evicted.
+	brokenOut sets.String
+}
+
+// NewClusterLabeler returns a ClusterLabeler breaking out the allowed logical clusters and
+// the topN busiest other ones. evict is called with the logical clusters falling out of
+// the busiest ones.
+func NewClusterLabeler(allowed []string, topN int, evict func(clusterName string)) *ClusterLabeler {
+	return newClusterLabeler(allowed, topN, evict, time.Now)
+}
+
+func newClusterLabeler(allowed []string, topN int, evict func(clusterName string), now func() time.Time) *ClusterLabeler {
+	return &ClusterLabeler{
+		allowed:     sets.NewString(allowed...),
+		topN:        topN,
+		now:         now,
+		evict:       evict,
+		windowStart: now(),
+		counts:      map[string]int{},
+		top:         sets.NewString(),
+		brokenOut:   sets.NewString(),
+	}
+}
+
+// Observe counts an observation of the given logical cluster, and calls record with the
+// logical cluster label it is recorded under. record and evict are called with the lock
+// of the labeler held, such that no series is recorded for a logical cluster while it
+// is evicted.
+func (l *ClusterLabeler) Observe(clusterName string, record func(label string)) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	record(l.label(clusterName))
+}
+
+// Label returns the logical cluster label the given logical cluster is currently recorded
+// under, without counting an observation.
+func (l *ClusterLabeler) Label(clusterName string) string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.allowed.Has(clusterName) || l.top.Has(clusterName) {
+		return clusterName
+	}
+	return OtherClusters
+}
+
+func (l *ClusterLabeler) label(clusterName string) string {
+	if now := l.now(); now.Sub(l.windowStart) >= topWindow {
+		l.rotate(now)
+	}
+	// allowed logical clusters do not take the place of busy ones
+	if l.topN > 0 && !l.allowed.Has(clusterName) {
+		l.counts[clusterName]++
+	}
+
+	if !l.allowed.Has(clusterName) && !l.top.Has(clusterName) {
+		return OtherClusters
+	}
+	l.brokenOut.Insert(clusterName)
+	return clusterName
+}
+
+// rotate starts a new window, with the busiest logical clusters of the current one.
+// The logical clusters which are not broken out anymore are evicted.
+func (l *ClusterLabeler) rotate(now time.Time) {
+	l.top = sets.NewString(topClusters(l.counts, l.topN)...)
+	l.counts = map[string]int{}
+	l.windowStart = now
+
+	for _, clusterName := range l.brokenOut.List() {
+		if l.allowed.Has(clusterName) || l.top.Has(clusterName) {
+			continue
+		}
+		if l.evict != nil {
+			l.evict(clusterName)
+		}
+		l.brokenOut.Delete(clusterName)
+	}
+}
+
+// topClusters returns the n logical clusters with the most observations, ties broken
+// by name.
+func topClusters(counts map[string]int, n int) []string {
+	clusterNames := make([]string, 0, len(counts))
+	for clusterName := range counts {
+		clusterNames = append(clusterNames, clusterName)
+	}
+	sort.Slice(clusterNames, func(i, j int) bool {
+		if counts[clusterNames[i]] != counts[clusterNames[j]] {
+			return counts[clusterNames[i]] > counts[clusterNames[j]]
+		}
+		return clusterNames[i] < clusterNames[j]
+	})
+	if len(clusterNames) > n {
+		clusterNames = clusterNames[:n]
+	}
+	return clusterNames
+}
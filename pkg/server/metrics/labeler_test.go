@@ -0,0 +1,81 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClusterLabeler(t *testing.T) {
+	now := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	var evicted []string
+	l := newClusterLabeler([]string{"root"}, 2, func(clusterName string) { evicted = append(evicted, clusterName) }, func() time.Time { return now })
+	label := func(clusterName string) string {
+		var ret string
+		l.Observe(clusterName, func(label string) { ret = label })
+		return ret
+	}
+
+	// the busiest logical clusters are only known after the first window
+	require.Equal(t, "root", label("root"))
+	for _, clusterName := range []string{"root:acme", "root:acme", "root:acme", "root:beta", "root:beta", "root:gamma"} {
+		require.Equal(t, OtherClusters, label(clusterName))
+	}
+
+	now = now.Add(topWindow)
+	require.Equal(t, "root:acme", label("root:acme"))
+	require.Equal(t, "root:beta", label("root:beta"))
+	require.Equal(t, OtherClusters, label("root:gamma"))
+	require.Equal(t, "root", label("root"))
+	for i := 0; i < 3; i++ {
+		require.Equal(t, OtherClusters, label("root:gamma"))
+	}
+	require.Empty(t, evicted)
+
+	// root:beta falls out of the busiest logical clusters, and is evicted
+	now = now.Add(topWindow)
+	require.Equal(t, "root:gamma", label("root:gamma"))
+	require.Equal(t, OtherClusters, label("root:beta"))
+	require.Equal(t, OtherClusters, l.Label("root:beta"))
+	require.Equal(t, "root:acme", l.Label("root:acme"))
+	require.Equal(t, []string{"root:beta"}, evicted)
+}
+
+func TestClusterLabelerWithoutTopN(t *testing.T) {
+	now := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	l := newClusterLabeler([]string{"root"}, 0, nil, func() time.Time { return now })
+	label := func(clusterName string) string {
+		var ret string
+		l.Observe(clusterName, func(label string) { ret = label })
+		return ret
+	}
+
+	require.Equal(t, OtherClusters, label("root:acme"))
+	now = now.Add(topWindow)
+	require.Equal(t, OtherClusters, label("root:acme"))
+	require.Equal(t, "root", label("root"))
+}
+
+func TestTopClusters(t *testing.T) {
+	counts := map[string]int{"root:acme": 3, "root:beta": 5, "root:gamma": 3, "root:delta": 1}
+	require.Equal(t, []string{"root:beta", "root:acme"}, topClusters(counts, 2))
+	require.Equal(t, []string{"root:beta", "root:acme", "root:gamma", "root:delta"}, topClusters(counts, 10))
+	require.Empty(t, topClusters(counts, 0))
+}
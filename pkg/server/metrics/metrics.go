@@ -0,0 +1,218 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/endpoints/responsewriter"
+	compbasemetrics "k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+const (
+	namespace = "kcp"
+	subsystem = "logical_cluster"
+
+	// WildcardCluster is the logical cluster label of the requests across all logical
+	// clusters.
+	WildcardCluster = "*"
+)
+
+var (
+	requestCounter = compbasemetrics.NewCounterVec(
+		&compbasemetrics.CounterOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "requests_total",
+			Help:           "Counter of requests broken out by logical cluster, verb and HTTP response code. Logical clusters which are neither allowed nor among the busiest ones are counted as 'other'.",
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+		[]string{"logical_cluster", "verb", "code"},
+	)
+	requestLatencies = compbasemetrics.NewHistogramVec(
+		&compbasemetrics.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "request_duration_seconds",
+			Help:      "Response latency distribution in seconds of requests, watches excluded, broken out by logical cluster and verb.",
+			Buckets: []float64{0.005, 0.025, 0.05, 0.1, 0.2, 0.4, 0.6, 0.8, 1.0, 1.25, 1.5, 2, 3,
+				4, 5, 6, 8, 10, 15, 20, 30, 45, 60},
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+		[]string{"logical_cluster", "verb"},
+	)
+	errorCounter = compbasemetrics.NewCounterVec(
+		&compbasemetrics.CounterOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "request_errors_total",
+			Help:           "Counter of requests answered with a server error or throttled, broken out by logical cluster and HTTP response code.",
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+		[]string{"logical_cluster", "code"},
+	)
+
+	metrics = []compbasemetrics.Registerable{
+		requestCounter,
+		requestLatencies,
+		errorCounter,
+	}
+)
+
+var registerMetrics sync.Once
+
+// Register registers the logical cluster metrics in the legacy registry, which is
+// served by the apiserver at /metrics.
+func Register() {
+	registerMetrics.Do(func() {
+		for _, metric := range metrics {
+			legacyregistry.MustRegister(metric)
+		}
+	})
+}
+
+// WithLogicalClusterMetrics records the metrics of every request by logical cluster. To
+// bound the cardinality of the logical cluster label, only the allowed logical clusters
+// and the topN other logical clusters with the most requests in the previous minute
+// are broken out, the others are counted as OtherClusters. The series of logical clusters
+// falling out of the busiest ones are deleted. It must be wrapped by the handler
+// setting the logical cluster of requests, and wrap the rest of the handler chain so
+// that requests rejected by authentication or authorization are counted as well.
+func WithLogicalClusterMetrics(handler http.Handler, allowed []string, topN int, requestInfoResolver genericapirequest.RequestInfoResolver) http.Handler {
+	Register()
+	recorder := newRequestRecorder(allowed, topN, time.Now)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		cluster := genericapirequest.ClusterFrom(req.Context())
+		if cluster == nil {
+			handler.ServeHTTP(w, req)
+			return
+		}
+		clusterName := cluster.Name
+		if cluster.Wildcard {
+			clusterName = WildcardCluster
+		}
+
+		verb := ""
+		if requestInfo, err := requestInfoResolver.NewRequestInfo(req); err == nil {
+			verb = requestInfo.Verb
+		}
+
+		start := time.Now()
+		delegate := &responseWriterDelegator{ResponseWriter: w}
+		handler.ServeHTTP(responsewriter.WrapForHTTP1Or2(delegate), req)
+		elapsed := time.Since(start)
+
+		recorder.observe(clusterName, verb, delegate.Status(), elapsed)
+	})
+}
+
+// series are the label values, other than the logical cluster, of the series
+// recorded for a logical cluster.
+type series struct {
+	verb string
+	code string
+}
+
+// requestRecorder records the metrics of requests under the label of their logical
+// cluster, and deletes the series of the logical clusters which are not broken out
+// anymore.
+type requestRecorder struct {
+	labeler *ClusterLabeler
+
+	// recorded are the series recorded per broken out logical cluster. It is only
+	// accessed by the callbacks of the labeler, which hold its lock.
+	recorded map[string]map[series]bool
+}
+
+func newRequestRecorder(allowed []string, topN int, now func() time.Time) *requestRecorder {
+	r := &requestRecorder{
+		recorded: map[string]map[series]bool{},
+	}
+	r.labeler = newClusterLabeler(allowed, topN, r.evict, now)
+	return r
+}
+
+func (r *requestRecorder) observe(clusterName, verb string, status int, elapsed time.Duration) {
+	code := strconv.Itoa(status)
+	r.labeler.Observe(clusterName, func(label string) {
+		if label != OtherClusters {
+			if r.recorded[label] == nil {
+				r.recorded[label] = map[series]bool{}
+			}
+			r.recorded[label][series{verb: verb, code: code}] = true
+		}
+
+		requestCounter.WithLabelValues(label, verb, code).Inc()
+		if verb != "watch" {
+			requestLatencies.WithLabelValues(label, verb).Observe(elapsed.Seconds())
+		}
+		if status >= http.StatusInternalServerError || status == http.StatusTooManyRequests {
+			errorCounter.WithLabelValues(label, code).Inc()
+		}
+	})
+}
+
+func (r *requestRecorder) evict(clusterName string) {
+	for s := range r.recorded[clusterName] {
+		requestCounter.Delete(map[string]string{"logical_cluster": clusterName, "verb": s.verb, "code": s.code})
+		requestLatencies.Delete(map[string]string{"logical_cluster": clusterName, "verb": s.verb})
+		errorCounter.Delete(map[string]string{"logical_cluster": clusterName, "code": s.code})
+	}
+	delete(r.recorded, clusterName)
+}
+
+// responseWriterDelegator records the status code written to the response.
+type responseWriterDelegator struct {
+	http.ResponseWriter
+
+	status      int
+	wroteHeader bool
+}
+
+var _ responsewriter.UserProvidedDecorator = &responseWriterDelegator{}
+
+func (r *responseWriterDelegator) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func (r *responseWriterDelegator) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.status = code
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *responseWriterDelegator) Write(b []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *responseWriterDelegator) Status() int {
+	if !r.wroteHeader {
+		return http.StatusOK
+	}
+	return r.status
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestRecorder(t *testing.T) {
+	now := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	r := newRequestRecorder([]string{"root"}, 1, func() time.Time { return now })
+
+	r.observe("root", "get", 200, time.Millisecond)
+	r.observe("root:acme", "get", 200, time.Millisecond)
+	r.observe("root:acme", "list", 500, time.Millisecond)
+	require.Contains(t, r.recorded, "root")
+	require.NotContains(t, r.recorded, "root:acme")
+
+	now = now.Add(topWindow)
+	r.observe("root:acme", "get", 200, time.Millisecond)
+	r.observe("root:beta", "get", 200, time.Millisecond)
+	r.observe("root:beta", "get", 200, time.Millisecond)
+	require.Equal(t, map[series]bool{{verb: "get", code: "200"}: true}, r.recorded["root:acme"])
+
+	// root:acme falls out of the busiest logical clusters, and its series are forgotten
+	now = now.Add(topWindow)
+	r.observe("root:beta", "get", 200, time.Millisecond)
+	require.NotContains(t, r.recorded, "root:acme")
+	require.Contains(t, r.recorded, "root:beta")
+	require.Contains(t, r.recorded, "root")
+}
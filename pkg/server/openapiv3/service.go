@@ -0,0 +1,381 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openapiv3
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha512"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emicklei/go-restful"
+
+	apiextensionshelpers "k8s.io/apiextensions-apiserver/pkg/apihelpers"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apiextensions-apiserver/pkg/controller/openapi/builder"
+	"k8s.io/apimachinery/pkg/labels"
+	utilcache "k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/klog/v2"
+	"k8s.io/kube-openapi/pkg/builder3"
+	"k8s.io/kube-openapi/pkg/common"
+	"k8s.io/kube-openapi/pkg/handler3"
+	"k8s.io/kube-openapi/pkg/spec3"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+)
+
+const (
+	openAPIV3Path = "/openapi/v3"
+
+	mimeJSON     = "application/json"
+	mimeProtobuf = "application/com.github.proto-openapi.spec.v3@v1.0+protobuf"
+
+	// crdSpecCacheSize is the number of CRD versions whose spec is cached. The shadow CRDs of
+	// bound APIResourceSchemas are shared by the workspaces binding them, and so are their specs.
+	crdSpecCacheSize = 1024
+)
+
+// CRDLister lists the CustomResourceDefinitions served in the logical cluster of a context,
+// i.e. its own, inherited and bound ones.
+type CRDLister interface {
+	ListWithContext(ctx context.Context, selector labels.Selector) ([]*apiextensionsv1.CustomResourceDefinition, error)
+}
+
+// Service serves the OpenAPI v3 of workspaces: the paths of their group versions at
+// /openapi/v3, and the spec of each of them at /openapi/v3/<path>, e.g. /openapi/v3/api/v1
+// or /openapi/v3/apis/apps/v1.
+//
+// The spec of a group version merges the built-in types with the served versions of the
+// established CRDs of the workspace, including the shadow CRDs of its bound resources. The
+// specs of CRD versions are built once per resource version and shared by the workspaces,
+// and the spec of a group version of a workspace is only rebuilt when the CRDs contributing
+// to it change.
+type Service struct {
+	crds        CRDLister
+	idleTimeout time.Duration
+
+	// static are the group versions of the built-in types, by path.
+	static map[string]*groupVersion
+
+	// crdSpecs are the specs of CRD versions, by crdSpecKey.
+	crdSpecs *utilcache.LRUExpireCache
+	// workspaces are the *workspace of logical clusters, by logical cluster name.
+	workspaces *utilcache.LRUExpireCache
+	// lock serializes the creation of workspaces.
+	lock sync.Mutex
+}
+
+// groupVersion is the spec of a group version, encoded.
+type groupVersion struct {
+	spec *spec3.OpenAPI
+	// fingerprint identifies the CRD versions the spec was built from.
+	fingerprint  string
+	lastModified time.Time
+
+	json, protobuf         []byte
+	jsonETag, protobufETag string
+}
+
+// workspace are the group versions of a logical cluster with CRDs, by path.
+type workspace struct {
+	lock          sync.Mutex
+	groupVersions map[string]*groupVersion
+}
+
+// crdVersion is a served version of a CRD.
+type crdVersion struct {
+	crd     *apiextensionsv1.CustomResourceDefinition
+	version string
+}
+
+// NewService returns a Service caching the specs of at most maxWorkspaces workspaces, each
+// for idleTimeout after its last request. The types it serves are added by Install.
+func NewService(maxWorkspaces int, idleTimeout time.Duration) *Service {
+	return &Service{
+		idleTimeout: idleTimeout,
+		static:      map[string]*groupVersion{},
+		crdSpecs:    utilcache.NewLRUExpireCache(crdSpecCacheSize),
+		workspaces:  utilcache.NewLRUExpireCache(maxWorkspaces),
+	}
+}
+
+// Install serves the CRDs listed by crds, and builds the group versions of the built-in
+// types served by the given web services, shared by all workspaces. It must be called
+// before serving, once the server chain is created.
+func (s *Service) Install(crds CRDLister, webServices []*restful.WebService, config *common.Config) error {
+	s.crds = crds
+	for _, ws := range webServices {
+		// the root path of a web service is the path of its group version, e.g. /apis/apps/v1
+		path := strings.TrimPrefix(ws.RootPath(), "/")
+		openAPI, err := builder3.BuildOpenAPISpec([]*restful.WebService{ws}, config)
+		if err != nil {
+			return fmt.Errorf("failed to build the OpenAPI v3 of %s: %w", path, err)
+		}
+		gv, err := newGroupVersion(openAPI, "")
+		if err != nil {
+			return err
+		}
+		s.static[path] = gv
+	}
+	return nil
+}
+
+// WithOpenAPIV3 serves the OpenAPI v3 of the logical cluster of the request. Any other
+// request is passed to apiHandler.
+func (s *Service) WithOpenAPIV3(apiHandler http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		cluster := request.ClusterFrom(req.Context())
+		if s.crds == nil || cluster == nil || cluster.Wildcard || (req.Method != http.MethodGet && req.Method != http.MethodHead) {
+			apiHandler.ServeHTTP(w, req)
+			return
+		}
+		path := strings.TrimSuffix(req.URL.Path, "/")
+		if path != openAPIV3Path && !strings.HasPrefix(path, openAPIV3Path+"/") {
+			apiHandler.ServeHTTP(w, req)
+			return
+		}
+
+		crds, err := s.crds.ListWithContext(req.Context(), labels.Everything())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		contributing := crdVersionsByPath(crds)
+
+		if path == openAPIV3Path {
+			s.serveDiscovery(w, req, contributing)
+			return
+		}
+		s.serveGroupVersion(w, req, cluster.Name, strings.TrimPrefix(path, openAPIV3Path+"/"), contributing)
+	}
+}
+
+// serveDiscovery serves the paths of the group versions of the workspace.
+func (s *Service) serveDiscovery(w http.ResponseWriter, req *http.Request, contributing map[string][]crdVersion) {
+	paths := make([]string, 0, len(s.static)+len(contributing))
+	for path := range s.static {
+		paths = append(paths, path)
+	}
+	for path := range contributing {
+		if _, found := s.static[path]; !found {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	data, err := json.Marshal(map[string][]string{"Paths": paths})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", mimeJSON)
+	w.Header().Set("Etag", computeETag(data))
+	http.ServeContent(w, req, openAPIV3Path, time.Time{}, bytes.NewReader(data))
+}
+
+// serveGroupVersion serves the spec of the group version at the given path in the
+// workspace, rebuilding it if its CRDs changed.
+func (s *Service) serveGroupVersion(w http.ResponseWriter, req *http.Request, clusterName, path string, contributing map[string][]crdVersion) {
+	static, isStatic := s.static[path]
+	versions, isCRD := contributing[path]
+
+	var gv *groupVersion
+	switch {
+	case isCRD:
+		var err error
+		if gv, err = s.groupVersion(clusterName, path, static, versions); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	case isStatic:
+		gv = static
+	default:
+		http.NotFound(w, req)
+		return
+	}
+
+	w.Header().Add("Vary", "Accept")
+	data, contentType, etag := gv.json, mimeJSON, gv.jsonETag
+	if strings.Contains(req.Header.Get("Accept"), mimeProtobuf) {
+		data, contentType, etag = gv.protobuf, mimeProtobuf, gv.protobufETag
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Etag", etag)
+	http.ServeContent(w, req, "", gv.lastModified, bytes.NewReader(data))
+}
+
+// groupVersion returns the spec of the group version at the given path in the workspace,
+// merging the given static spec with the given CRD versions. It is only rebuilt if the
+// CRD versions differ from the ones of the cached spec.
+func (s *Service) groupVersion(clusterName, path string, static *groupVersion, versions []crdVersion) (*groupVersion, error) {
+	ws := s.workspace(clusterName)
+	fingerprint := fingerprintOf(versions)
+
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	if gv, found := ws.groupVersions[path]; found && gv.fingerprint == fingerprint {
+		return gv, nil
+	}
+
+	specs := make([]*spec3.OpenAPI, 0, len(versions)+1)
+	if static != nil {
+		specs = append(specs, static.spec)
+	}
+	for _, v := range versions {
+		if openAPI := s.crdSpec(v); openAPI != nil {
+			specs = append(specs, openAPI)
+		}
+	}
+	gv, err := newGroupVersion(mergeSpecs(specs...), fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	ws.groupVersions[path] = gv
+	return gv, nil
+}
+
+// workspace returns the cached group versions of the given logical cluster, postponing
+// its idle eviction.
+func (s *Service) workspace(clusterName string) *workspace {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ws := &workspace{groupVersions: map[string]*groupVersion{}}
+	if cached, found := s.workspaces.Get(clusterName); found {
+		ws = cached.(*workspace)
+	}
+	s.workspaces.Add(clusterName, ws, s.idleTimeout)
+	return ws
+}
+
+// crdSpec returns the spec of the given CRD version, or nil if it cannot be built.
+func (s *Service) crdSpec(v crdVersion) *spec3.OpenAPI {
+	key := crdSpecKey(v)
+	if cached, found := s.crdSpecs.Get(key); found {
+		return cached.(*spec3.OpenAPI)
+	}
+	openAPI, err := builder.BuildOpenAPIV3(v.crd, v.version, builder.Options{V2: false})
+	if err != nil {
+		klog.Errorf("failed to build the OpenAPI v3 of CRD %s|%s version %s: %v", v.crd.ClusterName, v.crd.Name, v.version, err)
+		return nil
+	}
+	s.crdSpecs.Add(key, openAPI, s.idleTimeout)
+	return openAPI
+}
+
+// crdVersionsByPath returns the served versions of the established CRDs by the path of their
+// group version, sorted.
+func crdVersionsByPath(crds []*apiextensionsv1.CustomResourceDefinition) map[string][]crdVersion {
+	ret := map[string][]crdVersion{}
+	for _, crd := range crds {
+		if !apiextensionshelpers.IsCRDConditionTrue(crd, apiextensionsv1.Established) {
+			continue
+		}
+		for _, v := range crd.Spec.Versions {
+			if !v.Served {
+				continue
+			}
+			path := groupVersionPath(crd.Spec.Group, v.Name)
+			ret[path] = append(ret[path], crdVersion{crd: crd, version: v.Name})
+		}
+	}
+	for _, versions := range ret {
+		sort.Slice(versions, func(i, j int) bool {
+			return versions[i].crd.Name < versions[j].crd.Name
+		})
+	}
+	return ret
+}
+
+// groupVersionPath returns the path of the given group version, relative to /openapi/v3.
+// CRDs of the core group are served next to the built-in types of the core group.
+func groupVersionPath(group, version string) string {
+	if group == "" {
+		return "api/" + version
+	}
+	return "apis/" + group + "/" + version
+}
+
+// crdSpecKey identifies the spec of a CRD version. The UID and resource version change
+// with any change of the CRD.
+func crdSpecKey(v crdVersion) string {
+	return string(v.crd.UID) + "/" + v.crd.ResourceVersion + "/" + v.version
+}
+
+func fingerprintOf(versions []crdVersion) string {
+	keys := make([]string, 0, len(versions))
+	for _, v := range versions {
+		keys = append(keys, crdSpecKey(v))
+	}
+	return strings.Join(keys, ",")
+}
+
+// mergeSpecs merges the paths and schemas of the given specs into a new spec. Conflicting
+// schemas are the same shared types, e.g. ObjectMeta, and are not reported.
+func mergeSpecs(specs ...*spec3.OpenAPI) *spec3.OpenAPI {
+	merged := &spec3.OpenAPI{
+		Paths:      &spec3.Paths{Paths: map[string]*spec3.Path{}},
+		Components: &spec3.Components{Schemas: map[string]*spec.Schema{}},
+	}
+	for _, s := range specs {
+		if merged.Version == "" {
+			merged.Version = s.Version
+			merged.Info = s.Info
+		}
+		if s.Paths != nil {
+			for k, v := range s.Paths.Paths {
+				merged.Paths.Paths[k] = v
+			}
+		}
+		if s.Components != nil {
+			for k, v := range s.Components.Schemas {
+				merged.Components.Schemas[k] = v
+			}
+		}
+	}
+	return merged
+}
+
+func newGroupVersion(openAPI *spec3.OpenAPI, fingerprint string) (*groupVersion, error) {
+	data, err := json.Marshal(openAPI)
+	if err != nil {
+		return nil, err
+	}
+	pb, err := handler3.ToV3ProtoBinary(data)
+	if err != nil {
+		return nil, err
+	}
+	return &groupVersion{
+		spec:         openAPI,
+		fingerprint:  fingerprint,
+		lastModified: time.Now(),
+		json:         data,
+		protobuf:     pb,
+		jsonETag:     computeETag(data),
+		protobufETag: computeETag(pb),
+	}, nil
+}
+
+func computeETag(data []byte) string {
+	return fmt.Sprintf("\"%X\"", sha512.Sum512(data))
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openapiv3
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apiserver/pkg/endpoints/request"
+)
+
+type fakeCRDLister map[string][]*apiextensionsv1.CustomResourceDefinition
+
+func (l fakeCRDLister) ListWithContext(ctx context.Context, _ labels.Selector) ([]*apiextensionsv1.CustomResourceDefinition, error) {
+	return l[request.ClusterFrom(ctx).Name], nil
+}
+
+func newCRD(uid, resourceVersion string, established bool) *apiextensionsv1.CustomResourceDefinition {
+	status := apiextensionsv1.ConditionFalse
+	if established {
+		status = apiextensionsv1.ConditionTrue
+	}
+	return &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "widgets.today.dev", UID: types.UID(uid), ResourceVersion: resourceVersion},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: "today.dev",
+			Names: apiextensionsv1.CustomResourceDefinitionNames{Plural: "widgets", Singular: "widget", Kind: "Widget", ListKind: "WidgetList"},
+			Scope: apiextensionsv1.NamespaceScoped,
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{
+					Name:    "v1",
+					Served:  true,
+					Storage: true,
+					Schema: &apiextensionsv1.CustomResourceValidation{OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
+						Type: "object",
+						Properties: map[string]apiextensionsv1.JSONSchemaProps{
+							"spec": {Type: "object", Properties: map[string]apiextensionsv1.JSONSchemaProps{"size": {Type: "integer"}}},
+						},
+					}},
+				},
+				{Name: "v2", Served: false},
+			},
+		},
+		Status: apiextensionsv1.CustomResourceDefinitionStatus{
+			Conditions: []apiextensionsv1.CustomResourceDefinitionCondition{{Type: apiextensionsv1.Established, Status: status}},
+		},
+	}
+}
+
+func TestWithOpenAPIV3(t *testing.T) {
+	crds := fakeCRDLister{
+		"org:provider": {newCRD("provider", "1", true)},
+		// the same shadow CRD bound in the consumer workspace
+		"org:consumer": {newCRD("provider", "1", true)},
+		"org:pending":  {newCRD("pending", "1", false)},
+	}
+	s := NewService(10, time.Minute)
+	require.NoError(t, s.Install(crds, nil, nil))
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	serve := func(clusterName, path string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		req = req.WithContext(request.WithCluster(req.Context(), request.Cluster{Name: clusterName}))
+		w := httptest.NewRecorder()
+		s.WithOpenAPIV3(next).ServeHTTP(w, req)
+		return w
+	}
+	discovery := func(clusterName string) []string {
+		w := serve(clusterName, "/openapi/v3", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var paths map[string][]string
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &paths))
+		return paths["Paths"]
+	}
+
+	require.Equal(t, []string{"apis/today.dev/v1"}, discovery("org:provider"))
+	require.Equal(t, []string{"apis/today.dev/v1"}, discovery("org:consumer"))
+	require.Empty(t, discovery("org:pending"), "CRDs not established yet are not published")
+
+	w := serve("org:provider", "/openapi/v3/apis/today.dev/v1", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	require.Contains(t, w.Body.String(), "/apis/today.dev/v1/namespaces/{namespace}/widgets")
+	etag := w.Header().Get("Etag")
+	require.NotEmpty(t, etag)
+
+	w = serve("org:provider", "/openapi/v3/apis/today.dev/v1", http.Header{"If-None-Match": {etag}})
+	require.Equal(t, http.StatusNotModified, w.Code)
+
+	w = serve("org:provider", "/openapi/v3/apis/today.dev/v1", http.Header{"Accept": {mimeProtobuf}})
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, mimeProtobuf, w.Header().Get("Content-Type"))
+
+	w = serve("org:consumer", "/openapi/v3/apis/today.dev/v1", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, etag, w.Header().Get("Etag"))
+	require.Len(t, s.crdSpecs.Keys(), 1, "the spec of the shared CRD is built once")
+
+	require.Equal(t, http.StatusNotFound, serve("org:pending", "/openapi/v3/apis/today.dev/v1", nil).Code)
+	require.Equal(t, http.StatusNotFound, serve("org:provider", "/openapi/v3/apis/other.dev/v1", nil).Code)
+	require.Equal(t, http.StatusTeapot, serve("org:provider", "/openapi/v2", nil).Code)
+
+	// updating the CRD rebuilds the spec of its group version
+	crds["org:provider"] = []*apiextensionsv1.CustomResourceDefinition{newCRD("provider", "2", true)}
+	crds["org:provider"][0].Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["spec"].Properties["color"] = apiextensionsv1.JSONSchemaProps{Type: "string"}
+	w = serve("org:provider", "/openapi/v3/apis/today.dev/v1", http.Header{"If-None-Match": {etag}})
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NotEqual(t, etag, w.Header().Get("Etag"))
+	require.Contains(t, w.Body.String(), "color")
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package options
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+
+	kcpadmission "github.com/kcp-dev/kcp/pkg/admission"
+)
+
+type Admission struct {
+	// PluginOrder is the order of the kcp admission plugins and of the admission webhooks.
+	// Whether they are enabled is given by --enable-admission-plugins and
+	// --disable-admission-plugins.
+	PluginOrder []string
+}
+
+func NewAdmission() *Admission {
+	return &Admission{
+		PluginOrder: append([]string(nil), kcpadmission.DefaultKcpPluginOrder...),
+	}
+}
+
+func (a *Admission) AddFlags(fs *pflag.FlagSet) {
+	fs.StringSliceVar(&a.PluginOrder, "kcp-admission-plugin-order", a.PluginOrder,
+		"Order the kcp admission plugins and the admission webhooks of the workspaces are called in, comma separated. "+
+			"Every plugin must be listed once. The mutating kcp plugins must be ordered before MutatingAdmissionWebhook, "+
+			"which must be ordered before ValidatingAdmissionWebhook, and both before apis.kcp.dev/APIExportWebhooks. "+
+			"Whether a plugin is enabled is given by --enable-admission-plugins and --disable-admission-plugins.")
+}
+
+func (a *Admission) Validate() []error {
+	var errs []error
+	for _, err := range kcpadmission.ValidatePluginOrder(a.PluginOrder) {
+		errs = append(errs, fmt.Errorf("--kcp-admission-plugin-order: %w", err))
+	}
+	return errs
+}
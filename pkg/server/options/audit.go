@@ -0,0 +1,58 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package options
+
+import (
+	"github.com/spf13/pflag"
+
+	genericapiserver "k8s.io/apiserver/pkg/server"
+
+	kcpaudit "github.com/kcp-dev/kcp/pkg/audit"
+)
+
+type OrganizationAudit struct {
+	// PolicyDir is the directory holding the audit policies of organizations.
+	PolicyDir string
+}
+
+func NewOrganizationAudit() *OrganizationAudit {
+	return &OrganizationAudit{}
+}
+
+func (s *OrganizationAudit) AddFlags(fs *pflag.FlagSet) {
+	if s == nil {
+		return
+	}
+
+	fs.StringVar(&s.PolicyDir, "audit-organization-policy-dir", s.PolicyDir,
+		"Directory holding audit policies overriding the --audit-policy-file policy for the workspaces of organizations, "+
+			"in files named <organization>.yaml. They can lower the level of the events of an organization, but not raise it.")
+}
+
+// ApplyTo wraps the audit backend of the config with one applying the audit policies
+// of organizations.
+func (s *OrganizationAudit) ApplyTo(config *genericapiserver.Config) error {
+	if s.PolicyDir == "" || config.AuditBackend == nil {
+		return nil
+	}
+	evaluators, err := kcpaudit.LoadOrganizationPolicies(s.PolicyDir)
+	if err != nil {
+		return err
+	}
+	config.AuditBackend = kcpaudit.NewOrganizationPolicyBackend(config.AuditBackend, evaluators)
+	return nil
+}
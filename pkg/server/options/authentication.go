@@ -23,6 +23,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/spf13/pflag"
@@ -30,10 +31,15 @@ import (
 	"k8s.io/apiserver/pkg/authentication/authenticator"
 	"k8s.io/apiserver/pkg/authentication/request/bearertoken"
 	authenticatorunion "k8s.io/apiserver/pkg/authentication/request/union"
+	"k8s.io/apiserver/pkg/authentication/request/x509"
 	"k8s.io/apiserver/pkg/authentication/user"
 	genericapiserver "k8s.io/apiserver/pkg/server"
+	"k8s.io/apiserver/pkg/server/dynamiccertificates"
 	"k8s.io/client-go/tools/clientcmd"
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+
+	"github.com/kcp-dev/kcp/pkg/authentication"
+	tenancylisters "github.com/kcp-dev/kcp/pkg/client/listers/tenancy/v1alpha1"
 )
 
 type AdminAuthentication struct {
@@ -135,6 +141,183 @@ func (s *AdminAuthentication) WriteKubeConfig(config *genericapiserver.Config, n
 	return clientcmd.WriteToFile(*externalKubeConfig, s.KubeConfigPath)
 }
 
+type SyncerAuthentication struct {
+	// TokenKeyFilePath is the file holding the key signing the tokens of the syncers.
+	TokenKeyFilePath string
+}
+
+func NewSyncerAuthentication() *SyncerAuthentication {
+	return &SyncerAuthentication{
+		TokenKeyFilePath: ".syncer-token-key",
+	}
+}
+
+func (s *SyncerAuthentication) AddFlags(fs *pflag.FlagSet) {
+	if s == nil {
+		return
+	}
+
+	fs.StringVar(&s.TokenKeyFilePath, "authentication-syncer-token-key-path", s.TokenKeyFilePath,
+		"Path to the key signing the tokens of the syncers, generated at startup if missing. If this is relative, it is relative to --root-directory.")
+}
+
+// ApplyTo adds the authenticator of the syncer tokens to the config, and returns the
+// SyncerTokens issuing them.
+func (s *SyncerAuthentication) ApplyTo(config *genericapiserver.Config) (*authentication.SyncerTokens, error) {
+	key, err := authentication.LoadOrCreateTokenKey(s.TokenKeyFilePath)
+	if err != nil {
+		return nil, err
+	}
+	tokens := authentication.NewSyncerTokens(key)
+
+	config.Authentication.Authenticator = authenticatorunion.New(
+		bearertoken.New(authenticator.WrapAudienceAgnosticToken(config.Authentication.APIAudiences, tokens)),
+		config.Authentication.Authenticator,
+	)
+	return tokens, nil
+}
+
+type WorkspaceTokenAuthentication struct {
+	// TokenKeyFilePath is the file holding the key signing the workspace tokens.
+	TokenKeyFilePath string
+	// MaxExpiration is the maximum lifetime of workspace tokens.
+	MaxExpiration time.Duration
+}
+
+func NewWorkspaceTokenAuthentication() *WorkspaceTokenAuthentication {
+	return &WorkspaceTokenAuthentication{
+		TokenKeyFilePath: ".workspace-token-key",
+		MaxExpiration:    24 * time.Hour,
+	}
+}
+
+func (s *WorkspaceTokenAuthentication) AddFlags(fs *pflag.FlagSet) {
+	if s == nil {
+		return
+	}
+
+	fs.StringVar(&s.TokenKeyFilePath, "authentication-workspace-token-key-path", s.TokenKeyFilePath,
+		"Path to the key signing the workspace tokens of generated kubeconfigs, generated at startup if missing. If this is relative, it is relative to --root-directory.")
+	fs.DurationVar(&s.MaxExpiration, "authentication-workspace-token-max-expiration", s.MaxExpiration,
+		"Maximum lifetime of the workspace tokens of generated kubeconfigs.")
+}
+
+// ApplyTo adds the authenticator of the workspace tokens to the config, and returns
+// the WorkspaceTokens issuing them. Tokens are checked against the ClusterWorkspaces
+// of the given lister.
+func (s *WorkspaceTokenAuthentication) ApplyTo(config *genericapiserver.Config, workspaceLister tenancylisters.ClusterWorkspaceLister) (*authentication.WorkspaceTokens, error) {
+	key, err := authentication.LoadOrCreateTokenKey(s.TokenKeyFilePath)
+	if err != nil {
+		return nil, err
+	}
+	tokens := authentication.NewWorkspaceTokens(key, workspaceLister)
+
+	config.Authentication.Authenticator = authenticatorunion.New(
+		bearertoken.New(authenticator.WrapAudienceAgnosticToken(config.Authentication.APIAudiences, tokens)),
+		config.Authentication.Authenticator,
+	)
+	return tokens, nil
+}
+
+type ClientCertAuthentication struct {
+	// UsernameAttribute is the subject attribute of client certificates the username is taken from.
+	UsernameAttribute string
+	// GroupAttributes are the subject attributes of client certificates whose values are groups.
+	GroupAttributes []string
+	// GroupMappings map subject attribute values of client certificates to groups, in the
+	// format <attribute>:<value>=<group>.
+	GroupMappings []string
+
+	// ClientCAFile is the CA of the client certificates mapped as configured, taken over
+	// from the built-in authenticators when completing the options with a mapping other
+	// than the default one.
+	ClientCAFile string
+}
+
+func NewClientCertAuthentication() *ClientCertAuthentication {
+	return &ClientCertAuthentication{
+		UsernameAttribute: authentication.AttributeCommonName,
+		GroupAttributes:   []string{authentication.AttributeOrganization},
+	}
+}
+
+func (s *ClientCertAuthentication) AddFlags(fs *pflag.FlagSet) {
+	if s == nil {
+		return
+	}
+
+	fs.StringVar(&s.UsernameAttribute, "authentication-client-cert-username-attribute", s.UsernameAttribute,
+		"Subject attribute of the client certificates signed by --client-ca-file the username is taken from. One of CN, O, OU, SERIALNUMBER, L, C.")
+	fs.StringSliceVar(&s.GroupAttributes, "authentication-client-cert-group-attributes", s.GroupAttributes,
+		"Subject attributes of the client certificates signed by --client-ca-file whose values are groups of the user. Any of CN, O, OU, SERIALNUMBER, L, C.")
+	fs.StringSliceVar(&s.GroupMappings, "authentication-client-cert-group-mappings", s.GroupMappings,
+		"Groups the subject attribute values of the client certificates signed by --client-ca-file are mapped to, comma separated. "+
+			"The individual mapping format: attribute:value=group, e.g. OU:platform=system:kcp:platform-admins. A mapped value is "+
+			"replaced by its groups, also for attributes not in --authentication-client-cert-group-attributes.")
+}
+
+func (s *ClientCertAuthentication) Validate() []error {
+	if s == nil {
+		return nil
+	}
+
+	mapping, err := s.mapping()
+	if err != nil {
+		return []error{err}
+	}
+	if err := mapping.Validate(); err != nil {
+		return []error{err}
+	}
+	return nil
+}
+
+func (s *ClientCertAuthentication) mapping() (*authentication.ClientCertMapping, error) {
+	groupMappings, err := authentication.ParseGroupMappings(s.GroupMappings)
+	if err != nil {
+		return nil, err
+	}
+	return &authentication.ClientCertMapping{
+		UsernameAttribute: s.UsernameAttribute,
+		GroupAttributes:   s.GroupAttributes,
+		GroupMappings:     groupMappings,
+	}, nil
+}
+
+// IsDefault returns whether the mapping is the default one of the built-in authenticators,
+// mapping the common name to the username and the organizations to groups.
+func (s *ClientCertAuthentication) IsDefault() bool {
+	mapping, err := s.mapping()
+	return err == nil && mapping.IsDefault()
+}
+
+// ApplyTo trusts the client certificates signed by ClientCAFile, and adds an authenticator
+// mapping their subject to users as configured. The built-in authenticators do not know
+// about ClientCAFile, such that they do not authenticate these certificates with the default
+// mapping. Nothing is added without ClientCAFile.
+func (s *ClientCertAuthentication) ApplyTo(config *genericapiserver.Config) error {
+	if s.ClientCAFile == "" {
+		return nil
+	}
+	mapping, err := s.mapping()
+	if err != nil {
+		return err
+	}
+	clientCA, err := dynamiccertificates.NewDynamicCAContentFromFile("client-ca-bundle", s.ClientCAFile)
+	if err != nil {
+		return fmt.Errorf("unable to load client CA file %q: %w", s.ClientCAFile, err)
+	}
+	// the CA is reloaded by the secure serving once it trusts it
+	if err := config.Authentication.ApplyClientCert(clientCA, config.SecureServing); err != nil {
+		return err
+	}
+
+	config.Authentication.Authenticator = authenticatorunion.New(
+		x509.NewDynamic(clientCA.VerifyOptions, mapping),
+		config.Authentication.Authenticator,
+	)
+	return nil
+}
+
 func createKubeConfig(adminUserName, adminBearerToken, baseHost, tlsServerName string, caData []byte) *clientcmdapi.Config {
 	var kubeConfig clientcmdapi.Config
 	//Create Client and Shared
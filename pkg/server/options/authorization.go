@@ -17,6 +17,9 @@ limitations under the License.
 package options
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/spf13/pflag"
 
 	"k8s.io/apiserver/pkg/authorization/authorizer"
@@ -24,6 +27,8 @@ import (
 	"k8s.io/apiserver/pkg/authorization/path"
 	"k8s.io/apiserver/pkg/authorization/union"
 	genericapiserver "k8s.io/apiserver/pkg/server"
+	genericoptions "k8s.io/apiserver/pkg/server/options"
+	"k8s.io/apiserver/plugin/pkg/authorizer/webhook"
 	coreexternalversions "k8s.io/client-go/informers"
 
 	"github.com/kcp-dev/kcp/pkg/authorization"
@@ -37,6 +42,16 @@ type Authorization struct {
 
 	// AlwaysAllowGroups are groups which are allowed to take any actions.  In kube, this is system:masters.
 	AlwaysAllowGroups []string
+
+	// WebhookConfigFile is a kubeconfig file of an external authorization webhook. The
+	// logical cluster and workspace path of a request are passed in the SubjectAccessReview extras.
+	WebhookConfigFile string
+	// WebhookVersion is the API version of the SubjectAccessReviews sent to the webhook.
+	WebhookVersion string
+	// WebhookCacheAuthorizedTTL is the duration to cache authorized responses of the webhook.
+	WebhookCacheAuthorizedTTL time.Duration
+	// WebhookCacheUnauthorizedTTL is the duration to cache unauthorized responses of the webhook.
+	WebhookCacheUnauthorizedTTL time.Duration
 }
 
 func NewAuthorization() *Authorization {
@@ -45,6 +60,10 @@ func NewAuthorization() *Authorization {
 		// This field can be cleared by callers if they don't want this behavior.
 		AlwaysAllowPaths:  []string{"/healthz", "/readyz", "/livez"},
 		AlwaysAllowGroups: []string{"system:masters"},
+
+		WebhookVersion:              "v1beta1",
+		WebhookCacheAuthorizedTTL:   5 * time.Minute,
+		WebhookCacheUnauthorizedTTL: 30 * time.Second,
 	}
 }
 
@@ -67,6 +86,10 @@ func (s *Authorization) Validate() []error {
 
 	allErrors := []error{}
 
+	if s.WebhookConfigFile != "" && s.WebhookVersion != "v1" && s.WebhookVersion != "v1beta1" {
+		allErrors = append(allErrors, fmt.Errorf("--authorization-webhook-version must be v1 or v1beta1, got %q", s.WebhookVersion))
+	}
+
 	return allErrors
 }
 
@@ -78,6 +101,17 @@ func (s *Authorization) AddFlags(fs *pflag.FlagSet) {
 	fs.StringSliceVar(&s.AlwaysAllowPaths, "authorization-always-allow-paths", s.AlwaysAllowPaths,
 		"A list of HTTP paths to skip during authorization, i.e. these are authorized without "+
 			"contacting the 'core' kubernetes server.")
+
+	fs.StringVar(&s.WebhookConfigFile, "authorization-webhook-config-file", s.WebhookConfigFile,
+		"File with webhook configuration in kubeconfig format, consulted for every workspace "+
+			"before the workspace RBAC. The logical cluster and the workspace path of the request "+
+			"are passed in the SubjectAccessReview extras.")
+	fs.StringVar(&s.WebhookVersion, "authorization-webhook-version", s.WebhookVersion,
+		"The API version of the authorization.k8s.io SubjectAccessReview to send to and expect from the webhook.")
+	fs.DurationVar(&s.WebhookCacheAuthorizedTTL, "authorization-webhook-cache-authorized-ttl", s.WebhookCacheAuthorizedTTL,
+		"The duration to cache 'authorized' responses from the webhook authorizer.")
+	fs.DurationVar(&s.WebhookCacheUnauthorizedTTL, "authorization-webhook-cache-unauthorized-ttl", s.WebhookCacheUnauthorizedTTL,
+		"The duration to cache 'unauthorized' responses from the webhook authorizer.")
 }
 
 func (s *Authorization) ApplyTo(config *genericapiserver.Config, informer coreexternalversions.SharedInformerFactory, workspaceLister v1alpha1.ClusterWorkspaceLister) error {
@@ -100,6 +134,21 @@ func (s *Authorization) ApplyTo(config *genericapiserver.Config, informer coreex
 	// kcp authorizers
 	bootstrapAuth, bootstrapRules := authorization.NewBootstrapPolicyAuthorizer(informer)
 	localAuth, localResolver := authorization.NewLocalAuthorizer(informer)
+	authorizers = append(authorizers, authorization.NewSyncerScopeAuthorizer())
+	authorizers = append(authorizers, authorization.NewWorkspaceTokenAuthorizer(union.New(bootstrapAuth, localAuth)))
+	authorizers = append(authorizers, authorization.NewSystemComponentAuthorizer(bootstrapAuth))
+	authorizers = append(authorizers, authorization.NewImpersonationAuthorizer(bootstrapAuth, localAuth))
+	authorizers = append(authorizers, authorization.NewWildcardAuthorizer(bootstrapAuth))
+
+	// external authorizer consulted for every workspace, with logical cluster context
+	if s.WebhookConfigFile != "" {
+		webhookAuth, err := webhook.New(s.WebhookConfigFile, s.WebhookVersion, s.WebhookCacheAuthorizedTTL, s.WebhookCacheUnauthorizedTTL, *genericoptions.DefaultAuthWebhookRetryBackoff(), nil)
+		if err != nil {
+			return err
+		}
+		authorizers = append(authorizers, authorization.WithLogicalClusterExtra(webhookAuth))
+	}
+
 	authorizers = append(authorizers, authorization.NewWorkspaceContentAuthorizer(
 		informer,
 		workspaceLister,
@@ -21,7 +21,13 @@ import (
 
 	"github.com/kcp-dev/kcp/pkg/reconciler/apiresource"
 	"github.com/kcp-dev/kcp/pkg/reconciler/cluster/apiimporter"
+	"github.com/kcp-dev/kcp/pkg/reconciler/cluster/heartbeat"
 	"github.com/kcp-dev/kcp/pkg/reconciler/cluster/syncer"
+	"github.com/kcp-dev/kcp/pkg/reconciler/namespace"
+	"github.com/kcp-dev/kcp/pkg/reconciler/shardregistration"
+	"github.com/kcp-dev/kcp/pkg/reconciler/workspacedeletion"
+	"github.com/kcp-dev/kcp/pkg/reconciler/workspaceresourcequota"
+	"github.com/kcp-dev/kcp/pkg/reconciler/workspaceusage"
 )
 
 type Controllers struct {
@@ -30,11 +36,23 @@ type Controllers struct {
 	ApiImporter         ApiImporterController
 	ApiResource         ApiResourceController
 	Syncer              SyncerController
+	SyncerHeartbeat     SyncerHeartbeatController
+	NamespaceScheduler  NamespaceSchedulerController
+	WorkspaceUsage      WorkspaceUsageController
+	WorkspaceDeletion   WorkspaceDeletionController
+	WorkspaceQuota      WorkspaceQuotaController
+	ShardRegistration   ShardRegistrationController
 }
 
 type ApiImporterController = apiimporter.Options
 type ApiResourceController = apiresource.Options
 type SyncerController = syncer.Options
+type SyncerHeartbeatController = heartbeat.Options
+type NamespaceSchedulerController = namespace.Options
+type WorkspaceUsageController = workspaceusage.Options
+type WorkspaceDeletionController = workspacedeletion.Options
+type WorkspaceQuotaController = workspaceresourcequota.Options
+type ShardRegistrationController = shardregistration.Options
 
 func NewControllers() *Controllers {
 	return &Controllers{
@@ -43,6 +61,13 @@ func NewControllers() *Controllers {
 		ApiImporter: *apiimporter.DefaultOptions(),
 		ApiResource: *apiresource.DefaultOptions(),
 		Syncer:      *syncer.DefaultOptions(),
+
+		SyncerHeartbeat:    *heartbeat.DefaultOptions(),
+		NamespaceScheduler: *namespace.DefaultOptions(),
+		WorkspaceUsage:     *workspaceusage.DefaultOptions(),
+		WorkspaceDeletion:  *workspacedeletion.DefaultOptions(),
+		WorkspaceQuota:     *workspaceresourcequota.DefaultOptions(),
+		ShardRegistration:  *shardregistration.DefaultOptions(),
 	}
 }
 
@@ -55,6 +80,12 @@ func (c *Controllers) AddFlags(fs *pflag.FlagSet) {
 	apiimporter.BindOptions(&c.ApiImporter, fs)
 	apiresource.BindOptions(&c.ApiResource, fs)
 	syncer.BindOptions(&c.Syncer, fs)
+	heartbeat.BindOptions(&c.SyncerHeartbeat, fs)
+	namespace.BindOptions(&c.NamespaceScheduler, fs)
+	workspaceusage.BindOptions(&c.WorkspaceUsage, fs)
+	workspacedeletion.BindOptions(&c.WorkspaceDeletion, fs)
+	workspaceresourcequota.BindOptions(&c.WorkspaceQuota, fs)
+	shardregistration.BindOptions(&c.ShardRegistration, fs)
 }
 
 func (c *Controllers) Validate() []error {
@@ -69,6 +100,24 @@ func (c *Controllers) Validate() []error {
 	if err := c.Syncer.Validate(); err != nil {
 		errs = append(errs, err)
 	}
+	if err := c.SyncerHeartbeat.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.NamespaceScheduler.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.WorkspaceUsage.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.WorkspaceDeletion.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.WorkspaceQuota.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.ShardRegistration.Validate(); err != nil {
+		errs = append(errs, err)
+	}
 
 	return errs
 }
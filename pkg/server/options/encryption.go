@@ -0,0 +1,49 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package options
+
+import (
+	"github.com/spf13/pflag"
+
+	"github.com/kcp-dev/kcp/pkg/server/encryption"
+)
+
+type WorkspaceEncryption struct {
+	// ProviderConfigs are the encryption provider configuration files of the workspaces of
+	// logical clusters, in the format <logical cluster>=<file>.
+	ProviderConfigs []string
+}
+
+func NewWorkspaceEncryption() *WorkspaceEncryption {
+	return &WorkspaceEncryption{}
+}
+
+func (e *WorkspaceEncryption) AddFlags(fs *pflag.FlagSet) {
+	fs.StringSliceVar(&e.ProviderConfigs, "workspace-encryption-provider-configs", e.ProviderConfigs,
+		"Encryption provider configurations of workspaces, comma separated, in the format "+
+			"logical-cluster=file, e.g. root:org=/etc/kcp/org-encryption.yaml, where the file has the format "+
+			"of --encryption-provider-config. A configuration applies to the workspaces of the logical cluster "+
+			"and of its descendants, the one of the closest ancestor taking precedence. The resources it does "+
+			"not list are encrypted according to --encryption-provider-config.")
+}
+
+func (e *WorkspaceEncryption) Validate() []error {
+	if _, err := encryption.ParseProviderConfigs(e.ProviderConfigs); err != nil {
+		return []error{err}
+	}
+	return nil
+}
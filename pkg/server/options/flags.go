@@ -22,6 +22,12 @@ import (
 
 var (
 	allowedFlags = sets.NewString(
+		// admission flags
+		"admission-control-config-file", // File with admission control configuration.
+		"disable-admission-plugins",     // admission plugins that should be disabled although they are in the default enabled plugins list. The order of plugins in this flag does not matter.
+		"enable-admission-plugins",      // admission plugins that should be enabled in addition to default enabled ones. The order of plugins in this flag does not matter.
+		"kcp-admission-plugin-order",    // Order the kcp admission plugins and the admission webhooks of the workspaces are called in, comma separated.
+
 		// auditing flags
 		"audit-log-batch-buffer-size",           // The size of the buffer to store events before batching and writing. Only used in batch mode.
 		"audit-log-batch-max-size",              // The maximum size of a batch. Only used in batch mode.
@@ -40,6 +46,7 @@ var (
 		"audit-log-truncate-max-batch-size",     // Maximum size of the batch sent to the underlying backend. Actual serialized size can be several hundreds of bytes greater. If a batch exceeds this limit, it is split into several batches of smaller size.
 		"audit-log-truncate-max-event-size",     // Maximum size of the audit event sent to the underlying backend. If the size of an event is greater than this number, first request and response are removed, and if this doesn't reduce the size enough, event is discarded.
 		"audit-log-version",                     // API group and version used for serializing audit events written to log.
+		"audit-organization-policy-dir",         // Directory holding audit policies overriding the --audit-policy-file policy for the workspaces of organizations, in files named <organization>.yaml.
 		"audit-policy-file",                     // Path to the file that defines the audit policy configuration.
 		"audit-webhook-batch-buffer-size",       // The size of the buffer to store events before batching and writing. Only used in batch mode.
 		"audit-webhook-batch-initial-backoff",   // The amount of time to wait before retrying the first failed request.
@@ -78,11 +85,21 @@ var (
 		"token-auth-file",                    // If set, the file that will be used to secure the secure port of the API server via token authentication.
 
 		// KCP Authorization flags
-		"authorization-always-allow-paths", // A list of HTTP paths to skip during authorization, i.e. these are authorized without contacting the 'core' kubernetes server.
+		"authorization-always-allow-paths",             // A list of HTTP paths to skip during authorization, i.e. these are authorized without contacting the 'core' kubernetes server.
+		"authorization-webhook-cache-authorized-ttl",   // The duration to cache 'authorized' responses from the webhook authorizer.
+		"authorization-webhook-cache-unauthorized-ttl", // The duration to cache 'unauthorized' responses from the webhook authorizer.
+		"authorization-webhook-config-file",            // File with webhook configuration in kubeconfig format, consulted for every workspace before the workspace RBAC.
+		"authorization-webhook-version",                // The API version of the authorization.k8s.io SubjectAccessReview to send to and expect from the webhook.
 
-		// KCP Admin Authentication flags
-		"authentication-admin-token-path", // Path to which the administrative token hash should be written at startup. If this is relative, it is relative to --root-directory.
-		"kubeconfig-path",                 // Path to which the administrative kubeconfig should be written at startup.
+		// KCP Authentication flags
+		"authentication-client-cert-group-attributes",   // Subject attributes of the client certificates signed by --client-ca-file whose values are groups of the user.
+		"authentication-client-cert-group-mappings",     // Groups the subject attribute values of the client certificates signed by --client-ca-file are mapped to, comma separated.
+		"authentication-client-cert-username-attribute", // Subject attribute of the client certificates signed by --client-ca-file the username is taken from.
+		"authentication-admin-token-path",               // Path to which the administrative token hash should be written at startup. If this is relative, it is relative to --root-directory.
+		"authentication-syncer-token-key-path",          // Path to the key signing the tokens of the syncers, generated at startup if missing. If this is relative, it is relative to --root-directory.
+		"authentication-workspace-token-key-path",       // Path to the key signing the workspace tokens of generated kubeconfigs, generated at startup if missing. If this is relative, it is relative to --root-directory.
+		"authentication-workspace-token-max-expiration", // Maximum lifetime of the workspace tokens of generated kubeconfigs.
+		"kubeconfig-path",                               // Path to which the administrative kubeconfig should be written at startup.
 
 		// logs flags
 		"logging-format",      // Sets the log format. Permitted formats: "text".
@@ -94,11 +111,33 @@ var (
 		"tracing-config-file", // File with apiserver tracing configuration.
 
 		// KCP flags
-		"discovery-poll-interval", // Polling interval for dynamic discovery informers.
-		"enable-sharding",         // Enable delegating to peer kcp shards.
-		"profiler-address",        // [Address]:port to bind the profiler to
-		"root-directory",          // Root directory.
-		"shard-kubeconfig-file",   // Kubeconfig holding admin(!) credentials to peer kcp shards.
+		"bound-apis-cache-size",                 // Maximum number of workspaces whose APIs bound through APIBindings are kept resolved for serving.
+		"bound-apis-idle-timeout",               // Duration after which the resolved APIs bound through APIBindings of a workspace without requests are evicted.
+		"discovery-poll-interval",               // Polling interval for dynamic discovery informers.
+		"enable-sharding",                       // Enable delegating to peer kcp shards.
+		"etcd-config-file",                      // File holding the etcd endpoints, credentials and key prefix of this shard, overriding the --etcd-* flags.
+		"home-workspaces-organization",          // Organization the home workspaces of the users are created in on their first request to the ~ logical cluster.
+		"logical-cluster-metrics-allow-list",    // Logical clusters always broken out in the request metrics.
+		"logical-cluster-metrics-top-n",         // Number of logical clusters with the most requests in the previous minute broken out in the request metrics, in addition to the allowed ones.
+		"profiler-address",                      // [Address]:port to bind the profiler to
+		"root-directory",                        // Root directory.
+		"root-shard-kubeconfig-file",            // Kubeconfig holding admin(!) credentials to the root kcp shard, from which ClusterWorkspaceTypes, WorkspaceShards and RBAC are replicated.
+		"shard-ca-file",                         // CA certificate shared by the shards, issuing their serving and client certificates.
+		"shard-ca-key-file",                     // Key of the CA given by --shard-ca-file.
+		"shard-certificate-validity",            // Duration the serving and client certificates issued by the shard CA are valid for.
+		"shard-kubeconfig-file",                 // Kubeconfig holding admin(!) credentials to peer kcp shards, in addition to the shards registered as WorkspaceShards.
+		"shard-index-url",                       // URL of the workspace index of the shard proxy, routing the streams of the logical clusters of peer shards to them.
+		"shard-name",                            // Name of the WorkspaceShard this shard registers itself as in the root workspace.
+		"streaming-connection-idle-timeout",     // Time after which exec, attach, port-forward and watch streams and syncer tunnels without traffic are closed.
+		"streaming-drain-timeout",               // Time given on shutdown to the open streams to be closed by their clients, after which they are closed.
+		"streaming-handshake-timeout",           // Time after which upgrading the connection of a stream routed to a peer shard fails.
+		"webhook-service-endpoint-template",     // Go template of the URL the Services called by the admission and conversion webhooks of workspaces are dialed at.
+		"workspace-encryption-provider-configs", // Encryption provider configurations of workspaces, comma separated, in the format logical-cluster=file.
+		"workspace-rate-limit-per-user",         // Apply the --workspace-rate-limits to every user of a workspace separately.
+		"workspace-rate-limits",                 // Request rate limits of workspaces, comma separated, in the format logical-cluster=qps[/burst].
+		"workspace-snapshot-dir",                // Directory the snapshots of workspaces are stored in. Snapshots are disabled if empty.
+		"workspace-snapshot-quiesce-timeout",    // Maximum time the writes to a workspace are held back to take a snapshot.
+		"workspace-type-watch-cache-sizes",      // Watch cache settings per workspace type, overriding --watch-cache-sizes for the workspaces of the type, comma separated.
 
 		// secure serving flags
 		"bind-address",                     // The IP address on which to listen for the --secure-port port. The associated interface(s) must be reachable by the rest of the cluster, and by CLI/web clients. If blank or an unspecified address (0.0.0.0 or ::), all interfaces will be used.
@@ -120,14 +159,26 @@ var (
 		"embedded-etcd-wal-size-bytes", // Size of embedded etcd WAL
 
 		// KCP Controllers flags
-		"auto-publish-apis",                      // If true, the APIs imported from physical clusters will be published automatically as CRDs
-		"apiresource-controller-threads",         // Number of threads to use for the apiresource controller.
-		"pull-mode",                              // Deploy the syncer in registered physical clusters in POD, and have it sync resources from KCP
-		"push-mode",                              // If true, run syncer for each cluster from inside cluster controller
-		"resources-to-sync",                      // Provides the list of resources that should be synced from KCP logical cluster to underlying physical clusters
-		"run-controllers",                        // Run the controllers in-process
-		"syncer-image",                           // Syncer image to install on clusters
-		"unsupported-run-individual-controllers", // Run individual controllers in-process. The controller names can change at any time.
+		"auto-publish-apis",                           // If true, the APIs imported from physical clusters will be published automatically as CRDs
+		"apiresource-controller-threads",              // Number of threads to use for the apiresource controller.
+		"deleted-workspace-retention",                 // Duration the child workspaces and content of deleted workspaces are retained before they are purged
+		"deleted-workspace-retentions",                // Retention of deleted workspaces per logical cluster, comma separated, in the format logical-cluster=duration
+		"deleted-workspace-type-retentions",           // Retention of deleted workspaces per workspace type, comma separated, in the format type=duration
+		"namespace-eviction-grace-period",             // Amount of time a rescheduled namespace keeps running on the cluster it is evicted from, before its objects are deleted from it
+		"pull-mode",                                   // Deploy the syncer in registered physical clusters in POD, and have it sync resources from KCP
+		"push-mode",                                   // If true, run syncer for each cluster from inside cluster controller
+		"resources-to-sync",                           // Provides the list of resources that should be synced from KCP logical cluster to underlying physical clusters
+		"run-controllers",                             // Run the controllers in-process
+		"shard-heartbeat-grace-period",                // Time after the last heartbeat of a shard after which no workspaces are scheduled to it
+		"shard-heartbeat-interval",                    // Interval at which the shard registers its WorkspaceShard with its version, capacity, workspace count and health
+		"shard-labels",                                // Labels the shard sets on its WorkspaceShard, e.g. topology.kubernetes.io/region=eu-west-1, for workspaces to be placed by
+		"shard-workspace-capacity",                    // Number of workspaces after which no more workspaces are scheduled to the shard, 0 for no limit
+		"syncer-heartbeat-grace-period",               // Amount of time after the last syncer heartbeat before a workload cluster is marked as not ready
+		"syncer-image",                                // Syncer image to install on clusters
+		"unsupported-run-individual-controllers",      // Run individual controllers in-process. The controller names can change at any time.
+		"workload-cluster-unready-eviction-threshold", // Amount of time a workload cluster must be not ready before its namespaces are rescheduled to other clusters
+		"workspace-usage-interval",                    // Interval at which the storage usage of the logical clusters of workspaces is measured and published on their status
+		"workspace-resource-quota-interval",           // Interval at which the usage of the workspaces limited by WorkspaceResourceQuotas is published on their status
 
 		// generic flags
 		"cors-allowed-origins",                 // List of allowed origins for CORS, comma separated.  An allowed origin can be a regular expression to support subdomain matching. If this list is empty CORS will not be enabled.
@@ -200,11 +251,6 @@ var (
 		// features flags
 		"enable-swagger-ui", // Enables swagger ui on the apiserver at /swagger-ui
 
-		// admission flags
-		"admission-control-config-file", // File with admission control configuration.
-		"disable-admission-plugins",     // admission plugins that should be disabled although they are in the default enabled plugins list (NamespaceLifecycle). Comma-delimited list of admission plugins: MutatingAdmissionWebhook, NamespaceLifecycle, ValidatingAdmissionWebhook. The order of plugins in this flag does not matter.
-		"enable-admission-plugins",      // admission plugins that should be enabled in addition to default enabled ones (NamespaceLifecycle). Comma-delimited list of admission plugins: MutatingAdmissionWebhook, NamespaceLifecycle, ValidatingAdmissionWebhook. The order of plugins in this flag does not matter.
-
 		// egress selector flags
 		"egress-selector-config-file", // File with apiserver egress selector configuration.
 
@@ -25,20 +25,37 @@ import (
 	"github.com/spf13/pflag"
 
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/admission"
 	cliflag "k8s.io/component-base/cli/flag"
 	_ "k8s.io/kubernetes/pkg/features"
 	"k8s.io/kubernetes/pkg/genericcontrolplane/options"
 	kubeoptions "k8s.io/kubernetes/pkg/kubeapiserver/options"
 
 	kcpadmission "github.com/kcp-dev/kcp/pkg/admission"
+	"github.com/kcp-dev/kcp/pkg/etcd"
+	"github.com/kcp-dev/kcp/pkg/home"
+	"github.com/kcp-dev/kcp/pkg/shardcerts"
+	"github.com/kcp-dev/kcp/pkg/tracing"
 )
 
 type Options struct {
-	GenericControlPlane ServerRunOptions
-	EmbeddedEtcd        EmbeddedEtcd
-	Controllers         Controllers
-	Authorization       Authorization
-	AdminAuthentication AdminAuthentication
+	GenericControlPlane  ServerRunOptions
+	EmbeddedEtcd         EmbeddedEtcd
+	Controllers          Controllers
+	Authorization        Authorization
+	AdminAuthentication  AdminAuthentication
+	SyncerAuthentication SyncerAuthentication
+	WorkspaceTokens      WorkspaceTokenAuthentication
+	ClientCerts          ClientCertAuthentication
+	OrganizationAudit    OrganizationAudit
+	WatchCache           WatchCache
+	RateLimits           WorkspaceRateLimits
+	Snapshots            WorkspaceSnapshots
+	WebhookServices      WebhookServices
+	Encryption           WorkspaceEncryption
+	Streaming            Streaming
+	ShardCertificates    ShardCertificates
+	Admission            Admission
 
 	Extra ExtraOptions
 }
@@ -49,14 +66,51 @@ type ExtraOptions struct {
 	ShardKubeconfigFile   string
 	EnableSharding        bool
 	DiscoveryPollInterval time.Duration
+
+	// RootShardKubeconfigFile is the kubeconfig of the root shard, from which the objects needed by
+	// admission and authorization are replicated when this is not the root shard.
+	RootShardKubeconfigFile string
+
+	// ShardName is the name of the WorkspaceShard the shard registers itself as in the root workspace.
+	ShardName string
+
+	// EtcdConfigFile is a file holding the etcd endpoints, credentials and key prefix of the shard,
+	// overriding the --etcd-* flags.
+	EtcdConfigFile string
+
+	// LogicalClusterMetricsAllowList are the logical clusters always broken out in the request and controller metrics.
+	LogicalClusterMetricsAllowList []string
+	// LogicalClusterMetricsTopN is the number of busiest logical clusters broken out in the request and controller metrics.
+	LogicalClusterMetricsTopN int
+
+	// HomeWorkspacesOrganization is the organization the home workspaces of the users are created in,
+	// resolving the `~` logical cluster. Home workspaces are disabled if empty.
+	HomeWorkspacesOrganization string
+
+	// BoundAPIsCacheSize is the maximum number of workspaces whose bound APIs are kept resolved for serving.
+	BoundAPIsCacheSize int
+	// BoundAPIsIdleTimeout is the duration after which the resolved bound APIs of a workspace without requests are evicted.
+	BoundAPIsIdleTimeout time.Duration
 }
 
 type completedOptions struct {
-	GenericControlPlane options.CompletedServerRunOptions
-	EmbeddedEtcd        EmbeddedEtcd
-	Controllers         Controllers
-	Authorization       Authorization
-	AdminAuthentication AdminAuthentication
+	GenericControlPlane  options.CompletedServerRunOptions
+	EmbeddedEtcd         EmbeddedEtcd
+	Controllers          Controllers
+	Authorization        Authorization
+	AdminAuthentication  AdminAuthentication
+	SyncerAuthentication SyncerAuthentication
+	WorkspaceTokens      WorkspaceTokenAuthentication
+	ClientCerts          ClientCertAuthentication
+	OrganizationAudit    OrganizationAudit
+	WatchCache           WatchCache
+	RateLimits           WorkspaceRateLimits
+	Snapshots            WorkspaceSnapshots
+	WebhookServices      WebhookServices
+	Encryption           WorkspaceEncryption
+	Streaming            Streaming
+	ShardCertificates    ShardCertificates
+	Admission            Admission
 
 	Extra ExtraOptions
 }
@@ -71,10 +125,22 @@ func NewOptions() *Options {
 		GenericControlPlane: ServerRunOptions{
 			*options.NewServerRunOptions(),
 		},
-		EmbeddedEtcd:        *NewEmbeddedEtcd(),
-		Controllers:         *NewControllers(),
-		Authorization:       *NewAuthorization(),
-		AdminAuthentication: *NewAdminAuthentication(),
+		EmbeddedEtcd:         *NewEmbeddedEtcd(),
+		Controllers:          *NewControllers(),
+		Authorization:        *NewAuthorization(),
+		AdminAuthentication:  *NewAdminAuthentication(),
+		SyncerAuthentication: *NewSyncerAuthentication(),
+		WorkspaceTokens:      *NewWorkspaceTokenAuthentication(),
+		ClientCerts:          *NewClientCertAuthentication(),
+		OrganizationAudit:    *NewOrganizationAudit(),
+		WatchCache:           *NewWatchCache(),
+		RateLimits:           *NewWorkspaceRateLimits(),
+		Snapshots:            *NewWorkspaceSnapshots(),
+		WebhookServices:      *NewWebhookServices(),
+		Encryption:           *NewWorkspaceEncryption(),
+		Streaming:            *NewStreaming(),
+		ShardCertificates:    *NewShardCertificates(),
+		Admission:            *NewAdmission(),
 
 		Extra: ExtraOptions{
 			RootDirectory:         ".kcp",
@@ -82,6 +148,12 @@ func NewOptions() *Options {
 			ShardKubeconfigFile:   "",
 			EnableSharding:        false,
 			DiscoveryPollInterval: 60 * time.Second,
+			ShardName:             "root",
+
+			LogicalClusterMetricsTopN: 10,
+
+			BoundAPIsCacheSize:   1000,
+			BoundAPIsIdleTimeout: 10 * time.Minute,
 		},
 	}
 
@@ -100,8 +172,10 @@ func NewOptions() *Options {
 
 	// override set of admission plugins
 	kcpadmission.RegisterAllKcpAdmissionPlugins(o.GenericControlPlane.Admission.Plugins)
-	o.GenericControlPlane.Admission.DisablePlugins = kcpadmission.DefaultOffAdmissionPlugins().List()
+	// default-off, instead of disabled, such that --enable-admission-plugins and --disable-admission-plugins apply on top
+	o.GenericControlPlane.Admission.DefaultOffPlugins.Insert(kcpadmission.DefaultOffAdmissionPlugins().List()...)
 	o.GenericControlPlane.Admission.RecommendedPluginOrder = kcpadmission.AllOrderedPlugins
+	o.GenericControlPlane.Admission.Decorators = append(o.GenericControlPlane.Admission.Decorators, admission.DecoratorFunc(tracing.WithAdmissionTracing))
 
 	return o
 }
@@ -120,13 +194,33 @@ func (o *Options) rawFlags() cliflag.NamedFlagSets {
 	o.Controllers.AddFlags(fss.FlagSet("KCP Controllers"))
 	o.Authorization.AddFlags(fss.FlagSet("KCP Authorization"))
 	o.AdminAuthentication.AddFlags(fss.FlagSet("KCP Authentication"))
+	o.SyncerAuthentication.AddFlags(fss.FlagSet("KCP Authentication"))
+	o.WorkspaceTokens.AddFlags(fss.FlagSet("KCP Authentication"))
+	o.ClientCerts.AddFlags(fss.FlagSet("KCP Authentication"))
+	o.OrganizationAudit.AddFlags(fss.FlagSet("auditing"))
+	o.WatchCache.AddFlags(fss.FlagSet("KCP"))
+	o.RateLimits.AddFlags(fss.FlagSet("KCP"))
+	o.Snapshots.AddFlags(fss.FlagSet("KCP"))
+	o.WebhookServices.AddFlags(fss.FlagSet("KCP"))
+	o.Encryption.AddFlags(fss.FlagSet("KCP"))
+	o.Streaming.AddFlags(fss.FlagSet("KCP"))
+	o.ShardCertificates.AddFlags(fss.FlagSet("KCP"))
+	o.Admission.AddFlags(fss.FlagSet("admission"))
 
 	fs := fss.FlagSet("KCP")
 	fs.StringVar(&o.Extra.ProfilerAddress, "profiler-address", o.Extra.ProfilerAddress, "[Address]:port to bind the profiler to")
-	fs.StringVar(&o.Extra.ShardKubeconfigFile, "shard-kubeconfig-file", o.Extra.ShardKubeconfigFile, "Kubeconfig holding admin(!) credentials to peer kcp shards.")
+	fs.StringVar(&o.Extra.ShardKubeconfigFile, "shard-kubeconfig-file", o.Extra.ShardKubeconfigFile, "Kubeconfig holding admin(!) credentials to peer kcp shards, in addition to the shards registered as WorkspaceShards.")
 	fs.BoolVar(&o.Extra.EnableSharding, "enable-sharding", o.Extra.EnableSharding, "Enable delegating to peer kcp shards.")
+	fs.StringVar(&o.Extra.RootShardKubeconfigFile, "root-shard-kubeconfig-file", o.Extra.RootShardKubeconfigFile, "Kubeconfig holding admin(!) credentials to the root kcp shard. If set, the ClusterWorkspaceTypes, WorkspaceShards and the RBAC granting the use of ClusterWorkspaceTypes of all workspaces of the root shard are replicated to this shard.")
+	fs.StringVar(&o.Extra.ShardName, "shard-name", o.Extra.ShardName, "Name of the WorkspaceShard this shard registers itself as in the root workspace.")
+	fs.StringVar(&o.Extra.EtcdConfigFile, "etcd-config-file", o.Extra.EtcdConfigFile, "File holding the etcd endpoints, client certificate, key and CA bundle, and the key prefix of this shard, overriding the --etcd-servers, --etcd-certfile, --etcd-keyfile, --etcd-cafile and --etcd-prefix flags. Shards sharing an etcd must use prefixes that are not prefixes of one another.")
 	fs.StringVar(&o.Extra.RootDirectory, "root-directory", o.Extra.RootDirectory, "Root directory.")
 	fs.DurationVar(&o.Extra.DiscoveryPollInterval, "discovery-poll-interval", o.Extra.DiscoveryPollInterval, "Polling interval for dynamic discovery informers.")
+	fs.StringSliceVar(&o.Extra.LogicalClusterMetricsAllowList, "logical-cluster-metrics-allow-list", o.Extra.LogicalClusterMetricsAllowList, "Logical clusters always broken out in the request and controller metrics.")
+	fs.IntVar(&o.Extra.LogicalClusterMetricsTopN, "logical-cluster-metrics-top-n", o.Extra.LogicalClusterMetricsTopN, "Number of logical clusters with the most requests, respectively reconciliations, in the previous minute broken out in the request and controller metrics, in addition to the allowed ones. Other logical clusters are counted as 'other'.")
+	fs.StringVar(&o.Extra.HomeWorkspacesOrganization, "home-workspaces-organization", o.Extra.HomeWorkspacesOrganization, "Organization the home workspaces of the users are created in on their first request to the ~ logical cluster, e.g. /clusters/~. Home workspaces are disabled if empty.")
+	fs.IntVar(&o.Extra.BoundAPIsCacheSize, "bound-apis-cache-size", o.Extra.BoundAPIsCacheSize, "Maximum number of workspaces whose APIs bound through APIBindings are kept resolved for serving. The least recently used workspaces are evicted first.")
+	fs.DurationVar(&o.Extra.BoundAPIsIdleTimeout, "bound-apis-idle-timeout", o.Extra.BoundAPIsIdleTimeout, "Duration after which the resolved APIs bound through APIBindings of a workspace without requests are evicted, to be resolved again on its next request.")
 
 	return fss
 }
@@ -139,15 +233,58 @@ func (o *CompletedOptions) Validate() []error {
 	errs = append(errs, o.EmbeddedEtcd.Validate()...)
 	errs = append(errs, o.Authorization.Validate()...)
 	errs = append(errs, o.AdminAuthentication.Validate()...)
-
+	errs = append(errs, o.ClientCerts.Validate()...)
+	errs = append(errs, o.WatchCache.Validate()...)
+	errs = append(errs, o.RateLimits.Validate()...)
+	errs = append(errs, o.Snapshots.Validate()...)
+	errs = append(errs, o.WebhookServices.Validate()...)
+	errs = append(errs, o.Encryption.Validate()...)
+	errs = append(errs, o.Streaming.Validate()...)
+	errs = append(errs, o.ShardCertificates.Validate()...)
+	errs = append(errs, o.Admission.Validate()...)
+
+	if o.ShardCertificates.Enabled() {
+		if o.ShardCertificates.CAKeyFile == "" && o.Extra.RootShardKubeconfigFile == "" {
+			errs = append(errs, fmt.Errorf("--shard-ca-file requires --shard-ca-key-file on the root shard, or --root-shard-kubeconfig-file to request the certificates from the root shard"))
+		}
+		if o.ShardCertificates.CAKeyFile != "" && o.Extra.RootShardKubeconfigFile != "" {
+			errs = append(errs, fmt.Errorf("--shard-ca-key-file must only be set on the root shard, i.e. without --root-shard-kubeconfig-file"))
+		}
+	}
 	if o.Extra.DiscoveryPollInterval == 0 {
 		errs = append(errs, fmt.Errorf("--discovery-poll-interval not set"))
 	}
+	if o.Extra.ShardName == "" {
+		errs = append(errs, fmt.Errorf("--shard-name must not be empty"))
+	}
+	if name := o.Extra.HomeWorkspacesOrganization; name != "" && home.WorkspaceName(name) != name {
+		errs = append(errs, fmt.Errorf("--home-workspaces-organization %q must be a valid workspace name", name))
+	}
+	if o.Extra.LogicalClusterMetricsTopN < 0 {
+		errs = append(errs, fmt.Errorf("--logical-cluster-metrics-top-n must not be negative"))
+	}
+	if o.Extra.BoundAPIsCacheSize <= 0 {
+		errs = append(errs, fmt.Errorf("--bound-apis-cache-size must be positive"))
+	}
+	if o.Extra.BoundAPIsIdleTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("--bound-apis-idle-timeout must be positive"))
+	}
 
 	return errs
 }
 
 func (o *Options) Complete() (*CompletedOptions, error) {
+	if o.Extra.EtcdConfigFile != "" {
+		config, err := etcd.LoadConfig(o.Extra.EtcdConfigFile)
+		if err != nil {
+			return nil, err
+		}
+		o.GenericControlPlane.Etcd.StorageConfig.Prefix = config.Prefix
+		o.GenericControlPlane.Etcd.StorageConfig.Transport.ServerList = config.Endpoints
+		o.GenericControlPlane.Etcd.StorageConfig.Transport.CertFile = config.CertFile
+		o.GenericControlPlane.Etcd.StorageConfig.Transport.KeyFile = config.KeyFile
+		o.GenericControlPlane.Etcd.StorageConfig.Transport.TrustedCAFile = config.TrustedCAFile
+	}
 	if servers := o.GenericControlPlane.Etcd.StorageConfig.Transport.ServerList; len(servers) == 1 && servers[0] == "embedded" {
 		o.GenericControlPlane.Etcd.StorageConfig.Transport.ServerList = []string{"localhost:" + o.EmbeddedEtcd.ClientPort}
 		o.EmbeddedEtcd.Enabled = true
@@ -177,6 +314,59 @@ func (o *Options) Complete() (*CompletedOptions, error) {
 	if !filepath.IsAbs(o.AdminAuthentication.KubeConfigPath) {
 		o.AdminAuthentication.KubeConfigPath = filepath.Join(o.Extra.RootDirectory, o.AdminAuthentication.KubeConfigPath)
 	}
+	if !filepath.IsAbs(o.SyncerAuthentication.TokenKeyFilePath) {
+		o.SyncerAuthentication.TokenKeyFilePath = filepath.Join(o.Extra.RootDirectory, o.SyncerAuthentication.TokenKeyFilePath)
+	}
+	if !filepath.IsAbs(o.WorkspaceTokens.TokenKeyFilePath) {
+		o.WorkspaceTokens.TokenKeyFilePath = filepath.Join(o.Extra.RootDirectory, o.WorkspaceTokens.TokenKeyFilePath)
+	}
+	if !filepath.IsAbs(o.ShardCertificates.Directory) {
+		o.ShardCertificates.Directory = filepath.Join(o.Extra.RootDirectory, o.ShardCertificates.Directory)
+	}
+	if o.ShardCertificates.Enabled() {
+		// serve with, and trust the client certificates of the peers issued by, the shard CA.
+		// The files are written before the server starts and reloaded when rotated.
+		if o.GenericControlPlane.SecureServing.ServerCert.CertKey.CertFile == "" {
+			o.GenericControlPlane.SecureServing.ServerCert.CertKey.CertFile, o.GenericControlPlane.SecureServing.ServerCert.CertKey.KeyFile = o.ShardCertificates.ServingCertFile()
+		}
+		if clientCert := o.GenericControlPlane.Authentication.ClientCert; clientCert != nil {
+			if clientCert.ClientCA != o.ShardCertificates.ClientCAFile() {
+				o.ShardCertificates.UserClientCAFile = clientCert.ClientCA
+			}
+			clientCert.ClientCA = o.ShardCertificates.ClientCAFile()
+		}
+		// trust the identities forwarded by the front-proxy with the client certificate
+		// issued by the root shard, unless a request header CA is configured.
+		if requestHeader := o.GenericControlPlane.Authentication.RequestHeader; requestHeader != nil && requestHeader.ClientCAFile == "" {
+			requestHeader.ClientCAFile = o.ShardCertificates.CAFile
+			requestHeader.AllowedNames = []string{shardcerts.FrontProxyUserName}
+			if len(requestHeader.UsernameHeaders) == 0 {
+				requestHeader.UsernameHeaders = []string{"X-Remote-User"}
+			}
+			if len(requestHeader.GroupHeaders) == 0 {
+				requestHeader.GroupHeaders = []string{"X-Remote-Group"}
+			}
+			if len(requestHeader.ExtraHeaderPrefixes) == 0 {
+				requestHeader.ExtraHeaderPrefixes = []string{"X-Remote-Extra-"}
+			}
+		}
+	}
+	if clientCert := o.GenericControlPlane.Authentication.ClientCert; clientCert != nil && !o.ClientCerts.IsDefault() {
+		// the client certificates are mapped as configured instead of by the built-in
+		// authenticators, which keep authenticating the peers with the shard CA only.
+		if o.ShardCertificates.Enabled() {
+			o.ClientCerts.ClientCAFile = o.ShardCertificates.UserClientCAFile
+			clientCert.ClientCA = o.ShardCertificates.CAFile
+		} else {
+			o.ClientCerts.ClientCAFile = clientCert.ClientCA
+			clientCert.ClientCA = ""
+		}
+	}
+
+	// an invalid order is reported by Validate
+	if len(kcpadmission.ValidatePluginOrder(o.Admission.PluginOrder)) == 0 {
+		o.GenericControlPlane.Admission.RecommendedPluginOrder = kcpadmission.OrderedPlugins(o.Admission.PluginOrder)
+	}
 
 	completedGenericControlPlane, err := o.GenericControlPlane.ServerRunOptions.Complete()
 	if err != nil {
@@ -186,12 +376,24 @@ func (o *Options) Complete() (*CompletedOptions, error) {
 	return &CompletedOptions{
 		completedOptions: &completedOptions{
 			// TODO: GenericControlPlane here should be completed. But the k/k repo does not expose the CompleteOptions type, but should.
-			GenericControlPlane: completedGenericControlPlane,
-			EmbeddedEtcd:        o.EmbeddedEtcd,
-			Controllers:         o.Controllers,
-			Authorization:       o.Authorization,
-			AdminAuthentication: o.AdminAuthentication,
-			Extra:               o.Extra,
+			GenericControlPlane:  completedGenericControlPlane,
+			EmbeddedEtcd:         o.EmbeddedEtcd,
+			Controllers:          o.Controllers,
+			Authorization:        o.Authorization,
+			AdminAuthentication:  o.AdminAuthentication,
+			SyncerAuthentication: o.SyncerAuthentication,
+			WorkspaceTokens:      o.WorkspaceTokens,
+			ClientCerts:          o.ClientCerts,
+			OrganizationAudit:    o.OrganizationAudit,
+			WatchCache:           o.WatchCache,
+			RateLimits:           o.RateLimits,
+			Snapshots:            o.Snapshots,
+			WebhookServices:      o.WebhookServices,
+			Encryption:           o.Encryption,
+			Streaming:            o.Streaming,
+			ShardCertificates:    o.ShardCertificates,
+			Admission:            o.Admission,
+			Extra:                o.Extra,
 		},
 	}, nil
 }
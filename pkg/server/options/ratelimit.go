@@ -0,0 +1,53 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package options
+
+import (
+	"github.com/spf13/pflag"
+
+	"github.com/kcp-dev/kcp/pkg/server/ratelimit"
+)
+
+type WorkspaceRateLimits struct {
+	// Limits are the request rate limits of the workspaces of logical clusters, in the
+	// format <logical cluster>=<qps>[/<burst>].
+	Limits []string
+	// PerUser limits the requests of every user to a workspace separately.
+	PerUser bool
+}
+
+func NewWorkspaceRateLimits() *WorkspaceRateLimits {
+	return &WorkspaceRateLimits{}
+}
+
+func (r *WorkspaceRateLimits) AddFlags(fs *pflag.FlagSet) {
+	fs.StringSliceVar(&r.Limits, "workspace-rate-limits", r.Limits,
+		"Request rate limits of workspaces, comma separated. The individual limit format: "+
+			"logical-cluster=qps[/burst], e.g. root:org=50/100, where the burst defaults to the qps. "+
+			"A limit applies to the workspaces of the logical cluster and of its descendants, the limit "+
+			"of the closest ancestor taking precedence, and every workspace is limited separately. "+
+			"Requests exceeding the limit are answered with 429 and a Retry-After header.")
+	fs.BoolVar(&r.PerUser, "workspace-rate-limit-per-user", r.PerUser,
+		"Apply the --workspace-rate-limits to every user of a workspace separately.")
+}
+
+func (r *WorkspaceRateLimits) Validate() []error {
+	if _, err := ratelimit.ParseLimits(r.Limits); err != nil {
+		return []error{err}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package options
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/kcp-dev/kcp/pkg/shardcerts"
+)
+
+type ShardCertificates struct {
+	// CAFile is the CA shared by the shards, issuing their serving and client certificates.
+	// The shards talk to each other with their admin kubeconfigs if empty.
+	CAFile string
+	// CAKeyFile is the key of the shard CA. It is only given to the root shard, which signs
+	// the certificates requested by the other shards.
+	CAKeyFile string
+	// Validity is the duration the issued certificates are valid for. They are renewed
+	// after two thirds of it.
+	Validity time.Duration
+	// Directory holds the issued certificates, relative to the root directory.
+	Directory string
+
+	// UserClientCAFile is the --client-ca-file given by the user, trusted in addition to
+	// the shard CA.
+	UserClientCAFile string
+}
+
+func NewShardCertificates() *ShardCertificates {
+	return &ShardCertificates{
+		Validity:  24 * time.Hour,
+		Directory: "shard-certs",
+	}
+}
+
+func (s *ShardCertificates) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&s.CAFile, "shard-ca-file", s.CAFile,
+		"CA certificate shared by the shards. Every shard gets a serving certificate, unless --tls-cert-file is set, "+
+			"and a client certificate to reach its peers issued by it, trusts the client certificates of its peers, "+
+			"and renews its certificates before they expire. The root shard issues the certificates with --shard-ca-key-file, "+
+			"the other shards request theirs from the root shard given by --root-shard-kubeconfig-file.")
+	fs.StringVar(&s.CAKeyFile, "shard-ca-key-file", s.CAKeyFile,
+		"Key of the CA given by --shard-ca-file. Only set on the root shard, which signs the certificates of the other shards "+
+			"and issues the client certificate of the front-proxy.")
+	fs.DurationVar(&s.Validity, "shard-certificate-validity", s.Validity,
+		"Duration the serving and client certificates issued by the shard CA are valid for. They are renewed after two thirds of it.")
+}
+
+func (s *ShardCertificates) Validate() []error {
+	var errs []error
+	if s.CAKeyFile != "" && s.CAFile == "" {
+		errs = append(errs, fmt.Errorf("--shard-ca-key-file requires --shard-ca-file"))
+	}
+	if s.Validity < time.Hour {
+		errs = append(errs, fmt.Errorf("--shard-certificate-validity must be at least 1h"))
+	}
+	return errs
+}
+
+// Enabled returns true if the shards use certificates issued by the shard CA.
+func (s *ShardCertificates) Enabled() bool {
+	return s.CAFile != ""
+}
+
+// ServingCertFile returns the serving certificate and key files issued by the shard CA.
+func (s *ShardCertificates) ServingCertFile() (string, string) {
+	return filepath.Join(s.Directory, shardcerts.ServingCertFileName), filepath.Join(s.Directory, shardcerts.ServingKeyFileName)
+}
+
+// ClientCertFile returns the client certificate and key files issued by the shard CA.
+func (s *ShardCertificates) ClientCertFile() (string, string) {
+	return filepath.Join(s.Directory, shardcerts.ClientCertFileName), filepath.Join(s.Directory, shardcerts.ClientKeyFileName)
+}
+
+// FrontProxyClientCertFile returns the front-proxy client certificate and key files issued
+// by the shard CA on the root shard.
+func (s *ShardCertificates) FrontProxyClientCertFile() (string, string) {
+	return filepath.Join(s.Directory, shardcerts.FrontProxyClientCertFileName), filepath.Join(s.Directory, shardcerts.FrontProxyClientKeyFileName)
+}
+
+// ClientCAFile returns the bundle of the shard CA and of the client CA given by the user.
+func (s *ShardCertificates) ClientCAFile() string {
+	return filepath.Join(s.Directory, shardcerts.ClientCAFileName)
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package options
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+type WorkspaceSnapshots struct {
+	// Directory is the directory snapshots of workspaces are stored in. Snapshots are
+	// disabled if empty.
+	Directory string
+	// QuiesceTimeout is the maximum time the writes to a workspace are held back to take
+	// a snapshot.
+	QuiesceTimeout time.Duration
+}
+
+func NewWorkspaceSnapshots() *WorkspaceSnapshots {
+	return &WorkspaceSnapshots{
+		QuiesceTimeout: 5 * time.Second,
+	}
+}
+
+func (s *WorkspaceSnapshots) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&s.Directory, "workspace-snapshot-dir", s.Directory,
+		"Directory the snapshots of workspaces taken through the snapshot subresource of ClusterWorkspaces are stored in, "+
+			"e.g. a volume synced to an object store. Snapshots are disabled if empty.")
+	fs.DurationVar(&s.QuiesceTimeout, "workspace-snapshot-quiesce-timeout", s.QuiesceTimeout,
+		"Maximum time the writes to a workspace are held back, waiting for the in-flight writes to complete, to take a snapshot.")
+}
+
+func (s *WorkspaceSnapshots) Validate() []error {
+	if s.QuiesceTimeout <= 0 {
+		return []error{fmt.Errorf("--workspace-snapshot-quiesce-timeout must be positive")}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package options
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+type Streaming struct {
+	// ShardIndexURL is the URL of the workspace index used to route the streams of the
+	// logical clusters of peer shards to them. Streams are served locally if empty.
+	ShardIndexURL string
+	// HandshakeTimeout is the time after which upgrading a connection to a peer shard fails.
+	HandshakeTimeout time.Duration
+	// IdleTimeout is the time after which streams without traffic are closed.
+	IdleTimeout time.Duration
+	// DrainTimeout is the time streams are given to be closed by their clients on shutdown.
+	DrainTimeout time.Duration
+}
+
+func NewStreaming() *Streaming {
+	return &Streaming{
+		HandshakeTimeout: 30 * time.Second,
+		IdleTimeout:      4 * time.Hour,
+		DrainTimeout:     30 * time.Second,
+	}
+}
+
+func (s *Streaming) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&s.ShardIndexURL, "shard-index-url", s.ShardIndexURL,
+		"URL of the workspace index of the shard proxy. With --enable-sharding, the exec, attach, "+
+			"port-forward and WebSocket watch streams and the syncer tunnels of the logical clusters "+
+			"of peer shards are routed to them through the index. Streams are served locally if empty.")
+	fs.DurationVar(&s.HandshakeTimeout, "streaming-handshake-timeout", s.HandshakeTimeout,
+		"Time after which upgrading the connection of a stream routed to a peer shard fails.")
+	fs.DurationVar(&s.IdleTimeout, "streaming-connection-idle-timeout", s.IdleTimeout,
+		"Time after which exec, attach, port-forward and watch streams and syncer tunnels without traffic are closed, 0 to never close them.")
+	fs.DurationVar(&s.DrainTimeout, "streaming-drain-timeout", s.DrainTimeout,
+		"Time given on shutdown to the open streams to be closed by their clients, after which they are closed. "+
+			"New streams are answered with 503 and a Retry-After header meanwhile.")
+}
+
+func (s *Streaming) Validate() []error {
+	var errs []error
+	if s.ShardIndexURL != "" {
+		if u, err := url.Parse(s.ShardIndexURL); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("--shard-index-url must be an absolute URL: %q", s.ShardIndexURL))
+		}
+	}
+	if s.HandshakeTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("--streaming-handshake-timeout must be positive"))
+	}
+	if s.IdleTimeout < 0 {
+		errs = append(errs, fmt.Errorf("--streaming-connection-idle-timeout must not be negative"))
+	}
+	if s.DrainTimeout < 0 {
+		errs = append(errs, fmt.Errorf("--streaming-drain-timeout must not be negative"))
+	}
+	return errs
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package options
+
+import (
+	"github.com/spf13/pflag"
+
+	"github.com/kcp-dev/kcp/pkg/server/watchcache"
+)
+
+type WatchCache struct {
+	// WorkspaceTypeSizes are the watch cache settings per workspace type, in the format
+	// <workspace type>:<resource[.group]>#<size>, overriding --watch-cache-sizes.
+	WorkspaceTypeSizes []string
+}
+
+func NewWatchCache() *WatchCache {
+	return &WatchCache{}
+}
+
+func (w *WatchCache) AddFlags(fs *pflag.FlagSet) {
+	fs.StringSliceVar(&w.WorkspaceTypeSizes, "workspace-type-watch-cache-sizes", w.WorkspaceTypeSizes,
+		"Watch cache settings per workspace type, overriding --watch-cache-sizes for the workspaces of the type, "+
+			"comma separated. The individual setting format: type:resource[.group]#size, where resource[.group] "+
+			"is as in --watch-cache-sizes, or * for all resources. The watch cache size is dynamic, a size of "+
+			"zero serves the gets and lists of the workspaces of the type from etcd, any other size from the "+
+			"watch cache. Watches are always served from the watch cache of resources having one. "+
+			"It takes effect when watch-cache is enabled, and --watch-cache-sizes also applies to the "+
+			"resources served by CRDs.")
+}
+
+func (w *WatchCache) Validate() []error {
+	if _, err := watchcache.ParseWorkspaceTypeSizes(w.WorkspaceTypeSizes); err != nil {
+		return []error{err}
+	}
+	return nil
+}
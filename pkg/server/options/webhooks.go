@@ -0,0 +1,51 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package options
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+
+	"github.com/kcp-dev/kcp/pkg/server/serviceresolver"
+)
+
+type WebhookServices struct {
+	// EndpointTemplate is the template of the endpoints the Services called by the
+	// admission and conversion webhooks of workspaces are resolved to.
+	EndpointTemplate string
+}
+
+func NewWebhookServices() *WebhookServices {
+	return &WebhookServices{
+		EndpointTemplate: serviceresolver.DefaultEndpointTemplate,
+	}
+}
+
+func (s *WebhookServices) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&s.EndpointTemplate, "webhook-service-endpoint-template", s.EndpointTemplate,
+		"Go template of the URL the Services called by the admission and conversion webhooks of workspaces are dialed at. "+
+			"It is executed with the .ClusterName, .Namespace, .Name and .Port of the Service, and the .WorkloadCluster its "+
+			"namespace is scheduled on and the .PhysicalNamespace it is synced to.")
+}
+
+func (s *WebhookServices) Validate() []error {
+	if _, err := serviceresolver.ParseEndpointTemplate(s.EndpointTemplate); err != nil {
+		return []error{fmt.Errorf("--webhook-service-endpoint-template: %w", err)}
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ratelimit limits the rate of the requests to every workspace at the edge of the
+// shard, before they are admitted or fanned out to the peer shards, such that a runaway
+// controller of one tenant is answered with 429 responses instead of loading the shards.
+//
+// Limits are configured per logical cluster and apply to its descendant workspaces too,
+// the limit of the closest ancestor taking precedence. Every workspace, or every user of
+// a workspace, gets its own token bucket.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilcache "k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/handlers/responsewriters"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/util/flowcontrol"
+
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+)
+
+// DefaultMaxBuckets is the default maximum number of token buckets kept, the least
+// recently used ones being evicted first.
+const DefaultMaxBuckets = 10000
+
+var (
+	errorScheme = runtime.NewScheme()
+	errorCodecs = serializer.NewCodecFactory(errorScheme)
+)
+
+func init() {
+	errorScheme.AddUnversionedTypes(metav1.Unversioned,
+		&metav1.Status{},
+	)
+}
+
+// Limit is the request rate limit of the workspaces of a logical cluster.
+type Limit struct {
+	// QPS is the number of requests per second a workspace sustains.
+	QPS float32
+	// Burst is the number of requests a workspace can send at once.
+	Burst int
+}
+
+// ParseLimits parses limits in the format <logical cluster>=<qps>[/<burst>], keyed by
+// logical cluster. The burst defaults to the qps, rounded up.
+func ParseLimits(settings []string) (map[string]Limit, error) {
+	ret := map[string]Limit{}
+	for _, setting := range settings {
+		tokens := strings.SplitN(setting, "=", 2)
+		if len(tokens) != 2 || tokens[0] == "" {
+			return nil, fmt.Errorf("invalid workspace rate limit, expected <logical cluster>=<qps>[/<burst>]: %s", setting)
+		}
+		if _, _, err := helper.ParseLogicalClusterName(tokens[0]); err != nil {
+			return nil, fmt.Errorf("invalid workspace rate limit %s: %w", setting, err)
+		}
+		rates := strings.SplitN(tokens[1], "/", 2)
+		qps, err := strconv.ParseFloat(rates[0], 32)
+		if err != nil || qps <= 0 {
+			return nil, fmt.Errorf("invalid workspace rate limit %s: qps must be a positive number", setting)
+		}
+		limit := Limit{QPS: float32(qps), Burst: int(math.Ceil(qps))}
+		if len(rates) == 2 {
+			if limit.Burst, err = strconv.Atoi(rates[1]); err != nil || limit.Burst <= 0 {
+				return nil, fmt.Errorf("invalid workspace rate limit %s: burst must be a positive integer", setting)
+			}
+		}
+		ret[tokens[0]] = limit
+	}
+	return ret, nil
+}
+
+// Limiter holds a token bucket per workspace, or per user and workspace, limited.
+type Limiter struct {
+	limits  map[string]Limit
+	perUser bool
+
+	lock sync.Mutex
+	// buckets are the flowcontrol.RateLimiters by workspace, or by workspace and user.
+	buckets *utilcache.LRUExpireCache
+}
+
+// NewLimiter returns a Limiter enforcing the given limits by logical cluster, per user of
+// every workspace if perUser is true, with at most maxBuckets token buckets.
+func NewLimiter(limits map[string]Limit, perUser bool, maxBuckets int) *Limiter {
+	return &Limiter{
+		limits:  limits,
+		perUser: perUser,
+		buckets: utilcache.NewLRUExpireCache(maxBuckets),
+	}
+}
+
+// limitFor returns the limit of the given logical cluster or of its closest ancestor.
+// System logical clusters are not limited.
+func (l *Limiter) limitFor(clusterName string) (Limit, bool) {
+	if strings.HasPrefix(clusterName, helper.LocalSystemClusterPrefix) {
+		return Limit{}, false
+	}
+	for {
+		if limit, ok := l.limits[clusterName]; ok {
+			return limit, true
+		}
+		if clusterName == helper.RootCluster {
+			return Limit{}, false
+		}
+		parent, err := helper.ParentClusterName(clusterName)
+		if err != nil {
+			return Limit{}, false
+		}
+		clusterName = parent
+	}
+}
+
+// Accept takes a token from the bucket of the given user in the given logical cluster. If
+// none is left, it returns false with the number of seconds after which to retry.
+func (l *Limiter) Accept(clusterName, userName string) (bool, int) {
+	limit, ok := l.limitFor(clusterName)
+	if !ok {
+		return true, 0
+	}
+	key := clusterName
+	if l.perUser {
+		key += "|" + userName
+	}
+
+	// an idle bucket is full again after burst/qps, such that evicting it then loses nothing
+	idle := time.Duration(float64(limit.Burst) / float64(limit.QPS) * float64(time.Second))
+	l.lock.Lock()
+	var bucket flowcontrol.RateLimiter
+	if cached, ok := l.buckets.Get(key); ok && cached.(*limitedBucket).limit == limit {
+		bucket = cached.(*limitedBucket).RateLimiter
+	} else {
+		bucket = flowcontrol.NewTokenBucketRateLimiter(limit.QPS, limit.Burst)
+	}
+	l.buckets.Add(key, &limitedBucket{RateLimiter: bucket, limit: limit}, idle)
+	l.lock.Unlock()
+
+	if bucket.TryAccept() {
+		return true, 0
+	}
+	return false, int(math.Max(1, math.Ceil(1/float64(limit.QPS))))
+}
+
+// limitedBucket is a token bucket along with the limit it was created for.
+type limitedBucket struct {
+	flowcontrol.RateLimiter
+	limit Limit
+}
+
+// WithWorkspaceRateLimits rejects the requests exceeding the rate limit of their workspace
+// with 429 Too Many Requests and a Retry-After header. Requests of privileged users, i.e.
+// of kcp itself, and wildcard requests across logical clusters are not limited.
+func WithWorkspaceRateLimits(handler http.Handler, limiter *Limiter) http.Handler {
+	if limiter == nil || len(limiter.limits) == 0 {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		cluster := genericapirequest.ClusterFrom(req.Context())
+		if cluster == nil || cluster.Wildcard {
+			handler.ServeHTTP(w, req)
+			return
+		}
+		var userName string
+		if u, ok := genericapirequest.UserFrom(req.Context()); ok {
+			for _, group := range u.GetGroups() {
+				if group == user.SystemPrivilegedGroup {
+					handler.ServeHTTP(w, req)
+					return
+				}
+			}
+			userName = u.GetName()
+		}
+
+		if ok, retryAfter := limiter.Accept(cluster.Name, userName); !ok {
+			responsewriters.ErrorNegotiated(
+				apierrors.NewTooManyRequests(fmt.Sprintf("too many requests to workspace %s, please try again later", cluster.Name), retryAfter),
+				errorCodecs, schema.GroupVersion{}, w, req,
+			)
+			return
+		}
+		handler.ServeHTTP(w, req)
+	})
+}
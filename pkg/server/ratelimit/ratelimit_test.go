@@ -0,0 +1,104 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/apiserver/pkg/authentication/user"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+)
+
+func TestParseLimits(t *testing.T) {
+	limits, err := ParseLimits([]string{"root=100", "root:org=0.5/10", "org:team=2.5"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]Limit{
+		"root":     {QPS: 100, Burst: 100},
+		"root:org": {QPS: 0.5, Burst: 10},
+		"org:team": {QPS: 2.5, Burst: 3},
+	}, limits)
+
+	for _, setting := range []string{"root", "=10", "root=", "root=0", "root=-1", "root=10/0", "root=10/1.5", "a:b:c=10"} {
+		_, err := ParseLimits([]string{setting})
+		require.Error(t, err, setting)
+	}
+}
+
+func TestLimitFor(t *testing.T) {
+	l := NewLimiter(map[string]Limit{
+		"root":     {QPS: 100, Burst: 100},
+		"root:org": {QPS: 10, Burst: 20},
+	}, false, 10)
+
+	for clusterName, expected := range map[string]*Limit{
+		"root":         {QPS: 100, Burst: 100},
+		"root:other":   {QPS: 100, Burst: 100},
+		"other:team":   {QPS: 100, Burst: 100},
+		"root:org":     {QPS: 10, Burst: 20},
+		"org:team":     {QPS: 10, Burst: 20},
+		"system:admin": nil,
+	} {
+		limit, ok := l.limitFor(clusterName)
+		if expected == nil {
+			require.False(t, ok, clusterName)
+			continue
+		}
+		require.True(t, ok, clusterName)
+		require.Equal(t, *expected, limit, clusterName)
+	}
+}
+
+func TestWithWorkspaceRateLimits(t *testing.T) {
+	handler := func(perUser bool) http.Handler {
+		limiter := NewLimiter(map[string]Limit{"root:org": {QPS: 0.1, Burst: 2}}, perUser, 10)
+		return WithWorkspaceRateLimits(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}), limiter)
+	}
+	serve := func(h http.Handler, cluster genericapirequest.Cluster, u user.Info) *httptest.ResponseRecorder {
+		ctx := genericapirequest.WithCluster(genericapirequest.NewContext(), cluster)
+		ctx = genericapirequest.WithUser(ctx, u)
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/namespaces", nil).WithContext(ctx)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+	alice := &user.DefaultInfo{Name: "alice"}
+	bob := &user.DefaultInfo{Name: "bob"}
+	admin := &user.DefaultInfo{Name: "admin", Groups: []string{user.SystemPrivilegedGroup}}
+	team := genericapirequest.Cluster{Name: "org:team"}
+	other := genericapirequest.Cluster{Name: "org:other"}
+
+	h := handler(false)
+	require.Equal(t, http.StatusOK, serve(h, team, alice).Code)
+	require.Equal(t, http.StatusOK, serve(h, team, bob).Code)
+	w := serve(h, team, alice)
+	require.Equal(t, http.StatusTooManyRequests, w.Code, "the burst of the workspace is exhausted")
+	require.Equal(t, "10", w.Header().Get("Retry-After"))
+	require.Equal(t, http.StatusOK, serve(h, other, alice).Code, "every workspace is limited separately")
+	require.Equal(t, http.StatusOK, serve(h, team, admin).Code, "privileged users are not limited")
+	require.Equal(t, http.StatusOK, serve(h, genericapirequest.Cluster{Name: "root:other"}, alice).Code, "workspaces without limit are not limited")
+	require.Equal(t, http.StatusOK, serve(h, genericapirequest.Cluster{Name: "system:admin", Wildcard: true}, alice).Code, "wildcard requests are not limited")
+
+	h = handler(true)
+	require.Equal(t, http.StatusOK, serve(h, team, alice).Code)
+	require.Equal(t, http.StatusOK, serve(h, team, alice).Code)
+	require.Equal(t, http.StatusTooManyRequests, serve(h, team, alice).Code)
+	require.Equal(t, http.StatusOK, serve(h, team, bob).Code, "every user of a workspace is limited separately")
+}
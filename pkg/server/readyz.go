@@ -0,0 +1,206 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	genericapiserver "k8s.io/apiserver/pkg/server"
+	"k8s.io/apiserver/pkg/server/healthz"
+	"k8s.io/klog/v2"
+)
+
+// cacheSyncWaiter is implemented by all the shared informer factories.
+type cacheSyncWaiter interface {
+	WaitForCacheSync(stopCh <-chan struct{}) map[reflect.Type]bool
+}
+
+// newInformerSyncCheck returns a readyz check failing as long as one of the started informers
+// of the given factory has not synced. The unsynced informers are reported per API group.
+func newInformerSyncCheck(name string, factory cacheSyncWaiter) healthz.HealthChecker {
+	return healthz.NamedCheck("informer-sync-"+name, func(_ *http.Request) error {
+		// a closed channel makes WaitForCacheSync return the current state without waiting
+		stopCh := make(chan struct{})
+		close(stopCh)
+
+		unsynced := map[string][]string{}
+		for informerType, synced := range factory.WaitForCacheSync(stopCh) {
+			if !synced {
+				groupVersion, kind := informerGroupVersionKind(informerType)
+				unsynced[groupVersion] = append(unsynced[groupVersion], kind)
+			}
+		}
+		if len(unsynced) == 0 {
+			return nil
+		}
+
+		groupVersions := make([]string, 0, len(unsynced))
+		for groupVersion, kinds := range unsynced {
+			sort.Strings(kinds)
+			groupVersions = append(groupVersions, fmt.Sprintf("%s (%s)", groupVersion, strings.Join(kinds, ", ")))
+		}
+		sort.Strings(groupVersions)
+		return fmt.Errorf("informers not synced: %s", strings.Join(groupVersions, "; "))
+	})
+}
+
+// informerGroupVersionKind derives the group and version of the objects of an informer from
+// the package they are defined in, e.g. tenancy/v1alpha1 and ClusterWorkspace for
+// *github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1.ClusterWorkspace.
+func informerGroupVersionKind(t reflect.Type) (string, string) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	segments := strings.Split(t.PkgPath(), "/")
+	if len(segments) < 2 {
+		return t.PkgPath(), t.Name()
+	}
+	return strings.Join(segments[len(segments)-2:], "/"), t.Name()
+}
+
+// controllerHooks tracks the post-start hooks starting the kcp controllers, such that
+// /readyz tells which controllers are not started yet.
+type controllerHooks struct {
+	lock    sync.Mutex
+	pending sets.String
+}
+
+func newControllerHooks() *controllerHooks {
+	return &controllerHooks{
+		pending: sets.NewString(),
+	}
+}
+
+func (h *controllerHooks) add(name string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.pending.Insert(name)
+}
+
+func (h *controllerHooks) done(name string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.pending.Delete(name)
+}
+
+func (h *controllerHooks) Name() string {
+	return "kcp-controllers-started"
+}
+
+func (h *controllerHooks) Check(_ *http.Request) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.pending.Len() > 0 {
+		return fmt.Errorf("controllers not started yet: %s", strings.Join(h.pending.List(), ", "))
+	}
+	return nil
+}
+
+// addControllerPostStartHook adds a post-start hook starting controllers to the server, and
+// tracks whether it has run in the kcp-controllers-started readyz check.
+func (s *Server) addControllerPostStartHook(server *genericapiserver.GenericAPIServer, name string, hook genericapiserver.PostStartHookFunc) error {
+	s.controllerHooks.add(name)
+	return server.AddPostStartHook(name, func(hookContext genericapiserver.PostStartHookContext) error {
+		if err := hook(hookContext); err != nil {
+			return err
+		}
+		s.controllerHooks.done(name)
+		return nil
+	})
+}
+
+// bootstrapSteps runs the idempotent steps bootstrapping the system resources of the shard
+// in parallel, and tracks them such that /readyz tells which ones are pending.
+type bootstrapSteps struct {
+	lock    sync.Mutex
+	steps   map[string]func(ctx context.Context) error
+	pending sets.String
+}
+
+func newBootstrapSteps() *bootstrapSteps {
+	return &bootstrapSteps{
+		steps:   map[string]func(ctx context.Context) error{},
+		pending: sets.NewString(),
+	}
+}
+
+// add adds a step. A step blocks until it succeeded, and only fails when the context is done.
+func (b *bootstrapSteps) add(name string, step func(ctx context.Context) error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.steps[name] = step
+	b.pending.Insert(name)
+}
+
+// run runs the pending steps in parallel, and returns when all of them are done.
+func (b *bootstrapSteps) run(ctx context.Context) error {
+	b.lock.Lock()
+	steps := make(map[string]func(ctx context.Context) error, b.pending.Len())
+	for _, name := range b.pending.UnsortedList() {
+		steps[name] = b.steps[name]
+	}
+	b.lock.Unlock()
+
+	errs := make(chan error, len(steps))
+	var wg sync.WaitGroup
+	for name, step := range steps {
+		wg.Add(1)
+		go func(name string, step func(ctx context.Context) error) {
+			defer wg.Done()
+			start := time.Now()
+			if err := step(ctx); err != nil {
+				errs <- fmt.Errorf("failed to bootstrap %s: %w", name, err)
+				return
+			}
+			klog.Infof("Bootstrapped %s after %s", name, time.Since(start))
+
+			b.lock.Lock()
+			defer b.lock.Unlock()
+			b.pending.Delete(name)
+		}(name, step)
+	}
+	wg.Wait()
+	close(errs)
+
+	var all []error
+	for err := range errs {
+		all = append(all, err)
+	}
+	return utilerrors.NewAggregate(all)
+}
+
+func (b *bootstrapSteps) Name() string {
+	return "kcp-bootstrap"
+}
+
+func (b *bootstrapSteps) Check(_ *http.Request) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.pending.Len() > 0 {
+		return fmt.Errorf("bootstrap not done yet: %s", strings.Join(b.pending.List(), ", "))
+	}
+	return nil
+}
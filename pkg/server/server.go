@@ -28,28 +28,64 @@ import (
 	apiextensionsexternalversions "k8s.io/apiextensions-apiserver/pkg/client/informers/externalversions"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apiserver/pkg/admission"
+	webhookinit "k8s.io/apiserver/pkg/admission/plugin/webhook/initializer"
+	authenticatorunion "k8s.io/apiserver/pkg/authentication/request/union"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
 	genericapiserver "k8s.io/apiserver/pkg/server"
+	"k8s.io/apiserver/pkg/server/healthz"
 	"k8s.io/apiserver/pkg/util/webhook"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
 	coreexternalversions "k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
-	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/klog/v2"
 	"k8s.io/kubernetes/pkg/genericcontrolplane"
 
 	configroot "github.com/kcp-dev/kcp/config/root"
+	configsystemexports "github.com/kcp-dev/kcp/config/systemexports"
+	kcpadmissionhelpers "github.com/kcp-dev/kcp/pkg/admission/helpers"
 	kcpadmissioninitializers "github.com/kcp-dev/kcp/pkg/admission/initializers"
+	"github.com/kcp-dev/kcp/pkg/aggregator"
 	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+	kcpaudit "github.com/kcp-dev/kcp/pkg/audit"
+	"github.com/kcp-dev/kcp/pkg/authentication"
 	bootstrappolicy "github.com/kcp-dev/kcp/pkg/authorization/bootstrap"
 	kcpclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
 	kcpexternalversions "github.com/kcp-dev/kcp/pkg/client/informers/externalversions"
 	"github.com/kcp-dev/kcp/pkg/etcd"
+	"github.com/kcp-dev/kcp/pkg/home"
+	"github.com/kcp-dev/kcp/pkg/informer"
+	"github.com/kcp-dev/kcp/pkg/objectcount"
+	"github.com/kcp-dev/kcp/pkg/reconciler/boundcrds"
+	reconcilermetrics "github.com/kcp-dev/kcp/pkg/reconciler/metrics"
+	"github.com/kcp-dev/kcp/pkg/server/discoverycache"
+	"github.com/kcp-dev/kcp/pkg/server/encryption"
+	"github.com/kcp-dev/kcp/pkg/server/exportidentity"
+	kcpflowcontrol "github.com/kcp-dev/kcp/pkg/server/flowcontrol"
+	"github.com/kcp-dev/kcp/pkg/server/maintenance"
+	kcpmetrics "github.com/kcp-dev/kcp/pkg/server/metrics"
+	"github.com/kcp-dev/kcp/pkg/server/openapiv3"
 	kcpserveroptions "github.com/kcp-dev/kcp/pkg/server/options"
+	"github.com/kcp-dev/kcp/pkg/server/ratelimit"
+	"github.com/kcp-dev/kcp/pkg/server/serviceresolver"
+	"github.com/kcp-dev/kcp/pkg/server/snapshot"
+	"github.com/kcp-dev/kcp/pkg/server/streams"
+	"github.com/kcp-dev/kcp/pkg/server/tenancyconversion"
+	"github.com/kcp-dev/kcp/pkg/server/watchcache"
+	"github.com/kcp-dev/kcp/pkg/shardcerts"
 	"github.com/kcp-dev/kcp/pkg/sharding"
+	"github.com/kcp-dev/kcp/pkg/syncer/bundle"
+	"github.com/kcp-dev/kcp/pkg/tracing"
+	"github.com/kcp-dev/kcp/pkg/tunneler"
+	"github.com/kcp-dev/kcp/pkg/workspacetype"
 )
 
 const resyncPeriod = 10 * time.Hour
 
+// shardIndexTTL is how long the shard of a logical cluster is cached when routing streams.
+const shardIndexTTL = 30 * time.Second
+
 // Server manages the configuration and kcp api-server. It allows callers to easily use kcp
 // as a library rather than as a single binary. Using its constructor function, you can easily
 // setup a new api-server and start it:
@@ -70,7 +106,8 @@ type Server struct {
 	postStartHooks   []postStartHookEntry
 	preShutdownHooks []preShutdownHookEntry
 
-	syncedCh chan struct{}
+	syncedCh        chan struct{}
+	controllerHooks *controllerHooks
 
 	kcpSharedInformerFactory           kcpexternalversions.SharedInformerFactory
 	rootKcpSharedInformerFactory       kcpexternalversions.SharedInformerFactory
@@ -82,8 +119,9 @@ type Server struct {
 // NewServer creates a new instance of Server which manages the KCP api-server.
 func NewServer(o *kcpserveroptions.CompletedOptions) (*Server, error) {
 	return &Server{
-		options:  o,
-		syncedCh: make(chan struct{}),
+		options:         o,
+		syncedCh:        make(chan struct{}),
+		controllerHooks: newControllerHooks(),
 	}, nil
 }
 
@@ -139,6 +177,50 @@ func (s *Server) Run(ctx context.Context) error {
 		s.options.GenericControlPlane.Etcd.StorageConfig.Transport.TrustedCAFile = embeddedClientInfo.TrustedCAFile
 	}
 
+	reconcilermetrics.SetClusterLabeling(s.options.Extra.LogicalClusterMetricsAllowList, s.options.Extra.LogicalClusterMetricsTopN)
+	watchcache.SetClusterLabeling(s.options.Extra.LogicalClusterMetricsAllowList, s.options.Extra.LogicalClusterMetricsTopN)
+
+	// the certificates issued by the shard CA are written before the server loads them
+	if s.options.ShardCertificates.Enabled() {
+		// only the root shard holds the key of the shard CA, the other shards request their
+		// certificates from it
+		var source shardcerts.Source
+		if s.options.ShardCertificates.CAKeyFile != "" {
+			issuer, err := shardcerts.LoadIssuer(s.options.ShardCertificates.CAFile, s.options.ShardCertificates.CAKeyFile)
+			if err != nil {
+				return fmt.Errorf("failed to load the shard CA: %w", err)
+			}
+			source = issuer
+		} else {
+			rootConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(&clientcmd.ClientConfigLoadingRules{ExplicitPath: s.options.Extra.RootShardKubeconfigFile}, nil).ClientConfig()
+			if err != nil {
+				return fmt.Errorf("failed to load root shard kubeconfig: %w", err)
+			}
+			rootKubeClusterClient, err := kubernetes.NewClusterForConfig(rootConfig)
+			if err != nil {
+				return err
+			}
+			requester, err := shardcerts.LoadRequester(s.options.ShardCertificates.CAFile, rootKubeClusterClient.Cluster(helper.RootCluster).CertificatesV1().CertificateSigningRequests(), s.options.Extra.ShardName)
+			if err != nil {
+				return fmt.Errorf("failed to load the shard CA: %w", err)
+			}
+			source = requester
+		}
+		rotator := shardcerts.NewRotator(
+			source,
+			s.options.ShardCertificates.Directory,
+			s.options.Extra.ShardName,
+			shardcerts.Hosts(s.options.GenericControlPlane.GenericServerRunOptions.ExternalHost, s.options.GenericControlPlane.GenericServerRunOptions.AdvertiseAddress),
+			s.options.ShardCertificates.UserClientCAFile,
+			s.options.ShardCertificates.Validity,
+			s.options.ShardCertificates.CAKeyFile != "",
+		)
+		if err := rotator.Rotate(); err != nil {
+			return fmt.Errorf("failed to issue the shard certificates: %w", err)
+		}
+		go rotator.Run(ctx)
+	}
+
 	genericConfig, storageFactory, err := genericcontrolplane.BuildGenericConfig(s.options.GenericControlPlane)
 	if err != nil {
 		return err
@@ -174,6 +256,11 @@ func (s *Server) Run(ctx context.Context) error {
 	s.rootKcpSharedInformerFactory = kcpexternalversions.NewSharedInformerFactoryWithOptions(kcpClusterClient.Cluster(helper.RootCluster), resyncPeriod)
 	s.rootKubeSharedInformerFactory = coreexternalversions.NewSharedInformerFactoryWithOptions(kubeClusterClient.Cluster(helper.RootCluster), resyncPeriod)
 
+	// Distinguish the APF flows of the tenants by logical cluster or organization
+	if genericConfig.FlowControl != nil {
+		genericConfig.FlowControl = kcpflowcontrol.WithTenantDistinguisher(genericConfig.FlowControl, s.kubeSharedInformerFactory.Flowcontrol().V1beta2().FlowSchemas())
+	}
+
 	// Setup dynamic client
 	dynamicClusterClient, err := dynamic.NewClusterForConfig(genericConfig.LoopbackClientConfig)
 	if err != nil {
@@ -183,10 +270,36 @@ func (s *Server) Run(ctx context.Context) error {
 	if err := s.options.Authorization.ApplyTo(genericConfig, s.kubeSharedInformerFactory, s.kcpSharedInformerFactory.Tenancy().V1alpha1().ClusterWorkspaces().Lister()); err != nil {
 		return err
 	}
+	var homeWorkspaces *home.Handler
+	if org := s.options.Extra.HomeWorkspacesOrganization; org != "" {
+		genericConfig.Authorization.Authorizer = home.NewAuthorizer(genericConfig.Authorization.Authorizer)
+		homeWorkspaces = home.NewHandler(org, s.kcpSharedInformerFactory.Tenancy().V1alpha1().ClusterWorkspaces().Lister(), kcpClusterClient, kubeClusterClient, genericConfig.Authorization.Authorizer)
+	}
 	newTokenOrEmpty, tokenHash, err := s.options.AdminAuthentication.ApplyTo(genericConfig)
 	if err != nil {
 		return err
 	}
+	syncerTokens, err := s.options.SyncerAuthentication.ApplyTo(genericConfig)
+	if err != nil {
+		return err
+	}
+	workspaceTokens, err := s.options.WorkspaceTokens.ApplyTo(genericConfig, s.kcpSharedInformerFactory.Tenancy().V1alpha1().ClusterWorkspaces().Lister())
+	if err != nil {
+		return err
+	}
+	if err := s.options.ClientCerts.ApplyTo(genericConfig); err != nil {
+		return err
+	}
+	if err := s.options.GenericControlPlane.Audit.ApplyTo(genericConfig); err != nil {
+		return err
+	}
+	if err := s.options.OrganizationAudit.ApplyTo(genericConfig); err != nil {
+		return err
+	}
+	genericConfig.Authentication.Authenticator = authenticatorunion.New(
+		genericConfig.Authentication.Authenticator,
+		authentication.NewWorkspaceAuthenticator(s.kcpSharedInformerFactory.Tenancy().V1alpha1().ClusterWorkspaces(), genericConfig.Authentication.APIAudiences),
+	)
 	servingOpts := s.options.GenericControlPlane.SecureServing
 	externalAddress, err := servingOpts.DefaultExternalAddress()
 	if err != nil {
@@ -196,35 +309,238 @@ func (s *Server) Run(ctx context.Context) error {
 		return err
 	}
 
+	podTunneler := tunneler.NewTunneler(s.kubeSharedInformerFactory.Core().V1().Namespaces().Lister())
+	externalCACert, _ := genericConfig.SecureServing.Cert.CurrentCertKeyContent()
+	syncerBundles := bundle.NewHandler(
+		s.kcpSharedInformerFactory.Workload().V1alpha1().WorkloadClusters().Lister(),
+		syncerTokens,
+		s.options.Controllers.Syncer.SyncerImage,
+		fmt.Sprintf("https://%s:%d", externalAddress.String(), servingOpts.BindPort),
+		externalCACert,
+		s.options.Controllers.ApiImporter.ResourcesToSync,
+	)
+	workspaceKubeconfigs := authentication.NewWorkspaceKubeconfigHandler(
+		s.kcpSharedInformerFactory.Tenancy().V1alpha1().ClusterWorkspaces().Lister(),
+		workspaceTokens,
+		genericConfig.Authorization.Authorizer,
+		fmt.Sprintf("https://%s:%d", externalAddress.String(), servingOpts.BindPort),
+		externalCACert,
+		s.options.WorkspaceTokens.MaxExpiration,
+	)
+	var shardClientLoader *sharding.ClientLoader
+	if s.options.Extra.EnableSharding {
+		shardClientLoader = sharding.NewClientLoader()
+		shardClientLoader.Add(s.options.GenericControlPlane.GenericServerRunOptions.ExternalHost, genericConfig.LoopbackClientConfig)
+		if s.options.Extra.ShardKubeconfigFile != "" {
+			if err := shardClientLoader.AddKubeConfigContexts(s.options.Extra.ShardKubeconfigFile); err != nil {
+				return err
+			}
+		}
+	}
+	var shardResolver sharding.ShardResolver
+	if shardClientLoader != nil && s.options.Streaming.ShardIndexURL != "" {
+		shardResolver = sharding.NewIndexResolver(s.options.Streaming.ShardIndexURL, &http.Client{Timeout: s.options.Streaming.HandshakeTimeout}, shardIndexTTL)
+	}
+	// upgraded connections escape the request timeouts and the graceful shutdown of the
+	// HTTP server, they are tracked to be closed when idle and drained on shutdown.
+	streamTracker := streams.NewTracker(s.options.Streaming.IdleTimeout)
+	go streamTracker.Run(ctx)
+	s.AddPreShutdownHook("kcp-drain-streams", func() error {
+		streamTracker.Drain(s.options.Streaming.DrainTimeout)
+		return nil
+	})
+	rateLimits, err := ratelimit.ParseLimits(s.options.RateLimits.Limits)
+	if err != nil {
+		return err
+	}
+	rateLimiter := ratelimit.NewLimiter(rateLimits, s.options.RateLimits.PerUser, ratelimit.DefaultMaxBuckets)
+	var snapshots *snapshot.Handler
+	var quiescer *snapshot.Quiescer
+	if s.options.Snapshots.Directory != "" {
+		etcdClient, err := s.newEtcdClient()
+		if err != nil {
+			return err
+		}
+		go func() {
+			<-ctx.Done()
+			etcdClient.Close() // nolint: errcheck
+		}()
+		quiescer = snapshot.NewQuiescer()
+		snapshots = snapshot.NewHandler(
+			s.kcpSharedInformerFactory.Tenancy().V1alpha1().ClusterWorkspaces().Lister(),
+			snapshot.NewSnapshotter(
+				etcdClient,
+				s.options.GenericControlPlane.Etcd.StorageConfig.Prefix,
+				quiescer,
+				s.options.Snapshots.QuiesceTimeout,
+				snapshot.NewDirectorySink(s.options.Snapshots.Directory),
+			),
+			s.options.Extra.ShardName,
+		)
+	}
+
+	// the Services called by the admission and conversion webhooks of workspaces are dialed at
+	// their endpoint in the logical cluster of the request, e.g. the Service synced to the
+	// physical cluster, instead of their cluster DNS name.
+	webhookServiceResolver, err := serviceresolver.NewSyncedServiceResolver(
+		s.kubeSharedInformerFactory.Core().V1().Namespaces().Lister(),
+		s.options.WebhookServices.EndpointTemplate,
+	)
+	if err != nil {
+		return err
+	}
+
+	// the APIServices of workspaces are proxied to their extension apiserver, behind the Service
+	// of the APIService resolved like the Services of webhooks.
+	apiServiceInformers := dynamicinformer.NewDynamicSharedInformerFactory(dynamicClusterClient.Cluster(crossCluster), resyncPeriod)
+	apiServiceInformer := apiServiceInformers.ForResource(aggregator.APIServicesGVR)
+	apiServiceLister, err := aggregator.NewLister(apiServiceInformer.Informer())
+	if err != nil {
+		return err
+	}
+	apiServiceTransports, err := aggregator.NewTransports(webhookServiceResolver, s.options.GenericControlPlane.ProxyClientCertFile, s.options.GenericControlPlane.ProxyClientKeyFile)
+	if err != nil {
+		return err
+	}
+	aggregatedAPIs := aggregator.NewHandler(apiServiceLister, apiServiceTransports)
+
+	// the OpenAPI v3 of workspaces is cached like their bound APIs, and installed once the
+	// server chain is created.
+	openAPIV3 := openapiv3.NewService(s.options.Extra.BoundAPIsCacheSize, s.options.Extra.BoundAPIsIdleTimeout)
+
+	// the discovery of workspaces is cached like their bound APIs too, until the APIs they
+	// serve change.
+	discoveryCache, err := discoverycache.NewCache(
+		s.apiextensionsSharedInformerFactory.Apiextensions().V1().CustomResourceDefinitions(),
+		s.kcpSharedInformerFactory.Tenancy().V1alpha1().ClusterWorkspaces(),
+		s.kcpSharedInformerFactory.Apis().V1alpha1().APIBindings(),
+		s.options.Extra.BoundAPIsCacheSize,
+		s.options.Extra.BoundAPIsIdleTimeout,
+	)
+	if err != nil {
+		return err
+	}
+
 	genericConfig.BuildHandlerChainFunc = func(apiHandler http.Handler, c *genericapiserver.Config) (secure http.Handler) {
 		// we want a request to hit the chain like:
 		// - lcluster handler (this package's ServeHTTP)
+		// - home workspace resolution (home.WithHomeWorkspaces)
+		// - workspace maintenance (maintenance.WithMaintenance)
+		// - workspace rate limits (ratelimit.WithWorkspaceRateLimits)
+		// - workspace snapshots (snapshot.Handler.WithSnapshots)
+		// - write quiescing of workspaces being snapshotted (snapshot.WithQuiesce)
+		// - stream tracking (streams.WithStreamTracking)
+		// - stream routing to the shard of the logical cluster (sharding.WithStreamingProxy)
+		// - syncer tunnels (tunneler.WithTunnels)
+		// - aggregated APIs of the APIServices of workspaces (aggregator.Handler.WithAggregatedAPIs)
+		// - cached and aggregated discovery of workspaces (discoverycache.Cache.WithDiscoveryCache)
+		// - OpenAPI v3 of workspaces (openapiv3.Service.WithOpenAPIV3)
 		// - shard proxy (sharding.ServeHTTP)
 		// - original handler chain
 		// the lcluster handler is a pass-through, not a delegate, so the wrapping looks weird
-		if s.options.Extra.EnableSharding {
-			clientLoader := sharding.NewClientLoader()
-			clientLoader.Add(s.options.GenericControlPlane.GenericServerRunOptions.ExternalHost, genericConfig.LoopbackClientConfig)
-			apiHandler = sharding.WithSharding(apiHandler, clientLoader)
+		if shardClientLoader != nil {
+			apiHandler = sharding.WithSharding(apiHandler, shardClientLoader)
 		}
 		apiHandler = WithWildcardListWatchGuard(apiHandler)
-		apiHandler = WithClusterScope(genericapiserver.DefaultBuildHandlerChain(apiHandler, c))
+		apiHandler = openAPIV3.WithOpenAPIV3(apiHandler)
+		apiHandler = discoveryCache.WithDiscoveryCache(apiHandler)
+		apiHandler = aggregatedAPIs.WithAggregatedAPIs(apiHandler)
+		apiHandler = podTunneler.WithTunnels(apiHandler)
+		if shardResolver != nil {
+			apiHandler = sharding.WithStreamingProxy(apiHandler, shardResolver, shardClientLoader, s.options.Extra.ShardName, s.options.Streaming.HandshakeTimeout)
+		}
+		apiHandler = streams.WithStreamTracking(apiHandler, streamTracker)
+		apiHandler = syncerBundles.WithSyncerBundles(apiHandler)
+		apiHandler = workspaceKubeconfigs.WithWorkspaceKubeconfigs(apiHandler)
+		if snapshots != nil {
+			apiHandler = snapshot.WithQuiesce(apiHandler, quiescer)
+			apiHandler = snapshots.WithSnapshots(apiHandler)
+		}
+		apiHandler = ratelimit.WithWorkspaceRateLimits(apiHandler, rateLimiter)
+		apiHandler = maintenance.WithMaintenance(apiHandler, s.kcpSharedInformerFactory.Tenancy().V1alpha1().ClusterWorkspaces().Lister())
+		if homeWorkspaces != nil {
+			apiHandler = homeWorkspaces.WithHomeWorkspaces(apiHandler)
+		}
+		apiHandler = tracing.WithWorkspaceAttributes(apiHandler)
+		apiHandler = genericapiserver.DefaultBuildHandlerChain(apiHandler, c)
+		apiHandler = kcpmetrics.WithLogicalClusterMetrics(apiHandler, s.options.Extra.LogicalClusterMetricsAllowList, s.options.Extra.LogicalClusterMetricsTopN, c.RequestInfoResolver)
+		if c.AuditBackend != nil {
+			apiHandler = kcpaudit.WithWorkspaceAnnotations(apiHandler, s.kcpSharedInformerFactory.Tenancy().V1alpha1().ClusterWorkspaces().Lister())
+		}
+		apiHandler = WithClusterScope(apiHandler)
 
 		return apiHandler
 	}
 
+	// ClusterWorkspaceTypes are resolved once per logical cluster and type name, for all admission plugins
+	// and the workspace scheduler.
+	workspaceTypeResolver, err := workspacetype.NewResolver(s.kcpSharedInformerFactory.Tenancy().V1alpha1().ClusterWorkspaceTypes(), workspacetype.DefaultMaxResolutions)
+	if err != nil {
+		return err
+	}
+
+	// objects are counted per logical cluster and resource for the object count quota and
+	// the WorkspaceResourceQuotas built on it, fed by the informers started after the server is up.
+	objectCounter := objectcount.NewCounter()
+
+	defaultWebhookAuthResolverWrapper := webhook.NewDefaultAuthenticationInfoResolverWrapper(
+		nil,
+		genericConfig.EgressSelector,
+		genericConfig.LoopbackClientConfig,
+		genericConfig.TracerProvider,
+	)
+	webhookServiceResolverWrapper := serviceresolver.NewAuthenticationInfoResolverWrapper(webhookServiceResolver)
+	webhookAuthResolverWrapper := func(delegate webhook.AuthenticationInfoResolver) webhook.AuthenticationInfoResolver {
+		return webhookServiceResolverWrapper(defaultWebhookAuthResolverWrapper(delegate))
+	}
+
+	tenancyConversionResolverWrapper := tenancyconversion.NewAuthenticationInfoResolverWrapper()
+
 	admissionPluginInitializers := []admission.PluginInitializer{
+		webhookinit.NewPluginInitializer(webhookAuthResolverWrapper, webhook.NewDefaultServiceResolver()),
 		kcpadmissioninitializers.NewKcpInformersInitializer(s.kcpSharedInformerFactory),
 		kcpadmissioninitializers.NewKubeClusterClientInitializer(kubeClusterClient),
 		kcpadmissioninitializers.NewKcpClusterClientInitializer(kcpClusterClient),
+		kcpadmissioninitializers.NewAPIExtensionsInformersInitializer(s.apiextensionsSharedInformerFactory),
+		kcpadmissioninitializers.NewClusterWorkspaceTypeResolverInitializer(workspaceTypeResolver),
+		kcpadmissioninitializers.NewObjectCounterInitializer(objectCounter),
+	}
+
+	// record the kcp admission plugins waiting for informers, for /readyz. This must be the
+	// first decorator, as the others hide the plugin type.
+	admissionReadiness := kcpadmissionhelpers.NewReadinessTracker()
+	s.options.GenericControlPlane.Admission.Decorators = append(admission.Decorators{admissionReadiness.Decorator()}, s.options.GenericControlPlane.Admission.Decorators...)
+
+	// encrypt the data of the workspaces with their own encryption provider configuration at rest.
+	encryptionConfig, err := encryption.NewConfig(s.options.Encryption.ProviderConfigs)
+	if err != nil {
+		return err
 	}
+	genericConfig.RESTOptionsGetter = encryptionConfig.RESTOptionsGetter(genericConfig.RESTOptionsGetter)
+	genericConfig.AddHealthChecks(encryptionConfig.HealthChecks()...)
+
+	// decide the watch cache per resource and workspace type, for the built-in resources and the
+	// resources served by CRDs alike.
+	watchCacheConfig, err := watchcache.NewConfig(s.options.GenericControlPlane.Etcd, s.options.WatchCache.WorkspaceTypeSizes, s.kcpSharedInformerFactory.Tenancy().V1alpha1().ClusterWorkspaces().Lister())
+	if err != nil {
+		return err
+	}
+	genericConfig.RESTOptionsGetter = watchCacheConfig.RESTOptionsGetter(genericConfig.RESTOptionsGetter)
 
 	apisConfig, err := genericcontrolplane.CreateKubeAPIServerConfig(genericConfig, s.options.GenericControlPlane, s.kubeSharedInformerFactory, admissionPluginInitializers, storageFactory)
 	if err != nil {
 		return err
 	}
+	longRunningFunc := apisConfig.GenericConfig.LongRunningFunc
+	apisConfig.GenericConfig.LongRunningFunc = func(r *http.Request, requestInfo *genericapirequest.RequestInfo) bool {
+		// snapshots of large workspaces outlast the timeout of short requests
+		return tunneler.IsTunnelRequest(requestInfo) || snapshot.IsSnapshotRequest(requestInfo) || longRunningFunc(r, requestInfo)
+	}
 
 	s.AddPostStartHook("kcp-bootstrap-policy", bootstrappolicy.Policy().EnsureRBACPolicy())
+	if genericConfig.FlowControl != nil {
+		s.AddPostStartHook("kcp-bootstrap-flowcontrol", kcpflowcontrol.EnsureTenantConfiguration)
+	}
 
 	// If additional API servers are added, they should be gated.
 	apiExtensionsConfig, err := genericcontrolplane.CreateAPIExtensionsConfig(
@@ -233,27 +549,41 @@ func (s *Server) Run(ctx context.Context) error {
 		admissionPluginInitializers,
 		s.options.GenericControlPlane,
 
-		// Wire in a ServiceResolver that always returns an error that ResolveEndpoint is not yet
-		// supported. The effect is that CRD webhook conversions are not supported and will always get an
-		// error.
-		&unimplementedServiceResolver{},
-
-		webhook.NewDefaultAuthenticationInfoResolverWrapper(
-			nil,
-			apisConfig.GenericConfig.EgressSelector,
-			apisConfig.GenericConfig.LoopbackClientConfig,
-			apisConfig.GenericConfig.TracerProvider,
-		),
+		// The Services of conversion webhooks are resolved by webhookAuthResolverWrapper, in the
+		// logical cluster of the CRD. The conversions of the tenancy CRDs run in-process.
+		webhook.NewDefaultServiceResolver(),
+		func(delegate webhook.AuthenticationInfoResolver) webhook.AuthenticationInfoResolver {
+			return tenancyConversionResolverWrapper(webhookAuthResolverWrapper(delegate))
+		},
 	)
 	if err != nil {
 		return fmt.Errorf("configure api extensions: %w", err)
 	}
+	apiExtensionsConfig.GenericConfig.RESTOptionsGetter = watchCacheConfig.RESTOptionsGetter(apiExtensionsConfig.GenericConfig.RESTOptionsGetter)
+	// Wildcard lists and watches of the bound resources are restricted to the bindings presenting
+	// the identity hash of the request.
+	identityBindings, err := exportidentity.NewBindings(s.kcpSharedInformerFactory.Apis().V1alpha1().APIBindings())
+	if err != nil {
+		return err
+	}
+	apiExtensionsConfig.ExtraConfig.CRDRESTOptionsGetter = identityBindings.RESTOptionsGetter(watchCacheConfig.RESTOptionsGetter(apiExtensionsConfig.ExtraConfig.CRDRESTOptionsGetter))
+	// The bound APIs of a workspace are resolved lazily on its first request, and evicted when idle.
+	boundCRDResolver, err := boundcrds.NewResolver(
+		s.kcpSharedInformerFactory.Apis().V1alpha1().APIBindings(),
+		s.kcpSharedInformerFactory.Apis().V1alpha1().APIResourceSchemas(),
+		s.options.Extra.BoundAPIsCacheSize,
+		s.options.Extra.BoundAPIsIdleTimeout,
+	)
+	if err != nil {
+		return err
+	}
 	apiExtensionsConfig.ExtraConfig.NewInformerFactoryFunc = func(client apiextensionsclient.Interface, resyncPeriod time.Duration) apiextensionsexternalversions.SharedInformerFactory {
 		// TODO could we use s.apiextensionsSharedInformerFactory (ignoring client & resyncPeriod) instead of creating a 2nd factory here?
 		f := apiextensionsexternalversions.NewSharedInformerFactory(client, resyncPeriod)
 		return &kcpAPIExtensionsSharedInformerFactory{
 			SharedInformerFactory: f,
 			workspaceLister:       s.kcpSharedInformerFactory.Tenancy().V1alpha1().ClusterWorkspaces().Lister(),
+			boundCRDResolver:      boundCRDResolver,
 		}
 	}
 	// TODO(ncdc): I thought I was going to need this, but it turns out this breaks the CRD controllers because they
@@ -281,6 +611,47 @@ func (s *Server) Run(ctx context.Context) error {
 			serverChain.GenericControlPlane.GenericAPIServer.Handler.GoRestfulContainer.ServeHTTP,
 		),
 	)
+	if err := openAPIV3.Install(
+		serverChain.CustomResourceDefinitions.Informers.Apiextensions().V1().CustomResourceDefinitions().Lister(),
+		serverChain.GenericControlPlane.GenericAPIServer.Handler.GoRestfulContainer.RegisteredWebServices(),
+		apisConfig.GenericConfig.OpenAPIConfig,
+	); err != nil {
+		return err
+	}
+
+	// the system resources of the shard, bootstrapped in parallel in the kcp-start-informers hook
+	bootstrapSteps := newBootstrapSteps()
+	bootstrapSteps.add("root-workspace", func(ctx context.Context) error {
+		// bootstrap root workspace, the shards register themselves with the shard-registration controller
+		return configroot.Bootstrap(ctx,
+			apiextensionsClusterClient.Cluster(helper.RootCluster),
+			dynamicClusterClient.Cluster(helper.RootCluster),
+		)
+	})
+	bootstrapSteps.add("system-exports", func(ctx context.Context) error {
+		// bootstrap the APIExports of kcp's own APIs in the root workspace
+		return configsystemexports.Bootstrap(ctx,
+			apiextensionsClusterClient.Cluster(helper.RootCluster),
+			kcpClusterClient.Cluster(helper.RootCluster),
+		)
+	})
+
+	readyzChecks := []healthz.HealthChecker{
+		newInformerSyncCheck("kcp", s.kcpSharedInformerFactory),
+		newInformerSyncCheck("kube", s.kubeSharedInformerFactory),
+		newInformerSyncCheck("apiextensions", s.apiextensionsSharedInformerFactory),
+		newInformerSyncCheck("root-kcp", s.rootKcpSharedInformerFactory),
+		newInformerSyncCheck("root-kube", s.rootKubeSharedInformerFactory),
+		s.controllerHooks,
+		admissionReadiness,
+		bootstrapSteps,
+	}
+	if shardClientLoader != nil {
+		readyzChecks = append(readyzChecks, sharding.NewConnectivityCheck(shardClientLoader, s.options.GenericControlPlane.GenericServerRunOptions.ExternalHost))
+	}
+	if err := server.AddReadyzChecks(readyzChecks...); err != nil {
+		return err
+	}
 
 	s.AddPostStartHook("kcp-start-informers", func(ctx genericapiserver.PostStartHookContext) error {
 		s.kubeSharedInformerFactory.Start(ctx.StopCh)
@@ -288,33 +659,15 @@ func (s *Server) Run(ctx context.Context) error {
 		s.kcpSharedInformerFactory.Start(ctx.StopCh)
 		s.rootKubeSharedInformerFactory.Start(ctx.StopCh)
 		s.rootKcpSharedInformerFactory.Start(ctx.StopCh)
+		apiServiceInformers.Start(ctx.StopCh)
 
 		s.apiextensionsSharedInformerFactory.WaitForCacheSync(ctx.StopCh)
 		// wait for CRD inheritance work through the custom informer
 		// TODO: merge with upper s.apiextensionsSharedInformerFactory
 		serverChain.CustomResourceDefinitions.Informers.WaitForCacheSync(ctx.StopCh)
 
-		// bootstrap root workspace with workspace shard
-		servingCert, _ := server.SecureServingInfo.Cert.CurrentCertKeyContent()
-		if err := configroot.Bootstrap(goContext(ctx),
-			apiextensionsClusterClient.Cluster(helper.RootCluster),
-			dynamicClusterClient.Cluster(helper.RootCluster),
-			"root",
-
-			// TODO(sttts): move away from loopback, use external advertise address, an external CA and an access header enabled client servingCert for authentication
-			clientcmdapi.Config{
-				Clusters: map[string]*clientcmdapi.Cluster{
-					// cross-cluster is the virtual cluster running by default
-					"shard": {
-						Server:                   "https://" + server.ExternalAddress,
-						CertificateAuthorityData: servingCert, // TODO(sttts): wire controller updating this when it changes, or use CA
-					},
-				},
-				Contexts: map[string]*clientcmdapi.Context{
-					"shard": {Cluster: "shard"},
-				},
-				CurrentContext: "shard",
-			}); err != nil {
+		// bootstrap the root workspace and the APIExports of kcp's own APIs in parallel
+		if err := bootstrapSteps.run(goContext(ctx)); err != nil {
 			// nolint:nilerr
 			return nil // don't klog.Fatal. This only happens when context is cancelled.
 		}
@@ -330,6 +683,34 @@ func (s *Server) Run(ctx context.Context) error {
 		return nil
 	})
 
+	// Always do a * list/watch. Only metadata is needed to count objects, so avoid caching
+	// full objects of every type across all logical clusters.
+	objectCounterConfig := asSystemComponent(server.LoopbackClientConfig, "system:kcp:object-counter", bootstrappolicy.SystemKcpSchedulerGroup)
+	objectCounterKubeClient, err := kubernetes.NewClusterForConfig(objectCounterConfig)
+	if err != nil {
+		return err
+	}
+	objectCounterMetadataClient, err := informer.NewWildcardMetadataClient(objectCounterConfig)
+	if err != nil {
+		return err
+	}
+	objectCounterInformers := informer.NewMetadataDiscoverySharedInformerFactory(
+		s.kcpSharedInformerFactory.Tenancy().V1alpha1().ClusterWorkspaces().Lister(),
+		objectCounterKubeClient.DiscoveryClient,
+		objectCounterMetadataClient,
+		func(interface{}) bool { return true },
+		objectCounter,
+		s.options.Extra.DiscoveryPollInterval,
+	)
+	s.AddPostStartHook("kcp-start-object-counter", func(ctx genericapiserver.PostStartHookContext) error {
+		if err := s.waitForSync(ctx.StopCh); err != nil {
+			// nolint:nilerr
+			return nil // don't klog.Fatal. This only happens when context is cancelled.
+		}
+		objectCounterInformers.Start(goContext(ctx))
+		return nil
+	})
+
 	// ========================================================================================================
 	// TODO: split apart everything after this line, into their own commands, optional launched in this process
 
@@ -357,13 +738,108 @@ func (s *Server) Run(ctx context.Context) error {
 		if err := s.installSyncerController(ctx, *loopbackKubeConfig, server); err != nil {
 			return err
 		}
+		if err := s.installSyncerHeartbeatController(ctx, *loopbackKubeConfig, server); err != nil {
+			return err
+		}
 		if err := s.installApiResourceController(ctx, apiextensionsClusterClient, *loopbackKubeConfig, server); err != nil {
 			return err
 		}
 	}
 
 	if s.options.Controllers.EnableAll || enabled.Has("workspace-scheduler") {
-		if err := s.installWorkspaceScheduler(ctx, *loopbackKubeConfig, server); err != nil {
+		if err := s.installWorkspaceScheduler(ctx, *loopbackKubeConfig, server, workspaceTypeResolver); err != nil {
+			return err
+		}
+	}
+
+	if s.options.Controllers.EnableAll || enabled.Has("apiexport-identity") {
+		if err := s.installAPIExportIdentityController(ctx, *loopbackKubeConfig, server); err != nil {
+			return err
+		}
+	}
+
+	if s.options.Controllers.EnableAll || enabled.Has("apibinding-conflicts") {
+		if err := s.installAPIBindingConflictsController(ctx, *loopbackKubeConfig, server); err != nil {
+			return err
+		}
+	}
+
+	if s.options.Controllers.EnableAll || enabled.Has("apibinding-upgrade") {
+		if err := s.installAPIBindingUpgradeController(ctx, *loopbackKubeConfig, server); err != nil {
+			return err
+		}
+	}
+
+	if s.options.Controllers.EnableAll || enabled.Has("apibinding-roles") {
+		if err := s.installAPIBindingRolesController(ctx, *loopbackKubeConfig, server); err != nil {
+			return err
+		}
+	}
+
+	if s.options.Controllers.EnableAll || enabled.Has("bound-crds") {
+		if err := s.installBoundCRDsController(ctx, *loopbackKubeConfig, server, boundCRDResolver); err != nil {
+			return err
+		}
+	}
+
+	if s.options.Controllers.EnableAll || enabled.Has("virtual-workspace-urls") {
+		if err := s.installVirtualWorkspaceURLsController(ctx, *loopbackKubeConfig, server); err != nil {
+			return err
+		}
+	}
+
+	if s.options.Controllers.EnableAll || enabled.Has("workspace-usage") {
+		if err := s.installWorkspaceUsageController(ctx, *loopbackKubeConfig, server); err != nil {
+			return err
+		}
+	}
+
+	if s.options.Controllers.EnableAll || enabled.Has("workspace-resource-quota") {
+		if err := s.installWorkspaceResourceQuotaController(ctx, *loopbackKubeConfig, server, objectCounter); err != nil {
+			return err
+		}
+	}
+
+	if s.options.Controllers.EnableAll || enabled.Has("workspace-deletion") {
+		if err := s.installWorkspaceDeletionController(ctx, server); err != nil {
+			return err
+		}
+	}
+
+	// the generic registries only add the orphan and foregroundDeletion finalizers with
+	// --enable-garbage-collector, which is then to be honored by a garbage collector.
+	if s.options.GenericControlPlane.Etcd.EnableGarbageCollection && (s.options.Controllers.EnableAll || enabled.Has("garbage-collector")) {
+		if err := s.installGarbageCollectorController(ctx, server); err != nil {
+			return err
+		}
+	}
+
+	if s.options.Controllers.EnableAll || enabled.Has("shard-registration") {
+		if err := s.installShardRegistrationController(ctx, *loopbackKubeConfig, server); err != nil {
+			return err
+		}
+	}
+
+	if s.options.ShardCertificates.CAKeyFile != "" {
+		if err := s.installShardCertificateSigningController(ctx, *loopbackKubeConfig, server); err != nil {
+			return err
+		}
+	}
+
+	if shardClientLoader != nil {
+		if err := s.installShardRoutingController(ctx, *loopbackKubeConfig, server, shardClientLoader); err != nil {
+			return err
+		}
+	}
+
+	if s.options.Extra.RootShardKubeconfigFile != "" && (s.options.Controllers.EnableAll || enabled.Has("replication")) {
+		if err := s.installReplicationController(ctx, *loopbackKubeConfig, server); err != nil {
+			return err
+		}
+	}
+
+	if s.options.Controllers.EnableAll || enabled.Has("apiservice-availability") {
+		if err := s.installAPIServiceAvailabilityController(ctx, *loopbackKubeConfig, server, apiServiceInformer, apiServiceTransports); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,135 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package serviceresolver
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"text/template"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/clusters"
+
+	"github.com/kcp-dev/kcp/pkg/reconciler/namespace"
+	"github.com/kcp-dev/kcp/pkg/syncer"
+)
+
+// DefaultEndpointTemplate resolves Services to the Service synced to the physical
+// cluster, by its cluster DNS name.
+const DefaultEndpointTemplate = "https://{{.Name}}.{{.PhysicalNamespace}}.svc:{{.Port}}"
+
+// Resolver resolves a Service of a logical cluster, referenced by a webhook, into
+// the URL of its endpoint.
+type Resolver interface {
+	ResolveEndpoint(clusterName, namespace, name string, port int32) (*url.URL, error)
+}
+
+// Endpoint is the Service of a logical cluster an endpoint template is executed with.
+type Endpoint struct {
+	// ClusterName is the logical cluster of the Service.
+	ClusterName string
+	// Namespace is the namespace of the Service in the logical cluster.
+	Namespace string
+	// Name is the name of the Service.
+	Name string
+	// Port is the port of the Service.
+	Port int32
+	// WorkloadCluster is the WorkloadCluster the namespace is scheduled on.
+	WorkloadCluster string
+	// PhysicalNamespace is the namespace the syncer syncs the namespace to in the
+	// physical cluster.
+	PhysicalNamespace string
+}
+
+// syncedServiceResolver resolves Services to the Services synced to the physical cluster
+// their namespace is scheduled on, executing an endpoint template.
+type syncedServiceResolver struct {
+	namespaceLister corelisters.NamespaceLister
+	template        *template.Template
+}
+
+// NewSyncedServiceResolver returns a Resolver executing the given endpoint template, e.g.
+// DefaultEndpointTemplate, with the Endpoint of the synced Service.
+func NewSyncedServiceResolver(namespaceLister corelisters.NamespaceLister, endpointTemplate string) (Resolver, error) {
+	tmpl, err := ParseEndpointTemplate(endpointTemplate)
+	if err != nil {
+		return nil, err
+	}
+	return &syncedServiceResolver{
+		namespaceLister: namespaceLister,
+		template:        tmpl,
+	}, nil
+}
+
+// ParseEndpointTemplate parses an endpoint template, and checks that it is executed into
+// a URL.
+func ParseEndpointTemplate(endpointTemplate string) (*template.Template, error) {
+	tmpl, err := template.New("endpoint").Option("missingkey=error").Parse(endpointTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint template: %w", err)
+	}
+	if _, err := execute(tmpl, &Endpoint{ClusterName: "root:org", Namespace: "default", Name: "webhook", Port: 443, WorkloadCluster: "cluster", PhysicalNamespace: "kcp0"}); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+func (r *syncedServiceResolver) ResolveEndpoint(clusterName, namespaceName, name string, port int32) (*url.URL, error) {
+	ns, err := r.namespaceLister.Get(clusters.ToClusterAwareKey(clusterName, namespaceName))
+	if apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("namespace %q of service %s/%s not found in logical cluster %s", namespaceName, namespaceName, name, clusterName)
+	} else if err != nil {
+		return nil, err
+	}
+	workloadCluster := ns.Labels[namespace.ClusterLabel]
+	if workloadCluster == "" {
+		return nil, fmt.Errorf("namespace %q of service %s/%s in logical cluster %s is not scheduled on a WorkloadCluster", namespaceName, namespaceName, name, clusterName)
+	}
+	physicalNamespace, err := syncer.PhysicalClusterNamespaceName(syncer.NamespaceLocator{
+		LogicalCluster: clusterName,
+		Namespace:      namespaceName,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return execute(r.template, &Endpoint{
+		ClusterName:       clusterName,
+		Namespace:         namespaceName,
+		Name:              name,
+		Port:              port,
+		WorkloadCluster:   workloadCluster,
+		PhysicalNamespace: physicalNamespace,
+	})
+}
+
+func execute(tmpl *template.Template, endpoint *Endpoint) (*url.URL, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, endpoint); err != nil {
+		return nil, fmt.Errorf("invalid endpoint template: %w", err)
+	}
+	u, err := url.Parse(buf.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint %q: %w", buf.String(), err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint %q: missing host", buf.String())
+	}
+	return u, nil
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package serviceresolver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/kcp-dev/kcp/pkg/reconciler/namespace"
+	"github.com/kcp-dev/kcp/pkg/syncer"
+)
+
+func TestSyncedServiceResolver(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, ns := range []*corev1.Namespace{
+		{ObjectMeta: metav1.ObjectMeta{ClusterName: "root:org", Name: "scheduled", Labels: map[string]string{namespace.ClusterLabel: "us-east1"}}},
+		{ObjectMeta: metav1.ObjectMeta{ClusterName: "root:org", Name: "unscheduled"}},
+	} {
+		require.NoError(t, indexer.Add(ns))
+	}
+	physicalNamespace, err := syncer.PhysicalClusterNamespaceName(syncer.NamespaceLocator{LogicalCluster: "root:org", Namespace: "scheduled"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		template  string
+		namespace string
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:      "resolves to the synced service",
+			template:  DefaultEndpointTemplate,
+			namespace: "scheduled",
+			want:      "https://webhook." + physicalNamespace + ".svc:8443",
+		},
+		{
+			name:      "resolves with a custom template",
+			template:  "https://{{.Name}}-{{.Namespace}}.{{.WorkloadCluster}}.example.com:{{.Port}}",
+			namespace: "scheduled",
+			want:      "https://webhook-scheduled.us-east1.example.com:8443",
+		},
+		{
+			name:      "fails for namespaces not scheduled",
+			template:  DefaultEndpointTemplate,
+			namespace: "unscheduled",
+			wantErr:   true,
+		},
+		{
+			name:      "fails for missing namespaces",
+			template:  DefaultEndpointTemplate,
+			namespace: "missing",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewSyncedServiceResolver(corelisters.NewNamespaceLister(indexer), tt.template)
+			require.NoError(t, err)
+			u, err := r.ResolveEndpoint("root:org", tt.namespace, "webhook", 8443)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, u.String())
+		})
+	}
+}
+
+func TestParseEndpointTemplate(t *testing.T) {
+	tests := map[string]bool{
+		DefaultEndpointTemplate:                  true,
+		"{{.Name}}.{{.Namespace}}.svc":           false,
+		"https://{{.Unknown}}.example.com":       false,
+		"https://{{.Name}.example.com":           false,
+		"https://gateway.example.com/{{.Name}}":  true,
+		"https://{{.ClusterName}}.example.com:1": true,
+	}
+	for tmpl, valid := range tests {
+		_, err := ParseEndpointTemplate(tmpl)
+		require.Equal(t, valid, err == nil, "%s: %v", tmpl, err)
+	}
+}
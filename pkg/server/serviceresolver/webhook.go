@@ -0,0 +1,161 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package serviceresolver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/util/webhook"
+	"k8s.io/client-go/rest"
+)
+
+// Webhooks calling a Service are dialed at the endpoint of the Service in the logical
+// cluster of the request, while TLS is still verified against the <name>.<namespace>.svc
+// name of the Service, like upstream.
+//
+// The webhook clients are shared by the logical clusters, as upstream builds them from the
+// Service reference only. So:
+//  - the connections of admission webhooks, whose requests carry the logical cluster, are
+//    not reused.
+//  - conversion requests do not carry the logical cluster. It is passed in the path of the
+//    Service of the conversion webhook instead, see ScopeConversionWebhook.
+
+// clusterPathPrefix prefixes the path of conversion webhooks with the logical cluster of
+// their CRD.
+const clusterPathPrefix = "/clusters/"
+
+// NewAuthenticationInfoResolverWrapper returns a wrapper dialing the Services referenced by
+// webhooks at the endpoint resolved by the given Resolver, in the logical cluster of the
+// request.
+func NewAuthenticationInfoResolverWrapper(resolver Resolver) webhook.AuthenticationInfoResolverWrapper {
+	return func(delegate webhook.AuthenticationInfoResolver) webhook.AuthenticationInfoResolver {
+		return &webhook.AuthenticationInfoResolverDelegator{
+			ClientConfigForFunc: delegate.ClientConfigFor,
+			ClientConfigForServiceFunc: func(serviceName, serviceNamespace string, servicePort int) (*rest.Config, error) {
+				cfg, err := delegate.ClientConfigForService(serviceName, serviceNamespace, servicePort)
+				if err != nil {
+					return nil, err
+				}
+				cfg = rest.CopyConfig(cfg)
+				cfg.Dial = serviceDialer(resolver, serviceName, serviceNamespace, servicePort, cfg.Dial)
+				cfg.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+					return &clusterRoundTripper{delegate: rt}
+				})
+				return cfg, nil
+			},
+		}
+	}
+}
+
+// serviceDialer returns a dialer resolving the address of the given Service in the logical
+// cluster of the request, and dialing the other addresses with the given dialer.
+func serviceDialer(resolver Resolver, serviceName, serviceNamespace string, servicePort int, dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if dial == nil {
+		var d net.Dialer
+		dial = d.DialContext
+	}
+	serviceHost := net.JoinHostPort(serviceName+"."+serviceNamespace+".svc", strconv.Itoa(servicePort))
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if addr != serviceHost {
+			return dial(ctx, network, addr)
+		}
+		cluster := genericapirequest.ClusterFrom(ctx)
+		if cluster == nil || cluster.Name == "" || cluster.Wildcard {
+			return nil, fmt.Errorf("cannot resolve service %s/%s outside of a logical cluster", serviceNamespace, serviceName)
+		}
+		u, err := resolver.ResolveEndpoint(cluster.Name, serviceNamespace, serviceName, int32(servicePort))
+		if err != nil {
+			return nil, err
+		}
+		hostPort := u.Host
+		if u.Port() == "" {
+			// Default to port 443 if no port is specified, like upstream.
+			hostPort = net.JoinHostPort(u.Hostname(), "443")
+		}
+		return dial(ctx, network, hostPort)
+	}
+}
+
+// clusterRoundTripper passes the logical cluster of webhook requests to the dialer.
+type clusterRoundTripper struct {
+	delegate http.RoundTripper
+}
+
+func (rt *clusterRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if cluster := genericapirequest.ClusterFrom(req.Context()); cluster != nil && cluster.Name != "" {
+		// the connections are dialed for the logical cluster of the request, they must
+		// not be reused by the requests of another logical cluster.
+		req = req.Clone(req.Context())
+		req.Close = true
+		return rt.delegate.RoundTrip(req)
+	}
+
+	clusterName, path, ok := splitClusterPath(req.URL.Path)
+	if !ok {
+		return rt.delegate.RoundTrip(req)
+	}
+	req = req.Clone(genericapirequest.WithCluster(req.Context(), genericapirequest.Cluster{Name: clusterName}))
+	req.URL.Path = path
+	req.URL.RawPath = ""
+	return rt.delegate.RoundTrip(req)
+}
+
+// splitClusterPath splits a path scoped by ScopeConversionWebhook into the logical cluster
+// and the path of the webhook.
+func splitClusterPath(path string) (clusterName, webhookPath string, ok bool) {
+	if !strings.HasPrefix(path, clusterPathPrefix) {
+		return "", "", false
+	}
+	clusterName = strings.TrimPrefix(path, clusterPathPrefix)
+	webhookPath = "/"
+	if i := strings.Index(clusterName, "/"); i >= 0 {
+		clusterName, webhookPath = clusterName[:i], clusterName[i:]
+	}
+	if clusterName == "" {
+		return "", "", false
+	}
+	return clusterName, webhookPath, true
+}
+
+// ScopeConversionWebhook returns a copy of the given CRD whose conversion webhook Service
+// path is prefixed with the logical cluster of the CRD, or the CRD itself if it has no
+// conversion webhook calling a Service.
+func ScopeConversionWebhook(crd *apiextensionsv1.CustomResourceDefinition) *apiextensionsv1.CustomResourceDefinition {
+	if crd == nil || crd.ClusterName == "" ||
+		crd.Spec.Conversion == nil || crd.Spec.Conversion.Strategy != apiextensionsv1.WebhookConverter ||
+		crd.Spec.Conversion.Webhook == nil || crd.Spec.Conversion.Webhook.ClientConfig == nil ||
+		crd.Spec.Conversion.Webhook.ClientConfig.Service == nil {
+		return crd
+	}
+
+	crd = crd.DeepCopy()
+	service := crd.Spec.Conversion.Webhook.ClientConfig.Service
+	path := clusterPathPrefix + crd.ClusterName
+	if service.Path != nil {
+		path += *service.Path
+	}
+	service.Path = &path
+	return crd
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package serviceresolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+)
+
+type resolverFunc func(clusterName, namespace, name string, port int32) (*url.URL, error)
+
+func (f resolverFunc) ResolveEndpoint(clusterName, namespace, name string, port int32) (*url.URL, error) {
+	return f(clusterName, namespace, name, port)
+}
+
+var errDialed = errors.New("dialed")
+
+func TestServiceDialer(t *testing.T) {
+	resolver := resolverFunc(func(clusterName, namespace, name string, port int32) (*url.URL, error) {
+		switch clusterName {
+		case "root:unscheduled":
+			return nil, errors.New("not scheduled")
+		case "root:noport":
+			return url.Parse(fmt.Sprintf("https://%s.%s.noport.example.com", name, namespace))
+		}
+		return url.Parse(fmt.Sprintf("https://%s.%s.example.com:%d", name, namespace, port))
+	})
+	var dialed string
+	dial := serviceDialer(resolver, "webhook", "default", 8443, func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = addr
+		return nil, errDialed
+	})
+
+	tests := []struct {
+		name    string
+		cluster *genericapirequest.Cluster
+		addr    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "resolves the service in the logical cluster of the request",
+			cluster: &genericapirequest.Cluster{Name: "root:org"},
+			addr:    "webhook.default.svc:8443",
+			want:    "webhook.default.example.com:8443",
+		},
+		{
+			name:    "defaults to port 443",
+			cluster: &genericapirequest.Cluster{Name: "root:noport"},
+			addr:    "webhook.default.svc:8443",
+			want:    "webhook.default.noport.example.com:443",
+		},
+		{
+			name:    "dials other addresses",
+			cluster: &genericapirequest.Cluster{Name: "root:org"},
+			addr:    "example.com:443",
+			want:    "example.com:443",
+		},
+		{
+			name:    "fails outside of a logical cluster",
+			addr:    "webhook.default.svc:8443",
+			wantErr: true,
+		},
+		{
+			name:    "fails for wildcard requests",
+			cluster: &genericapirequest.Cluster{Wildcard: true},
+			addr:    "webhook.default.svc:8443",
+			wantErr: true,
+		},
+		{
+			name:    "fails if the service is not resolved",
+			cluster: &genericapirequest.Cluster{Name: "root:unscheduled"},
+			addr:    "webhook.default.svc:8443",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dialed = ""
+			ctx := context.Background()
+			if tt.cluster != nil {
+				ctx = genericapirequest.WithCluster(ctx, *tt.cluster)
+			}
+			_, err := dial(ctx, "tcp", tt.addr)
+			if tt.wantErr {
+				require.Error(t, err)
+				require.NotErrorIs(t, err, errDialed)
+				return
+			}
+			require.ErrorIs(t, err, errDialed)
+			require.Equal(t, tt.want, dialed)
+		})
+	}
+}
+
+type recordingRoundTripper struct {
+	req *http.Request
+}
+
+func (rt *recordingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.req = req
+	return &http.Response{StatusCode: http.StatusOK}, nil
+}
+
+func TestClusterRoundTripper(t *testing.T) {
+	t.Run("admission requests are not sent on reused connections", func(t *testing.T) {
+		recorder := &recordingRoundTripper{}
+		ctx := genericapirequest.WithCluster(context.Background(), genericapirequest.Cluster{Name: "root:org"})
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://webhook.default.svc:443/clusters/validate", nil)
+		require.NoError(t, err)
+
+		_, err = (&clusterRoundTripper{delegate: recorder}).RoundTrip(req)
+		require.NoError(t, err)
+		require.True(t, recorder.req.Close)
+		require.Equal(t, "/clusters/validate", recorder.req.URL.Path, "the path of admission webhooks must not be rewritten")
+		require.False(t, req.Close, "the request must not be modified")
+	})
+
+	t.Run("conversion requests pass the logical cluster of their path", func(t *testing.T) {
+		recorder := &recordingRoundTripper{}
+		req, err := http.NewRequest(http.MethodPost, "https://webhook.default.svc:443/clusters/root:org/convert", nil)
+		require.NoError(t, err)
+
+		_, err = (&clusterRoundTripper{delegate: recorder}).RoundTrip(req)
+		require.NoError(t, err)
+		require.Equal(t, "/convert", recorder.req.URL.Path)
+		cluster := genericapirequest.ClusterFrom(recorder.req.Context())
+		require.NotNil(t, cluster)
+		require.Equal(t, "root:org", cluster.Name)
+		require.Equal(t, "/clusters/root:org/convert", req.URL.Path, "the request must not be modified")
+	})
+}
+
+func TestSplitClusterPath(t *testing.T) {
+	tests := []struct {
+		path        string
+		clusterName string
+		webhookPath string
+		ok          bool
+	}{
+		{path: "/clusters/root:org/convert", clusterName: "root:org", webhookPath: "/convert", ok: true},
+		{path: "/clusters/root:org", clusterName: "root:org", webhookPath: "/", ok: true},
+		{path: "/clusters/", ok: false},
+		{path: "/convert", ok: false},
+	}
+	for _, tt := range tests {
+		clusterName, webhookPath, ok := splitClusterPath(tt.path)
+		require.Equal(t, tt.ok, ok, tt.path)
+		require.Equal(t, tt.clusterName, clusterName, tt.path)
+		require.Equal(t, tt.webhookPath, webhookPath, tt.path)
+	}
+}
+
+func TestScopeConversionWebhook(t *testing.T) {
+	path := "/convert"
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{ClusterName: "root:org", Name: "widgets.example.io"},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Conversion: &apiextensionsv1.CustomResourceConversion{
+				Strategy: apiextensionsv1.WebhookConverter,
+				Webhook: &apiextensionsv1.WebhookConversion{
+					ClientConfig: &apiextensionsv1.WebhookClientConfig{
+						Service: &apiextensionsv1.ServiceReference{Namespace: "default", Name: "webhook", Path: &path},
+					},
+				},
+			},
+		},
+	}
+
+	scoped := ScopeConversionWebhook(crd)
+	require.Equal(t, "/clusters/root:org/convert", *scoped.Spec.Conversion.Webhook.ClientConfig.Service.Path)
+	require.Equal(t, "/convert", *crd.Spec.Conversion.Webhook.ClientConfig.Service.Path, "the CRD must not be modified")
+
+	crd.Spec.Conversion.Webhook.ClientConfig.Service.Path = nil
+	scoped = ScopeConversionWebhook(crd)
+	require.Equal(t, "/clusters/root:org", *scoped.Spec.Conversion.Webhook.ClientConfig.Service.Path)
+
+	url := "https://example.com/convert"
+	crd.Spec.Conversion.Webhook.ClientConfig = &apiextensionsv1.WebhookClientConfig{URL: &url}
+	require.Same(t, crd, ScopeConversionWebhook(crd), "webhooks not calling a service must not be scoped")
+
+	crd.Spec.Conversion = &apiextensionsv1.CustomResourceConversion{Strategy: apiextensionsv1.NoneConverter}
+	require.Same(t, crd, ScopeConversionWebhook(crd))
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/endpoints/handlers/responsewriters"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clusters"
+
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy"
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+	tenancylisters "github.com/kcp-dev/kcp/pkg/client/listers/tenancy/v1alpha1"
+)
+
+// SnapshotSubresource is the subresource of ClusterWorkspaces taking snapshots of their
+// logical cluster.
+const SnapshotSubresource = "snapshot"
+
+// Handler serves the snapshots of the logical clusters of the ClusterWorkspaces scheduled
+// on this shard.
+type Handler struct {
+	workspaceLister tenancylisters.ClusterWorkspaceLister
+	snapshotter     *Snapshotter
+	shardName       string
+}
+
+// NewHandler returns a Handler taking snapshots with the given Snapshotter. Snapshots of
+// workspaces scheduled on another shard than the one with the given name are rejected.
+func NewHandler(workspaceLister tenancylisters.ClusterWorkspaceLister, snapshotter *Snapshotter, shardName string) *Handler {
+	return &Handler{
+		workspaceLister: workspaceLister,
+		snapshotter:     snapshotter,
+		shardName:       shardName,
+	}
+}
+
+// IsSnapshotRequest returns true if the request takes a snapshot of the logical cluster of
+// a ClusterWorkspace.
+func IsSnapshotRequest(requestInfo *genericapirequest.RequestInfo) bool {
+	return requestInfo != nil && requestInfo.IsResourceRequest &&
+		requestInfo.APIGroup == tenancy.GroupName &&
+		requestInfo.Resource == "clusterworkspaces" &&
+		requestInfo.Subresource == SnapshotSubresource &&
+		requestInfo.Verb == "create"
+}
+
+// WithSnapshots takes snapshots of the logical clusters of ClusterWorkspaces, and answers
+// with their Manifest. Every other request is passed to apiHandler. It expects authenticated
+// and authorized requests.
+func (h *Handler) WithSnapshots(apiHandler http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		requestInfo, _ := genericapirequest.RequestInfoFrom(req.Context())
+		cluster := genericapirequest.ClusterFrom(req.Context())
+		if cluster == nil || cluster.Wildcard || !IsSnapshotRequest(requestInfo) {
+			apiHandler.ServeHTTP(w, req)
+			return
+		}
+
+		manifest, err := h.snapshot(req, cluster.Name, requestInfo.Name)
+		if err != nil {
+			gv := schema.GroupVersion{Group: requestInfo.APIGroup, Version: requestInfo.APIVersion}
+			responsewriters.ErrorNegotiated(err, scheme.Codecs, gv, w, req)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(manifest)
+	}
+}
+
+func (h *Handler) snapshot(req *http.Request, clusterName, workspaceName string) (*Manifest, error) {
+	workspace, err := h.workspaceLister.Get(clusters.ToClusterAwareKey(clusterName, workspaceName))
+	if apierrors.IsNotFound(err) {
+		return nil, apierrors.NewNotFound(tenancyv1alpha1.Resource("clusterworkspaces"), workspaceName)
+	} else if err != nil {
+		return nil, apierrors.NewInternalError(err)
+	}
+	if current := workspace.Status.Location.Current; current != "" && h.shardName != "" && current != h.shardName {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("workspace %s is scheduled on shard %s, snapshots are taken by the shard of the workspace", workspaceName, current))
+	}
+	workspaceClusterName, err := helper.EncodeLogicalClusterName(workspace)
+	if err != nil {
+		return nil, apierrors.NewInternalError(err)
+	}
+
+	manifest, err := h.snapshotter.Snapshot(req.Context(), workspaceClusterName)
+	if err != nil {
+		return nil, apierrors.NewServiceUnavailable(err.Error())
+	}
+	return manifest, nil
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/endpoints/handlers/responsewriters"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+)
+
+// mutatingVerbs are the request verbs writing to the storage.
+var mutatingVerbs = sets.NewString("create", "update", "patch", "delete", "deletecollection")
+
+// Quiescer tracks the in-flight writes to logical clusters, and holds new writes to a
+// logical cluster back while it is quiesced.
+type Quiescer struct {
+	lock     sync.Mutex
+	clusters map[string]*clusterWrites
+}
+
+type clusterWrites struct {
+	inFlight int
+	// resumed is closed when the quiesce ends, nil when not quiesced.
+	resumed chan struct{}
+	// drained is closed when the in-flight writes completed, nil when not quiesced.
+	drained chan struct{}
+}
+
+// NewQuiescer returns a Quiescer without quiesced logical cluster.
+func NewQuiescer() *Quiescer {
+	return &Quiescer{clusters: map[string]*clusterWrites{}}
+}
+
+// Quiesce holds new writes to the given logical cluster back, and waits for the in-flight
+// writes to complete. The returned function resumes the writes, and must be called once
+// done. Only one quiesce of a logical cluster is in progress at a time, others wait for it
+// to end first.
+func (q *Quiescer) Quiesce(ctx context.Context, clusterName string) (func(), error) {
+	for {
+		q.lock.Lock()
+		writes := q.writesLocked(clusterName)
+		if writes.resumed == nil {
+			break
+		}
+		resumed := writes.resumed
+		q.lock.Unlock()
+
+		select {
+		case <-resumed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	writes := q.clusters[clusterName]
+	resumed, drained := make(chan struct{}), make(chan struct{})
+	writes.resumed, writes.drained = resumed, drained
+	if writes.inFlight == 0 {
+		close(drained)
+	}
+	q.lock.Unlock()
+
+	var once sync.Once
+	resume := func() {
+		once.Do(func() {
+			q.lock.Lock()
+			defer q.lock.Unlock()
+			writes.resumed, writes.drained = nil, nil
+			close(resumed)
+			q.cleanupLocked(clusterName)
+		})
+	}
+
+	select {
+	case <-drained:
+		return resume, nil
+	case <-ctx.Done():
+		resume()
+		return nil, ctx.Err()
+	}
+}
+
+// startWrite waits for a quiesce of the given logical cluster to end, and records an
+// in-flight write to it.
+func (q *Quiescer) startWrite(ctx context.Context, clusterName string) error {
+	for {
+		q.lock.Lock()
+		writes := q.writesLocked(clusterName)
+		if writes.resumed == nil {
+			writes.inFlight++
+			q.lock.Unlock()
+			return nil
+		}
+		resumed := writes.resumed
+		q.lock.Unlock()
+
+		select {
+		case <-resumed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// endWrite records the completion of an in-flight write to the given logical cluster.
+func (q *Quiescer) endWrite(clusterName string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	writes := q.clusters[clusterName]
+	writes.inFlight--
+	if writes.inFlight == 0 && writes.drained != nil {
+		close(writes.drained)
+	}
+	q.cleanupLocked(clusterName)
+}
+
+func (q *Quiescer) writesLocked(clusterName string) *clusterWrites {
+	writes, ok := q.clusters[clusterName]
+	if !ok {
+		writes = &clusterWrites{}
+		q.clusters[clusterName] = writes
+	}
+	return writes
+}
+
+func (q *Quiescer) cleanupLocked(clusterName string) {
+	if writes := q.clusters[clusterName]; writes.inFlight == 0 && writes.resumed == nil {
+		delete(q.clusters, clusterName)
+	}
+}
+
+// WithQuiesce tracks the writes to logical clusters, and holds them back while their
+// logical cluster is quiesced by the given Quiescer.
+func WithQuiesce(apiHandler http.Handler, quiescer *Quiescer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		requestInfo, _ := genericapirequest.RequestInfoFrom(ctx)
+		cluster := genericapirequest.ClusterFrom(ctx)
+		if cluster == nil || cluster.Wildcard || requestInfo == nil || !requestInfo.IsResourceRequest ||
+			!mutatingVerbs.Has(requestInfo.Verb) || IsSnapshotRequest(requestInfo) {
+			apiHandler.ServeHTTP(w, req)
+			return
+		}
+
+		if err := quiescer.startWrite(ctx, cluster.Name); err != nil {
+			responsewriters.InternalError(w, req, fmt.Errorf("logical cluster %s is being snapshotted: %w", cluster.Name, err))
+			return
+		}
+		defer quiescer.endWrite(cluster.Name)
+
+		apiHandler.ServeHTTP(w, req)
+	})
+}
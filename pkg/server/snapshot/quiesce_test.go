@@ -0,0 +1,151 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snapshot
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+)
+
+func TestQuiesce(t *testing.T) {
+	t.Run("waits for in-flight writes", func(t *testing.T) {
+		q := NewQuiescer()
+		require.NoError(t, q.startWrite(context.Background(), "root:org"))
+
+		quiesced := make(chan func())
+		go func() {
+			resume, err := q.Quiesce(context.Background(), "root:org")
+			require.NoError(t, err)
+			quiesced <- resume
+		}()
+
+		select {
+		case <-quiesced:
+			t.Fatal("quiesced with a write in flight")
+		case <-time.After(50 * time.Millisecond):
+		}
+		q.endWrite("root:org")
+		resume := <-quiesced
+		resume()
+		resume()
+		require.Empty(t, q.clusters)
+	})
+
+	t.Run("holds new writes back until resumed", func(t *testing.T) {
+		q := NewQuiescer()
+		resume, err := q.Quiesce(context.Background(), "root:org")
+		require.NoError(t, err)
+
+		require.NoError(t, q.startWrite(context.Background(), "root:other"), "other logical clusters must not be held back")
+		q.endWrite("root:other")
+
+		started := make(chan error)
+		go func() {
+			started <- q.startWrite(context.Background(), "root:org")
+		}()
+		select {
+		case <-started:
+			t.Fatal("write started while quiesced")
+		case <-time.After(50 * time.Millisecond):
+		}
+		resume()
+		require.NoError(t, <-started)
+		q.endWrite("root:org")
+		require.Empty(t, q.clusters)
+	})
+
+	t.Run("gives up on context cancellation", func(t *testing.T) {
+		q := NewQuiescer()
+		require.NoError(t, q.startWrite(context.Background(), "root:org"))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := q.Quiesce(ctx, "root:org")
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		require.NoError(t, q.startWrite(context.Background(), "root:org"))
+		q.endWrite("root:org")
+		q.endWrite("root:org")
+		require.Empty(t, q.clusters)
+	})
+}
+
+func TestWithQuiesce(t *testing.T) {
+	tests := []struct {
+		name        string
+		cluster     *genericapirequest.Cluster
+		requestInfo *genericapirequest.RequestInfo
+		held        bool
+	}{
+		{
+			name:        "writes are held back",
+			cluster:     &genericapirequest.Cluster{Name: "root:org"},
+			requestInfo: &genericapirequest.RequestInfo{IsResourceRequest: true, Verb: "create", Resource: "configmaps"},
+			held:        true,
+		},
+		{
+			name:        "reads pass",
+			cluster:     &genericapirequest.Cluster{Name: "root:org"},
+			requestInfo: &genericapirequest.RequestInfo{IsResourceRequest: true, Verb: "get", Resource: "configmaps"},
+		},
+		{
+			name:        "writes to other logical clusters pass",
+			cluster:     &genericapirequest.Cluster{Name: "root:other"},
+			requestInfo: &genericapirequest.RequestInfo{IsResourceRequest: true, Verb: "create", Resource: "configmaps"},
+		},
+		{
+			name:        "snapshots pass",
+			cluster:     &genericapirequest.Cluster{Name: "root:org"},
+			requestInfo: &genericapirequest.RequestInfo{IsResourceRequest: true, Verb: "create", APIGroup: "tenancy.kcp.dev", Resource: "clusterworkspaces", Subresource: "snapshot"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewQuiescer()
+			resume, err := q.Quiesce(context.Background(), "root:org")
+			require.NoError(t, err)
+			defer resume()
+
+			served := make(chan struct{})
+			handler := WithQuiesce(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				close(served)
+			}), q)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			ctx = genericapirequest.WithRequestInfo(genericapirequest.WithCluster(ctx, *tt.cluster), tt.requestInfo)
+			req := httptest.NewRequest(http.MethodPost, "/", nil).WithContext(ctx)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			select {
+			case <-served:
+				require.False(t, tt.held, "request was not held back")
+			default:
+				require.True(t, tt.held, "request was held back")
+				require.Equal(t, http.StatusInternalServerError, rec.Code)
+			}
+		})
+	}
+}
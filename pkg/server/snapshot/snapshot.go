@@ -0,0 +1,281 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package snapshot takes consistent backups of single logical clusters, as a building block
+// for tenant-level backup products.
+//
+// A snapshot holds the stored objects of a logical cluster as read from etcd at a single
+// revision, which is the resource version it is stamped with. The writes to the logical
+// cluster are quiesced while the revision is picked, such that the snapshot does not hold
+// half of the objects written by a request, and resume before the objects are read at that
+// revision and streamed to a Sink, e.g. an object store.
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// ObjectsName is the name of the object holding the stored objects of a snapshot, one
+	// JSON encoded Record per line.
+	ObjectsName = "objects.jsonl"
+	// ManifestName is the name of the object holding the Manifest of a snapshot. It is
+	// written last, i.e. a snapshot without manifest is incomplete.
+	ManifestName = "manifest.json"
+
+	// pageSize is the number of keys read from etcd at once.
+	pageSize = 500
+)
+
+// Sink stores the objects making up snapshots, e.g. in an object store.
+type Sink interface {
+	// Put stores the content read from r as the object with the given name, replacing
+	// any existing object of that name. The object must not be visible before r is
+	// read to its end.
+	Put(ctx context.Context, name string, r io.Reader) error
+}
+
+// Record is a stored object of a logical cluster.
+type Record struct {
+	// Key is the etcd key of the object, relative to the etcd prefix of the shard.
+	Key string `json:"key"`
+	// Value is the value stored in etcd, as is, i.e. possibly encrypted at rest.
+	Value []byte `json:"value"`
+}
+
+// Manifest describes a complete snapshot of a logical cluster.
+type Manifest struct {
+	// ClusterName is the logical cluster the snapshot was taken of.
+	ClusterName string `json:"clusterName"`
+	// ResourceVersion is the resource version the objects were read at.
+	ResourceVersion string `json:"resourceVersion"`
+	// Prefix is the name prefix of the objects of the snapshot in the sink.
+	Prefix string `json:"prefix"`
+	// ObjectCount is the number of stored objects in the snapshot.
+	ObjectCount int64 `json:"objectCount"`
+	// StorageBytes is the number of bytes of the keys and values of the stored objects.
+	StorageBytes int64 `json:"storageBytes"`
+	// CreationTimestamp is the time the snapshot was taken.
+	CreationTimestamp metav1.Time `json:"creationTimestamp"`
+}
+
+// Snapshotter takes snapshots of logical clusters from the etcd of the shard.
+type Snapshotter struct {
+	etcdClient     clientv3.KV
+	etcdPrefix     string
+	quiescer       *Quiescer
+	quiesceTimeout time.Duration
+	sink           Sink
+
+	now func() time.Time
+}
+
+// NewSnapshotter returns a Snapshotter reading the keys under the given etcd prefix, and
+// storing the snapshots in the given sink. The writes to a logical cluster are quiesced
+// by the given quiescer for at most quiesceTimeout to pick the revision of a snapshot.
+func NewSnapshotter(etcdClient clientv3.KV, etcdPrefix string, quiescer *Quiescer, quiesceTimeout time.Duration, sink Sink) *Snapshotter {
+	if !strings.HasSuffix(etcdPrefix, "/") {
+		etcdPrefix += "/"
+	}
+	return &Snapshotter{
+		etcdClient:     etcdClient,
+		etcdPrefix:     etcdPrefix,
+		quiescer:       quiescer,
+		quiesceTimeout: quiesceTimeout,
+		sink:           sink,
+		now:            time.Now,
+	}
+}
+
+// Snapshot stores a snapshot of the given logical cluster of a workspace in the sink, under
+// <logical cluster>/<resource version>/, and returns its manifest.
+func (s *Snapshotter) Snapshot(ctx context.Context, clusterName string) (*Manifest, error) {
+	revision, err := s.pinRevision(ctx, clusterName)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{
+		ClusterName:       clusterName,
+		ResourceVersion:   strconv.FormatInt(revision, 10),
+		Prefix:            clusterName + "/" + strconv.FormatInt(revision, 10) + "/",
+		CreationTimestamp: metav1.NewTime(s.now()),
+	}
+	klog.Infof("Taking snapshot of logical cluster %s at resource version %d", clusterName, revision)
+
+	r, w := io.Pipe()
+	written := make(chan error, 1)
+	go func() {
+		var err error
+		manifest.ObjectCount, manifest.StorageBytes, err = s.write(ctx, w, clusterName, revision)
+		w.CloseWithError(err)
+		written <- err
+	}()
+	err = s.sink.Put(ctx, manifest.Prefix+ObjectsName, r)
+	r.CloseWithError(err) // unblocks the writer if the sink stopped reading
+	if writeErr := <-written; err == nil {
+		err = writeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to store the objects of the snapshot of logical cluster %s: %w", clusterName, err)
+	}
+
+	raw, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.sink.Put(ctx, manifest.Prefix+ManifestName, strings.NewReader(string(raw))); err != nil {
+		return nil, fmt.Errorf("failed to store the manifest of the snapshot of logical cluster %s: %w", clusterName, err)
+	}
+	return manifest, nil
+}
+
+// pinRevision returns the current etcd revision, with the writes to the given logical
+// cluster quiesced.
+func (s *Snapshotter) pinRevision(ctx context.Context, clusterName string) (int64, error) {
+	quiesceCtx, cancel := context.WithTimeout(ctx, s.quiesceTimeout)
+	defer cancel()
+	resume, err := s.quiescer.Quiesce(quiesceCtx, clusterName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to quiesce the writes to logical cluster %s within %s: %w", clusterName, s.quiesceTimeout, err)
+	}
+	defer resume()
+
+	resp, err := s.etcdClient.Get(quiesceCtx, s.etcdPrefix, clientv3.WithPrefix(), clientv3.WithKeysOnly(), clientv3.WithLimit(1))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the etcd revision: %w", err)
+	}
+	return resp.Header.Revision, nil
+}
+
+// write encodes the keys of the given logical cluster at the given revision to w, and returns
+// the number of objects and bytes written. Only the key ranges of the logical cluster are read,
+// resource by resource: the next key after the keys of a resource tells the etcd prefix of the
+// next resource.
+func (s *Snapshotter) write(ctx context.Context, w io.Writer, clusterName string, revision int64) (int64, int64, error) {
+	encoder := json.NewEncoder(w)
+	var objects, bytes int64
+	key := s.etcdPrefix
+	rangeEnd := clientv3.GetPrefixRangeEnd(s.etcdPrefix)
+	for {
+		resp, err := s.etcdClient.Get(ctx, key, clientv3.WithRange(rangeEnd), clientv3.WithKeysOnly(), clientv3.WithLimit(1), clientv3.WithRev(revision))
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to read keys from etcd at revision %d: %w", revision, err)
+		}
+		if len(resp.Kvs) == 0 {
+			return objects, bytes, nil
+		}
+		relativeKey := strings.TrimPrefix(string(resp.Kvs[0].Key), s.etcdPrefix)
+		resourcePrefix, ok := resourcePrefixOfKey(relativeKey)
+		if !ok {
+			// not a key of a workspace, skipped with its siblings
+			key = clientv3.GetPrefixRangeEnd(s.etcdPrefix + relativeKey[:strings.LastIndex(relativeKey, "/")+1])
+			continue
+		}
+
+		n, b, err := s.writeRange(ctx, encoder, s.etcdPrefix+resourcePrefix+"/"+clusterName+"/", revision)
+		if err != nil {
+			return 0, 0, err
+		}
+		objects += n
+		bytes += b
+		key = clientv3.GetPrefixRangeEnd(s.etcdPrefix + resourcePrefix + "/")
+	}
+}
+
+// writeRange encodes the keys with the given prefix at the given revision, page by page, and
+// returns the number of objects and bytes written.
+func (s *Snapshotter) writeRange(ctx context.Context, encoder *json.Encoder, prefix string, revision int64) (int64, int64, error) {
+	var objects, bytes int64
+	key := prefix
+	rangeEnd := clientv3.GetPrefixRangeEnd(prefix)
+	for {
+		resp, err := s.etcdClient.Get(ctx, key, clientv3.WithRange(rangeEnd), clientv3.WithLimit(pageSize), clientv3.WithRev(revision))
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to read keys from etcd at revision %d: %w", revision, err)
+		}
+		for _, kv := range resp.Kvs {
+			if err := encoder.Encode(Record{Key: strings.TrimPrefix(string(kv.Key), s.etcdPrefix), Value: kv.Value}); err != nil {
+				return 0, 0, err
+			}
+			objects++
+			bytes += int64(len(kv.Key) + len(kv.Value))
+		}
+		if !resp.More || len(resp.Kvs) == 0 {
+			return objects, bytes, nil
+		}
+		key = string(resp.Kvs[len(resp.Kvs)-1].Key) + "\x00"
+	}
+}
+
+// resourcePrefixOfKey returns the resource prefix of an etcd key of a workspace relative to
+// the etcd prefix. Keys are of the form <resource prefix>/<logical cluster>/[<namespace>/]<name>,
+// where the resource prefix is made of one or more segments, none of which can contain a
+// colon, unlike the logical clusters of workspaces. It returns false for the keys of other
+// logical clusters, e.g. root.
+func resourcePrefixOfKey(key string) (string, bool) {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments[:len(segments)-1] {
+		if strings.Contains(segment, ":") {
+			return strings.Join(segments[:i], "/"), i > 0
+		}
+	}
+	return "", false
+}
+
+// DirectorySink stores snapshots as files in a directory, e.g. a mounted volume synced to
+// an object store.
+type DirectorySink struct {
+	dir string
+}
+
+// NewDirectorySink returns a DirectorySink storing the objects in the given directory.
+func NewDirectorySink(dir string) *DirectorySink {
+	return &DirectorySink{dir: dir}
+}
+
+// Put writes the object to a temporary file renamed once complete.
+func (d *DirectorySink) Put(ctx context.Context, name string, r io.Reader) error {
+	path := filepath.Join(d.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // nolint: errcheck
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close() // nolint: errcheck
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// fakeKV serves range reads from a map, in pages of pageSize keys, and records the
+// revisions the reads happened at.
+type fakeKV struct {
+	clientv3.KV
+
+	lock      sync.Mutex
+	data      map[string]string
+	revisions []int64
+	// values are the keys whose value was read
+	values []string
+}
+
+func (kv *fakeKV) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+
+	op := clientv3.OpGet(key, opts...)
+	kv.revisions = append(kv.revisions, op.Rev())
+	keys := make([]string, 0, len(kv.data))
+	for k := range kv.data {
+		if k >= key && k < string(op.RangeBytes()) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	resp := &clientv3.GetResponse{Header: &etcdserverpb.ResponseHeader{Revision: 42}}
+	limit := pageSize
+	if op.IsKeysOnly() {
+		// keys are only read one at a time
+		limit = 1
+	}
+	if len(keys) > limit {
+		keys = keys[:limit]
+		resp.More = true
+	}
+	for _, k := range keys {
+		if op.IsKeysOnly() {
+			resp.Kvs = append(resp.Kvs, &mvccpb.KeyValue{Key: []byte(k)})
+			continue
+		}
+		kv.values = append(kv.values, k)
+		resp.Kvs = append(resp.Kvs, &mvccpb.KeyValue{Key: []byte(k), Value: []byte(kv.data[k])})
+	}
+	return resp, nil
+}
+
+// memorySink stores the objects in memory.
+type memorySink map[string][]byte
+
+func (s memorySink) Put(ctx context.Context, name string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s[name] = data
+	return nil
+}
+
+func TestSnapshot(t *testing.T) {
+	data := map[string]string{
+		"/registry/configmaps/root/default/foo":                      "root",
+		"/registry/configmaps/root:acme/default/foo":                 "acme",
+		"/registry/tenancy.kcp.dev/clusterworkspaces/root:acme/team": "team workspace",
+		"/registry/namespaces/acme:team/default":                     "team",
+		"/registry/namespaces/acme:teams/default":                    "other",
+		"/other/configmaps/acme:team/default/foo":                    "other prefix",
+	}
+	for i := 0; i < 2*pageSize; i++ {
+		data[fmt.Sprintf("/registry/secrets/acme:team/default/secret-%04d", i)] = "x"
+	}
+	kv := &fakeKV{data: data}
+	sink := memorySink{}
+	s := NewSnapshotter(kv, "/registry", NewQuiescer(), time.Second, sink)
+	s.now = func() time.Time { return time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC) }
+
+	manifest, err := s.Snapshot(context.Background(), "acme:team")
+	require.NoError(t, err)
+
+	require.Equal(t, "acme:team", manifest.ClusterName)
+	require.Equal(t, "42", manifest.ResourceVersion)
+	require.Equal(t, "acme:team/42/", manifest.Prefix)
+	require.Equal(t, int64(2*pageSize+1), manifest.ObjectCount)
+	require.Equal(t, 2022, manifest.CreationTimestamp.Year())
+	for _, rev := range kv.revisions[1:] {
+		require.Equal(t, int64(42), rev, "objects must be read at the revision of the snapshot")
+	}
+	for _, key := range kv.values {
+		require.Contains(t, key, "/acme:team/", "only the objects of the logical cluster must be read")
+	}
+	require.Less(t, len(kv.revisions), 20, "the keys of other logical clusters must be skipped")
+
+	var records []Record
+	scanner := bufio.NewScanner(bytes.NewReader(sink["acme:team/42/objects.jsonl"]))
+	for scanner.Scan() {
+		var record Record
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+	require.NoError(t, scanner.Err())
+	require.Len(t, records, 2*pageSize+1)
+	require.Equal(t, Record{Key: "namespaces/acme:team/default", Value: []byte("team")}, records[0])
+	require.Equal(t, "secrets/acme:team/default/secret-0000", records[1].Key)
+
+	var stored Manifest
+	require.NoError(t, json.Unmarshal(sink["acme:team/42/manifest.json"], &stored))
+	require.Equal(t, manifest.ObjectCount, stored.ObjectCount)
+	require.Equal(t, manifest.StorageBytes, stored.StorageBytes)
+}
+
+func TestSnapshotQuiesceTimeout(t *testing.T) {
+	q := NewQuiescer()
+	require.NoError(t, q.startWrite(context.Background(), "acme:team"))
+	defer q.endWrite("acme:team")
+
+	sink := memorySink{}
+	s := NewSnapshotter(&fakeKV{}, "/registry/", q, 10*time.Millisecond, sink)
+	_, err := s.Snapshot(context.Background(), "acme:team")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Empty(t, sink)
+
+	require.NoError(t, q.startWrite(context.Background(), "acme:team"), "writes must resume after a failed quiesce")
+	q.endWrite("acme:team")
+}
+
+func TestResourcePrefixOfKey(t *testing.T) {
+	tests := map[string]string{
+		"configmaps/root:acme/default/foo":                                            "configmaps",
+		"tenancy.kcp.dev/clusterworkspaces/root:acme/team":                            "tenancy.kcp.dev/clusterworkspaces",
+		"apiextensions.k8s.io/customresourcedefinitions/acme:team/widgets.example.io": "apiextensions.k8s.io/customresourcedefinitions",
+		"configmaps/root/default/foo":                                                 "",
+		"configmaps/root/default/a:b":                                                 "",
+		"configmaps/system:admin/name":                                                "configmaps",
+		"root:acme/foo":                                                               "",
+	}
+	for key, expected := range tests {
+		prefix, ok := resourcePrefixOfKey(key)
+		require.Equal(t, expected, prefix, key)
+		require.Equal(t, expected != "", ok, key)
+	}
+}
+
+func TestDirectorySink(t *testing.T) {
+	dir := t.TempDir()
+	sink := NewDirectorySink(dir)
+	require.NoError(t, sink.Put(context.Background(), "acme:team/42/objects.jsonl", bytes.NewReader([]byte("content"))))
+
+	data, err := os.ReadFile(filepath.Join(dir, "acme:team", "42", "objects.jsonl"))
+	require.NoError(t, err)
+	require.Equal(t, "content", string(data))
+
+	entries, err := os.ReadDir(filepath.Join(dir, "acme:team", "42"))
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "temporary files must be removed")
+}
@@ -0,0 +1,272 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package streams keeps track of the connections hijacked by upgrade requests, i.e. the
+// SPDY and WebSocket streams of exec, attach, port-forward and watches, and the tunnels
+// opened by syncers. These connections escape the request timeouts and the graceful
+// shutdown of the HTTP server, so they are closed here when idle for too long, and drained
+// when the shard shuts down.
+package streams
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apiserver/pkg/endpoints/handlers/responsewriters"
+	"k8s.io/apiserver/pkg/endpoints/responsewriter"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// idleCheckInterval is how often the streams are checked for idleness.
+	idleCheckInterval = 10 * time.Second
+	// drainCheckInterval is how often the remaining streams are counted while draining.
+	drainCheckInterval = 100 * time.Millisecond
+	// retryAfterSeconds is the delay after which clients are asked to open streams
+	// rejected while draining again, e.g. through another shard.
+	retryAfterSeconds = 1
+)
+
+var (
+	errorScheme = runtime.NewScheme()
+	errorCodecs = serializer.NewCodecFactory(errorScheme)
+
+	errDraining = errors.New("the server is shutting down")
+)
+
+func init() {
+	errorScheme.AddUnversionedTypes(metav1.Unversioned,
+		&metav1.Status{},
+	)
+}
+
+// Tracker tracks the streams of upgrade requests.
+type Tracker struct {
+	idleTimeout time.Duration
+	now         func() time.Time
+
+	lock     sync.Mutex
+	streams  map[*trackedConn]struct{}
+	draining bool
+}
+
+// NewTracker returns a Tracker closing the streams without traffic in either direction
+// for longer than the given idle timeout. A zero idle timeout disables the idle check.
+func NewTracker(idleTimeout time.Duration) *Tracker {
+	return &Tracker{
+		idleTimeout: idleTimeout,
+		now:         time.Now,
+		streams:     map[*trackedConn]struct{}{},
+	}
+}
+
+// Run closes the idle streams until the context is done.
+func (t *Tracker) Run(ctx context.Context) {
+	if t.idleTimeout == 0 {
+		return
+	}
+	wait.Until(t.closeIdle, idleCheckInterval, ctx.Done())
+}
+
+// Active returns the number of open streams.
+func (t *Tracker) Active() int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return len(t.streams)
+}
+
+// Drain rejects new streams, and waits for the open streams to be closed by their
+// clients for at most the given timeout. The streams still open then are closed.
+func (t *Tracker) Drain(timeout time.Duration) {
+	t.lock.Lock()
+	t.draining = true
+	t.lock.Unlock()
+
+	klog.Infof("draining %d streams", t.Active())
+	deadline := t.now().Add(timeout)
+	for t.Active() > 0 && t.now().Before(deadline) {
+		time.Sleep(drainCheckInterval)
+	}
+
+	remaining := t.snapshot()
+	if len(remaining) > 0 {
+		klog.Infof("closing %d streams still open after %s", len(remaining), timeout)
+	}
+	for _, conn := range remaining {
+		conn.Close() // nolint: errcheck
+	}
+}
+
+func (t *Tracker) closeIdle() {
+	idleSince := t.now().Add(-t.idleTimeout).UnixNano()
+	for _, conn := range t.snapshot() {
+		if atomic.LoadInt64(&conn.lastActive) < idleSince {
+			klog.V(4).Infof("closing stream from %s idle for longer than %s", conn.RemoteAddr(), t.idleTimeout)
+			conn.Close() // nolint: errcheck
+		}
+	}
+}
+
+func (t *Tracker) snapshot() []*trackedConn {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	ret := make([]*trackedConn, 0, len(t.streams))
+	for conn := range t.streams {
+		ret = append(ret, conn)
+	}
+	return ret
+}
+
+// track wraps the given connection to record its activity, and to forget it when it
+// is closed. It fails while draining.
+func (t *Tracker) track(conn net.Conn) (net.Conn, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.draining {
+		return nil, errDraining
+	}
+	tracked := &trackedConn{Conn: conn, tracker: t, lastActive: t.now().UnixNano()}
+	t.streams[tracked] = struct{}{}
+	return tracked, nil
+}
+
+func (t *Tracker) isDraining() bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.draining
+}
+
+// WithStreamTracking tracks the connections hijacked by the upgrade requests passed to
+// the handler. While draining, upgrade requests are answered with 503 and a Retry-After
+// header.
+func WithStreamTracking(handler http.Handler, tracker *Tracker) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !httpstream.IsUpgradeRequest(req) {
+			handler.ServeHTTP(w, req)
+			return
+		}
+		if tracker.isDraining() {
+			responsewriters.ErrorNegotiated(draining(), errorCodecs, schema.GroupVersion{}, w, req)
+			return
+		}
+		handler.ServeHTTP(responsewriter.WrapForHTTP1Or2(&trackingResponseWriter{ResponseWriter: w, tracker: tracker}), req)
+	}
+}
+
+// draining returns a 503 error asking clients to open their stream again later.
+func draining() error {
+	return &apierrors.StatusError{ErrStatus: metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    http.StatusServiceUnavailable,
+		Reason:  metav1.StatusReasonServiceUnavailable,
+		Message: errDraining.Error() + ", please try again later",
+		Details: &metav1.StatusDetails{
+			RetryAfterSeconds: retryAfterSeconds,
+		},
+	}}
+}
+
+// trackingResponseWriter tracks the connection once hijacked.
+type trackingResponseWriter struct {
+	http.ResponseWriter
+	tracker *Tracker
+}
+
+var _ responsewriter.UserProvidedDecorator = &trackingResponseWriter{}
+var _ http.Hijacker = &trackingResponseWriter{}
+
+func (w *trackingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *trackingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("connection does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	// read the bytes already buffered by the server first, and account for all further
+	// reads and writes.
+	tracked, err := w.tracker.track(&bufferedConn{Conn: conn, reader: rw.Reader})
+	if err != nil {
+		conn.Close() // nolint: errcheck
+		return nil, nil, err
+	}
+	return tracked, bufio.NewReadWriter(bufio.NewReader(tracked), bufio.NewWriter(tracked)), nil
+}
+
+// trackedConn records the time of its last read or write.
+type trackedConn struct {
+	net.Conn
+	tracker *Tracker
+
+	// lastActive is the time of the last read or write in Unix nanoseconds
+	lastActive int64
+	closeOnce  sync.Once
+	closeErr   error
+}
+
+func (c *trackedConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		atomic.StoreInt64(&c.lastActive, c.tracker.now().UnixNano())
+	}
+	return n, err
+}
+
+func (c *trackedConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		atomic.StoreInt64(&c.lastActive, c.tracker.now().UnixNano())
+	}
+	return n, err
+}
+
+func (c *trackedConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.tracker.lock.Lock()
+		delete(c.tracker.streams, c)
+		c.tracker.lock.Unlock()
+		c.closeErr = c.Conn.Close()
+	})
+	return c.closeErr
+}
+
+// bufferedConn reads the bytes buffered while hijacking the connection first.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
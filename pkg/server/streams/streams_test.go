@@ -0,0 +1,159 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package streams
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// echo upgrades the connection and echoes what it reads until the client closes it.
+var echo = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+	conn, rw, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n") // nolint: errcheck
+	rw.Flush()                                                                                      // nolint: errcheck
+	io.Copy(rw, rw)                                                                                 // nolint: errcheck
+	rw.Flush()                                                                                      // nolint: errcheck
+})
+
+func openStream(t *testing.T, server *httptest.Server) (net.Conn, *http.Response) {
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: kcp\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, resp
+}
+
+func waitForActive(t *testing.T, tracker *Tracker, expected int) {
+	if err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		return tracker.Active() == expected, nil
+	}); err != nil {
+		t.Fatalf("expected %d active streams, got %d", expected, tracker.Active())
+	}
+}
+
+func TestWithStreamTracking(t *testing.T) {
+	tracker := NewTracker(0)
+	server := httptest.NewServer(WithStreamTracking(echo, tracker))
+	defer server.Close()
+
+	conn, resp := openStream(t, server)
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expected 101, got %d", resp.StatusCode)
+	}
+	waitForActive(t, tracker, 1)
+
+	conn.Close()
+	waitForActive(t, tracker, 0)
+}
+
+func TestDrain(t *testing.T) {
+	tracker := NewTracker(0)
+	server := httptest.NewServer(WithStreamTracking(echo, tracker))
+	defer server.Close()
+
+	conn, _ := openStream(t, server)
+	defer conn.Close()
+	waitForActive(t, tracker, 1)
+
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		tracker.Drain(100 * time.Millisecond)
+	}()
+	if err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		return tracker.isDraining(), nil
+	}); err != nil {
+		t.Fatal("expected the tracker to drain")
+	}
+
+	rejected, resp := openStream(t, server)
+	rejected.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected new streams to be rejected with 503, got %d", resp.StatusCode)
+	}
+	if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "1" {
+		t.Errorf("expected Retry-After 1, got %q", retryAfter)
+	}
+
+	<-drained
+	if active := tracker.Active(); active != 0 {
+		t.Errorf("expected no active streams after draining, got %d", active)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second)) // nolint: errcheck
+	if _, err := conn.Read(make([]byte, 1)); err == nil || strings.Contains(err.Error(), "timeout") {
+		t.Errorf("expected the stream to be closed, got %v", err)
+	}
+}
+
+func TestCloseIdle(t *testing.T) {
+	now := time.Now()
+	tracker := NewTracker(time.Minute)
+	tracker.now = func() time.Time { return now }
+
+	idle, idlePeer := net.Pipe()
+	defer idlePeer.Close()
+	active, activePeer := net.Pipe()
+	defer activePeer.Close()
+	go io.Copy(io.Discard, idlePeer)   // nolint: errcheck
+	go io.Copy(io.Discard, activePeer) // nolint: errcheck
+
+	trackedIdle, err := tracker.track(idle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trackedActive, err := tracker.track(active)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(50 * time.Second)
+	if _, err := trackedActive.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(30 * time.Second)
+	tracker.closeIdle()
+
+	if _, err := trackedIdle.Write([]byte("ping")); err == nil {
+		t.Errorf("expected the idle stream to be closed")
+	}
+	if _, err := trackedActive.Write([]byte("ping")); err != nil {
+		t.Errorf("expected the active stream to be open, got %v", err)
+	}
+	if active := tracker.Active(); active != 1 {
+		t.Errorf("expected 1 active stream, got %d", active)
+	}
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tenancyconversion converts the ClusterWorkspaces and ClusterWorkspaceTypes between
+// their v1alpha1 and v1beta1 versions inside of kcp.
+//
+// The CRDs of both resources declare a conversion webhook with the URL of Host, which no
+// network request is ever sent to: the webhook client of the CRDs is resolved to a client
+// calling the conversion handler of this package in-process.
+package tenancyconversion
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apiserver/pkg/util/webhook"
+	"k8s.io/client-go/rest"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	tenancyv1beta1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1beta1"
+)
+
+// Host is the host of the conversion webhook URL of the tenancy CRDs. It must match the
+// URL in config/crds.
+const Host = "tenancy-conversion.kcp.local"
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(tenancyv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(tenancyv1beta1.AddToScheme(scheme))
+}
+
+// NewAuthenticationInfoResolverWrapper returns a wrapper resolving the webhook clients for
+// Host to clients calling the conversion handler in-process, and delegating the others.
+func NewAuthenticationInfoResolverWrapper() webhook.AuthenticationInfoResolverWrapper {
+	return func(delegate webhook.AuthenticationInfoResolver) webhook.AuthenticationInfoResolver {
+		return &authenticationInfoResolver{delegate: delegate, handler: NewHandler()}
+	}
+}
+
+type authenticationInfoResolver struct {
+	delegate webhook.AuthenticationInfoResolver
+	handler  http.Handler
+}
+
+func (r *authenticationInfoResolver) ClientConfigFor(hostPort string) (*rest.Config, error) {
+	if host, _, err := net.SplitHostPort(hostPort); err == nil && host == Host {
+		return &rest.Config{Transport: &handlerTransport{handler: r.handler}}, nil
+	}
+	return r.delegate.ClientConfigFor(hostPort)
+}
+
+func (r *authenticationInfoResolver) ClientConfigForService(serviceName, serviceNamespace string, servicePort int) (*rest.Config, error) {
+	return r.delegate.ClientConfigForService(serviceName, serviceNamespace, servicePort)
+}
+
+// handlerTransport serves the requests with a handler instead of sending them.
+type handlerTransport struct {
+	handler http.Handler
+}
+
+func (t *handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorder := httptest.NewRecorder()
+	t.handler.ServeHTTP(recorder, req)
+	return recorder.Result(), nil
+}
+
+// NewHandler returns a handler serving v1 ConversionReviews of ClusterWorkspaces and
+// ClusterWorkspaceTypes.
+func NewHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var review apiextensionsv1.ConversionReview
+		if err := json.Unmarshal(body, &review); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if review.Request == nil {
+			http.Error(w, "missing conversion request", http.StatusBadRequest)
+			return
+		}
+
+		review.Response = convertRequest(review.Request)
+		review.Request = nil
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(&review); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// convertRequest converts the objects of the given conversion request to its desired version.
+func convertRequest(req *apiextensionsv1.ConversionRequest) *apiextensionsv1.ConversionResponse {
+	resp := &apiextensionsv1.ConversionResponse{UID: req.UID}
+	desired, err := schema.ParseGroupVersion(req.DesiredAPIVersion)
+	if err != nil {
+		resp.Result = metav1.Status{Status: metav1.StatusFailure, Message: err.Error()}
+		return resp
+	}
+	for _, obj := range req.Objects {
+		converted, err := convert(obj.Raw, desired)
+		if err != nil {
+			resp.ConvertedObjects = nil
+			resp.Result = metav1.Status{Status: metav1.StatusFailure, Message: err.Error()}
+			return resp
+		}
+		resp.ConvertedObjects = append(resp.ConvertedObjects, runtime.RawExtension{Raw: converted})
+	}
+	resp.Result = metav1.Status{Status: metav1.StatusSuccess}
+	return resp
+}
+
+func convert(raw []byte, desired schema.GroupVersion) ([]byte, error) {
+	var typeMeta metav1.TypeMeta
+	if err := json.Unmarshal(raw, &typeMeta); err != nil {
+		return nil, err
+	}
+	gvk := typeMeta.GroupVersionKind()
+	if gvk.Group != desired.Group {
+		return nil, fmt.Errorf("cannot convert %s to %s", gvk, desired)
+	}
+	if gvk.Version == desired.Version {
+		return raw, nil
+	}
+
+	in, err := scheme.New(gvk)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, in); err != nil {
+		return nil, err
+	}
+	out, err := scheme.New(desired.WithKind(gvk.Kind))
+	if err != nil {
+		return nil, err
+	}
+	if err := scheme.Convert(in, out, nil); err != nil {
+		return nil, err
+	}
+	out.GetObjectKind().SetGroupVersionKind(desired.WithKind(gvk.Kind))
+	return json.Marshal(out)
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tenancyconversion
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	tenancyv1beta1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1beta1"
+)
+
+type fakeResolver struct{}
+
+func (fakeResolver) ClientConfigFor(hostPort string) (*rest.Config, error) {
+	return &rest.Config{Host: hostPort}, nil
+}
+
+func (fakeResolver) ClientConfigForService(serviceName, serviceNamespace string, servicePort int) (*rest.Config, error) {
+	return &rest.Config{Host: serviceName}, nil
+}
+
+// convertThroughWebhook converts the given objects to the given version through the
+// webhook client resolved for Host.
+func convertThroughWebhook(t *testing.T, desiredAPIVersion string, objs ...runtime.Object) []runtime.RawExtension {
+	cfg, err := NewAuthenticationInfoResolverWrapper()(fakeResolver{}).ClientConfigFor(Host + ":443")
+	require.NoError(t, err)
+	require.NotNil(t, cfg.Transport)
+
+	review := apiextensionsv1.ConversionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "apiextensions.k8s.io/v1", Kind: "ConversionReview"},
+		Request:  &apiextensionsv1.ConversionRequest{UID: types.UID("review"), DesiredAPIVersion: desiredAPIVersion},
+	}
+	for _, obj := range objs {
+		raw, err := json.Marshal(obj)
+		require.NoError(t, err)
+		review.Request.Objects = append(review.Request.Objects, runtime.RawExtension{Raw: raw})
+	}
+	body, err := json.Marshal(&review)
+	require.NoError(t, err)
+
+	resp, err := (&http.Client{Transport: cfg.Transport}).Post("https://"+Host+"/convert", "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var result apiextensionsv1.ConversionReview
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	require.NotNil(t, result.Response)
+	require.Equal(t, types.UID("review"), result.Response.UID)
+	require.Equal(t, metav1.StatusSuccess, result.Response.Result.Status, result.Response.Result.Message)
+	return result.Response.ConvertedObjects
+}
+
+func TestRoundTrip(t *testing.T) {
+	workspace := &tenancyv1alpha1.ClusterWorkspace{
+		TypeMeta:   metav1.TypeMeta{APIVersion: tenancyv1alpha1.SchemeGroupVersion.String(), Kind: "ClusterWorkspace"},
+		ObjectMeta: metav1.ObjectMeta{ClusterName: "root:org", Name: "team", ResourceVersion: "42"},
+		Spec:       tenancyv1alpha1.ClusterWorkspaceSpec{Type: "Team"},
+		Status: tenancyv1alpha1.ClusterWorkspaceStatus{
+			Phase:        tenancyv1alpha1.ClusterWorkspacePhaseInitializing,
+			BaseURL:      "https://shard/clusters/root:org:team",
+			Initializers: []tenancyv1alpha1.ClusterWorkspaceInitializer{"initializers.tenancy.kcp.dev/team"},
+		},
+	}
+	workspaceType := &tenancyv1alpha1.ClusterWorkspaceType{
+		TypeMeta:   metav1.TypeMeta{APIVersion: tenancyv1alpha1.SchemeGroupVersion.String(), Kind: "ClusterWorkspaceType"},
+		ObjectMeta: metav1.ObjectMeta{ClusterName: "root:org", Name: "team"},
+		Spec:       tenancyv1alpha1.ClusterWorkspaceTypeSpec{Initializers: []tenancyv1alpha1.ClusterWorkspaceInitializer{"initializers.tenancy.kcp.dev/team"}},
+	}
+
+	betas := convertThroughWebhook(t, tenancyv1beta1.SchemeGroupVersion.String(), workspace, workspaceType)
+	require.Len(t, betas, 2)
+
+	var betaWorkspace tenancyv1beta1.ClusterWorkspace
+	require.NoError(t, json.Unmarshal(betas[0].Raw, &betaWorkspace))
+	require.Equal(t, tenancyv1beta1.SchemeGroupVersion.String(), betaWorkspace.APIVersion)
+	require.Equal(t, "ClusterWorkspace", betaWorkspace.Kind)
+	require.Equal(t, workspace.ObjectMeta, betaWorkspace.ObjectMeta)
+	require.Equal(t, tenancyv1beta1.ClusterWorkspaceTypeReference{Name: "Team"}, betaWorkspace.Spec.Type)
+	require.Equal(t, workspace.Status.BaseURL, betaWorkspace.Status.URL)
+	require.Equal(t, []tenancyv1beta1.ClusterWorkspaceInitializer{{Domain: "initializers.tenancy.kcp.dev", Name: "team"}}, betaWorkspace.Status.Initializers)
+
+	var betaWorkspaceType tenancyv1beta1.ClusterWorkspaceType
+	require.NoError(t, json.Unmarshal(betas[1].Raw, &betaWorkspaceType))
+	require.Equal(t, []tenancyv1beta1.ClusterWorkspaceInitializer{{Domain: "initializers.tenancy.kcp.dev", Name: "team"}}, betaWorkspaceType.Spec.Initializers)
+
+	alphas := convertThroughWebhook(t, tenancyv1alpha1.SchemeGroupVersion.String(), &betaWorkspace, &betaWorkspaceType)
+	require.Len(t, alphas, 2)
+
+	var alphaWorkspace tenancyv1alpha1.ClusterWorkspace
+	require.NoError(t, json.Unmarshal(alphas[0].Raw, &alphaWorkspace))
+	require.Equal(t, workspace, &alphaWorkspace)
+	var alphaWorkspaceType tenancyv1alpha1.ClusterWorkspaceType
+	require.NoError(t, json.Unmarshal(alphas[1].Raw, &alphaWorkspaceType))
+	require.Equal(t, workspaceType, &alphaWorkspaceType)
+}
+
+func TestOtherHostsAreDelegated(t *testing.T) {
+	cfg, err := NewAuthenticationInfoResolverWrapper()(fakeResolver{}).ClientConfigFor("example.com:443")
+	require.NoError(t, err)
+	require.Nil(t, cfg.Transport)
+	require.Equal(t, "example.com:443", cfg.Host)
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package watchcache
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/generic"
+	"k8s.io/apiserver/pkg/storage"
+	"k8s.io/apiserver/pkg/storage/storagebackend"
+	"k8s.io/apiserver/pkg/storage/storagebackend/factory"
+	"k8s.io/client-go/tools/cache"
+)
+
+// withWildcardBookmarks decorates the storage of a resource not served from the watch
+// cache, such that the wildcard watches allowing bookmarks get them.
+func withWildcardBookmarks(decorator generic.StorageDecorator) generic.StorageDecorator {
+	return func(
+		config *storagebackend.ConfigForResource,
+		resourcePrefix string,
+		keyFunc func(obj runtime.Object) (string, error),
+		newFunc func() runtime.Object,
+		newListFunc func() runtime.Object,
+		getAttrsFunc storage.AttrFunc,
+		triggerFuncs storage.IndexerFuncs,
+		indexers *cache.Indexers,
+	) (storage.Interface, factory.DestroyFunc, error) {
+		s, destroy, err := decorator(config, resourcePrefix, keyFunc, newFunc, newListFunc, getAttrsFunc, triggerFuncs, indexers)
+		if err != nil {
+			return s, destroy, err
+		}
+		return &wildcardBookmarks{Interface: s}, destroy, nil
+	}
+}
+
+// wildcardBookmarks requests the progress notifications of etcd for the wildcard watches
+// allowing bookmarks, which etcd sends on idle watches and the storage turns into bookmarks.
+// Only the watch cache sends bookmarks otherwise, such that the consumers of the wildcard
+// watches of uncached resources, e.g. the syncer virtual workspace filtering most of the
+// events out, would fail to resume from their last resource version after it is compacted,
+// and relist everything.
+//
+// Per-cluster watches are left alone: they are many more, and resuming them is cheap.
+type wildcardBookmarks struct {
+	storage.Interface
+}
+
+func (s *wildcardBookmarks) Watch(ctx context.Context, key string, opts storage.ListOptions) (watch.Interface, error) {
+	return s.Interface.Watch(ctx, key, withProgressNotify(ctx, opts))
+}
+
+func (s *wildcardBookmarks) WatchList(ctx context.Context, key string, opts storage.ListOptions) (watch.Interface, error) {
+	return s.Interface.WatchList(ctx, key, withProgressNotify(ctx, opts))
+}
+
+// withProgressNotify returns the options of a watch, requesting progress notifications
+// for the wildcard watches allowing bookmarks.
+func withProgressNotify(ctx context.Context, opts storage.ListOptions) storage.ListOptions {
+	if cluster := genericapirequest.ClusterFrom(ctx); cluster != nil && cluster.Wildcard && opts.Predicate.AllowWatchBookmarks {
+		opts.ProgressNotify = true
+	}
+	return opts
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package watchcache tunes the watch cache of the resources served by kcp per resource
+// and per workspace type, and measures its hit ratio per logical cluster.
+//
+// There is one watch cache per resource, shared by all the logical clusters, and sized
+// dynamically by the apiserver. A resource can be configured to be served from its watch
+// cache or not, and this can be overridden for the workspaces of a given type: e.g. the
+// workload resources can be cached only for the workspaces of a busy type, and the reads
+// of the other workspaces served from etcd.
+package watchcache
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	genericoptions "k8s.io/apiserver/pkg/server/options"
+	"k8s.io/client-go/tools/clusters"
+
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+	tenancylisters "github.com/kcp-dev/kcp/pkg/client/listers/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/workspacetype"
+)
+
+// AllResources is the resource of the workspace type settings applying to all resources.
+var AllResources = schema.GroupResource{Resource: "*"}
+
+// Config decides which resources are served from the watch cache, per workspace type.
+type Config struct {
+	// enabled is false if the watch cache is disabled for all resources.
+	enabled bool
+	// sizes are the watch cache sizes per resource, zero disabling the watch cache.
+	sizes map[schema.GroupResource]int
+	// workspaceTypeSizes are the watch cache sizes per workspace type and resource,
+	// overriding sizes for the workspaces of the type.
+	workspaceTypeSizes map[string]map[schema.GroupResource]int
+	// workspaceType returns the type of the workspace of a logical cluster, or false
+	// if it has none.
+	workspaceType func(clusterName string) (string, bool)
+}
+
+// NewConfig returns the watch cache Config of the given etcd options and workspace type
+// settings, in the format <workspace type>:<resource[.group]>#<size>, where the resource
+// can be * for all resources.
+func NewConfig(etcd *genericoptions.EtcdOptions, workspaceTypeSettings []string, workspaceLister tenancylisters.ClusterWorkspaceLister) (*Config, error) {
+	sizes, err := genericoptions.ParseWatchCacheSizes(etcd.WatchCacheSizes)
+	if err != nil {
+		return nil, err
+	}
+	workspaceTypeSizes, err := ParseWorkspaceTypeSizes(workspaceTypeSettings)
+	if err != nil {
+		return nil, err
+	}
+	return &Config{
+		enabled:            etcd.EnableWatchCache,
+		sizes:              sizes,
+		workspaceTypeSizes: workspaceTypeSizes,
+		workspaceType: func(clusterName string) (string, bool) {
+			return workspaceType(workspaceLister, clusterName)
+		},
+	}, nil
+}
+
+// ParseWorkspaceTypeSizes parses watch cache settings in the format
+// <workspace type>:<resource[.group]>#<size> into sizes per workspace type and resource.
+func ParseWorkspaceTypeSizes(settings []string) (map[string]map[schema.GroupResource]int, error) {
+	ret := map[string]map[schema.GroupResource]int{}
+	for _, setting := range settings {
+		tokens := strings.SplitN(setting, ":", 2)
+		if len(tokens) != 2 || tokens[0] == "" {
+			return nil, fmt.Errorf("invalid workspace type watch cache setting, expected <workspace type>:<resource[.group]>#<size>: %s", setting)
+		}
+		sizes, err := genericoptions.ParseWatchCacheSizes(tokens[1:])
+		if err != nil {
+			return nil, err
+		}
+		if ret[tokens[0]] == nil {
+			ret[tokens[0]] = map[schema.GroupResource]int{}
+		}
+		for gr, size := range sizes {
+			ret[tokens[0]][gr] = size
+		}
+	}
+	return ret, nil
+}
+
+// workspaceType returns the type of the ClusterWorkspace of the given logical cluster.
+func workspaceType(workspaceLister tenancylisters.ClusterWorkspaceLister, clusterName string) (string, bool) {
+	if clusterName == helper.RootCluster {
+		return "", false
+	}
+	parentClusterName, err := helper.ParentClusterName(clusterName)
+	if err != nil {
+		return "", false
+	}
+	_, name, err := helper.ParseLogicalClusterName(clusterName)
+	if err != nil {
+		return "", false
+	}
+	ws, err := workspaceLister.Get(clusters.ToClusterAwareKey(parentClusterName, name))
+	if err != nil {
+		return "", false
+	}
+	return workspacetype.TypeName(ws), true
+}
+
+// cached returns whether the given resource has a watch cache, i.e. if it is served from
+// the watch cache for the workspaces of at least one type.
+func (c *Config) cached(gr schema.GroupResource) bool {
+	if !c.enabled {
+		return false
+	}
+	if size, found := c.sizes[gr]; !found || size > 0 {
+		return true
+	}
+	for _, sizes := range c.workspaceTypeSizes {
+		if sizeFor(sizes, gr, 0) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// cachedFor returns whether the reads of the given resource in the given logical cluster
+// are served from the watch cache.
+func (c *Config) cachedFor(gr schema.GroupResource, clusterName string) bool {
+	size, found := c.sizes[gr]
+	if !found {
+		size = 1 // the size is dynamic, only zero matters
+	}
+	if len(c.workspaceTypeSizes) > 0 && clusterName != "" {
+		if wsType, ok := c.workspaceType(clusterName); ok {
+			size = sizeFor(c.workspaceTypeSizes[wsType], gr, size)
+		}
+	}
+	return size > 0
+}
+
+// sizeFor returns the size of the given resource in the given sizes, falling back to the
+// size for all resources, and then to the default size.
+func sizeFor(sizes map[schema.GroupResource]int, gr schema.GroupResource, defaultSize int) int {
+	if size, found := sizes[gr]; found {
+		return size
+	}
+	if size, found := sizes[AllResources]; found {
+		return size
+	}
+	return defaultSize
+}
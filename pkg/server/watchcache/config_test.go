@@ -0,0 +1,94 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package watchcache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestParseWorkspaceTypeSizes(t *testing.T) {
+	sizes, err := ParseWorkspaceTypeSizes([]string{"Busy:deployments.apps#100", "Busy:*#0", "Universal:configmaps#0"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]map[schema.GroupResource]int{
+		"Busy": {
+			{Group: "apps", Resource: "deployments"}: 100,
+			AllResources:                             0,
+		},
+		"Universal": {
+			{Resource: "configmaps"}: 0,
+		},
+	}, sizes)
+
+	for _, invalid := range []string{"deployments.apps#100", ":deployments.apps#100", "Busy:deployments.apps", "Busy:deployments.apps#-1"} {
+		_, err := ParseWorkspaceTypeSizes([]string{invalid})
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestCachedFor(t *testing.T) {
+	deployments := schema.GroupResource{Group: "apps", Resource: "deployments"}
+	configmaps := schema.GroupResource{Resource: "configmaps"}
+	secrets := schema.GroupResource{Resource: "secrets"}
+
+	c := &Config{
+		enabled: true,
+		sizes: map[schema.GroupResource]int{
+			deployments: 0,
+		},
+		workspaceTypeSizes: map[string]map[schema.GroupResource]int{
+			"Busy":      {deployments: 100},
+			"Universal": {AllResources: 0, secrets: 100},
+		},
+		workspaceType: func(clusterName string) (string, bool) {
+			switch clusterName {
+			case "root:org:busy":
+				return "Busy", true
+			case "root:org:universal":
+				return "Universal", true
+			default:
+				return "", false
+			}
+		},
+	}
+
+	require.True(t, c.cached(deployments), "deployments are cached for the busy workspaces")
+	require.True(t, c.cached(configmaps))
+
+	tests := []struct {
+		resource    schema.GroupResource
+		clusterName string
+		want        bool
+	}{
+		{deployments, "root:org:busy", true},
+		{deployments, "root:org:universal", false},
+		{deployments, "root:org:unknown", false},
+		{configmaps, "root:org:busy", true},
+		{configmaps, "root:org:universal", false},
+		{secrets, "root:org:universal", true},
+		{configmaps, "root", true},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.want, c.cachedFor(tt.resource, tt.clusterName), "%s in %s", tt.resource, tt.clusterName)
+	}
+
+	c.enabled = false
+	require.False(t, c.cached(configmaps), "the watch cache is disabled")
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package watchcache
+
+import (
+	"sync"
+
+	compbasemetrics "k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+
+	kcpmetrics "github.com/kcp-dev/kcp/pkg/server/metrics"
+)
+
+const (
+	namespace = "kcp"
+	subsystem = "watch_cache"
+
+	// NoCluster is the logical cluster label of the reads without a logical cluster.
+	NoCluster = "none"
+)
+
+var (
+	reads = compbasemetrics.NewCounterVec(
+		&compbasemetrics.CounterOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "reads_total",
+			Help:           "Counter of gets and lists of resources with a watch cache, broken out by resource, logical cluster and whether they were served from the watch cache ('hit') or from etcd ('miss'). Logical clusters which are neither allowed nor among the busiest ones are counted as 'other'.",
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+		[]string{"resource", "logical_cluster", "result"},
+	)
+)
+
+var (
+	lock sync.Mutex
+	// recorder records the reads, once SetClusterLabeling is called.
+	recorder *readRecorder
+
+	registerMetrics sync.Once
+)
+
+// SetClusterLabeling configures the logical clusters broken out in the watch cache
+// metrics: the allowed ones, and the topN other logical clusters with the most reads
+// in the previous minute.
+func SetClusterLabeling(allowed []string, topN int) {
+	registerMetrics.Do(func() {
+		legacyregistry.MustRegister(reads)
+	})
+
+	lock.Lock()
+	defer lock.Unlock()
+	recorder = newReadRecorder(allowed, topN)
+}
+
+// observe records a read of the given resource in the given logical cluster.
+func observe(resource, clusterName string, hit bool) {
+	lock.Lock()
+	r := recorder
+	lock.Unlock()
+	if r != nil {
+		r.observe(resource, clusterName, hit)
+	}
+}
+
+// series are the label values, other than the logical cluster, of the series
+// recorded for a logical cluster.
+type series struct {
+	resource string
+	result   string
+}
+
+// readRecorder records the reads under the label of their logical cluster, and deletes
+// the series of the logical clusters which are not broken out anymore.
+type readRecorder struct {
+	labeler *kcpmetrics.ClusterLabeler
+
+	// recorded are the series recorded per broken out logical cluster. It is only
+	// accessed by the callbacks of the labeler, which hold its lock.
+	recorded map[string]map[series]bool
+}
+
+func newReadRecorder(allowed []string, topN int) *readRecorder {
+	r := &readRecorder{
+		recorded: map[string]map[series]bool{},
+	}
+	r.labeler = kcpmetrics.NewClusterLabeler(allowed, topN, r.evict)
+	return r
+}
+
+func (r *readRecorder) observe(resource, clusterName string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	r.labeler.Observe(clusterName, func(label string) {
+		if label != kcpmetrics.OtherClusters {
+			if r.recorded[label] == nil {
+				r.recorded[label] = map[series]bool{}
+			}
+			r.recorded[label][series{resource: resource, result: result}] = true
+		}
+		reads.WithLabelValues(resource, label, result).Inc()
+	})
+}
+
+func (r *readRecorder) evict(clusterName string) {
+	for s := range r.recorded[clusterName] {
+		reads.Delete(map[string]string{"resource": s.resource, "logical_cluster": clusterName, "result": s.result})
+	}
+	delete(r.recorded, clusterName)
+}
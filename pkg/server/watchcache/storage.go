@@ -0,0 +1,160 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package watchcache
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/features"
+	"k8s.io/apiserver/pkg/registry/generic"
+	genericregistry "k8s.io/apiserver/pkg/registry/generic/registry"
+	"k8s.io/apiserver/pkg/storage"
+	"k8s.io/apiserver/pkg/storage/storagebackend"
+	"k8s.io/apiserver/pkg/storage/storagebackend/factory"
+	utilfeature "k8s.io/apiserver/pkg/util/feature"
+	"k8s.io/client-go/tools/cache"
+
+	kcpmetrics "github.com/kcp-dev/kcp/pkg/server/metrics"
+)
+
+// RESTOptionsGetter wraps the given RESTOptionsGetter to decide the watch cache of every
+// resource according to the Config. Contrary to the generic apiserver, this applies the
+// per-resource settings to the resources served by CRDs as well, including the ones bound
+// through APIBindings. The wildcard watches of the resources without watch cache get
+// bookmarks from etcd.
+func (c *Config) RESTOptionsGetter(delegate generic.RESTOptionsGetter) generic.RESTOptionsGetter {
+	return &restOptionsGetter{delegate: delegate, config: c}
+}
+
+type restOptionsGetter struct {
+	delegate generic.RESTOptionsGetter
+	config   *Config
+}
+
+func (g *restOptionsGetter) GetRESTOptions(resource schema.GroupResource) (generic.RESTOptions, error) {
+	opts, err := g.delegate.GetRESTOptions(resource)
+	if err != nil {
+		return opts, err
+	}
+	if !g.config.cached(resource) {
+		opts.Decorator = withWildcardBookmarks(generic.UndecoratedStorage)
+		return opts, nil
+	}
+	opts.Decorator = g.config.decorator(resource)
+	return opts, nil
+}
+
+// decorator returns a storage decorator creating the watch cache of the given resource,
+// which serves the reads of the logical clusters the resource is cached for.
+func (c *Config) decorator(resource schema.GroupResource) generic.StorageDecorator {
+	cacher := genericregistry.StorageWithCacher()
+	return func(
+		config *storagebackend.ConfigForResource,
+		resourcePrefix string,
+		keyFunc func(obj runtime.Object) (string, error),
+		newFunc func() runtime.Object,
+		newListFunc func() runtime.Object,
+		getAttrsFunc storage.AttrFunc,
+		triggerFuncs storage.IndexerFuncs,
+		indexers *cache.Indexers,
+	) (storage.Interface, factory.DestroyFunc, error) {
+		s, destroy, err := cacher(config, resourcePrefix, keyFunc, newFunc, newListFunc, getAttrsFunc, triggerFuncs, indexers)
+		if err != nil {
+			return s, destroy, err
+		}
+		return &clusterAwareCacher{
+			Interface: s,
+			resource:  resource.String(),
+			cachedFor: func(clusterName string) bool { return c.cachedFor(resource, clusterName) },
+		}, destroy, nil
+	}
+}
+
+// clusterAwareCacher serves the reads of the logical clusters a resource is not cached for
+// from etcd, and records whether the reads are served from the watch cache. Watches are
+// always served from the watch cache.
+type clusterAwareCacher struct {
+	storage.Interface
+
+	resource  string
+	cachedFor func(clusterName string) bool
+}
+
+// clusterOf returns the logical cluster label of the request, and whether its reads are
+// served from the watch cache.
+func (c *clusterAwareCacher) clusterOf(ctx context.Context) (string, bool) {
+	cluster := genericapirequest.ClusterFrom(ctx)
+	switch {
+	case cluster == nil || cluster.Name == "" && !cluster.Wildcard:
+		return NoCluster, true
+	case cluster.Wildcard:
+		return kcpmetrics.WildcardCluster, true
+	default:
+		return cluster.Name, c.cachedFor(cluster.Name)
+	}
+}
+
+func (c *clusterAwareCacher) Get(ctx context.Context, key string, opts storage.GetOptions, objPtr runtime.Object) error {
+	clusterName, cached := c.clusterOf(ctx)
+	if !cached {
+		// An unset resource version is served from etcd, with the latest data.
+		opts.ResourceVersion = ""
+	}
+	observe(c.resource, clusterName, opts.ResourceVersion != "")
+	return c.Interface.Get(ctx, key, opts, objPtr)
+}
+
+func (c *clusterAwareCacher) GetToList(ctx context.Context, key string, opts storage.ListOptions, listObj runtime.Object) error {
+	opts = c.routeList(ctx, opts)
+	return c.Interface.GetToList(ctx, key, opts, listObj)
+}
+
+func (c *clusterAwareCacher) List(ctx context.Context, key string, opts storage.ListOptions, listObj runtime.Object) error {
+	opts = c.routeList(ctx, opts)
+	return c.Interface.List(ctx, key, opts, listObj)
+}
+
+// routeList returns the options of a list, served from etcd for the logical clusters
+// the resource is not cached for, and records whether it is served from the cache.
+func (c *clusterAwareCacher) routeList(ctx context.Context, opts storage.ListOptions) storage.ListOptions {
+	clusterName, cached := c.clusterOf(ctx)
+	fromCache := !shouldDelegateList(opts)
+	if fromCache && !cached {
+		// An unset resource version is served from etcd, with the latest data.
+		opts.ResourceVersion = ""
+		opts.ResourceVersionMatch = ""
+		fromCache = false
+	}
+	observe(c.resource, clusterName, fromCache)
+	return opts
+}
+
+// shouldDelegateList returns whether the cacher delegates a list to etcd.
+//
+// NOTICE: Keep in sync with shouldDelegateList in k8s.io/apiserver/pkg/storage/cacher.
+func shouldDelegateList(opts storage.ListOptions) bool {
+	resourceVersion := opts.ResourceVersion
+	pred := opts.Predicate
+	pagingEnabled := utilfeature.DefaultFeatureGate.Enabled(features.APIListChunking)
+	hasContinuation := pagingEnabled && len(pred.Continue) > 0
+	hasLimit := pagingEnabled && pred.Limit > 0 && resourceVersion != "0"
+	return resourceVersion == "" || hasContinuation || hasLimit || opts.ResourceVersionMatch == metav1.ResourceVersionMatchExact
+}
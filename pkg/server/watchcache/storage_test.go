@@ -0,0 +1,149 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package watchcache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/storage"
+)
+
+// recordingStorage records the options of the reads it serves.
+type recordingStorage struct {
+	storage.Interface
+
+	getOpts   storage.GetOptions
+	listOpts  storage.ListOptions
+	watchOpts storage.ListOptions
+}
+
+func (s *recordingStorage) Get(_ context.Context, _ string, opts storage.GetOptions, _ runtime.Object) error {
+	s.getOpts = opts
+	return nil
+}
+
+func (s *recordingStorage) List(_ context.Context, _ string, opts storage.ListOptions, _ runtime.Object) error {
+	s.listOpts = opts
+	return nil
+}
+
+func (s *recordingStorage) Watch(_ context.Context, _ string, opts storage.ListOptions) (watch.Interface, error) {
+	s.watchOpts = opts
+	return watch.NewEmptyWatch(), nil
+}
+
+func TestClusterAwareCacher(t *testing.T) {
+	delegate := &recordingStorage{}
+	c := &clusterAwareCacher{
+		Interface: delegate,
+		resource:  "configmaps",
+		cachedFor: func(clusterName string) bool { return clusterName != "root:org:uncached" },
+	}
+	inCluster := func(clusterName string) context.Context {
+		return genericapirequest.WithCluster(context.Background(), genericapirequest.Cluster{Name: clusterName})
+	}
+
+	tests := []struct {
+		name        string
+		ctx         context.Context
+		opts        storage.ListOptions
+		wantRV      string
+		wantRVMatch metav1.ResourceVersionMatch
+		wantGetRV   string
+	}{
+		{
+			name:        "cached logical cluster",
+			ctx:         inCluster("root:org:cached"),
+			opts:        storage.ListOptions{ResourceVersion: "0", ResourceVersionMatch: metav1.ResourceVersionMatchNotOlderThan},
+			wantRV:      "0",
+			wantRVMatch: metav1.ResourceVersionMatchNotOlderThan,
+			wantGetRV:   "0",
+		},
+		{
+			name: "uncached logical cluster",
+			ctx:  inCluster("root:org:uncached"),
+			opts: storage.ListOptions{ResourceVersion: "0", ResourceVersionMatch: metav1.ResourceVersionMatchNotOlderThan},
+		},
+		{
+			name:      "wildcard",
+			ctx:       genericapirequest.WithCluster(context.Background(), genericapirequest.Cluster{Wildcard: true}),
+			opts:      storage.ListOptions{ResourceVersion: "0"},
+			wantRV:    "0",
+			wantGetRV: "0",
+		},
+		{
+			name:      "no logical cluster",
+			ctx:       context.Background(),
+			opts:      storage.ListOptions{ResourceVersion: "0"},
+			wantRV:    "0",
+			wantGetRV: "0",
+		},
+		{
+			name:        "consistent read in an uncached logical cluster",
+			ctx:         inCluster("root:org:uncached"),
+			opts:        storage.ListOptions{ResourceVersion: "42", ResourceVersionMatch: metav1.ResourceVersionMatchExact},
+			wantRV:      "42",
+			wantRVMatch: metav1.ResourceVersionMatchExact,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, c.List(tt.ctx, "/", tt.opts, nil))
+			require.Equal(t, tt.wantRV, delegate.listOpts.ResourceVersion)
+			require.Equal(t, tt.wantRVMatch, delegate.listOpts.ResourceVersionMatch)
+
+			require.NoError(t, c.Get(tt.ctx, "/", storage.GetOptions{ResourceVersion: tt.opts.ResourceVersion}, nil))
+			require.Equal(t, tt.wantGetRV, delegate.getOpts.ResourceVersion)
+		})
+	}
+}
+
+func TestWildcardBookmarks(t *testing.T) {
+	delegate := &recordingStorage{}
+	s := &wildcardBookmarks{Interface: delegate}
+	wildcard := genericapirequest.WithCluster(context.Background(), genericapirequest.Cluster{Wildcard: true})
+	inCluster := genericapirequest.WithCluster(context.Background(), genericapirequest.Cluster{Name: "root:org"})
+
+	tests := []struct {
+		name               string
+		ctx                context.Context
+		allowBookmarks     bool
+		wantProgressNotify bool
+	}{
+		{name: "wildcard watch allowing bookmarks", ctx: wildcard, allowBookmarks: true, wantProgressNotify: true},
+		{name: "wildcard watch without bookmarks", ctx: wildcard},
+		{name: "logical cluster watch allowing bookmarks", ctx: inCluster, allowBookmarks: true},
+		{name: "no logical cluster", ctx: context.Background(), allowBookmarks: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := storage.ListOptions{ResourceVersion: "42", Predicate: storage.SelectionPredicate{AllowWatchBookmarks: tt.allowBookmarks}}
+			w, err := s.Watch(tt.ctx, "/", opts)
+			require.NoError(t, err)
+			w.Stop()
+			require.Equal(t, tt.wantProgressNotify, delegate.watchOpts.ProgressNotify)
+			require.Equal(t, "42", delegate.watchOpts.ResourceVersion)
+		})
+	}
+}
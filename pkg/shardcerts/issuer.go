@@ -0,0 +1,237 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package shardcerts issues and rotates the certificates shards use to talk to each
+// other over mutual TLS: every shard serves with a certificate issued by a CA shared by
+// all shards, trusts client certificates issued by that CA, and reaches its peers with a
+// client certificate issued by it. Only the root shard holds the key of the CA and issues
+// certificates, the other shards request theirs with CertificateSigningRequests in the
+// root logical cluster. The leaf certificates are rotated before they expire.
+package shardcerts
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	certutil "k8s.io/client-go/util/cert"
+	"k8s.io/client-go/util/keyutil"
+
+	"github.com/kcp-dev/kcp/pkg/authorization/bootstrap"
+)
+
+// clockSkew is how long before their issuance certificates are valid, for peers whose
+// clock is behind.
+const clockSkew = 5 * time.Minute
+
+const (
+	// ClientSignerName is the signer of the CertificateSigningRequests of shard client
+	// certificates.
+	ClientSignerName = "kcp.dev/shard-client"
+	// ServingSignerName is the signer of the CertificateSigningRequests of shard serving
+	// certificates.
+	ServingSignerName = "kcp.dev/shard-serving"
+)
+
+// Issuer issues certificates signed by the shard CA.
+type Issuer struct {
+	caCert *x509.Certificate
+	caKey  crypto.Signer
+	caPEM  []byte
+	now    func() time.Time
+}
+
+// LoadIssuer returns an Issuer signing with the CA certificate and key in the given files.
+func LoadIssuer(certFile, keyFile string) (*Issuer, error) {
+	caPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return NewIssuer(caPEM, keyPEM)
+}
+
+// NewIssuer returns an Issuer signing with the given PEM encoded CA certificate and key.
+func NewIssuer(caPEM, keyPEM []byte) (*Issuer, error) {
+	certs, err := certutil.ParseCertsPEM(caPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid shard CA certificate: %w", err)
+	}
+	if !certs[0].IsCA {
+		return nil, fmt.Errorf("shard CA certificate %q is not a CA", certs[0].Subject.CommonName)
+	}
+	key, err := keyutil.ParsePrivateKeyPEM(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid shard CA key: %w", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("shard CA key of type %T cannot sign", key)
+	}
+	return &Issuer{
+		caCert: certs[0],
+		caKey:  signer,
+		caPEM:  pem.EncodeToMemory(&pem.Block{Type: certutil.CertificateBlockType, Bytes: certs[0].Raw}),
+		now:    time.Now,
+	}, nil
+}
+
+// CA returns the PEM encoded CA certificate.
+func (i *Issuer) CA() []byte {
+	return i.caPEM
+}
+
+// IssueServing returns a PEM encoded serving certificate and key for the given DNS names
+// and IP addresses, valid for the given duration.
+func (i *Issuer) IssueServing(hosts []string, validity time.Duration) ([]byte, []byte, error) {
+	template, err := servingTemplate(hosts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return i.issue(template, validity)
+}
+
+// IssueClient returns a PEM encoded client certificate and key for the given user and
+// groups, valid for the given duration.
+func (i *Issuer) IssueClient(userName string, groups []string, validity time.Duration) ([]byte, []byte, error) {
+	return i.issue(clientTemplate(userName, groups), validity)
+}
+
+// Sign returns the PEM encoded certificate, valid for the given duration, of the given
+// PEM encoded certificate request to the given signer. Only the client certificates of
+// shard users in the shards group, and serving certificates, are signed.
+func (i *Issuer) Sign(requestPEM []byte, signerName string, validity time.Duration) ([]byte, error) {
+	block, _ := pem.Decode(requestPEM)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, fmt.Errorf("no PEM encoded certificate request")
+	}
+	request, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if err := request.CheckSignature(); err != nil {
+		return nil, err
+	}
+	if len(request.EmailAddresses) > 0 || len(request.URIs) > 0 {
+		return nil, fmt.Errorf("email addresses and URIs are not signed")
+	}
+
+	var template *x509.Certificate
+	switch signerName {
+	case ClientSignerName:
+		if !strings.HasPrefix(request.Subject.CommonName, userNamePrefix) || len(request.Subject.CommonName) == len(userNamePrefix) {
+			return nil, fmt.Errorf("the common name of shard client certificates must be %s<shard-name>", userNamePrefix)
+		}
+		if len(request.Subject.Organization) != 1 || request.Subject.Organization[0] != bootstrap.SystemKcpShardsGroup {
+			return nil, fmt.Errorf("the organization of shard client certificates must be %s", bootstrap.SystemKcpShardsGroup)
+		}
+		if len(request.DNSNames) > 0 || len(request.IPAddresses) > 0 {
+			return nil, fmt.Errorf("shard client certificates have no DNS names and IP addresses")
+		}
+		template = clientTemplate(request.Subject.CommonName, request.Subject.Organization)
+	case ServingSignerName:
+		if len(request.Subject.Organization) > 0 {
+			return nil, fmt.Errorf("shard serving certificates have no organization")
+		}
+		hosts := append([]string{}, request.DNSNames...)
+		for _, ip := range request.IPAddresses {
+			hosts = append(hosts, ip.String())
+		}
+		if template, err = servingTemplate(hosts); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown signer %q", signerName)
+	}
+
+	return i.sign(template, request.PublicKey, validity)
+}
+
+func servingTemplate(hosts []string) (*x509.Certificate, error) {
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no hosts to issue a serving certificate for")
+	}
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: hosts[0]},
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	return template, nil
+}
+
+func clientTemplate(userName string, groups []string) *x509.Certificate {
+	return &x509.Certificate{
+		Subject:     pkix.Name{CommonName: userName, Organization: groups},
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+}
+
+func (i *Issuer) issue(template *x509.Certificate, validity time.Duration) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM, err := i.sign(template, key.Public(), validity)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err := keyutil.MarshalPrivateKeyToPEM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return certPEM, keyPEM, nil
+}
+
+func (i *Issuer) sign(template *x509.Certificate, pub interface{}, validity time.Duration) ([]byte, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	now := i.now()
+	template.SerialNumber = serial
+	template.NotBefore = now.Add(-clockSkew)
+	template.NotAfter = now.Add(validity)
+	if template.NotAfter.After(i.caCert.NotAfter) {
+		template.NotAfter = i.caCert.NotAfter
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, i.caCert, pub, i.caKey)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: certutil.CertificateBlockType, Bytes: der}), nil
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shardcerts
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	certificatesv1 "k8s.io/api/certificates/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	certificatesv1client "k8s.io/client-go/kubernetes/typed/certificates/v1"
+	certutil "k8s.io/client-go/util/cert"
+	"k8s.io/client-go/util/keyutil"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// requestInterval is how often the status of a CertificateSigningRequest is checked.
+	requestInterval = time.Second
+	// requestTimeout is how long a CertificateSigningRequest is waited for.
+	requestTimeout = 5 * time.Minute
+)
+
+// Requester issues certificates by requesting them from the root shard, which holds the
+// key of the shard CA, with CertificateSigningRequests in the root logical cluster. The
+// private keys never leave the shard.
+type Requester struct {
+	caPEM     []byte
+	client    certificatesv1client.CertificateSigningRequestInterface
+	shardName string
+
+	interval time.Duration
+	timeout  time.Duration
+}
+
+var _ Source = &Requester{}
+
+// LoadRequester returns a Requester for the given shard, trusting the CA certificate in the
+// given file, and creating the CertificateSigningRequests with the given client of the root
+// logical cluster of the root shard.
+func LoadRequester(caFile string, client certificatesv1client.CertificateSigningRequestInterface, shardName string) (*Requester, error) {
+	caPEM, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := certutil.ParseCertsPEM(caPEM); err != nil {
+		return nil, fmt.Errorf("invalid shard CA certificate: %w", err)
+	}
+	return &Requester{
+		caPEM:     caPEM,
+		client:    client,
+		shardName: shardName,
+		interval:  requestInterval,
+		timeout:   requestTimeout,
+	}, nil
+}
+
+// CA returns the PEM encoded CA certificate.
+func (r *Requester) CA() []byte {
+	return r.caPEM
+}
+
+// IssueServing requests a serving certificate for the given DNS names and IP addresses,
+// valid for the given duration, and returns it with its key, PEM encoded.
+func (r *Requester) IssueServing(hosts []string, validity time.Duration) ([]byte, []byte, error) {
+	if len(hosts) == 0 {
+		return nil, nil, fmt.Errorf("no hosts to issue a serving certificate for")
+	}
+	template := &x509.CertificateRequest{Subject: pkix.Name{CommonName: hosts[0]}}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	return r.request(template, ServingSignerName, []certificatesv1.KeyUsage{certificatesv1.UsageDigitalSignature, certificatesv1.UsageKeyEncipherment, certificatesv1.UsageServerAuth}, validity)
+}
+
+// IssueClient requests a client certificate for the given user and groups, valid for the
+// given duration, and returns it with its key, PEM encoded.
+func (r *Requester) IssueClient(userName string, groups []string, validity time.Duration) ([]byte, []byte, error) {
+	template := &x509.CertificateRequest{Subject: pkix.Name{CommonName: userName, Organization: groups}}
+	return r.request(template, ClientSignerName, []certificatesv1.KeyUsage{certificatesv1.UsageDigitalSignature, certificatesv1.UsageKeyEncipherment, certificatesv1.UsageClientAuth}, validity)
+}
+
+func (r *Requester) request(template *x509.CertificateRequest, signerName string, usages []certificatesv1.KeyUsage, validity time.Duration) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err := keyutil.MarshalPrivateKeyToPEM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	expirationSeconds := int32(validity / time.Second)
+	csr, err := r.client.Create(ctx, &certificatesv1.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: "shard-" + r.shardName + "-"},
+		Spec: certificatesv1.CertificateSigningRequestSpec{
+			Request:           pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}),
+			SignerName:        signerName,
+			Usages:            usages,
+			ExpirationSeconds: &expirationSeconds,
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to request a %s certificate: %w", signerName, err)
+	}
+	klog.Infof("Requested a %s certificate with CertificateSigningRequest %q", signerName, csr.Name)
+	defer func() {
+		if err := r.client.Delete(context.Background(), csr.Name, metav1.DeleteOptions{}); err != nil {
+			klog.Errorf("Failed to delete CertificateSigningRequest %q: %v", csr.Name, err)
+		}
+	}()
+
+	var certPEM []byte
+	if err := wait.PollImmediateUntil(r.interval, func() (bool, error) {
+		current, err := r.client.Get(ctx, csr.Name, metav1.GetOptions{})
+		if err != nil {
+			klog.V(2).Infof("Failed to get CertificateSigningRequest %q: %v", csr.Name, err)
+			return false, nil
+		}
+		for _, c := range current.Status.Conditions {
+			if c.Type == certificatesv1.CertificateDenied || c.Type == certificatesv1.CertificateFailed {
+				return false, fmt.Errorf("CertificateSigningRequest %q is %s: %s", csr.Name, c.Type, c.Message)
+			}
+		}
+		certPEM = current.Status.Certificate
+		return len(certPEM) > 0, nil
+	}, ctx.Done()); err != nil {
+		return nil, nil, fmt.Errorf("failed to get the %s certificate of CertificateSigningRequest %q: %w", signerName, csr.Name, err)
+	}
+	return certPEM, keyPEM, nil
+}
@@ -0,0 +1,253 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shardcerts
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	certutil "k8s.io/client-go/util/cert"
+	"k8s.io/klog/v2"
+
+	"github.com/kcp-dev/kcp/pkg/authorization/bootstrap"
+)
+
+const (
+	CAFileName          = "ca.crt"
+	ClientCAFileName    = "client-ca.crt"
+	ServingCertFileName = "serving.crt"
+	ServingKeyFileName  = "serving.key"
+	ClientCertFileName  = "client.crt"
+	ClientKeyFileName   = "client.key"
+
+	FrontProxyClientCertFileName = "front-proxy-client.crt"
+	FrontProxyClientKeyFileName  = "front-proxy-client.key"
+
+	// FrontProxyUserName is the user of the front-proxy client certificate, which is
+	// trusted to forward the identity of the users in request headers.
+	FrontProxyUserName = "kcp-front-proxy"
+
+	// checkInterval is how often the certificates are checked for renewal.
+	checkInterval = time.Minute
+)
+
+const userNamePrefix = "system:kcp:shard:"
+
+// UserName returns the user of the client certificate of the given shard.
+func UserName(shardName string) string {
+	return userNamePrefix + shardName
+}
+
+// Source issues certificates signed by the shard CA, i.e. an Issuer holding its key or a
+// Requester asking the root shard for them.
+type Source interface {
+	// CA returns the PEM encoded CA certificate.
+	CA() []byte
+	// IssueServing returns a PEM encoded serving certificate and key for the given hosts.
+	IssueServing(hosts []string, validity time.Duration) ([]byte, []byte, error)
+	// IssueClient returns a PEM encoded client certificate and key for the given user and groups.
+	IssueClient(userName string, groups []string, validity time.Duration) ([]byte, []byte, error)
+}
+
+// Rotator keeps the certificates of a shard issued and renewed in a directory. The serving
+// certificate and key, and the client CA bundle, are reloaded by the server when they
+// change, the client certificate and key by the clients of the peer shards, and the
+// front-proxy client certificate and key by the proxy in front of the shards.
+type Rotator struct {
+	source    Source
+	dir       string
+	shardName string
+	hosts     []string
+	validity  time.Duration
+	// extraClientCAFile is a client CA bundle trusted in addition to the shard CA.
+	extraClientCAFile string
+	// frontProxyClient is whether the front-proxy client certificate is issued.
+	frontProxyClient bool
+	now              func() time.Time
+}
+
+// NewRotator returns a Rotator issuing the certificates of the given shard with the given
+// source, valid for the given duration, into the given directory. The serving certificate
+// is issued for the given hosts. The client CA bundle holds the shard CA and the CAs of
+// extraClientCAFile, if not empty. The front-proxy client certificate is only issued if
+// frontProxyClient is true, i.e. on the root shard.
+func NewRotator(source Source, dir, shardName string, hosts []string, extraClientCAFile string, validity time.Duration, frontProxyClient bool) *Rotator {
+	return &Rotator{
+		source:            source,
+		dir:               dir,
+		shardName:         shardName,
+		hosts:             hosts,
+		validity:          validity,
+		extraClientCAFile: extraClientCAFile,
+		frontProxyClient:  frontProxyClient,
+		now:               time.Now,
+	}
+}
+
+// Run renews the certificates until the context is done.
+func (r *Rotator) Run(ctx context.Context) {
+	wait.Until(func() {
+		if err := r.Rotate(); err != nil {
+			runtime.HandleError(fmt.Errorf("failed to rotate the shard certificates: %w", err))
+		}
+	}, checkInterval, ctx.Done())
+}
+
+// Rotate writes the CA and the client CA bundle, and issues the serving, client and
+// front-proxy client certificates that are missing, not issued by the shard CA, or past
+// two thirds of their validity.
+func (r *Rotator) Rotate() error {
+	caCerts, err := certutil.ParseCertsPEM(r.source.CA())
+	if err != nil {
+		return err
+	}
+	ca := caCerts[0]
+
+	if err := os.MkdirAll(r.dir, 0700); err != nil {
+		return err
+	}
+	if err := writeIfChanged(filepath.Join(r.dir, CAFileName), r.source.CA(), 0644); err != nil {
+		return err
+	}
+	bundle := r.source.CA()
+	if r.extraClientCAFile != "" {
+		extra, err := os.ReadFile(r.extraClientCAFile)
+		if err != nil {
+			return err
+		}
+		bundle = append(append(append([]byte{}, extra...), '\n'), bundle...)
+	}
+	if err := writeIfChanged(filepath.Join(r.dir, ClientCAFileName), bundle, 0644); err != nil {
+		return err
+	}
+
+	if r.needsRenewal(ca, ServingCertFileName, r.hosts) {
+		certPEM, keyPEM, err := r.source.IssueServing(r.hosts, r.validity)
+		if err != nil {
+			return err
+		}
+		if err := r.writePair(ServingCertFileName, ServingKeyFileName, certPEM, keyPEM); err != nil {
+			return err
+		}
+		klog.Infof("Issued the serving certificate of shard %q for %v", r.shardName, r.hosts)
+	}
+	if r.needsRenewal(ca, ClientCertFileName, nil) {
+		certPEM, keyPEM, err := r.source.IssueClient(UserName(r.shardName), []string{bootstrap.SystemKcpShardsGroup}, r.validity)
+		if err != nil {
+			return err
+		}
+		if err := r.writePair(ClientCertFileName, ClientKeyFileName, certPEM, keyPEM); err != nil {
+			return err
+		}
+		klog.Infof("Issued the client certificate of shard %q", r.shardName)
+	}
+	if r.frontProxyClient && r.needsRenewal(ca, FrontProxyClientCertFileName, nil) {
+		certPEM, keyPEM, err := r.source.IssueClient(FrontProxyUserName, nil, r.validity)
+		if err != nil {
+			return err
+		}
+		if err := r.writePair(FrontProxyClientCertFileName, FrontProxyClientKeyFileName, certPEM, keyPEM); err != nil {
+			return err
+		}
+		klog.Infof("Issued the front-proxy client certificate")
+	}
+	return nil
+}
+
+// needsRenewal returns true if the certificate in the given file is missing, invalid,
+// not issued by the given CA, not issued for the given hosts or past two thirds of its
+// validity.
+func (r *Rotator) needsRenewal(ca *x509.Certificate, certFileName string, hosts []string) bool {
+	certs, err := certutil.CertsFromFile(filepath.Join(r.dir, certFileName))
+	if err != nil {
+		return true
+	}
+	cert := certs[0]
+	if err := cert.CheckSignatureFrom(ca); err != nil {
+		return true
+	}
+	if hosts != nil && !sets.NewString(hosts...).Equal(certHosts(cert)) {
+		return true
+	}
+	renewAt := cert.NotBefore.Add(cert.NotAfter.Sub(cert.NotBefore) * 2 / 3)
+	return !r.now().Before(renewAt)
+}
+
+func certHosts(cert *x509.Certificate) sets.String {
+	hosts := sets.NewString(cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		hosts.Insert(ip.String())
+	}
+	return hosts
+}
+
+// writePair writes the key before the certificate, such that readers reloading on
+// certificate changes find a matching key.
+func (r *Rotator) writePair(certFileName, keyFileName string, certPEM, keyPEM []byte) error {
+	if err := writeFile(filepath.Join(r.dir, keyFileName), keyPEM, 0600); err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(r.dir, certFileName), certPEM, 0644)
+}
+
+func writeIfChanged(path string, data []byte, perm os.FileMode) error {
+	if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, data) {
+		return nil
+	}
+	return writeFile(path, data, perm)
+}
+
+// writeFile replaces the file atomically.
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Hosts returns the hosts the serving certificate of a shard is issued for: the host of
+// the given external address first, the advertise address, and the local host.
+func Hosts(externalHost string, advertiseAddress net.IP) []string {
+	if host, _, err := net.SplitHostPort(externalHost); err == nil {
+		externalHost = host
+	}
+	candidates := []string{externalHost}
+	if len(advertiseAddress) > 0 && !advertiseAddress.IsUnspecified() {
+		candidates = append(candidates, advertiseAddress.String())
+	}
+	candidates = append(candidates, "localhost", "127.0.0.1")
+
+	seen := sets.NewString()
+	var hosts []string
+	for _, host := range candidates {
+		if host != "" && !seen.Has(host) {
+			seen.Insert(host)
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
@@ -0,0 +1,295 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shardcerts
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	certificatesv1 "k8s.io/api/certificates/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	certutil "k8s.io/client-go/util/cert"
+	"k8s.io/client-go/util/keyutil"
+
+	"github.com/kcp-dev/kcp/pkg/authorization/bootstrap"
+)
+
+func newTestIssuer(t *testing.T) *Issuer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := certutil.NewSelfSignedCACert(certutil.Config{CommonName: "shard-ca"}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM, err := keyutil.MarshalPrivateKeyToPEM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := NewIssuer(pem.EncodeToMemory(&pem.Block{Type: certutil.CertificateBlockType, Bytes: ca.Raw}), keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return issuer
+}
+
+func readCert(t *testing.T, path string) *x509.Certificate {
+	certs, err := certutil.CertsFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certs[0]
+}
+
+func TestRotate(t *testing.T) {
+	issuer := newTestIssuer(t)
+	now := time.Now()
+	issuer.now = func() time.Time { return now }
+
+	dir := t.TempDir()
+	extraCA := filepath.Join(dir, "users.crt")
+	if err := os.WriteFile(extraCA, []byte("users\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rotator := NewRotator(issuer, filepath.Join(dir, "shard-certs"), "shard-1", []string{"kcp.example.com", "10.0.0.1"}, extraCA, 24*time.Hour, true)
+	rotator.now = issuer.now
+	if err := rotator.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(issuer.caCert)
+	serving := readCert(t, filepath.Join(rotator.dir, ServingCertFileName))
+	for _, host := range []string{"kcp.example.com", "10.0.0.1"} {
+		if _, err := serving.Verify(x509.VerifyOptions{DNSName: host, Roots: roots, CurrentTime: now}); err != nil {
+			t.Errorf("expected the serving certificate to be valid for %s: %v", host, err)
+		}
+	}
+	if _, err := tls.LoadX509KeyPair(filepath.Join(rotator.dir, ServingCertFileName), filepath.Join(rotator.dir, ServingKeyFileName)); err != nil {
+		t.Errorf("expected a matching serving key: %v", err)
+	}
+
+	client := readCert(t, filepath.Join(rotator.dir, ClientCertFileName))
+	if _, err := client.Verify(x509.VerifyOptions{Roots: roots, CurrentTime: now, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+		t.Errorf("expected a valid client certificate: %v", err)
+	}
+	if client.Subject.CommonName != "system:kcp:shard:shard-1" || !reflect.DeepEqual(client.Subject.Organization, []string{bootstrap.SystemKcpShardsGroup}) {
+		t.Errorf("unexpected client subject %v", client.Subject)
+	}
+
+	frontProxy := readCert(t, filepath.Join(rotator.dir, FrontProxyClientCertFileName))
+	if _, err := frontProxy.Verify(x509.VerifyOptions{Roots: roots, CurrentTime: now, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+		t.Errorf("expected a valid front-proxy client certificate: %v", err)
+	}
+	if frontProxy.Subject.CommonName != FrontProxyUserName || len(frontProxy.Subject.Organization) != 0 {
+		t.Errorf("unexpected front-proxy client subject %v", frontProxy.Subject)
+	}
+
+	bundle, err := os.ReadFile(filepath.Join(rotator.dir, ClientCAFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(bundle, []byte("users\n")) || !bytes.Contains(bundle, issuer.CA()) {
+		t.Errorf("expected the client CA bundle to hold the user and shard CAs, got %q", bundle)
+	}
+
+	// nothing to renew yet
+	now = now.Add(12 * time.Hour)
+	if err := rotator.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if renewed := readCert(t, filepath.Join(rotator.dir, ServingCertFileName)); !renewed.Equal(serving) {
+		t.Errorf("expected the serving certificate not to be renewed before two thirds of its validity")
+	}
+
+	// past two thirds of the validity
+	now = now.Add(5 * time.Hour)
+	if err := rotator.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if renewed := readCert(t, filepath.Join(rotator.dir, ServingCertFileName)); renewed.Equal(serving) {
+		t.Errorf("expected the serving certificate to be renewed")
+	}
+	if renewed := readCert(t, filepath.Join(rotator.dir, ClientCertFileName)); renewed.Equal(client) {
+		t.Errorf("expected the client certificate to be renewed")
+	}
+	if renewed := readCert(t, filepath.Join(rotator.dir, FrontProxyClientCertFileName)); renewed.Equal(frontProxy) {
+		t.Errorf("expected the front-proxy client certificate to be renewed")
+	}
+
+	// new hosts
+	serving = readCert(t, filepath.Join(rotator.dir, ServingCertFileName))
+	rotator.hosts = []string{"kcp.example.com", "10.0.0.2"}
+	if err := rotator.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if renewed := readCert(t, filepath.Join(rotator.dir, ServingCertFileName)); renewed.Equal(serving) {
+		t.Errorf("expected the serving certificate to be renewed for new hosts")
+	}
+
+	// new CA
+	serving = readCert(t, filepath.Join(rotator.dir, ServingCertFileName))
+	newIssuer := newTestIssuer(t)
+	rotator.source = newIssuer
+	if err := rotator.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if renewed := readCert(t, filepath.Join(rotator.dir, ServingCertFileName)); renewed.CheckSignatureFrom(newIssuer.caCert) != nil {
+		t.Errorf("expected the serving certificate to be renewed by the new CA")
+	}
+}
+
+func newTestRequest(t *testing.T, template *x509.CertificateRequest) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+}
+
+func TestSign(t *testing.T) {
+	issuer := newTestIssuer(t)
+
+	tests := []struct {
+		name       string
+		signerName string
+		request    *x509.CertificateRequest
+		wantErr    bool
+	}{
+		{"shard client", ClientSignerName, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "system:kcp:shard:shard-1", Organization: []string{bootstrap.SystemKcpShardsGroup}}}, false},
+		{"system:masters client", ClientSignerName, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "system:kcp:shard:shard-1", Organization: []string{"system:masters"}}}, true},
+		{"additional group", ClientSignerName, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "system:kcp:shard:shard-1", Organization: []string{bootstrap.SystemKcpShardsGroup, "system:masters"}}}, true},
+		{"non-shard client", ClientSignerName, &x509.CertificateRequest{Subject: pkix.Name{CommonName: FrontProxyUserName, Organization: []string{bootstrap.SystemKcpShardsGroup}}}, true},
+		{"client with hosts", ClientSignerName, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "system:kcp:shard:shard-1", Organization: []string{bootstrap.SystemKcpShardsGroup}}, DNSNames: []string{"kcp.example.com"}}, true},
+		{"serving", ServingSignerName, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "kcp.example.com"}, DNSNames: []string{"kcp.example.com"}, IPAddresses: []net.IP{net.ParseIP("10.0.0.1")}}, false},
+		{"serving with organization", ServingSignerName, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "kcp.example.com", Organization: []string{"system:masters"}}, DNSNames: []string{"kcp.example.com"}}, true},
+		{"serving without hosts", ServingSignerName, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "kcp.example.com"}}, true},
+		{"unknown signer", "kubernetes.io/kube-apiserver-client", &x509.CertificateRequest{Subject: pkix.Name{CommonName: "system:kcp:shard:shard-1", Organization: []string{bootstrap.SystemKcpShardsGroup}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			certPEM, err := issuer.Sign(newTestRequest(t, tt.request), tt.signerName, time.Hour)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			certs, err := certutil.ParseCertsPEM(certPEM)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := certs[0].CheckSignatureFrom(issuer.caCert); err != nil {
+				t.Errorf("expected a certificate issued by the shard CA: %v", err)
+			}
+			if !reflect.DeepEqual(certs[0].Subject.Organization, tt.request.Subject.Organization) {
+				t.Errorf("expected the organization %v, got %v", tt.request.Subject.Organization, certs[0].Subject.Organization)
+			}
+		})
+	}
+}
+
+func TestRequester(t *testing.T) {
+	issuer := newTestIssuer(t)
+	client := fake.NewSimpleClientset()
+	// the root shard signs the requests
+	client.PrependReactor("create", "certificatesigningrequests", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		csr := action.(clienttesting.CreateAction).GetObject().(*certificatesv1.CertificateSigningRequest)
+		csr.Name = csr.GenerateName + "1"
+		certPEM, err := issuer.Sign(csr.Spec.Request, csr.Spec.SignerName, time.Duration(*csr.Spec.ExpirationSeconds)*time.Second)
+		if err != nil {
+			csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{Type: certificatesv1.CertificateFailed, Message: err.Error()})
+		}
+		csr.Status.Certificate = certPEM
+		return false, nil, nil
+	})
+
+	requester := &Requester{
+		caPEM:     issuer.CA(),
+		client:    client.CertificatesV1().CertificateSigningRequests(),
+		shardName: "shard-1",
+		interval:  10 * time.Millisecond,
+		timeout:   time.Second,
+	}
+
+	certPEM, keyPEM, err := requester.IssueClient(UserName("shard-1"), []string{bootstrap.SystemKcpShardsGroup}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tls.X509KeyPair(certPEM, keyPEM); err != nil {
+		t.Errorf("expected a matching client key: %v", err)
+	}
+
+	certPEM, keyPEM, err = requester.IssueServing([]string{"kcp.example.com", "10.0.0.1"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tls.X509KeyPair(certPEM, keyPEM); err != nil {
+		t.Errorf("expected a matching serving key: %v", err)
+	}
+
+	if _, _, err := requester.IssueClient(UserName("shard-1"), []string{"system:masters"}, time.Hour); err == nil {
+		t.Errorf("expected a failed request for system:masters")
+	}
+
+	if csrs, err := client.CertificatesV1().CertificateSigningRequests().List(context.Background(), metav1.ListOptions{}); err != nil {
+		t.Fatal(err)
+	} else if len(csrs.Items) != 0 {
+		t.Errorf("expected the requests to be deleted, got %d", len(csrs.Items))
+	}
+}
+
+func TestHosts(t *testing.T) {
+	tests := []struct {
+		name             string
+		externalHost     string
+		advertiseAddress net.IP
+		expected         []string
+	}{
+		{"external host with port", "kcp.example.com:6443", net.ParseIP("10.0.0.1"), []string{"kcp.example.com", "10.0.0.1", "localhost", "127.0.0.1"}},
+		{"external host without port", "10.0.0.1", net.ParseIP("10.0.0.1"), []string{"10.0.0.1", "localhost", "127.0.0.1"}},
+		{"unspecified advertise address", "", net.IPv4zero, []string{"localhost", "127.0.0.1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Hosts(tt.externalHost, tt.advertiseAddress); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
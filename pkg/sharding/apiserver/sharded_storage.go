@@ -46,19 +46,30 @@ func (s *shardedStorage) Watch(ctx context.Context, options *internalversion.Lis
 	for name := range s.shards {
 		shardIdentifiers = append(shardIdentifiers, name)
 	}
-	state, err := NewResourceVersionState(options.ResourceVersion, shardIdentifiers, s.shardIdentifierResourceVersion)
+	resourceVersion := options.ResourceVersion
+	if resourceVersion == "0" {
+		// start from any point in time on every shard
+		resourceVersion = ""
+	}
+	state, err := NewResourceVersionState(resourceVersion, shardIdentifiers, s.shardIdentifierResourceVersion)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse sharded resource version state: %w", err)
+		return nil, errors.NewBadRequest(fmt.Sprintf("failed to parse sharded resource version state: %v", err))
+	}
+	if !state.HasShards(shardIdentifiers) {
+		// the events of the shards added since could not be ordered after the resource version
+		return nil, errors.NewResourceExpired("the set of shards changed since the resource version, a new list is required")
 	}
 
 	watchers := map[string]watch.Interface{}
 	for i := range state.ResourceVersions {
 		client, err := s.clientFor(s.shards[state.ResourceVersions[i].Identifier])
 		if err != nil {
+			stopAll(watchers)
 			return nil, fmt.Errorf("failed to create sharded client: %w", err)
 		}
 		request, err := s.requestFor(client)
 		if err != nil {
+			stopAll(watchers)
 			return nil, fmt.Errorf("failed to create sharded request: %w", err)
 		}
 		request.OverwriteParam("limit", "500")
@@ -66,6 +77,7 @@ func (s *shardedStorage) Watch(ctx context.Context, options *internalversion.Lis
 		request.SetHeader("X-Kubernetes-Cluster", "*")
 		watcher, err := request.Watch(ctx)
 		if err != nil {
+			stopAll(watchers)
 			return nil, fmt.Errorf("error executing watch request: %w", err)
 		}
 		watchers[state.ResourceVersions[i].Identifier] = watcher
@@ -74,66 +86,93 @@ func (s *shardedStorage) Watch(ctx context.Context, options *internalversion.Lis
 	return NewAggregateWatcher(state, watchers), nil
 }
 
+func stopAll(watchers map[string]watch.Interface) {
+	for _, w := range watchers {
+		w.Stop()
+	}
+}
+
 type stopper interface {
 	Stop()
 }
 
+// aggregateWatcher merges the watches of all shards into one stream. The resource version
+// of every event is the vector of the last resource versions seen from every shard, such
+// that watching again from it resumes every shard where it was left. The stream ends as
+// soon as the watch of one shard ends, as the events of that shard would be missed otherwise.
 type aggregateWatcher struct {
 	delegates []stopper
 	wg        *sync.WaitGroup
 	events    chan watch.Event
+	stopCh    chan struct{}
+	stopOnce  sync.Once
 
 	state *ShardedResourceVersions
 	lock  *sync.Mutex
 }
 
 func (a *aggregateWatcher) Stop() {
-	for i := range a.delegates {
-		a.delegates[i].Stop()
-	}
-	a.wg.Wait()
-	close(a.events)
+	a.stopOnce.Do(func() {
+		close(a.stopCh)
+		for i := range a.delegates {
+			a.delegates[i].Stop()
+		}
+	})
 }
 
 func (a *aggregateWatcher) ResultChan() <-chan watch.Event {
 	return a.events
 }
 
-func (a *aggregateWatcher) process(identifier string, event watch.Event) {
+// send sends the event unless the watcher is stopped, returning whether it was sent.
+func (a *aggregateWatcher) send(event watch.Event) bool {
+	select {
+	case a.events <- event:
+		return true
+	case <-a.stopCh:
+		return false
+	}
+}
+
+func (a *aggregateWatcher) process(identifier string, event watch.Event) bool {
+	if event.Type == watch.Error {
+		// errors carry no resource version of the shard
+		return a.send(event)
+	}
 	obj, ok := event.Object.(metav1.Common)
 	if !ok {
-		a.events <- watch.Event{
+		return a.send(watch.Event{
 			Type:   watch.Error,
 			Object: &errors.NewInternalError(fmt.Errorf("watch event contained a %T which could not cast to metav1.Common", event.Object)).ErrStatus,
-		}
-		return
+		})
 	}
+
+	// the events of a shard are sent in order, so that the resource version of every event
+	// resumes the watch of its shard after it
 	a.lock.Lock()
-	err := a.state.UpdateWith(identifier, obj)
-	a.lock.Unlock()
-	if err != nil {
-		a.events <- watch.Event{
+	defer a.lock.Unlock()
+	if err := a.state.UpdateWith(identifier, obj); err != nil {
+		return a.send(watch.Event{
 			Type:   watch.Error,
 			Object: &errors.NewInternalError(fmt.Errorf("failed to update resource version vector clock: %w", err)).ErrStatus,
-		}
-		return
+		})
 	}
 	encoded, err := a.state.Encode()
 	if err != nil {
-		a.events <- watch.Event{
+		return a.send(watch.Event{
 			Type:   watch.Error,
 			Object: &errors.NewInternalError(fmt.Errorf("failed to encode resource version vector clock: %w", err)).ErrStatus,
-		}
-		return
+		})
 	}
 	obj.SetResourceVersion(encoded)
-	a.events <- event
+	return a.send(event)
 }
 
 func NewAggregateWatcher(state *ShardedResourceVersions, delegates map[string]watch.Interface) watch.Interface {
 	w := &aggregateWatcher{
 		delegates: []stopper{},
 		events:    make(chan watch.Event),
+		stopCh:    make(chan struct{}),
 		wg:        &sync.WaitGroup{},
 		state:     state,
 		lock:      &sync.Mutex{},
@@ -143,12 +182,20 @@ func NewAggregateWatcher(state *ShardedResourceVersions, delegates map[string]wa
 		go func(identifier string, events <-chan watch.Event) {
 			defer utilruntime.HandleCrash()
 			defer w.wg.Done()
+			// end the whole stream when the watch of one shard ends
+			defer w.Stop()
 			for event := range events {
-				w.process(identifier, event)
+				if !w.process(identifier, event) {
+					return
+				}
 			}
 		}(identifier, delegates[identifier].ResultChan())
 		w.delegates = append(w.delegates, delegates[identifier])
 	}
+	go func() {
+		w.wg.Wait()
+		close(w.events)
+	}()
 	return w
 }
 
@@ -168,6 +215,9 @@ func (s *shardedStorage) List(ctx context.Context, options *internalversion.List
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse sharded chunked state: %w", err)
 	}
+	if !state.ToShardList().HasShards(shardIdentifiers) {
+		return nil, errors.NewResourceExpired("the set of shards changed since the continue token was issued, a new list is required")
+	}
 	var output *unstructured.UnstructuredList
 	for {
 		shard, continueToken, err := state.NextQuery()
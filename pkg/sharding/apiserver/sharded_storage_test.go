@@ -0,0 +1,116 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func objectAt(resourceVersion string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetResourceVersion(resourceVersion)
+	return obj
+}
+
+func TestAggregateWatcher(t *testing.T) {
+	state, err := NewResourceVersionState("", []string{"first", "second"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, second := watch.NewFake(), watch.NewFake()
+	w := NewAggregateWatcher(state, map[string]watch.Interface{"first": first, "second": second})
+
+	receive := func() watch.Event {
+		t.Helper()
+		select {
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				t.Fatal("unexpected end of the watch")
+			}
+			return event
+		case <-time.After(wait.ForeverTestTimeout):
+			t.Fatal("timed out waiting for an event")
+		}
+		return watch.Event{}
+	}
+	expectVector := func(event watch.Event, want ...ShardedResourceVersion) {
+		t.Helper()
+		got := &ShardedResourceVersions{}
+		if err := got.Decode(event.Object.(metav1.Common).GetResourceVersion()); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(&ShardedResourceVersions{ShardResourceVersion: 1, ResourceVersions: want}, got); diff != "" {
+			t.Errorf("unexpected resource version (-want +got):\n%s", diff)
+		}
+	}
+
+	go first.Add(objectAt("10"))
+	expectVector(receive(), ShardedResourceVersion{Identifier: "first", ResourceVersion: 10}, ShardedResourceVersion{Identifier: "second"})
+	go second.Modify(objectAt("7"))
+	expectVector(receive(), ShardedResourceVersion{Identifier: "first", ResourceVersion: 10}, ShardedResourceVersion{Identifier: "second", ResourceVersion: 7})
+
+	// errors are passed through without a resource version
+	status := &metav1.Status{Status: metav1.StatusFailure, Reason: metav1.StatusReasonExpired}
+	go second.Error(status)
+	if event := receive(); event.Type != watch.Error || event.Object != status {
+		t.Errorf("expected the error event of the shard, got %#v", event)
+	}
+
+	// the end of the watch of one shard ends the whole watch
+	first.Stop()
+	select {
+	case _, ok := <-w.ResultChan():
+		if ok {
+			t.Fatal("expected the watch to end")
+		}
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatal("timed out waiting for the end of the watch")
+	}
+	if !second.IsStopped() {
+		t.Errorf("expected the watch of the other shard to be stopped")
+	}
+}
+
+func TestAggregateWatcherStopWithPendingEvents(t *testing.T) {
+	state, err := NewResourceVersionState("", []string{"first"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := watch.NewFakeWithChanSize(1, false)
+	first.Add(objectAt("10"))
+	w := NewAggregateWatcher(state, map[string]watch.Interface{"first": first})
+
+	// nobody reads the pending event
+	done := make(chan struct{})
+	go func() {
+		w.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatal("timed out stopping the watch")
+	}
+}
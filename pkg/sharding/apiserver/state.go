@@ -87,6 +87,18 @@ func (s *ShardedChunkedStates) ToResourceVersions() *ShardedResourceVersions {
 	}
 }
 
+// ToShardList returns the shards being queried, irrespective of their progress.
+func (s *ShardedChunkedStates) ToShardList() *ShardedResourceVersions {
+	shards := make([]ShardedResourceVersion, 0, len(s.ResourceVersions))
+	for _, shard := range s.ResourceVersions {
+		shards = append(shards, ShardedResourceVersion{Identifier: shard.Identifier, ResourceVersion: shard.ResourceVersion})
+	}
+	return &ShardedResourceVersions{
+		ShardResourceVersion: s.ShardResourceVersion,
+		ResourceVersions:     shards,
+	}
+}
+
 // UpdateWith updates the state from a new request from a shard
 func (s *ShardedChunkedStates) UpdateWith(identifier string, resp metav1.ListInterface) error {
 	index := -1
@@ -241,6 +253,26 @@ func (s *ShardedResourceVersions) UpdateWith(identifier string, resp metav1.Comm
 	return nil
 }
 
+// HasShards returns whether the resource versions are those of exactly the given shards.
+func (s *ShardedResourceVersions) HasShards(identifiers []string) bool {
+	if len(s.ResourceVersions) != len(identifiers) {
+		return false
+	}
+	for _, identifier := range identifiers {
+		found := false
+		for _, shard := range s.ResourceVersions {
+			if shard.Identifier == identifier {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
 func resourceVersionFor(identifier string, resp metav1.Common) (ShardedResourceVersion, error) {
 	resourceVersion := resp.GetResourceVersion()
 	if resourceVersion == "" {
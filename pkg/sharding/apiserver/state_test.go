@@ -143,3 +143,23 @@ func TestShardedChunkedStates_UpdateWith(t *testing.T) {
 		}
 	}
 }
+
+func TestShardedResourceVersions_HasShards(t *testing.T) {
+	state := &ShardedResourceVersions{ResourceVersions: []ShardedResourceVersion{
+		{Identifier: "first", ResourceVersion: 1},
+		{Identifier: "second", ResourceVersion: 2},
+	}}
+	for _, tc := range []struct {
+		shards []string
+		want   bool
+	}{
+		{shards: []string{"second", "first"}, want: true},
+		{shards: []string{"first"}},
+		{shards: []string{"first", "second", "third"}},
+		{shards: []string{"first", "third"}},
+	} {
+		if got := state.HasShards(tc.shards); got != tc.want {
+			t.Errorf("HasShards(%v): expected %v, got %v", tc.shards, tc.want, got)
+		}
+	}
+}
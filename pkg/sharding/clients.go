@@ -41,6 +41,13 @@ func (c *ClientLoader) Add(name string, config *rest.Config) {
 	c.clients[name] = config
 }
 
+// Remove removes the config of the given shard.
+func (c *ClientLoader) Remove(name string) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.clients, name)
+}
+
 func (c *ClientLoader) AddKubeConfigContexts(path string) error {
 	loader := &clientcmd.ClientConfigLoadingRules{ExplicitPath: path}
 	cfg, err := loader.Load()
@@ -58,7 +65,6 @@ func (c *ClientLoader) AddKubeConfigContexts(path string) error {
 		}
 		contextCfg.ContentType = "application/json"
 		c.clients[context] = contextCfg
-		c.Unlock()
 	}
 
 	return nil
@@ -75,3 +81,11 @@ func (c *ClientLoader) Clients() map[string]*rest.Config {
 
 	return out
 }
+
+// get returns the config of the given shard, as held by the loader. It must not be mutated.
+func (c *ClientLoader) get(name string) (*rest.Config, bool) {
+	c.RLock()
+	defer c.RUnlock()
+	config, ok := c.clients[name]
+	return config, ok
+}
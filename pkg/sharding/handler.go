@@ -20,6 +20,7 @@ import (
 	"net/http"
 	"time"
 
+	"k8s.io/apimachinery/pkg/util/httpstream"
 	"k8s.io/apiserver/pkg/endpoints/request"
 
 	"github.com/kcp-dev/kcp/pkg/sharding/apiserver"
@@ -37,11 +38,17 @@ func WithSharding(apiHandler http.Handler, loader *ClientLoader) http.Handler {
 			apiHandler.ServeHTTP(w, req)
 			return
 		}
-		if sharded := req.Header.Get("X-Kubernetes-Sharded-Request"); sharded == "true" {
+		if sharded := req.Header.Get(shardedRequestHeader); sharded == "true" {
 			// we're being asked for our own data by some other shard, no need to fan out
 			apiHandler.ServeHTTP(w, req)
 			return
 		}
+		if httpstream.IsUpgradeRequest(req) && info.Verb != "watch" {
+			// exec, attach and port-forward streams can't be fanned out, they are routed
+			// to the shard of their logical cluster by WithStreamingProxy
+			apiHandler.ServeHTTP(w, req)
+			return
+		}
 		handler := apiserver.NewShardedHandler(loader.Clients(), 0, 10*time.Minute)
 		handler.ServeHTTP(w, req)
 	})
@@ -0,0 +1,66 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sharding
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apiserver/pkg/server/healthz"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const connectivityTimeout = 5 * time.Second
+
+// NewConnectivityCheck returns a readyz check failing when one of the peer shards of the
+// loader, i.e. all of them except self, does not answer on /livez. Liveness rather than
+// readiness is probed so that the readiness of the shards does not depend on each other.
+func NewConnectivityCheck(loader *ClientLoader, self string) healthz.HealthChecker {
+	return healthz.NamedCheck("shard-connectivity", func(req *http.Request) error {
+		clients := loader.Clients()
+		names := make([]string, 0, len(clients))
+		for name := range clients {
+			if name != self {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		var errs []error
+		for _, name := range names {
+			if err := probe(req.Context(), clients[name]); err != nil {
+				errs = append(errs, fmt.Errorf("shard %q: %w", name, err))
+			}
+		}
+		return utilerrors.NewAggregate(errs)
+	})
+}
+
+func probe(ctx context.Context, config *rest.Config) error {
+	config = rest.CopyConfig(config)
+	config.Timeout = connectivityTimeout
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	return client.Discovery().RESTClient().Get().AbsPath("/livez").Do(ctx).Error()
+}
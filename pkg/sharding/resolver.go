@@ -0,0 +1,125 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sharding
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+)
+
+// RootShard is the name of the shard holding the root logical cluster.
+const RootShard = "root"
+
+// ShardResolver resolves the name of the shard a logical cluster is held on.
+type ShardResolver interface {
+	// Resolve returns the name of the shard currently holding the given logical cluster.
+	Resolve(ctx context.Context, clusterName string) (string, error)
+	// Invalidate drops any cached location of the given logical cluster, e.g. after the
+	// shard it was resolved to failed to serve it.
+	Invalidate(clusterName string)
+}
+
+// NewIndexResolver returns a ShardResolver asking the workspace index served at the
+// given URL for the shard of a logical cluster, and caching the answer for the given
+// time to live. The root logical cluster always resolves to the RootShard.
+func NewIndexResolver(indexURL string, client *http.Client, ttl time.Duration) ShardResolver {
+	return &indexResolver{
+		indexURL: strings.TrimSuffix(indexURL, "/"),
+		client:   client,
+		ttl:      ttl,
+		now:      time.Now,
+		cache:    map[string]resolvedShard{},
+	}
+}
+
+type indexResolver struct {
+	indexURL string
+	client   *http.Client
+	ttl      time.Duration
+	now      func() time.Time
+
+	lock sync.RWMutex
+	// cache holds the shards of the logical clusters, by logical cluster name
+	cache map[string]resolvedShard
+}
+
+type resolvedShard struct {
+	name    string
+	expires time.Time
+}
+
+func (r *indexResolver) Resolve(ctx context.Context, clusterName string) (string, error) {
+	if clusterName == helper.RootCluster {
+		return RootShard, nil
+	}
+
+	r.lock.RLock()
+	resolved, ok := r.cache[clusterName]
+	r.lock.RUnlock()
+	if ok && r.now().Before(resolved.expires) {
+		return resolved.name, nil
+	}
+
+	name, err := r.lookup(ctx, clusterName)
+	if err != nil {
+		return "", err
+	}
+
+	r.lock.Lock()
+	r.cache[clusterName] = resolvedShard{name: name, expires: r.now().Add(r.ttl)}
+	r.lock.Unlock()
+	return name, nil
+}
+
+func (r *indexResolver) Invalidate(clusterName string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.cache, clusterName)
+}
+
+// lookup asks the workspace index for the shard currently holding the given logical cluster.
+func (r *indexResolver) lookup(ctx context.Context, clusterName string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.indexURL+"/shard?clusterName="+url.QueryEscape(clusterName), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve the shard of cluster %q: %w", clusterName, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve the shard of cluster %q: %w", clusterName, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to resolve the shard of cluster %q: status code %d: %s", clusterName, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	name := strings.TrimSpace(string(body))
+	if name == "" {
+		return "", fmt.Errorf("failed to resolve the shard of cluster %q: empty shard name", clusterName)
+	}
+	return name, nil
+}
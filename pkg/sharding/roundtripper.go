@@ -0,0 +1,136 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sharding
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"k8s.io/client-go/rest"
+)
+
+// shardResolvingHost is the placeholder host of the configs returned by ShardResolvingConfig.
+// It is never dialed, requests are sent to the host of the shard they are routed to.
+const shardResolvingHost = "https://shards.kcp.invalid"
+
+// ShardResolvingConfig returns a config for clients whose requests are routed to the shard
+// holding the logical cluster they are scoped to, e.g. with the Cluster() method of the
+// cluster-aware clientsets, with the credentials of that shard. Requests that are not
+// scoped to a logical cluster fail.
+func ShardResolvingConfig(resolver ShardResolver, loader *ClientLoader) *rest.Config {
+	return &rest.Config{
+		Host:          shardResolvingHost,
+		ContentConfig: rest.ContentConfig{ContentType: "application/json"},
+		Transport:     NewShardRoundTripper(resolver, loader),
+	}
+}
+
+// NewShardRoundTripper returns a round-tripper sending the requests to the shard holding
+// the logical cluster of their /clusters/<name> path prefix, as resolved by the given
+// resolver, using the config of the shard in the given loader. The location of a logical
+// cluster is invalidated when its shard cannot be reached.
+func NewShardRoundTripper(resolver ShardResolver, loader *ClientLoader) http.RoundTripper {
+	return &shardRoundTripper{
+		resolver:   resolver,
+		loader:     loader,
+		transports: map[string]shardTransport{},
+	}
+}
+
+type shardRoundTripper struct {
+	resolver ShardResolver
+	loader   *ClientLoader
+
+	lock sync.Mutex
+	// transports holds the round-trippers of the shards, by shard name, until their
+	// config changes in the loader
+	transports map[string]shardTransport
+}
+
+type shardTransport struct {
+	config *rest.Config
+	host   *url.URL
+	rt     http.RoundTripper
+}
+
+func (s *shardRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	clusterName, ok := clusterFromPath(req.URL.Path)
+	if !ok {
+		return nil, fmt.Errorf("request to %q is not scoped to a logical cluster", req.URL.Path)
+	}
+	shard, err := s.resolver.Resolve(req.Context(), clusterName)
+	if err != nil {
+		return nil, err
+	}
+	transport, err := s.transportFor(shard)
+	if err != nil {
+		s.resolver.Invalidate(clusterName)
+		return nil, fmt.Errorf("cluster %q: %w", clusterName, err)
+	}
+
+	req = req.Clone(req.Context())
+	req.URL.Scheme = transport.host.Scheme
+	req.URL.Host = transport.host.Host
+	req.URL.Path = path.Join(transport.host.Path, req.URL.Path)
+	req.URL.RawPath = ""
+	req.Host = ""
+	resp, err := transport.rt.RoundTrip(req)
+	if err != nil {
+		s.resolver.Invalidate(clusterName)
+		return nil, err
+	}
+	return resp, nil
+}
+
+// transportFor returns the round-tripper of the given shard, created from its config in the loader.
+func (s *shardRoundTripper) transportFor(shard string) (shardTransport, error) {
+	config, ok := s.loader.get(shard)
+	if !ok {
+		return shardTransport{}, fmt.Errorf("unknown shard %q", shard)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if existing, ok := s.transports[shard]; ok && existing.config == config {
+		return existing, nil
+	}
+
+	host, err := url.Parse(config.Host)
+	if err != nil {
+		return shardTransport{}, fmt.Errorf("invalid host of shard %q: %w", shard, err)
+	}
+	rt, err := rest.TransportFor(config)
+	if err != nil {
+		return shardTransport{}, fmt.Errorf("failed to create transport for shard %q: %w", shard, err)
+	}
+	transport := shardTransport{config: config, host: host, rt: rt}
+	s.transports[shard] = transport
+	return transport, nil
+}
+
+// clusterFromPath returns the logical cluster of a /clusters/<name>/... path.
+func clusterFromPath(p string) (string, bool) {
+	if !strings.HasPrefix(p, "/clusters/") {
+		return "", false
+	}
+	clusterName := strings.SplitN(strings.TrimPrefix(p, "/clusters/"), "/", 2)[0]
+	return clusterName, clusterName != ""
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sharding
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/rest"
+)
+
+func TestIndexResolver(t *testing.T) {
+	var lookups int32
+	shards := map[string]string{"acme:team": "shard-1"}
+	index := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&lookups, 1)
+		shard, ok := shards[r.URL.Query().Get("clusterName")]
+		if !ok {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, shard)
+	}))
+	defer index.Close()
+
+	now := time.Unix(0, 0)
+	resolver := NewIndexResolver(index.URL, index.Client(), time.Minute).(*indexResolver)
+	resolver.now = func() time.Time { return now }
+
+	expect := func(clusterName, wantShard string, wantLookups int32) {
+		t.Helper()
+		shard, err := resolver.Resolve(context.Background(), clusterName)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if shard != wantShard {
+			t.Errorf("expected shard %q, got %q", wantShard, shard)
+		}
+		if got := atomic.LoadInt32(&lookups); got != wantLookups {
+			t.Errorf("expected %d lookups, got %d", wantLookups, got)
+		}
+	}
+
+	expect("root", RootShard, 0)
+	expect("acme:team", "shard-1", 1)
+	expect("acme:team", "shard-1", 1)
+
+	shards["acme:team"] = "shard-2"
+	resolver.Invalidate("acme:team")
+	expect("acme:team", "shard-2", 2)
+
+	shards["acme:team"] = "shard-3"
+	now = now.Add(2 * time.Minute)
+	expect("acme:team", "shard-3", 3)
+
+	if _, err := resolver.Resolve(context.Background(), "acme:unknown"); err == nil {
+		t.Errorf("expected an error resolving an unknown cluster")
+	}
+}
+
+type fakeResolver struct {
+	shards map[string]string
+
+	lock        sync.Mutex
+	invalidated []string
+}
+
+func (f *fakeResolver) Resolve(_ context.Context, clusterName string) (string, error) {
+	shard, ok := f.shards[clusterName]
+	if !ok {
+		return "", fmt.Errorf("cluster %q not found", clusterName)
+	}
+	return shard, nil
+}
+
+func (f *fakeResolver) Invalidate(clusterName string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.invalidated = append(f.invalidated, clusterName)
+}
+
+func (f *fakeResolver) wasInvalidated(clusterName string) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for _, invalidated := range f.invalidated {
+		if invalidated == clusterName {
+			return true
+		}
+	}
+	return false
+}
+
+func TestShardRoundTripper(t *testing.T) {
+	newShard := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s %s", name, r.URL.Path)
+		}))
+	}
+	first, second := newShard("first"), newShard("second")
+	defer first.Close()
+	defer second.Close()
+
+	loader := NewClientLoader()
+	loader.Add("first", &rest.Config{Host: first.URL})
+	loader.Add("second", &rest.Config{Host: second.URL + "/prefix"})
+	loader.Add("gone", &rest.Config{Host: "http://127.0.0.1:1"})
+	resolver := &fakeResolver{shards: map[string]string{
+		"acme:one":   "first",
+		"acme:two":   "second",
+		"acme:gone":  "gone",
+		"acme:other": "unknown",
+	}}
+	client := &http.Client{Transport: NewShardRoundTripper(resolver, loader)}
+
+	for _, tc := range []struct {
+		path            string
+		wantBody        string
+		wantErr         bool
+		wantInvalidated bool
+	}{
+		{path: "/clusters/acme:one/api/v1/namespaces", wantBody: "first /clusters/acme:one/api/v1/namespaces"},
+		{path: "/clusters/acme:two/api/v1/namespaces", wantBody: "second /prefix/clusters/acme:two/api/v1/namespaces"},
+		{path: "/clusters/acme:gone/api", wantErr: true, wantInvalidated: true},
+		{path: "/clusters/acme:other/api", wantErr: true, wantInvalidated: true},
+		{path: "/clusters/acme:missing/api", wantErr: true},
+		{path: "/api/v1/namespaces", wantErr: true},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			resolver.invalidated = nil
+			resp, err := client.Get(shardResolvingHost + tc.path)
+			if tc.wantErr {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatalf("expected an error")
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				defer resp.Body.Close()
+				body, err := io.ReadAll(resp.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(body) != tc.wantBody {
+					t.Errorf("expected body %q, got %q", tc.wantBody, string(body))
+				}
+			}
+			if invalidated := len(resolver.invalidated) > 0; invalidated != tc.wantInvalidated {
+				t.Errorf("expected invalidated=%v, got %v", tc.wantInvalidated, resolver.invalidated)
+			}
+		})
+	}
+}
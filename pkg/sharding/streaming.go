@@ -0,0 +1,180 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sharding
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/apiserver/pkg/endpoints/handlers/responsewriters"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+)
+
+// shardedRequestHeader marks the requests sent by a shard to a peer shard, which serves
+// them from its own data.
+const shardedRequestHeader = "X-Kubernetes-Sharded-Request"
+
+var (
+	errorScheme = runtime.NewScheme()
+	errorCodecs = serializer.NewCodecFactory(errorScheme)
+)
+
+func init() {
+	errorScheme.AddUnversionedTypes(metav1.Unversioned,
+		&metav1.Status{},
+	)
+}
+
+// WithStreamingProxy proxies the upgrade requests of a logical cluster held by a peer
+// shard, i.e. the SPDY and WebSocket streams of exec, attach, port-forward and watches,
+// and the tunnels opened by syncers, to that shard as resolved by the given resolver.
+// These requests cannot be fanned out. They are sent with the credentials of the peer
+// shard in the given loader, impersonating the user. Upgrade requests of logical
+// clusters held by the shard of the given name, wildcard requests and any other request
+// are passed to apiHandler. Upgrading the connection to the peer shard times out after
+// the given handshake timeout.
+func WithStreamingProxy(apiHandler http.Handler, resolver ShardResolver, loader *ClientLoader, self string, handshakeTimeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		cluster := request.ClusterFrom(req.Context())
+		if !httpstream.IsUpgradeRequest(req) || cluster == nil || cluster.Wildcard || req.Header.Get(shardedRequestHeader) == "true" {
+			apiHandler.ServeHTTP(w, req)
+			return
+		}
+
+		gv := schema.GroupVersion{}
+		if info, ok := request.RequestInfoFrom(req.Context()); ok {
+			gv = schema.GroupVersion{Group: info.APIGroup, Version: info.APIVersion}
+		}
+		userInfo, ok := request.UserFrom(req.Context())
+		if !ok {
+			responsewriters.ErrorNegotiated(apierrors.NewInternalError(fmt.Errorf("missing userInfo")), errorCodecs, gv, w, req)
+			return
+		}
+
+		shard, err := resolver.Resolve(req.Context(), cluster.Name)
+		if err != nil {
+			responsewriters.ErrorNegotiated(
+				apierrors.NewServiceUnavailable(fmt.Sprintf("failed to find the shard of logical cluster %q: %v", cluster.Name, err)),
+				errorCodecs, gv, w, req,
+			)
+			return
+		}
+		if shard == self {
+			apiHandler.ServeHTTP(w, req)
+			return
+		}
+		config, ok := loader.get(shard)
+		if !ok {
+			resolver.Invalidate(cluster.Name)
+			responsewriters.ErrorNegotiated(
+				apierrors.NewServiceUnavailable(fmt.Sprintf("unknown shard %q of logical cluster %q", shard, cluster.Name)),
+				errorCodecs, gv, w, req,
+			)
+			return
+		}
+
+		config = rest.CopyConfig(config)
+		config.Impersonate = rest.ImpersonationConfig{
+			UserName: userInfo.GetName(),
+			Groups:   userInfo.GetGroups(),
+			Extra:    userInfo.GetExtra(),
+		}
+		transport, err := streamingTransportFor(config, handshakeTimeout)
+		if err != nil {
+			responsewriters.ErrorNegotiated(apierrors.NewInternalError(err), errorCodecs, gv, w, req)
+			return
+		}
+		host, err := url.Parse(config.Host)
+		if err != nil {
+			responsewriters.ErrorNegotiated(apierrors.NewInternalError(fmt.Errorf("invalid host of shard %q: %w", shard, err)), errorCodecs, gv, w, req)
+			return
+		}
+
+		proxy := &httputil.ReverseProxy{
+			Director: func(req *http.Request) {
+				rewriteStreamingRequest(req, host, cluster.Name)
+			},
+			Transport:     transport,
+			FlushInterval: -1,
+			ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+				klog.V(4).Infof("failed to proxy stream of logical cluster %q to shard %q: %v", cluster.Name, shard, err)
+				resolver.Invalidate(cluster.Name)
+				responsewriters.ErrorNegotiated(
+					apierrors.NewServiceUnavailable(fmt.Sprintf("failed to reach shard %q: %v", shard, err)),
+					errorCodecs, gv, w, req,
+				)
+			},
+		}
+		proxy.ServeHTTP(w, req)
+	}
+}
+
+// streamingTransportFor returns a round-tripper for upgrade requests with the credentials
+// of the given config. It only speaks HTTP/1.1, as connections cannot be upgraded over
+// HTTP/2. Connecting, the TLS handshake and waiting for the response headers, i.e. for
+// the upgrade, time out after the given timeout each.
+func streamingTransportFor(config *rest.Config, handshakeTimeout time.Duration) (http.RoundTripper, error) {
+	tlsConfig, err := rest.TLSConfigFor(config)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		tlsConfig.NextProtos = []string{"http/1.1"}
+	}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		TLSClientConfig:       tlsConfig,
+		DialContext:           (&net.Dialer{Timeout: handshakeTimeout}).DialContext,
+		TLSHandshakeTimeout:   handshakeTimeout,
+		ResponseHeaderTimeout: handshakeTimeout,
+		DisableKeepAlives:     true,
+	}
+	return rest.HTTPWrappersForConfig(config, transport)
+}
+
+// rewriteStreamingRequest targets the request at the given shard host, scopes it to the
+// given logical cluster again, and removes the credentials of the user, which are
+// replaced by those of the shard.
+func rewriteStreamingRequest(req *http.Request, host *url.URL, clusterName string) {
+	req.URL.Scheme = host.Scheme
+	req.URL.Host = host.Host
+	req.URL.Path = path.Join(host.Path, "/clusters", clusterName, req.URL.Path)
+	req.URL.RawPath = ""
+	req.Host = ""
+
+	req.Header.Del("Authorization")
+	for name := range req.Header {
+		if strings.HasPrefix(http.CanonicalHeaderKey(name), "Impersonate-") {
+			req.Header.Del(name)
+		}
+	}
+	req.Header.Set(shardedRequestHeader, "true")
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sharding
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/rest"
+)
+
+func TestWithStreamingProxy(t *testing.T) {
+	// the shard upgrades the connection and echoes what it reads after a line describing
+	// the request it received.
+	shard := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		fmt.Fprintf(rw, "%s %s %s %s %s\n", req.URL.Path, req.Header.Get("Authorization"), req.Header.Get("Impersonate-User"), req.Header.Get("Impersonate-Group"), req.Header.Get(shardedRequestHeader))
+		rw.Flush()      // nolint: errcheck
+		io.Copy(rw, rw) // nolint: errcheck
+		rw.Flush()      // nolint: errcheck
+	}))
+	defer shard.Close()
+
+	loader := NewClientLoader()
+	loader.Add("other", &rest.Config{Host: shard.URL + "/prefix", BearerToken: "shard-token"})
+	loader.Add("gone", &rest.Config{Host: "http://127.0.0.1:1"})
+	resolver := &fakeResolver{shards: map[string]string{
+		"acme:local": "self",
+		"acme:other": "other",
+		"acme:gone":  "gone",
+	}}
+	local := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	handler := WithStreamingProxy(local, resolver, loader, "self", 5*time.Second)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// scope the request like the lcluster handler and authenticate it
+		parts := strings.SplitN(strings.TrimPrefix(req.URL.Path, "/clusters/"), "/", 2)
+		req.URL.Path = "/" + parts[1]
+		ctx := request.WithCluster(req.Context(), request.Cluster{Name: parts[0], Wildcard: parts[0] == "*"})
+		ctx = request.WithUser(ctx, &user.DefaultInfo{Name: "alice", Groups: []string{"team"}})
+		handler.ServeHTTP(w, req.WithContext(ctx))
+	}))
+	defer server.Close()
+
+	send := func(path string, upgrade, sharded bool) (*http.Response, *bufio.Reader, net.Conn) {
+		conn, err := net.Dial("tcp", server.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		headers := "Authorization: Bearer user-token\r\nImpersonate-User: mallory\r\n"
+		if upgrade {
+			headers += "Connection: Upgrade\r\nUpgrade: echo\r\n"
+		}
+		if sharded {
+			headers += shardedRequestHeader + ": true\r\n"
+		}
+		if _, err := fmt.Fprintf(conn, "POST %s HTTP/1.1\r\nHost: kcp\r\n%s\r\n", path, headers); err != nil {
+			t.Fatal(err)
+		}
+		reader := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(reader, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, reader, conn
+	}
+
+	t.Run("upgrade to a peer shard", func(t *testing.T) {
+		resp, reader, conn := send("/clusters/acme:other/api/v1/namespaces/default/pods/foo/exec", true, false)
+		defer conn.Close()
+		if resp.StatusCode != http.StatusSwitchingProtocols {
+			t.Fatalf("expected 101, got %d", resp.StatusCode)
+		}
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := "/prefix/clusters/acme:other/api/v1/namespaces/default/pods/foo/exec Bearer shard-token alice team true\n"; line != expected {
+			t.Errorf("expected the shard to receive %q, got %q", expected, line)
+		}
+		if _, err := conn.Write([]byte("ping\n")); err != nil {
+			t.Fatal(err)
+		}
+		if line, err := reader.ReadString('\n'); err != nil || line != "ping\n" {
+			t.Errorf("expected the stream to be echoed, got %q: %v", line, err)
+		}
+	})
+
+	for name, tc := range map[string]struct {
+		path    string
+		upgrade bool
+		sharded bool
+	}{
+		"upgrade to this shard":           {path: "/clusters/acme:local/api/v1/namespaces/default/pods/foo/exec", upgrade: true},
+		"wildcard upgrade":                {path: "/clusters/*/api/v1/configmaps?watch=true", upgrade: true},
+		"no upgrade":                      {path: "/clusters/acme:other/api/v1/namespaces"},
+		"upgrade from a peer shard":       {path: "/clusters/acme:other/api/v1/namespaces/default/pods/foo/exec", upgrade: true, sharded: true},
+		"upgrade to an unknown workspace": {path: "/clusters/acme:missing/api/v1/namespaces/default/pods/foo/exec", upgrade: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp, _, conn := send(tc.path, tc.upgrade, tc.sharded)
+			defer conn.Close()
+			expected := http.StatusTeapot
+			if name == "upgrade to an unknown workspace" {
+				expected = http.StatusServiceUnavailable
+			}
+			if resp.StatusCode != expected {
+				t.Errorf("expected %d, got %d", expected, resp.StatusCode)
+			}
+		})
+	}
+
+	t.Run("unreachable shard", func(t *testing.T) {
+		resp, _, conn := send("/clusters/acme:gone/api/v1/namespaces/default/pods/foo/exec", true, false)
+		defer conn.Close()
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("expected 503, got %d", resp.StatusCode)
+		}
+		if !resolver.wasInvalidated("acme:gone") {
+			t.Errorf("expected the shard of the logical cluster to be invalidated")
+		}
+	})
+}
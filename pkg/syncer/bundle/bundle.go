@@ -0,0 +1,300 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+
+	"github.com/kcp-dev/kcp/pkg/syncer"
+)
+
+const (
+	// DefaultNamespace is the namespace of the physical cluster the syncer is installed in.
+	DefaultNamespace = "kcp-syncer-system"
+
+	// LogicalClusterAnnotation holds the logical cluster of the WorkloadCluster the
+	// objects of a bundle were generated for.
+	LogicalClusterAnnotation = "workload.kcp.dev/logical-cluster"
+	// WorkloadClusterAnnotation holds the WorkloadCluster the objects of a bundle were
+	// generated for.
+	WorkloadClusterAnnotation = "workload.kcp.dev/workload-cluster"
+
+	kubeconfigKey = "kubeconfig"
+)
+
+// Options are the parameters of the install bundle of a syncer.
+type Options struct {
+	// Image is the syncer image.
+	Image string
+	// Namespace is the namespace of the physical cluster the syncer is installed in.
+	Namespace string
+	// ServerURL is the URL the syncer reaches kcp at.
+	ServerURL string
+	// CAData is the CA bundle the syncer verifies the kcp serving certificate with.
+	CAData []byte
+	// Token is the bearer token the syncer authenticates to kcp with.
+	Token string
+	// LogicalCluster is the logical cluster of the WorkloadCluster.
+	LogicalCluster string
+	// WorkloadCluster is the name of the WorkloadCluster the syncer syncs to.
+	WorkloadCluster string
+	// ResourcesToSync are the group resources synced to the physical cluster.
+	ResourcesToSync []string
+}
+
+// ClusterRoleRules returns the rules the syncer needs in the physical cluster to
+// sync the given group resources.
+func ClusterRoleRules(resourcesToSync []string) []rbacv1.PolicyRule {
+	resourcesWithStatus := sets.NewString()
+	apiGroups := sets.NewString()
+
+	for _, groupResourceToSync := range resourcesToSync {
+		gr := schema.ParseGroupResource(groupResourceToSync)
+		resourcesWithStatus.Insert(gr.Resource, gr.Resource+"/status")
+		apiGroups.Insert(gr.Group)
+	}
+
+	return []rbacv1.PolicyRule{
+		{
+			Verbs:     []string{"create"},
+			APIGroups: []string{""},
+			Resources: []string{"namespaces"},
+		},
+		{
+			Verbs:     []string{"get", "list", "watch"},
+			APIGroups: []string{""},
+			Resources: []string{"namespaces"},
+		},
+		{
+			Verbs:     []string{"get", "create", "update"},
+			APIGroups: []string{""},
+			Resources: []string{"configmaps"},
+		},
+		{
+			Verbs:     []string{"get"},
+			APIGroups: []string{""},
+			Resources: []string{"pods/log"},
+		},
+		{
+			Verbs:     []string{"get", "create"},
+			APIGroups: []string{""},
+			Resources: []string{"pods/exec", "pods/attach", "pods/portforward"},
+		},
+		{
+			// ServiceAccounts and image pull Secrets the synced pods depend on.
+			Verbs:     []string{"get", "create", "patch"},
+			APIGroups: []string{""},
+			Resources: []string{"serviceaccounts", "secrets"},
+		},
+		{
+			// Isolation of the namespaces of different logical clusters.
+			Verbs:     []string{"get", "create"},
+			APIGroups: []string{"networking.k8s.io"},
+			Resources: []string{"networkpolicies"},
+		},
+		{
+			Verbs:     []string{"list", "watch", "create", "update", "get", "delete"},
+			Resources: resourcesWithStatus.List(),
+			APIGroups: apiGroups.List(),
+		},
+	}
+}
+
+// Objects returns the objects installing the syncer of a WorkloadCluster in its
+// physical cluster: the namespace, service account and RBAC of the syncer, the Secret
+// holding its kubeconfig to kcp, and its Deployment.
+func Objects(o Options) ([]runtime.Object, error) {
+	if o.Namespace == "" {
+		o.Namespace = DefaultNamespace
+	}
+	name := resourceName(o.LogicalCluster, o.WorkloadCluster)
+	annotations := map[string]string{
+		LogicalClusterAnnotation:  o.LogicalCluster,
+		WorkloadClusterAnnotation: o.WorkloadCluster,
+	}
+	objectMeta := func(namespace string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{
+			Namespace:   namespace,
+			Name:        name,
+			Annotations: annotations,
+		}
+	}
+
+	kubeconfig, err := clientcmd.Write(clientcmdapi.Config{
+		Clusters: map[string]*clientcmdapi.Cluster{
+			"kcp": {
+				Server:                   o.ServerURL,
+				CertificateAuthorityData: o.CAData,
+			},
+		},
+		Contexts: map[string]*clientcmdapi.Context{
+			"kcp": {
+				Cluster:  "kcp",
+				AuthInfo: "syncer",
+			},
+		},
+		AuthInfos: map[string]*clientcmdapi.AuthInfo{
+			"syncer": {Token: o.Token},
+		},
+		CurrentContext: "kcp",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error writing kubeconfig for syncer: %w", err)
+	}
+
+	args := []string{
+		"-cluster", o.WorkloadCluster,
+		"-from_kubeconfig", "/kcp/" + kubeconfigKey,
+		"-from_cluster", o.LogicalCluster,
+	}
+	args = append(args, o.ResourcesToSync...)
+
+	var one int32 = 1
+	return []runtime.Object{
+		&corev1.Namespace{
+			TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Namespace"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name: o.Namespace,
+			},
+		},
+		&corev1.ServiceAccount{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+			ObjectMeta: objectMeta(o.Namespace),
+		},
+		&rbacv1.ClusterRole{
+			TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "ClusterRole"},
+			ObjectMeta: objectMeta(""),
+			Rules:      ClusterRoleRules(o.ResourcesToSync),
+		},
+		&rbacv1.ClusterRoleBinding{
+			TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "ClusterRoleBinding"},
+			ObjectMeta: objectMeta(""),
+			Subjects: []rbacv1.Subject{{
+				Kind:      "ServiceAccount",
+				Name:      name,
+				Namespace: o.Namespace,
+			}},
+			RoleRef: rbacv1.RoleRef{
+				Kind:     "ClusterRole",
+				Name:     name,
+				APIGroup: rbacv1.GroupName,
+			},
+		},
+		&corev1.Secret{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+			ObjectMeta: objectMeta(o.Namespace),
+			StringData: map[string]string{
+				kubeconfigKey: string(kubeconfig),
+			},
+		},
+		&appsv1.Deployment{
+			TypeMeta:   metav1.TypeMeta{APIVersion: appsv1.SchemeGroupVersion.String(), Kind: "Deployment"},
+			ObjectMeta: objectMeta(o.Namespace),
+			Spec: appsv1.DeploymentSpec{
+				Replicas: &one,
+				Selector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{
+						"app": name,
+					},
+				},
+				Strategy: appsv1.DeploymentStrategy{
+					Type: appsv1.RecreateDeploymentStrategyType,
+				},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{
+						Labels: map[string]string{
+							"app": name,
+						},
+						Annotations: annotations,
+					},
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{
+							Name:  "syncer",
+							Image: o.Image,
+							Args:  args,
+							VolumeMounts: []corev1.VolumeMount{{
+								Name:      kubeconfigKey,
+								MountPath: "/kcp",
+								ReadOnly:  true,
+							}},
+							TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+							Env: []corev1.EnvVar{{
+								Name: syncer.SyncerNamespaceKey,
+								ValueFrom: &corev1.EnvVarSource{
+									FieldRef: &corev1.ObjectFieldSelector{
+										FieldPath: "metadata.namespace",
+									},
+								},
+							}},
+						}},
+						Volumes: []corev1.Volume{{
+							Name: kubeconfigKey,
+							VolumeSource: corev1.VolumeSource{
+								Secret: &corev1.SecretVolumeSource{
+									SecretName: name,
+									Items: []corev1.KeyToPath{{
+										Key: kubeconfigKey, Path: kubeconfigKey,
+									}},
+								},
+							},
+						}},
+						ServiceAccountName: name,
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+// List returns the objects of the install bundle of a syncer as a v1 List.
+func List(o Options) (*corev1.List, error) {
+	objs, err := Objects(o)
+	if err != nil {
+		return nil, err
+	}
+	list := &corev1.List{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "List"},
+	}
+	for _, obj := range objs {
+		raw, err := json.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		list.Items = append(list.Items, runtime.RawExtension{Raw: raw})
+	}
+	return list, nil
+}
+
+// resourceName returns the name of the objects installing the syncer of the given
+// WorkloadCluster, which is unique per logical cluster and WorkloadCluster while
+// being a valid label value.
+func resourceName(logicalCluster, workloadCluster string) string {
+	hash := sha256.Sum224([]byte(logicalCluster + "/" + workloadCluster))
+	return fmt.Sprintf("kcp-syncer-%x", hash[:8])
+}
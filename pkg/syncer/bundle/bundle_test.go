@@ -0,0 +1,68 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+func TestObjects(t *testing.T) {
+	objs, err := Objects(Options{
+		Image:           "syncer:latest",
+		ServerURL:       "https://kcp:6443",
+		CAData:          []byte("ca"),
+		Token:           "token",
+		LogicalCluster:  "root:acme",
+		WorkloadCluster: "east",
+		ResourcesToSync: []string{"deployments.apps", "services"},
+	})
+	require.NoError(t, err)
+	require.Len(t, objs, 6)
+
+	name := resourceName("root:acme", "east")
+	require.NotEqual(t, name, resourceName("root:other", "east"), "names must be unique per logical cluster")
+
+	ns := objs[0].(*corev1.Namespace)
+	require.Equal(t, DefaultNamespace, ns.Name)
+
+	role := objs[2].(*rbacv1.ClusterRole)
+	require.Equal(t, name, role.Name)
+	require.Contains(t, role.Rules, rbacv1.PolicyRule{
+		Verbs:     []string{"list", "watch", "create", "update", "get", "delete"},
+		APIGroups: []string{"", "apps"},
+		Resources: []string{"deployments", "deployments/status", "services", "services/status"},
+	})
+
+	secret := objs[4].(*corev1.Secret)
+	kubeconfig, err := clientcmd.Load([]byte(secret.StringData[kubeconfigKey]))
+	require.NoError(t, err)
+	require.Equal(t, "https://kcp:6443", kubeconfig.Clusters[kubeconfig.Contexts[kubeconfig.CurrentContext].Cluster].Server)
+	require.Equal(t, "token", kubeconfig.AuthInfos[kubeconfig.Contexts[kubeconfig.CurrentContext].AuthInfo].Token)
+
+	deployment := objs[5].(*appsv1.Deployment)
+	require.Equal(t, DefaultNamespace, deployment.Namespace)
+	require.Equal(t, name, deployment.Spec.Template.Spec.ServiceAccountName)
+	require.Equal(t, []string{"-cluster", "east", "-from_kubeconfig", "/kcp/kubeconfig", "-from_cluster", "root:acme", "deployments.apps", "services"},
+		deployment.Spec.Template.Spec.Containers[0].Args)
+}
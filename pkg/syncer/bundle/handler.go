@@ -0,0 +1,145 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/endpoints/handlers/negotiation"
+	"k8s.io/apiserver/pkg/endpoints/handlers/responsewriters"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clusters"
+
+	"github.com/kcp-dev/kcp/pkg/apis/workload"
+	workloadlisters "github.com/kcp-dev/kcp/pkg/client/listers/workload/v1alpha1"
+)
+
+// SyncerSubresource is the subresource of WorkloadClusters serving the install
+// bundle of their syncer.
+const SyncerSubresource = "syncer"
+
+// TokenIssuer issues the bearer token of the syncer of a WorkloadCluster.
+type TokenIssuer interface {
+	Token(clusterName, workloadClusterName string) (string, error)
+}
+
+// Handler serves the install bundles of the syncers of WorkloadClusters.
+type Handler struct {
+	workloadClusterLister workloadlisters.WorkloadClusterLister
+	tokens                TokenIssuer
+
+	image           string
+	serverURL       string
+	caData          []byte
+	resourcesToSync []string
+}
+
+// NewHandler returns a Handler generating bundles with the given syncer image and
+// resources to sync by default, and a kubeconfig to kcp at the given URL.
+func NewHandler(workloadClusterLister workloadlisters.WorkloadClusterLister, tokens TokenIssuer, image, serverURL string, caData []byte, resourcesToSync []string) *Handler {
+	return &Handler{
+		workloadClusterLister: workloadClusterLister,
+		tokens:                tokens,
+		image:                 image,
+		serverURL:             serverURL,
+		caData:                caData,
+		resourcesToSync:       resourcesToSync,
+	}
+}
+
+// IsBundleRequest returns true if the request gets the install bundle of the syncer
+// of a WorkloadCluster.
+func IsBundleRequest(requestInfo *genericapirequest.RequestInfo) bool {
+	return requestInfo != nil && requestInfo.IsResourceRequest &&
+		requestInfo.APIGroup == workload.GroupName &&
+		requestInfo.Resource == "workloadclusters" &&
+		requestInfo.Subresource == SyncerSubresource &&
+		requestInfo.Verb == "get"
+}
+
+// WithSyncerBundles serves the install bundles of syncers as v1 Lists, in JSON or
+// YAML. The image, the namespace and the resources to sync can be overridden with
+// the image, namespace and resources query parameters. Every other request is passed
+// to apiHandler. It expects authenticated and authorized requests.
+func (h *Handler) WithSyncerBundles(apiHandler http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		requestInfo, _ := genericapirequest.RequestInfoFrom(req.Context())
+		cluster := genericapirequest.ClusterFrom(req.Context())
+		if cluster == nil || cluster.Wildcard || !IsBundleRequest(requestInfo) {
+			apiHandler.ServeHTTP(w, req)
+			return
+		}
+
+		gv := schema.GroupVersion{Group: requestInfo.APIGroup, Version: requestInfo.APIVersion}
+		list, err := h.bundle(req, cluster.Name, requestInfo.Name)
+		if err != nil {
+			responsewriters.ErrorNegotiated(err, scheme.Codecs, gv, w, req)
+			return
+		}
+		responsewriters.WriteObjectNegotiated(scheme.Codecs, negotiation.DefaultEndpointRestrictions, schema.GroupVersion{Version: "v1"}, w, req, http.StatusOK, list)
+	}
+}
+
+func (h *Handler) bundle(req *http.Request, clusterName, workloadClusterName string) (*corev1.List, error) {
+	workloadCluster, err := h.workloadClusterLister.Get(clusters.ToClusterAwareKey(clusterName, workloadClusterName))
+	if apierrors.IsNotFound(err) {
+		return nil, apierrors.NewNotFound(schema.GroupResource{Group: workload.GroupName, Resource: "workloadclusters"}, workloadClusterName)
+	} else if err != nil {
+		return nil, apierrors.NewInternalError(err)
+	}
+
+	query := req.URL.Query()
+	opts := Options{
+		Image:           h.image,
+		Namespace:       query.Get("namespace"),
+		ServerURL:       h.serverURL,
+		CAData:          h.caData,
+		LogicalCluster:  clusterName,
+		WorkloadCluster: workloadClusterName,
+	}
+	if image := query.Get("image"); image != "" {
+		opts.Image = image
+	}
+	if opts.Image == "" {
+		return nil, apierrors.NewBadRequest("no syncer image configured, set the image query parameter")
+	}
+	resourcesToSync := h.resourcesToSync
+	if resources := query.Get("resources"); resources != "" {
+		resourcesToSync = strings.Split(resources, ",")
+	}
+	for _, resource := range resourcesToSync {
+		gr := schema.ParseGroupResource(resource)
+		if workloadCluster.Spec.SyncedResources.Allows(gr.WithVersion("")) {
+			opts.ResourcesToSync = append(opts.ResourcesToSync, resource)
+		}
+	}
+
+	if opts.Token, err = h.tokens.Token(clusterName, workloadClusterName); err != nil {
+		return nil, apierrors.NewInternalError(fmt.Errorf("failed to issue the syncer token: %w", err))
+	}
+	list, err := List(opts)
+	if err != nil {
+		return nil, apierrors.NewInternalError(err)
+	}
+	return list, nil
+}
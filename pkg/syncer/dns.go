@@ -0,0 +1,235 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	nscontroller "github.com/kcp-dev/kcp/pkg/reconciler/namespace"
+)
+
+const (
+	dnsAgent = "kcp#syncer-dns/v0.0.0"
+
+	// DNSConfigMapPrefix prefixes the name of the ConfigMap the syncer maintains the
+	// CoreDNS rewrite rules of its logical cluster in. The ConfigMap holds a single
+	// "<name>.override" key, meant to be imported in the server block of the cluster
+	// domain, like "import /etc/coredns/custom/*.override".
+	DNSConfigMapPrefix = "kcp-dns-"
+
+	// defaultDNSNamespace is the namespace of the DNS ConfigMap when the syncer does
+	// not run in a namespace of the physical cluster.
+	defaultDNSNamespace = "kube-system"
+
+	clusterDomain = "cluster.local"
+
+	dnsQueueKey = "dns"
+)
+
+// startDNS maintains the CoreDNS rewrite rules resolving the Services of the namespaces
+// of the logical cluster by their workspace namespace name on the physical cluster.
+func startDNS(ctx context.Context, downstream *rest.Config, kcpClusterName, workloadClusterName string) error {
+	downstream = rest.CopyConfig(downstream)
+	downstream.UserAgent = dnsAgent
+
+	client, err := kubernetes.NewForConfig(downstream)
+	if err != nil {
+		return err
+	}
+	namespace := os.Getenv(SyncerNamespaceKey)
+	if namespace == "" {
+		namespace = defaultDNSNamespace
+	}
+
+	informerFactory := informers.NewSharedInformerFactoryWithOptions(client, resyncPeriod, informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+		o.LabelSelector = nscontroller.ClusterLabelFor(workloadClusterName)
+	}))
+	namespaceInformer := informerFactory.Core().V1().Namespaces()
+
+	c := &dnsController{
+		queue:           workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "kcp-dns-"+kcpClusterName+"-"+workloadClusterName),
+		client:          client,
+		namespaceLister: namespaceInformer.Lister(),
+		kcpClusterName:  kcpClusterName,
+		namespace:       namespace,
+		configMapName:   dnsConfigMapName(kcpClusterName),
+	}
+	namespaceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.queue.Add(dnsQueueKey) },
+		UpdateFunc: func(_, obj interface{}) { c.queue.Add(dnsQueueKey) },
+		DeleteFunc: func(obj interface{}) { c.queue.Add(dnsQueueKey) },
+	})
+
+	informerFactory.Start(ctx.Done())
+	go c.Start(ctx, namespaceInformer.Informer().HasSynced)
+
+	return nil
+}
+
+type dnsController struct {
+	queue workqueue.RateLimitingInterface
+
+	client          kubernetes.Interface
+	namespaceLister corelisters.NamespaceLister
+
+	kcpClusterName string
+	namespace      string
+	configMapName  string
+}
+
+func (c *dnsController) Start(ctx context.Context, hasSynced cache.InformerSynced) {
+	defer runtime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	if !cache.WaitForCacheSync(ctx.Done(), hasSynced) {
+		return
+	}
+
+	klog.Infof("Starting DNS controller of logical cluster %s", c.kcpClusterName)
+	defer klog.Infof("Shutting down DNS controller of logical cluster %s", c.kcpClusterName)
+
+	go wait.UntilWithContext(ctx, c.startWorker, time.Second)
+
+	<-ctx.Done()
+}
+
+func (c *dnsController) startWorker(ctx context.Context) {
+	for c.processNextWorkItem(ctx) {
+	}
+}
+
+func (c *dnsController) processNextWorkItem(ctx context.Context) bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	if err := c.process(ctx); err != nil {
+		runtime.HandleError(fmt.Errorf("failed to update DNS ConfigMap %s/%s: %w", c.namespace, c.configMapName, err))
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+func (c *dnsController) process(ctx context.Context) error {
+	namespaces, err := c.namespaceLister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	data := map[string]string{
+		c.configMapName + ".override": dnsOverrides(namespaces, c.kcpClusterName, clusterDomain),
+	}
+
+	configMaps := c.client.CoreV1().ConfigMaps(c.namespace)
+	existing, err := configMaps.Get(ctx, c.configMapName, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		_, err := configMaps.Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      c.configMapName,
+				Namespace: c.namespace,
+			},
+			Data: data,
+		}, metav1.CreateOptions{})
+		return err
+	} else if err != nil {
+		return err
+	}
+	if equality.Semantic.DeepEqual(existing.Data, data) {
+		return nil
+	}
+	existing = existing.DeepCopy()
+	existing.Data = data
+	_, err = configMaps.Update(ctx, existing, metav1.UpdateOptions{})
+	return err
+}
+
+// dnsConfigMapName returns the name of the DNS ConfigMap of a logical cluster. Every
+// syncer running on a physical cluster syncs from a different logical cluster.
+func dnsConfigMapName(kcpClusterName string) string {
+	return DNSConfigMapPrefix + strings.ReplaceAll(kcpClusterName, ":", "-")
+}
+
+// dnsOverrides returns the CoreDNS rewrite rules resolving the Services of the given
+// namespaces of the logical cluster by their workspace namespace name.
+//
+// Pods resolve "<svc>.<ns>" and "<svc>.<ns>.svc.<domain>" through the search path of
+// their own namespace first, i.e. "<svc>.<ns>.<pod namespace>.svc.<domain>". That name
+// is unique on the physical cluster as the pod namespace identifies the logical
+// cluster, and it is rewritten to the physical namespace of <ns>. The answers are
+// rewritten back to the queried name.
+func dnsOverrides(namespaces []*corev1.Namespace, kcpClusterName, domain string) string {
+	type mapping struct {
+		workspaceNamespace string
+		physicalNamespace  string
+	}
+	var mappings []mapping
+	for _, ns := range namespaces {
+		var l NamespaceLocator
+		if err := json.Unmarshal([]byte(ns.Annotations[namespaceLocatorAnnotation]), &l); err != nil {
+			continue
+		}
+		if l.LogicalCluster != kcpClusterName {
+			continue
+		}
+		mappings = append(mappings, mapping{workspaceNamespace: l.Namespace, physicalNamespace: ns.Name})
+	}
+	sort.Slice(mappings, func(i, j int) bool {
+		return mappings[i].physicalNamespace < mappings[j].physicalNamespace
+	})
+
+	var b strings.Builder
+	for _, from := range mappings {
+		for _, to := range mappings {
+			for _, queried := range []string{
+				fmt.Sprintf("%s.%s.svc.%s", to.workspaceNamespace, from.physicalNamespace, domain),
+				fmt.Sprintf("%s.svc.%s.%s.svc.%s", to.workspaceNamespace, domain, from.physicalNamespace, domain),
+			} {
+				physical := fmt.Sprintf("%s.svc.%s", to.physicalNamespace, domain)
+				fmt.Fprintf(&b, "rewrite stop {\n")
+				fmt.Fprintf(&b, "    name regex ^(.*)\\.%s\\.$ {1}.%s.\n", regexp.QuoteMeta(queried), physical)
+				fmt.Fprintf(&b, "    answer name ^(.*)\\.%s\\.$ {1}.%s.\n", regexp.QuoteMeta(physical), queried)
+				fmt.Fprintf(&b, "}\n")
+			}
+		}
+	}
+	return b.String()
+}
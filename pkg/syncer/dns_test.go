@@ -0,0 +1,73 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDNSOverrides(t *testing.T) {
+	namespaces := []*corev1.Namespace{
+		{ObjectMeta: metav1.ObjectMeta{Name: "kcpb", Annotations: map[string]string{namespaceLocatorAnnotation: `{"logical-cluster":"root:acme","namespace":"db"}`}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "kcpa", Annotations: map[string]string{namespaceLocatorAnnotation: `{"logical-cluster":"root:acme","namespace":"web"}`}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "kcpc", Annotations: map[string]string{namespaceLocatorAnnotation: `{"logical-cluster":"root:other","namespace":"db"}`}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "unmanaged"}},
+	}
+
+	require.Equal(t, `rewrite stop {
+    name regex ^(.*)\.web\.kcpa\.svc\.cluster\.local\.$ {1}.kcpa.svc.cluster.local.
+    answer name ^(.*)\.kcpa\.svc\.cluster\.local\.$ {1}.web.kcpa.svc.cluster.local.
+}
+rewrite stop {
+    name regex ^(.*)\.web\.svc\.cluster\.local\.kcpa\.svc\.cluster\.local\.$ {1}.kcpa.svc.cluster.local.
+    answer name ^(.*)\.kcpa\.svc\.cluster\.local\.$ {1}.web.svc.cluster.local.kcpa.svc.cluster.local.
+}
+rewrite stop {
+    name regex ^(.*)\.db\.kcpa\.svc\.cluster\.local\.$ {1}.kcpb.svc.cluster.local.
+    answer name ^(.*)\.kcpb\.svc\.cluster\.local\.$ {1}.db.kcpa.svc.cluster.local.
+}
+rewrite stop {
+    name regex ^(.*)\.db\.svc\.cluster\.local\.kcpa\.svc\.cluster\.local\.$ {1}.kcpb.svc.cluster.local.
+    answer name ^(.*)\.kcpb\.svc\.cluster\.local\.$ {1}.db.svc.cluster.local.kcpa.svc.cluster.local.
+}
+rewrite stop {
+    name regex ^(.*)\.web\.kcpb\.svc\.cluster\.local\.$ {1}.kcpa.svc.cluster.local.
+    answer name ^(.*)\.kcpa\.svc\.cluster\.local\.$ {1}.web.kcpb.svc.cluster.local.
+}
+rewrite stop {
+    name regex ^(.*)\.web\.svc\.cluster\.local\.kcpb\.svc\.cluster\.local\.$ {1}.kcpa.svc.cluster.local.
+    answer name ^(.*)\.kcpa\.svc\.cluster\.local\.$ {1}.web.svc.cluster.local.kcpb.svc.cluster.local.
+}
+rewrite stop {
+    name regex ^(.*)\.db\.kcpb\.svc\.cluster\.local\.$ {1}.kcpb.svc.cluster.local.
+    answer name ^(.*)\.kcpb\.svc\.cluster\.local\.$ {1}.db.kcpb.svc.cluster.local.
+}
+rewrite stop {
+    name regex ^(.*)\.db\.svc\.cluster\.local\.kcpb\.svc\.cluster\.local\.$ {1}.kcpb.svc.cluster.local.
+    answer name ^(.*)\.kcpb\.svc\.cluster\.local\.$ {1}.db.svc.cluster.local.kcpb.svc.cluster.local.
+}
+`, dnsOverrides(namespaces, "root:acme", "cluster.local"))
+}
+
+func TestDNSConfigMapName(t *testing.T) {
+	require.Equal(t, "kcp-dns-root-acme", dnsConfigMapName("root:acme"))
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	kcpclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
+)
+
+const (
+	heartbeatAgent = "kcp#syncer-heartbeat/v0.0.0"
+
+	// HeartbeatInterval is the period at which the syncer reports it is alive to
+	// its WorkloadCluster.
+	HeartbeatInterval = 5 * time.Second
+)
+
+// startHeartbeat periodically updates status.lastSyncerHeartbeatTime of the
+// WorkloadCluster the syncer is syncing to, until the context is done.
+func startHeartbeat(ctx context.Context, upstream *rest.Config, kcpClusterName, workloadClusterName string) error {
+	upstream = rest.CopyConfig(upstream)
+	upstream.UserAgent = heartbeatAgent
+
+	kcpClusterClient, err := kcpclient.NewClusterForConfig(upstream)
+	if err != nil {
+		return err
+	}
+	kcpClient := kcpClusterClient.Cluster(kcpClusterName)
+
+	go wait.UntilWithContext(ctx, func(ctx context.Context) {
+		patch := map[string]interface{}{
+			"status": map[string]interface{}{
+				"lastSyncerHeartbeatTime": metav1.Now(),
+			},
+		}
+		patchBytes, err := json.Marshal(patch)
+		if err != nil {
+			klog.Errorf("failed to marshal heartbeat patch for WorkloadCluster %s|%s: %v", kcpClusterName, workloadClusterName, err)
+			return
+		}
+		if _, err := kcpClient.WorkloadV1alpha1().WorkloadClusters().Patch(ctx, workloadClusterName, types.MergePatchType, patchBytes, metav1.PatchOptions{}, "status"); err != nil {
+			klog.Errorf("failed to send heartbeat to WorkloadCluster %s|%s: %v", kcpClusterName, workloadClusterName, err)
+			return
+		}
+		klog.V(5).Infof("Sent heartbeat to WorkloadCluster %s|%s", kcpClusterName, workloadClusterName)
+	}, HeartbeatInterval)
+
+	return nil
+}
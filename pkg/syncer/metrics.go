@@ -0,0 +1,133 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	compbasemetrics "k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+const (
+	metricsNamespace = "kcp"
+	metricsSubsystem = "syncer"
+)
+
+var (
+	metricLabels = []string{"logical_cluster", "workload_cluster", "direction", "resource"}
+
+	queueDepth = compbasemetrics.NewGaugeVec(
+		&compbasemetrics.GaugeOpts{
+			Namespace:      metricsNamespace,
+			Subsystem:      metricsSubsystem,
+			Name:           "queue_depth",
+			Help:           "Number of objects waiting to be synced, broken out by logical cluster, workload cluster, direction and resource.",
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+		metricLabels,
+	)
+	lastSuccessfulSync = compbasemetrics.NewGaugeVec(
+		&compbasemetrics.GaugeOpts{
+			Namespace:      metricsNamespace,
+			Subsystem:      metricsSubsystem,
+			Name:           "last_successful_sync_timestamp_seconds",
+			Help:           "Time of the last successful sync of an object, broken out by logical cluster, workload cluster, direction and resource.",
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+		metricLabels,
+	)
+	syncErrors = compbasemetrics.NewCounterVec(
+		&compbasemetrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Subsystem:      metricsSubsystem,
+			Name:           "sync_errors_total",
+			Help:           "Counter of failed syncs of an object, broken out by logical cluster, workload cluster, direction and resource.",
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+		metricLabels,
+	)
+	downstreamApplyFailures = compbasemetrics.NewCounterVec(
+		&compbasemetrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Subsystem:      metricsSubsystem,
+			Name:           "downstream_apply_failures_total",
+			Help:           "Counter of objects failed to be applied to the physical cluster, broken out by logical cluster, workload cluster, direction and resource.",
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+		metricLabels,
+	)
+	upsyncConflicts = compbasemetrics.NewCounterVec(
+		&compbasemetrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Subsystem:      metricsSubsystem,
+			Name:           "upsync_conflicts_total",
+			Help:           "Counter of conflicts updating the status of objects in kcp, broken out by logical cluster, workload cluster, direction and resource.",
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+		metricLabels,
+	)
+
+	metrics = []compbasemetrics.Registerable{
+		queueDepth,
+		lastSuccessfulSync,
+		syncErrors,
+		downstreamApplyFailures,
+		upsyncConflicts,
+	}
+)
+
+var registerMetrics sync.Once
+
+// RegisterMetrics registers the syncer metrics in the legacy registry, which is
+// served by the kcp server at /metrics, and by the syncer on its metrics address.
+func RegisterMetrics() {
+	registerMetrics.Do(func() {
+		for _, metric := range metrics {
+			legacyregistry.MustRegister(metric)
+		}
+	})
+}
+
+func (c *Controller) metricLabelValues(gvr schema.GroupVersionResource) []string {
+	return []string{c.upstreamClusterName, c.workloadClusterName, string(c.direction), gvr.GroupResource().String()}
+}
+
+// markPending records that the object of the given key is waiting in the queue.
+func (c *Controller) markPending(h holder) {
+	c.pendingLock.Lock()
+	defer c.pendingLock.Unlock()
+
+	if _, found := c.pending[h]; found {
+		return
+	}
+	c.pending[h] = struct{}{}
+	queueDepth.WithLabelValues(c.metricLabelValues(h.gvr)...).Inc()
+}
+
+// markProcessing records that the object of the given key left the queue.
+func (c *Controller) markProcessing(h holder) {
+	c.pendingLock.Lock()
+	defer c.pendingLock.Unlock()
+
+	if _, found := c.pending[h]; !found {
+		return
+	}
+	delete(c.pending, h)
+	queueDepth.WithLabelValues(c.metricLabelValues(h.gvr)...).Dec()
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func TestQueueDepth(t *testing.T) {
+	RegisterMetrics()
+
+	c := &Controller{
+		direction:           KcpToPhysicalCluster,
+		upstreamClusterName: "root:acme",
+		workloadClusterName: "us-east1",
+		pending:             map[holder]struct{}{},
+	}
+	deployments := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	depth := func() float64 {
+		value, err := testutil.GetGaugeMetricValue(queueDepth.WithLabelValues(c.metricLabelValues(deployments)...))
+		require.NoError(t, err)
+		return value
+	}
+
+	web := holder{gvr: deployments, clusterName: "root:acme", namespace: "default", name: "web"}
+	db := holder{gvr: deployments, clusterName: "root:acme", namespace: "default", name: "db"}
+
+	c.markPending(web)
+	c.markPending(web)
+	c.markPending(db)
+	require.Equal(t, float64(2), depth())
+
+	c.markProcessing(web)
+	c.markProcessing(web)
+	require.Equal(t, float64(1), depth())
+
+	c.markProcessing(db)
+	require.Equal(t, float64(0), depth())
+}
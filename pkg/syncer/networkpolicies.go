@@ -0,0 +1,171 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// LogicalClusterLabel is set on the namespaces the syncer creates in a physical
+	// cluster. It holds a hash of the logical cluster the namespace is synced from, so
+	// that namespaces of the same tenant can be selected by NetworkPolicies.
+	LogicalClusterLabel = "workloads.kcp.dev/logical-cluster"
+
+	// TenantIsolationPolicyName is the name of the NetworkPolicy the syncer creates in
+	// every namespace it creates in a physical cluster.
+	TenantIsolationPolicyName = "kcp-tenant-isolation"
+
+	namespaceNameLabel = "kubernetes.io/metadata.name"
+)
+
+var networkPoliciesGVR = schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "networkpolicies"}
+
+// logicalClusterLabelValue returns the value of the LogicalClusterLabel for the given
+// logical cluster. Logical cluster names are not valid label values, hence the hash.
+func logicalClusterLabelValue(logicalCluster string) string {
+	return fmt.Sprintf("%x", sha256.Sum224([]byte(logicalCluster)))
+}
+
+// tenantIsolationPolicy returns the NetworkPolicy denying ingress traffic to the pods
+// of a downstream namespace from the namespaces of other logical clusters. Traffic from
+// the namespaces not managed by kcp, e.g. ingress controllers, is still allowed.
+func tenantIsolationPolicy(downstreamNamespace, logicalCluster string) *networkingv1.NetworkPolicy {
+	return &networkingv1.NetworkPolicy{
+		TypeMeta: metav1.TypeMeta{APIVersion: "networking.k8s.io/v1", Kind: "NetworkPolicy"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      TenantIsolationPolicyName,
+			Namespace: downstreamNamespace,
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{{
+				From: []networkingv1.NetworkPolicyPeer{{
+					NamespaceSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{LogicalClusterLabel: logicalClusterLabelValue(logicalCluster)},
+					},
+				}, {
+					NamespaceSelector: &metav1.LabelSelector{
+						MatchExpressions: []metav1.LabelSelectorRequirement{{
+							Key:      LogicalClusterLabel,
+							Operator: metav1.LabelSelectorOpDoesNotExist,
+						}},
+					},
+				}},
+			}},
+		},
+	}
+}
+
+// ensureDownstreamTenantIsolation creates the tenant isolation NetworkPolicy in the
+// given downstream namespace, if it doesn't exist yet.
+func (c *Controller) ensureDownstreamTenantIsolation(ctx context.Context, downstreamNamespace, logicalCluster string) error {
+	policy, err := runtime.DefaultUnstructuredConverter.ToUnstructured(tenantIsolationPolicy(downstreamNamespace, logicalCluster))
+	if err != nil {
+		return err
+	}
+	if _, err := c.toClient.Resource(networkPoliciesGVR).Namespace(downstreamNamespace).Create(ctx, &unstructured.Unstructured{Object: policy}, metav1.CreateOptions{}); err != nil {
+		if !k8serrors.IsAlreadyExists(err) {
+			klog.Errorf("Error while creating network policy %s/%s: %v", downstreamNamespace, TenantIsolationPolicyName, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// translateNetworkPolicy maps the namespace selectors of a NetworkPolicy synced to a
+// physical cluster to the downstream namespaces of its logical cluster: namespace names
+// are mapped to the downstream ones, and the namespaces of other logical clusters are
+// never selected.
+func translateNetworkPolicy(gvr schema.GroupVersionResource, obj *unstructured.Unstructured, logicalCluster string) error {
+	if gvr != networkPoliciesGVR {
+		return nil
+	}
+
+	policy := &networkingv1.NetworkPolicy{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, policy); err != nil {
+		return err
+	}
+	for i := range policy.Spec.Ingress {
+		for j := range policy.Spec.Ingress[i].From {
+			if err := translateNetworkPolicyPeer(&policy.Spec.Ingress[i].From[j], logicalCluster); err != nil {
+				return err
+			}
+		}
+	}
+	for i := range policy.Spec.Egress {
+		for j := range policy.Spec.Egress[i].To {
+			if err := translateNetworkPolicyPeer(&policy.Spec.Egress[i].To[j], logicalCluster); err != nil {
+				return err
+			}
+		}
+	}
+
+	spec, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&policy.Spec)
+	if err != nil {
+		return err
+	}
+	return unstructured.SetNestedMap(obj.Object, spec, "spec")
+}
+
+func translateNetworkPolicyPeer(peer *networkingv1.NetworkPolicyPeer, logicalCluster string) error {
+	selector := peer.NamespaceSelector
+	if selector == nil {
+		// Peers without namespace selector select pods in the policy namespace only.
+		return nil
+	}
+
+	downstreamName := func(upstreamName string) (string, error) {
+		return PhysicalClusterNamespaceName(NamespaceLocator{LogicalCluster: logicalCluster, Namespace: upstreamName})
+	}
+	if name, found := selector.MatchLabels[namespaceNameLabel]; found {
+		mapped, err := downstreamName(name)
+		if err != nil {
+			return err
+		}
+		selector.MatchLabels[namespaceNameLabel] = mapped
+	}
+	for i, expr := range selector.MatchExpressions {
+		if expr.Key != namespaceNameLabel {
+			continue
+		}
+		for j, name := range expr.Values {
+			mapped, err := downstreamName(name)
+			if err != nil {
+				return err
+			}
+			selector.MatchExpressions[i].Values[j] = mapped
+		}
+	}
+
+	if selector.MatchLabels == nil {
+		selector.MatchLabels = map[string]string{}
+	}
+	selector.MatchLabels[LogicalClusterLabel] = logicalClusterLabelValue(logicalCluster)
+	return nil
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestTranslateNetworkPolicy(t *testing.T) {
+	policy := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "networking.k8s.io/v1",
+		"kind":       "NetworkPolicy",
+		"metadata":   map[string]interface{}{"name": "allow-frontend", "namespace": "kcp0123"},
+		"spec": map[string]interface{}{
+			"podSelector": map[string]interface{}{},
+			"ingress": []interface{}{
+				map[string]interface{}{"from": []interface{}{
+					map[string]interface{}{"podSelector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "web"}}},
+					map[string]interface{}{"namespaceSelector": map[string]interface{}{"matchLabels": map[string]interface{}{namespaceNameLabel: "frontend"}}},
+				}},
+			},
+			"egress": []interface{}{
+				map[string]interface{}{"to": []interface{}{
+					map[string]interface{}{"namespaceSelector": map[string]interface{}{}},
+				}},
+			},
+		},
+	}}
+
+	require.NoError(t, translateNetworkPolicy(networkPoliciesGVR, policy, "root:acme"))
+
+	frontend, err := PhysicalClusterNamespaceName(NamespaceLocator{LogicalCluster: "root:acme", Namespace: "frontend"})
+	require.NoError(t, err)
+	tenant := logicalClusterLabelValue("root:acme")
+
+	from, _, _ := unstructured.NestedSlice(policy.Object, "spec", "ingress")
+	require.Equal(t, []interface{}{
+		map[string]interface{}{"podSelector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "web"}}},
+		map[string]interface{}{"namespaceSelector": map[string]interface{}{"matchLabels": map[string]interface{}{
+			namespaceNameLabel:  frontend,
+			LogicalClusterLabel: tenant,
+		}}},
+	}, from[0].(map[string]interface{})["from"])
+
+	to, _, _ := unstructured.NestedSlice(policy.Object, "spec", "egress")
+	require.Equal(t, []interface{}{
+		map[string]interface{}{"namespaceSelector": map[string]interface{}{"matchLabels": map[string]interface{}{
+			LogicalClusterLabel: tenant,
+		}}},
+	}, to[0].(map[string]interface{})["to"])
+}
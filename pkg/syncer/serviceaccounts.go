@@ -0,0 +1,193 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+)
+
+var (
+	serviceAccountsGVR = schema.GroupVersionResource{Version: "v1", Resource: "serviceaccounts"}
+	secretsGVR         = schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+	podsGVR            = schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	podTemplatesGVR    = schema.GroupVersionResource{Version: "v1", Resource: "podtemplates"}
+)
+
+// isServiceAccountToken returns true if the given object is a service account token
+// Secret. Those tokens are issued for the logical cluster and are meaningless on a
+// physical cluster, which issues its own tokens for the downstream ServiceAccounts.
+func isServiceAccountToken(gvr schema.GroupVersionResource, obj *unstructured.Unstructured) bool {
+	if gvr != secretsGVR {
+		return false
+	}
+	secretType, _, _ := unstructured.NestedString(obj.Object, "type")
+	return secretType == string(corev1.SecretTypeServiceAccountToken)
+}
+
+// translateServiceAccount removes the token Secret references of a ServiceAccount
+// synced to a physical cluster, so that the token controller of the physical cluster
+// mints tokens for it instead. Image pull Secret references are kept, the referenced
+// Secrets being synced along with the pods using them.
+func translateServiceAccount(gvr schema.GroupVersionResource, obj *unstructured.Unstructured) {
+	if gvr != serviceAccountsGVR {
+		return
+	}
+	unstructured.RemoveNestedField(obj.Object, "secrets")
+}
+
+// podSpecPaths returns the paths of the pod specs embedded in an object of the given
+// resource, either directly or through a pod template.
+func podSpecPaths(gvr schema.GroupVersionResource, obj *unstructured.Unstructured) [][]string {
+	switch gvr {
+	case podsGVR:
+		return [][]string{{"spec"}}
+	case podTemplatesGVR:
+		return [][]string{{"template", "spec"}}
+	}
+
+	var paths [][]string
+	for _, path := range [][]string{
+		// deployments, replicasets, statefulsets, daemonsets, jobs, ...
+		{"spec", "template", "spec"},
+		// cronjobs
+		{"spec", "jobTemplate", "spec", "template", "spec"},
+	} {
+		if _, found, _ := unstructured.NestedSlice(obj.Object, append(path, "containers")...); found {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// podIdentityReferences returns the ServiceAccounts and image pull Secrets the pod
+// specs of the given object refer to.
+func podIdentityReferences(gvr schema.GroupVersionResource, obj *unstructured.Unstructured) (serviceAccounts, pullSecrets sets.String) {
+	serviceAccounts, pullSecrets = sets.NewString(), sets.NewString()
+	for _, path := range podSpecPaths(gvr, obj) {
+		podSpec, _, _ := unstructured.NestedMap(obj.Object, path...)
+
+		serviceAccount, _, _ := unstructured.NestedString(podSpec, "serviceAccountName")
+		if serviceAccount == "" {
+			serviceAccount, _, _ = unstructured.NestedString(podSpec, "serviceAccount")
+		}
+		if serviceAccount != "" {
+			serviceAccounts.Insert(serviceAccount)
+		}
+
+		refs, _, _ := unstructured.NestedSlice(podSpec, "imagePullSecrets")
+		for _, ref := range refs {
+			if m, ok := ref.(map[string]interface{}); ok {
+				if name, ok := m["name"].(string); ok && name != "" {
+					pullSecrets.Insert(name)
+				}
+			}
+		}
+	}
+	return serviceAccounts, pullSecrets
+}
+
+// ensureDownstreamPodIdentity makes sure the ServiceAccounts and image pull Secrets
+// referred to by the pod specs of the downstream object of an upstream object exist in
+// the downstream namespace, so that its pods are admitted and can pull their images on
+// the physical cluster.
+// The "default" ServiceAccount is left to the physical cluster, which creates one in
+// every namespace.
+func (c *Controller) ensureDownstreamPodIdentity(ctx context.Context, gvr schema.GroupVersionResource, upstreamObj, downstreamObj *unstructured.Unstructured) error {
+	downstreamNamespace := downstreamObj.GetNamespace()
+	serviceAccounts, pullSecrets := podIdentityReferences(gvr, downstreamObj)
+	serviceAccounts.Delete("default")
+
+	for _, name := range serviceAccounts.List() {
+		serviceAccount, err := c.fromClient.Resource(serviceAccountsGVR).Namespace(upstreamObj.GetNamespace()).Get(ctx, name, metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			// Create an empty one, the pods would not be admitted otherwise.
+			serviceAccount = &unstructured.Unstructured{}
+			serviceAccount.SetAPIVersion("v1")
+			serviceAccount.SetKind("ServiceAccount")
+			serviceAccount.SetName(name)
+		} else if err != nil {
+			return err
+		}
+		translateServiceAccount(serviceAccountsGVR, serviceAccount)
+
+		refs, _, _ := unstructured.NestedSlice(serviceAccount.Object, "imagePullSecrets")
+		for _, ref := range refs {
+			if m, ok := ref.(map[string]interface{}); ok {
+				if name, ok := m["name"].(string); ok && name != "" {
+					pullSecrets.Insert(name)
+				}
+			}
+		}
+
+		if err := c.applyDependencyToDownstream(ctx, serviceAccountsGVR, downstreamNamespace, serviceAccount); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range pullSecrets.List() {
+		secret, err := c.fromClient.Resource(secretsGVR).Namespace(upstreamObj.GetNamespace()).Get(ctx, name, metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			// Pulling may still succeed without it, let the kubelet report the failure.
+			klog.Warningf("Image pull secret %s|%s/%s referenced by %s %s not found", upstreamObj.GetClusterName(), upstreamObj.GetNamespace(), name, gvr.Resource, upstreamObj.GetName())
+			continue
+		} else if err != nil {
+			return err
+		}
+		if isServiceAccountToken(secretsGVR, secret) {
+			continue
+		}
+		if err := c.applyDependencyToDownstream(ctx, secretsGVR, downstreamNamespace, secret); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyDependencyToDownstream applies an upstream object another synced object depends
+// on to the downstream namespace.
+func (c *Controller) applyDependencyToDownstream(ctx context.Context, gvr schema.GroupVersionResource, downstreamNamespace string, upstreamObj *unstructured.Unstructured) error {
+	downstreamObj := upstreamObj.DeepCopy()
+	downstreamObj.SetUID("")
+	downstreamObj.SetResourceVersion("")
+	downstreamObj.SetNamespace(downstreamNamespace)
+	downstreamObj.SetManagedFields(nil)
+	downstreamObj.SetClusterName("")
+	downstreamObj.SetOwnerReferences(nil)
+	downstreamObj.SetFinalizers(nil)
+
+	data, err := json.Marshal(downstreamObj)
+	if err != nil {
+		return err
+	}
+	if _, err := c.toClient.Resource(gvr).Namespace(downstreamNamespace).Patch(ctx, downstreamObj.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{FieldManager: syncerApplyManager, Force: pointer.Bool(true)}); err != nil {
+		return fmt.Errorf("failed to apply %s %s/%s: %w", gvr.Resource, downstreamNamespace, downstreamObj.GetName(), err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestPodIdentityReferences(t *testing.T) {
+	podSpec := map[string]interface{}{
+		"serviceAccountName": "builder",
+		"imagePullSecrets": []interface{}{
+			map[string]interface{}{"name": "registry"},
+		},
+		"containers": []interface{}{
+			map[string]interface{}{"name": "main", "image": "quay.io/acme/builder"},
+		},
+	}
+
+	for _, c := range []struct {
+		desc                string
+		gvr                 schema.GroupVersionResource
+		obj                 map[string]interface{}
+		wantServiceAccounts []string
+		wantPullSecrets     []string
+	}{{
+		desc:                "pod",
+		gvr:                 podsGVR,
+		obj:                 map[string]interface{}{"spec": podSpec},
+		wantServiceAccounts: []string{"builder"},
+		wantPullSecrets:     []string{"registry"},
+	}, {
+		desc:                "deployment",
+		gvr:                 schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"},
+		obj:                 map[string]interface{}{"spec": map[string]interface{}{"template": map[string]interface{}{"spec": podSpec}}},
+		wantServiceAccounts: []string{"builder"},
+		wantPullSecrets:     []string{"registry"},
+	}, {
+		desc: "cronjob",
+		gvr:  schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "cronjobs"},
+		obj: map[string]interface{}{"spec": map[string]interface{}{"jobTemplate": map[string]interface{}{
+			"spec": map[string]interface{}{"template": map[string]interface{}{"spec": podSpec}},
+		}}},
+		wantServiceAccounts: []string{"builder"},
+		wantPullSecrets:     []string{"registry"},
+	}, {
+		desc: "deprecated serviceAccount field",
+		gvr:  podsGVR,
+		obj: map[string]interface{}{"spec": map[string]interface{}{
+			"serviceAccount": "legacy",
+			"containers":     []interface{}{},
+		}},
+		wantServiceAccounts: []string{"legacy"},
+		wantPullSecrets:     []string{},
+	}, {
+		desc:                "no pod spec",
+		gvr:                 schema.GroupVersionResource{Version: "v1", Resource: "configmaps"},
+		obj:                 map[string]interface{}{"data": map[string]interface{}{"spec": "value"}},
+		wantServiceAccounts: []string{},
+		wantPullSecrets:     []string{},
+	}} {
+		t.Run(c.desc, func(t *testing.T) {
+			serviceAccounts, pullSecrets := podIdentityReferences(c.gvr, &unstructured.Unstructured{Object: c.obj})
+			require.Equal(t, c.wantServiceAccounts, serviceAccounts.List())
+			require.Equal(t, c.wantPullSecrets, pullSecrets.List())
+		})
+	}
+}
+
+func TestServiceAccountTranslation(t *testing.T) {
+	token := &unstructured.Unstructured{Object: map[string]interface{}{
+		"type": "kubernetes.io/service-account-token",
+	}}
+	require.True(t, isServiceAccountToken(secretsGVR, token))
+
+	opaque := &unstructured.Unstructured{Object: map[string]interface{}{
+		"type": "Opaque",
+	}}
+	require.False(t, isServiceAccountToken(secretsGVR, opaque))
+
+	serviceAccount := &unstructured.Unstructured{Object: map[string]interface{}{
+		"secrets":          []interface{}{map[string]interface{}{"name": "builder-token-abcde"}},
+		"imagePullSecrets": []interface{}{map[string]interface{}{"name": "registry"}},
+	}}
+	translateServiceAccount(serviceAccountsGVR, serviceAccount)
+	require.Equal(t, map[string]interface{}{
+		"imagePullSecrets": []interface{}{map[string]interface{}{"name": "registry"}},
+	}, serviceAccount.Object)
+}
@@ -33,6 +33,7 @@ import (
 	"k8s.io/klog/v2"
 	"k8s.io/utils/pointer"
 
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
 	nscontroller "github.com/kcp-dev/kcp/pkg/reconciler/namespace"
 )
 
@@ -64,7 +65,7 @@ func deepEqualApartFromStatus(oldObj, newObj interface{}) bool {
 
 const specSyncerAgent = "kcp#spec-syncer/v0.0.0"
 
-func NewSpecSyncer(from, to *rest.Config, syncedResourceTypes []string, kcpClusterName, pclusterID string) (*Controller, error) {
+func NewSpecSyncer(from, to *rest.Config, syncedResourceTypes []string, syncedResources *workloadv1alpha1.SyncedResources, storageClasses map[string]string, kcpClusterName, pclusterID string) (*Controller, error) {
 	from = rest.CopyConfig(from)
 	from.UserAgent = specSyncerAgent
 	to = rest.CopyConfig(to)
@@ -83,7 +84,12 @@ func NewSpecSyncer(from, to *rest.Config, syncedResourceTypes []string, kcpClust
 	}
 	fromClient := fromClients.Cluster(kcpClusterName)
 	toClient := dynamic.NewForConfigOrDie(to)
-	return New(kcpClusterName, pclusterID, fromDiscovery, fromClient, toClient, KcpToPhysicalCluster, syncedResourceTypes, pclusterID)
+	c, err := New(kcpClusterName, pclusterID, fromDiscovery, fromClient, toClient, KcpToPhysicalCluster, syncedResourceTypes, syncedResources, pclusterID)
+	if err != nil {
+		return nil, err
+	}
+	c.storageClasses = storageClasses
+	return c, nil
 }
 
 func (c *Controller) deleteFromDownstream(ctx context.Context, gvr schema.GroupVersionResource, namespace, name string) error {
@@ -96,7 +102,8 @@ func (c *Controller) deleteFromDownstream(ctx context.Context, gvr schema.GroupV
 const namespaceLocatorAnnotation = "kcp.dev/namespace-locator"
 
 // TODO: This function is there as a quick and dirty implementation of namespace creation.
-//       In fact We should also be getting notifications about namespaces created upstream and be creating downstream equivalents.
+//
+//	In fact We should also be getting notifications about namespaces created upstream and be creating downstream equivalents.
 func (c *Controller) ensureDownstreamNamespaceExists(ctx context.Context, downstreamNamespace string, upstreamObj *unstructured.Unstructured) error {
 	namespaces := c.toClient.Resource(schema.GroupVersionResource{
 		Group:    "",
@@ -123,12 +130,15 @@ func (c *Controller) ensureDownstreamNamespaceExists(ctx context.Context, downst
 		namespaceLocatorAnnotation: string(b),
 	})
 
+	labels := map[string]string{
+		LogicalClusterLabel: logicalClusterLabelValue(upstreamObj.GetClusterName()),
+	}
 	if upstreamObj.GetLabels() != nil {
-		newNamespace.SetLabels(map[string]string{
-			// TODO: this should be set once at syncer startup and propagated around everywhere.
-			nscontroller.ClusterLabel: upstreamObj.GetLabels()[nscontroller.ClusterLabel],
-		})
+		// TODO: this should be set once at syncer startup and propagated around everywhere.
+		labels[nscontroller.ClusterLabel] = upstreamObj.GetLabels()[nscontroller.ClusterLabel]
+		labels[nscontroller.ClusterLabelFor(c.workloadClusterName)] = ""
 	}
+	newNamespace.SetLabels(labels)
 
 	if _, err := namespaces.Create(ctx, newNamespace, metav1.CreateOptions{}); err != nil {
 		// An already exists error is ok - it means something else beat us to creating the namespace.
@@ -141,15 +151,56 @@ func (c *Controller) ensureDownstreamNamespaceExists(ctx context.Context, downst
 	}
 	klog.Infof("Created downstream namespace %s for upstream namespace %s|%s", downstreamNamespace, c.upstreamClusterName, upstreamObj.GetName())
 
+	// Co-located tenants must not reach each other's pods, whatever their own policies.
+	if err := c.ensureDownstreamTenantIsolation(ctx, downstreamNamespace, upstreamObj.GetClusterName()); err != nil {
+		return err
+	}
+
 	return nil
 }
 
 func (c *Controller) applyToDownstream(ctx context.Context, gvr schema.GroupVersionResource, downstreamNamespace string, upstreamObj *unstructured.Unstructured) error {
+	if isServiceAccountToken(gvr, upstreamObj) {
+		klog.V(2).Infof("Not syncing service account token %s|%s/%s", upstreamObj.GetClusterName(), upstreamObj.GetNamespace(), upstreamObj.GetName())
+		return nil
+	}
+
 	if err := c.ensureDownstreamNamespaceExists(ctx, downstreamNamespace, upstreamObj); err != nil {
 		return err
 	}
 
-	downstreamObj := upstreamObj.DeepCopy()
+	downstreamObj, err := c.downstreamObject(gvr, downstreamNamespace, upstreamObj)
+	if err != nil {
+		return err
+	}
+	if err := c.ensureDownstreamPodIdentity(ctx, gvr, upstreamObj, downstreamObj); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(downstreamObj)
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.toClient.Resource(gvr).Namespace(downstreamNamespace).Patch(ctx, downstreamObj.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{FieldManager: syncerApplyManager, Force: pointer.Bool(true)}); err != nil {
+		downstreamApplyFailures.WithLabelValues(c.metricLabelValues(gvr)...).Inc()
+		klog.Infof("Error upserting %s %s/%s from upstream %s|%s/%s: %v", gvr.Resource, downstreamObj.GetNamespace(), downstreamObj.GetName(), upstreamObj.GetClusterName(), upstreamObj.GetNamespace(), upstreamObj.GetName(), err)
+		return err
+	}
+	klog.Infof("Upserted %s %s/%s from upstream %s|%s/%s", gvr.Resource, downstreamObj.GetNamespace(), downstreamObj.GetName(), upstreamObj.GetClusterName(), upstreamObj.GetNamespace(), upstreamObj.GetName())
+
+	return nil
+}
+
+// downstreamObject returns the object applied to the downstream namespace for the given
+// upstream object. The spec-diff of the workload cluster is applied first, so that the
+// translations of the fields the syncer owns, e.g. the namespace selectors of
+// NetworkPolicies, cannot be overridden by it.
+func (c *Controller) downstreamObject(gvr schema.GroupVersionResource, downstreamNamespace string, upstreamObj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	downstreamObj, err := applySpecDiff(upstreamObj.DeepCopy(), c.workloadClusterName)
+	if err != nil {
+		return nil, err
+	}
 	downstreamObj.SetUID("")
 	downstreamObj.SetResourceVersion("")
 	downstreamObj.SetNamespace(downstreamNamespace)
@@ -169,16 +220,11 @@ func (c *Controller) applyToDownstream(ctx context.Context, gvr schema.GroupVers
 	// TODO: wipe things like finalizers, owner-refs and any other life-cycle fields. The life-cycle
 	//       should exclusively owned by the syncer. Let's not some Kubernetes magic interfere with it.
 
-	data, err := json.Marshal(downstreamObj)
-	if err != nil {
-		return err
-	}
-
-	if _, err := c.toClient.Resource(gvr).Namespace(downstreamNamespace).Patch(ctx, downstreamObj.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{FieldManager: syncerApplyManager, Force: pointer.Bool(true)}); err != nil {
-		klog.Infof("Error upserting %s %s/%s from upstream %s|%s/%s: %v", gvr.Resource, downstreamObj.GetNamespace(), downstreamObj.GetName(), upstreamObj.GetClusterName(), upstreamObj.GetNamespace(), upstreamObj.GetName(), err)
-		return err
+	removeStatusAnnotations(downstreamObj)
+	translateServiceAccount(gvr, downstreamObj)
+	translatePersistentVolumeClaim(gvr, downstreamObj, c.storageClasses)
+	if err := translateNetworkPolicy(gvr, downstreamObj, upstreamObj.GetClusterName()); err != nil {
+		return nil, err
 	}
-	klog.Infof("Upserted %s %s/%s from upstream %s|%s/%s", gvr.Resource, downstreamObj.GetNamespace(), downstreamObj.GetName(), upstreamObj.GetClusterName(), upstreamObj.GetNamespace(), upstreamObj.GetName())
-
-	return nil
+	return downstreamObj, nil
 }
@@ -18,15 +18,24 @@ package syncer
 
 import (
 	"context"
+	"encoding/json"
+	"strings"
 
 	"k8s.io/apimachinery/pkg/api/equality"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/rest"
 	"k8s.io/klog/v2"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+	nscontroller "github.com/kcp-dev/kcp/pkg/reconciler/namespace"
 )
 
 func deepEqualStatus(oldObj, newObj interface{}) bool {
@@ -44,7 +53,7 @@ func deepEqualStatus(oldObj, newObj interface{}) bool {
 
 const statusSyncerAgent = "kcp#status-syncer/v0.0.0"
 
-func NewStatusSyncer(from, to *rest.Config, syncedResourceTypes []string, kcpClusterName, pclusterID string) (*Controller, error) {
+func NewStatusSyncer(from, to *rest.Config, syncedResourceTypes []string, syncedResources *workloadv1alpha1.SyncedResources, kcpClusterName, pclusterID string) (*Controller, error) {
 	from = rest.CopyConfig(from)
 	from.UserAgent = statusSyncerAgent
 	to = rest.CopyConfig(to)
@@ -62,10 +71,19 @@ func NewStatusSyncer(from, to *rest.Config, syncedResourceTypes []string, kcpClu
 		return nil, err
 	}
 	toClient := toClients.Cluster(kcpClusterName)
-	return New(kcpClusterName, pclusterID, discoveryClient, fromClient, toClient, PhysicalClusterToKcp, syncedResourceTypes, pclusterID)
+	return New(kcpClusterName, pclusterID, discoveryClient, fromClient, toClient, PhysicalClusterToKcp, syncedResourceTypes, syncedResources, pclusterID)
 }
 
 func (c *Controller) updateStatusInUpstream(ctx context.Context, gvr schema.GroupVersionResource, upstreamNamespace string, downstreamObj *unstructured.Unstructured) error {
+	if clusters := nscontroller.AssignedClusters(downstreamObj.GetLabels()); len(clusters) > 1 || downstreamObj.GetLabels()[nscontroller.ClusterLabel] != c.workloadClusterName {
+		// The object is placed on several clusters, the statuses of which are merged.
+		upstreamObj, err := c.updateStatusAnnotationInUpstream(ctx, gvr, upstreamNamespace, downstreamObj)
+		if err != nil {
+			return err
+		}
+		return c.updateMergedStatusInUpstream(ctx, gvr, upstreamObj, clusters)
+	}
+
 	upstreamObj := downstreamObj.DeepCopy()
 	upstreamObj.SetUID("")
 	upstreamObj.SetResourceVersion("")
@@ -82,6 +100,9 @@ func (c *Controller) updateStatusInUpstream(ctx context.Context, gvr schema.Grou
 
 	upstreamObj.SetResourceVersion(existing.GetResourceVersion())
 	if _, err := c.toClient.Resource(gvr).Namespace(upstreamNamespace).UpdateStatus(ctx, upstreamObj, metav1.UpdateOptions{}); err != nil {
+		if k8serrors.IsConflict(err) {
+			upsyncConflicts.WithLabelValues(c.metricLabelValues(gvr)...).Inc()
+		}
 		klog.Errorf("Failed updating status of resource %s|%s/%s from pcluster namespace %s: %v", c.upstreamClusterName, upstreamNamespace, upstreamObj.GetName(), downstreamObj.GetNamespace(), err)
 		return err
 	}
@@ -89,3 +110,126 @@ func (c *Controller) updateStatusInUpstream(ctx context.Context, gvr schema.Grou
 
 	return nil
 }
+
+// StatusAnnotationPrefix prefixes the annotations the status of an object placed on
+// several clusters is synced up to, for each of its clusters. The status of the object
+// is merged from them, see mergeStatuses. The status of an object placed on a single
+// cluster is synced up to the status of the object.
+const StatusAnnotationPrefix = "experimental.status.workloads.kcp.dev/"
+
+// updateStatusAnnotationInUpstream sets the status of the downstream object in the
+// status annotation of the workload cluster, on the upstream object, and returns the
+// updated upstream object.
+func (c *Controller) updateStatusAnnotationInUpstream(ctx context.Context, gvr schema.GroupVersionResource, upstreamNamespace string, downstreamObj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	status, found, err := unstructured.NestedFieldNoCopy(downstreamObj.Object, "status")
+	if err != nil {
+		return nil, err
+	}
+	var annotation interface{}
+	if found {
+		statusBytes, err := json.Marshal(status)
+		if err != nil {
+			return nil, err
+		}
+		annotation = string(statusBytes)
+	}
+	patchBytes, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				StatusAnnotationPrefix + c.workloadClusterName: annotation,
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	upstreamObj, err := c.toClient.Resource(gvr).Namespace(upstreamNamespace).Patch(ctx, downstreamObj.GetName(), types.MergePatchType, patchBytes, metav1.PatchOptions{})
+	if err != nil {
+		klog.Errorf("Failed updating status annotation of resource %s|%s/%s from pcluster namespace %s: %v", c.upstreamClusterName, upstreamNamespace, downstreamObj.GetName(), downstreamObj.GetNamespace(), err)
+		return nil, err
+	}
+	klog.Infof("Updated status annotation of resource %s|%s/%s from pcluster namespace %s", c.upstreamClusterName, upstreamNamespace, downstreamObj.GetName(), downstreamObj.GetNamespace())
+
+	return upstreamObj, nil
+}
+
+// updateMergedStatusInUpstream sets the status of the upstream object to the status
+// merged from the status annotations of the given clusters, the primary cluster first.
+// It is left as is until the primary cluster reported its status.
+func (c *Controller) updateMergedStatusInUpstream(ctx context.Context, gvr schema.GroupVersionResource, upstreamObj *unstructured.Unstructured, clusters []string) error {
+	var statuses []map[string]interface{}
+	for i, cluster := range clusters {
+		value, found := upstreamObj.GetAnnotations()[StatusAnnotationPrefix+cluster]
+		if !found {
+			if i == 0 {
+				return nil
+			}
+			continue
+		}
+		status := map[string]interface{}{}
+		if err := utiljson.Unmarshal([]byte(value), &status); err != nil {
+			klog.Errorf("Invalid status annotation of cluster %s on resource %s|%s/%s: %v", cluster, c.upstreamClusterName, upstreamObj.GetNamespace(), upstreamObj.GetName(), err)
+			if i == 0 {
+				return nil
+			}
+			continue
+		}
+		statuses = append(statuses, status)
+	}
+
+	merged := mergeStatuses(statuses)
+	if existing, _, _ := unstructured.NestedFieldNoCopy(upstreamObj.Object, "status"); equality.Semantic.DeepEqual(existing, merged) {
+		return nil
+	}
+	upstreamObj = upstreamObj.DeepCopy()
+	upstreamObj.Object["status"] = merged
+	if _, err := c.toClient.Resource(gvr).Namespace(upstreamObj.GetNamespace()).UpdateStatus(ctx, upstreamObj, metav1.UpdateOptions{}); err != nil {
+		if k8serrors.IsConflict(err) {
+			upsyncConflicts.WithLabelValues(c.metricLabelValues(gvr)...).Inc()
+		}
+		klog.Errorf("Failed updating merged status of resource %s|%s/%s: %v", c.upstreamClusterName, upstreamObj.GetNamespace(), upstreamObj.GetName(), err)
+		return err
+	}
+	klog.Infof("Updated merged status of resource %s|%s/%s from %d clusters", c.upstreamClusterName, upstreamObj.GetNamespace(), upstreamObj.GetName(), len(statuses))
+
+	return nil
+}
+
+// mergeStatuses merges the statuses of an object on its clusters, the primary cluster
+// first: the status of the primary cluster is taken over, except for the replica counts,
+// i.e. the top-level integer fields named replicas or ending with Replicas, which are
+// summed over all the clusters.
+func mergeStatuses(statuses []map[string]interface{}) map[string]interface{} {
+	merged := runtime.DeepCopyJSON(statuses[0])
+	for _, status := range statuses[1:] {
+		for key, value := range status {
+			if key != "replicas" && !strings.HasSuffix(key, "Replicas") {
+				continue
+			}
+			count, ok := value.(int64)
+			if !ok {
+				continue
+			}
+			switch current := merged[key].(type) {
+			case int64:
+				merged[key] = current + count
+			case nil:
+				merged[key] = count
+			}
+		}
+	}
+	return merged
+}
+
+// removeStatusAnnotations removes the status annotations of the additional clusters
+// of an object, which are not synced down.
+func removeStatusAnnotations(obj *unstructured.Unstructured) {
+	annotations := obj.GetAnnotations()
+	for key := range annotations {
+		if strings.HasPrefix(key, StatusAnnotationPrefix) {
+			delete(annotations, key)
+		}
+	}
+	obj.SetAnnotations(annotations)
+}
@@ -19,6 +19,8 @@ package syncer
 import (
 	"testing"
 
+	"github.com/stretchr/testify/require"
+
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
@@ -98,3 +100,29 @@ func TestDeepEqualStatus(t *testing.T) {
 		})
 	}
 }
+
+func TestMergeStatuses(t *testing.T) {
+	primary := map[string]interface{}{
+		"observedGeneration": int64(3),
+		"replicas":           int64(2),
+		"readyReplicas":      int64(2),
+		"conditions":         []interface{}{map[string]interface{}{"type": "Available", "status": "True"}},
+	}
+	additional := map[string]interface{}{
+		"observedGeneration":  int64(3),
+		"replicas":            int64(3),
+		"readyReplicas":       int64(1),
+		"unavailableReplicas": int64(2),
+		"conditions":          []interface{}{map[string]interface{}{"type": "Available", "status": "False"}},
+	}
+
+	require.Equal(t, map[string]interface{}{
+		"observedGeneration":  int64(3),
+		"replicas":            int64(5),
+		"readyReplicas":       int64(3),
+		"unavailableReplicas": int64(2),
+		"conditions":          []interface{}{map[string]interface{}{"type": "Available", "status": "True"}},
+	}, mergeStatuses([]map[string]interface{}{primary, additional}), "replica counts are summed, the rest is the status of the primary cluster")
+	require.Equal(t, int64(2), primary["replicas"], "statuses are not modified")
+	require.Equal(t, primary, mergeStatuses([]map[string]interface{}{primary}))
+}
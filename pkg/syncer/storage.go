@@ -0,0 +1,128 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+	kcpclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
+)
+
+var persistentVolumeClaimsGVR = schema.GroupVersionResource{Version: "v1", Resource: "persistentvolumeclaims"}
+
+// storageClassAnnotation is the deprecated way of requesting a StorageClass, still
+// honoured by Kubernetes.
+const storageClassAnnotation = "volume.beta.kubernetes.io/storage-class"
+
+// getStorageClasses returns the StorageClass mapping of the Locations the WorkloadCluster
+// belongs to. When several Locations map the same StorageClass, the first one by name wins.
+func getStorageClasses(ctx context.Context, upstream *rest.Config, kcpClusterName, workloadClusterName string) (map[string]string, error) {
+	kcpClusterClient, err := kcpclient.NewClusterForConfig(upstream)
+	if err != nil {
+		return nil, err
+	}
+	kcpClient := kcpClusterClient.Cluster(kcpClusterName)
+	cluster, err := kcpClient.WorkloadV1alpha1().WorkloadClusters().Get(ctx, workloadClusterName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get WorkloadCluster %s|%s: %w", kcpClusterName, workloadClusterName, err)
+	}
+	locations, err := kcpClient.WorkloadV1alpha1().Locations().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Locations of %s: %w", kcpClusterName, err)
+	}
+	return storageClassesFor(cluster, locations.Items), nil
+}
+
+func storageClassesFor(cluster *workloadv1alpha1.WorkloadCluster, locations []workloadv1alpha1.Location) map[string]string {
+	sort.Slice(locations, func(i, j int) bool { return locations[i].Name < locations[j].Name })
+
+	storageClasses := map[string]string{}
+	for _, location := range locations {
+		if location.Spec.InstanceSelector == nil || len(location.Spec.StorageClasses) == 0 {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(location.Spec.InstanceSelector)
+		if err != nil {
+			klog.Errorf("Invalid instance selector of Location %s|%s: %v", location.ClusterName, location.Name, err)
+			continue
+		}
+		if !selector.Matches(labels.Set(cluster.Labels)) {
+			continue
+		}
+		for from, to := range location.Spec.StorageClasses {
+			if _, found := storageClasses[from]; !found {
+				storageClasses[from] = to
+			}
+		}
+	}
+	return storageClasses
+}
+
+// translatePersistentVolumeClaim prepares a PersistentVolumeClaim to be bound on the
+// physical cluster: the binding made upstream, if any, is dropped, and the requested
+// StorageClass is mapped to the one of the physical cluster. The binding and capacity
+// are synced back up with the status.
+func translatePersistentVolumeClaim(gvr schema.GroupVersionResource, obj *unstructured.Unstructured, storageClasses map[string]string) {
+	if gvr != persistentVolumeClaimsGVR {
+		return
+	}
+
+	unstructured.RemoveNestedField(obj.Object, "spec", "volumeName")
+
+	annotations := obj.GetAnnotations()
+	for key := range annotations {
+		if strings.HasPrefix(key, "pv.kubernetes.io/") {
+			// e.g. pv.kubernetes.io/bind-completed
+			delete(annotations, key)
+		}
+	}
+	for _, key := range []string{
+		"volume.beta.kubernetes.io/storage-provisioner",
+		"volume.kubernetes.io/storage-provisioner",
+		"volume.kubernetes.io/selected-node",
+	} {
+		delete(annotations, key)
+	}
+	if storageClass, found := annotations[storageClassAnnotation]; found {
+		if mapped, found := storageClasses[storageClass]; found {
+			annotations[storageClassAnnotation] = mapped
+		}
+	}
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	obj.SetAnnotations(annotations)
+
+	storageClass, found, _ := unstructured.NestedString(obj.Object, "spec", "storageClassName")
+	if !found || storageClass == "" {
+		return
+	}
+	if mapped, found := storageClasses[storageClass]; found {
+		_ = unstructured.SetNestedField(obj.Object, mapped, "spec", "storageClassName")
+	}
+}
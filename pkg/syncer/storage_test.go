@@ -0,0 +1,80 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+)
+
+func TestStorageClassesFor(t *testing.T) {
+	cluster := &workloadv1alpha1.WorkloadCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "us-east1", Labels: map[string]string{"cloud": "aws"}},
+	}
+	location := func(name string, selector *metav1.LabelSelector, storageClasses map[string]string) workloadv1alpha1.Location {
+		return workloadv1alpha1.Location{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: workloadv1alpha1.LocationSpec{
+				InstanceSelector: selector,
+				StorageClasses:   storageClasses,
+			},
+		}
+	}
+
+	got := storageClassesFor(cluster, []workloadv1alpha1.Location{
+		location("gcp", &metav1.LabelSelector{MatchLabels: map[string]string{"cloud": "gcp"}}, map[string]string{"fast": "premium-rwo"}),
+		location("b-aws", &metav1.LabelSelector{MatchLabels: map[string]string{"cloud": "aws"}}, map[string]string{"fast": "io2", "slow": "sc1"}),
+		location("a-aws", &metav1.LabelSelector{MatchLabels: map[string]string{"cloud": "aws"}}, map[string]string{"fast": "gp3"}),
+		location("none", nil, map[string]string{"slow": "standard"}),
+	})
+	require.Equal(t, map[string]string{"fast": "gp3", "slow": "sc1"}, got)
+}
+
+func TestTranslatePersistentVolumeClaim(t *testing.T) {
+	pvc := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "PersistentVolumeClaim",
+		"metadata": map[string]interface{}{
+			"name":      "data",
+			"namespace": "kcp0123",
+			"annotations": map[string]interface{}{
+				"pv.kubernetes.io/bind-completed":          "yes",
+				"volume.kubernetes.io/storage-provisioner": "ebs.csi.aws.com",
+				"foo": "bar",
+			},
+		},
+		"spec": map[string]interface{}{
+			"storageClassName": "fast",
+			"volumeName":       "pvc-1234",
+			"accessModes":      []interface{}{"ReadWriteOnce"},
+		},
+	}}
+
+	translatePersistentVolumeClaim(persistentVolumeClaimsGVR, pvc, map[string]string{"fast": "gp3"})
+
+	require.Equal(t, map[string]string{"foo": "bar"}, pvc.GetAnnotations())
+	require.Equal(t, map[string]interface{}{
+		"storageClassName": "gp3",
+		"accessModes":      []interface{}{"ReadWriteOnce"},
+	}, pvc.Object["spec"])
+}
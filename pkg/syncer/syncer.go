@@ -23,8 +23,10 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -41,6 +43,8 @@ import (
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+	kcpclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
 	nscontroller "github.com/kcp-dev/kcp/pkg/reconciler/namespace"
 )
 
@@ -60,20 +64,50 @@ const KcpToPhysicalCluster Direction = "kcpToPhysicalCluster"
 const PhysicalClusterToKcp Direction = "physicalClusterToKcp"
 
 func StartSyncer(ctx context.Context, upstream, downstream *rest.Config, resources sets.String, kcpClusterName, pcluster string, numSyncerThreads int) error {
-	specSyncer, err := NewSpecSyncer(upstream, downstream, resources.List(), kcpClusterName, pcluster)
+	syncedResources, err := getSyncedResources(ctx, upstream, kcpClusterName, pcluster)
 	if err != nil {
 		return err
 	}
-	statusSyncer, err := NewStatusSyncer(downstream, upstream, resources.List(), kcpClusterName, pcluster)
+	storageClasses, err := getStorageClasses(ctx, upstream, kcpClusterName, pcluster)
 	if err != nil {
 		return err
 	}
+	specSyncer, err := NewSpecSyncer(upstream, downstream, resources.List(), syncedResources, storageClasses, kcpClusterName, pcluster)
+	if err != nil {
+		return err
+	}
+	statusSyncer, err := NewStatusSyncer(downstream, upstream, resources.List(), syncedResources, kcpClusterName, pcluster)
+	if err != nil {
+		return err
+	}
+	if err := startHeartbeat(ctx, upstream, kcpClusterName, pcluster); err != nil {
+		return err
+	}
+	if err := startTunnels(ctx, upstream, downstream, kcpClusterName, pcluster); err != nil {
+		return err
+	}
+	if err := startDNS(ctx, downstream, kcpClusterName, pcluster); err != nil {
+		return err
+	}
 	go specSyncer.Start(ctx, numSyncerThreads)
 	go statusSyncer.Start(ctx, numSyncerThreads)
 
 	return nil
 }
 
+// getSyncedResources returns the resources the WorkloadCluster allows to be synced.
+func getSyncedResources(ctx context.Context, upstream *rest.Config, kcpClusterName, workloadClusterName string) (*workloadv1alpha1.SyncedResources, error) {
+	kcpClusterClient, err := kcpclient.NewClusterForConfig(upstream)
+	if err != nil {
+		return nil, err
+	}
+	cluster, err := kcpClusterClient.Cluster(kcpClusterName).WorkloadV1alpha1().WorkloadClusters().Get(ctx, workloadClusterName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get WorkloadCluster %s|%s: %w", kcpClusterName, workloadClusterName, err)
+	}
+	return cluster.Spec.SyncedResources, nil
+}
+
 type UpsertFunc func(ctx context.Context, gvr schema.GroupVersionResource, namespace string, unstrob *unstructured.Unstructured) error
 type DeleteFunc func(ctx context.Context, gvr schema.GroupVersionResource, namespace, name string) error
 type HandlersProvider func(c *Controller, gvr schema.GroupVersionResource) cache.ResourceEventHandlerFuncs
@@ -83,6 +117,7 @@ type Controller struct {
 	queue workqueue.RateLimitingInterface
 
 	fromInformers dynamicinformer.DynamicSharedInformerFactory
+	fromClient    dynamic.Interface
 	toClient      dynamic.Interface
 
 	upsertFn  UpsertFunc
@@ -90,22 +125,35 @@ type Controller struct {
 	direction Direction
 
 	upstreamClusterName string
+	workloadClusterName string
 	syncerNamespace     string
+
+	// storageClasses maps the StorageClasses of synced PersistentVolumeClaims to the
+	// ones of the physical cluster.
+	storageClasses map[string]string
+
+	// pending holds the keys waiting in the queue, for the queue depth metric.
+	pendingLock sync.Mutex
+	pending     map[holder]struct{}
 }
 
 // New returns a new syncer Controller syncing spec from "from" to "to".
-func New(kcpClusterName, pcluster string, fromDiscovery discovery.DiscoveryInterface, fromClient, toClient dynamic.Interface, direction Direction, syncedResourceTypes []string, pclusterID string) (*Controller, error) {
+func New(kcpClusterName, pcluster string, fromDiscovery discovery.DiscoveryInterface, fromClient, toClient dynamic.Interface, direction Direction, syncedResourceTypes []string, syncedResources *workloadv1alpha1.SyncedResources, pclusterID string) (*Controller, error) {
 	controllerName := string(direction) + "-" + kcpClusterName + "-" + pcluster
 	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "kcp-"+controllerName)
 
 	c := Controller{
 		name:                controllerName,
 		queue:               queue,
+		fromClient:          fromClient,
 		toClient:            toClient,
 		direction:           direction,
 		upstreamClusterName: kcpClusterName,
+		workloadClusterName: pcluster,
 		syncerNamespace:     os.Getenv(SyncerNamespaceKey),
+		pending:             map[holder]struct{}{},
 	}
+	RegisterMetrics()
 
 	if direction == KcpToPhysicalCluster {
 		c.upsertFn = c.applyToDownstream
@@ -115,7 +163,7 @@ func New(kcpClusterName, pcluster string, fromDiscovery discovery.DiscoveryInter
 	}
 
 	fromInformers := dynamicinformer.NewFilteredDynamicSharedInformerFactory(fromClient, resyncPeriod, metav1.NamespaceAll, func(o *metav1.ListOptions) {
-		o.LabelSelector = fmt.Sprintf("%s=%s", nscontroller.ClusterLabel, pclusterID)
+		o.LabelSelector = nscontroller.ClusterLabelFor(pclusterID)
 	})
 
 	// Get all types the upstream API server knows about.
@@ -126,6 +174,10 @@ func New(kcpClusterName, pcluster string, fromDiscovery discovery.DiscoveryInter
 	}
 	for _, gvrstr := range gvrstrs {
 		gvr, _ := schema.ParseResourceArg(gvrstr)
+		if !(gvr.Group == "" && gvr.Resource == "namespaces") && !syncedResources.Allows(*gvr) {
+			klog.InfoS("Not syncing resource denied by the WorkloadCluster", "direction", c.direction, "clusterName", kcpClusterName, "pcluster", pcluster, "gvr", gvr)
+			continue
+		}
 
 		fromInformers.ForResource(*gvr).Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 			AddFunc: func(obj interface{}) { c.AddToQueue(*gvr, obj) },
@@ -252,14 +304,14 @@ func (c *Controller) AddToQueue(gvr schema.GroupVersionResource, obj interface{}
 
 	klog.Infof("Syncer %s: adding %s %s|%s/%s to queue", c.name, gvr, metaObj.GetClusterName(), metaObj.GetNamespace(), metaObj.GetName())
 
-	c.queue.Add(
-		holder{
-			gvr:         gvr,
-			clusterName: metaObj.GetClusterName(),
-			namespace:   metaObj.GetNamespace(),
-			name:        metaObj.GetName(),
-		},
-	)
+	h := holder{
+		gvr:         gvr,
+		clusterName: metaObj.GetClusterName(),
+		namespace:   metaObj.GetNamespace(),
+		name:        metaObj.GetName(),
+	}
+	c.markPending(h)
+	c.queue.Add(h)
 }
 
 // Start starts N worker processes processing work items.
@@ -297,12 +349,16 @@ func (c *Controller) processNextWorkItem(ctx context.Context) bool {
 	// other workers.
 	defer c.queue.Done(key)
 
+	c.markProcessing(h)
 	if err := c.process(ctx, h); err != nil {
 		runtime.HandleError(fmt.Errorf("syncer %q failed to sync %q, err: %w", c.name, key, err))
+		syncErrors.WithLabelValues(c.metricLabelValues(h.gvr)...).Inc()
+		c.markPending(h)
 		c.queue.AddRateLimited(key)
 		return true
 	}
 
+	lastSuccessfulSync.WithLabelValues(c.metricLabelValues(h.gvr)...).SetToCurrentTime()
 	c.queue.Forget(key)
 
 	return true
@@ -425,9 +481,40 @@ func (c *Controller) process(ctx context.Context, h holder) error {
 		return fmt.Errorf("%s: object to synchronize is expected to be Unstructured, but is %T", c.name, obj)
 	}
 
+	if c.direction == KcpToPhysicalCluster {
+		if evictAt, evicted := evictionTime(unstrob, c.workloadClusterName); evicted {
+			if remaining := time.Until(evictAt); remaining > 0 {
+				// Keep the object running until it is running on the clusters it is
+				// rescheduled to, and check back at the end of the grace period.
+				c.queue.AddAfter(h, remaining)
+			} else {
+				klog.InfoS("Evicting object", "gvr", h.gvr, "clusterName", h.clusterName, "namespace", fromNamespace, "name", h.name)
+				if err := c.deleteFn(ctx, h.gvr, toNamespace, h.name); err != nil && !k8serrors.IsNotFound(err) {
+					return err
+				}
+				return nil
+			}
+		}
+	}
+
 	if c.upsertFn != nil {
 		return c.upsertFn(ctx, h.gvr, toNamespace, unstrob)
 	}
 
 	return err
 }
+
+// evictionTime returns the time at which the given object is evicted from the
+// given workload cluster, if it is being evicted from it.
+func evictionTime(obj metav1.Object, workloadClusterName string) (time.Time, bool) {
+	value, found := obj.GetAnnotations()[nscontroller.EvictionAnnotationPrefix+workloadClusterName]
+	if !found {
+		return time.Time{}, false
+	}
+	evictAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		klog.Errorf("Invalid eviction time %q for object %s|%s/%s: %v", value, obj.GetClusterName(), obj.GetNamespace(), obj.GetName(), err)
+		return time.Time{}, false
+	}
+	return evictAt, true
+}
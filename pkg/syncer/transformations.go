@@ -0,0 +1,99 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// SpecDiffAnnotationPrefix is the prefix of the annotations holding the JSON patches
+// (RFC 6902) applied to a resource when it is synced to a given workload cluster.
+// The annotation name is the prefix followed by the name of the WorkloadCluster,
+// e.g. "experimental.spec-diff.workloads.kcp.dev/us-east1".
+const SpecDiffAnnotationPrefix = "experimental.spec-diff.workloads.kcp.dev/"
+
+// applySpecDiff applies the JSON patch declared for the given workload cluster, if any,
+// to the downstream object. The spec-diff annotations of all workload clusters are
+// removed from the object. The patch may only touch the spec: the metadata, e.g. the
+// name, namespace, labels and annotations the syncer and the physical cluster rely on,
+// and the status are refused.
+func applySpecDiff(downstreamObj *unstructured.Unstructured, workloadClusterName string) (*unstructured.Unstructured, error) {
+	annotations := downstreamObj.GetAnnotations()
+	patch, found := annotations[SpecDiffAnnotationPrefix+workloadClusterName]
+	for key := range annotations {
+		if strings.HasPrefix(key, SpecDiffAnnotationPrefix) {
+			delete(annotations, key)
+		}
+	}
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	downstreamObj.SetAnnotations(annotations)
+
+	if !found {
+		return downstreamObj, nil
+	}
+
+	decoded, err := jsonpatch.DecodePatch([]byte(patch))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s%s annotation: %w", SpecDiffAnnotationPrefix, workloadClusterName, err)
+	}
+	for _, op := range decoded {
+		paths := []string{}
+		if path, err := op.Path(); err == nil {
+			paths = append(paths, path)
+		}
+		if op.Kind() == "move" || op.Kind() == "copy" {
+			if from, err := op.From(); err == nil {
+				paths = append(paths, from)
+			}
+		}
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("invalid %s%s annotation: %s operation without path", SpecDiffAnnotationPrefix, workloadClusterName, op.Kind())
+		}
+		for _, path := range paths {
+			if !isSpecPath(path) {
+				return nil, fmt.Errorf("%s%s annotation must only patch /spec, not %q", SpecDiffAnnotationPrefix, workloadClusterName, path)
+			}
+		}
+	}
+	data, err := json.Marshal(downstreamObj)
+	if err != nil {
+		return nil, err
+	}
+	patched, err := decoded.Apply(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply %s%s annotation: %w", SpecDiffAnnotationPrefix, workloadClusterName, err)
+	}
+
+	result := &unstructured.Unstructured{}
+	if err := json.Unmarshal(patched, &result.Object); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// isSpecPath returns true if the given JSON pointer is the spec or below it.
+func isSpecPath(path string) bool {
+	return path == "/spec" || strings.HasPrefix(path, "/spec/")
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestApplySpecDiff(t *testing.T) {
+	deployment := func(annotations map[string]interface{}, image string) *unstructured.Unstructured {
+		metadata := map[string]interface{}{
+			"name":      "web",
+			"namespace": "kcp0123",
+		}
+		if annotations != nil {
+			metadata["annotations"] = annotations
+		}
+		return &unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"apiVersion": "apps/v1",
+				"kind":       "Deployment",
+				"metadata":   metadata,
+				"spec": map[string]interface{}{
+					"image": image,
+				},
+			},
+		}
+	}
+
+	for _, c := range []struct {
+		desc    string
+		obj     *unstructured.Unstructured
+		want    *unstructured.Unstructured
+		wantErr bool
+	}{{
+		desc: "no spec-diff",
+		obj:  deployment(map[string]interface{}{"foo": "bar"}, "nginx"),
+		want: deployment(map[string]interface{}{"foo": "bar"}, "nginx"),
+	}, {
+		desc: "spec-diff for this cluster",
+		obj: deployment(map[string]interface{}{
+			SpecDiffAnnotationPrefix + "us-east1": `[{"op": "replace", "path": "/spec/image", "value": "registry.us-east1/nginx"}]`,
+		}, "nginx"),
+		want: deployment(nil, "registry.us-east1/nginx"),
+	}, {
+		desc: "spec-diff for another cluster",
+		obj: deployment(map[string]interface{}{
+			"foo":                                 "bar",
+			SpecDiffAnnotationPrefix + "eu-west1": `[{"op": "replace", "path": "/spec/image", "value": "registry.eu-west1/nginx"}]`,
+		}, "nginx"),
+		want: deployment(map[string]interface{}{"foo": "bar"}, "nginx"),
+	}, {
+		desc: "invalid patch",
+		obj: deployment(map[string]interface{}{
+			SpecDiffAnnotationPrefix + "us-east1": `{"op": "replace"}`,
+		}, "nginx"),
+		wantErr: true,
+	}, {
+		desc: "patch renaming the object",
+		obj: deployment(map[string]interface{}{
+			SpecDiffAnnotationPrefix + "us-east1": `[{"op": "replace", "path": "/metadata/name", "value": "other"}]`,
+		}, "nginx"),
+		wantErr: true,
+	}, {
+		desc: "patch adding a label",
+		obj: deployment(map[string]interface{}{
+			SpecDiffAnnotationPrefix + "us-east1": `[{"op": "add", "path": "/metadata/labels", "value": {"kcp.dev/cluster": "other"}}]`,
+		}, "nginx"),
+		wantErr: true,
+	}, {
+		desc: "patch adding an annotation",
+		obj: deployment(map[string]interface{}{
+			SpecDiffAnnotationPrefix + "us-east1": `[{"op": "add", "path": "/metadata/annotations/foo", "value": "bar"}]`,
+		}, "nginx"),
+		wantErr: true,
+	}, {
+		desc: "patch of the status",
+		obj: deployment(map[string]interface{}{
+			SpecDiffAnnotationPrefix + "us-east1": `[{"op": "add", "path": "/status", "value": {}}]`,
+		}, "nginx"),
+		wantErr: true,
+	}, {
+		desc: "patch of a field prefixed with spec",
+		obj: deployment(map[string]interface{}{
+			SpecDiffAnnotationPrefix + "us-east1": `[{"op": "add", "path": "/specification", "value": {}}]`,
+		}, "nginx"),
+		wantErr: true,
+	}, {
+		desc: "patch copying the metadata into the spec",
+		obj: deployment(map[string]interface{}{
+			SpecDiffAnnotationPrefix + "us-east1": `[{"op": "copy", "from": "/metadata/annotations", "path": "/spec/annotations"}]`,
+		}, "nginx"),
+		wantErr: true,
+	}, {
+		desc: "patch copying within the spec",
+		obj: deployment(map[string]interface{}{
+			SpecDiffAnnotationPrefix + "us-east1": `[{"op": "copy", "from": "/spec/image", "path": "/spec/previousImage"}, {"op": "replace", "path": "/spec/image", "value": "registry.us-east1/nginx"}]`,
+		}, "nginx"),
+		want: func() *unstructured.Unstructured {
+			obj := deployment(nil, "registry.us-east1/nginx")
+			obj.Object["spec"].(map[string]interface{})["previousImage"] = "nginx"
+			return obj
+		}(),
+	}} {
+		t.Run(c.desc, func(t *testing.T) {
+			got, err := applySpecDiff(c.obj, "us-east1")
+			if (err != nil) != c.wantErr {
+				t.Fatalf("got error %v, want error %t", err, c.wantErr)
+			}
+			if c.wantErr {
+				return
+			}
+			if diff := cmp.Diff(c.want, got); diff != "" {
+				t.Errorf("unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDownstreamObjectSpecDiff(t *testing.T) {
+	// the spec-diff tries to open the policy to the namespaces of all tenants
+	policy := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "networking.k8s.io/v1",
+		"kind":       "NetworkPolicy",
+		"metadata": map[string]interface{}{
+			"name":        "allow-frontend",
+			"namespace":   "default",
+			"clusterName": "root:acme",
+			"annotations": map[string]interface{}{
+				SpecDiffAnnotationPrefix + "us-east1": `[{"op": "replace", "path": "/spec/ingress/0/from/0/namespaceSelector", "value": {}}]`,
+			},
+		},
+		"spec": map[string]interface{}{
+			"podSelector": map[string]interface{}{},
+			"ingress": []interface{}{
+				map[string]interface{}{"from": []interface{}{
+					map[string]interface{}{"namespaceSelector": map[string]interface{}{"matchLabels": map[string]interface{}{namespaceNameLabel: "frontend"}}},
+				}},
+			},
+		},
+	}}
+
+	c := &Controller{workloadClusterName: "us-east1"}
+	got, err := c.downstreamObject(networkPoliciesGVR, "kcp0123", policy)
+	require.NoError(t, err)
+
+	require.Empty(t, got.GetAnnotations())
+	ingress, _, _ := unstructured.NestedSlice(got.Object, "spec", "ingress")
+	require.Equal(t, []interface{}{
+		map[string]interface{}{"namespaceSelector": map[string]interface{}{"matchLabels": map[string]interface{}{
+			LogicalClusterLabel: logicalClusterLabelValue("root:acme"),
+		}}},
+	}, ingress[0].(map[string]interface{})["from"])
+}
@@ -0,0 +1,231 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	"github.com/kcp-dev/kcp/pkg/apis/workload"
+)
+
+const (
+	// TunnelSubresource is the subresource of WorkloadClusters the syncer opens reverse
+	// tunnels on. kcp sends the pod log, exec, attach and port-forward requests of the
+	// workload cluster through these tunnels.
+	TunnelSubresource = "tunnel"
+
+	// TunnelUpgradeProtocol is the protocol the tunnel requests upgrade their connection to.
+	TunnelUpgradeProtocol = "kcp-syncer-tunnel"
+
+	tunnelAgent = "kcp#syncer-tunnel/v0.0.0"
+
+	// idleTunnels is the number of tunnels kept open waiting for a request. Every tunnel
+	// carries a single request; a new one is opened as soon as an idle tunnel gets used.
+	idleTunnels = 2
+)
+
+// startTunnels keeps idle reverse tunnels open from the syncer to kcp, and serves the
+// requests received through them by proxying them to the physical cluster.
+func startTunnels(ctx context.Context, upstream, downstream *rest.Config, kcpClusterName, workloadClusterName string) error {
+	upstream = rest.CopyConfig(upstream)
+	upstream.UserAgent = tunnelAgent
+
+	upstreamURL, err := url.Parse(upstream.Host)
+	if err != nil {
+		return err
+	}
+	tunnelURL := *upstreamURL
+	tunnelURL.Path = fmt.Sprintf("/clusters/%s/apis/%s/v1alpha1/workloadclusters/%s/%s", kcpClusterName, workload.GroupName, workloadClusterName, TunnelSubresource)
+	upstreamRoundTripper, err := http1RoundTripperFor(upstream)
+	if err != nil {
+		return err
+	}
+
+	downstreamURL, err := url.Parse(downstream.Host)
+	if err != nil {
+		return err
+	}
+	downstreamRoundTripper, err := http1RoundTripperFor(downstream)
+	if err != nil {
+		return err
+	}
+	proxy := httputil.NewSingleHostReverseProxy(downstreamURL)
+	proxy.Transport = downstreamRoundTripper
+	proxy.FlushInterval = -1
+
+	used := make(chan struct{})
+	openTunnel := func() {
+		wait.UntilWithContext(ctx, func(ctx context.Context) {
+			conn, err := dialTunnel(ctx, upstreamRoundTripper, tunnelURL.String())
+			if err != nil {
+				klog.Errorf("failed to open tunnel to WorkloadCluster %s|%s: %v", kcpClusterName, workloadClusterName, err)
+				return
+			}
+			serveTunnel(conn, proxy, func() {
+				select {
+				case used <- struct{}{}:
+				case <-ctx.Done():
+				}
+			})
+		}, time.Second)
+	}
+	for i := 0; i < idleTunnels; i++ {
+		go openTunnel()
+	}
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-used:
+				go openTunnel()
+			}
+		}
+	}()
+
+	return nil
+}
+
+// http1RoundTripperFor returns a round tripper for the config that does not negotiate
+// HTTP/2, which does not support connection upgrades.
+func http1RoundTripperFor(config *rest.Config) (http.RoundTripper, error) {
+	tlsConfig, err := rest.TLSConfigFor(config)
+	if err != nil {
+		return nil, err
+	}
+	return rest.HTTPWrappersForConfig(config, &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: tlsConfig,
+	})
+}
+
+// dialTunnel opens a tunnel by upgrading a request to the tunnel subresource.
+func dialTunnel(ctx context.Context, roundTripper http.RoundTripper, tunnelURL string) (net.Conn, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tunnelURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", TunnelUpgradeProtocol)
+
+	resp, err := roundTripper.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("unexpected response %s: %s", resp.Status, body)
+	}
+	rwc, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		resp.Body.Close()
+		return nil, fmt.Errorf("upgraded response body is not writable")
+	}
+	return &tunnelConn{ReadWriteCloser: rwc}, nil
+}
+
+// serveTunnel serves the request kcp sends through the tunnel with the given handler,
+// and returns when the tunnel is closed. onUse is called when the request starts.
+func serveTunnel(conn net.Conn, handler http.Handler, onUse func()) {
+	listener := &tunnelListener{conn: conn, closed: make(chan struct{})}
+	conn.(*tunnelConn).onFirstRead = onUse
+	conn.(*tunnelConn).onClose = listener.close
+	server := &http.Server{Handler: handler}
+	server.Serve(listener) // nolint:errcheck
+}
+
+// tunnelConn is a net.Conn over the upgraded connection of a tunnel.
+type tunnelConn struct {
+	io.ReadWriteCloser
+
+	once        sync.Once
+	onFirstRead func()
+	onClose     func()
+}
+
+func (c *tunnelConn) Read(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Read(p)
+	if n > 0 && c.onFirstRead != nil {
+		c.once.Do(c.onFirstRead)
+	}
+	return n, err
+}
+
+func (c *tunnelConn) Close() error {
+	if c.onClose != nil {
+		c.onClose()
+	}
+	return c.ReadWriteCloser.Close()
+}
+
+func (c *tunnelConn) LocalAddr() net.Addr                { return tunnelAddr{} }
+func (c *tunnelConn) RemoteAddr() net.Addr               { return tunnelAddr{} }
+func (c *tunnelConn) SetDeadline(t time.Time) error      { return nil }
+func (c *tunnelConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *tunnelConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type tunnelAddr struct{}
+
+func (tunnelAddr) Network() string { return "tunnel" }
+func (tunnelAddr) String() string  { return "kcp" }
+
+// tunnelListener accepts the single connection of a tunnel, then blocks until it is closed.
+type tunnelListener struct {
+	lock     sync.Mutex
+	conn     net.Conn
+	accepted bool
+	closed   chan struct{}
+	once     sync.Once
+}
+
+func (l *tunnelListener) Accept() (net.Conn, error) {
+	l.lock.Lock()
+	if !l.accepted {
+		l.accepted = true
+		l.lock.Unlock()
+		return l.conn, nil
+	}
+	l.lock.Unlock()
+
+	<-l.closed
+	return nil, io.EOF
+}
+
+func (l *tunnelListener) close() {
+	l.once.Do(func() { close(l.closed) })
+}
+
+func (l *tunnelListener) Close() error {
+	l.close()
+	return nil
+}
+
+func (l *tunnelListener) Addr() net.Addr { return tunnelAddr{} }
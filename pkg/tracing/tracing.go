@@ -0,0 +1,128 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tracing adds kcp specific attributes and spans to the OpenTelemetry traces
+// of requests, which are enabled with the APIServerTracing feature gate and exported
+// over OTLP as configured with --tracing-config-file.
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"k8s.io/apiserver/pkg/admission"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+
+	"github.com/kcp-dev/kcp/pkg/authorization"
+)
+
+const (
+	// LogicalClusterAttributeKey is the span attribute holding the logical cluster of a request.
+	LogicalClusterAttributeKey = attribute.Key("kcp.logical_cluster")
+	// WorkspacePathAttributeKey is the span attribute holding the workspace path of a request.
+	WorkspacePathAttributeKey = attribute.Key("kcp.workspace_path")
+	// AdmissionPluginAttributeKey is the span attribute holding the name of an admission plugin.
+	AdmissionPluginAttributeKey = attribute.Key("kcp.admission.plugin")
+)
+
+// WithWorkspaceAttributes adds the logical cluster and the workspace path of requests
+// as attributes of the span of the request. It must be run inside of the tracing
+// filter of the handler chain, and after the logical cluster is set in the context.
+func WithWorkspaceAttributes(handler http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		span := trace.SpanFromContext(req.Context())
+		if span.IsRecording() {
+			span.SetAttributes(workspaceAttributes(genericapirequest.ClusterFrom(req.Context()))...)
+		}
+		handler.ServeHTTP(w, req)
+	}
+}
+
+func workspaceAttributes(cluster *genericapirequest.Cluster) []attribute.KeyValue {
+	switch {
+	case cluster == nil:
+		return nil
+	case cluster.Wildcard:
+		return []attribute.KeyValue{LogicalClusterAttributeKey.String("*")}
+	default:
+		return []attribute.KeyValue{
+			LogicalClusterAttributeKey.String(cluster.Name),
+			WorkspacePathAttributeKey.String(authorization.WorkspacePath(cluster.Name)),
+		}
+	}
+}
+
+// WithAdmissionTracing is an admission decorator recording a span for every call of
+// the admission plugin with the given name, as child of the span of the request.
+func WithAdmissionTracing(i admission.Interface, name string) admission.Interface {
+	return &pluginHandlerWithTracing{
+		Interface: i,
+		name:      name,
+	}
+}
+
+// pluginHandlerWithTracing decorates an admission handler with tracing.
+type pluginHandlerWithTracing struct {
+	admission.Interface
+	name string
+}
+
+// Admit performs a mutating admission control check in a span.
+func (p *pluginHandlerWithTracing) Admit(ctx context.Context, a admission.Attributes, o admission.ObjectInterfaces) error {
+	mutatingHandler, ok := p.Interface.(admission.MutationInterface)
+	if !ok {
+		return nil
+	}
+
+	ctx, span := p.startSpan(ctx, "admit", a)
+	defer span.End()
+	return endSpan(span, mutatingHandler.Admit(ctx, a, o))
+}
+
+// Validate performs a non-mutating admission control check in a span.
+func (p *pluginHandlerWithTracing) Validate(ctx context.Context, a admission.Attributes, o admission.ObjectInterfaces) error {
+	validatingHandler, ok := p.Interface.(admission.ValidationInterface)
+	if !ok {
+		return nil
+	}
+
+	ctx, span := p.startSpan(ctx, "validate", a)
+	defer span.End()
+	return endSpan(span, validatingHandler.Validate(ctx, a, o))
+}
+
+// startSpan starts a span with the tracer of the span of the request, so that no span
+// is recorded when the request is not traced.
+func (p *pluginHandlerWithTracing) startSpan(ctx context.Context, step string, a admission.Attributes) (context.Context, trace.Span) {
+	return trace.SpanFromContext(ctx).Tracer().Start(ctx, "Admission "+p.name+" "+step, trace.WithAttributes(
+		AdmissionPluginAttributeKey.String(p.name),
+		attribute.String("kcp.admission.step", step),
+		attribute.String("kcp.admission.operation", string(a.GetOperation())),
+		attribute.String("kcp.admission.resource", a.GetResource().GroupResource().String()),
+	))
+}
+
+func endSpan(span trace.Span, err error) error {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
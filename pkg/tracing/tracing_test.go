@@ -0,0 +1,80 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/oteltest"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/admission"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+)
+
+type fakePlugin struct {
+	*admission.Handler
+	err error
+}
+
+func (p *fakePlugin) Validate(ctx context.Context, a admission.Attributes, o admission.ObjectInterfaces) error {
+	return p.err
+}
+
+func TestWithWorkspaceAttributes(t *testing.T) {
+	sr := new(oteltest.SpanRecorder)
+	ctx, span := oteltest.NewTracerProvider(oteltest.WithSpanRecorder(sr)).Tracer("test").Start(context.Background(), "request")
+	ctx = genericapirequest.WithCluster(ctx, genericapirequest.Cluster{Name: "acme:team"})
+
+	handler := WithWorkspaceAttributes(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/namespaces", nil).WithContext(ctx)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	span.End()
+
+	require.Len(t, sr.Completed(), 1)
+	attrs := sr.Completed()[0].Attributes()
+	require.Equal(t, attribute.StringValue("acme:team"), attrs[LogicalClusterAttributeKey])
+	require.Equal(t, attribute.StringValue("root:acme:team"), attrs[WorkspacePathAttributeKey])
+}
+
+func TestWithAdmissionTracing(t *testing.T) {
+	sr := new(oteltest.SpanRecorder)
+	ctx, span := oteltest.NewTracerProvider(oteltest.WithSpanRecorder(sr)).Tracer("test").Start(context.Background(), "request")
+	defer span.End()
+
+	attr := admission.NewAttributesRecord(nil, nil, schema.GroupVersionKind{}, "default", "foo", schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}, "", admission.Create, nil, false, nil)
+	plugin := WithAdmissionTracing(&fakePlugin{Handler: admission.NewHandler(admission.Create), err: errors.New("denied")}, "FakePlugin")
+
+	// the plugin is not mutating, so no span is recorded for admit
+	require.NoError(t, plugin.(admission.MutationInterface).Admit(ctx, attr, nil))
+	require.Error(t, plugin.(admission.ValidationInterface).Validate(ctx, attr, nil))
+
+	require.Len(t, sr.Completed(), 1)
+	got := sr.Completed()[0]
+	require.Equal(t, "Admission FakePlugin validate", got.Name())
+	require.Equal(t, span.SpanContext().SpanID(), got.ParentSpanID())
+	require.Equal(t, attribute.StringValue("FakePlugin"), got.Attributes()[AdmissionPluginAttributeKey])
+	require.Equal(t, attribute.StringValue("configmaps"), got.Attributes()["kcp.admission.resource"])
+	require.Equal(t, codes.Error, got.StatusCode())
+}
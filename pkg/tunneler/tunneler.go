@@ -0,0 +1,292 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunneler
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/endpoints/handlers/responsewriters"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/clusters"
+	"k8s.io/klog/v2"
+
+	"github.com/kcp-dev/kcp/pkg/apis/workload"
+	"github.com/kcp-dev/kcp/pkg/reconciler/namespace"
+	"github.com/kcp-dev/kcp/pkg/syncer"
+)
+
+// podSubresources are the pod subresources served by the physical cluster, through the
+// tunnels opened by the syncer of the WorkloadCluster the namespace is scheduled on.
+var podSubresources = sets.NewString("log", "exec", "attach", "portforward")
+
+// tunnelWaitTimeout is how long a request waits for a tunnel to become available.
+const tunnelWaitTimeout = 10 * time.Second
+
+var (
+	errorScheme = runtime.NewScheme()
+	errorCodecs = serializer.NewCodecFactory(errorScheme)
+)
+
+func init() {
+	errorScheme.AddUnversionedTypes(metav1.Unversioned,
+		&metav1.Status{},
+	)
+}
+
+type tunnelKey struct {
+	clusterName         string
+	workloadClusterName string
+}
+
+// Tunneler keeps the idle tunnels opened by syncers, and serves pod logs, exec, attach and
+// port-forward requests through them.
+type Tunneler struct {
+	namespaceLister corelisters.NamespaceLister
+
+	lock    sync.Mutex
+	tunnels map[tunnelKey]chan net.Conn
+}
+
+// NewTunneler returns a Tunneler finding the WorkloadCluster of a pod through the
+// scheduling label of its namespace.
+func NewTunneler(namespaceLister corelisters.NamespaceLister) *Tunneler {
+	return &Tunneler{
+		namespaceLister: namespaceLister,
+		tunnels:         map[tunnelKey]chan net.Conn{},
+	}
+}
+
+// IsTunnelRequest returns true if the request opens a tunnel from a syncer. These
+// requests are long running.
+func IsTunnelRequest(requestInfo *genericapirequest.RequestInfo) bool {
+	return requestInfo != nil && requestInfo.IsResourceRequest &&
+		requestInfo.APIGroup == workload.GroupName &&
+		requestInfo.Resource == "workloadclusters" &&
+		requestInfo.Subresource == syncer.TunnelSubresource &&
+		requestInfo.Verb == "get"
+}
+
+func isPodSubresourceRequest(requestInfo *genericapirequest.RequestInfo) bool {
+	return requestInfo != nil && requestInfo.IsResourceRequest &&
+		requestInfo.APIGroup == "" &&
+		requestInfo.Resource == "pods" &&
+		requestInfo.Namespace != "" &&
+		requestInfo.Name != "" &&
+		podSubresources.Has(requestInfo.Subresource)
+}
+
+// WithTunnels accepts the tunnels opened by syncers, and proxies the pod subresource
+// requests of scheduled namespaces to their physical cluster. Every other request is
+// passed to apiHandler. It expects authenticated and authorized requests.
+func (t *Tunneler) WithTunnels(apiHandler http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		requestInfo, _ := genericapirequest.RequestInfoFrom(req.Context())
+		cluster := genericapirequest.ClusterFrom(req.Context())
+		if cluster == nil || cluster.Wildcard {
+			apiHandler.ServeHTTP(w, req)
+			return
+		}
+
+		switch {
+		case IsTunnelRequest(requestInfo):
+			t.acceptTunnel(w, req, tunnelKey{clusterName: cluster.Name, workloadClusterName: requestInfo.Name})
+		case isPodSubresourceRequest(requestInfo):
+			t.proxyPodSubresource(w, req, cluster.Name, requestInfo)
+		default:
+			apiHandler.ServeHTTP(w, req)
+		}
+	}
+}
+
+func (t *Tunneler) acceptTunnel(w http.ResponseWriter, req *http.Request, key tunnelKey) {
+	if !strings.EqualFold(req.Header.Get("Upgrade"), syncer.TunnelUpgradeProtocol) {
+		responsewriters.ErrorNegotiated(
+			apierrors.NewBadRequest(fmt.Sprintf("tunnel requests must upgrade to %q", syncer.TunnelUpgradeProtocol)),
+			errorCodecs, schema.GroupVersion{}, w, req,
+		)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		responsewriters.ErrorNegotiated(
+			apierrors.NewInternalError(errors.New("connection does not support hijacking")),
+			errorCodecs, schema.GroupVersion{}, w, req,
+		)
+		return
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		klog.Errorf("failed to hijack tunnel connection of WorkloadCluster %s|%s: %v", key.clusterName, key.workloadClusterName, err)
+		return
+	}
+	if _, err := fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: %s\r\n\r\n", syncer.TunnelUpgradeProtocol); err != nil {
+		conn.Close()
+		return
+	}
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return
+	}
+	if rw.Reader.Buffered() > 0 {
+		conn = &bufferedConn{Conn: conn, reader: rw.Reader}
+	}
+
+	klog.V(4).Infof("accepted tunnel from WorkloadCluster %s|%s", key.clusterName, key.workloadClusterName)
+	select {
+	case t.poolFor(key) <- conn:
+	case <-time.After(tunnelWaitTimeout):
+		// the pool is full of idle tunnels, the syncer will open a new one when needed.
+		conn.Close()
+	}
+}
+
+func (t *Tunneler) poolFor(key tunnelKey) chan net.Conn {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	pool, ok := t.tunnels[key]
+	if !ok {
+		pool = make(chan net.Conn, 4)
+		t.tunnels[key] = pool
+	}
+	return pool
+}
+
+func (t *Tunneler) proxyPodSubresource(w http.ResponseWriter, req *http.Request, clusterName string, requestInfo *genericapirequest.RequestInfo) {
+	gv := schema.GroupVersion{Version: requestInfo.APIVersion}
+
+	ns, err := t.namespaceLister.Get(clusters.ToClusterAwareKey(clusterName, requestInfo.Namespace))
+	if apierrors.IsNotFound(err) {
+		responsewriters.ErrorNegotiated(apierrors.NewNotFound(schema.GroupResource{Resource: "namespaces"}, requestInfo.Namespace), errorCodecs, gv, w, req)
+		return
+	} else if err != nil {
+		responsewriters.ErrorNegotiated(apierrors.NewInternalError(err), errorCodecs, gv, w, req)
+		return
+	}
+	workloadClusterName := ns.Labels[namespace.ClusterLabel]
+	if workloadClusterName == "" {
+		responsewriters.ErrorNegotiated(
+			apierrors.NewServiceUnavailable(fmt.Sprintf("namespace %q is not scheduled on a WorkloadCluster", requestInfo.Namespace)),
+			errorCodecs, gv, w, req,
+		)
+		return
+	}
+	downstreamNamespace, err := syncer.PhysicalClusterNamespaceName(syncer.NamespaceLocator{
+		LogicalCluster: clusterName,
+		Namespace:      requestInfo.Namespace,
+	})
+	if err != nil {
+		responsewriters.ErrorNegotiated(apierrors.NewInternalError(err), errorCodecs, gv, w, req)
+		return
+	}
+
+	conn, err := t.takeTunnel(req.Context(), tunnelKey{clusterName: clusterName, workloadClusterName: workloadClusterName})
+	if err != nil {
+		responsewriters.ErrorNegotiated(
+			apierrors.NewServiceUnavailable(fmt.Sprintf("no tunnel available to WorkloadCluster %q: %v", workloadClusterName, err)),
+			errorCodecs, gv, w, req,
+		)
+		return
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			rewriteRequest(req, downstreamNamespace, requestInfo)
+		},
+		Transport: &http.Transport{
+			DialContext: oneShotDialer(conn),
+		},
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			responsewriters.ErrorNegotiated(apierrors.NewServiceUnavailable(err.Error()), errorCodecs, gv, w, req)
+		},
+	}
+	defer conn.Close()
+	proxy.ServeHTTP(w, req)
+}
+
+// takeTunnel returns an idle tunnel of the given WorkloadCluster, waiting for one
+// to be opened if none is available.
+func (t *Tunneler) takeTunnel(ctx context.Context, key tunnelKey) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, tunnelWaitTimeout)
+	defer cancel()
+
+	select {
+	case conn := <-t.poolFor(key):
+		return conn, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// rewriteRequest targets the request at the pod in the namespace of the physical
+// cluster, and removes the credentials of the kcp user. The request is authenticated
+// downstream with the credentials of the syncer.
+func rewriteRequest(req *http.Request, downstreamNamespace string, requestInfo *genericapirequest.RequestInfo) {
+	req.URL.Scheme = "http"
+	req.URL.Host = "tunnel"
+	req.URL.Path = fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/%s", downstreamNamespace, requestInfo.Name, requestInfo.Subresource)
+	req.URL.RawPath = ""
+	req.Host = ""
+
+	req.Header.Del("Authorization")
+	for name := range req.Header {
+		if strings.HasPrefix(http.CanonicalHeaderKey(name), "Impersonate-") {
+			req.Header.Del(name)
+		}
+	}
+	req.Header.Del("X-Kubernetes-Cluster")
+}
+
+// oneShotDialer returns a dialer returning the given connection once.
+func oneShotDialer(conn net.Conn) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	var once sync.Once
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		var dialed net.Conn
+		once.Do(func() { dialed = conn })
+		if dialed == nil {
+			return nil, errors.New("tunnel already used")
+		}
+		return dialed, nil
+	}
+}
+
+// bufferedConn reads the bytes buffered while hijacking the connection first.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tunneler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+)
+
+func TestRewriteRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "https://kcp/api/v1/namespaces/default/pods/web/exec?command=ls&stdout=true", nil)
+	req.Header.Set("Authorization", "Bearer user-token")
+	req.Header.Set("Impersonate-User", "admin")
+	req.Header.Set("Impersonate-Group", "system:masters")
+	req.Header.Set("X-Kubernetes-Cluster", "root:acme")
+	req.Header.Set("X-Stream-Protocol-Version", "v4.channel.k8s.io")
+
+	rewriteRequest(req, "kcp0123", &genericapirequest.RequestInfo{
+		IsResourceRequest: true,
+		Verb:              "create",
+		APIVersion:        "v1",
+		Namespace:         "default",
+		Resource:          "pods",
+		Subresource:       "exec",
+		Name:              "web",
+	})
+
+	require.Equal(t, "/api/v1/namespaces/kcp0123/pods/web/exec", req.URL.Path)
+	require.Equal(t, "command=ls&stdout=true", req.URL.RawQuery)
+	require.Empty(t, req.Header.Get("Authorization"))
+	require.Empty(t, req.Header.Get("Impersonate-User"))
+	require.Empty(t, req.Header.Get("Impersonate-Group"))
+	require.Empty(t, req.Header.Get("X-Kubernetes-Cluster"))
+	require.Equal(t, "v4.channel.k8s.io", req.Header.Get("X-Stream-Protocol-Version"))
+}
+
+func TestIsPodSubresourceRequest(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		requestInfo *genericapirequest.RequestInfo
+		want        bool
+	}{
+		{name: "log", requestInfo: &genericapirequest.RequestInfo{IsResourceRequest: true, Namespace: "ns", Resource: "pods", Name: "web", Subresource: "log"}, want: true},
+		{name: "portforward", requestInfo: &genericapirequest.RequestInfo{IsResourceRequest: true, Namespace: "ns", Resource: "pods", Name: "web", Subresource: "portforward"}, want: true},
+		{name: "status", requestInfo: &genericapirequest.RequestInfo{IsResourceRequest: true, Namespace: "ns", Resource: "pods", Name: "web", Subresource: "status"}},
+		{name: "pod", requestInfo: &genericapirequest.RequestInfo{IsResourceRequest: true, Namespace: "ns", Resource: "pods", Name: "web"}},
+		{name: "other group", requestInfo: &genericapirequest.RequestInfo{IsResourceRequest: true, APIGroup: "example.io", Namespace: "ns", Resource: "pods", Name: "web", Subresource: "log"}},
+		{name: "no request info"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, isPodSubresourceRequest(tt.requestInfo))
+		})
+	}
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiexport
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+
+	apislisters "github.com/kcp-dev/kcp/pkg/client/listers/apis/v1alpha1"
+)
+
+// NewPermissionClaimAuthorizer returns an authorizer deciding whether the owner of the APIExport
+// found in the request context may access a resource in the logical cluster of the request
+// context. Access is allowed to the resources bound to the APIExport, and to the resources
+// claimed by the APIExport whose claim is accepted by the APIBinding of the logical cluster.
+// Non-resource requests are allowed in every logical cluster bound to the APIExport.
+func NewPermissionClaimAuthorizer(apiExportLister apislisters.APIExportLister, bindings *Bindings) authorizer.Authorizer {
+	return &PermissionClaimAuthorizer{
+		apiExportLister: apiExportLister,
+		bindings:        bindings,
+	}
+}
+
+type PermissionClaimAuthorizer struct {
+	apiExportLister apislisters.APIExportLister
+	bindings        *Bindings
+}
+
+func (a *PermissionClaimAuthorizer) Authorize(ctx context.Context, attr authorizer.Attributes) (authorizer.Decision, string, error) {
+	ref, ok := APIExportFrom(ctx)
+	if !ok {
+		return authorizer.DecisionNoOpinion, "", nil
+	}
+	cluster := genericapirequest.ClusterFrom(ctx)
+	if cluster == nil || cluster.Name == "" {
+		return authorizer.DecisionNoOpinion, "", nil
+	}
+
+	export, err := a.apiExportLister.Get(ref.Key())
+	if apierrors.IsNotFound(err) {
+		return authorizer.DecisionDeny, fmt.Sprintf("APIExport %s|%s does not exist", ref.ClusterName, ref.Name), nil
+	} else if err != nil {
+		return authorizer.DecisionNoOpinion, "", err
+	}
+	bindings, err := a.bindings.BoundTo(ref)
+	if err != nil {
+		return authorizer.DecisionNoOpinion, "", err
+	}
+
+	var gr *schema.GroupResource
+	if attr.IsResourceRequest() {
+		gr = &schema.GroupResource{Group: attr.GetAPIGroup(), Resource: attr.GetResource()}
+	}
+	if !accessibleClusters(export, bindings, ref, gr).Has(cluster.Name) {
+		return authorizer.DecisionDeny, "neither bound nor an accepted permission claim of the APIExport", nil
+	}
+	return authorizer.DecisionAllow, "", nil
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiexport
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"k8s.io/client-go/tools/cache"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+	apishelper "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1/helper"
+	apisinformers "github.com/kcp-dev/kcp/pkg/client/informers/externalversions/apis/v1alpha1"
+)
+
+const byBoundAPIExport = "apiexport-virtual-workspace-by-bound-apiexport"
+
+// Bindings returns the APIBindings bound to an APIExport from an index of the APIBinding
+// informer, and tells the watches of the virtual workspace when the APIBindings change,
+// such that they resolve the accessible logical clusters again.
+type Bindings struct {
+	indexer cache.Indexer
+
+	lock    sync.Mutex
+	changed chan struct{}
+}
+
+// NewBindings returns Bindings indexing the APIBindings of the given informer. It must be
+// called before the informer is started.
+func NewBindings(apiBindingInformer apisinformers.APIBindingInformer) (*Bindings, error) {
+	if _, found := apiBindingInformer.Informer().GetIndexer().GetIndexers()[byBoundAPIExport]; !found {
+		if err := apiBindingInformer.Informer().AddIndexers(cache.Indexers{byBoundAPIExport: indexByBoundAPIExport}); err != nil {
+			return nil, err
+		}
+	}
+	b := &Bindings{
+		indexer: apiBindingInformer.Informer().GetIndexer(),
+		changed: make(chan struct{}),
+	}
+	apiBindingInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(interface{}) { b.notify() },
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			old, ok := oldObj.(*apisv1alpha1.APIBinding)
+			if !ok {
+				return
+			}
+			binding, ok := newObj.(*apisv1alpha1.APIBinding)
+			if !ok {
+				return
+			}
+			if !reflect.DeepEqual(old.Spec.AcceptedPermissionClaims, binding.Spec.AcceptedPermissionClaims) ||
+				!reflect.DeepEqual(old.Status.BoundAPIExport, binding.Status.BoundAPIExport) ||
+				!reflect.DeepEqual(old.Status.BoundResources, binding.Status.BoundResources) {
+				b.notify()
+			}
+		},
+		DeleteFunc: func(interface{}) { b.notify() },
+	})
+	return b, nil
+}
+
+// BoundTo returns the APIBindings bound to the given APIExport.
+func (b *Bindings) BoundTo(ref APIExportRef) ([]*apisv1alpha1.APIBinding, error) {
+	objs, err := b.indexer.ByIndex(byBoundAPIExport, ref.Key())
+	if err != nil {
+		return nil, err
+	}
+	bindings := make([]*apisv1alpha1.APIBinding, 0, len(objs))
+	for _, obj := range objs {
+		bindings = append(bindings, obj.(*apisv1alpha1.APIBinding))
+	}
+	return bindings, nil
+}
+
+// Changed returns a channel closed on the next change of the APIBindings.
+func (b *Bindings) Changed() <-chan struct{} {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.changed
+}
+
+func (b *Bindings) notify() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+func indexByBoundAPIExport(obj interface{}) ([]string, error) {
+	binding, ok := obj.(*apisv1alpha1.APIBinding)
+	if !ok {
+		return []string{}, fmt.Errorf("obj is supposed to be an APIBinding, but is %T", obj)
+	}
+	if binding.Status.BoundAPIExport == nil {
+		return []string{}, nil
+	}
+	clusterName, exportName, ok := apishelper.ExportClusterName(binding.ClusterName, *binding.Status.BoundAPIExport)
+	if !ok {
+		return []string{}, nil
+	}
+	return []string{APIExportRef{ClusterName: clusterName, Name: exportName}.Key()}, nil
+}
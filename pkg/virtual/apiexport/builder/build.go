@@ -0,0 +1,77 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package builder
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	genericapiserver "k8s.io/apiserver/pkg/server"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	apisinformers "github.com/kcp-dev/kcp/pkg/client/informers/externalversions/apis/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/virtual/apiexport"
+	"github.com/kcp-dev/kcp/pkg/virtual/framework"
+	"github.com/kcp-dev/kcp/pkg/virtual/framework/handler"
+)
+
+const APIExportVirtualWorkspaceName string = "apiexport"
+const DefaultRootPathPrefix string = "/services/apiexport"
+
+// BuildVirtualWorkspace builds the APIExport virtual workspace, served at
+// <rootPathPrefix>/<logical-cluster>/<apiexport-name>, where the logical cluster
+// is the one the APIExport object lives in.
+func BuildVirtualWorkspace(rootPathPrefix string, kcpConfig *rest.Config, kubeClusterClient *kubernetes.Cluster, dynamicClusterClient dynamic.ClusterInterface, apiExports apisinformers.APIExportInformer, apiBindings apisinformers.APIBindingInformer) framework.VirtualWorkspace {
+	if !strings.HasSuffix(rootPathPrefix, "/") {
+		rootPathPrefix += "/"
+	}
+	// the APIBinding informer is indexed before it is started
+	bindings, bindingsErr := apiexport.NewBindings(apiBindings)
+	return &handler.HandlerVirtualWorkspace{
+		Name: APIExportVirtualWorkspaceName,
+		Ready: func() error {
+			if !apiExports.Informer().HasSynced() || !apiBindings.Informer().HasSynced() {
+				return errors.New("APIExport and APIBinding informers are not synced")
+			}
+			return nil
+		},
+		RootPathResolver: func(urlPath string, requestContext context.Context) (accepted bool, prefixToStrip string, completedContext context.Context) {
+			completedContext = requestContext
+			if path := urlPath; strings.HasPrefix(path, rootPathPrefix) {
+				path = strings.TrimPrefix(path, rootPathPrefix)
+				segments := strings.SplitN(path, "/", 3)
+				if len(segments) < 2 || segments[0] == "" || segments[1] == "" {
+					return
+				}
+				ref := apiexport.APIExportRef{ClusterName: segments[0], Name: segments[1]}
+
+				return true, rootPathPrefix + strings.Join(segments[:2], "/"), apiexport.WithAPIExport(requestContext, ref)
+			}
+			return
+		},
+		HandlerFactory: func(rootAPIServerConfig genericapiserver.CompletedConfig) (http.Handler, error) {
+			if bindingsErr != nil {
+				return nil, bindingsErr
+			}
+			return apiexport.NewProxy(kcpConfig, kubeClusterClient, dynamicClusterClient, apiExports.Lister(), bindings)
+		},
+	}
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiexport
+
+import (
+	"context"
+
+	"k8s.io/client-go/tools/clusters"
+)
+
+type apiExportKeyType string
+
+const apiExportKey apiExportKeyType = "APIExportVirtualWorkspaceAPIExport"
+
+// APIExportRef identifies the APIExport a request is served for.
+type APIExportRef struct {
+	// ClusterName is the logical cluster the APIExport object lives in.
+	ClusterName string
+	// Name is the name of the APIExport object.
+	Name string
+}
+
+// Key returns the cluster-aware key of the APIExport object, as used in listers.
+func (r APIExportRef) Key() string {
+	return clusters.ToClusterAwareKey(r.ClusterName, r.Name)
+}
+
+// WithAPIExport returns a copy of the context with the given APIExport.
+func WithAPIExport(ctx context.Context, ref APIExportRef) context.Context {
+	return context.WithValue(ctx, apiExportKey, ref)
+}
+
+// APIExportFrom returns the APIExport stored in the context, if any.
+func APIExportFrom(ctx context.Context) (APIExportRef, bool) {
+	ref, ok := ctx.Value(apiExportKey).(APIExportRef)
+	return ref, ok
+}
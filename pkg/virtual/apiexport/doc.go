@@ -0,0 +1,21 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package apiexport implements the APIExport virtual workspace, which gives the
+// owner of an APIExport access to the instances of the exported resources across
+// all the workspaces bound to the APIExport, so that a service provider can run a
+// single controller instead of one per consumer workspace.
+package apiexport
@@ -0,0 +1,491 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiexport
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/handlers/responsewriters"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	kcpadmissionhelpers "github.com/kcp-dev/kcp/pkg/admission/helpers"
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+	apishelper "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1/helper"
+	apislisters "github.com/kcp-dev/kcp/pkg/client/listers/apis/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/virtual/framework/handler"
+)
+
+// ContentSubresource is the subresource of APIExports a user must be granted
+// access to, with the verb of the request, to use the APIExport virtual workspace.
+const ContentSubresource = "content"
+
+// Proxy serves the requests of the owner of an APIExport, restricted to the resources
+// bound through APIBindings to the APIExport found in the request context or claimed by
+// the APIExport with a claim accepted by the APIBindings, and to the workspaces of these
+// APIBindings:
+//   - lists and watches without a /clusters/<logical-cluster> prefix are served across
+//     all the bound workspaces,
+//   - any other list, watch, get, update or patch (including of the status subresource)
+//     must be prefixed with the /clusters/<logical-cluster> of a bound workspace.
+type Proxy struct {
+	forwarder *handler.Forwarder
+
+	kubeClusterClient    *kubernetes.Cluster
+	dynamicClusterClient dynamic.ClusterInterface
+	apiExportLister      apislisters.APIExportLister
+	bindings             *Bindings
+	createAuthorizer     kcpadmissionhelpers.AdmissionAuthorizerFactory
+	claimAuthorizer      authorizer.Authorizer
+
+	requestInfoFactory *genericapirequest.RequestInfoFactory
+}
+
+// NewProxy returns a Proxy forwarding requests to kcp with the given config, which
+// must allow wildcard access to the exported resources.
+func NewProxy(kcpConfig *rest.Config, kubeClusterClient *kubernetes.Cluster, dynamicClusterClient dynamic.ClusterInterface, apiExportLister apislisters.APIExportLister, bindings *Bindings) (*Proxy, error) {
+	forwarder, err := handler.NewForwarder(kcpConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Proxy{
+		forwarder:            forwarder,
+		kubeClusterClient:    kubeClusterClient,
+		dynamicClusterClient: dynamicClusterClient,
+		apiExportLister:      apiExportLister,
+		bindings:             bindings,
+		createAuthorizer:     kcpadmissionhelpers.NewAdmissionAuthorizer,
+		claimAuthorizer:      NewPermissionClaimAuthorizer(apiExportLister, bindings),
+		requestInfoFactory:   handler.NewRequestInfoFactory(),
+	}, nil
+}
+
+var _ http.Handler = &Proxy{}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	ref, ok := APIExportFrom(ctx)
+	if !ok {
+		responsewriters.InternalError(w, req, errors.New("no APIExport in request context"))
+		return
+	}
+	export, err := p.apiExportLister.Get(ref.Key())
+	if err != nil {
+		handler.WriteError(w, req, err)
+		return
+	}
+
+	clusterName, path := handler.SplitClusterPath(req.URL.Path)
+	if clusterName == "*" {
+		clusterName = ""
+	}
+	infoReq := req.Clone(ctx)
+	infoReq.URL.Path = path
+	info, err := p.requestInfoFactory.NewRequestInfo(infoReq)
+	if err != nil {
+		handler.WriteError(w, req, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+
+	u, ok := genericapirequest.UserFrom(ctx)
+	if !ok {
+		handler.WriteError(w, req, apierrors.NewUnauthorized("no user in request context"))
+		return
+	}
+	if err := p.authorize(ctx, u, ref, info.Verb); err != nil {
+		handler.WriteError(w, req, err)
+		return
+	}
+
+	if !info.IsResourceRequest {
+		// discovery is only served in the bound workspaces
+		if clusterName == "" || !p.claimAllowed(ctx, u, clusterName, info) {
+			handler.WriteError(w, req, apierrors.NewNotFound(schema.GroupResource{}, path))
+			return
+		}
+		p.forwarder.Forward(w, req, clusterName, path, nil)
+		return
+	}
+
+	gr := schema.GroupResource{Group: info.APIGroup, Resource: info.Resource}
+	switch info.Verb {
+	case "list", "watch", "get", "update", "patch":
+	default:
+		handler.WriteError(w, req, apierrors.NewMethodNotSupported(gr, info.Verb))
+		return
+	}
+
+	if clusterName != "" {
+		if !p.claimAllowed(ctx, u, clusterName, info) {
+			handler.WriteError(w, req, apierrors.NewNotFound(gr, info.Name))
+			return
+		}
+		p.forwarder.Forward(w, req, clusterName, path, nil)
+		return
+	}
+
+	gvr := gr.WithVersion(info.APIVersion)
+	switch info.Verb {
+	case "list":
+		p.list(w, req, export, ref, gvr, info.Namespace)
+	case "watch":
+		p.watch(w, req, export, ref, gvr, info.Namespace)
+	default:
+		handler.WriteError(w, req, apierrors.NewBadRequest("requests for a single object must be prefixed with /clusters/<logical-cluster> of the object"))
+	}
+}
+
+// authorize checks that the user is allowed to access the content of the APIExport with the given verb.
+func (p *Proxy) authorize(ctx context.Context, u user.Info, ref APIExportRef, verb string) error {
+	authz, err := p.createAuthorizer(ref.ClusterName, p.kubeClusterClient)
+	if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+	attr := authorizer.AttributesRecord{
+		User:            u,
+		Verb:            verb,
+		APIGroup:        apisv1alpha1.SchemeGroupVersion.Group,
+		APIVersion:      apisv1alpha1.SchemeGroupVersion.Version,
+		Resource:        "apiexports",
+		Subresource:     ContentSubresource,
+		Name:            ref.Name,
+		ResourceRequest: true,
+	}
+	decision, reason, err := authz.Authorize(ctx, attr)
+	if err != nil {
+		return apierrors.NewInternalError(fmt.Errorf("unable to determine access to APIExport content: %w", err))
+	}
+	if decision != authorizer.DecisionAllow {
+		return apierrors.NewForbidden(apisv1alpha1.Resource("apiexports"), ref.Name, fmt.Errorf("missing verb=%q permission on apiexports/%s: %s", verb, ContentSubresource, reason))
+	}
+	return nil
+}
+
+// claimAllowed returns whether the request may be forwarded to the given logical cluster,
+// as decided by the permission claim authorizer.
+func (p *Proxy) claimAllowed(ctx context.Context, u user.Info, clusterName string, info *genericapirequest.RequestInfo) bool {
+	attr := authorizer.AttributesRecord{
+		User:            u,
+		Verb:            info.Verb,
+		Namespace:       info.Namespace,
+		APIGroup:        info.APIGroup,
+		APIVersion:      info.APIVersion,
+		Resource:        info.Resource,
+		Subresource:     info.Subresource,
+		Name:            info.Name,
+		ResourceRequest: info.IsResourceRequest,
+		Path:            info.Path,
+	}
+	decision, _, err := p.claimAuthorizer.Authorize(genericapirequest.WithCluster(ctx, genericapirequest.Cluster{Name: clusterName}), attr)
+	return err == nil && decision == authorizer.DecisionAllow
+}
+
+// accessibleClusters returns the logical clusters the owner of the APIExport may access
+// through the APIExport virtual workspace.
+func (p *Proxy) accessibleClusters(export *apisv1alpha1.APIExport, ref APIExportRef, gr *schema.GroupResource) (sets.String, error) {
+	bindings, err := p.bindings.BoundTo(ref)
+	if err != nil {
+		return nil, apierrors.NewInternalError(err)
+	}
+	return accessibleClusters(export, bindings, ref, gr), nil
+}
+
+// accessibleClusters returns the logical clusters with an APIBinding bound to the APIExport,
+// restricted, when the given resource is not nil, to the bindings either binding the resource,
+// or accepting a permission claim of the APIExport on the resource.
+func accessibleClusters(export *apisv1alpha1.APIExport, bindings []*apisv1alpha1.APIBinding, ref APIExportRef, gr *schema.GroupResource) sets.String {
+	clusters := sets.NewString()
+	for _, binding := range bindings {
+		if !isBoundTo(binding, ref) || !presentsIdentity(binding, export) {
+			continue
+		}
+		if gr == nil || bindsResource(binding, *gr) || acceptsClaim(export, binding, *gr) {
+			clusters.Insert(binding.ClusterName)
+		}
+	}
+	return clusters
+}
+
+// presentsIdentity returns whether the binding, bound to the APIExport, presents its current identity hash,
+// so that a provider cannot read the data of the bindings of another provider exporting the same resources.
+func presentsIdentity(binding *apisv1alpha1.APIBinding, export *apisv1alpha1.APIExport) bool {
+	return export.Status.IdentityHash == "" || apishelper.IdentityHash(*binding.Status.BoundAPIExport) == export.Status.IdentityHash
+}
+
+func bindsResource(binding *apisv1alpha1.APIBinding, gr schema.GroupResource) bool {
+	for _, resource := range binding.Status.BoundResources {
+		if resource.Group == gr.Group && resource.Resource == gr.Resource {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsClaim returns whether the APIExport claims the given resource, and the binding accepts that claim.
+func acceptsClaim(export *apisv1alpha1.APIExport, binding *apisv1alpha1.APIBinding, gr schema.GroupResource) bool {
+	return hasClaim(export.Spec.PermissionClaims, gr) && hasClaim(binding.Spec.AcceptedPermissionClaims, gr)
+}
+
+func hasClaim(claims []apisv1alpha1.PermissionClaim, gr schema.GroupResource) bool {
+	for _, claim := range claims {
+		if claim.Group == gr.Group && claim.Resource == gr.Resource {
+			return true
+		}
+	}
+	return false
+}
+
+// isBoundTo returns whether the binding is bound to the given APIExport. The bound
+// APIExport lives either in a workspace of the organization of the binding, or in the
+// root workspace.
+func isBoundTo(binding *apisv1alpha1.APIBinding, ref APIExportRef) bool {
+	if binding.Status.BoundAPIExport == nil {
+		return false
+	}
+	clusterName, exportName, ok := apishelper.ExportClusterName(binding.ClusterName, *binding.Status.BoundAPIExport)
+	return ok && clusterName == ref.ClusterName && exportName == ref.Name
+}
+
+// wildcardResource returns the resource to list and watch across all logical clusters,
+// suffixed with the identity hash of the APIExport when it exports the resource, such that
+// only the objects of the bindings presenting that identity hash are returned, and whether
+// it is suffixed.
+func wildcardResource(export *apisv1alpha1.APIExport, gvr schema.GroupVersionResource) (schema.GroupVersionResource, bool) {
+	if export.Status.IdentityHash == "" {
+		return gvr, false
+	}
+	suffix := apishelper.APIResourceSchemaName("", gvr.Group, gvr.Resource)
+	for _, name := range export.Spec.LatestResourceSchemas {
+		if strings.HasSuffix(name, suffix) {
+			gvr.Resource += ":" + export.Status.IdentityHash
+			return gvr, true
+		}
+	}
+	return gvr, false
+}
+
+// claimedListContinue is the continue token of the lists across workspaces of the resources
+// not restricted by identity hash, e.g. claimed ones, which are listed workspace by workspace.
+type claimedListContinue struct {
+	// Cluster is the logical cluster the next page starts in.
+	Cluster string `json:"cluster"`
+	// Continue is the continue token of the list of Cluster, if any.
+	Continue string `json:"continue,omitempty"`
+	// ResourceVersion is the resource version all the logical clusters are listed at.
+	ResourceVersion string `json:"resourceVersion"`
+}
+
+func encodeClaimedListContinue(c claimedListContinue) string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeClaimedListContinue(token string) (claimedListContinue, error) {
+	var c claimedListContinue
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return c, apierrors.NewBadRequest(fmt.Sprintf("invalid continue token: %v", err))
+	}
+	if err := json.Unmarshal(raw, &c); err != nil || c.Cluster == "" || c.ResourceVersion == "" {
+		return c, apierrors.NewBadRequest("invalid continue token")
+	}
+	return c, nil
+}
+
+func (p *Proxy) list(w http.ResponseWriter, req *http.Request, export *apisv1alpha1.APIExport, ref APIExportRef, gvr schema.GroupVersionResource, namespace string) {
+	var opts metav1.ListOptions
+	if err := metav1.ParameterCodec.DecodeParameters(req.URL.Query(), metav1.SchemeGroupVersion, &opts); err != nil {
+		handler.WriteError(w, req, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+
+	// Lists of exported resources are restricted by identity hash by the storage, which pages
+	// them. Other resources, e.g. claimed ones, are listed in the accessible workspaces only.
+	resource, restricted := wildcardResource(export, gvr)
+	var list *unstructured.UnstructuredList
+	var err error
+	if restricted {
+		list, err = p.dynamicClusterClient.Cluster("*").Resource(resource).Namespace(namespace).List(req.Context(), opts)
+	} else {
+		var clusters sets.String
+		if clusters, err = p.accessibleClusters(export, ref, &schema.GroupResource{Group: gvr.Group, Resource: gvr.Resource}); err == nil {
+			list, err = p.listClusters(req.Context(), clusters.List(), gvr, namespace, opts)
+		}
+	}
+	if err != nil {
+		handler.WriteError(w, req, err)
+		return
+	}
+
+	responsewriters.WriteRawJSON(http.StatusOK, list, w)
+}
+
+// listClusters lists the resource in the given sorted logical clusters one after the other, at
+// the resource version of the first list, filling the pages up to the limit of the options.
+func (p *Proxy) listClusters(ctx context.Context, clusters []string, gvr schema.GroupVersionResource, namespace string, opts metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	var start claimedListContinue
+	if opts.Continue != "" {
+		var err error
+		if start, err = decodeClaimedListContinue(opts.Continue); err != nil {
+			return nil, err
+		}
+	}
+
+	var result *unstructured.UnstructuredList
+	resourceVersion := start.ResourceVersion
+	for i, cluster := range clusters {
+		if cluster < start.Cluster {
+			continue
+		}
+
+		clusterOpts := opts
+		clusterOpts.Continue = ""
+		switch {
+		case cluster == start.Cluster && start.Continue != "":
+			clusterOpts.Continue = start.Continue
+			clusterOpts.ResourceVersion, clusterOpts.ResourceVersionMatch = "", ""
+		case resourceVersion != "":
+			clusterOpts.ResourceVersion, clusterOpts.ResourceVersionMatch = resourceVersion, metav1.ResourceVersionMatchExact
+		}
+		if opts.Limit > 0 && result != nil {
+			clusterOpts.Limit = opts.Limit - int64(len(result.Items))
+		}
+
+		list, err := p.dynamicClusterClient.Cluster(cluster).Resource(gvr).Namespace(namespace).List(ctx, clusterOpts)
+		if err != nil {
+			return nil, err
+		}
+		if result == nil {
+			result = list
+			resourceVersion = list.GetResourceVersion()
+		} else {
+			result.Items = append(result.Items, list.Items...)
+		}
+
+		if c := list.GetContinue(); c != "" {
+			result.SetContinue(encodeClaimedListContinue(claimedListContinue{Cluster: cluster, Continue: c, ResourceVersion: resourceVersion}))
+			break
+		}
+		result.SetContinue("")
+		if opts.Limit > 0 && int64(len(result.Items)) >= opts.Limit && i+1 < len(clusters) {
+			result.SetContinue(encodeClaimedListContinue(claimedListContinue{Cluster: clusters[i+1], ResourceVersion: resourceVersion}))
+			break
+		}
+	}
+
+	if result == nil {
+		// no logical cluster is accessible, the kind of the list is taken from an empty page
+		// of the list across all logical clusters
+		opts.Continue, opts.Limit = "", 1
+		list, err := p.dynamicClusterClient.Cluster("*").Resource(gvr).Namespace(namespace).List(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		list.Items = []unstructured.Unstructured{}
+		list.SetContinue("")
+		list.SetRemainingItemCount(nil)
+		return list, nil
+	}
+	result.SetResourceVersion(resourceVersion)
+	result.SetRemainingItemCount(nil)
+	return result, nil
+}
+
+func (p *Proxy) watch(w http.ResponseWriter, req *http.Request, export *apisv1alpha1.APIExport, ref APIExportRef, gvr schema.GroupVersionResource, namespace string) {
+	var opts metav1.ListOptions
+	if err := metav1.ParameterCodec.DecodeParameters(req.URL.Query(), metav1.SchemeGroupVersion, &opts); err != nil {
+		handler.WriteError(w, req, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+	opts.Watch = true
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		handler.WriteError(w, req, apierrors.NewInternalError(errors.New("unable to start watch - can't get http.Flusher")))
+		return
+	}
+
+	// The accessible logical clusters are resolved again when the APIBindings change.
+	gr := schema.GroupResource{Group: gvr.Group, Resource: gvr.Resource}
+	changed := p.bindings.Changed()
+	clusters, err := p.accessibleClusters(export, ref, &gr)
+	if err != nil {
+		handler.WriteError(w, req, err)
+		return
+	}
+
+	resource, _ := wildcardResource(export, gvr)
+	watcher, err := p.dynamicClusterClient.Cluster("*").Resource(resource).Namespace(namespace).Watch(req.Context(), opts)
+	if err != nil {
+		handler.WriteError(w, req, err)
+		return
+	}
+	defer watcher.Stop()
+
+	w.Header().Set("Content-Type", runtime.ContentTypeJSON)
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	encoder := json.NewEncoder(w)
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-changed:
+			changed = p.bindings.Changed()
+			if clusters, err = p.accessibleClusters(export, ref, &gr); err != nil {
+				return
+			}
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return
+			}
+			if obj, isUnstructured := event.Object.(*unstructured.Unstructured); isUnstructured && event.Type != watch.Bookmark {
+				if !clusters.Has(obj.GetClusterName()) {
+					continue
+				}
+			}
+			raw, err := json.Marshal(event.Object)
+			if err != nil {
+				return
+			}
+			if err := encoder.Encode(&metav1.WatchEvent{Type: string(event.Type), Object: runtime.RawExtension{Raw: raw}}); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
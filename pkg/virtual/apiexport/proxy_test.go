@@ -0,0 +1,231 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiexport
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+)
+
+func newBinding(clusterName, exportWorkspace, exportName string, resources ...string) *apisv1alpha1.APIBinding {
+	binding := &apisv1alpha1.APIBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: exportName, ClusterName: clusterName},
+	}
+	if exportWorkspace != "" {
+		binding.Status.BoundAPIExport = &apisv1alpha1.ExportReference{
+			Workspace: &apisv1alpha1.WorkspaceExportReference{WorkspaceName: exportWorkspace, ExportName: exportName},
+		}
+	}
+	for _, resource := range resources {
+		binding.Status.BoundResources = append(binding.Status.BoundResources, apisv1alpha1.BoundAPIResource{Group: "example.io", Resource: resource})
+	}
+	return binding
+}
+
+func TestAccessibleClusters(t *testing.T) {
+	accepting := newBinding("acme:accepting", "provider", "widgets")
+	accepting.Spec.AcceptedPermissionClaims = []apisv1alpha1.PermissionClaim{{Resource: "configmaps"}, {Resource: "secrets"}}
+	bindings := []*apisv1alpha1.APIBinding{
+		newBinding("acme:consumer1", "provider", "widgets", "widgets"),
+		newBinding("acme:consumer2", "provider", "widgets", "widgets", "gadgets"),
+		newBinding("acme:consumer3", "provider", "widgets", "gadgets"),
+		newBinding("acme:unbound", "", "widgets"),
+		newBinding("acme:other", "other", "widgets", "widgets"),
+		newBinding("other:consumer", "provider", "widgets", "widgets"),
+		accepting,
+	}
+	ref := APIExportRef{ClusterName: "acme:provider", Name: "widgets"}
+	export := &apisv1alpha1.APIExport{
+		ObjectMeta: metav1.ObjectMeta{Name: "widgets", ClusterName: "acme:provider"},
+		Spec: apisv1alpha1.APIExportSpec{
+			PermissionClaims: []apisv1alpha1.PermissionClaim{{Resource: "configmaps"}},
+		},
+	}
+
+	for _, tt := range []struct {
+		name string
+		gr   *schema.GroupResource
+		want sets.String
+	}{
+		{name: "any resource", want: sets.NewString("acme:consumer1", "acme:consumer2", "acme:consumer3", "acme:accepting")},
+		{name: "widgets", gr: &schema.GroupResource{Group: "example.io", Resource: "widgets"}, want: sets.NewString("acme:consumer1", "acme:consumer2")},
+		{name: "gadgets", gr: &schema.GroupResource{Group: "example.io", Resource: "gadgets"}, want: sets.NewString("acme:consumer2", "acme:consumer3")},
+		{name: "other group", gr: &schema.GroupResource{Group: "other.io", Resource: "widgets"}, want: sets.NewString()},
+		{name: "accepted claim", gr: &schema.GroupResource{Resource: "configmaps"}, want: sets.NewString("acme:accepting")},
+		{name: "accepted but not claimed", gr: &schema.GroupResource{Resource: "secrets"}, want: sets.NewString()},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := accessibleClusters(export, bindings, ref, tt.gr); !got.Equal(tt.want) {
+				t.Errorf("accessibleClusters() = %v, want %v", got.List(), tt.want.List())
+			}
+		})
+	}
+}
+
+func TestAccessibleClustersWithIdentity(t *testing.T) {
+	matching := newBinding("acme:matching", "provider", "widgets", "widgets")
+	matching.Status.BoundAPIExport.Workspace.IdentityHash = "abc"
+	stale := newBinding("acme:stale", "provider", "widgets", "widgets")
+	stale.Status.BoundAPIExport.Workspace.IdentityHash = "old"
+	bindings := []*apisv1alpha1.APIBinding{
+		matching,
+		stale,
+		newBinding("acme:none", "provider", "widgets", "widgets"),
+	}
+	ref := APIExportRef{ClusterName: "acme:provider", Name: "widgets"}
+	export := &apisv1alpha1.APIExport{
+		ObjectMeta: metav1.ObjectMeta{Name: "widgets", ClusterName: "acme:provider"},
+		Status:     apisv1alpha1.APIExportStatus{IdentityHash: "abc"},
+	}
+
+	gr := &schema.GroupResource{Group: "example.io", Resource: "widgets"}
+	if got, want := accessibleClusters(export, bindings, ref, gr), sets.NewString("acme:matching"); !got.Equal(want) {
+		t.Errorf("accessibleClusters() = %v, want %v", got.List(), want.List())
+	}
+}
+
+func TestWildcardResource(t *testing.T) {
+	export := &apisv1alpha1.APIExport{
+		Spec:   apisv1alpha1.APIExportSpec{LatestResourceSchemas: []string{"today.widgets.example.io"}},
+		Status: apisv1alpha1.APIExportStatus{IdentityHash: "abc"},
+	}
+
+	for _, tt := range []struct {
+		name           string
+		export         *apisv1alpha1.APIExport
+		gvr            schema.GroupVersionResource
+		want           schema.GroupVersionResource
+		wantRestricted bool
+	}{
+		{name: "exported resource", export: export, gvr: schema.GroupVersionResource{Group: "example.io", Version: "v1", Resource: "widgets"}, want: schema.GroupVersionResource{Group: "example.io", Version: "v1", Resource: "widgets:abc"}, wantRestricted: true},
+		{name: "claimed resource", export: export, gvr: schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}, want: schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}},
+		{name: "no identity", export: &apisv1alpha1.APIExport{Spec: export.Spec}, gvr: schema.GroupVersionResource{Group: "example.io", Version: "v1", Resource: "widgets"}, want: schema.GroupVersionResource{Group: "example.io", Version: "v1", Resource: "widgets"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, restricted := wildcardResource(tt.export, tt.gvr); got != tt.want || restricted != tt.wantRestricted {
+				t.Errorf("wildcardResource() = %v, %v, want %v, %v", got, restricted, tt.want, tt.wantRestricted)
+			}
+		})
+	}
+}
+
+func TestListClusters(t *testing.T) {
+	items := map[string][]string{
+		"acme:a": {"a1", "a2", "a3"},
+		"acme:b": {},
+		"acme:c": {"c1"},
+	}
+	var requests []string
+	kcp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		cluster := strings.Split(strings.TrimPrefix(req.URL.Path, "/clusters/"), "/")[0]
+		query := req.URL.Query()
+		requests = append(requests, cluster+"?"+query.Encode())
+
+		offset, _ := strconv.Atoi(query.Get("continue"))
+		names := items[cluster][offset:]
+		list := map[string]interface{}{"kind": "ConfigMapList", "apiVersion": "v1", "metadata": map[string]interface{}{"resourceVersion": "10"}}
+		if limit, _ := strconv.Atoi(query.Get("limit")); limit > 0 && limit < len(names) {
+			names = names[:limit]
+			list["metadata"].(map[string]interface{})["continue"] = strconv.Itoa(offset + limit)
+		}
+		var objs []interface{}
+		for _, name := range names {
+			objs = append(objs, map[string]interface{}{"kind": "ConfigMap", "apiVersion": "v1", "metadata": map[string]interface{}{"name": name, "clusterName": cluster}})
+		}
+		list["items"] = objs
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(list)
+	}))
+	defer kcp.Close()
+
+	dynamicClusterClient, err := dynamic.NewClusterForConfig(&rest.Config{Host: kcp.URL})
+	require.NoError(t, err)
+	p := &Proxy{dynamicClusterClient: dynamicClusterClient}
+	clusters := []string{"acme:a", "acme:b", "acme:c"}
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+
+	list, err := p.listClusters(context.Background(), clusters, gvr, "", metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a1", "a2", "a3", "c1"}, names(list))
+	require.Empty(t, list.GetContinue())
+	require.Equal(t, []string{"acme:a?", "acme:b?resourceVersion=10&resourceVersionMatch=Exact", "acme:c?resourceVersion=10&resourceVersionMatch=Exact"}, requests)
+
+	var pages [][]string
+	requests = nil
+	opts := metav1.ListOptions{Limit: 2}
+	for {
+		list, err := p.listClusters(context.Background(), clusters, gvr, "", opts)
+		require.NoError(t, err)
+		require.Equal(t, "10", list.GetResourceVersion())
+		pages = append(pages, names(list))
+		if opts.Continue = list.GetContinue(); opts.Continue == "" {
+			break
+		}
+	}
+	require.Equal(t, [][]string{{"a1", "a2"}, {"a3", "c1"}}, pages, "pages are filled up to the limit across logical clusters")
+	require.Equal(t, []string{
+		"acme:a?limit=2",
+		"acme:a?continue=2&limit=2",
+		"acme:b?limit=1&resourceVersion=10&resourceVersionMatch=Exact",
+		"acme:c?limit=1&resourceVersion=10&resourceVersionMatch=Exact",
+	}, requests)
+
+	_, err = p.listClusters(context.Background(), clusters, gvr, "", metav1.ListOptions{Continue: "invalid"})
+	require.True(t, apierrors.IsBadRequest(err), "invalid continue tokens are rejected")
+}
+
+func names(list *unstructured.UnstructuredList) []string {
+	ret := []string{}
+	for _, item := range list.Items {
+		ret = append(ret, item.GetName())
+	}
+	return ret
+}
+
+func TestIndexByBoundAPIExport(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		binding *apisv1alpha1.APIBinding
+		want    []string
+	}{
+		{name: "bound in the organization", binding: newBinding("acme:consumer", "provider", "widgets"), want: []string{APIExportRef{ClusterName: "acme:provider", Name: "widgets"}.Key()}},
+		{name: "not bound", binding: newBinding("acme:consumer", "", "widgets"), want: []string{}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := indexByBoundAPIExport(tt.binding)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package builder
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	genericapiserver "k8s.io/apiserver/pkg/server"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"github.com/kcp-dev/kcp/pkg/virtual/events"
+	"github.com/kcp-dev/kcp/pkg/virtual/framework"
+	"github.com/kcp-dev/kcp/pkg/virtual/framework/handler"
+)
+
+const EventsVirtualWorkspaceName string = "events"
+const DefaultRootPathPrefix string = "/services/events"
+
+// BuildVirtualWorkspace builds the events virtual workspace, served at
+// <rootPathPrefix>/<logical-cluster>, where the logical cluster is the one of the
+// workspace at the root of the subtree the Events of which are served.
+func BuildVirtualWorkspace(rootPathPrefix string, kcpConfig *rest.Config, kubeClusterClient *kubernetes.Cluster, eventInformers dynamicinformer.DynamicSharedInformerFactory) framework.VirtualWorkspace {
+	if !strings.HasSuffix(rootPathPrefix, "/") {
+		rootPathPrefix += "/"
+	}
+	return &handler.HandlerVirtualWorkspace{
+		Name: EventsVirtualWorkspaceName,
+		Ready: func() error {
+			for _, gvr := range events.Resources {
+				if !eventInformers.ForResource(gvr).Informer().HasSynced() {
+					return fmt.Errorf("%s informer is not synced", gvr)
+				}
+			}
+			return nil
+		},
+		RootPathResolver: func(urlPath string, requestContext context.Context) (accepted bool, prefixToStrip string, completedContext context.Context) {
+			completedContext = requestContext
+			if path := urlPath; strings.HasPrefix(path, rootPathPrefix) {
+				path = strings.TrimPrefix(path, rootPathPrefix)
+				segments := strings.SplitN(path, "/", 2)
+				if segments[0] == "" {
+					return
+				}
+
+				return true, rootPathPrefix + segments[0], events.WithSubtree(requestContext, segments[0])
+			}
+			return
+		},
+		HandlerFactory: func(rootAPIServerConfig genericapiserver.CompletedConfig) (http.Handler, error) {
+			return events.NewProxy(kcpConfig, kubeClusterClient, eventInformers)
+		},
+	}
+}
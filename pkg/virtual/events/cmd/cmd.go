@@ -0,0 +1,114 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/kcp-dev/kcp/pkg/virtual/events/builder"
+	"github.com/kcp-dev/kcp/pkg/virtual/framework"
+	virtualframeworkcmd "github.com/kcp-dev/kcp/pkg/virtual/framework/cmd"
+	rootapiserver "github.com/kcp-dev/kcp/pkg/virtual/framework/rootapiserver"
+)
+
+var _ virtualframeworkcmd.SubCommandOptions = (*EventsSubCommandOptions)(nil)
+
+type EventsSubCommandOptions struct {
+	RootPathPrefix string
+	KubeconfigFile string
+}
+
+func (o *EventsSubCommandOptions) Description() virtualframeworkcmd.SubCommandDescription {
+	return virtualframeworkcmd.SubCommandDescription{
+		Name:  "events",
+		Use:   "events",
+		Short: "Launch events virtual workspace apiserver",
+		Long:  "Start a virtual workspace apiserver serving to platform operators the Events of all the workspaces of a workspace subtree",
+	}
+}
+
+func (o *EventsSubCommandOptions) AddFlags(flags *pflag.FlagSet) {
+	if o == nil {
+		return
+	}
+
+	flags.StringVar(&o.KubeconfigFile, "events:kubeconfig", "", ""+
+		"The kubeconfig file of the kcp server, with wildcard access to events.")
+
+	_ = cobra.MarkFlagRequired(flags, "events:kubeconfig")
+
+	flags.StringVar(&o.RootPathPrefix, "events:root-path-prefix", builder.DefaultRootPathPrefix, ""+
+		"The prefix of the events API server root path.\n"+
+		"The final events API root path will be of the form:\n    <root-path-prefix>/<logical-cluster>")
+}
+
+func (o *EventsSubCommandOptions) Validate() []error {
+	if o == nil {
+		return nil
+	}
+	errs := []error{}
+
+	if len(o.KubeconfigFile) == 0 {
+		errs = append(errs, errors.New("--events:kubeconfig is required for this command"))
+	}
+
+	if !strings.HasPrefix(o.RootPathPrefix, "/") {
+		errs = append(errs, fmt.Errorf("--events:root-path-prefix %v should start with /", o.RootPathPrefix))
+	}
+
+	return errs
+}
+
+func (o *EventsSubCommandOptions) PrepareVirtualWorkspaces() ([]rootapiserver.InformerStart, []framework.VirtualWorkspace, error) {
+	kubeConfig, err := virtualframeworkcmd.ReadKubeConfig(o.KubeconfigFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	kubeClientConfig, err := kubeConfig.ClientConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	kubeClusterClient, err := kubernetes.NewClusterForConfig(kubeClientConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	dynamicClusterClient, err := dynamic.NewClusterForConfig(kubeClientConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	eventInformers := dynamicinformer.NewDynamicSharedInformerFactory(dynamicClusterClient.Cluster("*"), 10*time.Minute)
+
+	virtualWorkspaces := []framework.VirtualWorkspace{
+		builder.BuildVirtualWorkspace(o.RootPathPrefix, kubeClientConfig, kubeClusterClient, eventInformers),
+	}
+	informerStarts := []rootapiserver.InformerStart{
+		eventInformers.Start,
+	}
+	return informerStarts, virtualWorkspaces, nil
+}
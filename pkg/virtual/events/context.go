@@ -0,0 +1,38 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"context"
+)
+
+type subtreeKeyType string
+
+const subtreeKey subtreeKeyType = "EventsVirtualWorkspaceSubtree"
+
+// WithSubtree returns a copy of the context with the logical cluster at the root of the
+// workspace subtree the events of which are served.
+func WithSubtree(ctx context.Context, clusterName string) context.Context {
+	return context.WithValue(ctx, subtreeKey, clusterName)
+}
+
+// SubtreeFrom returns the logical cluster at the root of the workspace subtree stored
+// in the context, if any.
+func SubtreeFrom(ctx context.Context) (string, bool) {
+	clusterName, ok := ctx.Value(subtreeKey).(string)
+	return clusterName, ok
+}
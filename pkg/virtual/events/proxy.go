@@ -0,0 +1,534 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilcache "k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/handlers/responsewriters"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+
+	kcpadmissionhelpers "github.com/kcp-dev/kcp/pkg/admission/helpers"
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+	"github.com/kcp-dev/kcp/pkg/authorization"
+	"github.com/kcp-dev/kcp/pkg/virtual/framework/handler"
+)
+
+// Resources are the Event resources served by the Proxy.
+var Resources = []schema.GroupVersionResource{
+	{Version: "v1", Resource: "events"},
+	{Group: "events.k8s.io", Version: "v1", Resource: "events"},
+}
+
+// bySubtreeIndex is the name of the index of Events by the paths of the workspace of
+// their logical cluster and of all its ancestors.
+const bySubtreeIndex = "events-bySubtree"
+
+const (
+	// watchQueueLength is the number of events buffered for a watch, beyond which the
+	// watch is ended with an error such that its client lists the Events again.
+	watchQueueLength = 1000
+
+	// maxAuthorizers is the number of logical clusters the authorizers of which are kept.
+	maxAuthorizers = 1000
+	// authorizerTTL is how long the authorizer of a logical cluster is kept.
+	authorizerTTL = 10 * time.Minute
+	// authorizationRecheckPeriod is how long a watch serves the Events of a logical
+	// cluster before checking again that the user is allowed to read them.
+	authorizationRecheckPeriod = time.Minute
+)
+
+// Proxy serves the Events of all the workspaces of the subtree found in the request
+// context, from informers on the Events of all the logical clusters of kcp indexed by
+// the workspace subtrees they belong to:
+//   - both the core v1 and the events.k8s.io v1 Events can be listed and watched,
+//     in all namespaces or in a given namespace, and are read-only,
+//   - Events can be filtered with label selectors, and by name, namespace, type and
+//     reason with field selectors, e.g. fieldSelector=type=Warning,reason=FailedBinding,
+//   - lists are served from the informers in a single page, i.e. limit is ignored,
+//     and watches start at the current state of the informers. Watches falling behind
+//     the informers are ended with an expired error, such that clients list again,
+//   - the logical cluster of an Event is found in its metadata.clusterName,
+//   - discovery is served by the logical cluster at the root of the subtree,
+//   - users must be allowed to list (or watch) Events in the logical cluster at the
+//     root of the subtree, and only get the Events of the workspaces in which they
+//     are allowed to list (or watch) Events. Watches check that again periodically.
+type Proxy struct {
+	forwarder *handler.Forwarder
+
+	kubeClusterClient *kubernetes.Cluster
+	createAuthorizer  kcpadmissionhelpers.AdmissionAuthorizerFactory
+
+	indexers     map[schema.GroupVersionResource]cache.Indexer
+	broadcasters map[schema.GroupVersionResource]*broadcaster
+
+	lock        sync.Mutex
+	authorizers *utilcache.LRUExpireCache
+
+	requestInfoFactory *genericapirequest.RequestInfoFactory
+}
+
+// NewProxy returns a Proxy forwarding discovery to kcp with the given config, and
+// serving the Events of the given informers, which must inform about the Events of
+// all the logical clusters.
+func NewProxy(kcpConfig *rest.Config, kubeClusterClient *kubernetes.Cluster, eventInformers dynamicinformer.DynamicSharedInformerFactory) (*Proxy, error) {
+	forwarder, err := handler.NewForwarder(kcpConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Proxy{
+		forwarder:          forwarder,
+		kubeClusterClient:  kubeClusterClient,
+		createAuthorizer:   kcpadmissionhelpers.NewAdmissionAuthorizer,
+		indexers:           map[schema.GroupVersionResource]cache.Indexer{},
+		broadcasters:       map[schema.GroupVersionResource]*broadcaster{},
+		authorizers:        utilcache.NewLRUExpireCache(maxAuthorizers),
+		requestInfoFactory: handler.NewRequestInfoFactory(),
+	}
+	for _, gvr := range Resources {
+		informer := eventInformers.ForResource(gvr).Informer()
+		if err := informer.AddIndexers(cache.Indexers{bySubtreeIndex: indexBySubtree}); err != nil {
+			return nil, err
+		}
+		broadcaster := newBroadcaster()
+		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) { broadcaster.action(watch.Added, obj) },
+			UpdateFunc: func(_, obj interface{}) {
+				broadcaster.action(watch.Modified, obj)
+			},
+			DeleteFunc: func(obj interface{}) {
+				if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+					obj = tombstone.Obj
+				}
+				broadcaster.action(watch.Deleted, obj)
+			},
+		})
+		p.indexers[gvr] = informer.GetIndexer()
+		p.broadcasters[gvr] = broadcaster
+	}
+	return p, nil
+}
+
+// broadcaster sends the events of an informer to the watches. Unlike a watch.Broadcaster
+// dropping the events of full watches, it ends them, such that their clients relist
+// instead of silently missing events.
+type broadcaster struct {
+	lock     sync.Mutex
+	watchers map[*watcher]struct{}
+}
+
+// watcher receives the events of a broadcaster until it overflows or is stopped.
+type watcher struct {
+	result chan watch.Event
+	// overflowed is closed when the watcher fell behind the broadcaster.
+	overflowed chan struct{}
+}
+
+func newBroadcaster() *broadcaster {
+	return &broadcaster{watchers: map[*watcher]struct{}{}}
+}
+
+func (b *broadcaster) action(eventType watch.EventType, obj interface{}) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for w := range b.watchers {
+		select {
+		case w.result <- watch.Event{Type: eventType, Object: u}:
+		default:
+			delete(b.watchers, w)
+			close(w.overflowed)
+		}
+	}
+}
+
+func (b *broadcaster) watch() *watcher {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	w := &watcher{
+		result:     make(chan watch.Event, watchQueueLength),
+		overflowed: make(chan struct{}),
+	}
+	b.watchers[w] = struct{}{}
+	return w
+}
+
+func (b *broadcaster) stop(w *watcher) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	delete(b.watchers, w)
+}
+
+// indexBySubtree indexes Events by the paths of the workspace of their logical cluster
+// and of all its ancestors, such that the Events of a subtree are the ones indexed by
+// the path of its root.
+func indexBySubtree(obj interface{}) ([]string, error) {
+	metaObj, ok := obj.(metav1.Object)
+	if !ok {
+		return nil, fmt.Errorf("obj is supposed to be a metav1.Object, but is %T", obj)
+	}
+	path := authorization.WorkspacePath(metaObj.GetClusterName())
+	if path != helper.RootCluster && !strings.HasPrefix(path, helper.RootCluster+":") {
+		return []string{path}, nil
+	}
+	var keys []string
+	segments := strings.Split(path, ":")
+	for i := range segments {
+		keys = append(keys, strings.Join(segments[:i+1], ":"))
+	}
+	return keys, nil
+}
+
+var _ http.Handler = &Proxy{}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	clusterName, ok := SubtreeFrom(ctx)
+	if !ok {
+		responsewriters.InternalError(w, req, errors.New("no workspace subtree in request context"))
+		return
+	}
+	u, ok := genericapirequest.UserFrom(ctx)
+	if !ok {
+		handler.WriteError(w, req, apierrors.NewUnauthorized("no user in request context"))
+		return
+	}
+
+	info, err := p.requestInfoFactory.NewRequestInfo(req)
+	if err != nil {
+		handler.WriteError(w, req, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+
+	verb := "list"
+	if info.IsResourceRequest && info.Verb == "watch" {
+		verb = "watch"
+	}
+	if err := p.authorize(ctx, u, clusterName, verb); err != nil {
+		handler.WriteError(w, req, err)
+		return
+	}
+
+	if !info.IsResourceRequest {
+		p.forwarder.Forward(w, req, clusterName, req.URL.Path, nil)
+		return
+	}
+
+	gvr := schema.GroupVersionResource{Group: info.APIGroup, Version: info.APIVersion, Resource: info.Resource}
+	indexer, found := p.indexers[gvr]
+	if !found || info.Subresource != "" {
+		handler.WriteError(w, req, apierrors.NewForbidden(gvr.GroupResource(), info.Name, errors.New("only events are served by the events virtual workspace")))
+		return
+	}
+	if info.Name != "" || (info.Verb != "list" && info.Verb != "watch") {
+		handler.WriteError(w, req, apierrors.NewMethodNotSupported(gvr.GroupResource(), info.Verb))
+		return
+	}
+
+	opts := metav1.ListOptions{}
+	if err := metav1.ParameterCodec.DecodeParameters(req.URL.Query(), metav1.SchemeGroupVersion, &opts); err != nil {
+		handler.WriteError(w, req, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+	if opts.Continue != "" {
+		handler.WriteError(w, req, apierrors.NewBadRequest("continue is not supported by the events virtual workspace"))
+		return
+	}
+	f, err := newFilter(info.Namespace, authorization.WorkspacePath(clusterName), opts, func(clusterName string) bool {
+		return p.authorize(ctx, u, clusterName, verb) == nil
+	})
+	if err != nil {
+		handler.WriteError(w, req, err)
+		return
+	}
+
+	if info.Verb == "list" {
+		list, err := f.list(indexer)
+		if err != nil {
+			handler.WriteError(w, req, err)
+			return
+		}
+		list.SetAPIVersion(gvr.GroupVersion().String())
+		list.SetKind("EventList")
+		responsewriters.WriteRawJSON(http.StatusOK, list, w)
+		return
+	}
+
+	// start watching before listing, such that no event is missed in between
+	broadcaster := p.broadcasters[gvr]
+	watcher := broadcaster.watch()
+	defer broadcaster.stop(watcher)
+
+	var initial []watch.Event
+	if opts.ResourceVersion == "" || opts.ResourceVersion == "0" {
+		list, err := f.list(indexer)
+		if err != nil {
+			handler.WriteError(w, req, err)
+			return
+		}
+		for i := range list.Items {
+			initial = append(initial, watch.Event{Type: watch.Added, Object: &list.Items[i]})
+		}
+	}
+	serveWatch(w, req, initial, watcher, f)
+}
+
+// authorize checks that the user is allowed to read Events in the given logical cluster.
+func (p *Proxy) authorize(ctx context.Context, u user.Info, clusterName, verb string) error {
+	authz, err := p.authorizerFor(clusterName)
+	if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+	attr := authorizer.AttributesRecord{
+		User:            u,
+		Verb:            verb,
+		APIVersion:      "v1",
+		Resource:        "events",
+		ResourceRequest: true,
+	}
+	decision, reason, err := authz.Authorize(ctx, attr)
+	if err != nil {
+		return apierrors.NewInternalError(fmt.Errorf("unable to determine access to events: %w", err))
+	}
+	if decision != authorizer.DecisionAllow {
+		return apierrors.NewForbidden(schema.GroupResource{Resource: "events"}, "", fmt.Errorf("missing verb=%q permission on events in logical cluster %q: %s", verb, clusterName, reason))
+	}
+	return nil
+}
+
+// authorizerFor returns the authorizer of the logical cluster, which is kept for a while
+// such that its decisions are cached across requests.
+func (p *Proxy) authorizerFor(clusterName string) (authorizer.Authorizer, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if authz, found := p.authorizers.Get(clusterName); found {
+		return authz.(authorizer.Authorizer), nil
+	}
+	authz, err := p.createAuthorizer(clusterName, p.kubeClusterClient)
+	if err != nil {
+		return nil, err
+	}
+	p.authorizers.Add(clusterName, authz, authorizerTTL)
+	return authz, nil
+}
+
+// filter selects the Events of a request.
+type filter struct {
+	namespace string
+	subtree   string
+	labels    labels.Selector
+	fields    fields.Selector
+
+	// allowed returns whether the Events of the logical cluster can be served. Its
+	// decisions are kept for authorizationRecheckPeriod.
+	allowed func(clusterName string) bool
+	now     func() time.Time
+	lock    sync.Mutex
+	checked map[string]check
+}
+
+// check is a decision of filter.allowed.
+type check struct {
+	allowed bool
+	at      time.Time
+}
+
+// eventFields are the fields Events can be filtered by.
+var eventFields = sets.NewString("metadata.name", "metadata.namespace", "type", "reason")
+
+func newFilter(namespace, subtree string, opts metav1.ListOptions, allowed func(clusterName string) bool) (*filter, error) {
+	labelSelector, err := labels.Parse(opts.LabelSelector)
+	if err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+	fieldSelector, err := fields.ParseSelector(opts.FieldSelector)
+	if err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+	for _, r := range fieldSelector.Requirements() {
+		if !eventFields.Has(r.Field) {
+			return nil, apierrors.NewBadRequest(fmt.Sprintf("field label not supported: %s", r.Field))
+		}
+	}
+	return &filter{
+		namespace: namespace,
+		subtree:   subtree,
+		labels:    labelSelector,
+		fields:    fieldSelector,
+		allowed:   allowed,
+		now:       time.Now,
+		checked:   map[string]check{},
+	}, nil
+}
+
+// list returns the Events of the indexer matching the filter.
+func (f *filter) list(indexer cache.Indexer) (*unstructured.UnstructuredList, error) {
+	objs, err := indexer.ByIndex(bySubtreeIndex, f.subtree)
+	if err != nil {
+		return nil, apierrors.NewInternalError(err)
+	}
+	list := &unstructured.UnstructuredList{Items: []unstructured.Unstructured{}}
+	for _, obj := range objs {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok || !f.matches(u) {
+			continue
+		}
+		list.Items = append(list.Items, *u.DeepCopy())
+	}
+	sort.Slice(list.Items, func(i, j int) bool {
+		a, b := list.Items[i], list.Items[j]
+		if a.GetClusterName() != b.GetClusterName() {
+			return a.GetClusterName() < b.GetClusterName()
+		}
+		if a.GetNamespace() != b.GetNamespace() {
+			return a.GetNamespace() < b.GetNamespace()
+		}
+		return a.GetName() < b.GetName()
+	})
+	return list, nil
+}
+
+// matches returns whether the Event is in the namespace and subtree of the filter,
+// matches its selectors, and belongs to a logical cluster the Events of which can be
+// served.
+func (f *filter) matches(event *unstructured.Unstructured) bool {
+	if f.namespace != "" && event.GetNamespace() != f.namespace {
+		return false
+	}
+	if !inSubtree(event.GetClusterName(), f.subtree) {
+		return false
+	}
+	if !f.labels.Matches(labels.Set(event.GetLabels())) {
+		return false
+	}
+	eventType, _, _ := unstructured.NestedString(event.Object, "type")
+	reason, _, _ := unstructured.NestedString(event.Object, "reason")
+	if !f.fields.Matches(fields.Set{
+		"metadata.name":      event.GetName(),
+		"metadata.namespace": event.GetNamespace(),
+		"type":               eventType,
+		"reason":             reason,
+	}) {
+		return false
+	}
+	return f.isAllowed(event.GetClusterName())
+}
+
+func (f *filter) isAllowed(clusterName string) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	now := f.now()
+	c, found := f.checked[clusterName]
+	if !found || now.Sub(c.at) >= authorizationRecheckPeriod {
+		c = check{allowed: f.allowed(clusterName), at: now}
+		f.checked[clusterName] = c
+	}
+	return c.allowed
+}
+
+// serveWatch writes the initial events, then the events of the watcher, about Events
+// matching the filter as a JSON watch stream, until the request ends or the watcher
+// overflows, in which case an expired error is written such that the client relists.
+func serveWatch(w http.ResponseWriter, req *http.Request, initial []watch.Event, watcher *watcher, f *filter) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		responsewriters.InternalError(w, req, errors.New("streaming is not supported"))
+		return
+	}
+	w.Header().Set("Content-Type", runtime.ContentTypeJSON)
+	w.Header().Set("Transfer-Encoding", "chunked")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	encoder := json.NewEncoder(w)
+	write := func(eventType watch.EventType, obj interface{}) bool {
+		raw, err := json.Marshal(obj)
+		if err != nil {
+			return false
+		}
+		if err := encoder.Encode(&metav1.WatchEvent{Type: string(eventType), Object: runtime.RawExtension{Raw: raw}}); err != nil {
+			return false
+		}
+		flusher.Flush()
+		return true
+	}
+	for _, ev := range initial {
+		if !write(ev.Type, ev.Object) {
+			return
+		}
+	}
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-watcher.overflowed:
+			status := apierrors.NewResourceExpired("the watch fell behind the events, list them again").Status()
+			status.Kind, status.APIVersion = "Status", "v1"
+			write(watch.Error, &status)
+			return
+		case ev := <-watcher.result:
+			obj, ok := ev.Object.(*unstructured.Unstructured)
+			if !ok || !f.matches(obj) {
+				continue
+			}
+			if !write(ev.Type, obj) {
+				return
+			}
+		}
+	}
+}
+
+// inSubtree returns whether the logical cluster is the one of the workspace with the
+// given path, or of one of its descendants.
+func inSubtree(clusterName, subtree string) bool {
+	path := authorization.WorkspacePath(clusterName)
+	return path == subtree || strings.HasPrefix(path, subtree+":")
+}
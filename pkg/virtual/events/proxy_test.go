@@ -0,0 +1,134 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestFilter(t *testing.T) {
+	event := func(clusterName, name, eventType string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{"type": eventType}}
+		obj.SetClusterName(clusterName)
+		obj.SetNamespace("default")
+		obj.SetName(name)
+		return obj
+	}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{bySubtreeIndex: indexBySubtree})
+	for _, obj := range []*unstructured.Unstructured{
+		event("root", "a", "Normal"),
+		event("root:acme", "b", "Warning"),
+		event("acme:team", "c", "Normal"),
+		event("acme:secret", "d", "Warning"),
+		event("root:acme2", "e", "Normal"),
+		event("acme2:team", "f", "Normal"),
+		event("system:admin", "g", "Normal"),
+	} {
+		require.NoError(t, indexer.Add(obj))
+	}
+
+	var checked []string
+	allowed := func(clusterName string) bool {
+		checked = append(checked, clusterName)
+		return clusterName != "acme:secret"
+	}
+	names := func(list *unstructured.UnstructuredList) []string {
+		var got []string
+		for _, item := range list.Items {
+			got = append(got, item.GetName())
+		}
+		return got
+	}
+
+	f, err := newFilter("", "root:acme", metav1.ListOptions{}, allowed)
+	require.NoError(t, err)
+	list, err := f.list(indexer)
+	require.NoError(t, err)
+	require.Equal(t, []string{"c", "b"}, names(list), "events of workspaces the user may not read are dropped")
+	require.ElementsMatch(t, []string{"acme:team", "acme:secret", "root:acme"}, checked, "only the workspaces of the subtree are authorized")
+
+	f, err = newFilter("", "root", metav1.ListOptions{FieldSelector: "type=Normal"}, allowed)
+	require.NoError(t, err)
+	list, err = f.list(indexer)
+	require.NoError(t, err)
+	require.Equal(t, []string{"f", "c", "a", "e"}, names(list))
+
+	f, err = newFilter("other", "root", metav1.ListOptions{}, allowed)
+	require.NoError(t, err)
+	list, err = f.list(indexer)
+	require.NoError(t, err)
+	require.Empty(t, list.Items)
+
+	require.False(t, f.matches(event("acme:secret", "h", "Normal")), "watch events are filtered too")
+
+	_, err = newFilter("", "root", metav1.ListOptions{FieldSelector: "involvedObject.name=x"}, allowed)
+	require.Error(t, err, "unsupported fields are rejected")
+}
+
+func TestFilterRechecksAuthorization(t *testing.T) {
+	allowed := true
+	calls := 0
+	f, err := newFilter("", "root", metav1.ListOptions{}, func(string) bool {
+		calls++
+		return allowed
+	})
+	require.NoError(t, err)
+	now := time.Now()
+	f.now = func() time.Time { return now }
+
+	require.True(t, f.isAllowed("acme:team"))
+	allowed = false
+	require.True(t, f.isAllowed("acme:team"), "decisions are kept within the recheck period")
+	require.Equal(t, 1, calls)
+
+	now = now.Add(authorizationRecheckPeriod)
+	require.False(t, f.isAllowed("acme:team"), "decisions are checked again after the recheck period")
+	require.Equal(t, 2, calls)
+}
+
+func TestBroadcasterEndsFullWatches(t *testing.T) {
+	b := newBroadcaster()
+	slow := b.watch()
+	stopped := b.watch()
+	b.stop(stopped)
+
+	for i := 0; i < watchQueueLength; i++ {
+		b.action(watch.Added, &unstructured.Unstructured{})
+	}
+	select {
+	case <-slow.overflowed:
+		t.Fatal("watch overflowed before its queue is full")
+	default:
+	}
+	require.Len(t, stopped.result, 0, "stopped watches get no events")
+
+	b.action(watch.Added, &unstructured.Unstructured{})
+	select {
+	case <-slow.overflowed:
+	default:
+		t.Fatal("watch did not overflow")
+	}
+	require.Empty(t, b.watchers, "overflowed watches are removed")
+}
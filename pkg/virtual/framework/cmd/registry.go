@@ -0,0 +1,146 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"k8s.io/klog/v2"
+
+	"github.com/kcp-dev/kcp/pkg/virtual/framework"
+	virtualrootapiserver "github.com/kcp-dev/kcp/pkg/virtual/framework/rootapiserver"
+)
+
+// AllSubCommandName is the name of the sub-command serving all the registered virtual workspaces
+// in a single apiserver.
+const AllSubCommandName = "all"
+
+// Registry holds the virtual workspaces sub-commands. Distributions can build their own
+// virtual workspaces binary by registering their sub-commands next to the ones of kcp.
+type Registry struct {
+	lock        sync.Mutex
+	subCommands map[string]SubCommandOptions
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		subCommands: map[string]SubCommandOptions{},
+	}
+}
+
+// Register adds a virtual workspace sub-command, named after its description.
+// It is a fatal error to register the same name twice.
+func (r *Registry) Register(subCommandOptions SubCommandOptions) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	name := subCommandOptions.Description().Name
+	if name == AllSubCommandName {
+		klog.Fatalf("Virtual workspace sub-command name %q is reserved", name)
+	}
+	if _, found := r.subCommands[name]; found {
+		klog.Fatalf("Virtual workspace sub-command %q was registered twice", name)
+	}
+	klog.V(1).Infof("Registered virtual workspace sub-command %q", name)
+	r.subCommands[name] = subCommandOptions
+}
+
+// Registered returns the names of the registered sub-commands, sorted.
+func (r *Registry) Registered() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	names := make([]string, 0, len(r.subCommands))
+	for name := range r.subCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Command returns a command with one sub-command per registered virtual workspace, plus
+// the "all" sub-command serving all of them in a single apiserver.
+func (r *Registry) Command(use string, out, errout io.Writer, stopCh <-chan struct{}) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   use,
+		Short: "Command for virtual workspaces API Servers",
+		Run: func(cmd *cobra.Command, args []string) {
+			_ = cmd.Help()
+			os.Exit(1)
+		},
+	}
+
+	all := &combinedSubCommandOptions{}
+	for _, name := range r.Registered() {
+		subCommandOptions := r.subCommands[name]
+		cmd.AddCommand(APIServerCommand(out, errout, stopCh, subCommandOptions))
+		all.subCommands = append(all.subCommands, subCommandOptions)
+	}
+	cmd.AddCommand(APIServerCommand(out, errout, stopCh, all))
+
+	return cmd
+}
+
+var _ SubCommandOptions = (*combinedSubCommandOptions)(nil)
+
+// combinedSubCommandOptions serves the virtual workspaces of several sub-commands in a single
+// apiserver. Flags of the sub-commands are prefixed with their name, so they don't conflict.
+type combinedSubCommandOptions struct {
+	subCommands []SubCommandOptions
+}
+
+func (o *combinedSubCommandOptions) Description() SubCommandDescription {
+	return SubCommandDescription{
+		Name:  AllSubCommandName,
+		Use:   AllSubCommandName,
+		Short: "Launch all virtual workspaces in a single apiserver",
+		Long:  "Start a virtual workspace apiserver serving all the registered virtual workspaces",
+	}
+}
+
+func (o *combinedSubCommandOptions) AddFlags(flags *pflag.FlagSet) {
+	for _, subCommand := range o.subCommands {
+		subCommand.AddFlags(flags)
+	}
+}
+
+func (o *combinedSubCommandOptions) Validate() []error {
+	var errs []error
+	for _, subCommand := range o.subCommands {
+		errs = append(errs, subCommand.Validate()...)
+	}
+	return errs
+}
+
+func (o *combinedSubCommandOptions) PrepareVirtualWorkspaces() ([]virtualrootapiserver.InformerStart, []framework.VirtualWorkspace, error) {
+	var informerStarts []virtualrootapiserver.InformerStart
+	var virtualWorkspaces []framework.VirtualWorkspace
+	for _, subCommand := range o.subCommands {
+		starts, workspaces, err := subCommand.PrepareVirtualWorkspaces()
+		if err != nil {
+			return nil, nil, err
+		}
+		informerStarts = append(informerStarts, starts...)
+		virtualWorkspaces = append(virtualWorkspaces, workspaces...)
+	}
+	return informerStarts, virtualWorkspaces, nil
+}
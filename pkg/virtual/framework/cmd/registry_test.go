@@ -0,0 +1,101 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/pflag"
+
+	"github.com/kcp-dev/kcp/pkg/virtual/framework"
+	virtualrootapiserver "github.com/kcp-dev/kcp/pkg/virtual/framework/rootapiserver"
+)
+
+type fakeSubCommandOptions struct {
+	name    string
+	flag    string
+	invalid bool
+}
+
+func (o *fakeSubCommandOptions) Description() SubCommandDescription {
+	return SubCommandDescription{Name: o.name, Use: o.name}
+}
+
+func (o *fakeSubCommandOptions) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&o.flag, o.name+":flag", "", "")
+}
+
+func (o *fakeSubCommandOptions) Validate() []error {
+	if o.invalid {
+		return []error{errors.New(o.name + " is invalid")}
+	}
+	return nil
+}
+
+func (o *fakeSubCommandOptions) PrepareVirtualWorkspaces() ([]virtualrootapiserver.InformerStart, []framework.VirtualWorkspace, error) {
+	return []virtualrootapiserver.InformerStart{func(stopCh <-chan struct{}) {}}, nil, nil
+}
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register(&fakeSubCommandOptions{name: "zeta"})
+	registry.Register(&fakeSubCommandOptions{name: "alpha", invalid: true})
+
+	if got, want := registry.Registered(), []string{"alpha", "zeta"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Registered() = %v, want %v", got, want)
+	}
+
+	cmd := registry.Command("virtual-workspaces", nil, nil, nil)
+	var names []string
+	for _, sub := range cmd.Commands() {
+		names = append(names, sub.Name())
+	}
+	if want := []string{"all", "alpha", "zeta"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("sub-commands = %v, want %v", names, want)
+	}
+
+	all, _, err := cmd.Find([]string{AllSubCommandName})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, flag := range []string{"alpha:flag", "zeta:flag"} {
+		if all.Flags().Lookup(flag) == nil {
+			t.Errorf("expected flag %q on the %q sub-command", flag, AllSubCommandName)
+		}
+	}
+}
+
+func TestCombinedSubCommandOptions(t *testing.T) {
+	o := &combinedSubCommandOptions{subCommands: []SubCommandOptions{
+		&fakeSubCommandOptions{name: "alpha", invalid: true},
+		&fakeSubCommandOptions{name: "zeta"},
+	}}
+
+	if errs := o.Validate(); len(errs) != 1 {
+		t.Errorf("expected 1 validation error, got %v", errs)
+	}
+
+	informerStarts, _, err := o.PrepareVirtualWorkspaces()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(informerStarts) != 2 {
+		t.Errorf("expected the informer starts of both sub-commands, got %d", len(informerStarts))
+	}
+}
@@ -22,4 +22,8 @@ limitations under the License.
 // - define the implementation of the VirtualWorkspaces you want to expose (for example with utilities found in the `fixedgvs` package)
 //
 // - define the sub-command that will expose the related CLI arguments, Bootstrap and start those VirtualWorkspaces.
+//
+// - register the sub-command in a `cmd.Registry`, next to the ones of kcp, to build the virtual workspaces command.
+//
+// Virtual workspaces whose requests should be authorized before reaching them can be wrapped with `WithAuthorizer`.
 package framework
@@ -0,0 +1,135 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/handlers/responsewriters"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/transport"
+	"k8s.io/component-base/traces"
+)
+
+var errorCodecs = func() serializer.CodecFactory {
+	scheme := runtime.NewScheme()
+	metav1.AddToGroupVersion(scheme, schema.GroupVersion{Version: "v1"})
+	return serializer.NewCodecFactory(scheme)
+}()
+
+// Forwarder forwards requests to kcp, with the credentials of the virtual workspace.
+type Forwarder struct {
+	url       *url.URL
+	transport http.RoundTripper
+}
+
+// NewForwarder returns a Forwarder sending requests to the kcp server of the given config.
+func NewForwarder(config *rest.Config) (*Forwarder, error) {
+	u, err := url.Parse(config.Host)
+	if err != nil {
+		return nil, err
+	}
+	// propagate the trace context of requests to kcp
+	config = rest.CopyConfig(config)
+	config.Wrap(traces.WrapperFor(nil))
+	transport, err := rest.TransportFor(config)
+	if err != nil {
+		return nil, err
+	}
+	return &Forwarder{url: u, transport: transport}, nil
+}
+
+// Forward sends the request to the given path of the given logical cluster. When query is
+// not nil, it replaces the query of the request. The authentication and impersonation
+// headers of the request are dropped.
+func (f *Forwarder) Forward(w http.ResponseWriter, req *http.Request, clusterName, path string, query url.Values) {
+	f.forward(w, req, clusterName, path, query, f.transport)
+}
+
+// ForwardAs forwards the request like Forward, impersonating the given user, such that
+// kcp authorizes and admits the request for that user rather than for the virtual
+// workspace. The credentials of the virtual workspace must allow impersonating the user.
+func (f *Forwarder) ForwardAs(w http.ResponseWriter, req *http.Request, clusterName, path string, query url.Values, u user.Info) {
+	f.forward(w, req, clusterName, path, query, transport.NewImpersonatingRoundTripper(transport.ImpersonationConfig{
+		UserName: u.GetName(),
+		UID:      u.GetUID(),
+		Groups:   u.GetGroups(),
+		Extra:    u.GetExtra(),
+	}, f.transport))
+}
+
+func (f *Forwarder) forward(w http.ResponseWriter, req *http.Request, clusterName, path string, query url.Values, rt http.RoundTripper) {
+	target := *f.url
+	proxy := &httputil.ReverseProxy{
+		Director: func(r *http.Request) {
+			r.URL.Scheme = target.Scheme
+			r.URL.Host = target.Host
+			r.URL.Path = strings.TrimSuffix(target.Path, "/") + "/clusters/" + clusterName + path
+			r.URL.RawPath = ""
+			if query != nil {
+				r.URL.RawQuery = query.Encode()
+			}
+			r.Host = target.Host
+
+			r.Header.Del("Authorization")
+			for header := range r.Header {
+				if strings.HasPrefix(header, "Impersonate-") {
+					r.Header.Del(header)
+				}
+			}
+		},
+		Transport:     rt,
+		FlushInterval: -1,
+	}
+	proxy.ServeHTTP(w, req)
+}
+
+// WriteError writes the given error as a Status object.
+func WriteError(w http.ResponseWriter, req *http.Request, err error) {
+	responsewriters.ErrorNegotiated(err, errorCodecs, schema.GroupVersion{Version: "v1"}, w, req)
+}
+
+// NewRequestInfoFactory returns a RequestInfoFactory for the paths of the Kubernetes API.
+func NewRequestInfoFactory() *genericapirequest.RequestInfoFactory {
+	return &genericapirequest.RequestInfoFactory{
+		APIPrefixes:          sets.NewString("api", "apis"),
+		GrouplessAPIPrefixes: sets.NewString("api"),
+	}
+}
+
+// SplitClusterPath splits an optional /clusters/<logical-cluster> prefix from the given
+// path. It returns an empty logical cluster name when there is no such prefix.
+func SplitClusterPath(path string) (clusterName string, rest string) {
+	if !strings.HasPrefix(path, "/clusters/") {
+		return "", path
+	}
+	segments := strings.SplitN(strings.TrimPrefix(path, "/clusters/"), "/", 2)
+	if len(segments) < 2 {
+		return segments[0], "/"
+	}
+	return segments[0], "/" + segments[1]
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/client-go/rest"
+)
+
+func TestSplitClusterPath(t *testing.T) {
+	for _, tt := range []struct {
+		path        string
+		wantCluster string
+		wantRest    string
+	}{
+		{path: "/apis/apps/v1/deployments", wantRest: "/apis/apps/v1/deployments"},
+		{path: "/clusters/acme:team/apis/apps/v1/namespaces/default/deployments/foo", wantCluster: "acme:team", wantRest: "/apis/apps/v1/namespaces/default/deployments/foo"},
+		{path: "/clusters/*/api/v1/configmaps", wantCluster: "*", wantRest: "/api/v1/configmaps"},
+		{path: "/clusters/acme:team", wantCluster: "acme:team", wantRest: "/"},
+	} {
+		t.Run(tt.path, func(t *testing.T) {
+			cluster, rest := SplitClusterPath(tt.path)
+			if cluster != tt.wantCluster || rest != tt.wantRest {
+				t.Errorf("SplitClusterPath(%q) = (%q, %q), want (%q, %q)", tt.path, cluster, rest, tt.wantCluster, tt.wantRest)
+			}
+		})
+	}
+}
+
+func TestForwardAs(t *testing.T) {
+	var got http.Header
+	kcp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got = req.Header.Clone()
+	}))
+	defer kcp.Close()
+
+	f, err := NewForwarder(&rest.Config{Host: kcp.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPatch, "/api/v1/namespaces/default/configmaps/foo", nil)
+	req.Header.Set("Authorization", "Bearer syncer-token")
+	req.Header.Set("Impersonate-User", "admin")
+	f.ForwardAs(httptest.NewRecorder(), req, "acme:team", "/api/v1/namespaces/default/configmaps/foo", nil, &user.DefaultInfo{
+		Name:   "system:kcp:syncer:east",
+		Groups: []string{"system:kcp:syncer", "system:authenticated"},
+		Extra:  map[string][]string{"scopes": {"east"}},
+	})
+
+	if auth := got.Get("Authorization"); auth != "" {
+		t.Errorf("Authorization = %q, want none", auth)
+	}
+	if u := got.Get("Impersonate-User"); u != "system:kcp:syncer:east" {
+		t.Errorf("Impersonate-User = %q, want %q", u, "system:kcp:syncer:east")
+	}
+	if groups := got.Values("Impersonate-Group"); !reflect.DeepEqual(groups, []string{"system:kcp:syncer", "system:authenticated"}) {
+		t.Errorf("Impersonate-Group = %v", groups)
+	}
+	if extra := got.Values("Impersonate-Extra-Scopes"); !reflect.DeepEqual(extra, []string{"east"}) {
+		t.Errorf("Impersonate-Extra-Scopes = %v", extra)
+	}
+}
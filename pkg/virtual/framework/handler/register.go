@@ -0,0 +1,61 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"net/http"
+
+	genericapiserver "k8s.io/apiserver/pkg/server"
+
+	virtualcontext "github.com/kcp-dev/kcp/pkg/virtual/framework/context"
+)
+
+func (vw *HandlerVirtualWorkspace) Register(rootAPIServerConfig genericapiserver.CompletedConfig, delegateAPIServer genericapiserver.DelegationTarget) (genericapiserver.DelegationTarget, error) {
+	handler, err := vw.HandlerFactory(rootAPIServerConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &genericapiserver.RecommendedConfig{Config: *rootAPIServerConfig.Config, SharedInformerFactory: rootAPIServerConfig.SharedInformerFactory}
+
+	// Poststart hooks are only added at the top level RootAPIServer,
+	// so drop the ones copied from the RootAPIServerConfig.
+	cfg.PostStartHooks = map[string]genericapiserver.PostStartHookConfigEntry{}
+	cfg.EnableDiscovery = false
+
+	server, err := cfg.Complete().New(vw.Name+"-virtual-workspace-apiserver", delegateAPIServer)
+	if err != nil {
+		return nil, err
+	}
+
+	server.Handler.Director = http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if vwName := r.Context().Value(virtualcontext.VirtualWorkspaceNameKey); vwName != nil {
+			if vwNameString, isString := vwName.(string); isString && vwNameString == vw.Name {
+				handler.ServeHTTP(rw, r)
+				return
+			}
+		}
+		delegatedHandler := delegateAPIServer.UnprotectedHandler()
+		if delegatedHandler != nil {
+			delegatedHandler.ServeHTTP(rw, r)
+		} else {
+			http.NotFoundHandler().ServeHTTP(rw, r)
+		}
+	})
+
+	return server, nil
+}
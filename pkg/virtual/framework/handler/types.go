@@ -0,0 +1,53 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	genericapiserver "k8s.io/apiserver/pkg/server"
+
+	"github.com/kcp-dev/kcp/pkg/virtual/framework"
+)
+
+// HandlerFactory builds the HTTP handler serving the requests of a virtual workspace.
+// This may include creating active objects like informers, adding poststart hooks
+// into the rootAPIServerConfig, etc ...
+type HandlerFactory func(rootAPIServerConfig genericapiserver.CompletedConfig) (http.Handler, error)
+
+// HandlerVirtualWorkspace is an implementation of
+// the VirtualWorkspace interface, which serves all the requests
+// accepted by its RootPathResolver with a single HTTP handler.
+type HandlerVirtualWorkspace struct {
+	Name             string
+	RootPathResolver framework.RootPathResolverFunc
+	Ready            framework.ReadyFunc
+	HandlerFactory   HandlerFactory
+}
+
+func (vw *HandlerVirtualWorkspace) GetName() string {
+	return vw.Name
+}
+
+func (vw *HandlerVirtualWorkspace) IsReady() error {
+	return vw.Ready()
+}
+
+func (vw *HandlerVirtualWorkspace) ResolveRootPath(urlPath string, context context.Context) (accepted bool, prefixToStrip string, completedContext context.Context) {
+	return vw.RootPathResolver(urlPath, context)
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/endpoints/responsewriter"
+	compbasemetrics "k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+	"k8s.io/klog/v2"
+)
+
+const (
+	namespace = "kcp"
+	subsystem = "virtual_workspace"
+)
+
+var (
+	requestCounter = compbasemetrics.NewCounterVec(
+		&compbasemetrics.CounterOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "requests_total",
+			Help:           "Counter of virtual workspace requests broken out by virtual workspace, verb and HTTP response code.",
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+		[]string{"virtual_workspace", "verb", "code"},
+	)
+	requestLatencies = compbasemetrics.NewHistogramVec(
+		&compbasemetrics.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "request_duration_seconds",
+			Help:      "Response latency distribution in seconds of virtual workspace requests, watches excluded, broken out by virtual workspace and verb.",
+			Buckets: []float64{0.005, 0.025, 0.05, 0.1, 0.2, 0.4, 0.6, 0.8, 1.0, 1.25, 1.5, 2, 3,
+				4, 5, 6, 8, 10, 15, 20, 30, 45, 60},
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+		[]string{"virtual_workspace", "verb"},
+	)
+	rejectedRequestCounter = compbasemetrics.NewCounterVec(
+		&compbasemetrics.CounterOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "rejected_requests_total",
+			Help:           "Counter of virtual workspace requests rejected by authentication or authorization, broken out by virtual workspace and HTTP response code.",
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+		[]string{"virtual_workspace", "code"},
+	)
+	activeWatches = compbasemetrics.NewGaugeVec(
+		&compbasemetrics.GaugeOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "active_watches",
+			Help:           "Number of open watches broken out by virtual workspace.",
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+		[]string{"virtual_workspace"},
+	)
+
+	metrics = []compbasemetrics.Registerable{
+		requestCounter,
+		requestLatencies,
+		rejectedRequestCounter,
+		activeWatches,
+	}
+)
+
+// verbs are the verbs of the requests recorded as is, others are recorded as "other", as
+// the verbs of non-resource requests are the methods clients send.
+var verbs = sets.NewString(
+	"get", "list", "watch", "create", "update", "patch", "delete", "deletecollection", "proxy",
+	"post", "put", "head", "options",
+)
+
+var registerMetrics sync.Once
+
+// Register registers the virtual workspace metrics in the legacy registry,
+// which is served by the apiserver at /metrics.
+func Register() {
+	registerMetrics.Do(func() {
+		for _, metric := range metrics {
+			legacyregistry.MustRegister(metric)
+		}
+	})
+}
+
+// NameResolverFunc returns the name of the virtual workspace serving a request,
+// or false if no virtual workspace serves it.
+type NameResolverFunc func(req *http.Request) (string, bool)
+
+// WithInstrumentation records the metrics of every request served by a virtual workspace,
+// and logs it at level 4. It must wrap the whole handler chain, so that requests
+// rejected by authentication or authorization are counted as well. The resource of a
+// request is only logged: it is parsed from the path before authentication and routing,
+// such that it would give the metrics a series per path clients make up.
+func WithInstrumentation(handler http.Handler, resolveName NameResolverFunc, requestInfoResolver genericapirequest.RequestInfoResolver) http.Handler {
+	Register()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		name, ok := resolveName(req)
+		if !ok {
+			handler.ServeHTTP(w, req)
+			return
+		}
+
+		verb, resource := "", ""
+		if requestInfo, err := requestInfoResolver.NewRequestInfo(req); err == nil {
+			verb, resource = requestInfo.Verb, requestInfo.Resource
+			if requestInfo.Subresource != "" {
+				resource += "/" + requestInfo.Subresource
+			}
+		}
+
+		if verb == "watch" {
+			activeWatches.WithLabelValues(name).Inc()
+			defer activeWatches.WithLabelValues(name).Dec()
+		}
+
+		start := time.Now()
+		delegate := &responseWriterDelegator{ResponseWriter: w}
+		handler.ServeHTTP(responsewriter.WrapForHTTP1Or2(delegate), req)
+		elapsed := time.Since(start)
+
+		code := strconv.Itoa(delegate.Status())
+		verbLabel := verb
+		if !verbs.Has(verbLabel) {
+			verbLabel = "other"
+		}
+		requestCounter.WithLabelValues(name, verbLabel, code).Inc()
+		if verb != "watch" {
+			requestLatencies.WithLabelValues(name, verbLabel).Observe(elapsed.Seconds())
+		}
+		if status := delegate.Status(); status == http.StatusUnauthorized || status == http.StatusForbidden {
+			rejectedRequestCounter.WithLabelValues(name, code).Inc()
+		}
+
+		klog.V(4).Infof("virtual workspace %q: %s %s (verb=%q, resource=%q): %s in %v", name, req.Method, req.URL.Path, verb, resource, code, elapsed)
+	})
+}
+
+// responseWriterDelegator records the status code written to the response.
+type responseWriterDelegator struct {
+	http.ResponseWriter
+
+	status      int
+	wroteHeader bool
+}
+
+var _ responsewriter.UserProvidedDecorator = &responseWriterDelegator{}
+
+func (r *responseWriterDelegator) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func (r *responseWriterDelegator) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.status = code
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *responseWriterDelegator) Write(b []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *responseWriterDelegator) Status() int {
+	if !r.wroteHeader {
+		return http.StatusOK
+	}
+	return r.status
+}
@@ -25,7 +25,9 @@ import (
 
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
 	"k8s.io/apiserver/pkg/authorization/authorizerfactory"
+	genericapifilters "k8s.io/apiserver/pkg/endpoints/filters"
 	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
 	genericapiserver "k8s.io/apiserver/pkg/server"
 	genericapiserveroptions "k8s.io/apiserver/pkg/server/options"
@@ -34,6 +36,7 @@ import (
 
 	"github.com/kcp-dev/kcp/pkg/virtual/framework"
 	virtualcontext "github.com/kcp-dev/kcp/pkg/virtual/framework/context"
+	virtualmetrics "github.com/kcp-dev/kcp/pkg/virtual/framework/metrics"
 )
 
 type InformerStart func(stopCh <-chan struct{})
@@ -92,7 +95,6 @@ func (c *completedConfig) WithOpenAPIAggregationController(delegatedAPIServer *g
 func (c completedConfig) New(delegationTarget genericapiserver.DelegationTarget) (*RootAPIServer, error) {
 	delegateAPIServer := delegationTarget
 
-	var readys []framework.ReadyFunc
 	vwNames := sets.NewString()
 	for _, virtualWorkspace := range c.ExtraConfig.VirtualWorkspaces {
 		name := virtualWorkspace.GetName()
@@ -106,12 +108,11 @@ func (c completedConfig) New(delegationTarget genericapiserver.DelegationTarget)
 		if err != nil {
 			return nil, err
 		}
-		readys = append(readys, virtualWorkspace.IsReady)
+		c.GenericConfig.ReadyzChecks = append(c.GenericConfig.ReadyzChecks, virtualWorkspaceReadyCheck{name: name, ready: virtualWorkspace.IsReady})
 	}
 
 	c.GenericConfig.BuildHandlerChainFunc = c.getRootHandlerChain(delegateAPIServer)
 	c.GenericConfig.RequestInfoResolver = c
-	c.GenericConfig.ReadyzChecks = append(c.GenericConfig.ReadyzChecks, asHealthCheck(readys))
 
 	genericServer, err := c.GenericConfig.New("virtual-workspaces-root-apiserver", delegateAPIServer)
 	if err != nil {
@@ -131,19 +132,19 @@ func (c completedConfig) New(delegationTarget genericapiserver.DelegationTarget)
 	return s, nil
 }
 
-type asHealthCheck []framework.ReadyFunc
+// virtualWorkspaceReadyCheck exposes the readiness of a single virtual workspace
+// as its own readyz check, named after the virtual workspace.
+type virtualWorkspaceReadyCheck struct {
+	name  string
+	ready framework.ReadyFunc
+}
 
-func (readys asHealthCheck) Name() string {
-	return "VirtualWotrkspaceAdditionalReadinessChecks"
+func (c virtualWorkspaceReadyCheck) Name() string {
+	return "virtual-workspace-" + c.name
 }
 
-func (readys asHealthCheck) Check(req *http.Request) error {
-	for _, ready := range readys {
-		if err := ready(); err != nil {
-			return err
-		}
-	}
-	return nil
+func (c virtualWorkspaceReadyCheck) Check(req *http.Request) error {
+	return c.ready()
 }
 
 func (c completedConfig) resolveRootPaths(urlPath string, requestContext context.Context) (accepted bool, prefixToStrip string, completedContext context.Context) {
@@ -157,8 +158,17 @@ func (c completedConfig) resolveRootPaths(urlPath string, requestContext context
 }
 
 func (c completedConfig) getRootHandlerChain(delegateAPIServer genericapiserver.DelegationTarget) func(http.Handler, *genericapiserver.Config) http.Handler {
+	// virtual workspaces bringing their own authorizer are authorized here, since the
+	// root API server itself allows every request.
+	authorizers := map[string]authorizer.Authorizer{}
+	for _, virtualWorkspace := range c.ExtraConfig.VirtualWorkspaces {
+		if authorizing, ok := virtualWorkspace.(framework.AuthorizingVirtualWorkspace); ok {
+			authorizers[virtualWorkspace.GetName()] = authorizing.GetAuthorizer()
+		}
+	}
+
 	return func(apiHandler http.Handler, genericConfig *genericapiserver.Config) http.Handler {
-		return genericapiserver.DefaultBuildHandlerChain(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		return virtualmetrics.WithInstrumentation(genericapiserver.DefaultBuildHandlerChain(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 			if accepted, prefixToStrip, context := c.resolveRootPaths(req.URL.Path, req.Context()); accepted {
 				req.URL.Path = strings.TrimPrefix(req.URL.Path, prefixToStrip)
 				req.URL.RawPath = strings.TrimPrefix(req.URL.RawPath, prefixToStrip)
@@ -173,14 +183,30 @@ func (c completedConfig) getRootHandlerChain(delegateAPIServer genericapiserver.
 				}
 				req = req.WithContext(context)
 				delegatedHandler := delegateAPIServer.UnprotectedHandler()
-				if delegatedHandler != nil {
-					delegatedHandler.ServeHTTP(w, req)
+				if delegatedHandler == nil {
+					return
+				}
+				if name, ok := context.Value(virtualcontext.VirtualWorkspaceNameKey).(string); ok {
+					if authz, found := authorizers[name]; found {
+						delegatedHandler = genericapifilters.WithAuthorization(delegatedHandler, authz, legacyscheme.Codecs)
+					}
 				}
+				delegatedHandler.ServeHTTP(w, req)
 				return
 			}
 			apiHandler.ServeHTTP(w, req)
-		}), c.GenericConfig.Config)
+		}), c.GenericConfig.Config), c.virtualWorkspaceName, c)
+	}
+}
+
+// virtualWorkspaceName returns the name of the virtual workspace serving the given request, if any.
+func (c completedConfig) virtualWorkspaceName(req *http.Request) (string, bool) {
+	accepted, _, completedContext := c.resolveRootPaths(req.URL.Path, req.Context())
+	if !accepted {
+		return "", false
 	}
+	name, ok := completedContext.Value(virtualcontext.VirtualWorkspaceNameKey).(string)
+	return name, ok
 }
 
 var _ genericapirequest.RequestInfoResolver = (*completedConfig)(nil)
@@ -233,8 +259,8 @@ func NewRootAPIConfig(secureServing *genericapiserveroptions.SecureServingOption
 		return nil, err
 	}
 
-	// TODO: in the future it would probably be a mix between a delegated authorizer (delegating to some KCP instance)
-	// and a specific authorizer whose rules would be defined by each prefix-based virtual workspace.
+	// Virtual workspaces implementing framework.AuthorizingVirtualWorkspace are authorized
+	// by their own authorizer, see getRootHandlerChain. The others authorize requests themselves.
 	genericConfig.Authorization.Authorizer = authorizerfactory.NewAlwaysAllowAuthorizer()
 
 	ret := &RootAPIConfig{
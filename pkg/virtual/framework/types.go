@@ -19,6 +19,7 @@ package framework
 import (
 	"context"
 
+	"k8s.io/apiserver/pkg/authorization/authorizer"
 	genericapiserver "k8s.io/apiserver/pkg/server"
 )
 
@@ -48,3 +49,28 @@ type VirtualWorkspace interface {
 	IsReady() error
 	Register(rootAPIServerConfig genericapiserver.CompletedConfig, delegateAPIServer genericapiserver.DelegationTarget) (genericapiserver.DelegationTarget, error)
 }
+
+// AuthorizingVirtualWorkspace is optionally implemented by virtual workspaces whose requests
+// should be authorized by the Root API server before being handed over to them. Requests of
+// other virtual workspaces are not authorized by the Root API server.
+type AuthorizingVirtualWorkspace interface {
+	VirtualWorkspace
+	GetAuthorizer() authorizer.Authorizer
+}
+
+// WithAuthorizer returns the given virtual workspace, with its requests authorized by the given authorizer.
+func WithAuthorizer(virtualWorkspace VirtualWorkspace, authz authorizer.Authorizer) AuthorizingVirtualWorkspace {
+	return &authorizingVirtualWorkspace{
+		VirtualWorkspace: virtualWorkspace,
+		authorizer:       authz,
+	}
+}
+
+type authorizingVirtualWorkspace struct {
+	VirtualWorkspace
+	authorizer authorizer.Authorizer
+}
+
+func (vw *authorizingVirtualWorkspace) GetAuthorizer() authorizer.Authorizer {
+	return vw.authorizer
+}
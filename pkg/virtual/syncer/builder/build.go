@@ -0,0 +1,72 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package builder
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	genericapiserver "k8s.io/apiserver/pkg/server"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	workloadinformers "github.com/kcp-dev/kcp/pkg/client/informers/externalversions/workload/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/virtual/framework"
+	"github.com/kcp-dev/kcp/pkg/virtual/framework/handler"
+	"github.com/kcp-dev/kcp/pkg/virtual/syncer"
+)
+
+const SyncerVirtualWorkspaceName string = "syncer"
+const DefaultRootPathPrefix string = "/services/syncer"
+
+// BuildVirtualWorkspace builds the syncer virtual workspace, served at
+// <rootPathPrefix>/<logical-cluster>/<workload-cluster-name>, where the logical cluster
+// is the one the WorkloadCluster object lives in.
+func BuildVirtualWorkspace(rootPathPrefix string, kcpConfig *rest.Config, kubeClusterClient *kubernetes.Cluster, dynamicClusterClient dynamic.ClusterInterface, workloadClusters workloadinformers.WorkloadClusterInformer) framework.VirtualWorkspace {
+	if !strings.HasSuffix(rootPathPrefix, "/") {
+		rootPathPrefix += "/"
+	}
+	return &handler.HandlerVirtualWorkspace{
+		Name: SyncerVirtualWorkspaceName,
+		Ready: func() error {
+			if !workloadClusters.Informer().HasSynced() {
+				return errors.New("WorkloadCluster informer is not synced")
+			}
+			return nil
+		},
+		RootPathResolver: func(urlPath string, requestContext context.Context) (accepted bool, prefixToStrip string, completedContext context.Context) {
+			completedContext = requestContext
+			if path := urlPath; strings.HasPrefix(path, rootPathPrefix) {
+				path = strings.TrimPrefix(path, rootPathPrefix)
+				segments := strings.SplitN(path, "/", 3)
+				if len(segments) < 2 || segments[0] == "" || segments[1] == "" {
+					return
+				}
+				ref := syncer.WorkloadClusterRef{ClusterName: segments[0], Name: segments[1]}
+
+				return true, rootPathPrefix + strings.Join(segments[:2], "/"), syncer.WithWorkloadCluster(requestContext, ref)
+			}
+			return
+		},
+		HandlerFactory: func(rootAPIServerConfig genericapiserver.CompletedConfig) (http.Handler, error) {
+			return syncer.NewProxy(kcpConfig, kubeClusterClient, dynamicClusterClient, workloadClusters.Lister())
+		},
+	}
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+
+	kcpclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
+	kcpinformer "github.com/kcp-dev/kcp/pkg/client/informers/externalversions"
+	"github.com/kcp-dev/kcp/pkg/virtual/framework"
+	virtualframeworkcmd "github.com/kcp-dev/kcp/pkg/virtual/framework/cmd"
+	rootapiserver "github.com/kcp-dev/kcp/pkg/virtual/framework/rootapiserver"
+	"github.com/kcp-dev/kcp/pkg/virtual/syncer/builder"
+)
+
+var _ virtualframeworkcmd.SubCommandOptions = (*SyncerSubCommandOptions)(nil)
+
+type SyncerSubCommandOptions struct {
+	RootPathPrefix string
+	KubeconfigFile string
+}
+
+func (o *SyncerSubCommandOptions) Description() virtualframeworkcmd.SubCommandDescription {
+	return virtualframeworkcmd.SubCommandDescription{
+		Name:  "syncer",
+		Use:   "syncer",
+		Short: "Launch syncer virtual workspace apiserver",
+		Long:  "Start a virtual workspace apiserver serving to syncers the resources scheduled to their workload cluster",
+	}
+}
+
+func (o *SyncerSubCommandOptions) AddFlags(flags *pflag.FlagSet) {
+	if o == nil {
+		return
+	}
+
+	flags.StringVar(&o.KubeconfigFile, "syncer:kubeconfig", "", ""+
+		"The kubeconfig file of the kcp server, with read access to the resources synced to workload clusters and the permission to impersonate the syncers.")
+
+	_ = cobra.MarkFlagRequired(flags, "kubeconfig")
+
+	flags.StringVar(&o.RootPathPrefix, "syncer:root-path-prefix", builder.DefaultRootPathPrefix, ""+
+		"The prefix of the syncer API server root path.\n"+
+		"The final syncer API root path will be of the form:\n    <root-path-prefix>/<logical-cluster>/<workload-cluster-name>")
+}
+
+func (o *SyncerSubCommandOptions) Validate() []error {
+	if o == nil {
+		return nil
+	}
+	errs := []error{}
+
+	if len(o.KubeconfigFile) == 0 {
+		errs = append(errs, errors.New("--syncer:kubeconfig is required for this command"))
+	}
+
+	if !strings.HasPrefix(o.RootPathPrefix, "/") {
+		errs = append(errs, fmt.Errorf("--syncer:root-path-prefix %v should start with /", o.RootPathPrefix))
+	}
+
+	return errs
+}
+
+func (o *SyncerSubCommandOptions) PrepareVirtualWorkspaces() ([]rootapiserver.InformerStart, []framework.VirtualWorkspace, error) {
+	kubeConfig, err := virtualframeworkcmd.ReadKubeConfig(o.KubeconfigFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	kubeClientConfig, err := kubeConfig.ClientConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	kubeClusterClient, err := kubernetes.NewClusterForConfig(kubeClientConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	dynamicClusterClient, err := dynamic.NewClusterForConfig(kubeClientConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	kcpClusterClient, err := kcpclient.NewClusterForConfig(kubeClientConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	kcpInformer := kcpinformer.NewSharedInformerFactory(kcpClusterClient.Cluster("*"), 10*time.Minute)
+
+	virtualWorkspaces := []framework.VirtualWorkspace{
+		builder.BuildVirtualWorkspace(o.RootPathPrefix, kubeClientConfig, kubeClusterClient, dynamicClusterClient, kcpInformer.Workload().V1alpha1().WorkloadClusters()),
+	}
+	informerStarts := []rootapiserver.InformerStart{
+		kcpInformer.Start,
+	}
+	return informerStarts, virtualWorkspaces, nil
+}
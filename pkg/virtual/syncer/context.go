@@ -0,0 +1,51 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+
+	"k8s.io/client-go/tools/clusters"
+)
+
+type workloadClusterKeyType string
+
+const workloadClusterKey workloadClusterKeyType = "SyncerVirtualWorkspaceWorkloadCluster"
+
+// WorkloadClusterRef identifies the workload cluster a syncer request is served for.
+type WorkloadClusterRef struct {
+	// ClusterName is the logical cluster the WorkloadCluster object lives in.
+	ClusterName string
+	// Name is the name of the WorkloadCluster object.
+	Name string
+}
+
+// Key returns the cluster-aware key of the WorkloadCluster object, as used in listers.
+func (r WorkloadClusterRef) Key() string {
+	return clusters.ToClusterAwareKey(r.ClusterName, r.Name)
+}
+
+// WithWorkloadCluster returns a copy of the context with the given workload cluster.
+func WithWorkloadCluster(ctx context.Context, ref WorkloadClusterRef) context.Context {
+	return context.WithValue(ctx, workloadClusterKey, ref)
+}
+
+// WorkloadClusterFrom returns the workload cluster stored in the context, if any.
+func WorkloadClusterFrom(ctx context.Context) (WorkloadClusterRef, bool) {
+	ref, ok := ctx.Value(workloadClusterKey).(WorkloadClusterRef)
+	return ref, ok
+}
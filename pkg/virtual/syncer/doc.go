@@ -0,0 +1,27 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package syncer implements the syncer virtual workspace, which presents to
+// a syncer exactly the resources scheduled to its workload cluster, in the
+// logical cluster of the workload cluster, so that the syncer doesn't require
+// wildcard access to kcp.
+//
+// Namespaces are only scheduled to the workload clusters of their own logical
+// cluster, so this logical cluster is the only consumer workspace of a workload
+// cluster. Serving the label of the workload cluster across all logical clusters
+// would disclose the objects scheduled to the workload clusters of the same name
+// of other workspaces.
+package syncer
@@ -0,0 +1,214 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/handlers/responsewriters"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	kcpadmissionhelpers "github.com/kcp-dev/kcp/pkg/admission/helpers"
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+	workloadlisters "github.com/kcp-dev/kcp/pkg/client/listers/workload/v1alpha1"
+	nscontroller "github.com/kcp-dev/kcp/pkg/reconciler/namespace"
+	"github.com/kcp-dev/kcp/pkg/virtual/framework/handler"
+)
+
+// SyncVerb is the verb a user must be granted on a WorkloadCluster to use
+// the syncer virtual workspace of this workload cluster.
+const SyncVerb = "sync"
+
+// Proxy serves the requests of a syncer by forwarding them to kcp, restricted
+// to the objects scheduled to the workload cluster found in the request context:
+//   - requests are served in the logical cluster of the workload cluster, where
+//     its namespaces are scheduled. Requests for other logical clusters, including
+//     the * wildcard, are forbidden, as workload clusters of the same name may
+//     exist there,
+//   - lists and watches are served with a label selector matching the objects
+//     scheduled to the workload cluster,
+//   - gets, updates and patches (including of the status subresource) are only
+//     forwarded for objects scheduled to the workload cluster, as the syncer, such
+//     that the SyncerWrites admission plugin restricts their changes to the status
+//     and the status annotation of the workload cluster,
+//   - discovery is served by the logical cluster of the workload cluster,
+//     where the APIs of the physical cluster are imported,
+//   - requests for resources not allowed by spec.syncedResources of the
+//     workload cluster are forbidden.
+type Proxy struct {
+	forwarder *handler.Forwarder
+
+	kubeClusterClient     *kubernetes.Cluster
+	dynamicClusterClient  dynamic.ClusterInterface
+	workloadClusterLister workloadlisters.WorkloadClusterLister
+	createAuthorizer      kcpadmissionhelpers.AdmissionAuthorizerFactory
+
+	requestInfoFactory *genericapirequest.RequestInfoFactory
+}
+
+// NewProxy returns a Proxy forwarding requests to kcp with the given config, which
+// must allow reading the resources synced to workload clusters and impersonating
+// the syncers.
+func NewProxy(kcpConfig *rest.Config, kubeClusterClient *kubernetes.Cluster, dynamicClusterClient dynamic.ClusterInterface, workloadClusterLister workloadlisters.WorkloadClusterLister) (*Proxy, error) {
+	forwarder, err := handler.NewForwarder(kcpConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Proxy{
+		forwarder:             forwarder,
+		kubeClusterClient:     kubeClusterClient,
+		dynamicClusterClient:  dynamicClusterClient,
+		workloadClusterLister: workloadClusterLister,
+		createAuthorizer:      kcpadmissionhelpers.NewAdmissionAuthorizer,
+		requestInfoFactory:    handler.NewRequestInfoFactory(),
+	}, nil
+}
+
+var _ http.Handler = &Proxy{}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	ref, ok := WorkloadClusterFrom(ctx)
+	if !ok {
+		responsewriters.InternalError(w, req, errors.New("no workload cluster in request context"))
+		return
+	}
+	workloadCluster, err := p.workloadClusterLister.Get(ref.Key())
+	if err != nil {
+		handler.WriteError(w, req, err)
+		return
+	}
+	u, ok := genericapirequest.UserFrom(ctx)
+	if !ok {
+		handler.WriteError(w, req, apierrors.NewUnauthorized("no user in request context"))
+		return
+	}
+	if err := p.authorize(ctx, u, ref); err != nil {
+		handler.WriteError(w, req, err)
+		return
+	}
+
+	clusterName, path := handler.SplitClusterPath(req.URL.Path)
+	if clusterName == "" {
+		clusterName = ref.ClusterName
+	}
+	if clusterName != ref.ClusterName {
+		handler.WriteError(w, req, apierrors.NewForbidden(workloadv1alpha1.Resource("workloadclusters"), ref.Name, fmt.Errorf("logical cluster %q is not served to the syncer of workload cluster %s|%s", clusterName, ref.ClusterName, ref.Name)))
+		return
+	}
+	infoReq := req.Clone(ctx)
+	infoReq.URL.Path = path
+	info, err := p.requestInfoFactory.NewRequestInfo(infoReq)
+	if err != nil {
+		handler.WriteError(w, req, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+
+	if !info.IsResourceRequest {
+		p.forwarder.Forward(w, req, ref.ClusterName, path, nil)
+		return
+	}
+
+	gvr := schema.GroupVersionResource{Group: info.APIGroup, Version: info.APIVersion, Resource: info.Resource}
+	if !(gvr.Group == "" && gvr.Resource == "namespaces") && !workloadCluster.Spec.SyncedResources.Allows(gvr) {
+		handler.WriteError(w, req, apierrors.NewForbidden(gvr.GroupResource(), info.Name, fmt.Errorf("resource is not synced to workload cluster %q", ref.Name)))
+		return
+	}
+
+	switch info.Verb {
+	case "list", "watch":
+		query := req.URL.Query()
+		query.Set("labelSelector", scheduledToSelector(query.Get("labelSelector"), ref.Name))
+		p.forwarder.Forward(w, req, clusterName, path, query)
+
+	case "get", "update", "patch":
+		if err := p.checkScheduled(ctx, clusterName, info, ref.Name); err != nil {
+			handler.WriteError(w, req, err)
+			return
+		}
+		p.forwarder.ForwardAs(w, req, clusterName, path, nil, u)
+
+	default:
+		handler.WriteError(w, req, apierrors.NewMethodNotSupported(schema.GroupResource{Group: info.APIGroup, Resource: info.Resource}, info.Verb))
+	}
+}
+
+// authorize checks that the user is allowed to sync the workload cluster.
+func (p *Proxy) authorize(ctx context.Context, u user.Info, ref WorkloadClusterRef) error {
+	authz, err := p.createAuthorizer(ref.ClusterName, p.kubeClusterClient)
+	if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+	attr := authorizer.AttributesRecord{
+		User:            u,
+		Verb:            SyncVerb,
+		APIGroup:        workloadv1alpha1.SchemeGroupVersion.Group,
+		APIVersion:      workloadv1alpha1.SchemeGroupVersion.Version,
+		Resource:        "workloadclusters",
+		Name:            ref.Name,
+		ResourceRequest: true,
+	}
+	decision, reason, err := authz.Authorize(ctx, attr)
+	if err != nil {
+		return apierrors.NewInternalError(fmt.Errorf("unable to determine access to workload cluster: %w", err))
+	}
+	if decision != authorizer.DecisionAllow {
+		return apierrors.NewForbidden(workloadv1alpha1.Resource("workloadclusters"), ref.Name, fmt.Errorf("missing verb=%q permission on workloadclusters: %s", SyncVerb, reason))
+	}
+	return nil
+}
+
+// checkScheduled returns a NotFound error if the object targeted by the request
+// is not scheduled to the given workload cluster, so that its existence is not disclosed.
+func (p *Proxy) checkScheduled(ctx context.Context, clusterName string, info *genericapirequest.RequestInfo, workloadClusterName string) error {
+	gvr := schema.GroupVersionResource{Group: info.APIGroup, Version: info.APIVersion, Resource: info.Resource}
+	namespace := info.Namespace
+	if gvr.Group == "" && gvr.Resource == "namespaces" {
+		namespace = ""
+	}
+	obj, err := p.dynamicClusterClient.Cluster(clusterName).Resource(gvr).Namespace(namespace).Get(ctx, info.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if _, ok := obj.GetLabels()[nscontroller.ClusterLabelFor(workloadClusterName)]; !ok {
+		return apierrors.NewNotFound(gvr.GroupResource(), info.Name)
+	}
+	return nil
+}
+
+// scheduledToSelector restricts the given label selector to the objects scheduled
+// to the given workload cluster.
+func scheduledToSelector(selector, workloadClusterName string) string {
+	requirement := nscontroller.ClusterLabelFor(workloadClusterName)
+	if selector == "" {
+		return requirement
+	}
+	return selector + "," + requirement
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+	workloadlisters "github.com/kcp-dev/kcp/pkg/client/listers/workload/v1alpha1"
+)
+
+func TestScheduledToSelector(t *testing.T) {
+	if got, want := scheduledToSelector("", "us-east1"), "cluster.workloads.kcp.dev/us-east1"; got != want {
+		t.Errorf("scheduledToSelector() = %q, want %q", got, want)
+	}
+	if got, want := scheduledToSelector("app=foo", "us-east1"), "app=foo,cluster.workloads.kcp.dev/us-east1"; got != want {
+		t.Errorf("scheduledToSelector() = %q, want %q", got, want)
+	}
+}
+
+func TestProxyServesTheLogicalClusterOfTheWorkloadCluster(t *testing.T) {
+	var forwarded []string
+	kcp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		forwarded = append(forwarded, req.URL.Path+"?"+req.URL.RawQuery)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"kind":"ConfigMapList","apiVersion":"v1","items":[]}`))
+	}))
+	defer kcp.Close()
+
+	// two workspaces have a workload cluster of the same name
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, clusterName := range []string{"root:org:a", "root:org:b"} {
+		require.NoError(t, indexer.Add(&workloadv1alpha1.WorkloadCluster{
+			ObjectMeta: metav1.ObjectMeta{ClusterName: clusterName, Name: "us-east1"},
+		}))
+	}
+	proxy, err := NewProxy(&rest.Config{Host: kcp.URL}, nil, nil, workloadlisters.NewWorkloadClusterLister(indexer))
+	require.NoError(t, err)
+	proxy.createAuthorizer = func(string, *kubernetes.Cluster) (authorizer.Authorizer, error) {
+		return authorizer.AuthorizerFunc(func(context.Context, authorizer.Attributes) (authorizer.Decision, string, error) {
+			return authorizer.DecisionAllow, "", nil
+		}), nil
+	}
+
+	tests := []struct {
+		name          string
+		path          string
+		wantCode      int
+		wantForwarded string
+	}{
+		{
+			name:          "list without logical cluster is served in the logical cluster of the workload cluster",
+			path:          "/api/v1/configmaps",
+			wantCode:      http.StatusOK,
+			wantForwarded: "/clusters/root:org:a/api/v1/configmaps?labelSelector=cluster.workloads.kcp.dev%2Fus-east1",
+		},
+		{
+			name:          "list in the logical cluster of the workload cluster",
+			path:          "/clusters/root:org:a/api/v1/configmaps",
+			wantCode:      http.StatusOK,
+			wantForwarded: "/clusters/root:org:a/api/v1/configmaps?labelSelector=cluster.workloads.kcp.dev%2Fus-east1",
+		},
+		{
+			name:     "wildcard list is forbidden",
+			path:     "/clusters/*/api/v1/configmaps",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "wildcard watch is forbidden",
+			path:     "/clusters/*/api/v1/configmaps?watch=true",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "list in the workspace of another workload cluster of the same name is forbidden",
+			path:     "/clusters/root:org:b/api/v1/configmaps",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "get in the workspace of another workload cluster of the same name is forbidden",
+			path:     "/clusters/root:org:b/api/v1/namespaces/default/configmaps/foo",
+			wantCode: http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forwarded = nil
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			ctx := WithWorkloadCluster(req.Context(), WorkloadClusterRef{ClusterName: "root:org:a", Name: "us-east1"})
+			ctx = genericapirequest.WithUser(ctx, &user.DefaultInfo{Name: "syncer"})
+			rec := httptest.NewRecorder()
+			proxy.ServeHTTP(rec, req.WithContext(ctx))
+
+			require.Equal(t, tt.wantCode, rec.Code, rec.Body.String())
+			if tt.wantForwarded == "" {
+				require.Empty(t, forwarded)
+			} else {
+				require.Equal(t, []string{tt.wantForwarded}, forwarded)
+			}
+		})
+	}
+}
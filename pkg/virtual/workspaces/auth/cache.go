@@ -43,6 +43,8 @@ import (
 type Lister interface {
 	// List returns the list of ClusterWorkspace items that the user can access
 	List(user user.Info, selector labels.Selector) (*workspaceapi.ClusterWorkspaceList, error)
+	// Has returns whether the user can access the ClusterWorkspace of the given name
+	Has(user user.Info, name string) bool
 }
 
 // subjectRecord is a cache record for the set of workspaces a subject can access
@@ -430,6 +432,23 @@ func (ac *AuthorizationCache) List(userInfo user.Info, selector labels.Selector)
 	return workspaceList, nil
 }
 
+// Has returns whether the user has access to view the workspace of the given name, from the
+// records of the user and its groups only.
+func (ac *AuthorizationCache) Has(userInfo user.Info, name string) bool {
+	ac.rwMutex.RLock()
+	defer ac.rwMutex.RUnlock()
+
+	if obj, exists, _ := ac.userSubjectRecordStore.GetByKey(userInfo.GetName()); exists && obj.(*subjectRecord).workspaces.Has(name) {
+		return true
+	}
+	for _, group := range userInfo.GetGroups() {
+		if obj, exists, _ := ac.groupSubjectRecordStore.GetByKey(group); exists && obj.(*subjectRecord).workspaces.Has(name) {
+			return true
+		}
+	}
+	return false
+}
+
 func (ac *AuthorizationCache) ReadyForAccess() bool {
 	ac.rwMutex.RLock()
 	defer ac.rwMutex.RUnlock()
@@ -136,7 +136,7 @@ func (o *WorkspacesSubCommandOptions) PrepareVirtualWorkspaces() ([]rootapiserve
 	ruleResolver := frameworkrbac.NewRuleResolver(singleClusterRBACV1)
 
 	virtualWorkspaces := []framework.VirtualWorkspace{
-		builder.BuildVirtualWorkspace(o.RootPathPrefix, kcpInformer.Tenancy().V1alpha1().ClusterWorkspaces(), rootKcpClient, orgKcpClient, rootKubeClient, orgKubeClient, singleClusterRBACV1, subjectLocator, ruleResolver),
+		builder.BuildVirtualWorkspace(o.RootPathPrefix, kcpInformer.Tenancy().V1alpha1().ClusterWorkspaces(), kcpInformer.Tenancy().V1alpha1().ClusterWorkspaceTypes(), rootKcpClient, orgKcpClient, rootKubeClient, orgKubeClient, singleClusterRBACV1, subjectLocator, ruleResolver),
 	}
 	informerStarts := []rootapiserver.InformerStart{
 		kubeInformers.Start,
@@ -0,0 +1,167 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package printers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apiextensions-apiserver/pkg/registry/customresource/tableconvertor"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/klog/v2"
+	kprinters "k8s.io/kubernetes/pkg/printers"
+	printerstorage "k8s.io/kubernetes/pkg/printers/storage"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	tenancyv1beta1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1beta1"
+	"github.com/kcp-dev/kcp/pkg/workspacetype"
+)
+
+// TypeResolver resolves the ClusterWorkspaceType of a type name for the workspaces of a
+// logical cluster.
+type TypeResolver interface {
+	Resolve(clusterName, typeName string) (*tenancyv1alpha1.ClusterWorkspaceType, error)
+}
+
+// NewTableConvertor returns a TableConvertor printing the columns of AddWorkspacePrintHandlers,
+// followed by the additional printer columns of the ClusterWorkspaceTypes of the printed
+// workspaces. Columns of different types with the same name are printed once, with the
+// definition of the first printed type. Columns named like a built-in column are ignored.
+func NewTableConvertor(types TypeResolver) rest.TableConvertor {
+	return &tableConvertor{
+		TableConvertor: printerstorage.TableConvertor{TableGenerator: kprinters.NewTableGenerator().With(AddWorkspacePrintHandlers)},
+		types:          types,
+	}
+}
+
+type tableConvertor struct {
+	printerstorage.TableConvertor
+	types TypeResolver
+}
+
+// typeColumns prints the additional printer columns of a ClusterWorkspaceType.
+type typeColumns struct {
+	convertor rest.TableConvertor
+	headers   []metav1.TableColumnDefinition
+}
+
+func (c *tableConvertor) ConvertToTable(ctx context.Context, obj runtime.Object, tableOptions runtime.Object) (*metav1.Table, error) {
+	table, err := c.TableConvertor.ConvertToTable(ctx, obj, tableOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	builtin := map[string]bool{}
+	for _, column := range workspaceColumnDefinitions {
+		builtin[strings.ToLower(column.Name)] = true
+	}
+
+	// the columns of the types of the rows, in order of first appearance
+	var headers []metav1.TableColumnDefinition
+	columnIndex := map[string]int{}
+	columnsByType := map[*tenancyv1alpha1.ClusterWorkspaceType]*typeColumns{}
+	rowColumns := make([]*typeColumns, len(table.Rows))
+	for i, row := range table.Rows {
+		ws, ok := row.Object.Object.(*tenancyv1beta1.Workspace)
+		if !ok {
+			continue
+		}
+		typeName := ws.Spec.Type
+		if typeName == "" {
+			typeName = workspacetype.UniversalType
+		}
+		cwt, err := c.types.Resolve(ws.ClusterName, typeName)
+		if apierrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if len(cwt.Spec.AdditionalPrinterColumns) == 0 {
+			continue
+		}
+
+		columns, found := columnsByType[cwt]
+		if !found {
+			convertor, err := tableconvertor.New(cwt.Spec.AdditionalPrinterColumns)
+			if err != nil {
+				klog.Warningf("Ignoring the additional printer columns of ClusterWorkspaceType %s|%s: %v", cwt.ClusterName, cwt.Name, err)
+				columnsByType[cwt] = nil
+				continue
+			}
+			columns = &typeColumns{convertor: convertor}
+			for _, column := range cwt.Spec.AdditionalPrinterColumns {
+				description := column.Description
+				if description == "" {
+					description = fmt.Sprintf("Workspace type column (in JSONPath format): %s", column.JSONPath)
+				}
+				columns.headers = append(columns.headers, metav1.TableColumnDefinition{
+					Name:        column.Name,
+					Type:        column.Type,
+					Format:      column.Format,
+					Description: description,
+					Priority:    column.Priority,
+				})
+			}
+			columnsByType[cwt] = columns
+
+			for _, header := range columns.headers {
+				if _, found := columnIndex[header.Name]; found || builtin[strings.ToLower(header.Name)] {
+					continue
+				}
+				columnIndex[header.Name] = len(headers)
+				headers = append(headers, header)
+			}
+		}
+		rowColumns[i] = columns
+	}
+	if len(headers) == 0 {
+		return table, nil
+	}
+
+	if len(table.ColumnDefinitions) > 0 {
+		// the built-in column definitions are shared by all tables
+		columnDefinitions := make([]metav1.TableColumnDefinition, 0, len(table.ColumnDefinitions)+len(headers))
+		table.ColumnDefinitions = append(append(columnDefinitions, table.ColumnDefinitions...), headers...)
+	}
+	for i := range table.Rows {
+		cells := make([]interface{}, len(headers))
+		if columns := rowColumns[i]; columns != nil {
+			content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(table.Rows[i].Object.Object)
+			if err != nil {
+				return nil, err
+			}
+			typeTable, err := columns.convertor.ConvertToTable(ctx, &unstructured.Unstructured{Object: content}, nil)
+			if err != nil {
+				return nil, err
+			}
+			// the cells of the type follow the name cell
+			for j, header := range columns.headers {
+				if builtin[strings.ToLower(header.Name)] {
+					continue
+				}
+				cells[columnIndex[header.Name]] = typeTable.Rows[0].Cells[j+1]
+			}
+		}
+		table.Rows[i].Cells = append(table.Rows[i].Cells, cells...)
+	}
+	return table, nil
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package printers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	tenancyv1beta1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1beta1"
+)
+
+type fakeTypeResolver map[string]*tenancyv1alpha1.ClusterWorkspaceType
+
+func (r fakeTypeResolver) Resolve(clusterName, typeName string) (*tenancyv1alpha1.ClusterWorkspaceType, error) {
+	if cwt, found := r[clusterName+"|"+typeName]; found {
+		return cwt, nil
+	}
+	return nil, apierrors.NewNotFound(tenancyv1alpha1.Resource("clusterworkspacetypes"), typeName)
+}
+
+func newType(name string, columns ...apiextensionsv1.CustomResourceColumnDefinition) *tenancyv1alpha1.ClusterWorkspaceType {
+	return &tenancyv1alpha1.ClusterWorkspaceType{
+		ObjectMeta: metav1.ObjectMeta{ClusterName: "root:org", Name: name},
+		Spec:       tenancyv1alpha1.ClusterWorkspaceTypeSpec{AdditionalPrinterColumns: columns},
+	}
+}
+
+func newWorkspace(name, typeName string, labels map[string]string) tenancyv1beta1.Workspace {
+	return tenancyv1beta1.Workspace{
+		ObjectMeta: metav1.ObjectMeta{ClusterName: "root:org", Name: name, Labels: labels},
+		Spec:       tenancyv1beta1.WorkspaceSpec{Type: typeName},
+	}
+}
+
+func TestTableConvertor(t *testing.T) {
+	environment := apiextensionsv1.CustomResourceColumnDefinition{Name: "Environment", Type: "string", JSONPath: ".metadata.labels.environment"}
+	costCenter := apiextensionsv1.CustomResourceColumnDefinition{Name: "Cost Center", Type: "string", JSONPath: ".metadata.labels.cost-center", Description: "Cost center of the team", Priority: 1}
+	phase := apiextensionsv1.CustomResourceColumnDefinition{Name: "phase", Type: "string", JSONPath: ".metadata.labels.phase"}
+	types := fakeTypeResolver{
+		"root:org|Team":      newType("team", environment, costCenter, phase),
+		"root:org|Universal": newType("universal", environment),
+		"root:org|Plain":     newType("plain"),
+	}
+
+	list := &tenancyv1beta1.WorkspaceList{Items: []tenancyv1beta1.Workspace{
+		newWorkspace("plain", "Plain", nil),
+		newWorkspace("team", "Team", map[string]string{"environment": "prod", "cost-center": "42", "phase": "beta"}),
+		newWorkspace("universal", "", map[string]string{"environment": "dev"}),
+		newWorkspace("unknown", "Unknown", map[string]string{"environment": "dev"}),
+	}}
+
+	table, err := NewTableConvertor(types).ConvertToTable(context.Background(), list, nil)
+	require.NoError(t, err)
+
+	var names []string
+	for _, column := range table.ColumnDefinitions {
+		names = append(names, column.Name)
+	}
+	require.Equal(t, []string{"Name", "Type", "Phase", "URL", "Initializers", "Age", "Environment", "Cost Center"}, names)
+	require.Equal(t, "Workspace type column (in JSONPath format): .metadata.labels.environment", table.ColumnDefinitions[6].Description)
+	require.Equal(t, "Cost center of the team", table.ColumnDefinitions[7].Description)
+	require.Equal(t, int32(1), table.ColumnDefinitions[7].Priority)
+	require.Len(t, workspaceColumnDefinitions, 6, "the built-in columns are not modified")
+
+	var cells [][]interface{}
+	for _, row := range table.Rows {
+		require.Len(t, row.Cells, len(table.ColumnDefinitions))
+		cells = append(cells, append([]interface{}{row.Cells[0]}, row.Cells[6:]...))
+	}
+	require.Equal(t, [][]interface{}{
+		{"plain", nil, nil},
+		{"team", "prod", "42"},
+		{"universal", "dev", nil},
+		{"unknown", nil, nil},
+	}, cells)
+}
+
+func TestTableConvertorWithoutColumns(t *testing.T) {
+	ws := newWorkspace("plain", "Plain", nil)
+	table, err := NewTableConvertor(fakeTypeResolver{}).ConvertToTable(context.Background(), &ws, &metav1.TableOptions{NoHeaders: true})
+	require.NoError(t, err)
+	require.Empty(t, table.ColumnDefinitions)
+	require.Len(t, table.Rows, 1)
+	require.Len(t, table.Rows[0].Cells, len(workspaceColumnDefinitions))
+}
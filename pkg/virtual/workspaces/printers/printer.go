@@ -18,37 +18,60 @@ package printers
 
 import (
 	"sort"
+	"strings"
+	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/duration"
 	kprinters "k8s.io/kubernetes/pkg/printers"
 
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
 	tenancyv1beta1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1beta1"
 )
 
-func AddWorkspacePrintHandlers(h kprinters.PrintHandler) {
-	workspaceColumnDefinitions := []metav1.TableColumnDefinition{
-		{
-			Name:        "Name",
-			Type:        "string",
-			Format:      "name",
-			Description: metav1.ObjectMeta{}.SwaggerDoc()["name"],
-			Priority:    0,
-		},
-		{
-			Name:        "Phase",
-			Type:        "string",
-			Description: "Workspace phase",
-			Priority:    1,
-		},
-		{
-			Name:        "URL",
-			Type:        "string",
-			Description: "Workspace API Server URL",
-			Priority:    2,
-		},
-	}
+// workspaceColumnDefinitions are the built-in columns of workspaces.
+var workspaceColumnDefinitions = []metav1.TableColumnDefinition{
+	{
+		Name:        "Name",
+		Type:        "string",
+		Format:      "name",
+		Description: metav1.ObjectMeta{}.SwaggerDoc()["name"],
+		Priority:    0,
+	},
+	{
+		Name:        "Type",
+		Type:        "string",
+		Description: "Workspace type",
+		Priority:    0,
+	},
+	{
+		Name:        "Phase",
+		Type:        "string",
+		Description: "Workspace phase",
+		Priority:    0,
+	},
+	{
+		Name:        "URL",
+		Type:        "string",
+		Description: "Workspace API Server URL",
+		Priority:    0,
+	},
+	{
+		Name:        "Initializers",
+		Type:        "string",
+		Description: "Initializers to clear before the workspace is ready",
+		Priority:    0,
+	},
+	{
+		Name:        "Age",
+		Type:        "string",
+		Description: metav1.ObjectMeta{}.SwaggerDoc()["creationTimestamp"],
+		Priority:    0,
+	},
+}
 
+func AddWorkspacePrintHandlers(h kprinters.PrintHandler) {
 	if err := h.TableHandler(workspaceColumnDefinitions, printWorkspaceList); err != nil {
 		panic(err)
 	}
@@ -62,7 +85,7 @@ func printWorkspace(workspace *tenancyv1beta1.Workspace, options kprinters.Gener
 		Object: runtime.RawExtension{Object: workspace},
 	}
 
-	row.Cells = append(row.Cells, workspace.Name, workspace.Status.Phase, workspace.Status.URL)
+	row.Cells = append(row.Cells, workspace.Name, workspace.Spec.Type, workspace.Status.Phase, workspace.Status.URL, printInitializers(workspace.Status.Initializers), translateTimestampSince(workspace.CreationTimestamp))
 
 	return []metav1.TableRow{row}, nil
 }
@@ -80,6 +103,28 @@ func printWorkspaceList(list *tenancyv1beta1.WorkspaceList, options kprinters.Ge
 	return rows, nil
 }
 
+// printInitializers returns the comma-separated initializers of a workspace, or <none>.
+func printInitializers(initializers []tenancyv1alpha1.ClusterWorkspaceInitializer) string {
+	if len(initializers) == 0 {
+		return "<none>"
+	}
+	names := make([]string, 0, len(initializers))
+	for _, initializer := range initializers {
+		names = append(names, string(initializer))
+	}
+	return strings.Join(names, ",")
+}
+
+// translateTimestampSince returns the elapsed time since timestamp in
+// human-readable approximation.
+func translateTimestampSince(timestamp metav1.Time) string {
+	if timestamp.IsZero() {
+		return "<unknown>"
+	}
+
+	return duration.HumanDuration(time.Since(timestamp.Time))
+}
+
 // SortableWorkspaces is a list of workspaces that can be sorted
 type SortableWorkspaces []tenancyv1beta1.Workspace
 
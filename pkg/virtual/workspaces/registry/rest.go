@@ -18,8 +18,10 @@ package registry
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"sort"
 
 	rbacv1 "k8s.io/api/rbac/v1"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
@@ -29,10 +31,12 @@ import (
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/apiserver/pkg/authentication/user"
 	kuser "k8s.io/apiserver/pkg/authentication/user"
 	apirequest "k8s.io/apiserver/pkg/endpoints/request"
 	"k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/apiserver/pkg/storage/names"
 	rbacinformers "k8s.io/client-go/informers/rbac/v1"
 	"k8s.io/client-go/kubernetes"
 	rbacv1client "k8s.io/client-go/kubernetes/typed/rbac/v1"
@@ -40,8 +44,6 @@ import (
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
 	"k8s.io/kube-openapi/pkg/util/sets"
-	"k8s.io/kubernetes/pkg/printers"
-	printerstorage "k8s.io/kubernetes/pkg/printers/storage"
 
 	"github.com/kcp-dev/kcp/pkg/apis/tenancy/projection"
 	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
@@ -112,13 +114,16 @@ func AddNameIndexers(crbInformer rbacinformers.ClusterRoleBindingInformer) error
 }
 
 var _ rest.Lister = &REST{}
+var _ rest.Watcher = &REST{}
 var _ rest.Scoper = &REST{}
 var _ rest.Creater = &REST{}
 var _ rest.GracefulDeleter = &REST{}
+var _ rest.Updater = &REST{}
 
 // NewREST returns a RESTStorage object that will work against ClusterWorkspace resources in
-// org workspaces, projecting them to the Workspace type.
-func NewREST(rootTenancyClient, orgTenancyClient tenancyclient.TenancyV1alpha1Interface, rootKubeClient, orgKubeClient kubernetes.Interface, crbInformer rbacinformers.ClusterRoleBindingInformer, workspaceReviewerProvider workspaceauth.ReviewerProvider, orgWorkspaceLister workspaceauth.Lister) (*REST, *KubeconfigSubresourceREST) {
+// org workspaces, projecting them to the Workspace type. Workspaces are printed with the
+// additional printer columns of the ClusterWorkspaceTypes resolved by typeResolver.
+func NewREST(rootTenancyClient, orgTenancyClient tenancyclient.TenancyV1alpha1Interface, rootKubeClient, orgKubeClient kubernetes.Interface, crbInformer rbacinformers.ClusterRoleBindingInformer, workspaceReviewerProvider workspaceauth.ReviewerProvider, orgWorkspaceLister workspaceauth.Lister, typeResolver workspaceprinters.TypeResolver) (*REST, *KubeconfigSubresourceREST) {
 	mainRest := &REST{
 		rbacClient:                orgKubeClient.RbacV1(),
 		crbInformer:               crbInformer,
@@ -129,7 +134,7 @@ func NewREST(rootTenancyClient, orgTenancyClient tenancyclient.TenancyV1alpha1In
 		createStrategy:            Strategy,
 		updateStrategy:            Strategy,
 
-		TableConvertor: printerstorage.TableConvertor{TableGenerator: printers.NewTableGenerator().With(workspaceprinters.AddWorkspacePrintHandlers)},
+		TableConvertor: workspaceprinters.NewTableConvertor(typeResolver),
 	}
 	return mainRest,
 		&KubeconfigSubresourceREST{
@@ -207,7 +212,7 @@ func (s *REST) List(ctx context.Context, options *metainternal.ListOptions) (run
 	// It breaks the API guarantees of lists.
 	// To make it correct we have to know the latest RV of the org workspace shard,
 	// and then wait for freshness relative to that RV of the lister.
-	labelSelector, _ := InternalListOptionsToSelectors(options)
+	labelSelector, fieldSelector := InternalListOptionsToSelectors(options)
 	clusterWorkspaceList, err := s.clusterWorkspaceLister.List(withoutGroupsWhenPersonal(user, scope), labelSelector)
 	if err != nil {
 		return nil, err
@@ -225,16 +230,110 @@ func (s *REST) List(ctx context.Context, options *metainternal.ListOptions) (run
 
 	workspaceList := &tenancyv1beta1.WorkspaceList{
 		ListMeta: clusterWorkspaceList.ListMeta,
-		Items:    make([]tenancyv1beta1.Workspace, len(clusterWorkspaceList.Items)),
+		Items:    make([]tenancyv1beta1.Workspace, 0, len(clusterWorkspaceList.Items)),
 	}
 
-	for i, cws := range clusterWorkspaceList.Items {
-		projection.ProjectClusterWorkspaceToWorkspace(&cws, &workspaceList.Items[i])
+	for i := range clusterWorkspaceList.Items {
+		var ws tenancyv1beta1.Workspace
+		projection.ProjectClusterWorkspaceToWorkspace(&clusterWorkspaceList.Items[i], &ws)
+		if !fieldSelector.Matches(workspaceFieldSet(&ws)) {
+			continue
+		}
+		workspaceList.Items = append(workspaceList.Items, ws)
+	}
+
+	if options != nil && (options.Limit > 0 || options.Continue != "") {
+		items, continueToken, err := paginateWorkspaces(workspaceList.Items, options.Limit, options.Continue)
+		if err != nil {
+			return nil, err
+		}
+		workspaceList.Items = items
+		workspaceList.Continue = continueToken
 	}
 
 	return workspaceList, nil
 }
 
+// paginateWorkspaces returns a page of at most limit workspaces following the given continue
+// token, and the continue token of the next page. The token is the name of the last workspace
+// of the previous page, as workspaces are listed from a cache and there is no consistent
+// resource version to continue from.
+func paginateWorkspaces(items []tenancyv1beta1.Workspace, limit int64, continueToken string) ([]tenancyv1beta1.Workspace, string, error) {
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Name < items[j].Name
+	})
+
+	if continueToken != "" {
+		last, err := base64.RawURLEncoding.DecodeString(continueToken)
+		if err != nil {
+			return nil, "", kerrors.NewBadRequest(fmt.Sprintf("invalid continue token: %v", err))
+		}
+		start := sort.Search(len(items), func(i int) bool {
+			return items[i].Name > string(last)
+		})
+		items = items[start:]
+	}
+
+	if limit <= 0 || int64(len(items)) <= limit {
+		return items, "", nil
+	}
+	items = items[:limit]
+	return items, base64.RawURLEncoding.EncodeToString([]byte(items[len(items)-1].Name)), nil
+}
+
+// Watch watches the Workspaces visible to the user. Permissions are evaluated for every
+// event, and workspaces losing visibility are sent as deleted.
+func (s *REST) Watch(ctx context.Context, options *metainternal.ListOptions) (watch.Interface, error) {
+	user, ok := apirequest.UserFrom(ctx)
+	if !ok {
+		return nil, kerrors.NewForbidden(tenancyv1beta1.Resource("workspaces"), "", fmt.Errorf("unable to watch workspaces without a user on the context"))
+	}
+
+	scope := ctx.Value(WorkspacesScopeKey).(string)
+
+	labelSelector, fieldSelector := InternalListOptionsToSelectors(options)
+	listOptions := metav1.ListOptions{
+		LabelSelector: labelSelector.String(),
+		Watch:         true,
+	}
+	if options != nil {
+		listOptions.ResourceVersion = options.ResourceVersion
+		listOptions.AllowWatchBookmarks = options.AllowWatchBookmarks
+		listOptions.TimeoutSeconds = options.TimeoutSeconds
+	}
+
+	w, err := s.clusterWorkspaceClient.Watch(ctx, listOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return newWorkspaceWatcher(w, s.visibleWorkspaceProjector(user, scope), fieldSelector), nil
+}
+
+// visibleWorkspaceProjector returns a projector of the ClusterWorkspaces visible to the user
+// in the given scope.
+func (s *REST) visibleWorkspaceProjector(user kuser.Info, scope string) workspaceProjector {
+	visibleTo := withoutGroupsWhenPersonal(user, scope)
+	return func(cws *tenancyv1alpha1.ClusterWorkspace) (*tenancyv1beta1.Workspace, bool) {
+		if !s.clusterWorkspaceLister.Has(visibleTo, cws.Name) {
+			return nil, false
+		}
+
+		if scope == PersonalScope {
+			prettyName, err := s.getPrettyNameFromInternalName(user, cws.Name)
+			if err != nil {
+				return nil, false
+			}
+			cws = cws.DeepCopy()
+			cws.Name = prettyName
+		}
+
+		var ws tenancyv1beta1.Workspace
+		projection.ProjectClusterWorkspaceToWorkspace(cws, &ws)
+		return &ws, true
+	}
+}
+
 var _ = rest.Getter(&REST{})
 
 // Get retrieves a Workspace by name
@@ -323,7 +422,7 @@ var roleRules map[RoleType][]rbacv1.PolicyRule = map[RoleType][]rbacv1.PolicyRul
 	},
 	OwnerRoleType: {
 		{
-			Verbs:     []string{"get", "delete"},
+			Verbs:     []string{"get", "update", "delete"},
 			Resources: []string{"workspaces"},
 		},
 		{
@@ -415,6 +514,20 @@ func (s *REST) Create(ctx context.Context, obj runtime.Object, createValidation
 	if !isWorkspace {
 		return nil, kerrors.NewInvalid(tenancyv1beta1.SchemeGroupVersion.WithKind("Workspace").GroupKind(), obj.GetObjectKind().GroupVersionKind().String(), []*field.Error{})
 	}
+	if workspace.Name == "" {
+		if workspace.GenerateName == "" {
+			return nil, kerrors.NewInvalid(tenancyv1beta1.SchemeGroupVersion.WithKind("Workspace").GroupKind(), "", field.ErrorList{field.Required(field.NewPath("metadata", "name"), "name or generateName is required")})
+		}
+		workspace.Name = names.SimpleNameGenerator.GenerateName(workspace.GenerateName)
+	}
+	if createValidation != nil {
+		if err := createValidation(ctx, workspace); err != nil {
+			return nil, err
+		}
+	}
+	if options != nil && len(options.DryRun) > 0 {
+		return s.dryRunCreate(ctx, workspace, options)
+	}
 	ownerRoleBindingName := getRoleBindingName(OwnerRoleType, workspace.Name, user)
 	listerRoleBindingName := getRoleBindingName(ListerRoleType, workspace.Name, user)
 
@@ -470,6 +583,8 @@ func (s *REST) Create(ctx context.Context, obj runtime.Object, createValidation
 			Type: workspace.Spec.Type,
 		},
 	}
+	clusterWorkspace.GenerateName = ""
+	clusterWorkspace.ManagedFields = projection.ProjectWorkspaceManagedFields(workspace.ManagedFields, nil)
 	prettyName := workspace.Name
 	var createdClusterWorkspace *tenancyv1alpha1.ClusterWorkspace
 	var err error
@@ -480,7 +595,7 @@ func (s *REST) Create(ctx context.Context, obj runtime.Object, createValidation
 			nameSuffix = fmt.Sprintf("-%d", i)
 			clusterWorkspace.Name = fmt.Sprintf("%s-%s", prettyName, nameSuffix)
 		}
-		createdClusterWorkspace, err = s.clusterWorkspaceClient.Create(ctx, clusterWorkspace, metav1.CreateOptions{})
+		createdClusterWorkspace, err = s.clusterWorkspaceClient.Create(ctx, clusterWorkspace, createOptions(options))
 		if err == nil {
 			break
 		}
@@ -493,6 +608,7 @@ func (s *REST) Create(ctx context.Context, obj runtime.Object, createValidation
 	if err != nil {
 		return nil, err
 	}
+	createdClusterWorkspace = s.restoreManagedFields(ctx, createdClusterWorkspace, clusterWorkspace.ManagedFields)
 
 	// Update the cluster roles with the new workspace internal name, and also
 	// add the internal name as a label, to allow searching with it later on.
@@ -547,6 +663,26 @@ func (s *REST) Create(ctx context.Context, obj runtime.Object, createValidation
 	return &createdWorkspace, nil
 }
 
+// dryRunCreate validates the creation of the workspace against the underlying
+// ClusterWorkspace, without creating the related RBAC objects.
+func (s *REST) dryRunCreate(ctx context.Context, workspace *tenancyv1beta1.Workspace, options *metav1.CreateOptions) (runtime.Object, error) {
+	clusterWorkspace := &tenancyv1alpha1.ClusterWorkspace{
+		ObjectMeta: workspace.ObjectMeta,
+		Spec: tenancyv1alpha1.ClusterWorkspaceSpec{
+			Type: workspace.Spec.Type,
+		},
+	}
+	clusterWorkspace.GenerateName = ""
+	clusterWorkspace.ManagedFields = projection.ProjectWorkspaceManagedFields(workspace.ManagedFields, nil)
+	created, err := s.clusterWorkspaceClient.Create(ctx, clusterWorkspace, createOptions(options))
+	if err != nil {
+		return nil, err
+	}
+	var createdWorkspace tenancyv1beta1.Workspace
+	projection.ProjectClusterWorkspaceToWorkspace(created, &createdWorkspace)
+	return &createdWorkspace, nil
+}
+
 var _ = rest.GracefulDeleter(&REST{})
 
 func (s *REST) Delete(ctx context.Context, name string, deleteValidation rest.ValidateObjectFunc, options *metav1.DeleteOptions) (runtime.Object, bool, error) {
@@ -554,6 +690,9 @@ func (s *REST) Delete(ctx context.Context, name string, deleteValidation rest.Va
 	if !ok {
 		return nil, false, kerrors.NewForbidden(tenancyv1beta1.Resource("workspace"), "", fmt.Errorf("unable to delete a workspace without a user on the context"))
 	}
+	if options == nil {
+		options = &metav1.DeleteOptions{}
+	}
 
 	internalName := name
 	if scope := ctx.Value(WorkspacesScopeKey); scope == PersonalScope {
@@ -567,29 +706,44 @@ func (s *REST) Delete(ctx context.Context, name string, deleteValidation rest.Va
 		}
 	}
 
-	review, err := s.workspaceReviewerProvider.ForVerb("delete").Review(internalName)
-	if err != nil {
+	if err := s.authorize(user, "delete", name, internalName); err != nil {
 		return nil, false, err
 	}
-	if review.EvaluationError() != "" {
-		return nil, false, kerrors.NewForbidden(tenancyv1beta1.Resource("workspace"), "", errors.New(review.EvaluationError()))
-	}
-	if !sets.NewString(user.GetGroups()...).HasAny(review.Groups()...) &&
-		!sets.NewString(review.Users()...).Has(user.GetName()) {
-		return nil, false, kerrors.NewForbidden(tenancyv1beta1.Resource("workspace"), "", fmt.Errorf("User %s doesn't have the permission to delete workspace %s", user.GetName(), name))
+
+	if deleteValidation != nil {
+		existing, err := s.getClusterWorkspace(ctx, name, nil)
+		if err != nil {
+			return nil, false, err
+		}
+		var workspace tenancyv1beta1.Workspace
+		projection.ProjectClusterWorkspaceToWorkspace(existing, &workspace)
+		if err := deleteValidation(ctx, &workspace); err != nil {
+			return nil, false, err
+		}
 	}
 
+	// Preconditions, propagation policy and dry-run apply to the ClusterWorkspace,
+	// which shares its UID and resource version with the projected Workspace.
 	errorToReturn := s.clusterWorkspaceClient.Delete(ctx, internalName, *options)
-	if err != nil && !kerrors.IsNotFound(errorToReturn) {
-		return nil, false, err
+	if errorToReturn != nil && !kerrors.IsNotFound(errorToReturn) {
+		return nil, false, errorToReturn
+	}
+	if len(options.DryRun) > 0 {
+		return nil, false, errorToReturn
+	}
+
+	// The RBAC objects of the workspace are not subject to the preconditions of the workspace.
+	rbacDeleteOptions := metav1.DeleteOptions{
+		GracePeriodSeconds: options.GracePeriodSeconds,
+		PropagationPolicy:  options.PropagationPolicy,
 	}
 	internalNameLabelSelector := fmt.Sprintf("%s=%s", InternalNameLabel, internalName)
-	if err := s.rbacClient.ClusterRoleBindings().DeleteCollection(ctx, *options, metav1.ListOptions{
+	if err := s.rbacClient.ClusterRoleBindings().DeleteCollection(ctx, rbacDeleteOptions, metav1.ListOptions{
 		LabelSelector: internalNameLabelSelector,
 	}); err != nil {
 		klog.Error(err)
 	}
-	if err := s.rbacClient.ClusterRoles().DeleteCollection(ctx, *options, metav1.ListOptions{
+	if err := s.rbacClient.ClusterRoles().DeleteCollection(ctx, rbacDeleteOptions, metav1.ListOptions{
 		LabelSelector: internalNameLabelSelector,
 	}); err != nil {
 		klog.Error(err)
@@ -597,3 +751,128 @@ func (s *REST) Delete(ctx context.Context, name string, deleteValidation rest.Va
 
 	return nil, false, errorToReturn
 }
+
+// authorize checks that the user is granted the given verb on the workspace of the given
+// internal name, whose name in the request is name.
+func (s *REST) authorize(user kuser.Info, verb, name, internalName string) error {
+	review, err := s.workspaceReviewerProvider.ForVerb(verb).Review(internalName)
+	if err != nil {
+		return err
+	}
+	if review.EvaluationError() != "" {
+		return kerrors.NewForbidden(tenancyv1beta1.Resource("workspace"), "", errors.New(review.EvaluationError()))
+	}
+	if !sets.NewString(user.GetGroups()...).HasAny(review.Groups()...) &&
+		!sets.NewString(review.Users()...).Has(user.GetName()) {
+		return kerrors.NewForbidden(tenancyv1beta1.Resource("workspace"), "", fmt.Errorf("User %s doesn't have the permission to %s workspace %s", user.GetName(), verb, name))
+	}
+	return nil
+}
+
+var _ = rest.Updater(&REST{})
+
+// Update updates the metadata of a workspace, i.e. its labels, annotations, finalizers
+// and managed fields, onto the underlying ClusterWorkspace. Together with Get, this is
+// what allows patching and server-side applying workspaces. When forceAllowCreate is
+// true, as for server-side apply, a workspace that doesn't exist yet is created, subject to
+// the checks of Create. Otherwise the user must be granted the update verb on the workspace.
+func (s *REST) Update(ctx context.Context, name string, objInfo rest.UpdatedObjectInfo, createValidation rest.ValidateObjectFunc, updateValidation rest.ValidateObjectUpdateFunc, forceAllowCreate bool, options *metav1.UpdateOptions) (runtime.Object, bool, error) {
+	user, ok := apirequest.UserFrom(ctx)
+	if !ok {
+		return nil, false, kerrors.NewForbidden(tenancyv1beta1.Resource("workspace"), "", fmt.Errorf("unable to update a workspace without a user on the context"))
+	}
+	if options == nil {
+		options = &metav1.UpdateOptions{}
+	}
+
+	existing, err := s.getClusterWorkspace(ctx, name, nil)
+	if kerrors.IsNotFound(err) && forceAllowCreate {
+		obj, err := objInfo.UpdatedObject(ctx, nil)
+		if err != nil {
+			return nil, false, err
+		}
+		created, err := s.Create(ctx, obj, createValidation, &metav1.CreateOptions{DryRun: options.DryRun, FieldManager: options.FieldManager})
+		if err != nil {
+			return nil, false, err
+		}
+		return created, true, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	internalName := name
+	if scope := ctx.Value(WorkspacesScopeKey); scope == PersonalScope {
+		internalName, err = s.getInternalNameFromPrettyName(user, name)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	if err := s.authorize(user, "update", name, internalName); err != nil {
+		return nil, false, err
+	}
+
+	var oldWorkspace tenancyv1beta1.Workspace
+	projection.ProjectClusterWorkspaceToWorkspace(existing, &oldWorkspace)
+	obj, err := objInfo.UpdatedObject(ctx, &oldWorkspace)
+	if err != nil {
+		return nil, false, err
+	}
+	workspace, isWorkspace := obj.(*tenancyv1beta1.Workspace)
+	if !isWorkspace {
+		return nil, false, kerrors.NewInvalid(tenancyv1beta1.SchemeGroupVersion.WithKind("Workspace").GroupKind(), obj.GetObjectKind().GroupVersionKind().String(), []*field.Error{})
+	}
+	if workspace.Spec.Type != oldWorkspace.Spec.Type {
+		return nil, false, kerrors.NewInvalid(tenancyv1beta1.SchemeGroupVersion.WithKind("Workspace").GroupKind(), name, field.ErrorList{field.Invalid(field.NewPath("spec", "type"), workspace.Spec.Type, "field is immutable")})
+	}
+	if updateValidation != nil {
+		if err := updateValidation(ctx, workspace, &oldWorkspace); err != nil {
+			return nil, false, err
+		}
+	}
+
+	existing.Name = internalName
+	existing.ResourceVersion = workspace.ResourceVersion
+	existing.Labels = workspace.Labels
+	existing.Annotations = workspace.Annotations
+	existing.Finalizers = workspace.Finalizers
+	existing.ManagedFields = projection.ProjectWorkspaceManagedFields(workspace.ManagedFields, existing.ManagedFields)
+	updated, err := s.clusterWorkspaceClient.Update(ctx, existing, metav1.UpdateOptions{DryRun: options.DryRun, FieldManager: options.FieldManager})
+	if err != nil {
+		return nil, false, err
+	}
+	if len(options.DryRun) == 0 {
+		updated = s.restoreManagedFields(ctx, updated, existing.ManagedFields)
+	}
+
+	var updatedWorkspace tenancyv1beta1.Workspace
+	projection.ProjectClusterWorkspaceToWorkspace(updated, &updatedWorkspace)
+	updatedWorkspace.Name = name
+	return &updatedWorkspace, false, nil
+}
+
+// restoreManagedFields sets the given managed fields onto the written ClusterWorkspace if
+// they have been changed by the write. Writes of ClusterWorkspaces record the fields they
+// change as owned by the writer, taking them over from the managers which applied them to
+// the Workspace. A second write changing nothing but the managed fields gives them back.
+// If the ClusterWorkspace has been changed by someone else meanwhile, it is returned as is.
+func (s *REST) restoreManagedFields(ctx context.Context, written *tenancyv1alpha1.ClusterWorkspace, managedFields []metav1.ManagedFieldsEntry) *tenancyv1alpha1.ClusterWorkspace {
+	if len(managedFields) == 0 || projection.EqualManagedFields(written.ManagedFields, managedFields) {
+		return written
+	}
+	restored := written.DeepCopy()
+	restored.ManagedFields = managedFields
+	restored, err := s.clusterWorkspaceClient.Update(ctx, restored, metav1.UpdateOptions{})
+	if err != nil {
+		klog.V(2).Infof("failed to restore the managed fields of ClusterWorkspace %s: %v", written.Name, err)
+		return written
+	}
+	return restored
+}
+
+func createOptions(options *metav1.CreateOptions) metav1.CreateOptions {
+	if options == nil {
+		return metav1.CreateOptions{}
+	}
+	return metav1.CreateOptions{DryRun: options.DryRun, FieldManager: options.FieldManager}
+}
@@ -19,26 +19,34 @@ package registry
 import (
 	"context"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metainternal "k8s.io/apimachinery/pkg/apis/meta/internalversion"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apimachinery/pkg/watch"
 	kuser "k8s.io/apiserver/pkg/authentication/user"
 	apirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/rest"
 	informers "k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes/fake"
 	clienttesting "k8s.io/client-go/testing"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/kubernetes/pkg/controller"
 
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/projection"
 	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
 	tenancyv1beta1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1beta1"
 	tenancyv1fake "github.com/kcp-dev/kcp/pkg/client/clientset/versioned/fake"
@@ -62,6 +70,16 @@ func (ml *mockLister) List(user kuser.Info, selector labels.Selector) (*tenancyv
 	}, nil
 }
 
+func (ml *mockLister) Has(user kuser.Info, name string) bool {
+	ml.checkedUsers = append(ml.checkedUsers, user)
+	for _, ws := range ml.workspaces {
+		if ws.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 var _ workspaceauth.Review = mockReview{}
 
 type mockReview struct {
@@ -757,7 +775,7 @@ func TestCreateWorkspace(t *testing.T) {
 					},
 					Rules: []rbacv1.PolicyRule{
 						{
-							Verbs:         []string{"get", "delete"},
+							Verbs:         []string{"get", "update", "delete"},
 							ResourceNames: []string{"foo"},
 							Resources:     []string{"workspaces"},
 							APIGroups:     []string{"tenancy.kcp.dev"},
@@ -936,7 +954,7 @@ func TestCreateWorkspaceWithPrettyName(t *testing.T) {
 					},
 					Rules: []rbacv1.PolicyRule{
 						{
-							Verbs:         []string{"get", "delete"},
+							Verbs:         []string{"get", "update", "delete"},
 							ResourceNames: []string{"foo--1"},
 							Resources:     []string{"workspaces"},
 							APIGroups:     []string{"tenancy.kcp.dev"},
@@ -1467,3 +1485,292 @@ func TestDeletePersonalWorkspaceWithPrettyName(t *testing.T) {
 	}
 	applyTest(t, test)
 }
+
+func TestListOrganizationWorkspacesPaginated(t *testing.T) {
+	user := &kuser.DefaultInfo{
+		Name:   "test-user",
+		UID:    "test-uid",
+		Groups: []string{"test-group"},
+	}
+	test := TestDescription{
+		TestData: TestData{
+			user:  user,
+			scope: OrganizationScope,
+			clusterWorkspaces: []tenancyv1alpha1.ClusterWorkspace{
+				{ObjectMeta: metav1.ObjectMeta{Name: "foo"}},
+				{ObjectMeta: metav1.ObjectMeta{Name: "bar"}},
+				{ObjectMeta: metav1.ObjectMeta{Name: "baz"}},
+			},
+		},
+		apply: func(t *testing.T, storage *REST, kubeconfigSubResourceStorage *KubeconfigSubresourceREST, ctx context.Context, kubeClient *fake.Clientset, kcpClient *tenancyv1fake.Clientset, listerCheckedUsers func() []kuser.Info, testData TestData) {
+			response, err := storage.List(ctx, &metainternal.ListOptions{Limit: 2})
+			require.NoError(t, err)
+			workspaces := response.(*tenancyv1beta1.WorkspaceList)
+			require.Len(t, workspaces.Items, 2)
+			assert.Equal(t, "bar", workspaces.Items[0].Name)
+			assert.Equal(t, "baz", workspaces.Items[1].Name)
+			require.NotEmpty(t, workspaces.Continue)
+
+			response, err = storage.List(ctx, &metainternal.ListOptions{Limit: 2, Continue: workspaces.Continue})
+			require.NoError(t, err)
+			workspaces = response.(*tenancyv1beta1.WorkspaceList)
+			require.Len(t, workspaces.Items, 1)
+			assert.Equal(t, "foo", workspaces.Items[0].Name)
+			assert.Empty(t, workspaces.Continue)
+
+			response, err = storage.List(ctx, &metainternal.ListOptions{FieldSelector: fields.OneTermEqualSelector("metadata.name", "baz")})
+			require.NoError(t, err)
+			workspaces = response.(*tenancyv1beta1.WorkspaceList)
+			require.Len(t, workspaces.Items, 1)
+			assert.Equal(t, "baz", workspaces.Items[0].Name)
+		},
+	}
+	applyTest(t, test)
+}
+
+func TestWatchOrganizationWorkspaces(t *testing.T) {
+	user := &kuser.DefaultInfo{
+		Name:   "test-user",
+		UID:    "test-uid",
+		Groups: []string{"test-group"},
+	}
+	test := TestDescription{
+		TestData: TestData{
+			user:  user,
+			scope: OrganizationScope,
+			workspaceLister: &mockLister{
+				workspaces: []tenancyv1alpha1.ClusterWorkspace{
+					{ObjectMeta: metav1.ObjectMeta{Name: "foo"}},
+				},
+			},
+		},
+		apply: func(t *testing.T, storage *REST, kubeconfigSubResourceStorage *KubeconfigSubresourceREST, ctx context.Context, kubeClient *fake.Clientset, kcpClient *tenancyv1fake.Clientset, listerCheckedUsers func() []kuser.Info, testData TestData) {
+			w, err := storage.Watch(ctx, &metainternal.ListOptions{})
+			require.NoError(t, err)
+			defer w.Stop()
+
+			_, err = kcpClient.TenancyV1alpha1().ClusterWorkspaces().Create(ctx, &tenancyv1alpha1.ClusterWorkspace{ObjectMeta: metav1.ObjectMeta{Name: "bar"}}, metav1.CreateOptions{})
+			require.NoError(t, err)
+			_, err = kcpClient.TenancyV1alpha1().ClusterWorkspaces().Create(ctx, &tenancyv1alpha1.ClusterWorkspace{ObjectMeta: metav1.ObjectMeta{Name: "foo"}}, metav1.CreateOptions{})
+			require.NoError(t, err)
+
+			select {
+			case event := <-w.ResultChan():
+				assert.Equal(t, watch.Added, event.Type)
+				workspace, ok := event.Object.(*tenancyv1beta1.Workspace)
+				require.True(t, ok, "expected a Workspace, got %T", event.Object)
+				assert.Equal(t, "foo", workspace.Name)
+			case <-time.After(wait.ForeverTestTimeout):
+				t.Fatal("timed out waiting for watch event")
+			}
+		},
+	}
+	applyTest(t, test)
+}
+
+func TestCreateWorkspaceWithGenerateName(t *testing.T) {
+	user := &kuser.DefaultInfo{
+		Name:   "test-user",
+		UID:    "test-uid",
+		Groups: []string{"test-group"},
+	}
+	test := TestDescription{
+		TestData: TestData{
+			user:  user,
+			scope: PersonalScope,
+			reviewerProvider: mockReviewerProvider{
+				"get":    mockReviewer{},
+				"delete": mockReviewer{},
+			},
+		},
+		apply: func(t *testing.T, storage *REST, kubeconfigSubResourceStorage *KubeconfigSubresourceREST, ctx context.Context, kubeClient *fake.Clientset, kcpClient *tenancyv1fake.Clientset, listerCheckedUsers func() []kuser.Info, testData TestData) {
+			newWorkspace := tenancyv1beta1.Workspace{
+				ObjectMeta: metav1.ObjectMeta{
+					GenerateName: "foo-",
+				},
+			}
+			response, err := storage.Create(ctx, &newWorkspace, nil, &metav1.CreateOptions{})
+			require.NoError(t, err)
+			require.IsType(t, &tenancyv1beta1.Workspace{}, response)
+			workspace := response.(*tenancyv1beta1.Workspace)
+			assert.True(t, strings.HasPrefix(workspace.Name, "foo-"), "expected a generated name, got %q", workspace.Name)
+			assert.Greater(t, len(workspace.Name), len("foo-"))
+
+			_, err = kcpClient.TenancyV1alpha1().ClusterWorkspaces().Get(ctx, workspace.Name, metav1.GetOptions{})
+			require.NoError(t, err)
+			_, err = kubeClient.RbacV1().ClusterRoleBindings().Get(ctx, getRoleBindingName(OwnerRoleType, workspace.Name, user), metav1.GetOptions{})
+			require.NoError(t, err)
+		},
+	}
+	applyTest(t, test)
+}
+
+func TestUpdateOrganizationWorkspace(t *testing.T) {
+	user := &kuser.DefaultInfo{
+		Name:   "test-user",
+		UID:    "test-uid",
+		Groups: []string{"test-group"},
+	}
+	test := TestDescription{
+		TestData: TestData{
+			user:  user,
+			scope: OrganizationScope,
+			clusterWorkspaces: []tenancyv1alpha1.ClusterWorkspace{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "foo"},
+					Spec:       tenancyv1alpha1.ClusterWorkspaceSpec{Type: "Universal"},
+					Status:     tenancyv1alpha1.ClusterWorkspaceStatus{Phase: tenancyv1alpha1.ClusterWorkspacePhaseReady},
+				},
+			},
+			reviewerProvider: mockReviewerProvider{
+				"update": mockReviewer{
+					"foo": mockReview{
+						groups: []string{"test-group"},
+					},
+				},
+			},
+		},
+		apply: func(t *testing.T, storage *REST, kubeconfigSubResourceStorage *KubeconfigSubresourceREST, ctx context.Context, kubeClient *fake.Clientset, kcpClient *tenancyv1fake.Clientset, listerCheckedUsers func() []kuser.Info, testData TestData) {
+			updated := &tenancyv1beta1.Workspace{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo", Labels: map[string]string{"team": "a"}},
+				Spec:       tenancyv1beta1.WorkspaceSpec{Type: "Universal"},
+			}
+			response, created, err := storage.Update(ctx, "foo", rest.DefaultUpdatedObjectInfo(updated), nil, nil, false, &metav1.UpdateOptions{})
+			require.NoError(t, err)
+			assert.False(t, created)
+			workspace := response.(*tenancyv1beta1.Workspace)
+			assert.Equal(t, "foo", workspace.Name)
+			assert.Equal(t, map[string]string{"team": "a"}, workspace.Labels)
+			assert.Equal(t, tenancyv1alpha1.ClusterWorkspacePhaseReady, workspace.Status.Phase)
+
+			clusterWorkspace, err := kcpClient.TenancyV1alpha1().ClusterWorkspaces().Get(ctx, "foo", metav1.GetOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, map[string]string{"team": "a"}, clusterWorkspace.Labels)
+
+			updated.Spec.Type = "Organization"
+			_, _, err = storage.Update(ctx, "foo", rest.DefaultUpdatedObjectInfo(updated), nil, nil, false, &metav1.UpdateOptions{})
+			require.Error(t, err, "the type of a workspace should be immutable")
+
+			status, err := NewStatusREST(storage).Get(ctx, "foo", nil)
+			require.NoError(t, err)
+			assert.Equal(t, tenancyv1alpha1.ClusterWorkspacePhaseReady, status.(*tenancyv1beta1.Workspace).Status.Phase)
+		},
+	}
+	applyTest(t, test)
+}
+
+func TestUpdateOrganizationWorkspaceForbidden(t *testing.T) {
+	user := &kuser.DefaultInfo{
+		Name:   "test-user",
+		UID:    "test-uid",
+		Groups: []string{"test-group"},
+	}
+	test := TestDescription{
+		TestData: TestData{
+			user:  user,
+			scope: OrganizationScope,
+			clusterWorkspaces: []tenancyv1alpha1.ClusterWorkspace{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "foo"},
+					Spec:       tenancyv1alpha1.ClusterWorkspaceSpec{Type: "Universal"},
+					Status:     tenancyv1alpha1.ClusterWorkspaceStatus{Phase: tenancyv1alpha1.ClusterWorkspacePhaseReady},
+				},
+			},
+			reviewerProvider: mockReviewerProvider{
+				"update": mockReviewer{
+					"foo": mockReview{
+						users:  []string{"another-user"},
+						groups: []string{"another-group"},
+					},
+				},
+			},
+		},
+		apply: func(t *testing.T, storage *REST, kubeconfigSubResourceStorage *KubeconfigSubresourceREST, ctx context.Context, kubeClient *fake.Clientset, kcpClient *tenancyv1fake.Clientset, listerCheckedUsers func() []kuser.Info, testData TestData) {
+			updated := &tenancyv1beta1.Workspace{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo", Labels: map[string]string{"team": "a"}},
+				Spec:       tenancyv1beta1.WorkspaceSpec{Type: "Universal"},
+			}
+			for _, forceAllowCreate := range []bool{false, true} {
+				_, _, err := storage.Update(ctx, "foo", rest.DefaultUpdatedObjectInfo(updated), nil, nil, forceAllowCreate, &metav1.UpdateOptions{})
+				require.Error(t, err)
+				assert.True(t, kerrors.IsForbidden(err), "expected a Forbidden error, got %v", err)
+			}
+
+			clusterWorkspace, err := kcpClient.TenancyV1alpha1().ClusterWorkspaces().Get(ctx, "foo", metav1.GetOptions{})
+			require.NoError(t, err)
+			assert.Empty(t, clusterWorkspace.Labels)
+		},
+	}
+	applyTest(t, test)
+}
+
+func TestUpdateOrganizationWorkspaceManagedFields(t *testing.T) {
+	user := &kuser.DefaultInfo{
+		Name:   "test-user",
+		UID:    "test-uid",
+		Groups: []string{"test-group"},
+	}
+	managedFields := func(manager string, operation metav1.ManagedFieldsOperationType, apiVersion, fields string) metav1.ManagedFieldsEntry {
+		return metav1.ManagedFieldsEntry{Manager: manager, Operation: operation, APIVersion: apiVersion, FieldsType: "FieldsV1", FieldsV1: &metav1.FieldsV1{Raw: []byte(fields)}}
+	}
+	test := TestDescription{
+		TestData: TestData{
+			user:  user,
+			scope: OrganizationScope,
+			clusterWorkspaces: []tenancyv1alpha1.ClusterWorkspace{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "foo", ManagedFields: []metav1.ManagedFieldsEntry{
+						managedFields("kcp", metav1.ManagedFieldsOperationUpdate, "tenancy.kcp.dev/v1alpha1", `{"f:status":{"f:phase":{},"f:conditions":{}}}`),
+					}},
+					Spec:   tenancyv1alpha1.ClusterWorkspaceSpec{Type: "Universal"},
+					Status: tenancyv1alpha1.ClusterWorkspaceStatus{Phase: tenancyv1alpha1.ClusterWorkspacePhaseReady},
+				},
+			},
+			reviewerProvider: mockReviewerProvider{
+				"update": mockReviewer{
+					"foo": mockReview{
+						users: []string{"test-user"},
+					},
+				},
+			},
+		},
+		apply: func(t *testing.T, storage *REST, kubeconfigSubResourceStorage *KubeconfigSubresourceREST, ctx context.Context, kubeClient *fake.Clientset, kcpClient *tenancyv1fake.Clientset, listerCheckedUsers func() []kuser.Info, testData TestData) {
+			// Like the field manager of ClusterWorkspaces, take the changed fields over on the first update.
+			tookOver := false
+			kcpClient.PrependReactor("update", "clusterworkspaces", func(action clienttesting.Action) (bool, runtime.Object, error) {
+				if tookOver {
+					return false, nil, nil
+				}
+				tookOver = true
+				cws := action.(clienttesting.UpdateAction).GetObject().(*tenancyv1alpha1.ClusterWorkspace).DeepCopy()
+				cws.ManagedFields = []metav1.ManagedFieldsEntry{
+					managedFields("kcp", metav1.ManagedFieldsOperationUpdate, "tenancy.kcp.dev/v1alpha1", `{"f:status":{"f:phase":{},"f:conditions":{}}}`),
+					managedFields("virtual-workspaces", metav1.ManagedFieldsOperationUpdate, "tenancy.kcp.dev/v1alpha1", `{"f:metadata":{"f:labels":{"f:team":{}}}}`),
+				}
+				err := kcpClient.Tracker().Update(tenancyv1alpha1.SchemeGroupVersion.WithResource("clusterworkspaces"), cws, "")
+				return true, cws, err
+			})
+
+			applied := &tenancyv1beta1.Workspace{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo", Labels: map[string]string{"team": "a"}, ManagedFields: []metav1.ManagedFieldsEntry{
+					managedFields("kubectl", metav1.ManagedFieldsOperationApply, "tenancy.kcp.dev/v1beta1", `{"f:metadata":{"f:labels":{"f:team":{}}}}`),
+					managedFields("kcp", metav1.ManagedFieldsOperationUpdate, "tenancy.kcp.dev/v1beta1", `{"f:status":{"f:phase":{}}}`),
+				}},
+				Spec: tenancyv1beta1.WorkspaceSpec{Type: "Universal"},
+			}
+			response, _, err := storage.Update(ctx, "foo", rest.DefaultUpdatedObjectInfo(applied), nil, nil, false, &metav1.UpdateOptions{FieldManager: "kubectl"})
+			require.NoError(t, err)
+			assert.True(t, tookOver)
+
+			clusterWorkspace, err := kcpClient.TenancyV1alpha1().ClusterWorkspaces().Get(ctx, "foo", metav1.GetOptions{})
+			require.NoError(t, err)
+			expected := []metav1.ManagedFieldsEntry{
+				managedFields("kcp", metav1.ManagedFieldsOperationUpdate, "tenancy.kcp.dev/v1alpha1", `{"f:status":{"f:phase":{},"f:conditions":{}}}`),
+				managedFields("kubectl", metav1.ManagedFieldsOperationApply, "tenancy.kcp.dev/v1alpha1", `{"f:metadata":{"f:labels":{"f:team":{}}}}`),
+			}
+			assert.True(t, projection.EqualManagedFields(expected, clusterWorkspace.ManagedFields), "unexpected managed fields %v", clusterWorkspace.ManagedFields)
+			assert.ElementsMatch(t, applied.ManagedFields, response.(*tenancyv1beta1.Workspace).ManagedFields)
+		},
+	}
+	applyTest(t, test)
+}
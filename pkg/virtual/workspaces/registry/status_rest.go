@@ -0,0 +1,55 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/registry/rest"
+
+	tenancyv1beta1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1beta1"
+)
+
+// StatusREST implements the status subresource of workspaces. The status is
+// owned by the underlying ClusterWorkspace, so it is read-only.
+type StatusREST struct {
+	mainRest *REST
+}
+
+// NewStatusREST returns the status subresource storage of the given workspace storage.
+func NewStatusREST(mainRest *REST) *StatusREST {
+	return &StatusREST{mainRest: mainRest}
+}
+
+var _ rest.Getter = &StatusREST{}
+var _ rest.Scoper = &StatusREST{}
+
+// New returns a new Workspace
+func (s *StatusREST) New() runtime.Object {
+	return &tenancyv1beta1.Workspace{}
+}
+
+func (s *StatusREST) NamespaceScoped() bool {
+	return false
+}
+
+// Get retrieves a Workspace, with its status, by name
+func (s *StatusREST) Get(ctx context.Context, name string, options *metav1.GetOptions) (runtime.Object, error) {
+	return s.mainRest.Get(ctx, name, options)
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	tenancyv1beta1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1beta1"
+)
+
+// workspaceProjector returns the Workspace projection of a ClusterWorkspace, or false
+// if the ClusterWorkspace is not visible to the watching user.
+type workspaceProjector func(*tenancyv1alpha1.ClusterWorkspace) (*tenancyv1beta1.Workspace, bool)
+
+// workspaceWatcher turns a watch of ClusterWorkspaces into a watch of the Workspaces
+// visible to a user. Workspaces becoming visible are added, and those becoming invisible
+// are deleted from the point of view of the watching user.
+type workspaceWatcher struct {
+	in            watch.Interface
+	project       workspaceProjector
+	fieldSelector fields.Selector
+
+	// sent holds the last Workspaces sent to the watcher by internal name.
+	sent map[string]*tenancyv1beta1.Workspace
+
+	result   chan watch.Event
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+var _ watch.Interface = &workspaceWatcher{}
+
+func newWorkspaceWatcher(in watch.Interface, project workspaceProjector, fieldSelector fields.Selector) *workspaceWatcher {
+	w := &workspaceWatcher{
+		in:            in,
+		project:       project,
+		fieldSelector: fieldSelector,
+		sent:          map[string]*tenancyv1beta1.Workspace{},
+		result:        make(chan watch.Event),
+		stopCh:        make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *workspaceWatcher) ResultChan() <-chan watch.Event {
+	return w.result
+}
+
+func (w *workspaceWatcher) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stopCh)
+		w.in.Stop()
+	})
+}
+
+func (w *workspaceWatcher) run() {
+	defer close(w.result)
+	for {
+		select {
+		case <-w.stopCh:
+			return
+		case event, ok := <-w.in.ResultChan():
+			if !ok {
+				return
+			}
+			converted, ok := w.convert(event)
+			if !ok {
+				continue
+			}
+			select {
+			case w.result <- converted:
+			case <-w.stopCh:
+				return
+			}
+		}
+	}
+}
+
+func (w *workspaceWatcher) convert(event watch.Event) (watch.Event, bool) {
+	cws, ok := event.Object.(*tenancyv1alpha1.ClusterWorkspace)
+	if !ok {
+		return event, event.Type == watch.Error
+	}
+
+	if event.Type == watch.Bookmark {
+		bookmark := &tenancyv1beta1.Workspace{}
+		bookmark.ResourceVersion = cws.ResourceVersion
+		return watch.Event{Type: watch.Bookmark, Object: bookmark}, true
+	}
+
+	ws, visible := w.project(cws)
+	if visible && !w.fieldSelector.Matches(workspaceFieldSet(ws)) {
+		visible = false
+	}
+	last, wasSent := w.sent[cws.Name]
+
+	switch {
+	case event.Type == watch.Deleted || (!visible && wasSent):
+		if !wasSent {
+			return event, false
+		}
+		delete(w.sent, cws.Name)
+		deleted := last.DeepCopy()
+		deleted.ResourceVersion = cws.ResourceVersion
+		return watch.Event{Type: watch.Deleted, Object: deleted}, true
+	case visible && wasSent:
+		w.sent[cws.Name] = ws
+		return watch.Event{Type: watch.Modified, Object: ws}, true
+	case visible:
+		w.sent[cws.Name] = ws
+		return watch.Event{Type: watch.Added, Object: ws}, true
+	}
+	return event, false
+}
+
+// workspaceFieldSet returns the fields of a Workspace supported in field selectors.
+func workspaceFieldSet(ws *tenancyv1beta1.Workspace) fields.Set {
+	return fields.Set{
+		"metadata.name": ws.Name,
+		"spec.type":     ws.Spec.Type,
+		"status.phase":  string(ws.Status.Phase),
+	}
+}
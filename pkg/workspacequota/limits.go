@@ -0,0 +1,157 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package workspacequota resolves the limits of the WorkspaceResourceQuotas in effect
+// for a workspace, shared by the admission plugin enforcing them and the controller
+// publishing their usage.
+package workspacequota
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/client-go/tools/cache"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+)
+
+// ByLogicalClusterIndex is the name of the index of WorkspaceResourceQuotas by the
+// logical cluster they are created in.
+const ByLogicalClusterIndex = "workspacequota-byLogicalCluster"
+
+// IndexByLogicalCluster indexes WorkspaceResourceQuotas by the logical cluster they are created in.
+func IndexByLogicalCluster(obj interface{}) ([]string, error) {
+	quota, ok := obj.(*tenancyv1alpha1.WorkspaceResourceQuota)
+	if !ok {
+		return nil, fmt.Errorf("obj is supposed to be a WorkspaceResourceQuota, but is %T", obj)
+	}
+	return []string{quota.ClusterName}, nil
+}
+
+// AddIndexers adds the ByLogicalClusterIndex to the given WorkspaceResourceQuota informer,
+// unless added already.
+func AddIndexers(informer cache.SharedIndexInformer) error {
+	if _, found := informer.GetIndexer().GetIndexers()[ByLogicalClusterIndex]; found {
+		return nil
+	}
+	return informer.AddIndexers(cache.Indexers{
+		ByLogicalClusterIndex: IndexByLogicalCluster,
+	})
+}
+
+// Limit is a limit in effect for a workspace, with the quota it is set by.
+type Limit struct {
+	Value int64
+	Quota *tenancyv1alpha1.WorkspaceResourceQuota
+}
+
+// Limits are the limits in effect for a workspace.
+type Limits struct {
+	// ObjectCount holds the limits per resource of the form <resource>[.<group>].
+	ObjectCount map[string]Limit
+	// TotalObjectCount is the limit of all the namespaced resources, nil if not limited.
+	TotalObjectCount *Limit
+}
+
+// Empty returns true if no limit is in effect.
+func (l Limits) Empty() bool {
+	return len(l.ObjectCount) == 0 && l.TotalObjectCount == nil
+}
+
+// Resolve returns the limits in effect for the child workspace of the given name among
+// the given quotas of its parent workspace. The limits of the quotas naming the
+// workspace override the limits of the quotas applying to all the child workspaces. Of
+// the quotas of the same kind, the lowest limit applies, the one of the quota with the
+// lowest name if equal.
+func Resolve(quotas []*tenancyv1alpha1.WorkspaceResourceQuota, workspace string) Limits {
+	var named, all []*tenancyv1alpha1.WorkspaceResourceQuota
+	for _, quota := range quotas {
+		if len(quota.Spec.Workspaces) == 0 {
+			all = append(all, quota)
+			continue
+		}
+		for _, name := range quota.Spec.Workspaces {
+			if name == workspace {
+				named = append(named, quota)
+				break
+			}
+		}
+	}
+
+	limits := Limits{ObjectCount: map[string]Limit{}}
+	for _, quotas := range [][]*tenancyv1alpha1.WorkspaceResourceQuota{named, all} {
+		resolved := Limits{ObjectCount: map[string]Limit{}}
+		for _, quota := range quotas {
+			for resource, value := range quota.Spec.ObjectCount {
+				if _, overridden := limits.ObjectCount[resource]; overridden {
+					continue
+				}
+				if current, found := resolved.ObjectCount[resource]; !found || lower(Limit{value, quota}, current) {
+					resolved.ObjectCount[resource] = Limit{value, quota}
+				}
+			}
+			if quota.Spec.TotalObjectCount != nil && limits.TotalObjectCount == nil {
+				if candidate := (Limit{*quota.Spec.TotalObjectCount, quota}); resolved.TotalObjectCount == nil || lower(candidate, *resolved.TotalObjectCount) {
+					resolved.TotalObjectCount = &candidate
+				}
+			}
+		}
+		for resource, limit := range resolved.ObjectCount {
+			limits.ObjectCount[resource] = limit
+		}
+		if resolved.TotalObjectCount != nil {
+			limits.TotalObjectCount = resolved.TotalObjectCount
+		}
+	}
+	return limits
+}
+
+func lower(a, b Limit) bool {
+	if a.Value != b.Value {
+		return a.Value < b.Value
+	}
+	return a.Quota.Name < b.Quota.Name
+}
+
+// ForLogicalCluster returns the name of the workspace of the given logical cluster and
+// the limits in effect for it, resolved from the quotas of the parent workspace in the
+// given indexer, indexed by ByLogicalClusterIndex. It returns false for logical clusters
+// not defined by a ClusterWorkspace.
+func ForLogicalCluster(indexer cache.Indexer, clusterName string) (string, Limits, bool, error) {
+	if clusterName == helper.RootCluster || strings.HasPrefix(clusterName, helper.LocalSystemClusterPrefix) {
+		return "", Limits{}, false, nil
+	}
+	parent, err := helper.ParentClusterName(clusterName)
+	if err != nil {
+		// nolint: nilerr
+		return "", Limits{}, false, nil
+	}
+	_, workspace, err := helper.ParseLogicalClusterName(clusterName)
+	if err != nil {
+		// nolint: nilerr
+		return "", Limits{}, false, nil
+	}
+	objs, err := indexer.ByIndex(ByLogicalClusterIndex, parent)
+	if err != nil {
+		return "", Limits{}, false, err
+	}
+	quotas := make([]*tenancyv1alpha1.WorkspaceResourceQuota, 0, len(objs))
+	for _, obj := range objs {
+		quotas = append(quotas, obj.(*tenancyv1alpha1.WorkspaceResourceQuota))
+	}
+	return workspace, Resolve(quotas, workspace), true, nil
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workspacequota
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+)
+
+func newQuota(clusterName, name string, workspaces []string, objectCount map[string]int64, total *int64) *tenancyv1alpha1.WorkspaceResourceQuota {
+	return &tenancyv1alpha1.WorkspaceResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{ClusterName: clusterName, Name: name},
+		Spec: tenancyv1alpha1.WorkspaceResourceQuotaSpec{
+			Workspaces:       workspaces,
+			ObjectCount:      objectCount,
+			TotalObjectCount: total,
+		},
+	}
+}
+
+func int64Ptr(i int64) *int64 {
+	return &i
+}
+
+func TestResolve(t *testing.T) {
+	defaults := newQuota("root:org", "defaults", nil, map[string]int64{"configmaps": 100, "secrets": 50}, int64Ptr(1000))
+	strict := newQuota("root:org", "strict", nil, map[string]int64{"configmaps": 10}, nil)
+	team := newQuota("root:org", "team", []string{"team", "other"}, map[string]int64{"configmaps": 500}, int64Ptr(5000))
+	quotas := []*tenancyv1alpha1.WorkspaceResourceQuota{team, strict, defaults}
+
+	limits := Resolve(quotas, "unnamed")
+	require.Equal(t, map[string]Limit{"configmaps": {10, strict}, "secrets": {50, defaults}}, limits.ObjectCount, "the lowest limit of the quotas for all workspaces applies")
+	require.Equal(t, &Limit{1000, defaults}, limits.TotalObjectCount)
+
+	limits = Resolve(quotas, "team")
+	require.Equal(t, map[string]Limit{"configmaps": {500, team}, "secrets": {50, defaults}}, limits.ObjectCount, "the quotas naming the workspace override the others per resource")
+	require.Equal(t, &Limit{5000, team}, limits.TotalObjectCount)
+
+	require.True(t, Resolve(nil, "team").Empty())
+}
+
+func TestForLogicalCluster(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{ByLogicalClusterIndex: IndexByLogicalCluster})
+	require.NoError(t, indexer.Add(newQuota("root:org", "defaults", nil, map[string]int64{"configmaps": 100}, nil)))
+	require.NoError(t, indexer.Add(newQuota("root:other", "defaults", nil, map[string]int64{"configmaps": 1}, nil)))
+
+	workspace, limits, ok, err := ForLogicalCluster(indexer, "org:team")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "team", workspace)
+	require.Equal(t, int64(100), limits.ObjectCount["configmaps"].Value)
+
+	for _, clusterName := range []string{"root", "system:admin"} {
+		_, _, ok, err = ForLogicalCluster(indexer, clusterName)
+		require.NoError(t, err)
+		require.False(t, ok, "%s is not defined by a ClusterWorkspace", clusterName)
+	}
+}
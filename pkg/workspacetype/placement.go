@@ -0,0 +1,98 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workspacetype
+
+import (
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+)
+
+// Placements returns the placements constraining the shards the given ClusterWorkspace of
+// the given logical cluster is scheduled to, i.e. the ones of the workspace and of its
+// type, if any.
+func (r *Resolver) Placements(clusterName string, ws *tenancyv1alpha1.ClusterWorkspace) ([]*tenancyv1alpha1.ClusterWorkspacePlacement, error) {
+	var placements []*tenancyv1alpha1.ClusterWorkspacePlacement
+	if ws.Spec.Placement != nil {
+		placements = append(placements, ws.Spec.Placement)
+	}
+	cwt, err := r.Resolve(clusterName, TypeName(ws))
+	if apierrors.IsNotFound(err) {
+		return placements, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if cwt.Spec.Placement != nil {
+		placements = append(placements, cwt.Spec.Placement)
+	}
+	return placements, nil
+}
+
+// SatisfiesPlacements returns whether the labels of the given WorkspaceShard match the
+// required selectors of all the given placements.
+func SatisfiesPlacements(shard *tenancyv1alpha1.WorkspaceShard, placements []*tenancyv1alpha1.ClusterWorkspacePlacement) (bool, error) {
+	for _, placement := range placements {
+		if placement.Required == nil {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(placement.Required)
+		if err != nil {
+			return false, err
+		}
+		if !selector.Matches(labels.Set(shard.Labels)) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// PlacementScore returns the sum of the weights of the preferred selectors of the given
+// placements matching the labels of the given WorkspaceShard.
+func PlacementScore(shard *tenancyv1alpha1.WorkspaceShard, placements []*tenancyv1alpha1.ClusterWorkspacePlacement) (int64, error) {
+	var score int64
+	for _, placement := range placements {
+		for i := range placement.Preferred {
+			selector, err := metav1.LabelSelectorAsSelector(&placement.Preferred[i].Selector)
+			if err != nil {
+				return 0, err
+			}
+			if selector.Matches(labels.Set(shard.Labels)) {
+				score += int64(placement.Preferred[i].Weight)
+			}
+		}
+	}
+	return score, nil
+}
+
+// ValidatePlacement validates the selectors and weights of the given placement.
+func ValidatePlacement(placement *tenancyv1alpha1.ClusterWorkspacePlacement, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if placement.Required != nil {
+		errs = append(errs, metav1validation.ValidateLabelSelector(placement.Required, fldPath.Child("required"))...)
+	}
+	for i, preferred := range placement.Preferred {
+		if preferred.Weight < 1 || preferred.Weight > 100 {
+			errs = append(errs, field.Invalid(fldPath.Child("preferred").Index(i).Child("weight"), preferred.Weight, "must be in the range 1-100"))
+		}
+		errs = append(errs, metav1validation.ValidateLabelSelector(&placement.Preferred[i].Selector, fldPath.Child("preferred").Index(i).Child("selector"))...)
+	}
+	return errs
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workspacetype
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+)
+
+func TestPlacements(t *testing.T) {
+	region := func(region string) metav1.LabelSelector {
+		return metav1.LabelSelector{MatchLabels: map[string]string{"topology.kubernetes.io/region": region}}
+	}
+	zone := func(zone string) metav1.LabelSelector {
+		return metav1.LabelSelector{MatchLabels: map[string]string{"topology.kubernetes.io/zone": zone}}
+	}
+	eu := region("eu-west-1")
+	placements := []*tenancyv1alpha1.ClusterWorkspacePlacement{
+		{Required: &eu, Preferred: []tenancyv1alpha1.PreferredShardSelector{{Weight: 10, Selector: zone("eu-west-1a")}}},
+		{Preferred: []tenancyv1alpha1.PreferredShardSelector{{Weight: 5, Selector: zone("eu-west-1b")}, {Weight: 20, Selector: zone("eu-west-1a")}}},
+	}
+	shard := func(region, zone string) *tenancyv1alpha1.WorkspaceShard {
+		return &tenancyv1alpha1.WorkspaceShard{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{
+			"topology.kubernetes.io/region": region,
+			"topology.kubernetes.io/zone":   zone,
+		}}}
+	}
+
+	for _, tt := range []struct {
+		shard     *tenancyv1alpha1.WorkspaceShard
+		satisfied bool
+		score     int64
+	}{
+		{shard: shard("eu-west-1", "eu-west-1a"), satisfied: true, score: 30},
+		{shard: shard("eu-west-1", "eu-west-1b"), satisfied: true, score: 5},
+		{shard: shard("eu-west-1", "eu-west-1c"), satisfied: true, score: 0},
+		{shard: shard("us-east-1", "us-east-1a"), satisfied: false, score: 0},
+	} {
+		satisfied, err := SatisfiesPlacements(tt.shard, placements)
+		require.NoError(t, err)
+		require.Equal(t, tt.satisfied, satisfied, "shard %v", tt.shard.Labels)
+		score, err := PlacementScore(tt.shard, placements)
+		require.NoError(t, err)
+		require.Equal(t, tt.score, score, "shard %v", tt.shard.Labels)
+	}
+
+	satisfied, err := SatisfiesPlacements(shard("us-east-1", "us-east-1a"), nil)
+	require.NoError(t, err)
+	require.True(t, satisfied, "no placement is satisfied by any shard")
+}
+
+func TestValidatePlacement(t *testing.T) {
+	require.Empty(t, ValidatePlacement(&tenancyv1alpha1.ClusterWorkspacePlacement{
+		Required:  &metav1.LabelSelector{MatchLabels: map[string]string{"topology.kubernetes.io/region": "eu-west-1"}},
+		Preferred: []tenancyv1alpha1.PreferredShardSelector{{Weight: 100}},
+	}, field.NewPath("spec", "placement")))
+
+	errs := ValidatePlacement(&tenancyv1alpha1.ClusterWorkspacePlacement{
+		Required: &metav1.LabelSelector{MatchLabels: map[string]string{"topology.kubernetes.io/region": "eu west"}},
+		Preferred: []tenancyv1alpha1.PreferredShardSelector{
+			{Weight: 0},
+			{Weight: 101, Selector: metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "topology.kubernetes.io/zone", Operator: "Near"}}}},
+		},
+	}, field.NewPath("spec", "placement"))
+	var paths []string
+	for _, err := range errs {
+		paths = append(paths, err.Field)
+	}
+	require.Equal(t, []string{
+		"spec.placement.required.matchLabels",
+		"spec.placement.preferred[0].weight",
+		"spec.placement.preferred[1].weight",
+		"spec.placement.preferred[1].selector.matchExpressions[0].operator",
+	}, paths)
+}
@@ -0,0 +1,241 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workspacetype
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilcache "k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+	tenancyinformer "github.com/kcp-dev/kcp/pkg/client/informers/externalversions/tenancy/v1alpha1"
+)
+
+const (
+	// UniversalType is the type of ClusterWorkspaces not specifying one. Its
+	// ClusterWorkspaceType is optional.
+	UniversalType = "Universal"
+
+	// DefaultMaxResolutions is the default number of resolutions a Resolver caches.
+	DefaultMaxResolutions = 10000
+
+	byLogicalCluster = "workspacetype-resolver-by-logical-cluster"
+
+	// resolutionTTL is the time a resolution is cached for after its last use.
+	resolutionTTL = 10 * time.Minute
+)
+
+// TypeName returns the type of the given ClusterWorkspace, defaulting to UniversalType.
+func TypeName(ws *tenancyv1alpha1.ClusterWorkspace) string {
+	if ws.Spec.Type == "" {
+		return UniversalType
+	}
+	return ws.Spec.Type
+}
+
+// Resolver resolves the ClusterWorkspaceType of ClusterWorkspaces, walking up the ancestor
+// workspaces for types published for cross-workspace use.
+//
+// Resolutions, including the ones not finding a type, are cached until a
+// ClusterWorkspaceType of the same name changes in the logical cluster resolved for or in
+// one of its ancestors, or until they are unused for some time, such that the admission
+// plugins and controllers sharing a Resolver do not walk the ancestors on every request.
+type Resolver struct {
+	typeIndexer cache.Indexer
+
+	lock sync.Mutex
+	// generation is incremented on every invalidation, such that a resolution racing
+	// with an invalidation is not cached.
+	generation uint64
+	resolved   *utilcache.LRUExpireCache
+	synced     func() bool
+}
+
+// resolutionKey identifies the resolution of a type name in a logical cluster.
+type resolutionKey struct {
+	clusterName string
+	name        string
+}
+
+// resolution is a cached resolution result.
+type resolution struct {
+	cwt *tenancyv1alpha1.ClusterWorkspaceType
+	err error
+}
+
+// NewResolver returns a Resolver caching at most maxResolutions resolutions.
+func NewResolver(typeInformer tenancyinformer.ClusterWorkspaceTypeInformer, maxResolutions int) (*Resolver, error) {
+	if _, found := typeInformer.Informer().GetIndexer().GetIndexers()[byLogicalCluster]; !found {
+		if err := typeInformer.Informer().AddIndexers(cache.Indexers{
+			byLogicalCluster: indexByLogicalCluster,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	r := newResolver(typeInformer.Informer().GetIndexer(), utilcache.NewLRUExpireCache(maxResolutions))
+	r.synced = typeInformer.Informer().HasSynced
+
+	typeInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { r.invalidate(obj) },
+		UpdateFunc: func(_, obj interface{}) { r.invalidate(obj) },
+		DeleteFunc: func(obj interface{}) { r.invalidate(obj) },
+	})
+
+	return r, nil
+}
+
+func newResolver(typeIndexer cache.Indexer, resolved *utilcache.LRUExpireCache) *Resolver {
+	return &Resolver{
+		typeIndexer: typeIndexer,
+		resolved:    resolved,
+		synced:      func() bool { return true },
+	}
+}
+
+// indexByLogicalCluster indexes ClusterWorkspaceTypes by their logical cluster.
+func indexByLogicalCluster(obj interface{}) ([]string, error) {
+	metaObj, ok := obj.(metav1.Object)
+	if !ok {
+		return []string{}, fmt.Errorf("obj is supposed to be a metav1.Object, but is %T", obj)
+	}
+	return []string{metaObj.GetClusterName()}, nil
+}
+
+// HasSynced returns true when the ClusterWorkspaceType informer has synced.
+func (r *Resolver) HasSynced() bool {
+	return r.synced()
+}
+
+// Resolve returns the ClusterWorkspaceType of the given type name for a ClusterWorkspace in
+// the given logical cluster. Types of the cluster itself take precedence, followed by types
+// of the ancestor workspaces that are published for cross-workspace use. It returns a
+// NotFound error if there is none. The returned ClusterWorkspaceType must not be mutated.
+func (r *Resolver) Resolve(clusterName, typeName string) (*tenancyv1alpha1.ClusterWorkspaceType, error) {
+	key := resolutionKey{clusterName: clusterName, name: strings.ToLower(typeName)}
+
+	r.lock.Lock()
+	if cached, found := r.resolved.Get(key); found {
+		// Touch the resolution to postpone its eviction.
+		r.resolved.Add(key, cached, resolutionTTL)
+		r.lock.Unlock()
+		return cached.(*resolution).cwt, cached.(*resolution).err
+	}
+	generation := r.generation
+	r.lock.Unlock()
+
+	cwt, err := r.resolve(key)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.generation == generation {
+		r.resolved.Add(key, &resolution{cwt: cwt, err: err}, resolutionTTL)
+	}
+	return cwt, err
+}
+
+func (r *Resolver) resolve(key resolutionKey) (*tenancyv1alpha1.ClusterWorkspaceType, error) {
+	cwt, err := r.getType(key.clusterName, key.name)
+	if err == nil || !apierrors.IsNotFound(err) {
+		return cwt, err
+	}
+
+	for current := key.clusterName; current != helper.RootCluster && !strings.HasPrefix(current, helper.LocalSystemClusterPrefix); {
+		parent, err := helper.ParentClusterName(current)
+		if err != nil {
+			break
+		}
+		current = parent
+
+		cwt, err := r.getType(current, key.name)
+		if apierrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if len(cwt.Spec.AllowedWorkspaces) > 0 || len(cwt.Spec.AllowedGroups) > 0 {
+			return cwt, nil
+		}
+	}
+
+	return nil, apierrors.NewNotFound(tenancyv1alpha1.Resource("clusterworkspacetypes"), key.name)
+}
+
+func (r *Resolver) getType(clusterName, name string) (*tenancyv1alpha1.ClusterWorkspaceType, error) {
+	objs, err := r.typeIndexer.ByIndex(byLogicalCluster, clusterName)
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range objs {
+		if cwt, ok := obj.(*tenancyv1alpha1.ClusterWorkspaceType); ok && cwt.Name == name {
+			return cwt, nil
+		}
+	}
+	return nil, apierrors.NewNotFound(tenancyv1alpha1.Resource("clusterworkspacetypes"), name)
+}
+
+// invalidate evicts the resolutions the given ClusterWorkspaceType can change, i.e. the
+// ones of its name in its logical cluster and in the descendants of it.
+func (r *Resolver) invalidate(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	cwt, ok := obj.(*tenancyv1alpha1.ClusterWorkspaceType)
+	if !ok {
+		runtime.HandleError(fmt.Errorf("obj is supposed to be a ClusterWorkspaceType, but is %T", obj))
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.generation++
+	for _, k := range r.resolved.Keys() {
+		key := k.(resolutionKey)
+		if key.name == cwt.Name && isSelfOrAncestor(cwt.ClusterName, key.clusterName) {
+			r.resolved.Remove(key)
+		}
+	}
+}
+
+// isSelfOrAncestor returns whether the given logical cluster is the given descendant
+// or one of its ancestors.
+func isSelfOrAncestor(clusterName, descendant string) bool {
+	for current := descendant; ; {
+		if current == clusterName {
+			return true
+		}
+		if current == helper.RootCluster || strings.HasPrefix(current, helper.LocalSystemClusterPrefix) {
+			return false
+		}
+		parent, err := helper.ParentClusterName(current)
+		if err != nil {
+			return false
+		}
+		current = parent
+	}
+}
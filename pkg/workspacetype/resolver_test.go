@@ -0,0 +1,92 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workspacetype
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilcache "k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/client-go/tools/cache"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+)
+
+func TestResolver(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{byLogicalCluster: indexByLogicalCluster})
+	r := newResolver(indexer, utilcache.NewLRUExpireCache(10))
+
+	published := &tenancyv1alpha1.ClusterWorkspaceType{
+		ObjectMeta: metav1.ObjectMeta{ClusterName: "root:org", Name: "team"},
+		Spec:       tenancyv1alpha1.ClusterWorkspaceTypeSpec{AllowedWorkspaces: []string{"*"}},
+	}
+	local := &tenancyv1alpha1.ClusterWorkspaceType{
+		ObjectMeta: metav1.ObjectMeta{ClusterName: "org:a", Name: "team"},
+	}
+	unpublished := &tenancyv1alpha1.ClusterWorkspaceType{
+		ObjectMeta: metav1.ObjectMeta{ClusterName: "root:org", Name: "private"},
+	}
+	for _, cwt := range []*tenancyv1alpha1.ClusterWorkspaceType{published, unpublished} {
+		require.NoError(t, indexer.Add(cwt))
+	}
+
+	resolve := func(clusterName, typeName string) *tenancyv1alpha1.ClusterWorkspaceType {
+		t.Helper()
+		cwt, err := r.Resolve(clusterName, typeName)
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		require.NoError(t, err)
+		return cwt
+	}
+
+	require.Equal(t, published, resolve("root:org", "Team"), "types of the workspace itself are found")
+	require.Equal(t, published, resolve("org:a", "Team"), "published types of ancestors are found")
+	require.Equal(t, published, resolve("org:c", "Team"), "published types of ancestors are found")
+	require.Nil(t, resolve("org:a", "Private"), "unpublished types of ancestors are not found")
+	require.Nil(t, resolve("root:other", "Team"), "types of other workspaces are not found")
+	require.Nil(t, resolve("org:a", UniversalType))
+
+	// types of the workspace itself take precedence, once the cache is invalidated
+	require.NoError(t, indexer.Add(local))
+	require.Equal(t, published, resolve("org:a", "Team"), "resolutions are cached")
+	r.invalidate(local)
+	require.Equal(t, local, resolve("org:a", "Team"))
+	require.Equal(t, published, resolve("org:c", "Team"), "siblings are not invalidated")
+	require.Equal(t, published, resolve("root:org", "Team"), "ancestors are not invalidated")
+
+	// deleting a type invalidates the workspace and its descendants
+	require.NoError(t, indexer.Delete(published))
+	r.invalidate(cache.DeletedFinalStateUnknown{Key: "root:org|team", Obj: published})
+	require.Nil(t, resolve("root:org", "Team"))
+	require.Nil(t, resolve("org:c", "Team"))
+	require.Equal(t, local, resolve("org:a", "Team"))
+
+	// types of other names are not invalidated
+	require.NoError(t, indexer.Delete(unpublished))
+	r.invalidate(unpublished)
+	_, cached := r.resolved.Get(resolutionKey{clusterName: "org:a", name: "team"})
+	require.True(t, cached)
+}
+
+func TestTypeName(t *testing.T) {
+	require.Equal(t, UniversalType, TypeName(&tenancyv1alpha1.ClusterWorkspace{}))
+	require.Equal(t, "Organization", TypeName(&tenancyv1alpha1.ClusterWorkspace{Spec: tenancyv1alpha1.ClusterWorkspaceSpec{Type: "Organization"}}))
+}
@@ -121,7 +121,9 @@ func NewOrganizationFixture(t *testing.T, server RunningServer) (orgClusterName
 	require.NoError(t, err, "failed to create organization workspace")
 
 	t.Cleanup(func() {
-		err := clusterClient.Cluster(helper.RootCluster).TenancyV1alpha1().ClusterWorkspaces().Delete(ctx, org.Name, metav1.DeleteOptions{})
+		// the child workspaces of the fixture may still be terminating, delete them with the organization
+		foreground := metav1.DeletePropagationForeground
+		err := clusterClient.Cluster(helper.RootCluster).TenancyV1alpha1().ClusterWorkspaces().Delete(ctx, org.Name, metav1.DeleteOptions{PropagationPolicy: &foreground})
 		if apierrors.IsNotFound(err) {
 			return // ignore not found error
 		}
@@ -71,7 +71,8 @@ func TestClusterController(t *testing.T) {
 					ObjectMeta: metav1.ObjectMeta{
 						Name: "timothy",
 						Labels: map[string]string{
-							nscontroller.ClusterLabel: sinkClusterName,
+							nscontroller.ClusterLabel:                     sinkClusterName,
+							nscontroller.ClusterLabelFor(sinkClusterName): "",
 						},
 					},
 					Spec: wildwestv1alpha1.CowboySpec{Intent: "yeehaw"},
@@ -0,0 +1,104 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tenancyconversion
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	tenancyv1beta1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1beta1"
+	kcp "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
+	"github.com/kcp-dev/kcp/test/e2e/framework"
+)
+
+func TestRoundTripThroughTheAPI(t *testing.T) {
+	t.Parallel()
+
+	f := framework.NewKcpFixture(t, framework.KcpConfig{Name: "main"})
+	server := f.Servers["main"]
+
+	ctx := context.Background()
+	if deadline, ok := t.Deadline(); ok {
+		withDeadline, cancel := context.WithDeadline(ctx, deadline)
+		t.Cleanup(cancel)
+		ctx = withDeadline
+	}
+
+	cfg, err := server.Config("system:admin")
+	require.NoError(t, err)
+	kcpClusterClient, err := kcp.NewClusterForConfig(cfg)
+	require.NoError(t, err)
+	dynamicClusterClient, err := dynamic.NewClusterForConfig(cfg)
+	require.NoError(t, err)
+
+	orgClusterName := framework.NewOrganizationFixture(t, server)
+	kcpClient := kcpClusterClient.Cluster(orgClusterName)
+	betaTypes := dynamicClusterClient.Cluster(orgClusterName).Resource(tenancyv1beta1.SchemeGroupVersion.WithResource("clusterworkspacetypes"))
+	betaWorkspaces := dynamicClusterClient.Cluster(orgClusterName).Resource(tenancyv1beta1.SchemeGroupVersion.WithResource("clusterworkspaces"))
+
+	t.Logf("Create a v1beta1 ClusterWorkspaceType with a structured initializer")
+	_, err = betaTypes.Create(ctx, &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": tenancyv1beta1.SchemeGroupVersion.String(),
+		"kind":       "ClusterWorkspaceType",
+		"metadata":   map[string]interface{}{"name": "conversion"},
+		"spec": map[string]interface{}{
+			"initializers": []interface{}{map[string]interface{}{"domain": "example.dev", "name": "conversion"}},
+		},
+	}}, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	t.Logf("Read it as v1alpha1")
+	alphaType, err := kcpClient.TenancyV1alpha1().ClusterWorkspaceTypes().Get(ctx, "conversion", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []tenancyv1alpha1.ClusterWorkspaceInitializer{"example.dev/conversion"}, alphaType.Spec.Initializers)
+
+	t.Logf("Create a v1alpha1 ClusterWorkspace of that type")
+	_, err = kcpClient.TenancyV1alpha1().ClusterWorkspaces().Create(ctx, &tenancyv1alpha1.ClusterWorkspace{
+		ObjectMeta: metav1.ObjectMeta{Name: "conversion"},
+		Spec:       tenancyv1alpha1.ClusterWorkspaceSpec{Type: "Conversion"},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	t.Logf("Read it as v1beta1")
+	beta, err := betaWorkspaces.Get(ctx, "conversion", metav1.GetOptions{})
+	require.NoError(t, err)
+	typeName, _, err := unstructured.NestedString(beta.Object, "spec", "type", "name")
+	require.NoError(t, err)
+	require.Equal(t, "Conversion", typeName)
+
+	t.Logf("Update it through v1beta1 and read it back as v1alpha1")
+	require.NoError(t, unstructured.SetNestedField(beta.Object, true, "spec", "readOnly"))
+	_, err = betaWorkspaces.Update(ctx, beta, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	alpha, err := kcpClient.TenancyV1alpha1().ClusterWorkspaces().Get(ctx, "conversion", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.True(t, alpha.Spec.ReadOnly)
+	require.Equal(t, "Conversion", alpha.Spec.Type)
+
+	t.Logf("List them as v1beta1")
+	list, err := betaWorkspaces.List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, list.Items, 1)
+	require.Equal(t, tenancyv1beta1.SchemeGroupVersion.String(), list.Items[0].GetAPIVersion())
+}
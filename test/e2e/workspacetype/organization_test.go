@@ -0,0 +1,86 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workspace
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	configsystemexports "github.com/kcp-dev/kcp/config/systemexports"
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+	tenancyv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1alpha1/helper"
+	kcpclientset "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
+	"github.com/kcp-dev/kcp/test/e2e/framework"
+	"github.com/kcp-dev/kcp/third_party/conditions/util/conditions"
+)
+
+// TestOrganizationWorkspaceInitialization checks that Organization and Universal workspaces
+// are initialized end to end, including the APIBindings to kcp's own APIExports, which
+// must not be rejected for conflicting with the CRDs installed by the same initializers.
+func TestOrganizationWorkspaceInitialization(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	t.Cleanup(cancelFunc)
+
+	const serverName = "main"
+	f := framework.NewKcpFixture(t,
+		framework.KcpConfig{
+			Name: serverName,
+		},
+	)
+	server := f.Servers[serverName]
+	cfg, err := server.Config("system:admin")
+	require.NoError(t, err)
+	kcpClusterClient, err := kcpclientset.NewClusterForConfig(cfg)
+	require.NoError(t, err, "failed to construct client for server")
+
+	t.Logf("Create an Organization workspace and wait for it to become ready")
+	orgClusterName := framework.NewOrganizationFixture(t, server)
+	_, orgName, err := helper.ParseLogicalClusterName(orgClusterName)
+	require.NoError(t, err)
+
+	t.Logf("Expect the Organization workspace to be bootstrapped")
+	org, err := kcpClusterClient.Cluster(helper.RootCluster).TenancyV1alpha1().ClusterWorkspaces().Get(ctx, orgName, metav1.GetOptions{})
+	require.NoError(t, err)
+	require.True(t, conditions.IsTrue(org, tenancyv1alpha1.WorkspaceTypeBootstrapped), "workspace type is not bootstrapped: %v", conditions.Get(org, tenancyv1alpha1.WorkspaceTypeBootstrapped))
+	requireSystemBindings(ctx, t, kcpClusterClient.Cluster(orgClusterName), configsystemexports.ForType("Organization"))
+
+	t.Logf("Expect the ClusterWorkspaceTypes of the Organization type to be created")
+	_, err = kcpClusterClient.Cluster(orgClusterName).TenancyV1alpha1().ClusterWorkspaceTypes().Get(ctx, "universal", metav1.GetOptions{})
+	require.NoError(t, err)
+
+	t.Logf("Create a Universal workspace in the Organization workspace and wait for it to become ready")
+	wsClusterName := framework.NewWorkspaceFixture(t, server, orgClusterName, "Universal")
+	requireSystemBindings(ctx, t, kcpClusterClient.Cluster(wsClusterName), configsystemexports.ForType("Universal"))
+}
+
+// requireSystemBindings checks that the workspace binds the given exports of the root workspace.
+func requireSystemBindings(ctx context.Context, t *testing.T, client kcpclientset.Interface, exports []configsystemexports.Export) {
+	for _, export := range exports {
+		binding, err := client.ApisV1alpha1().APIBindings().Get(ctx, export.Name, metav1.GetOptions{})
+		require.NoError(t, err, "failed to get APIBinding %s", export.Name)
+		require.NotNil(t, binding.Spec.Reference.Root, "APIBinding %s does not reference the root workspace", export.Name)
+		require.Equal(t, export.Name, binding.Spec.Reference.Root.ExportName)
+		require.Equal(t, apisv1alpha1.APIBindingConflictPolicyLocalWins, binding.Spec.ConflictPolicy)
+	}
+}